@@ -17,12 +17,17 @@ import (
 
 	"github.com/joho/godotenv"
 	configaccess "github.com/router-for-me/CLIProxyAPI/v6/internal/access/config_access"
+	oidcaccess "github.com/router-for-me/CLIProxyAPI/v6/internal/access/oidc_access"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/buildinfo"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/cmd"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credcrypt"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/logging"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/managementasset"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/misc"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/providerspend"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/replay"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/secrets"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/store"
 	_ "github.com/router-for-me/CLIProxyAPI/v6/internal/translator"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
@@ -51,6 +56,14 @@ func init() {
 // It parses command-line flags, loads configuration, and starts the appropriate
 // service based on the provided flags (login, codex-login, or server mode).
 func main() {
+	// Subcommands run before the version banner so their output can be piped.
+	if len(os.Args) > 1 && os.Args[1] == "usage" {
+		os.Exit(cmd.RunUsage(os.Args[2:], DefaultConfigPath))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "credentials" {
+		os.Exit(cmd.RunCredentials(os.Args[2:], DefaultConfigPath))
+	}
+
 	fmt.Printf("CLIProxyAPI Version: %s, Commit: %s, BuiltAt: %s\n", buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate)
 
 	// Command-line flags to control the application's behavior.
@@ -66,6 +79,9 @@ func main() {
 	var vertexImport string
 	var configPath string
 	var password string
+	var replayLog string
+	var replayOpts replay.Options
+	var validateOnly bool
 
 	// Define command-line flags for different operation modes.
 	flag.BoolVar(&login, "login", false, "Login Google Account")
@@ -79,6 +95,11 @@ func main() {
 	flag.StringVar(&projectID, "project_id", "", "Project ID (Gemini only, not required)")
 	flag.StringVar(&configPath, "config", DefaultConfigPath, "Configure File Path")
 	flag.StringVar(&vertexImport, "vertex-import", "", "Import Vertex service account key JSON file")
+	flag.StringVar(&replayLog, "replay", "", "Replay a stored request log file against the running server")
+	flag.StringVar(&replayOpts.Model, "replay-model", "", "Override the model when replaying a request log")
+	flag.StringVar(&replayOpts.AuthID, "replay-auth", "", "Pin the replayed request to the given auth ID")
+	flag.BoolVar(&replayOpts.DryRun, "replay-dry-run", false, "Print the reconstructed request instead of sending it")
+	flag.BoolVar(&validateOnly, "validate", false, "Validate the config file and exit without starting the server")
 	flag.StringVar(&password, "password", "", "")
 
 	flag.CommandLine.Usage = func() {
@@ -111,6 +132,11 @@ func main() {
 	// Parse the command-line flags.
 	flag.Parse()
 
+	if validateOnly {
+		// Validate before any store bootstrap so the check has no side effects.
+		os.Exit(cmd.DoValidateConfig(configPath))
+	}
+
 	// Core application variables.
 	var err error
 	var cfg *config.Config
@@ -405,12 +431,78 @@ func main() {
 	usage.SetStatisticsEnabled(cfg.UsageStatisticsEnabled)
 	coreauth.SetQuotaCooldownDisabled(cfg.DisableCooling)
 	if err := usage.ConfigureDatabase(usage.DatabaseOptions{
-		Enabled:       cfg.UsageDatabase.Enabled,
-		Path:          cfg.UsageDatabase.Path,
-		RetentionDays: cfg.UsageDatabase.RetentionDays,
+		Enabled:                 cfg.UsageDatabase.Enabled,
+		Path:                    cfg.UsageDatabase.Path,
+		RetentionDays:           cfg.UsageDatabase.RetentionDays,
+		RequestsRetentionDays:   cfg.UsageDatabase.RequestsRetentionDays,
+		DailyRetentionDays:      cfg.UsageDatabase.DailyRetentionDays,
+		ProviderRetentionDays:   cfg.UsageDatabase.ProviderRetentionDays,
+		CredentialRetentionDays: cfg.UsageDatabase.CredentialRetentionDays,
+		ReadOnly:                cfg.UsageDatabase.ReadOnly,
+		QueueSize:               cfg.UsageDatabase.QueueSize,
+		OverflowPolicy:          cfg.UsageDatabase.OverflowPolicy,
+		SQLite:                  usage.SQLiteOptionsFromConfig(cfg.UsageDatabase.SQLite),
+		HashAccountEmail:        cfg.UsageDatabase.HashAccountEmail,
+		ModelPrices:             usage.ModelPricesFromConfig(cfg.UsageDatabase.ModelPrices),
+		SpendCaps:               usage.SpendCapsFromConfig(cfg.APIKeyPolicies),
+		TeamSpendCaps:           usage.TeamSpendCapsFromConfig(cfg.Teams),
+		FingerprintSalt:         usage.FingerprintSaltFromConfig(cfg.UsageDatabase),
+		MirrorDSN:               usage.MirrorDSNFromConfig(cfg.UsageDatabase),
+		Encryption:              usage.DatabaseEncryptionFromConfig(cfg.UsageDatabase.Encryption),
 	}); err != nil {
 		log.WithError(err).Warn("failed to initialize usage database")
 	}
+	providerspend.SetCaps(cfg.ProviderSpendCaps)
+	if err := usage.RefreshProviderSpend(context.Background()); err != nil && len(cfg.ProviderSpendCaps) > 0 {
+		log.WithError(err).Warn("provider spend caps are not enforced")
+	}
+	if err := usage.ConfigureStatsD(usage.StatsDOptions{
+		Enabled: cfg.StatsD.Enabled,
+		Address: cfg.StatsD.Address,
+		Prefix:  cfg.StatsD.Prefix,
+		Flavor:  cfg.StatsD.Flavor,
+		Tags:    cfg.StatsD.Tags,
+	}); err != nil {
+		log.WithError(err).Warn("failed to initialize statsd metrics")
+	}
+	if err := usage.ConfigureUsageSinks(usage.SinkOptionsFromConfig(cfg.UsageSinks)); err != nil {
+		log.WithError(err).Warn("failed to initialize usage sinks")
+	}
+	if err := usage.ConfigureKafka(usage.KafkaOptionsFromConfig(cfg.Kafka)); err != nil {
+		log.WithError(err).Warn("failed to initialize kafka usage publisher")
+	}
+	if err := usage.ConfigureArchive(usage.ArchiveOptionsFromConfig(cfg.UsageDatabase.Archive)); err != nil {
+		log.WithError(err).Warn("failed to initialize usage archive")
+	}
+	if err := usage.ConfigureReports(usage.ReportOptionsFromConfig(cfg.UsageDatabase.Reports)); err != nil {
+		log.WithError(err).Warn("failed to initialize usage reports")
+	}
+	if err := usage.ConfigureOTLPExport(usage.OTLPExportOptions{
+		Enabled:            cfg.OTLP.IsEnabled(),
+		Endpoint:           cfg.OTLP.Endpoint,
+		Endpoints:          cfg.OTLP.Endpoints,
+		SRVName:            cfg.OTLP.SRV.Name,
+		SRVScheme:          cfg.OTLP.SRV.Scheme,
+		SRVPath:            cfg.OTLP.SRV.Path,
+		Protocol:           cfg.OTLP.Protocol,
+		Headers:            cfg.OTLP.Headers,
+		CAFile:             cfg.OTLP.TLSCAFile,
+		InsecureSkipVerify: cfg.OTLP.TLSInsecureSkipVerify,
+		Timeout:            time.Duration(cfg.OTLP.TimeoutMs) * time.Millisecond,
+		BatchSize:          cfg.OTLP.BatchSize,
+		FlushInterval:      time.Duration(cfg.OTLP.FlushIntervalMs) * time.Millisecond,
+		SpoolDir:           cfg.OTLP.Spool.Dir,
+		SpoolMaxBytes:      int64(cfg.OTLP.Spool.MaxSizeMB) << 20,
+		SpoolMaxAge:        time.Duration(cfg.OTLP.Spool.MaxAgeHours) * time.Hour,
+		Sampling:           usage.OTLPSamplingFromConfig(cfg.OTLP.Sampling),
+		ResourceAttributes: cfg.OTLP.ResourceAttributes,
+		ExcludeEvents:      cfg.OTLP.ExcludeEvents,
+	}); err != nil {
+		log.WithError(err).Warn("failed to configure OTLP export")
+	}
+	if err := secrets.Configure(secrets.OptionsFromConfig(cfg.Secrets)); err != nil {
+		log.WithError(err).Warn("failed to initialize secrets backend")
+	}
 
 	if err = logging.ConfigureLogOutput(cfg.LoggingToFile, cfg.LogsMaxTotalSizeMB); err != nil {
 		log.Errorf("failed to configure log output: %v", err)
@@ -430,6 +522,24 @@ func main() {
 	}
 	managementasset.SetCurrentConfig(cfg)
 
+	if err = credcrypt.Configure(credcrypt.Options{
+		Enabled:    cfg.CredentialEncryption.Enabled,
+		KeyEnv:     cfg.CredentialEncryption.KeyEnv,
+		KeyFile:    cfg.CredentialEncryption.KeyFile,
+		KeyCommand: cfg.CredentialEncryption.KeyCommand,
+	}); err != nil {
+		// Refuse to start rather than silently writing credentials in plaintext.
+		log.Errorf("failed to load credential encryption key: %v", err)
+		return
+	}
+	if credcrypt.Enabled() && !usePostgresStore && !useObjectStore && !useGitStore {
+		if migrated, errMigrate := credcrypt.Migrate(cfg.AuthDir); errMigrate != nil {
+			log.Warnf("failed to encrypt existing auth files: %v", errMigrate)
+		} else if migrated > 0 {
+			log.Infof("encrypted %d plaintext auth file(s)", migrated)
+		}
+	}
+
 	// Create login options to be used in authentication flows.
 	options := &cmd.LoginOptions{
 		NoBrowser: noBrowser,
@@ -448,10 +558,14 @@ func main() {
 
 	// Register built-in access providers before constructing services.
 	configaccess.Register()
+	oidcaccess.Register()
 
 	// Handle different command modes based on the provided flags.
 
-	if vertexImport != "" {
+	if replayLog != "" {
+		// Handle request log replay
+		cmd.DoReplay(cfg, replayLog, replayOpts, password)
+	} else if vertexImport != "" {
 		// Handle Vertex service account import
 		cmd.DoVertexImport(cfg, vertexImport)
 	} else if login {
@@ -0,0 +1,45 @@
+// Command usage-sink is a minimal external usage sink: it appends every usage event
+// it receives from the proxy to a JSON Lines file. Register it under usage-sinks:
+//
+//	usage-sinks:
+//	  - name: "file"
+//	    command: "/usr/local/bin/usage-sink"
+//	    args: ["/var/log/cliproxy/usage.jsonl"]
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: usage-sink <output.jsonl>")
+		os.Exit(2)
+	}
+	f, err := os.OpenFile(os.Args[1], os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	out := bufio.NewWriter(f)
+	encoder := json.NewEncoder(out)
+
+	err = coreusage.ServeSink(os.Stdin, os.Stdout, func(ev coreusage.SinkEvent) error {
+		if errEncode := encoder.Encode(ev); errEncode != nil {
+			return errEncode
+		}
+		return out.Flush()
+	})
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,408 @@
+// Package oidcaccess authenticates client requests carrying JWT bearer tokens issued
+// by an OIDC provider, so teams can call the proxy with their SSO tokens.
+package oidcaccess
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	sdkaccess "github.com/router-for-me/CLIProxyAPI/v6/sdk/access"
+	sdkconfig "github.com/router-for-me/CLIProxyAPI/v6/sdk/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// jwksTTL is how long fetched signing keys are trusted before a refresh.
+	jwksTTL = time.Hour
+	// jwksMinRefresh throttles refreshes triggered by tokens with an unknown key ID.
+	jwksMinRefresh = time.Minute
+	// clockSkew tolerates small clock differences when checking exp and nbf.
+	clockSkew = time.Minute
+)
+
+var registerOnce sync.Once
+
+// Register makes the OIDC provider available to the access manager.
+func Register() {
+	registerOnce.Do(func() {
+		sdkaccess.RegisterProvider(sdkconfig.AccessProviderTypeOIDC, newProvider)
+	})
+}
+
+type provider struct {
+	name         string
+	issuer       string
+	audiences    []string
+	anyAudience  bool
+	jwksURL      string
+	subjectClaim string
+	client       *http.Client
+	now          func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newProvider(cfg *sdkconfig.AccessProvider, _ *sdkconfig.SDKConfig) (sdkaccess.Provider, error) {
+	issuer, _ := cfg.Config["issuer"].(string)
+	issuer = strings.TrimSpace(issuer)
+	if issuer == "" {
+		return nil, errors.New("oidc: issuer is required")
+	}
+	p := &provider{
+		name:         cfg.Name,
+		issuer:       issuer,
+		subjectClaim: "sub",
+		client:       &http.Client{Timeout: 10 * time.Second},
+		now:          time.Now,
+	}
+	if p.name == "" {
+		p.name = issuer
+	}
+	if raw, ok := cfg.Config["jwks-url"].(string); ok {
+		p.jwksURL = strings.TrimSpace(raw)
+	}
+	if raw, ok := cfg.Config["subject-claim"].(string); ok && strings.TrimSpace(raw) != "" {
+		p.subjectClaim = strings.TrimSpace(raw)
+	}
+	switch audiences := cfg.Config["audiences"].(type) {
+	case []string:
+		p.audiences = audiences
+	case []any:
+		for _, aud := range audiences {
+			if s, ok := aud.(string); ok && s != "" {
+				p.audiences = append(p.audiences, s)
+			}
+		}
+	}
+	p.anyAudience, _ = cfg.Config["allow-any-audience"].(bool)
+	if len(p.audiences) == 0 && !p.anyAudience {
+		return nil, errors.New("oidc: audiences are required unless allow-any-audience is set")
+	}
+	return p, nil
+}
+
+func (p *provider) Identifier() string { return p.name }
+
+// Authenticate accepts "Authorization: Bearer <jwt>". Requests without a bearer
+// token, or with a token that is not a JWT from this issuer, are left to other
+// providers.
+func (p *provider) Authenticate(ctx context.Context, r *http.Request) (*sdkaccess.Result, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, sdkaccess.ErrNoCredentials
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return nil, sdkaccess.ErrNotHandled
+	}
+	token = strings.TrimSpace(token)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, sdkaccess.ErrNotHandled
+	}
+
+	var head struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	var claims map[string]any
+	if decodeSegment(parts[0], &head) != nil || decodeSegment(parts[1], &claims) != nil {
+		return nil, sdkaccess.ErrNotHandled
+	}
+	if iss, _ := claims["iss"].(string); iss != p.issuer {
+		return nil, sdkaccess.ErrNotHandled
+	}
+
+	key, err := p.signingKey(ctx, head.Kid)
+	if err != nil {
+		log.Warnf("oidc %s: %v", p.name, err)
+		return nil, sdkaccess.ErrInvalidCredential
+	}
+	if err = verifySignature(head.Alg, key, parts[0]+"."+parts[1], parts[2]); err != nil {
+		log.Debugf("oidc %s: rejected token: %v", p.name, err)
+		return nil, sdkaccess.ErrInvalidCredential
+	}
+	if err = p.validateClaims(claims); err != nil {
+		log.Debugf("oidc %s: rejected token: %v", p.name, err)
+		return nil, sdkaccess.ErrInvalidCredential
+	}
+	subject, _ := claims[p.subjectClaim].(string)
+	if subject == "" {
+		log.Debugf("oidc %s: rejected token without %q claim", p.name, p.subjectClaim)
+		return nil, sdkaccess.ErrInvalidCredential
+	}
+	return &sdkaccess.Result{
+		Provider:  p.name,
+		Principal: subject,
+		Metadata: map[string]string{
+			"source":  "authorization",
+			"issuer":  p.issuer,
+			"subject": subject,
+		},
+	}, nil
+}
+
+func (p *provider) validateClaims(claims map[string]any) error {
+	now := p.now()
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return errors.New("missing exp")
+	}
+	if now.After(time.Unix(exp, 0).Add(clockSkew)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(clockSkew).Before(time.Unix(nbf, 0)) {
+		return errors.New("token not yet valid")
+	}
+	if len(p.audiences) == 0 {
+		if p.anyAudience {
+			return nil
+		}
+		return errors.New("no audiences configured")
+	}
+	var tokenAudiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		tokenAudiences = []string{aud}
+	case []any:
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				tokenAudiences = append(tokenAudiences, s)
+			}
+		}
+	}
+	for _, want := range p.audiences {
+		for _, got := range tokenAudiences {
+			if want == got {
+				return nil
+			}
+		}
+	}
+	return errors.New("audience not accepted")
+}
+
+func numericClaim(claims map[string]any, name string) (int64, bool) {
+	v, ok := claims[name].(float64)
+	return int64(v), ok
+}
+
+// signingKey returns the key for kid, refreshing the JWKS when it is stale or
+// does not know kid yet.
+func (p *provider) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	key, found := p.lookup(kid)
+	stale := now.Sub(p.fetchedAt) > jwksTTL
+	if found && !stale {
+		return key, nil
+	}
+	if !stale && now.Sub(p.fetchedAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		if found {
+			// Keep serving with the cached keys while the issuer is unreachable.
+			return key, nil
+		}
+		return nil, err
+	}
+	p.keys, p.fetchedAt = keys, now
+	if key, found = p.lookup(kid); !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup finds kid in the cached keys; a token without kid matches a single-key set.
+func (p *provider) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *provider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := p.jwksURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := p.getJSON(ctx, strings.TrimRight(p.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, fmt.Errorf("discover jwks: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("discover jwks: no jwks_uri in openid-configuration")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Debugf("oidc %s: skipping jwk %q: %v", p.name, k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (p *provider) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: HTTP %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jwk is a JSON Web Key holding an RSA or EC public key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// verifySignature checks an RS*, PS* or ES* signature over signed.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature string) error {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+	var hash crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("alg %s does not match key type", alg)
+		}
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(pub, hash, digest, sig, nil)
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+	case strings.HasPrefix(alg, "ES"):
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("alg %s does not match key type", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid ECDSA signature length")
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+}
+
+func decodeSegment(segment string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
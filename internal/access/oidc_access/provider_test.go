@@ -0,0 +1,111 @@
+package oidcaccess
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sdkaccess "github.com/router-for-me/CLIProxyAPI/v6/sdk/access"
+	sdkconfig "github.com/router-for-me/CLIProxyAPI/v6/sdk/config"
+)
+
+func TestProviderAuthenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	issuer = server.URL
+
+	cfg := sdkconfig.SDKConfig{OIDCAuth: []sdkconfig.OIDCAuthProvider{{Name: "sso", Issuer: issuer, Audiences: []string{"proxy"}}}}
+	built, err := newProvider(cfg.OIDCAccessProviders()[0], &cfg)
+	if err != nil {
+		t.Fatalf("newProvider: %v", err)
+	}
+
+	sign := func(claims map[string]any) string {
+		head, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+		body, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(head) + "." + base64.RawURLEncoding.EncodeToString(body)
+		digest := sha256.Sum256([]byte(signed))
+		sig, errSign := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if errSign != nil {
+			t.Fatalf("sign: %v", errSign)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+	}
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	authenticate := func(token string) (*sdkaccess.Result, error) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return built.Authenticate(context.Background(), req)
+	}
+
+	res, err := authenticate(sign(map[string]any{"iss": issuer, "sub": "alice", "aud": []any{"other", "proxy"}, "exp": exp}))
+	if err != nil || res.Principal != "alice" || res.Provider != "sso" || res.Metadata["subject"] != "alice" {
+		t.Fatalf("valid token: res=%+v err=%v", res, err)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"static key", "sk-static", sdkaccess.ErrNotHandled},
+		{"other issuer", sign(map[string]any{"iss": "https://elsewhere", "sub": "bob", "exp": exp}), sdkaccess.ErrNotHandled},
+		{"expired", sign(map[string]any{"iss": issuer, "sub": "bob", "aud": "proxy", "exp": float64(time.Now().Add(-time.Hour).Unix())}), sdkaccess.ErrInvalidCredential},
+		{"wrong audience", sign(map[string]any{"iss": issuer, "sub": "bob", "aud": "other", "exp": exp}), sdkaccess.ErrInvalidCredential},
+		{"missing subject", sign(map[string]any{"iss": issuer, "aud": "proxy", "exp": exp}), sdkaccess.ErrInvalidCredential},
+	}
+	for _, tc := range cases {
+		if _, err = authenticate(tc.token); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	tampered := sign(map[string]any{"iss": issuer, "sub": "alice", "aud": "proxy", "exp": exp})
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	if _, err = authenticate(tampered); !errors.Is(err, sdkaccess.ErrInvalidCredential) {
+		t.Errorf("tampered signature: err = %v", err)
+	}
+}
+
+func TestNewProviderRequiresAudiences(t *testing.T) {
+	cfg := sdkconfig.SDKConfig{OIDCAuth: []sdkconfig.OIDCAuthProvider{{Issuer: "https://login.example.com"}}}
+	if _, err := newProvider(cfg.OIDCAccessProviders()[0], &cfg); err == nil {
+		t.Fatal("expected an error without audiences")
+	}
+
+	cfg.OIDCAuth[0].AllowAnyAudience = true
+	built, err := newProvider(cfg.OIDCAccessProviders()[0], &cfg)
+	if err != nil {
+		t.Fatalf("newProvider with allow-any-audience: %v", err)
+	}
+	claims := map[string]any{"exp": float64(time.Now().Add(time.Hour).Unix()), "aud": "anything"}
+	if err = built.(*provider).validateClaims(claims); err != nil {
+		t.Fatalf("allow-any-audience rejected token: %v", err)
+	}
+}
@@ -183,6 +183,9 @@ func accessProviderMap(cfg *config.Config) map[string]*sdkConfig.AccessProvider
 			}
 		}
 	}
+	for _, provider := range cfg.OIDCAccessProviders() {
+		result[providerIdentifier(provider)] = provider
+	}
 	return result
 }
 
@@ -202,7 +205,7 @@ func collectProviderEntries(cfg *config.Config) []*sdkConfig.AccessProvider {
 			entries = append(entries, inline)
 		}
 	}
-	return entries
+	return append(entries, cfg.OIDCAccessProviders()...)
 }
 
 func providerIdentifier(provider *sdkConfig.AccessProvider) string {
@@ -0,0 +1,32 @@
+// Package adminui embeds the built-in dashboard served under /ui. The dashboard is a
+// static single page that reads the management API with the key the user enters, so
+// it works without downloading the external control panel.
+package adminui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// PathPrefix is the route the dashboard is served from.
+const PathPrefix = "/ui"
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard assets below PathPrefix.
+func Handler() http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		// The embedded tree is fixed at build time; a missing directory is a build bug.
+		panic(err)
+	}
+	files := http.StripPrefix(PathPrefix, http.FileServer(http.FS(assets)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; connect-src 'self'; img-src 'self' data:")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,209 @@
+// Built-in dashboard for CLI Proxy API. It polls the management API with the key
+// stored in this browser; nothing is sent anywhere else.
+(function () {
+  "use strict";
+
+  var API = "/v0/management";
+  var KEY_STORAGE = "cliproxy.ui.management-key";
+  var REFRESH_MS = 10000;
+  var timer = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function key() { return localStorage.getItem(KEY_STORAGE) || ""; }
+
+  function fetchJSON(path) {
+    return fetch(API + path, { headers: { "X-Management-Key": key() } }).then(function (resp) {
+      if (resp.status === 401 || resp.status === 403) {
+        var err = new Error("management key rejected");
+        err.unauthorized = true;
+        throw err;
+      }
+      if (resp.status === 503) {
+        return null; // usage database disabled
+      }
+      if (!resp.ok) {
+        throw new Error(path + ": HTTP " + resp.status);
+      }
+      return resp.json();
+    });
+  }
+
+  function el(tag, text, className) {
+    var node = document.createElement(tag);
+    if (text !== undefined && text !== null) node.textContent = String(text);
+    if (className) node.className = className;
+    return node;
+  }
+
+  function num(n) { return (n || 0).toLocaleString(); }
+
+  function pct(n) { return ((n || 0) * 100).toFixed(1) + "%"; }
+
+  function when(ts) {
+    if (!ts) return "";
+    var d = new Date(ts);
+    return isNaN(d) ? ts : d.toLocaleString();
+  }
+
+  function card(label, value) {
+    var c = el("div", null, "card");
+    c.appendChild(el("div", label, "label"));
+    c.appendChild(el("div", value, "value"));
+    return c;
+  }
+
+  function fillTable(id, rows, empty) {
+    var body = $(id).querySelector("tbody");
+    body.replaceChildren();
+    if (!rows.length) {
+      var tr = el("tr");
+      var td = el("td", empty, "muted");
+      td.colSpan = $(id).querySelectorAll("th").length;
+      tr.appendChild(td);
+      body.appendChild(tr);
+      return;
+    }
+    rows.forEach(function (cells) {
+      var tr = el("tr");
+      cells.forEach(function (cell) {
+        if (cell instanceof Node) {
+          var td = el("td");
+          td.appendChild(cell);
+          tr.appendChild(td);
+        } else {
+          tr.appendChild(el("td", cell, typeof cell === "number" ? "num" : ""));
+        }
+      });
+      body.appendChild(tr);
+    });
+  }
+
+  function renderUsage(data) {
+    var usage = (data && data.usage) || {};
+    var totals = $("totals");
+    totals.replaceChildren(
+      card("Requests", num(usage.total_requests)),
+      card("Succeeded", num(usage.success_count)),
+      card("Failed", num(usage.failure_count)),
+      card("Tokens", num(usage.total_tokens))
+    );
+    var byHour = usage.requests_by_hour || {};
+    var hours = Object.keys(byHour).sort();
+    var max = hours.reduce(function (m, h) { return Math.max(m, byHour[h]); }, 0);
+    var bars = $("hourly");
+    bars.replaceChildren();
+    hours.forEach(function (h) {
+      var bar = el("div");
+      bar.style.height = max ? Math.max(1, (byHour[h] / max) * 100) + "%" : "1px";
+      bar.title = h + ": " + num(byHour[h]) + " requests";
+      bars.appendChild(bar);
+    });
+  }
+
+  function healthCell(health) {
+    if (!health) return el("span", "no traffic", "muted");
+    var text = health.status || "unknown";
+    var cls = "status-ok";
+    if (health.disabled) { text = "disabled"; cls = "status-bad"; }
+    else if (health.circuit_breaker === "open") { text = "circuit open"; cls = "status-bad"; }
+    else if (health.quota_exceeded) { text = "quota exceeded"; cls = "status-warn"; }
+    else if (health.unavailable || (health.cooling_models || []).length) { text = "cooling down"; cls = "status-warn"; }
+    return el("span", text, cls);
+  }
+
+  function renderCredentials(data) {
+    var rows = ((data && data.credentials) || []).map(function (c) {
+      return [c.provider, c.credential_label, healthCell(c.health), c.total_requests || 0,
+        pct(c.request_share), pct(c.failure_rate), pct(c.rate_limit_rate)];
+    });
+    fillTable("credentials", rows, data ? "No credentials." : "Usage database disabled.");
+  }
+
+  function renderForecast(data) {
+    var rows = ((data && data.forecasts) || []).map(function (f) {
+      var requests = f.request_limit ? num(f.requests_used) + " / " + num(f.request_limit) : num(f.requests_used);
+      var tokens = f.token_limit ? num(f.tokens_used) + " / " + num(f.token_limit) : num(f.tokens_used);
+      var exhausted = f.exhausted_at
+        ? el("span", when(f.exhausted_at) + " (" + f.limited_by + ")", "status-warn")
+        : el("span", "not before reset", "muted");
+      return [f.provider, f.credential_label, f.window, requests, tokens, exhausted];
+    });
+    fillTable("forecast", rows, data ? "No provider quotas configured." : "Usage database disabled.");
+  }
+
+  function renderErrors(data) {
+    var rows = ((data && data.errors) || []).map(function (e) {
+      return [e.provider, e.model, e.error_class, e.requests, when(e.last_seen)];
+    });
+    fillTable("errors", rows, data ? "No failed requests." : "Usage database disabled.");
+  }
+
+  function renderTelemetry(status) {
+    if (!status) return;
+    var db = status.database || {};
+    var otlp = status.otlp || {};
+    $("telemetry").replaceChildren(
+      card("Dispatch queue", num(status["dispatch-queue-depth"])),
+      card("Usage database", db.enabled ? (db["read-only"] ? "read-only" : "writing") : "disabled"),
+      card("OTLP export", otlp.enabled ? "on" : "off"),
+      card("StatsD", status.statsd && status.statsd.enabled ? "on" : "off")
+    );
+  }
+
+  function refresh() {
+    Promise.all([
+      fetchJSON("/usage"),
+      fetchJSON("/usage/credentials?days=7"),
+      fetchJSON("/usage/forecast"),
+      fetchJSON("/usage/errors?days=1"),
+      fetchJSON("/status")
+    ]).then(function (results) {
+      renderUsage(results[0]);
+      renderCredentials(results[1]);
+      renderForecast(results[2]);
+      renderErrors(results[3]);
+      renderTelemetry(results[4]);
+      $("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+    }).catch(function (err) {
+      if (err.unauthorized) {
+        showLogin("Management key rejected.");
+        return;
+      }
+      $("updated").textContent = "Refresh failed: " + err.message;
+    });
+  }
+
+  function showLogin(message) {
+    clearInterval(timer);
+    timer = null;
+    localStorage.removeItem(KEY_STORAGE);
+    $("dashboard").hidden = true;
+    $("logout").hidden = true;
+    $("login").hidden = false;
+    $("login-error").textContent = message || "";
+  }
+
+  function showDashboard() {
+    $("login").hidden = true;
+    $("dashboard").hidden = false;
+    $("logout").hidden = false;
+    refresh();
+    clearInterval(timer);
+    timer = setInterval(refresh, REFRESH_MS);
+  }
+
+  $("login-form").addEventListener("submit", function (ev) {
+    ev.preventDefault();
+    localStorage.setItem(KEY_STORAGE, $("key").value.trim());
+    $("key").value = "";
+    showDashboard();
+  });
+  $("logout").addEventListener("click", function () { showLogin(); });
+
+  if (key()) {
+    showDashboard();
+  } else {
+    showLogin();
+  }
+})();
@@ -0,0 +1,73 @@
+package management
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// GetAuthRefresh lists the proactive refresh schedule of every OAuth credential: its
+// token expiry, when renewal is due, and the outcome of recent attempts.
+func (h *Handler) GetAuthRefresh(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"jitter-fraction":     h.cfg.AuthRefresh.JitterFraction(),
+		"max-backoff-seconds": h.cfg.AuthRefresh.MaxBackoffSeconds,
+		"credentials":         h.authManager.RefreshSchedule(),
+	})
+}
+
+// authEventSorts is the single ordering GetAuthEvents pages in: newest first.
+var authEventSorts = pageSort{Names: []string{"timestamp"}, Default: "timestamp", DefaultDesc: true}
+
+// GetAuthEvents returns the credential refresh outcomes recorded in the usage database
+// over the last N days, newest first. Filter with ?auth-id= and page with ?limit=;
+// without ?limit= and ?cursor= every event of the period is returned.
+func (h *Handler) GetAuthEvents(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	q, ok := parsePageQuery(c, authEventSorts)
+	if !ok {
+		return
+	}
+	if !q.Desc {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order: auth events are listed newest first"})
+		return
+	}
+	beforeID, err := pageKeyID(q.After)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	// One row more than the page tells whether another page follows.
+	limit := 0
+	if q.Limit > 0 {
+		limit = q.Limit + 1
+	}
+	rows, err := usage.QueryAuthEvents(c.Request.Context(), since, strings.TrimSpace(c.Query("auth-id")), limit, beforeID)
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	nextKey := ""
+	if q.Limit > 0 && len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		nextKey = strconv.FormatInt(rows[len(rows)-1].ID, 10)
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "events": rows, "page": q.info(nextKey)})
+}
@@ -0,0 +1,83 @@
+package management
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/loadshed"
+)
+
+// GetCircuitBreakers lists the circuit breaker state of every tracked credential.
+func (h *Handler) GetCircuitBreakers(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":          h.cfg.CircuitBreaker.Enabled,
+		"circuit-breakers": h.authManager.CircuitBreakers(),
+	})
+}
+
+// GetCredentialConcurrency lists in-flight and queued requests per limited credential,
+// the queue wait counters of every priority class and the load-shedding counters.
+func (h *Handler) GetCredentialConcurrency(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"max-in-flight": h.cfg.CredentialConcurrency.MaxInFlight,
+		"credentials":   h.authManager.ConcurrencyStatuses(),
+		"priorities":    h.authManager.PriorityQueueStats(),
+		"load-shedding": loadshed.CurrentStats(),
+	})
+}
+
+// GetCredentialCanaries lists the credentials warming up on canary routing with
+// their request, failure and rate-limit counts.
+func (h *Handler) GetCredentialCanaries(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":             h.cfg.CredentialCanary.Enabled,
+		"credential-canaries": h.authManager.Canaries(),
+	})
+}
+
+// DeleteCredentialCanaries promotes the canary ?auth-id= to full traffic, or every
+// canary when omitted.
+func (h *Handler) DeleteCredentialCanaries(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	h.authManager.PromoteCanary(strings.TrimSpace(c.Query("auth-id")))
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// GetLatencyRouting lists the recent p50 and p95 latency of every credential per
+// model, as used by latency-based routing.
+func (h *Handler) GetLatencyRouting(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   h.cfg.LatencyRouting.Enabled,
+		"latencies": h.authManager.LatencyStats(),
+	})
+}
+
+// DeleteCircuitBreakers closes the breaker for ?auth-id=, or all breakers when omitted.
+func (h *Handler) DeleteCircuitBreakers(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	h.authManager.ResetCircuitBreaker(strings.TrimSpace(c.Query("auth-id")))
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
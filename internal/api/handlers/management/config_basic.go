@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -109,6 +111,18 @@ func WriteConfig(path string, data []byte) error {
 	return f.Close()
 }
 
+// ValidateConfig performs a dry-run validation of the YAML config in the request body.
+// Nothing is written or applied; the response lists every issue found so callers can
+// check a candidate before PUT /config.yaml triggers a hot reload.
+func (h *Handler) ValidateConfig(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_yaml", "message": "cannot read request body"})
+		return
+	}
+	c.JSON(http.StatusOK, config.ValidateYAML(body, h.configFilePath))
+}
+
 func (h *Handler) PutConfigYAML(c *gin.Context) {
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -149,6 +163,14 @@ func (h *Handler) PutConfigYAML(c *gin.Context) {
 	}
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	if fields := addedCommands(h.cfg, &cfg); len(fields) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "command_change_forbidden",
+			"message": "commands can only be changed by editing the config file on the host",
+			"fields":  fields,
+		})
+		return
+	}
 	if WriteConfig(h.configFilePath, body) != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "write_failed", "message": "failed to write config"})
 		return
@@ -163,6 +185,36 @@ func (h *Handler) PutConfigYAML(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true, "changed": []string{"config"}})
 }
 
+// addedCommands lists the fields of next that would run a command the current config
+// does not already run: usage sinks and encryption key commands. Removing or disabling
+// a command is allowed.
+func addedCommands(current, next *config.Config) []string {
+	var fields []string
+	for i, sink := range next.UsageSinks {
+		if strings.TrimSpace(sink.Command) == "" || sink.Disabled {
+			continue
+		}
+		known := current != nil && slices.ContainsFunc(current.UsageSinks, func(old config.UsageSinkConfig) bool {
+			return old.Command == sink.Command && slices.Equal(old.Args, sink.Args) && maps.Equal(old.Env, sink.Env)
+		})
+		if !known {
+			fields = append(fields, fmt.Sprintf("usage-sinks[%d]", i))
+		}
+	}
+	var credentialCommand, usageCommand string
+	if current != nil {
+		credentialCommand = current.CredentialEncryption.KeyCommand
+		usageCommand = current.UsageDatabase.Encryption.KeyCommand
+	}
+	if cmd := strings.TrimSpace(next.CredentialEncryption.KeyCommand); cmd != "" && cmd != strings.TrimSpace(credentialCommand) {
+		fields = append(fields, "credential-encryption.key-command")
+	}
+	if cmd := strings.TrimSpace(next.UsageDatabase.Encryption.KeyCommand); cmd != "" && cmd != strings.TrimSpace(usageCommand) {
+		fields = append(fields, "usage-db.encryption.key-command")
+	}
+	return fields
+}
+
 // GetConfigYAML returns the raw config.yaml file bytes without re-encoding.
 // It preserves comments and original formatting/styles.
 func (h *Handler) GetConfigYAML(c *gin.Context) {
@@ -0,0 +1,76 @@
+package management
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestPutConfigYAMLRejectsNewCommands(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	current := "port: 8317\nusage-sinks:\n  - name: audit\n    command: /usr/bin/audit-sink\n"
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(current), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	h := &Handler{cfg: cfg, configFilePath: path}
+
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/v0/management/config.yaml", strings.NewReader(body))
+		h.PutConfigYAML(c)
+		return w
+	}
+
+	cases := []struct {
+		name, body, field string
+	}{
+		{"new sink", current + "  - name: evil\n    command: /bin/sh\n", "usage-sinks[1]"},
+		{"changed env", "port: 8317\nusage-sinks:\n  - name: audit\n    command: /usr/bin/audit-sink\n    env:\n      LD_PRELOAD: /tmp/x.so\n", "usage-sinks[0]"},
+		{"credential key command", current + "credential-encryption:\n  enabled: true\n  key-command: curl evil\n", "credential-encryption.key-command"},
+		{"usage key command", current + "usage-db:\n  encryption:\n    enabled: true\n    key-command: curl evil\n", "usage-db.encryption.key-command"},
+	}
+	for _, tc := range cases {
+		w := put(tc.body)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), tc.field) {
+			t.Errorf("%s: status %d body %s, want 403 naming %s", tc.name, w.Code, w.Body.String(), tc.field)
+		}
+	}
+
+	// Unchanged and removed commands may still be saved.
+	if w := put(current + "debug: true\n"); w.Code != http.StatusOK {
+		t.Fatalf("unchanged sink: status %d body %s", w.Code, w.Body.String())
+	}
+	if w := put("port: 8317\n"); w.Code != http.StatusOK {
+		t.Fatalf("removed sink: status %d body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetUsageSinksRedactsEnv(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{UsageSinks: []config.UsageSinkConfig{{Name: "audit", Command: "/usr/bin/audit-sink", Env: map[string]string{"TOKEN": "s3cret"}}}}
+	h := &Handler{cfg: cfg}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v0/management/usage-sinks", nil)
+	h.GetUsageSinks(c)
+
+	if strings.Contains(w.Body.String(), "s3cret") || !strings.Contains(w.Body.String(), `"TOKEN":"[redacted]"`) {
+		t.Fatalf("env not redacted: %s", w.Body.String())
+	}
+	if cfg.UsageSinks[0].Env["TOKEN"] != "s3cret" {
+		t.Fatal("redaction modified the live config")
+	}
+}
@@ -523,6 +523,90 @@ func (h *Handler) DeleteOAuthExcludedModels(c *gin.Context) {
 	h.persist(c)
 }
 
+// provider-proxies: map[string]string
+func (h *Handler) GetProviderProxies(c *gin.Context) {
+	c.JSON(200, gin.H{"provider-proxies": config.NormalizeProviderProxies(h.cfg.ProviderProxies)})
+}
+
+func (h *Handler) PutProviderProxies(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "failed to read body"})
+		return
+	}
+	var entries map[string]string
+	if err = json.Unmarshal(data, &entries); err != nil {
+		var wrapper struct {
+			Items map[string]string `json:"items"`
+		}
+		if err2 := json.Unmarshal(data, &wrapper); err2 != nil {
+			c.JSON(400, gin.H{"error": "invalid body"})
+			return
+		}
+		entries = wrapper.Items
+	}
+	entries = config.NormalizeProviderProxies(entries)
+	for provider, proxyURL := range entries {
+		if errCheck := config.CheckProxyURL(proxyURL); errCheck != nil {
+			c.JSON(400, gin.H{"error": provider + ": " + errCheck.Error()})
+			return
+		}
+	}
+	h.cfg.ProviderProxies = entries
+	h.persist(c)
+}
+
+func (h *Handler) PatchProviderProxies(c *gin.Context) {
+	var body struct {
+		Provider *string `json:"provider"`
+		ProxyURL string  `json:"proxy-url"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Provider == nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+	provider := strings.ToLower(strings.TrimSpace(*body.Provider))
+	if provider == "" {
+		c.JSON(400, gin.H{"error": "invalid provider"})
+		return
+	}
+	proxyURL := strings.TrimSpace(body.ProxyURL)
+	if proxyURL == "" {
+		h.deleteProviderProxy(c, provider)
+		return
+	}
+	if err := config.CheckProxyURL(proxyURL); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if h.cfg.ProviderProxies == nil {
+		h.cfg.ProviderProxies = make(map[string]string)
+	}
+	h.cfg.ProviderProxies[provider] = proxyURL
+	h.persist(c)
+}
+
+func (h *Handler) DeleteProviderProxies(c *gin.Context) {
+	provider := strings.ToLower(strings.TrimSpace(c.Query("provider")))
+	if provider == "" {
+		c.JSON(400, gin.H{"error": "missing provider"})
+		return
+	}
+	h.deleteProviderProxy(c, provider)
+}
+
+func (h *Handler) deleteProviderProxy(c *gin.Context, provider string) {
+	if _, ok := h.cfg.ProviderProxies[provider]; !ok {
+		c.JSON(404, gin.H{"error": "provider not found"})
+		return
+	}
+	delete(h.cfg.ProviderProxies, provider)
+	if len(h.cfg.ProviderProxies) == 0 {
+		h.cfg.ProviderProxies = nil
+	}
+	h.persist(c)
+}
+
 // codex-api-key: []CodexKey
 func (h *Handler) GetCodexKeys(c *gin.Context) {
 	c.JSON(200, gin.H{"codex-api-key": h.cfg.CodexKey})
@@ -0,0 +1,43 @@
+package management
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/livequota"
+)
+
+type credentialQuota struct {
+	livequota.Snapshot
+	Label string `json:"label,omitempty"`
+}
+
+// GetCredentialQuotas returns the remaining upstream quota each credential's
+// provider last reported, with reset times, optionally filtered by ?provider= and
+// ?auth-id=. Credentials appear after their first response carrying rate-limit
+// data; removed credentials are left out.
+func (h *Handler) GetCredentialQuotas(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	provider := strings.ToLower(strings.TrimSpace(c.Query("provider")))
+	authID := strings.TrimSpace(c.Query("auth-id"))
+	out := make([]credentialQuota, 0)
+	for _, snapshot := range livequota.Snapshots(time.Now()) {
+		if provider != "" && !strings.EqualFold(snapshot.Provider, provider) {
+			continue
+		}
+		if authID != "" && snapshot.AuthID != authID {
+			continue
+		}
+		auth, ok := h.authManager.GetByID(snapshot.AuthID)
+		if !ok {
+			continue
+		}
+		out = append(out, credentialQuota{Snapshot: snapshot, Label: auth.Label})
+	}
+	c.JSON(http.StatusOK, gin.H{"credentials": out})
+}
@@ -0,0 +1,164 @@
+package management
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credbundle"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credcrypt"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetCredentialStore reports the encryption state of auth files in auth-dir.
+func (h *Handler) GetCredentialStore(c *gin.Context) {
+	resp := gin.H{"encryption": credcrypt.Status()}
+	if stats, err := credcrypt.Inspect(h.cfg.AuthDir); err == nil {
+		resp["files"] = stats
+	} else {
+		resp["files_error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RotateCredentialKey re-encrypts every auth file under a new master key.
+// The key may be supplied as {"key": "<base64>"}; otherwise one is generated.
+// Keys loaded from a key file are written back to it, while env and command
+// sourced keys are returned once so the operator can update the external source.
+func (h *Handler) RotateCredentialKey(c *gin.Context) {
+	if !credcrypt.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "credential encryption is not enabled"})
+		return
+	}
+	var body struct {
+		Key string `json:"key"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+	}
+
+	encoded := strings.TrimSpace(body.Key)
+	var (
+		key credcrypt.Key
+		err error
+	)
+	if encoded != "" {
+		key, err = credcrypt.ParseKey(encoded)
+	} else {
+		key, encoded, err = credcrypt.GenerateKey()
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := credcrypt.Rotate(h.cfg.AuthDir, key, encoded)
+	if err != nil {
+		log.WithError(err).Error("management: credential key rotation failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "result": result, "key": encoded})
+		return
+	}
+	resp := gin.H{"status": "ok", "result": result}
+	if !result.KeyPersisted {
+		resp["key"] = encoded
+		resp["warning"] = "update the configured key source with this key before restarting"
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ExportCredentialBundle returns every auth file, with the runtime state the auth
+// manager holds for it, as a bundle sealed under {"passphrase": "..."}.
+func (h *Handler) ExportCredentialBundle(c *gin.Context) {
+	var body struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	var auths []*coreauth.Auth
+	if h.authManager != nil {
+		auths = h.authManager.List()
+	}
+	bundle, err := credbundle.Collect(h.cfg.AuthDir, auths)
+	if err != nil {
+		log.WithError(err).Error("management: credential export failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sealed, err := credbundle.Seal(bundle, body.Passphrase)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := "cliproxy-credentials-" + time.Now().UTC().Format("20060102-150405") + ".json"
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Header("X-Credential-Count", strconv.Itoa(len(bundle.Credentials)))
+	c.Data(http.StatusOK, "application/json", sealed)
+}
+
+// ImportCredentialBundle writes the credentials of {"bundle": {...}, "passphrase":
+// "...", "overwrite": false} into auth-dir, registers them and restores their
+// labels, cooldowns and disabled state. Existing files are kept unless overwrite is set.
+func (h *Handler) ImportCredentialBundle(c *gin.Context) {
+	var body struct {
+		Bundle     json.RawMessage `json:"bundle"`
+		Passphrase string          `json:"passphrase"`
+		Overwrite  bool            `json:"overwrite"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.Bundle) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	bundle, err := credbundle.Open(body.Bundle, body.Passphrase)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, credbundle.ErrBadPassphrase) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := credbundle.Restore(h.cfg.AuthDir, bundle, body.Overwrite)
+	if err != nil {
+		log.WithError(err).Error("management: credential import failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	imported := make(map[string]bool, len(result.Imported))
+	for _, rel := range result.Imported {
+		imported[rel] = true
+	}
+	ctx := c.Request.Context()
+	restored := 0
+	for _, cred := range bundle.Credentials {
+		if !imported[cred.Path] || h.authManager == nil {
+			continue
+		}
+		path := filepath.Join(h.cfg.AuthDir, filepath.FromSlash(cred.Path))
+		if errReg := h.registerAuthFromFile(ctx, path, cred.Content); errReg != nil {
+			log.WithError(errReg).Warnf("management: failed to register imported credential %s", cred.Path)
+			continue
+		}
+		if cred.State == nil {
+			continue
+		}
+		if auth, ok := h.authManager.GetByID(h.authIDForPath(path)); ok {
+			cred.State.Apply(auth)
+			auth.UpdatedAt = time.Now()
+			if _, errUpdate := h.authManager.Update(ctx, auth); errUpdate == nil {
+				restored++
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "result": result, "restored_state": restored})
+}
@@ -0,0 +1,70 @@
+package management
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+// eventStreamKeepAlive is how often an idle event stream sends a comment line so
+// proxies in between do not close it.
+const eventStreamKeepAlive = 30 * time.Second
+
+// StreamEvents streams runtime events from the event bus as server-sent events until
+// the client disconnects, e.g. config.reloaded and config.reload_failed after a hot
+// reload. Restrict the stream with ?types= (comma-separated event types).
+func (h *Handler) StreamEvents(c *gin.Context) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+		return
+	}
+	var types []events.Type
+	for _, raw := range strings.Split(c.Query("types"), ",") {
+		if raw = strings.TrimSpace(raw); raw != "" {
+			types = append(types, events.Type(raw))
+		}
+	}
+
+	queue := make(chan events.Event, 64)
+	unsubscribe := events.Subscribe(func(evt events.Event) {
+		select {
+		case queue <- evt:
+		default:
+		}
+	}, types...)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case evt := <-queue:
+			payload, err := json.Marshal(evt)
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", evt.Type, payload); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
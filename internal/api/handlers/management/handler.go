@@ -28,10 +28,12 @@ type attemptInfo struct {
 
 // Handler aggregates config reference, persistence path and helpers.
 type Handler struct {
-	cfg                 *config.Config
-	configFilePath      string
-	mu                  sync.Mutex
-	attemptsMu          sync.Mutex
+	cfg            *config.Config
+	configFilePath string
+	mu             sync.Mutex
+	attemptsMu     sync.Mutex
+	// invitesMu serialises invite code redemptions so a code is only redeemed once.
+	invitesMu           sync.Mutex
 	failedAttempts      map[string]*attemptInfo // keyed by client IP
 	authManager         *coreauth.Manager
 	usageStats          *usage.RequestStatistics
@@ -40,6 +42,7 @@ type Handler struct {
 	allowRemoteOverride bool
 	envSecret           string
 	logDir              string
+	replayHandler       http.Handler
 }
 
 // NewHandler creates a new management handler instance.
@@ -87,6 +90,7 @@ func (h *Handler) SetLogDirectory(dir string) {
 // Middleware enforces access control for management endpoints.
 // All requests (local and remote) require a valid management key.
 // Additionally, remote access requires allow-remote-management=true.
+// Scoped tokens from remote-management.tokens are limited to the endpoints their role allows.
 func (h *Handler) Middleware() gin.HandlerFunc {
 	const maxFailures = 5
 	const banDuration = 30 * time.Minute
@@ -181,6 +185,7 @@ func (h *Handler) Middleware() gin.HandlerFunc {
 		if localClient {
 			if lp := h.localPassword; lp != "" {
 				if subtle.ConstantTimeCompare([]byte(provided), []byte(lp)) == 1 {
+					c.Set(managementRoleKey, RoleAdmin)
 					c.Next()
 					return
 				}
@@ -196,16 +201,24 @@ func (h *Handler) Middleware() gin.HandlerFunc {
 				}
 				h.attemptsMu.Unlock()
 			}
+			c.Set(managementRoleKey, RoleAdmin)
 			c.Next()
 			return
 		}
 
+		role := RoleAdmin
 		if secretHash == "" || bcrypt.CompareHashAndPassword([]byte(secretHash), []byte(provided)) != nil {
-			if !localClient {
-				fail()
+			var matched bool
+			if cfg != nil {
+				role, matched = matchScopedToken(cfg.RemoteManagement.Tokens, provided)
+			}
+			if !matched {
+				if !localClient {
+					fail()
+				}
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid management key"})
+				return
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid management key"})
-			return
 		}
 
 		if !localClient {
@@ -217,12 +230,31 @@ func (h *Handler) Middleware() gin.HandlerFunc {
 			h.attemptsMu.Unlock()
 		}
 
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		if !roleAllows(role, c.Request.Method, path) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "role": role})
+			return
+		}
+		c.Set(managementRoleKey, role)
 		c.Next()
 	}
 }
 
 // persist saves the current in-memory config to disk.
 func (h *Handler) persist(c *gin.Context) bool {
+	if !h.save(c) {
+		return false
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	return true
+}
+
+// save writes the in-memory config to disk, responding with 500 on failure.
+// Callers that return their own success payload use it instead of persist.
+func (h *Handler) save(c *gin.Context) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	// Preserve comments when writing
@@ -230,7 +262,6 @@ func (h *Handler) persist(c *gin.Context) bool {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to save config: %v", err)})
 		return false
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	return true
 }
 
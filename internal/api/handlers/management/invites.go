@@ -0,0 +1,127 @@
+package management
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/invite"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/policy"
+	log "github.com/sirupsen/logrus"
+)
+
+// invite-codes: []InviteCode
+func (h *Handler) GetInviteCodes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"invite-codes": h.cfg.InviteCodes})
+}
+
+// CreateInviteCode issues a new invite code. The body may set label, policy and
+// either expires-at (RFC 3339) or expires-in-hours; code is generated when empty.
+// Expired codes are pruned on the way.
+func (h *Handler) CreateInviteCode(c *gin.Context) {
+	var body struct {
+		config.InviteCode
+		ExpiresInHours int `json:"expires-in-hours"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	entry := body.InviteCode
+	entry.Code = strings.TrimSpace(entry.Code)
+	entry.Policy.APIKey = ""
+	now := time.Now().UTC()
+	if body.ExpiresInHours > 0 {
+		entry.ExpiresAt = now.Add(time.Duration(body.ExpiresInHours) * time.Hour).Format(time.RFC3339)
+	} else if entry.ExpiresAt != "" {
+		if _, err := time.Parse(time.RFC3339, entry.ExpiresAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires-at must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+
+	h.invitesMu.Lock()
+	defer h.invitesMu.Unlock()
+	if entry.Code == "" {
+		code, err := invite.NewCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		entry.Code = code
+	}
+	for _, existing := range h.cfg.InviteCodes {
+		if strings.EqualFold(strings.TrimSpace(existing.Code), entry.Code) {
+			c.JSON(http.StatusConflict, gin.H{"error": "invite code already exists"})
+			return
+		}
+	}
+	invite.PruneExpired(h.cfg, now)
+	h.cfg.InviteCodes = append(h.cfg.InviteCodes, entry)
+	if !h.save(c) {
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"invite-code": entry})
+}
+
+// DeleteInviteCode revokes the invite code given by ?code=.
+func (h *Handler) DeleteInviteCode(c *gin.Context) {
+	code := strings.TrimSpace(c.Query("code"))
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing code"})
+		return
+	}
+	h.invitesMu.Lock()
+	defer h.invitesMu.Unlock()
+	out := make([]config.InviteCode, 0, len(h.cfg.InviteCodes))
+	for _, existing := range h.cfg.InviteCodes {
+		if !strings.EqualFold(strings.TrimSpace(existing.Code), code) {
+			out = append(out, existing)
+		}
+	}
+	if len(out) == len(h.cfg.InviteCodes) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invite code not found"})
+		return
+	}
+	h.cfg.InviteCodes = out
+	h.persist(c)
+}
+
+// RedeemInviteCode exchanges a one-time invite code ({"code": "..."}) for a new
+// client API key carrying the code's policy. It is served outside the management
+// API, without authentication, so new users can redeem codes themselves.
+func (h *Handler) RedeemInviteCode(c *gin.Context) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || strings.TrimSpace(body.Code) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing code"})
+		return
+	}
+
+	h.invitesMu.Lock()
+	defer h.invitesMu.Unlock()
+	key, entry, err := invite.Redeem(h.cfg, body.Code, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, invite.ErrInvalidCode) {
+			log.Warnf("management: rejected invite code redemption from %s", c.ClientIP())
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Rebuild the access providers from api-keys on the next reload, as PutAPIKeys does.
+	h.cfg.Access.Providers = nil
+	policy.SetPolicies(h.cfg.EffectiveAPIKeyPolicies())
+	if !h.save(c) {
+		return
+	}
+	log.Infof("management: invite code %q redeemed from %s", entry.Label, c.ClientIP())
+	issued := entry.Policy
+	issued.APIKey = key
+	c.JSON(http.StatusCreated, gin.H{"api-key": key, "policy": issued})
+}
@@ -0,0 +1,112 @@
+package management
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetLogLevel returns the configured log level and the level currently in effect.
+func (h *Handler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"log-level":       h.cfg.LogLevel,
+		"effective-level": log.GetLevel().String(),
+	})
+}
+
+// PutLogLevel changes the global log level immediately and persists it. An empty
+// value restores the default derived from debug.
+func (h *Handler) PutLogLevel(c *gin.Context) {
+	var body struct {
+		Value *string `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Value == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	level := strings.ToLower(strings.TrimSpace(*body.Value))
+	if !config.ValidLogLevel(level) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown log level %q (want %s)", level, strings.Join(config.LogLevels, ", "))})
+		return
+	}
+	h.cfg.LogLevel = level
+	util.SetLogLevel(h.cfg)
+	h.persist(c)
+}
+
+// GetLogComponents returns the components with debug output enabled and the known set.
+func (h *Handler) GetLogComponents(c *gin.Context) {
+	components := h.cfg.LogComponents
+	if components == nil {
+		components = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"log-components": components,
+		"available":      config.KnownLogComponents,
+	})
+}
+
+// PutLogComponents replaces the debug-enabled components. The body is either a JSON
+// array or {"items": [...]}; an empty list disables all component debug output.
+func (h *Handler) PutLogComponents(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+	var components []string
+	if err = json.Unmarshal(data, &components); err != nil {
+		var obj struct {
+			Items *[]string `json:"items"`
+		}
+		if errObj := json.Unmarshal(data, &obj); errObj != nil || obj.Items == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+		components = *obj.Items
+	}
+	components = config.NormalizeLogComponents(components)
+	for _, name := range components {
+		if !slices.Contains(config.KnownLogComponents, name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown log component %q (want %s)", name, strings.Join(config.KnownLogComponents, ", "))})
+			return
+		}
+	}
+	h.applyLogComponents(c, components)
+}
+
+// PatchLogComponents enables or disables debug output for a single component.
+// Body: {"component": "router", "enabled": true}.
+func (h *Handler) PatchLogComponents(c *gin.Context) {
+	var body struct {
+		Component string `json:"component"`
+		Enabled   *bool  `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	name := strings.ToLower(strings.TrimSpace(body.Component))
+	if !slices.Contains(config.KnownLogComponents, name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown log component %q (want %s)", name, strings.Join(config.KnownLogComponents, ", "))})
+		return
+	}
+	components := slices.DeleteFunc(slices.Clone(h.cfg.LogComponents), func(existing string) bool { return existing == name })
+	if *body.Enabled {
+		components = append(components, name)
+	}
+	h.applyLogComponents(c, config.NormalizeLogComponents(components))
+}
+
+func (h *Handler) applyLogComponents(c *gin.Context, components []string) {
+	h.cfg.LogComponents = components
+	util.SetDebugComponents(components)
+	h.persist(c)
+}
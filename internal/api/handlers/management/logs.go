@@ -145,8 +145,25 @@ func (h *Handler) DeleteLogs(c *gin.Context) {
 	})
 }
 
-// GetRequestErrorLogs lists error request log files when RequestLog is disabled.
-// It returns an empty list when RequestLog is enabled.
+// errorLog is one listed error request log file.
+type errorLog struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"`
+}
+
+// errorLogSorts are the orderings GetRequestErrorLogs accepts.
+var errorLogSorts = pageSort{Names: []string{"modified", "name", "size"}, Default: "modified", DefaultDesc: true}
+
+var errorLogSortKeys = map[string]func(errorLog) string{
+	"modified": func(file errorLog) string { return pageKeyInt(file.Modified) },
+	"name":     func(file errorLog) string { return file.Name },
+	"size":     func(file errorLog) string { return pageKeyInt(file.Size) },
+}
+
+// GetRequestErrorLogs lists error request log files when RequestLog is disabled, one
+// page at a time, newest first by default. It returns an empty list when RequestLog
+// is enabled.
 func (h *Handler) GetRequestErrorLogs(c *gin.Context) {
 	if h == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "handler unavailable"})
@@ -156,6 +173,10 @@ func (h *Handler) GetRequestErrorLogs(c *gin.Context) {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "configuration unavailable"})
 		return
 	}
+	q, ok := parsePageQuery(c, errorLogSorts)
+	if !ok {
+		return
+	}
 	if h.cfg.RequestLog {
 		c.JSON(http.StatusOK, gin.H{"files": []any{}})
 		return
@@ -177,12 +198,6 @@ func (h *Handler) GetRequestErrorLogs(c *gin.Context) {
 		return
 	}
 
-	type errorLog struct {
-		Name     string `json:"name"`
-		Size     int64  `json:"size"`
-		Modified int64  `json:"modified"`
-	}
-
 	files := make([]errorLog, 0, len(entries))
 	for _, entry := range entries {
 		if entry.IsDir() {
@@ -204,9 +219,8 @@ func (h *Handler) GetRequestErrorLogs(c *gin.Context) {
 		})
 	}
 
-	sort.Slice(files, func(i, j int) bool { return files[i].Modified > files[j].Modified })
-
-	c.JSON(http.StatusOK, gin.H{"files": files})
+	page, info := paginate(files, q, errorLogSortKeys, func(file errorLog) string { return file.Name })
+	c.JSON(http.StatusOK, gin.H{"files": page, "page": info})
 }
 
 // DownloadRequestErrorLog downloads a specific error request log file by name.
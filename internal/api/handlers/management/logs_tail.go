@@ -0,0 +1,72 @@
+package management
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// TailLogs streams one structured request log event (the usage-sinks event format)
+// per proxied request as server-sent events until the client disconnects. Filter
+// with ?provider=, ?model= (routed or requested model), ?status= (comma-separated
+// status classes such as 4xx,5xx) and ?api_key_hash= (fingerprint prefix). Events
+// are dropped while the client lags behind; the next event reports the count.
+func (h *Handler) TailLogs(c *gin.Context) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+		return
+	}
+	classes, err := usage.ParseStatusClasses(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub, unsubscribe := usage.SubscribeTail(usage.TailFilter{
+		Provider:      strings.TrimSpace(c.Query("provider")),
+		Model:         strings.TrimSpace(c.Query("model")),
+		StatusClasses: classes,
+		APIKeyHash:    strings.TrimSpace(c.Query("api_key_hash")),
+	}, 0)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	var reported uint64
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case evt := <-sub.C:
+			if dropped := sub.Dropped(); dropped > reported {
+				if _, err := fmt.Fprintf(c.Writer, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped-reported); err != nil {
+					return
+				}
+				reported = dropped
+			}
+			payload, err := json.Marshal(evt)
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(c.Writer, "event: request\ndata: %s\n\n", payload); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
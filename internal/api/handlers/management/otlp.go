@@ -2,8 +2,10 @@ package management
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
 )
 
@@ -15,7 +17,7 @@ func (h *Handler) GetOTLPEnabled(c *gin.Context) {
 	})
 }
 
-// SetOTLPEnabled sets the OTLP telemetry status
+// SetOTLPEnabled sets the OTLP telemetry status and persists it to the config file
 func (h *Handler) SetOTLPEnabled(c *gin.Context) {
 	var req struct {
 		Enabled bool `json:"enabled"`
@@ -26,21 +28,28 @@ func (h *Handler) SetOTLPEnabled(c *gin.Context) {
 	}
 
 	usage.SetOTLPEnabled(req.Enabled)
+	enabled := req.Enabled
+	h.cfg.OTLP.Enabled = &enabled
+	if !h.save(c) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"enabled": req.Enabled,
 		"message": "OTLP telemetry status updated",
 	})
 }
 
-// GetOTLPEndpoint returns the current OTLP endpoint
+// GetOTLPEndpoint returns the active OTLP endpoint and, with failover configured,
+// the health of every candidate collector.
 func (h *Handler) GetOTLPEndpoint(c *gin.Context) {
-	endpoint := usage.OTLPEndpoint()
-	c.JSON(http.StatusOK, gin.H{
-		"endpoint": endpoint,
-	})
+	resp := gin.H{"endpoint": usage.OTLPEndpoint()}
+	if candidates := usage.OTLPEndpointStatuses(); len(candidates) > 1 {
+		resp["candidates"] = candidates
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-// SetOTLPEndpoint sets the OTLP endpoint
+// SetOTLPEndpoint sets the OTLP endpoint and persists it to the config file
 func (h *Handler) SetOTLPEndpoint(c *gin.Context) {
 	var req struct {
 		Endpoint string `json:"endpoint"`
@@ -51,8 +60,60 @@ func (h *Handler) SetOTLPEndpoint(c *gin.Context) {
 	}
 
 	usage.SetOTLPEndpoint(req.Endpoint)
+	h.cfg.OTLP.Endpoint = strings.TrimSpace(req.Endpoint)
+	if !h.save(c) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"endpoint": req.Endpoint,
 		"message":  "OTLP endpoint updated",
 	})
 }
+
+// GetOTLPConfig returns the otlp section of the config.
+func (h *Handler) GetOTLPConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"otlp": h.cfg.OTLP})
+}
+
+// GetOTLPSpool reports how many events are waiting in the OTLP disk spool.
+func (h *Handler) GetOTLPSpool(c *gin.Context) {
+	status, ok := usage.OTLPSpoolState()
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "spool": status})
+}
+
+// PutOTLPConfig replaces the otlp section and persists it; the config watcher then
+// applies it. Fields omitted from the body are reset to their defaults.
+func (h *Handler) PutOTLPConfig(c *gin.Context) {
+	var body config.OTLPConfig
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if body.TimeoutMs < 0 || body.BatchSize < 0 || body.FlushIntervalMs < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout_ms, batch_size and flush_interval_ms must not be negative"})
+		return
+	}
+	if body.Spool.MaxSizeMB < 0 || body.Spool.MaxAgeHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "spool max_size_mb and max_age_hours must not be negative"})
+		return
+	}
+	body.Endpoint = strings.TrimSpace(body.Endpoint)
+	if err := usage.ValidateOTLPExport(usage.OTLPExportOptions{
+		Endpoint:           body.Endpoint,
+		Endpoints:          body.Endpoints,
+		SRVScheme:          body.SRV.Scheme,
+		Protocol:           body.Protocol,
+		CAFile:             body.TLSCAFile,
+		Sampling:           usage.OTLPSamplingFromConfig(body.Sampling),
+		ResourceAttributes: body.ResourceAttributes,
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.cfg.OTLP = body
+	h.persist(c)
+}
@@ -0,0 +1,227 @@
+package management
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Listing endpoints share one pagination convention: ?limit= caps the page (clamped
+// to maxPageLimit), ?sort= and ?order=asc|desc pick a stable ordering, and ?cursor=
+// continues after the last item of the previous page. Cursors are opaque, carry the
+// ordering they were issued for and resume by key rather than by offset, so items
+// added or removed between requests neither repeat nor shift the following pages.
+// Without ?limit= and ?cursor= the whole listing is returned, so clients that predate
+// pagination keep seeing every item; a cursor without ?limit= pages by defaultPageLimit.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// pageQuery is a parsed pagination request.
+type pageQuery struct {
+	// Limit is the page size; 0 returns every item.
+	Limit int
+	Sort  string
+	Desc  bool
+	// After is the key of the last item on the previous page; empty on the first page.
+	After string
+}
+
+// pageInfo describes the returned page. It is sent as "page" next to the items.
+type pageInfo struct {
+	// Limit is omitted when the whole listing is returned.
+	Limit int    `json:"limit,omitempty"`
+	Sort  string `json:"sort"`
+	Order string `json:"order"`
+	// Total counts every matching item; it is omitted when the listing pages in the
+	// database and the total is not known.
+	Total      *int   `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// pageCursor is the decoded form of ?cursor=.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   string `json:"k"`
+}
+
+// pageSort describes the orderings a listing accepts: the sort names, the default
+// one and its default direction.
+type pageSort struct {
+	Names       []string
+	Default     string
+	DefaultDesc bool
+}
+
+// parsePageQuery reads the pagination parameters, writing a 400 response and
+// returning false when they are invalid. A cursor must be used with the sort and
+// order it was issued for; omitted ones are taken from the cursor.
+func parsePageQuery(c *gin.Context, sorts pageSort) (pageQuery, bool) {
+	limit, err := parseLimit(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + err.Error()})
+		return pageQuery{}, false
+	}
+	raw := strings.TrimSpace(c.Query("cursor"))
+	if limit == 0 && raw != "" {
+		limit = defaultPageLimit
+	}
+	q := pageQuery{Limit: min(limit, maxPageLimit)}
+
+	sortName := strings.ToLower(strings.TrimSpace(c.Query("sort")))
+	order := strings.ToLower(strings.TrimSpace(c.Query("order")))
+	if raw != "" {
+		cursor, errCursor := decodePageCursor(raw)
+		if errCursor != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return pageQuery{}, false
+		}
+		if (sortName != "" && sortName != cursor.Sort) || (order != "" && order != cursor.Order) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor was issued for a different sort or order"})
+			return pageQuery{}, false
+		}
+		sortName, order, q.After = cursor.Sort, cursor.Order, cursor.Key
+	}
+
+	if sortName == "" {
+		sortName = sorts.Default
+	}
+	if !slices.Contains(sorts.Names, sortName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid sort: must be one of %s", strings.Join(sorts.Names, ", "))})
+		return pageQuery{}, false
+	}
+	q.Sort = sortName
+	switch order {
+	case "":
+		q.Desc = sortName == sorts.Default && sorts.DefaultDesc
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order: must be asc or desc"})
+		return pageQuery{}, false
+	}
+	return q, true
+}
+
+// order returns the query direction as sent back in pageInfo.
+func (q pageQuery) order() string {
+	if q.Desc {
+		return "desc"
+	}
+	return "asc"
+}
+
+// info builds the page description; nextKey is the key of the last returned item
+// when more items follow, or empty on the last page.
+func (q pageQuery) info(nextKey string) pageInfo {
+	info := pageInfo{Limit: q.Limit, Sort: q.Sort, Order: q.order()}
+	if nextKey != "" {
+		info.NextCursor = encodePageCursor(pageCursor{Sort: q.Sort, Order: q.order(), Key: nextKey})
+	}
+	return info
+}
+
+func encodePageCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageCursor(raw string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, err
+	}
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return cursor, err
+	}
+	if cursor.Key == "" {
+		return cursor, fmt.Errorf("empty cursor key")
+	}
+	return cursor, nil
+}
+
+// paginate orders items in memory by the key function of the requested sort, with
+// id breaking ties so the order is total, and returns the page following q.After.
+// Key functions must return strings that compare like the values they encode; see
+// pageKeyInt and pageKeyTime.
+func paginate[T any](items []T, q pageQuery, keys map[string]func(T) string, id func(T) string) ([]T, pageInfo) {
+	keyOf := keys[q.Sort]
+	type keyed struct {
+		key  string
+		item T
+	}
+	sorted := make([]keyed, len(items))
+	for i, item := range items {
+		sorted[i] = keyed{key: keyOf(item) + "\x00" + id(item), item: item}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if q.Desc {
+			return sorted[i].key > sorted[j].key
+		}
+		return sorted[i].key < sorted[j].key
+	})
+
+	start := 0
+	if q.After != "" {
+		start = sort.Search(len(sorted), func(i int) bool {
+			if q.Desc {
+				return sorted[i].key < q.After
+			}
+			return sorted[i].key > q.After
+		})
+	}
+	end := len(sorted)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	page := make([]T, 0, end-start)
+	for _, entry := range sorted[start:end] {
+		page = append(page, entry.item)
+	}
+
+	nextKey := ""
+	if end < len(sorted) {
+		nextKey = sorted[end-1].key
+	}
+	info := q.info(nextKey)
+	total := len(items)
+	info.Total = &total
+	return page, info
+}
+
+// pageKeyInt encodes n so that the encodings of signed integers sort numerically.
+func pageKeyInt(n int64) string {
+	return fmt.Sprintf("%020d", uint64(n)^(1<<63))
+}
+
+// pageKeyTime encodes t so that earlier times sort first; the zero time sorts first.
+func pageKeyTime(t time.Time) string {
+	if t.IsZero() {
+		return pageKeyInt(0)
+	}
+	return pageKeyInt(t.UnixNano())
+}
+
+// pageKeyID parses the numeric ID a database-paged cursor key carries.
+func pageKeyID(key string) (int64, error) {
+	if key == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(key, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return id, nil
+}
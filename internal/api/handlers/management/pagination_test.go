@@ -0,0 +1,86 @@
+package management
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPaginateFollowsCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	type item struct {
+		id    string
+		count int64
+	}
+	items := []item{{"a", 3}, {"b", 1}, {"c", 3}, {"d", 2}, {"e", -1}}
+	keys := map[string]func(item) string{
+		"count": func(it item) string { return pageKeyInt(it.count) },
+	}
+	sorts := pageSort{Names: []string{"count"}, Default: "count", DefaultDesc: true}
+
+	query := func(raw string) (pageQuery, int) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+raw, nil)
+		q, _ := parsePageQuery(c, sorts)
+		return q, rec.Code
+	}
+
+	var got []string
+	q, _ := query("limit=2")
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, info := paginate(items, q, keys, func(it item) string { return it.id })
+		for _, it := range page {
+			got = append(got, it.id)
+		}
+		if info.Total == nil || *info.Total != len(items) || info.Order != "desc" {
+			t.Fatalf("unexpected page info %+v", info)
+		}
+		if info.NextCursor == "" {
+			break
+		}
+		// Items added between requests must not shift the following pages.
+		items = append(items, item{"z", 10})
+		q, _ = query("limit=2&cursor=" + info.NextCursor)
+	}
+	want := []string{"c", "a", "d", "b", "e"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	if q, _ := query("limit=5000"); q.Limit != maxPageLimit {
+		t.Fatalf("expected the limit to be capped, got %d", q.Limit)
+	}
+	// Without limit and cursor the whole listing is returned, however long.
+	many := make([]item, maxPageLimit+5)
+	for i := range many {
+		many[i] = item{id: pageKeyInt(int64(i)), count: int64(i % 7)}
+	}
+	q, _ = query("")
+	if page, info := paginate(many, q, keys, func(it item) string { return it.id }); len(page) != len(many) || info.NextCursor != "" || info.Limit != 0 {
+		t.Fatalf("expected the full listing, got %d items and %+v", len(page), info)
+	}
+	_, info := paginate(many, pageQuery{Limit: 2, Sort: "count"}, keys, func(it item) string { return it.id })
+	if q, _ := query("cursor=" + info.NextCursor); q.Limit != defaultPageLimit {
+		t.Fatalf("expected a cursor without limit to page by %d, got %d", defaultPageLimit, q.Limit)
+	}
+	_, info = paginate(items[:2], pageQuery{Limit: 1, Sort: "count"}, keys, func(it item) string { return it.id })
+	if _, code := query("order=desc&cursor=" + info.NextCursor); code != http.StatusBadRequest {
+		t.Fatalf("expected a cursor used with another order to be rejected, got %d", code)
+	}
+	for _, raw := range []string{"sort=name", "order=up", "cursor=not-a-cursor", "limit=0"} {
+		if _, code := query(raw); code != http.StatusBadRequest {
+			t.Fatalf("expected %q to be rejected, got %d", raw, code)
+		}
+	}
+}
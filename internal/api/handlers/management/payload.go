@@ -0,0 +1,33 @@
+package management
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// GetPayloadConfig returns the configured payload default and override rules.
+func (h *Handler) GetPayloadConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"payload": h.cfg.Payload})
+}
+
+// GetEffectivePayload resolves the parameters and system prompt that would be injected
+// for ?model=, optionally narrowed by ?provider=, ?protocol= and ?api-key=.
+func (h *Handler) GetEffectivePayload(c *gin.Context) {
+	target := config.PayloadTarget{
+		Provider: strings.TrimSpace(c.Query("provider")),
+		Model:    strings.TrimSpace(c.Query("model")),
+		Protocol: strings.TrimSpace(c.Query("protocol")),
+		APIKey:   strings.TrimSpace(c.Query("api-key")),
+	}
+	if target.Model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"target":    target,
+		"effective": h.cfg.Payload.Resolve(target),
+	})
+}
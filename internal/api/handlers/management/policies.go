@@ -0,0 +1,116 @@
+package management
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/policy"
+)
+
+// api-key-policies: []APIKeyPolicy
+func (h *Handler) GetAPIKeyPolicies(c *gin.Context) {
+	c.JSON(200, gin.H{"api-key-policies": h.cfg.APIKeyPolicies})
+}
+
+func (h *Handler) PutAPIKeyPolicies(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "failed to read body"})
+		return
+	}
+	var arr []config.APIKeyPolicy
+	if err = json.Unmarshal(data, &arr); err != nil {
+		var obj struct {
+			Items []config.APIKeyPolicy `json:"items"`
+		}
+		if err2 := json.Unmarshal(data, &obj); err2 != nil {
+			c.JSON(400, gin.H{"error": "invalid body"})
+			return
+		}
+		arr = obj.Items
+	}
+	out := make([]config.APIKeyPolicy, 0, len(arr))
+	for i := range arr {
+		arr[i].APIKey = strings.TrimSpace(arr[i].APIKey)
+		if arr[i].APIKey == "" {
+			continue
+		}
+		out = append(out, arr[i])
+	}
+	h.applyAPIKeyPolicies(c, out)
+}
+
+func (h *Handler) PatchAPIKeyPolicy(c *gin.Context) {
+	var body struct {
+		Index *int                 `json:"index"`
+		Match *string              `json:"match"`
+		Value *config.APIKeyPolicy `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Value == nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+	value := *body.Value
+	value.APIKey = strings.TrimSpace(value.APIKey)
+	if value.APIKey == "" {
+		c.JSON(400, gin.H{"error": "api-key is required"})
+		return
+	}
+	policies := append([]config.APIKeyPolicy(nil), h.cfg.APIKeyPolicies...)
+	if body.Index != nil && *body.Index >= 0 && *body.Index < len(policies) {
+		policies[*body.Index] = value
+		h.applyAPIKeyPolicies(c, policies)
+		return
+	}
+	match := value.APIKey
+	if body.Match != nil {
+		match = strings.TrimSpace(*body.Match)
+	}
+	for i := range policies {
+		if policies[i].APIKey == match {
+			policies[i] = value
+			h.applyAPIKeyPolicies(c, policies)
+			return
+		}
+	}
+	if body.Index == nil && body.Match == nil {
+		h.applyAPIKeyPolicies(c, append(policies, value))
+		return
+	}
+	c.JSON(404, gin.H{"error": "item not found"})
+}
+
+func (h *Handler) DeleteAPIKeyPolicy(c *gin.Context) {
+	if val := strings.TrimSpace(c.Query("api-key")); val != "" {
+		out := make([]config.APIKeyPolicy, 0, len(h.cfg.APIKeyPolicies))
+		for _, v := range h.cfg.APIKeyPolicies {
+			if v.APIKey != val {
+				out = append(out, v)
+			}
+		}
+		h.applyAPIKeyPolicies(c, out)
+		return
+	}
+	if idxStr := c.Query("index"); idxStr != "" {
+		var idx int
+		_, err := fmt.Sscanf(idxStr, "%d", &idx)
+		if err == nil && idx >= 0 && idx < len(h.cfg.APIKeyPolicies) {
+			out := append([]config.APIKeyPolicy(nil), h.cfg.APIKeyPolicies[:idx]...)
+			out = append(out, h.cfg.APIKeyPolicies[idx+1:]...)
+			h.applyAPIKeyPolicies(c, out)
+			return
+		}
+	}
+	c.JSON(400, gin.H{"error": "missing api-key or index"})
+}
+
+// applyAPIKeyPolicies activates policies immediately instead of waiting for the
+// config watcher, so revoked models stop being served on the next request.
+func (h *Handler) applyAPIKeyPolicies(c *gin.Context, policies []config.APIKeyPolicy) {
+	h.cfg.APIKeyPolicies = policies
+	policy.SetPolicies(h.cfg.EffectiveAPIKeyPolicies())
+	h.persist(c)
+}
@@ -0,0 +1,93 @@
+package management
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/proxyhealth"
+)
+
+// providerProxyStatus reports one outbound proxy used by a provider's credentials.
+type providerProxyStatus struct {
+	proxyhealth.Status
+	// Source is where the proxy was configured: "credential", "provider" or "global".
+	Source      string `json:"source"`
+	Credentials int    `json:"credentials"`
+}
+
+type providerStatus struct {
+	Provider    string `json:"provider"`
+	Credentials int    `json:"credentials"`
+	Disabled    int    `json:"disabled"`
+	Unavailable int    `json:"unavailable"`
+	// Direct counts credentials that egress without a proxy.
+	Direct  int                   `json:"direct"`
+	Proxies []providerProxyStatus `json:"proxies,omitempty"`
+}
+
+// GetProviderStatus summarizes the credentials of every provider and the health of
+// the outbound proxies they egress through (credential proxy-url, provider-proxies
+// or the global proxy-url). Proxy probes are cached for a short while.
+func (h *Handler) GetProviderStatus(c *gin.Context) {
+	if h.authManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "core auth manager unavailable"})
+		return
+	}
+	type proxyKey struct {
+		url    string
+		source string
+	}
+	byProvider := make(map[string]*providerStatus)
+	proxyCounts := make(map[string]map[proxyKey]int)
+	for _, a := range h.authManager.List() {
+		provider := strings.ToLower(strings.TrimSpace(a.Provider))
+		st := byProvider[provider]
+		if st == nil {
+			st = &providerStatus{Provider: provider}
+			byProvider[provider] = st
+			proxyCounts[provider] = make(map[proxyKey]int)
+		}
+		st.Credentials++
+		if a.Disabled {
+			st.Disabled++
+		}
+		if a.Unavailable {
+			st.Unavailable++
+		}
+		key := proxyKey{url: strings.TrimSpace(a.ProxyURL), source: "credential"}
+		if key.url == "" && h.cfg != nil {
+			if key.url = strings.TrimSpace(h.cfg.ProviderProxies[provider]); key.url != "" {
+				key.source = "provider"
+			} else {
+				key.url, key.source = strings.TrimSpace(h.cfg.ProxyURL), "global"
+			}
+		}
+		if key.url == "" {
+			st.Direct++
+			continue
+		}
+		proxyCounts[provider][key]++
+	}
+
+	out := make([]providerStatus, 0, len(byProvider))
+	for provider, st := range byProvider {
+		for key, n := range proxyCounts[provider] {
+			st.Proxies = append(st.Proxies, providerProxyStatus{
+				Status:      proxyhealth.Check(c.Request.Context(), key.url),
+				Source:      key.source,
+				Credentials: n,
+			})
+		}
+		sort.Slice(st.Proxies, func(i, j int) bool {
+			if st.Proxies[i].Source != st.Proxies[j].Source {
+				return st.Proxies[i].Source < st.Proxies[j].Source
+			}
+			return st.Proxies[i].Proxy < st.Proxies[j].Proxy
+		})
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Provider < out[j].Provider })
+	c.JSON(http.StatusOK, gin.H{"providers": out})
+}
@@ -0,0 +1,120 @@
+package management
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles assignable to scoped management tokens. The primary management key,
+// MANAGEMENT_PASSWORD and the local password always act as RoleAdmin.
+const (
+	// RoleAdmin may call every management endpoint.
+	RoleAdmin = "admin"
+	// RoleReadOnly may read usage and the GET endpoints in readOnlyAllowed.
+	RoleReadOnly = "read-only"
+	// RoleUsageViewer may only read usage statistics and the usage database.
+	RoleUsageViewer = "usage-viewer"
+
+	managementRoleKey = "managementRole"
+	managementPrefix  = "/v0/management"
+)
+
+// readOnlyAllowed lists the GET endpoints a read-only token may call besides the
+// usage endpoints. Endpoints missing here, such as ones that return provider or
+// client keys, sink and exporter settings, logs, or start OAuth flows, stay admin-only
+// so new routes are not exposed until they are reviewed.
+var readOnlyAllowed = map[string]struct{}{
+	"/ampcode/force-model-mappings":             {},
+	"/ampcode/model-mappings":                   {},
+	"/ampcode/restrict-management-to-localhost": {},
+	"/ampcode/upstream-url":                     {},
+	"/auth-events":                              {},
+	"/auth-files":                               {},
+	"/auth-files/models":                        {},
+	"/auth-refresh":                             {},
+	"/circuit-breakers":                         {},
+	"/credential-canaries":                      {},
+	"/credential-concurrency":                   {},
+	"/credential-quotas":                        {},
+	"/credential-store":                         {},
+	"/debug":                                    {},
+	"/events":                                   {},
+	"/kafka/avro-schema":                        {},
+	"/latency-routing":                          {},
+	"/latest-version":                           {},
+	"/log-components":                           {},
+	"/log-level":                                {},
+	"/logging-to-file":                          {},
+	"/max-retry-interval":                       {},
+	"/oauth-excluded-models":                    {},
+	"/otel-enabled":                             {},
+	"/otel-endpoint":                            {},
+	"/otlp/spool":                               {},
+	"/provider-status":                          {},
+	"/quota-exceeded/switch-preview-model":      {},
+	"/quota-exceeded/switch-project":            {},
+	"/request-retry":                            {},
+	"/status":                                   {},
+	"/usage-statistics-enabled":                 {},
+	"/ws-auth":                                  {},
+}
+
+func normalizeRole(role string) string {
+	switch r := strings.ToLower(strings.TrimSpace(role)); r {
+	case RoleAdmin, RoleReadOnly, RoleUsageViewer:
+		return r
+	default:
+		return ""
+	}
+}
+
+// matchScopedToken returns the role of the configured token matching provided.
+func matchScopedToken(tokens []config.ManagementToken, provided string) (string, bool) {
+	for _, token := range tokens {
+		role := normalizeRole(token.Role)
+		key := strings.TrimSpace(token.Key)
+		if role == "" || key == "" {
+			continue
+		}
+		if strings.HasPrefix(key, "$2a$") || strings.HasPrefix(key, "$2b$") || strings.HasPrefix(key, "$2y$") {
+			if bcrypt.CompareHashAndPassword([]byte(key), []byte(provided)) == nil {
+				return role, true
+			}
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(provided)) == 1 {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// roleAllows reports whether role may call method on the management route path
+// (the registered pattern, with or without the /v0/management prefix).
+func roleAllows(role, method, path string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	path = strings.TrimPrefix(path, managementPrefix)
+	switch role {
+	case RoleUsageViewer:
+		return isUsagePath(path)
+	case RoleReadOnly:
+		_, allowed := readOnlyAllowed[path]
+		return allowed || isUsagePath(path)
+	default:
+		return false
+	}
+}
+
+func isUsagePath(path string) bool {
+	return path == "/usage" || strings.HasPrefix(path, "/usage/") ||
+		path == "/usage-db" || strings.HasPrefix(path, "/usage-db/")
+}
@@ -0,0 +1,102 @@
+package management
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestRoleAllows(t *testing.T) {
+	cases := []struct {
+		role, method, path string
+		want               bool
+	}{
+		{RoleAdmin, http.MethodPut, "/v0/management/otel-endpoint", true},
+		{RoleReadOnly, http.MethodGet, "/v0/management/otel-endpoint", true},
+		{RoleReadOnly, http.MethodPut, "/v0/management/otel-endpoint", false},
+		{RoleReadOnly, http.MethodGet, "/v0/management/auth-files/download", false},
+		{RoleReadOnly, http.MethodGet, "/v0/management/claude-api-key", false},
+		{RoleUsageViewer, http.MethodGet, "/v0/management/usage/daily", true},
+		{RoleUsageViewer, http.MethodGet, "/v0/management/usage-db", true},
+		{RoleUsageViewer, http.MethodGet, "/v0/management/usage-statistics-enabled", false},
+		{RoleUsageViewer, http.MethodPost, "/v0/management/usage/import", false},
+		{RoleUsageViewer, http.MethodGet, "/v0/management/quota", false},
+		{"", http.MethodGet, "/v0/management/usage", false},
+	}
+	for _, tc := range cases {
+		if got := roleAllows(tc.role, tc.method, tc.path); got != tc.want {
+			t.Errorf("roleAllows(%q, %s, %s) = %v, want %v", tc.role, tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestRoleAllowsSecretBearingEndpoints(t *testing.T) {
+	secret := []string{
+		"/config", "/config.yaml", "/api-keys", "/api-key-policies", "/teams", "/invite-codes",
+		"/claude-api-key", "/openai-compatibility", "/ampcode", "/ampcode/upstream-api-key",
+		"/otlp", "/payload", "/payload/effective", "/usage-sinks", "/provider-proxies", "/proxy-url",
+		"/logs", "/logs/tail", "/request-log", "/request-error-logs", "/request-error-logs/:name",
+		"/auth-files/download", "/anthropic-auth-url", "/get-auth-status",
+		"/not-yet-reviewed",
+	}
+	for _, path := range secret {
+		full := "/v0/management" + path
+		if !roleAllows(RoleAdmin, http.MethodGet, full) {
+			t.Errorf("admin denied GET %s", path)
+		}
+		if roleAllows(RoleReadOnly, http.MethodGet, full) {
+			t.Errorf("read-only allowed GET %s", path)
+		}
+		if roleAllows(RoleUsageViewer, http.MethodGet, full) {
+			t.Errorf("usage-viewer allowed GET %s", path)
+		}
+	}
+
+	readable := []string{"/usage", "/usage/credentials", "/usage-db/views/:view", "/status", "/auth-files", "/circuit-breakers"}
+	for _, path := range readable {
+		if !roleAllows(RoleReadOnly, http.MethodGet, "/v0/management"+path) {
+			t.Errorf("read-only denied GET %s", path)
+		}
+		if roleAllows(RoleReadOnly, http.MethodDelete, "/v0/management"+path) {
+			t.Errorf("read-only allowed DELETE %s", path)
+		}
+	}
+}
+
+func TestMiddlewareScopedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	cfg.RemoteManagement.SecretKey = "$2a$10$invalidinvalidinvalidinvalidinvalidinvalidinvalidinva"
+	cfg.RemoteManagement.Tokens = []config.ManagementToken{
+		{Name: "dash", Key: "viewer-token", Role: "usage-viewer"},
+		{Name: "typo", Key: "bad-role-token", Role: "superuser"},
+	}
+	h := &Handler{cfg: cfg, failedAttempts: make(map[string]*attemptInfo)}
+
+	engine := gin.New()
+	group := engine.Group("/v0/management", h.Middleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	group.GET("/usage", ok)
+	group.PUT("/otel-endpoint", ok)
+
+	do := func(method, path, key string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := do(http.MethodGet, "/v0/management/usage", "viewer-token"); code != http.StatusOK {
+		t.Fatalf("usage-viewer GET /usage = %d, want 200", code)
+	}
+	if code := do(http.MethodPut, "/v0/management/otel-endpoint", "viewer-token"); code != http.StatusForbidden {
+		t.Fatalf("usage-viewer PUT /otel-endpoint = %d, want 403", code)
+	}
+	if code := do(http.MethodGet, "/v0/management/usage", "bad-role-token"); code != http.StatusUnauthorized {
+		t.Fatalf("token with unknown role = %d, want 401", code)
+	}
+}
@@ -0,0 +1,139 @@
+package management
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/replay"
+)
+
+// maxReplayResponseBytes caps the upstream response echoed back to the caller.
+const maxReplayResponseBytes = 4 << 20
+
+type replayRequest struct {
+	// Name selects a request log file inside the log directory.
+	Name string `json:"name"`
+	// Log carries raw request log content, used when the file lives elsewhere (e.g. the CLI).
+	Log string `json:"log"`
+	replay.Options
+}
+
+// SetReplayHandler configures the HTTP handler used to re-issue replayed requests.
+func (h *Handler) SetReplayHandler(handler http.Handler) { h.replayHandler = handler }
+
+// ReplayRequestLog re-issues a request recorded in a request log against the running server.
+// The replay may be pinned to a credential (auth_id), redirected to another model, or
+// executed as a dry run that only returns the reconstructed request.
+func (h *Handler) ReplayRequestLog(c *gin.Context) {
+	var body replayRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	data := []byte(body.Log)
+	if name := strings.TrimSpace(body.Name); name != "" {
+		raw, status, err := h.readRequestLog(name)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		data = raw
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name or log is required"})
+		return
+	}
+
+	logged, err := replay.Parse(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	prepared, err := logged.Prepare(body.Options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if authID := strings.TrimSpace(body.AuthID); authID != "" && h.authManager != nil {
+		if _, ok := h.authManager.GetByID(authID); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "auth not found"})
+			return
+		}
+	}
+
+	request := gin.H{
+		"method":  prepared.Method,
+		"url":     prepared.URL,
+		"headers": prepared.Headers,
+		"body":    string(prepared.Body),
+	}
+	if body.DryRun {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "request": request})
+		return
+	}
+	if h.replayHandler == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "replay unavailable"})
+		return
+	}
+
+	req, err := http.NewRequestWithContext(replay.WithOptions(c.Request.Context(), body.Options), prepared.Method, prepared.URL, bytes.NewReader(prepared.Body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Header = prepared.Headers
+	req.RemoteAddr = c.Request.RemoteAddr
+
+	recorder := httptest.NewRecorder()
+	h.replayHandler.ServeHTTP(recorder, req)
+
+	respBody := recorder.Body.Bytes()
+	truncated := false
+	if len(respBody) > maxReplayResponseBytes {
+		respBody = respBody[:maxReplayResponseBytes]
+		truncated = true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"request": request,
+		"response": gin.H{
+			"status":    recorder.Code,
+			"headers":   recorder.Header(),
+			"body":      string(respBody),
+			"truncated": truncated,
+		},
+	})
+}
+
+// readRequestLog loads a request log file by name from the log directory.
+func (h *Handler) readRequestLog(name string) ([]byte, int, error) {
+	if strings.Contains(name, "/") || strings.Contains(name, "\\") || !strings.HasSuffix(name, ".log") {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid log file name")
+	}
+	dir := h.logDirectory()
+	if strings.TrimSpace(dir) == "" {
+		return nil, http.StatusInternalServerError, fmt.Errorf("log directory not configured")
+	}
+	dirAbs, errAbs := filepath.Abs(dir)
+	if errAbs != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to resolve log directory: %v", errAbs)
+	}
+	fullPath := filepath.Clean(filepath.Join(dirAbs, name))
+	if !strings.HasPrefix(fullPath, dirAbs+string(os.PathSeparator)) {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid log file path")
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, http.StatusNotFound, fmt.Errorf("log file not found")
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to read log file: %v", err)
+	}
+	return data, http.StatusOK, nil
+}
@@ -0,0 +1,16 @@
+package management
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// GetStatus reports the health of the usage pipeline in one document: dispatcher
+// and write queue depths, the last successful database insert, OTLP flush results,
+// the last retention pass and per-sink error counters. Monitors can alert on it to
+// catch telemetry that fails silently.
+func (h *Handler) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, usage.CurrentTelemetryStatus())
+}
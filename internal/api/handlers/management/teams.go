@@ -0,0 +1,118 @@
+package management
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/policy"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/team"
+)
+
+// teams: []Team
+func (h *Handler) GetTeams(c *gin.Context) {
+	c.JSON(200, gin.H{"teams": h.cfg.Teams})
+}
+
+func (h *Handler) PutTeams(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "failed to read body"})
+		return
+	}
+	var arr []config.Team
+	if err = json.Unmarshal(data, &arr); err != nil {
+		var obj struct {
+			Items []config.Team `json:"items"`
+		}
+		if err2 := json.Unmarshal(data, &obj); err2 != nil {
+			c.JSON(400, gin.H{"error": "invalid body"})
+			return
+		}
+		arr = obj.Items
+	}
+	out := make([]config.Team, 0, len(arr))
+	for i := range arr {
+		arr[i].Name = strings.TrimSpace(arr[i].Name)
+		if arr[i].Name == "" {
+			continue
+		}
+		out = append(out, arr[i])
+	}
+	h.applyTeams(c, out)
+}
+
+func (h *Handler) PatchTeam(c *gin.Context) {
+	var body struct {
+		Index *int         `json:"index"`
+		Match *string      `json:"match"`
+		Value *config.Team `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Value == nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+	value := *body.Value
+	value.Name = strings.TrimSpace(value.Name)
+	if value.Name == "" {
+		c.JSON(400, gin.H{"error": "name is required"})
+		return
+	}
+	teams := append([]config.Team(nil), h.cfg.Teams...)
+	if body.Index != nil && *body.Index >= 0 && *body.Index < len(teams) {
+		teams[*body.Index] = value
+		h.applyTeams(c, teams)
+		return
+	}
+	match := value.Name
+	if body.Match != nil {
+		match = strings.TrimSpace(*body.Match)
+	}
+	for i := range teams {
+		if teams[i].Name == match {
+			teams[i] = value
+			h.applyTeams(c, teams)
+			return
+		}
+	}
+	if body.Index == nil && body.Match == nil {
+		h.applyTeams(c, append(teams, value))
+		return
+	}
+	c.JSON(404, gin.H{"error": "item not found"})
+}
+
+func (h *Handler) DeleteTeam(c *gin.Context) {
+	if val := strings.TrimSpace(c.Query("name")); val != "" {
+		out := make([]config.Team, 0, len(h.cfg.Teams))
+		for _, v := range h.cfg.Teams {
+			if v.Name != val {
+				out = append(out, v)
+			}
+		}
+		h.applyTeams(c, out)
+		return
+	}
+	if idxStr := c.Query("index"); idxStr != "" {
+		var idx int
+		_, err := fmt.Sscanf(idxStr, "%d", &idx)
+		if err == nil && idx >= 0 && idx < len(h.cfg.Teams) {
+			out := append([]config.Team(nil), h.cfg.Teams[:idx]...)
+			out = append(out, h.cfg.Teams[idx+1:]...)
+			h.applyTeams(c, out)
+			return
+		}
+	}
+	c.JSON(400, gin.H{"error": "missing name or index"})
+}
+
+// applyTeams activates team membership, quotas and policies immediately; team
+// spending caps follow once the config watcher reloads the persisted file.
+func (h *Handler) applyTeams(c *gin.Context, teams []config.Team) {
+	h.cfg.Teams = teams
+	team.Set(teams)
+	policy.SetPolicies(h.cfg.EffectiveAPIKeyPolicies())
+	h.persist(c)
+}
@@ -1,10 +1,15 @@
 package management
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
 )
 
 // GetUsageStatistics returns the in-memory request statistics snapshot.
@@ -18,3 +23,434 @@ func (h *Handler) GetUsageStatistics(c *gin.Context) {
 		"failed_requests": snapshot.FailureCount,
 	})
 }
+
+// GetUsageInFlight lists streaming responses that are still running with the tokens
+// observed so far, so dashboards can show token burn before the final records land.
+func (h *Handler) GetUsageInFlight(c *gin.Context) {
+	streams := coreusage.InFlightStreams()
+	var inputTokens, outputTokens, totalTokens int64
+	for _, s := range streams {
+		inputTokens += s.InputTokens
+		outputTokens += s.OutputTokens
+		totalTokens += s.TotalTokens
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"streams":       streams,
+		"count":         len(streams),
+		"input_tokens":  inputTokens,
+		"output_tokens": outputTokens,
+		"total_tokens":  totalTokens,
+	})
+}
+
+// GetUsageTagSummary groups persisted usage by classification tag over the last N days.
+func (h *Handler) GetUsageTagSummary(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days) * 24 * time.Hour)
+	summary, err := usage.QueryTagSummary(c.Request.Context(), since)
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "tags": summary})
+}
+
+// GetUsageDaily returns persisted daily usage aggregates over the last N days.
+// It works against read-only replicas as well as the primary writer.
+func (h *Handler) GetUsageDaily(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryDailyUsage(c.Request.Context(), since, c.Query("provider"))
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "daily": rows})
+}
+
+// GetUsageErrors breaks failed upstream requests over the last N days down by
+// provider, model and error class (timeout, auth_expired, quota, content_filter,
+// 5xx, network, ...), with per-class totals for a quick triage overview.
+func (h *Handler) GetUsageErrors(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryErrorBreakdown(c.Request.Context(), since, c.Query("provider"))
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	byClass := make(map[string]int64)
+	var total int64
+	for _, row := range rows {
+		byClass[row.ErrorClass] += row.Requests
+		total += row.Requests
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "total_failed": total, "by_class": byClass, "errors": rows})
+}
+
+// usageClientSorts are the orderings GetUsageClients accepts; "key" groups the rows
+// by client key, busiest first within a key.
+var usageClientSorts = pageSort{Names: []string{"key", "requests", "last_seen"}, Default: "key"}
+
+var usageClientSortKeys = map[string]func(usage.KeyClientRow) string{
+	"key":       func(row usage.KeyClientRow) string { return row.APIKeyHash + "\x00" + pageKeyInt(-row.Requests) },
+	"requests":  func(row usage.KeyClientRow) string { return pageKeyInt(row.Requests) },
+	"last_seen": func(row usage.KeyClientRow) string { return row.LastSeen },
+}
+
+func usageClientID(row usage.KeyClientRow) string {
+	return strings.Join([]string{row.APIKeyHash, row.ClientIPHash, row.ClientCountry, row.UserAgent}, "\x00")
+}
+
+// GetUsageClients lists the client addresses, countries and user agents each client
+// key was used from over the last N days, with the number of distinct addresses and
+// countries per key, to spot shared or leaked keys. Filter with ?api_key_hash=.
+// The per-key summary covers every row; the rows themselves are paginated.
+// Rows are only recorded while client-attribution is enabled.
+func (h *Handler) GetUsageClients(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	q, ok := parsePageQuery(c, usageClientSorts)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryKeyClients(c.Request.Context(), since, c.Query("api_key_hash"))
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	type keySummary struct {
+		Addresses int `json:"distinct_addresses"`
+		Countries int `json:"distinct_countries"`
+	}
+	addresses := make(map[string]map[string]struct{})
+	countries := make(map[string]map[string]struct{})
+	for _, row := range rows {
+		if addresses[row.APIKeyHash] == nil {
+			addresses[row.APIKeyHash] = make(map[string]struct{})
+			countries[row.APIKeyHash] = make(map[string]struct{})
+		}
+		addresses[row.APIKeyHash][row.ClientIPHash] = struct{}{}
+		if row.ClientCountry != "" {
+			countries[row.APIKeyHash][row.ClientCountry] = struct{}{}
+		}
+	}
+	keys := make(map[string]keySummary, len(addresses))
+	for key, seen := range addresses {
+		keys[key] = keySummary{Addresses: len(seen), Countries: len(countries[key])}
+	}
+	page, info := paginate(rows, q, usageClientSortKeys, usageClientID)
+	c.JSON(http.StatusOK, gin.H{"days": days, "keys": keys, "clients": page, "page": info})
+}
+
+// GetUsageTeams totals requests, tokens and priced spend per team over the last N
+// days. Only requests made while the key belonged to a team are counted.
+func (h *Handler) GetUsageTeams(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryTeamUsage(c.Request.Context(), since)
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "teams": rows})
+}
+
+// GetUsageCache reports prompt-cache hit ratios and estimated savings per provider,
+// model and day over the last N days, with overall totals. Savings are priced with
+// usage-db model-prices and are net of the premium paid for cache writes.
+func (h *Handler) GetUsageCache(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryCacheReport(c.Request.Context(), since, c.Query("provider"))
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var promptTokens, cachedTokens, cacheCreationTokens int64
+	var savings float64
+	for _, row := range rows {
+		promptTokens += row.PromptTokens
+		cachedTokens += row.CachedTokens
+		cacheCreationTokens += row.CacheCreationTokens
+		savings += row.SavingsUSD
+	}
+	hitRatio := 0.0
+	if promptTokens > 0 {
+		hitRatio = float64(cachedTokens) / float64(promptTokens)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"days":                  days,
+		"prompt_tokens":         promptTokens,
+		"cached_tokens":         cachedTokens,
+		"cache_creation_tokens": cacheCreationTokens,
+		"hit_ratio":             hitRatio,
+		"savings_usd":           savings,
+		"cache":                 rows,
+	})
+}
+
+// GetUsageTools reports tool calls, tool result tokens and image inputs per provider,
+// model and day over the last N days, with overall totals, so agentic workloads can
+// be told apart from plain chat.
+func (h *Handler) GetUsageTools(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryToolUsage(c.Request.Context(), since, c.Query("provider"))
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var totals usage.ToolUsageRow
+	for _, row := range rows {
+		totals.Requests += row.Requests
+		totals.ToolRequests += row.ToolRequests
+		totals.ToolCalls += row.ToolCalls
+		totals.ToolResultTokens += row.ToolResultTokens
+		totals.ImageRequests += row.ImageRequests
+		totals.ImageInputs += row.ImageInputs
+		totals.DocumentInputs += row.DocumentInputs
+		totals.MediaBytes += row.MediaBytes
+		totals.MediaRejections += row.MediaRejections
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"days":               days,
+		"requests":           totals.Requests,
+		"tool_requests":      totals.ToolRequests,
+		"tool_calls":         totals.ToolCalls,
+		"tool_result_tokens": totals.ToolResultTokens,
+		"image_requests":     totals.ImageRequests,
+		"image_inputs":       totals.ImageInputs,
+		"document_inputs":    totals.DocumentInputs,
+		"media_bytes":        totals.MediaBytes,
+		"media_rejections":   totals.MediaRejections,
+		"tools":              rows,
+	})
+}
+
+// GetUsageReasoning reports reasoning budget enforcement per client key, model and day
+// over the last N days: requests clamped, rejected or flagged by reasoning-budgets
+// rules and responses that reported more reasoning tokens than allowed.
+func (h *Handler) GetUsageReasoning(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryReasoningBudgets(c.Request.Context(), since, c.Query("provider"))
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var totals usage.ReasoningBudgetRow
+	for _, row := range rows {
+		totals.Clamped += row.Clamped
+		totals.Rejected += row.Rejected
+		totals.Flagged += row.Flagged
+		totals.Exceeded += row.Exceeded
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"days":      days,
+		"clamped":   totals.Clamped,
+		"rejected":  totals.Rejected,
+		"flagged":   totals.Flagged,
+		"exceeded":  totals.Exceeded,
+		"reasoning": rows,
+	})
+}
+
+// GetUsageExport streams a tamper-evident archive of a billing period's request
+// records (?month=YYYY-MM or ?from=YYYY-MM-DD&to=YYYY-MM-DD, optional ?provider=),
+// signed with usage-db.export-signing-key when one is configured.
+func (h *Handler) GetUsageExport(c *gin.Context) {
+	from, to, err := usage.ParseExportPeriod(c.Query("month"), c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts := usage.ExportOptions{From: from, To: to, Provider: c.Query("provider")}
+	if path := strings.TrimSpace(h.cfg.UsageDatabase.ExportSigningKey); path != "" {
+		if opts.SigningKey, err = usage.LoadExportSigningKey(path); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "load export signing key: " + err.Error()})
+			return
+		}
+	}
+	name := "cliproxy-usage-" + from.Format("20060102") + "-" + to.Format("20060102") + ".tar.gz"
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	if _, err = usage.ExportUsage(c.Request.Context(), c.Writer, opts); err != nil {
+		if c.Writer.Written() {
+			// The archive is already partially sent; the client sees a truncated download.
+			_ = c.Error(err)
+			return
+		}
+		c.Writer.Header().Del("Content-Disposition")
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GetUsageMonthly returns per-month usage totals over the last N months (default 12).
+// Months whose daily rows were compacted by retention are served from usage_monthly.
+func (h *Handler) GetUsageMonthly(c *gin.Context) {
+	months := 12
+	if raw := strings.TrimSpace(c.Query("months")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid months"})
+			return
+		}
+		months = parsed
+	}
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month()-time.Month(months-1), 1, 0, 0, 0, 0, time.UTC)
+	rows, err := usage.QueryMonthlyUsage(c.Request.Context(), since, c.Query("provider"))
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"months": months, "monthly": rows})
+}
+
+// GetUsageDBStatus reports whether the usage database is open and whether it is a read-only replica.
+func (h *Handler) GetUsageDBStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, usage.CurrentDatabaseStatus())
+}
+
+// usageQueryDays parses the optional ?days= parameter (default 7), writing a 400 on invalid input.
+func usageQueryDays(c *gin.Context) (int, bool) {
+	days := 7
+	if raw := strings.TrimSpace(c.Query("days")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days"})
+			return 0, false
+		}
+		days = parsed
+	}
+	return days, true
+}
+
+// GetUsageRequest returns the usage rows recorded for one X-Request-ID so a single
+// failing call can be traced across retries and credentials.
+func (h *Handler) GetUsageRequest(c *gin.Context) {
+	requestID := strings.TrimSpace(c.Param("request_id"))
+	if requestID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing request id"})
+		return
+	}
+	rows, err := usage.QueryRequestUsage(c.Request.Context(), requestID)
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "request not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"request_id": requestID, "attempts": rows})
+}
+
+// GetUsageShadow reports shadow traffic comparisons over the last N days: a summary per
+// rule and model pair with average latency and output token deltas, plus the most
+// recent comparisons. Filter with ?rule= and cap the list with ?limit= (default 50).
+// Response bodies are included with ?responses=true, which requires the admin role
+// because they carry model output.
+func (h *Handler) GetUsageShadow(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	limit, err := parseLimit(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + err.Error()})
+		return
+	}
+	if limit == 0 {
+		limit = 50
+	}
+	withResponses, _ := strconv.ParseBool(c.Query("responses"))
+	if withResponses && c.GetString(managementRoleKey) != RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "responses require the admin role"})
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	summary, err := usage.QueryShadowSummary(c.Request.Context(), since)
+	var comparisons []usage.ShadowComparisonRow
+	if err == nil {
+		comparisons, err = usage.QueryShadowComparisons(c.Request.Context(), since, c.Query("rule"), limit, withResponses)
+	}
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"days": days, "summary": summary, "comparisons": comparisons})
+}
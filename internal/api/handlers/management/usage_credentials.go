@@ -0,0 +1,153 @@
+package management
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+)
+
+// credentialHealth is the live rotation state of a credential.
+type credentialHealth struct {
+	Status         string    `json:"status"`
+	Disabled       bool      `json:"disabled"`
+	Unavailable    bool      `json:"unavailable"`
+	QuotaExceeded  bool      `json:"quota_exceeded"`
+	NextRetryAfter time.Time `json:"next_retry_after,omitempty"`
+	// CoolingModels lists models the credential is currently blocked for.
+	CoolingModels  []string `json:"cooling_models,omitempty"`
+	CircuitBreaker string   `json:"circuit_breaker,omitempty"`
+}
+
+// credentialFairness combines persisted usage of one credential with its live state.
+type credentialFairness struct {
+	AuthID          string            `json:"auth_id,omitempty"`
+	Provider        string            `json:"provider"`
+	CredentialLabel string            `json:"credential_label"`
+	AccountEmail    string            `json:"account_email,omitempty"`
+	TotalRequests   int64             `json:"total_requests"`
+	FailedRequests  int64             `json:"failed_requests"`
+	RateLimited     int64             `json:"rate_limited"`
+	TotalTokens     int64             `json:"total_tokens"`
+	RequestShare    float64           `json:"request_share"`
+	FailureRate     float64           `json:"failure_rate"`
+	RateLimitRate   float64           `json:"rate_limit_rate"`
+	Health          *credentialHealth `json:"health,omitempty"`
+}
+
+// usageCredentialSorts are the orderings GetUsageCredentials accepts; "provider"
+// groups credentials by provider, busiest first within a provider.
+var usageCredentialSorts = pageSort{Names: []string{"provider", "requests", "failure_rate", "rate_limit_rate"}, Default: "provider"}
+
+var usageCredentialSortKeys = map[string]func(*credentialFairness) string{
+	"provider": func(entry *credentialFairness) string {
+		return entry.Provider + "\x00" + pageKeyInt(-entry.TotalRequests)
+	},
+	"requests":        func(entry *credentialFairness) string { return pageKeyInt(entry.TotalRequests) },
+	"failure_rate":    func(entry *credentialFairness) string { return pageKeyInt(int64(entry.FailureRate * 1e9)) },
+	"rate_limit_rate": func(entry *credentialFairness) string { return pageKeyInt(int64(entry.RateLimitRate * 1e9)) },
+}
+
+// GetUsageCredentials reports per-credential request share, failure rate and
+// rate-limit rate over the last N days (default 7) next to each credential's
+// current cooldown and health state. Shares are relative to the provider's total,
+// and registered credentials without traffic are listed with a zero share so
+// uneven rotation stands out.
+func (h *Handler) GetUsageCredentials(c *gin.Context) {
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	q, ok := parsePageQuery(c, usageCredentialSorts)
+	if !ok {
+		return
+	}
+	provider := strings.TrimSpace(c.Query("provider"))
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryCredentialUsage(c.Request.Context(), since, provider)
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries := make([]*credentialFairness, 0, len(rows))
+	byFingerprint := make(map[string]*credentialFairness, len(rows))
+	providerTotals := make(map[string]int64)
+	for _, row := range rows {
+		entry := &credentialFairness{
+			Provider:        row.Provider,
+			CredentialLabel: row.CredentialLabel,
+			AccountEmail:    row.AccountEmail,
+			TotalRequests:   row.TotalRequests,
+			FailedRequests:  row.FailedRequests,
+			RateLimited:     row.RateLimited,
+			TotalTokens:     row.TotalTokens,
+		}
+		entries = append(entries, entry)
+		byFingerprint[row.Provider+"\x00"+row.Fingerprint] = entry
+		providerTotals[row.Provider] += row.TotalRequests
+	}
+
+	if h.authManager != nil {
+		breakers := make(map[string]string)
+		for _, b := range h.authManager.CircuitBreakers() {
+			breakers[b.AuthID] = b.State
+		}
+		now := time.Now()
+		for _, auth := range h.authManager.List() {
+			if provider != "" && !strings.EqualFold(auth.Provider, provider) {
+				continue
+			}
+			entry, found := byFingerprint[auth.Provider+"\x00"+usage.CredentialFingerprint(auth.ID)]
+			if !found {
+				entry = &credentialFairness{Provider: auth.Provider, CredentialLabel: auth.ID}
+				entries = append(entries, entry)
+			}
+			entry.AuthID = auth.ID
+			entry.Health = authHealth(auth, breakers[auth.ID], now)
+		}
+	}
+
+	for _, entry := range entries {
+		if total := providerTotals[entry.Provider]; total > 0 {
+			entry.RequestShare = float64(entry.TotalRequests) / float64(total)
+		}
+		if entry.TotalRequests > 0 {
+			entry.FailureRate = float64(entry.FailedRequests) / float64(entry.TotalRequests)
+			entry.RateLimitRate = float64(entry.RateLimited) / float64(entry.TotalRequests)
+		}
+	}
+	page, info := paginate(entries, q, usageCredentialSortKeys, func(entry *credentialFairness) string {
+		return entry.Provider + "\x00" + entry.CredentialLabel + "\x00" + entry.AuthID
+	})
+	c.JSON(http.StatusOK, gin.H{"days": days, "credentials": page, "page": info})
+}
+
+func authHealth(auth *coreauth.Auth, breaker string, now time.Time) *credentialHealth {
+	health := &credentialHealth{
+		Status:         string(auth.Status),
+		Disabled:       auth.Disabled,
+		Unavailable:    auth.Unavailable,
+		QuotaExceeded:  auth.Quota.Exceeded,
+		CircuitBreaker: breaker,
+	}
+	if auth.NextRetryAfter.After(now) {
+		health.NextRetryAfter = auth.NextRetryAfter
+	}
+	for model, state := range auth.ModelStates {
+		if state != nil && state.Unavailable && state.NextRetryAfter.After(now) {
+			health.CoolingModels = append(health.CoolingModels, model)
+		}
+	}
+	sort.Strings(health.CoolingModels)
+	return health
+}
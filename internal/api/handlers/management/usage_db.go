@@ -0,0 +1,282 @@
+package management
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// GetUsageDBRetention returns the configured usage database retention settings
+// alongside the policy currently applied by the running store.
+func (h *Handler) GetUsageDBRetention(c *gin.Context) {
+	db := h.cfg.UsageDatabase
+	resp := gin.H{
+		"retention-days":            db.RetentionDays,
+		"requests-retention-days":   db.RequestsRetentionDays,
+		"daily-retention-days":      db.DailyRetentionDays,
+		"provider-retention-days":   config.NormalizeProviderRetentionDays(db.ProviderRetentionDays),
+		"credential-retention-days": config.NormalizeCredentialRetentionDays(db.CredentialRetentionDays),
+	}
+	if active, ok := usage.CurrentRetentionPolicy(); ok {
+		resp["active"] = active
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// PutUsageDBRetention updates any provided retention fields. Omitted fields keep their value.
+func (h *Handler) PutUsageDBRetention(c *gin.Context) {
+	var body struct {
+		RetentionDays           *int           `json:"retention-days"`
+		RequestsRetentionDays   *int           `json:"requests-retention-days"`
+		DailyRetentionDays      *int           `json:"daily-retention-days"`
+		ProviderRetentionDays   map[string]int `json:"provider-retention-days"`
+		CredentialRetentionDays map[string]int `json:"credential-retention-days"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	for _, v := range []*int{body.RetentionDays, body.RequestsRetentionDays, body.DailyRetentionDays} {
+		if v != nil && *v < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "retention days must not be negative"})
+			return
+		}
+	}
+	db := &h.cfg.UsageDatabase
+	if body.RetentionDays != nil && *body.RetentionDays > 0 {
+		db.RetentionDays = *body.RetentionDays
+	}
+	if body.RequestsRetentionDays != nil {
+		db.RequestsRetentionDays = *body.RequestsRetentionDays
+	}
+	if body.DailyRetentionDays != nil {
+		db.DailyRetentionDays = *body.DailyRetentionDays
+	}
+	if body.ProviderRetentionDays != nil {
+		db.ProviderRetentionDays = config.NormalizeProviderRetentionDays(body.ProviderRetentionDays)
+	}
+	if body.CredentialRetentionDays != nil {
+		db.CredentialRetentionDays = config.NormalizeCredentialRetentionDays(body.CredentialRetentionDays)
+	}
+	h.persist(c)
+}
+
+// PatchUsageDBProviderRetention sets the request detail retention for one provider.
+// A non-positive value removes the override.
+func (h *Handler) PatchUsageDBProviderRetention(c *gin.Context) {
+	var body struct {
+		Provider *string `json:"provider"`
+		Days     *int    `json:"days"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Provider == nil || body.Days == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	provider := strings.ToLower(strings.TrimSpace(*body.Provider))
+	if provider == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid provider"})
+		return
+	}
+	db := &h.cfg.UsageDatabase
+	if *body.Days <= 0 {
+		if _, ok := db.ProviderRetentionDays[provider]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+			return
+		}
+		delete(db.ProviderRetentionDays, provider)
+		db.ProviderRetentionDays = config.NormalizeProviderRetentionDays(db.ProviderRetentionDays)
+		h.persist(c)
+		return
+	}
+	if db.ProviderRetentionDays == nil {
+		db.ProviderRetentionDays = make(map[string]int)
+	}
+	db.ProviderRetentionDays[provider] = *body.Days
+	h.persist(c)
+}
+
+// DeleteUsageDBProviderRetention removes the retention override for a provider.
+func (h *Handler) DeleteUsageDBProviderRetention(c *gin.Context) {
+	provider := strings.ToLower(strings.TrimSpace(c.Query("provider")))
+	if provider == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing provider"})
+		return
+	}
+	db := &h.cfg.UsageDatabase
+	if _, ok := db.ProviderRetentionDays[provider]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+		return
+	}
+	delete(db.ProviderRetentionDays, provider)
+	db.ProviderRetentionDays = config.NormalizeProviderRetentionDays(db.ProviderRetentionDays)
+	h.persist(c)
+}
+
+// PatchUsageDBCredentialRetention sets the request detail retention for one credential,
+// identified by auth ID, API key or credential fingerprint. Credential overrides win
+// over provider overrides. A non-positive value removes the override.
+func (h *Handler) PatchUsageDBCredentialRetention(c *gin.Context) {
+	var body struct {
+		Credential *string `json:"credential"`
+		Days       *int    `json:"days"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Credential == nil || body.Days == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	credential := strings.TrimSpace(*body.Credential)
+	if credential == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return
+	}
+	db := &h.cfg.UsageDatabase
+	if *body.Days <= 0 {
+		if _, ok := db.CredentialRetentionDays[credential]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "credential not found"})
+			return
+		}
+		delete(db.CredentialRetentionDays, credential)
+		db.CredentialRetentionDays = config.NormalizeCredentialRetentionDays(db.CredentialRetentionDays)
+		h.persist(c)
+		return
+	}
+	if db.CredentialRetentionDays == nil {
+		db.CredentialRetentionDays = make(map[string]int)
+	}
+	db.CredentialRetentionDays[credential] = *body.Days
+	h.persist(c)
+}
+
+// DeleteUsageDBCredentialRetention removes the retention override for a credential.
+func (h *Handler) DeleteUsageDBCredentialRetention(c *gin.Context) {
+	credential := strings.TrimSpace(c.Query("credential"))
+	if credential == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing credential"})
+		return
+	}
+	db := &h.cfg.UsageDatabase
+	if _, ok := db.CredentialRetentionDays[credential]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "credential not found"})
+		return
+	}
+	delete(db.CredentialRetentionDays, credential)
+	db.CredentialRetentionDays = config.NormalizeCredentialRetentionDays(db.CredentialRetentionDays)
+	h.persist(c)
+}
+
+// PostUsageRetention runs a usage database retention pass immediately. With
+// {"dry_run": true} nothing is deleted and the response reports what would be.
+func (h *Handler) PostUsageRetention(c *gin.Context) {
+	var body struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+	}
+	result, err := usage.RunRetention(c.Request.Context(), body.DryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, usage.ErrDatabaseDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+		case errors.Is(err, usage.ErrReadOnly):
+			c.JSON(http.StatusConflict, gin.H{"error": "usage database is a read-only replica"})
+		case errors.Is(err, usage.ErrNotMaintenanceLeader):
+			c.JSON(http.StatusConflict, gin.H{"error": "another process holds the usage database maintenance lease"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetUsageReports lists the scheduled usage reports with their next run and
+// delivery counters.
+func (h *Handler) GetUsageReports(c *gin.Context) {
+	reports := usage.ReportStatuses()
+	if reports == nil {
+		reports = []usage.ReportStatus{}
+	}
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// PostUsageReportSend builds the named report for the period it would cover now
+// and delivers it immediately. With {"dry_run": true} the report is only returned.
+func (h *Handler) PostUsageReportSend(c *gin.Context) {
+	var body struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+	}
+	report, err := usage.SendReport(c.Request.Context(), c.Param("name"), body.DryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, usage.ErrReportNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "report not found"})
+		case errors.Is(err, usage.ErrDatabaseDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+		default:
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "report": report})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// PostUsageFingerprintMigration re-fingerprints stored API key hashes, credential
+// fingerprints and hashed emails after the fingerprint salt changed. Hashes cannot
+// be reversed, so only values this instance still knows are mapped: client API keys,
+// auth IDs, providers, account emails and upstream API keys. When the old scheme
+// was salted too, its salt must be passed as previous_salt.
+func (h *Handler) PostUsageFingerprintMigration(c *gin.Context) {
+	var body struct {
+		PreviousSalt string `json:"previous_salt"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+	}
+	known := []string{"unknown"}
+	if h.cfg != nil {
+		known = append(known, h.cfg.APIKeys...)
+	}
+	if h.authManager != nil {
+		for _, auth := range h.authManager.List() {
+			known = append(known, auth.ID, auth.Provider)
+			if auth.Attributes != nil {
+				known = append(known, auth.Attributes["api_key"], auth.Attributes["account_email"])
+			}
+			if email, ok := auth.Metadata["email"].(string); ok {
+				known = append(known, email)
+			}
+		}
+	}
+	result, err := usage.MigrateFingerprints(c.Request.Context(), known, body.PreviousSalt)
+	if err != nil {
+		switch {
+		case errors.Is(err, usage.ErrDatabaseDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+		case errors.Is(err, usage.ErrReadOnly):
+			c.JSON(http.StatusConflict, gin.H{"error": "usage database is a read-only replica"})
+		case errors.Is(err, usage.ErrFingerprintSaltMismatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "previous_salt does not match the stored fingerprints"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,121 @@
+package management
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// usageEraseResponse extends the database counts with the request log files removed.
+type usageEraseResponse struct {
+	usage.EraseResult
+	RequestLogFiles int `json:"request_log_files"`
+}
+
+// PostUsageErase handles data subject erasure requests. The body names either an
+// api_key_hash or an account_email (plain or fingerprinted); mode is "anonymize"
+// (default) or "delete". Matching usage rows are anonymized or deleted, and request
+// log files carrying the subject's request IDs are removed in either mode since
+// they hold raw payloads. With dry_run nothing is changed.
+func (h *Handler) PostUsageErase(c *gin.Context) {
+	var body struct {
+		APIKeyHash   string `json:"api_key_hash"`
+		AccountEmail string `json:"account_email"`
+		Mode         string `json:"mode"`
+		DryRun       bool   `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	mode := strings.ToLower(strings.TrimSpace(body.Mode))
+	if mode != "" && mode != "anonymize" && mode != "delete" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be anonymize or delete"})
+		return
+	}
+	result, err := usage.EraseSubject(c.Request.Context(), usage.EraseRequest{
+		APIKeyHash:   body.APIKeyHash,
+		AccountEmail: body.AccountEmail,
+		Delete:       mode == "delete",
+		DryRun:       body.DryRun,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, usage.ErrInvalidEraseRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of api_key_hash or account_email is required"})
+		case errors.Is(err, usage.ErrDatabaseDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+		case errors.Is(err, usage.ErrReadOnly):
+			c.JSON(http.StatusConflict, gin.H{"error": "usage database is a read-only replica"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	resp := usageEraseResponse{EraseResult: result}
+	if len(result.RequestIDs) > 0 {
+		resp.RequestLogFiles, err = removeRequestLogs(h.logDirectory(), result.RequestIDs, body.DryRun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("usage rows erased but request logs could not be scanned: %v", err)})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// removeRequestLogs deletes request log files whose headers carry one of the given
+// request IDs and returns how many matched. The main log and its rotations are skipped.
+func removeRequestLogs(dir string, requestIDs []string, dryRun bool) (int, error) {
+	if strings.TrimSpace(dir) == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	needles := make([][]byte, 0, len(requestIDs))
+	for _, id := range requestIDs {
+		needles = append(needles, []byte(http.CanonicalHeaderKey(tracing.RequestIDHeader)+": "+id+"\n"))
+	}
+
+	matched := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".log") || name == defaultLogFileName || isRotatedLogFile(name) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		data, errRead := os.ReadFile(path)
+		if errRead != nil {
+			if os.IsNotExist(errRead) {
+				continue
+			}
+			return matched, errRead
+		}
+		for _, needle := range needles {
+			if !bytes.Contains(data, needle) {
+				continue
+			}
+			matched++
+			if !dryRun {
+				if errRemove := os.Remove(path); errRemove != nil && !os.IsNotExist(errRemove) {
+					return matched, errRemove
+				}
+			}
+			break
+		}
+	}
+	return matched, nil
+}
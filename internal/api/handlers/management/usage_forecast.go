@@ -0,0 +1,70 @@
+package management
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// GetUsageForecast predicts when each credential of a provider listed in
+// usage-db.provider-quotas will reach its quota, extrapolating the burn rate of
+// the last N hours (default 3). Credentials closest to exhaustion come first so
+// operators can rotate them out ahead of time. For capacity planning it also
+// projects the daily tokens and cost of every provider over the next 30 days,
+// fitted to the last history-days (default 56) of usage_daily.
+func (h *Handler) GetUsageForecast(c *gin.Context) {
+	hours := 3
+	if raw := strings.TrimSpace(c.Query("hours")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > 24*31 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hours"})
+			return
+		}
+		hours = parsed
+	}
+	historyDays := 56
+	if raw := strings.TrimSpace(c.Query("history-days")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > 366 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid history-days"})
+			return
+		}
+		historyDays = parsed
+	}
+	quotas := h.cfg.UsageDatabase.ProviderQuotas
+	provider := strings.TrimSpace(c.Query("provider"))
+	if provider != "" {
+		quotas = nil
+		if quota, ok := h.cfg.UsageDatabase.ProviderQuotas[provider]; ok {
+			quotas = map[string]config.ProviderQuota{provider: quota}
+		}
+	}
+	now := time.Now()
+	forecasts, err := usage.QueryQuotaForecast(c.Request.Context(), quotas, now, time.Duration(hours)*time.Hour)
+	var projections []usage.UsageProjection
+	if err == nil {
+		projections, err = usage.QueryUsageProjection(c.Request.Context(), provider, now, historyDays)
+	}
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"lookback_hours": hours,
+		"forecasts":      forecasts,
+		"history_days":   historyDays,
+		"horizon_days":   usage.ProjectionHorizonDays,
+		"confidence":     usage.ProjectionConfidence,
+		"projections":    projections,
+	})
+}
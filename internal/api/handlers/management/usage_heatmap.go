@@ -0,0 +1,99 @@
+package management
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// defaultHeatmapDays covers four full weeks, so every weekday is sampled equally.
+const defaultHeatmapDays = 28
+
+// GetUsageHeatmap reports requests and tokens per hour of day and day of week, for
+// planning maintenance windows and quota allocation. The range is ?from= and ?to=
+// (YYYY-MM-DD, to exclusive) or the last ?days= (default 28); ?tz= is an IANA zone
+// (default UTC) applied to both the range and the buckets, and ?metric= (requests or
+// tokens) selects the values of matrix, peak and quietest.
+func (h *Handler) GetUsageHeatmap(c *gin.Context) {
+	loc := time.UTC
+	if name := strings.TrimSpace(c.Query("tz")); name != "" {
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tz"})
+			return
+		}
+	}
+	metric := strings.ToLower(strings.TrimSpace(c.DefaultQuery("metric", "requests")))
+	if metric != "requests" && metric != "tokens" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "metric must be requests or tokens"})
+		return
+	}
+
+	var start, end time.Time
+	if c.Query("from") != "" || c.Query("to") != "" {
+		from, to, err := usage.ParseExportPeriod("", c.Query("from"), c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+		end = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	} else {
+		days := defaultHeatmapDays
+		if c.Query("days") != "" {
+			var ok bool
+			if days, ok = usageQueryDays(c); !ok {
+				return
+			}
+		}
+		now := time.Now().In(loc)
+		end = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+		start = end.AddDate(0, 0, -days)
+	}
+
+	heatmap, err := usage.QueryUsageHeatmap(c.Request.Context(), start, end, c.Query("provider"), loc)
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	value := func(cell usage.HeatmapCell) int64 {
+		if metric == "tokens" {
+			return cell.Tokens
+		}
+		return cell.Requests
+	}
+	matrix := make([][]int64, 7)
+	for i := range matrix {
+		matrix[i] = make([]int64, 24)
+	}
+	peak, quietest := heatmap.Cells[0], heatmap.Cells[0]
+	for _, cell := range heatmap.Cells {
+		matrix[cell.Weekday][cell.Hour] = value(cell)
+		if value(cell) > value(peak) {
+			peak = cell
+		}
+		if value(cell) < value(quietest) {
+			quietest = cell
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":     start.Format("2006-01-02"),
+		"to":       end.Format("2006-01-02"),
+		"timezone": loc.String(),
+		"metric":   metric,
+		"requests": heatmap.Requests,
+		"tokens":   heatmap.Tokens,
+		"matrix":   matrix,
+		"peak":     peak,
+		"quietest": quietest,
+		"cells":    heatmap.Cells,
+	})
+}
@@ -0,0 +1,41 @@
+package management
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// GetUsageSinks returns the configured usage-sinks with the state of their running
+// processes. Sinks run arbitrary commands, so they can only be changed in the
+// config file, not through the management API. Env values often hold credentials
+// and are redacted.
+func (h *Handler) GetUsageSinks(c *gin.Context) {
+	sinks := make([]config.UsageSinkConfig, 0, len(h.cfg.UsageSinks))
+	for _, sink := range h.cfg.UsageSinks {
+		if len(sink.Env) > 0 {
+			env := make(map[string]string, len(sink.Env))
+			for key := range sink.Env {
+				env[key] = redactedValue
+			}
+			sink.Env = env
+		}
+		sinks = append(sinks, sink)
+	}
+	status := usage.UsageSinkStatuses()
+	if status == nil {
+		status = []usage.SinkStatus{}
+	}
+	c.JSON(http.StatusOK, gin.H{"usage-sinks": sinks, "status": status})
+}
+
+// redactedValue replaces secret values in management responses.
+const redactedValue = "[redacted]"
+
+// GetKafkaAvroSchema returns the Avro schema of the usage events the Kafka publisher
+// sends with format "avro", so consumers can register it or decode the messages.
+func (h *Handler) GetKafkaAvroSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", []byte(usage.UsageEventAvroSchema))
+}
@@ -0,0 +1,69 @@
+package management
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// GetUsageSpendCaps lists client keys and teams with a monthly spending cap, their
+// spend so far this month and whether they are suspended. Keys are identified by
+// api_key_hash, teams by name.
+func (h *Handler) GetUsageSpendCaps(c *gin.Context) {
+	caps, err := usage.SpendCaps(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"spend-caps": caps})
+}
+
+// GetUsageProviderSpendCaps lists providers with a monthly spend cap, their spend so
+// far this month and whether requests are currently routed away from them.
+func (h *Handler) GetUsageProviderSpendCaps(c *gin.Context) {
+	caps, err := usage.ProviderSpendCaps(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"provider-spend-caps": caps})
+}
+
+// PostUsageSpendCapReset lifts a spending cap suspension and restarts the key's
+// spend count, so it regains its full cap for the rest of the month.
+func (h *Handler) PostUsageSpendCapReset(c *gin.Context) {
+	writeSpendCapReset(c, usage.ResetSpendCap(c.Request.Context(), c.Param("key_hash")), "api key")
+}
+
+// PostUsageTeamSpendCapReset lifts a team's spending cap suspension and restarts
+// its spend count, unblocking every key of the team.
+func (h *Handler) PostUsageTeamSpendCapReset(c *gin.Context) {
+	writeSpendCapReset(c, usage.ResetTeamSpendCap(c.Request.Context(), c.Param("name")), "team")
+}
+
+func writeSpendCapReset(c *gin.Context, err error, subject string) {
+	if err != nil {
+		switch {
+		case errors.Is(err, usage.ErrUnknownSpendKey):
+			c.JSON(http.StatusNotFound, gin.H{"error": subject + " has no spending cap"})
+		case errors.Is(err, usage.ErrDatabaseDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+		case errors.Is(err, usage.ErrReadOnly):
+			c.JSON(http.StatusConflict, gin.H{"error": "usage database is a read-only replica"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
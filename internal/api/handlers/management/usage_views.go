@@ -0,0 +1,145 @@
+package management
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// grafanaInfinityPlugin is the Grafana data source the generated dashboard queries the
+// management API with. The management key is configured on the data source as an
+// Authorization header, so it never appears in the dashboard JSON.
+const grafanaInfinityPlugin = "yesoreyeram-infinity-datasource"
+
+// GetUsageDBView returns the rows of a reporting view over the last N days (default 7).
+func (h *Handler) GetUsageDBView(c *gin.Context) {
+	name := c.Param("view")
+	if !slices.Contains(usage.ViewNames(), name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown view", "views": usage.ViewNames()})
+		return
+	}
+	days, ok := usageQueryDays(c)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-time.Duration(days-1) * 24 * time.Hour)
+	rows, err := usage.QueryView(c.Request.Context(), name, since)
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "usage database disabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"view": name, "days": days, "rows": rows})
+}
+
+// GetUsageDBGrafanaDashboard returns a Grafana dashboard that charts the reporting
+// views through the management API. The API base URL defaults to the address the
+// request came in on and can be overridden with ?base-url=.
+func (h *Handler) GetUsageDBGrafanaDashboard(c *gin.Context) {
+	base := strings.TrimRight(strings.TrimSpace(c.Query("base-url")), "/")
+	if base == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		if forwarded := c.GetHeader("X-Forwarded-Proto"); forwarded != "" {
+			scheme = forwarded
+		}
+		base = scheme + "://" + c.Request.Host
+	}
+	c.Header("Content-Disposition", `attachment; filename="cliproxy-usage-dashboard.json"`)
+	c.JSON(http.StatusOK, grafanaDashboard(base+"/v0/management"))
+}
+
+// grafanaPanel describes one dashboard panel backed by a management endpoint.
+type grafanaPanel struct {
+	title   string
+	kind    string
+	path    string
+	columns [][2]string // selector, type
+	width   int
+}
+
+func grafanaDashboard(api string) gin.H {
+	panels := []grafanaPanel{
+		{
+			title: "Requests by provider", kind: "barchart", path: "/usage-db/views/v_usage_by_provider_day", width: 12,
+			columns: [][2]string{{"day", "string"}, {"provider", "string"}, {"requests", "number"}, {"failed_requests", "number"}, {"aborted_requests", "number"}},
+		},
+		{
+			title: "Tokens by provider", kind: "barchart", path: "/usage-db/views/v_usage_by_provider_day", width: 12,
+			columns: [][2]string{{"day", "string"}, {"provider", "string"}, {"prompt_tokens", "number"}, {"completion_tokens", "number"}},
+		},
+		{
+			title: "Cost by API key (USD)", kind: "table", path: "/usage-db/views/v_cost_by_key_day", width: 12,
+			columns: [][2]string{{"day", "string"}, {"api_key_hash", "string"}, {"requests", "number"}, {"cost_usd", "number"}, {"unpriced_requests", "number"}},
+		},
+		{
+			title: "Latency percentiles (ms)", kind: "table", path: "/usage-db/views/v_latency_by_model_day", width: 12,
+			columns: [][2]string{{"day", "string"}, {"provider", "string"}, {"model", "string"}, {"p50_ms", "number"}, {"p95_ms", "number"}, {"p99_ms", "number"}},
+		},
+	}
+	datasource := gin.H{"type": grafanaInfinityPlugin, "uid": "${DS_CLIPROXY}"}
+	out := make([]gin.H, 0, len(panels))
+	x, y := 0, 0
+	for i, p := range panels {
+		columns := make([]gin.H, 0, len(p.columns))
+		for _, col := range p.columns {
+			columns = append(columns, gin.H{"selector": col[0], "text": col[0], "type": col[1]})
+		}
+		if x+p.width > 24 {
+			x, y = 0, y+8
+		}
+		out = append(out, gin.H{
+			"id":         i + 1,
+			"type":       p.kind,
+			"title":      p.title,
+			"datasource": datasource,
+			"gridPos":    gin.H{"x": x, "y": y, "w": p.width, "h": 8},
+			"targets": []gin.H{{
+				"refId":         "A",
+				"datasource":    datasource,
+				"type":          "json",
+				"source":        "url",
+				"format":        "table",
+				"parser":        "backend",
+				"url":           api + p.path,
+				"url_options":   gin.H{"method": "GET", "params": []gin.H{{"key": "days", "value": "${days}"}}},
+				"root_selector": "rows",
+				"columns":       columns,
+			}},
+		})
+		x += p.width
+	}
+	return gin.H{
+		"__inputs": []gin.H{{
+			"name":        "DS_CLIPROXY",
+			"label":       "CLIProxyAPI management",
+			"description": "Infinity data source with an Authorization: Bearer <management key> header",
+			"type":        "datasource",
+			"pluginId":    grafanaInfinityPlugin,
+			"pluginName":  "Infinity",
+		}},
+		"title":         "CLIProxyAPI usage",
+		"uid":           "cliproxy-usage",
+		"schemaVersion": 39,
+		"editable":      true,
+		"time":          gin.H{"from": "now-7d", "to": "now"},
+		"templating": gin.H{"list": []gin.H{{
+			"name":    "days",
+			"label":   "Days",
+			"type":    "custom",
+			"query":   "1,7,14,30,90",
+			"current": gin.H{"text": "7", "value": "7"},
+		}}},
+		"panels": out,
+	}
+}
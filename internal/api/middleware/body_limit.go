@@ -0,0 +1,104 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the request body size limit middleware.
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/bodylimit"
+)
+
+const (
+	// bodyLimitKey holds the body limit already enforced for the request.
+	bodyLimitKey = "bodyLimit"
+	// bodyLimitRecordedKey marks that the oversize rejection was published.
+	bodyLimitRecordedKey = "bodyLimitRecorded"
+)
+
+// BodyLimitMiddleware enforces the route body limit on client API requests. It must
+// run before any middleware that buffers the body so oversized uploads are cut off
+// while they are read.
+func BodyLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limits := bodylimit.Active()
+		if limits == nil || c.Request.Body == nil || !shouldLogRequest(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		limitBody(c, limits.ForRoute(c.Request.URL.Path))
+	}
+}
+
+// KeyBodyLimitMiddleware tightens the body limit for the authenticated client key.
+// It must run after AuthMiddleware.
+func KeyBodyLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limits := bodylimit.Active()
+		if limits == nil || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		current := c.GetInt64(bodyLimitKey)
+		limit := limits.ForKey(c.GetString("apiKey"), current)
+		if limit == current {
+			c.Next()
+			return
+		}
+		limitBody(c, limit)
+	}
+}
+
+func limitBody(c *gin.Context, limit int64) {
+	if limit <= 0 {
+		c.Next()
+		return
+	}
+	now := time.Now()
+	if c.Request.ContentLength > limit {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": gin.H{
+				"code":    bodylimit.RejectionTooLarge,
+				"type":    "invalid_request_error",
+				"message": fmt.Sprintf("request body exceeds the %d byte limit", limit),
+			},
+		})
+		recordTooLarge(c, now)
+		return
+	}
+	body := &limitedBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, limit)}
+	c.Request.Body = body
+	c.Set(bodyLimitKey, limit)
+	c.Next()
+	if body.exceeded {
+		recordTooLarge(c, now)
+	}
+}
+
+func recordTooLarge(c *gin.Context, at time.Time) {
+	if c.GetBool(bodyLimitRecordedKey) {
+		return
+	}
+	c.Set(bodyLimitRecordedKey, true)
+	publishRejection(c, at, bodylimit.RejectionTooLarge)
+}
+
+// limitedBody notes when the wrapped reader stopped at the size limit so the
+// rejection can be recorded after the handler answered it.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if err != nil && errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
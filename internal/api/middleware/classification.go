@@ -0,0 +1,75 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the classification middleware that tags requests at ingestion.
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/classify"
+	"github.com/tidwall/gjson"
+)
+
+// maxClassifiedBody caps the request body buffered for prompt and model rules. Larger
+// bodies are passed through untouched and only path and header rules apply to them.
+const maxClassifiedBody = 4 << 20
+
+// ClassificationMiddleware evaluates the active classification rules against the
+// request and stores the resulting tags in the Gin context. The request body is
+// restored after inspection so downstream handlers can read it again. It must run
+// after AuthMiddleware so unauthenticated requests are not buffered.
+func ClassificationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		classifier := classify.Active()
+		if classifier == nil || c.Request.Method != http.MethodPost || !shouldLogRequest(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			original := c.Request.Body
+			data, err := io.ReadAll(io.LimitReader(original, maxClassifiedBody+1))
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(data), original), original}
+			if err == nil && len(data) <= maxClassifiedBody {
+				body = data
+			}
+		}
+
+		in := classify.Input{
+			Model:   gjson.GetBytes(body, "model").String(),
+			Path:    c.Request.URL.Path,
+			Headers: c.Request.Header,
+		}
+		if in.Model == "" {
+			in.Model = modelFromPath(c.Request.URL.Path)
+		}
+		if classifier.NeedsPrompt() {
+			in.Prompt = classify.PromptText(body)
+		}
+		if tags := classifier.Classify(in); len(tags) > 0 {
+			c.Set(classify.GinTagsKey, tags)
+		}
+		c.Next()
+	}
+}
+
+// modelFromPath extracts the model segment from Gemini-style paths such as
+// /v1beta/models/gemini-2.5-pro:generateContent.
+func modelFromPath(path string) string {
+	idx := strings.Index(path, "/models/")
+	if idx < 0 {
+		return ""
+	}
+	model := path[idx+len("/models/"):]
+	if cut := strings.IndexAny(model, ":/"); cut >= 0 {
+		model = model[:cut]
+	}
+	return model
+}
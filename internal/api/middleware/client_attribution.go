@@ -0,0 +1,21 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the middleware that records who sent a client API request.
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/clientattr"
+)
+
+// ClientAttributionMiddleware resolves the client IP, user agent and country of
+// client API requests and stores them in the Gin context for usage records. It runs
+// before rate limiting and authentication so rejected requests are attributed too.
+func ClientAttributionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resolver := clientattr.Active()
+		if resolver != nil && shouldLogRequest(c.Request.URL.Path) {
+			c.Set(clientattr.GinKey, resolver.Resolve(c.Request))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,154 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the Idempotency-Key middleware that replays stored responses.
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/idempotency"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client's idempotency key.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from the store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyMiddleware answers retried non-streaming POST requests that carry an
+// Idempotency-Key with the stored response of the first attempt, scoped to the
+// client API key. It must run after AuthMiddleware.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := idempotency.Active()
+		key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if store == nil || key == "" || c.Request.Method != http.MethodPost || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortIdempotency(c, http.StatusBadRequest, "invalid_request_error", "Idempotency-Key must be at most 255 characters")
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		// Hand the handler the bytes already read followed by the rest of the original
+		// reader, so a read error (e.g. the body limit) surfaces where it always did.
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+		if err != nil || isStreamingRequest(c.Request.URL.Path, body) {
+			c.Next()
+			return
+		}
+
+		storeKey := idempotency.Key(c.GetString("apiKey"), key)
+		resp, outcome := store.Begin(storeKey, idempotency.Fingerprint(c.Request.Method, c.Request.URL.RequestURI(), body))
+		switch outcome {
+		case idempotency.Replay:
+			for name, values := range resp.Header {
+				for _, v := range values {
+					c.Writer.Header().Add(name, v)
+				}
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Status(resp.Status)
+			_, _ = c.Writer.Write(resp.Body)
+			c.Abort()
+			return
+		case idempotency.InProgress:
+			abortIdempotency(c, http.StatusConflict, "conflict_error", "a request with this Idempotency-Key is still in progress; retry later")
+			return
+		case idempotency.Mismatch:
+			abortIdempotency(c, http.StatusUnprocessableEntity, "invalid_request_error", "this Idempotency-Key was already used for a different request")
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer, limit: store.MaxResponseBytes()}
+		c.Writer = recorder
+		stored := false
+		defer func() {
+			if !stored {
+				store.Abandon(storeKey)
+			}
+		}()
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		status := recorder.Status()
+		if status < http.StatusOK || status >= http.StatusMultipleChoices || recorder.skip ||
+			strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		header := make(http.Header)
+		if contentType := recorder.Header().Get("Content-Type"); contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		store.Complete(storeKey, idempotency.Response{Status: status, Header: header, Body: recorder.body.Bytes()})
+		stored = true
+	}
+}
+
+// isStreamingRequest reports whether a request asks for a streamed response, which
+// cannot be replayed.
+func isStreamingRequest(path string, body []byte) bool {
+	if strings.Contains(path, ":streamGenerateContent") {
+		return true
+	}
+	return gjson.GetBytes(body, "stream").Bool()
+}
+
+func abortIdempotency(c *gin.Context, status int, errType, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": gin.H{
+			"code":    "idempotency_key",
+			"type":    errType,
+			"message": message,
+		},
+	})
+}
+
+// idempotencyRecorder copies the response body while it is written to the client.
+// Responses that are flushed or exceed limit are not stored.
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int64
+	skip  bool
+}
+
+func (w *idempotencyRecorder) record(n int, data []byte) {
+	if w.skip {
+		return
+	}
+	if int64(w.body.Len()+n) > w.limit {
+		w.skip = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data[:n])
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.record(n, data)
+	return n, err
+}
+
+func (w *idempotencyRecorder) WriteString(data string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(data)
+	w.record(n, []byte(data))
+	return n, err
+}
+
+func (w *idempotencyRecorder) Flush() {
+	w.skip = true
+	w.ResponseWriter.Flush()
+}
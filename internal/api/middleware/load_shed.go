@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/loadshed"
+	log "github.com/sirupsen/logrus"
+)
+
+// LoadShedMiddleware answers 503 with Retry-After while the proxy is past its
+// load-shedding thresholds, and otherwise counts the request as in flight until it
+// has finished, streamed responses included. It runs last so cheaper rejections and
+// idempotent replays are not shed.
+func LoadShedMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		release, reason, retryAfter := loadshed.Admit()
+		if release != nil {
+			defer release()
+			c.Next()
+			return
+		}
+		log.Debugf("load shedding: rejected %s %s (%s)", c.Request.Method, c.Request.URL.Path, reason)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": gin.H{
+				"code":    loadshed.Rejection,
+				"type":    "overloaded_error",
+				"message": "the proxy is overloaded; retry later",
+			},
+		})
+		publishRejection(c, time.Now(), loadshed.Rejection)
+	}
+}
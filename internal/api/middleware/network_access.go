@@ -0,0 +1,88 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the source IP rate limiting and allowlist middleware.
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/classify"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/clientattr"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/netaccess"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+// IPRateLimitMiddleware enforces the per-IP request rate limit. It runs before
+// authentication so invalid keys count against the caller too.
+func IPRateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctrl := netaccess.Active()
+		if ctrl == nil {
+			c.Next()
+			return
+		}
+		now := time.Now()
+		ok, wait := ctrl.AllowRate(clientAddr(c), now)
+		if ok {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": gin.H{
+				"code":    netaccess.RejectionRateLimited,
+				"type":    "rate_limit_error",
+				"message": "too many requests from this IP address",
+			},
+		})
+		publishRejection(c, now, netaccess.RejectionRateLimited)
+	}
+}
+
+// NetworkAllowlistMiddleware rejects authenticated requests whose source IP is not
+// allowed for the client key. It must run after AuthMiddleware.
+func NetworkAllowlistMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctrl := netaccess.Active()
+		if ctrl == nil {
+			c.Next()
+			return
+		}
+		if ctrl.AllowKey(c.GetString("apiKey"), clientAddr(c)) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"code":    netaccess.RejectionIPDenied,
+				"type":    "permission_error",
+				"message": "requests from this IP address are not allowed for this API key",
+			},
+		})
+		publishRejection(c, time.Now(), netaccess.RejectionIPDenied)
+	}
+}
+
+// clientAddr returns the source IP of the request. Gin's ClientIP is not used: the
+// engine trusts forwarding headers from any peer, which would let clients choose the
+// address checked against allowlists and rate limits.
+func clientAddr(c *gin.Context) netip.Addr {
+	return clientattr.ClientIP(c.Request)
+}
+
+func publishRejection(c *gin.Context, at time.Time, reason string) {
+	ctx := context.WithValue(c.Request.Context(), "gin", c)
+	coreusage.PublishRecord(ctx, coreusage.Record{
+		Model:       modelFromPath(c.Request.URL.Path),
+		APIKey:      c.GetString("apiKey"),
+		RequestedAt: at,
+		Failed:      true,
+		Rejection:   reason,
+		Tags:        classify.TagsFromGin(c),
+	})
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/clientattr"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/netaccess"
+)
+
+// newNetworkAccessEngine serves /v1/models behind the IP rate limit and the allowlist,
+// authenticating every request as key.
+func newNetworkAccessEngine(key string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(IPRateLimitMiddleware(), func(c *gin.Context) { c.Set("apiKey", key) }, NetworkAllowlistMiddleware())
+	engine.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return engine
+}
+
+func serveFrom(engine *gin.Engine, remote, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.RemoteAddr = remote
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-IP", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestNetworkAllowlistIgnoresForgedForwardedFor(t *testing.T) {
+	t.Cleanup(func() {
+		netaccess.Set(config.NetworkAccessConfig{})
+		clientattr.Set(config.ClientAttributionConfig{})
+	})
+	netaccess.Set(config.NetworkAccessConfig{APIKeys: []config.NetworkKeyRule{{APIKey: "k", AllowedCIDRs: []string{"203.0.113.0/24"}}}})
+	clientattr.Set(config.ClientAttributionConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	engine := newNetworkAccessEngine("k")
+
+	if code := serveFrom(engine, "198.51.100.7:5000", "203.0.113.9"); code != http.StatusForbidden {
+		t.Fatalf("forged X-Forwarded-For from an untrusted peer passed the allowlist: %d", code)
+	}
+	if code := serveFrom(engine, "203.0.113.9:5000", ""); code != http.StatusOK {
+		t.Fatalf("allowed peer rejected: %d", code)
+	}
+	if code := serveFrom(engine, "10.1.2.3:443", "203.0.113.9"); code != http.StatusOK {
+		t.Fatalf("allowed client behind a trusted proxy rejected: %d", code)
+	}
+}
+
+func TestIPRateLimitIgnoresForgedForwardedFor(t *testing.T) {
+	t.Cleanup(func() {
+		netaccess.Set(config.NetworkAccessConfig{})
+		clientattr.Set(config.ClientAttributionConfig{})
+	})
+	netaccess.Set(config.NetworkAccessConfig{RequestsPerMinute: 1, Burst: 1})
+	clientattr.Set(config.ClientAttributionConfig{})
+	engine := newNetworkAccessEngine("k")
+
+	if code := serveFrom(engine, "198.51.100.8:5000", "192.0.2.1"); code != http.StatusOK {
+		t.Fatalf("first request rejected: %d", code)
+	}
+	// A new forged address per request must not give the peer a fresh bucket.
+	if code := serveFrom(engine, "198.51.100.8:5001", "192.0.2.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("forged X-Forwarded-For reset the rate limit: %d", code)
+	}
+}
@@ -0,0 +1,21 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the middleware that assigns a correlation identifier to each request.
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+)
+
+// RequestIDMiddleware assigns every request an X-Request-ID. A well-formed inbound
+// header is honoured so callers can correlate with their own logs; otherwise a new
+// identifier is generated. The value is echoed in the response header and stored
+// on the Gin context for access logs, usage records and OTLP events.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := tracing.ResolveRequestID(c.GetHeader(tracing.RequestIDHeader))
+		tracing.SetGinRequestID(c, id)
+		c.Header(tracing.RequestIDHeader, id)
+		c.Next()
+	}
+}
@@ -311,13 +311,19 @@ func (w *ResponseWriterWrapper) cloneHeaders() map[string][]string {
 	return finalHeaders
 }
 
+// extractAPIRequest returns the upstream request log, preceded by the request
+// transformation section when request-transforms rules were in scope.
 func (w *ResponseWriterWrapper) extractAPIRequest(c *gin.Context) []byte {
-	apiRequest, isExist := c.Get("API_REQUEST")
-	if !isExist {
-		return nil
+	var data []byte
+	if apiRequest, isExist := c.Get("API_REQUEST"); isExist {
+		data, _ = apiRequest.([]byte)
 	}
-	data, ok := apiRequest.([]byte)
-	if !ok || len(data) == 0 {
+	if transform, isExist := c.Get("API_REQUEST_TRANSFORM"); isExist {
+		if section, ok := transform.([]byte); ok && len(section) > 0 {
+			data = append(bytes.Clone(section), data...)
+		}
+	}
+	if len(data) == 0 {
 		return nil
 	}
 	return data
@@ -0,0 +1,27 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the middleware that records per-route handler metrics.
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/httpmetrics"
+)
+
+// RouteMetricsMiddleware counts requests, times them and tracks in-flight requests
+// per route template while Prometheus metrics are enabled. Streaming responses are
+// timed until the last byte is written.
+func RouteMetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registry := httpmetrics.Active()
+		if registry == nil {
+			c.Next()
+			return
+		}
+		started := time.Now()
+		finish := registry.Start(c.Request.Method, c.FullPath())
+		defer func() { finish(c.Writer.Status(), time.Since(started)) }()
+		c.Next()
+	}
+}
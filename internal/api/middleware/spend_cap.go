@@ -0,0 +1,38 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the middleware that rejects keys suspended by their spending cap.
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// SpendCapMiddleware rejects requests from client keys that were suspended for
+// exceeding their own or their team's monthly spending cap. It must run after AuthMiddleware.
+func SpendCapMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		suspension, suspended := usage.CheckSpendSuspension(c.GetString("apiKey"))
+		if !suspended {
+			c.Next()
+			return
+		}
+		message := fmt.Sprintf("this API key is suspended: it spent $%.2f of its $%.2f monthly cap in %s; ask an administrator to reset it",
+			suspension.SpendUSD, suspension.CapUSD, suspension.Month)
+		if suspension.Team != "" {
+			message = fmt.Sprintf("this API key is suspended: its team %s spent $%.2f of its $%.2f monthly cap in %s; ask an administrator to reset it",
+				suspension.Team, suspension.SpendUSD, suspension.CapUSD, suspension.Month)
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"code":    usage.RejectionSpendCap,
+				"type":    "permission_error",
+				"message": message,
+			},
+		})
+		publishRejection(c, time.Now(), usage.RejectionSpendCap)
+	}
+}
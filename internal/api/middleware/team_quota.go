@@ -0,0 +1,40 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the middleware enforcing per-team request quotas.
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/team"
+)
+
+// TeamQuotaMiddleware rejects requests once the client key's team has used up its
+// requests-per-minute quota. It must run after AuthMiddleware.
+func TeamQuotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dir := team.Active()
+		if dir == nil {
+			c.Next()
+			return
+		}
+		now := time.Now()
+		name, ok, wait := dir.Allow(c.GetString("apiKey"), now)
+		if ok {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": gin.H{
+				"code":    team.RejectionRateLimited,
+				"type":    "rate_limit_error",
+				"message": "team " + name + " exceeded its requests-per-minute quota",
+			},
+		})
+		publishRejection(c, now, team.RejectionRateLimited)
+	}
+}
@@ -0,0 +1,59 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the tracing middleware that opens a server span for each
+// proxied request and exposes its trace context to downstream executors.
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+)
+
+// TracingMiddleware creates a Gin middleware that starts a server span per request.
+// An inbound traceparent header is honoured so the proxy joins the caller's trace;
+// the resulting trace context is echoed back in the response traceparent header.
+// The span ends after the handler returns, which for streaming responses is when
+// the final chunk has been flushed to the client.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !shouldLogRequest(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		parent, _ := tracing.ParseTraceparent(c.GetHeader(tracing.TraceparentHeader))
+		span := tracing.StartSpan(c.Request.Method+" "+c.FullPath(), tracing.SpanKindServer, parent)
+		span.SetAttribute("http.request.method", c.Request.Method)
+		span.SetAttribute("url.path", c.Request.URL.Path)
+		span.SetAttribute("client.address", c.ClientIP())
+		if id := tracing.GinRequestID(c); id != "" {
+			span.SetAttribute("cliproxy.request_id", id)
+		}
+		if ua := c.GetHeader("User-Agent"); ua != "" {
+			span.SetAttribute("user_agent.original", ua)
+		}
+		tracing.SetGinSpan(c, span)
+		c.Header(tracing.TraceparentHeader, span.Context().Traceparent())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.response.status_code", status)
+		if provider, ok := c.Get("accessProvider"); ok {
+			span.SetAttribute("cliproxy.access_provider", provider)
+		}
+		if status >= http.StatusInternalServerError {
+			span.RecordError(errorForStatus(status))
+		} else if errs := c.Errors.ByType(gin.ErrorTypePrivate); len(errs) > 0 {
+			span.RecordError(errs.Last())
+		}
+		span.End()
+	}
+}
+
+type statusError int
+
+func (e statusError) Error() string { return http.StatusText(int(e)) }
+
+func errorForStatus(status int) error { return statusError(status) }
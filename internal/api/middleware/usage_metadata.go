@@ -0,0 +1,33 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the middleware that reads client-supplied usage attribution.
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// UsageMetadataMiddleware parses the X-Usage-Metadata header and stores the pairs in
+// the Gin context so usage records and OTLP events can carry them. Malformed or
+// oversized headers are rejected rather than silently dropped, so callers notice
+// that their cost attribution is not being recorded.
+func UsageMetadataMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		metadata, err := usage.ParseMetadata(c.GetHeader(usage.MetadataHeader))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"type":    "invalid_request_error",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+		if len(metadata) > 0 {
+			c.Set(usage.GinMetadataKey, metadata)
+		}
+		c.Next()
+	}
+}
@@ -117,8 +117,11 @@ func (m *AmpModule) Register(ctx modules.Context) error {
 	settings := ctx.Config.AmpCode
 	upstreamURL := strings.TrimSpace(settings.UpstreamURL)
 
-	// Determine auth middleware (from module or context)
-	auth := m.getAuthMiddleware(ctx)
+	// Determine the client access chain (from context) or auth middleware (from module or context)
+	auth := ctx.ClientMiddleware
+	if len(auth) == 0 {
+		auth = []gin.HandlerFunc{m.getAuthMiddleware(ctx)}
+	}
 
 	// Use registerOnce to ensure routes are only registered once
 	var regErr error
@@ -134,11 +137,11 @@ func (m *AmpModule) Register(ctx modules.Context) error {
 		m.setRestrictToLocalhost(settings.RestrictManagementToLocalhost)
 
 		// Always register provider aliases - these work without an upstream
-		m.registerProviderAliases(ctx.Engine, ctx.BaseHandler, auth)
+		m.registerProviderAliases(ctx.Engine, ctx.BaseHandler, auth...)
 
 		// Register management proxy routes once; middleware will gate access when upstream is unavailable.
 		// Pass auth middleware to require valid API key for all management routes.
-		m.registerManagementRoutes(ctx.Engine, ctx.BaseHandler, auth)
+		m.registerManagementRoutes(ctx.Engine, ctx.BaseHandler, auth...)
 
 		// If no upstream URL, skip proxy routes but provider aliases are still available
 		if upstreamURL == "" {
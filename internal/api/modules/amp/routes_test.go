@@ -383,3 +383,56 @@ func TestLocalhostOnlyMiddleware_HotReload(t *testing.T) {
 		t.Errorf("Expected 403 after re-enabling restriction, got %d", w.Code)
 	}
 }
+
+func TestRegisterRoutes_AppliesFullClientChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	m := &AmpModule{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	proxy, _ := createReverseProxy(upstream.URL, NewStaticSecretSource(""))
+	m.setProxy(proxy)
+
+	base := &handlers.BaseAPIHandler{}
+	var authCalls int
+	auth := func(c *gin.Context) {
+		authCalls++
+		c.Next()
+	}
+	denyNetwork := func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+	m.registerProviderAliases(r, base, auth, denyNetwork)
+	m.registerManagementRoutes(r, base, auth, denyNetwork)
+
+	for _, path := range []string{"/api/provider/openai/models", "/api/provider/anthropic/v1/models", "/api/user"} {
+		t.Run(path, func(t *testing.T) {
+			authCalls = 0
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d from the second chain handler", w.Code, http.StatusForbidden)
+			}
+			if authCalls != 1 {
+				t.Fatalf("auth ran %d times, want 1", authCalls)
+			}
+		})
+	}
+
+	// Bypassed management paths skip the whole chain.
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	authCalls = 0
+	resp, err := srv.Client().Get(srv.URL + "/threads/abc")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || authCalls != 0 {
+		t.Fatalf("bypassed path ran the chain: status %d, auth calls %d", resp.StatusCode, authCalls)
+	}
+}
@@ -19,6 +19,10 @@ type Context struct {
 	BaseHandler    *handlers.BaseAPIHandler
 	Config         *config.Config
 	AuthMiddleware gin.HandlerFunc
+	// ClientMiddleware is the full chain guarding client API routes, including
+	// authentication, IP rate limits and network allowlists. When set, modules use it
+	// instead of AuthMiddleware.
+	ClientMiddleware []gin.HandlerFunc
 }
 
 // RouteModule represents a pluggable routing module that can register routes
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,15 +20,36 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/access"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/adminui"
 	managementHandlers "github.com/router-for-me/CLIProxyAPI/v6/internal/api/handlers/management"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/api/middleware"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/api/modules"
 	ampmodule "github.com/router-for-me/CLIProxyAPI/v6/internal/api/modules/amp"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/batch"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/bodylimit"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/classify"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/clientattr"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/clientusage"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/httpmetrics"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/idempotency"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/loadshed"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/logging"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/managementasset"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/modelrewrite"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/netaccess"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/policy"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/providerspend"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/reasoningbudget"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/redisstate"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/replay"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/requesttransform"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/secrets"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/shadow"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/team"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/workspace"
 	sdkaccess "github.com/router-for-me/CLIProxyAPI/v6/sdk/access"
 	"github.com/router-for-me/CLIProxyAPI/v6/sdk/api/handlers"
 	"github.com/router-for-me/CLIProxyAPI/v6/sdk/api/handlers/claude"
@@ -124,6 +146,9 @@ type Server struct {
 	// cfg holds the current server configuration.
 	cfg *config.Config
 
+	// adminUI serves the embedded dashboard under /ui.
+	adminUI http.Handler
+
 	// oldConfigYaml stores a YAML snapshot of the previous configuration for change detection.
 	// This prevents issues when the config object is modified in place by Management API.
 	oldConfigYaml []byte
@@ -150,6 +175,9 @@ type Server struct {
 	// management handler
 	mgmt *managementHandlers.Handler
 
+	// batches runs OpenAI Batch API jobs through the engine.
+	batches *batch.Runner
+
 	// ampModule is the Amp routing module for model mapping hot-reload
 	ampModule *ampmodule.AmpModule
 
@@ -199,12 +227,25 @@ func NewServer(cfg *config.Config, authManager *auth.Manager, accessManager *sdk
 	}
 
 	// Add middleware
+	// Time requests outermost so recovered panics are counted with their 500 status.
+	engine.Use(middleware.RouteMetricsMiddleware())
 	engine.Use(logging.GinLogrusLogger())
 	engine.Use(logging.GinLogrusRecovery())
+	// Assign a correlation ID before anything else so every log line and usage record can carry it.
+	engine.Use(middleware.RequestIDMiddleware())
+	// Record the client IP, user agent and country for usage attribution.
+	engine.Use(middleware.ClientAttributionMiddleware())
+	// Cap request bodies before any middleware buffers them.
+	engine.Use(middleware.BodyLimitMiddleware())
 	for _, mw := range optionState.extraMiddleware {
 		engine.Use(mw)
 	}
 
+	// Open a tracing span per proxied request so upstream calls join the same trace.
+	engine.Use(middleware.TracingMiddleware())
+	// Attach client-supplied X-Usage-Metadata so usage records can be attributed to teams or projects.
+	engine.Use(middleware.UsageMetadataMiddleware())
+
 	// Add request logging middleware (positioned after recovery, before auth)
 	// Resolve logs directory relative to the configuration file directory.
 	var requestLogger logging.RequestLogger
@@ -241,6 +282,7 @@ func NewServer(cfg *config.Config, authManager *auth.Manager, accessManager *sdk
 		currentPath:         wd,
 		envManagementSecret: envManagementSecret,
 		wsRoutes:            make(map[string]struct{}),
+		adminUI:             adminui.Handler(),
 	}
 	s.wsAuthEnabled.Store(cfg.WebsocketAuth)
 	// Save initial YAML snapshot
@@ -248,9 +290,34 @@ func NewServer(cfg *config.Config, authManager *auth.Manager, accessManager *sdk
 	s.applyAccessConfig(nil, cfg)
 	if authManager != nil {
 		authManager.SetRetryConfig(cfg.RequestRetry, time.Duration(cfg.MaxRetryInterval)*time.Second)
+		authManager.SetCircuitBreaker(circuitBreakerConfig(cfg))
+		authManager.SetCredentialCanary(credentialCanaryConfig(cfg))
+		authManager.SetLatencyRouting(latencyRoutingConfig(cfg))
+		authManager.SetRefreshConfig(authRefreshConfig(cfg))
+		authManager.SetConcurrencyLimit(concurrencyConfig(cfg))
+		authManager.SetRateLimitSwitch(cfg.QuotaExceeded.SwitchCredentialEnabled())
+		applySessionAffinity(authManager, cfg)
 	}
 	managementasset.SetCurrentConfig(cfg)
 	auth.SetQuotaCooldownDisabled(cfg.DisableCooling)
+	classify.SetRules(cfg.ClassificationRules)
+	workspace.Set(cfg.Workspaces)
+	team.Set(cfg.Teams)
+	policy.SetPolicies(cfg.EffectiveAPIKeyPolicies())
+	modelrewrite.SetRules(cfg.ModelRewrites)
+	requesttransform.SetRules(cfg.RequestTransforms)
+	reasoningbudget.SetRules(cfg.ReasoningBudgets)
+	shadow.Set(cfg.ShadowTraffic)
+	httpmetrics.Set(cfg.Prometheus)
+	if err := redisstate.Configure(cfg.Redis); err != nil {
+		log.WithError(err).Warn("failed to initialize redis, enforcing limits locally")
+	}
+	netaccess.Set(cfg.NetworkAccess)
+	bodylimit.Set(cfg.RequestSizeLimits)
+	loadshed.Set(cfg.LoadShedding)
+	loadshed.SetQueueWaitSource(authManager.OldestQueueWait)
+	idempotency.Set(cfg.Idempotency)
+	clientattr.Set(cfg.ClientAttribution)
 	// Initialize management handler
 	s.mgmt = managementHandlers.NewHandler(cfg, configFilePath, authManager)
 	if optionState.localPassword != "" {
@@ -261,6 +328,9 @@ func NewServer(cfg *config.Config, authManager *auth.Manager, accessManager *sdk
 		logDir = filepath.Join(base, "logs")
 	}
 	s.mgmt.SetLogDirectory(logDir)
+	s.mgmt.SetReplayHandler(engine)
+	s.batches = batch.NewRunner(cfg.Batch.Concurrency)
+	s.batches.SetHandler(engine)
 	s.localPassword = optionState.localPassword
 
 	// Setup routes
@@ -269,10 +339,11 @@ func NewServer(cfg *config.Config, authManager *auth.Manager, accessManager *sdk
 	// Register Amp module using V2 interface with Context
 	s.ampModule = ampmodule.NewLegacy(accessManager, AuthMiddleware(accessManager))
 	ctx := modules.Context{
-		Engine:         engine,
-		BaseHandler:    s.handlers,
-		Config:         cfg,
-		AuthMiddleware: AuthMiddleware(accessManager),
+		Engine:           engine,
+		BaseHandler:      s.handlers,
+		Config:           cfg,
+		AuthMiddleware:   AuthMiddleware(accessManager),
+		ClientMiddleware: s.clientAccessMiddleware(),
 	}
 	if err := modules.RegisterModule(ctx, s.ampModule); err != nil {
 		log.Errorf("Failed to register Amp module: %v", err)
@@ -307,27 +378,41 @@ func NewServer(cfg *config.Config, authManager *auth.Manager, accessManager *sdk
 // It defines the endpoints and associates them with their respective handlers.
 func (s *Server) setupRoutes() {
 	s.engine.GET("/management.html", s.serveManagementControlPanel)
+	s.engine.GET(adminui.PathPrefix+"/*filepath", s.serveAdminUI)
 	openaiHandlers := openai.NewOpenAIAPIHandler(s.handlers)
 	geminiHandlers := gemini.NewGeminiAPIHandler(s.handlers)
 	geminiCLIHandlers := gemini.NewGeminiCLIAPIHandler(s.handlers)
 	claudeCodeHandlers := claude.NewClaudeCodeAPIHandler(s.handlers)
 	openaiResponsesHandlers := openai.NewOpenAIResponsesAPIHandler(s.handlers)
+	batchHandlers := batch.NewHandler(s.batches)
 
 	// OpenAI compatible API routes
 	v1 := s.engine.Group("/v1")
-	v1.Use(AuthMiddleware(s.accessManager))
+	v1.Use(s.clientAccessMiddleware()...)
+	v1.Use(middleware.SpendCapMiddleware(), middleware.TeamQuotaMiddleware(), middleware.KeyBodyLimitMiddleware(), middleware.IdempotencyMiddleware(), middleware.LoadShedMiddleware())
 	{
 		v1.GET("/models", s.unifiedModelsHandler(openaiHandlers, claudeCodeHandlers))
 		v1.POST("/chat/completions", openaiHandlers.ChatCompletions)
 		v1.POST("/completions", openaiHandlers.Completions)
+		v1.POST("/embeddings", openaiHandlers.Embeddings)
+		v1.GET("/realtime", openaiHandlers.Realtime)
 		v1.POST("/messages", claudeCodeHandlers.ClaudeMessages)
 		v1.POST("/messages/count_tokens", claudeCodeHandlers.ClaudeCountTokens)
 		v1.POST("/responses", openaiResponsesHandlers.Responses)
+		v1.POST("/files", batchHandlers.UploadFile)
+		v1.GET("/files/:file_id", batchHandlers.GetFile)
+		v1.GET("/files/:file_id/content", batchHandlers.GetFileContent)
+		v1.POST("/batches", batchHandlers.CreateBatch)
+		v1.GET("/batches", batchHandlers.ListBatches)
+		v1.GET("/batches/:batch_id", batchHandlers.GetBatch)
+		v1.POST("/batches/:batch_id/cancel", batchHandlers.CancelBatch)
+		v1.GET("/usage", clientusage.GetUsage)
 	}
 
 	// Gemini compatible API routes
 	v1beta := s.engine.Group("/v1beta")
-	v1beta.Use(AuthMiddleware(s.accessManager))
+	v1beta.Use(s.clientAccessMiddleware()...)
+	v1beta.Use(middleware.SpendCapMiddleware(), middleware.TeamQuotaMiddleware(), middleware.KeyBodyLimitMiddleware(), middleware.IdempotencyMiddleware(), middleware.LoadShedMiddleware())
 	{
 		v1beta.GET("/models", geminiHandlers.GeminiModels)
 		v1beta.POST("/models/*action", geminiHandlers.GeminiHandler)
@@ -341,10 +426,14 @@ func (s *Server) setupRoutes() {
 			"endpoints": []string{
 				"POST /v1/chat/completions",
 				"POST /v1/completions",
+				"POST /v1/embeddings",
 				"GET /v1/models",
 			},
 		})
 	})
+	s.engine.GET("/metrics", s.serveMetrics)
+	// Invite codes are redeemed without a client key; throttle guessing per IP.
+	s.engine.POST("/invites/redeem", middleware.IPRateLimitMiddleware(), s.redeemInviteCode)
 	s.engine.POST("/v1internal:method", geminiCLIHandlers.CLIHandler)
 
 	// OAuth callback endpoints (reuse main server port)
@@ -457,7 +546,19 @@ func (s *Server) AttachWebsocketRoute(path string, handler http.Handler) {
 		c.Abort()
 	}
 
-	s.engine.GET(trimmed, conditionalAuth, finalHandler)
+	s.engine.GET(trimmed, middleware.IPRateLimitMiddleware(), conditionalAuth, middleware.NetworkAllowlistMiddleware(), finalHandler)
+}
+
+// clientAccessMiddleware returns the chain guarding routes that accept client API keys:
+// per-IP rate limits, authentication, request classification and the per-key network
+// allowlist.
+func (s *Server) clientAccessMiddleware() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.IPRateLimitMiddleware(),
+		AuthMiddleware(s.accessManager),
+		middleware.ClassificationMiddleware(),
+		middleware.NetworkAllowlistMiddleware(),
+	}
 }
 
 func (s *Server) registerManagementRoutes() {
@@ -474,15 +575,47 @@ func (s *Server) registerManagementRoutes() {
 	mgmt.Use(s.managementAvailabilityMiddleware(), s.mgmt.Middleware())
 	{
 		mgmt.GET("/usage", s.mgmt.GetUsageStatistics)
+		mgmt.GET("/usage/in-flight", s.mgmt.GetUsageInFlight)
+		mgmt.GET("/usage/tags", s.mgmt.GetUsageTagSummary)
+		mgmt.GET("/usage/daily", s.mgmt.GetUsageDaily)
+		mgmt.GET("/usage/monthly", s.mgmt.GetUsageMonthly)
+		mgmt.GET("/usage/credentials", s.mgmt.GetUsageCredentials)
+		mgmt.GET("/usage/errors", s.mgmt.GetUsageErrors)
+		mgmt.GET("/usage/clients", s.mgmt.GetUsageClients)
+		mgmt.GET("/usage/teams", s.mgmt.GetUsageTeams)
+		mgmt.GET("/usage/shadow", s.mgmt.GetUsageShadow)
+		mgmt.GET("/usage/cache", s.mgmt.GetUsageCache)
+		mgmt.GET("/usage/tools", s.mgmt.GetUsageTools)
+		mgmt.GET("/usage/heatmap", s.mgmt.GetUsageHeatmap)
+		mgmt.GET("/usage/reasoning", s.mgmt.GetUsageReasoning)
+		mgmt.GET("/usage/export", s.mgmt.GetUsageExport)
+		mgmt.GET("/usage/forecast", s.mgmt.GetUsageForecast)
+		mgmt.GET("/usage/requests/:request_id", s.mgmt.GetUsageRequest)
+		mgmt.POST("/usage/retention", s.mgmt.PostUsageRetention)
+		mgmt.GET("/usage/reports", s.mgmt.GetUsageReports)
+		mgmt.POST("/usage/reports/:name/send", s.mgmt.PostUsageReportSend)
+		mgmt.POST("/usage/erase", s.mgmt.PostUsageErase)
+		mgmt.GET("/usage/spend-caps", s.mgmt.GetUsageSpendCaps)
+		mgmt.POST("/usage/spend-caps/:key_hash/reset", s.mgmt.PostUsageSpendCapReset)
+		mgmt.POST("/usage/team-spend-caps/:name/reset", s.mgmt.PostUsageTeamSpendCapReset)
+		mgmt.GET("/usage/provider-spend-caps", s.mgmt.GetUsageProviderSpendCaps)
 		mgmt.GET("/config", s.mgmt.GetConfig)
 		mgmt.GET("/config.yaml", s.mgmt.GetConfigYAML)
 		mgmt.PUT("/config.yaml", s.mgmt.PutConfigYAML)
+		mgmt.POST("/config/validate", s.mgmt.ValidateConfig)
 		mgmt.GET("/latest-version", s.mgmt.GetLatestVersion)
 
 		mgmt.GET("/debug", s.mgmt.GetDebug)
 		mgmt.PUT("/debug", s.mgmt.PutDebug)
 		mgmt.PATCH("/debug", s.mgmt.PutDebug)
 
+		mgmt.GET("/log-level", s.mgmt.GetLogLevel)
+		mgmt.PUT("/log-level", s.mgmt.PutLogLevel)
+		mgmt.PATCH("/log-level", s.mgmt.PutLogLevel)
+		mgmt.GET("/log-components", s.mgmt.GetLogComponents)
+		mgmt.PUT("/log-components", s.mgmt.PutLogComponents)
+		mgmt.PATCH("/log-components", s.mgmt.PatchLogComponents)
+
 		mgmt.GET("/logging-to-file", s.mgmt.GetLoggingToFile)
 		mgmt.PUT("/logging-to-file", s.mgmt.PutLoggingToFile)
 		mgmt.PATCH("/logging-to-file", s.mgmt.PutLoggingToFile)
@@ -495,6 +628,25 @@ func (s *Server) registerManagementRoutes() {
 		mgmt.PUT("/proxy-url", s.mgmt.PutProxyURL)
 		mgmt.PATCH("/proxy-url", s.mgmt.PutProxyURL)
 		mgmt.DELETE("/proxy-url", s.mgmt.DeleteProxyURL)
+		mgmt.GET("/provider-proxies", s.mgmt.GetProviderProxies)
+		mgmt.PUT("/provider-proxies", s.mgmt.PutProviderProxies)
+		mgmt.PATCH("/provider-proxies", s.mgmt.PatchProviderProxies)
+		mgmt.DELETE("/provider-proxies", s.mgmt.DeleteProviderProxies)
+		mgmt.GET("/provider-status", s.mgmt.GetProviderStatus)
+
+		mgmt.GET("/circuit-breakers", s.mgmt.GetCircuitBreakers)
+		mgmt.DELETE("/circuit-breakers", s.mgmt.DeleteCircuitBreakers)
+		mgmt.GET("/auth-refresh", s.mgmt.GetAuthRefresh)
+		mgmt.GET("/auth-events", s.mgmt.GetAuthEvents)
+		mgmt.GET("/events", s.mgmt.StreamEvents)
+		mgmt.GET("/credential-canaries", s.mgmt.GetCredentialCanaries)
+		mgmt.DELETE("/credential-canaries", s.mgmt.DeleteCredentialCanaries)
+		mgmt.GET("/latency-routing", s.mgmt.GetLatencyRouting)
+		mgmt.GET("/credential-concurrency", s.mgmt.GetCredentialConcurrency)
+		mgmt.GET("/credential-quotas", s.mgmt.GetCredentialQuotas)
+
+		mgmt.GET("/payload", s.mgmt.GetPayloadConfig)
+		mgmt.GET("/payload/effective", s.mgmt.GetEffectivePayload)
 
 		mgmt.GET("/quota-exceeded/switch-project", s.mgmt.GetSwitchProject)
 		mgmt.PUT("/quota-exceeded/switch-project", s.mgmt.PutSwitchProject)
@@ -509,18 +661,39 @@ func (s *Server) registerManagementRoutes() {
 		mgmt.PATCH("/api-keys", s.mgmt.PatchAPIKeys)
 		mgmt.DELETE("/api-keys", s.mgmt.DeleteAPIKeys)
 
+		mgmt.GET("/credential-store", s.mgmt.GetCredentialStore)
+		mgmt.POST("/credential-store/rotate", s.mgmt.RotateCredentialKey)
+		mgmt.POST("/credential-store/export", s.mgmt.ExportCredentialBundle)
+		mgmt.POST("/credential-store/import", s.mgmt.ImportCredentialBundle)
+
+		mgmt.GET("/api-key-policies", s.mgmt.GetAPIKeyPolicies)
+		mgmt.PUT("/api-key-policies", s.mgmt.PutAPIKeyPolicies)
+		mgmt.PATCH("/api-key-policies", s.mgmt.PatchAPIKeyPolicy)
+		mgmt.DELETE("/api-key-policies", s.mgmt.DeleteAPIKeyPolicy)
+
+		mgmt.GET("/teams", s.mgmt.GetTeams)
+		mgmt.PUT("/teams", s.mgmt.PutTeams)
+		mgmt.PATCH("/teams", s.mgmt.PatchTeam)
+		mgmt.DELETE("/teams", s.mgmt.DeleteTeam)
+
+		mgmt.GET("/invite-codes", s.mgmt.GetInviteCodes)
+		mgmt.POST("/invite-codes", s.mgmt.CreateInviteCode)
+		mgmt.DELETE("/invite-codes", s.mgmt.DeleteInviteCode)
+
 		mgmt.GET("/gemini-api-key", s.mgmt.GetGeminiKeys)
 		mgmt.PUT("/gemini-api-key", s.mgmt.PutGeminiKeys)
 		mgmt.PATCH("/gemini-api-key", s.mgmt.PatchGeminiKey)
 		mgmt.DELETE("/gemini-api-key", s.mgmt.DeleteGeminiKey)
 
 		mgmt.GET("/logs", s.mgmt.GetLogs)
+		mgmt.GET("/logs/tail", s.mgmt.TailLogs)
 		mgmt.DELETE("/logs", s.mgmt.DeleteLogs)
 		mgmt.GET("/request-error-logs", s.mgmt.GetRequestErrorLogs)
 		mgmt.GET("/request-error-logs/:name", s.mgmt.DownloadRequestErrorLog)
 		mgmt.GET("/request-log", s.mgmt.GetRequestLog)
 		mgmt.PUT("/request-log", s.mgmt.PutRequestLog)
 		mgmt.PATCH("/request-log", s.mgmt.PutRequestLog)
+		mgmt.POST("/request-log/replay", s.mgmt.ReplayRequestLog)
 		mgmt.GET("/ws-auth", s.mgmt.GetWebsocketAuth)
 		mgmt.PUT("/ws-auth", s.mgmt.PutWebsocketAuth)
 		mgmt.PATCH("/ws-auth", s.mgmt.PutWebsocketAuth)
@@ -596,6 +769,24 @@ func (s *Server) registerManagementRoutes() {
 		mgmt.GET("/otel-endpoint", s.mgmt.GetOTLPEndpoint)
 		mgmt.PUT("/otel-endpoint", s.mgmt.SetOTLPEndpoint)
 		mgmt.PATCH("/otel-endpoint", s.mgmt.SetOTLPEndpoint)
+		mgmt.GET("/otlp", s.mgmt.GetOTLPConfig)
+		mgmt.PUT("/otlp", s.mgmt.PutOTLPConfig)
+		mgmt.GET("/otlp/spool", s.mgmt.GetOTLPSpool)
+
+		// Usage database retention
+		mgmt.GET("/status", s.mgmt.GetStatus)
+		mgmt.GET("/usage-sinks", s.mgmt.GetUsageSinks)
+		mgmt.GET("/kafka/avro-schema", s.mgmt.GetKafkaAvroSchema)
+		mgmt.GET("/usage-db", s.mgmt.GetUsageDBStatus)
+		mgmt.GET("/usage-db/retention", s.mgmt.GetUsageDBRetention)
+		mgmt.PUT("/usage-db/retention", s.mgmt.PutUsageDBRetention)
+		mgmt.PATCH("/usage-db/retention", s.mgmt.PatchUsageDBProviderRetention)
+		mgmt.DELETE("/usage-db/retention", s.mgmt.DeleteUsageDBProviderRetention)
+		mgmt.PATCH("/usage-db/retention/credentials", s.mgmt.PatchUsageDBCredentialRetention)
+		mgmt.DELETE("/usage-db/retention/credentials", s.mgmt.DeleteUsageDBCredentialRetention)
+		mgmt.GET("/usage-db/views/:view", s.mgmt.GetUsageDBView)
+		mgmt.GET("/usage-db/grafana-dashboard", s.mgmt.GetUsageDBGrafanaDashboard)
+		mgmt.POST("/usage-db/fingerprints/migrate", s.mgmt.PostUsageFingerprintMigration)
 	}
 }
 
@@ -636,6 +827,70 @@ func (s *Server) serveManagementControlPanel(c *gin.Context) {
 	c.File(filePath)
 }
 
+// serveAdminUI serves the embedded dashboard. It follows the control panel switch,
+// since both expose the management API to a browser.
+func (s *Server) serveAdminUI(c *gin.Context) {
+	if cfg := s.cfg; cfg == nil || cfg.RemoteManagement.DisableControlPanel {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	s.adminUI.ServeHTTP(c.Writer, c.Request)
+}
+
+// redeemInviteCode exchanges an invite code for a client API key. It is served
+// outside the authenticated route groups, since the caller has no key yet.
+func (s *Server) redeemInviteCode(c *gin.Context) {
+	if s.mgmt == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	s.mgmt.RedeemInviteCode(c)
+}
+
+// serveMetrics writes the per-route handler metrics in the Prometheus text format.
+// It responds 404 while the prometheus block is disabled.
+func (s *Server) serveMetrics(c *gin.Context) {
+	registry := httpmetrics.Active()
+	if registry == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if !httpmetrics.Authorized(c.GetHeader("Authorization")) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Header("Content-Type", httpmetrics.ContentType)
+	c.Status(http.StatusOK)
+	if err := registry.Write(c.Writer); err != nil {
+		log.WithError(err).Debug("failed to write metrics")
+		return
+	}
+	shed := loadshed.CurrentStats()
+	if err := httpmetrics.WriteLoadShedding(c.Writer, httpmetrics.LoadShedding{
+		InFlight: shed.InFlight,
+		Shed:     map[string]uint64{loadshed.ReasonInFlight: shed.ShedInFlight, loadshed.ReasonQueueWait: shed.ShedQueueWait},
+	}); err != nil {
+		log.WithError(err).Debug("failed to write load shedding metrics")
+	}
+	if s.handlers == nil || s.handlers.AuthManager == nil {
+		return
+	}
+	stats := s.handlers.AuthManager.PriorityQueueStats()
+	classes := make([]httpmetrics.QueueClass, 0, len(stats))
+	for _, st := range stats {
+		classes = append(classes, httpmetrics.QueueClass{
+			Priority:    string(st.Priority),
+			Queued:      st.Queued,
+			Waited:      st.Waited,
+			Timeouts:    st.Timeouts,
+			WaitSeconds: float64(st.TotalWaitMs) / 1000,
+		})
+	}
+	if err := httpmetrics.WriteQueueClasses(c.Writer, classes); err != nil {
+		log.WithError(err).Debug("failed to write credential queue metrics")
+	}
+}
+
 func (s *Server) enableKeepAlive(timeout time.Duration, onTimeout func()) {
 	if timeout <= 0 || onTimeout == nil {
 		return
@@ -823,19 +1078,38 @@ func (s *Server) applyAccessConfig(oldCfg, newCfg *config.Config) {
 
 // UpdateClients updates the server's client list and configuration.
 // This method is called when the configuration or authentication tokens change.
+// A config rejected by ApplyConfig is logged and the previous one stays active.
 //
 // Parameters:
-//   - clients: The new slice of AI service clients
 //   - cfg: The new application configuration
 func (s *Server) UpdateClients(cfg *config.Config) {
+	if err := s.ApplyConfig(cfg); err != nil {
+		log.WithError(err).Error("config update rolled back")
+	}
+}
+
+// ApplyConfig applies cfg to the running server. The usage database, metrics, export
+// and secrets subsystems are configured first; when any of them rejects cfg they are
+// restored from the previous config, nothing else is touched and the error is
+// returned. Otherwise the remaining settings are swapped in and cfg becomes current.
+func (s *Server) ApplyConfig(cfg *config.Config) error {
+	if cfg == nil {
+		return errors.New("config is nil")
+	}
 	// Reconstruct old config from YAML snapshot to avoid reference sharing issues
 	var oldCfg *config.Config
 	if len(s.oldConfigYaml) > 0 {
 		_ = yaml.Unmarshal(s.oldConfigYaml, &oldCfg)
 	}
 
-	if cfg != nil {
-		cfg.NormalizeUsageDatabasePath(s.configFilePath)
+	cfg.NormalizeUsageDatabasePath(s.configFilePath)
+	if err := configureSubsystems(cfg); err != nil {
+		if oldCfg != nil {
+			if errRestore := configureSubsystems(oldCfg); errRestore != nil {
+				log.WithError(errRestore).Warn("failed to restore subsystems from the previous config")
+			}
+		}
+		return err
 	}
 
 	// Update request logger enabled state if it has changed
@@ -882,14 +1156,6 @@ func (s *Server) UpdateClients(cfg *config.Config) {
 		}
 	}
 
-	if err := usage.ConfigureDatabase(usage.DatabaseOptions{
-		Enabled:       cfg.UsageDatabase.Enabled,
-		Path:          cfg.UsageDatabase.Path,
-		RetentionDays: cfg.UsageDatabase.RetentionDays,
-	}); err != nil {
-		log.WithError(err).Warn("failed to configure usage database")
-	}
-
 	if oldCfg == nil || oldCfg.DisableCooling != cfg.DisableCooling {
 		auth.SetQuotaCooldownDisabled(cfg.DisableCooling)
 		if oldCfg != nil {
@@ -900,10 +1166,20 @@ func (s *Server) UpdateClients(cfg *config.Config) {
 	}
 	if s.handlers != nil && s.handlers.AuthManager != nil {
 		s.handlers.AuthManager.SetRetryConfig(cfg.RequestRetry, time.Duration(cfg.MaxRetryInterval)*time.Second)
+		s.handlers.AuthManager.SetCircuitBreaker(circuitBreakerConfig(cfg))
+		s.handlers.AuthManager.SetCredentialCanary(credentialCanaryConfig(cfg))
+		s.handlers.AuthManager.SetLatencyRouting(latencyRoutingConfig(cfg))
+		s.handlers.AuthManager.SetRefreshConfig(authRefreshConfig(cfg))
+		s.handlers.AuthManager.SetConcurrencyLimit(concurrencyConfig(cfg))
+		s.handlers.AuthManager.SetRateLimitSwitch(cfg.QuotaExceeded.SwitchCredentialEnabled())
+		applySessionAffinity(s.handlers.AuthManager, cfg)
+	}
+	if s.batches != nil {
+		s.batches.SetConcurrency(cfg.Batch.Concurrency)
 	}
 
-	// Update log level dynamically when debug flag changes
-	if oldCfg == nil || oldCfg.Debug != cfg.Debug {
+	// Update log level dynamically when debug, log-level or log-components change
+	if oldCfg == nil || oldCfg.Debug != cfg.Debug || oldCfg.LogLevel != cfg.LogLevel || !slices.Equal(oldCfg.LogComponents, cfg.LogComponents) {
 		util.SetLogLevel(cfg)
 		if oldCfg != nil {
 			log.Debugf("debug mode updated from %t to %t", oldCfg.Debug, cfg.Debug)
@@ -944,6 +1220,24 @@ func (s *Server) UpdateClients(cfg *config.Config) {
 		}
 	}
 
+	classify.SetRules(cfg.ClassificationRules)
+	workspace.Set(cfg.Workspaces)
+	team.Set(cfg.Teams)
+	policy.SetPolicies(cfg.EffectiveAPIKeyPolicies())
+	modelrewrite.SetRules(cfg.ModelRewrites)
+	requesttransform.SetRules(cfg.RequestTransforms)
+	reasoningbudget.SetRules(cfg.ReasoningBudgets)
+	shadow.Set(cfg.ShadowTraffic)
+	httpmetrics.Set(cfg.Prometheus)
+	if err := redisstate.Configure(cfg.Redis); err != nil {
+		log.WithError(err).Warn("failed to initialize redis, enforcing limits locally")
+	}
+	netaccess.Set(cfg.NetworkAccess)
+	bodylimit.Set(cfg.RequestSizeLimits)
+	loadshed.Set(cfg.LoadShedding)
+	idempotency.Set(cfg.Idempotency)
+	clientattr.Set(cfg.ClientAttribution)
+
 	s.applyAccessConfig(oldCfg, cfg)
 	s.cfg = cfg
 	s.wsAuthEnabled.Store(cfg.WebsocketAuth)
@@ -997,6 +1291,88 @@ func (s *Server) UpdateClients(cfg *config.Config) {
 		vertexAICompatCount,
 		openAICompatCount,
 	)
+	return nil
+}
+
+// configureSubsystems applies the usage database and its archive, the metrics and
+// export pipelines and the secrets backend for cfg. Every subsystem is attempted;
+// the returned error joins the ones that rejected the config.
+func configureSubsystems(cfg *config.Config) error {
+	var errs []error
+	if err := usage.ConfigureDatabase(usage.DatabaseOptions{
+		Enabled:                 cfg.UsageDatabase.Enabled,
+		Path:                    cfg.UsageDatabase.Path,
+		RetentionDays:           cfg.UsageDatabase.RetentionDays,
+		RequestsRetentionDays:   cfg.UsageDatabase.RequestsRetentionDays,
+		DailyRetentionDays:      cfg.UsageDatabase.DailyRetentionDays,
+		ProviderRetentionDays:   cfg.UsageDatabase.ProviderRetentionDays,
+		CredentialRetentionDays: cfg.UsageDatabase.CredentialRetentionDays,
+		ReadOnly:                cfg.UsageDatabase.ReadOnly,
+		QueueSize:               cfg.UsageDatabase.QueueSize,
+		OverflowPolicy:          cfg.UsageDatabase.OverflowPolicy,
+		SQLite:                  usage.SQLiteOptionsFromConfig(cfg.UsageDatabase.SQLite),
+		HashAccountEmail:        cfg.UsageDatabase.HashAccountEmail,
+		ModelPrices:             usage.ModelPricesFromConfig(cfg.UsageDatabase.ModelPrices),
+		SpendCaps:               usage.SpendCapsFromConfig(cfg.APIKeyPolicies),
+		TeamSpendCaps:           usage.TeamSpendCapsFromConfig(cfg.Teams),
+		FingerprintSalt:         usage.FingerprintSaltFromConfig(cfg.UsageDatabase),
+		MirrorDSN:               usage.MirrorDSNFromConfig(cfg.UsageDatabase),
+		Encryption:              usage.DatabaseEncryptionFromConfig(cfg.UsageDatabase.Encryption),
+	}); err != nil {
+		errs = append(errs, fmt.Errorf("usage database: %w", err))
+	}
+	providerspend.SetCaps(cfg.ProviderSpendCaps)
+	if err := usage.RefreshProviderSpend(context.Background()); err != nil && len(cfg.ProviderSpendCaps) > 0 {
+		log.WithError(err).Warn("provider spend caps are not enforced")
+	}
+	if err := usage.ConfigureStatsD(usage.StatsDOptions{
+		Enabled: cfg.StatsD.Enabled,
+		Address: cfg.StatsD.Address,
+		Prefix:  cfg.StatsD.Prefix,
+		Flavor:  cfg.StatsD.Flavor,
+		Tags:    cfg.StatsD.Tags,
+	}); err != nil {
+		errs = append(errs, fmt.Errorf("statsd metrics: %w", err))
+	}
+	if err := usage.ConfigureUsageSinks(usage.SinkOptionsFromConfig(cfg.UsageSinks)); err != nil {
+		errs = append(errs, fmt.Errorf("usage sinks: %w", err))
+	}
+	if err := usage.ConfigureKafka(usage.KafkaOptionsFromConfig(cfg.Kafka)); err != nil {
+		errs = append(errs, fmt.Errorf("kafka usage publisher: %w", err))
+	}
+	if err := usage.ConfigureArchive(usage.ArchiveOptionsFromConfig(cfg.UsageDatabase.Archive)); err != nil {
+		errs = append(errs, fmt.Errorf("usage archive: %w", err))
+	}
+	if err := usage.ConfigureReports(usage.ReportOptionsFromConfig(cfg.UsageDatabase.Reports)); err != nil {
+		errs = append(errs, fmt.Errorf("usage reports: %w", err))
+	}
+	if err := usage.ConfigureOTLPExport(usage.OTLPExportOptions{
+		Enabled:            cfg.OTLP.IsEnabled(),
+		Endpoint:           cfg.OTLP.Endpoint,
+		Endpoints:          cfg.OTLP.Endpoints,
+		SRVName:            cfg.OTLP.SRV.Name,
+		SRVScheme:          cfg.OTLP.SRV.Scheme,
+		SRVPath:            cfg.OTLP.SRV.Path,
+		Protocol:           cfg.OTLP.Protocol,
+		Headers:            cfg.OTLP.Headers,
+		CAFile:             cfg.OTLP.TLSCAFile,
+		InsecureSkipVerify: cfg.OTLP.TLSInsecureSkipVerify,
+		Timeout:            time.Duration(cfg.OTLP.TimeoutMs) * time.Millisecond,
+		BatchSize:          cfg.OTLP.BatchSize,
+		FlushInterval:      time.Duration(cfg.OTLP.FlushIntervalMs) * time.Millisecond,
+		SpoolDir:           cfg.OTLP.Spool.Dir,
+		SpoolMaxBytes:      int64(cfg.OTLP.Spool.MaxSizeMB) << 20,
+		SpoolMaxAge:        time.Duration(cfg.OTLP.Spool.MaxAgeHours) * time.Hour,
+		Sampling:           usage.OTLPSamplingFromConfig(cfg.OTLP.Sampling),
+		ResourceAttributes: cfg.OTLP.ResourceAttributes,
+		ExcludeEvents:      cfg.OTLP.ExcludeEvents,
+	}); err != nil {
+		errs = append(errs, fmt.Errorf("OTLP export: %w", err))
+	}
+	if err := secrets.Configure(secrets.OptionsFromConfig(cfg.Secrets)); err != nil {
+		errs = append(errs, fmt.Errorf("secrets backend: %w", err))
+	}
+	return errors.Join(errs...)
 }
 
 func (s *Server) SetWebsocketAuthChangeHandler(fn func(bool, bool)) {
@@ -1018,6 +1394,24 @@ func AuthMiddleware(manager *sdkaccess.Manager) gin.HandlerFunc {
 			return
 		}
 
+		// Replayed requests originate in-process from the management API, which has
+		// already authenticated the operator.
+		if _, ok := replay.FromContext(c.Request.Context()); ok {
+			c.Set("accessProvider", "replay")
+			c.Next()
+			return
+		}
+
+		// Batched requests carry the identity of the client that created the batch.
+		if principal, ok := batch.PrincipalFromContext(c.Request.Context()); ok {
+			if principal.APIKey != "" {
+				c.Set("apiKey", principal.APIKey)
+			}
+			c.Set("accessProvider", principal.AccessProvider)
+			c.Next()
+			return
+		}
+
 		result, err := manager.Authenticate(c.Request.Context(), c.Request)
 		if err == nil {
 			if result != nil {
@@ -1042,3 +1436,64 @@ func AuthMiddleware(manager *sdkaccess.Manager) gin.HandlerFunc {
 		}
 	}
 }
+
+// circuitBreakerConfig converts the YAML circuit breaker settings for the auth manager.
+func circuitBreakerConfig(cfg *config.Config) auth.BreakerConfig {
+	return auth.BreakerConfig{
+		Enabled:          cfg.CircuitBreaker.Enabled,
+		FailureThreshold: cfg.CircuitBreaker.FailureThreshold,
+		Window:           time.Duration(cfg.CircuitBreaker.WindowSeconds) * time.Second,
+		OpenDuration:     time.Duration(cfg.CircuitBreaker.OpenSeconds) * time.Second,
+	}
+}
+
+// credentialCanaryConfig converts the YAML canary settings for the auth manager.
+func credentialCanaryConfig(cfg *config.Config) auth.CanaryConfig {
+	return auth.CanaryConfig{
+		Enabled:          cfg.CredentialCanary.Enabled,
+		Percent:          cfg.CredentialCanary.TrafficPercent,
+		Warmup:           time.Duration(cfg.CredentialCanary.WarmupMinutes) * time.Minute,
+		MinRequests:      cfg.CredentialCanary.MinRequests,
+		MaxFailureRate:   cfg.CredentialCanary.MaxFailureRate,
+		MaxRateLimitRate: cfg.CredentialCanary.MaxRateLimitRate,
+	}
+}
+
+// latencyRoutingConfig converts the YAML latency routing settings for the auth manager.
+func latencyRoutingConfig(cfg *config.Config) auth.LatencyConfig {
+	return auth.LatencyConfig{
+		Enabled:    cfg.LatencyRouting.Enabled,
+		Window:     time.Duration(cfg.LatencyRouting.WindowSeconds) * time.Second,
+		MinSamples: cfg.LatencyRouting.MinSamples,
+	}
+}
+
+// authRefreshConfig converts the YAML proactive refresh settings for the auth manager.
+func authRefreshConfig(cfg *config.Config) auth.RefreshConfig {
+	return auth.RefreshConfig{
+		JitterFraction: cfg.AuthRefresh.JitterFraction(),
+		MaxBackoff:     time.Duration(cfg.AuthRefresh.MaxBackoffSeconds) * time.Second,
+	}
+}
+
+// applySessionAffinity configures sticky routing and, when requested, backs the
+// conversation bindings with the usage database.
+func applySessionAffinity(manager *auth.Manager, cfg *config.Config) {
+	manager.SetSessionAffinity(auth.AffinityConfig{
+		Enabled: cfg.SessionAffinity.Enabled,
+		TTL:     time.Duration(cfg.SessionAffinity.TTLSeconds) * time.Second,
+	})
+	if cfg.SessionAffinity.Enabled && cfg.SessionAffinity.Persist {
+		manager.SetAffinityStore(&usage.SessionAffinityStore{})
+	} else {
+		manager.SetAffinityStore(nil)
+	}
+}
+
+// concurrencyConfig converts the YAML per-credential concurrency settings for the auth manager.
+func concurrencyConfig(cfg *config.Config) auth.ConcurrencyConfig {
+	return auth.ConcurrencyConfig{
+		MaxInFlight:  cfg.CredentialConcurrency.MaxInFlight,
+		QueueTimeout: time.Duration(cfg.CredentialConcurrency.QueueTimeoutSeconds) * time.Second,
+	}
+}
@@ -9,10 +9,15 @@ import (
 	"testing"
 
 	gin "github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/api/middleware"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/bodylimit"
 	proxyconfig "github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/httpmetrics"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/idempotency"
 	sdkaccess "github.com/router-for-me/CLIProxyAPI/v6/sdk/access"
 	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
 	sdkconfig "github.com/router-for-me/CLIProxyAPI/v6/sdk/config"
+	"github.com/tidwall/gjson"
 )
 
 func newTestServer(t *testing.T) *Server {
@@ -109,3 +114,188 @@ func TestAmpProviderModelRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestAdminUIServed(t *testing.T) {
+	server := newTestServer(t)
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.engine.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	if rr := get("/ui/"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `<script src="app.js">`) {
+		t.Fatalf("unexpected /ui/ response: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := get("/ui/app.js"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "/v0/management") {
+		t.Fatalf("unexpected /ui/app.js response: %d", rr.Code)
+	}
+	if rr := get("/ui"); rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "/ui/" {
+		t.Fatalf("expected /ui to redirect to /ui/, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	server.cfg.RemoteManagement.DisableControlPanel = true
+	if rr := get("/ui/"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with the control panel disabled, got %d", rr.Code)
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	server := newTestServer(t)
+	bodylimit.Set(proxyconfig.RequestSizeLimitsConfig{MaxBodyBytes: 64})
+	t.Cleanup(func() { bodylimit.Set(proxyconfig.RequestSizeLimitsConfig{}) })
+
+	body := `{"model":"test","messages":[{"role":"user","content":"` + strings.Repeat("x", 128) + `"}]}`
+	cases := []struct {
+		name          string
+		contentLength int64
+	}{
+		{"declared length", int64(len(body))},
+		{"chunked", -1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.ContentLength = tc.contentLength
+			req.Header.Set("Authorization", "Bearer test-key")
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			server.engine.ServeHTTP(rr, req)
+			if rr.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("status = %d, want 413; body=%s", rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), bodylimit.RejectionTooLarge) {
+				t.Fatalf("expected %q in response, got %s", bodylimit.RejectionTooLarge, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	server := newTestServer(t)
+	idempotency.Set(proxyconfig.IdempotencyConfig{Enabled: true})
+	t.Cleanup(func() { idempotency.Set(proxyconfig.IdempotencyConfig{}) })
+
+	calls := 0
+	server.engine.POST("/idempotency-test", func(c *gin.Context) {
+		c.Set("apiKey", c.GetHeader("X-Test-Key"))
+	}, middleware.IdempotencyMiddleware(), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"call": calls})
+	})
+	send := func(clientKey, idemKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/idempotency-test", strings.NewReader(body))
+		req.Header.Set("X-Test-Key", clientKey)
+		req.Header.Set(middleware.IdempotencyKeyHeader, idemKey)
+		rr := httptest.NewRecorder()
+		server.engine.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := send("a", "k1", `{"model":"m"}`)
+	retry := send("a", "k1", `{"model":"m"}`)
+	if calls != 1 || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retry was not replayed: calls=%d status=%d body=%s", calls, retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" || retry.Header().Get("Content-Type") == "" {
+		t.Fatalf("unexpected replay headers: %v", retry.Header())
+	}
+	if rr := send("a", "k1", `{"model":"other"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key with another body: status = %d, want 422", rr.Code)
+	}
+	send("b", "k1", `{"model":"m"}`)
+	if calls != 2 {
+		t.Fatalf("keys must be scoped per client key, calls = %d", calls)
+	}
+	send("a", "k2", `{"model":"m","stream":true}`)
+	send("a", "k2", `{"model":"m","stream":true}`)
+	if calls != 4 {
+		t.Fatalf("streaming requests must not be replayed, calls = %d", calls)
+	}
+}
+
+func TestApplyConfigRollsBackRejectedConfig(t *testing.T) {
+	server := newTestServer(t)
+	previous := server.cfg
+
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatalf("failed to create blocker file: %v", err)
+	}
+	rejected := *previous
+	rejected.Debug = false
+	rejected.UsageDatabase = proxyconfig.UsageDatabaseConfig{Enabled: true, Path: filepath.Join(blocker, "usage.db")}
+	if err := server.ApplyConfig(&rejected); err == nil || !strings.Contains(err.Error(), "usage database") {
+		t.Fatalf("expected the usage database to reject the config, got %v", err)
+	}
+	if server.cfg != previous || !server.cfg.Debug {
+		t.Fatal("expected the previous config to stay active after a rejected reload")
+	}
+
+	accepted := *previous
+	accepted.Debug = false
+	if err := server.ApplyConfig(&accepted); err != nil {
+		t.Fatalf("expected the config to apply, got %v", err)
+	}
+	if server.cfg != &accepted {
+		t.Fatal("expected the accepted config to become current")
+	}
+}
+
+func TestMetricsEndpointReportsRouteTemplates(t *testing.T) {
+	server := newTestServer(t)
+	httpmetrics.Set(proxyconfig.PrometheusConfig{Enabled: true})
+	defer httpmetrics.Set(proxyconfig.PrometheusConfig{})
+
+	for _, path := range []string{"/", "/v1/files/file-123", "/no-such-path"} {
+		server.engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	rec := httptest.NewRecorder()
+	server.engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != httpmetrics.ContentType {
+		t.Fatalf("unexpected metrics response: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`cliproxy_http_requests_total{method="GET",route="/",status="2xx"} 1`,
+		`cliproxy_http_requests_total{method="GET",route="/v1/files/:file_id",status=`,
+		`cliproxy_http_requests_total{method="GET",route="unmatched",status="4xx"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestInviteCodeRedemption(t *testing.T) {
+	server := newTestServer(t)
+	server.cfg.InviteCodes = []proxyconfig.InviteCode{{Code: "TEAM-CODE", Label: "new hire", Policy: proxyconfig.APIKeyPolicy{AllowedModels: []string{"gpt-5*"}}}}
+	if err := os.WriteFile(server.configFilePath, []byte("port: 0\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	redeem := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/invites/redeem", strings.NewReader(`{"code":"team-code"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		server.engine.ServeHTTP(rr, req)
+		return rr
+	}
+	rr := redeem()
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201; body=%s", rr.Code, rr.Body.String())
+	}
+	key := gjson.Get(rr.Body.String(), "api-key").String()
+	if !strings.HasPrefix(key, "sk-") || gjson.Get(rr.Body.String(), "policy.allowed-models.0").String() != "gpt-5*" {
+		t.Fatalf("unexpected redemption response %s", rr.Body.String())
+	}
+	saved, err := os.ReadFile(server.configFilePath)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	if !strings.Contains(string(saved), key) || strings.Contains(string(saved), "TEAM-CODE") {
+		t.Fatalf("expected the key to be saved and the code removed, got:\n%s", saved)
+	}
+	if rr = redeem(); rr.Code != http.StatusNotFound {
+		t.Fatalf("second redemption status = %d, want 404", rr.Code)
+	}
+}
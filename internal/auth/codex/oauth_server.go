@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -121,7 +122,7 @@ func (s *OAuthServer) Stop(ctx context.Context) error {
 		return nil
 	}
 
-	log.Debug("Stopping OAuth callback server")
+	util.ComponentLog(util.LogComponentAuth).Debug("Stopping OAuth callback server")
 
 	// Create a context with timeout for shutdown
 	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -163,7 +164,7 @@ func (s *OAuthServer) WaitForCallback(timeout time.Duration) (*OAuthResult, erro
 //   - w: The HTTP response writer
 //   - r: The HTTP request
 func (s *OAuthServer) handleCallback(w http.ResponseWriter, r *http.Request) {
-	log.Debug("Received OAuth callback")
+	util.ComponentLog(util.LogComponentAuth).Debug("Received OAuth callback")
 
 	// Validate request method
 	if r.Method != http.MethodGet {
@@ -226,7 +227,7 @@ func (s *OAuthServer) handleCallback(w http.ResponseWriter, r *http.Request) {
 //   - w: The HTTP response writer
 //   - r: The HTTP request
 func (s *OAuthServer) handleSuccess(w http.ResponseWriter, r *http.Request) {
-	log.Debug("Serving success page")
+	util.ComponentLog(util.LogComponentAuth).Debug("Serving success page")
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -283,7 +284,7 @@ func (s *OAuthServer) generateSuccessHTML(setupRequired bool, platformURL string
 func (s *OAuthServer) sendResult(result *OAuthResult) {
 	select {
 	case s.resultChan <- result:
-		log.Debug("OAuth result sent to channel")
+		util.ComponentLog(util.LogComponentAuth).Debug("OAuth result sent to channel")
 	default:
 		log.Warn("OAuth result channel is full, result dropped")
 	}
@@ -267,9 +267,9 @@ func (g *GeminiAuth) getTokenFromWeb(ctx context.Context, config *oauth2.Config,
 
 				// Log platform info for debugging
 				platformInfo := browser.GetPlatformInfo()
-				log.Debugf("Browser platform info: %+v", platformInfo)
+				util.ComponentLog(util.LogComponentAuth).Debugf("Browser platform info: %+v", platformInfo)
 			} else {
-				log.Debug("Browser opened successfully")
+				util.ComponentLog(util.LogComponentAuth).Debug("Browser opened successfully")
 			}
 		}
 	} else {
@@ -14,7 +14,6 @@ import (
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -124,7 +123,7 @@ func (ia *IFlowAuth) doTokenRequest(ctx context.Context, req *http.Request) (*IF
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Debugf("iflow token request failed: status=%d body=%s", resp.StatusCode, string(body))
+		util.ComponentLog(util.LogComponentAuth).Debugf("iflow token request failed: status=%d body=%s", resp.StatusCode, string(body))
 		return nil, fmt.Errorf("iflow token: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
@@ -142,7 +141,7 @@ func (ia *IFlowAuth) doTokenRequest(ctx context.Context, req *http.Request) (*IF
 	}
 
 	if tokenResp.AccessToken == "" {
-		log.Debug(string(body))
+		util.ComponentLog(util.LogComponentAuth).Debug(string(body))
 		return nil, fmt.Errorf("iflow token: missing access token in response")
 	}
 
@@ -191,7 +190,7 @@ func (ia *IFlowAuth) FetchUserInfo(ctx context.Context, accessToken string) (*us
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Debugf("iflow api key failed: status=%d body=%s", resp.StatusCode, string(body))
+		util.ComponentLog(util.LogComponentAuth).Debugf("iflow api key failed: status=%d body=%s", resp.StatusCode, string(body))
 		return nil, fmt.Errorf("iflow api key: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
@@ -373,7 +372,7 @@ func (ia *IFlowAuth) fetchAPIKeyInfo(ctx context.Context, cookie string) (*iFlow
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Debugf("iflow cookie GET request failed: status=%d body=%s", resp.StatusCode, string(body))
+		util.ComponentLog(util.LogComponentAuth).Debugf("iflow cookie GET request failed: status=%d body=%s", resp.StatusCode, string(body))
 		return nil, fmt.Errorf("iflow cookie: GET request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
@@ -452,7 +451,7 @@ func (ia *IFlowAuth) RefreshAPIKey(ctx context.Context, cookie, name string) (*i
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Debugf("iflow cookie POST request failed: status=%d body=%s", resp.StatusCode, string(body))
+		util.ComponentLog(util.LogComponentAuth).Debugf("iflow cookie POST request failed: status=%d body=%s", resp.StatusCode, string(body))
 		return nil, fmt.Errorf("iflow cookie refresh: POST request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
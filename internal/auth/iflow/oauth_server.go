@@ -9,7 +9,7 @@ import (
 	"sync"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
 )
 
 const errorRedirectURL = "https://iflow.cn/oauth/error"
@@ -128,7 +128,7 @@ func (s *OAuthServer) sendResult(res *OAuthResult) {
 	select {
 	case s.result <- res:
 	default:
-		log.Debug("iflow oauth result channel full, dropping result")
+		util.ComponentLog(util.LogComponentAuth).Debug("iflow oauth result channel full, dropping result")
 	}
 }
 
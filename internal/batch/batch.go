@@ -0,0 +1,160 @@
+// Package batch implements the OpenAI Batch API. Each line of a batch input file is
+// re-issued through the server's own router, so batched requests get the same
+// routing, credential rotation and usage accounting as interactive ones, while job
+// and file state is persisted in the usage database.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// MaxLines caps the number of requests in one batch input file.
+const MaxLines = 50000
+
+// SupportedEndpoints lists the endpoints a batch job may target.
+var SupportedEndpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings", "/v1/responses"}
+
+// Principal identifies the client that created a batch job. Its requests run with
+// the same identity so key policies, spending caps and usage attribution apply.
+type Principal struct {
+	APIKey         string
+	AccessProvider string
+	RemoteAddr     string
+	// UsageMetadata is the X-Usage-Metadata header of the batch creation request,
+	// repeated on every batched request for cost attribution.
+	UsageMetadata string
+}
+
+type contextKey struct{}
+
+// WithPrincipal marks ctx as carrying a batched request. Only in-process callers can
+// set this value, so it is safe to use for bypassing client authentication.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// PrincipalFromContext returns the batch principal attached to ctx.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	if ctx == nil {
+		return Principal{}, false
+	}
+	principal, ok := ctx.Value(contextKey{}).(Principal)
+	return principal, ok
+}
+
+// Line is one request of a batch input file.
+type Line struct {
+	CustomID string
+	Method   string
+	URL      string
+	Body     []byte
+}
+
+// SupportedEndpoint reports whether endpoint can be targeted by a batch job.
+func SupportedEndpoint(endpoint string) bool {
+	for _, candidate := range SupportedEndpoints {
+		if endpoint == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseInput parses a JSONL batch input file whose requests must all target endpoint.
+// Validation problems are returned as batch errors carrying their 1-based line number.
+func ParseInput(content []byte, endpoint string) ([]Line, []usage.BatchError) {
+	var (
+		lines    []Line
+		problems []usage.BatchError
+	)
+	seen := make(map[string]struct{})
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	number := 0
+	for scanner.Scan() {
+		number++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		fail := func(code, format string, args ...any) {
+			line := number
+			problems = append(problems, usage.BatchError{Code: code, Message: fmt.Sprintf(format, args...), Line: &line})
+		}
+		if !gjson.ValidBytes(raw) {
+			fail("invalid_json_line", "line is not valid JSON")
+			continue
+		}
+		parsed := gjson.ParseBytes(raw)
+		customID := parsed.Get("custom_id").String()
+		method := strings.ToUpper(parsed.Get("method").String())
+		url := parsed.Get("url").String()
+		body := parsed.Get("body")
+		switch {
+		case customID == "":
+			fail("missing_required_parameter", "custom_id is required")
+			continue
+		case method != http.MethodPost:
+			fail("invalid_method", "method must be POST")
+			continue
+		case url != endpoint:
+			fail("mismatched_endpoint", "url %q does not match the batch endpoint %q", url, endpoint)
+			continue
+		case !body.IsObject():
+			fail("missing_required_parameter", "body must be a JSON object")
+			continue
+		}
+		if _, dup := seen[customID]; dup {
+			fail("duplicate_custom_id", "custom_id %q is used more than once", customID)
+			continue
+		}
+		seen[customID] = struct{}{}
+		payload := []byte(body.Raw)
+		// Batch results are collected whole, so streaming is never requested upstream.
+		payload, _ = sjson.DeleteBytes(payload, "stream")
+		lines = append(lines, Line{CustomID: customID, Method: method, URL: url, Body: payload})
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, usage.BatchError{Code: "invalid_file", Message: err.Error()})
+	}
+	if len(lines) > MaxLines {
+		problems = append(problems, usage.BatchError{Code: "too_many_requests", Message: fmt.Sprintf("batch input has %d requests, the limit is %d", len(lines), MaxLines)})
+	}
+	if len(lines) == 0 && len(problems) == 0 {
+		problems = append(problems, usage.BatchError{Code: "empty_file", Message: "batch input file contains no requests"})
+	}
+	return lines, problems
+}
+
+// outputLine is one line of a batch output or error file.
+type outputLine struct {
+	ID       string            `json:"id"`
+	CustomID string            `json:"custom_id"`
+	Response *outputResponse   `json:"response"`
+	Error    *usage.BatchError `json:"error"`
+}
+
+type outputResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// responseBody returns body as JSON, quoting it when the upstream reply was not JSON.
+func responseBody(body []byte) json.RawMessage {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && json.Valid(trimmed) {
+		return trimmed
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
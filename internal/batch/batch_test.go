@@ -0,0 +1,157 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	"github.com/tidwall/gjson"
+)
+
+func TestParseInput(t *testing.T) {
+	content := []byte(strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"m","stream":true}}`,
+		``,
+		`{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"m"}}`,
+	}, "\n"))
+	lines, problems := ParseInput(content, "/v1/chat/completions")
+	if len(problems) != 0 {
+		t.Fatalf("unexpected problems: %+v", problems)
+	}
+	if len(lines) != 2 || lines[0].CustomID != "a" || lines[1].CustomID != "b" {
+		t.Fatalf("unexpected lines: %+v", lines)
+	}
+	if gjson.GetBytes(lines[0].Body, "stream").Exists() {
+		t.Fatalf("stream was not removed: %s", lines[0].Body)
+	}
+
+	invalid := []byte(strings.Join([]string{
+		`not json`,
+		`{"custom_id":"a","method":"GET","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{}}`,
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+	}, "\n"))
+	_, problems = ParseInput(invalid, "/v1/chat/completions")
+	wantCodes := []string{"invalid_json_line", "invalid_method", "mismatched_endpoint", "duplicate_custom_id"}
+	if len(problems) != len(wantCodes) {
+		t.Fatalf("expected %d problems, got %+v", len(wantCodes), problems)
+	}
+	for i, code := range wantCodes {
+		if problems[i].Code != code {
+			t.Fatalf("problem %d: expected %s, got %+v", i, code, problems[i])
+		}
+	}
+	if problems[3].Line == nil || *problems[3].Line != 5 {
+		t.Fatalf("duplicate reported on the wrong line: %+v", problems[3])
+	}
+
+	if _, problems = ParseInput(nil, "/v1/chat/completions"); len(problems) != 1 || problems[0].Code != "empty_file" {
+		t.Fatalf("expected empty_file, got %+v", problems)
+	}
+}
+
+func TestRunnerExecutesBatch(t *testing.T) {
+	if err := usage.ConfigureDatabase(usage.DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")}); err != nil {
+		t.Fatalf("configure database: %v", err)
+	}
+	t.Cleanup(func() { _ = usage.ConfigureDatabase(usage.DatabaseOptions{}) })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok || principal.APIKey != "sk-client" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if gjson.GetBytes(body, "model").String() == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"unknown model"}}`))
+			return
+		}
+		_, _ = w.Write(bytes.ToUpper(body))
+	})
+	runner := NewRunner(2)
+	runner.SetHandler(handler)
+
+	lines, problems := ParseInput([]byte(strings.Join([]string{
+		`{"custom_id":"ok-1","method":"POST","url":"/v1/embeddings","body":{"model":"m","input":"x"}}`,
+		`{"custom_id":"bad","method":"POST","url":"/v1/embeddings","body":{"model":"bad","input":"y"}}`,
+		`{"custom_id":"ok-2","method":"POST","url":"/v1/embeddings","body":{"model":"m","input":"z"}}`,
+	}, "\n")), "/v1/embeddings")
+	if len(problems) != 0 {
+		t.Fatalf("unexpected problems: %+v", problems)
+	}
+	now := time.Now().UTC()
+	owner := usage.APIKeyHash("sk-client")
+	started, err := runner.Start(usage.Batch{
+		ID:               NewBatchID(),
+		APIKeyHash:       owner,
+		Endpoint:         "/v1/embeddings",
+		InputFileID:      NewFileID(),
+		CompletionWindow: completionWindow,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(time.Hour),
+	}, Principal{APIKey: "sk-client"}, lines)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	var batch usage.Batch
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if batch, err = usage.GetBatch(context.Background(), started.ID); err != nil {
+			t.Fatalf("get batch: %v", err)
+		}
+		if batch.Terminal() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("batch did not finish, status %s", batch.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if batch.Status != usage.BatchStatusCompleted || batch.Total != 3 || batch.Completed != 2 || batch.Failed != 1 {
+		t.Fatalf("unexpected final batch: %+v", batch)
+	}
+
+	output, err := usage.BatchFileContent(context.Background(), batch.OutputFileID)
+	if err != nil {
+		t.Fatalf("output file: %v", err)
+	}
+	outLines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(outLines) != 2 {
+		t.Fatalf("expected 2 output lines, got %q", output)
+	}
+	if got := gjson.Get(outLines[0], "custom_id").String(); got != "ok-1" {
+		t.Fatalf("output not in input order: %s", outLines[0])
+	}
+	if got := gjson.Get(outLines[1], "response.body.INPUT").String(); got != "Z" {
+		t.Fatalf("unexpected response body: %s", outLines[1])
+	}
+	errorsFile, err := usage.BatchFileContent(context.Background(), batch.ErrorFileID)
+	if err != nil {
+		t.Fatalf("error file: %v", err)
+	}
+	if got := gjson.GetBytes(errorsFile, "response.status_code").Int(); got != http.StatusBadRequest {
+		t.Fatalf("unexpected error file: %s", errorsFile)
+	}
+	file, err := usage.GetBatchFile(context.Background(), batch.OutputFileID)
+	if err != nil || file.APIKeyHash != owner || file.Purpose != "batch_output" {
+		t.Fatalf("unexpected output file %+v (%v)", file, err)
+	}
+
+	listed, err := usage.ListBatches(context.Background(), owner, "", 10)
+	if err != nil || len(listed) != 1 || listed[0].ID != batch.ID {
+		t.Fatalf("unexpected batch list %+v (%v)", listed, err)
+	}
+	if listed, _ = usage.ListBatches(context.Background(), usage.APIKeyHash("sk-other"), "", 10); len(listed) != 0 {
+		t.Fatalf("batch visible to another key: %+v", listed)
+	}
+}
@@ -0,0 +1,359 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/api/handlers"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxFileBytes caps the size of an uploaded batch input file.
+	maxFileBytes = 100 << 20
+	// completionWindow is the only completion window accepted, as with OpenAI.
+	completionWindow = "24h"
+)
+
+// Handler serves the OpenAI-compatible /v1/files and /v1/batches endpoints. Files and
+// batches are scoped to the client API key that created them.
+type Handler struct {
+	runner *Runner
+}
+
+// NewHandler creates a handler that starts batch jobs on runner.
+func NewHandler(runner *Runner) *Handler {
+	return &Handler{runner: runner}
+}
+
+// UploadFile handles POST /v1/files for files with purpose "batch".
+func (h *Handler) UploadFile(c *gin.Context) {
+	if purpose := c.PostForm("purpose"); purpose != "batch" {
+		writeError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("unsupported purpose %q, only \"batch\" is supported", purpose))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "invalid_request_error", "file is required")
+		return
+	}
+	if header.Size > maxFileBytes {
+		writeError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("file exceeds the %d byte limit", maxFileBytes))
+		return
+	}
+	src, err := header.Open()
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	defer func() { _ = src.Close() }()
+	content, err := io.ReadAll(io.LimitReader(src, maxFileBytes+1))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if len(content) > maxFileBytes {
+		writeError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("file exceeds the %d byte limit", maxFileBytes))
+		return
+	}
+
+	file := usage.BatchFile{
+		ID:         NewFileID(),
+		Purpose:    "batch",
+		Filename:   header.Filename,
+		Bytes:      int64(len(content)),
+		CreatedAt:  time.Now().UTC(),
+		APIKeyHash: ownerHash(c),
+	}
+	if err = usage.CreateBatchFile(c.Request.Context(), file, content); err != nil {
+		writeStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, fileObject(file))
+}
+
+// GetFile handles GET /v1/files/:file_id.
+func (h *Handler) GetFile(c *gin.Context) {
+	file, ok := h.ownedFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, fileObject(file))
+}
+
+// GetFileContent handles GET /v1/files/:file_id/content.
+func (h *Handler) GetFileContent(c *gin.Context) {
+	file, ok := h.ownedFile(c)
+	if !ok {
+		return
+	}
+	content, err := usage.BatchFileContent(c.Request.Context(), file.ID)
+	if err != nil {
+		writeStoreError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Data(http.StatusOK, "application/jsonl", content)
+}
+
+type createBatchRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// CreateBatch handles POST /v1/batches. The input file is validated up front; a file
+// with invalid lines produces a failed batch listing the problems, as OpenAI does.
+func (h *Handler) CreateBatch(c *gin.Context) {
+	var body createBatchRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		writeError(c, http.StatusBadRequest, "invalid_request_error", "invalid body")
+		return
+	}
+	if !SupportedEndpoint(body.Endpoint) {
+		writeError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("unsupported endpoint %q, expected one of %s", body.Endpoint, strings.Join(SupportedEndpoints, ", ")))
+		return
+	}
+	if body.CompletionWindow != completionWindow {
+		writeError(c, http.StatusBadRequest, "invalid_request_error", "completion_window must be \"24h\"")
+		return
+	}
+	owner := ownerHash(c)
+	file, err := usage.GetBatchFile(c.Request.Context(), body.InputFileID)
+	if err != nil || file.APIKeyHash != owner || file.Purpose != "batch" {
+		if err != nil && !errors.Is(err, usage.ErrBatchNotFound) {
+			writeStoreError(c, err)
+			return
+		}
+		writeError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("no batch input file with id %q", body.InputFileID))
+		return
+	}
+	content, err := usage.BatchFileContent(c.Request.Context(), file.ID)
+	if err != nil {
+		writeStoreError(c, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	batch := usage.Batch{
+		ID:               NewBatchID(),
+		APIKeyHash:       owner,
+		Endpoint:         body.Endpoint,
+		InputFileID:      file.ID,
+		Status:           usage.BatchStatusValidating,
+		CompletionWindow: completionWindow,
+		Metadata:         body.Metadata,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(24 * time.Hour),
+	}
+	lines, problems := ParseInput(content, body.Endpoint)
+	if len(problems) > 0 {
+		batch.Status = usage.BatchStatusFailed
+		batch.FailedAt = &now
+		batch.Errors = problems
+		if err = usage.SaveBatch(c.Request.Context(), batch); err != nil {
+			writeStoreError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, batchObject(batch))
+		return
+	}
+
+	principal := Principal{
+		APIKey:         c.GetString("apiKey"),
+		AccessProvider: c.GetString("accessProvider"),
+		RemoteAddr:     c.Request.RemoteAddr,
+		UsageMetadata:  c.GetHeader(usage.MetadataHeader),
+	}
+	if batch, err = h.runner.Start(batch, principal, lines); err != nil {
+		writeStoreError(c, err)
+		return
+	}
+	log.Infof("batch %s: started %d requests to %s", batch.ID, len(lines), batch.Endpoint)
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+// GetBatch handles GET /v1/batches/:batch_id.
+func (h *Handler) GetBatch(c *gin.Context) {
+	batch, ok := h.ownedBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+// ListBatches handles GET /v1/batches with the limit and after cursor parameters.
+func (h *Handler) ListBatches(c *gin.Context) {
+	limit := 20
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			writeError(c, http.StatusBadRequest, "invalid_request_error", "limit must be between 1 and 100")
+			return
+		}
+		limit = parsed
+	}
+	// Fetch one extra row to report whether another page follows.
+	batches, err := usage.ListBatches(c.Request.Context(), ownerHash(c), c.Query("after"), limit+1)
+	if err != nil {
+		writeStoreError(c, err)
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]gin.H, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, batchObject(batch))
+	}
+	resp := gin.H{"object": "list", "data": data, "has_more": hasMore, "first_id": nil, "last_id": nil}
+	if len(batches) > 0 {
+		resp["first_id"] = batches[0].ID
+		resp["last_id"] = batches[len(batches)-1].ID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CancelBatch handles POST /v1/batches/:batch_id/cancel.
+func (h *Handler) CancelBatch(c *gin.Context) {
+	batch, ok := h.ownedBatch(c)
+	if !ok {
+		return
+	}
+	if batch.Terminal() {
+		writeError(c, http.StatusConflict, "invalid_request_error", fmt.Sprintf("batch is already %s", batch.Status))
+		return
+	}
+	cancelled, err := h.runner.Cancel(batch.ID)
+	if err != nil {
+		if errors.Is(err, ErrNotRunning) {
+			writeError(c, http.StatusConflict, "invalid_request_error", "batch is not running on this server")
+			return
+		}
+		writeStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, batchObject(cancelled))
+}
+
+func (h *Handler) ownedFile(c *gin.Context) (usage.BatchFile, bool) {
+	id := c.Param("file_id")
+	file, err := usage.GetBatchFile(c.Request.Context(), id)
+	if err == nil && file.APIKeyHash != ownerHash(c) {
+		err = usage.ErrBatchNotFound
+	}
+	if err != nil {
+		if errors.Is(err, usage.ErrBatchNotFound) {
+			writeError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("no file with id %q", id))
+		} else {
+			writeStoreError(c, err)
+		}
+		return usage.BatchFile{}, false
+	}
+	return file, true
+}
+
+func (h *Handler) ownedBatch(c *gin.Context) (usage.Batch, bool) {
+	id := c.Param("batch_id")
+	batch, err := usage.GetBatch(c.Request.Context(), id)
+	if err == nil && batch.APIKeyHash != ownerHash(c) {
+		err = usage.ErrBatchNotFound
+	}
+	if err != nil {
+		if errors.Is(err, usage.ErrBatchNotFound) {
+			writeError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("no batch with id %q", id))
+		} else {
+			writeStoreError(c, err)
+		}
+		return usage.Batch{}, false
+	}
+	return batch, true
+}
+
+// ownerHash identifies the client API key that owns files and batches.
+func ownerHash(c *gin.Context) string {
+	return usage.APIKeyHash(c.GetString("apiKey"))
+}
+
+func writeError(c *gin.Context, status int, errType, message string) {
+	c.JSON(status, handlers.ErrorResponse{Error: handlers.ErrorDetail{Message: message, Type: errType}})
+}
+
+func writeStoreError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usage.ErrDatabaseDisabled), errors.Is(err, usage.ErrReadOnly):
+		writeError(c, http.StatusServiceUnavailable, "server_error", "the batch API requires a writable usage-db")
+	case errors.Is(err, usage.ErrBatchNotFound):
+		writeError(c, http.StatusNotFound, "invalid_request_error", err.Error())
+	default:
+		log.WithError(err).Error("batch: store error")
+		writeError(c, http.StatusInternalServerError, "server_error", "internal server error")
+	}
+}
+
+func fileObject(file usage.BatchFile) gin.H {
+	return gin.H{
+		"id":         file.ID,
+		"object":     "file",
+		"bytes":      file.Bytes,
+		"created_at": file.CreatedAt.Unix(),
+		"filename":   file.Filename,
+		"purpose":    file.Purpose,
+	}
+}
+
+func batchObject(batch usage.Batch) gin.H {
+	var batchErrors any
+	if len(batch.Errors) > 0 {
+		batchErrors = gin.H{"object": "list", "data": batch.Errors}
+	}
+	return gin.H{
+		"id":                batch.ID,
+		"object":            "batch",
+		"endpoint":          batch.Endpoint,
+		"errors":            batchErrors,
+		"input_file_id":     batch.InputFileID,
+		"completion_window": batch.CompletionWindow,
+		"status":            batch.Status,
+		"output_file_id":    optionalString(batch.OutputFileID),
+		"error_file_id":     optionalString(batch.ErrorFileID),
+		"created_at":        batch.CreatedAt.Unix(),
+		"in_progress_at":    unixOrNil(batch.InProgressAt),
+		"expires_at":        batch.ExpiresAt.Unix(),
+		"finalizing_at":     unixOrNil(batch.FinalizingAt),
+		"completed_at":      unixOrNil(batch.CompletedAt),
+		"failed_at":         unixOrNil(batch.FailedAt),
+		"expired_at":        unixOrNil(batch.ExpiredAt),
+		"cancelling_at":     unixOrNil(batch.CancellingAt),
+		"cancelled_at":      unixOrNil(batch.CancelledAt),
+		"request_counts": gin.H{
+			"total":     batch.Total,
+			"completed": batch.Completed,
+			"failed":    batch.Failed,
+		},
+		"metadata": batch.Metadata,
+	}
+}
+
+func optionalString(v string) any {
+	if v == "" {
+		return nil
+	}
+	return v
+}
+
+func unixOrNil(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Unix()
+}
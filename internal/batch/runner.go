@@ -0,0 +1,304 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultConcurrency is the number of requests of one batch in flight at a time.
+	defaultConcurrency = 4
+	// progressInterval throttles how often request counts are written back.
+	progressInterval = time.Second
+)
+
+// ErrNotRunning is returned when cancelling a batch that has no active worker.
+var ErrNotRunning = errors.New("batch: job is not running")
+
+// Runner executes batch jobs in the background by dispatching each request to an
+// http.Handler, normally the server's own Gin engine.
+type Runner struct {
+	handler     atomic.Value
+	concurrency atomic.Int32
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// job is the in-memory state of a running batch; it owns all writes to its row.
+type job struct {
+	mu        sync.Mutex
+	batch     usage.Batch
+	cancel    context.CancelFunc
+	lastSaved time.Time
+}
+
+type lineResult struct {
+	done       bool
+	statusCode int
+	requestID  string
+	body       []byte
+}
+
+// NewRunner creates a runner that keeps up to concurrency requests of each batch in flight.
+func NewRunner(concurrency int) *Runner {
+	r := &Runner{jobs: make(map[string]*job)}
+	r.SetConcurrency(concurrency)
+	return r
+}
+
+// SetHandler configures the handler batch requests are dispatched to.
+func (r *Runner) SetHandler(handler http.Handler) {
+	if handler != nil {
+		r.handler.Store(handler)
+	}
+}
+
+// SetConcurrency updates the per-batch concurrency for batches started afterwards.
+func (r *Runner) SetConcurrency(concurrency int) {
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	r.concurrency.Store(int32(concurrency))
+}
+
+// Start persists batch as in progress and executes lines in the background on
+// behalf of principal. The batch expires at batch.ExpiresAt.
+func (r *Runner) Start(batch usage.Batch, principal Principal, lines []Line) (usage.Batch, error) {
+	handler, _ := r.handler.Load().(http.Handler)
+	if handler == nil {
+		return batch, errors.New("batch: runner has no handler")
+	}
+	now := time.Now().UTC()
+	batch.Status = usage.BatchStatusInProgress
+	batch.InProgressAt = &now
+	batch.Total = len(lines)
+	if err := usage.SaveBatch(context.Background(), batch); err != nil {
+		return batch, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{batch: batch, cancel: cancel, lastSaved: now}
+	r.mu.Lock()
+	r.jobs[batch.ID] = j
+	r.mu.Unlock()
+
+	concurrency := int(r.concurrency.Load())
+	go func() {
+		defer cancel()
+		defer func() {
+			r.mu.Lock()
+			delete(r.jobs, batch.ID)
+			r.mu.Unlock()
+		}()
+		runCtx, cancelDeadline := context.WithDeadline(ctx, batch.ExpiresAt)
+		defer cancelDeadline()
+		results := r.dispatchAll(runCtx, handler, j, principal, lines, concurrency)
+		r.finish(runCtx, j, lines, results)
+	}()
+	return batch, nil
+}
+
+// Cancel stops a running batch. Requests already in flight are abandoned and the
+// batch finalises as cancelled with the results gathered so far.
+func (r *Runner) Cancel(id string) (usage.Batch, error) {
+	r.mu.Lock()
+	j := r.jobs[id]
+	r.mu.Unlock()
+	if j == nil {
+		return usage.Batch{}, ErrNotRunning
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.batch.Status == usage.BatchStatusInProgress {
+		now := time.Now().UTC()
+		j.batch.Status = usage.BatchStatusCancelling
+		j.batch.CancellingAt = &now
+		if err := usage.SaveBatch(context.Background(), j.batch); err != nil {
+			return j.batch, err
+		}
+		j.cancel()
+	}
+	return j.batch, nil
+}
+
+func (r *Runner) dispatchAll(ctx context.Context, handler http.Handler, j *job, principal Principal, lines []Line, concurrency int) []lineResult {
+	results := make([]lineResult, len(lines))
+	batchID := j.batch.ID
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range lines {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = dispatch(ctx, handler, batchID, principal, lines[i])
+			if results[i].done {
+				j.recordResult(results[i].statusCode)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// dispatch sends one batched request through handler. The result is not done when
+// the batch was cancelled or expired before the request finished.
+func dispatch(ctx context.Context, handler http.Handler, batchID string, principal Principal, line Line) lineResult {
+	requestID := "batch_req_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	req, err := http.NewRequestWithContext(WithPrincipal(ctx, principal), line.Method, line.URL, bytes.NewReader(line.Body))
+	if err != nil {
+		body, _ := json.Marshal(map[string]any{"error": map[string]string{"message": err.Error(), "type": "invalid_request_error"}})
+		return lineResult{done: true, statusCode: http.StatusBadRequest, requestID: requestID, body: body}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(tracing.RequestIDHeader, requestID)
+	if principal.UsageMetadata != "" {
+		req.Header.Set(usage.MetadataHeader, principal.UsageMetadata)
+	}
+	req.RemoteAddr = principal.RemoteAddr
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if ctx.Err() != nil {
+		return lineResult{}
+	}
+	log.Debugf("batch %s: request %s finished with status %d", batchID, line.CustomID, recorder.Code)
+	return lineResult{done: true, statusCode: recorder.Code, requestID: requestID, body: recorder.Body.Bytes()}
+}
+
+// recordResult counts a finished request and periodically persists the counts.
+func (j *job) recordResult(statusCode int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if statusCode >= 200 && statusCode < 300 {
+		j.batch.Completed++
+	} else {
+		j.batch.Failed++
+	}
+	if now := time.Now(); now.Sub(j.lastSaved) >= progressInterval {
+		j.lastSaved = now
+		if err := usage.SaveBatch(context.Background(), j.batch); err != nil {
+			log.WithError(err).Warnf("batch %s: failed to save progress", j.batch.ID)
+		}
+	}
+}
+
+// finish writes the output and error files and moves the batch to its final status.
+func (r *Runner) finish(ctx context.Context, j *job, lines []Line, results []lineResult) {
+	expired := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	cancelled := !expired && ctx.Err() != nil
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	j.batch.FinalizingAt = &now
+	if !cancelled {
+		j.batch.Status = usage.BatchStatusFinalizing
+	}
+	if err := usage.SaveBatch(context.Background(), j.batch); err != nil {
+		log.WithError(err).Warnf("batch %s: failed to save progress", j.batch.ID)
+	}
+
+	var output, failures bytes.Buffer
+	encoder := func(buf *bytes.Buffer, line outputLine) {
+		data, _ := json.Marshal(line)
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	for i, result := range results {
+		entry := outputLine{ID: result.requestID, CustomID: lines[i].CustomID}
+		switch {
+		case result.done:
+			entry.Response = &outputResponse{StatusCode: result.statusCode, RequestID: result.requestID, Body: responseBody(result.body)}
+			if result.statusCode >= 200 && result.statusCode < 300 {
+				encoder(&output, entry)
+			} else {
+				encoder(&failures, entry)
+			}
+		case expired:
+			entry.ID = "batch_req_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+			entry.Error = &usage.BatchError{Code: "batch_expired", Message: "This request could not be executed before the completion window expired."}
+			encoder(&failures, entry)
+		}
+	}
+
+	var errs []error
+	if output.Len() > 0 {
+		id, err := storeResultFile(j.batch, "output", output.Bytes())
+		j.batch.OutputFileID = id
+		errs = append(errs, err)
+	}
+	if failures.Len() > 0 {
+		id, err := storeResultFile(j.batch, "error", failures.Bytes())
+		j.batch.ErrorFileID = id
+		errs = append(errs, err)
+	}
+
+	done := time.Now().UTC()
+	switch err := errors.Join(errs...); {
+	case err != nil:
+		log.WithError(err).Errorf("batch %s: failed to store results", j.batch.ID)
+		j.batch.Status = usage.BatchStatusFailed
+		j.batch.FailedAt = &done
+		j.batch.Errors = append(j.batch.Errors, usage.BatchError{Code: "output_failed", Message: "failed to store batch results"})
+	case expired:
+		j.batch.Status = usage.BatchStatusExpired
+		j.batch.ExpiredAt = &done
+	case cancelled:
+		j.batch.Status = usage.BatchStatusCancelled
+		j.batch.CancelledAt = &done
+	default:
+		j.batch.Status = usage.BatchStatusCompleted
+		j.batch.CompletedAt = &done
+	}
+	if err := usage.SaveBatch(context.Background(), j.batch); err != nil {
+		log.WithError(err).Errorf("batch %s: failed to save final status", j.batch.ID)
+	}
+}
+
+// storeResultFile saves a batch output or error file and returns its ID. On failure
+// the ID is empty so the batch never points at a missing file.
+func storeResultFile(batch usage.Batch, kind string, content []byte) (string, error) {
+	file := usage.BatchFile{
+		ID:         NewFileID(),
+		Purpose:    "batch_output",
+		Filename:   batch.ID + "_" + kind + ".jsonl",
+		CreatedAt:  time.Now().UTC(),
+		APIKeyHash: batch.APIKeyHash,
+	}
+	if err := usage.CreateBatchFile(context.Background(), file, content); err != nil {
+		return "", err
+	}
+	return file.ID, nil
+}
+
+// NewFileID returns an identifier for a batch file.
+func NewFileID() string {
+	return "file-" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// NewBatchID returns an identifier for a batch job.
+func NewBatchID() string {
+	return "batch_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
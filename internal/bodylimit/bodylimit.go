@@ -0,0 +1,201 @@
+// Package bodylimit resolves the request body and inline media size limits configured
+// for client API routes and client keys. The active limits are swapped atomically on config reload.
+package bodylimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// RejectionTooLarge marks requests rejected because their body exceeded the limit.
+const RejectionTooLarge = "request_too_large"
+
+// RejectionMediaTooLarge marks requests rejected because their inline media exceeded
+// the media limits.
+const RejectionMediaTooLarge = "media_too_large"
+
+// Limits evaluates a compiled request-size-limits configuration.
+type Limits struct {
+	defaultLimit int64
+	// routes are sorted by descending prefix length so the first match is the longest.
+	routes []route
+	byKey  map[string]int64
+	media  MediaLimits
+	// mediaByKey holds the media limits of keys that override the defaults.
+	mediaByKey map[string]MediaLimits
+}
+
+// MediaLimits caps the decoded size of the inline media of a request. Zero means
+// unlimited.
+type MediaLimits struct {
+	// Item is the limit of each image or document.
+	Item int64
+	// Request is the limit of all media of one request.
+	Request int64
+}
+
+type route struct {
+	prefix string
+	limit  int64
+}
+
+var active atomic.Pointer[Limits]
+
+// Compile builds limits from configuration, skipping entries without a path or key.
+func Compile(cfg config.RequestSizeLimitsConfig) *Limits {
+	l := &Limits{
+		defaultLimit: max(cfg.MaxBodyBytes, 0),
+		media:        MediaLimits{Item: max(cfg.MaxMediaBytes, 0), Request: max(cfg.MaxRequestMediaBytes, 0)},
+	}
+	for _, r := range cfg.Routes {
+		prefix := strings.TrimSpace(r.Path)
+		if prefix == "" {
+			continue
+		}
+		l.routes = append(l.routes, route{prefix: prefix, limit: max(r.MaxBodyBytes, 0)})
+	}
+	sort.SliceStable(l.routes, func(i, j int) bool { return len(l.routes[i].prefix) > len(l.routes[j].prefix) })
+	for _, rule := range cfg.APIKeys {
+		key := strings.TrimSpace(rule.APIKey)
+		if key == "" {
+			continue
+		}
+		if rule.MaxMediaBytes > 0 || rule.MaxRequestMediaBytes > 0 {
+			if l.mediaByKey == nil {
+				l.mediaByKey = make(map[string]MediaLimits)
+			}
+			media := l.media
+			if rule.MaxMediaBytes > 0 {
+				media.Item = rule.MaxMediaBytes
+			}
+			if rule.MaxRequestMediaBytes > 0 {
+				media.Request = rule.MaxRequestMediaBytes
+			}
+			l.mediaByKey[key] = media
+		}
+		if rule.MaxBodyBytes <= 0 {
+			continue
+		}
+		if l.byKey == nil {
+			l.byKey = make(map[string]int64)
+		}
+		l.byKey[key] = rule.MaxBodyBytes
+	}
+	return l
+}
+
+// Set replaces the active limits.
+func Set(cfg config.RequestSizeLimitsConfig) {
+	next := Compile(cfg)
+	if !next.enabled() {
+		active.Store(nil)
+		return
+	}
+	active.Store(next)
+}
+
+// Active returns the active limits or nil when no limit is configured.
+func Active() *Limits {
+	return active.Load()
+}
+
+func (l *Limits) enabled() bool {
+	if l == nil {
+		return false
+	}
+	if l.defaultLimit > 0 || len(l.byKey) > 0 || l.media != (MediaLimits{}) || len(l.mediaByKey) > 0 {
+		return true
+	}
+	for _, r := range l.routes {
+		if r.limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ForRoute returns the limit for a request path, or 0 when it is unlimited.
+func (l *Limits) ForRoute(path string) int64 {
+	if l == nil {
+		return 0
+	}
+	for _, r := range l.routes {
+		if strings.HasPrefix(path, r.prefix) {
+			return r.limit
+		}
+	}
+	return l.defaultLimit
+}
+
+// ForKey returns the limit that applies once the client key is known: the key's own
+// limit when it is tighter than routeLimit, otherwise routeLimit.
+func (l *Limits) ForKey(apiKey string, routeLimit int64) int64 {
+	if l == nil {
+		return routeLimit
+	}
+	keyLimit, ok := l.byKey[apiKey]
+	if !ok || (routeLimit > 0 && routeLimit <= keyLimit) {
+		return routeLimit
+	}
+	return keyLimit
+}
+
+// ForMedia returns the media limits of a client key: its own limits when it has any,
+// otherwise the defaults.
+func (l *Limits) ForMedia(apiKey string) MediaLimits {
+	if l == nil {
+		return MediaLimits{}
+	}
+	if media, ok := l.mediaByKey[apiKey]; ok {
+		return media
+	}
+	return l.media
+}
+
+// CheckMedia returns an *MediaTooLargeError when largest (the biggest media item) or
+// total (all media of the request) exceeds the limits.
+func (m MediaLimits) CheckMedia(largest, total int64) error {
+	if m.Item > 0 && largest > m.Item {
+		return &MediaTooLargeError{Size: largest, Limit: m.Item}
+	}
+	if m.Request > 0 && total > m.Request {
+		return &MediaTooLargeError{Size: total, Limit: m.Request, Request: true}
+	}
+	return nil
+}
+
+// MediaTooLargeError reports a request refused because of its inline media size.
+type MediaTooLargeError struct {
+	Size  int64
+	Limit int64
+	// Request is set when the request total, rather than a single item, is too large.
+	Request bool
+}
+
+// Error renders an OpenAI-style JSON error body so handlers forward it verbatim.
+func (e *MediaTooLargeError) Error() string {
+	message := fmt.Sprintf("media input of %d bytes exceeds the %d byte limit per item", e.Size, e.Limit)
+	if e.Request {
+		message = fmt.Sprintf("media inputs of %d bytes exceed the %d byte limit per request", e.Size, e.Limit)
+	}
+	payload, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"code":    RejectionMediaTooLarge,
+			"type":    "invalid_request_error",
+			"message": message,
+		},
+	})
+	if err != nil {
+		return message
+	}
+	return string(payload)
+}
+
+// StatusCode implements the status accessor used by handlers.
+func (e *MediaTooLargeError) StatusCode() int { return http.StatusRequestEntityTooLarge }
@@ -0,0 +1,93 @@
+package bodylimit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestForRouteAndKey(t *testing.T) {
+	l := Compile(config.RequestSizeLimitsConfig{
+		MaxBodyBytes: 1000,
+		Routes: []config.RequestSizeRoute{
+			{Path: "/v1", MaxBodyBytes: 500},
+			{Path: "/v1/embeddings", MaxBodyBytes: 100},
+			{Path: "/v1beta", MaxBodyBytes: 0},
+		},
+		APIKeys: []config.RequestSizeKeyRule{{APIKey: "small", MaxBodyBytes: 50}, {APIKey: "large", MaxBodyBytes: 5000}},
+	})
+	routes := map[string]int64{
+		"/v1/chat/completions": 500,
+		"/v1/embeddings":       100,
+		"/v1beta/models/x":     0,
+		"/api/provider/openai": 1000,
+	}
+	for path, want := range routes {
+		if got := l.ForRoute(path); got != want {
+			t.Errorf("ForRoute(%q) = %d, want %d", path, got, want)
+		}
+	}
+	keys := []struct {
+		key        string
+		route, out int64
+	}{
+		{"small", 500, 50},
+		{"small", 0, 50},
+		{"large", 500, 500},
+		{"large", 0, 5000},
+		{"other", 500, 500},
+	}
+	for _, tc := range keys {
+		if got := l.ForKey(tc.key, tc.route); got != tc.out {
+			t.Errorf("ForKey(%q, %d) = %d, want %d", tc.key, tc.route, got, tc.out)
+		}
+	}
+}
+
+func TestSetDisablesEmptyConfig(t *testing.T) {
+	t.Cleanup(func() { Set(config.RequestSizeLimitsConfig{}) })
+	Set(config.RequestSizeLimitsConfig{Routes: []config.RequestSizeRoute{{Path: "/v1", MaxBodyBytes: 0}}})
+	if Active() != nil {
+		t.Fatalf("limits without a positive value must be inactive")
+	}
+	Set(config.RequestSizeLimitsConfig{MaxBodyBytes: 10})
+	if Active() == nil || Active().ForRoute("/v1/chat/completions") != 10 {
+		t.Fatalf("expected active default limit")
+	}
+}
+
+func TestForMedia(t *testing.T) {
+	l := Compile(config.RequestSizeLimitsConfig{
+		MaxMediaBytes:        100,
+		MaxRequestMediaBytes: 250,
+		APIKeys: []config.RequestSizeKeyRule{
+			{APIKey: "vision", MaxMediaBytes: 1000},
+			{APIKey: "body-only", MaxBodyBytes: 50},
+		},
+	})
+	if got := l.ForMedia("other"); got != (MediaLimits{Item: 100, Request: 250}) {
+		t.Fatalf("default media limits = %+v", got)
+	}
+	if got := l.ForMedia("body-only"); got != (MediaLimits{Item: 100, Request: 250}) {
+		t.Fatalf("key without media limits must use the defaults, got %+v", got)
+	}
+	vision := l.ForMedia("vision")
+	if vision != (MediaLimits{Item: 1000, Request: 250}) {
+		t.Fatalf("key media limits = %+v", vision)
+	}
+	if err := vision.CheckMedia(500, 200); err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+	err := vision.CheckMedia(200, 300)
+	var tooLarge *MediaTooLargeError
+	if !errors.As(err, &tooLarge) || !tooLarge.Request || tooLarge.Limit != 250 {
+		t.Fatalf("expected request total rejection, got %v", err)
+	}
+	if err := l.ForMedia("other").CheckMedia(101, 101); err == nil {
+		t.Fatalf("expected item rejection")
+	}
+	if err := (*Limits)(nil).ForMedia("other").CheckMedia(1<<30, 1<<30); err != nil {
+		t.Fatalf("nil limits must not reject: %v", err)
+	}
+}
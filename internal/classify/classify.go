@@ -0,0 +1,208 @@
+// Package classify tags incoming requests using configurable rules evaluated at
+// ingestion. Tags are propagated through the Gin context so they can be recorded
+// in usage statistics and scope model rewrite rules.
+package classify
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// GinTagsKey stores the request tags in the Gin context.
+const GinTagsKey = "requestTags"
+
+// MetadataKey is the executor metadata key carrying request tags.
+const MetadataKey = "request_tags"
+
+const (
+	matchPrompt = "prompt"
+	matchModel  = "model"
+	matchPath   = "path"
+	matchHeader = "header"
+)
+
+// Input holds the request attributes evaluated by classification rules.
+type Input struct {
+	Prompt  string
+	Model   string
+	Path    string
+	Headers http.Header
+}
+
+type rule struct {
+	tag     string
+	match   string
+	header  string
+	pattern *regexp.Regexp
+}
+
+// Classifier evaluates a compiled rule set.
+type Classifier struct {
+	rules []rule
+}
+
+var active atomic.Pointer[Classifier]
+
+// Compile builds a classifier from configuration, skipping invalid rules.
+func Compile(rules []config.ClassificationRule) *Classifier {
+	out := &Classifier{rules: make([]rule, 0, len(rules))}
+	for i := range rules {
+		r := rules[i]
+		tag := strings.TrimSpace(r.Tag)
+		if tag == "" || strings.TrimSpace(r.Pattern) == "" {
+			continue
+		}
+		match := strings.ToLower(strings.TrimSpace(r.Match))
+		if match == "" {
+			match = matchPrompt
+		}
+		switch match {
+		case matchPrompt, matchModel, matchPath, matchHeader:
+		default:
+			log.Warnf("classify: rule %q has unsupported match %q, skipping", tag, r.Match)
+			continue
+		}
+		if match == matchHeader && strings.TrimSpace(r.Header) == "" {
+			log.Warnf("classify: rule %q matches header but names none, skipping", tag)
+			continue
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			log.Warnf("classify: rule %q has invalid pattern: %v", tag, err)
+			continue
+		}
+		out.rules = append(out.rules, rule{
+			tag:     tag,
+			match:   match,
+			header:  strings.TrimSpace(r.Header),
+			pattern: re,
+		})
+	}
+	return out
+}
+
+// SetRules replaces the active rule set.
+func SetRules(rules []config.ClassificationRule) {
+	if len(rules) == 0 {
+		active.Store(nil)
+		return
+	}
+	active.Store(Compile(rules))
+}
+
+// Active returns the active classifier or nil when no rules are configured.
+func Active() *Classifier {
+	c := active.Load()
+	if c == nil || len(c.rules) == 0 {
+		return nil
+	}
+	return c
+}
+
+// NeedsPrompt reports whether any rule inspects prompt text.
+func (c *Classifier) NeedsPrompt() bool {
+	if c == nil {
+		return false
+	}
+	for i := range c.rules {
+		if c.rules[i].match == matchPrompt {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify returns the de-duplicated tags of all matching rules in rule order.
+func (c *Classifier) Classify(in Input) []string {
+	if c == nil {
+		return nil
+	}
+	var tags []string
+	seen := make(map[string]struct{})
+	for i := range c.rules {
+		r := c.rules[i]
+		if _, ok := seen[r.tag]; ok {
+			continue
+		}
+		var value string
+		switch r.match {
+		case matchPrompt:
+			value = in.Prompt
+		case matchModel:
+			value = in.Model
+		case matchPath:
+			value = in.Path
+		case matchHeader:
+			value = in.Headers.Get(r.header)
+		}
+		if value == "" || !r.pattern.MatchString(value) {
+			continue
+		}
+		seen[r.tag] = struct{}{}
+		tags = append(tags, r.tag)
+	}
+	return tags
+}
+
+// PromptText concatenates the string leaves of a JSON request body so rules can
+// match conversational content regardless of the client dialect.
+func PromptText(body []byte) string {
+	if len(body) == 0 || !gjson.ValidBytes(body) {
+		return ""
+	}
+	var b strings.Builder
+	var walk func(gjson.Result)
+	walk = func(v gjson.Result) {
+		switch {
+		case v.IsObject() || v.IsArray():
+			v.ForEach(func(_, item gjson.Result) bool {
+				walk(item)
+				return true
+			})
+		case v.Type == gjson.String:
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(v.Str)
+		}
+	}
+	for _, field := range []string{"system", "messages", "input", "instructions", "prompt", "contents", "systemInstruction", "request.contents", "request.systemInstruction"} {
+		if v := gjson.GetBytes(body, field); v.Exists() {
+			walk(v)
+		}
+	}
+	return b.String()
+}
+
+// TagsFromGin returns the tags attached to the Gin context.
+func TagsFromGin(c *gin.Context) []string {
+	if c == nil {
+		return nil
+	}
+	v, ok := c.Get(GinTagsKey)
+	if !ok {
+		return nil
+	}
+	tags, _ := v.([]string)
+	return tags
+}
+
+// TagsFromContext returns the tags attached to the Gin context embedded in ctx.
+func TagsFromContext(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok {
+		return nil
+	}
+	return TagsFromGin(ginCtx)
+}
@@ -0,0 +1,42 @@
+package classify
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestClassifierTagsMatchingRules(t *testing.T) {
+	c := Compile([]config.ClassificationRule{
+		{Tag: "code", Pattern: `(?i)\bfunc\b|stack trace`},
+		{Tag: "support", Pattern: `(?i)refund`},
+		{Tag: "experiment", Match: "header", Header: "X-Experiment", Pattern: `.+`},
+		{Tag: "claude", Match: "model", Pattern: `^claude-`},
+		{Tag: "broken", Pattern: `(`},
+		{Tag: "code", Match: "path", Pattern: `.*`},
+	})
+
+	body := []byte(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":[{"type":"text","text":"Here is a stack trace"}]}]}`)
+	headers := http.Header{}
+	headers.Set("X-Experiment", "variant-b")
+
+	got := c.Classify(Input{
+		Prompt:  PromptText(body),
+		Model:   "claude-sonnet-4",
+		Path:    "/v1/messages",
+		Headers: headers,
+	})
+	want := []string{"code", "experiment", "claude"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Classify() = %v, want %v", got, want)
+	}
+}
+
+func TestPromptTextIgnoresNonPromptFields(t *testing.T) {
+	body := []byte(`{"model":"gpt-5","metadata":{"note":"refund"},"input":"hello"}`)
+	if got := PromptText(body); got != "hello" {
+		t.Fatalf("PromptText() = %q, want %q", got, "hello")
+	}
+}
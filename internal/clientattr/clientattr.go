@@ -0,0 +1,186 @@
+// Package clientattr resolves who sent a client API request: the client IP behind
+// trusted reverse proxies, its user agent and, with a GeoIP database, its country.
+// The active resolver is swapped atomically on config reload.
+package clientattr
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// GinKey is the Gin context key holding the resolved Info of a request.
+const GinKey = "clientAttribution"
+
+// maxUserAgentLen caps stored user agents; longer values are truncated.
+const maxUserAgentLen = 256
+
+// Info describes the client behind a request.
+type Info struct {
+	IP        netip.Addr
+	UserAgent string
+	// Country is the ISO 3166 country code of IP, empty without a GeoIP database.
+	Country string
+}
+
+// Resolver evaluates a compiled client-attribution configuration.
+type Resolver struct {
+	trusted []netip.Prefix
+	header  string
+	geo     *geoDB
+}
+
+var active atomic.Pointer[Resolver]
+
+// proxies resolves client IPs for source IP controls. Unlike active it is kept while
+// client attribution is disabled, so trusted-proxies always applies.
+var proxies atomic.Pointer[Resolver]
+
+// Compile builds a resolver from configuration, skipping invalid proxy networks. A
+// GeoIP database that cannot be loaded disables country lookups.
+func Compile(cfg config.ClientAttributionConfig) *Resolver {
+	r := compileProxies(cfg)
+	if path := strings.TrimSpace(cfg.GeoIPDatabase); path != "" {
+		geo, err := loadGeoDB(path)
+		if err != nil {
+			log.WithError(err).Warn("client-attribution: GeoIP database unavailable, countries will not be recorded")
+		}
+		r.geo = geo
+	}
+	return r
+}
+
+// compileProxies builds a resolver of client IPs without country lookups.
+func compileProxies(cfg config.ClientAttributionConfig) *Resolver {
+	r := &Resolver{header: strings.TrimSpace(cfg.ClientIPHeader)}
+	if r.header == "" {
+		r.header = "X-Forwarded-For"
+	}
+	for _, raw := range cfg.TrustedProxies {
+		raw = strings.TrimSpace(raw)
+		if prefix, err := netip.ParsePrefix(raw); err == nil {
+			r.trusted = append(r.trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(raw)
+		if err != nil {
+			log.Warnf("client-attribution.trusted-proxies: skipping invalid network %q", raw)
+			continue
+		}
+		addr = addr.Unmap()
+		r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return r
+}
+
+// Set replaces the active resolver; a disabled configuration turns attribution off
+// but keeps its trusted proxies for ClientIP.
+func Set(cfg config.ClientAttributionConfig) {
+	proxies.Store(compileProxies(cfg))
+	if !cfg.Enabled {
+		active.Store(nil)
+		return
+	}
+	active.Store(Compile(cfg))
+}
+
+// Active returns the active resolver or nil when client attribution is off.
+func Active() *Resolver {
+	return active.Load()
+}
+
+// ClientIP returns the client address of req for access control: the TCP peer, or the
+// right-most untrusted forwarded address when the peer is a configured trusted proxy.
+// Forwarding headers from other peers are ignored, so clients cannot pick their IP.
+func ClientIP(req *http.Request) netip.Addr {
+	if r := proxies.Load(); r != nil {
+		return r.clientIP(req)
+	}
+	return parseHostAddr(req.RemoteAddr)
+}
+
+// Resolve returns the client behind req.
+func (r *Resolver) Resolve(req *http.Request) Info {
+	info := Info{UserAgent: req.UserAgent()}
+	if len(info.UserAgent) > maxUserAgentLen {
+		info.UserAgent = info.UserAgent[:maxUserAgentLen]
+	}
+	info.IP = r.clientIP(req)
+	if r.geo != nil && info.IP.IsValid() {
+		info.Country = r.geo.lookup(info.IP)
+	}
+	return info
+}
+
+// clientIP returns the TCP peer, or, when the peer is a trusted proxy, the right-most
+// address in the forwarding header that was not added by a trusted proxy.
+func (r *Resolver) clientIP(req *http.Request) netip.Addr {
+	client := parseHostAddr(req.RemoteAddr)
+	if !client.IsValid() || !r.isTrusted(client) {
+		return client
+	}
+	var hops []string
+	for _, value := range req.Header.Values(r.header) {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr := parseHostAddr(strings.TrimSpace(hops[i]))
+		if !addr.IsValid() {
+			break
+		}
+		client = addr
+		if !r.isTrusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range r.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHostAddr parses an address that may carry a port ("ip:port", "[ipv6]:port").
+func parseHostAddr(value string) netip.Addr {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap()
+	}
+	host, _, err := net.SplitHostPort(value)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// FromContext returns the client Info stored in the Gin context embedded in ctx.
+func FromContext(ctx context.Context) (Info, bool) {
+	if ctx == nil {
+		return Info{}, false
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil {
+		return Info{}, false
+	}
+	v, ok := ginCtx.Get(GinKey)
+	if !ok {
+		return Info{}, false
+	}
+	info, ok := v.(Info)
+	return info, ok
+}
@@ -0,0 +1,93 @@
+package clientattr
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	r := Compile(config.ClientAttributionConfig{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}})
+	cases := []struct {
+		name   string
+		remote string
+		header []string
+		want   string
+	}{
+		{name: "direct peer", remote: "198.51.100.7:5000", want: "198.51.100.7"},
+		{name: "untrusted peer ignores header", remote: "198.51.100.7:5000", header: []string{"203.0.113.9"}, want: "198.51.100.7"},
+		{name: "trusted peer", remote: "10.1.2.3:443", header: []string{"203.0.113.9"}, want: "203.0.113.9"},
+		{name: "spoofed left-most hop", remote: "10.1.2.3:443", header: []string{"1.1.1.1, 203.0.113.9, 192.0.2.1"}, want: "203.0.113.9"},
+		{name: "repeated headers", remote: "10.1.2.3:443", header: []string{"1.1.1.1", "203.0.113.9"}, want: "203.0.113.9"},
+		{name: "all hops trusted", remote: "10.1.2.3:443", header: []string{"10.9.9.9"}, want: "10.9.9.9"},
+		{name: "garbage hop stops the walk", remote: "10.1.2.3:443", header: []string{"203.0.113.9, unknown"}, want: "10.1.2.3"},
+		{name: "ipv6 peer", remote: "[2001:db8::1]:8080", want: "2001:db8::1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+			req.RemoteAddr = tc.remote
+			for _, v := range tc.header {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := r.Resolve(req).IP; got != netip.MustParseAddr(tc.want) {
+				t.Fatalf("client IP = %v, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveUserAgentAndCountry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.csv")
+	data := "start,end,country\n198.51.100.0,198.51.100.255,de\n203.0.113.0,203.0.113.127,US\n2001:db8::,2001:db8::ffff,NL\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r := Compile(config.ClientAttributionConfig{GeoIPDatabase: path})
+	for addr, want := range map[string]string{
+		"198.51.100.7":  "DE",
+		"203.0.113.9":   "US",
+		"203.0.113.200": "",
+		"2001:db8::42":  "NL",
+		"192.0.2.1":     "",
+	} {
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		req.RemoteAddr = addr + ":1234"
+		if strings.Contains(addr, ":") {
+			req.RemoteAddr = "[" + addr + "]:1234"
+		}
+		if got := r.Resolve(req).Country; got != want {
+			t.Errorf("country of %s = %q, want %q", addr, got, want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set("User-Agent", strings.Repeat("a", maxUserAgentLen+10))
+	if got := r.Resolve(req).UserAgent; len(got) != maxUserAgentLen {
+		t.Fatalf("user agent not truncated: %d bytes", len(got))
+	}
+}
+
+func TestClientIPHonorsTrustedProxiesWhileDisabled(t *testing.T) {
+	t.Cleanup(func() { Set(config.ClientAttributionConfig{}) })
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	req.RemoteAddr = "10.1.2.3:443"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+
+	Set(config.ClientAttributionConfig{})
+	if got := ClientIP(req); got != netip.MustParseAddr("10.1.2.3") {
+		t.Fatalf("without trusted proxies the peer must be used, got %v", got)
+	}
+	Set(config.ClientAttributionConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	if Active() != nil {
+		t.Fatal("attribution should stay disabled")
+	}
+	if got := ClientIP(req); got != netip.MustParseAddr("203.0.113.9") {
+		t.Fatalf("trusted proxy header ignored, got %v", got)
+	}
+}
@@ -0,0 +1,101 @@
+package clientattr
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// geoDB maps IP ranges to country codes.
+type geoDB struct {
+	ranges []geoRange
+}
+
+type geoRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+// geoCache keeps the last loaded database so config reloads that leave the file
+// untouched do not parse it again.
+var geoCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	db      *geoDB
+}
+
+// loadGeoDB reads a CSV of "start-ip,end-ip,country" rows. Extra columns are ignored
+// and rows that do not parse (such as a header) are skipped.
+func loadGeoDB(path string) (*geoDB, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	geoCache.mu.Lock()
+	defer geoCache.mu.Unlock()
+	if geoCache.db != nil && geoCache.path == path && geoCache.modTime.Equal(st.ModTime()) && geoCache.size == st.Size() {
+		return geoCache.db, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	db, err := parseGeoCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	geoCache.path, geoCache.modTime, geoCache.size, geoCache.db = path, st.ModTime(), st.Size(), db
+	return db, nil
+}
+
+func parseGeoCSV(r io.Reader) (*geoDB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	db := &geoDB{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			continue
+		}
+		start, errStart := netip.ParseAddr(strings.TrimSpace(record[0]))
+		end, errEnd := netip.ParseAddr(strings.TrimSpace(record[1]))
+		country := strings.ToUpper(strings.TrimSpace(record[2]))
+		if errStart != nil || errEnd != nil || country == "" || start.Is4() != end.Is4() || end.Less(start) {
+			continue
+		}
+		db.ranges = append(db.ranges, geoRange{start: start.Unmap(), end: end.Unmap(), country: country})
+	}
+	if len(db.ranges) == 0 {
+		return nil, errors.New("no IP ranges found")
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].start.Less(db.ranges[j].start) })
+	return db, nil
+}
+
+// lookup returns the country of addr, or "" when no range contains it.
+func (db *geoDB) lookup(addr netip.Addr) string {
+	// Find the last range starting at or before addr.
+	i := sort.Search(len(db.ranges), func(i int) bool { return addr.Less(db.ranges[i].start) }) - 1
+	if i < 0 || db.ranges[i].end.Less(addr) {
+		return ""
+	}
+	return db.ranges[i].country
+}
@@ -0,0 +1,178 @@
+// Package clientusage serves GET /v1/usage, which lets a client API key read its own
+// daily request and token totals from the usage database without management access.
+// Usage is always scoped to the calling key through its api_key_hash.
+package clientusage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/api/handlers"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultDays is the window returned when start_time is omitted, including today.
+	defaultDays = 7
+	// maxDays caps the window of one request.
+	maxDays = 90
+)
+
+// Totals are the summed usage of one day, one model or the whole window.
+type Totals struct {
+	Requests        int64   `json:"requests"`
+	FailedRequests  int64   `json:"failed_requests"`
+	InputTokens     int64   `json:"input_tokens"`
+	OutputTokens    int64   `json:"output_tokens"`
+	ReasoningTokens int64   `json:"reasoning_tokens"`
+	CachedTokens    int64   `json:"cached_tokens"`
+	TotalTokens     int64   `json:"total_tokens"`
+	CostUSD         float64 `json:"cost_usd"`
+}
+
+// ModelTotals is the usage of one model within a day.
+type ModelTotals struct {
+	Object string `json:"object"`
+	Model  string `json:"model"`
+	Totals
+}
+
+// Bucket is the usage of one UTC day.
+type Bucket struct {
+	Object    string        `json:"object"`
+	Date      string        `json:"date"`
+	StartTime int64         `json:"start_time"`
+	EndTime   int64         `json:"end_time"`
+	Results   []ModelTotals `json:"results"`
+	Totals
+}
+
+// GetUsage handles GET /v1/usage. The optional start_time and end_time parameters are
+// Unix seconds; the window defaults to the last seven UTC days and is returned as one
+// bucket per day, including days without requests.
+func GetUsage(c *gin.Context) {
+	apiKeyHash := usage.APIKeyHash(c.GetString("apiKey"))
+	if apiKeyHash == "" {
+		writeError(c, http.StatusForbidden, "permission_error", "usage is only available to requests authenticated with an API key")
+		return
+	}
+	now := time.Now().UTC()
+	start, end, err := parseWindow(c.Query("start_time"), c.Query("end_time"), now)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	rows, err := usage.QueryKeyDailyUsage(c.Request.Context(), apiKeyHash, start, end)
+	if err != nil {
+		if errors.Is(err, usage.ErrDatabaseDisabled) {
+			writeError(c, http.StatusServiceUnavailable, "server_error", "the usage API requires usage-db")
+			return
+		}
+		log.WithError(err).Error("client usage: query failed")
+		writeError(c, http.StatusInternalServerError, "server_error", "internal server error")
+		return
+	}
+	buckets, totals := buildBuckets(rows, start, end)
+	c.JSON(http.StatusOK, gin.H{
+		"object":     "page",
+		"start_time": start.Unix(),
+		"end_time":   end.Unix(),
+		"data":       buckets,
+		"totals":     totals,
+	})
+}
+
+// parseWindow resolves the requested window. Without start_time it begins at UTC
+// midnight defaultDays-1 days before now; without end_time it ends at now.
+func parseWindow(rawStart, rawEnd string, now time.Time) (time.Time, time.Time, error) {
+	end := now
+	if rawEnd != "" {
+		secs, err := strconv.ParseInt(rawEnd, 10, 64)
+		if err != nil || secs <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("end_time must be a Unix timestamp in seconds")
+		}
+		end = time.Unix(secs, 0).UTC()
+	}
+	start := startOfDay(end).AddDate(0, 0, -(defaultDays - 1))
+	if rawStart != "" {
+		secs, err := strconv.ParseInt(rawStart, 10, 64)
+		if err != nil || secs < 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("start_time must be a Unix timestamp in seconds")
+		}
+		start = time.Unix(secs, 0).UTC()
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_time must be before end_time")
+	}
+	if end.Sub(start) > maxDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("the window must not exceed %d days", maxDays)
+	}
+	return start, end, nil
+}
+
+// buildBuckets groups rows into one bucket per UTC day of [start, end) and sums the
+// window totals.
+func buildBuckets(rows []usage.KeyDailyUsageRow, start, end time.Time) ([]Bucket, Totals) {
+	byDay := make(map[string][]usage.KeyDailyUsageRow)
+	for _, row := range rows {
+		byDay[row.Day] = append(byDay[row.Day], row)
+	}
+	var (
+		buckets []Bucket
+		totals  Totals
+	)
+	for day := startOfDay(start); day.Before(end); day = day.AddDate(0, 0, 1) {
+		bucket := Bucket{
+			Object:    "bucket",
+			Date:      day.Format("2006-01-02"),
+			StartTime: day.Unix(),
+			EndTime:   day.AddDate(0, 0, 1).Unix(),
+			Results:   []ModelTotals{},
+		}
+		for _, row := range byDay[bucket.Date] {
+			model := ModelTotals{Object: "usage.result", Model: row.Model, Totals: totalsOf(row)}
+			bucket.Results = append(bucket.Results, model)
+			bucket.add(model.Totals)
+		}
+		totals.add(bucket.Totals)
+		buckets = append(buckets, bucket)
+	}
+	return buckets, totals
+}
+
+func totalsOf(row usage.KeyDailyUsageRow) Totals {
+	return Totals{
+		Requests:        row.Requests,
+		FailedRequests:  row.FailedRequests,
+		InputTokens:     row.InputTokens,
+		OutputTokens:    row.OutputTokens,
+		ReasoningTokens: row.ReasoningTokens,
+		CachedTokens:    row.CachedTokens,
+		TotalTokens:     row.TotalTokens,
+		CostUSD:         row.CostUSD,
+	}
+}
+
+func (t *Totals) add(o Totals) {
+	t.Requests += o.Requests
+	t.FailedRequests += o.FailedRequests
+	t.InputTokens += o.InputTokens
+	t.OutputTokens += o.OutputTokens
+	t.ReasoningTokens += o.ReasoningTokens
+	t.CachedTokens += o.CachedTokens
+	t.TotalTokens += o.TotalTokens
+	t.CostUSD += o.CostUSD
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func writeError(c *gin.Context, status int, errType, message string) {
+	c.JSON(status, handlers.ErrorResponse{Error: handlers.ErrorDetail{Message: message, Type: errType}})
+}
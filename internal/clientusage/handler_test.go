@@ -0,0 +1,52 @@
+package clientusage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+func TestParseWindow(t *testing.T) {
+	now := time.Date(2026, 10, 15, 13, 30, 0, 0, time.UTC)
+	start, end, err := parseWindow("", "", now)
+	if err != nil {
+		t.Fatalf("parseWindow failed: %v", err)
+	}
+	if want := time.Date(2026, 10, 9, 0, 0, 0, 0, time.UTC); !start.Equal(want) || !end.Equal(now) {
+		t.Fatalf("unexpected default window %s - %s", start, end)
+	}
+	for _, tc := range []struct{ start, end string }{
+		{"abc", ""},
+		{"", "-1"},
+		{"1760000000", "1750000000"},
+		{"1700000000", "1760000000"},
+	} {
+		if _, _, err := parseWindow(tc.start, tc.end, now); err == nil {
+			t.Fatalf("expected start_time=%q end_time=%q to be rejected", tc.start, tc.end)
+		}
+	}
+}
+
+func TestBuildBuckets(t *testing.T) {
+	start := time.Date(2026, 10, 13, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	rows := []usage.KeyDailyUsageRow{
+		{Day: "2026-10-13", Model: "a", Requests: 2, TotalTokens: 20},
+		{Day: "2026-10-15", Model: "a", Requests: 1, TotalTokens: 5},
+		{Day: "2026-10-15", Model: "b", Requests: 3, TotalTokens: 7, CostUSD: 0.5},
+	}
+	buckets, totals := buildBuckets(rows, start, end)
+	if len(buckets) != 3 {
+		t.Fatalf("expected a bucket per day including empty ones, got %+v", buckets)
+	}
+	if buckets[1].Date != "2026-10-14" || buckets[1].Requests != 0 || len(buckets[1].Results) != 0 {
+		t.Fatalf("unexpected empty bucket: %+v", buckets[1])
+	}
+	if b := buckets[2]; b.Requests != 4 || b.TotalTokens != 12 || len(b.Results) != 2 || b.CostUSD != 0.5 {
+		t.Fatalf("unexpected last bucket: %+v", b)
+	}
+	if totals.Requests != 6 || totals.TotalTokens != 32 {
+		t.Fatalf("unexpected totals: %+v", totals)
+	}
+}
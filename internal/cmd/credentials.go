@@ -0,0 +1,156 @@
+// Package cmd contains CLI helpers. This file implements the "credentials" subcommand,
+// which moves the auth files of auth-dir between hosts as a passphrase-encrypted bundle.
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credbundle"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credcrypt"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultBundlePassphraseEnv names the variable holding the bundle passphrase.
+const defaultBundlePassphraseEnv = "CLIPROXY_BUNDLE_PASSPHRASE"
+
+// RunCredentials implements `credentials export [-out file]` and `credentials import
+// [-overwrite] <bundle>`. Exports made offline carry the auth files only; use the
+// management endpoints of a running instance to include labels, cooldowns and model
+// state. It returns the process exit code.
+func RunCredentials(args []string, defaultConfigPath string) int {
+	if len(args) > 0 && args[0] == "export" {
+		return runCredentialsExport(args[1:], defaultConfigPath)
+	}
+	if len(args) > 0 && args[0] == "import" {
+		return runCredentialsImport(args[1:], defaultConfigPath)
+	}
+	fmt.Fprintln(os.Stderr, "usage: credentials export [-out file] | credentials import [-overwrite] <bundle>")
+	return 2
+}
+
+func runCredentialsExport(args []string, defaultConfigPath string) int {
+	fs := flag.NewFlagSet("credentials export", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Configure File Path")
+	passphraseEnv := fs.String("passphrase-env", defaultBundlePassphraseEnv, "Environment variable holding the bundle passphrase")
+	out := fs.String("out", "", "Bundle path (defaults to cliproxy-credentials-<timestamp>.json)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	log.SetOutput(os.Stderr)
+
+	passphrase := os.Getenv(*passphraseEnv)
+	if passphrase == "" {
+		fmt.Fprintf(os.Stderr, "credentials export: set the bundle passphrase in %s\n", *passphraseEnv)
+		return 2
+	}
+	authDir, err := loadCredentialsAuthDir(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "credentials export: %v\n", err)
+		return 1
+	}
+	bundle, err := credbundle.Collect(authDir, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "credentials export: %v\n", err)
+		return 1
+	}
+	sealed, err := credbundle.Seal(bundle, passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "credentials export: %v\n", err)
+		return 1
+	}
+	target := strings.TrimSpace(*out)
+	if target == "" {
+		target = fmt.Sprintf("cliproxy-credentials-%s.json", time.Now().UTC().Format("20060102-150405"))
+	}
+	if err = os.WriteFile(target, sealed, 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "credentials export: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Exported %d credential(s) to %s\n", len(bundle.Credentials), target)
+	return 0
+}
+
+func runCredentialsImport(args []string, defaultConfigPath string) int {
+	fs := flag.NewFlagSet("credentials import", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Configure File Path")
+	passphraseEnv := fs.String("passphrase-env", defaultBundlePassphraseEnv, "Environment variable holding the bundle passphrase")
+	overwrite := fs.Bool("overwrite", false, "Replace auth files that already exist")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	log.SetOutput(os.Stderr)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "credentials import: expected the bundle path")
+		return 2
+	}
+
+	passphrase := os.Getenv(*passphraseEnv)
+	if passphrase == "" {
+		fmt.Fprintf(os.Stderr, "credentials import: set the bundle passphrase in %s\n", *passphraseEnv)
+		return 2
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "credentials import: %v\n", err)
+		return 1
+	}
+	bundle, err := credbundle.Open(data, passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "credentials import: %v\n", err)
+		if errors.Is(err, credbundle.ErrBadPassphrase) {
+			return 2
+		}
+		return 1
+	}
+	authDir, err := loadCredentialsAuthDir(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "credentials import: %v\n", err)
+		return 1
+	}
+	result, err := credbundle.Restore(authDir, bundle, *overwrite)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "credentials import: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Imported %d credential(s) into %s\n", len(result.Imported), authDir)
+	for _, path := range result.Skipped {
+		fmt.Printf("Skipped existing %s (use -overwrite to replace)\n", path)
+	}
+	return 0
+}
+
+// loadCredentialsAuthDir loads the config, configures credential encryption from it
+// and returns the resolved auth-dir.
+func loadCredentialsAuthDir(configPath string) (string, error) {
+	path, err := resolveUsageConfigPath(configPath)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := config.LoadConfigOptional(path, false)
+	if err != nil {
+		return "", fmt.Errorf("load config: %w", err)
+	}
+	if err = credcrypt.Configure(credcrypt.Options{
+		Enabled:    cfg.CredentialEncryption.Enabled,
+		KeyEnv:     cfg.CredentialEncryption.KeyEnv,
+		KeyFile:    cfg.CredentialEncryption.KeyFile,
+		KeyCommand: cfg.CredentialEncryption.KeyCommand,
+	}); err != nil {
+		return "", fmt.Errorf("load credential encryption key: %w", err)
+	}
+	authDir, err := util.ResolveAuthDir(cfg.AuthDir)
+	if err != nil {
+		return "", err
+	}
+	if authDir == "" {
+		return "", fmt.Errorf("auth-dir is not configured")
+	}
+	return authDir, nil
+}
@@ -0,0 +1,114 @@
+// Package cmd contains CLI helpers. This file implements replaying a stored request
+// log against a running proxy instance through its management API.
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/replay"
+	log "github.com/sirupsen/logrus"
+)
+
+// DoReplay re-issues the request recorded in logPath. Dry runs are resolved locally
+// and print the reconstructed request; otherwise the log is sent to the management
+// endpoint of the instance described by cfg, authenticated with managementKey
+// (falling back to the MANAGEMENT_PASSWORD environment variable).
+func DoReplay(cfg *config.Config, logPath string, opts replay.Options, managementKey string) {
+	data, errRead := os.ReadFile(strings.TrimSpace(logPath))
+	if errRead != nil {
+		log.Errorf("replay: read log failed: %v", errRead)
+		return
+	}
+
+	if opts.DryRun {
+		logged, errParse := replay.Parse(data)
+		if errParse != nil {
+			log.Errorf("replay: %v", errParse)
+			return
+		}
+		prepared, errPrepare := logged.Prepare(opts)
+		if errPrepare != nil {
+			log.Errorf("replay: %v", errPrepare)
+			return
+		}
+		fmt.Printf("%s %s\n", prepared.Method, prepared.URL)
+		for key, values := range prepared.Headers {
+			for _, value := range values {
+				fmt.Printf("%s: %s\n", key, value)
+			}
+		}
+		fmt.Printf("\n%s\n", prepared.Body)
+		return
+	}
+
+	if managementKey = strings.TrimSpace(managementKey); managementKey == "" {
+		managementKey = strings.TrimSpace(os.Getenv("MANAGEMENT_PASSWORD"))
+	}
+	if managementKey == "" {
+		log.Errorf("replay: a management key is required (-password or MANAGEMENT_PASSWORD)")
+		return
+	}
+
+	payload, errMarshal := json.Marshal(map[string]any{
+		"log":     string(data),
+		"model":   opts.Model,
+		"auth_id": opts.AuthID,
+	})
+	if errMarshal != nil {
+		log.Errorf("replay: encode request failed: %v", errMarshal)
+		return
+	}
+
+	scheme := "http"
+	client := &http.Client{Timeout: 10 * time.Minute}
+	if cfg != nil && cfg.TLS.Enable {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	port := 8317
+	if cfg != nil && cfg.Port > 0 {
+		port = cfg.Port
+	}
+	endpoint := fmt.Sprintf("%s://127.0.0.1:%d/v0/management/request-log/replay", scheme, port)
+
+	req, errReq := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if errReq != nil {
+		log.Errorf("replay: build request failed: %v", errReq)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+managementKey)
+
+	resp, errDo := client.Do(req)
+	if errDo != nil {
+		log.Errorf("replay: request failed: %v", errDo)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("replay: management API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return
+	}
+
+	var result struct {
+		Response struct {
+			Status int    `json:"status"`
+			Body   string `json:"body"`
+		} `json:"response"`
+	}
+	if errUnmarshal := json.Unmarshal(body, &result); errUnmarshal != nil {
+		fmt.Println(string(body))
+		return
+	}
+	fmt.Printf("Status: %d\n\n%s\n", result.Response.Status, result.Response.Body)
+}
@@ -0,0 +1,532 @@
+// Package cmd contains CLI helpers. This file implements the "usage" subcommand,
+// which prints aggregated usage from the local database or the management API.
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	log "github.com/sirupsen/logrus"
+)
+
+// usageSummaryDays is the widest window printed by the usage subcommand.
+const usageSummaryDays = 30
+
+// RunUsage implements `usage [-config path] [-json] [-api] [-provider name]`. It
+// reads the configured usage database directly when available, falling back to the
+// management API of the running instance. `usage import`, `usage migrate`, `usage
+// compare`, `usage export` and `usage verify` are dispatched to their run helpers. It
+// returns the process exit code.
+func RunUsage(args []string, defaultConfigPath string) int {
+	if len(args) > 0 && args[0] == "import" {
+		return runUsageImport(args[1:], defaultConfigPath)
+	}
+	if len(args) > 0 && args[0] == "migrate" {
+		return runUsageMigrate(args[1:], defaultConfigPath)
+	}
+	if len(args) > 0 && args[0] == "compare" {
+		return runUsageCompare(args[1:], defaultConfigPath)
+	}
+	if len(args) > 0 && args[0] == "export" {
+		return runUsageExport(args[1:], defaultConfigPath)
+	}
+	if len(args) > 0 && args[0] == "verify" {
+		return runUsageVerify(args[1:])
+	}
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Configure File Path")
+	asJSON := fs.Bool("json", false, "Print the summary as JSON")
+	useAPI := fs.Bool("api", false, "Query the running server's management API instead of the database file")
+	provider := fs.String("provider", "", "Only include the given provider")
+	password := fs.String("password", "", "Management key (defaults to MANAGEMENT_PASSWORD)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	// Keep stdout reserved for the report so -json output stays machine readable.
+	log.SetOutput(os.Stderr)
+
+	path, err := resolveUsageConfigPath(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage: %v\n", err)
+		return 1
+	}
+	cfg, err := config.LoadConfigOptional(path, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage: load config: %v\n", err)
+		return 1
+	}
+
+	var (
+		rows   []usage.DailyUsageRow
+		source string
+	)
+	if !*useAPI && usageDatabaseAvailable(cfg) {
+		rows, err = queryUsageDatabase(cfg, *provider)
+		source = cfg.UsageDatabase.Path
+	} else {
+		rows, err = queryUsageAPI(cfg, *provider, *password)
+		source = "management API"
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage: %v\n", err)
+		return 1
+	}
+
+	summary := usage.SummarizeDaily(rows, time.Now())
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(summary); err != nil {
+			fmt.Fprintf(os.Stderr, "usage: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	printUsageSummary(os.Stdout, summary, source)
+	return 0
+}
+
+// runUsageImport implements `usage import [-config path] [-dry-run] <other.db>`,
+// merging another instance's usage database into the configured one.
+func runUsageImport(args []string, defaultConfigPath string) int {
+	fs := flag.NewFlagSet("usage import", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Configure File Path")
+	dryRun := fs.Bool("dry-run", false, "Report what would be imported without writing")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import expects exactly one source database path")
+		return 2
+	}
+	log.SetOutput(os.Stderr)
+
+	path, err := resolveUsageConfigPath(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage import: %v\n", err)
+		return 1
+	}
+	cfg, err := config.LoadConfigOptional(path, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage import: load config: %v\n", err)
+		return 1
+	}
+	if !cfg.UsageDatabase.Enabled || cfg.UsageDatabase.Path == "" || cfg.UsageDatabase.ReadOnly {
+		fmt.Fprintln(os.Stderr, "usage import: usage-db must be enabled and writable in the config")
+		return 1
+	}
+
+	result, err := usage.ImportDatabase(context.Background(), cfg.UsageDatabase.Path, fs.Arg(0), *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage import: %v\n", err)
+		return 1
+	}
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d requests (%d duplicates skipped), %d daily rows and %d monthly rows into %s\n",
+		verb, result.Requests, result.DuplicateRequests, result.DailyRows, result.MonthlyRows, cfg.UsageDatabase.Path)
+	return 0
+}
+
+// runUsageMigrate implements `usage migrate [-config path] [-from sqlite:usage.db]
+// -to postgres://...`, copying the usage database into PostgreSQL. The source
+// defaults to the configured usage-db; an interrupted run resumes when repeated.
+func runUsageMigrate(args []string, defaultConfigPath string) int {
+	fs := flag.NewFlagSet("usage migrate", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Configure File Path")
+	from := fs.String("from", "", "Source SQLite database as sqlite:<path> (defaults to the configured usage-db)")
+	to := fs.String("to", "", "Target PostgreSQL connection string (postgres://...)")
+	batchSize := fs.Int("batch-size", 1000, "Rows copied per transaction")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	log.SetOutput(os.Stderr)
+
+	target := strings.TrimSpace(*to)
+	if !strings.HasPrefix(target, "postgres://") && !strings.HasPrefix(target, "postgresql://") {
+		fmt.Fprintln(os.Stderr, "usage migrate: -to must be a postgres:// connection string")
+		return 2
+	}
+	source := strings.TrimPrefix(strings.TrimSpace(*from), "sqlite:")
+	if source == "" {
+		path, err := resolveUsageConfigPath(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "usage migrate: %v\n", err)
+			return 1
+		}
+		cfg, err := config.LoadConfigOptional(path, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "usage migrate: load config: %v\n", err)
+			return 1
+		}
+		if !cfg.UsageDatabase.Enabled || cfg.UsageDatabase.Path == "" {
+			fmt.Fprintln(os.Stderr, "usage migrate: no -from given and usage-db is not enabled in the config")
+			return 2
+		}
+		source = cfg.UsageDatabase.Path
+	}
+
+	result, err := usage.MigrateToPostgres(context.Background(), usage.MigrateOptions{
+		SourcePath: source,
+		TargetDSN:  target,
+		BatchSize:  *batchSize,
+		Progress: func(p usage.MigrateProgress) {
+			fmt.Fprintf(os.Stderr, "%s: %d/%d rows\n", p.Table, p.Copied, p.Total)
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage migrate: %v (re-run the same command to resume)\n", err)
+		return 1
+	}
+	fmt.Printf("Migrated %d tables (%d rows copied, %d indexes) from %s\n", result.Tables, result.Rows, result.Indexes, source)
+	return 0
+}
+
+// runUsageCompare implements `usage compare [-config path] [-from sqlite:usage.db]
+// [-to postgres://...] [-days n] [-json]`, reporting per-day row-count and token-sum
+// differences between the SQLite usage database and its PostgreSQL copy. The source
+// defaults to the configured usage-db and the target to usage-db.dual-write.dsn. It
+// exits with 1 when any day differs.
+func runUsageCompare(args []string, defaultConfigPath string) int {
+	fs := flag.NewFlagSet("usage compare", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Configure File Path")
+	from := fs.String("from", "", "Source SQLite database as sqlite:<path> (defaults to the configured usage-db)")
+	to := fs.String("to", "", "Target PostgreSQL connection string (defaults to usage-db.dual-write.dsn)")
+	days := fs.Int("days", usageSummaryDays, "Number of UTC days to compare, ending today")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	log.SetOutput(os.Stderr)
+	if *days <= 0 {
+		fmt.Fprintln(os.Stderr, "usage compare: -days must be positive")
+		return 2
+	}
+
+	source := strings.TrimPrefix(strings.TrimSpace(*from), "sqlite:")
+	target := strings.TrimSpace(*to)
+	if source == "" || target == "" {
+		path, err := resolveUsageConfigPath(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "usage compare: %v\n", err)
+			return 1
+		}
+		cfg, err := config.LoadConfigOptional(path, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "usage compare: load config: %v\n", err)
+			return 1
+		}
+		if source == "" {
+			if !usageDatabaseAvailable(cfg) {
+				fmt.Fprintln(os.Stderr, "usage compare: no -from given and usage-db is not enabled in the config")
+				return 2
+			}
+			source = cfg.UsageDatabase.Path
+		}
+		if target == "" {
+			target = strings.TrimSpace(cfg.UsageDatabase.DualWrite.DSN)
+		}
+	}
+	if !strings.HasPrefix(target, "postgres://") && !strings.HasPrefix(target, "postgresql://") {
+		fmt.Fprintln(os.Stderr, "usage compare: -to must be a postgres:// connection string")
+		return 2
+	}
+
+	now := time.Now().UTC()
+	end := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	report, err := usage.CheckConsistency(context.Background(), usage.ConsistencyOptions{
+		SourcePath: source,
+		TargetDSN:  target,
+		From:       end.AddDate(0, 0, -*days),
+		To:         end,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage compare: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "usage compare: %v\n", err)
+			return 1
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "Day\tSQLite rows\tPostgres rows\tRows diff\tPrompt diff\tCompletion diff\tTotal diff\t")
+		for _, day := range report.Days {
+			status := ""
+			if !day.Consistent() {
+				status = "MISMATCH"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%+d\t%+d\t%+d\t%+d\t%s\n", day.Day, day.Source.Rows, day.Target.Rows,
+				day.Diff.Rows, day.Diff.PromptTokens, day.Diff.CompletionTokens, day.Diff.TotalTokens, status)
+		}
+		_ = tw.Flush()
+		fmt.Printf("%d of %d days differ between %s and the PostgreSQL copy\n", report.Mismatched, len(report.Days), source)
+	}
+	if report.Mismatched > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runUsageExport implements `usage export [-config path] (-month YYYY-MM | -from
+// YYYY-MM-DD -to YYYY-MM-DD) [-provider name] [-sign-key path] [-out file]`, writing a
+// tamper-evident archive of the period's request records for billing reconciliation.
+func runUsageExport(args []string, defaultConfigPath string) int {
+	fs := flag.NewFlagSet("usage export", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath, "Configure File Path")
+	month := fs.String("month", "", "Billing month to export (YYYY-MM, UTC)")
+	from := fs.String("from", "", "First day to export (YYYY-MM-DD, UTC)")
+	to := fs.String("to", "", "Day after the last day to export (YYYY-MM-DD, UTC)")
+	provider := fs.String("provider", "", "Only include the given provider")
+	signKey := fs.String("sign-key", "", "Ed25519 private key (PEM) to sign with (defaults to usage-db.export-signing-key)")
+	out := fs.String("out", "", "Archive path (defaults to cliproxy-usage-<from>-<to>.tar.gz)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	log.SetOutput(os.Stderr)
+
+	start, end, err := usage.ParseExportPeriod(*month, *from, *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage export: %v\n", err)
+		return 2
+	}
+	path, err := resolveUsageConfigPath(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage export: %v\n", err)
+		return 1
+	}
+	cfg, err := config.LoadConfigOptional(path, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage export: load config: %v\n", err)
+		return 1
+	}
+	if !usageDatabaseAvailable(cfg) {
+		fmt.Fprintln(os.Stderr, "usage export: usage-db must be enabled in the config and its file must exist")
+		return 1
+	}
+	opts := usage.ExportOptions{From: start, To: end, Provider: *provider}
+	keyPath := strings.TrimSpace(*signKey)
+	if keyPath == "" {
+		keyPath = strings.TrimSpace(cfg.UsageDatabase.ExportSigningKey)
+	}
+	if keyPath != "" {
+		if opts.SigningKey, err = usage.LoadExportSigningKey(keyPath); err != nil {
+			fmt.Fprintf(os.Stderr, "usage export: load signing key: %v\n", err)
+			return 1
+		}
+	}
+	target := strings.TrimSpace(*out)
+	if target == "" {
+		target = "cliproxy-usage-" + start.Format("20060102") + "-" + end.Format("20060102") + ".tar.gz"
+	}
+
+	if err = usage.ConfigureDatabase(usage.DatabaseOptions{Enabled: true, Path: cfg.UsageDatabase.Path, ReadOnly: true, SQLite: usage.SQLiteOptionsFromConfig(cfg.UsageDatabase.SQLite)}); err != nil {
+		fmt.Fprintf(os.Stderr, "usage export: open usage database: %v\n", err)
+		return 1
+	}
+	defer func() { _ = usage.ConfigureDatabase(usage.DatabaseOptions{}) }()
+	file, err := os.Create(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage export: %v\n", err)
+		return 1
+	}
+	manifest, err := usage.ExportUsage(context.Background(), file, opts)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		fmt.Fprintf(os.Stderr, "usage export: %v\n", err)
+		return 1
+	}
+	signed := "unsigned"
+	if manifest.PublicKey != "" {
+		signed = "signed"
+	}
+	fmt.Printf("Exported %d requests (%d tokens) from %s to %s into %s (%s)\n",
+		manifest.Totals.Requests, manifest.Totals.TotalTokens, start.Format("2006-01-02"), end.Format("2006-01-02"), target, signed)
+	return 0
+}
+
+// runUsageVerify implements `usage verify [-public-key path] <archive>`, checking the
+// digests and signature of an archive written by `usage export`.
+func runUsageVerify(args []string) int {
+	fs := flag.NewFlagSet("usage verify", flag.ContinueOnError)
+	publicKey := fs.String("public-key", "", "Ed25519 public key (PEM) expected to have signed the archive")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage verify: expects exactly one archive path")
+		return 2
+	}
+	var (
+		key ed25519.PublicKey
+		err error
+	)
+	if path := strings.TrimSpace(*publicKey); path != "" {
+		if key, err = usage.LoadExportPublicKey(path); err != nil {
+			fmt.Fprintf(os.Stderr, "usage verify: load public key: %v\n", err)
+			return 1
+		}
+	}
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage verify: %v\n", err)
+		return 1
+	}
+	defer func() { _ = file.Close() }()
+	result, err := usage.VerifyExport(file, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage verify: %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	m := result.Manifest
+	fmt.Printf("OK: %d requests (%d tokens) from %s to %s\n",
+		m.Totals.Requests, m.Totals.TotalTokens, m.From.Format("2006-01-02"), m.To.Format("2006-01-02"))
+	switch {
+	case result.TrustedKey:
+		fmt.Println("Signature valid for the given public key.")
+	case result.Signed:
+		fmt.Printf("Signature valid for the embedded key %s; pass -public-key to check who signed it.\n", m.PublicKey)
+	default:
+		fmt.Println("Archive is not signed; only file integrity was checked.")
+	}
+	return 0
+}
+
+func resolveUsageConfigPath(path string) (string, error) {
+	if path = strings.TrimSpace(path); path != "" {
+		return path, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(wd, "config.yaml"), nil
+}
+
+func usageDatabaseAvailable(cfg *config.Config) bool {
+	if cfg == nil || !cfg.UsageDatabase.Enabled || cfg.UsageDatabase.Path == "" {
+		return false
+	}
+	_, err := os.Stat(cfg.UsageDatabase.Path)
+	return err == nil
+}
+
+func queryUsageDatabase(cfg *config.Config, provider string) ([]usage.DailyUsageRow, error) {
+	// Open read-only so running alongside a live server never contends for writes.
+	if err := usage.ConfigureDatabase(usage.DatabaseOptions{
+		Enabled:  true,
+		Path:     cfg.UsageDatabase.Path,
+		ReadOnly: true,
+		SQLite:   usage.SQLiteOptionsFromConfig(cfg.UsageDatabase.SQLite),
+	}); err != nil {
+		return nil, fmt.Errorf("open usage database: %w", err)
+	}
+	defer func() { _ = usage.ConfigureDatabase(usage.DatabaseOptions{}) }()
+	since := time.Now().UTC().AddDate(0, 0, -(usageSummaryDays - 1))
+	return usage.QueryDailyUsage(context.Background(), since, provider)
+}
+
+func queryUsageAPI(cfg *config.Config, provider, managementKey string) ([]usage.DailyUsageRow, error) {
+	if managementKey = strings.TrimSpace(managementKey); managementKey == "" {
+		managementKey = strings.TrimSpace(os.Getenv("MANAGEMENT_PASSWORD"))
+	}
+	if managementKey == "" {
+		return nil, fmt.Errorf("usage database unavailable and no management key given (-password or MANAGEMENT_PASSWORD)")
+	}
+
+	scheme := "http"
+	client := &http.Client{Timeout: 30 * time.Second}
+	if cfg != nil && cfg.TLS.Enable {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	port := 8317
+	if cfg != nil && cfg.Port > 0 {
+		port = cfg.Port
+	}
+	query := url.Values{"days": {fmt.Sprint(usageSummaryDays)}}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query.Set("provider", provider)
+	}
+	endpoint := fmt.Sprintf("%s://127.0.0.1:%d/v0/management/usage/daily?%s", scheme, port, query.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+managementKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("management API request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("management API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var payload struct {
+		Daily []usage.DailyUsageRow `json:"daily"`
+	}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("decode management API response: %w", err)
+	}
+	return payload.Daily, nil
+}
+
+func printUsageSummary(out io.Writer, summary usage.UsageSummary, source string) {
+	fmt.Fprintf(out, "Usage summary from %s (generated %s UTC)\n", source, summary.GeneratedAt.Format("2006-01-02 15:04"))
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := func(title string) {
+		fmt.Fprintf(tw, "\n%s\t", title)
+		for _, window := range usage.SummaryWindows {
+			fmt.Fprintf(tw, "%s requests\t%s tokens\t", window, window)
+		}
+		fmt.Fprintln(tw, "30d failed\t")
+	}
+	line := func(name string, windows map[string]usage.SummaryTotals) {
+		fmt.Fprintf(tw, "%s\t", name)
+		for _, window := range usage.SummaryWindows {
+			fmt.Fprintf(tw, "%d\t%d\t", windows[window].Requests, windows[window].TotalTokens)
+		}
+		fmt.Fprintf(tw, "%d\t\n", windows["30d"].FailedRequests)
+	}
+
+	header("TOTAL")
+	line("all", summary.Totals)
+	for _, section := range []struct {
+		title string
+		rows  []usage.SummaryRow
+	}{
+		{"PROVIDER", summary.ByProvider},
+		{"MODEL", summary.ByModel},
+		{"CREDENTIAL", summary.ByCredential},
+	} {
+		header(section.title)
+		for _, row := range section.rows {
+			line(row.Name, row.Windows)
+		}
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// DoValidateConfig checks the config file at configPath (config.yaml in the working
+// directory when empty) without starting the server or rewriting the file. It prints
+// every issue found and returns the process exit code: 0 when valid, 1 otherwise.
+func DoValidateConfig(configPath string) int {
+	if configPath = strings.TrimSpace(configPath); configPath == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "validate: failed to get working directory: %v\n", err)
+			return 1
+		}
+		configPath = filepath.Join(wd, "config.yaml")
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "validate: %v\n", err)
+		return 1
+	}
+
+	result := config.ValidateYAML(data, configPath)
+	for _, issue := range result.Issues {
+		field := issue.Field
+		if field == "" {
+			field = "-"
+		}
+		fmt.Printf("%-7s %s: %s\n", issue.Severity, field, issue.Message)
+	}
+	if !result.Valid {
+		fmt.Printf("%s: invalid\n", configPath)
+		return 1
+	}
+	fmt.Printf("%s: ok\n", configPath)
+	return 0
+}
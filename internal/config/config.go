@@ -40,6 +40,14 @@ type Config struct {
 	// Debug enables or disables debug-level logging and other debug features.
 	Debug bool `yaml:"debug" json:"debug"`
 
+	// LogLevel sets the global log level (trace, debug, info, warn, error). Empty means
+	// info, or debug when Debug is true.
+	LogLevel string `yaml:"log-level,omitempty" json:"log-level,omitempty"`
+
+	// LogComponents enables debug output for individual subsystems (usage, otlp, router,
+	// auth) without lowering the global log level.
+	LogComponents []string `yaml:"log-components,omitempty" json:"log-components,omitempty"`
+
 	// LoggingToFile controls whether application logs are written to rotating files or stdout.
 	LoggingToFile bool `yaml:"logging-to-file" json:"logging-to-file"`
 
@@ -58,6 +66,40 @@ type Config struct {
 	// MaxRetryInterval defines the maximum wait time in seconds before retrying a cooled-down credential.
 	MaxRetryInterval int `yaml:"max-retry-interval" json:"max-retry-interval"`
 
+	// CircuitBreaker stops routing to a credential after repeated upstream failures.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit-breaker,omitempty" json:"circuit-breaker,omitempty"`
+
+	// CredentialCanary warms up credentials added while running on a share of traffic.
+	CredentialCanary CredentialCanaryConfig `yaml:"credential-canary,omitempty" json:"credential-canary,omitempty"`
+
+	// LatencyRouting prefers the credentials and providers with the lowest recent p95 latency.
+	LatencyRouting LatencyRoutingConfig `yaml:"latency-routing,omitempty" json:"latency-routing,omitempty"`
+
+	// CredentialConcurrency limits in-flight requests per credential.
+	CredentialConcurrency CredentialConcurrencyConfig `yaml:"credential-concurrency,omitempty" json:"credential-concurrency,omitempty"`
+
+	// LoadShedding rejects client requests with 503 while the proxy is overloaded.
+	LoadShedding LoadSheddingConfig `yaml:"load-shedding,omitempty" json:"load-shedding,omitempty"`
+
+	// SessionAffinity pins requests of one conversation to the same credential.
+	SessionAffinity SessionAffinityConfig `yaml:"session-affinity,omitempty" json:"session-affinity,omitempty"`
+
+	// AuthRefresh tunes proactive renewal of OAuth credentials before they expire.
+	AuthRefresh AuthRefreshConfig `yaml:"auth-refresh,omitempty" json:"auth-refresh,omitempty"`
+
+	// NetworkAccess restricts client API traffic by source IP and rate limits it per IP.
+	NetworkAccess NetworkAccessConfig `yaml:"network-access,omitempty" json:"network-access,omitempty"`
+
+	// RequestSizeLimits caps client API request bodies per route and per client key.
+	RequestSizeLimits RequestSizeLimitsConfig `yaml:"request-size-limits,omitempty" json:"request-size-limits,omitempty"`
+
+	// Idempotency replays stored responses for retried requests carrying an Idempotency-Key header.
+	Idempotency IdempotencyConfig `yaml:"idempotency,omitempty" json:"idempotency,omitempty"`
+
+	// ClientAttribution records the client IP (hashed), user agent and country of
+	// client API requests in the usage database.
+	ClientAttribution ClientAttributionConfig `yaml:"client-attribution,omitempty" json:"client-attribution,omitempty"`
+
 	// QuotaExceeded defines the behavior when a quota is exceeded.
 	QuotaExceeded QuotaExceeded `yaml:"quota-exceeded" json:"quota-exceeded"`
 
@@ -86,15 +128,84 @@ type Config struct {
 	// OAuthExcludedModels defines per-provider global model exclusions applied to OAuth/file-backed auth entries.
 	OAuthExcludedModels map[string][]string `yaml:"oauth-excluded-models,omitempty" json:"oauth-excluded-models,omitempty"`
 
+	// ProviderProxies maps a provider name (e.g. "gemini-cli", "codex") to the outbound
+	// proxy its upstream requests use. A credential's own proxy-url takes precedence;
+	// providers without an entry fall back to the global proxy-url.
+	ProviderProxies map[string]string `yaml:"provider-proxies,omitempty" json:"provider-proxies,omitempty"`
+
+	// Upstream sets timeouts and retries of provider HTTP calls, with per-provider overrides.
+	Upstream UpstreamConfig `yaml:"upstream,omitempty" json:"upstream,omitempty"`
+
+	// PromptCaching adds Anthropic prompt cache breakpoints to Claude requests.
+	PromptCaching PromptCachingConfig `yaml:"prompt-caching,omitempty" json:"prompt-caching,omitempty"`
+
 	// Payload defines default and override rules for provider payload parameters.
 	Payload PayloadConfig `yaml:"payload" json:"payload"`
 
 	// OTLP defines OpenTelemetry configuration for telemetry export.
 	OTLP OTLPConfig `yaml:"otlp" json:"otlp"`
 
+	// StatsD configures an optional StatsD/DogStatsD metric sink alongside OTLP.
+	StatsD StatsDConfig `yaml:"statsd,omitempty" json:"statsd,omitempty"`
+
+	// Prometheus exposes per-route HTTP handler metrics at GET /metrics.
+	Prometheus PrometheusConfig `yaml:"prometheus,omitempty" json:"prometheus,omitempty"`
+
+	// UsageSinks are external programs that receive every usage record as a JSON line
+	// on stdin, for sinks the proxy does not ship (Kafka, BigQuery, ...).
+	UsageSinks []UsageSinkConfig `yaml:"usage-sinks,omitempty" json:"usage-sinks,omitempty"`
+
+	// Kafka publishes every usage record to a Kafka topic.
+	Kafka KafkaConfig `yaml:"kafka,omitempty" json:"kafka,omitempty"`
+
+	// Redis shares rate limit and spend cap counters between proxy instances.
+	Redis RedisConfig `yaml:"redis,omitempty" json:"redis,omitempty"`
+
 	// UsageDatabase controls local persistence of request/token statistics.
 	UsageDatabase UsageDatabaseConfig `yaml:"usage-db" json:"usage-db"`
 
+	// Batch configures the OpenAI-compatible /v1/batches endpoints.
+	Batch BatchConfig `yaml:"batch,omitempty" json:"batch,omitempty"`
+
+	// ClassificationRules tag incoming requests at ingestion based on prompt text or metadata.
+	ClassificationRules []ClassificationRule `yaml:"classification-rules,omitempty" json:"classification-rules,omitempty"`
+
+	// Workspaces group client API keys into tenants used for credential sharing controls.
+	Workspaces []Workspace `yaml:"workspaces,omitempty" json:"workspaces,omitempty"`
+
+	// Teams group client API keys so request quotas, spending caps, model policies and
+	// usage reports can be managed per team.
+	Teams []Team `yaml:"teams,omitempty" json:"teams,omitempty"`
+
+	// APIKeyPolicies restrict which models and providers individual client API keys may use.
+	APIKeyPolicies []APIKeyPolicy `yaml:"api-key-policies,omitempty" json:"api-key-policies,omitempty"`
+
+	// InviteCodes are one-time codes a new user exchanges for a client API key at
+	// POST /invites/redeem. Redeemed codes are removed.
+	InviteCodes []InviteCode `yaml:"invite-codes,omitempty" json:"invite-codes,omitempty"`
+
+	// ModelRewrites map requested model names to the models actually routed, optionally per client key.
+	ModelRewrites []ModelRewriteRule `yaml:"model-rewrites,omitempty" json:"model-rewrites,omitempty"`
+
+	// RequestTransforms rewrite inbound request bodies of selected client keys before translation.
+	RequestTransforms []RequestTransform `yaml:"request-transforms,omitempty" json:"request-transforms,omitempty"`
+
+	// ReasoningBudgets cap the reasoning tokens selected client keys or models may request.
+	ReasoningBudgets []ReasoningBudget `yaml:"reasoning-budgets,omitempty" json:"reasoning-budgets,omitempty"`
+
+	// ProviderSpendCaps cap the monthly spend of upstream providers, priced with
+	// usage-db.model-prices.
+	ProviderSpendCaps []ProviderSpendCap `yaml:"provider-spend-caps,omitempty" json:"provider-spend-caps,omitempty"`
+
+	// ShadowTraffic duplicates a sample of requests to a second model for A/B comparison.
+	ShadowTraffic ShadowTrafficConfig `yaml:"shadow-traffic,omitempty" json:"shadow-traffic,omitempty"`
+
+	// CredentialEncryption encrypts auth files in auth-dir at rest.
+	CredentialEncryption CredentialEncryptionConfig `yaml:"credential-encryption,omitempty" json:"credential-encryption,omitempty"`
+
+	// Secrets configures backends for API key references such as "vault:secret/data/llm#openai".
+	Secrets SecretsConfig `yaml:"secrets,omitempty" json:"secrets,omitempty"`
+
 	legacyMigrationPending bool `yaml:"-" json:"-"`
 }
 
@@ -119,6 +230,219 @@ type RemoteManagement struct {
 	// PanelGitHubRepository overrides the GitHub repository used to fetch the management panel asset.
 	// Accepts either a repository URL (https://github.com/org/repo) or an API releases endpoint.
 	PanelGitHubRepository string `yaml:"panel-github-repository"`
+	// Tokens are additional management keys limited to a role, e.g. a dashboard that
+	// may read usage but not change settings. They are accepted alongside SecretKey.
+	Tokens []ManagementToken `yaml:"tokens,omitempty"`
+}
+
+// ManagementToken is a scoped management API key.
+type ManagementToken struct {
+	// Name identifies the token in logs.
+	Name string `yaml:"name"`
+	// Key is the token value, plaintext or bcrypt hashed.
+	Key string `yaml:"key"`
+	// Role is one of "admin", "read-only" or "usage-viewer".
+	Role string `yaml:"role"`
+}
+
+// CircuitBreakerConfig configures the per-credential circuit breaker.
+type CircuitBreakerConfig struct {
+	// Enabled turns the breaker on.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// FailureThreshold is the number of consecutive upstream failures (5xx, 408,
+	// network errors) that opens the breaker. Defaults to 5.
+	FailureThreshold int `yaml:"failure-threshold,omitempty" json:"failure-threshold,omitempty"`
+	// WindowSeconds bounds how far apart those failures may be. Defaults to 60.
+	WindowSeconds int `yaml:"window-seconds,omitempty" json:"window-seconds,omitempty"`
+	// OpenSeconds is how long the breaker stays open before a half-open probe. Defaults to 30.
+	OpenSeconds int `yaml:"open-seconds,omitempty" json:"open-seconds,omitempty"`
+}
+
+// CredentialCanaryConfig routes only a small share of traffic to credentials added
+// while the proxy is running, until they have proven healthy. A canary is promoted to
+// full traffic once its warm-up has passed, or disabled as soon as its failure or
+// rate-limit rate exceeds the thresholds.
+type CredentialCanaryConfig struct {
+	// Enabled turns canary routing on.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// TrafficPercent is the share of a provider's requests sent to its canary
+	// credentials while other credentials are available. Defaults to 5.
+	TrafficPercent int `yaml:"traffic-percent,omitempty" json:"traffic-percent,omitempty"`
+	// WarmupMinutes is how long a credential stays a canary. Defaults to 30.
+	WarmupMinutes int `yaml:"warmup-minutes,omitempty" json:"warmup-minutes,omitempty"`
+	// MinRequests is the number of canary requests needed before the rates are
+	// judged; a canary is only promoted once it has served them. Defaults to 20.
+	MinRequests int `yaml:"min-requests,omitempty" json:"min-requests,omitempty"`
+	// MaxFailureRate is the share of failed requests (0-1, 429s excluded) above which
+	// the canary is disabled. Defaults to 0.2.
+	MaxFailureRate float64 `yaml:"max-failure-rate,omitempty" json:"max-failure-rate,omitempty"`
+	// MaxRateLimitRate is the share of 429 responses (0-1) above which the canary is
+	// disabled. Defaults to 0.5.
+	MaxRateLimitRate float64 `yaml:"max-rate-limit-rate,omitempty" json:"max-rate-limit-rate,omitempty"`
+}
+
+// LatencyRoutingConfig sends requests to the credential with the lowest p95 latency
+// for the requested model, measured from recent successful requests. Routing stays
+// round-robin while any candidate has too few recent samples.
+type LatencyRoutingConfig struct {
+	// Enabled turns latency-based routing on.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// WindowSeconds is how far back latencies are considered. Defaults to 300.
+	WindowSeconds int `yaml:"window-seconds,omitempty" json:"window-seconds,omitempty"`
+	// MinSamples is the number of recent requests every candidate needs before
+	// latencies are compared. Defaults to 10.
+	MinSamples int `yaml:"min-samples,omitempty" json:"min-samples,omitempty"`
+}
+
+// BatchConfig controls how batch jobs are executed. Jobs and their files are stored
+// in the usage database, so batches require a writable usage-db.
+type BatchConfig struct {
+	// Concurrency is the number of requests of one batch in flight at a time. Defaults to 4.
+	Concurrency int `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
+}
+
+// CredentialConcurrencyConfig bounds how many requests may use one credential at a time.
+type CredentialConcurrencyConfig struct {
+	// MaxInFlight is the default limit per credential; 0 disables limiting. Auth files
+	// may override it with a "max_concurrency" field.
+	MaxInFlight int `yaml:"max-in-flight,omitempty" json:"max-in-flight,omitempty"`
+	// QueueTimeoutSeconds is how long a request waits for a free slot before trying
+	// the next credential. Defaults to 30.
+	QueueTimeoutSeconds int `yaml:"queue-timeout-seconds,omitempty" json:"queue-timeout-seconds,omitempty"`
+}
+
+// LoadSheddingConfig sets the overload thresholds past which new client requests are
+// answered with 503 and Retry-After instead of being accepted. Zero disables a threshold.
+type LoadSheddingConfig struct {
+	// MaxInFlight caps the client API requests handled at once across the proxy.
+	MaxInFlight int `yaml:"max-in-flight,omitempty" json:"max-in-flight,omitempty"`
+	// MaxQueueWaitMs sheds new requests while the oldest request queued for a
+	// credential-concurrency slot has waited longer than this.
+	MaxQueueWaitMs int `yaml:"max-queue-wait-ms,omitempty" json:"max-queue-wait-ms,omitempty"`
+	// RetryAfterSeconds is the Retry-After sent with shed requests. Defaults to 5.
+	RetryAfterSeconds int `yaml:"retry-after-seconds,omitempty" json:"retry-after-seconds,omitempty"`
+}
+
+// AuthRefreshConfig tunes proactive OAuth token renewal. A credential is refreshed
+// once it enters its provider's refresh lead before expiry rather than after a
+// request fails with an expired token.
+type AuthRefreshConfig struct {
+	// JitterPercent widens each credential's refresh lead by a stable share of up to
+	// this percentage, so tokens issued together are not renewed in the same tick.
+	// Defaults to 10; a negative value disables jitter.
+	JitterPercent int `yaml:"jitter-percent,omitempty" json:"jitter-percent,omitempty"`
+	// MaxBackoffSeconds caps the delay between failed refresh attempts, which starts
+	// at five minutes and doubles per consecutive failure. Defaults to 1800.
+	MaxBackoffSeconds int `yaml:"max-backoff-seconds,omitempty" json:"max-backoff-seconds,omitempty"`
+}
+
+// JitterFraction returns the configured jitter as a fraction of the refresh lead.
+func (a AuthRefreshConfig) JitterFraction() float64 {
+	switch {
+	case a.JitterPercent < 0:
+		return 0
+	case a.JitterPercent == 0:
+		return 0.1
+	default:
+		return float64(min(a.JitterPercent, 100)) / 100
+	}
+}
+
+// SessionAffinityConfig controls sticky routing by conversation ID, which keeps
+// providers with server-side prompt caching on a warm cache.
+type SessionAffinityConfig struct {
+	// Enabled turns sticky routing on.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// TTLSeconds is how long an idle conversation stays bound. Defaults to 3600.
+	TTLSeconds int `yaml:"ttl-seconds,omitempty" json:"ttl-seconds,omitempty"`
+	// Persist also stores bindings in the usage database so they survive restarts.
+	Persist bool `yaml:"persist,omitempty" json:"persist,omitempty"`
+}
+
+// NetworkAccessConfig holds source IP controls for the client API (/v1, /v1beta).
+type NetworkAccessConfig struct {
+	// AllowedCIDRs, when set, lists the only networks client keys may connect from.
+	AllowedCIDRs []string `yaml:"allowed-cidrs,omitempty" json:"allowed-cidrs,omitempty"`
+	// APIKeys overrides AllowedCIDRs for individual client keys.
+	APIKeys []NetworkKeyRule `yaml:"api-keys,omitempty" json:"api-keys,omitempty"`
+	// RequestsPerMinute caps requests per client IP; 0 disables rate limiting.
+	RequestsPerMinute int `yaml:"requests-per-minute,omitempty" json:"requests-per-minute,omitempty"`
+	// Burst is the number of requests an idle IP may send at once. Defaults to RequestsPerMinute.
+	Burst int `yaml:"burst,omitempty" json:"burst,omitempty"`
+	// ExemptCIDRs are never rate limited (e.g., internal services).
+	ExemptCIDRs []string `yaml:"exempt-cidrs,omitempty" json:"exempt-cidrs,omitempty"`
+}
+
+// NetworkKeyRule binds a client API key to the networks it may connect from.
+type NetworkKeyRule struct {
+	// APIKey is the client key (from api-keys) the rule applies to.
+	APIKey string `yaml:"api-key" json:"api-key"`
+	// AllowedCIDRs lists networks (or single IPs) the key may be used from.
+	AllowedCIDRs []string `yaml:"allowed-cidrs" json:"allowed-cidrs"`
+}
+
+// RequestSizeLimitsConfig caps the size of client API request bodies. Limits are
+// enforced while the body is read, so oversized uploads are cut off instead of
+// buffered. Zero means unlimited.
+type RequestSizeLimitsConfig struct {
+	// MaxBodyBytes is the default limit for every client API route.
+	MaxBodyBytes int64 `yaml:"max-body-bytes,omitempty" json:"max-body-bytes,omitempty"`
+	// Routes override MaxBodyBytes for request paths; the longest matching prefix wins.
+	Routes []RequestSizeRoute `yaml:"routes,omitempty" json:"routes,omitempty"`
+	// APIKeys tighten the route limit for individual client keys. The route limit is
+	// checked before authentication, so a key limit can lower it but not raise it.
+	APIKeys []RequestSizeKeyRule `yaml:"api-keys,omitempty" json:"api-keys,omitempty"`
+	// MaxMediaBytes caps the decoded size of each inline image or document.
+	MaxMediaBytes int64 `yaml:"max-media-bytes,omitempty" json:"max-media-bytes,omitempty"`
+	// MaxRequestMediaBytes caps the decoded size of all inline media of a request.
+	MaxRequestMediaBytes int64 `yaml:"max-request-media-bytes,omitempty" json:"max-request-media-bytes,omitempty"`
+}
+
+// IdempotencyConfig controls Idempotency-Key handling for non-streaming client API
+// requests. Successful responses are kept in memory per client key and replayed to
+// retries with the same key, so a retry after a network error is not billed twice.
+type IdempotencyConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// TTLSeconds is how long a response is replayed (default 86400).
+	TTLSeconds int `yaml:"ttl-seconds,omitempty" json:"ttl-seconds,omitempty"`
+	// MaxEntries bounds the stored responses; the oldest are evicted first (default 10000).
+	MaxEntries int `yaml:"max-entries,omitempty" json:"max-entries,omitempty"`
+	// MaxResponseBytes is the largest response body stored (default 1048576). Larger
+	// responses are not replayable.
+	MaxResponseBytes int64 `yaml:"max-response-bytes,omitempty" json:"max-response-bytes,omitempty"`
+}
+
+// ClientAttributionConfig controls which client details are stored with usage records
+// to investigate shared keys. Client IPs are only stored as salted fingerprints.
+type ClientAttributionConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// TrustedProxies lists reverse proxies (CIDRs or IPs) whose forwarding header is
+	// believed. Without it the TCP peer address is the client IP. It also applies to
+	// network-access allowlists and rate limits while attribution is disabled.
+	TrustedProxies []string `yaml:"trusted-proxies,omitempty" json:"trusted-proxies,omitempty"`
+	// ClientIPHeader is the header trusted proxies append the client address to.
+	// Defaults to X-Forwarded-For.
+	ClientIPHeader string `yaml:"client-ip-header,omitempty" json:"client-ip-header,omitempty"`
+	// GeoIPDatabase is a CSV file of "start-ip,end-ip,country" ranges (e.g. DB-IP's
+	// IP-to-Country Lite download) used to derive the client country.
+	GeoIPDatabase string `yaml:"geoip-database,omitempty" json:"geoip-database,omitempty"`
+}
+
+// RequestSizeRoute sets the body limit for request paths starting with Path.
+type RequestSizeRoute struct {
+	Path         string `yaml:"path" json:"path"`
+	MaxBodyBytes int64  `yaml:"max-body-bytes" json:"max-body-bytes"`
+}
+
+// RequestSizeKeyRule sets the body limit for one client API key.
+type RequestSizeKeyRule struct {
+	// APIKey is the client key (from api-keys) the rule applies to.
+	APIKey       string `yaml:"api-key" json:"api-key"`
+	MaxBodyBytes int64  `yaml:"max-body-bytes" json:"max-body-bytes"`
+	// MaxMediaBytes and MaxRequestMediaBytes replace the default media limits for the
+	// key. Media is checked after authentication, so they may raise the defaults.
+	MaxMediaBytes        int64 `yaml:"max-media-bytes,omitempty" json:"max-media-bytes,omitempty"`
+	MaxRequestMediaBytes int64 `yaml:"max-request-media-bytes,omitempty" json:"max-request-media-bytes,omitempty"`
 }
 
 // QuotaExceeded defines the behavior when API quota limits are exceeded.
@@ -129,6 +453,15 @@ type QuotaExceeded struct {
 
 	// SwitchPreviewModel indicates whether to automatically switch to a preview model when a quota is exceeded.
 	SwitchPreviewModel bool `yaml:"switch-preview-model" json:"switch-preview-model"`
+
+	// SwitchCredential retries a rate-limited (429) request on another credential before
+	// returning the error to the client. Defaults to true.
+	SwitchCredential *bool `yaml:"switch-credential,omitempty" json:"switch-credential,omitempty"`
+}
+
+// SwitchCredentialEnabled reports whether rate-limited requests fail over to another credential.
+func (q QuotaExceeded) SwitchCredentialEnabled() bool {
+	return q.SwitchCredential == nil || *q.SwitchCredential
 }
 
 // AmpModelMapping defines a model name mapping for Amp CLI requests.
@@ -167,6 +500,30 @@ type AmpCode struct {
 	ForceModelMappings bool `yaml:"force-model-mappings" json:"force-model-mappings"`
 }
 
+// PromptCachingConfig controls the cache_control breakpoints injected into Claude
+// requests that do not set any themselves. Requests that already carry cache_control
+// are passed through untouched.
+type PromptCachingConfig struct {
+	// AutoInject marks the tool definitions, the system prompt and the conversation
+	// up to the latest user turn as cacheable.
+	AutoInject bool `yaml:"auto-inject" json:"auto-inject"`
+	// MinPromptChars skips requests whose messages, system prompt and tools are
+	// shorter, since Anthropic does not cache prompts under 1024 tokens and cache
+	// writes cost more than plain input. Defaults to 4096.
+	MinPromptChars int `yaml:"min-prompt-chars,omitempty" json:"min-prompt-chars,omitempty"`
+}
+
+// DefaultPromptCacheMinChars is the MinPromptChars used when unset.
+const DefaultPromptCacheMinChars = 4096
+
+// MinChars returns the effective minimum prompt size for injection.
+func (c PromptCachingConfig) MinChars() int {
+	if c.MinPromptChars > 0 {
+		return c.MinPromptChars
+	}
+	return DefaultPromptCacheMinChars
+}
+
 // PayloadConfig defines default and override parameter rules applied to provider payloads.
 type PayloadConfig struct {
 	// Default defines rules that only set parameters when they are missing in the payload.
@@ -176,11 +533,20 @@ type PayloadConfig struct {
 }
 
 // PayloadRule describes a single rule targeting a list of models with parameter updates.
+// A rule applies when every selector it sets (models, providers, api-keys) matches;
+// a rule without any selector never applies.
 type PayloadRule struct {
 	// Models lists model entries with name pattern and protocol constraint.
 	Models []PayloadModelRule `yaml:"models" json:"models"`
+	// Providers restricts the rule to executor identifiers (e.g., "claude", "codex", "gemini").
+	Providers []string `yaml:"providers,omitempty" json:"providers,omitempty"`
+	// APIKeys restricts the rule to requests authenticated with the listed client keys.
+	APIKeys []string `yaml:"api-keys,omitempty" json:"api-keys,omitempty"`
 	// Params maps JSON paths (gjson/sjson syntax) to values written into the payload.
 	Params map[string]any `yaml:"params" json:"params"`
+	// SystemPromptPrefix is placed ahead of the request's system prompt. Default rules
+	// only add it when the request has no system prompt.
+	SystemPromptPrefix string `yaml:"system-prompt-prefix,omitempty" json:"system-prompt-prefix,omitempty"`
 }
 
 // PayloadModelRule ties a model name pattern to a specific translator protocol.
@@ -193,14 +559,224 @@ type PayloadModelRule struct {
 
 // OTLPConfig holds OpenTelemetry configuration settings.
 type OTLPConfig struct {
-	// Enabled toggles OTLP telemetry export.
-	Enabled bool `yaml:"enabled" json:"enabled"`
-	// Endpoint is the OTLP HTTP/JSON endpoint to send telemetry to.
-	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// Enabled toggles OTLP telemetry export. Export stays on when unset.
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// Endpoint is the OTLP collector URL. Falls back to DY_NOTI_OTEL_ENDPOINT when empty.
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	// Endpoints are fallback collectors, tried in order when Endpoint is down.
+	Endpoints []string `yaml:"endpoints,omitempty" json:"endpoints,omitempty"`
+	// SRV discovers collectors from a DNS SRV record; its targets are preferred over
+	// Endpoint and Endpoints.
+	SRV OTLPSRVConfig `yaml:"srv,omitempty" json:"srv,omitempty"`
 	// TimeoutMs is the timeout in milliseconds for OTLP requests.
-	TimeoutMs int `yaml:"timeout_ms" json:"timeout_ms"`
-	// BatchSize controls how many events are batched before sending.
-	BatchSize int `yaml:"batch_size" json:"batch_size"`
+	TimeoutMs int `yaml:"timeout_ms,omitempty" json:"timeout_ms,omitempty"`
+	// BatchSize controls how many events are sent per export request. Defaults to 10;
+	// 1 sends each event as it arrives.
+	BatchSize int `yaml:"batch_size,omitempty" json:"batch_size,omitempty"`
+	// FlushIntervalMs bounds how long a partial batch waits. Defaults to 5000.
+	FlushIntervalMs int `yaml:"flush_interval_ms,omitempty" json:"flush_interval_ms,omitempty"`
+	// Protocol selects "http/json" (default) or "grpc". Endpoints with a grpc:// or
+	// grpcs:// scheme always use gRPC.
+	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+	// Headers are sent with every export request, e.g. collector authentication.
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// TLSCAFile is a PEM bundle used to verify the collector certificate.
+	TLSCAFile string `yaml:"tls_ca_file,omitempty" json:"tls_ca_file,omitempty"`
+	// TLSInsecureSkipVerify disables collector certificate verification.
+	TLSInsecureSkipVerify bool `yaml:"tls_insecure_skip_verify,omitempty" json:"tls_insecure_skip_verify,omitempty"`
+	// Spool persists events to disk while the collector is unreachable and replays
+	// them once exports succeed again.
+	Spool OTLPSpoolConfig `yaml:"spool,omitempty" json:"spool,omitempty"`
+	// Sampling exports only a share of usage events. Every event is exported when unset.
+	Sampling OTLPSamplingConfig `yaml:"sampling,omitempty" json:"sampling,omitempty"`
+	// ResourceAttributes are attached to every exported log and span, e.g. service.name,
+	// deployment.environment or instance.id. service.name defaults to cli-proxy-api.
+	ResourceAttributes map[string]string `yaml:"resource_attributes,omitempty" json:"resource_attributes,omitempty"`
+	// ExcludeEvents lists events not exported, e.g. circuit.opened. Lifecycle events
+	// (credential refreshes, circuit breaker, budgets, config reloads) are exported next
+	// to usage.record unless excluded; a name ending in "." excludes a whole family.
+	ExcludeEvents []string `yaml:"exclude_events,omitempty" json:"exclude_events,omitempty"`
+}
+
+// OTLPSamplingConfig selects which usage events are exported over OTLP.
+type OTLPSamplingConfig struct {
+	// Percentage of events exported, from 0 to 100. Defaults to 100.
+	Percentage *float64 `yaml:"percentage,omitempty" json:"percentage,omitempty"`
+	// AlwaysSampleFailures exports every failed request regardless of the percentage.
+	AlwaysSampleFailures bool `yaml:"always_sample_failures,omitempty" json:"always_sample_failures,omitempty"`
+	// Providers overrides the percentage for individual providers.
+	Providers map[string]float64 `yaml:"providers,omitempty" json:"providers,omitempty"`
+}
+
+// OTLPSRVConfig names a DNS SRV record listing OTLP collectors.
+type OTLPSRVConfig struct {
+	// Name is the full record name, e.g. _otlp._tcp.collectors.example.com.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Scheme of the discovered collectors: http (default), https, grpc or grpcs.
+	Scheme string `yaml:"scheme,omitempty" json:"scheme,omitempty"`
+	// Path is appended to discovered http(s) collectors. Defaults to /v1/logs.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+}
+
+// OTLPSpoolConfig bounds the on-disk OTLP event spool. The spool is off unless Dir is set.
+type OTLPSpoolConfig struct {
+	// Dir holds the spool segment files.
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	// MaxSizeMB caps the spool size; the oldest events are dropped beyond it. Defaults to 64.
+	MaxSizeMB int `yaml:"max_size_mb,omitempty" json:"max_size_mb,omitempty"`
+	// MaxAgeHours drops spooled events older than this. Defaults to 24.
+	MaxAgeHours int `yaml:"max_age_hours,omitempty" json:"max_age_hours,omitempty"`
+}
+
+// IsEnabled reports whether OTLP export is on, defaulting to true when unset.
+func (o OTLPConfig) IsEnabled() bool {
+	return o.Enabled == nil || *o.Enabled
+}
+
+// CredentialEncryptionConfig selects the master key used to encrypt auth files.
+// Exactly one source is used, in order of precedence: key-command, key-file, key-env.
+type CredentialEncryptionConfig struct {
+	// Enabled turns on AES-GCM encryption of credential files.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// KeyEnv names the environment variable holding the key. Defaults to CLIPROXY_MASTER_KEY.
+	KeyEnv string `yaml:"key-env,omitempty" json:"key-env,omitempty"`
+	// KeyFile points at a file holding the key; rotation rewrites it.
+	KeyFile string `yaml:"key-file,omitempty" json:"key-file,omitempty"`
+	// KeyCommand is a shell command printing the key, e.g. a KMS decrypt call.
+	KeyCommand string `yaml:"key-command,omitempty" json:"key-command,omitempty"`
+}
+
+// SecretsConfig holds settings for external secret backends. Provider API key fields
+// may contain "vault:<path>#<field>" or "env:<NAME>" references instead of literal keys.
+type SecretsConfig struct {
+	// RefreshIntervalSeconds controls how often static secrets are re-read. Defaults to 300.
+	RefreshIntervalSeconds int `yaml:"refresh-interval-seconds,omitempty" json:"refresh-interval-seconds,omitempty"`
+	// Vault configures the HashiCorp Vault backend.
+	Vault VaultConfig `yaml:"vault,omitempty" json:"vault,omitempty"`
+}
+
+// VaultConfig describes how to reach Vault. The token itself never lives in this file.
+type VaultConfig struct {
+	// Enabled turns on "vault:" references.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Address is the Vault URL. Defaults to the VAULT_ADDR environment variable.
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+	// TokenEnv names the environment variable holding the token. Defaults to VAULT_TOKEN.
+	TokenEnv string `yaml:"token-env,omitempty" json:"token-env,omitempty"`
+	// TokenFile is re-read on every request, e.g. a Vault agent token sink.
+	TokenFile string `yaml:"token-file,omitempty" json:"token-file,omitempty"`
+	// Namespace is the Vault Enterprise namespace.
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+}
+
+// StatsDConfig holds settings for the StatsD/DogStatsD UDP metric sink.
+type StatsDConfig struct {
+	// Enabled toggles metric emission.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Address is the agent's UDP host:port. Defaults to 127.0.0.1:8125.
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+	// Prefix is prepended to every metric name. Defaults to "cliproxy".
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	// Flavor selects "datadog" (tagged DogStatsD, default) or "statsd" (plain lines).
+	Flavor string `yaml:"flavor,omitempty" json:"flavor,omitempty"`
+	// Tags are constant "key:value" tags added to every metric (datadog flavor only).
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// PrometheusConfig controls the Prometheus scrape endpoint.
+type PrometheusConfig struct {
+	// Enabled serves GET /metrics and records request counts, durations and in-flight
+	// requests per route template, management endpoints included.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Buckets are the upper bounds in seconds of the request duration histogram.
+	// Defaults to 0.005 through 60 seconds.
+	Buckets []float64 `yaml:"buckets,omitempty" json:"buckets,omitempty"`
+	// BearerToken, when set, must be presented as "Authorization: Bearer <token>" to scrape.
+	BearerToken string `yaml:"bearer-token,omitempty" json:"-"`
+}
+
+// UsageSinkConfig describes an external usage sink process.
+type UsageSinkConfig struct {
+	// Name identifies the sink in logs and the telemetry status.
+	Name string `yaml:"name" json:"name"`
+	// Command is the executable to start; it is restarted with backoff when it exits.
+	Command string `yaml:"command" json:"command"`
+	// Args are passed to Command.
+	Args []string `yaml:"args,omitempty" json:"args,omitempty"`
+	// Env adds variables to the environment inherited from the proxy.
+	Env map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	// QueueSize bounds the records buffered while the process is slow or restarting.
+	// Records beyond it are dropped and counted. Defaults to 1000.
+	QueueSize int `yaml:"queue-size,omitempty" json:"queue-size,omitempty"`
+	// Disabled keeps the entry in the config without starting it.
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+}
+
+// KafkaConfig holds settings for the Kafka usage event publisher.
+type KafkaConfig struct {
+	// Enabled toggles publishing.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Brokers are the bootstrap brokers as host:port.
+	Brokers []string `yaml:"brokers,omitempty" json:"brokers,omitempty"`
+	// Topic receives one message per usage record, keyed by the client API key hash.
+	Topic string `yaml:"topic,omitempty" json:"topic,omitempty"`
+	// ClientID identifies the producer to the brokers. Defaults to "cliproxy".
+	ClientID string `yaml:"client-id,omitempty" json:"client-id,omitempty"`
+	// Format selects "json" (default) or "avro" (Avro single-object encoding).
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+	// Acks selects "all" (default), "leader" or "none".
+	Acks string `yaml:"acks,omitempty" json:"acks,omitempty"`
+	// BatchSize is the number of records sent per produce request. Defaults to 100.
+	BatchSize int `yaml:"batch-size,omitempty" json:"batch-size,omitempty"`
+	// FlushIntervalMs bounds how long a partial batch waits. Defaults to 1000.
+	FlushIntervalMs int `yaml:"flush-interval-ms,omitempty" json:"flush-interval-ms,omitempty"`
+	// TimeoutMs bounds each broker request. Defaults to 10000.
+	TimeoutMs int `yaml:"timeout-ms,omitempty" json:"timeout-ms,omitempty"`
+	// QueueSize bounds the records waiting to be sent; overflow is dropped and counted.
+	// Defaults to 10000.
+	QueueSize int `yaml:"queue-size,omitempty" json:"queue-size,omitempty"`
+	// TLS configures encrypted broker connections.
+	TLS KafkaTLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+	// SASL configures broker authentication.
+	SASL KafkaSASLConfig `yaml:"sasl,omitempty" json:"sasl,omitempty"`
+}
+
+// KafkaTLSConfig enables TLS for broker connections.
+type KafkaTLSConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// CAFile is a PEM bundle used to verify broker certificates.
+	CAFile string `yaml:"ca-file,omitempty" json:"ca-file,omitempty"`
+	// InsecureSkipVerify disables broker certificate verification.
+	InsecureSkipVerify bool `yaml:"insecure-skip-verify,omitempty" json:"insecure-skip-verify,omitempty"`
+}
+
+// KafkaSASLConfig selects the SASL mechanism used to authenticate to the brokers.
+type KafkaSASLConfig struct {
+	// Mechanism is "PLAIN", "SCRAM-SHA-256" or "SCRAM-SHA-512". Empty disables SASL.
+	Mechanism string `yaml:"mechanism,omitempty" json:"mechanism,omitempty"`
+	Username  string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password  string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// RedisConfig points proxy instances at a shared Redis so per-IP rate limits and
+// monthly spend caps are enforced across all of them. While Redis is unreachable
+// every instance falls back to enforcing limits from its own state.
+type RedisConfig struct {
+	// Enabled toggles the Redis backend.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Address is the server as host:port.
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+	// Username selects an ACL user (Redis 6+); empty authenticates with Password only.
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"-"`
+	// DB is the logical database index.
+	DB int `yaml:"db,omitempty" json:"db,omitempty"`
+	// KeyPrefix namespaces every key written by the proxy. Defaults to "cliproxy:".
+	KeyPrefix string `yaml:"key-prefix,omitempty" json:"key-prefix,omitempty"`
+	// TLS enables encrypted connections.
+	TLS KafkaTLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+	// TimeoutMs bounds each command, including connecting. Defaults to 250.
+	TimeoutMs int `yaml:"timeout-ms,omitempty" json:"timeout-ms,omitempty"`
 }
 
 // UsageDatabaseConfig describes the settings for the quota usage store.
@@ -211,6 +787,390 @@ type UsageDatabaseConfig struct {
 	Path string `yaml:"path" json:"path"`
 	// RetentionDays controls how long to keep historical rows.
 	RetentionDays int `yaml:"retention-days" json:"retention-days"`
+	// RequestsRetentionDays overrides RetentionDays for per-request detail rows (usage_requests).
+	RequestsRetentionDays int `yaml:"requests-retention-days,omitempty" json:"requests-retention-days,omitempty"`
+	// DailyRetentionDays overrides RetentionDays for daily aggregate rows (usage_daily).
+	DailyRetentionDays int `yaml:"daily-retention-days,omitempty" json:"daily-retention-days,omitempty"`
+	// ProviderRetentionDays overrides request detail retention per provider (e.g., claude: 90).
+	ProviderRetentionDays map[string]int `yaml:"provider-retention-days,omitempty" json:"provider-retention-days,omitempty"`
+	// CredentialRetentionDays overrides request detail retention per credential and takes
+	// precedence over provider overrides. Keys are auth IDs, API keys or credential
+	// fingerprints; they are resolved to fingerprints when retention runs.
+	CredentialRetentionDays map[string]int `yaml:"credential-retention-days,omitempty" json:"credential-retention-days,omitempty"`
+	// ReadOnly opens an existing database for queries only, e.g. for a reporting instance
+	// pointed at a file written by another proxy. Usage records are not persisted.
+	ReadOnly bool `yaml:"read-only,omitempty" json:"read-only,omitempty"`
+	// QueueSize is the capacity of the in-memory write queue (default 2048).
+	QueueSize int `yaml:"queue-size,omitempty" json:"queue-size,omitempty"`
+	// OverflowPolicy decides what happens when the write queue is full:
+	// "block" (default), "drop-newest", "drop-oldest", or "spill" to a file next to the database.
+	OverflowPolicy string `yaml:"overflow-policy,omitempty" json:"overflow-policy,omitempty"`
+	// SQLite tunes the connection pragmas of the database file.
+	SQLite UsageSQLiteConfig `yaml:"sqlite,omitempty" json:"sqlite,omitempty"`
+	// HashAccountEmail stores a SHA-256 of the OAuth account email in the account_email
+	// columns instead of the address.
+	HashAccountEmail bool `yaml:"hash-account-email,omitempty" json:"hash-account-email,omitempty"`
+	// ModelPrices maps model names to USD prices per million tokens. They are copied into
+	// the usage_model_prices table that the v_cost_by_key_day view joins against.
+	ModelPrices map[string]ModelPrice `yaml:"model-prices,omitempty" json:"model-prices,omitempty"`
+	// FingerprintSalt keys the HMAC-SHA256 used to fingerprint API keys, auth IDs and
+	// hashed emails. When empty the environment variable named by FingerprintSaltEnv
+	// is used; without either, fingerprints are plain SHA-256.
+	FingerprintSalt string `yaml:"fingerprint-salt,omitempty" json:"-"`
+	// FingerprintSaltEnv names the environment variable holding the salt. Defaults to
+	// CLIPROXY_FINGERPRINT_SALT.
+	FingerprintSaltEnv string `yaml:"fingerprint-salt-env,omitempty" json:"fingerprint-salt-env,omitempty"`
+	// ProviderQuotas maps provider names to the quota each of their credentials gets.
+	// They are used to forecast when a credential will run out at its current burn rate.
+	ProviderQuotas map[string]ProviderQuota `yaml:"provider-quotas,omitempty" json:"provider-quotas,omitempty"`
+	// ExportSigningKey is the path to a PEM-encoded Ed25519 private key (PKCS #8, as
+	// written by "openssl genpkey -algorithm ed25519") used to sign usage exports.
+	ExportSigningKey string `yaml:"export-signing-key,omitempty" json:"export-signing-key,omitempty"`
+	// Archive uploads usage_requests rows to object storage before retention deletes them.
+	Archive UsageArchiveConfig `yaml:"archive,omitempty" json:"archive,omitempty"`
+	// Reports schedules usage summaries rendered from usage_daily and delivered by
+	// email or webhook.
+	Reports UsageReportsConfig `yaml:"reports,omitempty" json:"reports,omitempty"`
+	// DualWrite mirrors every usage record into a second backend while switching
+	// storage, so both stores can be compared before the switch.
+	DualWrite UsageDualWriteConfig `yaml:"dual-write,omitempty" json:"dual-write,omitempty"`
+	// Encryption encrypts credential labels, account emails and client labels before
+	// they are stored. API key and credential hashes are keyed by FingerprintSalt.
+	Encryption UsageEncryptionConfig `yaml:"encryption,omitempty" json:"encryption,omitempty"`
+}
+
+// UsageEncryptionConfig selects the key used to encrypt sensitive usage-db columns.
+// Exactly one source is used, in order of precedence: key-command, key-file, key-env.
+type UsageEncryptionConfig struct {
+	// Enabled turns on AES-GCM encryption of label and email columns.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// KeyEnv names the environment variable holding the key. Defaults to CLIPROXY_USAGE_DB_KEY.
+	KeyEnv string `yaml:"key-env,omitempty" json:"key-env,omitempty"`
+	// KeyFile points at a file holding the key.
+	KeyFile string `yaml:"key-file,omitempty" json:"key-file,omitempty"`
+	// KeyCommand is a shell command printing the key, e.g. a KMS decrypt call.
+	KeyCommand string `yaml:"key-command,omitempty" json:"key-command,omitempty"`
+}
+
+// UsageDualWriteConfig configures mirroring of usage-db writes into PostgreSQL.
+type UsageDualWriteConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// DSN is the postgres:// connection string of the target database.
+	DSN string `yaml:"dsn,omitempty" json:"-"`
+}
+
+// UsageSQLiteConfig tunes the SQLite pragmas set on every usage database connection.
+// Zero values keep the defaults: WAL journaling, the SQLite default synchronous level
+// and cache size, a 5 second busy timeout and no memory mapping.
+type UsageSQLiteConfig struct {
+	// JournalMode is one of wal, delete, truncate, persist, memory or off.
+	JournalMode string `yaml:"journal-mode,omitempty" json:"journal-mode,omitempty"`
+	// Synchronous is one of off, normal, full or extra.
+	Synchronous string `yaml:"synchronous,omitempty" json:"synchronous,omitempty"`
+	// CacheSizeKB is the page cache size per connection in KiB.
+	CacheSizeKB int `yaml:"cache-size-kb,omitempty" json:"cache-size-kb,omitempty"`
+	// BusyTimeoutMs is how long a connection waits for a lock held by another one.
+	BusyTimeoutMs int `yaml:"busy-timeout-ms,omitempty" json:"busy-timeout-ms,omitempty"`
+	// MmapSizeMB enables memory-mapped I/O of up to this many MiB of the file.
+	MmapSizeMB int `yaml:"mmap-size-mb,omitempty" json:"mmap-size-mb,omitempty"`
+}
+
+// UsageReportsConfig configures scheduled usage report delivery.
+type UsageReportsConfig struct {
+	// SMTP is the mail server used for recipients with email addresses.
+	SMTP UsageReportSMTPConfig `yaml:"smtp,omitempty" json:"smtp,omitempty"`
+	// Recipients each get their own report on their own schedule.
+	Recipients []UsageReportRecipient `yaml:"recipients,omitempty" json:"recipients,omitempty"`
+}
+
+// UsageReportSMTPConfig is the outgoing mail server of usage reports.
+type UsageReportSMTPConfig struct {
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	// Port defaults to 587, or 465 with TLS.
+	Port     int    `yaml:"port,omitempty" json:"port,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"-"`
+	// From is the sender address.
+	From string `yaml:"from,omitempty" json:"from,omitempty"`
+	// TLS connects with implicit TLS (SMTPS) instead of upgrading with STARTTLS.
+	TLS bool `yaml:"tls,omitempty" json:"tls,omitempty"`
+}
+
+// UsageReportRecipient is one scheduled usage report.
+type UsageReportRecipient struct {
+	// Name identifies the report in logs, the telemetry status and the management API.
+	Name string `yaml:"name" json:"name"`
+	// Email lists the addresses the report is mailed to.
+	Email []string `yaml:"email,omitempty" json:"email,omitempty"`
+	// Webhook receives the report as a JSON POST.
+	Webhook string `yaml:"webhook,omitempty" json:"webhook,omitempty"`
+	// Schedule is "daily" (default) or "weekly".
+	Schedule string `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	// Time is the local "HH:MM" the report is sent at (default "08:00").
+	Time string `yaml:"time,omitempty" json:"time,omitempty"`
+	// Weekday is the day weekly reports are sent on (default "monday").
+	Weekday string `yaml:"weekday,omitempty" json:"weekday,omitempty"`
+	// Timezone is the IANA zone Time and Weekday are read in (default UTC).
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	// TopModels is the number of models listed in the report (default 5).
+	TopModels int `yaml:"top-models,omitempty" json:"top-models,omitempty"`
+	// Disabled keeps the entry in the config without scheduling it.
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+}
+
+// UsageArchiveConfig configures archival of expired usage_requests rows to S3-compatible
+// object storage. Google Cloud Storage works through its XML API endpoint
+// (storage.googleapis.com) with HMAC keys.
+type UsageArchiveConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Endpoint is the host[:port] of the object store, e.g. "s3.us-east-1.amazonaws.com".
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	Bucket   string `yaml:"bucket" json:"bucket"`
+	// Prefix is prepended to every object key.
+	Prefix    string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Region    string `yaml:"region,omitempty" json:"region,omitempty"`
+	AccessKey string `yaml:"access-key" json:"-"`
+	SecretKey string `yaml:"secret-key" json:"-"`
+	// Insecure talks plain HTTP to the endpoint, e.g. a local MinIO.
+	Insecure bool `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+	// PathStyle addresses the bucket in the URL path instead of the host name.
+	PathStyle bool `yaml:"path-style,omitempty" json:"path-style,omitempty"`
+	// Format is the object encoding. Only "jsonl" (gzip-compressed JSON lines, the
+	// default) is supported.
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+	// TimeoutSeconds bounds one upload (default 120).
+	TimeoutSeconds int `yaml:"timeout-seconds,omitempty" json:"timeout-seconds,omitempty"`
+}
+
+// ProviderQuota is the per-credential allowance of a provider within a calendar window.
+type ProviderQuota struct {
+	// Requests is the number of requests allowed per window; zero means unlimited.
+	Requests int64 `yaml:"requests,omitempty" json:"requests,omitempty"`
+	// Tokens is the number of total tokens allowed per window; zero means unlimited.
+	Tokens int64 `yaml:"tokens,omitempty" json:"tokens,omitempty"`
+	// Window is the UTC calendar period the quota resets on: "hour", "day" (default) or "month".
+	Window string `yaml:"window,omitempty" json:"window,omitempty"`
+}
+
+// ModelPrice is the USD price per million prompt and completion tokens of a model.
+type ModelPrice struct {
+	InputPerMillion  float64 `yaml:"input" json:"input"`
+	OutputPerMillion float64 `yaml:"output" json:"output"`
+	// CachedInputPerMillion prices prompt tokens served from the provider's prompt cache.
+	// Zero assumes a 90% discount on InputPerMillion.
+	CachedInputPerMillion float64 `yaml:"cached-input,omitempty" json:"cached-input,omitempty"`
+}
+
+// ClassificationRule assigns a tag to requests whose selected field matches Pattern.
+type ClassificationRule struct {
+	// Tag is the label attached to matching requests (e.g., "code", "support").
+	Tag string `yaml:"tag" json:"tag"`
+	// Match selects the inspected field: "prompt" (default), "model", "path", or "header".
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
+	// Header names the request header inspected when Match is "header".
+	Header string `yaml:"header,omitempty" json:"header,omitempty"`
+	// Pattern is a regular expression evaluated against the selected field.
+	Pattern string `yaml:"pattern" json:"pattern"`
+}
+
+// Workspace maps a set of client API keys to a named tenant. Credentials can be
+// restricted to workspaces via the "sharing" and "workspaces" fields of their auth file.
+type Workspace struct {
+	// Name identifies the workspace in credential sharing policies.
+	Name string `yaml:"name" json:"name"`
+	// APIKeys lists the client keys (from api-keys) that belong to this workspace.
+	APIKeys []string `yaml:"api-keys" json:"api-keys"`
+}
+
+// Team groups client API keys. A key belongs to at most one team, and the team is
+// recorded on each of the key's usage records.
+type Team struct {
+	// Name identifies the team in usage reports and the management API.
+	Name string `yaml:"name" json:"name"`
+	// APIKeys lists the client keys (from api-keys) that belong to this team.
+	APIKeys []string `yaml:"api-keys" json:"api-keys"`
+	// Policy applies to member keys without an api-key-policies entry of their own.
+	// Its api-key and monthly-spend-cap fields are ignored.
+	Policy APIKeyPolicy `yaml:"policy,omitempty" json:"policy,omitempty"`
+	// MonthlySpendCap is a hard USD cap on the combined priced spend of all member
+	// keys per calendar month. Once reached every member key is suspended until an
+	// administrator resets the team. Zero disables the cap.
+	MonthlySpendCap float64 `yaml:"monthly-spend-cap,omitempty" json:"monthly-spend-cap,omitempty"`
+	// RequestsPerMinute caps the combined request rate of all member keys; requests
+	// beyond it are answered with 429. Zero disables the quota.
+	RequestsPerMinute int `yaml:"requests-per-minute,omitempty" json:"requests-per-minute,omitempty"`
+}
+
+// EffectiveAPIKeyPolicies returns the api-key-policies followed by the team policies
+// of member keys that have no policy of their own.
+func (cfg *Config) EffectiveAPIKeyPolicies() []APIKeyPolicy {
+	if cfg == nil {
+		return nil
+	}
+	if len(cfg.Teams) == 0 {
+		return cfg.APIKeyPolicies
+	}
+	own := make(map[string]struct{}, len(cfg.APIKeyPolicies))
+	for _, p := range cfg.APIKeyPolicies {
+		own[strings.TrimSpace(p.APIKey)] = struct{}{}
+	}
+	out := append([]APIKeyPolicy(nil), cfg.APIKeyPolicies...)
+	for _, team := range cfg.Teams {
+		for _, key := range team.APIKeys {
+			key = strings.TrimSpace(key)
+			if _, ok := own[key]; ok || key == "" {
+				continue
+			}
+			own[key] = struct{}{}
+			p := team.Policy
+			p.APIKey = key
+			p.MonthlySpendCap = 0
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// APIKeyPolicy binds a client API key to the models and providers it may use.
+// Entries support '*' wildcards and are matched case-insensitively; deny lists win
+// over allow lists, and empty allow lists permit everything not denied.
+type APIKeyPolicy struct {
+	// APIKey is the client key (from api-keys) the policy applies to.
+	APIKey string `yaml:"api-key" json:"api-key"`
+	// AllowedModels, when set, lists the only models the key may request.
+	AllowedModels []string `yaml:"allowed-models,omitempty" json:"allowed-models,omitempty"`
+	// DeniedModels lists models the key may never request.
+	DeniedModels []string `yaml:"denied-models,omitempty" json:"denied-models,omitempty"`
+	// AllowedProviders, when set, lists the only providers that may serve the key.
+	AllowedProviders []string `yaml:"allowed-providers,omitempty" json:"allowed-providers,omitempty"`
+	// DeniedProviders lists providers that may never serve the key.
+	DeniedProviders []string `yaml:"denied-providers,omitempty" json:"denied-providers,omitempty"`
+	// MonthlySpendCap is a hard USD cap on the key's priced spend per calendar month.
+	// Spend is computed from usage-db model-prices; once reached the key is
+	// suspended until an administrator resets it. Zero disables the cap.
+	MonthlySpendCap float64 `yaml:"monthly-spend-cap,omitempty" json:"monthly-spend-cap,omitempty"`
+	// Priority is the key's scheduling class ("high", "normal" or "low", default
+	// "normal"). When a credential is at its concurrency limit, queued requests of
+	// higher classes receive the next free slot first.
+	Priority string `yaml:"priority,omitempty" json:"priority,omitempty"`
+}
+
+// InviteCode is a one-time code that is exchanged for a new client API key. The key
+// is added to api-keys and gets the code's policy in api-key-policies.
+type InviteCode struct {
+	// Code is the secret presented by the user.
+	Code string `yaml:"code" json:"code"`
+	// Label notes who the code was issued to; it is logged when the code is redeemed.
+	Label string `yaml:"label,omitempty" json:"label,omitempty"`
+	// ExpiresAt (RFC 3339) is when the code stops being accepted. Empty never expires.
+	ExpiresAt string `yaml:"expires-at,omitempty" json:"expires-at,omitempty"`
+	// Policy is copied for the issued key; its api-key field is ignored.
+	Policy APIKeyPolicy `yaml:"policy,omitempty" json:"policy,omitempty"`
+}
+
+// ModelRewriteRule rewrites a requested model name before provider resolution.
+// Rules are evaluated in order and the first match wins.
+type ModelRewriteRule struct {
+	// Match selects how From is compared: "exact" (default, case-insensitive) or "regex".
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
+	// From is the requested model name or, for regex rules, the pattern matched against it.
+	From string `yaml:"from" json:"from"`
+	// To is the effective model. Regex rules may reference capture groups as $1 or ${name}.
+	To string `yaml:"to" json:"to"`
+	// APIKeys limits the rule to the listed client keys; empty applies it to every key.
+	APIKeys []string `yaml:"api-keys,omitempty" json:"api-keys,omitempty"`
+	// Tags limits the rule to requests carrying at least one of the listed
+	// classification tags (see classification-rules); empty ignores tags.
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// RequestTransform rewrites the body of matching requests as the client sent it,
+// before it is translated for a provider. Every matching rule applies, in order; within
+// a rule the template runs first, then delete, default, set, max and system-prompt.
+// Paths use gjson/sjson syntax. A rule that fails leaves the body untouched.
+type RequestTransform struct {
+	// Name labels the rule in request logs.
+	Name string `yaml:"name" json:"name"`
+	// APIKeys limits the rule to the listed client keys; empty applies it to every key.
+	APIKeys []string `yaml:"api-keys,omitempty" json:"api-keys,omitempty"`
+	// Models limits the rule to requested models matching these wildcard patterns.
+	Models []string `yaml:"models,omitempty" json:"models,omitempty"`
+	// Formats limits the rule to inbound API formats ("openai", "openai-response",
+	// "claude", "gemini", "gemini-cli").
+	Formats []string `yaml:"formats,omitempty" json:"formats,omitempty"`
+	// Template is a Go text/template rendering the new JSON body. It sees .Body (the
+	// decoded body), .Raw, .Model and .Format, plus the functions json, get and raw.
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+	// Delete lists paths removed from the body, e.g. unsupported fields.
+	Delete []string `yaml:"delete,omitempty" json:"delete,omitempty"`
+	// Default sets values only where the body lacks them.
+	Default map[string]any `yaml:"default,omitempty" json:"default,omitempty"`
+	// Set always writes values, replacing what the client sent.
+	Set map[string]any `yaml:"set,omitempty" json:"set,omitempty"`
+	// Max clamps numeric values at the given paths, e.g. max_tokens: 4096.
+	Max map[string]float64 `yaml:"max,omitempty" json:"max,omitempty"`
+	// SystemPrompt replaces the client's system prompt in the request format.
+	SystemPrompt string `yaml:"system-prompt,omitempty" json:"system-prompt,omitempty"`
+}
+
+// ReasoningBudget caps the reasoning (thinking) tokens of matching requests. The
+// first rule matching the client key and model applies. Requested budgets and effort
+// levels are compared with MaxTokens using the proxy's effort-to-budget mapping;
+// responses that report more reasoning tokens than MaxTokens are flagged in usage.
+type ReasoningBudget struct {
+	// Name labels the rule in usage reports. Defaults to "rule-<n>".
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// APIKeys limits the rule to the listed client keys; empty applies it to every key.
+	APIKeys []string `yaml:"api-keys,omitempty" json:"api-keys,omitempty"`
+	// Models limits the rule to requested models matching these wildcard patterns.
+	Models []string `yaml:"models,omitempty" json:"models,omitempty"`
+	// MaxTokens is the largest reasoning budget allowed.
+	MaxTokens int `yaml:"max-tokens" json:"max-tokens"`
+	// Action is "clamp" (default) to rewrite the request to the largest budget or effort
+	// level within MaxTokens, "reject" to refuse requests asking for more, or "flag" to
+	// forward requests unchanged and only record violations.
+	Action string `yaml:"action,omitempty" json:"action,omitempty"`
+}
+
+// ProviderSpendCap limits what one upstream provider may cost per calendar month (UTC).
+// Spend is priced from the usage database, so caps need usage-db and model prices.
+type ProviderSpendCap struct {
+	// Provider is the provider name, e.g. "claude" or "openai-compatibility".
+	Provider string `yaml:"provider" json:"provider"`
+	// MonthlyCap is the USD cap for the current month.
+	MonthlyCap float64 `yaml:"monthly-cap" json:"monthly-cap"`
+	// Action is "fallback" (default) to route requests to the model's other providers
+	// once the cap is reached, or "reject" to refuse them.
+	Action string `yaml:"action,omitempty" json:"action,omitempty"`
+}
+
+// ShadowTrafficConfig duplicates a percentage of requests to a secondary model. The
+// client only ever receives the primary response; both responses are stored side by
+// side in the usage database with their latency and token counts.
+type ShadowTrafficConfig struct {
+	// Rules select the requests to shadow. The first rule matching the model wins.
+	Rules []ShadowRule `yaml:"rules,omitempty" json:"rules,omitempty"`
+	// MaxConcurrent bounds in-flight shadow requests; samples beyond it are skipped.
+	// Defaults to 4.
+	MaxConcurrent int `yaml:"max-concurrent,omitempty" json:"max-concurrent,omitempty"`
+	// TimeoutSeconds bounds each shadow request. Defaults to 120.
+	TimeoutSeconds int `yaml:"timeout-seconds,omitempty" json:"timeout-seconds,omitempty"`
+	// MaxResponseBytes truncates the stored responses. Defaults to 65536.
+	MaxResponseBytes int `yaml:"max-response-bytes,omitempty" json:"max-response-bytes,omitempty"`
+}
+
+// ShadowRule sends Percentage of the requests for Model to ShadowModel as well.
+type ShadowRule struct {
+	// Name identifies the experiment in the comparison table. Defaults to "model->shadow-model".
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Model is the routed model name to sample, or "*" for every model.
+	Model string `yaml:"model" json:"model"`
+	// ShadowModel is the model the duplicate request is sent to.
+	ShadowModel string `yaml:"shadow-model" json:"shadow-model"`
+	// ShadowProvider optionally restricts the duplicate to one provider (e.g. "gemini").
+	ShadowProvider string `yaml:"shadow-provider,omitempty" json:"shadow-provider,omitempty"`
+	// Percentage of matching requests to shadow, from 0 to 100.
+	Percentage float64 `yaml:"percentage" json:"percentage"`
 }
 
 // ClaudeKey represents the configuration for a Claude API key,
@@ -424,6 +1384,8 @@ func LoadConfigOptional(configFile string, optional bool) (*Config, error) {
 	if cfg.LogsMaxTotalSizeMB < 0 {
 		cfg.LogsMaxTotalSizeMB = 0
 	}
+	cfg.LogLevel = strings.ToLower(strings.TrimSpace(cfg.LogLevel))
+	cfg.LogComponents = NormalizeLogComponents(cfg.LogComponents)
 
 	// Sync request authentication providers with inline API keys for backwards compatibility.
 	syncInlineAccessProvider(&cfg)
@@ -445,6 +1407,7 @@ func LoadConfigOptional(configFile string, optional bool) (*Config, error) {
 
 	// Normalize OAuth provider model exclusion map.
 	cfg.OAuthExcludedModels = NormalizeOAuthExcludedModels(cfg.OAuthExcludedModels)
+	cfg.ProviderProxies = NormalizeProviderProxies(cfg.ProviderProxies)
 
 	cfg.normalizeUsageDatabase(configFile)
 
@@ -483,6 +1446,14 @@ func (c *UsageDatabaseConfig) normalize(configFile string) {
 	if c.RetentionDays <= 0 {
 		c.RetentionDays = 14
 	}
+	if c.RequestsRetentionDays < 0 {
+		c.RequestsRetentionDays = 0
+	}
+	if c.DailyRetentionDays < 0 {
+		c.DailyRetentionDays = 0
+	}
+	c.ProviderRetentionDays = NormalizeProviderRetentionDays(c.ProviderRetentionDays)
+	c.CredentialRetentionDays = NormalizeCredentialRetentionDays(c.CredentialRetentionDays)
 	if configFile == "" {
 		return
 	}
@@ -499,6 +1470,141 @@ func (c *UsageDatabaseConfig) normalize(configFile string) {
 	}
 }
 
+// NormalizeProviderRetentionDays lowercases provider keys and drops non-positive entries.
+func NormalizeProviderRetentionDays(entries map[string]int) map[string]int {
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(entries))
+	for provider, days := range entries {
+		key := strings.ToLower(strings.TrimSpace(provider))
+		if key == "" || days <= 0 {
+			continue
+		}
+		out[key] = days
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// NormalizeCredentialRetentionDays trims credential keys and drops non-positive entries.
+// Keys keep their case since auth IDs and API keys are case-sensitive.
+func NormalizeCredentialRetentionDays(entries map[string]int) map[string]int {
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(entries))
+	for credential, days := range entries {
+		key := strings.TrimSpace(credential)
+		if key == "" || days <= 0 {
+			continue
+		}
+		out[key] = days
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// NormalizeProviderProxies lowercases provider keys, trims proxy URLs and drops empty entries.
+func NormalizeProviderProxies(entries map[string]string) map[string]string {
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(entries))
+	for provider, proxyURL := range entries {
+		key := strings.ToLower(strings.TrimSpace(provider))
+		proxyURL = strings.TrimSpace(proxyURL)
+		if key == "" || proxyURL == "" {
+			continue
+		}
+		out[key] = proxyURL
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// ProviderProxyURL returns the proxy configured for provider in provider-proxies,
+// falling back to the global proxy-url.
+func (cfg *Config) ProviderProxyURL(provider string) string {
+	if cfg == nil {
+		return ""
+	}
+	if proxyURL := strings.TrimSpace(cfg.ProviderProxies[strings.ToLower(strings.TrimSpace(provider))]); proxyURL != "" {
+		return proxyURL
+	}
+	return strings.TrimSpace(cfg.ProxyURL)
+}
+
+// UpstreamConfig holds the default upstream policy and per-provider overrides keyed
+// by provider name (e.g. "claude", "gemini-cli" or an openai-compatibility name).
+type UpstreamConfig struct {
+	UpstreamPolicy `yaml:",inline" json:",inline"`
+	Providers      map[string]UpstreamPolicy `yaml:"providers,omitempty" json:"providers,omitempty"`
+}
+
+// UpstreamPolicy configures timeouts and retries of upstream provider calls. Zero
+// values disable a limit in the defaults and inherit the default in provider overrides.
+type UpstreamPolicy struct {
+	// ConnectTimeoutSeconds bounds establishing the connection, TLS handshake included.
+	ConnectTimeoutSeconds int `yaml:"connect-timeout-seconds,omitempty" json:"connect-timeout-seconds,omitempty"`
+	// ReadTimeoutSeconds bounds the wait for response headers and each gap between
+	// body reads, so stalled streams fail without capping healthy long ones.
+	ReadTimeoutSeconds int `yaml:"read-timeout-seconds,omitempty" json:"read-timeout-seconds,omitempty"`
+	// TotalTimeoutSeconds bounds the whole call, streamed response body included.
+	TotalTimeoutSeconds int           `yaml:"total-timeout-seconds,omitempty" json:"total-timeout-seconds,omitempty"`
+	Retry               UpstreamRetry `yaml:"retry,omitempty" json:"retry,omitempty"`
+}
+
+// UpstreamRetry retries an upstream call on the same credential before its response
+// reaches the client. Calls failing to connect and responses with one of StatusCodes
+// are retried with exponential backoff; a Retry-After header within MaxBackoffMs wins.
+type UpstreamRetry struct {
+	// MaxAttempts counts the first call; 0 and 1 disable retries.
+	MaxAttempts      int   `yaml:"max-attempts,omitempty" json:"max-attempts,omitempty"`
+	StatusCodes      []int `yaml:"status-codes,omitempty" json:"status-codes,omitempty"`
+	InitialBackoffMs int   `yaml:"initial-backoff-ms,omitempty" json:"initial-backoff-ms,omitempty"`
+	MaxBackoffMs     int   `yaml:"max-backoff-ms,omitempty" json:"max-backoff-ms,omitempty"`
+}
+
+// For returns the policy for provider: its override's non-zero fields over the defaults.
+func (c UpstreamConfig) For(provider string) UpstreamPolicy {
+	policy := c.UpstreamPolicy
+	for name, override := range c.Providers {
+		if !strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(provider)) {
+			continue
+		}
+		if override.ConnectTimeoutSeconds != 0 {
+			policy.ConnectTimeoutSeconds = override.ConnectTimeoutSeconds
+		}
+		if override.ReadTimeoutSeconds != 0 {
+			policy.ReadTimeoutSeconds = override.ReadTimeoutSeconds
+		}
+		if override.TotalTimeoutSeconds != 0 {
+			policy.TotalTimeoutSeconds = override.TotalTimeoutSeconds
+		}
+		if override.Retry.MaxAttempts != 0 {
+			policy.Retry.MaxAttempts = override.Retry.MaxAttempts
+		}
+		if len(override.Retry.StatusCodes) > 0 {
+			policy.Retry.StatusCodes = override.Retry.StatusCodes
+		}
+		if override.Retry.InitialBackoffMs != 0 {
+			policy.Retry.InitialBackoffMs = override.Retry.InitialBackoffMs
+		}
+		if override.Retry.MaxBackoffMs != 0 {
+			policy.Retry.MaxBackoffMs = override.Retry.MaxBackoffMs
+		}
+		break
+	}
+	return policy
+}
+
 // SanitizeOpenAICompatibility removes OpenAI-compatibility provider entries that are
 // not actionable, specifically those missing a BaseURL. It trims whitespace before
 // evaluation and preserves the relative order of remaining entries.
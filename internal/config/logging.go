@@ -0,0 +1,39 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// LogLevels lists the accepted values for log-level.
+var LogLevels = []string{"trace", "debug", "info", "warn", "error"}
+
+// KnownLogComponents lists the subsystems whose debug output can be enabled through
+// log-components.
+var KnownLogComponents = []string{"usage", "otlp", "router", "auth"}
+
+// ValidLogLevel reports whether level is empty or one of LogLevels.
+func ValidLogLevel(level string) bool {
+	level = strings.ToLower(strings.TrimSpace(level))
+	return level == "" || level == "warning" || slices.Contains(LogLevels, level)
+}
+
+// NormalizeLogComponents lower-cases, trims and de-duplicates component names,
+// preserving their order. Unknown names are kept so validation can report them.
+func NormalizeLogComponents(components []string) []string {
+	if len(components) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(components))
+	for _, c := range components {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" || slices.Contains(out, c) {
+			continue
+		}
+		out = append(out, c)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
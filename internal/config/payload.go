@@ -0,0 +1,166 @@
+package config
+
+import "strings"
+
+// PayloadTarget identifies the upstream request payload rules are evaluated for.
+type PayloadTarget struct {
+	// Provider is the executor identifier serving the request (e.g., "claude").
+	Provider string `json:"provider"`
+	// Model is the normalized model name.
+	Model string `json:"model"`
+	// Protocol is the translator format of the payload; empty matches any protocol constraint.
+	Protocol string `json:"protocol,omitempty"`
+	// APIKey is the client key that authenticated the request.
+	APIKey string `json:"-"`
+}
+
+// EffectivePayload is the merged outcome of the payload rules matching one target.
+type EffectivePayload struct {
+	// Default holds parameters set only when the payload lacks them.
+	Default map[string]any `json:"default"`
+	// Override holds parameters always written into the payload.
+	Override map[string]any `json:"override"`
+	// DefaultSystemPrompt is used when the request carries no system prompt.
+	DefaultSystemPrompt string `json:"default-system-prompt,omitempty"`
+	// SystemPromptPrefix is placed ahead of any existing system prompt.
+	SystemPromptPrefix string `json:"system-prompt-prefix,omitempty"`
+}
+
+// Empty reports whether no rule contributed anything.
+func (e EffectivePayload) Empty() bool {
+	return len(e.Default) == 0 && len(e.Override) == 0 && e.DefaultSystemPrompt == "" && e.SystemPromptPrefix == ""
+}
+
+// Resolve merges the rules matching target. Default values follow first-write-wins
+// across rules, override values last-write-wins, mirroring how they are applied.
+func (p PayloadConfig) Resolve(target PayloadTarget) EffectivePayload {
+	out := EffectivePayload{Default: map[string]any{}, Override: map[string]any{}}
+	if strings.TrimSpace(target.Model) == "" {
+		return out
+	}
+	for i := range p.Default {
+		rule := &p.Default[i]
+		if !rule.Matches(target) {
+			continue
+		}
+		for path, value := range rule.Params {
+			if _, exists := out.Default[path]; !exists {
+				out.Default[path] = value
+			}
+		}
+		if out.DefaultSystemPrompt == "" {
+			out.DefaultSystemPrompt = strings.TrimSpace(rule.SystemPromptPrefix)
+		}
+	}
+	for i := range p.Override {
+		rule := &p.Override[i]
+		if !rule.Matches(target) {
+			continue
+		}
+		for path, value := range rule.Params {
+			out.Override[path] = value
+		}
+		if prefix := strings.TrimSpace(rule.SystemPromptPrefix); prefix != "" {
+			out.SystemPromptPrefix = prefix
+		}
+	}
+	return out
+}
+
+// Matches reports whether the rule applies to target.
+func (r *PayloadRule) Matches(target PayloadTarget) bool {
+	if r == nil || (len(r.Models) == 0 && len(r.Providers) == 0 && len(r.APIKeys) == 0) {
+		return false
+	}
+	if len(r.Providers) > 0 && !containsFold(r.Providers, target.Provider) {
+		return false
+	}
+	if len(r.APIKeys) > 0 && !containsTrimmed(r.APIKeys, target.APIKey) {
+		return false
+	}
+	if len(r.Models) == 0 {
+		return true
+	}
+	model := strings.TrimSpace(target.Model)
+	for _, entry := range r.Models {
+		name := strings.TrimSpace(entry.Name)
+		if name == "" {
+			continue
+		}
+		if ep := strings.TrimSpace(entry.Protocol); ep != "" && target.Protocol != "" && !strings.EqualFold(ep, target.Protocol) {
+			continue
+		}
+		if MatchModelPattern(name, model) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, value string) bool {
+	value = strings.TrimSpace(value)
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTrimmed(list []string, value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchModelPattern performs simple wildcard matching where '*' matches zero or more characters.
+// Examples:
+//
+//	"*-5" matches "gpt-5"
+//	"gpt-*" matches "gpt-5" and "gpt-4"
+//	"gemini-*-pro" matches "gemini-2.5-pro" and "gemini-3-pro".
+func MatchModelPattern(pattern, model string) bool {
+	pattern = strings.TrimSpace(pattern)
+	model = strings.TrimSpace(model)
+	if pattern == "" {
+		return false
+	}
+	if pattern == "*" {
+		return true
+	}
+	// Iterative glob-style matcher supporting only '*' wildcard.
+	pi, si := 0, 0
+	starIdx := -1
+	matchIdx := 0
+	for si < len(model) {
+		if pi < len(pattern) && (pattern[pi] == model[si]) {
+			pi++
+			si++
+			continue
+		}
+		if pi < len(pattern) && pattern[pi] == '*' {
+			starIdx = pi
+			matchIdx = si
+			pi++
+			continue
+		}
+		if starIdx != -1 {
+			pi = starIdx + 1
+			matchIdx++
+			si = matchIdx
+			continue
+		}
+		return false
+	}
+	for pi < len(pattern) && pattern[pi] == '*' {
+		pi++
+	}
+	return pi == len(pattern)
+}
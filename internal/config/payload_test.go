@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestPayloadResolve(t *testing.T) {
+	cfg := PayloadConfig{
+		Default: []PayloadRule{
+			{Models: []PayloadModelRule{{Name: "gpt-*"}}, Params: map[string]any{"temperature": 0.5}},
+			{Providers: []string{"codex"}, Params: map[string]any{"temperature": 0.9, "max_tokens": 1024}, SystemPromptPrefix: "Be brief."},
+			{Params: map[string]any{"ignored": true}},
+		},
+		Override: []PayloadRule{
+			{Providers: []string{"codex"}, APIKeys: []string{"k1"}, Params: map[string]any{"reasoning.effort": "low"}},
+			{Providers: []string{"codex"}, APIKeys: []string{"k1"}, Params: map[string]any{"reasoning.effort": "high"}, SystemPromptPrefix: "Team A."},
+		},
+	}
+
+	got := cfg.Resolve(PayloadTarget{Provider: "codex", Model: "gpt-5", APIKey: "k1"})
+	if got.Default["temperature"] != 0.5 || got.Default["max_tokens"] != 1024 {
+		t.Fatalf("defaults must be first-write-wins, got %v", got.Default)
+	}
+	if _, ok := got.Default["ignored"]; ok {
+		t.Fatalf("rule without selectors must not apply")
+	}
+	if got.Override["reasoning.effort"] != "high" || got.SystemPromptPrefix != "Team A." || got.DefaultSystemPrompt != "Be brief." {
+		t.Fatalf("unexpected effective payload %+v", got)
+	}
+
+	other := cfg.Resolve(PayloadTarget{Provider: "codex", Model: "gpt-5", APIKey: "k2"})
+	if len(other.Override) != 0 || other.SystemPromptPrefix != "" {
+		t.Fatalf("key-scoped overrides leaked to another key: %+v", other)
+	}
+	if empty := cfg.Resolve(PayloadTarget{Provider: "claude", Model: "claude-sonnet"}); !empty.Empty() {
+		t.Fatalf("expected no matching rules, got %+v", empty)
+	}
+}
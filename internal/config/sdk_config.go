@@ -4,6 +4,8 @@
 // debug settings, proxy configuration, and API keys.
 package config
 
+import "strings"
+
 // SDKConfig represents the application's configuration, loaded from a YAML file.
 type SDKConfig struct {
 	// ProxyURL is the URL of an optional proxy server to use for outbound requests.
@@ -23,13 +25,63 @@ type SDKConfig struct {
 	// Access holds request authentication provider configuration.
 	Access AccessConfig `yaml:"auth,omitempty" json:"auth,omitempty"`
 
+	// OIDCAuth accepts SSO-issued JWT bearer tokens from the listed issuers in addition
+	// to the static api-keys.
+	OIDCAuth []OIDCAuthProvider `yaml:"oidc-auth,omitempty" json:"oidc-auth,omitempty"`
+
 	// ModelsList controls list filtering behavior for /v1/models.
 	ModelsList ModelsList `yaml:"models-list,omitempty" json:"models-list,omitempty"`
+
+	// ErrorResponses selects the schema of error bodies returned to clients.
+	ErrorResponses ErrorResponsesConfig `yaml:"error-responses,omitempty" json:"error-responses,omitempty"`
+}
+
+// ErrorResponsesConfig controls how upstream and proxy errors are rendered for clients.
+type ErrorResponsesConfig struct {
+	// Translate converts errors into the schema of the inbound API dialect (OpenAI,
+	// Claude or Gemini) so client SDKs classify and retry them correctly. When false,
+	// upstream JSON error bodies are forwarded verbatim.
+	Translate bool `yaml:"translate" json:"translate"`
+	// Routes overrides the dialect per request path prefix with "openai", "claude",
+	// "gemini" or "passthrough". The longest matching prefix wins.
+	Routes map[string]string `yaml:"routes,omitempty" json:"routes,omitempty"`
 }
 
 // ModelsList configures model list filtering.
 type ModelsList struct {
 	IncludeSuspended bool `yaml:"include-suspended" json:"include-suspended"`
+	// Cache caches model listings and upstream model discovery.
+	Cache ModelsCache `yaml:"cache,omitempty" json:"cache,omitempty"`
+}
+
+// ModelsCache keeps model listings for TTLSeconds and, for StaleSeconds after that,
+// keeps serving them while they are refreshed in the background. A zero TTL disables
+// caching.
+type ModelsCache struct {
+	TTLSeconds   int `yaml:"ttl-seconds,omitempty" json:"ttl-seconds,omitempty"`
+	StaleSeconds int `yaml:"stale-while-revalidate-seconds,omitempty" json:"stale-while-revalidate-seconds,omitempty"`
+	// Providers overrides the TTLs of the model lists fetched from a provider's
+	// upstream API, keyed by provider (e.g. "antigravity").
+	Providers map[string]ModelsCacheTTL `yaml:"providers,omitempty" json:"providers,omitempty"`
+}
+
+// ModelsCacheTTL is a per-provider override of the model cache TTLs.
+type ModelsCacheTTL struct {
+	TTLSeconds   int `yaml:"ttl-seconds" json:"ttl-seconds"`
+	StaleSeconds int `yaml:"stale-while-revalidate-seconds,omitempty" json:"stale-while-revalidate-seconds,omitempty"`
+}
+
+// For returns the TTL and stale window in seconds for provider, or for the proxy's
+// own listings when provider is empty.
+func (c ModelsCache) For(provider string) (int, int) {
+	if provider = strings.TrimSpace(provider); provider != "" {
+		for name, entry := range c.Providers {
+			if strings.EqualFold(strings.TrimSpace(name), provider) {
+				return entry.TTLSeconds, entry.StaleSeconds
+			}
+		}
+	}
+	return c.TTLSeconds, c.StaleSeconds
 }
 
 // AccessConfig groups request authentication providers.
@@ -56,10 +108,32 @@ type AccessProvider struct {
 	Config map[string]any `yaml:"config,omitempty" json:"config,omitempty"`
 }
 
+// OIDCAuthProvider validates JWT bearer tokens issued by one OIDC issuer.
+type OIDCAuthProvider struct {
+	// Name identifies the provider in logs and usage records. Defaults to the issuer.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Issuer must match the token's iss claim.
+	Issuer string `yaml:"issuer" json:"issuer"`
+	// Audiences lists accepted aud values; a token must carry at least one of them.
+	// Required unless AllowAnyAudience is set.
+	Audiences []string `yaml:"audiences,omitempty" json:"audiences,omitempty"`
+	// AllowAnyAudience accepts tokens for any audience of the issuer when Audiences is
+	// empty, including tokens minted for unrelated applications.
+	AllowAnyAudience bool `yaml:"allow-any-audience,omitempty" json:"allow-any-audience,omitempty"`
+	// JWKSURL is where signing keys are fetched from. When empty it is discovered
+	// from the issuer's /.well-known/openid-configuration.
+	JWKSURL string `yaml:"jwks-url,omitempty" json:"jwks-url,omitempty"`
+	// SubjectClaim names the claim used as the client identity. Defaults to "sub".
+	SubjectClaim string `yaml:"subject-claim,omitempty" json:"subject-claim,omitempty"`
+}
+
 const (
 	// AccessProviderTypeConfigAPIKey is the built-in provider validating inline API keys.
 	AccessProviderTypeConfigAPIKey = "config-api-key"
 
+	// AccessProviderTypeOIDC is the built-in provider validating OIDC-issued JWTs.
+	AccessProviderTypeOIDC = "oidc-jwt"
+
 	// DefaultAccessProviderName is applied when no provider name is supplied.
 	DefaultAccessProviderName = "config-inline"
 )
@@ -93,3 +167,39 @@ func MakeInlineAPIKeyProvider(keys []string) *AccessProvider {
 	}
 	return provider
 }
+
+// OIDCAccessProviders converts the oidc-auth entries to access provider configurations.
+func (c *SDKConfig) OIDCAccessProviders() []*AccessProvider {
+	if c == nil {
+		return nil
+	}
+	out := make([]*AccessProvider, 0, len(c.OIDCAuth))
+	for _, entry := range c.OIDCAuth {
+		issuer := strings.TrimSpace(entry.Issuer)
+		if issuer == "" {
+			continue
+		}
+		name := strings.TrimSpace(entry.Name)
+		if name == "" {
+			name = issuer
+		}
+		audiences := make([]any, 0, len(entry.Audiences))
+		for _, aud := range entry.Audiences {
+			if aud = strings.TrimSpace(aud); aud != "" {
+				audiences = append(audiences, aud)
+			}
+		}
+		out = append(out, &AccessProvider{
+			Name: name,
+			Type: AccessProviderTypeOIDC,
+			Config: map[string]any{
+				"issuer":             issuer,
+				"audiences":          audiences,
+				"allow-any-audience": entry.AllowAnyAudience,
+				"jwks-url":           strings.TrimSpace(entry.JWKSURL),
+				"subject-claim":      strings.TrimSpace(entry.SubjectClaim),
+			},
+		})
+	}
+	return out
+}
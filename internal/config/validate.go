@@ -0,0 +1,1095 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validation issue severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ValidationIssue is a single problem found in a candidate configuration.
+type ValidationIssue struct {
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// ValidationResult is the outcome of a dry-run validation. Valid is false when any
+// issue has error severity; warnings never block a reload.
+type ValidationResult struct {
+	Valid  bool              `json:"valid"`
+	Issues []ValidationIssue `json:"issues"`
+}
+
+type validator struct {
+	baseDir string
+	issues  []ValidationIssue
+}
+
+func (v *validator) errorf(field, format string, args ...any) {
+	v.issues = append(v.issues, ValidationIssue{Field: field, Message: fmt.Sprintf(format, args...), Severity: SeverityError})
+}
+
+func (v *validator) warnf(field, format string, args ...any) {
+	v.issues = append(v.issues, ValidationIssue{Field: field, Message: fmt.Sprintf(format, args...), Severity: SeverityWarning})
+}
+
+// ValidateYAML parses data as a candidate config without applying it or touching
+// configFile. configFile is only used to resolve relative paths the same way the
+// running server would.
+func ValidateYAML(data []byte, configFile string) ValidationResult {
+	v := &validator{}
+	if configFile != "" {
+		v.baseDir = filepath.Dir(configFile)
+	}
+
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			v.errorf("", "parse: %v", err)
+			return v.result()
+		}
+		for _, msg := range typeErr.Errors {
+			// Unknown keys are reported as warnings: legacy keys are migrated on load.
+			if strings.Contains(msg, "not found in type") {
+				v.warnf("", "%s", msg)
+			} else {
+				v.errorf("", "%s", msg)
+			}
+		}
+		// Fall back to a lenient decode so semantic checks still run.
+		cfg = Config{}
+		_ = yaml.Unmarshal(data, &cfg)
+	}
+	cfg.validate(v)
+	return v.result()
+}
+
+func (v *validator) result() ValidationResult {
+	res := ValidationResult{Valid: true, Issues: v.issues}
+	if res.Issues == nil {
+		res.Issues = []ValidationIssue{}
+	}
+	for _, issue := range v.issues {
+		if issue.Severity == SeverityError {
+			res.Valid = false
+			break
+		}
+	}
+	return res
+}
+
+func (v *validator) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) || v.baseDir == "" {
+		return path
+	}
+	return filepath.Join(v.baseDir, path)
+}
+
+func (v *validator) fileExists(field, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(v.resolve(path)); err != nil {
+		v.errorf(field, "%v", err)
+	}
+}
+
+func (cfg *Config) validate(v *validator) {
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		v.errorf("port", "must be between 0 and 65535, got %d", cfg.Port)
+	}
+	if cfg.TLS.Enable {
+		if cfg.TLS.Cert == "" || cfg.TLS.Key == "" {
+			v.errorf("tls", "cert and key are required when enable is true")
+		}
+		v.fileExists("tls.cert", cfg.TLS.Cert)
+		v.fileExists("tls.key", cfg.TLS.Key)
+	}
+	if cfg.ProxyURL != "" {
+		if u, err := url.Parse(cfg.ProxyURL); err != nil || u.Host == "" {
+			v.errorf("proxy-url", "invalid URL %q", cfg.ProxyURL)
+		}
+	}
+	for prefix, dialect := range cfg.ErrorResponses.Routes {
+		field := "error-responses.routes." + prefix
+		if !strings.HasPrefix(prefix, "/") {
+			v.errorf(field, "route prefix must start with /")
+		}
+		switch strings.ToLower(strings.TrimSpace(dialect)) {
+		case "openai", "claude", "gemini", "passthrough":
+		default:
+			v.errorf(field, "must be openai, claude, gemini or passthrough, got %q", dialect)
+		}
+	}
+	for provider, proxyURL := range cfg.ProviderProxies {
+		if err := CheckProxyURL(proxyURL); err != nil {
+			v.errorf("provider-proxies."+provider, "%v", err)
+		}
+	}
+	validateUpstreamPolicy(v, "upstream", cfg.Upstream.UpstreamPolicy)
+	for provider, policy := range cfg.Upstream.Providers {
+		validateUpstreamPolicy(v, "upstream.providers."+provider, policy)
+	}
+	if cfg.RequestRetry < 0 {
+		v.errorf("request-retry", "must not be negative")
+	}
+	if cfg.MaxRetryInterval < 0 {
+		v.errorf("max-retry-interval", "must not be negative")
+	}
+	if !ValidLogLevel(cfg.LogLevel) {
+		v.errorf("log-level", "unknown level %q (want %s)", cfg.LogLevel, strings.Join(LogLevels, ", "))
+	}
+	for _, c := range NormalizeLogComponents(cfg.LogComponents) {
+		if !slices.Contains(KnownLogComponents, c) {
+			v.warnf("log-components", "unknown component %q (want %s)", c, strings.Join(KnownLogComponents, ", "))
+		}
+	}
+
+	cfg.validateUsageDatabase(v)
+	cfg.validateUsageReports(v)
+	cfg.validateTelemetry(v)
+	cfg.validateRouting(v)
+	cfg.validatePayload(v)
+	cfg.validateNetworkAccess(v)
+	cfg.validateRequestSizeLimits(v)
+	cfg.validateIdempotency(v)
+	cfg.validateClientAttribution(v)
+	cfg.validateShadowTraffic(v)
+	cfg.validateRequestTransforms(v)
+	cfg.validateReasoningBudgets(v)
+	cfg.validateProviderSpendCaps(v)
+	cfg.validateOIDCAuth(v)
+
+	cb := cfg.CircuitBreaker
+	if cb.FailureThreshold < 0 || cb.WindowSeconds < 0 || cb.OpenSeconds < 0 {
+		v.errorf("circuit-breaker", "failure-threshold, window-seconds and open-seconds must not be negative")
+	}
+	if cc := cfg.CredentialCanary; cc.TrafficPercent < 0 || cc.TrafficPercent > 100 {
+		v.errorf("credential-canary.traffic-percent", "must be between 0 and 100")
+	}
+	if cc := cfg.CredentialCanary; cc.WarmupMinutes < 0 || cc.MinRequests < 0 {
+		v.errorf("credential-canary", "warmup-minutes and min-requests must not be negative")
+	}
+	if cc := cfg.CredentialCanary; cc.MaxFailureRate < 0 || cc.MaxFailureRate > 1 || cc.MaxRateLimitRate < 0 || cc.MaxRateLimitRate > 1 {
+		v.errorf("credential-canary", "max-failure-rate and max-rate-limit-rate must be between 0 and 1")
+	}
+	if lr := cfg.LatencyRouting; lr.WindowSeconds < 0 || lr.MinSamples < 0 {
+		v.errorf("latency-routing", "window-seconds and min-samples must not be negative")
+	}
+	if cc := cfg.CredentialConcurrency; cc.MaxInFlight < 0 || cc.QueueTimeoutSeconds < 0 {
+		v.errorf("credential-concurrency", "max-in-flight and queue-timeout-seconds must not be negative")
+	}
+	if ls := cfg.LoadShedding; ls.MaxInFlight < 0 || ls.MaxQueueWaitMs < 0 || ls.RetryAfterSeconds < 0 {
+		v.errorf("load-shedding", "max-in-flight, max-queue-wait-ms and retry-after-seconds must not be negative")
+	}
+	if cfg.PromptCaching.MinPromptChars < 0 {
+		v.errorf("prompt-caching.min-prompt-chars", "must not be negative")
+	}
+	if cfg.AuthRefresh.JitterPercent > 100 {
+		v.errorf("auth-refresh.jitter-percent", "must not exceed 100")
+	}
+	if cfg.AuthRefresh.MaxBackoffSeconds < 0 {
+		v.errorf("auth-refresh.max-backoff-seconds", "must not be negative")
+	}
+	if mc := cfg.ModelsList.Cache; mc.TTLSeconds < 0 || mc.StaleSeconds < 0 {
+		v.errorf("models-list.cache", "ttl-seconds and stale-while-revalidate-seconds must not be negative")
+	}
+	for provider, entry := range cfg.ModelsList.Cache.Providers {
+		if entry.TTLSeconds < 0 || entry.StaleSeconds < 0 {
+			v.errorf("models-list.cache.providers."+provider, "ttl-seconds and stale-while-revalidate-seconds must not be negative")
+		}
+	}
+	if cfg.Batch.Concurrency < 0 {
+		v.errorf("batch.concurrency", "must not be negative")
+	}
+	for i, token := range cfg.RemoteManagement.Tokens {
+		field := fmt.Sprintf("remote-management.tokens[%d]", i)
+		if strings.TrimSpace(token.Key) == "" {
+			v.errorf(field+".key", "must not be empty")
+		}
+		switch strings.ToLower(strings.TrimSpace(token.Role)) {
+		case "admin", "read-only", "usage-viewer":
+		default:
+			v.errorf(field+".role", "unknown role %q (want admin, read-only or usage-viewer)", token.Role)
+		}
+	}
+	if ce := cfg.CredentialEncryption; ce.Enabled && ce.KeyFile != "" {
+		v.fileExists("credential-encryption.key-file", ce.KeyFile)
+	}
+	if vault := cfg.Secrets.Vault; vault.Enabled {
+		if vault.Address == "" && os.Getenv("VAULT_ADDR") == "" {
+			v.errorf("secrets.vault.address", "required when VAULT_ADDR is not set")
+		}
+		v.fileExists("secrets.vault.token-file", vault.TokenFile)
+	}
+}
+
+func (cfg *Config) validateUsageDatabase(v *validator) {
+	db := cfg.UsageDatabase
+	if db.RetentionDays < 0 || db.RequestsRetentionDays < 0 || db.DailyRetentionDays < 0 {
+		v.errorf("usage-db", "retention days must not be negative")
+	}
+	for provider, days := range db.ProviderRetentionDays {
+		if days < 0 {
+			v.errorf("usage-db.provider-retention-days."+provider, "must not be negative")
+		}
+	}
+	for _, days := range db.CredentialRetentionDays {
+		if days < 0 {
+			// Keys may be API keys, so they are left out of the message.
+			v.errorf("usage-db.credential-retention-days", "must not be negative")
+			break
+		}
+	}
+	if db.QueueSize < 0 {
+		v.errorf("usage-db.queue-size", "must not be negative")
+	}
+	for model, price := range db.ModelPrices {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 || price.CachedInputPerMillion < 0 {
+			v.errorf("usage-db.model-prices."+model, "prices must not be negative")
+		}
+	}
+	for provider, quota := range db.ProviderQuotas {
+		field := "usage-db.provider-quotas." + provider
+		if quota.Requests < 0 || quota.Tokens < 0 {
+			v.errorf(field, "limits must not be negative")
+		}
+		switch strings.ToLower(strings.TrimSpace(quota.Window)) {
+		case "", "hour", "day", "month":
+		default:
+			v.errorf(field+".window", "unknown window %q (want hour, day or month)", quota.Window)
+		}
+	}
+	if salt := strings.TrimSpace(db.FingerprintSalt); salt != "" && len(salt) < 16 {
+		v.warnf("usage-db.fingerprint-salt", "short salts are easy to guess; use at least 16 random characters")
+	}
+	switch strings.ToLower(strings.TrimSpace(db.OverflowPolicy)) {
+	case "", "block", "drop-oldest", "drop-newest", "spill":
+	default:
+		v.errorf("usage-db.overflow-policy", "unknown policy %q (want block, drop-newest, drop-oldest or spill)", db.OverflowPolicy)
+	}
+	sqlite := db.SQLite
+	switch strings.ToLower(strings.TrimSpace(sqlite.JournalMode)) {
+	case "", "wal", "delete", "truncate", "persist":
+	case "memory", "off":
+		v.warnf("usage-db.sqlite.journal-mode", "%s journaling can corrupt the database on a crash", sqlite.JournalMode)
+	default:
+		v.errorf("usage-db.sqlite.journal-mode", "unknown mode %q (want wal, delete, truncate, persist, memory or off)", sqlite.JournalMode)
+	}
+	switch strings.ToLower(strings.TrimSpace(sqlite.Synchronous)) {
+	case "", "normal", "full", "extra":
+	case "off":
+		v.warnf("usage-db.sqlite.synchronous", "off loses recent usage and can corrupt the database on power loss")
+	default:
+		v.errorf("usage-db.sqlite.synchronous", "unknown level %q (want off, normal, full or extra)", sqlite.Synchronous)
+	}
+	if sqlite.CacheSizeKB < 0 || sqlite.BusyTimeoutMs < 0 || sqlite.MmapSizeMB < 0 {
+		v.errorf("usage-db.sqlite", "sizes and timeouts must not be negative")
+	}
+	if db.Enabled && db.ReadOnly {
+		if db.Path == "" {
+			v.errorf("usage-db.path", "required for a read-only replica")
+		} else {
+			v.fileExists("usage-db.path", db.Path)
+		}
+	}
+	if archive := db.Archive; archive.Enabled {
+		if strings.TrimSpace(archive.Endpoint) == "" {
+			v.errorf("usage-db.archive.endpoint", "required when archival is enabled")
+		} else if strings.Contains(archive.Endpoint, "://") {
+			v.errorf("usage-db.archive.endpoint", "must be host[:port] without a scheme; set insecure for plain HTTP")
+		}
+		if strings.TrimSpace(archive.Bucket) == "" {
+			v.errorf("usage-db.archive.bucket", "required when archival is enabled")
+		}
+		if strings.TrimSpace(archive.AccessKey) == "" || strings.TrimSpace(archive.SecretKey) == "" {
+			v.errorf("usage-db.archive", "access-key and secret-key are required")
+		}
+		switch strings.ToLower(strings.TrimSpace(archive.Format)) {
+		case "", "jsonl":
+		case "parquet":
+			v.errorf("usage-db.archive.format", "parquet is not supported; use jsonl")
+		default:
+			v.errorf("usage-db.archive.format", "unknown format %q (want jsonl)", archive.Format)
+		}
+		if archive.TimeoutSeconds < 0 {
+			v.errorf("usage-db.archive.timeout-seconds", "must not be negative")
+		}
+		if db.RetentionDays <= 0 && db.RequestsRetentionDays <= 0 && len(db.ProviderRetentionDays) == 0 && len(db.CredentialRetentionDays) == 0 {
+			v.warnf("usage-db.archive", "no request retention is configured, so nothing is ever archived")
+		}
+	}
+	if dual := db.DualWrite; dual.Enabled {
+		dsn := strings.TrimSpace(dual.DSN)
+		switch {
+		case dsn == "":
+			v.errorf("usage-db.dual-write.dsn", "required when dual-write is enabled")
+		case strings.HasPrefix(dsn, "clickhouse://"):
+			v.errorf("usage-db.dual-write.dsn", "clickhouse is not supported; use a postgres:// target")
+		case !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://"):
+			v.errorf("usage-db.dual-write.dsn", "must be a postgres:// connection string")
+		}
+		if db.ReadOnly {
+			v.warnf("usage-db.dual-write", "ignored on a read-only replica; the writer instance mirrors")
+		}
+	}
+	if enc := db.Encryption; enc.Enabled && enc.KeyFile != "" {
+		v.fileExists("usage-db.encryption.key-file", enc.KeyFile)
+	}
+}
+
+func (cfg *Config) validateUsageReports(v *validator) {
+	reports := cfg.UsageDatabase.Reports
+	needsSMTP := false
+	seen := make(map[string]struct{}, len(reports.Recipients))
+	for i, r := range reports.Recipients {
+		field := fmt.Sprintf("usage-db.reports.recipients[%d]", i)
+		name := strings.TrimSpace(r.Name)
+		if name == "" {
+			v.errorf(field+".name", "required")
+		} else if _, dup := seen[strings.ToLower(name)]; dup {
+			v.errorf(field+".name", "duplicate report %q", name)
+		} else {
+			seen[strings.ToLower(name)] = struct{}{}
+		}
+		if len(r.Email) == 0 && strings.TrimSpace(r.Webhook) == "" {
+			v.errorf(field, "set email or webhook")
+		}
+		for _, addr := range r.Email {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				v.errorf(field+".email", "invalid address %q", addr)
+			}
+		}
+		if hook := strings.TrimSpace(r.Webhook); hook != "" {
+			if u, err := url.Parse(hook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.errorf(field+".webhook", "must be an http(s) URL")
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(r.Schedule)) {
+		case "", "daily", "weekly":
+		default:
+			v.errorf(field+".schedule", "unknown schedule %q (want daily or weekly)", r.Schedule)
+		}
+		if t := strings.TrimSpace(r.Time); t != "" {
+			if _, err := time.Parse("15:04", t); err != nil {
+				v.errorf(field+".time", "must be HH:MM, got %q", r.Time)
+			}
+		}
+		if d := strings.TrimSpace(r.Weekday); d != "" {
+			if _, ok := ParseWeekday(d); !ok {
+				v.errorf(field+".weekday", "unknown weekday %q", r.Weekday)
+			}
+		}
+		if tz := strings.TrimSpace(r.Timezone); tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				v.errorf(field+".timezone", "unknown time zone %q", r.Timezone)
+			}
+		}
+		if r.TopModels < 0 {
+			v.errorf(field+".top-models", "must not be negative")
+		}
+		if len(r.Email) > 0 && !r.Disabled {
+			needsSMTP = true
+		}
+	}
+	if needsSMTP {
+		if strings.TrimSpace(reports.SMTP.Host) == "" {
+			v.errorf("usage-db.reports.smtp.host", "required for email recipients")
+		}
+		if _, err := mail.ParseAddress(reports.SMTP.From); err != nil {
+			v.errorf("usage-db.reports.smtp.from", "must be a valid sender address")
+		}
+	}
+	if reports.SMTP.Port < 0 || reports.SMTP.Port > 65535 {
+		v.errorf("usage-db.reports.smtp.port", "must be between 1 and 65535")
+	}
+	if len(reports.Recipients) > 0 && !cfg.UsageDatabase.Enabled {
+		v.warnf("usage-db.reports", "reports are read from the usage database, which is disabled")
+	}
+}
+
+// ParseWeekday resolves a weekday name such as "monday" or "mon".
+func ParseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < 3 {
+		return 0, false
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.HasPrefix(strings.ToLower(d.String()), name) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+func validateOTLPEndpoint(v *validator, field, endpoint string) {
+	if endpoint == "" {
+		return
+	}
+	u, err := url.Parse(endpoint)
+	switch {
+	case err != nil || u.Host == "":
+		v.errorf(field, "invalid URL %q", endpoint)
+	case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "grpc" && u.Scheme != "grpcs":
+		v.errorf(field, "unsupported scheme %q (want http, https, grpc or grpcs)", u.Scheme)
+	}
+}
+
+func (cfg *Config) validateTelemetry(v *validator) {
+	otlp := cfg.OTLP
+	validateOTLPEndpoint(v, "otlp.endpoint", otlp.Endpoint)
+	for i, endpoint := range otlp.Endpoints {
+		if strings.TrimSpace(endpoint) == "" {
+			v.errorf(fmt.Sprintf("otlp.endpoints[%d]", i), "must not be empty")
+			continue
+		}
+		validateOTLPEndpoint(v, fmt.Sprintf("otlp.endpoints[%d]", i), endpoint)
+	}
+	switch strings.ToLower(strings.TrimSpace(otlp.SRV.Scheme)) {
+	case "", "http", "https", "grpc", "grpcs":
+	default:
+		v.errorf("otlp.srv.scheme", "unsupported scheme %q (want http, https, grpc or grpcs)", otlp.SRV.Scheme)
+	}
+	if otlp.SRV.Name == "" && (otlp.SRV.Scheme != "" || otlp.SRV.Path != "") {
+		v.warnf("otlp.srv", "scheme and path have no effect without name")
+	}
+	switch strings.ToLower(strings.TrimSpace(otlp.Protocol)) {
+	case "", "http/json", "grpc", "otlp/grpc":
+	default:
+		v.errorf("otlp.protocol", "unknown protocol %q (want http/json or grpc)", otlp.Protocol)
+	}
+	if otlp.TimeoutMs < 0 || otlp.BatchSize < 0 || otlp.FlushIntervalMs < 0 {
+		v.errorf("otlp", "timeout_ms, batch_size and flush_interval_ms must not be negative")
+	}
+	if otlp.Spool.MaxSizeMB < 0 || otlp.Spool.MaxAgeHours < 0 {
+		v.errorf("otlp.spool", "max_size_mb and max_age_hours must not be negative")
+	}
+	v.fileExists("otlp.tls_ca_file", otlp.TLSCAFile)
+	if pct := otlp.Sampling.Percentage; pct != nil && (*pct < 0 || *pct > 100) {
+		v.errorf("otlp.sampling.percentage", "must be between 0 and 100, got %v", *pct)
+	}
+	for provider, pct := range otlp.Sampling.Providers {
+		if pct < 0 || pct > 100 {
+			v.errorf("otlp.sampling.providers."+provider, "must be between 0 and 100, got %v", pct)
+		}
+	}
+	for key := range otlp.ResourceAttributes {
+		if strings.TrimSpace(key) == "" {
+			v.errorf("otlp.resource_attributes", "attribute names must not be empty")
+		}
+	}
+	for i, name := range otlp.ExcludeEvents {
+		switch strings.TrimSpace(name) {
+		case "":
+			v.errorf(fmt.Sprintf("otlp.exclude_events[%d]", i), "must not be empty")
+		case "usage.record":
+			v.warnf(fmt.Sprintf("otlp.exclude_events[%d]", i), "usage.record is governed by otlp.sampling and cannot be excluded")
+		}
+	}
+
+	if sd := cfg.StatsD; sd.Enabled {
+		if sd.Address != "" {
+			if _, _, err := net.SplitHostPort(sd.Address); err != nil {
+				v.errorf("statsd.address", "%v", err)
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(sd.Flavor)) {
+		case "", "datadog", "dogstatsd", "statsd":
+		default:
+			v.errorf("statsd.flavor", "unknown flavor %q (want datadog or statsd)", sd.Flavor)
+		}
+	}
+
+	for i, bound := range cfg.Prometheus.Buckets {
+		if bound <= 0 || (i > 0 && bound <= cfg.Prometheus.Buckets[i-1]) {
+			v.errorf("prometheus.buckets", "must be positive and strictly increasing")
+			break
+		}
+	}
+
+	sinkNames := make(map[string]bool, len(cfg.UsageSinks))
+	for i, sink := range cfg.UsageSinks {
+		field := fmt.Sprintf("usage-sinks[%d]", i)
+		name := strings.TrimSpace(sink.Name)
+		switch {
+		case name == "":
+			v.errorf(field+".name", "must not be empty")
+		case sinkNames[name]:
+			v.errorf(field+".name", "duplicate sink %q", name)
+		}
+		sinkNames[name] = true
+		command := strings.TrimSpace(sink.Command)
+		if command == "" {
+			v.errorf(field+".command", "must not be empty")
+		} else if !sink.Disabled {
+			if _, err := exec.LookPath(command); err != nil {
+				v.warnf(field+".command", "%v", err)
+			}
+		}
+		if sink.QueueSize < 0 {
+			v.errorf(field+".queue-size", "must not be negative")
+		}
+	}
+
+	if kafka := cfg.Kafka; kafka.Enabled {
+		if len(kafka.Brokers) == 0 {
+			v.errorf("kafka.brokers", "at least one broker is required")
+		}
+		for i, broker := range kafka.Brokers {
+			if _, _, err := net.SplitHostPort(strings.TrimSpace(broker)); err != nil {
+				v.errorf(fmt.Sprintf("kafka.brokers[%d]", i), "%v", err)
+			}
+		}
+		if strings.TrimSpace(kafka.Topic) == "" {
+			v.errorf("kafka.topic", "must not be empty")
+		}
+		switch strings.ToLower(strings.TrimSpace(kafka.Format)) {
+		case "", "json", "avro":
+		default:
+			v.errorf("kafka.format", "unknown format %q (want json or avro)", kafka.Format)
+		}
+		switch strings.ToLower(strings.TrimSpace(kafka.Acks)) {
+		case "", "all", "leader", "none":
+		default:
+			v.errorf("kafka.acks", "unknown acks %q (want all, leader or none)", kafka.Acks)
+		}
+		if kafka.BatchSize < 0 || kafka.FlushIntervalMs < 0 || kafka.TimeoutMs < 0 || kafka.QueueSize < 0 {
+			v.errorf("kafka", "batch-size, flush-interval-ms, timeout-ms and queue-size must not be negative")
+		}
+		switch strings.ToUpper(strings.TrimSpace(kafka.SASL.Mechanism)) {
+		case "":
+		case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+			if kafka.SASL.Username == "" {
+				v.errorf("kafka.sasl.username", "must not be empty")
+			}
+			if !kafka.TLS.Enabled {
+				v.warnf("kafka.sasl", "credentials are sent without TLS")
+			}
+		default:
+			v.errorf("kafka.sasl.mechanism", "unknown mechanism %q (want PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512)", kafka.SASL.Mechanism)
+		}
+		v.fileExists("kafka.tls.ca-file", kafka.TLS.CAFile)
+	}
+
+	if redis := cfg.Redis; redis.Enabled {
+		if _, _, err := net.SplitHostPort(strings.TrimSpace(redis.Address)); err != nil {
+			v.errorf("redis.address", "%v", err)
+		}
+		if redis.DB < 0 || redis.TimeoutMs < 0 {
+			v.errorf("redis", "db and timeout-ms must not be negative")
+		}
+		if redis.Password != "" && !redis.TLS.Enabled {
+			v.warnf("redis.password", "credentials are sent without TLS")
+		}
+		v.fileExists("redis.tls.ca-file", redis.TLS.CAFile)
+		capped := false
+		for _, p := range cfg.APIKeyPolicies {
+			capped = capped || p.MonthlySpendCap > 0
+		}
+		for _, t := range cfg.Teams {
+			capped = capped || t.MonthlySpendCap > 0
+		}
+		if cfg.NetworkAccess.RequestsPerMinute <= 0 && !capped {
+			v.warnf("redis", "nothing is shared: neither network-access.requests-per-minute nor a monthly-spend-cap is configured")
+		}
+	}
+}
+
+func (cfg *Config) validateOIDCAuth(v *validator) {
+	names := make(map[string]bool, len(cfg.OIDCAuth))
+	for i, entry := range cfg.OIDCAuth {
+		field := fmt.Sprintf("oidc-auth[%d]", i)
+		issuer := strings.TrimSpace(entry.Issuer)
+		if u, err := url.Parse(issuer); issuer == "" || err != nil || u.Host == "" {
+			v.errorf(field+".issuer", "must be an absolute URL, got %q", entry.Issuer)
+		} else if u.Scheme != "https" {
+			v.warnf(field+".issuer", "issuer is not served over https")
+		}
+		if raw := strings.TrimSpace(entry.JWKSURL); raw != "" {
+			if u, err := url.Parse(raw); err != nil || u.Host == "" {
+				v.errorf(field+".jwks-url", "invalid URL %q", entry.JWKSURL)
+			}
+		}
+		if len(entry.Audiences) == 0 && !entry.AllowAnyAudience {
+			v.errorf(field+".audiences", "at least one audience is required; set allow-any-audience to accept every token of this issuer")
+		} else if len(entry.Audiences) == 0 {
+			v.warnf(field+".audiences", "tokens for any audience of this issuer will be accepted")
+		}
+		name := strings.TrimSpace(entry.Name)
+		if name == "" {
+			name = issuer
+		}
+		if names[name] {
+			v.errorf(field+".name", "duplicate provider %q", name)
+		}
+		names[name] = true
+	}
+}
+
+func (cfg *Config) validateNetworkAccess(v *validator) {
+	na := cfg.NetworkAccess
+	if na.RequestsPerMinute < 0 || na.Burst < 0 {
+		v.errorf("network-access", "requests-per-minute and burst must not be negative")
+	}
+	checkNetworks := func(field string, values []string) {
+		for _, raw := range values {
+			raw = strings.TrimSpace(raw)
+			if _, err := netip.ParsePrefix(raw); err == nil {
+				continue
+			}
+			if _, err := netip.ParseAddr(raw); err != nil {
+				v.errorf(field, "invalid CIDR or IP address %q", raw)
+			}
+		}
+	}
+	checkNetworks("network-access.allowed-cidrs", na.AllowedCIDRs)
+	checkNetworks("network-access.exempt-cidrs", na.ExemptCIDRs)
+	for i, rule := range na.APIKeys {
+		field := fmt.Sprintf("network-access.api-keys[%d]", i)
+		if strings.TrimSpace(rule.APIKey) == "" {
+			v.errorf(field+".api-key", "must not be empty")
+		} else if !slices.Contains(cfg.APIKeys, strings.TrimSpace(rule.APIKey)) {
+			v.warnf(field+".api-key", "key is not listed in api-keys")
+		}
+		if len(rule.AllowedCIDRs) == 0 {
+			v.warnf(field+".allowed-cidrs", "empty list denies the key from every address")
+		}
+		checkNetworks(field+".allowed-cidrs", rule.AllowedCIDRs)
+	}
+}
+
+func (cfg *Config) validateClientAttribution(v *validator) {
+	ca := cfg.ClientAttribution
+	if !ca.Enabled {
+		return
+	}
+	for _, raw := range ca.TrustedProxies {
+		raw = strings.TrimSpace(raw)
+		if _, err := netip.ParsePrefix(raw); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(raw); err != nil {
+			v.errorf("client-attribution.trusted-proxies", "invalid CIDR or IP address %q", raw)
+		}
+	}
+	v.fileExists("client-attribution.geoip-database", ca.GeoIPDatabase)
+}
+
+func (cfg *Config) validateShadowTraffic(v *validator) {
+	st := cfg.ShadowTraffic
+	if st.MaxConcurrent < 0 || st.TimeoutSeconds < 0 || st.MaxResponseBytes < 0 {
+		v.errorf("shadow-traffic", "max-concurrent, timeout-seconds and max-response-bytes must not be negative")
+	}
+	for i, rule := range st.Rules {
+		field := fmt.Sprintf("shadow-traffic.rules[%d]", i)
+		if strings.TrimSpace(rule.Model) == "" {
+			v.errorf(field+".model", "must not be empty")
+		}
+		if strings.TrimSpace(rule.ShadowModel) == "" {
+			v.errorf(field+".shadow-model", "must not be empty")
+		} else if strings.EqualFold(strings.TrimSpace(rule.ShadowModel), strings.TrimSpace(rule.Model)) && rule.ShadowProvider == "" {
+			v.warnf(field+".shadow-model", "same as model; the comparison only measures credential variance")
+		}
+		if rule.Percentage < 0 || rule.Percentage > 100 {
+			v.errorf(field+".percentage", "must be between 0 and 100, got %g", rule.Percentage)
+		}
+	}
+	if db := cfg.UsageDatabase; len(st.Rules) > 0 && (!db.Enabled || db.ReadOnly) {
+		v.warnf("shadow-traffic", "comparisons are stored in usage-db, which is disabled or read-only")
+	}
+}
+
+// requestTransformFormats are the inbound formats request-transforms rules may select.
+var requestTransformFormats = []string{"openai", "openai-response", "claude", "gemini", "gemini-cli"}
+
+func (cfg *Config) validateRequestTransforms(v *validator) {
+	clientKeys := make(map[string]struct{}, len(cfg.APIKeys))
+	for _, key := range cfg.APIKeys {
+		clientKeys[strings.TrimSpace(key)] = struct{}{}
+	}
+	for i, rule := range cfg.RequestTransforms {
+		field := fmt.Sprintf("request-transforms[%d]", i)
+		if strings.TrimSpace(rule.Template) == "" && len(rule.Delete) == 0 && len(rule.Default) == 0 &&
+			len(rule.Set) == 0 && len(rule.Max) == 0 && strings.TrimSpace(rule.SystemPrompt) == "" {
+			v.warnf(field, "rule has no template, delete, default, set, max or system-prompt and does nothing")
+		}
+		if tmpl := strings.TrimSpace(rule.Template); tmpl != "" {
+			// The functions only need to exist for parsing; requesttransform binds them.
+			funcs := template.FuncMap{"json": fmt.Sprint, "get": fmt.Sprint, "raw": fmt.Sprint}
+			if _, err := template.New(field).Funcs(funcs).Parse(tmpl); err != nil {
+				v.errorf(field+".template", "%v", err)
+			}
+		}
+		for _, format := range rule.Formats {
+			if !slices.Contains(requestTransformFormats, strings.ToLower(strings.TrimSpace(format))) {
+				v.errorf(field+".formats", "unknown format %q (want %s)", format, strings.Join(requestTransformFormats, ", "))
+			}
+		}
+		for _, key := range rule.APIKeys {
+			if _, known := clientKeys[strings.TrimSpace(key)]; !known {
+				v.warnf(field+".api-keys", "key is not listed in api-keys")
+				break
+			}
+		}
+	}
+}
+
+// reasoningBudgetActions are the accepted reasoning-budgets actions.
+var reasoningBudgetActions = []string{"clamp", "reject", "flag"}
+
+func (cfg *Config) validateReasoningBudgets(v *validator) {
+	for i, rule := range cfg.ReasoningBudgets {
+		field := fmt.Sprintf("reasoning-budgets[%d]", i)
+		if rule.MaxTokens < 0 {
+			v.errorf(field+".max-tokens", "must not be negative")
+		}
+		if action := strings.ToLower(strings.TrimSpace(rule.Action)); action != "" && !slices.Contains(reasoningBudgetActions, action) {
+			v.errorf(field+".action", "unknown action %q (want %s)", rule.Action, strings.Join(reasoningBudgetActions, ", "))
+		}
+		for _, key := range rule.APIKeys {
+			if !slices.Contains(cfg.APIKeys, strings.TrimSpace(key)) {
+				v.warnf(field+".api-keys", "key is not listed in api-keys")
+				break
+			}
+		}
+	}
+}
+
+func (cfg *Config) validateProviderSpendCaps(v *validator) {
+	seen := make(map[string]bool, len(cfg.ProviderSpendCaps))
+	for i, entry := range cfg.ProviderSpendCaps {
+		field := fmt.Sprintf("provider-spend-caps[%d]", i)
+		provider := strings.ToLower(strings.TrimSpace(entry.Provider))
+		switch {
+		case provider == "":
+			v.errorf(field+".provider", "must not be empty")
+		case seen[provider]:
+			v.errorf(field+".provider", "duplicate provider %q", entry.Provider)
+		}
+		seen[provider] = true
+		if entry.MonthlyCap <= 0 {
+			v.errorf(field+".monthly-cap", "must be positive")
+		}
+		switch strings.ToLower(strings.TrimSpace(entry.Action)) {
+		case "", "fallback", "reject":
+		default:
+			v.errorf(field+".action", "unknown action %q (want fallback or reject)", entry.Action)
+		}
+	}
+	if len(cfg.ProviderSpendCaps) == 0 {
+		return
+	}
+	db := cfg.UsageDatabase
+	if !db.Enabled || db.ReadOnly {
+		v.warnf("provider-spend-caps", "have no effect without a writable usage-db")
+	} else if len(db.ModelPrices) == 0 {
+		v.warnf("provider-spend-caps", "have no effect without usage-db.model-prices")
+	}
+}
+
+func (cfg *Config) validateRequestSizeLimits(v *validator) {
+	rl := cfg.RequestSizeLimits
+	if rl.MaxBodyBytes < 0 {
+		v.errorf("request-size-limits.max-body-bytes", "must not be negative")
+	}
+	if rl.MaxMediaBytes < 0 {
+		v.errorf("request-size-limits.max-media-bytes", "must not be negative")
+	}
+	if rl.MaxRequestMediaBytes < 0 {
+		v.errorf("request-size-limits.max-request-media-bytes", "must not be negative")
+	}
+	for i, route := range rl.Routes {
+		field := fmt.Sprintf("request-size-limits.routes[%d]", i)
+		if !strings.HasPrefix(strings.TrimSpace(route.Path), "/") {
+			v.errorf(field+".path", "must start with /")
+		}
+		if route.MaxBodyBytes < 0 {
+			v.errorf(field+".max-body-bytes", "must not be negative")
+		}
+	}
+	for i, rule := range rl.APIKeys {
+		field := fmt.Sprintf("request-size-limits.api-keys[%d]", i)
+		if strings.TrimSpace(rule.APIKey) == "" {
+			v.errorf(field+".api-key", "must not be empty")
+		} else if !slices.Contains(cfg.APIKeys, strings.TrimSpace(rule.APIKey)) {
+			v.warnf(field+".api-key", "key is not listed in api-keys")
+		}
+		if rule.MaxBodyBytes < 0 {
+			v.errorf(field+".max-body-bytes", "must not be negative")
+		}
+		if rule.MaxMediaBytes < 0 {
+			v.errorf(field+".max-media-bytes", "must not be negative")
+		}
+		if rule.MaxRequestMediaBytes < 0 {
+			v.errorf(field+".max-request-media-bytes", "must not be negative")
+		}
+	}
+}
+
+func (cfg *Config) validateIdempotency(v *validator) {
+	idem := cfg.Idempotency
+	if idem.TTLSeconds < 0 {
+		v.errorf("idempotency.ttl-seconds", "must not be negative")
+	}
+	if idem.MaxEntries < 0 {
+		v.errorf("idempotency.max-entries", "must not be negative")
+	}
+	if idem.MaxResponseBytes < 0 {
+		v.errorf("idempotency.max-response-bytes", "must not be negative")
+	}
+}
+
+func (cfg *Config) validatePayload(v *validator) {
+	check := func(section string, rules []PayloadRule) {
+		for i, rule := range rules {
+			field := fmt.Sprintf("payload.%s[%d]", section, i)
+			if len(rule.Models) == 0 && len(rule.Providers) == 0 && len(rule.APIKeys) == 0 {
+				v.warnf(field, "rule sets no models, providers or api-keys and never applies")
+			}
+			if len(rule.Params) == 0 && strings.TrimSpace(rule.SystemPromptPrefix) == "" {
+				v.warnf(field, "rule sets neither params nor system-prompt-prefix")
+			}
+		}
+	}
+	check("default", cfg.Payload.Default)
+	check("override", cfg.Payload.Override)
+}
+
+func (cfg *Config) validateRouting(v *validator) {
+	classTags := make(map[string]struct{}, len(cfg.ClassificationRules))
+	for i, rule := range cfg.ClassificationRules {
+		field := fmt.Sprintf("classification-rules[%d]", i)
+		if strings.TrimSpace(rule.Tag) == "" {
+			v.errorf(field+".tag", "must not be empty")
+		}
+		classTags[strings.TrimSpace(rule.Tag)] = struct{}{}
+		match := strings.ToLower(strings.TrimSpace(rule.Match))
+		switch match {
+		case "", "prompt", "model", "path":
+		case "header":
+			if strings.TrimSpace(rule.Header) == "" {
+				v.errorf(field+".header", "required when match is header")
+			}
+		default:
+			v.errorf(field+".match", "unknown match %q (want prompt, model, path or header)", rule.Match)
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil || strings.TrimSpace(rule.Pattern) == "" {
+			v.errorf(field+".pattern", "invalid pattern %q", rule.Pattern)
+		}
+	}
+
+	clientKeys := make(map[string]struct{}, len(cfg.APIKeys))
+	for _, key := range cfg.APIKeys {
+		clientKeys[strings.TrimSpace(key)] = struct{}{}
+	}
+	seenPolicy := make(map[string]struct{}, len(cfg.APIKeyPolicies))
+	for i, p := range cfg.APIKeyPolicies {
+		field := fmt.Sprintf("api-key-policies[%d]", i)
+		key := strings.TrimSpace(p.APIKey)
+		if key == "" {
+			v.errorf(field+".api-key", "must not be empty")
+			continue
+		}
+		if _, dup := seenPolicy[key]; dup {
+			v.warnf(field+".api-key", "duplicate policy; the last entry wins")
+		}
+		seenPolicy[key] = struct{}{}
+		if _, known := clientKeys[key]; !known {
+			v.warnf(field+".api-key", "key is not listed in api-keys")
+		}
+		validateSpendCap(v, field, p.MonthlySpendCap, &cfg.UsageDatabase)
+		switch strings.ToLower(strings.TrimSpace(p.Priority)) {
+		case "", "high", "normal", "low":
+		default:
+			v.errorf(field+".priority", "must be high, normal or low, got %q", p.Priority)
+		}
+	}
+	seenInvite := make(map[string]struct{}, len(cfg.InviteCodes))
+	for i, invite := range cfg.InviteCodes {
+		field := fmt.Sprintf("invite-codes[%d]", i)
+		code := strings.ToUpper(strings.TrimSpace(invite.Code))
+		if code == "" {
+			v.errorf(field+".code", "must not be empty")
+		} else if _, dup := seenInvite[code]; dup {
+			v.errorf(field+".code", "duplicate code")
+		}
+		seenInvite[code] = struct{}{}
+		if invite.ExpiresAt != "" {
+			if _, err := time.Parse(time.RFC3339, invite.ExpiresAt); err != nil {
+				v.errorf(field+".expires-at", "must be an RFC 3339 timestamp, got %q", invite.ExpiresAt)
+			}
+		}
+		validateSpendCap(v, field+".policy", invite.Policy.MonthlySpendCap, &cfg.UsageDatabase)
+		switch strings.ToLower(strings.TrimSpace(invite.Policy.Priority)) {
+		case "", "high", "normal", "low":
+		default:
+			v.errorf(field+".policy.priority", "must be high, normal or low, got %q", invite.Policy.Priority)
+		}
+	}
+	seenWorkspace := make(map[string]string)
+	for i, ws := range cfg.Workspaces {
+		field := fmt.Sprintf("workspaces[%d]", i)
+		if strings.TrimSpace(ws.Name) == "" {
+			v.errorf(field+".name", "must not be empty")
+		}
+		for _, key := range ws.APIKeys {
+			key = strings.TrimSpace(key)
+			if other, dup := seenWorkspace[key]; dup && other != ws.Name {
+				v.errorf(field+".api-keys", "a key is already assigned to workspace %q", other)
+			}
+			seenWorkspace[key] = ws.Name
+		}
+	}
+	teamNames := make(map[string]struct{}, len(cfg.Teams))
+	seenTeam := make(map[string]string)
+	for i, t := range cfg.Teams {
+		field := fmt.Sprintf("teams[%d]", i)
+		name := strings.TrimSpace(t.Name)
+		if name == "" {
+			v.errorf(field+".name", "must not be empty")
+		} else if _, dup := teamNames[name]; dup {
+			v.errorf(field+".name", "duplicate team %q", name)
+		}
+		teamNames[name] = struct{}{}
+		for _, key := range t.APIKeys {
+			key = strings.TrimSpace(key)
+			if other, dup := seenTeam[key]; dup && other != name {
+				v.errorf(field+".api-keys", "a key is already assigned to team %q", other)
+			}
+			seenTeam[key] = name
+			if _, known := clientKeys[key]; !known {
+				v.warnf(field+".api-keys", "key is not listed in api-keys")
+			}
+		}
+		validateSpendCap(v, field, t.MonthlySpendCap, &cfg.UsageDatabase)
+		if t.RequestsPerMinute < 0 {
+			v.errorf(field+".requests-per-minute", "must not be negative")
+		}
+		switch strings.ToLower(strings.TrimSpace(t.Policy.Priority)) {
+		case "", "high", "normal", "low":
+		default:
+			v.errorf(field+".policy.priority", "must be high, normal or low, got %q", t.Policy.Priority)
+		}
+	}
+	for i, rule := range cfg.ModelRewrites {
+		field := fmt.Sprintf("model-rewrites[%d]", i)
+		if strings.TrimSpace(rule.From) == "" {
+			v.errorf(field+".from", "must not be empty")
+		}
+		if strings.TrimSpace(rule.To) == "" {
+			v.errorf(field+".to", "must not be empty")
+		}
+		switch strings.ToLower(strings.TrimSpace(rule.Match)) {
+		case "", "exact":
+		case "regex":
+			if _, err := regexp.Compile(rule.From); err != nil {
+				v.errorf(field+".from", "invalid pattern %q", rule.From)
+			}
+		default:
+			v.errorf(field+".match", "unknown match %q (want exact or regex)", rule.Match)
+		}
+		for _, key := range rule.APIKeys {
+			if _, known := clientKeys[strings.TrimSpace(key)]; !known {
+				v.warnf(field+".api-keys", "key is not listed in api-keys")
+				break
+			}
+		}
+		for _, tag := range rule.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
+				v.errorf(field+".tags", "must not contain empty entries")
+				continue
+			}
+			if _, known := classTags[tag]; !known {
+				v.warnf(field+".tags", "tag %q is not assigned by any classification rule", tag)
+			}
+		}
+	}
+	for i, compat := range cfg.OpenAICompatibility {
+		if strings.TrimSpace(compat.BaseURL) == "" {
+			v.warnf(fmt.Sprintf("openai-compatibility[%d].base-url", i), "entry without base-url is ignored")
+		}
+	}
+}
+
+func validateUpstreamPolicy(v *validator, field string, p UpstreamPolicy) {
+	if p.ConnectTimeoutSeconds < 0 || p.ReadTimeoutSeconds < 0 || p.TotalTimeoutSeconds < 0 {
+		v.errorf(field, "timeouts must not be negative")
+	}
+	if p.Retry.MaxAttempts < 0 || p.Retry.InitialBackoffMs < 0 || p.Retry.MaxBackoffMs < 0 {
+		v.errorf(field+".retry", "max-attempts and backoffs must not be negative")
+	}
+	for _, code := range p.Retry.StatusCodes {
+		if code < 400 || code > 599 {
+			v.errorf(field+".retry.status-codes", "%d is not an HTTP error status", code)
+		}
+	}
+}
+
+// validateSpendCap checks a monthly spending cap against the usage database it is
+// computed from: caps need model prices and request rows covering a whole month.
+func validateSpendCap(v *validator, field string, limit float64, db *UsageDatabaseConfig) {
+	if limit == 0 {
+		return
+	}
+	if limit < 0 {
+		v.errorf(field+".monthly-spend-cap", "must not be negative")
+		return
+	}
+	if !db.Enabled || db.ReadOnly {
+		v.warnf(field+".monthly-spend-cap", "has no effect without a writable usage-db")
+		return
+	}
+	if len(db.ModelPrices) == 0 {
+		v.warnf(field+".monthly-spend-cap", "has no effect without usage-db.model-prices")
+	}
+	days := db.RetentionDays
+	if db.RequestsRetentionDays > 0 {
+		days = db.RequestsRetentionDays
+	}
+	if days <= 0 {
+		days = 14 // usage database default
+	}
+	if days < 31 {
+		v.warnf(field+".monthly-spend-cap", "requests older than %d days are deleted by retention and stop counting toward the cap", days)
+	}
+}
+
+// CheckProxyURL reports whether raw is a usable outbound proxy URL with a socks5,
+// http or https scheme and a host.
+func CheckProxyURL(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid URL %q", raw)
+	}
+	switch u.Scheme {
+	case "socks5", "http", "https":
+		return nil
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q; use socks5, http or https", u.Scheme)
+	}
+}
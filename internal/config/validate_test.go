@@ -0,0 +1,211 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateYAML(t *testing.T) {
+	valid := []byte(`
+port: 8317
+usage-db:
+  overflow-policy: spill
+  sqlite:
+    synchronous: normal
+    busy-timeout-ms: 30000
+classification-rules:
+  - tag: coding
+    pattern: "(?i)func "
+`)
+	if res := ValidateYAML(valid, ""); !res.Valid || len(res.Issues) != 0 {
+		t.Fatalf("expected valid config, got %+v", res)
+	}
+
+	if res := ValidateYAML([]byte("port: [1"), ""); res.Valid {
+		t.Fatalf("expected syntax error to be invalid")
+	}
+}
+
+// TestValidateYAMLCases checks each validator on its own: errors lists every field
+// expected to fail and warnings the fields expected to warn.
+func TestValidateYAMLCases(t *testing.T) {
+	cases := []struct {
+		name     string
+		yaml     string
+		errors   []string
+		warnings []string
+	}{
+		{
+			name: "top level",
+			yaml: `
+port: 70000
+unknown-key: true
+`,
+			errors:   []string{"port"},
+			warnings: []string{""},
+		},
+		{
+			name: "usage-db overflow policy",
+			yaml: `
+usage-db:
+  overflow-policy: discard
+`,
+			errors: []string{"usage-db.overflow-policy"},
+		},
+		{
+			name: "usage-db sqlite pragmas",
+			yaml: `
+usage-db:
+  sqlite:
+    journal-mode: wal2
+`,
+			errors: []string{"usage-db.sqlite.journal-mode"},
+		},
+		{
+			name: "usage reports",
+			yaml: `
+usage-db:
+  reports:
+    recipients:
+      - name: weekly
+        webhook: https://hooks.example.com/usage
+        schedule: monthly
+        timezone: Mars/Olympus
+`,
+			errors:   []string{"usage-db.reports.recipients[0].schedule", "usage-db.reports.recipients[0].timezone"},
+			warnings: []string{"usage-db.reports"},
+		},
+		{
+			name: "otlp collectors",
+			yaml: `
+otlp:
+  endpoint: ftp://collector:4317
+  endpoints:
+    - collector-2
+`,
+			errors: []string{"otlp.endpoint", "otlp.endpoints[0]"},
+		},
+		{
+			name: "otlp resource attributes",
+			yaml: `
+otlp:
+  endpoint: http://collector:4318
+  resource_attributes:
+    " ": blank
+`,
+			errors: []string{"otlp.resource_attributes"},
+		},
+		{
+			name: "provider proxies",
+			yaml: `
+provider-proxies:
+  codex: ftp://proxy:21
+`,
+			errors: []string{"provider-proxies.codex"},
+		},
+		{
+			name: "upstream policies",
+			yaml: `
+upstream:
+  read-timeout-seconds: -5
+  providers:
+    claude:
+      retry:
+        status-codes: [200]
+`,
+			errors: []string{"upstream", "upstream.providers.claude.retry.status-codes"},
+		},
+		{
+			name: "classification rules",
+			yaml: `
+classification-rules:
+  - tag: coding
+    match: header
+    pattern: "("
+`,
+			errors: []string{"classification-rules[0].header", "classification-rules[0].pattern"},
+		},
+		{
+			name: "request transforms",
+			yaml: `
+request-transforms:
+  - name: broken
+    formats: [soap]
+    template: "{{ .Body"
+`,
+			errors: []string{"request-transforms[0].formats", "request-transforms[0].template"},
+		},
+		{
+			name: "reasoning budgets",
+			yaml: `
+reasoning-budgets:
+  - max-tokens: -1
+    action: truncate
+`,
+			errors: []string{"reasoning-budgets[0].max-tokens", "reasoning-budgets[0].action"},
+		},
+		{
+			name: "provider spend caps",
+			yaml: `
+provider-spend-caps:
+  - provider: claude
+    monthly-cap: 0
+    action: queue
+`,
+			errors:   []string{"provider-spend-caps[0].monthly-cap", "provider-spend-caps[0].action"},
+			warnings: []string{"provider-spend-caps"},
+		},
+		{
+			name: "redis",
+			yaml: `
+redis:
+  enabled: true
+  address: "localhost"
+`,
+			errors:   []string{"redis.address"},
+			warnings: []string{"redis"},
+		},
+		{
+			name: "oidc audiences required",
+			yaml: `
+oidc-auth:
+  - issuer: https://login.example.com
+`,
+			errors: []string{"oidc-auth[0].audiences"},
+		},
+		{
+			name: "oidc any audience opt-out",
+			yaml: `
+oidc-auth:
+  - issuer: https://login.example.com
+    allow-any-audience: true
+`,
+			warnings: []string{"oidc-auth[0].audiences"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := ValidateYAML([]byte(tc.yaml), "")
+			var errs, warns []string
+			for _, issue := range res.Issues {
+				if issue.Severity == SeverityError {
+					errs = append(errs, issue.Field)
+				} else {
+					warns = append(warns, issue.Field)
+				}
+			}
+			slices.Sort(errs)
+			slices.Sort(warns)
+			want := slices.Sorted(slices.Values(tc.errors))
+			if !slices.Equal(errs, want) {
+				t.Errorf("errors = %q, want %q; issues: %+v", errs, want, res.Issues)
+			}
+			if !slices.Equal(warns, slices.Sorted(slices.Values(tc.warnings))) {
+				t.Errorf("warnings = %q, want %q; issues: %+v", warns, tc.warnings, res.Issues)
+			}
+			if res.Valid != (len(tc.errors) == 0) {
+				t.Errorf("valid = %v with errors %q", res.Valid, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+// Package credbundle moves provider credentials between hosts. Every auth file in
+// auth-dir is collected in plaintext, together with the runtime state the auth
+// manager holds for it (label, disabled flag, cooldowns and per-model state), and the
+// result is sealed with AES-256-GCM under a key derived from a passphrase. Importing
+// writes the files through credcrypt, so they are encrypted under the destination's
+// own master key when credential encryption is enabled there.
+package credbundle
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credcrypt"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+)
+
+const (
+	bundleVersion = "v1"
+	bundleKDF     = "pbkdf2-sha256"
+	// kdfIterations follows the current OWASP recommendation for PBKDF2-HMAC-SHA256.
+	kdfIterations = 600000
+	// minPassphrase is the shortest passphrase accepted for new bundles.
+	minPassphrase = 12
+)
+
+// ErrBadPassphrase is returned when a bundle cannot be opened with the passphrase.
+var ErrBadPassphrase = errors.New("credbundle: wrong passphrase or corrupted bundle")
+
+// envelope is the sealed bundle as written to disk.
+type envelope struct {
+	Version    string `json:"cliproxy_credential_bundle"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"data"`
+}
+
+// Bundle is the plaintext content of a sealed bundle.
+type Bundle struct {
+	CreatedAt   time.Time    `json:"created_at"`
+	Credentials []Credential `json:"credentials"`
+}
+
+// Credential is one auth file and the runtime state it had when exported.
+type Credential struct {
+	// Path is the file path relative to auth-dir.
+	Path string `json:"path"`
+	// Content is the decrypted auth file.
+	Content json.RawMessage `json:"content"`
+	State   *State          `json:"state,omitempty"`
+}
+
+// State is the auth manager state of a credential that does not live in its file.
+type State struct {
+	Label          string                          `json:"label,omitempty"`
+	Disabled       bool                            `json:"disabled,omitempty"`
+	Unavailable    bool                            `json:"unavailable,omitempty"`
+	Status         coreauth.Status                 `json:"status,omitempty"`
+	StatusMessage  string                          `json:"status_message,omitempty"`
+	Quota          coreauth.QuotaState             `json:"quota"`
+	NextRetryAfter time.Time                       `json:"next_retry_after"`
+	ModelStates    map[string]*coreauth.ModelState `json:"model_states,omitempty"`
+}
+
+// ImportResult summarises an import.
+type ImportResult struct {
+	Imported []string `json:"imported"`
+	// Skipped lists files that already existed and were kept.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Collect reads every auth file under authDir. auths supplies runtime state and may
+// be nil, e.g. when exporting from the command line without a running server.
+func Collect(authDir string, auths []*coreauth.Auth) (Bundle, error) {
+	if strings.TrimSpace(authDir) == "" {
+		return Bundle{}, fmt.Errorf("credbundle: auth directory not configured")
+	}
+	states := make(map[string]*State, len(auths))
+	for _, a := range auths {
+		if a == nil {
+			continue
+		}
+		st := StateOf(a)
+		states[a.ID] = st
+		if path := a.Attributes["path"]; path != "" {
+			if rel, err := filepath.Rel(authDir, path); err == nil {
+				states[filepath.ToSlash(rel)] = st
+			}
+		}
+	}
+	bundle := Bundle{CreatedAt: time.Now().UTC(), Credentials: []Credential{}}
+	err := filepath.WalkDir(authDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(strings.ToLower(d.Name()), ".json") {
+			return nil
+		}
+		data, errRead := credcrypt.ReadFile(path)
+		if errRead != nil {
+			return fmt.Errorf("%s: %w", d.Name(), errRead)
+		}
+		if !json.Valid(data) {
+			return nil
+		}
+		rel, errRel := filepath.Rel(authDir, path)
+		if errRel != nil {
+			return errRel
+		}
+		rel = filepath.ToSlash(rel)
+		bundle.Credentials = append(bundle.Credentials, Credential{Path: rel, Content: data, State: states[rel]})
+		return nil
+	})
+	if err != nil {
+		return Bundle{}, err
+	}
+	sort.Slice(bundle.Credentials, func(i, j int) bool { return bundle.Credentials[i].Path < bundle.Credentials[j].Path })
+	return bundle, nil
+}
+
+// StateOf captures the runtime state of a.
+func StateOf(a *coreauth.Auth) *State {
+	return &State{
+		Label:          a.Label,
+		Disabled:       a.Disabled,
+		Unavailable:    a.Unavailable,
+		Status:         a.Status,
+		StatusMessage:  a.StatusMessage,
+		Quota:          a.Quota,
+		NextRetryAfter: a.NextRetryAfter,
+		ModelStates:    a.ModelStates,
+	}
+}
+
+// Apply copies st onto a. Cooldowns that have already expired are restored as is and
+// simply lapse.
+func (st *State) Apply(a *coreauth.Auth) {
+	if st == nil || a == nil {
+		return
+	}
+	if st.Label != "" {
+		a.Label = st.Label
+	}
+	a.Disabled = st.Disabled
+	a.Unavailable = st.Unavailable
+	if st.Status != "" {
+		a.Status = st.Status
+	}
+	a.StatusMessage = st.StatusMessage
+	a.Quota = st.Quota
+	a.NextRetryAfter = st.NextRetryAfter
+	a.ModelStates = st.ModelStates
+}
+
+// Restore writes the files of b into authDir, encrypted under the local master key
+// when credential encryption is enabled. Existing files are kept unless overwrite is
+// set. Imported lists the written paths relative to authDir.
+func Restore(authDir string, b Bundle, overwrite bool) (ImportResult, error) {
+	result := ImportResult{Imported: []string{}}
+	if strings.TrimSpace(authDir) == "" {
+		return result, fmt.Errorf("credbundle: auth directory not configured")
+	}
+	// Validate everything first so a bad entry does not leave a partial import.
+	for _, cred := range b.Credentials {
+		rel := filepath.FromSlash(cred.Path)
+		if !filepath.IsLocal(rel) || !strings.HasSuffix(strings.ToLower(rel), ".json") {
+			return result, fmt.Errorf("credbundle: invalid credential path %q", cred.Path)
+		}
+		if !json.Valid(cred.Content) {
+			return result, fmt.Errorf("credbundle: %s is not valid JSON", cred.Path)
+		}
+	}
+	for _, cred := range b.Credentials {
+		dst := filepath.Join(authDir, filepath.FromSlash(cred.Path))
+		if _, err := os.Stat(dst); err == nil && !overwrite {
+			result.Skipped = append(result.Skipped, cred.Path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+			return result, err
+		}
+		if err := credcrypt.WriteFile(dst, cred.Content, 0o600); err != nil {
+			return result, fmt.Errorf("%s: %w", cred.Path, err)
+		}
+		result.Imported = append(result.Imported, cred.Path)
+	}
+	return result, nil
+}
+
+// Seal encrypts b under passphrase.
+func Seal(b Bundle, passphrase string) ([]byte, error) {
+	if len(passphrase) < minPassphrase {
+		return nil, fmt.Errorf("credbundle: passphrase must be at least %d characters", minPassphrase)
+	}
+	plain, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, salt, kdfIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	env := envelope{
+		Version:    bundleVersion,
+		KDF:        bundleKDF,
+		Iterations: kdfIterations,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plain, []byte(bundleVersion))),
+	}
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// Open decrypts a bundle written by Seal.
+func Open(data []byte, passphrase string) (Bundle, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Version == "" {
+		return Bundle{}, fmt.Errorf("credbundle: not a credential bundle")
+	}
+	// The iteration cap keeps a crafted bundle from pinning the CPU.
+	if env.Version != bundleVersion || env.KDF != bundleKDF || env.Iterations <= 0 || env.Iterations > 10*kdfIterations {
+		return Bundle{}, fmt.Errorf("credbundle: unsupported bundle %s/%s", env.Version, env.KDF)
+	}
+	salt, errSalt := base64.StdEncoding.DecodeString(env.Salt)
+	nonce, errNonce := base64.StdEncoding.DecodeString(env.Nonce)
+	sealed, errData := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err := errors.Join(errSalt, errNonce, errData); err != nil {
+		return Bundle{}, fmt.Errorf("credbundle: malformed bundle: %w", err)
+	}
+	gcm, err := newGCM(passphrase, salt, env.Iterations)
+	if err != nil {
+		return Bundle{}, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return Bundle{}, fmt.Errorf("credbundle: malformed bundle nonce")
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(env.Version))
+	if err != nil {
+		return Bundle{}, ErrBadPassphrase
+	}
+	var b Bundle
+	if err = json.Unmarshal(plain, &b); err != nil {
+		return Bundle{}, fmt.Errorf("credbundle: decode bundle: %w", err)
+	}
+	return b, nil
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("credbundle: passphrase is empty")
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
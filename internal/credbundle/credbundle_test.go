@@ -0,0 +1,148 @@
+package credbundle
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credcrypt"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+)
+
+const testPassphrase = "correct horse battery"
+
+func TestSealOpen(t *testing.T) {
+	b := Bundle{
+		CreatedAt:   time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		Credentials: []Credential{{Path: "claude.json", Content: []byte(`{"access_token":"secret"}`)}},
+	}
+	sealed, err := Seal(b, testPassphrase)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("expected the bundle to be encrypted, got %s", sealed)
+	}
+	got, err := Open(sealed, testPassphrase)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if len(got.Credentials) != 1 || string(got.Credentials[0].Content) != `{"access_token":"secret"}` || !got.CreatedAt.Equal(b.CreatedAt) {
+		t.Fatalf("unexpected bundle %+v", got)
+	}
+	if _, err = Open(sealed, "wrong passphrase!"); !errors.Is(err, ErrBadPassphrase) {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+	if _, err = Seal(b, "short"); err == nil {
+		t.Fatal("expected a short passphrase to be rejected")
+	}
+	if _, err = Open([]byte(`{"type":"claude"}`), testPassphrase); err == nil {
+		t.Fatal("expected a plain auth file to be rejected")
+	}
+}
+
+func TestCollectAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	_, encoded, err := credcrypt.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	keyFile := filepath.Join(dir, "master.key")
+	if err = os.WriteFile(keyFile, []byte(encoded), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = credcrypt.Configure(credcrypt.Options{Enabled: true, KeyFile: keyFile}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	t.Cleanup(func() { _ = credcrypt.Configure(credcrypt.Options{}) })
+
+	src := filepath.Join(dir, "src")
+	if err = os.MkdirAll(filepath.Join(src, "team"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err = credcrypt.WriteFile(filepath.Join(src, "claude.json"), []byte(`{"type":"claude"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(src, "team", "codex.json"), []byte(`{"type":"codex"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(src, "notes.txt"), []byte("ignored"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	retry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	auths := []*coreauth.Auth{{
+		ID:             "claude-1",
+		Label:          "primary",
+		Disabled:       true,
+		NextRetryAfter: retry,
+		Attributes:     map[string]string{"path": filepath.Join(src, "claude.json")},
+	}}
+
+	b, err := Collect(src, auths)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(b.Credentials) != 2 || b.Credentials[0].Path != "claude.json" || b.Credentials[1].Path != "team/codex.json" {
+		t.Fatalf("unexpected credentials %+v", b.Credentials)
+	}
+	if string(b.Credentials[0].Content) != `{"type":"claude"}` {
+		t.Fatalf("expected the sealed file to be decrypted, got %s", b.Credentials[0].Content)
+	}
+	st := b.Credentials[0].State
+	if st == nil || st.Label != "primary" || !st.Disabled || !st.NextRetryAfter.Equal(retry) {
+		t.Fatalf("unexpected state %+v", st)
+	}
+	if b.Credentials[1].State != nil {
+		t.Fatalf("expected no state for an unloaded auth, got %+v", b.Credentials[1].State)
+	}
+
+	dst := filepath.Join(dir, "dst")
+	if err = os.MkdirAll(dst, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dst, "claude.json"), []byte(`{"type":"old"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Restore(dst, b, false)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if len(result.Imported) != 1 || result.Imported[0] != "team/codex.json" || len(result.Skipped) != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dst, "team", "codex.json"))
+	if !credcrypt.IsSealed(raw) {
+		t.Fatalf("expected the imported file to be encrypted, got %s", raw)
+	}
+	if result, err = Restore(dst, b, true); err != nil || len(result.Imported) != 2 {
+		t.Fatalf("overwrite: %+v, %v", result, err)
+	}
+	if data, _ := credcrypt.ReadFile(filepath.Join(dst, "claude.json")); string(data) != `{"type":"claude"}` {
+		t.Fatalf("expected the existing file to be replaced, got %s", data)
+	}
+
+	a := &coreauth.Auth{ID: "claude-1"}
+	st.Apply(a)
+	if a.Label != "primary" || !a.Disabled || !a.NextRetryAfter.Equal(retry) {
+		t.Fatalf("unexpected applied state %+v", a)
+	}
+}
+
+func TestRestoreRejectsEscapingPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{"../escape.json", "/abs.json", "script.sh"} {
+		b := Bundle{Credentials: []Credential{
+			{Path: "ok.json", Content: []byte(`{}`)},
+			{Path: path, Content: []byte(`{}`)},
+		}}
+		if _, err := Restore(dir, b, true); err == nil {
+			t.Fatalf("expected %q to be rejected", path)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ok.json")); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be written when an entry is invalid")
+	}
+}
@@ -0,0 +1,471 @@
+// Package credcrypt encrypts provider credentials at rest. Auth JSON files are sealed
+// with AES-256-GCM under a master key resolved from an environment variable, a key
+// file or an external command (e.g. a KMS decrypt call). Plaintext files remain
+// readable so existing installations can migrate in place.
+package credcrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultKeyEnv is the environment variable consulted when no other key source is configured.
+	DefaultKeyEnv = "CLIPROXY_MASTER_KEY"
+
+	envelopeVersion = "v1"
+	envelopeAlg     = "AES-256-GCM"
+	keySize         = 32
+	commandTimeout  = 30 * time.Second
+)
+
+// Key source names reported by Status.
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceCommand = "command"
+)
+
+// ErrKeyUnavailable is returned when a sealed file references a key that is not loaded.
+var ErrKeyUnavailable = errors.New("credcrypt: encryption key unavailable")
+
+// Options configures credential encryption.
+type Options struct {
+	Enabled bool
+	// KeyEnv names the environment variable holding the base64 or hex encoded master key.
+	KeyEnv string
+	// KeyFile is a file holding the encoded master key. Rotation rewrites it in place.
+	KeyFile string
+	// KeyCommand is run through the shell and must print the encoded master key, which
+	// lets the key be fetched from a KMS or secrets manager.
+	KeyCommand string
+}
+
+// Key is a master key together with its stable identifier.
+type Key struct {
+	ID       string
+	material []byte
+}
+
+type envelope struct {
+	Version    string `json:"cliproxy_encrypted"`
+	Alg        string `json:"alg"`
+	KeyID      string `json:"kid"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"data"`
+}
+
+type keyring struct {
+	opts    Options
+	source  string
+	current Key
+	// keys holds every key able to open files, including ones retired by rotation
+	// during this process lifetime.
+	keys map[string]Key
+}
+
+var (
+	active   atomic.Pointer[keyring]
+	rotateMu sync.Mutex
+)
+
+// Configure loads the master key described by opts. Disabling encryption keeps
+// sealed files unreadable until a key is configured again.
+func Configure(opts Options) error {
+	if !opts.Enabled {
+		active.Store(nil)
+		return nil
+	}
+	key, source, err := loadKey(opts)
+	if err != nil {
+		return err
+	}
+	ring := &keyring{opts: opts, source: source, current: key, keys: map[string]Key{key.ID: key}}
+	if prev := active.Load(); prev != nil {
+		for id, k := range prev.keys {
+			if _, ok := ring.keys[id]; !ok {
+				ring.keys[id] = k
+			}
+		}
+	}
+	active.Store(ring)
+	return nil
+}
+
+// Enabled reports whether new credential writes are encrypted.
+func Enabled() bool { return active.Load() != nil }
+
+// ParseKey decodes a base64 (standard or URL) or hex encoded 32-byte key.
+func ParseKey(encoded string) (Key, error) {
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return Key{}, fmt.Errorf("credcrypt: master key is empty")
+	}
+	decoders := []func(string) ([]byte, error){
+		base64.StdEncoding.DecodeString,
+		base64.RawStdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+		base64.RawURLEncoding.DecodeString,
+		hex.DecodeString,
+	}
+	for _, decode := range decoders {
+		if raw, err := decode(encoded); err == nil && len(raw) == keySize {
+			return newKey(raw), nil
+		}
+	}
+	return Key{}, fmt.Errorf("credcrypt: master key must encode exactly %d bytes", keySize)
+}
+
+// GenerateKey returns a random key and its base64 encoding.
+func GenerateKey() (Key, string, error) {
+	raw := make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return Key{}, "", fmt.Errorf("credcrypt: generate key: %w", err)
+	}
+	return newKey(raw), base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func newKey(raw []byte) Key {
+	sum := sha256.Sum256(raw)
+	return Key{ID: hex.EncodeToString(sum[:8]), material: append([]byte(nil), raw...)}
+}
+
+// LoadKey resolves the key described by opts without installing it, for subsystems
+// that encrypt their own data. KeyEnv falls back to DefaultKeyEnv.
+func LoadKey(opts Options) (Key, error) {
+	key, _, err := loadKey(opts)
+	return key, err
+}
+
+// Derive returns a 32-byte subkey of k bound to purpose, so one master key can back
+// several ciphers without reusing key material.
+func (k Key) Derive(purpose string) []byte {
+	mac := hmac.New(sha256.New, k.material)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func loadKey(opts Options) (Key, string, error) {
+	switch {
+	case strings.TrimSpace(opts.KeyCommand) != "":
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "sh", "-c", opts.KeyCommand).Output()
+		if err != nil {
+			return Key{}, "", fmt.Errorf("credcrypt: key command failed: %w", err)
+		}
+		key, err := ParseKey(string(out))
+		return key, SourceCommand, err
+	case strings.TrimSpace(opts.KeyFile) != "":
+		data, err := os.ReadFile(opts.KeyFile)
+		if err != nil {
+			return Key{}, "", fmt.Errorf("credcrypt: read key file: %w", err)
+		}
+		key, err := ParseKey(string(data))
+		return key, SourceFile, err
+	default:
+		name := strings.TrimSpace(opts.KeyEnv)
+		if name == "" {
+			name = DefaultKeyEnv
+		}
+		key, err := ParseKey(os.Getenv(name))
+		if err != nil {
+			return Key{}, "", fmt.Errorf("credcrypt: %s: %w", name, err)
+		}
+		return key, SourceEnv, nil
+	}
+}
+
+// IsSealed reports whether data is an encrypted credential envelope.
+func IsSealed(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, []byte(`"cliproxy_encrypted"`)) {
+		return false
+	}
+	var env envelope
+	return json.Unmarshal(trimmed, &env) == nil && env.Version != "" && env.Ciphertext != ""
+}
+
+// Seal encrypts plain under the current key. It returns plain unchanged when
+// encryption is disabled or the data is already sealed.
+func Seal(plain []byte) ([]byte, error) {
+	ring := active.Load()
+	if ring == nil || IsSealed(plain) {
+		return plain, nil
+	}
+	return seal(ring.current, plain)
+}
+
+func seal(key Key, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("credcrypt: nonce: %w", err)
+	}
+	ciphertext := gcm.Seal(nil, nonce, plain, []byte(key.ID))
+	return json.Marshal(envelope{
+		Version:    envelopeVersion,
+		Alg:        envelopeAlg,
+		KeyID:      key.ID,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	})
+}
+
+// Open decrypts a sealed envelope. Plaintext input is returned unchanged.
+func Open(data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return data, nil
+	}
+	var env envelope
+	if err := json.Unmarshal(bytes.TrimSpace(data), &env); err != nil {
+		return nil, fmt.Errorf("credcrypt: decode envelope: %w", err)
+	}
+	if env.Version != envelopeVersion || env.Alg != envelopeAlg {
+		return nil, fmt.Errorf("credcrypt: unsupported envelope %s/%s", env.Version, env.Alg)
+	}
+	ring := active.Load()
+	if ring == nil {
+		return nil, ErrKeyUnavailable
+	}
+	key, ok := ring.keys[env.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: key id %s", ErrKeyUnavailable, env.KeyID)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("credcrypt: decode nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("credcrypt: decode ciphertext: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("credcrypt: invalid nonce length")
+	}
+	plain, err := gcm.Open(nil, nonce, ciphertext, []byte(key.ID))
+	if err != nil {
+		return nil, fmt.Errorf("credcrypt: decrypt: %w", err)
+	}
+	return plain, nil
+}
+
+func newGCM(key Key) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.material)
+	if err != nil {
+		return nil, fmt.Errorf("credcrypt: cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadFile reads path and decrypts it when sealed.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Open(data)
+}
+
+// WriteFile seals plain when encryption is enabled and writes it atomically.
+func WriteFile(path string, plain []byte, perm fs.FileMode) error {
+	data, err := Seal(plain)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, data, perm)
+}
+
+// SealFile encrypts an existing plaintext file in place. It is a no-op when
+// encryption is disabled or the file is already sealed.
+func SealFile(path string) error {
+	if !Enabled() {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if IsSealed(data) {
+		return nil
+	}
+	return WriteFile(path, data, 0o600)
+}
+
+func writeAtomic(path string, data []byte, perm fs.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// StatusInfo describes the active encryption state.
+type StatusInfo struct {
+	Enabled bool   `json:"enabled"`
+	KeyID   string `json:"key_id,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// Status reports the active key, if any.
+func Status() StatusInfo {
+	ring := active.Load()
+	if ring == nil {
+		return StatusInfo{}
+	}
+	return StatusInfo{Enabled: true, KeyID: ring.current.ID, Source: ring.source}
+}
+
+// DirStats counts sealed and plaintext credential files under dir.
+type DirStats struct {
+	Encrypted int            `json:"encrypted"`
+	Plaintext int            `json:"plaintext"`
+	ByKey     map[string]int `json:"by_key,omitempty"`
+}
+
+// Inspect walks dir and classifies every auth JSON file.
+func Inspect(dir string) (DirStats, error) {
+	stats := DirStats{ByKey: map[string]int{}}
+	err := walkCredentials(dir, func(path string, data []byte) error {
+		if !IsSealed(data) {
+			stats.Plaintext++
+			return nil
+		}
+		stats.Encrypted++
+		var env envelope
+		if json.Unmarshal(bytes.TrimSpace(data), &env) == nil {
+			stats.ByKey[env.KeyID]++
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// RotateResult summarises a re-encryption pass.
+type RotateResult struct {
+	KeyID     string `json:"key_id"`
+	Rewritten int    `json:"rewritten"`
+	// KeyPersisted is true when the new key was written back to the configured key file.
+	KeyPersisted bool `json:"key_persisted"`
+}
+
+// Rotate re-encrypts every credential file under dir with newKey and makes it the
+// current key. Plaintext files are encrypted as part of the pass. When the active
+// key came from a key file, the encoded new key is written back to that file once
+// all credentials have been rewritten.
+func Rotate(dir string, newKey Key, encoded string) (RotateResult, error) {
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+
+	ring := active.Load()
+	if ring == nil {
+		return RotateResult{}, fmt.Errorf("credcrypt: encryption is not enabled")
+	}
+	// Make the new key able to open files before any are rewritten so concurrent
+	// readers never see an unknown key id.
+	next := &keyring{opts: ring.opts, source: ring.source, current: ring.current, keys: make(map[string]Key, len(ring.keys)+1)}
+	for id, k := range ring.keys {
+		next.keys[id] = k
+	}
+	next.keys[newKey.ID] = newKey
+	active.Store(next)
+
+	result := RotateResult{KeyID: newKey.ID}
+	err := walkCredentials(dir, func(path string, data []byte) error {
+		plain, errOpen := Open(data)
+		if errOpen != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), errOpen)
+		}
+		sealed, errSeal := seal(newKey, plain)
+		if errSeal != nil {
+			return errSeal
+		}
+		if errWrite := writeAtomic(path, sealed, 0o600); errWrite != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), errWrite)
+		}
+		result.Rewritten++
+		return nil
+	})
+	if err != nil {
+		// Files already rewritten stay readable because the new key remains loaded.
+		return result, err
+	}
+
+	final := &keyring{opts: next.opts, source: next.source, current: newKey, keys: next.keys}
+	active.Store(final)
+
+	if final.source == SourceFile && encoded != "" {
+		if errWrite := writeAtomic(final.opts.KeyFile, []byte(encoded+"\n"), 0o600); errWrite != nil {
+			return result, fmt.Errorf("credcrypt: credentials rotated but key file update failed: %w", errWrite)
+		}
+		result.KeyPersisted = true
+	}
+	return result, nil
+}
+
+// Migrate seals any plaintext credential files under dir with the current key.
+func Migrate(dir string) (int, error) {
+	if !Enabled() {
+		return 0, nil
+	}
+	count := 0
+	err := walkCredentials(dir, func(path string, data []byte) error {
+		if IsSealed(data) {
+			return nil
+		}
+		if errWrite := WriteFile(path, data, 0o600); errWrite != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), errWrite)
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+func walkCredentials(dir string, fn func(path string, data []byte) error) error {
+	if strings.TrimSpace(dir) == "" {
+		return fmt.Errorf("credcrypt: auth directory not configured")
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(strings.ToLower(d.Name()), ".json") {
+			return nil
+		}
+		data, errRead := os.ReadFile(path)
+		if errRead != nil || len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+		return fn(path, data)
+	})
+}
@@ -0,0 +1,72 @@
+package credcrypt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSealOpenAndRotate(t *testing.T) {
+	dir := t.TempDir()
+	_, encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	keyFile := filepath.Join(dir, "master.key")
+	if err = os.WriteFile(keyFile, []byte(encoded), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	if err = Configure(Options{Enabled: true, KeyFile: keyFile}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	t.Cleanup(func() { _ = Configure(Options{}) })
+
+	authDir := filepath.Join(dir, "auths")
+	if err = os.MkdirAll(authDir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	plain := []byte(`{"type":"claude","access_token":"secret"}`)
+	legacy := filepath.Join(authDir, "legacy.json")
+	if err = os.WriteFile(legacy, plain, 0o600); err != nil {
+		t.Fatalf("write legacy: %v", err)
+	}
+	if n, errMigrate := Migrate(authDir); errMigrate != nil || n != 1 {
+		t.Fatalf("migrate: n=%d err=%v", n, errMigrate)
+	}
+	raw, _ := os.ReadFile(legacy)
+	if !IsSealed(raw) || bytes.Contains(raw, []byte("secret")) {
+		t.Fatalf("expected sealed file, got %s", raw)
+	}
+
+	newKey, newEncoded, _ := GenerateKey()
+	result, err := Rotate(authDir, newKey, newEncoded)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if result.Rewritten != 1 || !result.KeyPersisted || Status().KeyID != newKey.ID {
+		t.Fatalf("unexpected rotate result %+v status %+v", result, Status())
+	}
+	persisted, _ := os.ReadFile(keyFile)
+	if strings.TrimSpace(string(persisted)) != newEncoded {
+		t.Fatal("key file was not updated")
+	}
+
+	// A fresh keyring loaded from the rotated key file must open the files.
+	active.Store(nil)
+	if err = Configure(Options{Enabled: true, KeyFile: keyFile}); err != nil {
+		t.Fatalf("reconfigure: %v", err)
+	}
+	got, err := ReadFile(legacy)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("open after rotation: %s %v", got, err)
+	}
+
+	if err = Configure(Options{}); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if _, err = ReadFile(legacy); err == nil {
+		t.Fatal("expected sealed file to be unreadable without a key")
+	}
+}
@@ -0,0 +1,290 @@
+// Package httpmetrics records request counts, latency histograms and in-flight
+// gauges per HTTP route and renders them in the Prometheus text exposition format.
+// Routes are identified by their template (e.g. "/v0/management/usage/:id") so
+// path parameters never create new series.
+package httpmetrics
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// ContentType is the media type of the exposition written by Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// UnmatchedRoute labels requests that did not match any registered route, so
+// scans of random paths collapse into one series.
+const UnmatchedRoute = "unmatched"
+
+// DefaultBuckets are the duration histogram bounds in seconds used when none are configured.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type seriesKey struct {
+	routeKey
+	status string
+}
+
+type series struct {
+	count   uint64
+	sum     float64
+	buckets []uint64
+}
+
+// Registry holds the metrics of every route seen since it was created.
+type Registry struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	series   map[seriesKey]*series
+	inFlight map[routeKey]int64
+}
+
+var (
+	active      atomic.Pointer[Registry]
+	bearerToken atomic.Pointer[string]
+)
+
+// NewRegistry creates an empty registry with the given histogram bounds, falling
+// back to DefaultBuckets when none are given.
+func NewRegistry(buckets []float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Registry{
+		buckets:  slices.Clone(buckets),
+		series:   make(map[seriesKey]*series),
+		inFlight: make(map[routeKey]int64),
+	}
+}
+
+// Set enables or disables collection. Recorded series survive a reload unless the
+// histogram buckets change.
+func Set(cfg config.PrometheusConfig) {
+	token := strings.TrimSpace(cfg.BearerToken)
+	bearerToken.Store(&token)
+	if !cfg.Enabled {
+		active.Store(nil)
+		return
+	}
+	buckets := cfg.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	if prev := active.Load(); prev != nil && slices.Equal(prev.buckets, buckets) {
+		return
+	}
+	active.Store(NewRegistry(buckets))
+}
+
+// Active returns the active registry or nil when collection is disabled.
+func Active() *Registry {
+	return active.Load()
+}
+
+// Authorized reports whether an Authorization header value may scrape the metrics.
+// Any request may when no bearer token is configured.
+func Authorized(header string) bool {
+	token := bearerToken.Load()
+	if token == nil || *token == "" {
+		return true
+	}
+	provided, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(provided)), []byte(*token)) == 1
+}
+
+// Start marks a request on route as in flight. The returned function records its
+// status and duration and must be called exactly once.
+func (r *Registry) Start(method, route string) func(status int, elapsed time.Duration) {
+	if r == nil {
+		return func(int, time.Duration) {}
+	}
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	key := routeKey{method: method, route: route}
+	r.mu.Lock()
+	r.inFlight[key]++
+	r.mu.Unlock()
+	return func(status int, elapsed time.Duration) {
+		seconds := elapsed.Seconds()
+		skey := seriesKey{routeKey: key, status: StatusClass(status)}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.inFlight[key]--
+		s := r.series[skey]
+		if s == nil {
+			s = &series{buckets: make([]uint64, len(r.buckets))}
+			r.series[skey] = s
+		}
+		s.count++
+		s.sum += seconds
+		if i := sort.SearchFloat64s(r.buckets, seconds); i < len(s.buckets) {
+			s.buckets[i]++
+		}
+	}
+}
+
+// StatusClass maps an HTTP status code to its class label, e.g. 404 to "4xx".
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// Write renders every series in the Prometheus text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	keys := make([]seriesKey, 0, len(r.series))
+	snapshot := make(map[seriesKey]series, len(r.series))
+	for k, s := range r.series {
+		keys = append(keys, k)
+		snapshot[k] = series{count: s.count, sum: s.sum, buckets: slices.Clone(s.buckets)}
+	}
+	routes := make([]routeKey, 0, len(r.inFlight))
+	inFlight := make(map[routeKey]int64, len(r.inFlight))
+	for k, n := range r.inFlight {
+		routes = append(routes, k)
+		inFlight[k] = n
+	}
+	r.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].route != routes[j].route {
+			return routes[i].route < routes[j].route
+		}
+		return routes[i].method < routes[j].method
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP cliproxy_http_requests_total HTTP requests handled, by route template and status class.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_http_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(bw, "cliproxy_http_requests_total{%s} %d\n", k.labels(), snapshot[k].count)
+	}
+
+	fmt.Fprintln(bw, "# HELP cliproxy_http_request_duration_seconds HTTP request duration, by route template and status class.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_http_request_duration_seconds histogram")
+	for _, k := range keys {
+		s := snapshot[k]
+		labels := k.labels()
+		var cumulative uint64
+		for i, bound := range r.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(bw, "cliproxy_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(bw, "cliproxy_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, s.count)
+		fmt.Fprintf(bw, "cliproxy_http_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(s.sum))
+		fmt.Fprintf(bw, "cliproxy_http_request_duration_seconds_count{%s} %d\n", labels, s.count)
+	}
+
+	fmt.Fprintln(bw, "# HELP cliproxy_http_requests_in_flight HTTP requests currently being handled, by route template.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_http_requests_in_flight gauge")
+	for _, k := range routes {
+		fmt.Fprintf(bw, "cliproxy_http_requests_in_flight{method=\"%s\",route=\"%s\"} %d\n", escapeLabel(k.method), escapeLabel(k.route), inFlight[k])
+	}
+	return bw.Flush()
+}
+
+// QueueClass is the credential slot queue state of one request priority class.
+type QueueClass struct {
+	Priority    string
+	Queued      int
+	Waited      uint64
+	Timeouts    uint64
+	WaitSeconds float64
+}
+
+// WriteQueueClasses renders credential slot queue depth and wait metrics per priority class.
+func WriteQueueClasses(w io.Writer, classes []QueueClass) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP cliproxy_credential_queue_depth Requests waiting for a credential concurrency slot, by priority.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_credential_queue_depth gauge")
+	for _, c := range classes {
+		fmt.Fprintf(bw, "cliproxy_credential_queue_depth{priority=\"%s\"} %d\n", escapeLabel(c.Priority), c.Queued)
+	}
+	fmt.Fprintln(bw, "# HELP cliproxy_credential_queue_waits_total Requests granted a credential slot after queueing, by priority.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_credential_queue_waits_total counter")
+	for _, c := range classes {
+		fmt.Fprintf(bw, "cliproxy_credential_queue_waits_total{priority=\"%s\"} %d\n", escapeLabel(c.Priority), c.Waited)
+	}
+	fmt.Fprintln(bw, "# HELP cliproxy_credential_queue_wait_seconds_total Time spent queueing for granted credential slots, by priority.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_credential_queue_wait_seconds_total counter")
+	for _, c := range classes {
+		fmt.Fprintf(bw, "cliproxy_credential_queue_wait_seconds_total{priority=\"%s\"} %s\n", escapeLabel(c.Priority), formatFloat(c.WaitSeconds))
+	}
+	fmt.Fprintln(bw, "# HELP cliproxy_credential_queue_timeouts_total Requests that timed out waiting for a credential slot, by priority.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_credential_queue_timeouts_total counter")
+	for _, c := range classes {
+		fmt.Fprintf(bw, "cliproxy_credential_queue_timeouts_total{priority=\"%s\"} %d\n", escapeLabel(c.Priority), c.Timeouts)
+	}
+	return bw.Flush()
+}
+
+// LoadShedding is the proxy-wide load and the requests shed per reason.
+type LoadShedding struct {
+	InFlight int64
+	// Shed counts shed requests keyed by reason.
+	Shed map[string]uint64
+}
+
+// WriteLoadShedding renders the in-flight gauge and shed request counters of load shedding.
+func WriteLoadShedding(w io.Writer, ls LoadShedding) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP cliproxy_load_in_flight Client API requests being handled, as counted by load shedding.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_load_in_flight gauge")
+	fmt.Fprintf(bw, "cliproxy_load_in_flight %d\n", ls.InFlight)
+	fmt.Fprintln(bw, "# HELP cliproxy_load_shed_total Client API requests rejected with 503 because the proxy was overloaded, by reason.")
+	fmt.Fprintln(bw, "# TYPE cliproxy_load_shed_total counter")
+	reasons := make([]string, 0, len(ls.Shed))
+	for reason := range ls.Shed {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(bw, "cliproxy_load_shed_total{reason=\"%s\"} %d\n", escapeLabel(reason), ls.Shed[reason])
+	}
+	return bw.Flush()
+}
+
+func (k seriesKey) labels() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\",status=\"%s\"", escapeLabel(k.method), escapeLabel(k.route), k.status)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
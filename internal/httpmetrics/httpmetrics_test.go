@@ -0,0 +1,58 @@
+package httpmetrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestRegistryWritesHistogramsAndGauges(t *testing.T) {
+	r := NewRegistry([]float64{0.1, 1})
+	r.Start("POST", "/v1/chat/completions")(200, 50*time.Millisecond)
+	r.Start("POST", "/v1/chat/completions")(201, 2*time.Second)
+	r.Start("GET", "")(404, time.Millisecond)
+	r.Start("GET", "/v0/management/events")
+
+	var out strings.Builder
+	if err := r.Write(&out); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	for _, want := range []string{
+		`cliproxy_http_requests_total{method="POST",route="/v1/chat/completions",status="2xx"} 2`,
+		`cliproxy_http_request_duration_seconds_bucket{method="POST",route="/v1/chat/completions",status="2xx",le="0.1"} 1`,
+		`cliproxy_http_request_duration_seconds_bucket{method="POST",route="/v1/chat/completions",status="2xx",le="1"} 1`,
+		`cliproxy_http_request_duration_seconds_bucket{method="POST",route="/v1/chat/completions",status="2xx",le="+Inf"} 2`,
+		`cliproxy_http_request_duration_seconds_sum{method="POST",route="/v1/chat/completions",status="2xx"} 2.05`,
+		`cliproxy_http_requests_total{method="GET",route="unmatched",status="4xx"} 1`,
+		`cliproxy_http_requests_in_flight{method="GET",route="/v0/management/events"} 1`,
+		`cliproxy_http_requests_in_flight{method="POST",route="/v1/chat/completions"} 0`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestSetKeepsSeriesAndChecksBearerToken(t *testing.T) {
+	defer Set(config.PrometheusConfig{})
+
+	Set(config.PrometheusConfig{Enabled: true})
+	first := Active()
+	Set(config.PrometheusConfig{Enabled: true, BearerToken: "secret"})
+	if Active() != first {
+		t.Fatal("expected a token change to keep the recorded series")
+	}
+	if Authorized("") || Authorized("Bearer wrong") || !Authorized("Bearer secret") {
+		t.Fatal("expected only the configured bearer token to be accepted")
+	}
+	Set(config.PrometheusConfig{Enabled: true, Buckets: []float64{1}})
+	if Active() == first {
+		t.Fatal("expected new buckets to start a new registry")
+	}
+	Set(config.PrometheusConfig{})
+	if Active() != nil || !Authorized("") {
+		t.Fatal("expected disabling to drop the registry and the token")
+	}
+}
@@ -0,0 +1,204 @@
+// Package idempotency stores the responses of client API requests by Idempotency-Key
+// so retries are answered without forwarding the request upstream again. The active
+// store is swapped atomically on config reload.
+package idempotency
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+const (
+	defaultTTL              = 24 * time.Hour
+	defaultMaxEntries       = 10000
+	defaultMaxResponseBytes = 1 << 20
+)
+
+// Outcome tells the caller of Begin how to answer a request.
+type Outcome int
+
+const (
+	// Proceed means the key is new and reserved; the caller must Complete or Abandon it.
+	Proceed Outcome = iota
+	// Replay means a stored response exists for the key and the same request.
+	Replay
+	// InProgress means a request with the key is still being handled.
+	InProgress
+	// Mismatch means the key was used before for a different request.
+	Mismatch
+)
+
+// Response is a stored response.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	key         string
+	fingerprint string
+	expires     time.Time
+	done        bool
+	response    Response
+}
+
+// Store keeps responses in memory, evicting expired entries and, beyond the entry
+// limit, the oldest ones.
+type Store struct {
+	mu               sync.Mutex
+	ttl              time.Duration
+	maxEntries       int
+	maxResponseBytes int64
+	entries          map[string]*list.Element
+	// order holds entries oldest first.
+	order *list.List
+	now   func() time.Time
+}
+
+var active atomic.Pointer[Store]
+
+// NewStore creates an empty store, applying defaults to zero limits.
+func NewStore(cfg config.IdempotencyConfig) *Store {
+	s := &Store{entries: make(map[string]*list.Element), order: list.New(), now: time.Now}
+	s.configure(cfg)
+	return s
+}
+
+func (s *Store) configure(cfg config.IdempotencyConfig) {
+	s.ttl = time.Duration(cfg.TTLSeconds) * time.Second
+	if s.ttl <= 0 {
+		s.ttl = defaultTTL
+	}
+	s.maxEntries = cfg.MaxEntries
+	if s.maxEntries <= 0 {
+		s.maxEntries = defaultMaxEntries
+	}
+	s.maxResponseBytes = cfg.MaxResponseBytes
+	if s.maxResponseBytes <= 0 {
+		s.maxResponseBytes = defaultMaxResponseBytes
+	}
+}
+
+// Set enables, reconfigures or disables the active store. Stored responses survive
+// a reload that keeps the feature enabled.
+func Set(cfg config.IdempotencyConfig) {
+	if !cfg.Enabled {
+		active.Store(nil)
+		return
+	}
+	if prev := active.Load(); prev != nil {
+		prev.mu.Lock()
+		prev.configure(cfg)
+		prev.evictLocked(prev.now())
+		prev.mu.Unlock()
+		return
+	}
+	active.Store(NewStore(cfg))
+}
+
+// Active returns the active store or nil when idempotency keys are ignored.
+func Active() *Store {
+	return active.Load()
+}
+
+// Key scopes an Idempotency-Key to the client API key that sent it.
+func Key(apiKey, idempotencyKey string) string {
+	sum := sha256.Sum256([]byte(apiKey + "\x00" + idempotencyKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint identifies a request so a key reused for another request is detected.
+func Fingerprint(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + uri + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MaxResponseBytes is the largest response body the store keeps.
+func (s *Store) MaxResponseBytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxResponseBytes
+}
+
+// Begin looks key up. For a new key it reserves the key for the request identified
+// by fingerprint and returns Proceed; the stored response is returned with Replay.
+func (s *Store) Begin(key, fingerprint string) (Response, Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*entry)
+		if now.Before(e.expires) {
+			switch {
+			case e.fingerprint != fingerprint:
+				return Response{}, Mismatch
+			case !e.done:
+				return Response{}, InProgress
+			default:
+				return e.response, Replay
+			}
+		}
+		s.removeLocked(el)
+	}
+	s.entries[key] = s.order.PushBack(&entry{key: key, fingerprint: fingerprint, expires: now.Add(s.ttl)})
+	s.evictLocked(now)
+	return Response{}, Proceed
+}
+
+// Complete stores the response of a reserved key; the TTL starts now.
+func (s *Store) Complete(key string, resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	e := el.Value.(*entry)
+	e.done = true
+	e.response = resp
+	e.expires = s.now().Add(s.ttl)
+	s.order.MoveToBack(el)
+}
+
+// Abandon releases a reserved key without storing a response, so a retry is
+// forwarded again.
+func (s *Store) Abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok && !el.Value.(*entry).done {
+		s.removeLocked(el)
+	}
+}
+
+// Len returns the number of stored and reserved keys.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// evictLocked drops expired entries from the front of order, which is sorted by
+// expiry as every entry gets the same TTL when it is added or completed.
+func (s *Store) evictLocked(now time.Time) {
+	for el := s.order.Front(); el != nil && !now.Before(el.Value.(*entry).expires); el = s.order.Front() {
+		s.removeLocked(el)
+	}
+	for s.order.Len() > s.maxEntries {
+		s.removeLocked(s.order.Front())
+	}
+}
+
+func (s *Store) removeLocked(el *list.Element) {
+	delete(s.entries, el.Value.(*entry).key)
+	s.order.Remove(el)
+}
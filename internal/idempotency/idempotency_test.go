@@ -0,0 +1,56 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestStoreBeginCompleteReplay(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := NewStore(config.IdempotencyConfig{TTLSeconds: 60, MaxEntries: 2})
+	s.now = func() time.Time { return now }
+
+	key := Key("client-key", "retry-1")
+	if Key("other-key", "retry-1") == key {
+		t.Fatalf("keys of different clients must not collide")
+	}
+	fp := Fingerprint("POST", "/v1/chat/completions", []byte(`{"model":"m"}`))
+	if _, outcome := s.Begin(key, fp); outcome != Proceed {
+		t.Fatalf("first Begin = %v, want Proceed", outcome)
+	}
+	if _, outcome := s.Begin(key, fp); outcome != InProgress {
+		t.Fatalf("concurrent Begin = %v, want InProgress", outcome)
+	}
+	s.Complete(key, Response{Status: 200, Body: []byte("ok")})
+	if resp, outcome := s.Begin(key, fp); outcome != Replay || string(resp.Body) != "ok" {
+		t.Fatalf("retry = %v %q, want Replay ok", outcome, resp.Body)
+	}
+	if _, outcome := s.Begin(key, Fingerprint("POST", "/v1/chat/completions", []byte(`{}`))); outcome != Mismatch {
+		t.Fatalf("different body = %v, want Mismatch", outcome)
+	}
+
+	now = now.Add(61 * time.Second)
+	if _, outcome := s.Begin(key, fp); outcome != Proceed {
+		t.Fatalf("Begin after TTL = %v, want Proceed", outcome)
+	}
+	s.Abandon(key)
+	if _, outcome := s.Begin(key, fp); outcome != Proceed {
+		t.Fatalf("Begin after Abandon = %v, want Proceed", outcome)
+	}
+}
+
+func TestStoreEvictsOldest(t *testing.T) {
+	s := NewStore(config.IdempotencyConfig{MaxEntries: 2})
+	for _, k := range []string{"a", "b", "c"} {
+		s.Begin(k, "fp")
+		s.Complete(k, Response{Status: 200})
+	}
+	if s.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", s.Len())
+	}
+	if _, outcome := s.Begin("a", "fp"); outcome != Proceed {
+		t.Fatalf("oldest entry should have been evicted, got %v", outcome)
+	}
+}
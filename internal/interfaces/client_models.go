@@ -64,6 +64,9 @@ type Part struct {
 	// InlineData contains base64-encoded data with its MIME type (e.g., images).
 	InlineData *InlineData `json:"inlineData,omitempty"`
 
+	// FileData references media by URI (e.g., an uploaded file or a public URL).
+	FileData *FileData `json:"fileData,omitempty"`
+
 	// ThoughtSignature is a provider-required signature that accompanies certain parts.
 	ThoughtSignature string `json:"thoughtSignature,omitempty"`
 
@@ -84,6 +87,15 @@ type InlineData struct {
 	Data string `json:"data,omitempty"`
 }
 
+// FileData references media stored outside the request by its URI.
+type FileData struct {
+	// MimeType specifies the media type of the referenced file (e.g., "application/pdf").
+	MimeType string `json:"mimeType,omitempty"`
+
+	// FileURI is the location of the file.
+	FileURI string `json:"fileUri"`
+}
+
 // FunctionCall represents a tool call requested by the model.
 // It includes the function name and its arguments that the model wants to execute.
 type FunctionCall struct {
@@ -0,0 +1,109 @@
+// Package invite issues and redeems one-time invite codes. A redeemed code is
+// exchanged for a new client API key that inherits the code's policy, so team leads
+// can hand out codes instead of keys.
+package invite
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// ErrInvalidCode is returned for unknown and expired codes alike, so callers cannot
+// tell which codes once existed.
+var ErrInvalidCode = errors.New("invalid or expired invite code")
+
+// NewCode returns a random code of the form XXXX-XXXX-XXXX-XXXX.
+func NewCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := base32.StdEncoding.EncodeToString(buf)
+	groups := make([]string, 0, 4)
+	for i := 0; i < len(raw); i += 4 {
+		groups = append(groups, raw[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// NewKey returns a random client API key.
+func NewKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "sk-" + hex.EncodeToString(buf), nil
+}
+
+// Expired reports whether the code no longer accepts redemptions at now.
+func Expired(code config.InviteCode, now time.Time) bool {
+	if code.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, code.ExpiresAt)
+	return err != nil || !now.Before(expiresAt)
+}
+
+// Redeem exchanges code for a new client API key. It removes the code from cfg,
+// appends the key to api-keys and its policy to api-key-policies, and returns the key
+// with the redeemed entry. The caller persists cfg and serialises calls.
+func Redeem(cfg *config.Config, code string, now time.Time) (string, config.InviteCode, error) {
+	code = normalize(code)
+	if cfg == nil || code == "" {
+		return "", config.InviteCode{}, ErrInvalidCode
+	}
+	index := -1
+	for i, entry := range cfg.InviteCodes {
+		// Compare every entry in constant time so timing does not leak prefixes.
+		if subtle.ConstantTimeCompare([]byte(normalize(entry.Code)), []byte(code)) == 1 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return "", config.InviteCode{}, ErrInvalidCode
+	}
+	entry := cfg.InviteCodes[index]
+	if Expired(entry, now) {
+		return "", config.InviteCode{}, ErrInvalidCode
+	}
+	key, err := NewKey()
+	if err != nil {
+		return "", config.InviteCode{}, err
+	}
+	cfg.InviteCodes = append(cfg.InviteCodes[:index:index], cfg.InviteCodes[index+1:]...)
+	cfg.APIKeys = append(cfg.APIKeys, key)
+	policy := entry.Policy
+	policy.APIKey = key
+	cfg.APIKeyPolicies = append(cfg.APIKeyPolicies, policy)
+	return key, entry, nil
+}
+
+// PruneExpired removes the codes that expired before now and reports how many it removed.
+func PruneExpired(cfg *config.Config, now time.Time) int {
+	if cfg == nil {
+		return 0
+	}
+	kept := make([]config.InviteCode, 0, len(cfg.InviteCodes))
+	for _, entry := range cfg.InviteCodes {
+		if !Expired(entry, now) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(cfg.InviteCodes) - len(kept)
+	if removed > 0 {
+		cfg.InviteCodes = kept
+	}
+	return removed
+}
+
+// normalize makes codes case-insensitive and tolerant of surrounding whitespace.
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
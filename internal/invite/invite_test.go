@@ -0,0 +1,58 @@
+package invite
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestRedeem(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := &config.Config{
+		InviteCodes: []config.InviteCode{
+			{Code: "ABCD-EFGH", Label: "alice", Policy: config.APIKeyPolicy{AllowedModels: []string{"gpt-5"}, MonthlySpendCap: 20}},
+			{Code: "OLD-CODE", ExpiresAt: "2026-04-30T00:00:00Z"},
+		},
+	}
+	cfg.APIKeys = []string{"existing"}
+
+	key, entry, err := Redeem(cfg, " abcd-efgh ", now)
+	if err != nil {
+		t.Fatalf("Redeem: %v", err)
+	}
+	if !strings.HasPrefix(key, "sk-") || entry.Label != "alice" {
+		t.Fatalf("unexpected key %q or entry %+v", key, entry)
+	}
+	if len(cfg.APIKeys) != 2 || cfg.APIKeys[1] != key {
+		t.Fatalf("expected the key to be added, got %v", cfg.APIKeys)
+	}
+	if len(cfg.APIKeyPolicies) != 1 || cfg.APIKeyPolicies[0].APIKey != key || cfg.APIKeyPolicies[0].MonthlySpendCap != 20 {
+		t.Fatalf("expected the code policy for the key, got %+v", cfg.APIKeyPolicies)
+	}
+	if len(cfg.InviteCodes) != 1 || cfg.InviteCodes[0].Code != "OLD-CODE" {
+		t.Fatalf("expected the code to be consumed, got %+v", cfg.InviteCodes)
+	}
+
+	if _, _, err = Redeem(cfg, "ABCD-EFGH", now); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected a redeemed code to be rejected, got %v", err)
+	}
+	if _, _, err = Redeem(cfg, "OLD-CODE", now); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected an expired code to be rejected, got %v", err)
+	}
+	if removed := PruneExpired(cfg, now); removed != 1 || len(cfg.InviteCodes) != 0 {
+		t.Fatalf("expected the expired code to be pruned, removed %d", removed)
+	}
+}
+
+func TestNewCode(t *testing.T) {
+	code, err := NewCode()
+	if err != nil {
+		t.Fatalf("NewCode: %v", err)
+	}
+	if len(code) != 19 || strings.Count(code, "-") != 3 {
+		t.Fatalf("unexpected code format %q", code)
+	}
+}
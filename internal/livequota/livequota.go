@@ -0,0 +1,246 @@
+// Package livequota records the remaining upstream quota providers report on their
+// responses, so the management API can show how much of each credential's rate
+// limits is left and when they reset. Anthropic and OpenAI-style providers send
+// rate-limit headers with every response; Google APIs only describe the exhausted
+// quota in the body of a 429 response.
+package livequota
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// errorPeekLimit bounds how much of a 429 body is read to find Google quota details.
+const errorPeekLimit = 64 << 10
+
+// Limit is the last reported state of one upstream rate limit.
+type Limit struct {
+	// Name identifies the limit, e.g. "requests", "tokens", "input-tokens" or a
+	// Google quota ID.
+	Name      string `json:"name"`
+	Limit     int64  `json:"limit,omitempty"`
+	Remaining int64  `json:"remaining"`
+	// ResetAt is when the provider said the limit replenishes, if it did.
+	ResetAt *time.Time `json:"reset-at,omitempty"`
+	// Stale is set once ResetAt has passed; Remaining has likely been refilled since.
+	Stale bool `json:"stale,omitempty"`
+}
+
+// Snapshot is the quota last reported for one credential.
+type Snapshot struct {
+	AuthID     string    `json:"auth-id"`
+	Provider   string    `json:"provider"`
+	ObservedAt time.Time `json:"observed-at"`
+	Limits     []Limit   `json:"limits"`
+}
+
+// Tracker keeps the latest limits per credential.
+type Tracker struct {
+	mu      sync.Mutex
+	entries map[string]*Snapshot
+}
+
+var defaultTracker = NewTracker()
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	return &Tracker{entries: make(map[string]*Snapshot)}
+}
+
+// Observe records limits reported for authID with the shared tracker.
+func Observe(authID, provider string, limits []Limit, now time.Time) {
+	defaultTracker.Observe(authID, provider, limits, now)
+}
+
+// Snapshots returns the shared tracker's snapshots.
+func Snapshots(now time.Time) []Snapshot {
+	return defaultTracker.Snapshots(now)
+}
+
+// Observe merges limits into the snapshot of authID. Limits missing from this
+// response keep their previous values.
+func (t *Tracker) Observe(authID, provider string, limits []Limit, now time.Time) {
+	if authID == "" || len(limits) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := t.entries[authID]
+	if entry == nil {
+		entry = &Snapshot{AuthID: authID}
+		t.entries[authID] = entry
+	}
+	entry.Provider = provider
+	entry.ObservedAt = now
+	for _, limit := range limits {
+		replaced := false
+		for i := range entry.Limits {
+			if entry.Limits[i].Name == limit.Name {
+				entry.Limits[i] = limit
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			entry.Limits = append(entry.Limits, limit)
+		}
+	}
+	sort.Slice(entry.Limits, func(i, j int) bool { return entry.Limits[i].Name < entry.Limits[j].Name })
+}
+
+// Snapshots returns a copy of every snapshot, ordered by provider and auth ID, with
+// limits whose reset time passed before now marked stale.
+func (t *Tracker) Snapshots(now time.Time) []Snapshot {
+	t.mu.Lock()
+	out := make([]Snapshot, 0, len(t.entries))
+	for _, entry := range t.entries {
+		snapshot := *entry
+		snapshot.Limits = append([]Limit(nil), entry.Limits...)
+		for i := range snapshot.Limits {
+			limit := &snapshot.Limits[i]
+			limit.Stale = limit.ResetAt != nil && !now.Before(*limit.ResetAt)
+		}
+		out = append(out, snapshot)
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].AuthID < out[j].AuthID
+	})
+	return out
+}
+
+// ParseHeaders reads the rate-limit headers of an upstream response: Anthropic's
+// anthropic-ratelimit-<name>-{limit,remaining,reset} with RFC 3339 resets and the
+// OpenAI-style x-ratelimit-{limit,remaining,reset}-<name> with duration resets.
+func ParseHeaders(header http.Header, now time.Time) []Limit {
+	var limits []Limit
+	for _, name := range []string{"requests", "tokens", "input-tokens", "output-tokens"} {
+		prefix := "Anthropic-Ratelimit-" + name + "-"
+		if limit, ok := headerLimit(name, header.Get(prefix+"Limit"), header.Get(prefix+"Remaining")); ok {
+			if reset, err := time.Parse(time.RFC3339, strings.TrimSpace(header.Get(prefix+"Reset"))); err == nil {
+				reset = reset.UTC()
+				limit.ResetAt = &reset
+			}
+			limits = append(limits, limit)
+			continue
+		}
+		if limit, ok := headerLimit(name, header.Get("X-Ratelimit-Limit-"+name), header.Get("X-Ratelimit-Remaining-"+name)); ok {
+			if reset, err := time.ParseDuration(strings.TrimSpace(header.Get("X-Ratelimit-Reset-" + name))); err == nil {
+				resetAt := now.Add(reset).UTC()
+				limit.ResetAt = &resetAt
+			}
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+func headerLimit(name, limitValue, remainingValue string) (Limit, bool) {
+	remaining, err := strconv.ParseInt(strings.TrimSpace(remainingValue), 10, 64)
+	if err != nil {
+		return Limit{}, false
+	}
+	limit, _ := strconv.ParseInt(strings.TrimSpace(limitValue), 10, 64)
+	return Limit{Name: name, Limit: limit, Remaining: remaining}, true
+}
+
+// ParseGoogleQuotaError reads the exhausted quotas of a Google API 429 body: one
+// limit per QuotaFailure violation (or a single "quota" limit without any), all with
+// nothing remaining and resetting after the RetryInfo delay.
+func ParseGoogleQuotaError(body []byte, now time.Time) []Limit {
+	details := gjson.GetBytes(body, "error.details")
+	if !details.IsArray() {
+		return nil
+	}
+	var (
+		resetAt *time.Time
+		limits  []Limit
+	)
+	for _, detail := range details.Array() {
+		switch detail.Get("@type").String() {
+		case "type.googleapis.com/google.rpc.RetryInfo":
+			if delay, err := time.ParseDuration(detail.Get("retryDelay").String()); err == nil {
+				at := now.Add(delay).UTC()
+				resetAt = &at
+			}
+		case "type.googleapis.com/google.rpc.QuotaFailure":
+			for _, violation := range detail.Get("violations").Array() {
+				name := violation.Get("quotaId").String()
+				if name == "" {
+					name = violation.Get("quotaMetric").String()
+				}
+				if name == "" {
+					continue
+				}
+				limits = append(limits, Limit{Name: name, Limit: violation.Get("quotaValue").Int()})
+			}
+		}
+	}
+	if len(limits) == 0 {
+		if resetAt == nil {
+			return nil
+		}
+		limits = []Limit{{Name: "quota"}}
+	}
+	for i := range limits {
+		limits[i].ResetAt = resetAt
+	}
+	return limits
+}
+
+// Transport records the limits of every response of one credential.
+type Transport struct {
+	Base     http.RoundTripper
+	AuthID   string
+	Provider string
+}
+
+// WrapTransport decorates base so responses of authID are observed. Requests
+// without a credential are not tracked.
+func WrapTransport(base http.RoundTripper, authID, provider string) http.RoundTripper {
+	if authID == "" {
+		return base
+	}
+	return &Transport{Base: base, AuthID: authID, Provider: provider}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	now := time.Now()
+	limits := ParseHeaders(resp.Header, now)
+	if len(limits) == 0 && resp.StatusCode == http.StatusTooManyRequests && resp.Body != nil &&
+		strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		body, errRead := io.ReadAll(io.LimitReader(resp.Body, errorPeekLimit))
+		// Hand the caller the full body: the peeked bytes followed by the rest.
+		resp.Body = peekedBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		if errRead == nil {
+			limits = ParseGoogleQuotaError(body, now)
+		}
+	}
+	Observe(t.AuthID, t.Provider, limits, now)
+	return resp, nil
+}
+
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,75 @@
+package livequota
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHeaders(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set("anthropic-ratelimit-requests-limit", "50")
+	header.Set("anthropic-ratelimit-requests-remaining", "49")
+	header.Set("anthropic-ratelimit-requests-reset", "2026-05-01T12:00:30Z")
+	header.Set("x-ratelimit-limit-tokens", "40000")
+	header.Set("x-ratelimit-remaining-tokens", "39000")
+	header.Set("x-ratelimit-reset-tokens", "1m30s")
+
+	limits := ParseHeaders(header, now)
+	if len(limits) != 2 {
+		t.Fatalf("expected two limits, got %+v", limits)
+	}
+	requests, tokens := limits[0], limits[1]
+	if requests.Name != "requests" || requests.Limit != 50 || requests.Remaining != 49 || !requests.ResetAt.Equal(now.Add(30*time.Second)) {
+		t.Fatalf("unexpected requests limit %+v", requests)
+	}
+	if tokens.Name != "tokens" || tokens.Remaining != 39000 || !tokens.ResetAt.Equal(now.Add(90*time.Second)) {
+		t.Fatalf("unexpected tokens limit %+v", tokens)
+	}
+}
+
+func TestTransportObservesGoogleQuotaError(t *testing.T) {
+	body := `{"error":{"code":429,"details":[
+		{"@type":"type.googleapis.com/google.rpc.QuotaFailure","violations":[{"quotaId":"GenerateRequestsPerMinutePerProjectPerModel","quotaValue":"60"}]},
+		{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"12s"}]}}`
+	base := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	before := time.Now()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", nil)
+	resp, err := WrapTransport(base, "gemini-test.json", "gemini-cli").RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if got, _ := io.ReadAll(resp.Body); string(got) != body {
+		t.Fatalf("expected the body to be passed through, got %q", got)
+	}
+
+	var snapshot *Snapshot
+	for _, s := range Snapshots(before) {
+		if s.AuthID == "gemini-test.json" {
+			snapshot = &s
+		}
+	}
+	if snapshot == nil || len(snapshot.Limits) != 1 {
+		t.Fatalf("expected one recorded limit, got %+v", snapshot)
+	}
+	limit := snapshot.Limits[0]
+	if limit.Name != "GenerateRequestsPerMinutePerProjectPerModel" || limit.Limit != 60 || limit.Remaining != 0 || limit.ResetAt == nil || limit.Stale {
+		t.Fatalf("unexpected limit %+v", limit)
+	}
+	if later := Snapshots(limit.ResetAt.Add(time.Second)); !later[0].Limits[0].Stale {
+		t.Fatalf("expected the limit to be stale after its reset, got %+v", later[0].Limits[0])
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,46 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestAdmit(t *testing.T) {
+	defer Set(config.LoadSheddingConfig{})
+	defer SetQueueWaitSource(nil)
+	Set(config.LoadSheddingConfig{MaxInFlight: 1, MaxQueueWaitMs: 500})
+	wait := time.Duration(0)
+	SetQueueWaitSource(func() time.Duration { return wait })
+	before := CurrentStats()
+
+	release, _, _ := Admit()
+	if release == nil {
+		t.Fatal("expected the first request to be admitted")
+	}
+	if again, reason, retryAfter := Admit(); again != nil || reason != ReasonInFlight || retryAfter != DefaultRetryAfter {
+		t.Fatalf("expected the second request to be shed for in-flight, got %q after %s", reason, retryAfter)
+	}
+	release()
+	release()
+	if stats := CurrentStats(); stats.InFlight != before.InFlight {
+		t.Fatalf("expected release to be idempotent, in-flight %d", stats.InFlight)
+	}
+
+	wait = time.Second
+	if shed, reason, _ := Admit(); shed != nil || reason != ReasonQueueWait {
+		t.Fatalf("expected a request to be shed for queue wait, got %q", reason)
+	}
+	stats := CurrentStats()
+	if stats.ShedInFlight != before.ShedInFlight+1 || stats.ShedQueueWait != before.ShedQueueWait+1 {
+		t.Fatalf("unexpected shed counters %+v (before %+v)", stats, before)
+	}
+
+	Set(config.LoadSheddingConfig{})
+	release, _, _ = Admit()
+	if release == nil {
+		t.Fatal("expected requests to be admitted with shedding disabled")
+	}
+	release()
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
 	log "github.com/sirupsen/logrus"
 )
@@ -64,6 +65,9 @@ func GinLogrusLogger() gin.HandlerFunc {
 			logLine = logLine + " | " + errorMessage
 		}
 		logLine = logLine + accountInfo
+		if requestID := tracing.GinRequestID(c); requestID != "" {
+			logLine = logLine + " rid=" + requestID
+		}
 
 		switch {
 		case statusCode >= http.StatusInternalServerError:
@@ -85,9 +89,10 @@ func GinLogrusLogger() gin.HandlerFunc {
 func GinLogrusRecovery() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
 		log.WithFields(log.Fields{
-			"panic": recovered,
-			"stack": string(debug.Stack()),
-			"path":  c.Request.URL.Path,
+			"panic":      recovered,
+			"stack":      string(debug.Stack()),
+			"path":       c.Request.URL.Path,
+			"request_id": tracing.GinRequestID(c),
 		}).Error("recovered from panic")
 
 		c.AbortWithStatus(http.StatusInternalServerError)
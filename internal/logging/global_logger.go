@@ -54,7 +54,7 @@ func (m *LogFormatter) Format(entry *log.Entry) ([]byte, error) {
 // It is safe to call multiple times; initialization happens only once.
 func SetupBaseLogger() {
 	setupOnce.Do(func() {
-		log.SetOutput(os.Stdout)
+		util.SetLogOutput(os.Stdout)
 		log.SetReportCaller(true)
 		log.SetFormatter(&LogFormatter{})
 
@@ -101,13 +101,13 @@ func ConfigureLogOutput(loggingToFile bool, logsMaxTotalSizeMB int) error {
 			MaxAge:     0,
 			Compress:   false,
 		}
-		log.SetOutput(logWriter)
+		util.SetLogOutput(logWriter)
 	} else {
 		if logWriter != nil {
 			_ = logWriter.Close()
 			logWriter = nil
 		}
-		log.SetOutput(os.Stdout)
+		util.SetLogOutput(os.Stdout)
 	}
 
 	configureLogDirCleanerLocked(logDir, logsMaxTotalSizeMB, protectedPath)
@@ -0,0 +1,156 @@
+// Package modelcache caches model listings and upstream model discovery so frequent
+// client discovery calls neither add latency nor consume provider quota. Entries are
+// fresh for a TTL; for a further stale window they are still served while one
+// background refresh replaces them. Failed refreshes keep the previous value.
+package modelcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// refreshTimeout bounds background refreshes, which outlive the triggering request.
+const refreshTimeout = 30 * time.Second
+
+// Policy is how long entries are fresh and then served stale.
+type Policy struct {
+	TTL   time.Duration
+	Stale time.Duration
+}
+
+// PolicyFromSeconds converts configured seconds into a Policy.
+func PolicyFromSeconds(ttlSeconds, staleSeconds int) Policy {
+	return Policy{TTL: time.Duration(max(ttlSeconds, 0)) * time.Second, Stale: time.Duration(max(staleSeconds, 0)) * time.Second}
+}
+
+// Enabled reports whether p caches anything.
+func (p Policy) Enabled() bool { return p.TTL > 0 }
+
+// Cache holds values of type T by key.
+type Cache[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*entry[T]
+	now     func() time.Time
+}
+
+type entry[T any] struct {
+	value     T
+	fetchedAt time.Time
+	valid     bool
+	// loading is closed when the running fetch finishes; nil when idle.
+	loading chan struct{}
+	err     error
+}
+
+// New returns an empty cache.
+func New[T any]() *Cache[T] {
+	return &Cache[T]{entries: make(map[string]*entry[T]), now: time.Now}
+}
+
+// Get returns the value for key. Fresh values are returned as is. Stale values within
+// the stale window are returned immediately and refreshed in the background. Missing
+// or expired values are fetched, with concurrent callers sharing one fetch; when that
+// fetch fails the expired value is returned if there is one. A disabled policy calls
+// fetch directly.
+func (c *Cache[T]) Get(ctx context.Context, key string, p Policy, fetch func(context.Context) (T, error)) (T, error) {
+	if !p.Enabled() {
+		return fetch(ctx)
+	}
+	c.mu.Lock()
+	e := c.entries[key]
+	if e == nil {
+		e = &entry[T]{}
+		c.entries[key] = e
+	}
+	age := c.now().Sub(e.fetchedAt)
+	switch {
+	case e.valid && age < p.TTL:
+		value := e.value
+		c.mu.Unlock()
+		return value, nil
+	case e.valid && age < p.TTL+p.Stale:
+		value := e.value
+		if e.loading == nil {
+			c.startLocked(key, e, fetch)
+		}
+		c.mu.Unlock()
+		return value, nil
+	}
+	if e.loading == nil {
+		c.startLocked(key, e, fetch)
+	}
+	loading := e.loading
+	c.mu.Unlock()
+
+	select {
+	case <-loading:
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.valid {
+		if e.err != nil {
+			log.Debugf("modelcache: refresh of %s failed, serving the previous value: %v", key, e.err)
+		}
+		return e.value, nil
+	}
+	var zero T
+	return zero, e.err
+}
+
+// startLocked runs fetch in the background; c.mu must be held.
+func (c *Cache[T]) startLocked(key string, e *entry[T], fetch func(context.Context) (T, error)) {
+	done := make(chan struct{})
+	e.loading = done
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		value, err := safeFetch(ctx, fetch)
+		c.mu.Lock()
+		if err == nil {
+			e.value, e.fetchedAt, e.valid = value, c.now(), true
+		}
+		e.err = err
+		e.loading = nil
+		c.mu.Unlock()
+		close(done)
+		if err != nil {
+			log.Debugf("modelcache: fetch of %s failed: %v", key, err)
+		}
+	}()
+}
+
+func safeFetch[T any](ctx context.Context, fetch func(context.Context) (T, error)) (value T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("modelcache: fetch panicked: %v", r)
+		}
+	}()
+	return fetch(ctx)
+}
+
+// Delete drops key so the next Get fetches it again.
+func (c *Cache[T]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[key]; e != nil && e.loading == nil {
+		delete(c.entries, key)
+	}
+}
+
+// Purge drops every idle entry.
+func (c *Cache[T]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if e.loading == nil {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package modelcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetFreshStaleAndExpired(t *testing.T) {
+	c := New[int]()
+	clock := time.Unix(0, 0)
+	c.now = func() time.Time { return clock }
+	p := Policy{TTL: time.Minute, Stale: time.Minute}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func(context.Context) (int, error) {
+		n := calls.Add(1)
+		if n == 2 {
+			<-release
+		}
+		return int(n), nil
+	}
+
+	if v, err := c.Get(context.Background(), "k", p, fetch); err != nil || v != 1 {
+		t.Fatalf("first get: %d, %v", v, err)
+	}
+	clock = clock.Add(30 * time.Second)
+	if v, _ := c.Get(context.Background(), "k", p, fetch); v != 1 || calls.Load() != 1 {
+		t.Fatalf("expected the fresh value without a fetch, got %d after %d calls", v, calls.Load())
+	}
+
+	clock = clock.Add(60 * time.Second)
+	if v, _ := c.Get(context.Background(), "k", p, fetch); v != 1 {
+		t.Fatalf("expected the stale value while revalidating, got %d", v)
+	}
+	waitFor(t, func() bool { return calls.Load() == 2 })
+	if v, _ := c.Get(context.Background(), "k", p, fetch); v != 1 || calls.Load() != 2 {
+		t.Fatalf("expected one background refresh, got %d after %d calls", v, calls.Load())
+	}
+	close(release)
+	waitFor(t, func() bool {
+		v, _ := c.Get(context.Background(), "k", p, fetch)
+		return v == 2
+	})
+
+	clock = clock.Add(5 * time.Minute)
+	if v, _ := c.Get(context.Background(), "k", p, fetch); v != 3 {
+		t.Fatalf("expected an expired value to be refetched, got %d", v)
+	}
+}
+
+func TestGetFallsBackOnError(t *testing.T) {
+	c := New[string]()
+	clock := time.Unix(0, 0)
+	c.now = func() time.Time { return clock }
+	p := Policy{TTL: time.Minute}
+
+	if _, err := c.Get(context.Background(), "k", p, func(context.Context) (string, error) { return "", errors.New("down") }); err == nil {
+		t.Fatal("expected the error without a previous value")
+	}
+	if v, err := c.Get(context.Background(), "k", p, func(context.Context) (string, error) { return "ok", nil }); err != nil || v != "ok" {
+		t.Fatalf("unexpected %q, %v", v, err)
+	}
+	clock = clock.Add(time.Hour)
+	v, err := c.Get(context.Background(), "k", p, func(context.Context) (string, error) { panic("boom") })
+	if err != nil || v != "ok" {
+		t.Fatalf("expected the previous value after a failed refresh, got %q, %v", v, err)
+	}
+}
+
+func TestGetDisabled(t *testing.T) {
+	c := New[int]()
+	var calls int
+	fetch := func(context.Context) (int, error) { calls++; return calls, nil }
+	for i := 0; i < 3; i++ {
+		_, _ = c.Get(context.Background(), "k", PolicyFromSeconds(0, 60), fetch)
+	}
+	if calls != 3 {
+		t.Fatalf("expected every call to fetch, got %d", calls)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,250 @@
+// Package modelrewrite maps requested model names to the models actually routed,
+// using exact or regular expression rules that can be scoped to client API keys and
+// to the classification tags of the request.
+// Rewrites run before provider resolution, so the effective model decides which
+// credentials serve the request while the requested name is kept for usage records.
+package modelrewrite
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/classify"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// GinRequestedModelKey stores the model name the client asked for in the Gin context
+// when a rule rewrote it.
+const GinRequestedModelKey = "requestedModel"
+
+const (
+	matchExact = "exact"
+	matchRegex = "regex"
+)
+
+type rule struct {
+	from    string
+	name    string
+	pattern *regexp.Regexp
+	to      string
+	keys    map[string]struct{}
+	tags    map[string]struct{}
+}
+
+// Rewriter evaluates a compiled rule set.
+type Rewriter struct {
+	rules []rule
+}
+
+var active atomic.Pointer[Rewriter]
+
+// Compile builds a rewriter from configuration, skipping invalid rules.
+func Compile(rules []config.ModelRewriteRule) *Rewriter {
+	out := &Rewriter{rules: make([]rule, 0, len(rules))}
+	for i := range rules {
+		r := rules[i]
+		from, to := strings.TrimSpace(r.From), strings.TrimSpace(r.To)
+		if from == "" || to == "" {
+			continue
+		}
+		compiled := rule{to: to}
+		switch strings.ToLower(strings.TrimSpace(r.Match)) {
+		case "", matchExact:
+			compiled.from = strings.ToLower(from)
+			compiled.name = from
+		case matchRegex:
+			re, err := regexp.Compile(from)
+			if err != nil {
+				log.Warnf("modelrewrite: rule %q has invalid pattern: %v", from, err)
+				continue
+			}
+			compiled.pattern = re
+		default:
+			log.Warnf("modelrewrite: rule %q has unsupported match %q, skipping", from, r.Match)
+			continue
+		}
+		for _, key := range r.APIKeys {
+			if key = strings.TrimSpace(key); key == "" {
+				continue
+			}
+			if compiled.keys == nil {
+				compiled.keys = make(map[string]struct{}, len(r.APIKeys))
+			}
+			compiled.keys[key] = struct{}{}
+		}
+		for _, tag := range r.Tags {
+			if tag = strings.TrimSpace(tag); tag == "" {
+				continue
+			}
+			if compiled.tags == nil {
+				compiled.tags = make(map[string]struct{}, len(r.Tags))
+			}
+			compiled.tags[tag] = struct{}{}
+		}
+		out.rules = append(out.rules, compiled)
+	}
+	return out
+}
+
+// SetRules replaces the active rule set.
+func SetRules(rules []config.ModelRewriteRule) {
+	if len(rules) == 0 {
+		active.Store(nil)
+		return
+	}
+	active.Store(Compile(rules))
+}
+
+// Active returns the active rewriter or nil when no rules are configured.
+func Active() *Rewriter {
+	r := active.Load()
+	if r == nil || len(r.rules) == 0 {
+		return nil
+	}
+	return r
+}
+
+// Rewrite returns the effective model for model as requested with apiKey. The first
+// matching rule wins; ok is false when no rule applies. Rules scoped to tags never
+// match, see RewriteTagged.
+func (r *Rewriter) Rewrite(apiKey, model string) (string, bool) {
+	return r.RewriteTagged(apiKey, nil, model)
+}
+
+// RewriteTagged is Rewrite for a request carrying the given classification tags.
+// Rules scoped to tags only match requests carrying at least one of them.
+func (r *Rewriter) RewriteTagged(apiKey string, tags []string, model string) (string, bool) {
+	if r == nil {
+		return model, false
+	}
+	trimmed := strings.TrimSpace(model)
+	if trimmed == "" {
+		return model, false
+	}
+	apiKey = strings.TrimSpace(apiKey)
+	for i := range r.rules {
+		rr := &r.rules[i]
+		if rr.keys != nil {
+			if _, ok := rr.keys[apiKey]; !ok {
+				continue
+			}
+		}
+		if rr.tags != nil && !hasAnyTag(rr.tags, tags) {
+			continue
+		}
+		if rr.pattern == nil {
+			if strings.ToLower(trimmed) == rr.from {
+				return rr.to, true
+			}
+			continue
+		}
+		match := rr.pattern.FindStringSubmatchIndex(trimmed)
+		if match == nil {
+			continue
+		}
+		out := rr.pattern.ExpandString(nil, rr.to, trimmed, match)
+		if len(out) == 0 {
+			continue
+		}
+		return string(out), true
+	}
+	return model, false
+}
+
+func hasAnyTag(want map[string]struct{}, tags []string) bool {
+	for _, tag := range tags {
+		if _, ok := want[tag]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Alias is an exact rewrite rule as seen by one client key: requests for From are
+// served by To.
+type Alias struct {
+	From string
+	To   string
+}
+
+// Aliases returns the model names exact-match rules expose to apiKey, in rule order,
+// with the model each one is served by. Regex rules do not name a model and are only
+// consulted when they shadow an exact rule; rules scoped to tags depend on the request
+// and are not listed.
+func (r *Rewriter) Aliases(apiKey string) []Alias {
+	if r == nil {
+		return nil
+	}
+	var out []Alias
+	seen := make(map[string]struct{})
+	for i := range r.rules {
+		rr := &r.rules[i]
+		if rr.pattern != nil || rr.tags != nil {
+			continue
+		}
+		if _, dup := seen[rr.from]; dup {
+			continue
+		}
+		seen[rr.from] = struct{}{}
+		if to, ok := r.Rewrite(apiKey, rr.name); ok {
+			out = append(out, Alias{From: rr.name, To: to})
+		}
+	}
+	return out
+}
+
+// Apply rewrites model using the active rules and the client key and classification
+// tags carried by ctx.
+// When a rule matches, the requested name is stored in the Gin context so usage
+// records can report both the requested and the effective model.
+func Apply(ctx context.Context, model string) string {
+	r := Active()
+	if r == nil {
+		return model
+	}
+	var ginCtx *gin.Context
+	if ctx != nil {
+		ginCtx, _ = ctx.Value("gin").(*gin.Context)
+	}
+	apiKey := ""
+	var tags []string
+	if ginCtx != nil {
+		if v, ok := ginCtx.Get("apiKey"); ok {
+			apiKey, _ = v.(string)
+		}
+		tags = classify.TagsFromGin(ginCtx)
+	}
+	effective, ok := r.RewriteTagged(apiKey, tags, model)
+	if !ok || effective == model {
+		return model
+	}
+	log.Debugf("modelrewrite: %s -> %s", model, effective)
+	if ginCtx != nil {
+		if _, exists := ginCtx.Get(GinRequestedModelKey); !exists {
+			ginCtx.Set(GinRequestedModelKey, model)
+		}
+	}
+	return effective
+}
+
+// RequestedModelFromContext returns the model name the client asked for when a rule
+// rewrote it, or "" when the request was not rewritten.
+func RequestedModelFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil {
+		return ""
+	}
+	v, ok := ginCtx.Get(GinRequestedModelKey)
+	if !ok {
+		return ""
+	}
+	model, _ := v.(string)
+	return model
+}
@@ -0,0 +1,102 @@
+package modelrewrite
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/classify"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestRewrite(t *testing.T) {
+	r := Compile([]config.ModelRewriteRule{
+		{From: "gpt-4o", To: "claude-sonnet", APIKeys: []string{"k1"}},
+		{Match: "regex", From: `^gemini-(.+)-latest$`, To: "gemini-$1"},
+		{Match: "regex", From: `(`, To: "broken"},
+		{From: "GPT-4o", To: "gpt-4.1"},
+	})
+
+	cases := []struct {
+		key, model, want string
+		ok               bool
+	}{
+		{"k1", "gpt-4o", "claude-sonnet", true},
+		{"k2", "GPT-4O", "gpt-4.1", true},
+		{"k2", "gemini-2.5-pro-latest", "gemini-2.5-pro", true},
+		{"k2", "gemini-2.5-pro", "gemini-2.5-pro", false},
+	}
+	for _, tc := range cases {
+		got, ok := r.Rewrite(tc.key, tc.model)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Rewrite(%q, %q) = %q, %v; want %q, %v", tc.key, tc.model, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestApplyRecordsRequestedModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetRules([]config.ModelRewriteRule{{From: "gpt-4o", To: "claude-sonnet"}})
+	t.Cleanup(func() { SetRules(nil) })
+
+	ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx := context.WithValue(context.Background(), "gin", ginCtx)
+
+	if got := Apply(ctx, "gpt-4o"); got != "claude-sonnet" {
+		t.Fatalf("Apply = %q, want claude-sonnet", got)
+	}
+	if got := RequestedModelFromContext(ctx); got != "gpt-4o" {
+		t.Fatalf("RequestedModelFromContext = %q, want gpt-4o", got)
+	}
+	if got := Apply(ctx, "gpt-4.1"); got != "gpt-4.1" {
+		t.Fatalf("unmatched model rewritten to %q", got)
+	}
+}
+
+func TestApplyUsesClassificationTags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetRules([]config.ModelRewriteRule{
+		{From: "claude-sonnet", To: "claude-haiku", Tags: []string{"support"}},
+		{From: "claude-sonnet", To: "claude-opus", APIKeys: []string{"k1"}},
+	})
+	t.Cleanup(func() { SetRules(nil) })
+
+	ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ginCtx.Set("apiKey", "k1")
+	ctx := context.WithValue(context.Background(), "gin", ginCtx)
+	if got := Apply(ctx, "claude-sonnet"); got != "claude-opus" {
+		t.Fatalf("untagged request rewritten to %q, want claude-opus", got)
+	}
+	ginCtx.Set(classify.GinTagsKey, []string{"code", "support"})
+	if got := Apply(ctx, "claude-sonnet"); got != "claude-haiku" {
+		t.Fatalf("tagged request rewritten to %q, want claude-haiku", got)
+	}
+	if aliases := Active().Aliases("k2"); len(aliases) != 0 {
+		t.Fatalf("tag-scoped rules must not be listed as aliases: %v", aliases)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	r := Compile([]config.ModelRewriteRule{
+		{From: "gpt-4o", To: "claude-sonnet", APIKeys: []string{"k1"}},
+		{Match: "regex", From: `^shadowed$`, To: "regex-target"},
+		{From: "GPT-4o", To: "gpt-4.1"},
+		{From: "shadowed", To: "exact-target"},
+	})
+	cases := map[string][]Alias{
+		"k1": {{From: "gpt-4o", To: "claude-sonnet"}, {From: "shadowed", To: "regex-target"}},
+		"k2": {{From: "gpt-4o", To: "gpt-4.1"}, {From: "shadowed", To: "regex-target"}},
+	}
+	for key, want := range cases {
+		got := r.Aliases(key)
+		if len(got) != len(want) {
+			t.Fatalf("Aliases(%q) = %v, want %v", key, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Aliases(%q)[%d] = %v, want %v", key, i, got[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package netaccess enforces source IP controls on the client API: CIDR allowlists
+// (globally or per client API key) and a token bucket rate limit per client IP,
+// optionally shared between instances through Redis.
+// The active controller is swapped atomically on config reload; rate limit state
+// survives reloads that keep the same limits.
+package netaccess
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/redisstate"
+	log "github.com/sirupsen/logrus"
+)
+
+// Rejection reasons recorded in usage statistics.
+const (
+	// RejectionIPDenied marks requests from an address outside the allowed networks.
+	RejectionIPDenied = "ip_denied"
+	// RejectionRateLimited marks requests over the per-IP rate limit.
+	RejectionRateLimited = "ip_rate_limited"
+)
+
+// idleBucketTTL is how long an untouched per-IP bucket is kept before it is swept.
+const idleBucketTTL = 10 * time.Minute
+
+// Controller evaluates a compiled network access configuration.
+type Controller struct {
+	allowed []netip.Prefix
+	byKey   map[string][]netip.Prefix
+	exempt  []netip.Prefix
+	limiter *limiter
+}
+
+var active atomic.Pointer[Controller]
+
+// Compile builds a controller from configuration, skipping invalid networks. A key
+// whose rule lists no valid network is denied from everywhere.
+func Compile(cfg config.NetworkAccessConfig) *Controller {
+	c := &Controller{
+		allowed: parsePrefixes("network-access.allowed-cidrs", cfg.AllowedCIDRs),
+		exempt:  parsePrefixes("network-access.exempt-cidrs", cfg.ExemptCIDRs),
+	}
+	for _, rule := range cfg.APIKeys {
+		key := strings.TrimSpace(rule.APIKey)
+		if key == "" {
+			continue
+		}
+		if c.byKey == nil {
+			c.byKey = make(map[string][]netip.Prefix, len(cfg.APIKeys))
+		}
+		c.byKey[key] = parsePrefixes("network-access.api-keys", rule.AllowedCIDRs)
+	}
+	if cfg.RequestsPerMinute > 0 {
+		burst := cfg.Burst
+		if burst <= 0 {
+			burst = cfg.RequestsPerMinute
+		}
+		c.limiter = newLimiter(cfg.RequestsPerMinute, burst)
+	}
+	return c
+}
+
+// Set replaces the active controller. Per-IP buckets are carried over when the
+// rate and burst are unchanged so a reload does not reset limits.
+func Set(cfg config.NetworkAccessConfig) {
+	next := Compile(cfg)
+	if !next.enabled() {
+		active.Store(nil)
+		return
+	}
+	if prev := active.Load(); prev != nil && prev.limiter != nil && next.limiter != nil &&
+		prev.limiter.perMinute == next.limiter.perMinute && prev.limiter.burst == next.limiter.burst {
+		next.limiter = prev.limiter
+	}
+	active.Store(next)
+}
+
+// Active returns the active controller or nil when network access control is off.
+func Active() *Controller {
+	return active.Load()
+}
+
+func (c *Controller) enabled() bool {
+	return c != nil && (len(c.allowed) > 0 || len(c.byKey) > 0 || c.limiter != nil)
+}
+
+// AllowRate consumes one request from ip's bucket. When the limit is exceeded it
+// returns false and how long until the next request would be admitted. With Redis
+// configured the bucket is shared by every instance; while Redis is unreachable the
+// local bucket is used instead.
+func (c *Controller) AllowRate(ip netip.Addr, now time.Time) (bool, time.Duration) {
+	if c == nil || c.limiter == nil || !ip.IsValid() || contains(c.exempt, ip) {
+		return true, 0
+	}
+	ip = ip.Unmap()
+	if store := redisstate.Active(); store != nil {
+		ok, wait, err := store.TakeToken(context.Background(), store.Key("ratelimit", "ip", ip.String()), c.limiter.rate, c.limiter.burst, now)
+		if err == nil {
+			return ok, wait
+		}
+		log.Debugf("netaccess: shared rate limit unavailable, using local bucket: %v", err)
+	}
+	return c.limiter.take(ip, now)
+}
+
+// AllowKey reports whether apiKey may be used from ip. Keys with their own rule
+// are checked against it; other keys fall back to the global allowlist.
+func (c *Controller) AllowKey(apiKey string, ip netip.Addr) bool {
+	if c == nil {
+		return true
+	}
+	prefixes, ok := c.byKey[strings.TrimSpace(apiKey)]
+	if !ok {
+		prefixes = c.allowed
+		if len(prefixes) == 0 {
+			return true
+		}
+	}
+	return ip.IsValid() && contains(prefixes, ip.Unmap())
+}
+
+func contains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefixes accepts CIDRs and bare addresses.
+func parsePrefixes(field string, values []string) []netip.Prefix {
+	out := make([]netip.Prefix, 0, len(values))
+	for _, raw := range values {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(raw); err == nil {
+			out = append(out, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(raw)
+		if err != nil {
+			log.Warnf("netaccess: %s: invalid network %q, skipping", field, raw)
+			continue
+		}
+		addr = addr.Unmap()
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter is a token bucket per client IP.
+type limiter struct {
+	perMinute int
+	burst     int
+	rate      float64 // tokens per second
+
+	mu        sync.Mutex
+	buckets   map[netip.Addr]*bucket
+	lastSweep time.Time
+}
+
+func newLimiter(perMinute, burst int) *limiter {
+	return &limiter{
+		perMinute: perMinute,
+		burst:     burst,
+		rate:      float64(perMinute) / 60,
+		buckets:   make(map[netip.Addr]*bucket),
+	}
+}
+
+func (l *limiter) take(ip netip.Addr, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > idleBucketTTL {
+		for addr, b := range l.buckets {
+			if now.Sub(b.last) > idleBucketTTL {
+				delete(l.buckets, addr)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[ip] = b
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(float64(l.burst), b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
@@ -0,0 +1,111 @@
+package netaccess
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/redisstate"
+)
+
+func TestAllowKey(t *testing.T) {
+	c := Compile(config.NetworkAccessConfig{
+		AllowedCIDRs: []string{"10.0.0.0/8"},
+		APIKeys: []config.NetworkKeyRule{
+			{APIKey: "k1", AllowedCIDRs: []string{"203.0.113.7", "2001:db8::/32"}},
+			{APIKey: "k2", AllowedCIDRs: []string{"not-a-cidr"}},
+		},
+	})
+	cases := []struct {
+		key, ip string
+		want    bool
+	}{
+		{"k1", "203.0.113.7", true},
+		{"k1", "::ffff:203.0.113.7", true},
+		{"k1", "2001:db8::1", true},
+		{"k1", "10.1.2.3", false},
+		{"other", "10.1.2.3", true},
+		{"other", "192.168.1.1", false},
+		{"k2", "10.1.2.3", false},
+	}
+	for _, tc := range cases {
+		if got := c.AllowKey(tc.key, netip.MustParseAddr(tc.ip)); got != tc.want {
+			t.Errorf("AllowKey(%q, %s) = %v, want %v", tc.key, tc.ip, got, tc.want)
+		}
+	}
+	if !Compile(config.NetworkAccessConfig{}).AllowKey("any", netip.Addr{}) {
+		t.Fatalf("empty config must allow every key")
+	}
+}
+
+func TestAllowRate(t *testing.T) {
+	c := Compile(config.NetworkAccessConfig{RequestsPerMinute: 60, Burst: 2, ExemptCIDRs: []string{"127.0.0.1"}})
+	ip := netip.MustParseAddr("192.0.2.1")
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := c.AllowRate(ip, now); !ok {
+			t.Fatalf("request %d within burst rejected", i)
+		}
+	}
+	ok, wait := c.AllowRate(ip, now)
+	if ok || wait <= 0 || wait > time.Second {
+		t.Fatalf("expected rejection with ~1s wait, got ok=%v wait=%v", ok, wait)
+	}
+	if ok, _ = c.AllowRate(ip, now.Add(time.Second)); !ok {
+		t.Fatalf("bucket did not refill")
+	}
+	if ok, _ = c.AllowRate(netip.MustParseAddr("192.0.2.2"), now); !ok {
+		t.Fatalf("limits must be per IP")
+	}
+	for i := 0; i < 5; i++ {
+		if ok, _ = c.AllowRate(netip.MustParseAddr("127.0.0.1"), now); !ok {
+			t.Fatalf("exempt address rate limited")
+		}
+	}
+}
+
+func TestSetKeepsBucketsAcrossReload(t *testing.T) {
+	t.Cleanup(func() { Set(config.NetworkAccessConfig{}) })
+	cfg := config.NetworkAccessConfig{RequestsPerMinute: 60, Burst: 1}
+	Set(cfg)
+	ip := netip.MustParseAddr("192.0.2.9")
+	now := time.Now()
+	if ok, _ := Active().AllowRate(ip, now); !ok {
+		t.Fatalf("first request rejected")
+	}
+	cfg.AllowedCIDRs = []string{"192.0.2.0/24"}
+	Set(cfg)
+	if ok, _ := Active().AllowRate(ip, now); ok {
+		t.Fatalf("reload with unchanged limits must keep the bucket")
+	}
+	Set(config.NetworkAccessConfig{})
+	if Active() != nil {
+		t.Fatalf("expected nil controller when disabled")
+	}
+}
+
+func TestAllowRateFallsBackWithoutRedis(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	if err = redisstate.Configure(config.RedisConfig{Enabled: true, Address: addr, TimeoutMs: 50}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = redisstate.Configure(config.RedisConfig{}) }()
+
+	c := Compile(config.NetworkAccessConfig{RequestsPerMinute: 60, Burst: 1})
+	ip := netip.MustParseAddr("198.51.100.9")
+	now := time.Now()
+	if ok, _ := c.AllowRate(ip, now); !ok {
+		t.Fatal("expected the first request to be admitted by the local bucket")
+	}
+	if ok, wait := c.AllowRate(ip, now); ok || wait <= 0 {
+		t.Fatalf("expected the local bucket to limit while redis is down, got ok=%v wait=%v", ok, wait)
+	}
+}
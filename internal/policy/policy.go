@@ -0,0 +1,215 @@
+// Package policy enforces per-client-key model and provider allowlists/denylists.
+// Policies are evaluated in the request path before credential selection so a key
+// can never reach a model or provider it has not been granted.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// Code is the machine readable error code returned for denied requests.
+const Code = "policy_denied"
+
+type rule struct {
+	allowedModels    []string
+	deniedModels     []string
+	allowedProviders []string
+	deniedProviders  []string
+	priority         string
+}
+
+// Set holds compiled policies keyed by client API key.
+type Set struct {
+	byKey map[string]rule
+}
+
+var active atomic.Pointer[Set]
+
+// DeniedError reports a request rejected by an API key policy.
+type DeniedError struct {
+	Model  string
+	Reason string
+}
+
+// Error renders an OpenAI-style JSON error body so handlers forward it verbatim.
+func (e *DeniedError) Error() string {
+	payload, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"code":    Code,
+			"type":    "permission_error",
+			"message": e.Reason,
+			"model":   e.Model,
+		},
+	})
+	if err != nil {
+		return e.Reason
+	}
+	return string(payload)
+}
+
+// StatusCode implements the status accessor used by handlers.
+func (e *DeniedError) StatusCode() int { return http.StatusForbidden }
+
+// Compile builds a policy set from configuration. Later entries for the same key
+// replace earlier ones.
+func Compile(policies []config.APIKeyPolicy) *Set {
+	set := &Set{byKey: make(map[string]rule, len(policies))}
+	for i := range policies {
+		key := strings.TrimSpace(policies[i].APIKey)
+		if key == "" {
+			continue
+		}
+		set.byKey[key] = rule{
+			allowedModels:    normalizePatterns(policies[i].AllowedModels),
+			deniedModels:     normalizePatterns(policies[i].DeniedModels),
+			allowedProviders: normalizePatterns(policies[i].AllowedProviders),
+			deniedProviders:  normalizePatterns(policies[i].DeniedProviders),
+			priority:         strings.ToLower(strings.TrimSpace(policies[i].Priority)),
+		}
+	}
+	return set
+}
+
+// SetPolicies replaces the active policy set.
+func SetPolicies(policies []config.APIKeyPolicy) {
+	if len(policies) == 0 {
+		active.Store(nil)
+		return
+	}
+	active.Store(Compile(policies))
+}
+
+// Active returns the active policy set or nil when no policies are configured.
+func Active() *Set {
+	return active.Load()
+}
+
+// Evaluate checks whether apiKey may call model (matched against every given name,
+// e.g. the requested and the normalized model) and filters providers down to the
+// permitted ones. Keys without a policy are unrestricted.
+func (s *Set) Evaluate(apiKey string, models []string, providers []string) ([]string, error) {
+	if s == nil {
+		return providers, nil
+	}
+	r, ok := s.byKey[strings.TrimSpace(apiKey)]
+	if !ok {
+		return providers, nil
+	}
+	display := ""
+	if len(models) > 0 {
+		display = models[0]
+	}
+	for _, model := range models {
+		if matchAny(r.deniedModels, model) {
+			return nil, &DeniedError{Model: display, Reason: "model " + display + " is denied for this API key"}
+		}
+	}
+	if len(r.allowedModels) > 0 {
+		allowed := false
+		for _, model := range models {
+			if matchAny(r.allowedModels, model) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, &DeniedError{Model: display, Reason: "model " + display + " is not allowed for this API key"}
+		}
+	}
+
+	out := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		if matchAny(r.deniedProviders, provider) {
+			continue
+		}
+		if len(r.allowedProviders) > 0 && !matchAny(r.allowedProviders, provider) {
+			continue
+		}
+		out = append(out, provider)
+	}
+	if len(out) == 0 && len(providers) > 0 {
+		return nil, &DeniedError{Model: display, Reason: "no provider serving " + display + " is allowed for this API key"}
+	}
+	return out, nil
+}
+
+// Priority returns the scheduling class configured for apiKey, or "" when the key
+// has no policy or no priority.
+func (s *Set) Priority(apiKey string) string {
+	if s == nil {
+		return ""
+	}
+	return s.byKey[strings.TrimSpace(apiKey)].priority
+}
+
+// APIKeyFromContext returns the authenticated client key from the Gin context embedded in ctx.
+func APIKeyFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil {
+		return ""
+	}
+	v, ok := ginCtx.Get("apiKey")
+	if !ok {
+		return ""
+	}
+	key, _ := v.(string)
+	return key
+}
+
+func normalizePatterns(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, p := range in {
+		if trimmed := strings.ToLower(strings.TrimSpace(p)); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
+func matchAny(patterns []string, value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return false
+	}
+	for _, p := range patterns {
+		if matchWildcard(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard reports whether value matches pattern, where '*' matches any substring.
+func matchWildcard(pattern, value string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	last := parts[len(parts)-1]
+	if !strings.HasSuffix(value, last) {
+		return false
+	}
+	value = value[:len(value)-len(last)]
+	for _, segment := range parts[1 : len(parts)-1] {
+		idx := strings.Index(value, segment)
+		if idx < 0 {
+			return false
+		}
+		value = value[idx+len(segment):]
+	}
+	return true
+}
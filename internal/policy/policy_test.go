@@ -0,0 +1,57 @@
+package policy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestEvaluate(t *testing.T) {
+	set := Compile([]config.APIKeyPolicy{
+		{APIKey: "k1", AllowedModels: []string{"gpt-4o*"}, DeniedModels: []string{"gpt-4o-mini"}},
+		{APIKey: "k2", DeniedProviders: []string{"claude"}},
+	})
+
+	if _, err := set.Evaluate("k1", []string{"gpt-4o-2024"}, nil); err != nil {
+		t.Fatalf("allowed model rejected: %v", err)
+	}
+	var denied *DeniedError
+	if _, err := set.Evaluate("k1", []string{"GPT-4o-mini"}, nil); !errors.As(err, &denied) {
+		t.Fatalf("expected denied model, got %v", err)
+	}
+	if _, err := set.Evaluate("k1", []string{"claude-3"}, nil); !errors.As(err, &denied) {
+		t.Fatalf("expected model outside allow list to be denied, got %v", err)
+	}
+
+	providers, err := set.Evaluate("k2", []string{"any"}, []string{"claude", "gemini"})
+	if err != nil || !reflect.DeepEqual(providers, []string{"gemini"}) {
+		t.Fatalf("unexpected providers %v err %v", providers, err)
+	}
+	if _, err = set.Evaluate("k2", []string{"any"}, []string{"claude"}); !errors.As(err, &denied) {
+		t.Fatalf("expected denial when every provider is filtered, got %v", err)
+	}
+
+	providers, err = set.Evaluate("other", []string{"any"}, []string{"claude"})
+	if err != nil || len(providers) != 1 {
+		t.Fatalf("keys without a policy must be unrestricted, got %v %v", providers, err)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	set := Compile([]config.APIKeyPolicy{
+		{APIKey: "k1", Priority: " High "},
+		{APIKey: "k2"},
+	})
+	if got := set.Priority("k1"); got != "high" {
+		t.Fatalf("expected high priority, got %q", got)
+	}
+	if got := set.Priority("k2"); got != "" {
+		t.Fatalf("expected no priority, got %q", got)
+	}
+	var none *Set
+	if got := none.Priority("k1"); got != "" {
+		t.Fatalf("nil set must report no priority, got %q", got)
+	}
+}
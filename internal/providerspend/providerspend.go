@@ -0,0 +1,198 @@
+// Package providerspend enforces monthly spend caps on upstream providers. The usage
+// store prices each provider's spend and marks providers that reach their cap; the
+// request path then drops those providers from the candidates of a model, so traffic
+// moves to the model's other providers, or rejects the request.
+package providerspend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// Rejection is the error code and usage rejection of requests refused because of
+// provider spend caps.
+const Rejection = "provider_spend_cap_exceeded"
+
+// Cap actions.
+const (
+	ActionFallback = "fallback"
+	ActionReject   = "reject"
+)
+
+// Cap is the monthly cap of one provider.
+type Cap struct {
+	Provider string  `json:"provider"`
+	CapUSD   float64 `json:"cap_usd"`
+	Action   string  `json:"action"`
+}
+
+// Exceedance records a provider that reached its cap.
+type Exceedance struct {
+	Cap
+	Month      string    `json:"month"`
+	SpendUSD   float64   `json:"spend_usd"`
+	ExceededAt time.Time `json:"exceeded_at"`
+}
+
+var (
+	caps atomic.Pointer[map[string]Cap]
+	// mu serialises updates of exceeded.
+	mu       sync.Mutex
+	exceeded atomic.Pointer[map[string]Exceedance]
+)
+
+// SetCaps replaces the configured caps and drops the exceedances of providers that
+// are no longer capped. The usage store re-evaluates the remaining ones.
+func SetCaps(entries []config.ProviderSpendCap) {
+	next := make(map[string]Cap, len(entries))
+	for _, entry := range entries {
+		provider := normalize(entry.Provider)
+		if provider == "" || entry.MonthlyCap <= 0 {
+			continue
+		}
+		action := strings.ToLower(strings.TrimSpace(entry.Action))
+		if action != ActionReject {
+			action = ActionFallback
+		}
+		next[provider] = Cap{Provider: provider, CapUSD: entry.MonthlyCap, Action: action}
+	}
+	caps.Store(&next)
+
+	mu.Lock()
+	defer mu.Unlock()
+	current := Exceeded()
+	kept := make(map[string]Exceedance, len(current))
+	for provider, entry := range current {
+		if c, ok := next[provider]; ok {
+			entry.Cap = c
+			kept[provider] = entry
+		}
+	}
+	exceeded.Store(&kept)
+}
+
+// Caps returns the configured caps keyed by lower-case provider name.
+func Caps() map[string]Cap {
+	if current := caps.Load(); current != nil {
+		return *current
+	}
+	return nil
+}
+
+// Exceeded returns the providers currently past their cap.
+func Exceeded() map[string]Exceedance {
+	if current := exceeded.Load(); current != nil {
+		return *current
+	}
+	return nil
+}
+
+// MarkExceeded records that a provider reached its cap.
+func MarkExceeded(entry Exceedance) {
+	mu.Lock()
+	defer mu.Unlock()
+	next := make(map[string]Exceedance, len(Exceeded())+1)
+	for provider, existing := range Exceeded() {
+		next[provider] = existing
+	}
+	next[entry.Provider] = entry
+	exceeded.Store(&next)
+}
+
+// Clear drops the exceedance of a provider, e.g. after its cap was raised.
+func Clear(provider string) {
+	provider = normalize(provider)
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := Exceeded()[provider]; !ok {
+		return
+	}
+	next := make(map[string]Exceedance, len(Exceeded()))
+	for name, existing := range Exceeded() {
+		if name != provider {
+			next[name] = existing
+		}
+	}
+	exceeded.Store(&next)
+}
+
+// Check reports whether provider is past its cap in the month containing now.
+// Exceedances of earlier months no longer count, so caps reset on the 1st (UTC).
+func Check(provider string, now time.Time) (Exceedance, bool) {
+	entry, ok := Exceeded()[normalize(provider)]
+	if !ok || entry.Month != now.UTC().Format("2006-01") {
+		return Exceedance{}, false
+	}
+	return entry, true
+}
+
+// Filter removes providers past their cap from providers. It returns an
+// *ExceededError when a capped provider uses the reject action or when no provider
+// is left.
+func Filter(providers []string, model string, now time.Time) ([]string, error) {
+	if len(Exceeded()) == 0 {
+		return providers, nil
+	}
+	var (
+		allowed []string
+		hit     []Exceedance
+	)
+	for _, provider := range providers {
+		entry, capped := Check(provider, now)
+		if !capped {
+			allowed = append(allowed, provider)
+			continue
+		}
+		hit = append(hit, entry)
+		if entry.Action == ActionReject {
+			return nil, &ExceededError{Model: model, Providers: []Exceedance{entry}}
+		}
+	}
+	if len(hit) > 0 && len(allowed) == 0 {
+		return nil, &ExceededError{Model: model, Providers: hit}
+	}
+	return allowed, nil
+}
+
+// ExceededError reports a request refused because of provider spend caps.
+type ExceededError struct {
+	Model     string
+	Providers []Exceedance
+}
+
+// Error renders an OpenAI-style JSON error body so handlers forward it verbatim.
+func (e *ExceededError) Error() string {
+	parts := make([]string, 0, len(e.Providers))
+	for _, entry := range e.Providers {
+		parts = append(parts, fmt.Sprintf("%s spent $%.2f of its $%.2f cap for %s", entry.Provider, entry.SpendUSD, entry.CapUSD, entry.Month))
+	}
+	sort.Strings(parts)
+	message := fmt.Sprintf("model %s is unavailable: monthly provider spend cap reached (%s)", e.Model, strings.Join(parts, "; "))
+	payload, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"code":    Rejection,
+			"type":    "insufficient_quota",
+			"message": message,
+			"model":   e.Model,
+		},
+	})
+	if err != nil {
+		return message
+	}
+	return string(payload)
+}
+
+// StatusCode implements the status accessor used by handlers.
+func (e *ExceededError) StatusCode() int { return http.StatusTooManyRequests }
+
+func normalize(provider string) string {
+	return strings.ToLower(strings.TrimSpace(provider))
+}
@@ -0,0 +1,51 @@
+package providerspend
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+func TestFilter(t *testing.T) {
+	SetCaps([]config.ProviderSpendCap{
+		{Provider: "claude", MonthlyCap: 100},
+		{Provider: "codex", MonthlyCap: 50, Action: "Reject"},
+	})
+	defer SetCaps(nil)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	if got, err := Filter([]string{"claude", "gemini"}, "m", now); err != nil || len(got) != 2 {
+		t.Fatalf("expected no filtering before any cap is reached, got %v, %v", got, err)
+	}
+
+	MarkExceeded(Exceedance{Cap: Caps()["claude"], Month: "2026-10", SpendUSD: 101})
+	got, err := Filter([]string{"claude", "gemini"}, "m", now)
+	if err != nil || len(got) != 1 || got[0] != "gemini" {
+		t.Fatalf("expected a fallback to gemini, got %v, %v", got, err)
+	}
+	_, err = Filter([]string{"claude"}, "m", now)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.StatusCode() != http.StatusTooManyRequests || gjson.Get(err.Error(), "error.code").String() != Rejection {
+		t.Fatalf("expected a rejection without fallback providers, got %v", err)
+	}
+	if got, err = Filter([]string{"claude", "gemini"}, "m", now.AddDate(0, 1, 0)); err != nil || len(got) != 2 {
+		t.Fatalf("expected the cap to reset next month, got %v, %v", got, err)
+	}
+
+	MarkExceeded(Exceedance{Cap: Caps()["codex"], Month: "2026-10", SpendUSD: 60})
+	if _, err = Filter([]string{"codex", "gemini"}, "m", now); !errors.As(err, &exceeded) {
+		t.Fatalf("expected reject caps to refuse the request, got %v", err)
+	}
+
+	SetCaps([]config.ProviderSpendCap{{Provider: "codex", MonthlyCap: 50}})
+	if _, ok := Check("claude", now); ok {
+		t.Fatal("expected removing a cap to drop its exceedance")
+	}
+	if entry, ok := Check("codex", now); !ok || entry.Action != ActionFallback {
+		t.Fatalf("expected the remaining exceedance to pick up the new action, got %+v, %v", entry, ok)
+	}
+}
@@ -0,0 +1,134 @@
+// Package proxyhealth probes the outbound proxies credentials egress through and
+// caches the results, so status endpoints can report unreachable proxies without
+// dialing them on every request.
+package proxyhealth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL is how long a probe result is reused.
+	DefaultTTL = 30 * time.Second
+	// DefaultTimeout bounds a single probe.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Status is the result of the last probe of one proxy.
+type Status struct {
+	// Proxy is the proxy URL with its password removed.
+	Proxy     string    `json:"proxy"`
+	Reachable bool      `json:"reachable"`
+	LatencyMs int64     `json:"latency-ms,omitempty"`
+	CheckedAt time.Time `json:"checked-at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Checker probes proxies by opening a TCP connection to the proxy host.
+type Checker struct {
+	ttl     time.Duration
+	timeout time.Duration
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu      sync.Mutex
+	results map[string]Status
+}
+
+var defaultChecker = NewChecker(DefaultTTL, DefaultTimeout)
+
+// NewChecker creates a checker that reuses results for ttl and gives up a probe after timeout.
+func NewChecker(ttl, timeout time.Duration) *Checker {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{
+		ttl:     ttl,
+		timeout: timeout,
+		dial:    (&net.Dialer{}).DialContext,
+		results: make(map[string]Status),
+	}
+}
+
+// Check probes proxyURL with the shared checker.
+func Check(ctx context.Context, proxyURL string) Status {
+	return defaultChecker.Check(ctx, proxyURL)
+}
+
+// Check returns the cached status of proxyURL, probing it when the cached result
+// is older than the checker's TTL.
+func (c *Checker) Check(ctx context.Context, proxyURL string) Status {
+	proxyURL = strings.TrimSpace(proxyURL)
+	now := time.Now()
+	c.mu.Lock()
+	cached, ok := c.results[proxyURL]
+	c.mu.Unlock()
+	if ok && now.Sub(cached.CheckedAt) < c.ttl {
+		return cached
+	}
+
+	status := Status{Proxy: Redact(proxyURL), CheckedAt: now}
+	addr, err := proxyAddress(proxyURL)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		dialCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		conn, errDial := c.dial(dialCtx, "tcp", addr)
+		cancel()
+		if errDial != nil {
+			status.Error = errDial.Error()
+		} else {
+			_ = conn.Close()
+			status.Reachable = true
+			status.LatencyMs = time.Since(now).Milliseconds()
+		}
+	}
+	c.mu.Lock()
+	c.results[proxyURL] = status
+	c.mu.Unlock()
+	return status
+}
+
+// proxyAddress returns the host:port to dial for proxyURL, applying the scheme's default port.
+func proxyAddress(proxyURL string) (string, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("missing proxy host")
+	}
+	if port := u.Port(); port != "" {
+		return u.Host, nil
+	}
+	switch u.Scheme {
+	case "socks5":
+		return net.JoinHostPort(u.Hostname(), "1080"), nil
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443"), nil
+	default:
+		return net.JoinHostPort(u.Hostname(), "80"), nil
+	}
+}
+
+// Redact removes the password from proxyURL so it can be reported.
+func Redact(proxyURL string) string {
+	u, err := url.Parse(strings.TrimSpace(proxyURL))
+	if err != nil || u.Host == "" {
+		return "<redacted>"
+	}
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+	}
+	return u.String()
+}
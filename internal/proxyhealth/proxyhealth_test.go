@@ -0,0 +1,46 @@
+package proxyhealth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCheckProbesAndCaches(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	c := NewChecker(time.Minute, time.Second)
+	dials := 0
+	dial := c.dial
+	c.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		return dial(ctx, network, addr)
+	}
+
+	proxyURL := "socks5://user:secret@" + ln.Addr().String()
+	st := c.Check(context.Background(), proxyURL)
+	if !st.Reachable || st.Error != "" {
+		t.Fatalf("expected reachable proxy, got %+v", st)
+	}
+	if st.Proxy != "socks5://user:xxxxx@"+ln.Addr().String() {
+		t.Fatalf("expected redacted proxy, got %q", st.Proxy)
+	}
+	c.Check(context.Background(), proxyURL)
+	if dials != 1 {
+		t.Fatalf("expected cached result, dialed %d times", dials)
+	}
+
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	if st = c.Check(context.Background(), "http://"+addr); st.Reachable || st.Error == "" {
+		t.Fatalf("expected unreachable proxy, got %+v", st)
+	}
+	if st = c.Check(context.Background(), "http://"); st.Reachable || st.Error == "" {
+		t.Fatalf("expected invalid proxy to be unreachable, got %+v", st)
+	}
+}
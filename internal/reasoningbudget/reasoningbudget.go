@@ -0,0 +1,490 @@
+// Package reasoningbudget caps the reasoning (thinking) tokens client keys and models
+// may request. Matching requests are rewritten to the largest budget or effort level
+// the cap allows in their inbound format, or rejected, and the decision is kept on the
+// Gin context so the usage database can flag requests that were clamped, rejected or
+// reported more reasoning tokens than allowed.
+package reasoningbudget
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/constant"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Rule actions.
+const (
+	ActionClamp  = "clamp"
+	ActionReject = "reject"
+	ActionFlag   = "flag"
+)
+
+// Outcomes recorded in usage for requests a rule matched.
+const (
+	// OutcomeClamped marks requests rewritten to fit the budget.
+	OutcomeClamped = "clamped"
+	// OutcomeRejected marks requests refused for asking for more than the budget.
+	OutcomeRejected = "rejected"
+	// OutcomeFlagged marks requests that asked for more than a flag rule allows.
+	OutcomeFlagged = "flagged"
+	// OutcomeExceeded marks responses reporting more reasoning tokens than the budget.
+	OutcomeExceeded = "exceeded"
+)
+
+// Rejection is the usage rejection reason and error code of refused requests.
+const Rejection = "reasoning_budget_exceeded"
+
+// GinKey stores the Decision of a request on the Gin context.
+const GinKey = "REASONING_BUDGET"
+
+// claudeMinBudget is the smallest budget_tokens Claude accepts with thinking enabled.
+const claudeMinBudget = 1024
+
+// effortLevels and geminiLevels are the effort levels tried when clamping, largest first.
+var (
+	effortLevels = []string{"xhigh", "high", "medium", "low", "minimal", "none"}
+	geminiLevels = []string{"high", "medium", "low", "minimal"}
+)
+
+// Limit is the budget a rule applies to a request.
+type Limit struct {
+	Rule      string `json:"rule"`
+	MaxTokens int    `json:"max_tokens"`
+	Action    string `json:"action"`
+}
+
+// Decision records how a matched request was handled.
+type Decision struct {
+	Limit
+	// Requested is the largest budget the request asked for explicitly: -1 for a
+	// dynamic (unbounded) budget and 0 when it asked for none.
+	Requested int `json:"requested"`
+	// Clamped is set when the request was rewritten.
+	Clamped bool `json:"clamped"`
+}
+
+type rule struct {
+	limit  Limit
+	keys   map[string]struct{}
+	models []string
+}
+
+// Set holds the compiled rules.
+type Set struct {
+	rules []rule
+}
+
+var active atomic.Pointer[Set]
+
+// ExceededError reports a request refused by a reject rule.
+type ExceededError struct {
+	Model     string
+	Requested int
+	MaxTokens int
+}
+
+// Error renders an OpenAI-style JSON error body so handlers forward it verbatim.
+func (e *ExceededError) Error() string {
+	requested := fmt.Sprintf("%d tokens", e.Requested)
+	if e.Requested < 0 {
+		requested = "a dynamic budget"
+	}
+	message := fmt.Sprintf("requested reasoning budget (%s) exceeds the %d tokens allowed for this key and model", requested, e.MaxTokens)
+	payload, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"code":    Rejection,
+			"type":    "invalid_request_error",
+			"message": message,
+			"model":   e.Model,
+		},
+	})
+	if err != nil {
+		return message
+	}
+	return string(payload)
+}
+
+// StatusCode implements the status accessor used by handlers.
+func (e *ExceededError) StatusCode() int { return http.StatusBadRequest }
+
+// Compile builds a rule set from configuration.
+func Compile(budgets []config.ReasoningBudget) *Set {
+	out := &Set{rules: make([]rule, 0, len(budgets))}
+	for i, b := range budgets {
+		r := rule{limit: Limit{Rule: strings.TrimSpace(b.Name), MaxTokens: max(b.MaxTokens, 0), Action: strings.ToLower(strings.TrimSpace(b.Action))}}
+		if r.limit.Rule == "" {
+			r.limit.Rule = fmt.Sprintf("rule-%d", i+1)
+		}
+		if r.limit.Action == "" {
+			r.limit.Action = ActionClamp
+		}
+		for _, key := range b.APIKeys {
+			if key = strings.TrimSpace(key); key == "" {
+				continue
+			}
+			if r.keys == nil {
+				r.keys = make(map[string]struct{}, len(b.APIKeys))
+			}
+			r.keys[key] = struct{}{}
+		}
+		for _, pattern := range b.Models {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				r.models = append(r.models, pattern)
+			}
+		}
+		out.rules = append(out.rules, r)
+	}
+	return out
+}
+
+// SetRules replaces the active rule set.
+func SetRules(budgets []config.ReasoningBudget) {
+	if len(budgets) == 0 {
+		active.Store(nil)
+		return
+	}
+	active.Store(Compile(budgets))
+}
+
+// Active returns the active rule set or nil when no budgets are configured.
+func Active() *Set {
+	s := active.Load()
+	if s == nil || len(s.rules) == 0 {
+		return nil
+	}
+	return s
+}
+
+// Match returns the limit of the first rule selecting apiKey and any of models.
+func (s *Set) Match(apiKey string, models ...string) (Limit, bool) {
+	if s == nil {
+		return Limit{}, false
+	}
+	apiKey = strings.TrimSpace(apiKey)
+	for _, r := range s.rules {
+		if r.keys != nil {
+			if _, ok := r.keys[apiKey]; !ok {
+				continue
+			}
+		}
+		if len(r.models) > 0 && !matchesAny(r.models, models) {
+			continue
+		}
+		return r.limit, true
+	}
+	return Limit{}, false
+}
+
+func matchesAny(patterns, models []string) bool {
+	for _, pattern := range patterns {
+		for _, model := range models {
+			if model != "" && config.MatchModelPattern(pattern, model) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// param is a reasoning parameter of an inbound format.
+type param struct {
+	path string
+	kind paramKind
+}
+
+type paramKind int
+
+const (
+	kindBudget paramKind = iota
+	kindEffort
+	kindGeminiLevel
+	kindClaude
+)
+
+// formatParams lists the reasoning parameters of format. The first one is written
+// when a request without any must be limited explicitly.
+func formatParams(format string) []param {
+	switch format {
+	case constant.OpenAI:
+		return []param{{"reasoning_effort", kindEffort}}
+	case constant.OpenaiResponse:
+		return []param{{"reasoning.effort", kindEffort}}
+	case constant.Claude:
+		return []param{{"thinking.budget_tokens", kindClaude}}
+	case constant.Gemini, constant.GeminiCLI:
+		root := "generationConfig.thinkingConfig."
+		if format == constant.GeminiCLI {
+			root = "request." + root
+		}
+		return []param{{root + "thinkingBudget", kindBudget}, {root + "thinkingLevel", kindGeminiLevel}}
+	}
+	return nil
+}
+
+// thinksByDefault reports whether model reasons when a request sets no budget: Gemini
+// models and models with effort levels do, Claude only when asked to.
+func thinksByDefault(model string) bool {
+	info := registry.GetGlobalRegistry().GetModelInfo(model)
+	if info == nil || info.Thinking == nil {
+		return false
+	}
+	return len(info.Thinking.Levels) > 0 || strings.EqualFold(info.Type, "gemini")
+}
+
+// Enforce applies limit to body, a request in the given inbound format for model, and
+// to the thinking metadata parsed from the model name suffix, which metadata may hold
+// and which is updated in place. Reject rules return an *ExceededError when the
+// request explicitly asks for more than the budget. Requests to thinking models that
+// think by default but do not set a budget are given one under clamp and reject rules,
+// since providers may otherwise think without bound.
+func Enforce(limit Limit, format, model string, body []byte, metadata map[string]any) ([]byte, Decision, error) {
+	d := Decision{Limit: limit}
+	format = strings.ToLower(strings.TrimSpace(format))
+	params := formatParams(format)
+	explicit := false
+	for _, p := range params {
+		if requested, ok := requestedBudget(p, model, body); ok {
+			explicit = true
+			d.Requested = mergeRequested(d.Requested, requested)
+		}
+	}
+	if requested, ok := metadataBudget(model, metadata); ok {
+		explicit = true
+		d.Requested = mergeRequested(d.Requested, requested)
+	}
+	if limit.Action == ActionFlag {
+		return body, d, nil
+	}
+	if explicit && exceeds(d.Requested, limit.MaxTokens) && limit.Action == ActionReject {
+		return body, d, &ExceededError{Model: model, Requested: d.Requested, MaxTokens: limit.MaxTokens}
+	}
+
+	out := body
+	if gjson.ValidBytes(body) {
+		for _, p := range params {
+			requested, ok := requestedBudget(p, model, out)
+			if !ok || !exceeds(requested, limit.MaxTokens) {
+				continue
+			}
+			if updated, err := clampParam(p, model, out, limit.MaxTokens); err == nil {
+				out = updated
+				d.Clamped = true
+			}
+		}
+		if !explicit && len(params) > 0 && thinksByDefault(model) && format != constant.Claude {
+			p := params[0]
+			if strings.HasSuffix(p.path, "thinkingBudget") && util.ModelUsesThinkingLevels(model) {
+				p = params[1]
+			}
+			if updated, err := clampParam(p, model, out, limit.MaxTokens); err == nil {
+				out = updated
+				d.Clamped = true
+			}
+		}
+	}
+	if clampMetadata(model, metadata, limit.MaxTokens) {
+		d.Clamped = true
+	}
+	return out, d, nil
+}
+
+// mergeRequested keeps the larger of two requested budgets, -1 meaning unbounded.
+func mergeRequested(a, b int) int {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return max(a, b)
+}
+
+func exceeds(requested, maxTokens int) bool {
+	return requested < 0 || requested > maxTokens
+}
+
+// requestedBudget returns the budget p asks for in body.
+func requestedBudget(p param, model string, body []byte) (int, bool) {
+	value := gjson.GetBytes(body, p.path)
+	if !value.Exists() {
+		return 0, false
+	}
+	switch p.kind {
+	case kindBudget:
+		if value.Type != gjson.Number {
+			return 0, false
+		}
+		return max(int(value.Int()), -1), true
+	case kindClaude:
+		if !strings.EqualFold(gjson.GetBytes(body, "thinking.type").String(), "enabled") || value.Type != gjson.Number {
+			return 0, false
+		}
+		return int(value.Int()), true
+	case kindEffort:
+		return effortBudget(model, value.String())
+	case kindGeminiLevel:
+		return util.ThinkingLevelToBudget(value.String())
+	}
+	return 0, false
+}
+
+func effortBudget(model, effort string) (int, bool) {
+	if strings.EqualFold(strings.TrimSpace(effort), "auto") {
+		return -1, true
+	}
+	return util.ThinkingEffortToBudget(model, effort)
+}
+
+// clampParam writes the largest value of p within maxTokens into body.
+func clampParam(p param, model string, body []byte, maxTokens int) ([]byte, error) {
+	switch p.kind {
+	case kindBudget:
+		return sjson.SetBytes(body, p.path, maxTokens)
+	case kindClaude:
+		if maxTokens < claudeMinBudget {
+			return sjson.SetRawBytes(body, "thinking", []byte(`{"type":"disabled"}`))
+		}
+		return sjson.SetBytes(body, p.path, maxTokens)
+	case kindEffort:
+		return sjson.SetBytes(body, p.path, clampEffort(model, maxTokens))
+	case kindGeminiLevel:
+		return sjson.SetBytes(body, p.path, clampGeminiLevel(maxTokens))
+	}
+	return nil, fmt.Errorf("unsupported parameter %s", p.path)
+}
+
+// clampEffort returns the highest effort level of model whose budget fits maxTokens,
+// or its lowest level when none does.
+func clampEffort(model string, maxTokens int) string {
+	levels := effortLevels
+	if modelLevels := util.GetModelThinkingLevels(model); len(modelLevels) > 0 {
+		levels = make([]string, 0, len(modelLevels))
+		for i := len(modelLevels) - 1; i >= 0; i-- {
+			levels = append(levels, strings.ToLower(modelLevels[i]))
+		}
+	}
+	for _, level := range levels {
+		if budget, ok := effortBudget(model, level); ok && !exceeds(budget, maxTokens) {
+			return level
+		}
+	}
+	return levels[len(levels)-1]
+}
+
+func clampGeminiLevel(maxTokens int) string {
+	for _, level := range geminiLevels {
+		if budget, _ := util.ThinkingLevelToBudget(level); budget <= maxTokens {
+			return level
+		}
+	}
+	return geminiLevels[len(geminiLevels)-1]
+}
+
+// metadataBudget returns the budget requested by a model name suffix.
+func metadataBudget(model string, metadata map[string]any) (int, bool) {
+	if metadata == nil {
+		return 0, false
+	}
+	requested, found := 0, false
+	if raw, ok := metadata[util.ThinkingBudgetMetadataKey].(int); ok {
+		requested, found = max(raw, -1), true
+	}
+	if effort, ok := metadata[util.ReasoningEffortMetadataKey].(string); ok {
+		if budget, okBudget := effortBudget(model, effort); okBudget {
+			if found {
+				requested = mergeRequested(requested, budget)
+			} else {
+				requested, found = budget, true
+			}
+		}
+	}
+	return requested, found
+}
+
+func clampMetadata(model string, metadata map[string]any, maxTokens int) bool {
+	if metadata == nil {
+		return false
+	}
+	clamped := false
+	if raw, ok := metadata[util.ThinkingBudgetMetadataKey].(int); ok && exceeds(raw, maxTokens) {
+		metadata[util.ThinkingBudgetMetadataKey] = maxTokens
+		clamped = true
+	}
+	if effort, ok := metadata[util.ReasoningEffortMetadataKey].(string); ok {
+		if budget, okBudget := effortBudget(model, effort); okBudget && exceeds(budget, maxTokens) {
+			metadata[util.ReasoningEffortMetadataKey] = clampEffort(model, maxTokens)
+			clamped = true
+		}
+	}
+	return clamped
+}
+
+// Apply enforces the active rules on a request from the client key carried by ctx.
+// requestedModel and model are matched against rule patterns; model (without
+// thinking suffix) selects the effort mapping. The decision is stored on the Gin
+// context for usage.
+func Apply(ctx context.Context, format, requestedModel, model string, body []byte, metadata map[string]any) ([]byte, error) {
+	s := Active()
+	if s == nil {
+		return body, nil
+	}
+	var ginCtx *gin.Context
+	if ctx != nil {
+		ginCtx, _ = ctx.Value("gin").(*gin.Context)
+	}
+	apiKey := ""
+	if ginCtx != nil {
+		apiKey = ginCtx.GetString("apiKey")
+	}
+	limit, ok := s.Match(apiKey, requestedModel, model)
+	if !ok {
+		return body, nil
+	}
+	out, d, err := Enforce(limit, format, model, body, metadata)
+	if ginCtx != nil {
+		ginCtx.Set(GinKey, &d)
+	}
+	return out, err
+}
+
+// FromContext returns the decision stored for the request behind ctx.
+func FromContext(ctx context.Context) (*Decision, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil {
+		return nil, false
+	}
+	d, ok := ginCtx.Value(GinKey).(*Decision)
+	return d, ok && d != nil
+}
+
+// Outcome classifies a usage record of the request behind ctx: rejected, exceeded
+// when reasoningTokens is over the budget, clamped or flagged. It returns "" when no
+// rule matched or the request stayed within its budget.
+func Outcome(ctx context.Context, rejection string, reasoningTokens int64) string {
+	if rejection == Rejection {
+		return OutcomeRejected
+	}
+	d, ok := FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	switch {
+	case reasoningTokens > int64(d.MaxTokens):
+		return OutcomeExceeded
+	case d.Clamped:
+		return OutcomeClamped
+	case d.Action == ActionFlag && exceeds(d.Requested, d.MaxTokens):
+		return OutcomeFlagged
+	}
+	return ""
+}
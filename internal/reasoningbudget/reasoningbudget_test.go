@@ -0,0 +1,127 @@
+package reasoningbudget
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	"github.com/tidwall/gjson"
+)
+
+func TestMatch(t *testing.T) {
+	set := Compile([]config.ReasoningBudget{
+		{Name: "k1-claude", APIKeys: []string{"k1"}, Models: []string{"claude-*"}, MaxTokens: 2048, Action: "Reject"},
+		{MaxTokens: 8192},
+	})
+	if limit, ok := set.Match("k1", "claude-sonnet"); !ok || limit.Rule != "k1-claude" || limit.Action != ActionReject {
+		t.Fatalf("unexpected limit %+v, %v", limit, ok)
+	}
+	if limit, ok := set.Match("k2", "claude-sonnet"); !ok || limit.Rule != "rule-2" || limit.Action != ActionClamp || limit.MaxTokens != 8192 {
+		t.Fatalf("expected the catch-all rule, got %+v, %v", limit, ok)
+	}
+	var none *Set
+	if _, ok := none.Match("k1", "claude-sonnet"); ok {
+		t.Fatal("nil set must not match")
+	}
+}
+
+func TestEnforceClampsPerFormat(t *testing.T) {
+	limit := Limit{Rule: "r", MaxTokens: 2048, Action: ActionClamp}
+	cases := []struct {
+		format, body, path, want string
+	}{
+		{"openai", `{"reasoning_effort":"high"}`, "reasoning_effort", "low"},
+		{"openai-response", `{"reasoning":{"effort":"medium"}}`, "reasoning.effort", "low"},
+		{"claude", `{"thinking":{"type":"enabled","budget_tokens":16000}}`, "thinking.budget_tokens", "2048"},
+		{"gemini", `{"generationConfig":{"thinkingConfig":{"thinkingBudget":-1}}}`, "generationConfig.thinkingConfig.thinkingBudget", "2048"},
+		{"gemini", `{"generationConfig":{"thinkingConfig":{"thinkingLevel":"high"}}}`, "generationConfig.thinkingConfig.thinkingLevel", "low"},
+		{"gemini-cli", `{"request":{"generationConfig":{"thinkingConfig":{"thinkingBudget":32768}}}}`, "request.generationConfig.thinkingConfig.thinkingBudget", "2048"},
+	}
+	for _, tc := range cases {
+		out, d, err := Enforce(limit, tc.format, "unknown-model", []byte(tc.body), nil)
+		if err != nil || !d.Clamped {
+			t.Fatalf("%s: expected a clamp, got %+v, %v", tc.format, d, err)
+		}
+		if got := gjson.GetBytes(out, tc.path).String(); got != tc.want {
+			t.Fatalf("%s: %s = %q, want %q (%s)", tc.format, tc.path, got, tc.want, out)
+		}
+	}
+
+	out, d, err := Enforce(limit, "claude", "unknown-model", []byte(`{"thinking":{"type":"enabled","budget_tokens":1500}}`), nil)
+	if err != nil || d.Clamped || gjson.GetBytes(out, "thinking.budget_tokens").Int() != 1500 {
+		t.Fatalf("expected a budget within the cap to be kept, got %s, %+v, %v", out, d, err)
+	}
+	out, _, _ = Enforce(Limit{MaxTokens: 512, Action: ActionClamp}, "claude", "unknown-model", []byte(`{"thinking":{"type":"enabled","budget_tokens":4096}}`), nil)
+	if gjson.GetBytes(out, "thinking.type").String() != "disabled" {
+		t.Fatalf("expected thinking to be disabled below Claude's minimum, got %s", out)
+	}
+}
+
+func TestEnforceRejectAndFlag(t *testing.T) {
+	body := []byte(`{"thinking":{"type":"enabled","budget_tokens":16000}}`)
+	_, d, err := Enforce(Limit{MaxTokens: 4096, Action: ActionReject}, "claude", "claude-x", body, nil)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Requested != 16000 || exceeded.StatusCode() != 400 || d.Requested != 16000 {
+		t.Fatalf("expected a rejection, got %+v, %v", d, err)
+	}
+	if code := gjson.Get(err.Error(), "error.code").String(); code != Rejection {
+		t.Fatalf("unexpected error body %s", err)
+	}
+
+	out, d, err := Enforce(Limit{MaxTokens: 4096, Action: ActionFlag}, "claude", "claude-x", body, nil)
+	if err != nil || d.Clamped || string(out) != string(body) || d.Requested != 16000 {
+		t.Fatalf("expected flag rules to leave the request alone, got %s, %+v, %v", out, d, err)
+	}
+}
+
+func TestEnforceClampsModelSuffix(t *testing.T) {
+	_, metadata := util.NormalizeThinkingModel("unknown-model(32768)")
+	_, d, err := Enforce(Limit{MaxTokens: 4096, Action: ActionClamp}, "openai", "unknown-model", []byte(`{}`), metadata)
+	if err != nil || !d.Clamped || metadata[util.ThinkingBudgetMetadataKey] != 4096 {
+		t.Fatalf("expected the suffix budget to be clamped, got %+v, %v, %v", metadata, d, err)
+	}
+	_, metadata = util.NormalizeThinkingModel("unknown-model(high)")
+	if _, _, err = Enforce(Limit{MaxTokens: 8192, Action: ActionClamp}, "openai", "unknown-model", []byte(`{}`), metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata[util.ReasoningEffortMetadataKey] != "medium" {
+		t.Fatalf("expected the suffix effort to be lowered, got %+v", metadata)
+	}
+}
+
+func TestApplyAndOutcome(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetRules([]config.ReasoningBudget{{APIKeys: []string{"k1"}, MaxTokens: 1024}})
+	defer SetRules(nil)
+
+	ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ginCtx.Set("apiKey", "k1")
+	ctx := context.WithValue(context.Background(), "gin", ginCtx)
+	out, err := Apply(ctx, "openai", "unknown-model", "unknown-model", []byte(`{"reasoning_effort":"high"}`), nil)
+	if err != nil || gjson.GetBytes(out, "reasoning_effort").String() != "low" {
+		t.Fatalf("unexpected result %s, %v", out, err)
+	}
+	if got := Outcome(ctx, "", 800); got != OutcomeClamped {
+		t.Fatalf("expected clamped, got %q", got)
+	}
+	if got := Outcome(ctx, "", 5000); got != OutcomeExceeded {
+		t.Fatalf("expected exceeded, got %q", got)
+	}
+	if got := Outcome(ctx, Rejection, 0); got != OutcomeRejected {
+		t.Fatalf("expected rejected, got %q", got)
+	}
+
+	other, _ := gin.CreateTestContext(httptest.NewRecorder())
+	other.Set("apiKey", "k2")
+	otherCtx := context.WithValue(context.Background(), "gin", other)
+	if _, err = Apply(otherCtx, "openai", "unknown-model", "unknown-model", []byte(`{"reasoning_effort":"high"}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := Outcome(otherCtx, "", 5000); got != "" {
+		t.Fatalf("expected keys without a budget to report nothing, got %q", got)
+	}
+}
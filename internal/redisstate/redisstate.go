@@ -0,0 +1,340 @@
+// Package redisstate shares rate limit and quota counters between proxy instances
+// through Redis. Every operation returns an error instead of blocking when Redis is
+// unreachable, so callers can fall back to enforcing limits from local state; after a
+// failure Redis is not contacted again for retryInterval.
+package redisstate
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKeyPrefix = "cliproxy:"
+	defaultTimeout   = 250 * time.Millisecond
+	// maxIdleConns bounds the connections kept open between commands.
+	maxIdleConns = 8
+	// retryInterval is how long Redis is skipped after a connection failure.
+	retryInterval = 5 * time.Second
+)
+
+// ErrUnavailable is returned while Redis is skipped after a connection failure.
+var ErrUnavailable = errors.New("redisstate: redis unavailable")
+
+// tokenBucketScript refills the bucket in KEYS[1] at ARGV[1] tokens per millisecond
+// up to ARGV[2], as of ARGV[3] (Unix milliseconds), and takes one token. It returns
+// {1, 0} when admitted and {0, wait in milliseconds} otherwise.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil then
+  tokens = burst
+  last = now
+end
+if now > last then
+  tokens = math.min(burst, tokens + (now - last) * rate)
+  last = now
+end
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(last))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+return {allowed, wait}
+`)
+
+// addFloatScript adds ARGV[1] to the counter in KEYS[1], (re)sets its TTL to ARGV[2]
+// milliseconds and returns the new value.
+var addFloatScript = redis.NewScript(`
+local value = redis.call('INCRBYFLOAT', KEYS[1], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return value
+`)
+
+// Store is a connection to the shared Redis.
+type Store struct {
+	cfg    config.RedisConfig
+	addr   string
+	client *redis.Client
+	prefix string
+
+	downUntil atomic.Int64
+	down      atomic.Bool
+	lastError atomic.Pointer[string]
+}
+
+// Status describes the shared Redis for the management status endpoint.
+type Status struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address,omitempty"`
+	// Available is false while limits are enforced locally after a connection failure.
+	Available bool   `json:"available"`
+	LastError string `json:"last-error,omitempty"`
+}
+
+// CurrentStatus reports the active store.
+func CurrentStatus() Status {
+	s := Active()
+	if s == nil {
+		return Status{}
+	}
+	status := Status{Enabled: true, Address: s.addr, Available: s.Available()}
+	if msg := s.lastError.Load(); msg != nil {
+		status.LastError = *msg
+	}
+	return status
+}
+
+var active atomic.Pointer[Store]
+
+// Configure replaces the active store. An unchanged configuration keeps the
+// existing connections; a disabled one removes the store.
+func Configure(cfg config.RedisConfig) error {
+	prev := active.Load()
+	if !cfg.Enabled || strings.TrimSpace(cfg.Address) == "" {
+		active.Store(nil)
+		if prev != nil {
+			_ = prev.client.Close()
+		}
+		return nil
+	}
+	if prev != nil && prev.cfg == cfg {
+		return nil
+	}
+	next, err := newStore(cfg)
+	if err != nil {
+		active.Store(nil)
+	} else {
+		active.Store(next)
+	}
+	if prev != nil {
+		_ = prev.client.Close()
+	}
+	return err
+}
+
+// Active returns the active store or nil when Redis is not configured.
+func Active() *Store {
+	return active.Load()
+}
+
+func newStore(cfg config.RedisConfig) (*Store, error) {
+	addr := strings.TrimSpace(cfg.Address)
+	timeout := defaultTimeout
+	if cfg.TimeoutMs > 0 {
+		timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
+	}
+	// Commands are not retried: a failure falls back to local limits instead of
+	// delaying the request.
+	opts := &redis.Options{
+		Addr:             addr,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		Protocol:         2,
+		DialTimeout:      timeout,
+		ReadTimeout:      timeout,
+		WriteTimeout:     timeout,
+		MaxRetries:       -1,
+		MaxIdleConns:     maxIdleConns,
+		DisableIndentity: true,
+	}
+	if cfg.TLS.Enabled {
+		host, _, _ := net.SplitHostPort(addr)
+		opts.TLSConfig = &tls.Config{ServerName: host, InsecureSkipVerify: cfg.TLS.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+		if cfg.TLS.CAFile != "" {
+			pem, err := os.ReadFile(cfg.TLS.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read redis CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("redis CA file %s contains no certificates", cfg.TLS.CAFile)
+			}
+			opts.TLSConfig.RootCAs = pool
+		}
+	}
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &Store{cfg: cfg, addr: addr, client: redis.NewClient(opts), prefix: prefix}, nil
+}
+
+// Key joins parts into a key under the configured prefix.
+func (s *Store) Key(parts ...string) string {
+	return s.prefix + strings.Join(parts, ":")
+}
+
+// Available reports whether Redis answered the last command.
+func (s *Store) Available() bool {
+	return s != nil && !s.down.Load()
+}
+
+// observe records the outcome of a command, skipping Redis for retryInterval after a
+// connection failure. Error replies and missing keys do not mark Redis unavailable.
+func (s *Store) observe(err error) error {
+	var replyErr redis.Error
+	if err != nil && !errors.As(err, &replyErr) {
+		s.downUntil.Store(time.Now().Add(retryInterval).UnixNano())
+		msg := err.Error()
+		s.lastError.Store(&msg)
+		if s.down.CompareAndSwap(false, true) {
+			log.Warnf("redisstate: %s unreachable, enforcing limits locally: %v", s.addr, err)
+		}
+		return err
+	}
+	if s.down.CompareAndSwap(true, false) {
+		log.Infof("redisstate: %s reachable again, limits are shared", s.addr)
+	}
+	return err
+}
+
+// begin returns the context for a command, or ErrUnavailable while Redis is skipped
+// after a connection failure.
+func (s *Store) begin(ctx context.Context) (context.Context, error) {
+	if until := s.downUntil.Load(); until != 0 && time.Now().UnixNano() < until {
+		return nil, ErrUnavailable
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return ctx, nil
+}
+
+// run executes script, loading it when the server does not have it cached.
+func (s *Store) run(ctx context.Context, script *redis.Script, keys []string, args ...any) (any, error) {
+	ctx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := script.Run(ctx, s.client, keys, args...).Result()
+	return reply, s.observe(err)
+}
+
+// get returns the string at key, or "" and false when it does not exist.
+func (s *Store) get(ctx context.Context, key string) (string, bool, error) {
+	ctx, err := s.begin(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	value, err := s.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, s.observe(nil)
+	}
+	if err = s.observe(err); err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// TakeToken takes one token from the bucket stored at key, which holds up to burst
+// tokens and refills at perSecond. When the bucket is empty it returns false and how
+// long until the next token.
+func (s *Store) TakeToken(ctx context.Context, key string, perSecond float64, burst int, now time.Time) (bool, time.Duration, error) {
+	reply, err := s.run(ctx, tokenBucketScript, []string{key},
+		strconv.FormatFloat(perSecond/1000, 'g', -1, 64), burst, now.UnixMilli())
+	if err != nil {
+		return false, 0, err
+	}
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("redisstate: unexpected token bucket reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
+
+// AddFloat adds delta to the counter at key, refreshes its TTL and returns the new total.
+func (s *Store) AddFloat(ctx context.Context, key string, delta float64, ttl time.Duration) (float64, error) {
+	reply, err := s.run(ctx, addFloatScript, []string{key},
+		strconv.FormatFloat(delta, 'f', -1, 64), ttl.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+	return parseFloat(reply)
+}
+
+// GetFloat returns the counter at key, or zero when it does not exist.
+func (s *Store) GetFloat(ctx context.Context, key string) (float64, error) {
+	value, ok, err := s.get(ctx, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return parseFloat(value)
+}
+
+// SetTime stores t at key with the given TTL.
+func (s *Store) SetTime(ctx context.Context, key string, t time.Time, ttl time.Duration) error {
+	ctx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return s.observe(s.client.Set(ctx, key, t.UnixMilli(), ttl).Err())
+}
+
+// GetTime returns the time stored at key, or the zero time when it does not exist.
+func (s *Store) GetTime(ctx context.Context, key string) (time.Time, error) {
+	value, ok, err := s.get(ctx, key)
+	if err != nil || !ok {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("redisstate: bad time at %s: %w", key, err)
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// Delete removes keys.
+func (s *Store) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	ctx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return s.observe(s.client.Del(ctx, keys...).Err())
+}
+
+func parseFloat(reply any) (float64, error) {
+	var raw string
+	switch v := reply.(type) {
+	case string:
+		raw = v
+	case int64:
+		return float64(v), nil
+	default:
+		return 0, fmt.Errorf("redisstate: unexpected reply %v", reply)
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, fmt.Errorf("redisstate: bad number %q", raw)
+	}
+	return f, nil
+}
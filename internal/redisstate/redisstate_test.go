@@ -0,0 +1,110 @@
+package redisstate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestStoreCommands(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("proxy", "secret")
+	if err := Configure(config.RedisConfig{Enabled: true, Address: server.Addr(), Username: "proxy", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Configure(config.RedisConfig{}) }()
+	store := Active()
+	ctx := context.Background()
+
+	key := store.Key("spend", "abc", "2026-10")
+	if key != "cliproxy:spend:abc:2026-10" {
+		t.Fatalf("unexpected key %s", key)
+	}
+	if total, err := store.AddFloat(ctx, key, 1.25, time.Hour); err != nil || total != 1.25 {
+		t.Fatalf("AddFloat = %v, %v", total, err)
+	}
+	if total, err := store.AddFloat(ctx, key, 0.5, time.Hour); err != nil || total != 1.75 {
+		t.Fatalf("AddFloat = %v, %v", total, err)
+	}
+	if total, err := store.GetFloat(ctx, key); err != nil || total != 1.75 {
+		t.Fatalf("GetFloat = %v, %v", total, err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if total, err := store.GetFloat(ctx, key); err != nil || total != 0 {
+		t.Fatalf("expected deleted counter to read zero, got %v, %v", total, err)
+	}
+
+	at := time.UnixMilli(1760000000123).UTC()
+	if err := store.SetTime(ctx, "t", at, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.GetTime(ctx, "t"); err != nil || !got.Equal(at) {
+		t.Fatalf("GetTime = %v, %v", got, err)
+	}
+	if got, err := store.GetTime(ctx, "missing"); err != nil || !got.IsZero() {
+		t.Fatalf("expected zero time for a missing key, got %v, %v", got, err)
+	}
+
+	now := time.Now()
+	for i, want := range []bool{true, true, false} {
+		ok, wait, err := store.TakeToken(ctx, "bucket", 1, 2, now)
+		if err != nil || ok != want {
+			t.Fatalf("take %d = %v, %v, %v", i, ok, wait, err)
+		}
+		if !ok && wait != time.Second {
+			t.Fatalf("expected a one second wait, got %v", wait)
+		}
+	}
+	if ttl := server.TTL(store.Key("spend", "abc", "2026-10")); ttl != 0 {
+		t.Fatalf("expected the deleted counter to have no TTL, got %v", ttl)
+	}
+	if ttl := server.TTL("t"); ttl != time.Hour {
+		t.Fatalf("SetTime TTL = %v, want 1h", ttl)
+	}
+	if !store.Available() {
+		t.Fatal("expected the store to be available")
+	}
+}
+
+func TestStoreRejectsBadCredentials(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("proxy", "secret")
+	if err := Configure(config.RedisConfig{Enabled: true, Address: server.Addr(), Username: "proxy", Password: "wrong"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Configure(config.RedisConfig{}) }()
+	if _, err := Active().GetFloat(context.Background(), "k"); err == nil {
+		t.Fatal("expected authentication to fail")
+	}
+}
+
+func TestStoreUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	if err = Configure(config.RedisConfig{Enabled: true, Address: addr, TimeoutMs: 50}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Configure(config.RedisConfig{}) }()
+	store := Active()
+
+	if _, err = store.GetFloat(context.Background(), "k"); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+	if store.Available() {
+		t.Fatal("expected the store to be marked unavailable")
+	}
+	if _, err = store.GetFloat(context.Background(), "k"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected redis to be skipped after a failure, got %v", err)
+	}
+}
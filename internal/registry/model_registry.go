@@ -753,6 +753,73 @@ func (r *ModelRegistry) GetModelInfo(modelID string) *ModelInfo {
 	return nil
 }
 
+// Model health states reported by ModelHealth.Status.
+const (
+	ModelStatusAvailable   = "available"
+	ModelStatusCoolingDown = "cooling_down"
+	ModelStatusUnavailable = "unavailable"
+)
+
+// ModelHealth summarises how many registered clients can currently serve a model.
+type ModelHealth struct {
+	// Providers lists the providers supplying the model, most clients first.
+	Providers []string `json:"providers"`
+	// Clients is the number of registered clients for the model.
+	Clients int `json:"clients"`
+	// Available counts clients that are neither cooling down nor suspended.
+	Available int `json:"available"`
+	// CoolingDown counts clients waiting out a quota cooldown.
+	CoolingDown int `json:"cooling_down"`
+	// Suspended counts clients disabled for other reasons (e.g., blocked credentials).
+	Suspended int `json:"suspended"`
+}
+
+// Status classifies the health as available, cooling_down or unavailable.
+func (h ModelHealth) Status() string {
+	switch {
+	case h.Available > 0:
+		return ModelStatusAvailable
+	case h.CoolingDown > 0:
+		return ModelStatusCoolingDown
+	default:
+		return ModelStatusUnavailable
+	}
+}
+
+// GetModelHealth returns the serving state of modelID; ok is false when the model is
+// not registered.
+func (r *ModelRegistry) GetModelHealth(modelID string) (ModelHealth, bool) {
+	providers := r.GetModelProviders(modelID)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	registration, exists := r.models[modelID]
+	if !exists || registration == nil || registration.Count <= 0 {
+		return ModelHealth{}, false
+	}
+	health := ModelHealth{Providers: providers, Clients: registration.Count}
+	now := time.Now()
+	quotaExpiredDuration := 5 * time.Minute
+	cooling := make(map[string]struct{})
+	for clientID, quotaTime := range registration.QuotaExceededClients {
+		if quotaTime != nil && now.Sub(*quotaTime) < quotaExpiredDuration {
+			cooling[clientID] = struct{}{}
+		}
+	}
+	for clientID, reason := range registration.SuspendedClients {
+		if strings.EqualFold(reason, "quota") {
+			cooling[clientID] = struct{}{}
+			continue
+		}
+		if _, ok := cooling[clientID]; !ok {
+			health.Suspended++
+		}
+	}
+	health.CoolingDown = len(cooling)
+	health.Available = max(health.Clients-health.CoolingDown-health.Suspended, 0)
+	return health, true
+}
+
 // convertModelToMap converts ModelInfo to the appropriate format for different handler types
 func (r *ModelRegistry) convertModelToMap(model *ModelInfo, handlerType string) map[string]any {
 	if model == nil {
@@ -0,0 +1,185 @@
+// Package replay reconstructs proxied requests from request log files so they can
+// be re-issued against the running server, optionally pinned to a specific
+// credential or rewritten to target a different model.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	sectionRequestInfo = "=== REQUEST INFO ==="
+	sectionHeaders     = "=== HEADERS ==="
+	sectionBody        = "=== REQUEST BODY ==="
+)
+
+// Request is the inbound client request recovered from a request log.
+type Request struct {
+	URL     string      `json:"url"`
+	Method  string      `json:"method"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"-"`
+}
+
+// Options controls how a logged request is replayed.
+type Options struct {
+	// Model overrides the requested model, either in the JSON body or the Gemini-style path.
+	Model string `json:"model,omitempty"`
+	// AuthID pins credential selection to a single auth entry.
+	AuthID string `json:"auth_id,omitempty"`
+	// DryRun returns the reconstructed request without sending it.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Parse extracts the client request from the contents of a request log file.
+func Parse(data []byte) (*Request, error) {
+	start := bytes.Index(data, []byte(sectionRequestInfo))
+	if start < 0 {
+		return nil, errors.New("replay: request info section not found")
+	}
+	data = data[start:]
+	headersAt := bytes.Index(data, []byte(sectionHeaders))
+	bodyAt := bytes.Index(data, []byte(sectionBody))
+	if headersAt < 0 || bodyAt < 0 || bodyAt < headersAt {
+		return nil, errors.New("replay: malformed request log")
+	}
+
+	req := &Request{Headers: make(http.Header)}
+	scanner := bufio.NewScanner(bytes.NewReader(data[:headersAt]))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "URL: "):
+			req.URL = strings.TrimSpace(strings.TrimPrefix(line, "URL: "))
+		case strings.HasPrefix(line, "Method: "):
+			req.Method = strings.TrimSpace(strings.TrimPrefix(line, "Method: "))
+		}
+	}
+
+	headerBlock := data[headersAt+len(sectionHeaders) : bodyAt]
+	scanner = bufio.NewScanner(bytes.NewReader(headerBlock))
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		req.Headers.Add(key, value)
+	}
+
+	body := data[bodyAt+len(sectionBody):]
+	body = bytes.TrimPrefix(body, []byte("\n"))
+	if end := bytes.Index(body, []byte("\n\n=== ")); end >= 0 {
+		body = body[:end]
+	}
+	req.Body = bytes.TrimRight(body, "\n")
+
+	if req.URL == "" || req.Method == "" {
+		return nil, errors.New("replay: request log is missing URL or method")
+	}
+	return req, nil
+}
+
+// Prepare applies opts to a copy of the logged request and strips credentials that
+// were masked when the log was written. The returned path includes the query string.
+func (r *Request) Prepare(opts Options) (*Request, error) {
+	if r == nil {
+		return nil, errors.New("replay: nil request")
+	}
+	out := &Request{Method: r.Method, Headers: make(http.Header), Body: append([]byte(nil), r.Body...)}
+	for key, values := range r.Headers {
+		if isSensitive(key) {
+			continue
+		}
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Accept-Encoding", "Connection", "Host":
+			continue
+		}
+		out.Headers[key] = append([]string(nil), values...)
+	}
+
+	parsed, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("replay: invalid logged URL: %w", err)
+	}
+	query := parsed.Query()
+	for key := range query {
+		if isSensitive(key) || strings.EqualFold(key, "key") {
+			query.Del(key)
+		}
+	}
+	parsed.RawQuery = query.Encode()
+
+	if model := strings.TrimSpace(opts.Model); model != "" {
+		if gjson.GetBytes(out.Body, "model").Exists() {
+			if out.Body, err = sjson.SetBytes(out.Body, "model", model); err != nil {
+				return nil, fmt.Errorf("replay: rewrite model: %w", err)
+			}
+		}
+		parsed.Path = rewritePathModel(parsed.Path, model)
+	}
+	out.URL = parsed.String()
+	return out, nil
+}
+
+// rewritePathModel replaces the model in Gemini-style paths such as
+// /v1beta/models/{model}:generateContent.
+func rewritePathModel(path, model string) string {
+	const marker = "/models/"
+	idx := strings.Index(path, marker)
+	if idx < 0 {
+		return path
+	}
+	rest := path[idx+len(marker):]
+	end := strings.IndexAny(rest, ":/")
+	if end < 0 {
+		end = len(rest)
+	}
+	return path[:idx+len(marker)] + model + rest[end:]
+}
+
+func isSensitive(key string) bool {
+	lower := strings.ToLower(strings.TrimSpace(key))
+	for _, fragment := range []string{"authorization", "api-key", "apikey", "api_key", "token", "secret"} {
+		if strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// WithOptions marks ctx as carrying a replayed request. Only in-process callers can
+// set this value, so it is safe to use for bypassing client authentication.
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, contextKey{}, opts)
+}
+
+// FromContext returns the replay options attached to ctx, looking through the
+// embedded Gin context when present.
+func FromContext(ctx context.Context) (Options, bool) {
+	if ctx == nil {
+		return Options{}, false
+	}
+	if opts, ok := ctx.Value(contextKey{}).(Options); ok {
+		return opts, true
+	}
+	if ginCtx, ok := ctx.Value("gin").(*gin.Context); ok && ginCtx != nil && ginCtx.Request != nil {
+		if opts, ok := ginCtx.Request.Context().Value(contextKey{}).(Options); ok {
+			return opts, true
+		}
+	}
+	return Options{}, false
+}
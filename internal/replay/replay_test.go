@@ -0,0 +1,64 @@
+package replay
+
+import (
+	"testing"
+)
+
+const sampleLog = `=== REQUEST INFO ===
+Version: dev
+URL: /v1beta/models/gemini-2.5-pro:generateContent?alt=sse&key=abc...xyz
+Method: POST
+Timestamp: 2025-01-01T00:00:00Z
+
+=== HEADERS ===
+Content-Type: application/json
+Authorization: Bearer sk-...abcd
+Content-Length: 42
+
+=== REQUEST BODY ===
+{"model":"gemini-2.5-pro","contents":[{"parts":[{"text":"hi"}]}]}
+
+=== API REQUEST ===
+{"upstream":true}
+
+=== RESPONSE ===
+Status: 500
+
+boom
+`
+
+func TestParseAndPrepare(t *testing.T) {
+	logged, err := Parse([]byte(sampleLog))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if logged.Method != "POST" {
+		t.Fatalf("Method = %q, want POST", logged.Method)
+	}
+	if got := string(logged.Body); got != `{"model":"gemini-2.5-pro","contents":[{"parts":[{"text":"hi"}]}]}` {
+		t.Fatalf("Body = %q", got)
+	}
+
+	prepared, err := logged.Prepare(Options{Model: "gemini-2.5-flash"})
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	if prepared.URL != "/v1beta/models/gemini-2.5-flash:generateContent?alt=sse" {
+		t.Fatalf("URL = %q", prepared.URL)
+	}
+	if prepared.Headers.Get("Authorization") != "" || prepared.Headers.Get("Content-Length") != "" {
+		t.Fatalf("expected masked and length headers to be dropped, got %v", prepared.Headers)
+	}
+	if prepared.Headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type header lost: %v", prepared.Headers)
+	}
+	if got := string(prepared.Body); got != `{"model":"gemini-2.5-flash","contents":[{"parts":[{"text":"hi"}]}]}` {
+		t.Fatalf("prepared body = %q", got)
+	}
+}
+
+func TestParseRejectsUnstructuredLog(t *testing.T) {
+	if _, err := Parse([]byte("not a request log")); err == nil {
+		t.Fatal("expected error for unstructured input")
+	}
+}
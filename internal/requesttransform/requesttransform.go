@@ -0,0 +1,358 @@
+// Package requesttransform rewrites inbound request bodies for selected client API
+// keys before they are translated for a provider, e.g. to force a system prompt,
+// clamp max_tokens or strip fields a deployment does not support. Which rules were
+// applied or skipped is recorded in the request log.
+package requesttransform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/constant"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// GinLogKey stores the request log section describing the transformation of a request.
+const GinLogKey = "API_REQUEST_TRANSFORM"
+
+// templateFuncs are the functions available to rule templates: json encodes a value,
+// get returns the decoded value at a body path and raw its JSON text ("null" when absent).
+// get and raw are rebound to the request body on every execution.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+	"get": func(path string) any { return nil },
+	"raw": func(path string) string { return "null" },
+}
+
+type rule struct {
+	cfg      config.RequestTransform
+	name     string
+	keys     map[string]struct{}
+	formats  map[string]struct{}
+	template *template.Template
+}
+
+// Transformer evaluates a compiled rule set.
+type Transformer struct {
+	rules []rule
+}
+
+// Outcome reports what one rule in scope of a request did.
+type Outcome struct {
+	Rule    string
+	Applied bool
+	// Reason explains why a rule was skipped.
+	Reason string
+}
+
+var active atomic.Pointer[Transformer]
+
+// Compile builds a transformer from configuration, skipping rules with invalid templates.
+func Compile(rules []config.RequestTransform) *Transformer {
+	out := &Transformer{rules: make([]rule, 0, len(rules))}
+	for i := range rules {
+		r := rules[i]
+		compiled := rule{cfg: r, name: strings.TrimSpace(r.Name)}
+		if compiled.name == "" {
+			compiled.name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if tmpl := strings.TrimSpace(r.Template); tmpl != "" {
+			parsed, err := template.New(compiled.name).Funcs(templateFuncs).Option("missingkey=zero").Parse(tmpl)
+			if err != nil {
+				log.Warnf("requesttransform: rule %q has invalid template: %v", compiled.name, err)
+				continue
+			}
+			compiled.template = parsed
+		}
+		for _, key := range r.APIKeys {
+			if key = strings.TrimSpace(key); key == "" {
+				continue
+			}
+			if compiled.keys == nil {
+				compiled.keys = make(map[string]struct{}, len(r.APIKeys))
+			}
+			compiled.keys[key] = struct{}{}
+		}
+		for _, format := range r.Formats {
+			if format = strings.ToLower(strings.TrimSpace(format)); format == "" {
+				continue
+			}
+			if compiled.formats == nil {
+				compiled.formats = make(map[string]struct{}, len(r.Formats))
+			}
+			compiled.formats[format] = struct{}{}
+		}
+		out.rules = append(out.rules, compiled)
+	}
+	return out
+}
+
+// SetRules replaces the active rule set.
+func SetRules(rules []config.RequestTransform) {
+	if len(rules) == 0 {
+		active.Store(nil)
+		return
+	}
+	active.Store(Compile(rules))
+}
+
+// Active returns the active transformer or nil when no rules are configured.
+func Active() *Transformer {
+	t := active.Load()
+	if t == nil || len(t.rules) == 0 {
+		return nil
+	}
+	return t
+}
+
+// Transform applies the rules in scope of apiKey to body, a request in the given
+// inbound format for model. Rules scoped to other keys are not reported; rules in
+// scope that do not select the format or model, or that fail, are reported as skipped.
+func (t *Transformer) Transform(apiKey, format, model string, body []byte) ([]byte, []Outcome) {
+	if t == nil || len(body) == 0 {
+		return body, nil
+	}
+	apiKey = strings.TrimSpace(apiKey)
+	format = strings.ToLower(strings.TrimSpace(format))
+	var outcomes []Outcome
+	for i := range t.rules {
+		r := &t.rules[i]
+		if r.keys != nil {
+			if _, ok := r.keys[apiKey]; !ok {
+				continue
+			}
+		}
+		outcome := Outcome{Rule: r.name}
+		updated, err := r.apply(format, model, body)
+		if err != nil {
+			outcome.Reason = err.Error()
+		} else {
+			outcome.Applied = true
+			body = updated
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return body, outcomes
+}
+
+func (r *rule) apply(format, model string, body []byte) ([]byte, error) {
+	if r.formats != nil {
+		if _, ok := r.formats[format]; !ok {
+			return nil, fmt.Errorf("format %s not selected", format)
+		}
+	}
+	if len(r.cfg.Models) > 0 && !matchesAny(r.cfg.Models, model) {
+		return nil, fmt.Errorf("model %s not selected", model)
+	}
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("body is not valid JSON")
+	}
+	out := bytes.Clone(body)
+	var err error
+	if r.template != nil {
+		if out, err = r.render(format, model, out); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range r.cfg.Delete {
+		if out, err = sjson.DeleteBytes(out, path); err != nil {
+			return nil, fmt.Errorf("delete %s: %w", path, err)
+		}
+	}
+	for path, value := range r.cfg.Default {
+		if gjson.GetBytes(out, path).Exists() {
+			continue
+		}
+		if out, err = sjson.SetBytes(out, path, value); err != nil {
+			return nil, fmt.Errorf("default %s: %w", path, err)
+		}
+	}
+	for path, value := range r.cfg.Set {
+		if out, err = sjson.SetBytes(out, path, value); err != nil {
+			return nil, fmt.Errorf("set %s: %w", path, err)
+		}
+	}
+	for path, limit := range r.cfg.Max {
+		current := gjson.GetBytes(out, path)
+		if current.Type != gjson.Number || current.Float() <= limit {
+			continue
+		}
+		var value any = limit
+		if limit == math.Trunc(limit) {
+			value = int64(limit)
+		}
+		if out, err = sjson.SetBytes(out, path, value); err != nil {
+			return nil, fmt.Errorf("max %s: %w", path, err)
+		}
+	}
+	if prompt := strings.TrimSpace(r.cfg.SystemPrompt); prompt != "" {
+		if out, err = setSystemPrompt(out, format, prompt); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// render executes the rule template against body and returns the rendered body.
+func (r *rule) render(format, model string, body []byte) ([]byte, error) {
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	tmpl, err := r.template.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	tmpl.Funcs(template.FuncMap{
+		"get": func(path string) any { return gjson.GetBytes(body, path).Value() },
+		"raw": func(path string) string {
+			if v := gjson.GetBytes(body, path); v.Exists() {
+				return v.Raw
+			}
+			return "null"
+		},
+	})
+	var buf bytes.Buffer
+	data := map[string]any{"Body": decoded, "Raw": string(body), "Model": model, "Format": format}
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	out := bytes.TrimSpace(buf.Bytes())
+	if !gjson.ValidBytes(out) || !gjson.ParseBytes(out).IsObject() {
+		return nil, fmt.Errorf("template did not render a JSON object")
+	}
+	return out, nil
+}
+
+// setSystemPrompt replaces the system prompt of body in the given inbound format.
+func setSystemPrompt(body []byte, format, prompt string) ([]byte, error) {
+	switch format {
+	case constant.OpenAI:
+		messages := []string{mustJSON(map[string]string{"role": "system", "content": prompt})}
+		gjson.GetBytes(body, "messages").ForEach(func(_, msg gjson.Result) bool {
+			if role := msg.Get("role").String(); role != "system" && role != "developer" {
+				messages = append(messages, msg.Raw)
+			}
+			return true
+		})
+		return sjson.SetRawBytes(body, "messages", []byte("["+strings.Join(messages, ",")+"]"))
+	case constant.OpenaiResponse:
+		out, err := sjson.SetBytes(body, "instructions", prompt)
+		if err != nil {
+			return nil, err
+		}
+		if input := gjson.GetBytes(out, "input"); input.IsArray() {
+			kept := make([]string, 0, len(input.Array()))
+			input.ForEach(func(_, item gjson.Result) bool {
+				if role := item.Get("role").String(); role != "system" && role != "developer" {
+					kept = append(kept, item.Raw)
+				}
+				return true
+			})
+			return sjson.SetRawBytes(out, "input", []byte("["+strings.Join(kept, ",")+"]"))
+		}
+		return out, nil
+	case constant.Claude:
+		return sjson.SetBytes(body, "system", prompt)
+	case constant.Gemini, constant.GeminiCLI:
+		root := ""
+		if format == constant.GeminiCLI {
+			root = "request."
+		}
+		out, err := sjson.DeleteBytes(body, root+"system_instruction")
+		if err != nil {
+			return nil, err
+		}
+		return sjson.SetRawBytes(out, root+"systemInstruction", []byte(`{"parts":[`+mustJSON(map[string]string{"text": prompt})+`]}`))
+	default:
+		return nil, fmt.Errorf("system-prompt is not supported for format %s", format)
+	}
+}
+
+func mustJSON(v any) string {
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+func matchesAny(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		if config.MatchModelPattern(pattern, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply transforms body, a request in the given inbound format for model, with the
+// active rules and the client key carried by ctx. The outcome is stored in the Gin
+// context for the request log.
+func Apply(ctx context.Context, format, model string, body []byte) []byte {
+	t := Active()
+	if t == nil {
+		return body
+	}
+	var ginCtx *gin.Context
+	if ctx != nil {
+		ginCtx, _ = ctx.Value("gin").(*gin.Context)
+	}
+	apiKey := ""
+	if ginCtx != nil {
+		apiKey = ginCtx.GetString("apiKey")
+	}
+	out, outcomes := t.Transform(apiKey, format, model, body)
+	if len(outcomes) == 0 {
+		return body
+	}
+	for _, o := range outcomes {
+		if o.Applied {
+			log.Debugf("requesttransform: applied %s", o.Rule)
+		} else {
+			log.Debugf("requesttransform: skipped %s: %s", o.Rule, o.Reason)
+		}
+	}
+	if ginCtx != nil {
+		ginCtx.Set(GinLogKey, []byte(LogSection(outcomes, out)))
+	}
+	return out
+}
+
+// LogSection formats outcomes, and the transformed body when a rule applied, as a
+// request log section.
+func LogSection(outcomes []Outcome, body []byte) string {
+	var applied, skipped []string
+	for _, o := range outcomes {
+		if o.Applied {
+			applied = append(applied, o.Rule)
+		} else {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", o.Rule, o.Reason))
+		}
+	}
+	var b strings.Builder
+	b.WriteString("=== API REQUEST TRANSFORM ===\n")
+	if len(applied) > 0 {
+		fmt.Fprintf(&b, "Applied: %s\n", strings.Join(applied, ", "))
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&b, "Skipped: %s\n", strings.Join(skipped, ", "))
+	}
+	if len(applied) > 0 {
+		b.WriteString("\nBody:\n")
+		b.Write(body)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
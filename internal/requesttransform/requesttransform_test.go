@@ -0,0 +1,91 @@
+package requesttransform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+func TestTransform(t *testing.T) {
+	tr := Compile([]config.RequestTransform{
+		{
+			Name:         "team-a",
+			APIKeys:      []string{"key-a"},
+			Delete:       []string{"logit_bias"},
+			Default:      map[string]any{"temperature": 0.2},
+			Max:          map[string]float64{"max_tokens": 1024},
+			SystemPrompt: "Be brief.",
+		},
+		{Name: "claude-only", Formats: []string{"claude"}, Set: map[string]any{"metadata.user_id": "proxy"}},
+		{Name: "other-key", APIKeys: []string{"key-b"}, Set: map[string]any{"model": "x"}},
+	})
+	body := []byte(`{"model":"gpt-4o","max_tokens":4096,"logit_bias":{"1":2},"messages":[{"role":"system","content":"Be verbose."},{"role":"user","content":"hi"}]}`)
+
+	out, outcomes := tr.Transform("key-a", "openai", "gpt-4o", body)
+	if len(outcomes) != 2 || !outcomes[0].Applied || outcomes[1].Applied || !strings.Contains(outcomes[1].Reason, "format") {
+		t.Fatalf("unexpected outcomes: %+v", outcomes)
+	}
+	if gjson.GetBytes(out, "max_tokens").Int() != 1024 || gjson.GetBytes(out, "logit_bias").Exists() || gjson.GetBytes(out, "temperature").Float() != 0.2 {
+		t.Fatalf("unexpected body: %s", out)
+	}
+	messages := gjson.GetBytes(out, "messages").Array()
+	if len(messages) != 2 || messages[0].Get("content").String() != "Be brief." || messages[1].Get("role").String() != "user" {
+		t.Fatalf("expected the system prompt to be replaced, got %s", out)
+	}
+
+	section := LogSection(outcomes, out)
+	if !strings.HasPrefix(section, "=== API REQUEST TRANSFORM ===") || !strings.Contains(section, "Applied: team-a") || !strings.Contains(section, "Skipped: claude-only (format openai not selected)") {
+		t.Fatalf("unexpected log section: %q", section)
+	}
+
+	if _, outcomes = tr.Transform("key-c", "openai", "gpt-4o", body); len(outcomes) != 1 || outcomes[0].Rule != "claude-only" {
+		t.Fatalf("expected only the unscoped rule to be in scope, got %+v", outcomes)
+	}
+}
+
+func TestTransformTemplate(t *testing.T) {
+	tr := Compile([]config.RequestTransform{
+		{Name: "wrap", Template: `{"model":{{ json .Model }},"messages":{{ raw "messages" }},"user":{{ json (get "user") }}}`},
+		{Name: "broken", Template: `not json`},
+	})
+	body := []byte(`{"model":"a","messages":[{"role":"user","content":"hi"}],"user":"u1","stream_options":{}}`)
+	out, outcomes := tr.Transform("", "openai", "gpt-4o", body)
+	if len(outcomes) != 2 || !outcomes[0].Applied || outcomes[1].Applied {
+		t.Fatalf("unexpected outcomes: %+v", outcomes)
+	}
+	if gjson.GetBytes(out, "model").String() != "gpt-4o" || gjson.GetBytes(out, "user").String() != "u1" || gjson.GetBytes(out, "stream_options").Exists() {
+		t.Fatalf("unexpected rendered body: %s", out)
+	}
+	if gjson.GetBytes(out, "messages.0.content").String() != "hi" {
+		t.Fatalf("expected messages to be kept, got %s", out)
+	}
+}
+
+func TestSetSystemPromptFormats(t *testing.T) {
+	cases := []struct {
+		format, body, path, want string
+	}{
+		{"claude", `{"system":[{"type":"text","text":"old"}],"messages":[]}`, "system", "new"},
+		{"openai-response", `{"instructions":"old","input":[{"role":"developer","content":"x"},{"role":"user","content":"hi"}]}`, "instructions", "new"},
+		{"gemini", `{"system_instruction":{"parts":[{"text":"old"}]},"contents":[]}`, "systemInstruction.parts.0.text", "new"},
+		{"gemini-cli", `{"request":{"contents":[]}}`, "request.systemInstruction.parts.0.text", "new"},
+	}
+	for _, tc := range cases {
+		out, err := setSystemPrompt([]byte(tc.body), tc.format, "new")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.format, err)
+		}
+		if got := gjson.GetBytes(out, tc.path).String(); got != tc.want {
+			t.Fatalf("%s: expected %q at %s, got %s", tc.format, tc.want, tc.path, out)
+		}
+	}
+	out, _ := setSystemPrompt([]byte(`{"input":[{"role":"developer","content":"x"},{"role":"user","content":"hi"}]}`), "openai-response", "new")
+	if n := len(gjson.GetBytes(out, "input").Array()); n != 1 {
+		t.Fatalf("expected developer input to be dropped, got %s", out)
+	}
+	if _, err := setSystemPrompt([]byte(`{}`), "codex", "new"); err == nil {
+		t.Fatal("expected unsupported format to fail")
+	}
+}
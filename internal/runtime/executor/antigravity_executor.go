@@ -93,12 +93,13 @@ func (e *AntigravityExecutor) Execute(ctx context.Context, auth *cliproxyauth.Au
 	translated = util.ApplyGemini3ThinkingLevelFromMetadataCLI(req.Model, req.Metadata, translated)
 	translated = util.ApplyDefaultThinkingIfNeededCLI(req.Model, translated)
 	translated = normalizeAntigravityThinking(req.Model, translated)
-	translated = applyPayloadConfigWithRoot(e.cfg, req.Model, "antigravity", "request", translated)
+	translated = applyPayloadConfigWithRoot(ctx, e.cfg, e.Identifier(), req.Model, "antigravity", "request", translated)
 
 	baseURLs := antigravityBaseURLFallbackOrder(auth)
 	httpClient := newProxyAwareHTTPClient(ctx, e.cfg, auth, 0)
 
 	var lastStatus int
+	var lastRetryAfter *time.Duration
 	var lastBody []byte
 	var lastErr error
 
@@ -138,6 +139,7 @@ func (e *AntigravityExecutor) Execute(ctx context.Context, auth *cliproxyauth.Au
 		if httpResp.StatusCode < http.StatusOK || httpResp.StatusCode >= http.StatusMultipleChoices {
 			log.Debugf("antigravity executor: upstream error status: %d, body: %s", httpResp.StatusCode, summarizeErrorBody(httpResp.Header.Get("Content-Type"), bodyBytes))
 			lastStatus = httpResp.StatusCode
+			lastRetryAfter = parseRetryAfterHeader(httpResp.Header.Get("Retry-After"))
 			lastBody = append([]byte(nil), bodyBytes...)
 			lastErr = nil
 			if httpResp.StatusCode == http.StatusTooManyRequests && idx+1 < len(baseURLs) {
@@ -149,7 +151,7 @@ func (e *AntigravityExecutor) Execute(ctx context.Context, auth *cliproxyauth.Au
 				}
 				continue
 			}
-			err = statusErr{code: httpResp.StatusCode, msg: string(bodyBytes)}
+			err = newStatusErr(httpResp, bodyBytes)
 			return resp, err
 		}
 
@@ -163,7 +165,7 @@ func (e *AntigravityExecutor) Execute(ctx context.Context, auth *cliproxyauth.Au
 
 	switch {
 	case lastStatus != 0:
-		err = statusErr{code: lastStatus, msg: string(lastBody)}
+		err = statusErr{code: lastStatus, msg: string(lastBody), retryAfter: lastRetryAfter}
 	case lastErr != nil:
 		err = lastErr
 	default:
@@ -193,12 +195,13 @@ func (e *AntigravityExecutor) executeClaudeNonStream(ctx context.Context, auth *
 	translated = util.ApplyGemini3ThinkingLevelFromMetadataCLI(req.Model, req.Metadata, translated)
 	translated = util.ApplyDefaultThinkingIfNeededCLI(req.Model, translated)
 	translated = normalizeAntigravityThinking(req.Model, translated)
-	translated = applyPayloadConfigWithRoot(e.cfg, req.Model, "antigravity", "request", translated)
+	translated = applyPayloadConfigWithRoot(ctx, e.cfg, e.Identifier(), req.Model, "antigravity", "request", translated)
 
 	baseURLs := antigravityBaseURLFallbackOrder(auth)
 	httpClient := newProxyAwareHTTPClient(ctx, e.cfg, auth, 0)
 
 	var lastStatus int
+	var lastRetryAfter *time.Duration
 	var lastBody []byte
 	var lastErr error
 
@@ -242,13 +245,14 @@ func (e *AntigravityExecutor) executeClaudeNonStream(ctx context.Context, auth *
 			}
 			appendAPIResponseChunk(ctx, e.cfg, bodyBytes)
 			lastStatus = httpResp.StatusCode
+			lastRetryAfter = parseRetryAfterHeader(httpResp.Header.Get("Retry-After"))
 			lastBody = append([]byte(nil), bodyBytes...)
 			lastErr = nil
 			if httpResp.StatusCode == http.StatusTooManyRequests && idx+1 < len(baseURLs) {
 				log.Debugf("antigravity executor: rate limited on base url %s, retrying with fallback base url: %s", baseURL, baseURLs[idx+1])
 				continue
 			}
-			err = statusErr{code: httpResp.StatusCode, msg: string(bodyBytes)}
+			err = newStatusErr(httpResp, bodyBytes)
 			return resp, err
 		}
 
@@ -275,6 +279,7 @@ func (e *AntigravityExecutor) executeClaudeNonStream(ctx context.Context, auth *
 					continue
 				}
 
+				reporter.observeChunk(payload)
 				if detail, ok := parseAntigravityStreamUsage(payload); ok {
 					reporter.publish(ctx, detail)
 				}
@@ -283,7 +288,7 @@ func (e *AntigravityExecutor) executeClaudeNonStream(ctx context.Context, auth *
 			}
 			if errScan := scanner.Err(); errScan != nil {
 				recordAPIResponseError(ctx, e.cfg, errScan)
-				reporter.publishFailure(ctx)
+				reporter.publishFailure(ctx, errScan)
 				out <- cliproxyexecutor.StreamChunk{Err: errScan}
 			} else {
 				reporter.ensurePublished(ctx)
@@ -313,7 +318,7 @@ func (e *AntigravityExecutor) executeClaudeNonStream(ctx context.Context, auth *
 
 	switch {
 	case lastStatus != 0:
-		err = statusErr{code: lastStatus, msg: string(lastBody)}
+		err = statusErr{code: lastStatus, msg: string(lastBody), retryAfter: lastRetryAfter}
 	case lastErr != nil:
 		err = lastErr
 	default:
@@ -527,12 +532,13 @@ func (e *AntigravityExecutor) ExecuteStream(ctx context.Context, auth *cliproxya
 	translated = util.ApplyGemini3ThinkingLevelFromMetadataCLI(req.Model, req.Metadata, translated)
 	translated = util.ApplyDefaultThinkingIfNeededCLI(req.Model, translated)
 	translated = normalizeAntigravityThinking(req.Model, translated)
-	translated = applyPayloadConfigWithRoot(e.cfg, req.Model, "antigravity", "request", translated)
+	translated = applyPayloadConfigWithRoot(ctx, e.cfg, e.Identifier(), req.Model, "antigravity", "request", translated)
 
 	baseURLs := antigravityBaseURLFallbackOrder(auth)
 	httpClient := newProxyAwareHTTPClient(ctx, e.cfg, auth, 0)
 
 	var lastStatus int
+	var lastRetryAfter *time.Duration
 	var lastBody []byte
 	var lastErr error
 
@@ -576,6 +582,7 @@ func (e *AntigravityExecutor) ExecuteStream(ctx context.Context, auth *cliproxya
 			}
 			appendAPIResponseChunk(ctx, e.cfg, bodyBytes)
 			lastStatus = httpResp.StatusCode
+			lastRetryAfter = parseRetryAfterHeader(httpResp.Header.Get("Retry-After"))
 			lastBody = append([]byte(nil), bodyBytes...)
 			lastErr = nil
 			if httpResp.StatusCode == http.StatusTooManyRequests && idx+1 < len(baseURLs) {
@@ -587,7 +594,7 @@ func (e *AntigravityExecutor) ExecuteStream(ctx context.Context, auth *cliproxya
 				}
 				continue
 			}
-			err = statusErr{code: httpResp.StatusCode, msg: string(bodyBytes)}
+			err = newStatusErr(httpResp, bodyBytes)
 			return nil, err
 		}
 
@@ -617,6 +624,7 @@ func (e *AntigravityExecutor) ExecuteStream(ctx context.Context, auth *cliproxya
 					continue
 				}
 
+				reporter.observeChunk(payload)
 				if detail, ok := parseAntigravityStreamUsage(payload); ok {
 					reporter.publish(ctx, detail)
 				}
@@ -632,7 +640,7 @@ func (e *AntigravityExecutor) ExecuteStream(ctx context.Context, auth *cliproxya
 			}
 			if errScan := scanner.Err(); errScan != nil {
 				recordAPIResponseError(ctx, e.cfg, errScan)
-				reporter.publishFailure(ctx)
+				reporter.publishFailure(ctx, errScan)
 				out <- cliproxyexecutor.StreamChunk{Err: errScan}
 			} else {
 				reporter.ensurePublished(ctx)
@@ -643,7 +651,7 @@ func (e *AntigravityExecutor) ExecuteStream(ctx context.Context, auth *cliproxya
 
 	switch {
 	case lastStatus != 0:
-		err = statusErr{code: lastStatus, msg: string(lastBody)}
+		err = statusErr{code: lastStatus, msg: string(lastBody), retryAfter: lastRetryAfter}
 	case lastErr != nil:
 		err = lastErr
 	default:
@@ -692,6 +700,7 @@ func (e *AntigravityExecutor) CountTokens(ctx context.Context, auth *cliproxyaut
 	}
 
 	var lastStatus int
+	var lastRetryAfter *time.Duration
 	var lastBody []byte
 	var lastErr error
 
@@ -772,18 +781,19 @@ func (e *AntigravityExecutor) CountTokens(ctx context.Context, auth *cliproxyaut
 		}
 
 		lastStatus = httpResp.StatusCode
+		lastRetryAfter = parseRetryAfterHeader(httpResp.Header.Get("Retry-After"))
 		lastBody = append([]byte(nil), bodyBytes...)
 		lastErr = nil
 		if httpResp.StatusCode == http.StatusTooManyRequests && idx+1 < len(baseURLs) {
 			log.Debugf("antigravity executor: rate limited on base url %s, retrying with fallback base url: %s", baseURL, baseURLs[idx+1])
 			continue
 		}
-		return cliproxyexecutor.Response{}, statusErr{code: httpResp.StatusCode, msg: string(bodyBytes)}
+		return cliproxyexecutor.Response{}, newStatusErr(httpResp, bodyBytes)
 	}
 
 	switch {
 	case lastStatus != 0:
-		return cliproxyexecutor.Response{}, statusErr{code: lastStatus, msg: string(lastBody)}
+		return cliproxyexecutor.Response{}, statusErr{code: lastStatus, msg: string(lastBody), retryAfter: lastRetryAfter}
 	case lastErr != nil:
 		return cliproxyexecutor.Response{}, lastErr
 	default:
@@ -951,7 +961,7 @@ func (e *AntigravityExecutor) refreshToken(ctx context.Context, auth *cliproxyau
 	}
 
 	if httpResp.StatusCode < http.StatusOK || httpResp.StatusCode >= http.StatusMultipleChoices {
-		return auth, statusErr{code: httpResp.StatusCode, msg: string(bodyBytes)}
+		return auth, newStatusErr(httpResp, bodyBytes)
 	}
 
 	var tokenResp struct {
@@ -69,10 +69,12 @@ func (e *ClaudeExecutor) Execute(ctx context.Context, auth *cliproxyauth.Auth, r
 	// Inject thinking config based on model metadata for thinking variants
 	body = e.injectThinkingConfig(req.Model, req.Metadata, body)
 
+	// Payload rules run first so configured system prompts follow the Claude Code identity block.
+	body = applyPayloadConfig(ctx, e.cfg, e.Identifier(), req.Model, body)
 	if !strings.HasPrefix(upstreamModel, "claude-3-5-haiku") {
 		body = checkSystemInstructions(body)
 	}
-	body = applyPayloadConfig(e.cfg, req.Model, body)
+	body = injectPromptCacheControl(e.cfg, body)
 
 	// Ensure max_tokens > thinking.budget_tokens when thinking is enabled
 	body = ensureMaxTokensForThinking(req.Model, body)
@@ -116,7 +118,7 @@ func (e *ClaudeExecutor) Execute(ctx context.Context, auth *cliproxyauth.Auth, r
 		b, _ := io.ReadAll(httpResp.Body)
 		appendAPIResponseChunk(ctx, e.cfg, b)
 		log.Debugf("request error, error status: %d, error body: %s", httpResp.StatusCode, summarizeErrorBody(httpResp.Header.Get("Content-Type"), b))
-		err = statusErr{code: httpResp.StatusCode, msg: string(b)}
+		err = newStatusErr(httpResp, b)
 		if errClose := httpResp.Body.Close(); errClose != nil {
 			log.Errorf("response body close error: %v", errClose)
 		}
@@ -144,6 +146,7 @@ func (e *ClaudeExecutor) Execute(ctx context.Context, auth *cliproxyauth.Auth, r
 	if stream {
 		lines := bytes.Split(data, []byte("\n"))
 		for _, line := range lines {
+			reporter.observeChunk(line)
 			if detail, ok := parseClaudeStreamUsage(line); ok {
 				reporter.publish(ctx, detail)
 			}
@@ -182,8 +185,9 @@ func (e *ClaudeExecutor) ExecuteStream(ctx context.Context, auth *cliproxyauth.A
 	body, _ = sjson.SetBytes(body, "model", upstreamModel)
 	// Inject thinking config based on model metadata for thinking variants
 	body = e.injectThinkingConfig(req.Model, req.Metadata, body)
+	body = applyPayloadConfig(ctx, e.cfg, e.Identifier(), req.Model, body)
 	body = checkSystemInstructions(body)
-	body = applyPayloadConfig(e.cfg, req.Model, body)
+	body = injectPromptCacheControl(e.cfg, body)
 
 	// Ensure max_tokens > thinking.budget_tokens when thinking is enabled
 	body = ensureMaxTokensForThinking(req.Model, body)
@@ -230,7 +234,7 @@ func (e *ClaudeExecutor) ExecuteStream(ctx context.Context, auth *cliproxyauth.A
 		if errClose := httpResp.Body.Close(); errClose != nil {
 			log.Errorf("response body close error: %v", errClose)
 		}
-		err = statusErr{code: httpResp.StatusCode, msg: string(b)}
+		err = newStatusErr(httpResp, b)
 		return nil, err
 	}
 	decodedBody, err := decodeResponseBody(httpResp.Body, httpResp.Header.Get("Content-Encoding"))
@@ -259,6 +263,7 @@ func (e *ClaudeExecutor) ExecuteStream(ctx context.Context, auth *cliproxyauth.A
 			for scanner.Scan() {
 				line := scanner.Bytes()
 				appendAPIResponseChunk(ctx, e.cfg, line)
+				reporter.observeChunk(line)
 				if detail, ok := parseClaudeStreamUsage(line); ok {
 					reporter.publish(ctx, detail)
 				}
@@ -270,7 +275,7 @@ func (e *ClaudeExecutor) ExecuteStream(ctx context.Context, auth *cliproxyauth.A
 			}
 			if errScan := scanner.Err(); errScan != nil {
 				recordAPIResponseError(ctx, e.cfg, errScan)
-				reporter.publishFailure(ctx)
+				reporter.publishFailure(ctx, errScan)
 				out <- cliproxyexecutor.StreamChunk{Err: errScan}
 			}
 			return
@@ -283,6 +288,7 @@ func (e *ClaudeExecutor) ExecuteStream(ctx context.Context, auth *cliproxyauth.A
 		for scanner.Scan() {
 			line := scanner.Bytes()
 			appendAPIResponseChunk(ctx, e.cfg, line)
+			reporter.observeChunk(line)
 			if detail, ok := parseClaudeStreamUsage(line); ok {
 				reporter.publish(ctx, detail)
 			}
@@ -293,7 +299,7 @@ func (e *ClaudeExecutor) ExecuteStream(ctx context.Context, auth *cliproxyauth.A
 		}
 		if errScan := scanner.Err(); errScan != nil {
 			recordAPIResponseError(ctx, e.cfg, errScan)
-			reporter.publishFailure(ctx)
+			reporter.publishFailure(ctx, errScan)
 			out <- cliproxyexecutor.StreamChunk{Err: errScan}
 		}
 	}()
@@ -370,7 +376,7 @@ func (e *ClaudeExecutor) CountTokens(ctx context.Context, auth *cliproxyauth.Aut
 		if errClose := resp.Body.Close(); errClose != nil {
 			log.Errorf("response body close error: %v", errClose)
 		}
-		return cliproxyexecutor.Response{}, statusErr{code: resp.StatusCode, msg: string(b)}
+		return cliproxyexecutor.Response{}, newStatusErr(resp, b)
 	}
 	decodedBody, err := decodeResponseBody(resp.Body, resp.Header.Get("Content-Encoding"))
 	if err != nil {
@@ -550,6 +556,9 @@ func (e *ClaudeExecutor) resolveClaudeConfig(auth *cliproxyauth.Auth) *config.Cl
 	var attrKey, attrBase string
 	if auth.Attributes != nil {
 		attrKey = strings.TrimSpace(auth.Attributes["api_key"])
+		if ref := strings.TrimSpace(auth.Attributes["api_key_ref"]); ref != "" {
+			attrKey = ref
+		}
 		attrBase = strings.TrimSpace(auth.Attributes["base_url"])
 	}
 	for i := range e.cfg.ClaudeKey {
@@ -756,3 +765,49 @@ func checkSystemInstructions(payload []byte) []byte {
 	}
 	return payload
 }
+
+// injectPromptCacheControl adds ephemeral cache_control breakpoints to the last tool
+// definition, the last system block and the latest user turn when
+// prompt-caching.auto-inject is enabled. Requests that already set cache_control
+// anywhere are left alone, as are prompts too short to be cached.
+func injectPromptCacheControl(cfg *config.Config, payload []byte) []byte {
+	if cfg == nil || !cfg.PromptCaching.AutoInject || bytes.Contains(payload, []byte(`"cache_control"`)) {
+		return payload
+	}
+	root := gjson.ParseBytes(payload)
+	tools, system, messages := root.Get("tools"), root.Get("system"), root.Get("messages")
+	if len(tools.Raw)+len(system.Raw)+len(messages.Raw) < cfg.PromptCaching.MinChars() {
+		return payload
+	}
+	ephemeral := []byte(`{"type":"ephemeral"}`)
+	if n := len(tools.Array()); n > 0 {
+		payload, _ = sjson.SetRawBytes(payload, fmt.Sprintf("tools.%d.cache_control", n-1), ephemeral)
+	}
+	if system.IsArray() {
+		if n := len(system.Array()); n > 0 {
+			payload, _ = sjson.SetRawBytes(payload, fmt.Sprintf("system.%d.cache_control", n-1), ephemeral)
+		}
+	}
+	turns := messages.Array()
+	for i := len(turns) - 1; i >= 0; i-- {
+		if turns[i].Get("role").String() != "user" {
+			continue
+		}
+		content := turns[i].Get("content")
+		if content.Type == gjson.String {
+			if content.String() == "" {
+				break
+			}
+			block, _ := sjson.Set(`{"type":"text"}`, "text", content.String())
+			payload, _ = sjson.SetRawBytes(payload, fmt.Sprintf("messages.%d.content", i), []byte("["+block+"]"))
+			payload, _ = sjson.SetRawBytes(payload, fmt.Sprintf("messages.%d.content.0.cache_control", i), ephemeral)
+		} else if blocks := content.Array(); len(blocks) > 0 {
+			last := blocks[len(blocks)-1]
+			if last.Get("type").String() != "text" || last.Get("text").String() != "" {
+				payload, _ = sjson.SetRawBytes(payload, fmt.Sprintf("messages.%d.content.%d.cache_control", i, len(blocks)-1), ephemeral)
+			}
+		}
+		break
+	}
+	return payload
+}
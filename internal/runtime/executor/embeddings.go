@@ -0,0 +1,172 @@
+package executor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	cliproxyauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// embeddingInputs extracts the text inputs of an OpenAI embeddings request. Token-array
+// inputs cannot be translated to Google's APIs and are rejected.
+func embeddingInputs(payload []byte) ([]string, error) {
+	input := gjson.GetBytes(payload, "input")
+	switch {
+	case input.Type == gjson.String:
+		return []string{input.String()}, nil
+	case input.IsArray():
+		items := input.Array()
+		if len(items) == 0 {
+			return nil, statusErr{code: http.StatusBadRequest, msg: "input must not be empty"}
+		}
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			if item.Type != gjson.String {
+				return nil, statusErr{code: http.StatusBadRequest, msg: "input must be a string or an array of strings for this provider"}
+			}
+			out = append(out, item.String())
+		}
+		return out, nil
+	default:
+		return nil, statusErr{code: http.StatusBadRequest, msg: "input must be a string or an array of strings"}
+	}
+}
+
+// geminiEmbedRequest builds a Gemini batchEmbedContents body for the given inputs.
+func geminiEmbedRequest(model string, inputs []string, dimensions int64) []byte {
+	body := []byte(`{"requests":[]}`)
+	for _, text := range inputs {
+		item := []byte(`{}`)
+		item, _ = sjson.SetBytes(item, "model", "models/"+model)
+		item, _ = sjson.SetBytes(item, "content.parts.0.text", text)
+		if dimensions > 0 {
+			item, _ = sjson.SetBytes(item, "outputDimensionality", dimensions)
+		}
+		body, _ = sjson.SetRawBytes(body, "requests.-1", item)
+	}
+	return body
+}
+
+// vertexEmbedRequest builds a Vertex AI :predict body for text embedding models.
+func vertexEmbedRequest(inputs []string, dimensions int64) []byte {
+	body := []byte(`{"instances":[]}`)
+	for _, text := range inputs {
+		item, _ := sjson.SetBytes([]byte(`{}`), "content", text)
+		body, _ = sjson.SetRawBytes(body, "instances.-1", item)
+	}
+	if dimensions > 0 {
+		body, _ = sjson.SetBytes(body, "parameters.outputDimensionality", dimensions)
+	}
+	return body
+}
+
+// openAIEmbeddingsResponse renders embedding vectors in the OpenAI /v1/embeddings shape.
+// Each vector is the raw JSON array of floats returned upstream; with base64 encoding
+// it is re-encoded as little-endian float32 values, as OpenAI does.
+func openAIEmbeddingsResponse(model, encodingFormat string, vectors []gjson.Result, promptTokens int64) []byte {
+	out := []byte(`{"object":"list","data":[]}`)
+	for i, vector := range vectors {
+		item := []byte(`{"object":"embedding"}`)
+		item, _ = sjson.SetBytes(item, "index", i)
+		if strings.EqualFold(encodingFormat, "base64") {
+			values := vector.Array()
+			buf := make([]byte, 4*len(values))
+			for j, v := range values {
+				binary.LittleEndian.PutUint32(buf[4*j:], math.Float32bits(float32(v.Float())))
+			}
+			item, _ = sjson.SetBytes(item, "embedding", base64.StdEncoding.EncodeToString(buf))
+		} else {
+			raw := vector.Raw
+			if raw == "" {
+				raw = "[]"
+			}
+			item, _ = sjson.SetRawBytes(item, "embedding", []byte(raw))
+		}
+		out, _ = sjson.SetRawBytes(out, "data.-1", item)
+	}
+	out, _ = sjson.SetBytes(out, "model", model)
+	out, _ = sjson.SetBytes(out, "usage.prompt_tokens", promptTokens)
+	out, _ = sjson.SetBytes(out, "usage.total_tokens", promptTokens)
+	return out
+}
+
+// estimateEmbeddingTokens approximates the prompt tokens of inputs for providers that
+// do not report usage for embeddings.
+func estimateEmbeddingTokens(model string, inputs []string) int64 {
+	enc, err := tokenizerForModel(model)
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, text := range inputs {
+		count, errCount := enc.Count(text)
+		if errCount != nil {
+			return 0
+		}
+		total += int64(count)
+	}
+	return total
+}
+
+// embeddingUsage reports embedding prompt tokens; embeddings produce no output tokens.
+func embeddingUsage(promptTokens int64) usage.Detail {
+	return usage.Detail{InputTokens: promptTokens, TotalTokens: promptTokens}
+}
+
+// doEmbeddingRequest sends a prepared embeddings request upstream and returns the
+// response body, recording the exchange in the request log.
+func doEmbeddingRequest(ctx context.Context, cfg *config.Config, auth *cliproxyauth.Auth, provider string, httpReq *http.Request, body []byte) ([]byte, http.Header, error) {
+	var authID, authLabel, authType, authValue string
+	if auth != nil {
+		authID = auth.ID
+		authLabel = auth.Label
+		authType, authValue = auth.AccountInfo()
+	}
+	recordAPIRequest(ctx, cfg, upstreamRequestLog{
+		URL:       httpReq.URL.String(),
+		Method:    http.MethodPost,
+		Headers:   httpReq.Header.Clone(),
+		Body:      body,
+		Provider:  provider,
+		AuthID:    authID,
+		AuthLabel: authLabel,
+		AuthType:  authType,
+		AuthValue: authValue,
+	})
+
+	httpClient := newProxyAwareHTTPClient(ctx, cfg, auth, 0)
+	httpResp, err := httpClient.Do(httpReq)
+	if err != nil {
+		recordAPIResponseError(ctx, cfg, err)
+		return nil, nil, err
+	}
+	defer func() {
+		if errClose := httpResp.Body.Close(); errClose != nil {
+			log.Errorf("%s executor: close response body error: %v", provider, errClose)
+		}
+	}()
+	recordAPIResponseMetadata(ctx, cfg, httpResp.StatusCode, httpResp.Header.Clone())
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		b, _ := io.ReadAll(httpResp.Body)
+		appendAPIResponseChunk(ctx, cfg, b)
+		log.Debugf("request error, error status: %d, error body: %s", httpResp.StatusCode, summarizeErrorBody(httpResp.Header.Get("Content-Type"), b))
+		return nil, nil, newStatusErr(httpResp, b)
+	}
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		recordAPIResponseError(ctx, cfg, err)
+		return nil, nil, err
+	}
+	appendAPIResponseChunk(ctx, cfg, data)
+	return data, httpResp.Header.Clone(), nil
+}
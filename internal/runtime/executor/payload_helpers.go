@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -83,16 +84,16 @@ func ApplyReasoningEffortMetadata(payload []byte, metadata map[string]any, model
 }
 
 // applyPayloadConfig applies payload default and override rules from configuration
-// to the given JSON payload for the specified model.
+// to the given JSON payload for the specified provider, model and client key.
 // Defaults only fill missing fields, while overrides always overwrite existing values.
-func applyPayloadConfig(cfg *config.Config, model string, payload []byte) []byte {
-	return applyPayloadConfigWithRoot(cfg, model, "", "", payload)
+func applyPayloadConfig(ctx context.Context, cfg *config.Config, provider, model string, payload []byte) []byte {
+	return applyPayloadConfigWithRoot(ctx, cfg, provider, model, "", "", payload)
 }
 
 // applyPayloadConfigWithRoot behaves like applyPayloadConfig but treats all parameter
 // paths as relative to the provided root path (for example, "request" for Gemini CLI)
 // and restricts matches to the given protocol when supplied.
-func applyPayloadConfigWithRoot(cfg *config.Config, model, protocol, root string, payload []byte) []byte {
+func applyPayloadConfigWithRoot(ctx context.Context, cfg *config.Config, provider, model, protocol, root string, payload []byte) []byte {
 	if cfg == nil || len(payload) == 0 {
 		return payload
 	}
@@ -104,69 +105,136 @@ func applyPayloadConfigWithRoot(cfg *config.Config, model, protocol, root string
 	if model == "" {
 		return payload
 	}
+	effective := rules.Resolve(config.PayloadTarget{
+		Provider: provider,
+		Model:    model,
+		Protocol: protocol,
+		APIKey:   apiKeyFromContext(ctx),
+	})
 	out := payload
-	// Apply default rules: first write wins per field across all matching rules.
-	for i := range rules.Default {
-		rule := &rules.Default[i]
-		if !payloadRuleMatchesModel(rule, model, protocol) {
+	for path, value := range effective.Default {
+		fullPath := buildPayloadPath(root, path)
+		if fullPath == "" {
 			continue
 		}
-		for path, value := range rule.Params {
-			fullPath := buildPayloadPath(root, path)
-			if fullPath == "" {
-				continue
-			}
-			if gjson.GetBytes(out, fullPath).Exists() {
-				continue
-			}
-			updated, errSet := sjson.SetBytes(out, fullPath, value)
-			if errSet != nil {
-				continue
-			}
-			out = updated
+		if gjson.GetBytes(out, fullPath).Exists() {
+			continue
+		}
+		updated, errSet := sjson.SetBytes(out, fullPath, value)
+		if errSet != nil {
+			continue
 		}
+		out = updated
 	}
-	// Apply override rules: last write wins per field across all matching rules.
-	for i := range rules.Override {
-		rule := &rules.Override[i]
-		if !payloadRuleMatchesModel(rule, model, protocol) {
+	for path, value := range effective.Override {
+		fullPath := buildPayloadPath(root, path)
+		if fullPath == "" {
 			continue
 		}
-		for path, value := range rule.Params {
-			fullPath := buildPayloadPath(root, path)
-			if fullPath == "" {
-				continue
-			}
-			updated, errSet := sjson.SetBytes(out, fullPath, value)
-			if errSet != nil {
-				continue
-			}
-			out = updated
+		updated, errSet := sjson.SetBytes(out, fullPath, value)
+		if errSet != nil {
+			continue
 		}
+		out = updated
+	}
+	if effective.DefaultSystemPrompt != "" {
+		out = applySystemPrompt(out, provider, root, effective.DefaultSystemPrompt, false)
+	}
+	if effective.SystemPromptPrefix != "" {
+		out = applySystemPrompt(out, provider, root, effective.SystemPromptPrefix, true)
 	}
 	return out
 }
 
-func payloadRuleMatchesModel(rule *config.PayloadRule, model, protocol string) bool {
-	if rule == nil {
-		return false
-	}
-	if len(rule.Models) == 0 {
-		return false
-	}
-	for _, entry := range rule.Models {
-		name := strings.TrimSpace(entry.Name)
-		if name == "" {
-			continue
+// applySystemPrompt places text ahead of the payload's system prompt, detecting the
+// request format from its shape. Without prefix the text is only added when the
+// payload has no system prompt yet.
+func applySystemPrompt(payload []byte, provider, root, text string, prefix bool) []byte {
+	path := func(p string) string { return buildPayloadPath(root, p) }
+	base := payload
+	if root != "" {
+		base = []byte(gjson.GetBytes(payload, root).Raw)
+	}
+	switch {
+	case gjson.GetBytes(base, "contents").Exists() || gjson.GetBytes(base, "systemInstruction").Exists() || gjson.GetBytes(base, "system_instruction").Exists():
+		key := "systemInstruction"
+		if gjson.GetBytes(base, "system_instruction").Exists() {
+			key = "system_instruction"
 		}
-		if ep := strings.TrimSpace(entry.Protocol); ep != "" && protocol != "" && !strings.EqualFold(ep, protocol) {
-			continue
+		parts := gjson.GetBytes(base, key+".parts")
+		if parts.IsArray() && len(parts.Array()) > 0 && !prefix {
+			return payload
 		}
-		if matchModelPattern(name, model) {
-			return true
+		part, _ := sjson.Set(`{}`, "text", text)
+		return setRawArrayWithHead(payload, path(key+".parts"), part, parts)
+	case gjson.GetBytes(base, "input").Exists() && !gjson.GetBytes(base, "messages").Exists():
+		existing := gjson.GetBytes(base, "instructions").String()
+		if existing != "" && !prefix {
+			return payload
 		}
+		out, _ := sjson.SetBytes(payload, path("instructions"), joinSystemText(text, existing))
+		return out
+	case strings.EqualFold(provider, "claude") || gjson.GetBytes(base, "system").Exists():
+		system := gjson.GetBytes(base, "system")
+		block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+		switch {
+		case system.IsArray():
+			if len(system.Array()) > 0 && !prefix {
+				return payload
+			}
+			return setRawArrayWithHead(payload, path("system"), block, system)
+		case system.String() != "":
+			if !prefix {
+				return payload
+			}
+			existing, _ := sjson.Set(`{"type":"text"}`, "text", system.String())
+			out, _ := sjson.SetRawBytes(payload, path("system"), []byte("["+block+","+existing+"]"))
+			return out
+		default:
+			out, _ := sjson.SetRawBytes(payload, path("system"), []byte("["+block+"]"))
+			return out
+		}
+	default:
+		messages := gjson.GetBytes(base, "messages")
+		first := messages.Get("0")
+		if first.Get("role").String() == "system" || first.Get("role").String() == "developer" {
+			if !prefix {
+				return payload
+			}
+			content := first.Get("content")
+			if content.IsArray() {
+				part, _ := sjson.Set(`{"type":"text"}`, "text", text)
+				return setRawArrayWithHead(payload, path("messages.0.content"), part, content)
+			}
+			out, _ := sjson.SetBytes(payload, path("messages.0.content"), joinSystemText(text, content.String()))
+			return out
+		}
+		msg, _ := sjson.Set(`{"role":"system"}`, "content", text)
+		return setRawArrayWithHead(payload, path("messages"), msg, messages)
+	}
+}
+
+// setRawArrayWithHead writes head followed by the elements of existing to path.
+func setRawArrayWithHead(payload []byte, path, head string, existing gjson.Result) []byte {
+	items := []string{head}
+	if existing.IsArray() {
+		existing.ForEach(func(_, item gjson.Result) bool {
+			items = append(items, item.Raw)
+			return true
+		})
+	}
+	out, err := sjson.SetRawBytes(payload, path, []byte("["+strings.Join(items, ",")+"]"))
+	if err != nil {
+		return payload
+	}
+	return out
+}
+
+func joinSystemText(prefix, existing string) string {
+	if existing == "" {
+		return prefix
 	}
-	return false
+	return prefix + "\n\n" + existing
 }
 
 // buildPayloadPath combines an optional root path with a relative parameter path.
@@ -187,51 +255,6 @@ func buildPayloadPath(root, path string) string {
 	return r + "." + p
 }
 
-// matchModelPattern performs simple wildcard matching where '*' matches zero or more characters.
-// Examples:
-//
-//	"*-5" matches "gpt-5"
-//	"gpt-*" matches "gpt-5" and "gpt-4"
-//	"gemini-*-pro" matches "gemini-2.5-pro" and "gemini-3-pro".
-func matchModelPattern(pattern, model string) bool {
-	pattern = strings.TrimSpace(pattern)
-	model = strings.TrimSpace(model)
-	if pattern == "" {
-		return false
-	}
-	if pattern == "*" {
-		return true
-	}
-	// Iterative glob-style matcher supporting only '*' wildcard.
-	pi, si := 0, 0
-	starIdx := -1
-	matchIdx := 0
-	for si < len(model) {
-		if pi < len(pattern) && (pattern[pi] == model[si]) {
-			pi++
-			si++
-			continue
-		}
-		if pi < len(pattern) && pattern[pi] == '*' {
-			starIdx = pi
-			matchIdx = si
-			pi++
-			continue
-		}
-		if starIdx != -1 {
-			pi = starIdx + 1
-			matchIdx++
-			si = matchIdx
-			continue
-		}
-		return false
-	}
-	for pi < len(pattern) && pattern[pi] == '*' {
-		pi++
-	}
-	return pi == len(pattern)
-}
-
 // NormalizeThinkingConfig normalizes thinking-related fields in the payload
 // based on model capabilities. For models without thinking support, it strips
 // reasoning fields. For models with level-based thinking, it validates and
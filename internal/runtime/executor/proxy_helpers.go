@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/livequota"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/upstream"
 	cliproxyauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/proxy"
@@ -16,9 +19,14 @@ import (
 
 // newProxyAwareHTTPClient creates an HTTP client with proper proxy configuration priority:
 // 1. Use auth.ProxyURL if configured (highest priority)
-// 2. Use cfg.ProxyURL if auth proxy is not configured
+// 2. Use the provider's provider-proxies entry, then cfg.ProxyURL, if auth proxy is not configured
 // 3. Use RoundTripper from context if neither are configured
 //
+// The resulting transport is instrumented with upstream tracing spans, records the
+// rate limits the provider reports for auth, and enforces the provider's upstream
+// timeout and retry policy. The connect timeout applies to direct
+// and HTTP(S) proxy connections; a context RoundTripper keeps its own dialer.
+//
 // Parameters:
 //   - ctx: The context containing optional RoundTripper
 //   - cfg: The application configuration
@@ -32,24 +40,18 @@ func newProxyAwareHTTPClient(ctx context.Context, cfg *config.Config, auth *clip
 	if timeout > 0 {
 		httpClient.Timeout = timeout
 	}
+	policy := upstreamPolicy(cfg, auth)
 
-	// Priority 1: Use auth.ProxyURL if configured
-	var proxyURL string
-	if auth != nil {
-		proxyURL = strings.TrimSpace(auth.ProxyURL)
-	}
-
-	// Priority 2: Use cfg.ProxyURL if auth proxy is not configured
-	if proxyURL == "" && cfg != nil {
-		proxyURL = strings.TrimSpace(cfg.ProxyURL)
-	}
+	// Priority 1 and 2: credential proxy, then provider or global proxy
+	proxyURL := effectiveProxyURL(cfg, auth)
 
 	// If we have a proxy URL configured, set up the transport
 	if proxyURL != "" {
 		transport := buildProxyTransport(proxyURL)
 		if transport != nil {
+			upstream.ApplyConnectTimeout(transport, policy.Connect)
 			httpClient.Transport = transport
-			return httpClient
+			return withUpstreamPolicy(withTracing(withQuotaTracking(httpClient, auth), auth), policy)
 		}
 		// If proxy setup failed, log and fall through to context RoundTripper
 		log.Debugf("failed to setup proxy from URL: %s, falling back to context transport", proxyURL)
@@ -58,8 +60,63 @@ func newProxyAwareHTTPClient(ctx context.Context, cfg *config.Config, auth *clip
 	// Priority 3: Use RoundTripper from context (typically from RoundTripperFor)
 	if rt, ok := ctx.Value("cliproxy.roundtripper").(http.RoundTripper); ok && rt != nil {
 		httpClient.Transport = rt
+	} else if policy.Connect > 0 {
+		httpClient.Transport = upstream.DefaultTransport(policy.Connect)
+	}
+
+	return withUpstreamPolicy(withTracing(withQuotaTracking(httpClient, auth), auth), policy)
+}
+
+// upstreamPolicy returns the upstream timeout and retry policy of auth's provider.
+func upstreamPolicy(cfg *config.Config, auth *cliproxyauth.Auth) upstream.Policy {
+	if cfg == nil {
+		return upstream.Policy{}
+	}
+	provider := ""
+	if auth != nil {
+		provider = auth.Provider
+	}
+	return upstream.PolicyFromConfig(cfg.Upstream.For(provider))
+}
+
+// withUpstreamPolicy wraps the client transport with the read/total timeouts and
+// retries of policy. It wraps the tracing transport so every attempt gets a span.
+func withUpstreamPolicy(httpClient *http.Client, policy upstream.Policy) *http.Client {
+	httpClient.Transport = upstream.WrapTransport(httpClient.Transport, policy)
+	return httpClient
+}
+
+// effectiveProxyURL returns the outbound proxy for auth: its own proxy-url, then the
+// provider-proxies entry of its provider, then the global proxy-url.
+func effectiveProxyURL(cfg *config.Config, auth *cliproxyauth.Auth) string {
+	provider := ""
+	if auth != nil {
+		if proxyURL := strings.TrimSpace(auth.ProxyURL); proxyURL != "" {
+			return proxyURL
+		}
+		provider = auth.Provider
 	}
+	return cfg.ProviderProxyURL(provider)
+}
 
+// withTracing wraps the client transport so each upstream call emits a span
+// and forwards the traceparent header of the inbound request.
+func withTracing(httpClient *http.Client, auth *cliproxyauth.Auth) *http.Client {
+	provider := ""
+	if auth != nil {
+		provider = auth.Provider
+	}
+	httpClient.Transport = tracing.WrapTransport(httpClient.Transport, provider)
+	return httpClient
+}
+
+// withQuotaTracking wraps the client transport so the remaining quota reported on
+// every upstream response is recorded for auth.
+func withQuotaTracking(httpClient *http.Client, auth *cliproxyauth.Auth) *http.Client {
+	if auth == nil {
+		return httpClient
+	}
+	httpClient.Transport = livequota.WrapTransport(httpClient.Transport, auth.ID, auth.Provider)
 	return httpClient
 }
 
@@ -0,0 +1,183 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	cliproxyauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	realtimeHandshakeTimeout = 30 * time.Second
+	// pcm16BytesPerSecond is 24 kHz mono 16-bit PCM, the Realtime API default.
+	pcm16BytesPerSecond = 48000
+	// g711BytesPerSecond is 8 kHz mono G.711 (u-law or A-law).
+	g711BytesPerSecond = 8000
+)
+
+// realtimeURL turns an OpenAI-style HTTP base URL into the Realtime WebSocket URL for model.
+func realtimeURL(baseURL, model string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/realtime")
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "https", "wss":
+		u.Scheme = "wss"
+	case "http", "ws":
+		u.Scheme = "ws"
+	default:
+		return "", fmt.Errorf("unsupported base URL scheme %q", u.Scheme)
+	}
+	query := u.Query()
+	query.Set("model", model)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// dialRealtimeWebsocket opens target with header, honouring the proxy settings of the
+// credential. A rejected handshake is returned as a statusErr so the auth manager can
+// cool the credential down and fail over like it does for HTTP requests.
+func dialRealtimeWebsocket(ctx context.Context, cfg *config.Config, auth *cliproxyauth.Auth, target string, header http.Header) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: realtimeHandshakeTimeout}
+	if proxyURL := effectiveProxyURL(cfg, auth); proxyURL != "" {
+		if transport := buildProxyTransport(proxyURL); transport != nil {
+			dialer.Proxy = transport.Proxy
+			dialer.NetDialContext = transport.DialContext
+		}
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, target, header)
+	if err != nil {
+		if resp == nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		msg := strings.TrimSpace(string(body))
+		if msg == "" {
+			msg = fmt.Sprintf("realtime handshake rejected: %s", resp.Status)
+		}
+		return nil, statusErr{code: resp.StatusCode, msg: msg, retryAfter: parseRetryAfterHeader(resp.Header.Get("Retry-After"))}
+	}
+	return conn, nil
+}
+
+// realtimeConn wraps an upstream Realtime connection and accounts the session:
+// tokens from every response.done event and the duration of the audio streamed in
+// both directions. One usage record covering the session is published on Close.
+type realtimeConn struct {
+	*websocket.Conn
+	ctx      context.Context
+	reporter *usageReporter
+
+	mu           sync.Mutex
+	detail       usage.Detail
+	inputFormat  string
+	outputFormat string
+	audioSeconds float64
+	closeOnce    sync.Once
+}
+
+func newRealtimeConn(ctx context.Context, conn *websocket.Conn, reporter *usageReporter) *realtimeConn {
+	return &realtimeConn{Conn: conn, ctx: ctx, reporter: reporter}
+}
+
+// ReadMessage reads the next upstream event.
+func (c *realtimeConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.Conn.ReadMessage()
+	if err == nil && messageType == websocket.TextMessage {
+		c.observeServerEvent(data)
+	}
+	return messageType, data, err
+}
+
+// WriteMessage sends a client event upstream.
+func (c *realtimeConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.TextMessage {
+		c.observeClientEvent(data)
+	}
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// Close closes the upstream connection and publishes the session's usage.
+func (c *realtimeConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		detail, seconds := c.detail, c.audioSeconds
+		c.mu.Unlock()
+		c.reporter.audioSeconds = seconds
+		c.reporter.publish(c.ctx, detail)
+		c.reporter.ensurePublished(c.ctx)
+	})
+	return err
+}
+
+func (c *realtimeConn) observeServerEvent(data []byte) {
+	event := gjson.ParseBytes(data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch event.Get("type").String() {
+	case "session.created", "session.updated":
+		session := event.Get("session")
+		if format := realtimeAudioFormat(session, "input"); format != "" {
+			c.inputFormat = format
+		}
+		if format := realtimeAudioFormat(session, "output"); format != "" {
+			c.outputFormat = format
+		}
+	case "response.done":
+		u := event.Get("response.usage")
+		c.detail.InputTokens += u.Get("input_tokens").Int()
+		c.detail.OutputTokens += u.Get("output_tokens").Int()
+		c.detail.CachedTokens += u.Get("input_token_details.cached_tokens").Int()
+		c.detail.TotalTokens += u.Get("total_tokens").Int()
+	case "response.audio.delta", "response.output_audio.delta":
+		c.audioSeconds += audioDuration(event.Get("delta").String(), c.outputFormat)
+	}
+}
+
+func (c *realtimeConn) observeClientEvent(data []byte) {
+	event := gjson.ParseBytes(data)
+	if event.Get("type").String() != "input_audio_buffer.append" {
+		return
+	}
+	c.mu.Lock()
+	c.audioSeconds += audioDuration(event.Get("audio").String(), c.inputFormat)
+	c.mu.Unlock()
+}
+
+// realtimeAudioFormat reads the audio format of direction ("input" or "output") from
+// a session object in either the beta or the GA Realtime schema.
+func realtimeAudioFormat(session gjson.Result, direction string) string {
+	if format := session.Get(direction + "_audio_format").String(); format != "" {
+		return format
+	}
+	return session.Get("audio." + direction + ".format.type").String()
+}
+
+// audioDuration returns the seconds of audio in a base64 chunk of the given format.
+func audioDuration(b64, format string) float64 {
+	if b64 == "" {
+		return 0
+	}
+	size := len(b64) / 4 * 3
+	size -= strings.Count(b64[max(0, len(b64)-2):], "=")
+	switch format {
+	case "g711_ulaw", "g711_alaw", "audio/pcmu", "audio/pcma":
+		return float64(size) / g711BytesPerSecond
+	default:
+		return float64(size) / pcm16BytesPerSecond
+	}
+}
@@ -3,12 +3,16 @@ package executor
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/classify"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/modelrewrite"
 	cliproxyauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
 	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
 	"github.com/tidwall/gjson"
@@ -22,8 +26,32 @@ type usageReporter struct {
 	authIndex   uint64
 	apiKey      string
 	source      string
+	email       string
+	requested   string
+	tags        []string
+	queueWait   time.Duration
 	requestedAt time.Time
-	once        sync.Once
+	// audioSeconds is set by realtime sessions before their record is published.
+	audioSeconds float64
+	// inputs carries the tool result and image statistics of the inbound request.
+	inputs usage.InputStats
+	// toolCalls accumulates tool calls observed in stream chunks.
+	toolCalls atomic.Int64
+	// client is the inbound request's context, captured while the Gin context is
+	// still live; it is cancelled when the client disconnects.
+	client context.Context
+	// partial holds the usage and generated text observed in stream chunks. It is
+	// reported to the in-flight usage table while the stream runs and recorded when
+	// the client aborts the stream before the final usage arrives; streamID registers
+	// the stream in that table.
+	partialMu    sync.Mutex
+	partial      usage.Detail
+	partialText  strings.Builder
+	partialChars int64
+	streamID     uint64
+	streamEnded  bool
+	progressAt   time.Time
+	once         sync.Once
 }
 
 func newUsageReporter(ctx context.Context, provider, model string, auth *cliproxyauth.Auth) *usageReporter {
@@ -34,20 +62,29 @@ func newUsageReporter(ctx context.Context, provider, model string, auth *cliprox
 		requestedAt: time.Now(),
 		apiKey:      apiKey,
 		source:      resolveUsageSource(auth, apiKey),
+		requested:   modelrewrite.RequestedModelFromContext(ctx),
+		tags:        classify.TagsFromContext(ctx),
+		queueWait:   cliproxyauth.QueueWaitFromContext(ctx),
+		inputs:      usage.InputStatsFromContext(ctx),
+		client:      clientContext(ctx),
 	}
 	if auth != nil {
 		reporter.authID = auth.ID
 		reporter.authIndex = auth.EnsureIndex()
+		reporter.email = accountEmail(auth)
 	}
 	return reporter
 }
 
 func (r *usageReporter) publish(ctx context.Context, detail usage.Detail) {
-	r.publishWithOutcome(ctx, detail, false)
+	r.publishWithOutcome(ctx, detail, nil)
 }
 
-func (r *usageReporter) publishFailure(ctx context.Context) {
-	r.publishWithOutcome(ctx, usage.Detail{}, true)
+func (r *usageReporter) publishFailure(ctx context.Context, err error) {
+	if err == nil {
+		err = errors.New("upstream request failed")
+	}
+	r.publishWithOutcome(ctx, usage.Detail{}, err)
 }
 
 func (r *usageReporter) trackFailure(ctx context.Context, errPtr *error) {
@@ -55,34 +92,52 @@ func (r *usageReporter) trackFailure(ctx context.Context, errPtr *error) {
 		return
 	}
 	if *errPtr != nil {
-		r.publishFailure(ctx)
+		r.publishFailure(ctx, *errPtr)
 	}
 }
 
-func (r *usageReporter) publishWithOutcome(ctx context.Context, detail usage.Detail, failed bool) {
+// publishWithOutcome publishes detail once; a non-nil failure marks the record failed
+// and classifies the error. A failure caused by the client disconnecting is recorded
+// as aborted instead, with the usage observed in the stream so far.
+func (r *usageReporter) publishWithOutcome(ctx context.Context, detail usage.Detail, failure error) {
 	if r == nil {
 		return
 	}
+	aborted := failure != nil && r.client != nil && r.client.Err() != nil
+	if aborted {
+		detail, failure = r.partialDetail(), nil
+	}
+	failed := failure != nil
 	if detail.TotalTokens == 0 {
 		total := detail.InputTokens + detail.OutputTokens + detail.ReasoningTokens
 		if total > 0 {
 			detail.TotalTokens = total
 		}
 	}
-	if detail.InputTokens == 0 && detail.OutputTokens == 0 && detail.ReasoningTokens == 0 && detail.CachedTokens == 0 && detail.TotalTokens == 0 && !failed {
+	if detail.InputTokens == 0 && detail.OutputTokens == 0 && detail.ReasoningTokens == 0 && detail.CachedTokens == 0 && detail.CacheCreationTokens == 0 && detail.TotalTokens == 0 && !failed && !aborted {
 		return
 	}
+	r.endStream()
+	detail = r.withToolStats(detail)
 	r.once.Do(func() {
 		usage.PublishRecord(ctx, usage.Record{
-			Provider:    r.provider,
-			Model:       r.model,
-			Source:      r.source,
-			APIKey:      r.apiKey,
-			AuthID:      r.authID,
-			AuthIndex:   r.authIndex,
-			RequestedAt: r.requestedAt,
-			Failed:      failed,
-			Detail:      detail,
+			Provider:       r.provider,
+			Model:          r.model,
+			RequestedModel: r.requested,
+			Source:         r.source,
+			AccountEmail:   r.email,
+			APIKey:         r.apiKey,
+			AuthID:         r.authID,
+			AuthIndex:      r.authIndex,
+			RequestedAt:    r.requestedAt,
+			Tags:           r.tags,
+			QueueWait:      r.queueWait,
+			Latency:        time.Since(r.requestedAt),
+			Failed:         failed,
+			Aborted:        aborted,
+			ErrorClass:     usage.ClassifyError(failure),
+			Detail:         detail,
+			AudioSeconds:   r.audioSeconds,
 		})
 	})
 }
@@ -95,19 +150,101 @@ func (r *usageReporter) ensurePublished(ctx context.Context) {
 	if r == nil {
 		return
 	}
+	r.endStream()
 	r.once.Do(func() {
 		usage.PublishRecord(ctx, usage.Record{
-			Provider:    r.provider,
-			Model:       r.model,
-			Source:      r.source,
-			APIKey:      r.apiKey,
-			AuthID:      r.authID,
-			AuthIndex:   r.authIndex,
-			RequestedAt: r.requestedAt,
-			Failed:      false,
-			Detail:      usage.Detail{},
+			Provider:       r.provider,
+			Model:          r.model,
+			RequestedModel: r.requested,
+			Source:         r.source,
+			AccountEmail:   r.email,
+			APIKey:         r.apiKey,
+			AuthID:         r.authID,
+			AuthIndex:      r.authIndex,
+			RequestedAt:    r.requestedAt,
+			Tags:           r.tags,
+			QueueWait:      r.queueWait,
+			Latency:        time.Since(r.requestedAt),
+			Failed:         false,
+			Detail:         r.withToolStats(usage.Detail{}),
+			AudioSeconds:   r.audioSeconds,
+		})
+	})
+}
+
+// clientContext returns the context of the inbound request behind ctx, or nil.
+func clientContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil || ginCtx.Request == nil {
+		return nil
+	}
+	return ginCtx.Request.Context()
+}
+
+func (r *usageReporter) withToolStats(detail usage.Detail) usage.Detail {
+	if detail.ToolCalls == 0 {
+		detail.ToolCalls = r.toolCalls.Load()
+	}
+	detail.ToolResultTokens = r.inputs.ToolResultTokens
+	detail.ImageInputs = r.inputs.ImageInputs
+	detail.DocumentInputs = r.inputs.DocumentInputs
+	detail.MediaBytes = r.inputs.MediaBytes
+	return detail
+}
+
+// countToolCalls counts the tool/function calls in a response body or stream chunk
+// of any upstream format: OpenAI chat completions (a streamed call is counted on its
+// first delta, the one carrying the call id), Claude messages and content_block_start
+// events, Gemini candidates and Responses API output items. Wrapping "response"
+// objects (Gemini CLI, Antigravity, Codex events) are unwrapped first.
+func countToolCalls(data []byte) int64 {
+	root, ok := chunkRoot(data)
+	if !ok {
+		return 0
+	}
+	return countToolCallsIn(root)
+}
+
+func countToolCallsIn(root gjson.Result) int64 {
+	var n int64
+	root.Get("choices").ForEach(func(_, choice gjson.Result) bool {
+		n += choice.Get("message.tool_calls.#").Int()
+		choice.Get("delta.tool_calls").ForEach(func(_, call gjson.Result) bool {
+			if call.Get("id").String() != "" {
+				n++
+			}
+			return true
+		})
+		return true
+	})
+	root.Get("content").ForEach(func(_, block gjson.Result) bool {
+		if block.Get("type").String() == "tool_use" {
+			n++
+		}
+		return true
+	})
+	if root.Get("type").String() == "content_block_start" && root.Get("content_block.type").String() == "tool_use" {
+		n++
+	}
+	root.Get("candidates").ForEach(func(_, candidate gjson.Result) bool {
+		candidate.Get("content.parts").ForEach(func(_, part gjson.Result) bool {
+			if part.Get("functionCall").Exists() {
+				n++
+			}
+			return true
 		})
+		return true
+	})
+	root.Get("output").ForEach(func(_, item gjson.Result) bool {
+		if item.Get("type").String() == "function_call" {
+			n++
+		}
+		return true
 	})
+	return n
 }
 
 func apiKeyFromContext(ctx context.Context) string {
@@ -131,6 +268,21 @@ func apiKeyFromContext(ctx context.Context) string {
 	return ""
 }
 
+// accountEmail returns the account email of an OAuth credential, or "" for API keys.
+func accountEmail(auth *cliproxyauth.Auth) string {
+	if auth.Attributes != nil {
+		if email := strings.TrimSpace(auth.Attributes["account_email"]); email != "" {
+			return email
+		}
+	}
+	if auth.Metadata != nil {
+		if email, ok := auth.Metadata["email"].(string); ok {
+			return strings.TrimSpace(email)
+		}
+	}
+	return ""
+}
+
 func resolveUsageSource(auth *cliproxyauth.Auth, ctxAPIKey string) string {
 	if auth != nil {
 		provider := strings.TrimSpace(auth.Provider)
@@ -191,6 +343,7 @@ func parseCodexUsage(data []byte) (usage.Detail, bool) {
 	if reasoning := usageNode.Get("output_tokens_details.reasoning_tokens"); reasoning.Exists() {
 		detail.ReasoningTokens = reasoning.Int()
 	}
+	detail.ToolCalls = countToolCalls(data)
 	return detail, true
 }
 
@@ -210,6 +363,7 @@ func parseOpenAIUsage(data []byte) usage.Detail {
 	if reasoning := usageNode.Get("completion_tokens_details.reasoning_tokens"); reasoning.Exists() {
 		detail.ReasoningTokens = reasoning.Int()
 	}
+	detail.ToolCalls = countToolCalls(data)
 	return detail
 }
 
@@ -242,15 +396,13 @@ func parseClaudeUsage(data []byte) usage.Detail {
 		return usage.Detail{}
 	}
 	detail := usage.Detail{
-		InputTokens:  usageNode.Get("input_tokens").Int(),
-		OutputTokens: usageNode.Get("output_tokens").Int(),
-		CachedTokens: usageNode.Get("cache_read_input_tokens").Int(),
-	}
-	if detail.CachedTokens == 0 {
-		// fall back to creation tokens when read tokens are absent
-		detail.CachedTokens = usageNode.Get("cache_creation_input_tokens").Int()
+		InputTokens:         usageNode.Get("input_tokens").Int(),
+		OutputTokens:        usageNode.Get("output_tokens").Int(),
+		CachedTokens:        usageNode.Get("cache_read_input_tokens").Int(),
+		CacheCreationTokens: usageNode.Get("cache_creation_input_tokens").Int(),
 	}
 	detail.TotalTokens = detail.InputTokens + detail.OutputTokens
+	detail.ToolCalls = countToolCalls(data)
 	return detail
 }
 
@@ -264,12 +416,10 @@ func parseClaudeStreamUsage(line []byte) (usage.Detail, bool) {
 		return usage.Detail{}, false
 	}
 	detail := usage.Detail{
-		InputTokens:  usageNode.Get("input_tokens").Int(),
-		OutputTokens: usageNode.Get("output_tokens").Int(),
-		CachedTokens: usageNode.Get("cache_read_input_tokens").Int(),
-	}
-	if detail.CachedTokens == 0 {
-		detail.CachedTokens = usageNode.Get("cache_creation_input_tokens").Int()
+		InputTokens:         usageNode.Get("input_tokens").Int(),
+		OutputTokens:        usageNode.Get("output_tokens").Int(),
+		CachedTokens:        usageNode.Get("cache_read_input_tokens").Int(),
+		CacheCreationTokens: usageNode.Get("cache_creation_input_tokens").Int(),
 	}
 	detail.TotalTokens = detail.InputTokens + detail.OutputTokens
 	return detail, true
@@ -293,6 +443,7 @@ func parseGeminiCLIUsage(data []byte) usage.Detail {
 	if detail.TotalTokens == 0 {
 		detail.TotalTokens = detail.InputTokens + detail.OutputTokens + detail.ReasoningTokens
 	}
+	detail.ToolCalls = countToolCalls(data)
 	return detail
 }
 
@@ -314,6 +465,7 @@ func parseGeminiUsage(data []byte) usage.Detail {
 	if detail.TotalTokens == 0 {
 		detail.TotalTokens = detail.InputTokens + detail.OutputTokens + detail.ReasoningTokens
 	}
+	detail.ToolCalls = countToolCalls(data)
 	return detail
 }
 
@@ -386,6 +538,7 @@ func parseAntigravityUsage(data []byte) usage.Detail {
 	if detail.TotalTokens == 0 {
 		detail.TotalTokens = detail.InputTokens + detail.OutputTokens + detail.ReasoningTokens
 	}
+	detail.ToolCalls = countToolCalls(data)
 	return detail
 }
 
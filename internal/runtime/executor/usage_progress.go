@@ -0,0 +1,185 @@
+package executor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	"github.com/tidwall/gjson"
+)
+
+// maxPartialText caps the streamed text kept for estimating the output tokens of a
+// running or aborted stream; longer responses are extrapolated from the kept share.
+const maxPartialText = 1 << 20
+
+// streamProgressInterval throttles how often a running stream refreshes its entry in
+// the in-flight usage table.
+const streamProgressInterval = 5 * time.Second
+
+// observeChunk inspects a stream chunk. Tool calls started in it are added to the
+// published record unless the usage payload already carried a count; usage fields and
+// generated text are reported to the in-flight usage table while the stream runs and
+// kept for recording a stream the client aborts.
+func (r *usageReporter) observeChunk(line []byte) {
+	if r == nil {
+		return
+	}
+	root, ok := chunkRoot(line)
+	if !ok {
+		return
+	}
+	if n := countToolCallsIn(root); n > 0 {
+		r.toolCalls.Add(n)
+	}
+	detail, hasUsage := partialUsage(root)
+	text := streamedText(root)
+	if !hasUsage && text == "" {
+		return
+	}
+	r.partialMu.Lock()
+	r.partial.InputTokens = max(r.partial.InputTokens, detail.InputTokens)
+	r.partial.OutputTokens = max(r.partial.OutputTokens, detail.OutputTokens)
+	r.partial.ReasoningTokens = max(r.partial.ReasoningTokens, detail.ReasoningTokens)
+	r.partial.CachedTokens = max(r.partial.CachedTokens, detail.CachedTokens)
+	r.partial.CacheCreationTokens = max(r.partial.CacheCreationTokens, detail.CacheCreationTokens)
+	r.partial.TotalTokens = max(r.partial.TotalTokens, detail.TotalTokens)
+	r.partialChars += int64(len(text))
+	if r.partialText.Len() < maxPartialText {
+		r.partialText.WriteString(text)
+	}
+	now := time.Now()
+	if r.streamID == 0 && !r.streamEnded {
+		r.streamID = usage.StartStream(r.provider, r.model, r.authID, r.source, r.requestedAt)
+	}
+	refresh := r.streamID != 0 && now.Sub(r.progressAt) >= streamProgressInterval
+	if refresh {
+		r.progressAt = now
+	}
+	id := r.streamID
+	r.partialMu.Unlock()
+	if refresh {
+		usage.UpdateStream(id, r.partialDetail())
+	}
+}
+
+// partialDetail returns the usage observed so far in the stream. When no chunk
+// reported output tokens they are estimated from the streamed text.
+func (r *usageReporter) partialDetail() usage.Detail {
+	r.partialMu.Lock()
+	defer r.partialMu.Unlock()
+	detail := r.partial
+	if detail.OutputTokens == 0 && r.partialText.Len() > 0 {
+		if estimated := estimateTextTokens(r.partialText.String()); estimated > 0 {
+			detail.OutputTokens = estimated * r.partialChars / int64(r.partialText.Len())
+			detail.TotalTokens = 0
+		}
+	}
+	return detail
+}
+
+// endStream removes the stream from the in-flight usage table before its final
+// record is published.
+func (r *usageReporter) endStream() {
+	r.partialMu.Lock()
+	id := r.streamID
+	r.streamID = 0
+	r.streamEnded = true
+	r.partialMu.Unlock()
+	if id != 0 {
+		usage.EndStream(id)
+	}
+}
+
+// chunkRoot parses a response body or stream chunk, unwrapping the "response" object
+// of Gemini CLI, Antigravity and Codex events.
+func chunkRoot(data []byte) (gjson.Result, bool) {
+	payload := jsonPayload(data)
+	if len(payload) == 0 || !gjson.ValidBytes(payload) {
+		return gjson.Result{}, false
+	}
+	root := gjson.ParseBytes(payload)
+	if wrapped := root.Get("response"); wrapped.IsObject() {
+		root = wrapped
+	}
+	return root, true
+}
+
+// partialUsage reads the usage fields a stream chunk carries in any upstream format:
+// OpenAI and Responses API usage, Claude message_start and message_delta usage, and
+// Gemini usageMetadata.
+func partialUsage(root gjson.Result) (usage.Detail, bool) {
+	if node := firstExisting(root, "usageMetadata", "usage_metadata"); node.Exists() {
+		return usage.Detail{
+			InputTokens:     node.Get("promptTokenCount").Int(),
+			OutputTokens:    node.Get("candidatesTokenCount").Int(),
+			ReasoningTokens: node.Get("thoughtsTokenCount").Int(),
+			CachedTokens:    node.Get("cachedContentTokenCount").Int(),
+			TotalTokens:     node.Get("totalTokenCount").Int(),
+		}, true
+	}
+	node := firstExisting(root, "usage", "message.usage")
+	if !node.IsObject() {
+		return usage.Detail{}, false
+	}
+	return usage.Detail{
+		InputTokens:         firstExisting(node, "prompt_tokens", "input_tokens").Int(),
+		OutputTokens:        firstExisting(node, "completion_tokens", "output_tokens").Int(),
+		ReasoningTokens:     firstExisting(node, "completion_tokens_details.reasoning_tokens", "output_tokens_details.reasoning_tokens").Int(),
+		CachedTokens:        firstExisting(node, "prompt_tokens_details.cached_tokens", "input_tokens_details.cached_tokens", "cache_read_input_tokens").Int(),
+		CacheCreationTokens: node.Get("cache_creation_input_tokens").Int(),
+		TotalTokens:         node.Get("total_tokens").Int(),
+	}, true
+}
+
+// streamedText returns the generated text (including reasoning and tool arguments)
+// a stream chunk carries in any upstream format.
+func streamedText(root gjson.Result) string {
+	var b strings.Builder
+	root.Get("choices").ForEach(func(_, choice gjson.Result) bool {
+		b.WriteString(choice.Get("delta.content").String())
+		b.WriteString(choice.Get("delta.reasoning_content").String())
+		b.WriteString(choice.Get("text").String())
+		choice.Get("delta.tool_calls").ForEach(func(_, call gjson.Result) bool {
+			b.WriteString(call.Get("function.arguments").String())
+			return true
+		})
+		return true
+	})
+	if delta := root.Get("delta"); delta.IsObject() {
+		b.WriteString(delta.Get("text").String())
+		b.WriteString(delta.Get("thinking").String())
+		b.WriteString(delta.Get("partial_json").String())
+	} else if delta.Type == gjson.String && strings.HasSuffix(root.Get("type").String(), ".delta") {
+		b.WriteString(delta.String())
+	}
+	root.Get("candidates").ForEach(func(_, candidate gjson.Result) bool {
+		candidate.Get("content.parts").ForEach(func(_, part gjson.Result) bool {
+			b.WriteString(part.Get("text").String())
+			return true
+		})
+		return true
+	})
+	return b.String()
+}
+
+func firstExisting(node gjson.Result, paths ...string) gjson.Result {
+	for _, path := range paths {
+		if value := node.Get(path); value.Exists() {
+			return value
+		}
+	}
+	return gjson.Result{}
+}
+
+// estimateTextTokens approximates the token count of generated text.
+func estimateTextTokens(text string) int64 {
+	enc, err := tokenizerForModel("")
+	if err != nil {
+		return 0
+	}
+	count, err := enc.Count(text)
+	if err != nil {
+		return 0
+	}
+	return int64(count)
+}
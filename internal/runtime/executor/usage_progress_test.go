@@ -0,0 +1,71 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+func inFlight(id uint64) (usage.StreamProgress, bool) {
+	for _, s := range usage.InFlightStreams() {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return usage.StreamProgress{}, false
+}
+
+func TestObserveChunkTracksInFlightStream(t *testing.T) {
+	r := &usageReporter{provider: "openai", model: "gpt-test", requestedAt: time.Now()}
+	r.observeChunk([]byte(`data: {"choices":[{"delta":{"content":"hello there, how are you today?"}}]}`))
+	id := r.streamID
+	if id == 0 {
+		t.Fatal("first chunk did not register the stream")
+	}
+	progress, ok := inFlight(id)
+	if !ok || progress.Provider != "openai" || progress.OutputTokens == 0 {
+		t.Fatalf("unexpected in-flight entry %+v (found=%v)", progress, ok)
+	}
+
+	// Updates inside the refresh interval are kept but not reported yet.
+	r.observeChunk([]byte(`data: {"choices":[],"usage":{"prompt_tokens":50,"completion_tokens":9}}`))
+	if progress, _ = inFlight(id); progress.InputTokens != 0 {
+		t.Fatalf("progress refreshed before the interval elapsed: %+v", progress)
+	}
+	r.progressAt = time.Now().Add(-streamProgressInterval)
+	r.observeChunk([]byte(`data: {"choices":[{"delta":{"content":"!"}}]}`))
+	if progress, _ = inFlight(id); progress.InputTokens != 50 || progress.OutputTokens != 9 || progress.TotalTokens != 59 {
+		t.Fatalf("unexpected refreshed progress %+v", progress)
+	}
+
+	r.endStream()
+	if _, ok = inFlight(id); ok {
+		t.Fatal("ended stream still listed")
+	}
+	r.observeChunk([]byte(`data: {"choices":[{"delta":{"content":"late"}}]}`))
+	if r.streamID != 0 {
+		t.Fatal("a chunk after the stream ended registered it again")
+	}
+}
+
+func TestPublishEndsInFlightStream(t *testing.T) {
+	r := &usageReporter{provider: "claude", model: "claude-test", requestedAt: time.Now()}
+	r.observeChunk([]byte(`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}`))
+	id := r.streamID
+	if _, ok := inFlight(id); !ok {
+		t.Fatal("stream not registered")
+	}
+	r.publish(context.Background(), usage.Detail{InputTokens: 3, OutputTokens: 1})
+	if _, ok := inFlight(id); ok {
+		t.Fatal("publishing the final record must end the stream")
+	}
+
+	empty := &usageReporter{provider: "claude", model: "claude-test", requestedAt: time.Now()}
+	empty.observeChunk([]byte(`data: {"type":"ping"}`))
+	if empty.streamID != 0 {
+		t.Fatal("chunks without usage or text must not register a stream")
+	}
+	empty.ensurePublished(context.Background())
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// authFileSecretFields lists the auth file fields that may hold a secret reference
+// instead of the OAuth refresh token itself. Nested fields are dot-separated.
+var authFileSecretFields = []string{"refresh_token", "token.refresh_token"}
+
+// authFileRefAttr prefixes the auth attribute recording the reference a field was
+// resolved from.
+const authFileRefAttr = "secret_ref:"
+
+// ResolveAuthMetadata replaces secret references in the refresh token fields of auth
+// file metadata with their values and records each reference in attrs, so the
+// credential can be saved back without writing the token to disk. It does not block
+// on an unavailable backend and returns ErrPending or the fetch error instead.
+func ResolveAuthMetadata(metadata map[string]any, attrs map[string]string) error {
+	for _, field := range authFileSecretFields {
+		raw, ok := metadataString(metadata, field)
+		if !ok || !IsReference(raw) {
+			continue
+		}
+		value, err := Lookup(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		setMetadataString(metadata, field, value)
+		if attrs != nil {
+			attrs[authFileRefAttr+field] = strings.TrimSpace(raw)
+		}
+	}
+	return nil
+}
+
+// RestoreAuthMetadata returns a copy of metadata with resolved refresh tokens swapped
+// back for the references recorded by ResolveAuthMetadata. A token the provider
+// rotated no longer matches the secret; it is kept and its reference dropped from
+// attrs, so the credential stays usable after a restart.
+func RestoreAuthMetadata(metadata map[string]any, attrs map[string]string) map[string]any {
+	out, copied := metadata, false
+	for _, field := range authFileSecretFields {
+		ref := attrs[authFileRefAttr+field]
+		if ref == "" {
+			continue
+		}
+		current, ok := metadataString(out, field)
+		if !ok {
+			continue
+		}
+		value, err := Lookup(ref)
+		if err != nil {
+			continue
+		}
+		if value != current {
+			log.Warnf("secrets: %s no longer matches %s; saving the rotated token to the auth file", field, ref)
+			delete(attrs, authFileRefAttr+field)
+			continue
+		}
+		if !copied {
+			out, copied = copyMetadata(metadata), true
+		}
+		setMetadataString(out, field, ref)
+	}
+	return out
+}
+
+func metadataString(metadata map[string]any, field string) (string, bool) {
+	parent, key, ok := metadataParent(metadata, field)
+	if !ok {
+		return "", false
+	}
+	value, ok := parent[key].(string)
+	return value, ok
+}
+
+func setMetadataString(metadata map[string]any, field, value string) {
+	if parent, key, ok := metadataParent(metadata, field); ok {
+		parent[key] = value
+	}
+}
+
+func metadataParent(metadata map[string]any, field string) (map[string]any, string, bool) {
+	if metadata == nil {
+		return nil, "", false
+	}
+	head, rest, nested := strings.Cut(field, ".")
+	if !nested {
+		return metadata, field, true
+	}
+	child, ok := metadata[head].(map[string]any)
+	if !ok {
+		return nil, "", false
+	}
+	return metadataParent(child, rest)
+}
+
+// copyMetadata copies metadata deep enough that setMetadataString on the copy leaves
+// the original untouched.
+func copyMetadata(metadata map[string]any) map[string]any {
+	out := make(map[string]any, len(metadata))
+	for k, v := range metadata {
+		if child, ok := v.(map[string]any); ok {
+			v = copyMetadata(child)
+		}
+		out[k] = v
+	}
+	return out
+}
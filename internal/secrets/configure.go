@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+var (
+	configureMu sync.Mutex
+	activeVault *VaultOptions
+)
+
+// Options selects the secret backends enabled on the default manager.
+type Options struct {
+	// Vault enables "vault:" references when non-nil.
+	Vault *VaultOptions
+	// RefreshInterval controls how often static secrets are re-read.
+	RefreshInterval time.Duration
+}
+
+// Configure applies opts to the default manager and starts the renewal loop when a
+// remote backend is enabled.
+func Configure(opts Options) error {
+	configureMu.Lock()
+	defer configureMu.Unlock()
+
+	m := defaultManager
+	m.SetRefreshInterval(opts.RefreshInterval)
+	if opts.Vault == nil {
+		if activeVault != nil {
+			m.Unregister("vault")
+			m.Stop()
+			activeVault = nil
+		}
+		return nil
+	}
+	// Keep cached secrets across config reloads that do not touch the backend.
+	if activeVault != nil && *activeVault == *opts.Vault {
+		return nil
+	}
+	backend, err := NewVaultBackend(*opts.Vault)
+	if err != nil {
+		return err
+	}
+	m.Register(backend)
+	m.Start(context.Background())
+	vaultOpts := *opts.Vault
+	activeVault = &vaultOpts
+	return nil
+}
+
+// OptionsFromConfig translates the secrets config section, reading the Vault token
+// from the configured environment variable.
+func OptionsFromConfig(cfg config.SecretsConfig) Options {
+	opts := Options{RefreshInterval: time.Duration(cfg.RefreshIntervalSeconds) * time.Second}
+	if !cfg.Vault.Enabled {
+		return opts
+	}
+	address := strings.TrimSpace(cfg.Vault.Address)
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	tokenEnv := strings.TrimSpace(cfg.Vault.TokenEnv)
+	if tokenEnv == "" {
+		tokenEnv = "VAULT_TOKEN"
+	}
+	opts.Vault = &VaultOptions{
+		Address:   address,
+		Token:     os.Getenv(tokenEnv),
+		TokenFile: strings.TrimSpace(cfg.Vault.TokenFile),
+		Namespace: strings.TrimSpace(cfg.Vault.Namespace),
+	}
+	return opts
+}
@@ -0,0 +1,441 @@
+// Package secrets resolves credential references such as "vault:secret/data/llm#openai"
+// to their values through pluggable backends, so long-lived provider keys can live in
+// a secrets manager instead of the config file. Resolved values are cached, renewed
+// or re-read before they expire, and subscribers are notified when a value rotates.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultRefreshInterval is how often static (non-leased) secrets are re-read.
+const DefaultRefreshInterval = 5 * time.Minute
+
+// lookupWait bounds how long Lookup waits for the first fetch of a reference before
+// leaving it to finish in the background.
+const lookupWait = 2 * time.Second
+
+// fetchTimeout bounds a background fetch started by Lookup.
+const fetchTimeout = 30 * time.Second
+
+// fetchRetry is how long after a failed background fetch subscribers are notified so
+// callers look the reference up again.
+const fetchRetry = time.Minute
+
+// ErrPending reports that a reference is still being fetched in the background.
+// Subscribers are notified once its value is available.
+var ErrPending = errors.New("secrets: value is still being fetched")
+
+// Secret is a value fetched from a backend.
+type Secret struct {
+	Value string
+	// LeaseID identifies a dynamic secret lease; empty for static secrets.
+	LeaseID string
+	// TTL is the remaining lifetime reported by the backend; zero means unknown.
+	TTL       time.Duration
+	Renewable bool
+}
+
+// Backend fetches secrets for a reference scheme.
+type Backend interface {
+	// Scheme is the reference prefix handled by the backend, e.g. "vault".
+	Scheme() string
+	// Fetch reads field from the secret stored at path.
+	Fetch(ctx context.Context, path, field string) (Secret, error)
+	// Renew extends a leased secret. Backends without leases return the secret unchanged.
+	Renew(ctx context.Context, secret Secret) (Secret, error)
+}
+
+// Reference is a parsed "scheme:path#field" secret reference.
+type Reference struct {
+	Scheme string
+	Path   string
+	Field  string
+}
+
+type entry struct {
+	ref       Reference
+	secret    Secret
+	refreshAt time.Time
+}
+
+// pendingFetch tracks a background fetch started by Lookup. late is set once no
+// caller waits for the result, so its arrival must be announced to subscribers.
+type pendingFetch struct {
+	done chan struct{}
+	late bool
+}
+
+// Manager caches resolved references and keeps them fresh.
+type Manager struct {
+	mu       sync.Mutex
+	backends map[string]Backend
+	entries  map[string]*entry
+	pending  map[string]*pendingFetch
+	failed   map[string]error
+	interval time.Duration
+
+	subMu       sync.Mutex
+	subscribers map[int]func()
+	nextSub     int
+
+	stop chan struct{}
+}
+
+// NewManager creates a manager with the env backend registered.
+func NewManager() *Manager {
+	m := &Manager{
+		backends:    make(map[string]Backend),
+		entries:     make(map[string]*entry),
+		pending:     make(map[string]*pendingFetch),
+		failed:      make(map[string]error),
+		interval:    DefaultRefreshInterval,
+		subscribers: make(map[int]func()),
+	}
+	m.Register(envBackend{})
+	return m
+}
+
+var defaultManager = NewManager()
+
+// Default returns the process-wide manager.
+func Default() *Manager { return defaultManager }
+
+// Register installs or replaces the backend for its scheme and drops cached values
+// resolved through the previous backend.
+func (m *Manager) Register(b Backend) {
+	if b == nil {
+		return
+	}
+	m.mu.Lock()
+	scheme := b.Scheme()
+	m.backends[scheme] = b
+	for raw, e := range m.entries {
+		if e.ref.Scheme == scheme {
+			delete(m.entries, raw)
+		}
+	}
+	clear(m.failed)
+	m.mu.Unlock()
+}
+
+// Unregister removes the backend for scheme.
+func (m *Manager) Unregister(scheme string) {
+	m.mu.Lock()
+	delete(m.backends, scheme)
+	for raw, e := range m.entries {
+		if e.ref.Scheme == scheme {
+			delete(m.entries, raw)
+		}
+	}
+	clear(m.failed)
+	m.mu.Unlock()
+}
+
+// SetRefreshInterval changes how often static secrets are re-read.
+func (m *Manager) SetRefreshInterval(d time.Duration) {
+	if d <= 0 {
+		d = DefaultRefreshInterval
+	}
+	m.mu.Lock()
+	m.interval = d
+	m.mu.Unlock()
+}
+
+// ParseReference parses value as a secret reference for one of the registered
+// schemes. Values that are not references return ok=false.
+func (m *Manager) ParseReference(value string) (Reference, bool) {
+	scheme, rest, found := strings.Cut(strings.TrimSpace(value), ":")
+	if !found || rest == "" {
+		return Reference{}, false
+	}
+	m.mu.Lock()
+	_, known := m.backends[scheme]
+	m.mu.Unlock()
+	if !known {
+		return Reference{}, false
+	}
+	rest = strings.TrimPrefix(rest, "//")
+	path, field, _ := strings.Cut(rest, "#")
+	return Reference{Scheme: scheme, Path: strings.Trim(path, "/"), Field: field}, path != ""
+}
+
+// IsReference reports whether value is a secret reference.
+func (m *Manager) IsReference(value string) bool {
+	_, ok := m.ParseReference(value)
+	return ok
+}
+
+// Resolve returns the secret value for a reference, or value unchanged when it is
+// not a reference. Cached values are served until their refresh time.
+func (m *Manager) Resolve(ctx context.Context, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	ref, ok := m.ParseReference(value)
+	if !ok {
+		return value, nil
+	}
+	m.mu.Lock()
+	if e, cached := m.entries[value]; cached {
+		m.mu.Unlock()
+		return e.secret.Value, nil
+	}
+	backend := m.backends[ref.Scheme]
+	m.mu.Unlock()
+
+	secret, err := backend.Fetch(ctx, ref.Path, ref.Field)
+	if err != nil {
+		return "", fmt.Errorf("secrets: resolve %s:%s: %w", ref.Scheme, ref.Path, err)
+	}
+	m.mu.Lock()
+	m.entries[value] = &entry{ref: ref, secret: secret, refreshAt: m.refreshTimeLocked(secret)}
+	m.mu.Unlock()
+	return secret.Value, nil
+}
+
+// Lookup returns the value for a reference without blocking on an unavailable
+// backend. The first lookup of a reference waits briefly for its fetch; when that does
+// not finish in time, or an earlier fetch failed, the fetch continues in the
+// background and Lookup returns ErrPending or the last error. Subscribers are notified
+// when the value arrives, and a minute after a failed fetch so it is looked up again.
+func (m *Manager) Lookup(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	ref, ok := m.ParseReference(value)
+	if !ok {
+		return value, nil
+	}
+	m.mu.Lock()
+	if e, cached := m.entries[value]; cached {
+		m.mu.Unlock()
+		return e.secret.Value, nil
+	}
+	fetch, running := m.pending[value]
+	if running {
+		fetch.late = true
+	} else {
+		_, failedBefore := m.failed[value]
+		fetch = &pendingFetch{done: make(chan struct{}), late: failedBefore}
+		m.pending[value] = fetch
+		go m.fetch(value, ref, m.backends[ref.Scheme], fetch)
+	}
+	wait := !fetch.late
+	m.mu.Unlock()
+
+	if wait {
+		timer := time.NewTimer(lookupWait)
+		select {
+		case <-fetch.done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, cached := m.entries[value]; cached {
+		return e.secret.Value, nil
+	}
+	fetch.late = true
+	if err := m.failed[value]; err != nil {
+		return "", err
+	}
+	return "", ErrPending
+}
+
+func (m *Manager) fetch(raw string, ref Reference, backend Backend, fetch *pendingFetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	secret, err := backend.Fetch(ctx, ref.Path, ref.Field)
+	cancel()
+
+	m.mu.Lock()
+	delete(m.pending, raw)
+	if err != nil {
+		m.failed[raw] = fmt.Errorf("secrets: resolve %s:%s: %w", ref.Scheme, ref.Path, err)
+	} else {
+		delete(m.failed, raw)
+		m.entries[raw] = &entry{ref: ref, secret: secret, refreshAt: m.refreshTimeLocked(secret)}
+	}
+	late := fetch.late
+	m.mu.Unlock()
+	close(fetch.done)
+
+	switch {
+	case err != nil:
+		log.WithError(err).Warnf("secrets: resolve %s:%s failed; retrying in %s", ref.Scheme, ref.Path, fetchRetry)
+		time.AfterFunc(fetchRetry, m.notify)
+	case late:
+		m.notify()
+	}
+}
+
+// refreshTimeLocked schedules renewal at two thirds of a lease, or after the static
+// refresh interval for secrets without a TTL.
+func (m *Manager) refreshTimeLocked(secret Secret) time.Time {
+	if secret.TTL > 0 {
+		wait := secret.TTL * 2 / 3
+		if wait > m.interval && secret.LeaseID == "" {
+			wait = m.interval
+		}
+		return time.Now().Add(wait)
+	}
+	return time.Now().Add(m.interval)
+}
+
+// Subscribe registers fn to run after any cached secret changes value.
+func (m *Manager) Subscribe(fn func()) func() {
+	m.subMu.Lock()
+	id := m.nextSub
+	m.nextSub++
+	m.subscribers[id] = fn
+	m.subMu.Unlock()
+	return func() {
+		m.subMu.Lock()
+		delete(m.subscribers, id)
+		m.subMu.Unlock()
+	}
+}
+
+// Start runs the background renewal loop until Stop or ctx cancellation.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				m.Stop()
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.RefreshDue(ctx)
+			}
+		}
+	}()
+}
+
+// Stop ends the renewal loop.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	m.mu.Unlock()
+}
+
+// RefreshDue renews or re-reads every secret whose refresh time has passed and
+// notifies subscribers when any value changed.
+func (m *Manager) RefreshDue(ctx context.Context) {
+	now := time.Now()
+	m.mu.Lock()
+	due := make(map[string]*entry)
+	for raw, e := range m.entries {
+		if !now.Before(e.refreshAt) {
+			due[raw] = e
+		}
+	}
+	m.mu.Unlock()
+	if len(due) == 0 {
+		return
+	}
+
+	changed := false
+	for raw, e := range due {
+		m.mu.Lock()
+		backend, ok := m.backends[e.ref.Scheme]
+		m.mu.Unlock()
+		if !ok {
+			continue
+		}
+		next, err := m.refreshEntry(ctx, backend, e)
+		if err != nil {
+			log.WithError(err).Warnf("secrets: refresh %s:%s failed; keeping cached value", e.ref.Scheme, e.ref.Path)
+			m.mu.Lock()
+			e.refreshAt = time.Now().Add(time.Minute)
+			m.mu.Unlock()
+			continue
+		}
+		m.mu.Lock()
+		if current, still := m.entries[raw]; still && current == e {
+			if next.Value != e.secret.Value {
+				changed = true
+			}
+			m.entries[raw] = &entry{ref: e.ref, secret: next, refreshAt: m.refreshTimeLocked(next)}
+		}
+		m.mu.Unlock()
+	}
+	if changed {
+		m.notify()
+	}
+}
+
+func (m *Manager) refreshEntry(ctx context.Context, backend Backend, e *entry) (Secret, error) {
+	if e.secret.LeaseID != "" && e.secret.Renewable {
+		renewed, err := backend.Renew(ctx, e.secret)
+		// A lease nearing its max TTL is renewed for less than requested; fetch a
+		// fresh secret instead of riding it to expiry.
+		if err == nil && renewed.TTL > time.Minute {
+			return renewed, nil
+		}
+	}
+	return backend.Fetch(ctx, e.ref.Path, e.ref.Field)
+}
+
+func (m *Manager) notify() {
+	m.subMu.Lock()
+	subs := make([]func(), 0, len(m.subscribers))
+	for _, fn := range m.subscribers {
+		subs = append(subs, fn)
+	}
+	m.subMu.Unlock()
+	for _, fn := range subs {
+		fn()
+	}
+}
+
+// Resolve resolves value through the default manager.
+func Resolve(ctx context.Context, value string) (string, error) {
+	return defaultManager.Resolve(ctx, value)
+}
+
+// Lookup looks value up through the default manager without blocking on an
+// unavailable backend.
+func Lookup(value string) (string, error) { return defaultManager.Lookup(value) }
+
+// IsReference reports whether value is a reference known to the default manager.
+func IsReference(value string) bool { return defaultManager.IsReference(value) }
+
+// Subscribe registers a change callback on the default manager.
+func Subscribe(fn func()) func() { return defaultManager.Subscribe(fn) }
+
+// envBackend resolves "env:NAME" references from the process environment.
+type envBackend struct{}
+
+func (envBackend) Scheme() string { return "env" }
+
+func (envBackend) Fetch(_ context.Context, path, _ string) (Secret, error) {
+	value, ok := os.LookupEnv(path)
+	if !ok {
+		return Secret{}, fmt.Errorf("environment variable %s is not set", path)
+	}
+	return Secret{Value: value}, nil
+}
+
+func (envBackend) Renew(_ context.Context, secret Secret) (Secret, error) { return secret, nil }
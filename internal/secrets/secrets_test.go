@@ -0,0 +1,160 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVaultKVResolveAndRotate(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/llm" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		key := "sk-one"
+		if version.Load() == 2 {
+			key = "sk-two"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{
+				"data":     map[string]any{"openai": key, "claude": "ck"},
+				"metadata": map[string]any{"version": version.Load()},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	backend, err := NewVaultBackend(VaultOptions{Address: srv.URL, Token: "root"})
+	if err != nil {
+		t.Fatalf("backend: %v", err)
+	}
+	m := NewManager()
+	m.Register(backend)
+
+	if got, _ := m.Resolve(context.Background(), "sk-literal"); got != "sk-literal" {
+		t.Fatalf("literal values must pass through, got %q", got)
+	}
+	ref := "vault:secret/data/llm#openai"
+	got, err := m.Resolve(context.Background(), ref)
+	if err != nil || got != "sk-one" {
+		t.Fatalf("resolve: %q %v", got, err)
+	}
+	if _, err = m.Resolve(context.Background(), "vault:secret/data/llm#missing"); err == nil {
+		t.Fatal("expected error for missing field")
+	}
+
+	var notified atomic.Int32
+	m.Subscribe(func() { notified.Add(1) })
+	version.Store(2)
+	m.SetRefreshInterval(-1)
+	for _, e := range m.entries {
+		e.refreshAt = e.refreshAt.AddDate(-1, 0, 0)
+	}
+	m.RefreshDue(context.Background())
+	if got, _ = m.Resolve(context.Background(), ref); got != "sk-two" {
+		t.Fatalf("expected rotated value, got %q", got)
+	}
+	if notified.Load() != 1 {
+		t.Fatalf("expected one change notification, got %d", notified.Load())
+	}
+}
+
+type slowBackend struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (b *slowBackend) Scheme() string { return "slow" }
+
+func (b *slowBackend) Fetch(ctx context.Context, _, _ string) (Secret, error) {
+	b.calls.Add(1)
+	select {
+	case <-b.release:
+		return Secret{Value: "late-value"}, nil
+	case <-ctx.Done():
+		return Secret{}, ctx.Err()
+	}
+}
+
+func (b *slowBackend) Renew(_ context.Context, secret Secret) (Secret, error) { return secret, nil }
+
+func TestLookupDoesNotBlockOnSlowBackend(t *testing.T) {
+	backend := &slowBackend{release: make(chan struct{})}
+	m := NewManager()
+	m.Register(backend)
+	notified := make(chan struct{}, 1)
+	m.Subscribe(func() { notified <- struct{}{} })
+
+	start := time.Now()
+	if _, err := m.Lookup("slow:key"); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected ErrPending, got %v", err)
+	}
+	if waited := time.Since(start); waited > lookupWait+time.Second {
+		t.Fatalf("first lookup blocked for %s", waited)
+	}
+	start = time.Now()
+	if _, err := m.Lookup("slow:key"); !errors.Is(err, ErrPending) || time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("repeated lookup must return ErrPending at once, got %v after %s", err, time.Since(start))
+	}
+
+	close(backend.release)
+	select {
+	case <-notified:
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscribers were not notified when the value arrived")
+	}
+	if got, err := m.Lookup("slow:key"); err != nil || got != "late-value" {
+		t.Fatalf("expected the fetched value, got %q %v", got, err)
+	}
+	if backend.calls.Load() != 1 {
+		t.Fatalf("expected a single fetch, got %d", backend.calls.Load())
+	}
+}
+
+func TestAuthMetadataReferences(t *testing.T) {
+	t.Setenv("CLIPROXY_TEST_REFRESH", "rt-secret")
+	metadata := map[string]any{
+		"type":          "claude",
+		"refresh_token": "env:CLIPROXY_TEST_REFRESH",
+		"token":         map[string]any{"refresh_token": "env:CLIPROXY_TEST_REFRESH"},
+	}
+	attrs := map[string]string{}
+	if err := ResolveAuthMetadata(metadata, attrs); err != nil {
+		t.Fatalf("ResolveAuthMetadata: %v", err)
+	}
+	nested := metadata["token"].(map[string]any)
+	if metadata["refresh_token"] != "rt-secret" || nested["refresh_token"] != "rt-secret" {
+		t.Fatalf("references not resolved: %+v", metadata)
+	}
+
+	saved := RestoreAuthMetadata(metadata, attrs)
+	if saved["refresh_token"] != "env:CLIPROXY_TEST_REFRESH" || saved["token"].(map[string]any)["refresh_token"] != "env:CLIPROXY_TEST_REFRESH" {
+		t.Fatalf("references not restored for saving: %+v", saved)
+	}
+	if metadata["refresh_token"] != "rt-secret" || nested["refresh_token"] != "rt-secret" {
+		t.Fatal("restoring references changed the in-memory credential")
+	}
+
+	metadata["refresh_token"] = "rt-rotated"
+	saved = RestoreAuthMetadata(metadata, attrs)
+	if saved["refresh_token"] != "rt-rotated" || saved["token"].(map[string]any)["refresh_token"] != "env:CLIPROXY_TEST_REFRESH" {
+		t.Fatalf("rotated token must be saved as is: %+v", saved)
+	}
+	if _, kept := attrs["secret_ref:refresh_token"]; kept {
+		t.Fatal("reference of a rotated token must be dropped")
+	}
+}
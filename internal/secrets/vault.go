@@ -0,0 +1,176 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultOptions configures the HashiCorp Vault backend.
+type VaultOptions struct {
+	// Address is the Vault server URL, e.g. https://vault.example.com:8200.
+	Address string
+	// Token authenticates requests directly. TokenFile takes precedence when set.
+	Token string
+	// TokenFile is re-read on every request so tokens rotated by a Vault agent sink are picked up.
+	TokenFile string
+	// Namespace is sent as X-Vault-Namespace for Vault Enterprise.
+	Namespace string
+	// Timeout bounds each request. Defaults to 10s.
+	Timeout time.Duration
+}
+
+// VaultBackend reads KV (v1 and v2) and dynamic secrets through the Vault HTTP API.
+// References look like "vault:secret/data/cliproxy#openai" where the fragment names
+// the field inside the secret's data.
+type VaultBackend struct {
+	opts   VaultOptions
+	client *http.Client
+}
+
+// NewVaultBackend validates opts and returns a backend.
+func NewVaultBackend(opts VaultOptions) (*VaultBackend, error) {
+	opts.Address = strings.TrimRight(strings.TrimSpace(opts.Address), "/")
+	if opts.Address == "" {
+		return nil, fmt.Errorf("secrets: vault address is required")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &VaultBackend{opts: opts, client: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+// Scheme implements Backend.
+func (v *VaultBackend) Scheme() string { return "vault" }
+
+type vaultResponse struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int64          `json:"lease_duration"`
+	Renewable     bool           `json:"renewable"`
+	Data          map[string]any `json:"data"`
+	Errors        []string       `json:"errors"`
+}
+
+// Fetch implements Backend.
+func (v *VaultBackend) Fetch(ctx context.Context, path, field string) (Secret, error) {
+	var resp vaultResponse
+	if err := v.do(ctx, http.MethodGet, "/v1/"+path, nil, &resp); err != nil {
+		return Secret{}, err
+	}
+	data := resp.Data
+	// KV v2 nests the payload under data.data alongside version metadata.
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = nested
+		}
+	}
+	if field == "" {
+		if len(data) != 1 {
+			return Secret{}, fmt.Errorf("vault secret %s has %d fields; add #field to the reference", path, len(data))
+		}
+		for k := range data {
+			field = k
+		}
+	}
+	raw, ok := data[field]
+	if !ok {
+		return Secret{}, fmt.Errorf("vault secret %s has no field %q", path, field)
+	}
+	value, ok := raw.(string)
+	if !ok {
+		return Secret{}, fmt.Errorf("vault secret %s field %q is not a string", path, field)
+	}
+	return Secret{
+		Value:     value,
+		LeaseID:   resp.LeaseID,
+		TTL:       time.Duration(resp.LeaseDuration) * time.Second,
+		Renewable: resp.Renewable,
+	}, nil
+}
+
+// Renew implements Backend by extending the secret's lease.
+func (v *VaultBackend) Renew(ctx context.Context, secret Secret) (Secret, error) {
+	if secret.LeaseID == "" {
+		return secret, nil
+	}
+	body := map[string]any{"lease_id": secret.LeaseID}
+	if secret.TTL > 0 {
+		body["increment"] = int64(secret.TTL / time.Second)
+	}
+	var resp vaultResponse
+	if err := v.do(ctx, http.MethodPut, "/v1/sys/leases/renew", body, &resp); err != nil {
+		return secret, err
+	}
+	secret.TTL = time.Duration(resp.LeaseDuration) * time.Second
+	secret.Renewable = resp.Renewable
+	if resp.LeaseID != "" {
+		secret.LeaseID = resp.LeaseID
+	}
+	return secret, nil
+}
+
+func (v *VaultBackend) token() (string, error) {
+	if v.opts.TokenFile != "" {
+		data, err := os.ReadFile(v.opts.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("read vault token file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if v.opts.Token == "" {
+		return "", fmt.Errorf("vault token is not configured")
+	}
+	return v.opts.Token, nil
+}
+
+func (v *VaultBackend) do(ctx context.Context, method, path string, body any, out *vaultResponse) error {
+	token, err := v.token()
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		payload, errMarshal := json.Marshal(body)
+		if errMarshal != nil {
+			return errMarshal
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.opts.Address+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("X-Vault-Request", "true")
+	if v.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, out); err != nil && resp.StatusCode < 300 {
+		return fmt.Errorf("decode vault response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("vault %s %s: %d %s", method, path, resp.StatusCode, strings.Join(out.Errors, "; "))
+		}
+		return fmt.Errorf("vault %s %s: status %d", method, path, resp.StatusCode)
+	}
+	return nil
+}
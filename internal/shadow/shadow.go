@@ -0,0 +1,280 @@
+// Package shadow duplicates a sample of requests to a secondary model so operators
+// can compare models on real traffic. The duplicate runs after the primary request
+// has been dispatched and never affects the response returned to the client; both
+// results are handed to the registered recorder, which stores them side by side.
+package shadow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	defaultMaxConcurrent    = 4
+	defaultTimeout          = 120 * time.Second
+	defaultMaxResponseBytes = 64 << 10
+)
+
+// Rule is a compiled shadow rule.
+type Rule struct {
+	Name           string
+	Model          string
+	ShadowModel    string
+	ShadowProvider string
+	Percentage     float64
+}
+
+// Sampler decides which requests are shadowed and bounds how many run at once.
+type Sampler struct {
+	rules            []Rule
+	sem              chan struct{}
+	timeout          time.Duration
+	maxResponseBytes int
+	// roll returns a value in [0, 100); replaced in tests.
+	roll func() float64
+}
+
+var active atomic.Pointer[Sampler]
+
+// Compile builds a sampler from configuration, skipping incomplete rules.
+func Compile(cfg config.ShadowTrafficConfig) *Sampler {
+	s := &Sampler{
+		timeout:          defaultTimeout,
+		maxResponseBytes: defaultMaxResponseBytes,
+		roll:             func() float64 { return rand.Float64() * 100 },
+	}
+	maxConcurrent := defaultMaxConcurrent
+	if cfg.MaxConcurrent > 0 {
+		maxConcurrent = cfg.MaxConcurrent
+	}
+	s.sem = make(chan struct{}, maxConcurrent)
+	if cfg.TimeoutSeconds > 0 {
+		s.timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	if cfg.MaxResponseBytes > 0 {
+		s.maxResponseBytes = cfg.MaxResponseBytes
+	}
+	for _, r := range cfg.Rules {
+		model, shadowModel := strings.TrimSpace(r.Model), strings.TrimSpace(r.ShadowModel)
+		if model == "" || shadowModel == "" || r.Percentage <= 0 {
+			continue
+		}
+		name := strings.TrimSpace(r.Name)
+		if name == "" {
+			name = model + "->" + shadowModel
+		}
+		s.rules = append(s.rules, Rule{
+			Name:           name,
+			Model:          model,
+			ShadowModel:    shadowModel,
+			ShadowProvider: strings.ToLower(strings.TrimSpace(r.ShadowProvider)),
+			Percentage:     min(r.Percentage, 100),
+		})
+	}
+	return s
+}
+
+// Set replaces the active sampler.
+func Set(cfg config.ShadowTrafficConfig) {
+	if len(cfg.Rules) == 0 {
+		active.Store(nil)
+		return
+	}
+	active.Store(Compile(cfg))
+}
+
+// Active returns the active sampler or nil when no rules are configured.
+func Active() *Sampler {
+	s := active.Load()
+	if s == nil || len(s.rules) == 0 {
+		return nil
+	}
+	return s
+}
+
+// Match returns the first rule whose model equals model (case-insensitive) or is "*".
+func (s *Sampler) Match(model string) (Rule, bool) {
+	if s == nil {
+		return Rule{}, false
+	}
+	model = strings.TrimSpace(model)
+	for _, r := range s.rules {
+		if r.Model == "*" || strings.EqualFold(r.Model, model) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Sample matches model and rolls against the rule's percentage. A request is never
+// shadowed to the model it was routed to.
+func (s *Sampler) Sample(model string) (Rule, bool) {
+	r, ok := s.Match(model)
+	if !ok || (strings.EqualFold(r.ShadowModel, model) && r.ShadowProvider == "") {
+		return Rule{}, false
+	}
+	if r.Percentage < 100 && s.roll() >= r.Percentage {
+		return Rule{}, false
+	}
+	return r, true
+}
+
+// Acquire reserves a concurrency slot. It does not wait: when every slot is taken
+// the sample is skipped so shadow traffic cannot pile up behind a slow model.
+func (s *Sampler) Acquire() (release func(), ok bool) {
+	select {
+	case s.sem <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-s.sem }) }, true
+	default:
+		return nil, false
+	}
+}
+
+// Timeout bounds a single shadow request.
+func (s *Sampler) Timeout() time.Duration { return s.timeout }
+
+// MaxResponseBytes is the number of response bytes kept for each side.
+func (s *Sampler) MaxResponseBytes() int { return s.maxResponseBytes }
+
+// Result describes one side of a comparison.
+type Result struct {
+	Model        string
+	StatusCode   int
+	Latency      time.Duration
+	InputTokens  int64
+	OutputTokens int64
+	// Response is the (possibly truncated) response body or concatenated stream chunks.
+	Response string
+	Error    string
+}
+
+// Collector accumulates a response, whole or chunk by chunk, into a Result. Token
+// counts are read from every chunk while only the first limit bytes are kept.
+type Collector struct {
+	limit  int
+	buf    []byte
+	input  int64
+	output int64
+}
+
+// NewCollector returns a collector keeping at most limit response bytes.
+func NewCollector(limit int) *Collector {
+	return &Collector{limit: limit}
+}
+
+// Write adds a response body or stream chunk.
+func (c *Collector) Write(chunk []byte) {
+	input, output := ExtractTokens(chunk)
+	c.input, c.output = max(c.input, input), max(c.output, output)
+	if room := c.limit - len(c.buf); room > 0 {
+		c.buf = append(c.buf, chunk[:min(room, len(chunk))]...)
+	}
+}
+
+// Result builds the result for model from the collected response.
+func (c *Collector) Result(model string, status int, latency time.Duration, err error) Result {
+	res := Result{
+		Model:        model,
+		StatusCode:   status,
+		Latency:      latency,
+		InputTokens:  c.input,
+		OutputTokens: c.output,
+		Response:     strings.ToValidUTF8(string(c.buf), ""),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Comparison pairs the primary and shadow results of one request.
+type Comparison struct {
+	Rule      string
+	RequestID string
+	// APIKey is the client key of the primary request; recorders store only its hash.
+	APIKey    string
+	Timestamp time.Time
+	Primary   Result
+	Shadow    Result
+}
+
+// Recorder persists a finished comparison.
+type Recorder func(ctx context.Context, c Comparison)
+
+var recorder atomic.Pointer[Recorder]
+
+// RegisterRecorder installs the function that stores comparisons.
+func RegisterRecorder(r Recorder) {
+	if r == nil {
+		recorder.Store(nil)
+		return
+	}
+	recorder.Store(&r)
+}
+
+// Record hands c to the registered recorder, if any.
+func Record(ctx context.Context, c Comparison) {
+	if r := recorder.Load(); r != nil {
+		(*r)(ctx, c)
+	}
+}
+
+var (
+	inputTokenPaths = []string{
+		"usage.prompt_tokens",
+		"usage.input_tokens",
+		"message.usage.input_tokens",
+		"response.usage.input_tokens",
+		"usageMetadata.promptTokenCount",
+		"response.usageMetadata.promptTokenCount",
+	}
+	outputTokenPaths = []string{
+		"usage.completion_tokens",
+		"usage.output_tokens",
+		"message.usage.output_tokens",
+		"response.usage.output_tokens",
+		"usageMetadata.candidatesTokenCount",
+		"response.usageMetadata.candidatesTokenCount",
+	}
+)
+
+// ExtractTokens returns the input and output token counts reported in an OpenAI,
+// Claude or Gemini response. Streams are scanned chunk by chunk (SSE "data:" lines or
+// newline-delimited JSON) and the largest count wins, since providers report running
+// totals.
+func ExtractTokens(payload []byte) (input, output int64) {
+	scan := func(doc []byte) {
+		for _, path := range inputTokenPaths {
+			input = max(input, gjson.GetBytes(doc, path).Int())
+		}
+		for _, path := range outputTokenPaths {
+			output = max(output, gjson.GetBytes(doc, path).Int())
+		}
+	}
+	trimmed := bytes.TrimSpace(payload)
+	if gjson.ValidBytes(trimmed) {
+		scan(trimmed)
+		return input, output
+	}
+	sc := bufio.NewScanner(bytes.NewReader(payload))
+	sc.Buffer(make([]byte, 0, 64<<10), len(payload)+1)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		line = bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		scan(line)
+	}
+	return input, output
+}
@@ -0,0 +1,86 @@
+package shadow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestSamplerMatchesAndSamples(t *testing.T) {
+	s := Compile(config.ShadowTrafficConfig{Rules: []config.ShadowRule{
+		{Model: "gpt-4o", ShadowModel: "claude-sonnet-4", Percentage: 25},
+		{Model: "disabled", ShadowModel: "x", Percentage: 0},
+		{Name: "catch-all", Model: "*", ShadowModel: "gemini-2.5-flash", Percentage: 100},
+	}})
+
+	rolls := []float64{10, 40}
+	s.roll = func() float64 {
+		v := rolls[0]
+		rolls = rolls[1:]
+		return v
+	}
+	r, ok := s.Sample("GPT-4o")
+	if !ok || r.Name != "gpt-4o->claude-sonnet-4" || r.ShadowModel != "claude-sonnet-4" {
+		t.Fatalf("expected the first rule to sample a roll under 25, got %+v %v", r, ok)
+	}
+	if _, ok = s.Sample("gpt-4o"); ok {
+		t.Fatal("expected a roll over the percentage to be skipped")
+	}
+	if r, ok = s.Sample("disabled"); !ok || r.Name != "catch-all" {
+		t.Fatalf("expected rules with zero percentage to be dropped, got %+v %v", r, ok)
+	}
+	if _, ok = s.Sample("gemini-2.5-flash"); ok {
+		t.Fatal("expected a request not to be shadowed to its own model")
+	}
+}
+
+func TestSamplerAcquireSkipsWhenFull(t *testing.T) {
+	s := Compile(config.ShadowTrafficConfig{MaxConcurrent: 1, TimeoutSeconds: 5})
+	if s.Timeout() != 5*time.Second || s.MaxResponseBytes() != defaultMaxResponseBytes {
+		t.Fatalf("unexpected limits: %v %d", s.Timeout(), s.MaxResponseBytes())
+	}
+	release, ok := s.Acquire()
+	if !ok {
+		t.Fatal("expected the first slot to be free")
+	}
+	if _, ok = s.Acquire(); ok {
+		t.Fatal("expected a second shadow to be skipped")
+	}
+	release()
+	release()
+	if _, ok = s.Acquire(); !ok {
+		t.Fatal("expected the slot to be free after release")
+	}
+}
+
+func TestExtractTokens(t *testing.T) {
+	cases := []struct {
+		name          string
+		payload       string
+		input, output int64
+	}{
+		{"openai", `{"usage":{"prompt_tokens":12,"completion_tokens":30}}`, 12, 30},
+		{"claude", `{"usage":{"input_tokens":7,"output_tokens":9}}`, 7, 9},
+		{"gemini", `{"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":5}}`, 4, 5},
+		{"claude stream", "event: message_start\ndata: {\"message\":{\"usage\":{\"input_tokens\":20,\"output_tokens\":1}}}\n\n" +
+			"event: message_delta\ndata: {\"usage\":{\"output_tokens\":42}}\n\n", 20, 42},
+		{"openai stream", "data: {\"choices\":[]}\n\ndata: {\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":8}}\n\ndata: [DONE]\n", 3, 8},
+		{"none", `not json`, 0, 0},
+	}
+	for _, tc := range cases {
+		if input, output := ExtractTokens([]byte(tc.payload)); input != tc.input || output != tc.output {
+			t.Errorf("%s: got %d/%d, want %d/%d", tc.name, input, output, tc.input, tc.output)
+		}
+	}
+}
+
+func TestCollectorTruncatesButCountsEveryChunk(t *testing.T) {
+	c := NewCollector(8)
+	c.Write([]byte(`data: {"usage":{"prompt_tokens":3}}`))
+	c.Write([]byte(`data: {"usage":{"completion_tokens":11}}`))
+	res := c.Result("m", 200, time.Second, nil)
+	if res.Response != "data: {\"" || res.InputTokens != 3 || res.OutputTokens != 11 || res.Error != "" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
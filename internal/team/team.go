@@ -0,0 +1,121 @@
+// Package team resolves the team a client API key belongs to and enforces the
+// per-team request quota. Teams are swapped atomically on config reload; quota
+// buckets of teams whose limit is unchanged carry over.
+package team
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// RejectionRateLimited marks requests rejected because their team exceeded its
+// requests-per-minute quota.
+const RejectionRateLimited = "team_rate_limited"
+
+// Directory maps client API keys to team names and holds the team quotas.
+type Directory struct {
+	byKey  map[string]string
+	quotas map[string]*quota
+}
+
+// quota is a token bucket refilled at perMinute tokens per minute, holding at most
+// perMinute tokens.
+type quota struct {
+	perMinute int
+	mu        sync.Mutex
+	tokens    float64
+	last      time.Time
+}
+
+var active atomic.Pointer[Directory]
+
+// Build constructs a directory from configuration. Keys listed under several teams
+// keep their first assignment; previous carries the quota state of unchanged teams.
+func Build(teams []config.Team, previous *Directory) *Directory {
+	dir := &Directory{byKey: make(map[string]string), quotas: make(map[string]*quota)}
+	for i := range teams {
+		name := strings.TrimSpace(teams[i].Name)
+		if name == "" {
+			continue
+		}
+		for _, key := range teams[i].APIKeys {
+			key = strings.TrimSpace(key)
+			if _, assigned := dir.byKey[key]; key == "" || assigned {
+				continue
+			}
+			dir.byKey[key] = name
+		}
+		if perMinute := teams[i].RequestsPerMinute; perMinute > 0 {
+			if prev := previous.quota(name); prev != nil && prev.perMinute == perMinute {
+				dir.quotas[name] = prev
+			} else {
+				dir.quotas[name] = &quota{perMinute: perMinute, tokens: float64(perMinute)}
+			}
+		}
+	}
+	return dir
+}
+
+// Set replaces the active team directory.
+func Set(teams []config.Team) {
+	if len(teams) == 0 {
+		active.Store(nil)
+		return
+	}
+	active.Store(Build(teams, active.Load()))
+}
+
+// Lookup returns the team of apiKey with the active directory, or "" when the key
+// belongs to no team.
+func Lookup(apiKey string) string {
+	return active.Load().Lookup(apiKey)
+}
+
+// Lookup returns the team owning apiKey, or "" when it is unassigned.
+func (d *Directory) Lookup(apiKey string) string {
+	if d == nil {
+		return ""
+	}
+	return d.byKey[strings.TrimSpace(apiKey)]
+}
+
+func (d *Directory) quota(name string) *quota {
+	if d == nil {
+		return nil
+	}
+	return d.quotas[name]
+}
+
+// Allow takes one request from the quota of apiKey's team. It reports the team, and
+// when the quota is exhausted false with the time until the next request is allowed.
+// Keys without a team or whose team has no quota are always allowed.
+func (d *Directory) Allow(apiKey string, now time.Time) (string, bool, time.Duration) {
+	name := d.Lookup(apiKey)
+	q := d.quota(name)
+	if q == nil {
+		return name, true, 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rate := float64(q.perMinute) / 60
+	if !q.last.IsZero() {
+		if elapsed := now.Sub(q.last).Seconds(); elapsed > 0 {
+			q.tokens = min(float64(q.perMinute), q.tokens+elapsed*rate)
+		}
+	}
+	q.last = now
+	if q.tokens >= 1 {
+		q.tokens--
+		return name, true, 0
+	}
+	return name, false, time.Duration((1 - q.tokens) / rate * float64(time.Second))
+}
+
+// Active returns the active directory, or nil when no teams are configured.
+func Active() *Directory {
+	return active.Load()
+}
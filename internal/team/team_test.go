@@ -0,0 +1,57 @@
+package team
+
+import (
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestBuildLookup(t *testing.T) {
+	dir := Build([]config.Team{
+		{Name: "research", APIKeys: []string{"sk-a", " sk-b "}},
+		{Name: "ops", APIKeys: []string{"sk-b", "sk-c"}},
+		{Name: " ", APIKeys: []string{"sk-d"}},
+	}, nil)
+	cases := map[string]string{"sk-a": "research", "sk-b": "research", "sk-c": "ops", "sk-d": "", "sk-x": ""}
+	for key, want := range cases {
+		if got := dir.Lookup(key); got != want {
+			t.Errorf("Lookup(%q) = %q, want %q", key, got, want)
+		}
+	}
+	var nilDir *Directory
+	if got := nilDir.Lookup("sk-a"); got != "" {
+		t.Fatalf("nil directory resolved %q", got)
+	}
+}
+
+func TestAllowQuota(t *testing.T) {
+	teams := []config.Team{{Name: "research", APIKeys: []string{"sk-a", "sk-b"}, RequestsPerMinute: 2}}
+	dir := Build(teams, nil)
+	now := time.Now()
+	for _, key := range []string{"sk-a", "sk-b"} {
+		if name, ok, _ := dir.Allow(key, now); !ok || name != "research" {
+			t.Fatalf("expected %s to be allowed within the team quota, got %q %v", key, name, ok)
+		}
+	}
+	_, ok, wait := dir.Allow("sk-a", now)
+	if ok || wait <= 0 || wait > 30*time.Second {
+		t.Fatalf("expected the shared quota to be exhausted with a wait up to 30s, got %v %s", ok, wait)
+	}
+	if _, ok, _ = dir.Allow("sk-other", now); !ok {
+		t.Fatal("keys outside any team must not be limited")
+	}
+	if _, ok, _ = dir.Allow("sk-b", now.Add(30*time.Second)); !ok {
+		t.Fatal("expected one request to be allowed after half a minute")
+	}
+
+	// Reloading with the same limit keeps the bucket; a new limit starts afresh.
+	kept := Build(teams, dir)
+	if _, ok, _ = kept.Allow("sk-a", now.Add(30*time.Second)); ok {
+		t.Fatal("expected the quota state to carry over an unchanged reload")
+	}
+	teams[0].RequestsPerMinute = 5
+	if _, ok, _ = Build(teams, dir).Allow("sk-a", now.Add(30*time.Second)); !ok {
+		t.Fatal("expected a changed limit to start with a full bucket")
+	}
+}
@@ -0,0 +1,245 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+)
+
+const (
+	// DefaultEndpoint is the OTLP/HTTP traces endpoint used when none is configured.
+	DefaultEndpoint = "http://127.0.0.1:4318/v1/traces"
+
+	serviceName     = "cli-proxy-api"
+	scopeName       = "github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+	exportBatchSize = 64
+	exportInterval  = 5 * time.Second
+	exportQueueSize = 1024
+)
+
+type exporter struct {
+	enabled  atomic.Bool
+	endpoint atomic.Pointer[string]
+	resource atomic.Pointer[map[string]any]
+	client   *http.Client
+	queue    chan *Span
+	once     sync.Once
+}
+
+var defaultExporter = newExporter()
+
+func newExporter() *exporter {
+	e := &exporter{
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan *Span, exportQueueSize),
+	}
+	endpoint := strings.TrimSpace(os.Getenv("DY_NOTI_OTEL_TRACES_ENDPOINT"))
+	if endpoint == "" {
+		endpoint = TracesEndpointFromLogs(os.Getenv("DY_NOTI_OTEL_ENDPOINT"))
+	}
+	e.endpoint.Store(&endpoint)
+	e.enabled.Store(true)
+	e.setResource(nil)
+	return e
+}
+
+// SetEnabled toggles span export. Spans are still created for header propagation when disabled.
+func SetEnabled(enabled bool) { defaultExporter.enabled.Store(enabled) }
+
+// Enabled reports whether span export is active.
+func Enabled() bool { return defaultExporter.enabled.Load() }
+
+// SetEndpoint overrides the OTLP/HTTP traces endpoint.
+func SetEndpoint(endpoint string) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	defaultExporter.endpoint.Store(&endpoint)
+}
+
+// Endpoint returns the active OTLP/HTTP traces endpoint.
+func Endpoint() string { return *defaultExporter.endpoint.Load() }
+
+// SetResourceAttributes replaces the resource attributes attached to exported spans.
+// service.name defaults to cli-proxy-api.
+func SetResourceAttributes(attrs map[string]string) { defaultExporter.setResource(attrs) }
+
+func (e *exporter) setResource(attrs map[string]string) {
+	resource := map[string]any{"service.name": serviceName}
+	for key, value := range attrs {
+		resource[key] = value
+	}
+	e.resource.Store(&resource)
+}
+
+// TracesEndpointFromLogs derives the traces endpoint from an OTLP logs endpoint
+// by swapping the conventional /v1/logs suffix for /v1/traces.
+func TracesEndpointFromLogs(logsEndpoint string) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(logsEndpoint), "/")
+	if trimmed == "" {
+		return DefaultEndpoint
+	}
+	if strings.HasSuffix(trimmed, "/v1/logs") {
+		return strings.TrimSuffix(trimmed, "/v1/logs") + "/v1/traces"
+	}
+	if strings.HasSuffix(trimmed, "/v1/traces") {
+		return trimmed
+	}
+	return trimmed + "/v1/traces"
+}
+
+func (e *exporter) enqueue(span *Span) {
+	if !e.enabled.Load() {
+		return
+	}
+	e.once.Do(func() { go e.run() })
+	select {
+	case e.queue <- span:
+	default:
+		util.ComponentLog(util.LogComponentOTLP).Debug("tracing: export queue full, dropping span")
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, exportBatchSize)
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) < exportBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := e.export(batch); err != nil {
+			util.ComponentLog(util.LogComponentOTLP).Debugf("tracing: export failed: %v", err)
+		}
+		batch = make([]*Span, 0, exportBatchSize)
+	}
+}
+
+func (e *exporter) export(spans []*Span) error {
+	if len(spans) == 0 || !e.enabled.Load() {
+		return nil
+	}
+	payload, err := json.Marshal(buildPayload(spans, *e.resource.Load()))
+	if err != nil {
+		return fmt.Errorf("marshal spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, Endpoint(), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CLIProxyAPI-OTLP-Exporter/1.0")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+	return nil
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            map[string]any  `json:"status,omitempty"`
+}
+
+func buildPayload(spans []*Span, resource map[string]any) map[string]any {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		item := otlpSpan{
+			TraceID:           s.ctx.TraceIDString(),
+			SpanID:            s.ctx.SpanIDString(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        encodeAttributes(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			item.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.errorMsg != "" {
+			item.Status = map[string]any{"code": 2, "message": s.errorMsg}
+		}
+		s.mu.Unlock()
+		out = append(out, item)
+	}
+	return map[string]any{
+		"resourceSpans": []any{
+			map[string]any{
+				"resource": map[string]any{
+					"attributes": encodeAttributes(resource),
+				},
+				"scopeSpans": []any{
+					map[string]any{
+						"scope": map[string]any{"name": scopeName},
+						"spans": out,
+					},
+				},
+			},
+		},
+	}
+}
+
+func encodeAttributes(attrs map[string]any) []otlpAttribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]otlpAttribute, 0, len(attrs))
+	for key, value := range attrs {
+		var encoded map[string]any
+		switch v := value.(type) {
+		case string:
+			encoded = map[string]any{"stringValue": v}
+		case bool:
+			encoded = map[string]any{"boolValue": v}
+		case int:
+			encoded = map[string]any{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int64:
+			encoded = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case uint64:
+			encoded = map[string]any{"intValue": strconv.FormatUint(v, 10)}
+		case float64:
+			encoded = map[string]any{"doubleValue": v}
+		default:
+			encoded = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, otlpAttribute{Key: key, Value: encoded})
+	}
+	return out
+}
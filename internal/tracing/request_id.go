@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the per-request correlation identifier.
+const RequestIDHeader = "X-Request-ID"
+
+// ginRequestIDKey stores the correlation identifier in the Gin context.
+const ginRequestIDKey = "cliproxy.request_id"
+
+// maxRequestIDLength bounds client-supplied identifiers so they cannot bloat logs.
+const maxRequestIDLength = 128
+
+// ResolveRequestID returns the client-supplied identifier when it is usable and
+// generates a fresh UUID otherwise. Identifiers must be printable ASCII without
+// spaces so they can be echoed into headers and log lines verbatim.
+func ResolveRequestID(inbound string) string {
+	if validRequestID(inbound) {
+		return inbound
+	}
+	return uuid.NewString()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetGinRequestID records the correlation identifier on the Gin context.
+func SetGinRequestID(c *gin.Context, id string) {
+	if c == nil || id == "" {
+		return
+	}
+	c.Set(ginRequestIDKey, id)
+}
+
+// GinRequestID returns the correlation identifier stored in the Gin context, if any.
+func GinRequestID(c *gin.Context) string {
+	if c == nil {
+		return ""
+	}
+	return c.GetString(ginRequestIDKey)
+}
+
+// RequestIDFromContext resolves the correlation identifier from a context carrying the Gin context.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil {
+		return ""
+	}
+	return GinRequestID(ginCtx)
+}
@@ -0,0 +1,201 @@
+// Package tracing emits lightweight OpenTelemetry-compatible spans for proxied
+// requests. It implements W3C trace context propagation (traceparent) and exports
+// finished spans to an OTLP/HTTP JSON collector without pulling in the full SDK.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TraceparentHeader is the W3C trace context propagation header.
+const TraceparentHeader = "traceparent"
+
+// ginSpanKey stores the active request span in the Gin context.
+const ginSpanKey = "cliproxy.trace_span"
+
+// SpanKind mirrors the OTLP span kind enumeration.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether both trace and span identifiers are non-zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceIDString returns the hex-encoded trace identifier.
+func (sc SpanContext) TraceIDString() string { return hex.EncodeToString(sc.TraceID[:]) }
+
+// SpanIDString returns the hex-encoded span identifier.
+func (sc SpanContext) SpanIDString() string { return hex.EncodeToString(sc.SpanID[:]) }
+
+// Traceparent formats the span context as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceIDString(), sc.SpanIDString(), flags)
+}
+
+// ParseTraceparent decodes a W3C traceparent header value.
+// It returns false when the value is malformed or carries all-zero identifiers.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Span records timing and attributes for a single unit of work.
+type Span struct {
+	name     string
+	kind     SpanKind
+	ctx      SpanContext
+	parentID [8]byte
+	start    time.Time
+
+	mu       sync.Mutex
+	end      time.Time
+	attrs    map[string]any
+	errorMsg string
+	ended    bool
+}
+
+// StartSpan begins a new span. When parent is valid the span joins its trace,
+// otherwise a new trace is started.
+func StartSpan(name string, kind SpanKind, parent SpanContext) *Span {
+	s := &Span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+		attrs: make(map[string]any),
+	}
+	if parent.IsValid() {
+		s.ctx.TraceID = parent.TraceID
+		s.ctx.Sampled = parent.Sampled
+		s.parentID = parent.SpanID
+	} else {
+		_, _ = rand.Read(s.ctx.TraceID[:])
+		s.ctx.Sampled = true
+	}
+	_, _ = rand.Read(s.ctx.SpanID[:])
+	return s
+}
+
+// Context returns the span's identifiers.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetAttribute attaches a key/value pair to the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil || key == "" {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed with the provided error message.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errorMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End finalizes the span and hands it to the exporter. Subsequent calls are no-ops.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.ctx.Sampled {
+		defaultExporter.enqueue(s)
+	}
+}
+
+// SetGinSpan stores the active request span in the Gin context.
+func SetGinSpan(c *gin.Context, span *Span) {
+	if c == nil || span == nil {
+		return
+	}
+	c.Set(ginSpanKey, span)
+}
+
+// GinSpan returns the active request span stored in the Gin context, if any.
+func GinSpan(c *gin.Context) *Span {
+	if c == nil {
+		return nil
+	}
+	v, ok := c.Get(ginSpanKey)
+	if !ok {
+		return nil
+	}
+	span, _ := v.(*Span)
+	return span
+}
+
+// SpanFromContext resolves the active request span from a context carrying the Gin context.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil {
+		return nil
+	}
+	return GinSpan(ginCtx)
+}
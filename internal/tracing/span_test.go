@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseTraceparentRoundTrip(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(header)
+	if !ok {
+		t.Fatalf("expected valid traceparent")
+	}
+	if got := sc.Traceparent(); got != header {
+		t.Fatalf("round trip mismatch: got %s want %s", got, header)
+	}
+
+	invalid := []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-zzzzzzzzzzzzzzzz-01",
+	}
+	for _, value := range invalid {
+		if _, ok := ParseTraceparent(value); ok {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestTransportPropagatesTraceparent(t *testing.T) {
+	SetEnabled(false)
+	defer SetEnabled(true)
+
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceparentHeader)
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	root := StartSpan("root", SpanKindServer, SpanContext{})
+	SetGinSpan(ginCtx, root)
+	ctx := context.WithValue(context.Background(), "gin", ginCtx)
+
+	client := &http.Client{Transport: WrapTransport(nil, "claude")}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	child, ok := ParseTraceparent(received)
+	if !ok {
+		t.Fatalf("upstream did not receive a valid traceparent: %q", received)
+	}
+	if child.TraceID != root.Context().TraceID {
+		t.Fatalf("expected upstream span to share trace id")
+	}
+	if child.SpanID == root.Context().SpanID {
+		t.Fatalf("expected upstream span to have its own span id")
+	}
+}
+
+func TestTracesEndpointFromLogs(t *testing.T) {
+	cases := map[string]string{
+		"":                                 DefaultEndpoint,
+		"http://collector:4318/v1/logs":    "http://collector:4318/v1/traces",
+		"http://collector:4318/v1/traces/": "http://collector:4318/v1/traces",
+		"http://collector:4318":            "http://collector:4318/v1/traces",
+	}
+	for in, want := range cases {
+		if got := TracesEndpointFromLogs(in); !strings.EqualFold(got, want) {
+			t.Fatalf("TracesEndpointFromLogs(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestResolveRequestID(t *testing.T) {
+	if got := ResolveRequestID("client-abc_123"); got != "client-abc_123" {
+		t.Fatalf("expected inbound id to be honoured, got %q", got)
+	}
+	for _, inbound := range []string{"", "has space", "line\nbreak", strings.Repeat("x", maxRequestIDLength+1)} {
+		got := ResolveRequestID(inbound)
+		if got == inbound || !validRequestID(got) {
+			t.Fatalf("expected a generated id for %q, got %q", inbound, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Transport wraps an http.RoundTripper, emitting a client span per upstream call
+// and propagating the trace via the traceparent header. The span stays open until
+// the response body is fully consumed or closed so streaming time is captured.
+type Transport struct {
+	Base     http.RoundTripper
+	Provider string
+}
+
+// WrapTransport decorates base with upstream span instrumentation.
+func WrapTransport(base http.RoundTripper, provider string) http.RoundTripper {
+	if _, ok := base.(*Transport); ok {
+		return base
+	}
+	return &Transport{Base: base, Provider: provider}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	parent := SpanFromContext(req.Context())
+	if parent == nil {
+		return base.RoundTrip(req)
+	}
+
+	span := StartSpan("upstream "+req.Method, SpanKindClient, parent.Context())
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Host)
+	span.SetAttribute("url.path", req.URL.Path)
+	if t.Provider != "" {
+		span.SetAttribute("cliproxy.provider", t.Provider)
+	}
+
+	outbound := req.Clone(req.Context())
+	outbound.Header.Set(TraceparentHeader, span.Context().Traceparent())
+
+	resp, err := base.RoundTrip(outbound)
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		span.End()
+		return resp, nil
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
+
+// spanBody ends the upstream span once the body reaches EOF or is closed.
+type spanBody struct {
+	io.ReadCloser
+	span  *Span
+	bytes int64
+	once  sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	if err == io.EOF {
+		b.finish(nil)
+	} else if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish(nil)
+	return err
+}
+
+func (b *spanBody) finish(err error) {
+	b.once.Do(func() {
+		b.span.SetAttribute("http.response.body.size", b.bytes)
+		b.span.RecordError(err)
+		b.span.End()
+	})
+}
@@ -7,6 +7,8 @@ package claude
 
 import (
 	"bytes"
+	"mime"
+	"path"
 	"strings"
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/translator/gemini/common"
@@ -65,6 +67,7 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, _
 	contentsJSON := "[]"
 	hasContents := false
 	messagesResult := gjson.GetBytes(rawJSON, "messages")
+	toolNames := common.ClaudeToolUseNames(messagesResult)
 	if messagesResult.IsArray() {
 		messageResults := messagesResult.Array()
 		for i := 0; i < len(messageResults); i++ {
@@ -130,10 +133,13 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, _
 					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "tool_result" {
 						toolCallID := contentResult.Get("tool_use_id").String()
 						if toolCallID != "" {
-							funcName := toolCallID
-							toolCallIDs := strings.Split(toolCallID, "-")
-							if len(toolCallIDs) > 1 {
-								funcName = strings.Join(toolCallIDs[0:len(toolCallIDs)-2], "-")
+							funcName, ok := toolNames[toolCallID]
+							if !ok {
+								funcName = toolCallID
+								toolCallIDs := strings.Split(toolCallID, "-")
+								if len(toolCallIDs) > 1 {
+									funcName = strings.Join(toolCallIDs[0:len(toolCallIDs)-2], "-")
+								}
 							}
 							functionResponseResult := contentResult.Get("content")
 
@@ -163,9 +169,26 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, _
 							partJSON, _ = sjson.SetRaw(partJSON, "functionResponse", functionResponseJSON)
 							clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
 						}
-					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "image" {
+					} else if contentTypeResult.Type == gjson.String && (contentTypeResult.String() == "image" || contentTypeResult.String() == "document") {
 						sourceResult := contentResult.Get("source")
-						if sourceResult.Get("type").String() == "base64" {
+						switch sourceResult.Get("type").String() {
+						case "url":
+							uri := sourceResult.Get("url").String()
+							mimeType := "image/jpeg"
+							if contentTypeResult.String() == "document" {
+								mimeType = "application/pdf"
+							} else if byExt := mime.TypeByExtension(path.Ext(strings.SplitN(uri, "?", 2)[0])); strings.HasPrefix(byExt, "image/") {
+								mimeType = byExt
+							}
+							partJSON := `{"fileData":{"mimeType":"","fileUri":""}}`
+							partJSON, _ = sjson.Set(partJSON, "fileData.mimeType", mimeType)
+							partJSON, _ = sjson.Set(partJSON, "fileData.fileUri", uri)
+							clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
+						case "text":
+							partJSON := `{}`
+							partJSON, _ = sjson.Set(partJSON, "text", sourceResult.Get("data").String())
+							clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
+						case "base64":
 							inlineDataJSON := `{}`
 							if mimeType := sourceResult.Get("media_type").String(); mimeType != "" {
 								inlineDataJSON, _ = sjson.Set(inlineDataJSON, "mime_type", mimeType)
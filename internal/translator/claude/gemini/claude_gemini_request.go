@@ -81,9 +81,10 @@ func ConvertGeminiRequestToClaude(modelName string, inputRawJSON []byte, stream
 
 	// FIFO queue to store tool call IDs for matching with tool results
 	// Gemini uses sequential pairing across possibly multiple in-flight
-	// functionCalls, so we keep a FIFO queue of generated tool IDs and
-	// consume them in order when functionResponses arrive.
-	var pendingToolIDs []string
+	// functionCalls, so we keep a FIFO queue of tool IDs and consume them
+	// when functionResponses arrive, preferring the call with the same ID
+	// or function name.
+	var pendingToolIDs []util.PendingToolCall
 
 	// Model mapping to specify which Claude Code model to use
 	out, _ = sjson.Set(out, "model", modelName)
@@ -185,10 +186,13 @@ func ConvertGeminiRequestToClaude(modelName string, inputRawJSON []byte, stream
 					if fc := part.Get("functionCall"); fc.Exists() && role == "assistant" {
 						toolUse := `{"type":"tool_use","id":"","name":"","input":{}}`
 
-						// Generate a unique tool ID and enqueue it for later matching
-						// with the corresponding functionResponse
-						toolID := genToolCallID()
-						pendingToolIDs = append(pendingToolIDs, toolID)
+						// Keep the call ID or generate a unique one, and enqueue it for
+						// later matching with the corresponding functionResponse
+						toolID := fc.Get("id").String()
+						if toolID == "" {
+							toolID = genToolCallID()
+						}
+						pendingToolIDs = append(pendingToolIDs, util.PendingToolCall{ID: toolID, Name: fc.Get("name").String()})
 						toolUse, _ = sjson.Set(toolUse, "id", toolID)
 
 						if name := fc.Get("name"); name.Exists() {
@@ -205,14 +209,11 @@ func ConvertGeminiRequestToClaude(modelName string, inputRawJSON []byte, stream
 					if fr := part.Get("functionResponse"); fr.Exists() {
 						toolResult := `{"type":"tool_result","tool_use_id":"","content":""}`
 
-						// Attach the oldest queued tool_id to pair the response
-						// with its call. If the queue is empty, generate a new id.
+						// Attach the queued tool_id of the call this response answers.
+						// If the queue is empty, generate a new id.
 						var toolID string
-						if len(pendingToolIDs) > 0 {
-							toolID = pendingToolIDs[0]
-							// Pop the first element from the queue
-							pendingToolIDs = pendingToolIDs[1:]
-						} else {
+						toolID, pendingToolIDs = util.TakePendingToolCall(pendingToolIDs, fr.Get("id").String(), fr.Get("name").String())
+						if toolID == "" {
 							// Fallback: generate new ID if no pending tool_use found
 							toolID = genToolCallID()
 						}
@@ -228,29 +229,9 @@ func ConvertGeminiRequestToClaude(modelName string, inputRawJSON []byte, stream
 						return true
 					}
 
-					// Image content (inline_data) conversion to Claude Code format
-					if inlineData := part.Get("inline_data"); inlineData.Exists() {
-						imageContent := `{"type":"image","source":{"type":"base64","media_type":"","data":""}}`
-						if mimeType := inlineData.Get("mime_type"); mimeType.Exists() {
-							imageContent, _ = sjson.Set(imageContent, "source.media_type", mimeType.String())
-						}
-						if data := inlineData.Get("data"); data.Exists() {
-							imageContent, _ = sjson.Set(imageContent, "source.data", data.String())
-						}
-						msg, _ = sjson.SetRaw(msg, "content.-1", imageContent)
-						return true
-					}
-
-					// File data conversion to text content with file info
-					if fileData := part.Get("file_data"); fileData.Exists() {
-						// For file data, we'll convert to text content with file info
-						textContent := `{"type":"text","text":""}`
-						fileInfo := "File: " + fileData.Get("file_uri").String()
-						if mimeType := fileData.Get("mime_type"); mimeType.Exists() {
-							fileInfo += " (Type: " + mimeType.String() + ")"
-						}
-						textContent, _ = sjson.Set(textContent, "text", fileInfo)
-						msg, _ = sjson.SetRaw(msg, "content.-1", textContent)
+					// Inline data (images, PDFs) and file data conversion to Claude Code blocks
+					if block, ok := geminiMediaBlock(part); ok {
+						msg, _ = sjson.SetRaw(msg, "content.-1", block)
 						return true
 					}
 
@@ -309,16 +290,25 @@ func ConvertGeminiRequestToClaude(modelName string, inputRawJSON []byte, stream
 	}
 
 	// Tool config mapping from Gemini format to Claude Code format
-	if toolConfig := root.Get("tool_config"); toolConfig.Exists() {
-		if funcCalling := toolConfig.Get("function_calling_config"); funcCalling.Exists() {
+	// Gemini may provide `tool_config` or `toolConfig`; support both keys.
+	toolConfig := util.FirstExisting(root, "tool_config", "toolConfig")
+	if toolConfig.Exists() {
+		funcCalling := util.FirstExisting(toolConfig, "function_calling_config", "functionCallingConfig")
+		if funcCalling.Exists() {
+			allowed := util.FirstExisting(funcCalling, "allowed_function_names", "allowedFunctionNames")
 			if mode := funcCalling.Get("mode"); mode.Exists() {
-				switch mode.String() {
-				case "AUTO":
+				switch strings.ToUpper(mode.String()) {
+				case "AUTO", "VALIDATED":
 					out, _ = sjson.Set(out, "tool_choice", map[string]interface{}{"type": "auto"})
 				case "NONE":
 					out, _ = sjson.Set(out, "tool_choice", map[string]interface{}{"type": "none"})
 				case "ANY":
-					out, _ = sjson.Set(out, "tool_choice", map[string]interface{}{"type": "any"})
+					// A single allowed function forces that tool
+					if names := allowed.Array(); len(names) == 1 {
+						out, _ = sjson.Set(out, "tool_choice", map[string]interface{}{"type": "tool", "name": names[0].String()})
+					} else {
+						out, _ = sjson.Set(out, "tool_choice", map[string]interface{}{"type": "any"})
+					}
 				}
 			}
 		}
@@ -338,3 +328,49 @@ func ConvertGeminiRequestToClaude(modelName string, inputRawJSON []byte, stream
 
 	return []byte(out)
 }
+
+// geminiMediaBlock converts a Gemini inlineData or fileData part into a Claude
+// content block. Inline images become image blocks and inline PDFs document blocks;
+// http(s) file URIs of images and PDFs become URL sources. Other file URIs, which
+// Claude cannot fetch, are passed as a text note.
+func geminiMediaBlock(part gjson.Result) (string, bool) {
+	if inlineData := util.FirstExisting(part, "inline_data", "inlineData"); inlineData.Exists() {
+		mimeType := util.FirstExisting(inlineData, "mime_type", "mimeType").String()
+		blockType := "image"
+		if mimeType == "application/pdf" {
+			blockType = "document"
+		}
+		block := `{"type":"","source":{"type":"base64","media_type":"","data":""}}`
+		block, _ = sjson.Set(block, "type", blockType)
+		block, _ = sjson.Set(block, "source.media_type", mimeType)
+		block, _ = sjson.Set(block, "source.data", inlineData.Get("data").String())
+		return block, true
+	}
+	fileData := util.FirstExisting(part, "file_data", "fileData")
+	if !fileData.Exists() {
+		return "", false
+	}
+	uri := util.FirstExisting(fileData, "file_uri", "fileUri").String()
+	mimeType := util.FirstExisting(fileData, "mime_type", "mimeType")
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		blockType := ""
+		switch {
+		case strings.HasPrefix(mimeType.String(), "image/"):
+			blockType = "image"
+		case mimeType.String() == "application/pdf":
+			blockType = "document"
+		}
+		if blockType != "" {
+			block := `{"type":"","source":{"type":"url","url":""}}`
+			block, _ = sjson.Set(block, "type", blockType)
+			block, _ = sjson.Set(block, "source.url", uri)
+			return block, true
+		}
+	}
+	fileInfo := "File: " + uri
+	if mimeType.Exists() {
+		fileInfo += " (Type: " + mimeType.String() + ")"
+	}
+	textContent, _ := sjson.Set(`{"type":"text","text":""}`, "text", fileInfo)
+	return textContent, true
+}
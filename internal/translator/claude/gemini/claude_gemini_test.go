@@ -0,0 +1,92 @@
+package gemini
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertGeminiRequestToClaudeToolChoice(t *testing.T) {
+	cases := []struct {
+		name       string
+		toolConfig string
+		want       string
+	}{
+		{name: "none", toolConfig: `{"functionCallingConfig":{"mode":"NONE"}}`, want: `{"type":"none"}`},
+		{name: "auto", toolConfig: `{"functionCallingConfig":{"mode":"AUTO"}}`, want: `{"type":"auto"}`},
+		{name: "any", toolConfig: `{"functionCallingConfig":{"mode":"ANY"}}`, want: `{"type":"any"}`},
+		{name: "single allowed function", toolConfig: `{"function_calling_config":{"mode":"ANY","allowed_function_names":["lookup"]}}`, want: `{"name":"lookup","type":"tool"}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"tools":[{"functionDeclarations":[{"name":"lookup","parameters":{"type":"object"}}]}],"tool_config":` + tc.toolConfig + `}`
+			out := ConvertGeminiRequestToClaude("claude-sonnet-4-5", []byte(in), false)
+			if got := gjson.GetBytes(out, "tool_choice").Raw; got != tc.want {
+				t.Fatalf("tool_choice = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConvertGeminiRequestToClaudeToolResults(t *testing.T) {
+	in := `{"contents":[
+		{"role":"user","parts":[{"text":"weather and time?"}]},
+		{"role":"model","parts":[
+			{"functionCall":{"name":"weather","args":{"city":"Oslo"}}},
+			{"functionCall":{"name":"clock","args":{}}}
+		]},
+		{"role":"function","parts":[
+			{"functionResponse":{"name":"clock","response":{"result":"12:00"}}},
+			{"functionResponse":{"name":"weather","response":{"temp":4}}}
+		]}
+	]}`
+	out := ConvertGeminiRequestToClaude("claude-sonnet-4-5", []byte(in), false)
+
+	uses := gjson.GetBytes(out, "messages.1.content").Array()
+	if len(uses) != 2 || uses[0].Get("type").String() != "tool_use" || uses[0].Get("input.city").String() != "Oslo" {
+		t.Fatalf("unexpected tool_use blocks: %s", gjson.GetBytes(out, "messages.1").Raw)
+	}
+	results := gjson.GetBytes(out, "messages.2")
+	if results.Get("role").String() != "user" {
+		t.Fatalf("tool results should be sent as user turn: %s", results.Raw)
+	}
+	if r := results.Get("content.0"); r.Get("tool_use_id").String() != uses[1].Get("id").String() || r.Get("content").String() != "12:00" {
+		t.Fatalf("clock result not matched by name: %s", r.Raw)
+	}
+	if r := results.Get("content.1"); r.Get("tool_use_id").String() != uses[0].Get("id").String() || r.Get("content").String() != `{"temp":4}` {
+		t.Fatalf("weather result not matched by name: %s", r.Raw)
+	}
+}
+
+func TestConvertClaudeResponseToGeminiStreamsFunctionCalls(t *testing.T) {
+	var param any
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-5"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"\"Oslo\"}"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_2","name":"clock","input":{}}}`,
+		`{"type":"content_block_stop","index":1}`,
+	}
+	var calls []gjson.Result
+	for _, event := range events {
+		for _, out := range ConvertClaudeResponseToGemini(context.Background(), "claude-sonnet-4-5", nil, nil, []byte("data: "+event), &param) {
+			for _, part := range gjson.Get(out, "candidates.0.content.parts").Array() {
+				if call := part.Get("functionCall"); call.Exists() {
+					calls = append(calls, call)
+				}
+			}
+		}
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected two function calls, got %v", calls)
+	}
+	if calls[0].Get("name").String() != "weather" || calls[0].Get("args.city").String() != "Oslo" {
+		t.Fatalf("unexpected first function call: %s", calls[0].Raw)
+	}
+	if calls[1].Get("name").String() != "clock" || calls[1].Get("args").Raw != "{}" {
+		t.Fatalf("unexpected second function call: %s", calls[1].Raw)
+	}
+}
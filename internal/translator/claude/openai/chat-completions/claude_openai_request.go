@@ -139,6 +139,7 @@ func ConvertOpenAIRequestToClaude(modelName string, inputRawJSON []byte, stream
 	// Process messages and transform them to Claude Code format
 	var anthropicMessages []interface{}
 	var toolCallIDs []string // Track tool call IDs for matching with tool results
+	lastWasToolResult := false
 
 	if messages := root.Get("messages"); messages.Exists() && messages.IsArray() {
 		messages.ForEach(func(_, message gjson.Result) bool {
@@ -180,26 +181,10 @@ func ConvertOpenAIRequestToClaude(modelName string, inputRawJSON []byte, stream
 								"text": part.Get("text").String(),
 							})
 
-						case "image_url":
-							// Convert OpenAI image format to Claude Code format
-							imageURL := part.Get("image_url.url").String()
-							if strings.HasPrefix(imageURL, "data:") {
-								// Extract base64 data and media type from data URL
-								parts := strings.Split(imageURL, ",")
-								if len(parts) == 2 {
-									mediaTypePart := strings.Split(parts[0], ";")[0]
-									mediaType := strings.TrimPrefix(mediaTypePart, "data:")
-									data := parts[1]
-
-									contentParts = append(contentParts, map[string]interface{}{
-										"type": "image",
-										"source": map[string]interface{}{
-											"type":       "base64",
-											"media_type": mediaType,
-											"data":       data,
-										},
-									})
-								}
+						case "image_url", "file":
+							// Convert OpenAI image and file parts to Claude Code image and document blocks
+							if block, ok := convertOpenAIMediaPart(part); ok {
+								contentParts = append(contentParts, block)
 							}
 						}
 						return true
@@ -264,23 +249,25 @@ func ConvertOpenAIRequestToClaude(modelName string, inputRawJSON []byte, stream
 
 			case "tool":
 				// Handle tool result messages conversion
-				toolCallID := message.Get("tool_call_id").String()
-				content := message.Get("content").String()
-
-				// Create tool result message in Claude Code format
-				msg := map[string]interface{}{
-					"role": "user",
-					"content": []interface{}{
-						map[string]interface{}{
-							"type":        "tool_result",
-							"tool_use_id": toolCallID,
-							"content":     content,
-						},
-					},
+				toolResult := map[string]interface{}{
+					"type":        "tool_result",
+					"tool_use_id": message.Get("tool_call_id").String(),
+					"content":     convertOpenAIToolContent(contentResult),
 				}
 
-				anthropicMessages = append(anthropicMessages, msg)
+				// Results of parallel tool calls arrive as consecutive tool messages; Claude
+				// expects them together in the user turn that follows the tool_use blocks.
+				if n := len(anthropicMessages); n > 0 && lastWasToolResult {
+					previous := anthropicMessages[n-1].(map[string]interface{})
+					previous["content"] = append(previous["content"].([]interface{}), toolResult)
+				} else {
+					anthropicMessages = append(anthropicMessages, map[string]interface{}{
+						"role":    "user",
+						"content": []interface{}{toolResult},
+					})
+				}
 			}
+			lastWasToolResult = role == "tool"
 			return true
 		})
 	}
@@ -327,7 +314,7 @@ func ConvertOpenAIRequestToClaude(modelName string, inputRawJSON []byte, stream
 			choice := toolChoice.String()
 			switch choice {
 			case "none":
-				// Don't set tool_choice, Claude Code will not use tools
+				out, _ = sjson.Set(out, "tool_choice", map[string]interface{}{"type": "none"})
 			case "auto":
 				out, _ = sjson.Set(out, "tool_choice", map[string]interface{}{"type": "auto"})
 			case "required":
@@ -346,5 +333,81 @@ func ConvertOpenAIRequestToClaude(modelName string, inputRawJSON []byte, stream
 		}
 	}
 
+	// parallel_tool_calls=false maps to disable_parallel_tool_use, which lives on tool_choice
+	if parallel := root.Get("parallel_tool_calls"); parallel.Exists() && !parallel.Bool() && gjson.Get(out, "tools").Exists() {
+		switch gjson.Get(out, "tool_choice.type").String() {
+		case "none":
+		case "":
+			out, _ = sjson.Set(out, "tool_choice", map[string]interface{}{"type": "auto", "disable_parallel_tool_use": true})
+		default:
+			out, _ = sjson.Set(out, "tool_choice.disable_parallel_tool_use", true)
+		}
+	}
+
 	return []byte(out)
 }
+
+// convertOpenAIToolContent converts the content of an OpenAI tool message into
+// tool_result content: plain strings stay strings, content parts become text,
+// image and document blocks.
+func convertOpenAIToolContent(content gjson.Result) interface{} {
+	if !content.IsArray() {
+		return content.String()
+	}
+	blocks := make([]interface{}, 0)
+	content.ForEach(func(_, part gjson.Result) bool {
+		switch part.Get("type").String() {
+		case "text":
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": part.Get("text").String()})
+		case "image_url", "file":
+			if block, ok := convertOpenAIMediaPart(part); ok {
+				blocks = append(blocks, block)
+			}
+		}
+		return true
+	})
+	return blocks
+}
+
+// convertOpenAIMediaPart converts an OpenAI image_url or file content part into a
+// Claude image or document block. Data URLs and bare base64 file data become base64
+// sources; http(s) image URLs are passed through as URL sources. Files referenced by
+// file_id cannot be resolved and are dropped.
+func convertOpenAIMediaPart(part gjson.Result) (map[string]interface{}, bool) {
+	if part.Get("type").String() == "image_url" {
+		imageURL := part.Get("image_url.url").String()
+		if mediaType, data, ok := util.ParseDataURL(imageURL); ok {
+			return map[string]interface{}{
+				"type":   "image",
+				"source": map[string]interface{}{"type": "base64", "media_type": mediaType, "data": data},
+			}, true
+		}
+		if strings.HasPrefix(imageURL, "http://") || strings.HasPrefix(imageURL, "https://") {
+			return map[string]interface{}{
+				"type":   "image",
+				"source": map[string]interface{}{"type": "url", "url": imageURL},
+			}, true
+		}
+		return nil, false
+	}
+	fileData := part.Get("file.file_data").String()
+	if fileData == "" {
+		return nil, false
+	}
+	mediaType, data, ok := util.ParseDataURL(fileData)
+	if !ok {
+		mediaType, data = "application/pdf", fileData
+	}
+	blockType := "document"
+	if strings.HasPrefix(mediaType, "image/") {
+		blockType = "image"
+	}
+	block := map[string]interface{}{
+		"type":   blockType,
+		"source": map[string]interface{}{"type": "base64", "media_type": mediaType, "data": data},
+	}
+	if filename := part.Get("file.filename").String(); filename != "" && blockType == "document" {
+		block["title"] = filename
+	}
+	return block, true
+}
@@ -25,12 +25,16 @@ type ConvertAnthropicResponseToOpenAIParams struct {
 	CreatedAt    int64
 	ResponseID   string
 	FinishReason string
-	// Tool calls accumulator for streaming
+	// Tool calls accumulator for streaming, keyed by Claude content block index
 	ToolCallsAccumulator map[int]*ToolCallAccumulator
+	// NextToolCallIndex is the OpenAI index of the next tool call. Claude numbers
+	// content blocks including text, OpenAI numbers tool calls from zero.
+	NextToolCallIndex int
 }
 
 // ToolCallAccumulator holds the state for accumulating tool call data
 type ToolCallAccumulator struct {
+	Index     int
 	ID        string
 	Name      string
 	Arguments strings.Builder
@@ -118,13 +122,26 @@ func ConvertClaudeResponseToOpenAI(_ context.Context, modelName string, original
 					(*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator = make(map[int]*ToolCallAccumulator)
 				}
 
-				(*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator[index] = &ToolCallAccumulator{
-					ID:   toolCallID,
-					Name: toolName,
+				accumulator := &ToolCallAccumulator{
+					Index: (*param).(*ConvertAnthropicResponseToOpenAIParams).NextToolCallIndex,
+					ID:    toolCallID,
+					Name:  toolName,
 				}
+				(*param).(*ConvertAnthropicResponseToOpenAIParams).NextToolCallIndex++
+				(*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator[index] = accumulator
 
-				// Don't output anything yet - wait for complete tool call
-				return []string{}
+				// Announce the tool call; its arguments follow as deltas
+				toolCall := map[string]interface{}{
+					"index": accumulator.Index,
+					"id":    accumulator.ID,
+					"type":  "function",
+					"function": map[string]interface{}{
+						"name":      accumulator.Name,
+						"arguments": "",
+					},
+				}
+				template, _ = sjson.Set(template, "choices.0.delta.tool_calls", []interface{}{toolCall})
+				return []string{template}
 			}
 		}
 		return []string{}
@@ -149,17 +166,20 @@ func ConvertClaudeResponseToOpenAI(_ context.Context, modelName string, original
 					hasContent = true
 				}
 			case "input_json_delta":
-				// Tool use input delta - accumulate arguments for tool calls
-				if partialJSON := delta.Get("partial_json"); partialJSON.Exists() {
-					index := int(root.Get("index").Int())
-					if (*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator != nil {
-						if accumulator, exists := (*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator[index]; exists {
-							accumulator.Arguments.WriteString(partialJSON.String())
-						}
-					}
+				// Tool use input delta - forward as tool call arguments delta
+				partialJSON := delta.Get("partial_json").String()
+				index := int(root.Get("index").Int())
+				accumulator, exists := (*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator[index]
+				if !exists || partialJSON == "" {
+					return []string{}
+				}
+				accumulator.Arguments.WriteString(partialJSON)
+				toolCall := map[string]interface{}{
+					"index":    accumulator.Index,
+					"function": map[string]interface{}{"arguments": partialJSON},
 				}
-				// Don't output anything yet - wait for complete tool call
-				return []string{}
+				template, _ = sjson.Set(template, "choices.0.delta.tool_calls", []interface{}{toolCall})
+				return []string{template}
 			}
 		}
 		if hasContent {
@@ -169,35 +189,24 @@ func ConvertClaudeResponseToOpenAI(_ context.Context, modelName string, original
 		}
 
 	case "content_block_stop":
-		// End of content block - output complete tool call if it's a tool_use block
+		// End of content block - close the tool call if it's a tool_use block
 		index := int(root.Get("index").Int())
-		if (*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator != nil {
-			if accumulator, exists := (*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator[index]; exists {
-				// Build complete tool call with accumulated arguments
-				arguments := accumulator.Arguments.String()
-				if arguments == "" {
-					arguments = "{}"
-				}
-
-				toolCall := map[string]interface{}{
-					"index": index,
-					"id":    accumulator.ID,
-					"type":  "function",
-					"function": map[string]interface{}{
-						"name":      accumulator.Name,
-						"arguments": arguments,
-					},
-				}
-
-				template, _ = sjson.Set(template, "choices.0.delta.tool_calls", []interface{}{toolCall})
-
-				// Clean up the accumulator for this index
-				delete((*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator, index)
-
-				return []string{template}
-			}
+		accumulator, exists := (*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator[index]
+		if !exists {
+			return []string{}
 		}
-		return []string{}
+		// Clean up the accumulator for this index
+		delete((*param).(*ConvertAnthropicResponseToOpenAIParams).ToolCallsAccumulator, index)
+		if accumulator.Arguments.Len() > 0 {
+			return []string{}
+		}
+		// Tools without parameters stream no input; send empty arguments
+		toolCall := map[string]interface{}{
+			"index":    accumulator.Index,
+			"function": map[string]interface{}{"arguments": "{}"},
+		}
+		template, _ = sjson.Set(template, "choices.0.delta.tool_calls", []interface{}{toolCall})
+		return []string{template}
 
 	case "message_delta":
 		// Handle message-level changes including stop reason and usage
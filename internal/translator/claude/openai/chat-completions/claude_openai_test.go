@@ -0,0 +1,125 @@
+package chat_completions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertOpenAIRequestToClaudeToolChoice(t *testing.T) {
+	cases := []struct {
+		name       string
+		toolChoice string
+		parallel   string
+		want       string
+	}{
+		{name: "none", toolChoice: `"none"`, want: `{"type":"none"}`},
+		{name: "auto", toolChoice: `"auto"`, want: `{"type":"auto"}`},
+		{name: "required", toolChoice: `"required"`, want: `{"type":"any"}`},
+		{name: "named function", toolChoice: `{"type":"function","function":{"name":"lookup"}}`, want: `{"name":"lookup","type":"tool"}`},
+		{name: "serial calls", parallel: `false`, want: `{"disable_parallel_tool_use":true,"type":"auto"}`},
+		{name: "serial named function", toolChoice: `{"type":"function","function":{"name":"lookup"}}`, parallel: `false`, want: `{"name":"lookup","type":"tool","disable_parallel_tool_use":true}`},
+		{name: "serial none", toolChoice: `"none"`, parallel: `false`, want: `{"type":"none"}`},
+		{name: "parallel allowed", parallel: `true`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := `{"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}]`
+			if tc.toolChoice != "" {
+				in += `,"tool_choice":` + tc.toolChoice
+			}
+			if tc.parallel != "" {
+				in += `,"parallel_tool_calls":` + tc.parallel
+			}
+			out := ConvertOpenAIRequestToClaude("claude-sonnet-4-5", []byte(in+"}"), false)
+			if got := gjson.GetBytes(out, "tool_choice").Raw; got != tc.want {
+				t.Fatalf("tool_choice = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConvertOpenAIRequestToClaudeToolResults(t *testing.T) {
+	in := `{"messages":[
+		{"role":"user","content":"weather and time?"},
+		{"role":"assistant","content":"Checking.","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Oslo\"}"}},
+			{"id":"call_2","type":"function","function":{"name":"clock","arguments":""}}
+		]},
+		{"role":"tool","tool_call_id":"call_1","content":"4C"},
+		{"role":"tool","tool_call_id":"call_2","content":[{"type":"text","text":"12:00"}]}
+	]}`
+	out := ConvertOpenAIRequestToClaude("claude-sonnet-4-5", []byte(in), false)
+
+	messages := gjson.GetBytes(out, "messages").Array()
+	if len(messages) != 3 {
+		t.Fatalf("expected user, assistant and one tool result turn, got %s", gjson.GetBytes(out, "messages").Raw)
+	}
+	uses := messages[1].Get(`content.#(type=="tool_use")#`).Array()
+	if len(uses) != 2 || uses[0].Get("id").String() != "call_1" || uses[0].Get("input.city").String() != "Oslo" || uses[1].Get("input").Raw != "{}" {
+		t.Fatalf("unexpected tool_use blocks: %s", messages[1].Raw)
+	}
+	results := messages[2]
+	if results.Get("role").String() != "user" || len(results.Get("content").Array()) != 2 {
+		t.Fatalf("parallel tool results should share one user turn: %s", results.Raw)
+	}
+	if r := results.Get("content.0"); r.Get("type").String() != "tool_result" || r.Get("tool_use_id").String() != "call_1" || r.Get("content").String() != "4C" {
+		t.Fatalf("unexpected first tool_result: %s", r.Raw)
+	}
+	if r := results.Get("content.1"); r.Get("tool_use_id").String() != "call_2" || r.Get("content.0.text").String() != "12:00" {
+		t.Fatalf("unexpected second tool_result: %s", r.Raw)
+	}
+}
+
+func TestConvertClaudeResponseToOpenAIStreamsToolCalls(t *testing.T) {
+	var param any
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Oslo\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"clock","input":{}}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"input_tokens":3,"output_tokens":9}}`,
+		`{"type":"message_stop"}`,
+	}
+	var toolDeltas []gjson.Result
+	var finishReason string
+	for _, event := range events {
+		for _, out := range ConvertClaudeResponseToOpenAI(context.Background(), "claude-sonnet-4-5", nil, nil, []byte("data: "+event), &param) {
+			toolDeltas = append(toolDeltas, gjson.Get(out, "choices.0.delta.tool_calls").Array()...)
+			if reason := gjson.Get(out, "choices.0.finish_reason"); reason.Type == gjson.String {
+				finishReason = reason.String()
+			}
+		}
+	}
+
+	want := []struct {
+		index     int64
+		id, name  string
+		arguments string
+	}{
+		{0, "toolu_1", "weather", ""},
+		{0, "", "", `{"city":`},
+		{0, "", "", `"Oslo"}`},
+		{1, "toolu_2", "clock", ""},
+		{1, "", "", `{}`},
+	}
+	if len(toolDeltas) != len(want) {
+		t.Fatalf("expected %d tool call deltas, got %d: %v", len(want), len(toolDeltas), toolDeltas)
+	}
+	for i, w := range want {
+		d := toolDeltas[i]
+		if d.Get("index").Int() != w.index || d.Get("id").String() != w.id || d.Get("function.name").String() != w.name || d.Get("function.arguments").String() != w.arguments {
+			t.Fatalf("delta %d = %s", i, d.Raw)
+		}
+	}
+	if finishReason != "tool_calls" {
+		t.Fatalf("finish_reason = %q", finishReason)
+	}
+}
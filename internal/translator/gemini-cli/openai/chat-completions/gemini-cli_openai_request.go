@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/router-for-me/CLIProxyAPI/v6/internal/misc"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/translator/gemini/common"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
 	log "github.com/sirupsen/logrus"
@@ -141,8 +140,7 @@ func ConvertOpenAIRequestToGeminiCLI(modelName string, inputRawJSON []byte, _ bo
 			if role == "tool" {
 				toolCallID := m.Get("tool_call_id").String()
 				if toolCallID != "" {
-					c := m.Get("content")
-					toolResponses[toolCallID] = c.Raw
+					toolResponses[toolCallID] = common.OpenAIToolResponseText(m.Get("content"))
 				}
 			}
 		}
@@ -174,31 +172,10 @@ func ConvertOpenAIRequestToGeminiCLI(modelName string, inputRawJSON []byte, _ bo
 						case "text":
 							node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".text", item.Get("text").String())
 							p++
-						case "image_url":
-							imageURL := item.Get("image_url.url").String()
-							if len(imageURL) > 5 {
-								pieces := strings.SplitN(imageURL[5:], ";", 2)
-								if len(pieces) == 2 && len(pieces[1]) > 7 {
-									mime := pieces[0]
-									data := pieces[1][7:]
-									node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".inlineData.mime_type", mime)
-									node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".inlineData.data", data)
-									p++
-								}
-							}
-						case "file":
-							filename := item.Get("file.filename").String()
-							fileData := item.Get("file.file_data").String()
-							ext := ""
-							if sp := strings.Split(filename, "."); len(sp) > 1 {
-								ext = sp[len(sp)-1]
-							}
-							if mimeType, ok := misc.MimeTypes[ext]; ok {
-								node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".inlineData.mime_type", mimeType)
-								node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".inlineData.data", fileData)
+						case "image_url", "file":
+							if part, ok := common.OpenAIMediaPart(item); ok {
+								node, _ = sjson.SetRawBytes(node, "parts."+itoa(p), part)
 								p++
-							} else {
-								log.Warnf("Unknown file name extension '%s' in user message, skip", ext)
 							}
 						}
 					}
@@ -241,11 +218,16 @@ func ConvertOpenAIRequestToGeminiCLI(modelName string, inputRawJSON []byte, _ bo
 					for _, fid := range fIDs {
 						if name, ok := tcID2Name[fid]; ok {
 							toolNode, _ = sjson.SetBytes(toolNode, "parts."+itoa(pp)+".functionResponse.name", name)
-							resp := toolResponses[fid]
-							if resp == "" {
+							resp, ok := toolResponses[fid]
+							if !ok {
 								resp = "{}"
 							}
-							toolNode, _ = sjson.SetBytes(toolNode, "parts."+itoa(pp)+".functionResponse.response.result", []byte(resp))
+							// Structured results are forwarded as JSON, anything else as text.
+							if parsed := gjson.Parse(resp); gjson.Valid(resp) && (parsed.IsObject() || parsed.IsArray()) {
+								toolNode, _ = sjson.SetRawBytes(toolNode, "parts."+itoa(pp)+".functionResponse.response.result", []byte(resp))
+							} else {
+								toolNode, _ = sjson.SetBytes(toolNode, "parts."+itoa(pp)+".functionResponse.response.result", resp)
+							}
 							pp++
 						}
 					}
@@ -329,6 +311,17 @@ func ConvertOpenAIRequestToGeminiCLI(modelName string, inputRawJSON []byte, _ bo
 		}
 	}
 
+	// tool_choice -> toolConfig.functionCallingConfig. Gemini has no switch for parallel
+	// function calls, so parallel_tool_calls is not forwarded.
+	if gjson.GetBytes(out, "request.tools.0.functionDeclarations").Exists() {
+		if mode, names := common.OpenAIFunctionCallingConfig(gjson.GetBytes(rawJSON, "tool_choice")); mode != "" {
+			out, _ = sjson.SetBytes(out, "request.toolConfig.functionCallingConfig.mode", mode)
+			if len(names) > 0 {
+				out, _ = sjson.SetBytes(out, "request.toolConfig.functionCallingConfig.allowedFunctionNames", names)
+			}
+		}
+	}
+
 	return common.AttachDefaultSafetySettings(out, "request.safetySettings")
 }
 
@@ -57,6 +57,7 @@ func ConvertClaudeRequestToGemini(modelName string, inputRawJSON []byte, _ bool)
 	// contents
 	contents := make([]client.Content, 0)
 	messagesResult := gjson.GetBytes(rawJSON, "messages")
+	toolNames := common.ClaudeToolUseNames(messagesResult)
 	if messagesResult.IsArray() {
 		messageResults := messagesResult.Array()
 		for i := 0; i < len(messageResults); i++ {
@@ -79,6 +80,10 @@ func ConvertClaudeRequestToGemini(modelName string, inputRawJSON []byte, _ bool)
 					if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "text" {
 						prompt := contentResult.Get("text").String()
 						clientContent.Parts = append(clientContent.Parts, client.Part{Text: prompt})
+					} else if contentTypeResult.Type == gjson.String && (contentTypeResult.String() == "image" || contentTypeResult.String() == "document") {
+						if part, ok := common.ClaudeMediaPart(contentResult); ok {
+							clientContent.Parts = append(clientContent.Parts, part)
+						}
 					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "tool_use" {
 						functionName := contentResult.Get("name").String()
 						functionArgs := contentResult.Get("input").String()
@@ -92,13 +97,21 @@ func ConvertClaudeRequestToGemini(modelName string, inputRawJSON []byte, _ bool)
 					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "tool_result" {
 						toolCallID := contentResult.Get("tool_use_id").String()
 						if toolCallID != "" {
-							funcName := toolCallID
-							toolCallIDs := strings.Split(toolCallID, "-")
-							if len(toolCallIDs) > 1 {
-								funcName = strings.Join(toolCallIDs[0:len(toolCallIDs)-1], "-")
+							funcName, ok := toolNames[toolCallID]
+							if !ok {
+								// IDs minted by the Gemini response translators are "<name>-<n>".
+								funcName = toolCallID
+								toolCallIDs := strings.Split(toolCallID, "-")
+								if len(toolCallIDs) > 1 {
+									funcName = strings.Join(toolCallIDs[0:len(toolCallIDs)-1], "-")
+								}
+							}
+							// Gemini reads failures from an "error" field of the response
+							resultKey := "result"
+							if contentResult.Get("is_error").Bool() {
+								resultKey = "error"
 							}
-							responseData := contentResult.Get("content").Raw
-							functionResponse := client.FunctionResponse{Name: funcName, Response: map[string]interface{}{"result": responseData}}
+							functionResponse := client.FunctionResponse{Name: funcName, Response: map[string]interface{}{resultKey: common.ClaudeToolResultValue(contentResult)}}
 							clientContent.Parts = append(clientContent.Parts, client.Part{FunctionResponse: &functionResponse})
 						}
 					}
@@ -155,6 +168,17 @@ func ConvertClaudeRequestToGemini(modelName string, inputRawJSON []byte, _ bool)
 		out, _ = sjson.SetRaw(out, "tools", string(b))
 	}
 
+	// tool_choice -> toolConfig.functionCallingConfig. Gemini has no switch for parallel
+	// function calls, so disable_parallel_tool_use is not forwarded.
+	if len(tools) > 0 && len(tools[0].FunctionDeclarations) > 0 {
+		if mode, names := common.ClaudeFunctionCallingConfig(gjson.GetBytes(rawJSON, "tool_choice")); mode != "" {
+			out, _ = sjson.Set(out, "toolConfig.functionCallingConfig.mode", mode)
+			if len(names) > 0 {
+				out, _ = sjson.Set(out, "toolConfig.functionCallingConfig.allowedFunctionNames", names)
+			}
+		}
+	}
+
 	// Map Anthropic thinking -> Gemini thinkingBudget/include_thoughts when enabled
 	// Only apply for models that use numeric budgets, not discrete levels.
 	if t := gjson.GetBytes(rawJSON, "thinking"); t.Exists() && t.IsObject() && util.ModelSupportsThinking(modelName) && !util.ModelUsesThinkingLevels(modelName) {
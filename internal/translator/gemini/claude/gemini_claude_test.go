@@ -0,0 +1,118 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertClaudeRequestToGeminiToolChoice(t *testing.T) {
+	cases := []struct {
+		name       string
+		toolChoice string
+		mode       string
+		allowed    string
+	}{
+		{name: "none", toolChoice: `{"type":"none"}`, mode: "NONE"},
+		{name: "auto", toolChoice: `{"type":"auto","disable_parallel_tool_use":true}`, mode: "AUTO"},
+		{name: "any", toolChoice: `{"type":"any"}`, mode: "ANY"},
+		{name: "named tool", toolChoice: `{"type":"tool","name":"lookup"}`, mode: "ANY", allowed: `["lookup"]`},
+		{name: "tool without name", toolChoice: `{"type":"tool"}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := `{"messages":[{"role":"user","content":"hi"}],"tools":[{"name":"lookup","input_schema":{"type":"object"}}],"tool_choice":` + tc.toolChoice + `}`
+			out := ConvertClaudeRequestToGemini("gemini-2.5-pro", []byte(in), false)
+			if got := gjson.GetBytes(out, "toolConfig.functionCallingConfig.mode").String(); got != tc.mode {
+				t.Fatalf("mode = %q, want %q: %s", got, tc.mode, out)
+			}
+			if got := gjson.GetBytes(out, "toolConfig.functionCallingConfig.allowedFunctionNames").Raw; got != tc.allowed {
+				t.Fatalf("allowedFunctionNames = %s, want %s", got, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestConvertClaudeRequestToGeminiToolResults(t *testing.T) {
+	in := `{"messages":[
+		{"role":"user","content":"weather and time?"},
+		{"role":"assistant","content":[
+			{"type":"tool_use","id":"toolu_1","name":"weather","input":{"city":"Oslo"}},
+			{"type":"tool_use","id":"toolu_2","name":"clock","input":{}}
+		]},
+		{"role":"user","content":[
+			{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"4C"},{"type":"text","text":"cloudy"}]},
+			{"type":"tool_result","tool_use_id":"toolu_2","content":"clock offline","is_error":true},
+			{"type":"tool_result","tool_use_id":"news-17","content":[{"type":"json","value":1}]}
+		]}
+	]}`
+	out := ConvertClaudeRequestToGemini("gemini-2.5-pro", []byte(in), false)
+
+	call := gjson.GetBytes(out, "contents.1.parts.0.functionCall")
+	if call.Get("name").String() != "weather" || call.Get("args.city").String() != "Oslo" {
+		t.Fatalf("unexpected functionCall: %s", call.Raw)
+	}
+	parts := gjson.GetBytes(out, "contents.2.parts").Array()
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 function responses, got %s", gjson.GetBytes(out, "contents.2").Raw)
+	}
+	if r := parts[0].Get("functionResponse"); r.Get("name").String() != "weather" || r.Get("response.result").String() != "4C\ncloudy" {
+		t.Fatalf("unexpected first response: %s", r.Raw)
+	}
+	if r := parts[1].Get("functionResponse"); r.Get("name").String() != "clock" || r.Get("response.error").String() != "clock offline" || r.Get("response.result").Exists() {
+		t.Fatalf("error result not forwarded as error: %s", r.Raw)
+	}
+	if r := parts[2].Get("functionResponse"); r.Get("name").String() != "news" || r.Get("response.result.0.value").Int() != 1 {
+		t.Fatalf("unknown id should fall back to the minted name and keep JSON content: %s", r.Raw)
+	}
+}
+
+func TestConvertGeminiResponseToClaudeStreamsToolUse(t *testing.T) {
+	var param any
+	chunks := []string{
+		`{"candidates":[{"content":{"parts":[{"text":"Checking."}]}}]}`,
+		`{"candidates":[{"content":{"parts":[{"functionCall":{"name":"weather","args":{"city":"Oslo"}}}]}}]}`,
+		`{"candidates":[{"content":{"parts":[{"functionCall":{"name":"","args":{"unit":"C"}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":7}}`,
+	}
+	var events []gjson.Result
+	for _, chunk := range chunks {
+		for _, out := range ConvertGeminiResponseToClaude(context.Background(), "", nil, nil, []byte(chunk), &param) {
+			events = append(events, sseData(out)...)
+		}
+	}
+
+	var types []string
+	for _, ev := range events {
+		types = append(types, ev.Get("type").String())
+	}
+	want := "message_start content_block_start content_block_delta content_block_stop content_block_start content_block_delta content_block_delta content_block_stop message_delta"
+	if got := strings.Join(types, " "); got != want {
+		t.Fatalf("events = %s\nwant %s", got, want)
+	}
+	start := events[4]
+	if start.Get("index").Int() != 1 || start.Get("content_block.type").String() != "tool_use" || start.Get("content_block.name").String() != "weather" || start.Get("content_block.id").String() == "" {
+		t.Fatalf("unexpected tool_use start: %s", start.Raw)
+	}
+	for i, args := range []string{`{"city":"Oslo"}`, `{"unit":"C"}`} {
+		delta := events[5+i]
+		if delta.Get("index").Int() != 1 || delta.Get("delta.type").String() != "input_json_delta" || delta.Get("delta.partial_json").String() != args {
+			t.Fatalf("unexpected input_json_delta %d: %s", i, delta.Raw)
+		}
+	}
+	if got := events[8].Get("delta.stop_reason").String(); got != "tool_use" {
+		t.Fatalf("stop_reason = %q", got)
+	}
+}
+
+// sseData returns the JSON payloads of the data lines in an SSE fragment.
+func sseData(fragment string) []gjson.Result {
+	var payloads []gjson.Result
+	for _, line := range strings.Split(fragment, "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			payloads = append(payloads, gjson.Parse(data))
+		}
+	}
+	return payloads
+}
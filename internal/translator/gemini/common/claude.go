@@ -0,0 +1,100 @@
+package common
+
+import (
+	"mime"
+	"path"
+	"strings"
+
+	client "github.com/router-for-me/CLIProxyAPI/v6/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// ClaudeToolUseNames maps the IDs of the tool_use blocks in messages to their tool
+// names, so tool_result blocks can be answered with the function name Gemini expects.
+func ClaudeToolUseNames(messages gjson.Result) map[string]string {
+	names := make(map[string]string)
+	for _, message := range messages.Array() {
+		for _, block := range message.Get("content").Array() {
+			if block.Get("type").String() != "tool_use" {
+				continue
+			}
+			if id, name := block.Get("id").String(), block.Get("name").String(); id != "" && name != "" {
+				names[id] = name
+			}
+		}
+	}
+	return names
+}
+
+// ClaudeToolResultValue converts the content of a tool_result block into the result
+// of a Gemini functionResponse: text stays text, text blocks are joined and other
+// content is forwarded as JSON.
+func ClaudeToolResultValue(toolResult gjson.Result) any {
+	content := toolResult.Get("content")
+	switch {
+	case content.Type == gjson.String:
+		return content.String()
+	case content.IsArray():
+		var texts []string
+		for _, block := range content.Array() {
+			if block.Get("type").String() != "text" {
+				return content.Value()
+			}
+			texts = append(texts, block.Get("text").String())
+		}
+		return strings.Join(texts, "\n")
+	case content.Exists():
+		return content.Value()
+	default:
+		return ""
+	}
+}
+
+// ClaudeFunctionCallingConfig maps a Claude tool_choice to the mode and allowed
+// function names of a Gemini functionCallingConfig. The mode is empty when tool_choice
+// is absent or unknown. Gemini has no switch for parallel function calls, so
+// disable_parallel_tool_use has no counterpart.
+func ClaudeFunctionCallingConfig(toolChoice gjson.Result) (string, []string) {
+	switch toolChoice.Get("type").String() {
+	case "none":
+		return "NONE", nil
+	case "auto":
+		return "AUTO", nil
+	case "any":
+		return "ANY", nil
+	case "tool":
+		if name := toolChoice.Get("name").String(); name != "" {
+			return "ANY", []string{name}
+		}
+	}
+	return "", nil
+}
+
+// ClaudeMediaPart converts a Claude image or document block into a Gemini part:
+// base64 sources become inlineData, URL sources fileData and plain-text documents text.
+func ClaudeMediaPart(block gjson.Result) (client.Part, bool) {
+	source := block.Get("source")
+	switch source.Get("type").String() {
+	case "base64":
+		data := source.Get("data").String()
+		if data == "" {
+			return client.Part{}, false
+		}
+		return client.Part{InlineData: &client.InlineData{MimeType: source.Get("media_type").String(), Data: data}}, true
+	case "url":
+		uri := source.Get("url").String()
+		if uri == "" {
+			return client.Part{}, false
+		}
+		mimeType := "image/jpeg"
+		if block.Get("type").String() == "document" {
+			mimeType = "application/pdf"
+		} else if byExt := mime.TypeByExtension(path.Ext(strings.SplitN(uri, "?", 2)[0])); strings.HasPrefix(byExt, "image/") {
+			mimeType = byExt
+		}
+		return client.Part{FileData: &client.FileData{MimeType: mimeType, FileURI: uri}}, true
+	case "text":
+		return client.Part{Text: source.Get("data").String()}, true
+	}
+	return client.Part{}, false
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestFunctionCallingConfig(t *testing.T) {
+	cases := []struct {
+		name    string
+		convert func(gjson.Result) (string, []string)
+		choice  string
+		mode    string
+		allowed []string
+	}{
+		{name: "openai none", convert: OpenAIFunctionCallingConfig, choice: `"none"`, mode: "NONE"},
+		{name: "openai required", convert: OpenAIFunctionCallingConfig, choice: `"required"`, mode: "ANY"},
+		{name: "openai function", convert: OpenAIFunctionCallingConfig, choice: `{"type":"function","function":{"name":"lookup"}}`, mode: "ANY", allowed: []string{"lookup"}},
+		{name: "openai absent", convert: OpenAIFunctionCallingConfig, choice: ``},
+		{name: "claude auto", convert: ClaudeFunctionCallingConfig, choice: `{"type":"auto"}`, mode: "AUTO"},
+		{name: "claude any", convert: ClaudeFunctionCallingConfig, choice: `{"type":"any"}`, mode: "ANY"},
+		{name: "claude tool", convert: ClaudeFunctionCallingConfig, choice: `{"type":"tool","name":"lookup"}`, mode: "ANY", allowed: []string{"lookup"}},
+		{name: "claude absent", convert: ClaudeFunctionCallingConfig, choice: ``},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mode, allowed := tc.convert(gjson.Parse(tc.choice))
+			if mode != tc.mode || !slices.Equal(allowed, tc.allowed) {
+				t.Fatalf("got (%q, %q), want (%q, %q)", mode, allowed, tc.mode, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestOpenAIMediaPart(t *testing.T) {
+	cases := []struct {
+		name string
+		item string
+		want string
+	}{
+		{name: "data url", item: `{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}`, want: `{"inlineData":{"mime_type":"image/png","data":"AAAA"}}`},
+		{name: "remote image", item: `{"type":"image_url","image_url":{"url":"https://example.com/cat.webp?size=2"}}`, want: `{"fileData":{"mimeType":"image/webp","fileUri":"https://example.com/cat.webp?size=2"}}`},
+		{name: "file by extension", item: `{"type":"file","file":{"filename":"report.PDF","file_data":"JVBE"}}`, want: `{"inlineData":{"mime_type":"application/pdf","data":"JVBE"}}`},
+		{name: "unknown extension", item: `{"type":"file","file":{"filename":"blob.unknownext","file_data":"AAAA"}}`},
+		{name: "file id only", item: `{"type":"file","file":{"file_id":"file-1"}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			part, ok := OpenAIMediaPart(gjson.Parse(tc.item))
+			if ok != (tc.want != "") || string(part) != tc.want {
+				t.Fatalf("got (%s, %v), want %s", part, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestClaudeToolResultValue(t *testing.T) {
+	cases := []struct {
+		name   string
+		result string
+		want   any
+	}{
+		{name: "string", result: `{"content":"done"}`, want: "done"},
+		{name: "text blocks", result: `{"content":[{"type":"text","text":"a"},{"type":"text","text":"b"}]}`, want: "a\nb"},
+		{name: "missing", result: `{}`, want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ClaudeToolResultValue(gjson.Parse(tc.result)); got != tc.want {
+				t.Fatalf("got %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+	mixed := ClaudeToolResultValue(gjson.Parse(`{"content":[{"type":"text","text":"a"},{"type":"image","source":{}}]}`))
+	if blocks, ok := mixed.([]any); !ok || len(blocks) != 2 {
+		t.Fatalf("non-text content should be forwarded as JSON, got %#v", mixed)
+	}
+}
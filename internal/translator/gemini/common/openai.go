@@ -0,0 +1,96 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/misc"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// OpenAIToolResponseText returns the text of an OpenAI tool message content, joining
+// the text parts of array content.
+func OpenAIToolResponseText(content gjson.Result) string {
+	if !content.IsArray() {
+		return content.String()
+	}
+	var texts []string
+	for _, item := range content.Array() {
+		if item.Get("type").String() == "text" {
+			texts = append(texts, item.Get("text").String())
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// OpenAIFunctionCallingConfig maps an OpenAI tool_choice to the mode and allowed
+// function names of a Gemini functionCallingConfig. The mode is empty when tool_choice
+// is absent or unknown. Gemini has no switch for parallel function calls, so
+// parallel_tool_calls has no counterpart.
+func OpenAIFunctionCallingConfig(toolChoice gjson.Result) (string, []string) {
+	if toolChoice.Type == gjson.String {
+		switch toolChoice.String() {
+		case "none":
+			return "NONE", nil
+		case "auto":
+			return "AUTO", nil
+		case "required":
+			return "ANY", nil
+		}
+		return "", nil
+	}
+	if toolChoice.Get("type").String() == "function" {
+		if name := toolChoice.Get("function.name").String(); name != "" {
+			return "ANY", []string{name}
+		}
+	}
+	return "", nil
+}
+
+// OpenAIMediaPart converts an OpenAI image_url or file content part into a Gemini
+// part. Data URLs become inlineData; http(s) image URLs are passed as fileData so the
+// upstream fetches them. Bare base64 file data takes its MIME type from the filename.
+func OpenAIMediaPart(item gjson.Result) ([]byte, bool) {
+	if item.Get("type").String() == "image_url" {
+		imageURL := item.Get("image_url.url").String()
+		if mimeType, data, ok := util.ParseDataURL(imageURL); ok {
+			return InlineDataPart(mimeType, data), true
+		}
+		if strings.HasPrefix(imageURL, "http://") || strings.HasPrefix(imageURL, "https://") {
+			mimeType := "image/jpeg"
+			if known, ok := misc.MimeTypes[util.FileExtension(strings.SplitN(imageURL, "?", 2)[0])]; ok {
+				mimeType = known
+			}
+			part := []byte(`{"fileData":{"mimeType":"","fileUri":""}}`)
+			part, _ = sjson.SetBytes(part, "fileData.mimeType", mimeType)
+			part, _ = sjson.SetBytes(part, "fileData.fileUri", imageURL)
+			return part, true
+		}
+		return nil, false
+	}
+	filename := item.Get("file.filename").String()
+	fileData := item.Get("file.file_data").String()
+	if fileData == "" {
+		return nil, false
+	}
+	if mimeType, data, ok := util.ParseDataURL(fileData); ok {
+		return InlineDataPart(mimeType, data), true
+	}
+	ext := util.FileExtension(filename)
+	mimeType, ok := misc.MimeTypes[ext]
+	if !ok {
+		log.Warnf("Unknown file name extension '%s' in user message, skip", ext)
+		return nil, false
+	}
+	return InlineDataPart(mimeType, fileData), true
+}
+
+// InlineDataPart returns a Gemini inlineData part holding base64 data.
+func InlineDataPart(mimeType, data string) []byte {
+	part := []byte(`{"inlineData":{"mime_type":"","data":""}}`)
+	part, _ = sjson.SetBytes(part, "inlineData.mime_type", mimeType)
+	part, _ = sjson.SetBytes(part, "inlineData.data", data)
+	return part
+}
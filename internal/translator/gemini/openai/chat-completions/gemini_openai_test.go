@@ -0,0 +1,113 @@
+package chat_completions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertOpenAIRequestToGeminiToolChoice(t *testing.T) {
+	cases := []struct {
+		name       string
+		toolChoice string
+		mode       string
+		allowed    string
+	}{
+		{name: "none", toolChoice: `"none"`, mode: "NONE"},
+		{name: "auto", toolChoice: `"auto"`, mode: "AUTO"},
+		{name: "required", toolChoice: `"required"`, mode: "ANY"},
+		{name: "named function", toolChoice: `{"type":"function","function":{"name":"lookup"}}`, mode: "ANY", allowed: `["lookup"]`},
+		{name: "unknown", toolChoice: `"sometimes"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := `{"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}],"tool_choice":` + tc.toolChoice + `}`
+			out := ConvertOpenAIRequestToGemini("gemini-2.5-pro", []byte(in), false)
+			if got := gjson.GetBytes(out, "toolConfig.functionCallingConfig.mode").String(); got != tc.mode {
+				t.Fatalf("mode = %q, want %q: %s", got, tc.mode, out)
+			}
+			if got := gjson.GetBytes(out, "toolConfig.functionCallingConfig.allowedFunctionNames").Raw; got != tc.allowed {
+				t.Fatalf("allowedFunctionNames = %s, want %s", got, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestConvertOpenAIRequestToGeminiToolResults(t *testing.T) {
+	in := `{"messages":[
+		{"role":"user","content":"weather and time?"},
+		{"role":"assistant","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Oslo\"}"}},
+			{"id":"call_2","type":"function","function":{"name":"clock","arguments":"{}"}}
+		]},
+		{"role":"tool","tool_call_id":"call_1","content":"{\"temp\":4}"},
+		{"role":"tool","tool_call_id":"call_2","content":[{"type":"text","text":"12:00"},{"type":"text","text":"CET"}]}
+	]}`
+	out := ConvertOpenAIRequestToGemini("gemini-2.5-pro", []byte(in), false)
+
+	call := gjson.GetBytes(out, "contents.1.parts.0.functionCall")
+	if call.Get("name").String() != "weather" || call.Get("args.city").String() != "Oslo" {
+		t.Fatalf("unexpected functionCall: %s", call.Raw)
+	}
+	responses := gjson.GetBytes(out, "contents.2")
+	if responses.Get("role").String() != "tool" {
+		t.Fatalf("expected tool content, got %s", responses.Raw)
+	}
+	if got := responses.Get("parts.0.functionResponse.name").String(); got != "weather" {
+		t.Fatalf("first response name = %q", got)
+	}
+	if got := responses.Get("parts.0.functionResponse.response.result.temp").Int(); got != 4 {
+		t.Fatalf("structured result not forwarded as JSON: %s", responses.Raw)
+	}
+	if got := responses.Get("parts.1.functionResponse.name").String(); got != "clock" {
+		t.Fatalf("second response name = %q", got)
+	}
+	if got := responses.Get("parts.1.functionResponse.response.result").String(); got != "12:00\nCET" {
+		t.Fatalf("text parts not joined: %q", got)
+	}
+}
+
+func TestConvertGeminiResponseToOpenAIStreamsToolCalls(t *testing.T) {
+	var param any
+	chunks := []string{
+		`{"candidates":[{"content":{"parts":[{"functionCall":{"name":"weather","args":{"city":"Oslo"}}},{"functionCall":{"name":"clock","args":{}}}]}}]}`,
+		`{"candidates":[{"content":{"parts":[{"functionCall":{"name":"news","args":{"topic":"ski"}}}]},"finishReason":"STOP"}]}`,
+	}
+	var deltas []gjson.Result
+	for _, chunk := range chunks {
+		out := ConvertGeminiResponseToOpenAI(context.Background(), "", nil, nil, []byte("data: "+chunk), &param)
+		if len(out) != 1 {
+			t.Fatalf("expected one chunk, got %d", len(out))
+		}
+		if got := gjson.Get(out[0], "choices.0.finish_reason").String(); got != "tool_calls" {
+			t.Fatalf("finish_reason = %q", got)
+		}
+		deltas = append(deltas, gjson.Get(out[0], "choices.0.delta.tool_calls").Array()...)
+	}
+
+	want := []struct {
+		index int64
+		name  string
+		args  string
+	}{
+		{0, "weather", `{"city":"Oslo"}`},
+		{1, "clock", `{}`},
+		{2, "news", `{"topic":"ski"}`},
+	}
+	if len(deltas) != len(want) {
+		t.Fatalf("expected %d tool call deltas, got %d", len(want), len(deltas))
+	}
+	ids := map[string]bool{}
+	for i, w := range want {
+		d := deltas[i]
+		if d.Get("index").Int() != w.index || d.Get("function.name").String() != w.name || d.Get("function.arguments").String() != w.args {
+			t.Fatalf("delta %d = %s", i, d.Raw)
+		}
+		if id := d.Get("id").String(); id == "" || ids[id] {
+			t.Fatalf("delta %d has missing or repeated id %q", i, id)
+		} else {
+			ids[id] = true
+		}
+	}
+}
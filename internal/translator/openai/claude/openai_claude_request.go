@@ -125,7 +125,7 @@ func ConvertClaudeRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 					partType := part.Get("type").String()
 
 					switch partType {
-					case "text", "image":
+					case "text", "image", "document":
 						if contentItem, ok := convertClaudeContentPart(part); ok {
 							contentItems = append(contentItems, contentItem)
 						}
@@ -153,7 +153,7 @@ func ConvertClaudeRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 						// Convert to OpenAI tool message format and add immediately to preserve order
 						toolResultJSON := `{"role":"tool","tool_call_id":"","content":""}`
 						toolResultJSON, _ = sjson.Set(toolResultJSON, "tool_call_id", part.Get("tool_use_id").String())
-						toolResultJSON, _ = sjson.Set(toolResultJSON, "content", part.Get("content").String())
+						toolResultJSON, _ = sjson.Set(toolResultJSON, "content", convertClaudeToolResultContent(part))
 						messagesJSON, _ = sjson.Set(messagesJSON, "-1", gjson.Parse(toolResultJSON).Value())
 					}
 					return true
@@ -239,6 +239,8 @@ func ConvertClaudeRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 	// Tool choice mapping - convert Anthropic tool_choice to OpenAI format
 	if toolChoice := root.Get("tool_choice"); toolChoice.Exists() {
 		switch toolChoice.Get("type").String() {
+		case "none":
+			out, _ = sjson.Set(out, "tool_choice", "none")
 		case "auto":
 			out, _ = sjson.Set(out, "tool_choice", "auto")
 		case "any":
@@ -253,6 +255,9 @@ func ConvertClaudeRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 			// Default to auto if not specified
 			out, _ = sjson.Set(out, "tool_choice", "auto")
 		}
+		if toolChoice.Get("disable_parallel_tool_use").Bool() && gjson.Get(out, "tools").Exists() {
+			out, _ = sjson.Set(out, "parallel_tool_calls", false)
+		}
 	}
 
 	// Handle user parameter (for tracking)
@@ -263,6 +268,28 @@ func ConvertClaudeRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 	return []byte(out)
 }
 
+// convertClaudeToolResultContent flattens the content of a tool_result block into the
+// text of an OpenAI tool message; tool messages cannot carry images. Failed tool runs
+// are prefixed so the model can tell them apart from regular output.
+func convertClaudeToolResultContent(part gjson.Result) string {
+	content := part.Get("content")
+	text := content.String()
+	if content.IsArray() {
+		var texts []string
+		content.ForEach(func(_, item gjson.Result) bool {
+			if item.Get("type").String() == "text" {
+				texts = append(texts, item.Get("text").String())
+			}
+			return true
+		})
+		text = strings.Join(texts, "\n")
+	}
+	if part.Get("is_error").Bool() {
+		text = "Error: " + text
+	}
+	return text
+}
+
 func convertClaudeContentPart(part gjson.Result) (string, bool) {
 	partType := part.Get("type").String()
 
@@ -309,6 +336,39 @@ func convertClaudeContentPart(part gjson.Result) (string, bool) {
 
 		return imageContent, true
 
+	case "document":
+		// Base64 documents (PDFs) become file parts; Chat Completions has no way to
+		// reference a file by URL, so URL documents are passed as a text reference.
+		source := part.Get("source")
+		switch source.Get("type").String() {
+		case "base64":
+			data := source.Get("data").String()
+			if data == "" {
+				return "", false
+			}
+			mediaType := source.Get("media_type").String()
+			if mediaType == "" {
+				mediaType = "application/pdf"
+			}
+			filename := part.Get("title").String()
+			if filename == "" {
+				filename = "document.pdf"
+			}
+			fileContent := `{"type":"file","file":{"filename":"","file_data":""}}`
+			fileContent, _ = sjson.Set(fileContent, "file.filename", filename)
+			fileContent, _ = sjson.Set(fileContent, "file.file_data", "data:"+mediaType+";base64,"+data)
+			return fileContent, true
+		case "text":
+			textContent := `{"type":"text","text":""}`
+			textContent, _ = sjson.Set(textContent, "text", source.Get("data").String())
+			return textContent, true
+		case "url":
+			textContent := `{"type":"text","text":""}`
+			textContent, _ = sjson.Set(textContent, "text", "Document: "+source.Get("url").String())
+			return textContent, true
+		}
+		return "", false
+
 	default:
 		return "", false
 	}
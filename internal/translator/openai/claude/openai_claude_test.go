@@ -0,0 +1,121 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertClaudeRequestToOpenAIToolChoice(t *testing.T) {
+	cases := []struct {
+		name       string
+		toolChoice string
+		want       string
+		parallel   string
+	}{
+		{name: "none", toolChoice: `{"type":"none"}`, want: `"none"`},
+		{name: "auto", toolChoice: `{"type":"auto"}`, want: `"auto"`},
+		{name: "any", toolChoice: `{"type":"any"}`, want: `"required"`},
+		{name: "named tool", toolChoice: `{"type":"tool","name":"lookup"}`, want: `{"type":"function","function":{"name":"lookup"}}`},
+		{name: "serial calls", toolChoice: `{"type":"auto","disable_parallel_tool_use":true}`, want: `"auto"`, parallel: "false"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := `{"messages":[{"role":"user","content":"hi"}],"tools":[{"name":"lookup","input_schema":{"type":"object"}}],"tool_choice":` + tc.toolChoice + `}`
+			out := ConvertClaudeRequestToOpenAI("gpt-4.1", []byte(in), false)
+			if got := gjson.GetBytes(out, "tool_choice").Raw; got != tc.want {
+				t.Fatalf("tool_choice = %s, want %s", got, tc.want)
+			}
+			if got := gjson.GetBytes(out, "parallel_tool_calls").Raw; got != tc.parallel {
+				t.Fatalf("parallel_tool_calls = %s, want %s", got, tc.parallel)
+			}
+		})
+	}
+}
+
+func TestConvertClaudeRequestToOpenAIToolResults(t *testing.T) {
+	in := `{"messages":[
+		{"role":"user","content":"weather and time?"},
+		{"role":"assistant","content":[
+			{"type":"text","text":"Checking."},
+			{"type":"tool_use","id":"toolu_1","name":"weather","input":{"city":"Oslo"}},
+			{"type":"tool_use","id":"toolu_2","name":"clock","input":{}}
+		]},
+		{"role":"user","content":[
+			{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"4C"},{"type":"text","text":"cloudy"}]},
+			{"type":"tool_result","tool_use_id":"toolu_2","content":"clock offline","is_error":true}
+		]}
+	]}`
+	out := ConvertClaudeRequestToOpenAI("gpt-4.1", []byte(in), false)
+
+	// messages[0] is the system prompt the translator adds for tool use.
+	messages := gjson.GetBytes(out, "messages").Array()
+	if len(messages) != 6 {
+		t.Fatalf("expected 6 messages, got %s", gjson.GetBytes(out, "messages").Raw)
+	}
+	calls := messages[3].Get("tool_calls").Array()
+	if len(calls) != 2 || calls[0].Get("id").String() != "toolu_1" || calls[0].Get("function.arguments").String() != `{"city":"Oslo"}` || calls[1].Get("function.arguments").String() != `{}` {
+		t.Fatalf("unexpected tool calls: %s", messages[3].Raw)
+	}
+	if m := messages[4]; m.Get("role").String() != "tool" || m.Get("tool_call_id").String() != "toolu_1" || m.Get("content").String() != "4C\ncloudy" {
+		t.Fatalf("unexpected first tool message: %s", m.Raw)
+	}
+	if m := messages[5]; m.Get("tool_call_id").String() != "toolu_2" || m.Get("content").String() != "Error: clock offline" {
+		t.Fatalf("unexpected error tool message: %s", m.Raw)
+	}
+}
+
+func TestConvertOpenAIResponseToClaudeStreamsToolUse(t *testing.T) {
+	var param any
+	chunks := []string{
+		`{"id":"chatcmpl-1","model":"gpt-4.1","choices":[{"index":0,"delta":{"role":"assistant","content":"Checking."}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4.1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4.1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"name":"weather","arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4.1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"clock","arguments":"{}"}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4.1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Oslo\"}"}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4.1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":3,"completion_tokens":9}}`,
+		`[DONE]`,
+	}
+	var events []gjson.Result
+	for _, chunk := range chunks {
+		for _, out := range ConvertOpenAIResponseToClaude(context.Background(), "", []byte(`{"stream":true}`), nil, []byte("data: "+chunk), &param) {
+			for _, line := range strings.Split(out, "\n") {
+				if data, ok := strings.CutPrefix(line, "data: "); ok {
+					events = append(events, gjson.Parse(data))
+				}
+			}
+		}
+	}
+
+	var types []string
+	for _, ev := range events {
+		types = append(types, ev.Get("type").String())
+	}
+	want := "message_start content_block_start content_block_delta content_block_stop content_block_start content_block_start content_block_delta content_block_stop content_block_delta content_block_stop message_delta message_stop"
+	if got := strings.Join(types, " "); got != want {
+		t.Fatalf("events = %s\nwant %s", got, want)
+	}
+	for i, w := range []struct {
+		index    int64
+		id, name string
+	}{{1, "call_1", "weather"}, {2, "call_2", "clock"}} {
+		start := events[4+i]
+		if start.Get("index").Int() != w.index || start.Get("content_block.type").String() != "tool_use" || start.Get("content_block.id").String() != w.id || start.Get("content_block.name").String() != w.name {
+			t.Fatalf("unexpected tool_use start: %s", start.Raw)
+		}
+	}
+	for i, w := range []struct {
+		index int64
+		json  string
+	}{{1, `{"city":"Oslo"}`}, {2, `{}`}} {
+		delta := events[6+2*i]
+		if delta.Get("index").Int() != w.index || delta.Get("delta.type").String() != "input_json_delta" || delta.Get("delta.partial_json").String() != w.json {
+			t.Fatalf("unexpected input_json_delta: %s", delta.Raw)
+		}
+	}
+	if got := events[10].Get("delta.stop_reason").String(); got != "tool_use" {
+		t.Fatalf("stop_reason = %q", got)
+	}
+}
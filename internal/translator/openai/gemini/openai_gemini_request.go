@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"mime"
 	"strings"
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
@@ -95,7 +96,8 @@ func ConvertGeminiRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 
 	// Process contents (Gemini messages) -> OpenAI messages
 	var openAIMessages []interface{}
-	var toolCallIDs []string // Track tool call IDs for matching with tool results
+	// Tool calls not answered yet, for matching functionResponses with their calls
+	var pendingToolCalls []util.PendingToolCall
 
 	// System instruction -> OpenAI system message
 	// Gemini may provide `systemInstruction` or `system_instruction`; support both keys.
@@ -123,21 +125,9 @@ func ConvertGeminiRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 					})
 				}
 
-				// Handle inline data (e.g., images)
-				if inlineData := part.Get("inlineData"); inlineData.Exists() {
-					mimeType := inlineData.Get("mimeType").String()
-					if mimeType == "" {
-						mimeType = "application/octet-stream"
-					}
-					data := inlineData.Get("data").String()
-					imageURL := fmt.Sprintf("data:%s;base64,%s", mimeType, data)
-
-					aggregatedParts = append(aggregatedParts, map[string]interface{}{
-						"type": "image_url",
-						"image_url": map[string]interface{}{
-							"url": imageURL,
-						},
-					})
+				// Handle inline and file data (e.g., images and PDFs)
+				if media, ok := geminiMediaPart(part); ok {
+					aggregatedParts = append(aggregatedParts, media)
 				}
 				return true
 			})
@@ -169,6 +159,7 @@ func ConvertGeminiRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 			var aggregatedParts []interface{}
 			onlyTextContent := true
 			var toolCalls []interface{}
+			hasFunctionResponse := false
 
 			if parts.Exists() && parts.IsArray() {
 				parts.ForEach(func(_, part gjson.Result) bool {
@@ -182,29 +173,19 @@ func ConvertGeminiRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 						})
 					}
 
-					// Handle inline data (e.g., images)
-					if inlineData := part.Get("inlineData"); inlineData.Exists() {
+					// Handle inline and file data (e.g., images and PDFs)
+					if media, ok := geminiMediaPart(part); ok {
 						onlyTextContent = false
-
-						mimeType := inlineData.Get("mimeType").String()
-						if mimeType == "" {
-							mimeType = "application/octet-stream"
-						}
-						data := inlineData.Get("data").String()
-						imageURL := fmt.Sprintf("data:%s;base64,%s", mimeType, data)
-
-						aggregatedParts = append(aggregatedParts, map[string]interface{}{
-							"type": "image_url",
-							"image_url": map[string]interface{}{
-								"url": imageURL,
-							},
-						})
+						aggregatedParts = append(aggregatedParts, media)
 					}
 
 					// Handle function calls (Gemini) -> tool calls (OpenAI)
 					if functionCall := part.Get("functionCall"); functionCall.Exists() {
-						toolCallID := genToolCallID()
-						toolCallIDs = append(toolCallIDs, toolCallID)
+						toolCallID := functionCall.Get("id").String()
+						if toolCallID == "" {
+							toolCallID = genToolCallID()
+						}
+						pendingToolCalls = append(pendingToolCalls, util.PendingToolCall{ID: toolCallID, Name: functionCall.Get("name").String()})
 
 						toolCall := map[string]interface{}{
 							"id":   toolCallID,
@@ -247,16 +228,16 @@ func ConvertGeminiRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 							}
 						}
 
-						// Try to match with previous tool call ID
-						_ = functionResponse.Get("name").String() // functionName not used for now
-						if len(toolCallIDs) > 0 {
-							// Use the last tool call ID (simple matching by function name)
-							// In a real implementation, you might want more sophisticated matching
-							toolMsg["tool_call_id"] = toolCallIDs[len(toolCallIDs)-1]
-						} else {
+						// Match the response with its call by ID, then by the oldest unanswered
+						// call of the same function
+						var toolCallID string
+						toolCallID, pendingToolCalls = util.TakePendingToolCall(pendingToolCalls, functionResponse.Get("id").String(), functionResponse.Get("name").String())
+						if toolCallID == "" {
 							// Generate a tool call ID if none available
-							toolMsg["tool_call_id"] = genToolCallID()
+							toolCallID = genToolCallID()
 						}
+						toolMsg["tool_call_id"] = toolCallID
+						hasFunctionResponse = true
 
 						openAIMessages = append(openAIMessages, toolMsg)
 					}
@@ -279,6 +260,10 @@ func ConvertGeminiRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 				msg["tool_calls"] = toolCalls
 			}
 
+			// Contents holding only function responses were emitted as tool messages
+			if hasFunctionResponse && len(aggregatedParts) == 0 && len(toolCalls) == 0 {
+				return true
+			}
 			openAIMessages = append(openAIMessages, msg)
 
 			// switch role {
@@ -433,19 +418,72 @@ func ConvertGeminiRequestToOpenAI(modelName string, inputRawJSON []byte, stream
 	}
 
 	// Tool choice mapping (Gemini doesn't have direct equivalent, but we can handle it)
-	if toolConfig := root.Get("toolConfig"); toolConfig.Exists() {
-		if functionCallingConfig := toolConfig.Get("functionCallingConfig"); functionCallingConfig.Exists() {
-			mode := functionCallingConfig.Get("mode").String()
+	// Gemini may provide `toolConfig` or `tool_config`; support both keys.
+	toolConfig := util.FirstExisting(root, "toolConfig", "tool_config")
+	if toolConfig.Exists() {
+		functionCallingConfig := util.FirstExisting(toolConfig, "functionCallingConfig", "function_calling_config")
+		if functionCallingConfig.Exists() {
+			allowed := util.FirstExisting(functionCallingConfig, "allowedFunctionNames", "allowed_function_names")
+			mode := strings.ToUpper(functionCallingConfig.Get("mode").String())
 			switch mode {
 			case "NONE":
 				out, _ = sjson.Set(out, "tool_choice", "none")
-			case "AUTO":
+			case "AUTO", "VALIDATED":
 				out, _ = sjson.Set(out, "tool_choice", "auto")
 			case "ANY":
-				out, _ = sjson.Set(out, "tool_choice", "required")
+				// A single allowed function forces that function
+				if names := allowed.Array(); len(names) == 1 {
+					toolChoiceJSON := `{"type":"function","function":{"name":""}}`
+					toolChoiceJSON, _ = sjson.Set(toolChoiceJSON, "function.name", names[0].String())
+					out, _ = sjson.SetRaw(out, "tool_choice", toolChoiceJSON)
+				} else {
+					out, _ = sjson.Set(out, "tool_choice", "required")
+				}
 			}
 		}
 	}
 
 	return []byte(out)
 }
+
+// geminiMediaPart converts a Gemini inlineData or fileData part into an OpenAI
+// content part. Inline images become data URL image_url parts and other inline data
+// (e.g., PDFs) file parts; file URIs of images are passed as image URLs and other
+// file URIs, which Chat Completions cannot reference, as a text note.
+func geminiMediaPart(part gjson.Result) (map[string]interface{}, bool) {
+	if inlineData := util.FirstExisting(part, "inlineData", "inline_data"); inlineData.Exists() {
+		mimeType := util.FirstExisting(inlineData, "mimeType", "mime_type").String()
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		dataURL := fmt.Sprintf("data:%s;base64,%s", mimeType, inlineData.Get("data").String())
+		if strings.HasPrefix(mimeType, "image/") || mimeType == "application/octet-stream" {
+			return map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]interface{}{"url": dataURL},
+			}, true
+		}
+		filename := "file"
+		if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+			filename += exts[0]
+		}
+		return map[string]interface{}{
+			"type": "file",
+			"file": map[string]interface{}{"filename": filename, "file_data": dataURL},
+		}, true
+	}
+	if fileData := util.FirstExisting(part, "fileData", "file_data"); fileData.Exists() {
+		uri := util.FirstExisting(fileData, "fileUri", "file_uri").String()
+		if uri == "" {
+			return nil, false
+		}
+		if strings.HasPrefix(util.FirstExisting(fileData, "mimeType", "mime_type").String(), "image/") {
+			return map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]interface{}{"url": uri},
+			}, true
+		}
+		return map[string]interface{}{"type": "text", "text": "File: " + uri}, true
+	}
+	return nil, false
+}
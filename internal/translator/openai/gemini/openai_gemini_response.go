@@ -10,6 +10,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -223,10 +225,11 @@ func ConvertOpenAIResponseToGemini(_ context.Context, _ string, originalRequestR
 				geminiFinishReason := mapOpenAIFinishReasonToGemini(finishReason.String())
 				template, _ = sjson.Set(template, "candidates.0.finishReason", geminiFinishReason)
 
-				// If we have accumulated tool calls, output them now
-				if len((*param).(*ConvertOpenAIResponseToGeminiParams).ToolCallsAccumulator) > 0 {
+				// If we have accumulated tool calls, output them now in the order of their indexes
+				if accumulators := (*param).(*ConvertOpenAIResponseToGeminiParams).ToolCallsAccumulator; len(accumulators) > 0 {
 					var parts []interface{}
-					for _, accumulator := range (*param).(*ConvertOpenAIResponseToGeminiParams).ToolCallsAccumulator {
+					for _, index := range slices.Sorted(maps.Keys(accumulators)) {
+						accumulator := accumulators[index]
 						argsStr := accumulator.Arguments.String()
 						var argsMap map[string]interface{}
 
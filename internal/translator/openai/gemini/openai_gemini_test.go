@@ -0,0 +1,98 @@
+package gemini
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertGeminiRequestToOpenAIToolChoice(t *testing.T) {
+	cases := []struct {
+		name       string
+		toolConfig string
+		want       string
+	}{
+		{name: "none", toolConfig: `{"functionCallingConfig":{"mode":"NONE"}}`, want: `"none"`},
+		{name: "auto", toolConfig: `{"functionCallingConfig":{"mode":"AUTO"}}`, want: `"auto"`},
+		{name: "validated", toolConfig: `{"functionCallingConfig":{"mode":"VALIDATED"}}`, want: `"auto"`},
+		{name: "any", toolConfig: `{"functionCallingConfig":{"mode":"ANY"}}`, want: `"required"`},
+		{name: "single allowed function", toolConfig: `{"function_calling_config":{"mode":"any","allowed_function_names":["lookup"]}}`, want: `{"type":"function","function":{"name":"lookup"}}`},
+		{name: "several allowed functions", toolConfig: `{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["lookup","fetch"]}}`, want: `"required"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"tools":[{"functionDeclarations":[{"name":"lookup","parameters":{"type":"object"}}]}],"toolConfig":` + tc.toolConfig + `}`
+			out := ConvertGeminiRequestToOpenAI("gpt-4.1", []byte(in), false)
+			if got := gjson.GetBytes(out, "tool_choice").Raw; got != tc.want {
+				t.Fatalf("tool_choice = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConvertGeminiRequestToOpenAIToolResults(t *testing.T) {
+	in := `{"contents":[
+		{"role":"user","parts":[{"text":"weather and time?"}]},
+		{"role":"model","parts":[
+			{"functionCall":{"name":"weather","args":{"city":"Oslo"}}},
+			{"functionCall":{"id":"call_clock","name":"clock","args":{}}}
+		]},
+		{"role":"function","parts":[
+			{"functionResponse":{"id":"call_clock","name":"clock","response":{"content":"12:00"}}},
+			{"functionResponse":{"name":"weather","response":{"temp":4}}}
+		]}
+	]}`
+	out := ConvertGeminiRequestToOpenAI("gpt-4.1", []byte(in), false)
+
+	messages := gjson.GetBytes(out, "messages").Array()
+	if len(messages) != 4 {
+		t.Fatalf("expected user, assistant and two tool messages, got %s", gjson.GetBytes(out, "messages").Raw)
+	}
+	calls := messages[1].Get("tool_calls").Array()
+	if len(calls) != 2 || calls[1].Get("id").String() != "call_clock" || calls[0].Get("function.arguments").String() != `{"city":"Oslo"}` {
+		t.Fatalf("unexpected tool calls: %s", messages[1].Raw)
+	}
+	weatherID := calls[0].Get("id").String()
+	if weatherID == "" {
+		t.Fatalf("weather call has no id: %s", calls[0].Raw)
+	}
+	if m := messages[2]; m.Get("role").String() != "tool" || m.Get("tool_call_id").String() != "call_clock" || m.Get("content").String() != `"12:00"` {
+		t.Fatalf("clock response not matched by id: %s", m.Raw)
+	}
+	if m := messages[3]; m.Get("tool_call_id").String() != weatherID || m.Get("content").String() != `{"temp":4}` {
+		t.Fatalf("weather response not matched by name: %s", m.Raw)
+	}
+}
+
+func TestConvertOpenAIResponseToGeminiStreamsToolCalls(t *testing.T) {
+	var param any
+	chunks := []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"clock","arguments":"{}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Oslo\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	}
+	var outputs []string
+	for _, chunk := range chunks {
+		outputs = append(outputs, ConvertOpenAIResponseToGemini(context.Background(), "", nil, nil, []byte("data: "+chunk), &param)...)
+	}
+	if len(outputs) != 1 {
+		t.Fatalf("tool call deltas should be held until the finish reason, got %d outputs: %v", len(outputs), outputs)
+	}
+
+	parts := gjson.Get(outputs[0], "candidates.0.content.parts").Array()
+	if len(parts) != 2 {
+		t.Fatalf("expected two function calls, got %s", outputs[0])
+	}
+	if call := parts[0].Get("functionCall"); call.Get("name").String() != "weather" || call.Get("args.city").String() != "Oslo" {
+		t.Fatalf("unexpected first function call: %s", call.Raw)
+	}
+	if call := parts[1].Get("functionCall"); call.Get("name").String() != "clock" || call.Get("args").Raw != "{}" {
+		t.Fatalf("unexpected second function call: %s", call.Raw)
+	}
+	if got := gjson.Get(outputs[0], "candidates.0.finishReason").String(); got != "STOP" {
+		t.Fatalf("finishReason = %q", got)
+	}
+}
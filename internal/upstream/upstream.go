@@ -0,0 +1,343 @@
+// Package upstream applies the configured timeout and retry policy to provider HTTP
+// calls. Expired timeouts surface as *TimeoutError, which carries 504 Gateway Timeout
+// and names the phase that expired so the usage error taxonomy can tell them apart.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// Timeout phases reported by TimeoutError.
+const (
+	PhaseConnect = "connect"
+	PhaseRead    = "read"
+	PhaseTotal   = "total"
+)
+
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	// retryDrainLimit bounds how much of a retried response is read to reuse the connection.
+	retryDrainLimit = 64 << 10
+)
+
+// TimeoutError reports an upstream call that exceeded a configured timeout.
+type TimeoutError struct {
+	Phase string
+	Limit time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("upstream %s timeout after %s", e.Phase, e.Limit)
+}
+
+// Timeout implements net.Error.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// Temporary implements net.Error.
+func (e *TimeoutError) Temporary() bool { return true }
+
+// StatusCode reports 504 so clients see a gateway timeout.
+func (e *TimeoutError) StatusCode() int { return http.StatusGatewayTimeout }
+
+// TimeoutPhase returns the phase that expired: connect, read or total.
+func (e *TimeoutError) TimeoutPhase() string { return e.Phase }
+
+// Policy is the resolved timeout and retry policy of one provider.
+type Policy struct {
+	Connect        time.Duration
+	Read           time.Duration
+	Total          time.Duration
+	MaxAttempts    int
+	StatusCodes    []int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// PolicyFromConfig converts a configured policy.
+func PolicyFromConfig(p config.UpstreamPolicy) Policy {
+	seconds := func(n int) time.Duration { return time.Duration(max(n, 0)) * time.Second }
+	millis := func(n int) time.Duration { return time.Duration(max(n, 0)) * time.Millisecond }
+	return Policy{
+		Connect:        seconds(p.ConnectTimeoutSeconds),
+		Read:           seconds(p.ReadTimeoutSeconds),
+		Total:          seconds(p.TotalTimeoutSeconds),
+		MaxAttempts:    p.Retry.MaxAttempts,
+		StatusCodes:    p.Retry.StatusCodes,
+		InitialBackoff: millis(p.Retry.InitialBackoffMs),
+		MaxBackoff:     millis(p.Retry.MaxBackoffMs),
+	}
+}
+
+// wrapped reports whether p needs the Transport decorator; the connect timeout is
+// applied to the dialer instead.
+func (p Policy) wrapped() bool {
+	return p.Read > 0 || p.Total > 0 || p.MaxAttempts > 1
+}
+
+// Transport enforces read and total timeouts and retries around Base.
+type Transport struct {
+	Base   http.RoundTripper
+	Policy Policy
+}
+
+// WrapTransport decorates base with p, returning base unchanged when p has neither
+// read or total timeouts nor retries.
+func WrapTransport(base http.RoundTripper, p Policy) http.RoundTripper {
+	if !p.wrapped() {
+		return base
+	}
+	return &Transport{Base: base, Policy: p}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, cancelTotal := context.WithCancelCause(req.Context())
+	if t.Policy.Total > 0 {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadlineCause(ctx, time.Now().Add(t.Policy.Total), &TimeoutError{Phase: PhaseTotal, Limit: t.Policy.Total})
+		parentCancel := cancelTotal
+		cancelTotal = func(cause error) {
+			cancelDeadline()
+			parentCancel(cause)
+		}
+	}
+
+	attemptReq := req
+	for attempt := 1; ; attempt++ {
+		resp, err := t.attempt(ctx, base, attemptReq)
+		retry := attempt < t.Policy.MaxAttempts && t.retryable(resp, err) && rewindable(req)
+		var wait time.Duration
+		if retry {
+			wait, retry = t.backoff(attempt, resp)
+		}
+		if !retry {
+			if err != nil {
+				cancelTotal(nil)
+				return nil, err
+			}
+			b := resp.Body.(*body)
+			releaseAttempt := b.release
+			b.release = func() {
+				releaseAttempt()
+				cancelTotal(nil)
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, retryDrainLimit))
+			_ = resp.Body.Close()
+		}
+		if errWait := sleep(ctx, wait); errWait != nil {
+			cancelTotal(nil)
+			return nil, errWait
+		}
+		attemptReq = req.Clone(req.Context())
+		if req.Body != nil && req.Body != http.NoBody {
+			body, errBody := req.GetBody()
+			if errBody != nil {
+				cancelTotal(nil)
+				return nil, errBody
+			}
+			attemptReq.Body = body
+		}
+	}
+}
+
+// attempt sends one request. The read timeout covers the wait for response headers
+// and each gap between body reads; the returned body releases ctx when closed.
+func (t *Transport) attempt(ctx context.Context, base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	attemptCtx, cancel := context.WithCancelCause(ctx)
+	var timer *time.Timer
+	if t.Policy.Read > 0 {
+		expired := &TimeoutError{Phase: PhaseRead, Limit: t.Policy.Read}
+		timer = time.AfterFunc(t.Policy.Read, func() { cancel(expired) })
+	}
+	resp, err := base.RoundTrip(req.WithContext(attemptCtx))
+	if err != nil {
+		if timer != nil {
+			timer.Stop()
+		}
+		err = timeoutCause(attemptCtx, err)
+		cancel(nil)
+		return nil, err
+	}
+	if timer != nil {
+		timer.Reset(t.Policy.Read)
+	}
+	resp.Body = &body{
+		ReadCloser: resp.Body,
+		ctx:        attemptCtx,
+		timer:      timer,
+		read:       t.Policy.Read,
+		release:    func() { cancel(nil) },
+	}
+	return resp, nil
+}
+
+func (t *Transport) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return connectFailure(err)
+	}
+	return slices.Contains(t.Policy.StatusCodes, resp.StatusCode)
+}
+
+// backoff returns the wait before the attempt following attempt. A Retry-After header
+// beyond MaxBackoff stops retrying so the response reaches the caller.
+func (t *Transport) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if t.Policy.MaxBackoff > 0 && after > t.Policy.MaxBackoff {
+				return 0, false
+			}
+			return after, true
+		}
+	}
+	wait := t.Policy.InitialBackoff
+	if wait <= 0 {
+		wait = defaultInitialBackoff
+	}
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if t.Policy.MaxBackoff > 0 && wait >= t.Policy.MaxBackoff {
+			break
+		}
+	}
+	if t.Policy.MaxBackoff > 0 && wait > t.Policy.MaxBackoff {
+		wait = t.Policy.MaxBackoff
+	}
+	return wait, true
+}
+
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// connectFailure reports errors raised before the request reached the provider, which
+// are safe to retry.
+func connectFailure(err error) bool {
+	var timeout *TimeoutError
+	if errors.As(err, &timeout) {
+		return timeout.Phase == PhaseConnect
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// timeoutCause replaces err with the TimeoutError that cancelled ctx, if any.
+func timeoutCause(ctx context.Context, err error) error {
+	var timeout *TimeoutError
+	if errors.As(context.Cause(ctx), &timeout) {
+		return timeout
+	}
+	return err
+}
+
+func sleep(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return timeoutCause(ctx, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// body restarts the read timeout on every read and releases the call's contexts on close.
+type body struct {
+	io.ReadCloser
+	ctx     context.Context
+	timer   *time.Timer
+	read    time.Duration
+	release func()
+	once    sync.Once
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		return n, timeoutCause(b.ctx, err)
+	}
+	if b.timer != nil && err == nil {
+		b.timer.Reset(b.read)
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		b.release()
+	})
+	return err
+}
+
+var defaultTransports sync.Map // connect timeout -> *http.Transport
+
+// DefaultTransport returns a shared clone of http.DefaultTransport whose connections
+// time out after connect; it is http.DefaultTransport itself when connect is zero.
+func DefaultTransport(connect time.Duration) http.RoundTripper {
+	if connect <= 0 {
+		return http.DefaultTransport
+	}
+	if cached, ok := defaultTransports.Load(connect); ok {
+		return cached.(*http.Transport)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = nil
+	ApplyConnectTimeout(transport, connect)
+	actual, _ := defaultTransports.LoadOrStore(connect, transport)
+	return actual.(*http.Transport)
+}
+
+// ApplyConnectTimeout bounds dialing and the TLS handshake of transport. Transports
+// with a custom dialer, such as SOCKS5 proxies, keep their dialer.
+func ApplyConnectTimeout(transport *http.Transport, connect time.Duration) {
+	if transport == nil || connect <= 0 {
+		return
+	}
+	transport.TLSHandshakeTimeout = connect
+	if transport.DialContext != nil {
+		return
+	}
+	dialer := &net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		var netErr net.Error
+		if err != nil && errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+			return nil, &TimeoutError{Phase: PhaseConnect, Limit: connect}
+		}
+		return conn, err
+	}
+}
@@ -0,0 +1,123 @@
+package upstream
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestRetryOnStatus(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("attempt %d got body %q", calls.Load()+1, body)
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: WrapTransport(nil, Policy{MaxAttempts: 3, StatusCodes: []int{503}, InitialBackoff: time.Millisecond})}
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" || calls.Load() != 3 {
+		t.Fatalf("unexpected result %d %q after %d calls", resp.StatusCode, body, calls.Load())
+	}
+}
+
+func TestRetryAfterBeyondMaxBackoff(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: WrapTransport(nil, Policy{MaxAttempts: 3, StatusCodes: []int{429}, MaxBackoff: time.Second})}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || calls.Load() != 1 {
+		t.Fatalf("expected the 429 without retrying, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := &http.Client{Transport: WrapTransport(nil, Policy{Read: 100 * time.Millisecond})}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, err = io.ReadAll(resp.Body)
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Phase != PhaseRead || timeout.StatusCode() != http.StatusGatewayTimeout {
+		t.Fatalf("expected a read timeout, got %v", err)
+	}
+}
+
+func TestTotalTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: WrapTransport(nil, Policy{Total: 100 * time.Millisecond})}
+	_, err := client.Get(srv.URL)
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Phase != PhaseTotal {
+		t.Fatalf("expected a total timeout, got %v", err)
+	}
+}
+
+func TestPolicyFromConfig(t *testing.T) {
+	cfg := config.UpstreamConfig{
+		UpstreamPolicy: config.UpstreamPolicy{
+			ConnectTimeoutSeconds: 5,
+			Retry:                 config.UpstreamRetry{MaxAttempts: 2, StatusCodes: []int{502}},
+		},
+		Providers: map[string]config.UpstreamPolicy{
+			"Claude": {ReadTimeoutSeconds: 30, Retry: config.UpstreamRetry{MaxAttempts: 4}},
+		},
+	}
+	p := PolicyFromConfig(cfg.For("claude"))
+	if p.Connect != 5*time.Second || p.Read != 30*time.Second || p.MaxAttempts != 4 || len(p.StatusCodes) != 1 {
+		t.Fatalf("unexpected merged policy %+v", p)
+	}
+	if p = PolicyFromConfig(cfg.For("codex")); p.Read != 0 || p.MaxAttempts != 2 {
+		t.Fatalf("unexpected default policy %+v", p)
+	}
+	if WrapTransport(http.DefaultTransport, Policy{Connect: time.Second}) != http.DefaultTransport {
+		t.Fatal("expected a connect-only policy to leave the transport alone")
+	}
+}
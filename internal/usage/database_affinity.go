@@ -0,0 +1,59 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// affinityPruneInterval bounds how often expired session affinity rows are deleted.
+const affinityPruneInterval = time.Hour
+
+// SessionAffinityStore persists the auth manager's conversation bindings in the usage
+// database so sticky routing survives restarts. It is a no-op while the database is
+// disabled or opened read-only.
+type SessionAffinityStore struct {
+	lastPrune atomic.Int64
+}
+
+// LoadAffinity returns the credential bound to key if the binding has not expired.
+func (a *SessionAffinityStore) LoadAffinity(ctx context.Context, key string, now time.Time) (string, bool, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return "", false, nil
+	}
+	var authID string
+	err := store.db.QueryRowContext(ctx,
+		`SELECT auth_id FROM usage_session_affinity WHERE affinity_key = ? AND expires_at > ?`,
+		key, now.UTC()).Scan(&authID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return authID, true, nil
+}
+
+// SaveAffinity binds key to authID until expiresAt, replacing any earlier binding.
+func (a *SessionAffinityStore) SaveAffinity(ctx context.Context, key, authID string, expiresAt time.Time) error {
+	store := currentUsageStore.Load()
+	if store == nil || store.readOnly {
+		return nil
+	}
+	if _, err := store.db.ExecContext(ctx, `
+		INSERT INTO usage_session_affinity (affinity_key, auth_id, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(affinity_key) DO UPDATE SET auth_id = excluded.auth_id, expires_at = excluded.expires_at;`,
+		key, authID, expiresAt.UTC()); err != nil {
+		return err
+	}
+	now := time.Now()
+	last := a.lastPrune.Load()
+	if now.Sub(time.Unix(0, last)) < affinityPruneInterval || !a.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return nil
+	}
+	_, err := store.db.ExecContext(ctx, `DELETE FROM usage_session_affinity WHERE expires_at <= ?`, now.UTC())
+	return err
+}
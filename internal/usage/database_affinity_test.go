@@ -0,0 +1,39 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionAffinityStoreRoundTrip(t *testing.T) {
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	currentUsageStore.Store(store)
+	defer func() {
+		currentUsageStore.Store(nil)
+		store.close()
+	}()
+
+	ctx := context.Background()
+	affinity := &SessionAffinityStore{}
+	now := time.Now()
+	if err = affinity.SaveAffinity(ctx, "codex|conv-1", "auth-a", now.Add(time.Hour)); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err = affinity.SaveAffinity(ctx, "codex|conv-1", "auth-b", now.Add(time.Hour)); err != nil {
+		t.Fatalf("rebind: %v", err)
+	}
+	if authID, ok, errLoad := affinity.LoadAffinity(ctx, "codex|conv-1", now); errLoad != nil || !ok || authID != "auth-b" {
+		t.Fatalf("load = %q, %v, %v; want auth-b", authID, ok, errLoad)
+	}
+	if _, ok, _ := affinity.LoadAffinity(ctx, "codex|conv-1", now.Add(2*time.Hour)); ok {
+		t.Fatal("expired binding must not be returned")
+	}
+	if _, ok, _ := affinity.LoadAffinity(ctx, "codex|unknown", now); ok {
+		t.Fatal("unknown conversation must not be bound")
+	}
+}
@@ -0,0 +1,262 @@
+package usage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+const defaultArchiveTimeout = 2 * time.Minute
+
+// ArchiveOptions configures archival of expired usage_requests rows to S3-compatible
+// object storage.
+type ArchiveOptions struct {
+	Enabled   bool
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Insecure  bool
+	PathStyle bool
+	Timeout   time.Duration
+}
+
+// ArchiveStatus reports the uploads of the usage archiver.
+type ArchiveStatus struct {
+	Enabled bool   `json:"enabled"`
+	Bucket  string `json:"bucket,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	// Objects and Rows count the objects and usage_requests rows uploaded.
+	Objects    uint64 `json:"objects"`
+	Rows       uint64 `json:"rows"`
+	LastObject string `json:"last-object,omitempty"`
+	// Uploads tracks archive passes; a failed pass keeps the rows for the next one.
+	Uploads ExporterHealth `json:"uploads"`
+}
+
+// archiveUploader stores one object of size bytes under key.
+type archiveUploader interface {
+	upload(ctx context.Context, key string, r io.Reader, size int64) error
+}
+
+type minioUploader struct {
+	client *minio.Client
+	bucket string
+}
+
+func (u minioUploader) upload(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := u.client.PutObject(ctx, u.bucket, key, r, size, minio.PutObjectOptions{ContentType: "application/gzip"})
+	return err
+}
+
+type usageArchiver struct {
+	opts     ArchiveOptions
+	uploader archiveUploader
+
+	objects    atomic.Uint64
+	rows       atomic.Uint64
+	lastObject atomic.Pointer[string]
+	uploads    healthTracker
+}
+
+// archivedRequests describes the rows uploaded by one archive pass. maxID is the
+// highest archived row ID, or 0 when nothing had expired.
+type archivedRequests struct {
+	rows   int64
+	object string
+	maxID  int64
+}
+
+var (
+	currentArchiver  atomic.Pointer[usageArchiver]
+	archiverConfigMu sync.Mutex
+)
+
+// ArchiveOptionsFromConfig converts the usage-db.archive configuration block.
+func ArchiveOptionsFromConfig(cfg config.UsageArchiveConfig) ArchiveOptions {
+	return ArchiveOptions{
+		Enabled:   cfg.Enabled,
+		Endpoint:  cfg.Endpoint,
+		Bucket:    cfg.Bucket,
+		Prefix:    cfg.Prefix,
+		Region:    cfg.Region,
+		AccessKey: cfg.AccessKey,
+		SecretKey: cfg.SecretKey,
+		Insecure:  cfg.Insecure,
+		PathStyle: cfg.PathStyle,
+		Timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+	}
+}
+
+// ConfigureArchive enables, reconfigures or disables archival of expired usage rows.
+// While enabled, retention only deletes usage_requests rows after they were uploaded.
+func ConfigureArchive(opts ArchiveOptions) error {
+	archiverConfigMu.Lock()
+	defer archiverConfigMu.Unlock()
+
+	normalized := normalizeArchiveOptions(opts)
+	if prev := currentArchiver.Load(); prev != nil && reflect.DeepEqual(prev.opts, normalized) {
+		return nil
+	}
+	if !normalized.Enabled {
+		currentArchiver.Store(nil)
+		return nil
+	}
+	if normalized.Endpoint == "" || normalized.Bucket == "" {
+		return errors.New("usage: archive endpoint and bucket are required")
+	}
+	options := &minio.Options{
+		Creds:  credentials.NewStaticV4(normalized.AccessKey, normalized.SecretKey, ""),
+		Secure: !normalized.Insecure,
+		Region: normalized.Region,
+	}
+	if normalized.PathStyle {
+		options.BucketLookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(normalized.Endpoint, options)
+	if err != nil {
+		return fmt.Errorf("usage: create archive client: %w", err)
+	}
+	currentArchiver.Store(&usageArchiver{opts: normalized, uploader: minioUploader{client: client, bucket: normalized.Bucket}})
+	return nil
+}
+
+func normalizeArchiveOptions(opts ArchiveOptions) ArchiveOptions {
+	opts.Endpoint = strings.TrimSpace(opts.Endpoint)
+	opts.Bucket = strings.TrimSpace(opts.Bucket)
+	opts.Prefix = strings.Trim(strings.TrimSpace(opts.Prefix), "/")
+	opts.Region = strings.TrimSpace(opts.Region)
+	opts.AccessKey = strings.TrimSpace(opts.AccessKey)
+	opts.SecretKey = strings.TrimSpace(opts.SecretKey)
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultArchiveTimeout
+	}
+	return opts
+}
+
+// CurrentArchiveStatus reports the usage archiver counters.
+func CurrentArchiveStatus() ArchiveStatus {
+	a := currentArchiver.Load()
+	if a == nil {
+		return ArchiveStatus{}
+	}
+	status := ArchiveStatus{
+		Enabled: true,
+		Bucket:  a.opts.Bucket,
+		Prefix:  a.opts.Prefix,
+		Objects: a.objects.Load(),
+		Rows:    a.rows.Load(),
+		Uploads: a.uploads.snapshot(),
+	}
+	if last := a.lastObject.Load(); last != nil {
+		status.LastObject = *last
+	}
+	return status
+}
+
+// archive uploads the usage_requests rows that retention is about to delete as one
+// gzip-compressed JSON lines object (one ExportRecord per line). Nothing is uploaded
+// when no row has expired.
+func (a *usageArchiver) archive(ctx context.Context, s *usageStore, now time.Time, policy *retentionPolicy) (archivedRequests, error) {
+	var out archivedRequests
+	clauses, args := expiredRequestClauses(now, policy)
+	if len(clauses) == 0 {
+		return out, nil
+	}
+	query := `SELECT ` + exportRecordColumns + ` FROM usage_requests WHERE (` + strings.Join(clauses, `) OR (`) + `) ORDER BY id ASC`
+	var flatArgs []any
+	for _, clauseArgs := range args {
+		flatArgs = append(flatArgs, clauseArgs...)
+	}
+
+	staging, err := os.CreateTemp("", "cliproxy-usage-archive-*.jsonl.gz")
+	if err != nil {
+		return out, err
+	}
+	defer func() {
+		_ = staging.Close()
+		_ = os.Remove(staging.Name())
+	}()
+	gz := gzip.NewWriter(staging)
+	buffered := bufio.NewWriter(gz)
+
+	rows, err := s.db.QueryContext(ctx, query, flatArgs...)
+	if err != nil {
+		return out, err
+	}
+	var minID int64
+	for rows.Next() {
+		rec, errScan := scanExportRecord(rows)
+		if errScan != nil {
+			_ = rows.Close()
+			return out, errScan
+		}
+		line, errMarshal := json.Marshal(rec)
+		if errMarshal != nil {
+			_ = rows.Close()
+			return out, errMarshal
+		}
+		if _, err = buffered.Write(append(line, '\n')); err != nil {
+			_ = rows.Close()
+			return out, err
+		}
+		if out.rows == 0 {
+			minID = rec.ID
+		}
+		out.rows++
+		out.maxID = rec.ID
+	}
+	if err = rows.Close(); err != nil {
+		return out, err
+	}
+	if err = rows.Err(); err != nil {
+		return out, err
+	}
+	if out.rows == 0 {
+		return out, nil
+	}
+	if err = buffered.Flush(); err != nil {
+		return out, err
+	}
+	if err = gz.Close(); err != nil {
+		return out, err
+	}
+	size, err := staging.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return out, err
+	}
+	if _, err = staging.Seek(0, io.SeekStart); err != nil {
+		return out, err
+	}
+
+	day := now.UTC()
+	key := path.Join(a.opts.Prefix, "usage_requests", day.Format("2006/01/02"),
+		fmt.Sprintf("usage-requests-%d-%d.jsonl.gz", minID, out.maxID))
+	uploadCtx, cancel := context.WithTimeout(ctx, a.opts.Timeout)
+	defer cancel()
+	if err = a.uploader.upload(uploadCtx, key, staging, size); err != nil {
+		return archivedRequests{}, fmt.Errorf("upload %s: %w", key, err)
+	}
+	out.object = key
+	a.objects.Add(1)
+	a.rows.Add(uint64(out.rows))
+	a.lastObject.Store(&key)
+	return out, nil
+}
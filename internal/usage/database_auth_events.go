@@ -0,0 +1,125 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxAuthEventReason bounds the stored error message of a failed refresh.
+const maxAuthEventReason = 1024
+
+func init() {
+	events.Subscribe(RecordAuthEvent, events.CredentialRefreshed, events.CredentialRefreshFailed)
+}
+
+// RecordAuthEvent stores a credential refresh outcome published on the event bus. It
+// is a no-op while the database is disabled or opened read-only.
+func RecordAuthEvent(evt events.Event) {
+	store := currentUsageStore.Load()
+	if store == nil || store.readOnly {
+		return
+	}
+	timestamp := evt.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	reason := evt.Reason
+	if len(reason) > maxAuthEventReason {
+		reason = strings.ToValidUTF8(reason[:maxAuthEventReason], "")
+	}
+	str := func(key string) string {
+		if v, ok := evt.Data[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	num := func(key string) int64 {
+		switch v := evt.Data[key].(type) {
+		case int:
+			return int64(v)
+		case int64:
+			return v
+		case float64:
+			return int64(v)
+		}
+		return 0
+	}
+	_, err := store.db.Exec(`
+		INSERT INTO auth_events (
+			timestamp, type, provider, auth_id, reason, duration_ms,
+			consecutive_failures, expires_at, retry_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		timestamp.UTC(), string(evt.Type), evt.Provider, evt.AuthID, reason, num("duration_ms"),
+		num("consecutive_failures"), str("expires_at"), str("retry_at"))
+	if err != nil {
+		log.WithError(err).Warn("usage: failed to store auth event")
+	}
+}
+
+// AuthEventRow is one recorded credential refresh outcome.
+type AuthEventRow struct {
+	ID                  int64  `json:"id"`
+	Timestamp           string `json:"timestamp"`
+	Type                string `json:"type"`
+	Provider            string `json:"provider"`
+	AuthID              string `json:"auth_id"`
+	Reason              string `json:"reason,omitempty"`
+	DurationMs          int64  `json:"duration_ms"`
+	ConsecutiveFailures int64  `json:"consecutive_failures,omitempty"`
+	ExpiresAt           string `json:"expires_at,omitempty"`
+	RetryAt             string `json:"retry_at,omitempty"`
+}
+
+// QueryAuthEvents returns the auth events at or after since, newest first, optionally
+// filtered by auth ID and capped at limit rows. A positive beforeID resumes after the
+// event with that ID, so consecutive calls page through the events.
+func QueryAuthEvents(ctx context.Context, since time.Time, authID string, limit int, beforeID int64) ([]AuthEventRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := `
+		SELECT id, CAST(timestamp AS TEXT), type, provider, auth_id, reason, duration_ms,
+			consecutive_failures, expires_at, retry_at
+		FROM auth_events
+		WHERE timestamp >= ?`
+	args := []any{since.UTC()}
+	if authID = strings.TrimSpace(authID); authID != "" {
+		query += ` AND auth_id = ?`
+		args = append(args, authID)
+	}
+	if beforeID > 0 {
+		query += ` AND (timestamp, id) < ((SELECT timestamp FROM auth_events WHERE id = ?), ?)`
+		args = append(args, beforeID, beforeID)
+	}
+	query += ` ORDER BY timestamp DESC, id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]AuthEventRow, 0)
+	for rows.Next() {
+		var row AuthEventRow
+		if err := rows.Scan(&row.ID, &row.Timestamp, &row.Type, &row.Provider, &row.AuthID, &row.Reason,
+			&row.DurationMs, &row.ConsecutiveFailures, &row.ExpiresAt, &row.RetryAt); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
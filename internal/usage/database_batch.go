@@ -0,0 +1,278 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Batch job statuses, matching the OpenAI Batch API.
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// ErrBatchNotFound is returned when a batch job or batch file does not exist.
+var ErrBatchNotFound = errors.New("usage: batch not found")
+
+// BatchFile is a file uploaded for, or produced by, a batch job.
+type BatchFile struct {
+	ID         string
+	Purpose    string
+	Filename   string
+	Bytes      int64
+	CreatedAt  time.Time
+	APIKeyHash string
+}
+
+// BatchError describes why a batch, or one line of its input, failed.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    *int   `json:"line,omitempty"`
+}
+
+// Batch is the persisted state of a batch job.
+type Batch struct {
+	ID               string
+	APIKeyHash       string
+	Endpoint         string
+	InputFileID      string
+	OutputFileID     string
+	ErrorFileID      string
+	Status           string
+	CompletionWindow string
+	Metadata         map[string]string
+	Errors           []BatchError
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+	InProgressAt     *time.Time
+	FinalizingAt     *time.Time
+	CompletedAt      *time.Time
+	FailedAt         *time.Time
+	ExpiredAt        *time.Time
+	CancellingAt     *time.Time
+	CancelledAt      *time.Time
+	Total            int
+	Completed        int
+	Failed           int
+}
+
+// Terminal reports whether the batch has reached a final status.
+func (b Batch) Terminal() bool {
+	switch b.Status {
+	case BatchStatusFailed, BatchStatusCompleted, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CreateBatchFile stores a batch input or output file together with its content.
+func CreateBatchFile(ctx context.Context, file BatchFile, content []byte) error {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return ErrDatabaseDisabled
+	}
+	if store.readOnly {
+		return ErrReadOnly
+	}
+	_, err := store.db.ExecContext(ctx, `
+		INSERT INTO usage_batch_files (id, purpose, filename, bytes, created_at, api_key_hash, content)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		file.ID, file.Purpose, file.Filename, int64(len(content)), file.CreatedAt.UTC(), file.APIKeyHash, content)
+	return err
+}
+
+// GetBatchFile returns the metadata of a stored batch file.
+func GetBatchFile(ctx context.Context, id string) (BatchFile, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return BatchFile{}, ErrDatabaseDisabled
+	}
+	var file BatchFile
+	err := store.db.QueryRowContext(ctx, `
+		SELECT id, purpose, filename, bytes, created_at, api_key_hash
+		FROM usage_batch_files WHERE id = ?;`, id).
+		Scan(&file.ID, &file.Purpose, &file.Filename, &file.Bytes, &file.CreatedAt, &file.APIKeyHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BatchFile{}, ErrBatchNotFound
+	}
+	return file, err
+}
+
+// BatchFileContent returns the content of a stored batch file.
+func BatchFileContent(ctx context.Context, id string) ([]byte, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	var content []byte
+	err := store.db.QueryRowContext(ctx, `SELECT content FROM usage_batch_files WHERE id = ?`, id).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBatchNotFound
+	}
+	return content, err
+}
+
+// SaveBatch inserts or replaces the stored state of a batch job.
+func SaveBatch(ctx context.Context, batch Batch) error {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return ErrDatabaseDisabled
+	}
+	if store.readOnly {
+		return ErrReadOnly
+	}
+	metadata, err := json.Marshal(batch.Metadata)
+	if err != nil {
+		return err
+	}
+	batchErrors, err := json.Marshal(batch.Errors)
+	if err != nil {
+		return err
+	}
+	_, err = store.db.ExecContext(ctx, `
+		INSERT INTO usage_batches (
+			id, api_key_hash, endpoint, input_file_id, output_file_id, error_file_id,
+			status, completion_window, metadata, errors, created_at, expires_at,
+			in_progress_at, finalizing_at, completed_at, failed_at, expired_at,
+			cancelling_at, cancelled_at, total, completed, failed
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			output_file_id = excluded.output_file_id,
+			error_file_id = excluded.error_file_id,
+			status = excluded.status,
+			metadata = excluded.metadata,
+			errors = excluded.errors,
+			in_progress_at = excluded.in_progress_at,
+			finalizing_at = excluded.finalizing_at,
+			completed_at = excluded.completed_at,
+			failed_at = excluded.failed_at,
+			expired_at = excluded.expired_at,
+			cancelling_at = excluded.cancelling_at,
+			cancelled_at = excluded.cancelled_at,
+			total = excluded.total,
+			completed = excluded.completed,
+			failed = excluded.failed;`,
+		batch.ID, batch.APIKeyHash, batch.Endpoint, batch.InputFileID, batch.OutputFileID, batch.ErrorFileID,
+		batch.Status, batch.CompletionWindow, string(metadata), string(batchErrors), batch.CreatedAt.UTC(), batch.ExpiresAt.UTC(),
+		nullTime(batch.InProgressAt), nullTime(batch.FinalizingAt), nullTime(batch.CompletedAt), nullTime(batch.FailedAt), nullTime(batch.ExpiredAt),
+		nullTime(batch.CancellingAt), nullTime(batch.CancelledAt), batch.Total, batch.Completed, batch.Failed)
+	return err
+}
+
+const batchColumns = `id, api_key_hash, endpoint, input_file_id, output_file_id, error_file_id,
+	status, completion_window, metadata, errors, created_at, expires_at,
+	in_progress_at, finalizing_at, completed_at, failed_at, expired_at,
+	cancelling_at, cancelled_at, total, completed, failed`
+
+// GetBatch returns the stored state of a batch job.
+func GetBatch(ctx context.Context, id string) (Batch, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return Batch{}, ErrDatabaseDisabled
+	}
+	batch, err := scanBatch(store.db.QueryRowContext(ctx, `SELECT `+batchColumns+` FROM usage_batches WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Batch{}, ErrBatchNotFound
+	}
+	return batch, err
+}
+
+// ListBatches returns up to limit batch jobs owned by apiKeyHash, newest first,
+// starting after the batch with ID after when it is set.
+func ListBatches(ctx context.Context, apiKeyHash, after string, limit int) ([]Batch, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	query := `SELECT ` + batchColumns + ` FROM usage_batches WHERE api_key_hash = ?`
+	args := []any{apiKeyHash}
+	if after != "" {
+		query += ` AND rowid < (SELECT rowid FROM usage_batches WHERE id = ?)`
+		args = append(args, after)
+	}
+	query += ` ORDER BY rowid DESC LIMIT ?`
+	args = append(args, limit)
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []Batch
+	for rows.Next() {
+		batch, errScan := scanBatch(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+		out = append(out, batch)
+	}
+	return out, rows.Err()
+}
+
+// failInterruptedBatches marks batches left unfinished by a previous process as
+// failed; their workers did not survive the restart.
+func (s *usageStore) failInterruptedBatches() error {
+	errs, _ := json.Marshal([]BatchError{{Code: "interrupted", Message: "batch was interrupted by a server restart"}})
+	_, err := s.db.Exec(`
+		UPDATE usage_batches SET status = ?, failed_at = ?, errors = ?
+		WHERE status IN (?, ?, ?, ?);`,
+		BatchStatusFailed, time.Now().UTC(), string(errs),
+		BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanBatch(row rowScanner) (Batch, error) {
+	var (
+		batch                                     Batch
+		metadata, batchErrors                     string
+		inProgress, finalizing, completed, failed sql.NullTime
+		expired, cancelling, cancelled            sql.NullTime
+	)
+	if err := row.Scan(&batch.ID, &batch.APIKeyHash, &batch.Endpoint, &batch.InputFileID, &batch.OutputFileID, &batch.ErrorFileID,
+		&batch.Status, &batch.CompletionWindow, &metadata, &batchErrors, &batch.CreatedAt, &batch.ExpiresAt,
+		&inProgress, &finalizing, &completed, &failed, &expired,
+		&cancelling, &cancelled, &batch.Total, &batch.Completed, &batch.Failed); err != nil {
+		return Batch{}, err
+	}
+	_ = json.Unmarshal([]byte(metadata), &batch.Metadata)
+	_ = json.Unmarshal([]byte(batchErrors), &batch.Errors)
+	batch.InProgressAt = timePtr(inProgress)
+	batch.FinalizingAt = timePtr(finalizing)
+	batch.CompletedAt = timePtr(completed)
+	batch.FailedAt = timePtr(failed)
+	batch.ExpiredAt = timePtr(expired)
+	batch.CancellingAt = timePtr(cancelling)
+	batch.CancelledAt = timePtr(cancelled)
+	return batch, nil
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time.UTC()
+	return &v
+}
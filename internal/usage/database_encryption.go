@@ -0,0 +1,141 @@
+package usage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credcrypt"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultDatabaseKeyEnv is read when usage-db.encryption names no key source.
+const DefaultDatabaseKeyEnv = "CLIPROXY_USAGE_DB_KEY"
+
+// sealedColumnPrefix marks an encrypted column value. Values without it are
+// plaintext written before encryption was enabled and are returned unchanged.
+const sealedColumnPrefix = "enc:v1:"
+
+// DatabaseEncryption selects the key that encrypts credential labels, account
+// emails and client labels in the usage database.
+type DatabaseEncryption struct {
+	Enabled    bool
+	KeyEnv     string
+	KeyFile    string
+	KeyCommand string
+}
+
+// DatabaseEncryptionFromConfig converts the usage-db encryption settings.
+func DatabaseEncryptionFromConfig(cfg config.UsageEncryptionConfig) DatabaseEncryption {
+	enc := DatabaseEncryption{
+		Enabled:    cfg.Enabled,
+		KeyEnv:     strings.TrimSpace(cfg.KeyEnv),
+		KeyFile:    strings.TrimSpace(cfg.KeyFile),
+		KeyCommand: strings.TrimSpace(cfg.KeyCommand),
+	}
+	if enc.KeyEnv == "" {
+		enc.KeyEnv = DefaultDatabaseKeyEnv
+	}
+	return enc
+}
+
+// columnCipher encrypts column values deterministically: the nonce is an HMAC of
+// the plaintext, so equal values produce equal ciphertexts and GROUP BY, MAX and
+// equality lookups keep working on encrypted columns.
+type columnCipher struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+var activeColumnCipher atomic.Pointer[columnCipher]
+
+func configureColumnCipher(enc DatabaseEncryption) error {
+	if !enc.Enabled {
+		activeColumnCipher.Store(nil)
+		return nil
+	}
+	key, err := credcrypt.LoadKey(credcrypt.Options{
+		Enabled:    true,
+		KeyEnv:     enc.KeyEnv,
+		KeyFile:    enc.KeyFile,
+		KeyCommand: enc.KeyCommand,
+	})
+	if err != nil {
+		return fmt.Errorf("usage: load database encryption key: %w", err)
+	}
+	c, err := newColumnCipher(key.Derive("usage-db column encryption"), key.Derive("usage-db column nonce"))
+	if err != nil {
+		return err
+	}
+	activeColumnCipher.Store(c)
+	return nil
+}
+
+func newColumnCipher(encKey, nonceKey []byte) (*columnCipher, error) {
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("usage: database encryption cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("usage: database encryption cipher: %w", err)
+	}
+	return &columnCipher{aead: aead, nonceKey: nonceKey}, nil
+}
+
+// sealColumn encrypts value when database encryption is on. Empty values stay
+// empty, so checks for an empty column keep their meaning.
+func sealColumn(value string) string {
+	c := activeColumnCipher.Load()
+	if c == nil || value == "" || strings.HasPrefix(value, sealedColumnPrefix) {
+		return value
+	}
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), nil)
+	return sealedColumnPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// openColumn decrypts a value written by sealColumn. Plaintext values, and sealed
+// values that cannot be opened with the configured key, are returned unchanged.
+func openColumn(value string) string {
+	if !strings.HasPrefix(value, sealedColumnPrefix) {
+		return value
+	}
+	c := activeColumnCipher.Load()
+	if c == nil {
+		return value
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value[len(sealedColumnPrefix):])
+	if err != nil || len(raw) < c.aead.NonceSize() {
+		return value
+	}
+	nonce, ciphertext := raw[:c.aead.NonceSize()], raw[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return value
+	}
+	return string(plain)
+}
+
+// warnSealedColumns logs when the database holds encrypted values that the current
+// configuration cannot read.
+func (s *usageStore) warnSealedColumns() {
+	if activeColumnCipher.Load() != nil {
+		return
+	}
+	var found int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM (
+		SELECT 1 FROM usage_requests WHERE credential_label LIKE ? OR account_email LIKE ? LIMIT 1
+	)`, sealedColumnPrefix+"%", sealedColumnPrefix+"%").Scan(&found)
+	if err == nil && found > 0 {
+		log.Warn("usage: the database holds encrypted labels but usage-db.encryption is disabled; they are shown encrypted")
+	}
+}
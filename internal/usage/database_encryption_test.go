@@ -0,0 +1,71 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatabaseEncryptionSealsLabels(t *testing.T) {
+	t.Setenv("USAGE_TEST_DB_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err := configureColumnCipher(DatabaseEncryption{Enabled: true, KeyEnv: "USAGE_TEST_DB_KEY"}); err != nil {
+		t.Fatalf("configureColumnCipher: %v", err)
+	}
+	defer activeColumnCipher.Store(nil)
+
+	sealed := sealColumn("acct@example.com")
+	if !strings.HasPrefix(sealed, sealedColumnPrefix) || strings.Contains(sealed, "acct") {
+		t.Fatalf("label not sealed: %q", sealed)
+	}
+	if again := sealColumn("acct@example.com"); again != sealed {
+		t.Fatalf("sealing must be deterministic: %q != %q", again, sealed)
+	}
+	if sealColumn("") != "" || openColumn("plain") != "plain" {
+		t.Fatal("empty and plaintext values must pass through")
+	}
+
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("newUsageStore: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	for _, label := range []string{sealed, "legacy@example.com"} {
+		if err = store.insert(dbRecord{
+			Timestamp:             time.Now().UTC(),
+			Provider:              "claude",
+			Model:                 "claude-sonnet",
+			CredentialLabel:       label,
+			CredentialFingerprint: "fp-" + label[:4],
+			AccountEmail:          label,
+			StatusCode:            200,
+		}); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	var raw int
+	if err = store.db.QueryRow(`SELECT COUNT(*) FROM usage_daily WHERE credential_label LIKE '%acct%'`).Scan(&raw); err != nil || raw != 0 {
+		t.Fatalf("plaintext label stored in usage_daily (count=%d err=%v)", raw, err)
+	}
+
+	rows, err := QueryCredentialUsage(context.Background(), time.Now().Add(-time.Hour), "")
+	if err != nil {
+		t.Fatalf("QueryCredentialUsage: %v", err)
+	}
+	labels := map[string]string{}
+	for _, row := range rows {
+		labels[row.CredentialLabel] = row.AccountEmail
+	}
+	if labels["acct@example.com"] != "acct@example.com" || labels["legacy@example.com"] != "legacy@example.com" {
+		t.Fatalf("unexpected decrypted rows: %+v", rows)
+	}
+
+	activeColumnCipher.Store(nil)
+	if openColumn(sealed) != sealed {
+		t.Fatal("sealed values must be returned unchanged without a key")
+	}
+}
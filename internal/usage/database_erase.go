@@ -0,0 +1,151 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidEraseRequest is returned when an erase request does not name exactly one subject.
+var ErrInvalidEraseRequest = errors.New("usage: exactly one of api key hash or account email is required")
+
+// EraseRequest selects the data subject whose usage rows are anonymized or deleted.
+type EraseRequest struct {
+	// APIKeyHash matches usage_requests.api_key_hash.
+	APIKeyHash string
+	// AccountEmail matches account_email either as a plain address or as its
+	// fingerprint, so it works whether or not hash-account-email is enabled. Values
+	// written with database encryption on are matched as well.
+	AccountEmail string
+	// Delete removes matching rows instead of stripping their identifying columns.
+	Delete bool
+	DryRun bool
+}
+
+// EraseResult reports the rows affected, or that would be affected, by an erase request.
+type EraseResult struct {
+	Mode        string `json:"mode"`
+	DryRun      bool   `json:"dry_run"`
+	Requests    int64  `json:"requests"`
+	DailyRows   int64  `json:"daily_rows"`
+	MonthlyRows int64  `json:"monthly_rows"`
+	// ShadowComparisons counts deleted shadow_comparisons rows. They hold response
+	// text, so they are deleted in both modes.
+	ShadowComparisons int64 `json:"shadow_comparisons"`
+	// RequestIDs are the correlation IDs of the matched requests, used to locate
+	// request log files that belong to the subject.
+	RequestIDs []string `json:"-"`
+}
+
+// EraseSubject anonymizes or deletes the usage rows of one data subject. Anonymizing
+// keeps the rows for aggregate reporting but clears the key hash, client label and
+// account email, and replaces credential labels with the credential fingerprint.
+// Aggregate tables carry no key hash, so only email requests touch them.
+func EraseSubject(ctx context.Context, req EraseRequest) (EraseResult, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return EraseResult{}, ErrDatabaseDisabled
+	}
+	if store.readOnly {
+		return EraseResult{}, ErrReadOnly
+	}
+	return store.erase(ctx, req)
+}
+
+func (s *usageStore) erase(ctx context.Context, req EraseRequest) (EraseResult, error) {
+	result := EraseResult{Mode: "anonymize", DryRun: req.DryRun}
+	if req.Delete {
+		result.Mode = "delete"
+	}
+	keyHash := strings.ToLower(strings.TrimSpace(req.APIKeyHash))
+	email := strings.ToLower(strings.TrimSpace(req.AccountEmail))
+	if (keyHash == "") == (email == "") {
+		return result, ErrInvalidEraseRequest
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var (
+		where string
+		args  []any
+	)
+	if keyHash != "" {
+		where, args = `api_key_hash = ?`, []any{keyHash}
+	} else {
+		where, args = `account_email IN (?, ?, ?, ?)`, []any{email, fingerprint(email), sealColumn(email), sealColumn(fingerprint(email))}
+	}
+
+	s.retentionMu.Lock()
+	defer s.retentionMu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if result.RequestIDs, err = matchingRequestIDs(ctx, tx, where, args); err != nil {
+		return result, fmt.Errorf("usage: erase collect request ids: %w", err)
+	}
+
+	requestsStmt := `DELETE FROM usage_requests WHERE ` + where
+	aggregateStmt := `DELETE FROM %s WHERE ` + where
+	if !req.Delete {
+		if keyHash != "" {
+			requestsStmt = `UPDATE usage_requests SET api_key_hash = '', client_label = '', metadata = '' WHERE ` + where
+		} else {
+			requestsStmt = `UPDATE usage_requests SET account_email = '', client_label = '', metadata = '',
+				credential_label = COALESCE(credential_fingerprint, '') WHERE ` + where
+		}
+		aggregateStmt = `UPDATE %s SET account_email = '', credential_label = credential_fingerprint WHERE ` + where
+	}
+	if result.Requests, err = execCount(ctx, tx, requestsStmt, args); err != nil {
+		return result, fmt.Errorf("usage: erase requests: %w", err)
+	}
+	if keyHash != "" {
+		if result.ShadowComparisons, err = execCount(ctx, tx, `DELETE FROM shadow_comparisons WHERE api_key_hash = ?`, args); err != nil {
+			return result, fmt.Errorf("usage: erase shadow comparisons: %w", err)
+		}
+	}
+	if email != "" {
+		if result.DailyRows, err = execCount(ctx, tx, fmt.Sprintf(aggregateStmt, "usage_daily"), args); err != nil {
+			return result, fmt.Errorf("usage: erase daily rows: %w", err)
+		}
+		if result.MonthlyRows, err = execCount(ctx, tx, fmt.Sprintf(aggregateStmt, "usage_monthly"), args); err != nil {
+			return result, fmt.Errorf("usage: erase monthly rows: %w", err)
+		}
+	}
+	if req.DryRun {
+		return result, nil
+	}
+	return result, tx.Commit()
+}
+
+func matchingRequestIDs(ctx context.Context, tx *sql.Tx, where string, args []any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT request_id FROM usage_requests WHERE request_id <> '' AND `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func execCount(ctx context.Context, tx *sql.Tx, stmt string, args []any) (int64, error) {
+	res, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,72 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageStoreErase(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	keyHash := fingerprint("sk-subject")
+	for _, rec := range []dbRecord{
+		{Timestamp: now, RequestID: "r1", Provider: "claude", Model: "a", CredentialLabel: "alice@example.com.json", CredentialFingerprint: "fp-a", AccountEmail: "alice@example.com", APIKeyHash: keyHash, ClientLabel: "svc"},
+		{Timestamp: now, RequestID: "r2", Provider: "claude", Model: "a", CredentialLabel: "alice@example.com.json", CredentialFingerprint: "fp-a", AccountEmail: fingerprint("alice@example.com")},
+		{Timestamp: now, RequestID: "r3", Provider: "claude", Model: "a", CredentialLabel: "bob", CredentialFingerprint: "fp-b", AccountEmail: "bob@example.com"},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	ctx := context.Background()
+
+	if _, err = store.erase(ctx, EraseRequest{APIKeyHash: keyHash, AccountEmail: "alice@example.com"}); !errors.Is(err, ErrInvalidEraseRequest) {
+		t.Fatalf("expected ErrInvalidEraseRequest for two selectors, got %v", err)
+	}
+
+	dry, err := store.erase(ctx, EraseRequest{AccountEmail: " Alice@Example.com ", Delete: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry-run erase failed: %v", err)
+	}
+	if dry.Requests != 2 || dry.DailyRows != 1 || len(dry.RequestIDs) != 2 {
+		t.Fatalf("unexpected dry-run result: %+v", dry)
+	}
+	var count int
+	if err = store.db.QueryRow(`SELECT COUNT(*) FROM usage_requests`).Scan(&count); err != nil || count != 3 {
+		t.Fatalf("dry run must not delete rows, count=%d err=%v", count, err)
+	}
+
+	anon, err := store.erase(ctx, EraseRequest{APIKeyHash: keyHash})
+	if err != nil {
+		t.Fatalf("anonymize erase failed: %v", err)
+	}
+	if anon.Mode != "anonymize" || anon.Requests != 1 || anon.DailyRows != 0 {
+		t.Fatalf("unexpected anonymize result: %+v", anon)
+	}
+	var hash, label string
+	if err = store.db.QueryRow(`SELECT api_key_hash, client_label FROM usage_requests WHERE request_id = 'r1'`).Scan(&hash, &label); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if hash != "" || label != "" {
+		t.Fatalf("expected key hash and client label cleared, got %q %q", hash, label)
+	}
+
+	anon, err = store.erase(ctx, EraseRequest{AccountEmail: "alice@example.com"})
+	if err != nil || anon.Requests != 2 || anon.DailyRows != 1 {
+		t.Fatalf("unexpected email anonymize result: %+v err=%v", anon, err)
+	}
+	if err = store.db.QueryRow(`SELECT COUNT(*) FROM usage_daily WHERE credential_label LIKE 'alice%' OR account_email <> ''`).Scan(&count); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected only bob's daily row to keep an email, got %d", count)
+	}
+}
@@ -0,0 +1,445 @@
+package usage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Export archive layout. The manifest lists the SHA-256 of every other file and, when
+// a signing key is configured, manifest.sig holds the raw Ed25519 signature of
+// manifest.json, so it can also be checked with
+// "openssl pkeyutl -verify -pubin -inkey pub.pem -rawin -in manifest.json -sigfile manifest.sig".
+const (
+	exportFormatVersion = 1
+	ExportRecordsFile   = "usage.jsonl"
+	ExportManifestFile  = "manifest.json"
+	ExportSignatureFile = "manifest.sig"
+)
+
+// ExportOptions selects the usage_requests rows written to an export archive.
+type ExportOptions struct {
+	// From and To bound the period as [From, To).
+	From time.Time
+	To   time.Time
+	// Provider optionally restricts the export to one provider.
+	Provider string
+	// SigningKey signs the manifest when set.
+	SigningKey ed25519.PrivateKey
+}
+
+// ExportFile is the manifest entry of one archived file.
+type ExportFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// ExportTotals sums the exported records for quick comparison with an invoice.
+type ExportTotals struct {
+	Requests            int64   `json:"requests"`
+	FailedRequests      int64   `json:"failed_requests"`
+	PromptTokens        int64   `json:"prompt_tokens"`
+	CompletionTokens    int64   `json:"completion_tokens"`
+	ReasoningTokens     int64   `json:"reasoning_tokens"`
+	CachedTokens        int64   `json:"cached_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens,omitempty"`
+	TotalTokens         int64   `json:"total_tokens"`
+	AudioSeconds        float64 `json:"audio_seconds,omitempty"`
+	ToolCalls           int64   `json:"tool_calls,omitempty"`
+	ToolResultTokens    int64   `json:"tool_result_tokens,omitempty"`
+	ImageInputs         int64   `json:"image_inputs,omitempty"`
+	DocumentInputs      int64   `json:"document_inputs,omitempty"`
+	MediaBytes          int64   `json:"media_bytes,omitempty"`
+}
+
+// ExportManifest describes an export archive.
+type ExportManifest struct {
+	Version     int          `json:"version"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	From        time.Time    `json:"period_from"`
+	To          time.Time    `json:"period_to"`
+	Provider    string       `json:"provider,omitempty"`
+	Files       []ExportFile `json:"files"`
+	Totals      ExportTotals `json:"totals"`
+	// PublicKey is the base64 Ed25519 public key of the signer; empty when unsigned.
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// ExportRecord is one usage_requests row as written to usage.jsonl.
+type ExportRecord struct {
+	ID                    int64   `json:"id"`
+	Timestamp             string  `json:"timestamp"`
+	RequestID             string  `json:"request_id,omitempty"`
+	Provider              string  `json:"provider"`
+	Model                 string  `json:"model"`
+	RequestedModel        string  `json:"requested_model,omitempty"`
+	CredentialLabel       string  `json:"credential_label"`
+	CredentialFingerprint string  `json:"credential_fingerprint"`
+	AccountEmail          string  `json:"account_email,omitempty"`
+	APIKeyHash            string  `json:"api_key_hash"`
+	Team                  string  `json:"team,omitempty"`
+	StatusCode            int     `json:"status_code"`
+	Failed                bool    `json:"failed"`
+	RateLimited           bool    `json:"rate_limited"`
+	Rejection             string  `json:"rejection,omitempty"`
+	ErrorClass            string  `json:"error_class,omitempty"`
+	PromptTokens          int64   `json:"prompt_tokens"`
+	CompletionTokens      int64   `json:"completion_tokens"`
+	ReasoningTokens       int64   `json:"reasoning_tokens"`
+	CachedTokens          int64   `json:"cached_tokens"`
+	CacheCreationTokens   int64   `json:"cache_creation_tokens,omitempty"`
+	TotalTokens           int64   `json:"total_tokens"`
+	AudioSeconds          float64 `json:"audio_seconds,omitempty"`
+	ToolCalls             int64   `json:"tool_calls,omitempty"`
+	ToolResultTokens      int64   `json:"tool_result_tokens,omitempty"`
+	ImageInputs           int64   `json:"image_inputs,omitempty"`
+	DocumentInputs        int64   `json:"document_inputs,omitempty"`
+	MediaBytes            int64   `json:"media_bytes,omitempty"`
+	DurationMs            int64   `json:"duration_ms"`
+}
+
+// ParseExportPeriod resolves an export period from either a month ("2006-01") or a
+// from/to pair of dates ("2006-01-02", to exclusive). All times are UTC.
+func ParseExportPeriod(month, from, to string) (time.Time, time.Time, error) {
+	month, from, to = strings.TrimSpace(month), strings.TrimSpace(from), strings.TrimSpace(to)
+	if month != "" {
+		if from != "" || to != "" {
+			return time.Time{}, time.Time{}, errors.New("month cannot be combined with from/to")
+		}
+		start, err := time.Parse("2006-01", month)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q, expected YYYY-MM", month)
+		}
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	if from == "" || to == "" {
+		return time.Time{}, time.Time{}, errors.New("a month or both from and to are required")
+	}
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from %q, expected YYYY-MM-DD", from)
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to %q, expected YYYY-MM-DD", to)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, errors.New("to must be after from")
+	}
+	return start, end, nil
+}
+
+// LoadExportSigningKey reads a PEM-encoded PKCS #8 Ed25519 private key.
+func LoadExportSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", path)
+	}
+	return key, nil
+}
+
+// LoadExportPublicKey reads a PEM-encoded Ed25519 public key. A private key file is
+// accepted too, in which case its public half is returned.
+func LoadExportPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	if block.Type == "PRIVATE KEY" {
+		key, errKey := LoadExportSigningKey(path)
+		if errKey != nil {
+			return nil, errKey
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 public key", path)
+	}
+	return key, nil
+}
+
+// ExportUsage writes a gzip-compressed tar archive of the usage_requests rows in the
+// requested period to w: usage.jsonl, manifest.json and, when signed, manifest.sig.
+// The records are staged in a temporary file so their digest is known before the
+// manifest is written.
+func ExportUsage(ctx context.Context, w io.Writer, opts ExportOptions) (ExportManifest, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return ExportManifest{}, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	manifest := ExportManifest{
+		Version:     exportFormatVersion,
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		From:        opts.From.UTC(),
+		To:          opts.To.UTC(),
+		Provider:    strings.ToLower(strings.TrimSpace(opts.Provider)),
+	}
+
+	staging, err := os.CreateTemp("", "cliproxy-usage-export-*.jsonl")
+	if err != nil {
+		return ExportManifest{}, err
+	}
+	defer func() {
+		_ = staging.Close()
+		_ = os.Remove(staging.Name())
+	}()
+	digest := sha256.New()
+	buffered := bufio.NewWriter(io.MultiWriter(staging, digest))
+	size, err := store.writeExportRecords(ctx, buffered, manifest.From, manifest.To, manifest.Provider, &manifest.Totals)
+	if err != nil {
+		return ExportManifest{}, err
+	}
+	if err = buffered.Flush(); err != nil {
+		return ExportManifest{}, err
+	}
+	if _, err = staging.Seek(0, io.SeekStart); err != nil {
+		return ExportManifest{}, err
+	}
+	manifest.Files = []ExportFile{{Name: ExportRecordsFile, SHA256: hex.EncodeToString(digest.Sum(nil)), Bytes: size}}
+
+	var signature []byte
+	if opts.SigningKey != nil {
+		manifest.PublicKey = base64.StdEncoding.EncodeToString(opts.SigningKey.Public().(ed25519.PublicKey))
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return ExportManifest{}, err
+	}
+	if opts.SigningKey != nil {
+		signature = ed25519.Sign(opts.SigningKey, manifestJSON)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	addFile := func(name string, size int64, r io.Reader) error {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: manifest.GeneratedAt, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	}
+	if err = addFile(ExportRecordsFile, size, staging); err != nil {
+		return ExportManifest{}, err
+	}
+	if err = addFile(ExportManifestFile, int64(len(manifestJSON)), bytes.NewReader(manifestJSON)); err != nil {
+		return ExportManifest{}, err
+	}
+	if signature != nil {
+		if err = addFile(ExportSignatureFile, int64(len(signature)), bytes.NewReader(signature)); err != nil {
+			return ExportManifest{}, err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return ExportManifest{}, err
+	}
+	return manifest, gz.Close()
+}
+
+// exportRecordColumns selects a usage_requests row in the order scanExportRecord reads it.
+const exportRecordColumns = `id, CAST(timestamp AS TEXT), request_id, COALESCE(provider, ''), COALESCE(model, ''), requested_model,
+			COALESCE(credential_label, ''), COALESCE(credential_fingerprint, ''), account_email, COALESCE(api_key_hash, ''), team,
+			COALESCE(status_code, 0), COALESCE(failed, 0), COALESCE(rate_limited, 0), rejection, error_class,
+			COALESCE(prompt_tokens, 0), COALESCE(completion_tokens, 0), COALESCE(reasoning_tokens, 0),
+			COALESCE(cached_tokens, 0), cache_creation_tokens, COALESCE(total_tokens, 0), audio_seconds,
+			tool_calls, tool_result_tokens, image_inputs, document_inputs, media_bytes, duration_ms`
+
+func scanExportRecord(rows *sql.Rows) (ExportRecord, error) {
+	var rec ExportRecord
+	err := rows.Scan(&rec.ID, &rec.Timestamp, &rec.RequestID, &rec.Provider, &rec.Model, &rec.RequestedModel,
+		&rec.CredentialLabel, &rec.CredentialFingerprint, &rec.AccountEmail, &rec.APIKeyHash, &rec.Team,
+		&rec.StatusCode, &rec.Failed, &rec.RateLimited, &rec.Rejection, &rec.ErrorClass,
+		&rec.PromptTokens, &rec.CompletionTokens, &rec.ReasoningTokens,
+		&rec.CachedTokens, &rec.CacheCreationTokens, &rec.TotalTokens, &rec.AudioSeconds,
+		&rec.ToolCalls, &rec.ToolResultTokens, &rec.ImageInputs, &rec.DocumentInputs, &rec.MediaBytes, &rec.DurationMs)
+	return rec, err
+}
+
+func (s *usageStore) writeExportRecords(ctx context.Context, w io.Writer, from, to time.Time, provider string, totals *ExportTotals) (int64, error) {
+	query := `SELECT ` + exportRecordColumns + `
+		FROM usage_requests
+		WHERE timestamp >= ? AND timestamp < ?`
+	args := []any{from, to}
+	if provider != "" {
+		query += ` AND LOWER(provider) = ?`
+		args = append(args, provider)
+	}
+	query += ` ORDER BY id ASC;`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var written int64
+	for rows.Next() {
+		rec, errScan := scanExportRecord(rows)
+		if errScan != nil {
+			return written, errScan
+		}
+		rec.CredentialLabel, rec.AccountEmail = openColumn(rec.CredentialLabel), openColumn(rec.AccountEmail)
+		line, errMarshal := json.Marshal(rec)
+		if errMarshal != nil {
+			return written, errMarshal
+		}
+		n, errWrite := w.Write(append(line, '\n'))
+		written += int64(n)
+		if errWrite != nil {
+			return written, errWrite
+		}
+		totals.Requests++
+		if rec.Failed {
+			totals.FailedRequests++
+		}
+		totals.PromptTokens += rec.PromptTokens
+		totals.CompletionTokens += rec.CompletionTokens
+		totals.ReasoningTokens += rec.ReasoningTokens
+		totals.CachedTokens += rec.CachedTokens
+		totals.CacheCreationTokens += rec.CacheCreationTokens
+		totals.TotalTokens += rec.TotalTokens
+		totals.AudioSeconds += rec.AudioSeconds
+		totals.ToolCalls += rec.ToolCalls
+		totals.ToolResultTokens += rec.ToolResultTokens
+		totals.ImageInputs += rec.ImageInputs
+		totals.DocumentInputs += rec.DocumentInputs
+		totals.MediaBytes += rec.MediaBytes
+	}
+	return written, rows.Err()
+}
+
+// ExportVerification is the outcome of checking an export archive.
+type ExportVerification struct {
+	Manifest ExportManifest
+	// Signed reports whether the manifest signature was present and valid.
+	Signed bool
+	// TrustedKey reports whether the signature was checked against a caller-supplied
+	// key rather than the key embedded in the manifest, which only proves integrity.
+	TrustedKey bool
+}
+
+// VerifyExport checks that every file listed in an export archive's manifest matches
+// its digest and, when the manifest is signed, that the signature is valid. With a nil
+// publicKey the key embedded in the manifest is used.
+func VerifyExport(r io.Reader, publicKey ed25519.PublicKey) (ExportVerification, error) {
+	var result ExportVerification
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return result, fmt.Errorf("read archive: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	var manifestJSON, signature []byte
+	digests := make(map[string]ExportFile)
+	tr := tar.NewReader(gz)
+	for {
+		header, errNext := tr.Next()
+		if errors.Is(errNext, io.EOF) {
+			break
+		}
+		if errNext != nil {
+			return result, fmt.Errorf("read archive: %w", errNext)
+		}
+		switch header.Name {
+		case ExportManifestFile:
+			manifestJSON, err = io.ReadAll(tr)
+		case ExportSignatureFile:
+			signature, err = io.ReadAll(tr)
+		default:
+			digest := sha256.New()
+			var n int64
+			n, err = io.Copy(digest, tr)
+			digests[header.Name] = ExportFile{Name: header.Name, SHA256: hex.EncodeToString(digest.Sum(nil)), Bytes: n}
+		}
+		if err != nil {
+			return result, fmt.Errorf("read %s: %w", header.Name, err)
+		}
+	}
+	if manifestJSON == nil {
+		return result, fmt.Errorf("archive has no %s", ExportManifestFile)
+	}
+	if err = json.Unmarshal(manifestJSON, &result.Manifest); err != nil {
+		return result, fmt.Errorf("parse %s: %w", ExportManifestFile, err)
+	}
+	for _, file := range result.Manifest.Files {
+		got, ok := digests[file.Name]
+		if !ok {
+			return result, fmt.Errorf("%s is listed in the manifest but missing", file.Name)
+		}
+		if got.SHA256 != file.SHA256 || got.Bytes != file.Bytes {
+			return result, fmt.Errorf("%s does not match the manifest digest", file.Name)
+		}
+		delete(digests, file.Name)
+	}
+	if len(digests) > 0 {
+		extra := make([]string, 0, len(digests))
+		for name := range digests {
+			extra = append(extra, name)
+		}
+		sort.Strings(extra)
+		return result, fmt.Errorf("archive contains files not listed in the manifest: %s", strings.Join(extra, ", "))
+	}
+
+	key := publicKey
+	if key == nil && result.Manifest.PublicKey != "" {
+		raw, errKey := base64.StdEncoding.DecodeString(result.Manifest.PublicKey)
+		if errKey != nil || len(raw) != ed25519.PublicKeySize {
+			return result, errors.New("manifest public key is malformed")
+		}
+		key = ed25519.PublicKey(raw)
+	}
+	switch {
+	case signature == nil && (publicKey != nil || result.Manifest.PublicKey != ""):
+		return result, fmt.Errorf("archive is not signed but a signature is expected")
+	case signature == nil:
+		return result, nil
+	case key == nil:
+		return result, errors.New("archive is signed but no public key is available")
+	case !ed25519.Verify(key, manifestJSON, signature):
+		return result, errors.New("manifest signature is invalid")
+	}
+	result.Signed = true
+	result.TrustedKey = publicKey != nil
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package usage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportUsageSignedRoundTrip(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	from, to, err := ParseExportPeriod("2026-09", "", "")
+	if err != nil {
+		t.Fatalf("ParseExportPeriod: %v", err)
+	}
+	for _, rec := range []dbRecord{
+		{Timestamp: from.Add(time.Hour), Provider: "claude", Model: "a", Tokens: TokenStats{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}},
+		{Timestamp: to.Add(-time.Minute), Provider: "claude", Model: "a", Failed: true, Tokens: TokenStats{InputTokens: 3, TotalTokens: 3}},
+		{Timestamp: from.Add(2 * time.Hour), Provider: "gemini", Model: "b", Tokens: TokenStats{TotalTokens: 100}},
+		{Timestamp: to, Provider: "claude", Model: "a", Tokens: TokenStats{TotalTokens: 1000}},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	var archive bytes.Buffer
+	manifest, err := ExportUsage(context.Background(), &archive, ExportOptions{From: from, To: to, Provider: "Claude", SigningKey: private})
+	if err != nil {
+		t.Fatalf("ExportUsage: %v", err)
+	}
+	if manifest.Totals.Requests != 2 || manifest.Totals.FailedRequests != 1 || manifest.Totals.TotalTokens != 18 {
+		t.Fatalf("unexpected totals: %+v", manifest.Totals)
+	}
+
+	result, err := VerifyExport(bytes.NewReader(archive.Bytes()), public)
+	if err != nil {
+		t.Fatalf("VerifyExport: %v", err)
+	}
+	if !result.Signed || !result.TrustedKey || result.Manifest.Totals != manifest.Totals {
+		t.Fatalf("unexpected verification: %+v", result)
+	}
+	otherPublic, _, _ := ed25519.GenerateKey(nil)
+	if _, err = VerifyExport(bytes.NewReader(archive.Bytes()), otherPublic); err == nil {
+		t.Fatal("expected verification with another key to fail")
+	}
+
+	// Rewriting a record, even with a consistent archive, breaks the digest.
+	files := readExportArchive(t, archive.Bytes())
+	var rec ExportRecord
+	lines := bytes.SplitN(files[ExportRecordsFile], []byte("\n"), 2)
+	if err = json.Unmarshal(lines[0], &rec); err != nil {
+		t.Fatalf("decode record: %v", err)
+	}
+	if rec.Provider != "claude" || rec.PromptTokens != 10 {
+		t.Fatalf("unexpected first record: %+v", rec)
+	}
+	rec.PromptTokens = 1
+	tampered, _ := json.Marshal(rec)
+	files[ExportRecordsFile] = append(append(tampered, '\n'), lines[1]...)
+	if _, err = VerifyExport(bytes.NewReader(writeExportArchive(t, files)), nil); err == nil {
+		t.Fatal("expected tampered archive to fail verification")
+	}
+}
+
+func readExportArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, errNext := tr.Next()
+		if errNext == io.EOF {
+			return files
+		}
+		if errNext != nil {
+			t.Fatalf("tar: %v", errNext)
+		}
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = content
+	}
+}
+
+func writeExportArchive(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		_, _ = tw.Write(content)
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,158 @@
+package usage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// QuotaForecast predicts when a credential will exhaust its provider quota if it
+// keeps consuming at its recent burn rate.
+type QuotaForecast struct {
+	Provider              string    `json:"provider"`
+	CredentialLabel       string    `json:"credential_label"`
+	CredentialFingerprint string    `json:"credential_fingerprint"`
+	Window                string    `json:"window"`
+	WindowResetsAt        time.Time `json:"window_resets_at"`
+	RequestLimit          int64     `json:"request_limit,omitempty"`
+	RequestsUsed          int64     `json:"requests_used"`
+	RequestsPerHour       float64   `json:"requests_per_hour"`
+	TokenLimit            int64     `json:"token_limit,omitempty"`
+	TokensUsed            int64     `json:"tokens_used"`
+	TokensPerHour         float64   `json:"tokens_per_hour"`
+	// ExhaustedAt is when the first limit is predicted to be reached. It is nil when
+	// the window resets first.
+	ExhaustedAt *time.Time `json:"exhausted_at,omitempty"`
+	// LimitedBy names the limit reached first: "requests" or "tokens".
+	LimitedBy string `json:"limited_by,omitempty"`
+}
+
+// quotaWindow returns the normalised window name and the UTC bounds of the window
+// containing now.
+func quotaWindow(window string, now time.Time) (string, time.Time, time.Time) {
+	now = now.UTC()
+	switch strings.ToLower(strings.TrimSpace(window)) {
+	case "hour":
+		start := now.Truncate(time.Hour)
+		return "hour", start, start.Add(time.Hour)
+	case "month":
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return "month", start, start.AddDate(0, 1, 0)
+	default:
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return "day", start, start.AddDate(0, 0, 1)
+	}
+}
+
+// QueryQuotaForecast forecasts quota exhaustion for every credential of the providers
+// in quotas that has traffic in the current window or the burn-rate lookback. Usage
+// counts all requests except those the upstream rejected with 429, and the burn rate
+// is the average per hour over the lookback ending at now. Forecasts are ordered by
+// predicted exhaustion, soonest first.
+func QueryQuotaForecast(ctx context.Context, quotas map[string]config.ProviderQuota, now time.Time, lookback time.Duration) ([]QuotaForecast, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if lookback <= 0 {
+		lookback = 3 * time.Hour
+	}
+	now = now.UTC()
+	burnStart := now.Add(-lookback)
+	hours := lookback.Hours()
+
+	out := make([]QuotaForecast, 0)
+	for provider, quota := range quotas {
+		if quota.Requests <= 0 && quota.Tokens <= 0 {
+			continue
+		}
+		window, windowStart, resetAt := quotaWindow(quota.Window, now)
+		since := windowStart
+		if burnStart.Before(since) {
+			since = burnStart
+		}
+		rows, err := store.db.QueryContext(ctx, `
+			SELECT COALESCE(credential_fingerprint, ''), COALESCE(MAX(credential_label), ''),
+				COALESCE(SUM(CASE WHEN timestamp >= ? THEN 1 ELSE 0 END), 0),
+				COALESCE(SUM(CASE WHEN timestamp >= ? THEN COALESCE(total_tokens, 0) ELSE 0 END), 0),
+				COALESCE(SUM(CASE WHEN timestamp >= ? THEN 1 ELSE 0 END), 0),
+				COALESCE(SUM(CASE WHEN timestamp >= ? THEN COALESCE(total_tokens, 0) ELSE 0 END), 0)
+			FROM usage_requests
+			WHERE provider = ? AND timestamp >= ? AND COALESCE(rate_limited, 0) = 0
+			GROUP BY credential_fingerprint;`,
+			windowStart, windowStart, burnStart, burnStart, provider, since)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var burnRequests, burnTokens int64
+			item := QuotaForecast{
+				Provider:       provider,
+				Window:         window,
+				WindowResetsAt: resetAt,
+				RequestLimit:   quota.Requests,
+				TokenLimit:     quota.Tokens,
+			}
+			if err = rows.Scan(&item.CredentialFingerprint, &item.CredentialLabel, &item.RequestsUsed, &item.TokensUsed, &burnRequests, &burnTokens); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			item.CredentialLabel = openColumn(item.CredentialLabel)
+			item.RequestsPerHour = float64(burnRequests) / hours
+			item.TokensPerHour = float64(burnTokens) / hours
+			forecastExhaustion(&item, now)
+			out = append(out, item)
+		}
+		_ = rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].ExhaustedAt, out[j].ExhaustedAt
+		switch {
+		case a != nil && b != nil && !a.Equal(*b):
+			return a.Before(*b)
+		case (a == nil) != (b == nil):
+			return a != nil
+		case out[i].Provider != out[j].Provider:
+			return out[i].Provider < out[j].Provider
+		default:
+			return out[i].CredentialLabel < out[j].CredentialLabel
+		}
+	})
+	return out, nil
+}
+
+// forecastExhaustion sets ExhaustedAt and LimitedBy to the earliest limit the
+// credential reaches before its window resets.
+func forecastExhaustion(item *QuotaForecast, now time.Time) {
+	check := func(name string, limit, used int64, perHour float64) {
+		if limit <= 0 {
+			return
+		}
+		at := now
+		if remaining := limit - used; remaining > 0 {
+			if perHour <= 0 {
+				return
+			}
+			at = now.Add(time.Duration(float64(remaining) / perHour * float64(time.Hour)))
+		}
+		if !at.Before(item.WindowResetsAt) {
+			return
+		}
+		if item.ExhaustedAt == nil || at.Before(*item.ExhaustedAt) {
+			item.ExhaustedAt = &at
+			item.LimitedBy = name
+		}
+	}
+	check("requests", item.RequestLimit, item.RequestsUsed, item.RequestsPerHour)
+	check("tokens", item.TokenLimit, item.TokensUsed, item.TokensPerHour)
+}
@@ -0,0 +1,158 @@
+package usage
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+func TestQueryQuotaForecast(t *testing.T) {
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	var records []dbRecord
+	for i := 0; i < 40; i++ {
+		records = append(records, dbRecord{Timestamp: now.Add(-time.Duration(i+1) * 3 * time.Minute), Provider: "claude",
+			CredentialLabel: "busy", CredentialFingerprint: "fp-busy", Tokens: TokenStats{TotalTokens: 200}})
+	}
+	records = append(records,
+		dbRecord{Timestamp: now.Add(-time.Minute), Provider: "claude", CredentialLabel: "busy", CredentialFingerprint: "fp-busy", RateLimited: true, Tokens: TokenStats{TotalTokens: 999}},
+		dbRecord{Timestamp: now.Add(-3 * time.Hour), Provider: "claude", CredentialLabel: "idle", CredentialFingerprint: "fp-idle"},
+		dbRecord{Timestamp: now.Add(-3 * time.Hour), Provider: "gemini", CredentialLabel: "other", CredentialFingerprint: "fp-other"},
+	)
+	for _, rec := range records {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	quotas := map[string]config.ProviderQuota{"claude": {Requests: 100, Tokens: 10000}}
+	forecasts, err := QueryQuotaForecast(context.Background(), quotas, now, 4*time.Hour)
+	if err != nil {
+		t.Fatalf("QueryQuotaForecast failed: %v", err)
+	}
+	if len(forecasts) != 2 {
+		t.Fatalf("expected forecasts for two claude credentials, got %+v", forecasts)
+	}
+	busy, idle := forecasts[0], forecasts[1]
+	if busy.CredentialLabel != "busy" || busy.RequestsUsed != 40 || busy.TokensUsed != 8000 || busy.RequestsPerHour != 10 {
+		t.Fatalf("unexpected busy forecast: %+v", busy)
+	}
+	// 2000 tokens remain at 2000 tokens/hour, well before 60 requests at 10/hour.
+	if busy.ExhaustedAt == nil || !busy.ExhaustedAt.Equal(now.Add(time.Hour)) || busy.LimitedBy != "tokens" {
+		t.Fatalf("unexpected busy exhaustion: %+v", busy)
+	}
+	if !busy.WindowResetsAt.Equal(time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)) || busy.Window != "day" {
+		t.Fatalf("unexpected window: %+v", busy)
+	}
+	if idle.CredentialLabel != "idle" || idle.ExhaustedAt != nil {
+		t.Fatalf("idle credential should outlast its window: %+v", idle)
+	}
+
+	quotas["claude"] = config.ProviderQuota{Requests: 5, Window: "hour"}
+	if forecasts, err = QueryQuotaForecast(context.Background(), quotas, now, 4*time.Hour); err != nil {
+		t.Fatalf("QueryQuotaForecast failed: %v", err)
+	}
+	// The hourly window started at now, so no credential has used any of it yet.
+	if len(forecasts) != 2 || forecasts[0].RequestsUsed != 0 || forecasts[0].ExhaustedAt == nil || !forecasts[0].ExhaustedAt.Equal(now.Add(30*time.Minute)) || forecasts[1].ExhaustedAt != nil {
+		t.Fatalf("unexpected hourly forecast: %+v", forecasts)
+	}
+}
+
+func TestFitSeries(t *testing.T) {
+	weekly := make([]float64, 28)
+	for i := range weekly {
+		weekly[i] = 100
+		if i%7 >= 5 {
+			weekly[i] = 20
+		}
+	}
+	fit := fitSeries(weekly)
+	if fit.method != ProjectionHoltWinters {
+		t.Fatalf("expected holt-winters for four weeks, got %s", fit.method)
+	}
+	// The history ends on a "weekend" day; the next five days are weekdays.
+	if mid, low, high := fit.project(1); math.Abs(mid-100) > 1 || low > mid || high < mid {
+		t.Fatalf("expected a weekday of ~100, got %v [%v, %v]", mid, low, high)
+	}
+	if mid, _, _ := fit.project(6); math.Abs(mid-20) > 1 {
+		t.Fatalf("expected a weekend day of ~20, got %v", mid)
+	}
+
+	fit = fitSeries([]float64{10, 20, 30, 40, 50})
+	if mid, _, _ := fit.project(1); fit.method != ProjectionHolt || mid <= 50 {
+		t.Fatalf("expected holt to follow the trend, got %s %v", fit.method, mid)
+	}
+	fit = fitSeries([]float64{10, 30})
+	if mid, low, high := fit.project(3); fit.method != ProjectionMovingAverage || mid != 20 || low >= mid || high <= mid {
+		t.Fatalf("expected a moving average of 20 with a range, got %s %v [%v, %v]", fit.method, mid, low, high)
+	}
+	if _, low, _ := fitSeries([]float64{1, 100, 1}).project(1); low < 0 {
+		t.Fatalf("expected the range to be clamped at zero, got %v", low)
+	}
+}
+
+func TestQueryUsageProjection(t *testing.T) {
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	if err = store.syncModelPrices(map[string]ModelPrice{"m": {InputPerMillion: 1, OutputPerMillion: 2}}); err != nil {
+		t.Fatalf("sync prices failed: %v", err)
+	}
+
+	now := time.Date(2026, 3, 30, 12, 0, 0, 0, time.UTC)
+	for day := 1; day <= 21; day++ {
+		rec := dbRecord{Timestamp: now.AddDate(0, 0, -day), Provider: "claude", Model: "m",
+			Tokens: TokenStats{InputTokens: 600000, OutputTokens: 400000, TotalTokens: 1000000}}
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	for _, rec := range []dbRecord{
+		{Timestamp: now.AddDate(0, 0, -2), Provider: "gemini", Model: "unpriced", Tokens: TokenStats{TotalTokens: 10}},
+		{Timestamp: now, Provider: "claude", Model: "m", Tokens: TokenStats{TotalTokens: 999999999}},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	projections, err := QueryUsageProjection(context.Background(), "", now, 56)
+	if err != nil {
+		t.Fatalf("QueryUsageProjection failed: %v", err)
+	}
+	if len(projections) != 2 || projections[0].Provider != "claude" || projections[1].Provider != "gemini" {
+		t.Fatalf("unexpected projections: %+v", projections)
+	}
+	claude := projections[0]
+	if claude.Method != ProjectionHoltWinters || claude.HistoryDays != 21 || len(claude.Daily) != ProjectionHorizonDays {
+		t.Fatalf("unexpected claude projection: %+v", claude)
+	}
+	if claude.Daily[0].Date != "2026-03-30" || claude.Daily[0].Tokens != 1000000 || math.Abs(claude.Daily[0].CostUSD-1.4) > 1e-9 {
+		t.Fatalf("expected today's partial day to be ignored, got %+v", claude.Daily[0])
+	}
+	if claude.Next7Days.Tokens != 7000000 || claude.Next30Days.Tokens != 30000000 || math.Abs(claude.Next30Days.CostUSD-42) > 1e-6 {
+		t.Fatalf("unexpected totals: %+v %+v", claude.Next7Days, claude.Next30Days)
+	}
+	if gemini := projections[1]; gemini.Method != ProjectionMovingAverage || gemini.HistoryDays != 2 || gemini.Daily[0].CostUSD != 0 {
+		t.Fatalf("unexpected gemini projection: %+v", gemini)
+	}
+
+	if projections, err = QueryUsageProjection(context.Background(), "gemini", now, 56); err != nil || len(projections) != 1 {
+		t.Fatalf("expected the provider filter to apply, got %+v, %v", projections, err)
+	}
+}
@@ -0,0 +1,322 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImportResult summarises a database merge.
+type ImportResult struct {
+	// Requests is the number of usage_requests rows copied.
+	Requests int64 `json:"requests"`
+	// DuplicateRequests counts source rows already present in the destination.
+	DuplicateRequests int64 `json:"duplicate_requests"`
+	// DailyRows is the number of usage_daily rows copied for days the source no longer
+	// holds request detail for. Days with request detail are rebuilt from the copied rows.
+	DailyRows int64 `json:"daily_rows"`
+	// MonthlyRows is the number of usage_monthly rows copied.
+	MonthlyRows int64 `json:"monthly_rows"`
+}
+
+// importOptionalColumns lists usage columns added after the first schema, with the
+// value used when the source database predates them.
+var importOptionalColumns = map[string]string{
+	"tags":                  "''",
+	"policy_denied":         "0",
+	"queue_wait_ms":         "0",
+	"account_email":         "''",
+	"requested_model":       "''",
+	"rejection":             "''",
+	"duration_ms":           "0",
+	"client_label":          "''",
+	"request_id":            "''",
+	"metadata":              "''",
+	"audio_seconds":         "0",
+	"error_class":           "''",
+	"client_ip_hash":        "''",
+	"user_agent":            "''",
+	"client_country":        "''",
+	"tool_calls":            "0",
+	"tool_result_tokens":    "0",
+	"image_inputs":          "0",
+	"reasoning_budget":      "''",
+	"aborted":               "0",
+	"aborted_requests":      "0",
+	"document_inputs":       "0",
+	"media_bytes":           "0",
+	"cache_creation_tokens": "0",
+	"team":                  "''",
+}
+
+// ImportDatabase merges the usage_requests, usage_daily and usage_monthly tables of
+// the database at srcPath into the one at dstPath. Request rows already present in
+// the destination (same timestamp, credential, model, key and token counts) are
+// skipped, so importing the same file twice is a no-op. Aggregate rows are only copied
+// for days or months the destination has no row for, which keeps re-imports idempotent
+// but means overlapping aggregates from two instances sharing a credential keep the
+// destination's figures. With dryRun the merge is rolled back after counting.
+func ImportDatabase(ctx context.Context, dstPath, srcPath string, dryRun bool) (ImportResult, error) {
+	var result ImportResult
+	dstPath, srcPath = filepath.Clean(dstPath), filepath.Clean(srcPath)
+	if dstPath == srcPath {
+		return result, errors.New("usage: cannot import a database into itself")
+	}
+	if _, err := os.Stat(srcPath); err != nil {
+		return result, fmt.Errorf("usage: import source: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return result, fmt.Errorf("usage: mkdir failed: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout=5000&_pragma=foreign_keys=on", filepath.ToSlash(dstPath))
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return result, fmt.Errorf("usage: open sqlite: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+	if err = applyUsageSchema(db); err != nil {
+		return result, err
+	}
+
+	// ATTACH is per connection, so pin one for the whole merge.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return result, fmt.Errorf("usage: open sqlite: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	srcURI := fmt.Sprintf("file:%s?mode=ro", filepath.ToSlash(srcPath))
+	if _, err = conn.ExecContext(ctx, `ATTACH DATABASE ? AS src`, srcURI); err != nil {
+		return result, fmt.Errorf("usage: attach %s: %w", srcPath, err)
+	}
+	defer func() { _, _ = conn.ExecContext(context.Background(), `DETACH DATABASE src`) }()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err = importRequests(ctx, tx, &result); err != nil {
+		return result, fmt.Errorf("usage: import requests: %w", err)
+	}
+	if err = importAggregates(ctx, tx, &result); err != nil {
+		return result, fmt.Errorf("usage: import aggregates: %w", err)
+	}
+	if dryRun {
+		return result, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return result, fmt.Errorf("usage: import commit: %w", err)
+	}
+	return result, nil
+}
+
+func importRequests(ctx context.Context, tx *sql.Tx, result *ImportResult) error {
+	srcColumns, err := sourceColumns(ctx, tx, "usage_requests")
+	if err != nil || len(srcColumns) == 0 {
+		return err
+	}
+	var total int64
+	if err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM src.usage_requests`).Scan(&total); err != nil {
+		return err
+	}
+	var maxID int64
+	if err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM main.usage_requests`).Scan(&maxID); err != nil {
+		return err
+	}
+
+	columns := []string{
+		"timestamp", "provider", "model", "credential_label", "credential_fingerprint",
+		"api_key_hash", "auth_id", "auth_index", "source", "status_code", "failed",
+		"rate_limited", "prompt_tokens", "completion_tokens", "reasoning_tokens",
+		"cached_tokens", "total_tokens", "tags", "policy_denied", "queue_wait_ms", "account_email",
+		"requested_model", "rejection", "duration_ms", "client_label", "request_id", "metadata",
+		"audio_seconds", "error_class", "client_ip_hash", "user_agent", "client_country",
+		"tool_calls", "tool_result_tokens", "image_inputs", "reasoning_budget", "aborted",
+		"document_inputs", "media_bytes", "cache_creation_tokens", "team",
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO main.usage_requests (%s)
+		SELECT %s FROM src.usage_requests AS s
+		WHERE NOT EXISTS (
+			SELECT 1 FROM main.usage_requests AS d
+			WHERE d.credential_fingerprint IS s.credential_fingerprint
+				AND d.timestamp IS s.timestamp
+				AND d.provider IS s.provider
+				AND d.model IS s.model
+				AND d.api_key_hash IS s.api_key_hash
+				AND d.auth_index IS s.auth_index
+				AND d.prompt_tokens IS s.prompt_tokens
+				AND d.completion_tokens IS s.completion_tokens
+				AND d.total_tokens IS s.total_tokens
+				AND d.failed IS s.failed
+		)
+		ORDER BY s.id;
+	`, strings.Join(columns, ", "), selectList("s", columns, srcColumns)))
+	if err != nil {
+		return err
+	}
+	if result.Requests, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	result.DuplicateRequests = total - result.Requests
+
+	// Fold exactly the copied rows into the daily aggregates.
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO main.usage_daily (
+			day, provider, credential_fingerprint, credential_label, model,
+			total_requests, failed_requests, rate_limited, prompt_tokens,
+			completion_tokens, total_tokens, account_email, aborted_requests
+		)
+		SELECT substr(timestamp, 1, 10), provider, credential_fingerprint, MAX(credential_label), model,
+			COUNT(*), SUM(failed), SUM(rate_limited), SUM(prompt_tokens),
+			SUM(completion_tokens), SUM(total_tokens), MAX(account_email), SUM(aborted)
+		FROM main.usage_requests
+		WHERE id > ?
+		GROUP BY substr(timestamp, 1, 10), provider, credential_fingerprint, model
+		ON CONFLICT(day, provider, credential_fingerprint, model) DO UPDATE SET
+			total_requests = usage_daily.total_requests + excluded.total_requests,
+			failed_requests = usage_daily.failed_requests + excluded.failed_requests,
+			rate_limited = usage_daily.rate_limited + excluded.rate_limited,
+			prompt_tokens = usage_daily.prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = usage_daily.completion_tokens + excluded.completion_tokens,
+			total_tokens = usage_daily.total_tokens + excluded.total_tokens,
+			aborted_requests = usage_daily.aborted_requests + excluded.aborted_requests;
+	`, maxID); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, tags FROM main.usage_requests WHERE id > ? AND tags != ''`, maxID)
+	if err != nil {
+		return err
+	}
+	type tagged struct {
+		id   int64
+		tags string
+	}
+	var pending []tagged
+	for rows.Next() {
+		var t tagged
+		if err = rows.Scan(&t.id, &t.tags); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		pending = append(pending, t)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, t := range pending {
+		for _, tag := range strings.Split(t.tags, ",") {
+			if tag = strings.TrimSpace(tag); tag == "" {
+				continue
+			}
+			if _, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO main.usage_request_tags (request_id, tag) VALUES (?, ?)`, t.id, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func importAggregates(ctx context.Context, tx *sql.Tx, result *ImportResult) error {
+	aggregate := []string{
+		"provider", "credential_fingerprint", "credential_label", "model",
+		"total_requests", "failed_requests", "rate_limited", "prompt_tokens",
+		"completion_tokens", "total_tokens", "account_email", "aborted_requests",
+	}
+
+	dailyColumns, err := sourceColumns(ctx, tx, "usage_daily")
+	if err != nil {
+		return err
+	}
+	if len(dailyColumns) > 0 {
+		requestColumns, errColumns := sourceColumns(ctx, tx, "usage_requests")
+		if errColumns != nil {
+			return errColumns
+		}
+		// Days with request detail in the source were rebuilt from the copied rows.
+		filter := ""
+		if len(requestColumns) > 0 {
+			filter = "WHERE s.day NOT IN (SELECT DISTINCT substr(timestamp, 1, 10) FROM src.usage_requests)"
+		}
+		columns := append([]string{"day"}, aggregate...)
+		res, errInsert := tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT OR IGNORE INTO main.usage_daily (%s)
+			SELECT %s FROM src.usage_daily AS s %s;
+		`, strings.Join(columns, ", "), selectList("s", columns, dailyColumns), filter))
+		if errInsert != nil {
+			return errInsert
+		}
+		if result.DailyRows, err = res.RowsAffected(); err != nil {
+			return err
+		}
+	}
+
+	monthlyColumns, err := sourceColumns(ctx, tx, "usage_monthly")
+	if err != nil {
+		return err
+	}
+	if len(monthlyColumns) > 0 {
+		columns := append([]string{"month"}, aggregate...)
+		res, errInsert := tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT OR IGNORE INTO main.usage_monthly (%s)
+			SELECT %s FROM src.usage_monthly AS s;
+		`, strings.Join(columns, ", "), selectList("s", columns, monthlyColumns)))
+		if errInsert != nil {
+			return errInsert
+		}
+		if result.MonthlyRows, err = res.RowsAffected(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceColumns returns the column set of table in the attached source database, or
+// an empty set when the table does not exist there.
+func sourceColumns(ctx context.Context, tx *sql.Tx, table string) (map[string]struct{}, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`PRAGMA src.table_info(%s)`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	columns := make(map[string]struct{})
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err = rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = struct{}{}
+	}
+	return columns, rows.Err()
+}
+
+// selectList builds the SELECT expressions for columns, substituting defaults for
+// optional columns the source schema lacks.
+func selectList(alias string, columns []string, available map[string]struct{}) string {
+	exprs := make([]string, len(columns))
+	for i, column := range columns {
+		if _, ok := available[column]; ok {
+			exprs[i] = alias + "." + column
+		} else if def, optional := importOptionalColumns[column]; optional {
+			exprs[i] = def
+		} else {
+			exprs[i] = "NULL"
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
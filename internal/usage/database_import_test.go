@@ -0,0 +1,99 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestImportDatabaseMergesAndDeduplicates(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.db")
+	dstPath := filepath.Join(dir, "dst.db")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	src, err := newUsageStore(DatabaseOptions{Enabled: true, Path: srcPath})
+	if err != nil {
+		t.Fatalf("failed to create source store: %v", err)
+	}
+	shared := dbRecord{
+		Timestamp:             now,
+		Provider:              "claude",
+		Model:                 "claude-sonnet",
+		CredentialLabel:       "auth-A",
+		CredentialFingerprint: "fp-A",
+		Tags:                  []string{"coding"},
+		Tokens:                TokenStats{InputTokens: 3, OutputTokens: 4, TotalTokens: 7},
+	}
+	other := shared
+	other.Timestamp = now.Add(time.Second)
+	other.Tags = nil
+	for _, rec := range []dbRecord{shared, other} {
+		if err = src.insert(rec); err != nil {
+			t.Fatalf("source insert failed: %v", err)
+		}
+	}
+	// An aggregate for a day whose request detail has already been pruned.
+	if _, err = src.db.Exec(`INSERT INTO usage_daily (day, provider, credential_fingerprint, credential_label, model,
+		total_requests, failed_requests, rate_limited, prompt_tokens, completion_tokens, total_tokens)
+		VALUES ('2020-01-01', 'claude', 'fp-A', 'auth-A', 'claude-sonnet', 9, 0, 0, 1, 1, 2)`); err != nil {
+		t.Fatalf("seed source daily failed: %v", err)
+	}
+	src.close()
+
+	dst, err := newUsageStore(DatabaseOptions{Enabled: true, Path: dstPath})
+	if err != nil {
+		t.Fatalf("failed to create destination store: %v", err)
+	}
+	if err = dst.insert(shared); err != nil {
+		t.Fatalf("destination insert failed: %v", err)
+	}
+	dst.close()
+
+	ctx := context.Background()
+	dry, err := ImportDatabase(ctx, dstPath, srcPath, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if dry.Requests != 1 || dry.DuplicateRequests != 1 || dry.DailyRows != 1 {
+		t.Fatalf("unexpected dry run result: %+v", dry)
+	}
+
+	result, err := ImportDatabase(ctx, dstPath, srcPath, false)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if result != dry {
+		t.Fatalf("import result %+v differs from dry run %+v", result, dry)
+	}
+	again, err := ImportDatabase(ctx, dstPath, srcPath, false)
+	if err != nil {
+		t.Fatalf("re-import failed: %v", err)
+	}
+	if again.Requests != 0 || again.DailyRows != 0 || again.DuplicateRequests != 2 {
+		t.Fatalf("re-import should be a no-op, got %+v", again)
+	}
+
+	check, err := newUsageStore(DatabaseOptions{Enabled: true, Path: dstPath, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to reopen destination: %v", err)
+	}
+	defer check.close()
+	var requests, dailyRequests int
+	if err = check.db.QueryRow(`SELECT COUNT(*) FROM usage_requests`).Scan(&requests); err != nil {
+		t.Fatalf("count requests failed: %v", err)
+	}
+	if err = check.db.QueryRow(`SELECT total_requests FROM usage_daily WHERE day = ?`, now.Format("2006-01-02")).Scan(&dailyRequests); err != nil {
+		t.Fatalf("query daily failed: %v", err)
+	}
+	if requests != 2 || dailyRequests != 2 {
+		t.Fatalf("expected 2 requests in detail and daily, got %d and %d", requests, dailyRequests)
+	}
+	var pruned int
+	if err = check.db.QueryRow(`SELECT total_requests FROM usage_daily WHERE day = '2020-01-01'`).Scan(&pruned); err != nil || pruned != 9 {
+		t.Fatalf("expected pruned-day aggregate to be copied, got %d (%v)", pruned, err)
+	}
+}
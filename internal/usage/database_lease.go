@@ -0,0 +1,177 @@
+package usage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Several writable proxy processes may share one usage database. All of them insert
+// records, but only the holder of the maintenance lease runs retention, daily
+// compaction and scheduled reports, so that work is neither duplicated nor run by
+// two processes at once. The lease is a row in usage_leases that its holder renews
+// with heartbeats; when the holder stops, another process takes over once it expires.
+const (
+	maintenanceLeaseName = "maintenance"
+	leaseTTL             = 30 * time.Second
+	leaseHeartbeat       = 10 * time.Second
+)
+
+// ErrNotMaintenanceLeader is returned for maintenance requested from a process that
+// does not hold the maintenance lease of a shared usage database.
+var ErrNotMaintenanceLeader = errors.New("usage: another process holds the maintenance lease")
+
+// MaintenanceStatus describes the maintenance lease as last seen by this process.
+type MaintenanceStatus struct {
+	// Instance identifies this process in the lease table.
+	Instance string `json:"instance"`
+	Leader   bool   `json:"leader"`
+	// Holder is the instance holding the lease, which may be another process.
+	Holder    string     `json:"holder,omitempty"`
+	ExpiresAt *time.Time `json:"expires-at,omitempty"`
+	LastError string     `json:"last-error,omitempty"`
+}
+
+type leaseState struct {
+	instance string
+
+	mu        sync.Mutex
+	leader    bool
+	holder    string
+	expiresAt time.Time
+	lastErr   string
+}
+
+// newLeaseInstance returns an identifier unique to one store of one process.
+func newLeaseInstance() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "unknown"
+	}
+	var buf [4]byte
+	_, _ = rand.Read(buf[:])
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(buf[:]))
+}
+
+// renewLease acquires the maintenance lease when it is free or expired, or extends
+// it when this store already holds it, and reports whether this store is the leader.
+func (s *usageStore) renewLease(now time.Time) bool {
+	res, err := s.db.Exec(`
+		INSERT INTO usage_leases (name, holder, expires_at, heartbeat_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			holder = excluded.holder,
+			expires_at = excluded.expires_at,
+			heartbeat_at = excluded.heartbeat_at
+		WHERE usage_leases.holder = excluded.holder OR usage_leases.expires_at < ?`,
+		maintenanceLeaseName, s.lease.instance, now.Add(leaseTTL).UnixMilli(), now.UnixMilli(), now.UnixMilli())
+	var acquired bool
+	if err == nil {
+		var n int64
+		n, err = res.RowsAffected()
+		acquired = n > 0
+	}
+	var (
+		holder  string
+		expires int64
+	)
+	if err == nil {
+		err = s.db.QueryRow(`SELECT holder, expires_at FROM usage_leases WHERE name = ?`, maintenanceLeaseName).Scan(&holder, &expires)
+	}
+
+	l := &s.lease
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	wasLeader := l.leader
+	if err != nil {
+		// Keep a held lease until it would have expired; a busy database must not
+		// make two processes believe they lead.
+		l.lastErr = err.Error()
+		l.leader = l.leader && now.Before(l.expiresAt)
+	} else {
+		l.lastErr = ""
+		l.leader = acquired
+		l.holder = holder
+		l.expiresAt = time.UnixMilli(expires).UTC()
+	}
+	switch {
+	case l.leader && !wasLeader:
+		log.Infof("usage: acquired database maintenance lease as %s", l.instance)
+	case !l.leader && wasLeader:
+		log.Warnf("usage: lost database maintenance lease to %s", l.holder)
+	}
+	if err != nil {
+		util.ComponentLog(util.LogComponentUsage).WithError(err).Debug("usage: maintenance lease heartbeat failed")
+	}
+	return l.leader
+}
+
+// isMaintenanceLeader reports whether this store holds an unexpired maintenance lease.
+func (s *usageStore) isMaintenanceLeader() bool {
+	if s.readOnly {
+		return false
+	}
+	l := &s.lease
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leader && time.Now().Before(l.expiresAt)
+}
+
+// releaseLease gives up the maintenance lease so another process can take over
+// without waiting for it to expire.
+func (s *usageStore) releaseLease() {
+	if s.readOnly || s.lease.instance == "" {
+		return
+	}
+	if _, err := s.db.Exec(`DELETE FROM usage_leases WHERE name = ? AND holder = ?`, maintenanceLeaseName, s.lease.instance); err != nil {
+		log.WithError(err).Warn("usage: failed to release maintenance lease")
+	}
+	s.lease.mu.Lock()
+	s.lease.leader = false
+	s.lease.mu.Unlock()
+}
+
+func (s *usageStore) leaseLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(leaseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.renewLease(time.Now().UTC())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *usageStore) maintenanceStatus() MaintenanceStatus {
+	l := &s.lease
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	status := MaintenanceStatus{
+		Instance:  l.instance,
+		Leader:    l.leader && time.Now().Before(l.expiresAt),
+		Holder:    l.holder,
+		LastError: l.lastErr,
+	}
+	if !l.expiresAt.IsZero() {
+		expires := l.expiresAt
+		status.ExpiresAt = &expires
+	}
+	return status
+}
+
+// maintenanceAllowed reports whether this process should run scheduled work that
+// must happen once per shared database. It is true unless a writable store is open
+// whose maintenance lease is held by another process.
+func maintenanceAllowed() bool {
+	store := currentUsageStore.Load()
+	return store == nil || store.readOnly || store.isMaintenanceLeader()
+}
@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageStoreMaintenanceLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	first, err := newUsageStore(DatabaseOptions{Enabled: true, Path: path, RetentionDays: 1})
+	if err != nil {
+		t.Fatalf("failed to create first store: %v", err)
+	}
+	second, err := newUsageStore(DatabaseOptions{Enabled: true, Path: path, RetentionDays: 1})
+	if err != nil {
+		first.close()
+		t.Fatalf("failed to create second store: %v", err)
+	}
+	defer second.close()
+
+	if !first.isMaintenanceLeader() {
+		t.Fatal("expected the first store to hold the maintenance lease")
+	}
+	if second.isMaintenanceLeader() {
+		t.Fatal("expected the second store to follow")
+	}
+	if status := second.maintenanceStatus(); status.Holder != first.lease.instance {
+		t.Fatalf("expected second store to see %s as holder, got %+v", first.lease.instance, status)
+	}
+
+	// Both processes write; only the leader expires old rows.
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	for _, store := range []*usageStore{first, second} {
+		if err := store.insert(dbRecord{Timestamp: old, Provider: "claude", Model: "m"}); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	second.applyRetention()
+	if n := countRequests(t, second); n != 2 {
+		t.Fatalf("expected the follower to skip retention, got %d rows", n)
+	}
+
+	first.close()
+	if !second.renewLease(time.Now().UTC()) {
+		t.Fatal("expected the second store to take over the released lease")
+	}
+	second.applyRetention()
+	if n := countRequests(t, second); n != 0 {
+		t.Fatalf("expected the new leader to apply retention, got %d rows", n)
+	}
+}
+
+func TestUsageStoreMaintenanceLeaseExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: path})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	if _, err := store.db.Exec(`UPDATE usage_leases SET holder = ?, expires_at = ?`, "other", now.Add(time.Minute).UnixMilli()); err != nil {
+		t.Fatalf("update lease failed: %v", err)
+	}
+	if store.renewLease(now) {
+		t.Fatal("expected a live lease of another holder to be respected")
+	}
+	if _, err := store.db.Exec(`UPDATE usage_leases SET expires_at = ?`, now.Add(-time.Second).UnixMilli()); err != nil {
+		t.Fatalf("update lease failed: %v", err)
+	}
+	if !store.renewLease(now) {
+		t.Fatal("expected an expired lease to be taken over")
+	}
+}
+
+func countRequests(t *testing.T, store *usageStore) int {
+	t.Helper()
+	var n int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM usage_requests`).Scan(&n); err != nil {
+		t.Fatalf("count usage_requests failed: %v", err)
+	}
+	return n
+}
@@ -0,0 +1,472 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	defaultMigrateBatchSize = 1000
+	// postgresMaxParams is the bind parameter limit of one PostgreSQL statement.
+	postgresMaxParams = 65535
+	// migrateProgressTable records, per table, the last SQLite rowid copied so an
+	// interrupted migration resumes instead of starting over.
+	migrateProgressTable = "usage_migration_progress"
+)
+
+// MigrateOptions configures MigrateToPostgres.
+type MigrateOptions struct {
+	// SourcePath is the SQLite usage database to copy from. It is opened read-only.
+	SourcePath string
+	// TargetDSN is a postgres:// connection string.
+	TargetDSN string
+	// BatchSize is the number of rows copied per transaction.
+	BatchSize int
+	// Progress, when set, is called after every committed batch.
+	Progress func(MigrateProgress)
+}
+
+// MigrateProgress reports how far one table has been copied, including rows
+// copied by earlier, interrupted runs.
+type MigrateProgress struct {
+	Table  string
+	Copied int64
+	Total  int64
+}
+
+// MigrateResult summarises a MigrateToPostgres run.
+type MigrateResult struct {
+	// Tables is the number of tables created or brought up to date.
+	Tables int `json:"tables"`
+	// Rows is the number of rows copied by this run.
+	Rows int64 `json:"rows"`
+	// Indexes is the number of secondary and unique indexes ensured.
+	Indexes int `json:"indexes"`
+}
+
+type migrateColumn struct {
+	name    string
+	decl    string
+	notNull bool
+	dflt    sql.NullString
+	pk      int
+}
+
+type migrateTable struct {
+	name    string
+	columns []migrateColumn
+	indexes []string
+}
+
+// MigrateToPostgres copies every table of a SQLite usage database, with its primary
+// keys and indexes, into PostgreSQL. Rows are copied in rowid order, one transaction
+// per batch that also records the position reached, so re-running after an
+// interruption continues where the previous run stopped and rows already present
+// are skipped. Views and foreign keys are not copied. Rows updated in place after
+// they were copied are not revisited, so the final run should happen while the
+// server is stopped.
+func MigrateToPostgres(ctx context.Context, opts MigrateOptions) (MigrateResult, error) {
+	var result MigrateResult
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultMigrateBatchSize
+	}
+	sourcePath := filepath.Clean(opts.SourcePath)
+	if _, err := os.Stat(sourcePath); err != nil {
+		return result, fmt.Errorf("usage: migrate source: %w", err)
+	}
+	src, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout=5000", filepath.ToSlash(sourcePath)))
+	if err != nil {
+		return result, fmt.Errorf("usage: open sqlite: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+	dst, err := sql.Open("pgx", opts.TargetDSN)
+	if err != nil {
+		return result, fmt.Errorf("usage: open postgres: %w", err)
+	}
+	defer func() { _ = dst.Close() }()
+	if err = dst.PingContext(ctx); err != nil {
+		return result, fmt.Errorf("usage: connect to postgres: %w", err)
+	}
+
+	tables, err := sourceTables(ctx, src)
+	if err != nil {
+		return result, fmt.Errorf("usage: read sqlite schema: %w", err)
+	}
+	if err = ensureMigrateProgress(ctx, dst); err != nil {
+		return result, fmt.Errorf("usage: create migration progress table: %w", err)
+	}
+
+	for _, table := range tables {
+		if _, err = dst.ExecContext(ctx, postgresTableDDL(table)); err != nil {
+			return result, fmt.Errorf("usage: create table %s: %w", table.name, err)
+		}
+		copied, errCopy := copyTable(ctx, src, dst, table, opts)
+		result.Rows += copied
+		if errCopy != nil {
+			return result, fmt.Errorf("usage: copy table %s: %w", table.name, errCopy)
+		}
+		for _, stmt := range table.indexes {
+			if _, err = dst.ExecContext(ctx, stmt); err != nil {
+				return result, fmt.Errorf("usage: create index on %s: %w", table.name, err)
+			}
+			result.Indexes++
+		}
+		if id := identityColumn(table); id != "" {
+			// Continue the identity after the copied IDs so new rows do not collide.
+			if _, err = dst.ExecContext(ctx, fmt.Sprintf(
+				`SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 0) + 1, false) FROM %s`,
+				quoteIdent(table.name), id, quoteIdent(id), quoteIdent(table.name))); err != nil {
+				return result, fmt.Errorf("usage: reset identity of %s: %w", table.name, err)
+			}
+		}
+		result.Tables++
+	}
+	return result, nil
+}
+
+// ensureMigrateProgress creates the progress table shared by MigrateToPostgres and
+// the dual-write mirror, so either one continues where the other stopped.
+func ensureMigrateProgress(ctx context.Context, dst *sql.DB) error {
+	_, err := dst.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+migrateProgressTable+` (
+		table_name TEXT PRIMARY KEY,
+		last_rowid BIGINT NOT NULL,
+		rows BIGINT NOT NULL
+	)`)
+	return err
+}
+
+// sourceTables reads the columns and indexes of every user table in src.
+func sourceTables(ctx context.Context, src *sql.DB) ([]migrateTable, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tables := make([]migrateTable, 0, len(names))
+	for _, name := range names {
+		table := migrateTable{name: name}
+		if table.columns, err = migrateColumns(ctx, src, name); err != nil {
+			return nil, err
+		}
+		if table.indexes, err = sourceIndexes(ctx, src, name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func migrateColumns(ctx context.Context, src *sql.DB, table string) ([]migrateColumn, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var columns []migrateColumn
+	for rows.Next() {
+		var col migrateColumn
+		if err = rows.Scan(&col.name, &col.decl, &col.notNull, &col.dflt, &col.pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// sourceIndexes returns PostgreSQL statements recreating the indexes of table.
+// Explicit indexes are portable as written; indexes SQLite derived from UNIQUE
+// constraints are rebuilt from their column lists. Primary keys are part of the
+// table definition instead.
+func sourceIndexes(ctx context.Context, src *sql.DB, table string) ([]string, error) {
+	type index struct {
+		name   string
+		origin string
+		sql    sql.NullString
+	}
+	rows, err := src.QueryContext(ctx, `
+		SELECT l.name, l.origin, m.sql
+		FROM pragma_index_list(?) AS l
+		LEFT JOIN sqlite_master AS m ON m.type = 'index' AND m.name = l.name
+		ORDER BY l.name`, table)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []index
+	for rows.Next() {
+		var idx index
+		if err = rows.Scan(&idx.name, &idx.origin, &idx.sql); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var stmts []string
+	for _, idx := range indexes {
+		switch {
+		case idx.origin == "pk":
+		case idx.sql.Valid && idx.sql.String != "":
+			stmt := idx.sql.String
+			if !strings.Contains(strings.ToUpper(stmt), "IF NOT EXISTS") {
+				stmt = strings.Replace(stmt, "INDEX ", "INDEX IF NOT EXISTS ", 1)
+			}
+			stmts = append(stmts, stmt)
+		default:
+			columns, errCols := indexColumns(ctx, src, idx.name)
+			if errCols != nil {
+				return nil, errCols
+			}
+			quoted := make([]string, len(columns))
+			for i, column := range columns {
+				quoted[i] = quoteIdent(column)
+			}
+			stmts = append(stmts, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)",
+				quoteIdent(table+"_"+strings.Join(columns, "_")+"_key"), quoteIdent(table), strings.Join(quoted, ", ")))
+		}
+	}
+	return stmts, nil
+}
+
+func indexColumns(ctx context.Context, src *sql.DB, index string) ([]string, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name FROM pragma_index_info(?) ORDER BY seqno`, index)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// postgresTableDDL translates a SQLite table definition into PostgreSQL. A single
+// INTEGER PRIMARY KEY becomes an identity column, as it auto-increments in SQLite.
+func postgresTableDDL(table migrateTable) string {
+	identity := identityColumn(table)
+	var (
+		defs []string
+		pk   []migrateColumn
+	)
+	for _, col := range table.columns {
+		def := quoteIdent(col.name) + " " + postgresType(col.decl)
+		if col.name == identity {
+			def += " GENERATED BY DEFAULT AS IDENTITY"
+		}
+		if col.notNull {
+			def += " NOT NULL"
+		}
+		if col.dflt.Valid && col.name != identity {
+			def += " DEFAULT " + col.dflt.String
+		}
+		defs = append(defs, def)
+		if col.pk > 0 {
+			pk = append(pk, col)
+		}
+	}
+	if len(pk) > 0 {
+		sort.Slice(pk, func(i, j int) bool { return pk[i].pk < pk[j].pk })
+		names := make([]string, len(pk))
+		for i, col := range pk {
+			names[i] = quoteIdent(col.name)
+		}
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(names, ", ")+")")
+	}
+	return "CREATE TABLE IF NOT EXISTS " + quoteIdent(table.name) + " (\n\t" + strings.Join(defs, ",\n\t") + "\n)"
+}
+
+// identityColumn returns the name of the table's INTEGER PRIMARY KEY, if it has one.
+func identityColumn(table migrateTable) string {
+	var found string
+	for _, col := range table.columns {
+		if col.pk == 0 {
+			continue
+		}
+		if found != "" || strings.ToUpper(strings.TrimSpace(col.decl)) != "INTEGER" {
+			return ""
+		}
+		found = col.name
+	}
+	return found
+}
+
+// postgresType maps a SQLite declared type to a PostgreSQL column type following
+// SQLite's own type affinity rules.
+func postgresType(decl string) string {
+	upper := strings.ToUpper(decl)
+	switch {
+	case strings.Contains(upper, "INT"):
+		return "BIGINT"
+	case strings.Contains(upper, "DATETIME"), strings.Contains(upper, "TIMESTAMP"):
+		return "TIMESTAMPTZ"
+	case strings.Contains(upper, "CHAR"), strings.Contains(upper, "CLOB"), strings.Contains(upper, "TEXT"):
+		return "TEXT"
+	case strings.Contains(upper, "BLOB"):
+		return "BYTEA"
+	case strings.Contains(upper, "REAL"), strings.Contains(upper, "FLOA"), strings.Contains(upper, "DOUB"):
+		return "DOUBLE PRECISION"
+	case upper == "":
+		return "TEXT"
+	default:
+		return "NUMERIC"
+	}
+}
+
+// copyTable copies the rows of table that the previous runs have not copied yet
+// and returns how many rows this call copied.
+func copyTable(ctx context.Context, src, dst *sql.DB, table migrateTable, opts MigrateOptions) (int64, error) {
+	var total int64
+	if opts.Progress != nil {
+		if err := src.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+quoteIdent(table.name)).Scan(&total); err != nil {
+			return 0, err
+		}
+	}
+	var lastRowID, copiedBefore int64
+	err := dst.QueryRowContext(ctx, `SELECT last_rowid, rows FROM `+migrateProgressTable+` WHERE table_name = $1`, table.name).
+		Scan(&lastRowID, &copiedBefore)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	names := make([]string, len(table.columns))
+	binary := make([]bool, len(table.columns))
+	for i, col := range table.columns {
+		names[i] = quoteIdent(col.name)
+		binary[i] = postgresType(col.decl) == "BYTEA"
+	}
+	batchSize := opts.BatchSize
+	if limit := postgresMaxParams / len(table.columns); batchSize > limit {
+		batchSize = limit
+	}
+	selectStmt := fmt.Sprintf(`SELECT rowid, %s FROM %s WHERE rowid > ? ORDER BY rowid LIMIT ?`, strings.Join(names, ", "), quoteIdent(table.name))
+	insertPrefix := fmt.Sprintf(`INSERT INTO %s (%s) VALUES `, quoteIdent(table.name), strings.Join(names, ", "))
+
+	var copied int64
+	for {
+		values, maxRowID, err := readBatch(ctx, src, selectStmt, lastRowID, batchSize, binary)
+		if err != nil {
+			return copied, err
+		}
+		if len(values) == 0 {
+			break
+		}
+		if err = writeBatch(ctx, dst, insertPrefix, table.name, values, len(table.columns), maxRowID, copiedBefore+copied+int64(len(values))); err != nil {
+			return copied, err
+		}
+		lastRowID = maxRowID
+		copied += int64(len(values))
+		if opts.Progress != nil {
+			opts.Progress(MigrateProgress{Table: table.name, Copied: copiedBefore + copied, Total: total})
+		}
+	}
+	if copied == 0 && opts.Progress != nil {
+		opts.Progress(MigrateProgress{Table: table.name, Copied: copiedBefore, Total: total})
+	}
+	return copied, nil
+}
+
+func readBatch(ctx context.Context, src *sql.DB, stmt string, after int64, limit int, binary []bool) ([][]any, int64, error) {
+	rows, err := src.QueryContext(ctx, stmt, after, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+	var (
+		out      [][]any
+		maxRowID int64
+	)
+	for rows.Next() {
+		row := make([]any, len(binary))
+		dest := make([]any, len(binary)+1)
+		dest[0] = &maxRowID
+		for i := range row {
+			dest[i+1] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		for i, value := range row {
+			// SQLite may hand back TEXT as bytes; PostgreSQL only accepts them for BYTEA.
+			if b, ok := value.([]byte); ok && !binary[i] {
+				row[i] = string(b)
+			}
+		}
+		out = append(out, row)
+	}
+	return out, maxRowID, rows.Err()
+}
+
+// writeBatch inserts one batch and advances the table's progress in the same
+// transaction, so a crash never leaves the two out of step.
+func writeBatch(ctx context.Context, dst *sql.DB, insertPrefix, table string, values [][]any, width int, lastRowID, copied int64) error {
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var b strings.Builder
+	b.WriteString(insertPrefix)
+	args := make([]any, 0, len(values)*width)
+	for i, row := range values {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j := range row {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", len(args)+1)
+			args = append(args, row[j])
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(" ON CONFLICT DO NOTHING")
+	if _, err = tx.ExecContext(ctx, b.String(), args...); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO `+migrateProgressTable+` (table_name, last_rowid, rows) VALUES ($1, $2, $3)
+		ON CONFLICT (table_name) DO UPDATE SET last_rowid = excluded.last_rowid, rows = excluded.rows`,
+		table, lastRowID, copied); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
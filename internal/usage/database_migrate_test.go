@@ -0,0 +1,69 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSourceTablesTranslateToPostgres(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{Enabled: true, Path: path}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	store.close()
+
+	src, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	defer func() { _ = src.Close() }()
+	tables, err := sourceTables(context.Background(), src)
+	if err != nil {
+		t.Fatalf("sourceTables failed: %v", err)
+	}
+	byName := make(map[string]migrateTable, len(tables))
+	for _, table := range tables {
+		byName[table.name] = table
+	}
+
+	requests, ok := byName["usage_requests"]
+	if !ok {
+		t.Fatalf("usage_requests missing from %d tables", len(tables))
+	}
+	ddl := postgresTableDDL(requests)
+	for _, want := range []string{
+		`"id" BIGINT GENERATED BY DEFAULT AS IDENTITY`,
+		`"timestamp" TIMESTAMPTZ NOT NULL`,
+		`"request_id" TEXT NOT NULL DEFAULT ''`,
+		`PRIMARY KEY ("id")`,
+	} {
+		if !strings.Contains(ddl, want) {
+			t.Fatalf("usage_requests DDL lacks %q:\n%s", want, ddl)
+		}
+	}
+	var partial bool
+	for _, stmt := range requests.indexes {
+		if !strings.Contains(stmt, "IF NOT EXISTS") {
+			t.Fatalf("index statement is not idempotent: %s", stmt)
+		}
+		partial = partial || strings.Contains(stmt, "WHERE request_id <> ''")
+	}
+	if !partial {
+		t.Fatalf("partial request_id index missing: %v", requests.indexes)
+	}
+
+	daily := postgresTableDDL(byName["usage_daily"])
+	if !strings.Contains(daily, `PRIMARY KEY ("day", "provider", "credential_fingerprint", "model")`) || strings.Contains(daily, "IDENTITY") {
+		t.Fatalf("unexpected usage_daily DDL:\n%s", daily)
+	}
+	if ddl = postgresTableDDL(byName["usage_batch_files"]); !strings.Contains(ddl, `"content" BYTEA NOT NULL`) {
+		t.Fatalf("unexpected usage_batch_files DDL:\n%s", ddl)
+	}
+	if ddl = postgresTableDDL(byName["usage_spend_caps"]); !strings.Contains(ddl, `"spend_usd" DOUBLE PRECISION NOT NULL`) {
+		t.Fatalf("unexpected usage_spend_caps DDL:\n%s", ddl)
+	}
+}
@@ -0,0 +1,387 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// mirrorInterval bounds how long a committed record waits before it is mirrored
+	// when no further writes wake the mirror.
+	mirrorInterval = 5 * time.Second
+	// mirrorRetryInterval is the pause after a failed pass, e.g. while the target is down.
+	mirrorRetryInterval = 30 * time.Second
+)
+
+// mirrorAppendTables only grow between retention passes, so they are mirrored by
+// rowid through the same progress rows `usage migrate` uses.
+var mirrorAppendTables = []string{"usage_requests", "usage_request_tags"}
+
+// usageMirror is the PostgreSQL side of a dual-write window.
+type usageMirror struct {
+	db     *sql.DB
+	append []migrateTable
+	daily  migrateTable
+}
+
+// MirrorDSNFromConfig returns the dual-write target of cfg, or "" when dual-write
+// is disabled.
+func MirrorDSNFromConfig(cfg config.UsageDatabaseConfig) string {
+	if !cfg.DualWrite.Enabled {
+		return ""
+	}
+	return strings.TrimSpace(cfg.DualWrite.DSN)
+}
+
+// notifyMirror wakes the mirror after a commit without blocking the writer.
+func (s *usageStore) notifyMirror() {
+	if s.mirrorWake == nil {
+		return
+	}
+	select {
+	case s.mirrorWake <- struct{}{}:
+	default:
+	}
+}
+
+// mirrorLoop copies committed records into the dual-write target. Rows written
+// while the target is unreachable, including those from before dual-write was
+// enabled, are copied once it is back, so the target catches up on its own.
+func (s *usageStore) mirrorLoop() {
+	defer s.wg.Done()
+	var (
+		mirror *usageMirror
+		failed bool
+	)
+	defer func() {
+		if mirror != nil {
+			_ = mirror.db.Close()
+		}
+	}()
+	ticker := time.NewTicker(mirrorInterval)
+	defer ticker.Stop()
+	var retryAt time.Time
+	for {
+		select {
+		case <-s.mirrorWake:
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+		if time.Now().Before(retryAt) {
+			continue
+		}
+		err := s.syncMirror(&mirror)
+		if err != nil {
+			retryAt = time.Now().Add(mirrorRetryInterval)
+			if !failed {
+				log.WithError(err).Warn("usage: dual-write mirror failed; retrying")
+			}
+		} else if failed {
+			log.Info("usage: dual-write mirror caught up")
+		}
+		failed = err != nil
+	}
+}
+
+// syncMirror runs one pass, connecting first when needed. A failed connection is
+// dropped so the next pass reconnects.
+func (s *usageStore) syncMirror(mirror **usageMirror) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if *mirror == nil {
+		m, err := openUsageMirror(ctx, s.db, s.mirrorDSN)
+		if err != nil {
+			return err
+		}
+		*mirror = m
+	}
+	if err := (*mirror).sync(ctx, s.db, time.Now().UTC()); err != nil {
+		_ = (*mirror).db.Close()
+		*mirror = nil
+		return err
+	}
+	return nil
+}
+
+// openUsageMirror connects to dsn and creates the mirrored tables there.
+func openUsageMirror(ctx context.Context, src *sql.DB, dsn string) (*usageMirror, error) {
+	dst, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+	m := &usageMirror{db: dst}
+	if err = m.prepare(ctx, src); err != nil {
+		_ = dst.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *usageMirror) prepare(ctx context.Context, src *sql.DB) error {
+	if err := m.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("connect to postgres: %w", err)
+	}
+	if err := ensureMigrateProgress(ctx, m.db); err != nil {
+		return fmt.Errorf("create migration progress table: %w", err)
+	}
+	tables, err := sourceTables(ctx, src)
+	if err != nil {
+		return fmt.Errorf("read sqlite schema: %w", err)
+	}
+	for _, table := range tables {
+		switch {
+		case table.name == "usage_daily":
+			m.daily = table
+		case slices.Contains(mirrorAppendTables, table.name):
+			m.append = append(m.append, table)
+		default:
+			continue
+		}
+		if _, err = m.db.ExecContext(ctx, postgresTableDDL(table)); err != nil {
+			return fmt.Errorf("create table %s: %w", table.name, err)
+		}
+		for _, stmt := range table.indexes {
+			if _, err = m.db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("create index on %s: %w", table.name, err)
+			}
+		}
+	}
+	if m.daily.name == "" || len(m.append) != len(mirrorAppendTables) {
+		return errors.New("usage tables missing from the sqlite schema")
+	}
+	return nil
+}
+
+// sync copies new request rows and tags, then overwrites the daily aggregates of
+// yesterday and today, the only days live writes change.
+func (m *usageMirror) sync(ctx context.Context, src *sql.DB, now time.Time) error {
+	for _, table := range m.append {
+		if _, err := copyTable(ctx, src, m.db, table, MigrateOptions{BatchSize: defaultMigrateBatchSize}); err != nil {
+			return fmt.Errorf("mirror %s: %w", table.name, err)
+		}
+	}
+	since := now.AddDate(0, 0, -1).Format("2006-01-02")
+	if err := upsertMirrorRows(ctx, src, m.db, m.daily, `day >= ?`, since); err != nil {
+		return fmt.Errorf("mirror usage_daily: %w", err)
+	}
+	return nil
+}
+
+// upsertMirrorRows replaces the target rows of table matching where with the
+// source rows, keyed by the table's primary key.
+func upsertMirrorRows(ctx context.Context, src, dst *sql.DB, table migrateTable, where string, args ...any) error {
+	names := make([]string, len(table.columns))
+	binary := make([]bool, len(table.columns))
+	var (
+		keys    []migrateColumn
+		updates []string
+	)
+	for i, col := range table.columns {
+		names[i] = quoteIdent(col.name)
+		binary[i] = postgresType(col.decl) == "BYTEA"
+		if col.pk > 0 {
+			keys = append(keys, col)
+		} else {
+			updates = append(updates, names[i]+" = excluded."+names[i])
+		}
+	}
+	if len(keys) == 0 || len(updates) == 0 {
+		return fmt.Errorf("table %s has no primary key to upsert on", table.name)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].pk < keys[j].pk })
+	conflict := make([]string, len(keys))
+	for i, col := range keys {
+		conflict[i] = quoteIdent(col.name)
+	}
+
+	rows, err := src.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, strings.Join(names, ", "), quoteIdent(table.name), where), args...)
+	if err != nil {
+		return err
+	}
+	var values [][]any
+	for rows.Next() {
+		row := make([]any, len(names))
+		dest := make([]any, len(names))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		for i, value := range row {
+			if b, ok := value.([]byte); ok && !binary[i] {
+				row[i] = string(b)
+			}
+		}
+		values = append(values, row)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil || len(values) == 0 {
+		return err
+	}
+
+	placeholders := make([]string, len(names))
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	stmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s`,
+		quoteIdent(table.name), strings.Join(names, ", "), strings.Join(placeholders, ", "),
+		strings.Join(conflict, ", "), strings.Join(updates, ", "))
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, row := range values {
+		if _, err = tx.ExecContext(ctx, stmt, row...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ConsistencyOptions configures CheckConsistency.
+type ConsistencyOptions struct {
+	// SourcePath is the SQLite usage database. It is opened read-only.
+	SourcePath string
+	// TargetDSN is the postgres:// database the source was mirrored or migrated into.
+	TargetDSN string
+	// From and To bound the compared UTC days; To is exclusive.
+	From, To time.Time
+}
+
+// ConsistencyTotals are the usage_requests row count and token sums of one day.
+type ConsistencyTotals struct {
+	Rows             int64 `json:"rows"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// ConsistencyDay compares one UTC day of both stores.
+type ConsistencyDay struct {
+	Day    string            `json:"day"`
+	Source ConsistencyTotals `json:"source"`
+	Target ConsistencyTotals `json:"target"`
+	// Diff is Target minus Source.
+	Diff ConsistencyTotals `json:"diff"`
+}
+
+// Consistent reports whether both stores hold the same totals for the day.
+func (d ConsistencyDay) Consistent() bool {
+	return d.Diff == ConsistencyTotals{}
+}
+
+// ConsistencyReport is the result of CheckConsistency.
+type ConsistencyReport struct {
+	Days       []ConsistencyDay `json:"days"`
+	Mismatched int              `json:"mismatched"`
+}
+
+// CheckConsistency compares the per-day row counts and token sums of usage_requests
+// in a SQLite usage database and its PostgreSQL copy. Days present in either store
+// are reported, oldest first. Records committed during the last few seconds may not
+// have been mirrored yet, so a mismatch for the current day can be transient.
+func CheckConsistency(ctx context.Context, opts ConsistencyOptions) (ConsistencyReport, error) {
+	var report ConsistencyReport
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	src, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout=5000", filepath.ToSlash(filepath.Clean(opts.SourcePath))))
+	if err != nil {
+		return report, fmt.Errorf("usage: open sqlite: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+	dst, err := sql.Open("pgx", opts.TargetDSN)
+	if err != nil {
+		return report, fmt.Errorf("usage: open postgres: %w", err)
+	}
+	defer func() { _ = dst.Close() }()
+
+	from, to := opts.From.UTC(), opts.To.UTC()
+	source, err := dailyConsistencyTotals(ctx, src, sqliteConsistencyQuery, from, to)
+	if err != nil {
+		return report, fmt.Errorf("usage: read sqlite totals: %w", err)
+	}
+	target, err := dailyConsistencyTotals(ctx, dst, postgresConsistencyQuery, from, to)
+	if err != nil {
+		return report, fmt.Errorf("usage: read postgres totals: %w", err)
+	}
+	report = compareConsistencyTotals(source, target)
+	return report, nil
+}
+
+const (
+	sqliteConsistencyQuery = `
+		SELECT substr(timestamp, 1, 10), COUNT(*), COALESCE(SUM(prompt_tokens), 0),
+			COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(total_tokens), 0)
+		FROM usage_requests WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY substr(timestamp, 1, 10)`
+	postgresConsistencyQuery = `
+		SELECT to_char("timestamp" AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*),
+			COALESCE(SUM(prompt_tokens), 0)::BIGINT, COALESCE(SUM(completion_tokens), 0)::BIGINT,
+			COALESCE(SUM(total_tokens), 0)::BIGINT
+		FROM usage_requests WHERE "timestamp" >= $1 AND "timestamp" < $2
+		GROUP BY day`
+)
+
+func dailyConsistencyTotals(ctx context.Context, db *sql.DB, query string, args ...any) (map[string]ConsistencyTotals, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	out := make(map[string]ConsistencyTotals)
+	for rows.Next() {
+		var (
+			day    string
+			totals ConsistencyTotals
+		)
+		if err = rows.Scan(&day, &totals.Rows, &totals.PromptTokens, &totals.CompletionTokens, &totals.TotalTokens); err != nil {
+			return nil, err
+		}
+		out[day] = totals
+	}
+	return out, rows.Err()
+}
+
+// compareConsistencyTotals pairs the days of both stores and computes their diffs.
+func compareConsistencyTotals(source, target map[string]ConsistencyTotals) ConsistencyReport {
+	days := make([]string, 0, len(source)+len(target))
+	for day := range source {
+		days = append(days, day)
+	}
+	for day := range target {
+		if _, ok := source[day]; !ok {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	report := ConsistencyReport{Days: make([]ConsistencyDay, 0, len(days))}
+	for _, day := range days {
+		s, t := source[day], target[day]
+		entry := ConsistencyDay{Day: day, Source: s, Target: t, Diff: ConsistencyTotals{
+			Rows:             t.Rows - s.Rows,
+			PromptTokens:     t.PromptTokens - s.PromptTokens,
+			CompletionTokens: t.CompletionTokens - s.CompletionTokens,
+			TotalTokens:      t.TotalTokens - s.TotalTokens,
+		}}
+		if !entry.Consistent() {
+			report.Mismatched++
+		}
+		report.Days = append(report.Days, entry)
+	}
+	return report
+}
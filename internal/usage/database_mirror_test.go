@@ -0,0 +1,51 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckConsistencyTotals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{Enabled: true, Path: path}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	day := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, ts := range []time.Time{day, day.Add(time.Hour), day.AddDate(0, 0, 1)} {
+		rec := dbRecord{Timestamp: ts, Provider: "claude", Model: "m"}
+		rec.Tokens = TokenStats{InputTokens: int64(10 * (i + 1)), OutputTokens: 5, TotalTokens: int64(10*(i+1) + 5)}
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	source, err := dailyConsistencyTotals(context.Background(), store.db, sqliteConsistencyQuery, day.AddDate(0, 0, -1), day.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatalf("dailyConsistencyTotals failed: %v", err)
+	}
+	if got := source["2026-05-01"]; got != (ConsistencyTotals{Rows: 2, PromptTokens: 30, CompletionTokens: 10, TotalTokens: 40}) {
+		t.Fatalf("unexpected totals for 2026-05-01: %+v", got)
+	}
+
+	target := map[string]ConsistencyTotals{
+		"2026-05-01": source["2026-05-01"],
+		"2026-05-03": {Rows: 1, TotalTokens: 7},
+	}
+	report := compareConsistencyTotals(source, target)
+	if len(report.Days) != 3 || report.Mismatched != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if !report.Days[0].Consistent() {
+		t.Fatalf("expected 2026-05-01 to match: %+v", report.Days[0])
+	}
+	if diff := report.Days[1].Diff; diff.Rows != -1 || diff.TotalTokens != -35 {
+		t.Fatalf("unexpected diff for the missing day: %+v", report.Days[1])
+	}
+	if report.Days[2].Day != "2026-05-03" || report.Days[2].Diff.Rows != 1 {
+		t.Fatalf("expected the target-only day to be reported: %+v", report.Days[2])
+	}
+}
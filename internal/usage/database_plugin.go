@@ -2,19 +2,28 @@ package usage
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/bodylimit"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/clientattr"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/loadshed"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/netaccess"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/providerspend"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/reasoningbudget"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/team"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
 	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
 	log "github.com/sirupsen/logrus"
 	_ "modernc.org/sqlite"
@@ -25,6 +34,47 @@ type DatabaseOptions struct {
 	Enabled       bool
 	Path          string
 	RetentionDays int
+	// RequestsRetentionDays overrides RetentionDays for usage_requests when positive.
+	RequestsRetentionDays int
+	// DailyRetentionDays overrides RetentionDays for usage_daily when positive.
+	DailyRetentionDays int
+	// ProviderRetentionDays overrides usage_requests retention for specific providers.
+	ProviderRetentionDays map[string]int
+	// CredentialRetentionDays overrides usage_requests retention for specific credentials,
+	// keyed by auth ID, API key or credential fingerprint. It wins over provider overrides.
+	CredentialRetentionDays map[string]int
+	// ReadOnly opens an existing database for queries only; no records are written
+	// and retention is left to the owning writer instance.
+	ReadOnly bool
+	// QueueSize is the capacity of the in-memory write queue (default 2048).
+	QueueSize int
+	// OverflowPolicy selects what happens when the write queue is full: "drop-newest"
+	// (default), "drop-oldest", "spill" to a temporary file, or "block".
+	OverflowPolicy string
+	// SQLite tunes the connection pragmas. Changing it reopens the database.
+	SQLite SQLiteOptions
+	// HashAccountEmail stores a SHA-256 of the lower-cased account email instead of
+	// the address itself.
+	HashAccountEmail bool
+	// ModelPrices are copied into usage_model_prices for the v_cost_by_key_day view.
+	// Keys are lower-cased model names.
+	ModelPrices map[string]ModelPrice
+	// SpendCaps are monthly dollar caps keyed by client API key. A key whose priced
+	// spend reaches its cap is suspended until reset through the management API.
+	SpendCaps map[string]float64
+	// TeamSpendCaps are monthly dollar caps keyed by team name. Once a team's
+	// combined spend reaches its cap every key of the team is suspended.
+	TeamSpendCaps map[string]float64
+	// FingerprintSalt switches stored fingerprints from plain SHA-256 to HMAC-SHA256
+	// keyed by the salt. Existing rows are converted with MigrateFingerprints.
+	FingerprintSalt string
+	// MirrorDSN, when set, is a postgres:// database every committed record is also
+	// copied into, for a dual-write window while switching backends. Read-only
+	// stores ignore it.
+	MirrorDSN string
+	// Encryption encrypts credential labels, account emails and client labels before
+	// they are written. Rows written without it stay readable.
+	Encryption DatabaseEncryption
 }
 
 type databasePlugin struct{}
@@ -41,10 +91,30 @@ func init() {
 // ConfigureDatabase wires the on-disk usage store based on options.
 func ConfigureDatabase(opts DatabaseOptions) error {
 	normalized := normalizeDatabaseOptions(opts)
+	setFingerprintSalt(normalized.FingerprintSalt)
 	prev := currentDBConfig.Load()
 	if configsEqual(prev, &normalized) {
 		return nil
 	}
+	if prev == nil || prev.Encryption != normalized.Encryption {
+		if err := configureColumnCipher(normalized.Encryption); err != nil {
+			return err
+		}
+	}
+	if storageEqual(prev, &normalized) {
+		if store := currentUsageStore.Load(); store != nil {
+			store.setRetention(newRetentionPolicy(normalized))
+			store.overflow.policy.Store(normalized.OverflowPolicy)
+			if err := store.syncModelPrices(normalized.ModelPrices); err != nil {
+				log.WithError(err).Warn("usage: failed to update model prices")
+			}
+			store.setSpendCaps(normalized.SpendCaps, normalized.TeamSpendCaps)
+			store.warnFingerprintMigration()
+			store.warnSealedColumns()
+			currentDBConfig.Store(&normalized)
+			return nil
+		}
+	}
 
 	if !normalized.Enabled || normalized.Path == "" {
 		currentDBConfig.Store(&normalized)
@@ -61,7 +131,7 @@ func ConfigureDatabase(opts DatabaseOptions) error {
 	}
 	old := currentUsageStore.Swap(store)
 	if old != nil {
-		old.close()
+		old.handover(store)
 	}
 	currentDBConfig.Store(&normalized)
 	return nil
@@ -71,24 +141,62 @@ func normalizeDatabaseOptions(opts DatabaseOptions) DatabaseOptions {
 	if opts.RetentionDays <= 0 {
 		opts.RetentionDays = 14
 	}
+	if opts.RequestsRetentionDays < 0 {
+		opts.RequestsRetentionDays = 0
+	}
+	if opts.DailyRetentionDays < 0 {
+		opts.DailyRetentionDays = 0
+	}
+	opts.ProviderRetentionDays = config.NormalizeProviderRetentionDays(opts.ProviderRetentionDays)
+	opts.CredentialRetentionDays = config.NormalizeCredentialRetentionDays(opts.CredentialRetentionDays)
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	opts.OverflowPolicy = normalizeOverflowPolicy(opts.OverflowPolicy)
+	opts.SQLite = normalizeSQLiteOptions(opts.SQLite)
+	opts.ModelPrices = normalizeModelPrices(opts.ModelPrices)
+	opts.SpendCaps = maps.Clone(opts.SpendCaps)
+	maps.DeleteFunc(opts.SpendCaps, func(_ string, limit float64) bool { return limit <= 0 })
+	opts.TeamSpendCaps = maps.Clone(opts.TeamSpendCaps)
+	maps.DeleteFunc(opts.TeamSpendCaps, func(_ string, limit float64) bool { return limit <= 0 })
 	if opts.Path != "" {
 		opts.Path = filepath.Clean(opts.Path)
 	}
+	opts.MirrorDSN = strings.TrimSpace(opts.MirrorDSN)
 	return opts
 }
 
 func configsEqual(a, b *DatabaseOptions) bool {
+	if !storageEqual(a, b) {
+		return false
+	}
+	return a.RetentionDays == b.RetentionDays &&
+		a.RequestsRetentionDays == b.RequestsRetentionDays &&
+		a.DailyRetentionDays == b.DailyRetentionDays &&
+		a.OverflowPolicy == b.OverflowPolicy &&
+		a.HashAccountEmail == b.HashAccountEmail &&
+		maps.Equal(a.ProviderRetentionDays, b.ProviderRetentionDays) &&
+		maps.Equal(a.CredentialRetentionDays, b.CredentialRetentionDays) &&
+		maps.Equal(a.ModelPrices, b.ModelPrices) &&
+		maps.Equal(a.SpendCaps, b.SpendCaps) &&
+		maps.Equal(a.TeamSpendCaps, b.TeamSpendCaps) &&
+		a.FingerprintSalt == b.FingerprintSalt &&
+		a.Encryption == b.Encryption
+}
+
+// storageEqual reports whether two option sets target the same database file with
+// the same connection settings.
+func storageEqual(a, b *DatabaseOptions) bool {
 	if a == nil || b == nil {
 		return false
 	}
-	return a.Enabled == b.Enabled &&
-		a.Path == b.Path &&
-		a.RetentionDays == b.RetentionDays
+	return a.Enabled == b.Enabled && a.Path == b.Path && a.ReadOnly == b.ReadOnly && a.QueueSize == b.QueueSize &&
+		a.SQLite == b.SQLite && a.MirrorDSN == b.MirrorDSN
 }
 
 func (databasePlugin) HandleUsage(ctx context.Context, record coreusage.Record) {
 	store := currentUsageStore.Load()
-	if store == nil {
+	if store == nil || store.readOnly {
 		return
 	}
 
@@ -98,24 +206,50 @@ func (databasePlugin) HandleUsage(ctx context.Context, record coreusage.Record)
 		timestamp = time.Now()
 	}
 
-	status := resolveStatusCode(ctx)
+	status := recordStatus(ctx, record)
 	rateLimited := status == http.StatusTooManyRequests
 	apiKeyHash := fingerprint(record.APIKey)
+	email := strings.ToLower(strings.TrimSpace(record.AccountEmail))
+	if opts := currentDBConfig.Load(); opts != nil && opts.HashAccountEmail {
+		email = fingerprint(email)
+	}
 
 	dbRec := dbRecord{
 		Timestamp:             timestamp.UTC(),
 		Provider:              record.Provider,
 		Model:                 record.Model,
-		CredentialLabel:       credentialLabel(record),
+		CredentialLabel:       sealColumn(credentialLabel(record)),
 		CredentialFingerprint: credentialFingerprint(record),
 		APIKeyHash:            apiKeyHash,
+		Team:                  team.Lookup(record.APIKey),
 		AuthID:                record.AuthID,
 		AuthIndex:             record.AuthIndex,
 		Source:                record.Source,
+		AccountEmail:          sealColumn(email),
 		StatusCode:            status,
 		Failed:                record.Failed,
 		RateLimited:           rateLimited,
 		Tokens:                detail,
+		Tags:                  record.Tags,
+		PolicyDenied:          record.PolicyDenied,
+		Rejection:             record.Rejection,
+		QueueWaitMs:           record.QueueWait.Milliseconds(),
+		RequestedModel:        record.RequestedModel,
+		DurationMs:            recordDuration(record).Milliseconds(),
+		ClientLabel:           sealColumn(clientLabel(ctx)),
+		RequestID:             tracing.RequestIDFromContext(ctx),
+		Metadata:              encodeMetadata(requestMetadata(ctx)),
+		AudioSeconds:          record.AudioSeconds,
+		ErrorClass:            record.ErrorClass,
+		ReasoningBudget:       reasoningbudget.Outcome(ctx, record.Rejection, detail.ReasoningTokens),
+		Aborted:               record.Aborted,
+	}
+	if client, ok := clientattr.FromContext(ctx); ok {
+		if client.IP.IsValid() {
+			dbRec.ClientIPHash = fingerprint(client.IP.String())
+		}
+		dbRec.UserAgent = client.UserAgent
+		dbRec.ClientCountry = client.Country
 	}
 
 	if err := store.enqueue(dbRec); err != nil {
@@ -123,6 +257,42 @@ func (databasePlugin) HandleUsage(ctx context.Context, record coreusage.Record)
 	}
 }
 
+// recordStatus returns the HTTP status of the request behind record, using the
+// status implied by proxy-side rejections when there is one.
+func recordStatus(ctx context.Context, record coreusage.Record) int {
+	switch {
+	case record.PolicyDenied, record.Rejection == netaccess.RejectionIPDenied, record.Rejection == RejectionSpendCap:
+		return http.StatusForbidden
+	case record.Rejection == netaccess.RejectionRateLimited, record.Rejection == providerspend.Rejection,
+		record.Rejection == team.RejectionRateLimited:
+		return http.StatusTooManyRequests
+	case record.Rejection == bodylimit.RejectionTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case record.Rejection == reasoningbudget.Rejection:
+		return http.StatusBadRequest
+	case record.Rejection == loadshed.Rejection:
+		return http.StatusServiceUnavailable
+	}
+	return resolveStatusCode(ctx)
+}
+
+// clientLabel returns the identity an access provider attached to the request,
+// such as the subject of an OIDC token.
+func clientLabel(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil {
+		return ""
+	}
+	metadata, ok := ginCtx.Value("accessMetadata").(map[string]string)
+	if !ok {
+		return ""
+	}
+	return metadata["subject"]
+}
+
 func resolveStatusCode(ctx context.Context) int {
 	if ctx == nil {
 		return 0
@@ -165,14 +335,6 @@ func credentialFingerprint(record coreusage.Record) string {
 	}
 }
 
-func fingerprint(value string) string {
-	if value == "" {
-		return ""
-	}
-	sum := sha256.Sum256([]byte(value))
-	return hex.EncodeToString(sum[:])
-}
-
 type dbRecord struct {
 	Timestamp             time.Time
 	Provider              string
@@ -183,46 +345,163 @@ type dbRecord struct {
 	AuthID                string
 	AuthIndex             uint64
 	Source                string
+	AccountEmail          string
 	StatusCode            int
 	Failed                bool
 	RateLimited           bool
 	Tokens                TokenStats
+	Tags                  []string
+	PolicyDenied          bool
+	Rejection             string
+	QueueWaitMs           int64
+	RequestedModel        string
+	DurationMs            int64
+	ClientLabel           string
+	RequestID             string
+	Metadata              string
+	AudioSeconds          float64
+	ErrorClass            string
+	ClientIPHash          string
+	UserAgent             string
+	ClientCountry         string
+	// ReasoningBudget is the reasoning budget outcome ("clamped", "rejected", "flagged"
+	// or "exceeded"), empty when no budget applied or it was respected.
+	ReasoningBudget string
+	// Aborted marks streams the client disconnected from; Tokens are partial.
+	Aborted bool
+	// Team is the team of the client key at the time of the request.
+	Team string
 }
 
 type usageStore struct {
-	db            *sql.DB
-	retentionDays int
-	queue         chan dbRecord
-	stop          chan struct{}
-	wg            sync.WaitGroup
+	db        *sql.DB
+	readOnly  bool
+	retention atomic.Pointer[retentionPolicy]
+	// retentionMu serialises scheduled and manually triggered retention passes.
+	retentionMu sync.Mutex
+	// lease tracks the maintenance lease shared with other processes writing the file.
+	lease    leaseState
+	queue    chan dbRecord
+	overflow overflowState
+	spend    spendState
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	// fingerprintScheme records how fingerprints already in the database were made.
+	fingerprintScheme atomic.Value
+
+	// enqueueMu lets close wait for in-flight enqueues, so no record can enter the
+	// queue after it has been drained.
+	enqueueMu sync.RWMutex
+	closed    bool
+	// successor receives records queued or enqueued after a configuration reload
+	// replaced this store.
+	successor atomic.Pointer[usageStore]
+
+	// mirrorDSN and mirrorWake drive the dual-write mirror; mirrorWake is nil
+	// without one.
+	mirrorDSN  string
+	mirrorWake chan struct{}
 }
 
 func newUsageStore(opts DatabaseOptions) (*usageStore, error) {
 	if opts.Path == "" {
 		return nil, errors.New("usage: database path is empty")
 	}
+	if opts.ReadOnly {
+		return openReadOnlyUsageStore(opts)
+	}
 	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
 		return nil, fmt.Errorf("usage: mkdir failed: %w", err)
 	}
 
-	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout=5000&_pragma=foreign_keys=on", filepath.ToSlash(opts.Path))
-	db, err := sql.Open("sqlite", dsn)
+	db, err := sql.Open("sqlite", sqliteDSN(opts.Path, opts.SQLite, false))
 	if err != nil {
 		return nil, fmt.Errorf("usage: open sqlite: %w", err)
 	}
 	if err := applyUsageSchema(db); err != nil {
 		return nil, err
 	}
+	scheme, err := loadFingerprintScheme(db, true)
+	if err != nil {
+		return nil, fmt.Errorf("usage: read fingerprint scheme: %w", err)
+	}
 
+	queueSize := opts.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
 	store := &usageStore{
-		db:            db,
-		retentionDays: opts.RetentionDays,
-		queue:         make(chan dbRecord, 2048),
-		stop:          make(chan struct{}),
+		db:    db,
+		queue: make(chan dbRecord, queueSize),
+		stop:  make(chan struct{}),
+	}
+	store.lease.instance = newLeaseInstance()
+	leader := store.renewLease(time.Now().UTC())
+	store.fingerprintScheme.Store(scheme)
+	store.warnFingerprintMigration()
+	store.warnSealedColumns()
+	store.overflow.policy.Store(normalizeOverflowPolicy(opts.OverflowPolicy))
+	store.overflow.spill = &spillFile{dir: filepath.Dir(opts.Path)}
+	store.setRetention(newRetentionPolicy(opts))
+	if err := store.syncModelPrices(opts.ModelPrices); err != nil {
+		log.WithError(err).Warn("usage: failed to store model prices")
+	}
+	store.setSpendCaps(opts.SpendCaps, opts.TeamSpendCaps)
+	if err := store.loadSpendSuspensions(); err != nil {
+		log.WithError(err).Warn("usage: failed to load key suspensions")
+	}
+	// Unfinished batches may belong to another live process sharing the file, so
+	// only a process that takes over the maintenance lease fails them.
+	if leader {
+		if err := store.failInterruptedBatches(); err != nil {
+			log.WithError(err).Warn("usage: failed to mark interrupted batches")
+		}
 	}
-	store.wg.Add(2)
+	store.wg.Add(3)
 	go store.run()
 	go store.retentionLoop()
+	go store.leaseLoop()
+	if opts.MirrorDSN != "" {
+		store.mirrorDSN = opts.MirrorDSN
+		store.mirrorWake = make(chan struct{}, 1)
+		store.wg.Add(1)
+		go store.mirrorLoop()
+	}
+	return store, nil
+}
+
+// openReadOnlyUsageStore opens an existing database without starting the writer
+// or retention goroutines, so secondary processes can serve queries against a
+// file owned by another instance.
+func openReadOnlyUsageStore(opts DatabaseOptions) (*usageStore, error) {
+	if _, err := os.Stat(opts.Path); err != nil {
+		return nil, fmt.Errorf("usage: read-only database unavailable: %w", err)
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(opts.Path, opts.SQLite, true))
+	if err != nil {
+		return nil, fmt.Errorf("usage: open sqlite: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("usage: open sqlite: %w", err)
+	}
+	store := &usageStore{
+		db:       db,
+		readOnly: true,
+		stop:     make(chan struct{}),
+	}
+	if scheme, errScheme := loadFingerprintScheme(db, false); errScheme == nil {
+		store.fingerprintScheme.Store(scheme)
+	} else {
+		store.fingerprintScheme.Store(fingerprintSchemeSHA256)
+	}
+	store.overflow.policy.Store(normalizeOverflowPolicy(opts.OverflowPolicy))
+	store.setRetention(newRetentionPolicy(opts))
+	store.setSpendCaps(opts.SpendCaps, opts.TeamSpendCaps)
+	if err := store.loadSpendSuspensions(); err != nil {
+		log.WithError(err).Warn("usage: failed to load key suspensions")
+	}
 	return store, nil
 }
 
@@ -265,32 +544,228 @@ func applyUsageSchema(db *sql.DB) error {
 			PRIMARY KEY (day, provider, credential_fingerprint, model)
 		);`,
 		`CREATE INDEX IF NOT EXISTS idx_usage_daily_provider ON usage_daily(provider, day);`,
+		`CREATE TABLE IF NOT EXISTS usage_monthly (
+			month TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			credential_fingerprint TEXT NOT NULL,
+			credential_label TEXT NOT NULL,
+			model TEXT NOT NULL,
+			total_requests INTEGER NOT NULL,
+			failed_requests INTEGER NOT NULL,
+			rate_limited INTEGER NOT NULL,
+			prompt_tokens INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			total_tokens INTEGER NOT NULL,
+			PRIMARY KEY (month, provider, credential_fingerprint, model)
+		);`,
+		`CREATE TABLE IF NOT EXISTS usage_request_tags (
+			request_id INTEGER NOT NULL REFERENCES usage_requests(id) ON DELETE CASCADE,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (request_id, tag)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_request_tags_tag ON usage_request_tags(tag);`,
+		`CREATE TABLE IF NOT EXISTS usage_meta (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS usage_leases (
+			name TEXT PRIMARY KEY,
+			holder TEXT NOT NULL,
+			expires_at INTEGER NOT NULL,
+			heartbeat_at INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS usage_spend_caps (
+			api_key_hash TEXT PRIMARY KEY,
+			month TEXT NOT NULL,
+			spend_usd REAL NOT NULL,
+			cap_usd REAL NOT NULL,
+			suspended_at DATETIME,
+			reset_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS usage_batch_files (
+			id TEXT PRIMARY KEY,
+			purpose TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			bytes INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			api_key_hash TEXT NOT NULL,
+			content BLOB NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS usage_batches (
+			id TEXT PRIMARY KEY,
+			api_key_hash TEXT NOT NULL,
+			endpoint TEXT NOT NULL,
+			input_file_id TEXT NOT NULL,
+			output_file_id TEXT NOT NULL DEFAULT '',
+			error_file_id TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			completion_window TEXT NOT NULL,
+			metadata TEXT NOT NULL DEFAULT 'null',
+			errors TEXT NOT NULL DEFAULT 'null',
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			in_progress_at DATETIME,
+			finalizing_at DATETIME,
+			completed_at DATETIME,
+			failed_at DATETIME,
+			expired_at DATETIME,
+			cancelling_at DATETIME,
+			cancelled_at DATETIME,
+			total INTEGER NOT NULL DEFAULT 0,
+			completed INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_batches_api_key ON usage_batches(api_key_hash);`,
+		`CREATE TABLE IF NOT EXISTS usage_session_affinity (
+			affinity_key TEXT PRIMARY KEY,
+			auth_id TEXT NOT NULL,
+			expires_at DATETIME NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS shadow_comparisons (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp DATETIME NOT NULL,
+			rule TEXT NOT NULL,
+			request_id TEXT NOT NULL DEFAULT '',
+			api_key_hash TEXT NOT NULL DEFAULT '',
+			primary_model TEXT NOT NULL,
+			primary_status INTEGER NOT NULL,
+			primary_latency_ms INTEGER NOT NULL,
+			primary_input_tokens INTEGER NOT NULL,
+			primary_output_tokens INTEGER NOT NULL,
+			primary_error TEXT NOT NULL DEFAULT '',
+			primary_response TEXT NOT NULL DEFAULT '',
+			shadow_model TEXT NOT NULL,
+			shadow_status INTEGER NOT NULL,
+			shadow_latency_ms INTEGER NOT NULL,
+			shadow_input_tokens INTEGER NOT NULL,
+			shadow_output_tokens INTEGER NOT NULL,
+			shadow_error TEXT NOT NULL DEFAULT '',
+			shadow_response TEXT NOT NULL DEFAULT '',
+			latency_delta_ms INTEGER NOT NULL,
+			output_token_delta INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_shadow_comparisons_rule_time ON shadow_comparisons(rule, timestamp);`,
+		`CREATE TABLE IF NOT EXISTS auth_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp DATETIME NOT NULL,
+			type TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			auth_id TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			consecutive_failures INTEGER NOT NULL DEFAULT 0,
+			expires_at TEXT NOT NULL DEFAULT '',
+			retry_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_auth_events_auth_time ON auth_events(auth_id, timestamp);`,
 	}
 	for _, stmt := range schema {
 		if _, err := db.Exec(stmt); err != nil {
 			return fmt.Errorf("usage: apply schema: %w", err)
 		}
 	}
-	return nil
+	columns := []struct{ table, name, decl string }{
+		{"usage_requests", "tags", "TEXT"},
+		{"usage_requests", "policy_denied", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "queue_wait_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "account_email", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "requested_model", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "rejection", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "duration_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "client_label", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "request_id", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "metadata", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "audio_seconds", "REAL NOT NULL DEFAULT 0"},
+		{"usage_requests", "error_class", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "client_ip_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "user_agent", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "client_country", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "tool_calls", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "tool_result_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "image_inputs", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "reasoning_budget", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_requests", "aborted", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "document_inputs", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "media_bytes", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "cache_creation_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_requests", "team", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_daily", "account_email", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_monthly", "account_email", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_daily", "aborted_requests", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_monthly", "aborted_requests", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, col := range columns {
+		if err := ensureColumn(db, col.table, col.name, col.decl); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_usage_requests_account_email ON usage_requests(account_email, timestamp);`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_requests_request_id ON usage_requests(request_id) WHERE request_id <> '';`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_requests_api_key ON usage_requests(api_key_hash, timestamp);`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_requests_client_ip ON usage_requests(client_ip_hash, timestamp) WHERE client_ip_hash <> '';`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_requests_team ON usage_requests(team, timestamp) WHERE team <> '';`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("usage: apply schema: %w", err)
+		}
+	}
+	return applyUsageViews(db)
 }
 
-func (s *usageStore) enqueue(rec dbRecord) error {
-	select {
-	case s.queue <- rec:
-		return nil
-	case <-s.stop:
-		return errors.New("usage: database store stopped")
+// ensureColumn adds a column to an existing table when it is missing, letting
+// databases created by older builds pick up new fields in place.
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return fmt.Errorf("usage: inspect %s: %w", table, err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("usage: inspect %s: %w", table, err)
+		}
+		if strings.EqualFold(name, column) {
+			return nil
+		}
 	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("usage: inspect %s: %w", table, err)
+	}
+	_ = rows.Close()
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl)); err != nil {
+		return fmt.Errorf("usage: add column %s.%s: %w", table, column, err)
+	}
+	return nil
 }
 
+var (
+	// ErrReadOnly is returned for writes against a read-only usage database.
+	ErrReadOnly     = errors.New("usage: database store is read-only")
+	errStoreStopped = errors.New("usage: database store stopped")
+)
+
 func (s *usageStore) run() {
 	defer s.wg.Done()
+	s.overflow.spill.recover(s.insert)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	for {
 		select {
 		case rec := <-s.queue:
 			if err := s.insert(rec); err != nil {
 				log.WithError(err).Warn("usage: insert failed")
 			}
+		case <-ticker.C:
+			s.replaySpill()
 		case <-s.stop:
 			s.drainRemaining()
 			return
@@ -299,13 +774,18 @@ func (s *usageStore) run() {
 }
 
 func (s *usageStore) drainRemaining() {
+	insert := s.insert
+	if next := s.successor.Load(); next != nil {
+		insert = next.insert
+	}
 	for {
 		select {
 		case rec := <-s.queue:
-			if err := s.insert(rec); err != nil {
+			if err := insert(rec); err != nil {
 				log.WithError(err).Warn("usage: insert during drain failed")
 			}
 		default:
+			s.overflow.spill.drain(insert)
 			return
 		}
 	}
@@ -326,23 +806,8 @@ func (s *usageStore) retentionLoop() {
 	}
 }
 
-func (s *usageStore) applyRetention() {
-	if s.retentionDays <= 0 {
-		return
-	}
-	cutoff := time.Now().UTC().Add(-time.Duration(s.retentionDays) * 24 * time.Hour)
-	_, err := s.db.Exec(`DELETE FROM usage_requests WHERE timestamp < ?`, cutoff)
-	if err != nil {
-		log.WithError(err).Warn("usage: retention delete requests failed")
-	}
-	cutoffDay := cutoff.Format("2006-01-02")
-	_, err = s.db.Exec(`DELETE FROM usage_daily WHERE day < ?`, cutoffDay)
-	if err != nil {
-		log.WithError(err).Warn("usage: retention delete daily failed")
-	}
-}
-
-func (s *usageStore) insert(rec dbRecord) error {
+func (s *usageStore) insert(rec dbRecord) (err error) {
+	defer func() { databaseHealth.observe(err) }()
 	tx, err := s.db.BeginTx(context.Background(), nil)
 	if err != nil {
 		return err
@@ -351,27 +816,46 @@ func (s *usageStore) insert(rec dbRecord) error {
 		_ = tx.Rollback()
 	}()
 
-	if _, err := tx.ExecContext(context.Background(), `
+	res, err := tx.ExecContext(context.Background(), `
 		INSERT INTO usage_requests (
 			timestamp, provider, model, credential_label, credential_fingerprint,
 			api_key_hash, auth_id, auth_index, source, status_code, failed,
 			rate_limited, prompt_tokens, completion_tokens, reasoning_tokens,
-			cached_tokens, total_tokens
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+			cached_tokens, total_tokens, tags, policy_denied, queue_wait_ms, account_email,
+			requested_model, rejection, duration_ms, client_label, request_id, metadata, audio_seconds,
+			error_class, client_ip_hash, user_agent, client_country, tool_calls, tool_result_tokens, image_inputs,
+			reasoning_budget, aborted, document_inputs, media_bytes, cache_creation_tokens, team
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 	`, rec.Timestamp, rec.Provider, rec.Model, rec.CredentialLabel, rec.CredentialFingerprint,
 		rec.APIKeyHash, rec.AuthID, rec.AuthIndex, rec.Source, rec.StatusCode, boolToInt(rec.Failed),
 		boolToInt(rec.RateLimited), rec.Tokens.InputTokens, rec.Tokens.OutputTokens, rec.Tokens.ReasoningTokens,
-		rec.Tokens.CachedTokens, rec.Tokens.TotalTokens); err != nil {
+		rec.Tokens.CachedTokens, rec.Tokens.TotalTokens, strings.Join(rec.Tags, ","), boolToInt(rec.PolicyDenied), rec.QueueWaitMs, rec.AccountEmail,
+		rec.RequestedModel, rec.Rejection, rec.DurationMs, rec.ClientLabel, rec.RequestID, rec.Metadata, rec.AudioSeconds,
+		rec.ErrorClass, rec.ClientIPHash, rec.UserAgent, rec.ClientCountry, rec.Tokens.ToolCalls, rec.Tokens.ToolResultTokens, rec.Tokens.ImageInputs,
+		rec.ReasoningBudget, boolToInt(rec.Aborted), rec.Tokens.DocumentInputs, rec.Tokens.MediaBytes, rec.Tokens.CacheCreationTokens, rec.Team)
+	if err != nil {
 		return err
 	}
+	if len(rec.Tags) > 0 {
+		requestID, errID := res.LastInsertId()
+		if errID != nil {
+			return errID
+		}
+		for _, tag := range rec.Tags {
+			if _, err := tx.ExecContext(context.Background(),
+				`INSERT OR IGNORE INTO usage_request_tags (request_id, tag) VALUES (?, ?)`, requestID, tag); err != nil {
+				return err
+			}
+		}
+	}
 
 	day := rec.Timestamp.Format("2006-01-02")
 	if _, err := tx.ExecContext(context.Background(), `
 		INSERT INTO usage_daily (
 			day, provider, credential_fingerprint, credential_label, model,
 			total_requests, failed_requests, rate_limited, prompt_tokens,
-			completion_tokens, total_tokens
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			completion_tokens, total_tokens, account_email, aborted_requests
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(day, provider, credential_fingerprint, model) DO UPDATE SET
 			total_requests = usage_daily.total_requests + excluded.total_requests,
 			failed_requests = usage_daily.failed_requests + excluded.failed_requests,
@@ -379,17 +863,28 @@ func (s *usageStore) insert(rec dbRecord) error {
 			prompt_tokens = usage_daily.prompt_tokens + excluded.prompt_tokens,
 			completion_tokens = usage_daily.completion_tokens + excluded.completion_tokens,
 			total_tokens = usage_daily.total_tokens + excluded.total_tokens,
+			aborted_requests = usage_daily.aborted_requests + excluded.aborted_requests,
 			credential_label = CASE
 				WHEN excluded.credential_label != '' THEN excluded.credential_label
 				ELSE usage_daily.credential_label
+			END,
+			account_email = CASE
+				WHEN excluded.account_email != '' THEN excluded.account_email
+				ELSE usage_daily.account_email
 			END;
 	`, day, rec.Provider, rec.CredentialFingerprint, rec.CredentialLabel, rec.Model,
 		1, boolToInt(rec.Failed), boolToInt(rec.RateLimited), rec.Tokens.InputTokens,
-		rec.Tokens.OutputTokens, rec.Tokens.TotalTokens); err != nil {
+		rec.Tokens.OutputTokens, rec.Tokens.TotalTokens, rec.AccountEmail, boolToInt(rec.Aborted)); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.notifyMirror()
+	s.checkSpendCap(rec)
+	s.checkProviderSpendCap(rec)
+	return nil
 }
 
 func boolToInt(v bool) int {
@@ -400,7 +895,22 @@ func boolToInt(v bool) int {
 }
 
 func (s *usageStore) close() {
+	s.handover(nil)
+}
+
+// handover stops the store. Records still queued or spilled, and records enqueued
+// by callers that loaded the store before it was swapped out, are written to next
+// when it is writable, so reconfiguring the database loses none of them. Without a
+// writable successor they are flushed to this store's own database before it closes.
+func (s *usageStore) handover(next *usageStore) {
+	if next != nil && !next.readOnly {
+		s.successor.Store(next)
+	}
+	s.enqueueMu.Lock()
+	s.closed = true
+	s.enqueueMu.Unlock()
 	close(s.stop)
 	s.wg.Wait()
+	s.releaseLease()
 	_ = s.db.Close()
 }
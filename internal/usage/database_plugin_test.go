@@ -122,3 +122,182 @@ func TestDatabasePluginHandleUsage(t *testing.T) {
 		time.Sleep(50 * time.Millisecond)
 	}
 }
+
+func TestUsageStoreReadOnlyReplica(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "usage.db")
+	writer, err := newUsageStore(DatabaseOptions{Enabled: true, Path: path})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	if err := writer.insert(dbRecord{
+		Timestamp:             time.Now().UTC(),
+		Provider:              "gemini",
+		Model:                 "gemini-2.5-pro",
+		CredentialFingerprint: "fingerprint",
+		StatusCode:            200,
+	}); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	writer.close()
+
+	replica, err := newUsageStore(DatabaseOptions{Enabled: true, Path: path, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to open read-only store: %v", err)
+	}
+	defer replica.close()
+
+	var total int
+	if err := replica.db.QueryRow(`SELECT SUM(total_requests) FROM usage_daily`).Scan(&total); err != nil {
+		t.Fatalf("query usage_daily failed: %v", err)
+	}
+	if total != 1 {
+		t.Fatalf("expected 1 request in replica, got %d", total)
+	}
+	if err := replica.enqueue(dbRecord{}); err == nil {
+		t.Fatal("expected enqueue on read-only store to fail")
+	}
+
+	if _, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "missing.db"), ReadOnly: true}); err == nil {
+		t.Fatal("expected read-only open of missing database to fail")
+	}
+}
+
+func TestUsageStoreRecordsAccountEmail(t *testing.T) {
+	t.Parallel()
+
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	for _, email := range []string{"acct@example.com", ""} {
+		rec := dbRecord{
+			Timestamp:             now,
+			Provider:              "claude",
+			Model:                 "claude-sonnet",
+			CredentialLabel:       "auth-A",
+			CredentialFingerprint: "fp-A",
+			AccountEmail:          email,
+			Tokens:                TokenStats{TotalTokens: 5},
+		}
+		if err := store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	var requests int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM usage_requests WHERE account_email = ?`, "acct@example.com").Scan(&requests); err != nil {
+		t.Fatalf("query usage_requests failed: %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expected 1 request row for the account, got %d", requests)
+	}
+	var dailyEmail string
+	if err := store.db.QueryRow(`SELECT account_email FROM usage_daily WHERE credential_fingerprint = ?`, "fp-A").Scan(&dailyEmail); err != nil {
+		t.Fatalf("query usage_daily failed: %v", err)
+	}
+	if dailyEmail != "acct@example.com" {
+		t.Fatalf("expected daily row to keep the account email, got %q", dailyEmail)
+	}
+}
+
+func TestUsageStoreCountsAbortedStreams(t *testing.T) {
+	t.Parallel()
+
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	for _, aborted := range []bool{true, false} {
+		rec := dbRecord{
+			Timestamp:             now,
+			Provider:              "claude",
+			Model:                 "claude-3",
+			CredentialFingerprint: "fingerprint",
+			Aborted:               aborted,
+			Tokens:                TokenStats{InputTokens: 10, OutputTokens: 5, TotalTokens: 15},
+		}
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	var abortedRows int
+	if err = store.db.QueryRow(`SELECT COUNT(*) FROM usage_requests WHERE aborted = 1`).Scan(&abortedRows); err != nil {
+		t.Fatalf("query usage_requests failed: %v", err)
+	}
+	var totalRequests, abortedRequests, failedRequests, tokens int
+	if err = store.db.QueryRow(`SELECT total_requests, aborted_requests, failed_requests, total_tokens FROM usage_daily`).
+		Scan(&totalRequests, &abortedRequests, &failedRequests, &tokens); err != nil {
+		t.Fatalf("query usage_daily failed: %v", err)
+	}
+	if abortedRows != 1 || totalRequests != 2 || abortedRequests != 1 || failedRequests != 0 || tokens != 30 {
+		t.Fatalf("unexpected aggregate: aborted rows=%d requests=%d aborted=%d failed=%d tokens=%d",
+			abortedRows, totalRequests, abortedRequests, failedRequests, tokens)
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = compactDaily(context.Background(), tx, now.AddDate(0, 0, 1).Format("2006-01-02")); err != nil {
+		t.Fatalf("compact failed: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.db.QueryRow(`SELECT aborted_requests FROM usage_monthly`).Scan(&abortedRequests); err != nil || abortedRequests != 1 {
+		t.Fatalf("expected aborted requests to survive compaction, got %d, %v", abortedRequests, err)
+	}
+}
+
+func TestUsageStoreAppliesSQLitePragmas(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "usage.db")
+	opts := normalizeDatabaseOptions(DatabaseOptions{Enabled: true, Path: path, SQLite: SQLiteOptions{
+		JournalMode:   "TRUNCATE",
+		Synchronous:   "normal",
+		CacheSizeKB:   8192,
+		BusyTimeoutMs: 15000,
+		MmapSizeMB:    64,
+	}})
+	store, err := newUsageStore(opts)
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	for pragma, want := range map[string]string{
+		"journal_mode": "truncate",
+		"synchronous":  "1",
+		"cache_size":   "-8192",
+		"busy_timeout": "15000",
+		"mmap_size":    "67108864",
+	} {
+		var got string
+		if err := store.db.QueryRow("PRAGMA " + pragma).Scan(&got); err != nil {
+			t.Fatalf("PRAGMA %s failed: %v", pragma, err)
+		}
+		if got != want {
+			t.Fatalf("PRAGMA %s = %s, want %s", pragma, got, want)
+		}
+	}
+
+	defaults := normalizeSQLiteOptions(SQLiteOptions{})
+	if defaults.JournalMode != "wal" || defaults.BusyTimeoutMs != 5000 || defaults.Synchronous != "" {
+		t.Fatalf("unexpected defaults %+v", defaults)
+	}
+	changed := opts
+	changed.SQLite.Synchronous = "full"
+	if storageEqual(&opts, &changed) {
+		t.Fatal("expected changed pragmas to reopen the database")
+	}
+}
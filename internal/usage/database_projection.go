@@ -0,0 +1,269 @@
+package usage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ProjectionHorizonDays is the number of days QueryUsageProjection forecasts.
+	ProjectionHorizonDays = 30
+	// ProjectionConfidence is the coverage of the projected ranges.
+	ProjectionConfidence = 0.95
+	// projectionZ is the normal quantile matching ProjectionConfidence.
+	projectionZ = 1.96
+
+	projectionSeason = 7
+	// Smoothing constants of the level, trend and weekly season. They are fixed rather
+	// than fitted so projections stay stable from one call to the next.
+	projectionAlpha = 0.3
+	projectionBeta  = 0.05
+	projectionGamma = 0.3
+)
+
+// Projection methods, chosen by the length of the history.
+const (
+	ProjectionHoltWinters   = "holt-winters"
+	ProjectionHolt          = "holt"
+	ProjectionMovingAverage = "moving-average"
+)
+
+// ProjectedUsage is a token and cost forecast with its confidence range.
+type ProjectedUsage struct {
+	Date       string  `json:"date,omitempty"`
+	Tokens     int64   `json:"tokens"`
+	TokensLow  int64   `json:"tokens_low"`
+	TokensHigh int64   `json:"tokens_high"`
+	CostUSD    float64 `json:"cost_usd"`
+	CostLowUSD float64 `json:"cost_low_usd"`
+	// CostHighUSD is the upper end of the cost range.
+	CostHighUSD float64 `json:"cost_high_usd"`
+}
+
+// UsageProjection forecasts the daily tokens and priced cost of one provider.
+type UsageProjection struct {
+	Provider string `json:"provider"`
+	// Method is "holt-winters" (trend and weekly seasonality, from 14 days of history),
+	// "holt" (trend, from 3 days) or "moving-average".
+	Method string `json:"method"`
+	// HistoryDays is the number of complete days the model was fitted to.
+	HistoryDays int              `json:"history_days"`
+	Daily       []ProjectedUsage `json:"daily"`
+	// Next7Days and Next30Days sum the daily projections; their ranges sum the daily
+	// ranges and are therefore conservative.
+	Next7Days  ProjectedUsage `json:"next_7_days"`
+	Next30Days ProjectedUsage `json:"next_30_days"`
+}
+
+// QueryUsageProjection fits a model to the daily tokens and cost of each provider in
+// usage_daily over the complete UTC days of the last historyDays (default 56) and
+// projects the next ProjectionHorizonDays starting today. A provider's history starts
+// on its first day with traffic; later days without traffic count as zero. Cost is
+// priced with usage-db.model-prices. An empty provider selects every provider.
+func QueryUsageProjection(ctx context.Context, provider string, now time.Time, historyDays int) ([]UsageProjection, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if historyDays <= 0 {
+		historyDays = 56
+	}
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := today.AddDate(0, 0, -historyDays)
+
+	query := `
+		SELECT d.day, d.provider, COALESCE(SUM(d.total_tokens), 0),
+			COALESCE(SUM(d.prompt_tokens * p.input_per_million + d.completion_tokens * p.output_per_million), 0) / 1000000.0
+		FROM usage_daily AS d
+		LEFT JOIN usage_model_prices AS p ON p.model = LOWER(d.model)
+		WHERE d.day >= ? AND d.day < ?`
+	args := []any{from.Format("2006-01-02"), today.Format("2006-01-02")}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query += ` AND d.provider = ?`
+		args = append(args, provider)
+	}
+	rows, err := store.db.QueryContext(ctx, query+` GROUP BY d.day, d.provider;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	type point struct{ tokens, cost float64 }
+	byProvider := make(map[string]map[string]point)
+	for rows.Next() {
+		var (
+			day, name string
+			p         point
+		)
+		if err = rows.Scan(&day, &name, &p.tokens, &p.cost); err != nil {
+			return nil, err
+		}
+		if byProvider[name] == nil {
+			byProvider[name] = make(map[string]point)
+		}
+		byProvider[name][day] = p
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]UsageProjection, 0, len(byProvider))
+	for name, days := range byProvider {
+		first := today
+		for day := range days {
+			if t, errParse := time.Parse("2006-01-02", day); errParse == nil && t.Before(first) {
+				first = t
+			}
+		}
+		var tokens, cost []float64
+		for day := first; day.Before(today); day = day.AddDate(0, 0, 1) {
+			p := days[day.Format("2006-01-02")]
+			tokens = append(tokens, p.tokens)
+			cost = append(cost, p.cost)
+		}
+		tokenFit, costFit := fitSeries(tokens), fitSeries(cost)
+		projection := UsageProjection{
+			Provider:    name,
+			Method:      tokenFit.method,
+			HistoryDays: len(tokens),
+			Daily:       make([]ProjectedUsage, 0, ProjectionHorizonDays),
+		}
+		for h := 1; h <= ProjectionHorizonDays; h++ {
+			tokenMid, tokenLow, tokenHigh := tokenFit.project(h)
+			costMid, costLow, costHigh := costFit.project(h)
+			day := ProjectedUsage{
+				Date:        today.AddDate(0, 0, h-1).Format("2006-01-02"),
+				Tokens:      int64(math.Round(tokenMid)),
+				TokensLow:   int64(math.Round(tokenLow)),
+				TokensHigh:  int64(math.Round(tokenHigh)),
+				CostUSD:     costMid,
+				CostLowUSD:  costLow,
+				CostHighUSD: costHigh,
+			}
+			projection.Daily = append(projection.Daily, day)
+			if h <= 7 {
+				projection.Next7Days.add(day)
+			}
+			projection.Next30Days.add(day)
+		}
+		out = append(out, projection)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Provider < out[j].Provider })
+	return out, nil
+}
+
+func (p *ProjectedUsage) add(day ProjectedUsage) {
+	p.Tokens += day.Tokens
+	p.TokensLow += day.TokensLow
+	p.TokensHigh += day.TokensHigh
+	p.CostUSD += day.CostUSD
+	p.CostLowUSD += day.CostLowUSD
+	p.CostHighUSD += day.CostHighUSD
+}
+
+// seriesFit is a model fitted to a daily series. sigma is the root mean square of
+// its one-step-ahead errors over the history.
+type seriesFit struct {
+	method string
+	level  float64
+	trend  float64
+	season []float64
+	sigma  float64
+}
+
+// project returns the forecast h days past the history with its range, which widens
+// with the square root of h. Values are clamped at zero.
+func (f seriesFit) project(h int) (float64, float64, float64) {
+	mid := f.level + float64(h)*f.trend
+	if len(f.season) > 0 {
+		mid += f.season[(h-1)%len(f.season)]
+	}
+	spread := projectionZ * f.sigma * math.Sqrt(float64(h))
+	return math.Max(mid, 0), math.Max(mid-spread, 0), math.Max(mid+spread, 0)
+}
+
+// fitSeries picks the model by history length: additive Holt-Winters with a weekly
+// season from two weeks, Holt's linear trend from three days and a moving average of
+// the last week otherwise.
+func fitSeries(values []float64) seriesFit {
+	switch n := len(values); {
+	case n >= 2*projectionSeason:
+		return fitHoltWinters(values)
+	case n >= 3:
+		return fitHolt(values)
+	default:
+		return fitMovingAverage(values)
+	}
+}
+
+func fitMovingAverage(values []float64) seriesFit {
+	if len(values) > projectionSeason {
+		values = values[len(values)-projectionSeason:]
+	}
+	fit := seriesFit{method: ProjectionMovingAverage}
+	if len(values) == 0 {
+		return fit
+	}
+	for _, v := range values {
+		fit.level += v
+	}
+	fit.level /= float64(len(values))
+	for _, v := range values {
+		fit.sigma += (v - fit.level) * (v - fit.level)
+	}
+	fit.sigma = math.Sqrt(fit.sigma / float64(len(values)))
+	return fit
+}
+
+func fitHolt(values []float64) seriesFit {
+	level, trend := values[0], values[1]-values[0]
+	var sse float64
+	for _, y := range values[1:] {
+		err := y - (level + trend)
+		sse += err * err
+		prev := level
+		level = projectionAlpha*y + (1-projectionAlpha)*(level+trend)
+		trend = projectionBeta*(level-prev) + (1-projectionBeta)*trend
+	}
+	return seriesFit{method: ProjectionHolt, level: level, trend: trend, sigma: math.Sqrt(sse / float64(len(values)-1))}
+}
+
+func fitHoltWinters(values []float64) seriesFit {
+	m := projectionSeason
+	var first, second float64
+	for i := 0; i < m; i++ {
+		first += values[i]
+		second += values[m+i]
+	}
+	first /= float64(m)
+	second /= float64(m)
+	level, trend := first, (second-first)/float64(m)
+	season := make([]float64, len(values))
+	for i := 0; i < m; i++ {
+		season[i] = values[i] - first
+	}
+	var sse float64
+	for t := m; t < len(values); t++ {
+		y := values[t]
+		err := y - (level + trend + season[t-m])
+		sse += err * err
+		prev := level
+		level = projectionAlpha*(y-season[t-m]) + (1-projectionAlpha)*(level+trend)
+		trend = projectionBeta*(level-prev) + (1-projectionBeta)*trend
+		season[t] = projectionGamma*(y-level) + (1-projectionGamma)*season[t-m]
+	}
+	return seriesFit{
+		method: ProjectionHoltWinters,
+		level:  level,
+		trend:  trend,
+		season: season[len(values)-m:],
+		sigma:  math.Sqrt(sse / float64(len(values)-m)),
+	}
+}
@@ -0,0 +1,156 @@
+package usage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/providerspend"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// ProviderSpendStatus reports the current month's spend of one capped provider.
+type ProviderSpendStatus struct {
+	Provider   string     `json:"provider"`
+	Action     string     `json:"action"`
+	CapUSD     float64    `json:"cap_usd"`
+	SpendUSD   float64    `json:"spend_usd"`
+	Month      string     `json:"month"`
+	Exceeded   bool       `json:"exceeded"`
+	ExceededAt *time.Time `json:"exceeded_at,omitempty"`
+}
+
+// RefreshProviderSpend re-evaluates every provider spend cap against the usage
+// database, e.g. after the caps or model prices changed or at startup.
+func RefreshProviderSpend(ctx context.Context) error {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	now := time.Now().UTC()
+	for provider, limit := range providerspend.Caps() {
+		spend, err := store.providerSpend(ctx, provider, now)
+		if err != nil {
+			return err
+		}
+		store.applyProviderSpend(limit, spend, now)
+	}
+	return nil
+}
+
+// ProviderSpendCaps lists every capped provider with its spend for the current month.
+func ProviderSpendCaps(ctx context.Context) ([]ProviderSpendStatus, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	now := time.Now().UTC()
+	caps := providerspend.Caps()
+	providers := make([]string, 0, len(caps))
+	for provider := range caps {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	out := make([]ProviderSpendStatus, 0, len(providers))
+	for _, provider := range providers {
+		limit := caps[provider]
+		spend, err := store.providerSpend(ctx, provider, now)
+		if err != nil {
+			return nil, err
+		}
+		status := ProviderSpendStatus{
+			Provider: provider,
+			Action:   limit.Action,
+			CapUSD:   limit.CapUSD,
+			SpendUSD: spend,
+			Month:    now.Format("2006-01"),
+		}
+		if entry, exceeded := providerspend.Check(provider, now); exceeded {
+			at := entry.ExceededAt
+			status.Exceeded = true
+			status.ExceededAt = &at
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+// providerSpend returns the priced spend of a provider for the month containing now.
+// Daily rows already folded into usage_monthly by retention are counted from there.
+func (s *usageStore) providerSpend(ctx context.Context, provider string, now time.Time) (float64, error) {
+	month := now.UTC().Format("2006-01")
+	var spend float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(tokens.prompt * p.input_per_million + tokens.completion * p.output_per_million), 0) / 1000000.0
+		FROM (
+			SELECT model, prompt_tokens AS prompt, completion_tokens AS completion
+			FROM usage_daily WHERE provider = ? AND day BETWEEN ? AND ?
+			UNION ALL
+			SELECT model, prompt_tokens, completion_tokens
+			FROM usage_monthly WHERE provider = ? AND month = ?
+		) AS tokens
+		JOIN usage_model_prices AS p ON p.model = LOWER(tokens.model);`,
+		provider, month+"-01", month+"-31", provider, month).Scan(&spend)
+	return spend, err
+}
+
+// checkProviderSpendCap marks the provider of rec once its spend for the month
+// reaches its cap. It runs on the writer goroutine after each insert.
+func (s *usageStore) checkProviderSpendCap(rec dbRecord) {
+	limit, capped := providerspend.Caps()[strings.ToLower(rec.Provider)]
+	if !capped {
+		return
+	}
+	at := rec.Timestamp.UTC()
+	if _, exceeded := providerspend.Check(limit.Provider, at); exceeded {
+		return
+	}
+	spend, err := s.providerSpend(context.Background(), limit.Provider, at)
+	if err != nil {
+		log.WithError(err).Warn("usage: failed to compute provider spend")
+		return
+	}
+	s.applyProviderSpend(limit, spend, at)
+}
+
+// applyProviderSpend marks or clears the exceedance of a provider for the month of now.
+func (s *usageStore) applyProviderSpend(limit providerspend.Cap, spend float64, now time.Time) {
+	_, exceeded := providerspend.Check(limit.Provider, now)
+	if spend < limit.CapUSD {
+		if exceeded {
+			providerspend.Clear(limit.Provider)
+			log.Infof("usage: provider %s is back under its $%.2f monthly spend cap", limit.Provider, limit.CapUSD)
+		}
+		return
+	}
+	if exceeded {
+		return
+	}
+	providerspend.MarkExceeded(providerspend.Exceedance{
+		Cap:        limit,
+		Month:      now.UTC().Format("2006-01"),
+		SpendUSD:   spend,
+		ExceededAt: time.Now().UTC(),
+	})
+	log.Warnf("usage: provider %s reached its $%.2f monthly spend cap ($%.2f spent); action %s", limit.Provider, limit.CapUSD, spend, limit.Action)
+	events.Publish(events.Event{
+		Type:     events.BudgetCrossed,
+		Provider: limit.Provider,
+		Reason:   "monthly spend cap reached",
+		Data: map[string]any{
+			"scope":     "provider",
+			"month":     now.UTC().Format("2006-01"),
+			"spend_usd": spend,
+			"cap_usd":   limit.CapUSD,
+			"action":    limit.Action,
+		},
+	})
+}
@@ -0,0 +1,794 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/bodylimit"
+)
+
+// DailyUsageRow is a single usage_daily aggregate row.
+type DailyUsageRow struct {
+	Day              string `json:"day"`
+	Provider         string `json:"provider"`
+	CredentialLabel  string `json:"credential_label"`
+	Model            string `json:"model"`
+	TotalRequests    int64  `json:"total_requests"`
+	FailedRequests   int64  `json:"failed_requests"`
+	RateLimited      int64  `json:"rate_limited"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	// AbortedRequests counts streams the client disconnected from mid-response.
+	AbortedRequests int64 `json:"aborted_requests"`
+}
+
+// MonthlyUsageRow is a per-month aggregate combining compacted usage_monthly rows
+// with the daily rows that have not been compacted yet.
+type MonthlyUsageRow struct {
+	Month            string `json:"month"`
+	Provider         string `json:"provider"`
+	CredentialLabel  string `json:"credential_label"`
+	Model            string `json:"model"`
+	TotalRequests    int64  `json:"total_requests"`
+	FailedRequests   int64  `json:"failed_requests"`
+	RateLimited      int64  `json:"rate_limited"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	AbortedRequests  int64  `json:"aborted_requests"`
+}
+
+// DatabaseStatus describes the active usage store.
+type DatabaseStatus struct {
+	Enabled  bool   `json:"enabled"`
+	Path     string `json:"path,omitempty"`
+	ReadOnly bool   `json:"read-only"`
+	// Queue reports write queue depth and overflow counters for writable stores.
+	Queue *QueueStats `json:"queue,omitempty"`
+	// FingerprintScheme is how fingerprints in the database were made: "sha256" or
+	// "hmac-sha256:<salt id>". A pending migration means it differs from the configured salt.
+	FingerprintScheme           string `json:"fingerprint-scheme,omitempty"`
+	FingerprintMigrationPending bool   `json:"fingerprint-migration-pending,omitempty"`
+	// Maintenance reports which process sharing the file runs retention and reports.
+	Maintenance *MaintenanceStatus `json:"maintenance,omitempty"`
+}
+
+// CurrentDatabaseStatus reports whether a usage store is open and in which mode.
+func CurrentDatabaseStatus() DatabaseStatus {
+	var status DatabaseStatus
+	if opts := currentDBConfig.Load(); opts != nil {
+		status.Path = opts.Path
+	}
+	if store := currentUsageStore.Load(); store != nil {
+		status.Enabled = true
+		status.ReadOnly = store.readOnly
+		status.FingerprintScheme = store.storedFingerprintScheme()
+		status.FingerprintMigrationPending = store.fingerprintMigrationPending()
+		if !store.readOnly {
+			stats := store.queueStats()
+			status.Queue = &stats
+			maintenance := store.maintenanceStatus()
+			status.Maintenance = &maintenance
+		}
+	}
+	return status
+}
+
+// QueryDailyUsage returns usage_daily rows on or after since, optionally filtered by provider.
+func QueryDailyUsage(ctx context.Context, since time.Time, provider string) ([]DailyUsageRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := `
+		SELECT day, provider, credential_label, model, total_requests, failed_requests,
+			rate_limited, prompt_tokens, completion_tokens, total_tokens, aborted_requests
+		FROM usage_daily
+		WHERE day >= ?`
+	args := []any{since.UTC().Format("2006-01-02")}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query += ` AND LOWER(provider) = ?`
+		args = append(args, strings.ToLower(provider))
+	}
+	query += ` ORDER BY day DESC, provider ASC, model ASC;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]DailyUsageRow, 0)
+	for rows.Next() {
+		var row DailyUsageRow
+		if err := rows.Scan(&row.Day, &row.Provider, &row.CredentialLabel, &row.Model, &row.TotalRequests,
+			&row.FailedRequests, &row.RateLimited, &row.PromptTokens, &row.CompletionTokens, &row.TotalTokens,
+			&row.AbortedRequests); err != nil {
+			return nil, err
+		}
+		row.CredentialLabel = openColumn(row.CredentialLabel)
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// QueryMonthlyUsage returns per-month totals for months on or after since, optionally
+// filtered by provider. Months still covered by usage_daily are summed on the fly.
+func QueryMonthlyUsage(ctx context.Context, since time.Time, provider string) ([]MonthlyUsageRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	month := since.UTC().Format("2006-01")
+	filter := ""
+	args := []any{month}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		filter = ` AND LOWER(provider) = ?`
+		args = append(args, strings.ToLower(provider))
+	}
+	args = append(args, args...)
+	query := `
+		SELECT month, provider, MAX(credential_label), model, SUM(total_requests), SUM(failed_requests),
+			SUM(rate_limited), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(aborted_requests)
+		FROM (
+			SELECT month, provider, credential_fingerprint, credential_label, model, total_requests,
+				failed_requests, rate_limited, prompt_tokens, completion_tokens, total_tokens, aborted_requests
+			FROM usage_monthly
+			WHERE month >= ?` + filter + `
+			UNION ALL
+			SELECT substr(day, 1, 7), provider, credential_fingerprint, credential_label, model, total_requests,
+				failed_requests, rate_limited, prompt_tokens, completion_tokens, total_tokens, aborted_requests
+			FROM usage_daily
+			WHERE substr(day, 1, 7) >= ?` + filter + `
+		)
+		GROUP BY month, provider, credential_fingerprint, model
+		ORDER BY month DESC, provider ASC, model ASC;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]MonthlyUsageRow, 0)
+	for rows.Next() {
+		var row MonthlyUsageRow
+		if err := rows.Scan(&row.Month, &row.Provider, &row.CredentialLabel, &row.Model, &row.TotalRequests,
+			&row.FailedRequests, &row.RateLimited, &row.PromptTokens, &row.CompletionTokens, &row.TotalTokens,
+			&row.AbortedRequests); err != nil {
+			return nil, err
+		}
+		row.CredentialLabel = openColumn(row.CredentialLabel)
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// CredentialUsageRow totals usage_daily for one credential.
+type CredentialUsageRow struct {
+	Fingerprint     string `json:"credential_fingerprint"`
+	Provider        string `json:"provider"`
+	CredentialLabel string `json:"credential_label"`
+	AccountEmail    string `json:"account_email,omitempty"`
+	TotalRequests   int64  `json:"total_requests"`
+	FailedRequests  int64  `json:"failed_requests"`
+	RateLimited     int64  `json:"rate_limited"`
+	TotalTokens     int64  `json:"total_tokens"`
+}
+
+// QueryCredentialUsage totals usage_daily per provider and credential for days on
+// or after since, optionally filtered by provider.
+func QueryCredentialUsage(ctx context.Context, since time.Time, provider string) ([]CredentialUsageRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := `
+		SELECT credential_fingerprint, provider, MAX(credential_label), MAX(account_email),
+			SUM(total_requests), SUM(failed_requests), SUM(rate_limited), SUM(total_tokens)
+		FROM usage_daily
+		WHERE day >= ?`
+	args := []any{since.UTC().Format("2006-01-02")}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query += ` AND LOWER(provider) = ?`
+		args = append(args, strings.ToLower(provider))
+	}
+	query += ` GROUP BY provider, credential_fingerprint ORDER BY provider ASC, SUM(total_requests) DESC;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]CredentialUsageRow, 0)
+	for rows.Next() {
+		var row CredentialUsageRow
+		if err := rows.Scan(&row.Fingerprint, &row.Provider, &row.CredentialLabel, &row.AccountEmail, &row.TotalRequests,
+			&row.FailedRequests, &row.RateLimited, &row.TotalTokens); err != nil {
+			return nil, err
+		}
+		row.CredentialLabel, row.AccountEmail = openColumn(row.CredentialLabel), openColumn(row.AccountEmail)
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// CredentialFingerprint returns the credential_fingerprint stored for requests
+// served by the credential with the given auth ID.
+func CredentialFingerprint(authID string) string {
+	return fingerprint(authID)
+}
+
+// RequestUsageRow is a single usage_requests row located by its correlation ID.
+type RequestUsageRow struct {
+	Timestamp       string `json:"timestamp"`
+	RequestID       string `json:"request_id"`
+	Provider        string `json:"provider"`
+	Model           string `json:"model"`
+	RequestedModel  string `json:"requested_model,omitempty"`
+	CredentialLabel string `json:"credential_label"`
+	AuthID          string `json:"auth_id,omitempty"`
+	ClientLabel     string `json:"client_label,omitempty"`
+	StatusCode      int    `json:"status_code"`
+	Failed          bool   `json:"failed"`
+	RateLimited     bool   `json:"rate_limited"`
+	Rejection       string `json:"rejection,omitempty"`
+	ErrorClass      string `json:"error_class,omitempty"`
+	DurationMs      int64  `json:"duration_ms"`
+	TotalTokens     int64  `json:"total_tokens"`
+	// ClientIPHash, UserAgent and ClientCountry are set when client-attribution is enabled.
+	ClientIPHash  string `json:"client_ip_hash,omitempty"`
+	UserAgent     string `json:"user_agent,omitempty"`
+	ClientCountry string `json:"client_country,omitempty"`
+	// Metadata holds the attribution pairs the client sent in X-Usage-Metadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// QueryRequestUsage returns the usage_requests rows recorded for a request ID. A
+// single client request can produce several rows when it is retried across credentials.
+func QueryRequestUsage(ctx context.Context, requestID string) ([]RequestUsageRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rows, err := store.db.QueryContext(ctx, `
+		SELECT CAST(timestamp AS TEXT), request_id, COALESCE(provider, ''), COALESCE(model, ''), requested_model,
+			COALESCE(credential_label, ''), COALESCE(auth_id, ''), client_label, COALESCE(status_code, 0),
+			COALESCE(failed, 0), COALESCE(rate_limited, 0), rejection, error_class, duration_ms, COALESCE(total_tokens, 0),
+			client_ip_hash, user_agent, client_country, metadata
+		FROM usage_requests
+		WHERE request_id = ?
+		ORDER BY id ASC;`, strings.TrimSpace(requestID))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]RequestUsageRow, 0)
+	for rows.Next() {
+		var (
+			row      RequestUsageRow
+			metadata string
+		)
+		if err := rows.Scan(&row.Timestamp, &row.RequestID, &row.Provider, &row.Model, &row.RequestedModel,
+			&row.CredentialLabel, &row.AuthID, &row.ClientLabel, &row.StatusCode, &row.Failed, &row.RateLimited,
+			&row.Rejection, &row.ErrorClass, &row.DurationMs, &row.TotalTokens,
+			&row.ClientIPHash, &row.UserAgent, &row.ClientCountry, &metadata); err != nil {
+			return nil, err
+		}
+		if metadata != "" {
+			_ = json.Unmarshal([]byte(metadata), &row.Metadata)
+		}
+		row.CredentialLabel, row.ClientLabel = openColumn(row.CredentialLabel), openColumn(row.ClientLabel)
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// KeyClientRow counts the requests one client key made from one client address,
+// country and user agent.
+type KeyClientRow struct {
+	APIKeyHash     string `json:"api_key_hash"`
+	ClientIPHash   string `json:"client_ip_hash"`
+	ClientCountry  string `json:"client_country,omitempty"`
+	UserAgent      string `json:"user_agent,omitempty"`
+	Requests       int64  `json:"requests"`
+	FailedRequests int64  `json:"failed_requests"`
+	FirstSeen      string `json:"first_seen"`
+	LastSeen       string `json:"last_seen"`
+}
+
+// QueryKeyClients groups the attributed usage_requests rows at or after since by
+// client key, client address, country and user agent, optionally filtered by the
+// key's api_key_hash. Rows without attribution are skipped. A shared key shows up as
+// many distinct addresses or countries. Rows are ordered by key, then count.
+func QueryKeyClients(ctx context.Context, since time.Time, apiKeyHash string) ([]KeyClientRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := `
+		SELECT COALESCE(api_key_hash, ''), client_ip_hash, client_country, user_agent,
+			COUNT(*), SUM(COALESCE(failed, 0)), CAST(MIN(timestamp) AS TEXT), CAST(MAX(timestamp) AS TEXT)
+		FROM usage_requests
+		WHERE timestamp >= ? AND client_ip_hash <> ''`
+	args := []any{since.UTC()}
+	if apiKeyHash = strings.TrimSpace(apiKeyHash); apiKeyHash != "" {
+		query += ` AND api_key_hash = ?`
+		args = append(args, apiKeyHash)
+	}
+	query += ` GROUP BY 1, 2, 3, 4 ORDER BY 1 ASC, COUNT(*) DESC, 2 ASC;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]KeyClientRow, 0)
+	for rows.Next() {
+		var row KeyClientRow
+		if err := rows.Scan(&row.APIKeyHash, &row.ClientIPHash, &row.ClientCountry, &row.UserAgent,
+			&row.Requests, &row.FailedRequests, &row.FirstSeen, &row.LastSeen); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// KeyDailyUsageRow totals the usage_requests rows of one client key for one UTC day
+// and model.
+type KeyDailyUsageRow struct {
+	Day             string  `json:"day"`
+	Model           string  `json:"model"`
+	Requests        int64   `json:"requests"`
+	FailedRequests  int64   `json:"failed_requests"`
+	InputTokens     int64   `json:"input_tokens"`
+	OutputTokens    int64   `json:"output_tokens"`
+	ReasoningTokens int64   `json:"reasoning_tokens"`
+	CachedTokens    int64   `json:"cached_tokens"`
+	TotalTokens     int64   `json:"total_tokens"`
+	CostUSD         float64 `json:"cost_usd"`
+}
+
+// QueryKeyDailyUsage totals the usage_requests rows of the key with apiKeyHash in
+// [since, until) per day and model, pricing them with the configured model prices.
+// Only rows still within request retention are counted. Rows are ordered by day,
+// then model.
+func QueryKeyDailyUsage(ctx context.Context, apiKeyHash string, since, until time.Time) ([]KeyDailyUsageRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rows, err := store.db.QueryContext(ctx, `
+		SELECT substr(r.timestamp, 1, 10), COALESCE(r.model, ''),
+			COUNT(*), SUM(COALESCE(r.failed, 0)),
+			SUM(COALESCE(r.prompt_tokens, 0)), SUM(COALESCE(r.completion_tokens, 0)),
+			SUM(COALESCE(r.reasoning_tokens, 0)), SUM(COALESCE(r.cached_tokens, 0)),
+			SUM(COALESCE(r.total_tokens, 0)),
+			ROUND(SUM(COALESCE(r.prompt_tokens, 0) * COALESCE(p.input_per_million, 0)
+				+ COALESCE(r.completion_tokens, 0) * COALESCE(p.output_per_million, 0)) / 1000000.0, 6)
+		FROM usage_requests AS r
+		LEFT JOIN usage_model_prices AS p ON p.model = LOWER(r.model)
+		WHERE r.api_key_hash = ? AND r.timestamp >= ? AND r.timestamp < ?
+		GROUP BY 1, 2
+		ORDER BY 1 ASC, 2 ASC;`, apiKeyHash, since.UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]KeyDailyUsageRow, 0)
+	for rows.Next() {
+		var row KeyDailyUsageRow
+		if err := rows.Scan(&row.Day, &row.Model, &row.Requests, &row.FailedRequests, &row.InputTokens,
+			&row.OutputTokens, &row.ReasoningTokens, &row.CachedTokens, &row.TotalTokens, &row.CostUSD); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// unclassifiedErrorClass labels failed rows recorded before error classes were captured.
+const unclassifiedErrorClass = "unclassified"
+
+// ErrorBreakdownRow counts the failed upstream requests of one provider and model
+// that share an error class.
+type ErrorBreakdownRow struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	ErrorClass string `json:"error_class"`
+	Requests   int64  `json:"requests"`
+	// Credentials is the number of distinct credentials that hit the error.
+	Credentials int64  `json:"credentials"`
+	LastSeen    string `json:"last_seen"`
+}
+
+// QueryErrorBreakdown groups the failed usage_requests rows at or after since by
+// provider, model and error class, optionally filtered by provider. Requests the
+// proxy refused before routing them are excluded. Rows are ordered by count, largest
+// first.
+func QueryErrorBreakdown(ctx context.Context, since time.Time, provider string) ([]ErrorBreakdownRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := `
+		SELECT COALESCE(provider, ''), COALESCE(model, ''), COALESCE(NULLIF(error_class, ''), ?),
+			COUNT(*), COUNT(DISTINCT credential_fingerprint), CAST(MAX(timestamp) AS TEXT)
+		FROM usage_requests
+		WHERE timestamp >= ? AND COALESCE(failed, 0) = 1 AND rejection = '' AND COALESCE(policy_denied, 0) = 0`
+	args := []any{unclassifiedErrorClass, since.UTC()}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query += ` AND LOWER(provider) = ?`
+		args = append(args, strings.ToLower(provider))
+	}
+	query += ` GROUP BY 1, 2, 3 ORDER BY COUNT(*) DESC, 1 ASC, 2 ASC, 3 ASC;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]ErrorBreakdownRow, 0)
+	for rows.Next() {
+		var row ErrorBreakdownRow
+		if err := rows.Scan(&row.Provider, &row.Model, &row.ErrorClass, &row.Requests, &row.Credentials, &row.LastSeen); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// ToolUsageRow summarises tool use and media inputs of one provider and model on one UTC day.
+type ToolUsageRow struct {
+	Day      string `json:"day"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Requests int64  `json:"requests"`
+	// ToolRequests counts requests that made a tool call or carried a tool result.
+	ToolRequests     int64 `json:"tool_requests"`
+	ToolCalls        int64 `json:"tool_calls"`
+	ToolResultTokens int64 `json:"tool_result_tokens"`
+	// ImageRequests counts requests with at least one image input.
+	ImageRequests  int64 `json:"image_requests"`
+	ImageInputs    int64 `json:"image_inputs"`
+	DocumentInputs int64 `json:"document_inputs"`
+	// MediaBytes is the decoded size of inline images and documents.
+	MediaBytes int64 `json:"media_bytes"`
+	// MediaRejections counts requests refused by the media size limits.
+	MediaRejections int64 `json:"media_rejections"`
+}
+
+// QueryToolUsage returns per-day tool call, tool result and media input counts from
+// since onwards, optionally filtered by provider, ordered by day then provider and model.
+func QueryToolUsage(ctx context.Context, since time.Time, provider string) ([]ToolUsageRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := `
+		SELECT substr(timestamp, 1, 10) AS day, COALESCE(provider, ''), COALESCE(model, ''),
+			COUNT(*),
+			SUM(CASE WHEN tool_calls > 0 OR tool_result_tokens > 0 THEN 1 ELSE 0 END),
+			SUM(tool_calls), SUM(tool_result_tokens),
+			SUM(CASE WHEN image_inputs > 0 THEN 1 ELSE 0 END),
+			SUM(image_inputs), SUM(document_inputs), SUM(media_bytes),
+			SUM(CASE WHEN rejection = ? THEN 1 ELSE 0 END)
+		FROM usage_requests
+		WHERE timestamp >= ?`
+	args := []any{bodylimit.RejectionMediaTooLarge, since.UTC()}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query += ` AND LOWER(provider) = ?`
+		args = append(args, strings.ToLower(provider))
+	}
+	query += ` GROUP BY day, provider, model ORDER BY day ASC, provider ASC, model ASC;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]ToolUsageRow, 0)
+	for rows.Next() {
+		var row ToolUsageRow
+		if err := rows.Scan(&row.Day, &row.Provider, &row.Model, &row.Requests, &row.ToolRequests,
+			&row.ToolCalls, &row.ToolResultTokens, &row.ImageRequests, &row.ImageInputs,
+			&row.DocumentInputs, &row.MediaBytes, &row.MediaRejections); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// ReasoningBudgetRow summarises reasoning budget enforcement for one client key and
+// model on one UTC day.
+type ReasoningBudgetRow struct {
+	Day        string `json:"day"`
+	APIKeyHash string `json:"api_key_hash"`
+	Model      string `json:"model"`
+	Requests   int64  `json:"requests"`
+	// ReasoningTokens and MaxReasoningTokens are the sum and the largest reported
+	// reasoning tokens of the requests.
+	ReasoningTokens    int64 `json:"reasoning_tokens"`
+	MaxReasoningTokens int64 `json:"max_reasoning_tokens"`
+	Clamped            int64 `json:"clamped"`
+	Rejected           int64 `json:"rejected"`
+	Flagged            int64 `json:"flagged"`
+	// Exceeded counts responses reporting more reasoning tokens than the budget.
+	Exceeded int64 `json:"exceeded"`
+}
+
+// QueryReasoningBudgets returns per-day reasoning budget outcomes from since onwards
+// for the client keys and models with at least one clamped, rejected, flagged or
+// exceeded request, optionally filtered by provider, ordered by day, key and model.
+func QueryReasoningBudgets(ctx context.Context, since time.Time, provider string) ([]ReasoningBudgetRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := `
+		SELECT substr(timestamp, 1, 10) AS day, COALESCE(api_key_hash, ''), COALESCE(model, ''),
+			COUNT(*), SUM(COALESCE(reasoning_tokens, 0)), MAX(COALESCE(reasoning_tokens, 0)),
+			SUM(CASE WHEN reasoning_budget = 'clamped' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN reasoning_budget = 'rejected' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN reasoning_budget = 'flagged' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN reasoning_budget = 'exceeded' THEN 1 ELSE 0 END)
+		FROM usage_requests
+		WHERE timestamp >= ?`
+	args := []any{since.UTC()}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query += ` AND LOWER(provider) = ?`
+		args = append(args, strings.ToLower(provider))
+	}
+	query += ` GROUP BY day, api_key_hash, model HAVING SUM(reasoning_budget <> '') > 0
+		ORDER BY day ASC, api_key_hash ASC, model ASC;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]ReasoningBudgetRow, 0)
+	for rows.Next() {
+		var row ReasoningBudgetRow
+		if err := rows.Scan(&row.Day, &row.APIKeyHash, &row.Model, &row.Requests, &row.ReasoningTokens,
+			&row.MaxReasoningTokens, &row.Clamped, &row.Rejected, &row.Flagged, &row.Exceeded); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// CacheReportRow summarises prompt-cache use of one provider and model on one UTC day.
+type CacheReportRow struct {
+	Day      string `json:"day"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Requests int64  `json:"requests"`
+	// CacheHitRequests counts requests that read at least one token from the cache.
+	CacheHitRequests int64 `json:"cache_hit_requests"`
+	// PromptTokens includes the cached tokens, whichever way the provider reports them.
+	PromptTokens int64 `json:"prompt_tokens"`
+	CachedTokens int64 `json:"cached_tokens"`
+	// CacheCreationTokens counts prompt tokens written to the cache.
+	CacheCreationTokens int64 `json:"cache_creation_tokens"`
+	// HitRatio is CachedTokens / PromptTokens.
+	HitRatio float64 `json:"hit_ratio"`
+	// SavingsUSD estimates what the cached tokens would have cost at the full input
+	// price, minus their cached price and the premium paid for cache writes, using
+	// usage-db model-prices.
+	SavingsUSD float64 `json:"savings_usd"`
+	// UnpricedRequests counts requests whose model has no configured price.
+	UnpricedRequests int64 `json:"unpriced_requests"`
+}
+
+// QueryCacheReport returns per-day prompt-cache statistics of successful requests
+// from since onwards, optionally filtered by provider, ordered by day then provider
+// and model.
+func QueryCacheReport(ctx context.Context, since time.Time, provider string) ([]CacheReportRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	query := `
+		SELECT day, provider, model, requests, cache_hit_requests, prompt_tokens, cached_tokens,
+			cache_creation_tokens, savings_usd, unpriced_requests
+		FROM v_cache_by_model_day
+		WHERE day >= ?`
+	args := []any{since.UTC().Format("2006-01-02")}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query += ` AND LOWER(provider) = ?`
+		args = append(args, strings.ToLower(provider))
+	}
+	query += ` ORDER BY day ASC, provider ASC, model ASC;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]CacheReportRow, 0)
+	for rows.Next() {
+		var row CacheReportRow
+		if err := rows.Scan(&row.Day, &row.Provider, &row.Model, &row.Requests, &row.CacheHitRequests,
+			&row.PromptTokens, &row.CachedTokens, &row.CacheCreationTokens, &row.SavingsUSD, &row.UnpricedRequests); err != nil {
+			return nil, err
+		}
+		if row.PromptTokens > 0 {
+			row.HitRatio = float64(row.CachedTokens) / float64(row.PromptTokens)
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// HeatmapCell totals the requests starting in one hour of one weekday.
+type HeatmapCell struct {
+	// Weekday is 0 for Sunday through 6 for Saturday.
+	Weekday  int   `json:"weekday"`
+	Hour     int   `json:"hour"`
+	Requests int64 `json:"requests"`
+	Tokens   int64 `json:"tokens"`
+}
+
+// UsageHeatmap is the hour-of-day by day-of-week distribution of usage.
+type UsageHeatmap struct {
+	// Cells holds all 168 cells ordered by weekday, then hour.
+	Cells    []HeatmapCell `json:"cells"`
+	Requests int64         `json:"requests"`
+	Tokens   int64         `json:"tokens"`
+}
+
+// QueryUsageHeatmap totals the usage_requests rows in [since, until), optionally
+// filtered by provider, per weekday and hour of day in loc. Rows are bucketed by
+// their UTC hour before conversion, so zones with a fractional-hour offset are
+// approximated to the hour. Only rows still within request retention are counted.
+func QueryUsageHeatmap(ctx context.Context, since, until time.Time, provider string, loc *time.Location) (UsageHeatmap, error) {
+	heatmap := UsageHeatmap{Cells: make([]HeatmapCell, 7*24)}
+	for i := range heatmap.Cells {
+		heatmap.Cells[i] = HeatmapCell{Weekday: i / 24, Hour: i % 24}
+	}
+	store := currentUsageStore.Load()
+	if store == nil {
+		return heatmap, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	query := `
+		SELECT substr(timestamp, 1, 13), COUNT(*), SUM(COALESCE(total_tokens, 0))
+		FROM usage_requests
+		WHERE timestamp >= ? AND timestamp < ?`
+	args := []any{since.UTC(), until.UTC()}
+	if provider = strings.TrimSpace(provider); provider != "" {
+		query += ` AND LOWER(provider) = ?`
+		args = append(args, strings.ToLower(provider))
+	}
+	query += ` GROUP BY 1;`
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return heatmap, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var (
+			bucket           string
+			requests, tokens int64
+		)
+		if err := rows.Scan(&bucket, &requests, &tokens); err != nil {
+			return heatmap, err
+		}
+		hour, errParse := time.Parse("2006-01-02 15", strings.Replace(bucket, "T", " ", 1))
+		if errParse != nil {
+			continue
+		}
+		local := hour.In(loc)
+		cell := &heatmap.Cells[int(local.Weekday())*24+local.Hour()]
+		cell.Requests += requests
+		cell.Tokens += tokens
+		heatmap.Requests += requests
+		heatmap.Tokens += tokens
+	}
+	return heatmap, rows.Err()
+}
+
+// TeamUsageRow totals the requests of one team's client keys.
+type TeamUsageRow struct {
+	Team           string `json:"team"`
+	Keys           int64  `json:"distinct_keys"`
+	TotalRequests  int64  `json:"total_requests"`
+	FailedRequests int64  `json:"failed_requests"`
+	InputTokens    int64  `json:"input_tokens"`
+	OutputTokens   int64  `json:"output_tokens"`
+	TotalTokens    int64  `json:"total_tokens"`
+	// CostUSD prices the tokens with usage-db model-prices.
+	CostUSD float64 `json:"cost_usd"`
+	// UnpricedRequests counts requests whose model has no configured price.
+	UnpricedRequests int64 `json:"unpriced_requests"`
+}
+
+// QueryTeamUsage totals usage_requests per team from since onwards, busiest team
+// first. Requests of keys outside any team are not reported.
+func QueryTeamUsage(ctx context.Context, since time.Time) ([]TeamUsageRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rows, err := store.db.QueryContext(ctx, `
+		SELECT r.team, COUNT(DISTINCT r.api_key_hash), COUNT(*), SUM(r.failed),
+			SUM(COALESCE(r.prompt_tokens, 0)), SUM(COALESCE(r.completion_tokens, 0)), SUM(COALESCE(r.total_tokens, 0)),
+			COALESCE(SUM(COALESCE(r.prompt_tokens, 0) * p.input_per_million
+				+ COALESCE(r.completion_tokens, 0) * p.output_per_million), 0) / 1000000.0,
+			SUM(CASE WHEN p.model IS NULL THEN 1 ELSE 0 END)
+		FROM usage_requests AS r
+		LEFT JOIN usage_model_prices AS p ON p.model = LOWER(r.model)
+		WHERE r.team <> '' AND r.timestamp >= ?
+		GROUP BY r.team
+		ORDER BY COUNT(*) DESC, r.team ASC;`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]TeamUsageRow, 0)
+	for rows.Next() {
+		var row TeamUsageRow
+		if err := rows.Scan(&row.Team, &row.Keys, &row.TotalRequests, &row.FailedRequests, &row.InputTokens,
+			&row.OutputTokens, &row.TotalTokens, &row.CostUSD, &row.UnpricedRequests); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
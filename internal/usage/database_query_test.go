@@ -0,0 +1,528 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/shadow"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+func TestQueryCredentialUsage(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	busy, idle := CredentialFingerprint("auth-busy"), CredentialFingerprint("auth-idle")
+	for _, rec := range []dbRecord{
+		{Timestamp: now, Provider: "claude", Model: "a", CredentialLabel: "auth-busy", CredentialFingerprint: busy, Tokens: TokenStats{TotalTokens: 5}},
+		{Timestamp: now, Provider: "claude", Model: "b", CredentialLabel: "auth-busy", CredentialFingerprint: busy, Failed: true, RateLimited: true},
+		{Timestamp: now, Provider: "claude", Model: "a", CredentialLabel: "auth-idle", CredentialFingerprint: idle},
+		{Timestamp: now, Provider: "gemini", Model: "a", CredentialLabel: "g", CredentialFingerprint: CredentialFingerprint("g")},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryCredentialUsage(context.Background(), now.Add(-24*time.Hour), "Claude")
+	if err != nil {
+		t.Fatalf("QueryCredentialUsage failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected two claude credentials, got %+v", rows)
+	}
+	if got := rows[0]; got.Fingerprint != busy || got.TotalRequests != 2 || got.FailedRequests != 1 || got.RateLimited != 1 || got.TotalTokens != 5 {
+		t.Fatalf("unexpected busiest credential row: %+v", got)
+	}
+	if rows[1].Fingerprint != idle || rows[1].TotalRequests != 1 {
+		t.Fatalf("unexpected second credential row: %+v", rows[1])
+	}
+}
+
+func TestQueryRequestUsage(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	for _, rec := range []dbRecord{
+		{Timestamp: now, RequestID: "req-1", Provider: "claude", Model: "a", AuthID: "first", StatusCode: 429, Failed: true, RateLimited: true},
+		{Timestamp: now, RequestID: "req-1", Provider: "claude", Model: "a", AuthID: "second", StatusCode: 200, DurationMs: 40, Metadata: `{"team":"search"}`},
+		{Timestamp: now, RequestID: "req-2", Provider: "claude", Model: "a", AuthID: "first", StatusCode: 200},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryRequestUsage(context.Background(), "req-1")
+	if err != nil {
+		t.Fatalf("QueryRequestUsage failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].AuthID != "first" || !rows[0].RateLimited || rows[1].AuthID != "second" || rows[1].DurationMs != 40 {
+		t.Fatalf("unexpected attempts for req-1: %+v", rows)
+	}
+	if rows[0].Metadata != nil || rows[1].Metadata["team"] != "search" {
+		t.Fatalf("unexpected metadata for req-1: %+v", rows)
+	}
+	if rows, err = QueryRequestUsage(context.Background(), "missing"); err != nil || len(rows) != 0 {
+		t.Fatalf("expected no rows for unknown id, got %+v (err=%v)", rows, err)
+	}
+}
+
+func TestQueryErrorBreakdown(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	for _, rec := range []dbRecord{
+		{Timestamp: now, Provider: "claude", Model: "a", CredentialFingerprint: "one", Failed: true, ErrorClass: "quota"},
+		{Timestamp: now, Provider: "claude", Model: "a", CredentialFingerprint: "two", Failed: true, ErrorClass: "quota"},
+		{Timestamp: now, Provider: "claude", Model: "a", CredentialFingerprint: "one", Failed: true, ErrorClass: "timeout"},
+		{Timestamp: now, Provider: "claude", Model: "a", CredentialFingerprint: "one", Failed: true},
+		{Timestamp: now, Provider: "claude", Model: "a", CredentialFingerprint: "one", Failed: true, Rejection: "ip_denied"},
+		{Timestamp: now, Provider: "claude", Model: "a", CredentialFingerprint: "one"},
+		{Timestamp: now, Provider: "gemini", Model: "b", CredentialFingerprint: "three", Failed: true, ErrorClass: "5xx"},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryErrorBreakdown(context.Background(), now.Add(-time.Hour), "claude")
+	if err != nil {
+		t.Fatalf("QueryErrorBreakdown failed: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected three claude error classes, got %+v", rows)
+	}
+	if got := rows[0]; got.ErrorClass != "quota" || got.Requests != 2 || got.Credentials != 2 {
+		t.Fatalf("unexpected top error class: %+v", got)
+	}
+	if rows[1].ErrorClass != "timeout" || rows[2].ErrorClass != unclassifiedErrorClass {
+		t.Fatalf("unexpected remaining classes: %+v", rows[1:])
+	}
+}
+
+func TestQueryKeyClients(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	home, office := fingerprint("198.51.100.7"), fingerprint("203.0.113.9")
+	for _, rec := range []dbRecord{
+		{Timestamp: now, RequestID: "r1", APIKeyHash: "shared", ClientIPHash: home, UserAgent: "curl/8", ClientCountry: "DE"},
+		{Timestamp: now, RequestID: "r2", APIKeyHash: "shared", ClientIPHash: home, UserAgent: "curl/8", ClientCountry: "DE", Failed: true},
+		{Timestamp: now, RequestID: "r3", APIKeyHash: "shared", ClientIPHash: office, UserAgent: "sdk/1", ClientCountry: "US"},
+		{Timestamp: now, RequestID: "r4", APIKeyHash: "other", ClientIPHash: office, UserAgent: "sdk/1"},
+		{Timestamp: now, RequestID: "r5", APIKeyHash: "shared"},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryKeyClients(context.Background(), now.Add(-time.Hour), "shared")
+	if err != nil {
+		t.Fatalf("QueryKeyClients failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected two attributed clients for the shared key, got %+v", rows)
+	}
+	if got := rows[0]; got.ClientIPHash != home || got.ClientCountry != "DE" || got.UserAgent != "curl/8" || got.Requests != 2 || got.FailedRequests != 1 {
+		t.Fatalf("unexpected busiest client row: %+v", got)
+	}
+	if got := rows[1]; got.ClientIPHash != office || got.ClientCountry != "US" || got.Requests != 1 {
+		t.Fatalf("unexpected second client row: %+v", got)
+	}
+	if rows, err = QueryKeyClients(context.Background(), now.Add(-time.Hour), ""); err != nil || len(rows) != 3 {
+		t.Fatalf("expected three rows across keys, got %+v (err=%v)", rows, err)
+	}
+
+	attempts, err := QueryRequestUsage(context.Background(), "r3")
+	if err != nil || len(attempts) != 1 || attempts[0].ClientIPHash != office || attempts[0].UserAgent != "sdk/1" || attempts[0].ClientCountry != "US" {
+		t.Fatalf("expected attribution on request lookup, got %+v (err=%v)", attempts, err)
+	}
+}
+
+func TestQueryTeamUsage(t *testing.T) {
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{
+		Enabled:     true,
+		Path:        filepath.Join(t.TempDir(), "usage.db"),
+		ModelPrices: map[string]ModelPrice{"gpt-x": {InputPerMillion: 10, OutputPerMillion: 30}},
+	}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	for _, rec := range []dbRecord{
+		{Timestamp: now, RequestID: "r1", Model: "gpt-x", APIKeyHash: "a", Team: "research", Tokens: TokenStats{InputTokens: 100000, OutputTokens: 10000, TotalTokens: 110000}},
+		{Timestamp: now, RequestID: "r2", Model: "gpt-x", APIKeyHash: "b", Team: "research", Failed: true},
+		{Timestamp: now, RequestID: "r3", Model: "other", APIKeyHash: "b", Team: "research", Tokens: TokenStats{InputTokens: 10, TotalTokens: 10}},
+		{Timestamp: now, RequestID: "r4", Model: "gpt-x", APIKeyHash: "c", Team: "ops"},
+		{Timestamp: now, RequestID: "r5", Model: "gpt-x", APIKeyHash: "d"},
+		{Timestamp: now.Add(-48 * time.Hour), RequestID: "r6", Model: "gpt-x", APIKeyHash: "c", Team: "ops"},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryTeamUsage(context.Background(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("QueryTeamUsage failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected two teams, got %+v", rows)
+	}
+	// 100k input tokens at $10/M and 10k output tokens at $30/M cost $1.30.
+	got := rows[0]
+	if got.Team != "research" || got.Keys != 2 || got.TotalRequests != 3 || got.FailedRequests != 1 ||
+		got.InputTokens != 100010 || got.TotalTokens != 110010 || math.Abs(got.CostUSD-1.3) > 1e-9 || got.UnpricedRequests != 1 {
+		t.Fatalf("unexpected research row: %+v", got)
+	}
+	if got = rows[1]; got.Team != "ops" || got.TotalRequests != 1 || got.Keys != 1 {
+		t.Fatalf("unexpected ops row: %+v", got)
+	}
+}
+
+func TestQueryKeyDailyUsage(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{
+		Enabled:     true,
+		Path:        filepath.Join(t.TempDir(), "usage.db"),
+		ModelPrices: map[string]ModelPrice{"gpt-4o": {InputPerMillion: 2, OutputPerMillion: 10}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour).Add(time.Hour)
+	yesterday := today.Add(-24 * time.Hour)
+	for _, rec := range []dbRecord{
+		{Timestamp: today, Model: "gpt-4o", APIKeyHash: "mine", Tokens: TokenStats{InputTokens: 1000, OutputTokens: 100, TotalTokens: 1100}},
+		{Timestamp: today, Model: "gpt-4o", APIKeyHash: "mine", Failed: true},
+		{Timestamp: yesterday, Model: "claude-sonnet", APIKeyHash: "mine", Tokens: TokenStats{InputTokens: 5, TotalTokens: 5}},
+		{Timestamp: today, Model: "gpt-4o", APIKeyHash: "theirs", Tokens: TokenStats{InputTokens: 7, TotalTokens: 7}},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryKeyDailyUsage(context.Background(), "mine", yesterday.Add(-time.Hour), today.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("QueryKeyDailyUsage failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected one row per day and model of the key, got %+v", rows)
+	}
+	if got := rows[0]; got.Day != yesterday.Format("2006-01-02") || got.Model != "claude-sonnet" || got.InputTokens != 5 || got.CostUSD != 0 {
+		t.Fatalf("unexpected first row: %+v", got)
+	}
+	if got := rows[1]; got.Requests != 2 || got.FailedRequests != 1 || got.InputTokens != 1000 || got.OutputTokens != 100 || got.CostUSD != 0.003 {
+		t.Fatalf("unexpected second row: %+v", got)
+	}
+}
+
+func TestQueryCacheReport(t *testing.T) {
+	opts := DatabaseOptions{
+		Enabled: true,
+		Path:    filepath.Join(t.TempDir(), "usage.db"),
+		ModelPrices: map[string]ModelPrice{
+			"gpt-x":    {InputPerMillion: 10, OutputPerMillion: 30, CachedInputPerMillion: 2.5},
+			"claude-x": {InputPerMillion: 3, OutputPerMillion: 15},
+		},
+	}
+	store, err := newUsageStore(normalizeDatabaseOptions(opts))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	for _, rec := range []dbRecord{
+		{Timestamp: now, Provider: "openai", Model: "gpt-x", Tokens: TokenStats{InputTokens: 1000, CachedTokens: 800}},
+		{Timestamp: now, Provider: "openai", Model: "gpt-x", Tokens: TokenStats{InputTokens: 1000}},
+		{Timestamp: now, Provider: "openai", Model: "gpt-x", Failed: true, Tokens: TokenStats{InputTokens: 1000, CachedTokens: 1000}},
+		// Claude reports cache reads outside input_tokens.
+		{Timestamp: now, Provider: "claude", Model: "claude-x", Tokens: TokenStats{InputTokens: 100, CachedTokens: 900}},
+		// Cache writes are recorded apart from reads and cost a 25% premium.
+		{Timestamp: now, Provider: "claude", Model: "claude-x", Tokens: TokenStats{InputTokens: 100, CacheCreationTokens: 900}},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryCacheReport(context.Background(), now.Add(-time.Hour), "")
+	if err != nil {
+		t.Fatalf("QueryCacheReport failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected two provider/model rows, got %+v", rows)
+	}
+	claude, openai := rows[0], rows[1]
+	if claude.PromptTokens != 2000 || claude.CachedTokens != 900 || claude.CacheCreationTokens != 900 || claude.HitRatio != 0.45 {
+		t.Fatalf("unexpected claude row: %+v", claude)
+	}
+	// No cached-input price: cached tokens are assumed to cost 10% of 3 USD/M, and
+	// the write premium is 25% of 3 USD/M.
+	if math.Abs(claude.SavingsUSD-0.001755) > 1e-9 {
+		t.Fatalf("claude savings = %v, want 0.001755", claude.SavingsUSD)
+	}
+	if openai.Requests != 2 || openai.CacheHitRequests != 1 || openai.PromptTokens != 2000 || openai.HitRatio != 0.4 {
+		t.Fatalf("unexpected openai row: %+v", openai)
+	}
+	if math.Abs(openai.SavingsUSD-0.006) > 1e-9 {
+		t.Fatalf("openai savings = %v, want 0.006", openai.SavingsUSD)
+	}
+}
+
+func TestShadowComparisons(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	now := time.Now().UTC()
+	for i, shadowLatency := range []time.Duration{300 * time.Millisecond, 500 * time.Millisecond, 0} {
+		c := shadow.Comparison{
+			Rule:      "ab",
+			RequestID: fmt.Sprintf("r%d", i),
+			APIKey:    "client-key",
+			Timestamp: now.Add(time.Duration(i) * time.Second),
+			Primary:   shadow.Result{Model: "gpt-4o", StatusCode: 200, Latency: time.Second, OutputTokens: 100, Response: "primary"},
+			Shadow:    shadow.Result{Model: "claude-sonnet-4", StatusCode: 200, Latency: shadowLatency, OutputTokens: 80, Response: "shadow"},
+		}
+		if shadowLatency == 0 {
+			c.Shadow = shadow.Result{Model: "claude-sonnet-4", StatusCode: 429, Error: "rate limited"}
+		}
+		RecordShadowComparison(context.Background(), c)
+	}
+
+	summary, err := QueryShadowSummary(context.Background(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("QueryShadowSummary failed: %v", err)
+	}
+	if len(summary) != 1 {
+		t.Fatalf("expected one summary row, got %+v", summary)
+	}
+	if got := summary[0]; got.Comparisons != 3 || got.ShadowErrors != 1 || got.PrimaryErrors != 0 ||
+		got.AvgLatencyDeltaMs != -600 || got.AvgOutputTokenDelta != -20 {
+		t.Fatalf("unexpected summary: %+v", got)
+	}
+
+	rows, err := QueryShadowComparisons(context.Background(), now.Add(-time.Hour), "ab", 2, false)
+	if err != nil {
+		t.Fatalf("QueryShadowComparisons failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].RequestID != "r2" || rows[0].Shadow.Error != "rate limited" || rows[1].Primary.Response != "" {
+		t.Fatalf("unexpected comparisons: %+v", rows)
+	}
+	if rows[1].APIKeyHash != fingerprint("client-key") || rows[1].LatencyDeltaMs != -500 {
+		t.Fatalf("unexpected comparison row: %+v", rows[1])
+	}
+	rows, err = QueryShadowComparisons(context.Background(), now.Add(-time.Hour), "", 0, true)
+	if err != nil || len(rows) != 3 || rows[2].Primary.Response != "primary" || rows[2].Shadow.Response != "shadow" {
+		t.Fatalf("expected responses to be loaded on request, got %+v (%v)", rows, err)
+	}
+}
+
+func TestAuthEvents(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	now := time.Now().UTC()
+	RecordAuthEvent(events.Event{Type: events.CredentialRefreshFailed, Provider: "claude", AuthID: "a", Reason: "invalid_grant", Time: now.Add(-time.Minute),
+		Data: map[string]any{"duration_ms": int64(120), "consecutive_failures": 2, "retry_at": "2026-01-01T00:10:00Z"}})
+	RecordAuthEvent(events.Event{Type: events.CredentialRefreshed, Provider: "claude", AuthID: "a", Time: now,
+		Data: map[string]any{"duration_ms": int64(80), "expires_at": "2026-01-01T08:00:00Z"}})
+	RecordAuthEvent(events.Event{Type: events.CredentialRefreshed, Provider: "codex", AuthID: "b", Time: now})
+
+	rows, err := QueryAuthEvents(context.Background(), now.Add(-time.Hour), "a", 0, 0)
+	if err != nil {
+		t.Fatalf("QueryAuthEvents failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Type != string(events.CredentialRefreshed) || rows[0].ExpiresAt != "2026-01-01T08:00:00Z" ||
+		rows[1].Reason != "invalid_grant" || rows[1].ConsecutiveFailures != 2 || rows[1].DurationMs != 120 {
+		t.Fatalf("unexpected auth events: %+v", rows)
+	}
+	if rows, _ = QueryAuthEvents(context.Background(), now.Add(-time.Hour), "", 1, 0); len(rows) != 1 {
+		t.Fatalf("expected the limit to apply, got %+v", rows)
+	}
+	rows, err = QueryAuthEvents(context.Background(), now.Add(-time.Hour), "", 2, rows[0].ID)
+	if err != nil || len(rows) != 2 || rows[0].AuthID != "a" || rows[1].Reason != "invalid_grant" {
+		t.Fatalf("expected the next page after the newest event, got %+v (%v)", rows, err)
+	}
+}
+
+func TestQueryToolUsage(t *testing.T) {
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{
+		Enabled: true,
+		Path:    filepath.Join(t.TempDir(), "usage.db"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	for _, rec := range []dbRecord{
+		{Timestamp: now, Provider: "claude", Model: "claude-x", Tokens: TokenStats{InputTokens: 10, ToolCalls: 2}},
+		{Timestamp: now, Provider: "claude", Model: "claude-x", Tokens: TokenStats{InputTokens: 10, ToolResultTokens: 300, ImageInputs: 1}},
+		{Timestamp: now, Provider: "claude", Model: "claude-x", Tokens: TokenStats{InputTokens: 10}},
+		{Timestamp: now, Provider: "openai", Model: "gpt-x", Tokens: TokenStats{InputTokens: 10, ImageInputs: 3}},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryToolUsage(context.Background(), now.Add(-time.Hour), "")
+	if err != nil {
+		t.Fatalf("QueryToolUsage failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected two provider/model rows, got %+v", rows)
+	}
+	claude, openai := rows[0], rows[1]
+	if claude.Requests != 3 || claude.ToolRequests != 2 || claude.ToolCalls != 2 || claude.ToolResultTokens != 300 ||
+		claude.ImageRequests != 1 || claude.ImageInputs != 1 {
+		t.Fatalf("unexpected claude row: %+v", claude)
+	}
+	if openai.Requests != 1 || openai.ToolRequests != 0 || openai.ImageRequests != 1 || openai.ImageInputs != 3 {
+		t.Fatalf("unexpected openai row: %+v", openai)
+	}
+	if rows, _ = QueryToolUsage(context.Background(), now.Add(-time.Hour), "OpenAI"); len(rows) != 1 {
+		t.Fatalf("expected the provider filter to apply, got %+v", rows)
+	}
+}
+
+func TestQueryReasoningBudgets(t *testing.T) {
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{
+		Enabled: true,
+		Path:    filepath.Join(t.TempDir(), "usage.db"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	for _, rec := range []dbRecord{
+		{Timestamp: now, Provider: "claude", Model: "claude-x", APIKeyHash: "k1", Tokens: TokenStats{ReasoningTokens: 900}, ReasoningBudget: "clamped"},
+		{Timestamp: now, Provider: "claude", Model: "claude-x", APIKeyHash: "k1", Tokens: TokenStats{ReasoningTokens: 3000}, ReasoningBudget: "exceeded"},
+		{Timestamp: now, Provider: "claude", Model: "claude-x", APIKeyHash: "k1", Failed: true, Rejection: "reasoning_budget_exceeded", ReasoningBudget: "rejected"},
+		{Timestamp: now, Provider: "claude", Model: "claude-x", APIKeyHash: "k1", Tokens: TokenStats{ReasoningTokens: 100}},
+		{Timestamp: now, Provider: "openai", Model: "gpt-x", APIKeyHash: "k2", Tokens: TokenStats{ReasoningTokens: 5000}},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryReasoningBudgets(context.Background(), now.Add(-time.Hour), "")
+	if err != nil {
+		t.Fatalf("QueryReasoningBudgets failed: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected only the key with budget outcomes, got %+v", rows)
+	}
+	row := rows[0]
+	if row.APIKeyHash != "k1" || row.Requests != 4 || row.ReasoningTokens != 4000 || row.MaxReasoningTokens != 3000 ||
+		row.Clamped != 1 || row.Rejected != 1 || row.Exceeded != 1 || row.Flagged != 0 {
+		t.Fatalf("unexpected row: %+v", row)
+	}
+	if rows, _ = QueryReasoningBudgets(context.Background(), now.Add(-time.Hour), "openai"); len(rows) != 0 {
+		t.Fatalf("expected the provider filter to apply, got %+v", rows)
+	}
+}
+
+func TestQueryUsageHeatmap(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	// 2026-05-04 is a Monday.
+	monday := time.Date(2026, 5, 4, 23, 15, 0, 0, time.UTC)
+	for _, rec := range []dbRecord{
+		{Timestamp: monday, Provider: "claude", Model: "m", Tokens: TokenStats{TotalTokens: 100}},
+		{Timestamp: monday.Add(30 * time.Minute), Provider: "claude", Model: "m", Tokens: TokenStats{TotalTokens: 50}},
+		{Timestamp: monday.AddDate(0, 0, 7), Provider: "claude", Model: "m", Tokens: TokenStats{TotalTokens: 10}},
+		{Timestamp: monday, Provider: "gemini", Model: "m", Tokens: TokenStats{TotalTokens: 1}},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	from, to := monday.AddDate(0, 0, -1), monday.AddDate(0, 0, 14)
+	heatmap, err := QueryUsageHeatmap(context.Background(), from, to, "claude", nil)
+	if err != nil {
+		t.Fatalf("QueryUsageHeatmap failed: %v", err)
+	}
+	if len(heatmap.Cells) != 168 || heatmap.Requests != 3 || heatmap.Tokens != 160 {
+		t.Fatalf("unexpected heatmap totals: %d cells, %d requests, %d tokens", len(heatmap.Cells), heatmap.Requests, heatmap.Tokens)
+	}
+	if cell := heatmap.Cells[1*24+23]; cell.Weekday != 1 || cell.Hour != 23 || cell.Requests != 3 || cell.Tokens != 160 {
+		t.Fatalf("unexpected Monday 23:00 cell: %+v", cell)
+	}
+
+	// Two hours east of UTC the same requests fall on Tuesday at 01:00.
+	heatmap, err = QueryUsageHeatmap(context.Background(), from, to, "claude", time.FixedZone("UTC+2", 2*3600))
+	if err != nil {
+		t.Fatalf("QueryUsageHeatmap failed: %v", err)
+	}
+	if cell := heatmap.Cells[2*24+1]; cell.Requests != 3 {
+		t.Fatalf("expected the requests on Tuesday 01:00 local time, got %+v", cell)
+	}
+}
@@ -0,0 +1,234 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Overflow policies applied when the usage write queue is full.
+const (
+	// OverflowBlock waits for room in the queue, stalling the caller.
+	OverflowBlock = "block"
+	// OverflowDropOldest discards the oldest queued record to make room.
+	OverflowDropOldest = "drop-oldest"
+	// OverflowDropNewest discards the incoming record.
+	OverflowDropNewest = "drop-newest"
+	// OverflowSpill appends the record to a temporary file that the writer replays
+	// once the queue has drained.
+	OverflowSpill = "spill"
+
+	defaultQueueSize = 2048
+)
+
+// QueueStats reports the state of the usage write queue.
+type QueueStats struct {
+	Policy       string `json:"policy"`
+	Depth        int    `json:"depth"`
+	Capacity     int    `json:"capacity"`
+	Dropped      uint64 `json:"dropped"`
+	Spilled      uint64 `json:"spilled"`
+	SpillPending int64  `json:"spill-pending"`
+}
+
+func normalizeOverflowPolicy(policy string) string {
+	switch p := strings.ToLower(strings.TrimSpace(policy)); p {
+	case OverflowDropNewest, OverflowDropOldest, OverflowSpill:
+		return p
+	default:
+		return OverflowBlock
+	}
+}
+
+// overflowState tracks the queue policy and its counters for one store.
+type overflowState struct {
+	policy  atomic.Value // string
+	dropped atomic.Uint64
+	spilled atomic.Uint64
+	spill   *spillFile
+}
+
+// spillFile buffers overflowed records as JSON lines on disk. Lines are sealed with
+// the database column cipher when encryption is on, so labels, emails and request
+// metadata never reach the disk in the clear.
+type spillFile struct {
+	mu   sync.Mutex
+	dir  string
+	file *os.File
+	// lines counts the records written to the current file.
+	lines   int64
+	pending atomic.Int64
+}
+
+func (s *spillFile) append(rec dbRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line := []byte(sealColumn(string(raw)))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		f, errCreate := os.CreateTemp(s.dir, "usage-spill-*.jsonl")
+		if errCreate != nil {
+			return fmt.Errorf("usage: create spill file: %w", errCreate)
+		}
+		s.file = f
+	}
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.lines++
+	s.pending.Add(1)
+	return nil
+}
+
+// take detaches the current spill file so the writer can replay it while new
+// overflow goes to a fresh file. It returns the file and how many records it holds.
+func (s *spillFile) take() (string, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return "", 0
+	}
+	name, lines := s.file.Name(), s.lines
+	_ = s.file.Close()
+	s.file, s.lines = nil, 0
+	return name, lines
+}
+
+// recover replays spill files left behind by a previous process. Their records were
+// never counted as pending in this process.
+func (s *spillFile) recover(insert func(dbRecord) error) {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "usage-spill-*.jsonl"))
+	s.mu.Lock()
+	active := ""
+	if s.file != nil {
+		active = s.file.Name()
+	}
+	s.mu.Unlock()
+	for _, path := range matches {
+		if path != active {
+			s.replay(path, insert)
+		}
+	}
+}
+
+// drain detaches the current spill file and replays it.
+func (s *spillFile) drain(insert func(dbRecord) error) {
+	if path, lines := s.take(); path != "" {
+		s.replay(path, insert)
+		s.pending.Add(-lines)
+	}
+}
+
+// replay inserts every record from a detached spill file and removes it.
+func (s *spillFile) replay(path string, insert func(dbRecord) error) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.WithError(err).Warn("usage: open spill file failed")
+		return
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var rec dbRecord
+		if errUnmarshal := json.Unmarshal([]byte(openColumn(scanner.Text())), &rec); errUnmarshal != nil {
+			log.WithError(errUnmarshal).Warn("usage: skipping corrupt or unreadable spill record")
+		} else if errInsert := insert(rec); errInsert != nil {
+			log.WithError(errInsert).Warn("usage: insert spilled record failed")
+		}
+	}
+	if errScan := scanner.Err(); errScan != nil {
+		log.WithError(errScan).Warn("usage: read spill file failed")
+	}
+	_ = f.Close()
+	_ = os.Remove(path)
+}
+
+// enqueue applies the overflow policy when the queue is full.
+func (s *usageStore) enqueue(rec dbRecord) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	s.enqueueMu.RLock()
+	defer s.enqueueMu.RUnlock()
+	if s.closed {
+		if next := s.successor.Load(); next != nil {
+			return next.enqueue(rec)
+		}
+		return errStoreStopped
+	}
+	select {
+	case s.queue <- rec:
+		return nil
+	case <-s.stop:
+		return errStoreStopped
+	default:
+	}
+
+	switch s.overflow.policy.Load().(string) {
+	case OverflowBlock:
+		select {
+		case s.queue <- rec:
+			return nil
+		case <-s.stop:
+			return errStoreStopped
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.queue <- rec:
+				return nil
+			case <-s.stop:
+				return errStoreStopped
+			default:
+			}
+			select {
+			case <-s.queue:
+				s.overflow.dropped.Add(1)
+			default:
+			}
+		}
+	case OverflowSpill:
+		if err := s.overflow.spill.append(rec); err != nil {
+			s.overflow.dropped.Add(1)
+			return err
+		}
+		s.overflow.spilled.Add(1)
+		return nil
+	default:
+		s.overflow.dropped.Add(1)
+		return nil
+	}
+}
+
+// replaySpill drains spilled records once the in-memory queue has room again.
+func (s *usageStore) replaySpill() {
+	if s.overflow.spill == nil || s.overflow.spill.pending.Load() == 0 || len(s.queue) > cap(s.queue)/2 {
+		return
+	}
+	s.overflow.spill.drain(s.insert)
+}
+
+// queueStats snapshots the write queue counters.
+func (s *usageStore) queueStats() QueueStats {
+	stats := QueueStats{
+		Policy:   s.overflow.policy.Load().(string),
+		Depth:    len(s.queue),
+		Capacity: cap(s.queue),
+		Dropped:  s.overflow.dropped.Load(),
+		Spilled:  s.overflow.spilled.Load(),
+	}
+	if s.overflow.spill != nil {
+		stats.SpillPending = s.overflow.spill.pending.Load()
+	}
+	return stats
+}
@@ -0,0 +1,190 @@
+package usage
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newQueueOnlyStore(policy string, size int, dir string) *usageStore {
+	store := &usageStore{queue: make(chan dbRecord, size), stop: make(chan struct{})}
+	store.overflow.policy.Store(normalizeOverflowPolicy(policy))
+	store.overflow.spill = &spillFile{dir: dir}
+	return store
+}
+
+func TestEnqueueOverflowPolicies(t *testing.T) {
+	t.Parallel()
+
+	newest := newQueueOnlyStore(OverflowDropNewest, 2, t.TempDir())
+	for i := 0; i < 5; i++ {
+		if err := newest.enqueue(dbRecord{Model: string(rune('a' + i))}); err != nil {
+			t.Fatalf("drop-newest enqueue: %v", err)
+		}
+	}
+	if stats := newest.queueStats(); stats.Policy != OverflowDropNewest || stats.Depth != 2 || stats.Dropped != 3 {
+		t.Fatalf("unexpected drop-newest stats: %+v", stats)
+	}
+	if first := <-newest.queue; first.Model != "a" {
+		t.Fatalf("drop-newest kept %q first, want a", first.Model)
+	}
+
+	oldest := newQueueOnlyStore(OverflowDropOldest, 2, t.TempDir())
+	for i := 0; i < 5; i++ {
+		if err := oldest.enqueue(dbRecord{Model: string(rune('a' + i))}); err != nil {
+			t.Fatalf("drop-oldest enqueue: %v", err)
+		}
+	}
+	if stats := oldest.queueStats(); stats.Depth != 2 || stats.Dropped != 3 {
+		t.Fatalf("unexpected drop-oldest stats: %+v", stats)
+	}
+	if first := <-oldest.queue; first.Model != "d" {
+		t.Fatalf("drop-oldest kept %q first, want d", first.Model)
+	}
+}
+
+func TestEnqueueSpillReplay(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := newQueueOnlyStore(OverflowSpill, 1, dir)
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		rec := dbRecord{Timestamp: now, Provider: "claude", Model: string(rune('a' + i)), Tokens: TokenStats{TotalTokens: int64(i)}}
+		if err := store.enqueue(rec); err != nil {
+			t.Fatalf("spill enqueue: %v", err)
+		}
+	}
+	stats := store.queueStats()
+	if stats.Spilled != 2 || stats.SpillPending != 2 || stats.Dropped != 0 {
+		t.Fatalf("unexpected spill stats: %+v", stats)
+	}
+
+	<-store.queue
+	var replayed []dbRecord
+	store.overflow.spill.drain(func(rec dbRecord) error {
+		replayed = append(replayed, rec)
+		return nil
+	})
+	if len(replayed) != 2 || replayed[0].Model != "b" || replayed[1].Tokens.TotalTokens != 2 || !replayed[0].Timestamp.Equal(now) {
+		t.Fatalf("unexpected replayed records: %+v", replayed)
+	}
+	if pending := store.overflow.spill.pending.Load(); pending != 0 {
+		t.Fatalf("expected no pending spill records, got %d", pending)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "usage-spill-*.jsonl")); len(matches) != 0 {
+		t.Fatalf("spill file not removed: %v", matches)
+	}
+}
+
+func TestHandoverLosesNoRecords(t *testing.T) {
+	t.Parallel()
+
+	oldPath := filepath.Join(t.TempDir(), "old.db")
+	newPath := filepath.Join(t.TempDir(), "new.db")
+	old, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{Enabled: true, Path: oldPath, QueueSize: 8, OverflowPolicy: OverflowBlock}))
+	if err != nil {
+		t.Fatalf("failed to create old store: %v", err)
+	}
+	next, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{Enabled: true, Path: newPath}))
+	if err != nil {
+		t.Fatalf("failed to create new store: %v", err)
+	}
+
+	// Writers keep using the store they loaded before the swap, as HandleUsage does.
+	const writers, perWriter = 4, 50
+	var wg sync.WaitGroup
+	now := time.Now().UTC()
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if errEnqueue := old.enqueue(dbRecord{Timestamp: now, Provider: "claude", Model: "m"}); errEnqueue != nil {
+					t.Errorf("enqueue: %v", errEnqueue)
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	old.handover(next)
+	wg.Wait()
+	next.close()
+
+	total := 0
+	for _, path := range []string{oldPath, newPath} {
+		db, errOpen := sql.Open("sqlite", path)
+		if errOpen != nil {
+			t.Fatalf("open %s: %v", path, errOpen)
+		}
+		var n int
+		if errCount := db.QueryRow(`SELECT COUNT(*) FROM usage_requests`).Scan(&n); errCount != nil {
+			t.Fatalf("count %s: %v", path, errCount)
+		}
+		_ = db.Close()
+		total += n
+	}
+	if total != writers*perWriter {
+		t.Fatalf("expected %d persisted records, got %d", writers*perWriter, total)
+	}
+	if err = old.enqueue(dbRecord{}); err != errStoreStopped {
+		t.Fatalf("expected enqueue after the successor closed to fail, got %v", err)
+	}
+}
+
+func TestOverflowPolicyDefaultsToBlock(t *testing.T) {
+	if got := normalizeOverflowPolicy(""); got != OverflowBlock {
+		t.Fatalf("expected block as the default overflow policy, got %q", got)
+	}
+}
+
+func TestSpillSealsRecordsAndRecoversWithoutCounting(t *testing.T) {
+	c, err := newColumnCipher(make([]byte, 32), []byte("nonce-key"))
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	activeColumnCipher.Store(c)
+	defer activeColumnCipher.Store(nil)
+
+	dir := t.TempDir()
+	previous := newQueueOnlyStore(OverflowSpill, 1, dir)
+	for i := 0; i < 3; i++ {
+		rec := dbRecord{Provider: "claude", Model: "m", AccountEmail: "alice@example.com", CredentialLabel: "alice-label"}
+		if err = previous.enqueue(rec); err != nil {
+			t.Fatalf("spill enqueue: %v", err)
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "usage-spill-*.jsonl"))
+	if len(matches) != 1 {
+		t.Fatalf("expected one spill file, got %v", matches)
+	}
+	// Simulate a crash: the file is left behind for the next process.
+	previous.overflow.spill.mu.Lock()
+	_ = previous.overflow.spill.file.Close()
+	previous.overflow.spill.mu.Unlock()
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatalf("read spill file: %v", err)
+	}
+	if strings.Contains(string(data), "alice") || strings.Contains(string(data), "claude") {
+		t.Fatalf("spill file holds plaintext: %s", data)
+	}
+
+	next := newQueueOnlyStore(OverflowSpill, 1, dir)
+	var recovered []dbRecord
+	next.overflow.spill.recover(func(rec dbRecord) error {
+		recovered = append(recovered, rec)
+		return nil
+	})
+	if len(recovered) != 2 || recovered[0].Provider != "claude" || recovered[0].AccountEmail != "alice@example.com" {
+		t.Fatalf("unexpected recovered records: %+v", recovered)
+	}
+	if pending := next.overflow.spill.pending.Load(); pending != 0 {
+		t.Fatalf("recovery left spill-pending at %d", pending)
+	}
+}
@@ -0,0 +1,652 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReportTime      = "08:00"
+	defaultReportTopModels = 5
+	reportDeliveryTimeout  = 30 * time.Second
+)
+
+// ErrReportNotFound is returned when no report recipient has the requested name.
+var ErrReportNotFound = errors.New("usage: report not found")
+
+// ReportOptions configures scheduled usage reports.
+type ReportOptions struct {
+	SMTP       ReportSMTP
+	Recipients []ReportRecipient
+}
+
+// ReportSMTP is the mail server reports are sent through.
+type ReportSMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLS      bool
+}
+
+// ReportRecipient is one scheduled report and where it is delivered.
+type ReportRecipient struct {
+	Name     string
+	Email    []string
+	Webhook  string
+	Weekly   bool
+	Time     string
+	Weekday  time.Weekday
+	Timezone string
+	// TopModels is the number of models listed in the report.
+	TopModels int
+}
+
+// UsageReport summarises usage_daily over a report period. Days are UTC days, as
+// usage_daily aggregates them.
+type UsageReport struct {
+	Name        string       `json:"name"`
+	Schedule    string       `json:"schedule"`
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Totals      ReportTotals `json:"totals"`
+	// TopModels lists the busiest models by requests.
+	TopModels []ReportModel `json:"top_models"`
+	// Failures lists providers with failed or rate-limited requests, most failures first.
+	Failures []ReportFailures `json:"failures"`
+}
+
+// ReportTotals sums requests, tokens and estimated cost over a report period.
+type ReportTotals struct {
+	Requests         int64 `json:"requests"`
+	FailedRequests   int64 `json:"failed_requests"`
+	RateLimited      int64 `json:"rate_limited"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	// CostUSD is priced with usage-db model-prices.
+	CostUSD float64 `json:"cost_usd"`
+	// UnpricedRequests counts requests whose model has no configured price.
+	UnpricedRequests int64 `json:"unpriced_requests"`
+}
+
+// ReportModel is the usage of one provider and model over a report period.
+type ReportModel struct {
+	Provider       string  `json:"provider"`
+	Model          string  `json:"model"`
+	Requests       int64   `json:"requests"`
+	FailedRequests int64   `json:"failed_requests"`
+	TotalTokens    int64   `json:"total_tokens"`
+	CostUSD        float64 `json:"cost_usd"`
+}
+
+// ReportFailures counts the failures of one provider over a report period.
+type ReportFailures struct {
+	Provider       string  `json:"provider"`
+	Requests       int64   `json:"requests"`
+	FailedRequests int64   `json:"failed_requests"`
+	RateLimited    int64   `json:"rate_limited"`
+	FailureRate    float64 `json:"failure_rate"`
+}
+
+// ReportStatus reports the schedule and deliveries of one report recipient.
+type ReportStatus struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	NextRun  *time.Time `json:"next-run,omitempty"`
+	// LastPeriod is the period of the last delivered report, e.g. "2026-01-05..2026-01-11".
+	LastPeriod string         `json:"last-period,omitempty"`
+	Deliveries ExporterHealth `json:"deliveries"`
+}
+
+type reportEntry struct {
+	recipient ReportRecipient
+	location  *time.Location
+
+	mu         sync.Mutex
+	next       time.Time
+	lastPeriod string
+	deliveries healthTracker
+}
+
+type reportScheduler struct {
+	opts    ReportOptions
+	entries []*reportEntry
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var (
+	currentReports  atomic.Pointer[reportScheduler]
+	reportsConfigMu sync.Mutex
+
+	// sendReportMail delivers a rendered message; replaced in tests.
+	sendReportMail = sendSMTPMail
+)
+
+// ReportOptionsFromConfig converts the usage-db.reports configuration block,
+// skipping disabled recipients.
+func ReportOptionsFromConfig(cfg config.UsageReportsConfig) ReportOptions {
+	opts := ReportOptions{SMTP: ReportSMTP{
+		Host:     cfg.SMTP.Host,
+		Port:     cfg.SMTP.Port,
+		Username: cfg.SMTP.Username,
+		Password: cfg.SMTP.Password,
+		From:     cfg.SMTP.From,
+		TLS:      cfg.SMTP.TLS,
+	}}
+	for _, r := range cfg.Recipients {
+		if r.Disabled {
+			continue
+		}
+		weekday, _ := config.ParseWeekday(r.Weekday)
+		if strings.TrimSpace(r.Weekday) == "" {
+			weekday = time.Monday
+		}
+		opts.Recipients = append(opts.Recipients, ReportRecipient{
+			Name:      r.Name,
+			Email:     r.Email,
+			Webhook:   r.Webhook,
+			Weekly:    strings.EqualFold(strings.TrimSpace(r.Schedule), "weekly"),
+			Time:      r.Time,
+			Weekday:   weekday,
+			Timezone:  r.Timezone,
+			TopModels: r.TopModels,
+		})
+	}
+	return opts
+}
+
+// ConfigureReports starts, reschedules or stops the usage report scheduler.
+func ConfigureReports(opts ReportOptions) error {
+	reportsConfigMu.Lock()
+	defer reportsConfigMu.Unlock()
+
+	normalized, entries, err := normalizeReportOptions(opts)
+	if err != nil {
+		return err
+	}
+	prev := currentReports.Load()
+	if prev != nil && reflect.DeepEqual(prev.opts, normalized) {
+		return nil
+	}
+	if prev != nil {
+		close(prev.stop)
+		<-prev.done
+	}
+	if len(entries) == 0 {
+		currentReports.Store(nil)
+		return nil
+	}
+	s := &reportScheduler{opts: normalized, entries: entries, stop: make(chan struct{}), done: make(chan struct{})}
+	now := time.Now()
+	for _, e := range entries {
+		e.next = nextReportRun(e.recipient, e.location, now)
+	}
+	currentReports.Store(s)
+	go s.run()
+	return nil
+}
+
+func normalizeReportOptions(opts ReportOptions) (ReportOptions, []*reportEntry, error) {
+	opts.SMTP.Host = strings.TrimSpace(opts.SMTP.Host)
+	opts.SMTP.Username = strings.TrimSpace(opts.SMTP.Username)
+	opts.SMTP.From = strings.TrimSpace(opts.SMTP.From)
+	if opts.SMTP.Port <= 0 {
+		opts.SMTP.Port = 587
+		if opts.SMTP.TLS {
+			opts.SMTP.Port = 465
+		}
+	}
+	recipients := make([]ReportRecipient, 0, len(opts.Recipients))
+	entries := make([]*reportEntry, 0, len(opts.Recipients))
+	for _, r := range opts.Recipients {
+		r.Name = strings.TrimSpace(r.Name)
+		r.Webhook = strings.TrimSpace(r.Webhook)
+		r.Time = strings.TrimSpace(r.Time)
+		r.Timezone = strings.TrimSpace(r.Timezone)
+		if r.Name == "" || (len(r.Email) == 0 && r.Webhook == "") {
+			continue
+		}
+		if r.Time == "" {
+			r.Time = defaultReportTime
+		}
+		if _, err := time.Parse("15:04", r.Time); err != nil {
+			return ReportOptions{}, nil, fmt.Errorf("usage: report %s: invalid time %q", r.Name, r.Time)
+		}
+		if r.Timezone == "" {
+			r.Timezone = "UTC"
+		}
+		loc, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			return ReportOptions{}, nil, fmt.Errorf("usage: report %s: %w", r.Name, err)
+		}
+		if len(r.Email) > 0 && (opts.SMTP.Host == "" || opts.SMTP.From == "") {
+			return ReportOptions{}, nil, fmt.Errorf("usage: report %s: smtp host and from are required for email", r.Name)
+		}
+		if r.TopModels <= 0 {
+			r.TopModels = defaultReportTopModels
+		}
+		recipients = append(recipients, r)
+		entries = append(entries, &reportEntry{recipient: r, location: loc})
+	}
+	opts.Recipients = recipients
+	return opts, entries, nil
+}
+
+func (s *reportScheduler) run() {
+	defer close(s.done)
+	for {
+		next := time.Time{}
+		for _, e := range s.entries {
+			e.mu.Lock()
+			if next.IsZero() || e.next.Before(next) {
+				next = e.next
+			}
+			e.mu.Unlock()
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		now := time.Now()
+		for _, e := range s.entries {
+			e.mu.Lock()
+			due := !e.next.After(now)
+			if due {
+				e.next = nextReportRun(e.recipient, e.location, now)
+			}
+			e.mu.Unlock()
+			if !due {
+				continue
+			}
+			if !maintenanceAllowed() {
+				util.ComponentLog(util.LogComponentUsage).Debugf("usage report %s: skipped, another process holds the maintenance lease", e.recipient.Name)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*reportDeliveryTimeout)
+			if _, err := s.deliver(ctx, e, now); err != nil {
+				log.WithError(err).Warnf("usage report %s: delivery failed", e.recipient.Name)
+			}
+			cancel()
+		}
+	}
+}
+
+// nextReportRun returns the first scheduled time of r strictly after after.
+func nextReportRun(r ReportRecipient, loc *time.Location, after time.Time) time.Time {
+	clock, _ := time.Parse("15:04", r.Time)
+	local := after.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	step := 1
+	if r.Weekly {
+		step = 7
+		next = next.AddDate(0, 0, (int(r.Weekday)-int(next.Weekday())+7)%7)
+	}
+	for !next.After(after) {
+		next = next.AddDate(0, 0, step)
+	}
+	return next
+}
+
+// reportPeriod returns the UTC days [from, to) covered by a report sent at runAt: the
+// day (or seven days) before the local date of the run. Days that have not ended in
+// UTC yet are left out, so the report never shows a partial day.
+func reportPeriod(r ReportRecipient, loc *time.Location, runAt time.Time) (time.Time, time.Time) {
+	local := runAt.In(loc)
+	end := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	utc := runAt.UTC()
+	if today := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC); end.After(today) {
+		end = today
+	}
+	days := 1
+	if r.Weekly {
+		days = 7
+	}
+	return end.AddDate(0, 0, -days), end
+}
+
+func (s *reportScheduler) deliver(ctx context.Context, e *reportEntry, runAt time.Time) (UsageReport, error) {
+	from, to := reportPeriod(e.recipient, e.location, runAt)
+	report, err := BuildUsageReport(ctx, e.recipient, from, to)
+	if err == nil {
+		err = s.send(ctx, e.recipient, report)
+	}
+	e.deliveries.observe(err)
+	if err != nil {
+		return report, err
+	}
+	e.mu.Lock()
+	e.lastPeriod = report.From + ".." + report.To
+	e.mu.Unlock()
+	return report, nil
+}
+
+func (s *reportScheduler) send(ctx context.Context, r ReportRecipient, report UsageReport) error {
+	var errs []error
+	if r.Webhook != "" {
+		if err := postReportWebhook(ctx, r.Webhook, report); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	if len(r.Email) > 0 {
+		msg := renderReportMail(s.opts.SMTP.From, r.Email, report)
+		if err := sendReportMail(s.opts.SMTP, r.Email, msg); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// BuildUsageReport summarises usage_daily rows of the UTC days [from, to) for r.
+func BuildUsageReport(ctx context.Context, r ReportRecipient, from, to time.Time) (UsageReport, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return UsageReport{}, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	schedule := "daily"
+	if r.Weekly {
+		schedule = "weekly"
+	}
+	report := UsageReport{
+		Name:        r.Name,
+		Schedule:    schedule,
+		From:        from.UTC().Format("2006-01-02"),
+		To:          to.UTC().AddDate(0, 0, -1).Format("2006-01-02"),
+		GeneratedAt: time.Now().UTC(),
+		TopModels:   make([]ReportModel, 0),
+		Failures:    make([]ReportFailures, 0),
+	}
+	rows, err := store.db.QueryContext(ctx, `
+		SELECT COALESCE(d.provider, ''), COALESCE(d.model, ''),
+			SUM(d.total_requests), SUM(d.failed_requests), SUM(d.rate_limited),
+			SUM(d.prompt_tokens), SUM(d.completion_tokens), SUM(d.total_tokens),
+			SUM(d.prompt_tokens * COALESCE(p.input_per_million, 0)
+				+ d.completion_tokens * COALESCE(p.output_per_million, 0)) / 1000000.0,
+			SUM(CASE WHEN p.model IS NULL THEN d.total_requests ELSE 0 END)
+		FROM usage_daily AS d
+		LEFT JOIN usage_model_prices AS p ON p.model = LOWER(d.model)
+		WHERE d.day >= ? AND d.day < ?
+		GROUP BY d.provider, d.model;`, from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02"))
+	if err != nil {
+		return report, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	failures := make(map[string]*ReportFailures)
+	var models []ReportModel
+	for rows.Next() {
+		var m ReportModel
+		var rateLimited, prompt, completion, unpriced int64
+		if err := rows.Scan(&m.Provider, &m.Model, &m.Requests, &m.FailedRequests, &rateLimited,
+			&prompt, &completion, &m.TotalTokens, &m.CostUSD, &unpriced); err != nil {
+			return report, err
+		}
+		report.Totals.Requests += m.Requests
+		report.Totals.FailedRequests += m.FailedRequests
+		report.Totals.RateLimited += rateLimited
+		report.Totals.PromptTokens += prompt
+		report.Totals.CompletionTokens += completion
+		report.Totals.TotalTokens += m.TotalTokens
+		report.Totals.CostUSD += m.CostUSD
+		report.Totals.UnpricedRequests += unpriced
+		models = append(models, m)
+
+		f := failures[m.Provider]
+		if f == nil {
+			f = &ReportFailures{Provider: m.Provider}
+			failures[m.Provider] = f
+		}
+		f.Requests += m.Requests
+		f.FailedRequests += m.FailedRequests
+		f.RateLimited += rateLimited
+	}
+	if err = rows.Err(); err != nil {
+		return report, err
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Requests != models[j].Requests {
+			return models[i].Requests > models[j].Requests
+		}
+		if models[i].Provider != models[j].Provider {
+			return models[i].Provider < models[j].Provider
+		}
+		return models[i].Model < models[j].Model
+	})
+	top := r.TopModels
+	if top <= 0 {
+		top = defaultReportTopModels
+	}
+	if len(models) > top {
+		models = models[:top]
+	}
+	report.TopModels = append(report.TopModels, models...)
+
+	for _, f := range failures {
+		if f.FailedRequests == 0 && f.RateLimited == 0 {
+			continue
+		}
+		if f.Requests > 0 {
+			f.FailureRate = float64(f.FailedRequests) / float64(f.Requests)
+		}
+		report.Failures = append(report.Failures, *f)
+	}
+	sort.Slice(report.Failures, func(i, j int) bool {
+		if report.Failures[i].FailedRequests != report.Failures[j].FailedRequests {
+			return report.Failures[i].FailedRequests > report.Failures[j].FailedRequests
+		}
+		return report.Failures[i].Provider < report.Failures[j].Provider
+	})
+	return report, nil
+}
+
+// SendReport builds the report of the named recipient for the period its next
+// scheduled run would cover if it ran now, and delivers it unless dryRun is set.
+func SendReport(ctx context.Context, name string, dryRun bool) (UsageReport, error) {
+	s := currentReports.Load()
+	if s == nil {
+		return UsageReport{}, ErrReportNotFound
+	}
+	for _, e := range s.entries {
+		if !strings.EqualFold(e.recipient.Name, strings.TrimSpace(name)) {
+			continue
+		}
+		now := time.Now()
+		if dryRun {
+			from, to := reportPeriod(e.recipient, e.location, now)
+			return BuildUsageReport(ctx, e.recipient, from, to)
+		}
+		return s.deliver(ctx, e, now)
+	}
+	return UsageReport{}, ErrReportNotFound
+}
+
+// ReportStatuses reports the schedule and delivery counters of every report.
+func ReportStatuses() []ReportStatus {
+	s := currentReports.Load()
+	if s == nil {
+		return nil
+	}
+	out := make([]ReportStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		status := ReportStatus{Name: e.recipient.Name, Schedule: "daily", Deliveries: e.deliveries.snapshot()}
+		if e.recipient.Weekly {
+			status.Schedule = "weekly"
+		}
+		e.mu.Lock()
+		next := e.next
+		status.LastPeriod = e.lastPeriod
+		e.mu.Unlock()
+		status.NextRun = &next
+		out = append(out, status)
+	}
+	return out
+}
+
+func postReportWebhook(ctx context.Context, url string, report UsageReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, reportDeliveryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// renderReportText renders a report as a plain text summary.
+func renderReportText(report UsageReport) string {
+	var b strings.Builder
+	period := report.From
+	if report.To != report.From {
+		period += " to " + report.To
+	}
+	fmt.Fprintf(&b, "Usage report %q (%s), %s (UTC)\n\n", report.Name, report.Schedule, period)
+	t := report.Totals
+	fmt.Fprintf(&b, "Requests:       %s (%s failed, %s rate limited)\n", formatCount(t.Requests), formatCount(t.FailedRequests), formatCount(t.RateLimited))
+	fmt.Fprintf(&b, "Tokens:         %s (%s prompt, %s completion)\n", formatCount(t.TotalTokens), formatCount(t.PromptTokens), formatCount(t.CompletionTokens))
+	fmt.Fprintf(&b, "Estimated cost: $%.2f", t.CostUSD)
+	if t.UnpricedRequests > 0 {
+		fmt.Fprintf(&b, " (%s requests without a model price)", formatCount(t.UnpricedRequests))
+	}
+	b.WriteString("\n")
+
+	if len(report.TopModels) > 0 {
+		b.WriteString("\nTop models\n")
+		tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  MODEL\tPROVIDER\tREQUESTS\tFAILED\tTOKENS\tCOST")
+		for _, m := range report.TopModels {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t$%.2f\n", m.Model, m.Provider, formatCount(m.Requests),
+				formatCount(m.FailedRequests), formatCount(m.TotalTokens), m.CostUSD)
+		}
+		_ = tw.Flush()
+	}
+	if len(report.Failures) > 0 {
+		b.WriteString("\nFailures\n")
+		tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  PROVIDER\tFAILED\tRATE\tRATE LIMITED")
+		for _, f := range report.Failures {
+			fmt.Fprintf(tw, "  %s\t%s\t%.1f%%\t%s\n", f.Provider, formatCount(f.FailedRequests), f.FailureRate*100, formatCount(f.RateLimited))
+		}
+		_ = tw.Flush()
+	}
+	return b.String()
+}
+
+// formatCount renders n with thousands separators.
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+func renderReportMail(from string, to []string, report UsageReport) []byte {
+	subject := fmt.Sprintf("Usage report %s: %s", report.Name, report.From)
+	if report.To != report.From {
+		subject += " to " + report.To
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", report.GeneratedAt.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(renderReportText(report), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// sendSMTPMail sends msg through the configured server, upgrading plain connections
+// with STARTTLS when the server offers it.
+func sendSMTPMail(cfg ReportSMTP, to []string, msg []byte) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	if !cfg.TLS {
+		return smtp.SendMail(addr, auth, cfg.From, to, msg)
+	}
+	dialer := &net.Dialer{Timeout: reportDeliveryTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() { _ = client.Close() }()
+	if auth != nil {
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err = client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
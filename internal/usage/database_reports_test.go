@@ -0,0 +1,129 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextReportRun(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	// 2026-03-28 is a Saturday; Berlin switches to summer time on the 29th.
+	after := time.Date(2026, 3, 28, 9, 0, 0, 0, time.UTC)
+
+	daily := ReportRecipient{Time: "08:00"}
+	if got, want := nextReportRun(daily, berlin, after), time.Date(2026, 3, 29, 6, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("daily next run = %v, want %v", got.UTC(), want)
+	}
+	weekly := ReportRecipient{Time: "08:00", Weekly: true, Weekday: time.Monday}
+	if got, want := nextReportRun(weekly, berlin, after), time.Date(2026, 3, 30, 6, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("weekly next run = %v, want %v", got.UTC(), want)
+	}
+	sameDay := ReportRecipient{Time: "12:30", Weekly: true, Weekday: time.Saturday}
+	if got, want := nextReportRun(sameDay, time.UTC, after), time.Date(2026, 3, 28, 12, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("same-day weekly next run = %v, want %v", got, want)
+	}
+}
+
+func TestReportPeriod(t *testing.T) {
+	tokyo := time.FixedZone("UTC+9", 9*3600)
+	// 08:00 in Tokyo on the 15th is still the 14th in UTC, which has not ended yet.
+	runAt := time.Date(2026, 10, 14, 23, 0, 0, 0, time.UTC)
+	from, to := reportPeriod(ReportRecipient{}, tokyo, runAt)
+	if from.Format("2006-01-02") != "2026-10-13" || to.Format("2006-01-02") != "2026-10-14" {
+		t.Fatalf("daily period = %v..%v", from, to)
+	}
+	from, to = reportPeriod(ReportRecipient{Weekly: true}, time.UTC, time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC))
+	if from.Format("2006-01-02") != "2026-10-05" || to.Format("2006-01-02") != "2026-10-12" {
+		t.Fatalf("weekly period = %v..%v", from, to)
+	}
+}
+
+func TestSendReport(t *testing.T) {
+	store, err := newUsageStore(normalizeDatabaseOptions(DatabaseOptions{
+		Enabled:     true,
+		Path:        filepath.Join(t.TempDir(), "usage.db"),
+		ModelPrices: map[string]ModelPrice{"gpt-x": {InputPerMillion: 10, OutputPerMillion: 30}},
+	}))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	for _, rec := range []dbRecord{
+		{Timestamp: yesterday, Provider: "openai", Model: "gpt-x", Tokens: TokenStats{InputTokens: 1000, OutputTokens: 100, TotalTokens: 1100}},
+		{Timestamp: yesterday, Provider: "openai", Model: "gpt-x", Failed: true, Tokens: TokenStats{InputTokens: 1000, TotalTokens: 1000}},
+		{Timestamp: yesterday, Provider: "claude", Model: "claude-x", RateLimited: true, Failed: true},
+		{Timestamp: yesterday.AddDate(0, 0, -3), Provider: "openai", Model: "gpt-x", Tokens: TokenStats{InputTokens: 5000, TotalTokens: 5000}},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	var received UsageReport
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+	}))
+	defer hook.Close()
+	var mailed string
+	sendReportMail = func(_ ReportSMTP, to []string, msg []byte) error {
+		mailed = string(msg)
+		return nil
+	}
+	defer func() { sendReportMail = sendSMTPMail }()
+
+	if err = ConfigureReports(ReportOptions{
+		SMTP: ReportSMTP{Host: "smtp.example.com", From: "reports@example.com"},
+		Recipients: []ReportRecipient{
+			{Name: "ops", Webhook: hook.URL, Email: []string{"ops@example.com"}, TopModels: 1},
+		},
+	}); err != nil {
+		t.Fatalf("ConfigureReports failed: %v", err)
+	}
+	defer func() { _ = ConfigureReports(ReportOptions{}) }()
+
+	if _, err = SendReport(context.Background(), "missing", false); err != ErrReportNotFound {
+		t.Fatalf("expected ErrReportNotFound, got %v", err)
+	}
+	report, err := SendReport(context.Background(), "OPS", false)
+	if err != nil {
+		t.Fatalf("SendReport failed: %v", err)
+	}
+	if report.Totals.Requests != 3 || report.Totals.FailedRequests != 2 || report.Totals.RateLimited != 1 {
+		t.Fatalf("unexpected totals: %+v", report.Totals)
+	}
+	if math.Abs(report.Totals.CostUSD-0.023) > 1e-9 || report.Totals.UnpricedRequests != 1 {
+		t.Fatalf("unexpected cost: %+v", report.Totals)
+	}
+	if len(report.TopModels) != 1 || report.TopModels[0].Model != "gpt-x" {
+		t.Fatalf("unexpected top models: %+v", report.TopModels)
+	}
+	if len(report.Failures) != 2 || report.Failures[0].Provider != "claude" || report.Failures[0].FailureRate != 1 {
+		t.Fatalf("unexpected failures: %+v", report.Failures)
+	}
+	if received.Name != "ops" || received.Totals.Requests != 3 {
+		t.Fatalf("unexpected webhook payload: %+v", received)
+	}
+	if !strings.Contains(mailed, "Subject: Usage report ops: "+report.From) || !strings.Contains(mailed, "Estimated cost: $0.02") {
+		t.Fatalf("unexpected mail:\n%s", mailed)
+	}
+	statuses := ReportStatuses()
+	if len(statuses) != 1 || statuses[0].Deliveries.Successes != 1 || statuses[0].LastPeriod != report.From+".."+report.To {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+}
@@ -0,0 +1,359 @@
+package usage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// retentionPolicy captures how long rows are kept in each usage table.
+type retentionPolicy struct {
+	requestsDays int
+	dailyDays    int
+	providers    map[string]int
+	// credentials maps credential keys (auth IDs, API keys or fingerprints) to days.
+	credentials map[string]int
+}
+
+// RetentionPolicy is the externally visible form of the active retention settings.
+type RetentionPolicy struct {
+	RequestsDays int            `json:"requests-retention-days"`
+	DailyDays    int            `json:"daily-retention-days"`
+	Providers    map[string]int `json:"provider-retention-days,omitempty"`
+	// Credentials is keyed by the credential fingerprint each override resolves to.
+	Credentials map[string]int `json:"credential-retention-days,omitempty"`
+}
+
+func newRetentionPolicy(opts DatabaseOptions) *retentionPolicy {
+	policy := &retentionPolicy{
+		requestsDays: opts.RetentionDays,
+		dailyDays:    opts.RetentionDays,
+		providers:    config.NormalizeProviderRetentionDays(opts.ProviderRetentionDays),
+		credentials:  config.NormalizeCredentialRetentionDays(opts.CredentialRetentionDays),
+	}
+	if opts.RequestsRetentionDays > 0 {
+		policy.requestsDays = opts.RequestsRetentionDays
+	}
+	if opts.DailyRetentionDays > 0 {
+		policy.dailyDays = opts.DailyRetentionDays
+	}
+	return policy
+}
+
+// credentialRetention resolves the credential overrides of the policy to fingerprints
+// with the current salt. Keys that already are fingerprints are used as they are; when
+// several keys resolve to the same fingerprint the shortest retention wins.
+func (p *retentionPolicy) credentialRetention() map[string]int {
+	if len(p.credentials) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(p.credentials))
+	for key, days := range p.credentials {
+		fp := strings.ToLower(key)
+		if !isFingerprint(fp) {
+			fp = fingerprint(key)
+		}
+		if prev, ok := out[fp]; !ok || days < prev {
+			out[fp] = days
+		}
+	}
+	return out
+}
+
+// isFingerprint reports whether value has the shape of a credential fingerprint.
+func isFingerprint(value string) bool {
+	if len(value) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+// CurrentRetentionPolicy returns the retention settings of the active usage store.
+// The boolean result is false when the database is disabled.
+func CurrentRetentionPolicy() (RetentionPolicy, bool) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return RetentionPolicy{}, false
+	}
+	policy := store.retention.Load()
+	if policy == nil {
+		return RetentionPolicy{}, false
+	}
+	out := RetentionPolicy{
+		RequestsDays: policy.requestsDays,
+		DailyDays:    policy.dailyDays,
+	}
+	if len(policy.providers) > 0 {
+		out.Providers = make(map[string]int, len(policy.providers))
+		for k, v := range policy.providers {
+			out.Providers[k] = v
+		}
+	}
+	out.Credentials = policy.credentialRetention()
+	return out, true
+}
+
+func (s *usageStore) setRetention(policy *retentionPolicy) {
+	if policy == nil {
+		return
+	}
+	s.retention.Store(policy)
+}
+
+// RetentionResult reports the rows removed, or that would be removed, by a retention pass.
+type RetentionResult struct {
+	DryRun bool `json:"dry_run"`
+	// Requests is the number of usage_requests rows deleted.
+	Requests int64 `json:"requests"`
+	// Archived is the number of usage_requests rows uploaded to object storage before
+	// deletion; ArchiveObject is the key of the uploaded object.
+	Archived      int64  `json:"archived,omitempty"`
+	ArchiveObject string `json:"archive_object,omitempty"`
+	// RequestTags is the number of usage_request_tags rows deleted along with them.
+	RequestTags int64 `json:"request_tags"`
+	// ShadowComparisons is the number of shadow_comparisons rows deleted; they follow
+	// the request detail retention.
+	ShadowComparisons int64 `json:"shadow_comparisons"`
+	// AuthEvents is the number of auth_events rows deleted, also by request retention.
+	AuthEvents int64 `json:"auth_events"`
+	// DailyRows is the number of usage_daily rows folded into usage_monthly and deleted.
+	DailyRows int64 `json:"daily_rows"`
+	// MonthlyRows is the number of usage_monthly rows created or updated by the fold.
+	MonthlyRows int64 `json:"monthly_rows"`
+}
+
+// RunRetention applies the active retention policy immediately instead of waiting
+// for the next scheduled pass. With dryRun the deletions are rolled back after
+// counting, so the result shows what the next pass would remove. Only the holder
+// of the maintenance lease may run a real pass.
+func RunRetention(ctx context.Context, dryRun bool) (RetentionResult, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return RetentionResult{}, ErrDatabaseDisabled
+	}
+	if store.readOnly {
+		return RetentionResult{}, ErrReadOnly
+	}
+	if !dryRun && !store.isMaintenanceLeader() {
+		return RetentionResult{}, ErrNotMaintenanceLeader
+	}
+	result, err := store.runRetention(ctx, time.Now().UTC(), dryRun)
+	if !dryRun {
+		retentionHealth.observe(err)
+	}
+	return result, err
+}
+
+func (s *usageStore) applyRetention() {
+	if !s.isMaintenanceLeader() {
+		util.ComponentLog(util.LogComponentUsage).Debug("usage: retention skipped, another process holds the maintenance lease")
+		return
+	}
+	result, err := s.runRetention(context.Background(), time.Now().UTC(), false)
+	retentionHealth.observe(err)
+	if err != nil {
+		log.WithError(err).Warn("usage: retention failed")
+		return
+	}
+	if result.Requests > 0 || result.DailyRows > 0 {
+		util.ComponentLog(util.LogComponentUsage).Debugf("usage: retention removed %d request rows and compacted %d daily rows", result.Requests, result.DailyRows)
+	}
+}
+
+func (s *usageStore) runRetention(ctx context.Context, now time.Time, dryRun bool) (RetentionResult, error) {
+	result := RetentionResult{DryRun: dryRun}
+	policy := s.retention.Load()
+	if policy == nil {
+		return result, nil
+	}
+	s.retentionMu.Lock()
+	defer s.retentionMu.Unlock()
+
+	// Expired rows are uploaded before the transaction so a slow object store never
+	// holds the database lock; only the uploaded rows are deleted afterwards.
+	maxID := int64(-1)
+	if archiver := currentArchiver.Load(); archiver != nil && !dryRun {
+		archived, err := archiver.archive(ctx, s, now, policy)
+		archiver.uploads.observe(err)
+		if err != nil {
+			return result, fmt.Errorf("usage: retention archive requests: %w", err)
+		}
+		result.Archived, result.ArchiveObject, maxID = archived.rows, archived.object, archived.maxID
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var tagsBefore, tagsAfter int64
+	if err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM usage_request_tags`).Scan(&tagsBefore); err != nil {
+		return result, err
+	}
+	if result.Requests, err = deleteExpiredRequests(ctx, tx, now, policy, maxID); err != nil {
+		return result, fmt.Errorf("usage: retention delete requests: %w", err)
+	}
+	if err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM usage_request_tags`).Scan(&tagsAfter); err != nil {
+		return result, err
+	}
+	result.RequestTags = tagsBefore - tagsAfter
+	if policy.requestsDays > 0 {
+		cutoff := retentionCutoff(now, policy.requestsDays)
+		if result.ShadowComparisons, err = execCount(ctx, tx, `DELETE FROM shadow_comparisons WHERE timestamp < ?`, []any{cutoff}); err != nil {
+			return result, fmt.Errorf("usage: retention delete shadow comparisons: %w", err)
+		}
+		if result.AuthEvents, err = execCount(ctx, tx, `DELETE FROM auth_events WHERE timestamp < ?`, []any{cutoff}); err != nil {
+			return result, fmt.Errorf("usage: retention delete auth events: %w", err)
+		}
+	}
+
+	if policy.dailyDays > 0 {
+		cutoffDay := retentionCutoff(now, policy.dailyDays).Format("2006-01-02")
+		if result.MonthlyRows, result.DailyRows, err = compactDaily(ctx, tx, cutoffDay); err != nil {
+			return result, fmt.Errorf("usage: retention compact daily: %w", err)
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+	return result, tx.Commit()
+}
+
+// compactDaily folds usage_daily rows older than cutoffDay into usage_monthly and
+// deletes them, so monthly totals outlive the daily retention window.
+func compactDaily(ctx context.Context, tx *sql.Tx, cutoffDay string) (monthly, daily int64, err error) {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO usage_monthly (
+			month, provider, credential_fingerprint, credential_label, model,
+			total_requests, failed_requests, rate_limited, prompt_tokens,
+			completion_tokens, total_tokens, account_email, aborted_requests
+		)
+		SELECT substr(day, 1, 7), provider, credential_fingerprint, MAX(credential_label), model,
+			SUM(total_requests), SUM(failed_requests), SUM(rate_limited), SUM(prompt_tokens),
+			SUM(completion_tokens), SUM(total_tokens), MAX(account_email), SUM(aborted_requests)
+		FROM usage_daily
+		WHERE day < ?
+		GROUP BY substr(day, 1, 7), provider, credential_fingerprint, model
+		ON CONFLICT(month, provider, credential_fingerprint, model) DO UPDATE SET
+			total_requests = usage_monthly.total_requests + excluded.total_requests,
+			failed_requests = usage_monthly.failed_requests + excluded.failed_requests,
+			rate_limited = usage_monthly.rate_limited + excluded.rate_limited,
+			prompt_tokens = usage_monthly.prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = usage_monthly.completion_tokens + excluded.completion_tokens,
+			total_tokens = usage_monthly.total_tokens + excluded.total_tokens,
+			aborted_requests = usage_monthly.aborted_requests + excluded.aborted_requests,
+			credential_label = CASE
+				WHEN excluded.credential_label != '' THEN excluded.credential_label
+				ELSE usage_monthly.credential_label
+			END,
+			account_email = CASE
+				WHEN excluded.account_email != '' THEN excluded.account_email
+				ELSE usage_monthly.account_email
+			END;
+	`, cutoffDay)
+	if err != nil {
+		return 0, 0, err
+	}
+	if monthly, err = res.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+	if res, err = tx.ExecContext(ctx, `DELETE FROM usage_daily WHERE day < ?`, cutoffDay); err != nil {
+		return 0, 0, err
+	}
+	daily, err = res.RowsAffected()
+	return monthly, daily, err
+}
+
+// expiredRequestClauses returns the WHERE clauses matching usage_requests rows past
+// their credential-specific, provider-specific or default retention. Credential
+// overrides take precedence, so rows of those credentials are excluded from the
+// provider and default clauses.
+func expiredRequestClauses(now time.Time, policy *retentionPolicy) ([]string, [][]any) {
+	credentialDays := policy.credentialRetention()
+	credentials := make([]string, 0, len(credentialDays))
+	for fp := range credentialDays {
+		credentials = append(credentials, fp)
+	}
+	sort.Strings(credentials)
+	notCredential := ""
+	if len(credentials) > 0 {
+		notCredential = ` AND COALESCE(credential_fingerprint, '') NOT IN (?` + strings.Repeat(`, ?`, len(credentials)-1) + `)`
+	}
+	withCredentials := func(args []any) []any {
+		for _, fp := range credentials {
+			args = append(args, fp)
+		}
+		return args
+	}
+
+	providers := make([]string, 0, len(policy.providers))
+	for provider := range policy.providers {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	var (
+		clauses []string
+		args    [][]any
+	)
+	for _, fp := range credentials {
+		clauses = append(clauses, `credential_fingerprint = ? AND timestamp < ?`)
+		args = append(args, []any{fp, retentionCutoff(now, credentialDays[fp])})
+	}
+	for _, provider := range providers {
+		clauses = append(clauses, `LOWER(provider) = ? AND timestamp < ?`+notCredential)
+		args = append(args, withCredentials([]any{provider, retentionCutoff(now, policy.providers[provider])}))
+	}
+	if policy.requestsDays <= 0 {
+		return clauses, args
+	}
+	clause := `timestamp < ?`
+	clauseArgs := []any{retentionCutoff(now, policy.requestsDays)}
+	if len(providers) > 0 {
+		clause += ` AND LOWER(COALESCE(provider, '')) NOT IN (?` + strings.Repeat(`, ?`, len(providers)-1) + `)`
+		for _, provider := range providers {
+			clauseArgs = append(clauseArgs, provider)
+		}
+	}
+	clause += notCredential
+	clauseArgs = withCredentials(clauseArgs)
+	return append(clauses, clause), append(args, clauseArgs)
+}
+
+// deleteExpiredRequests removes usage_requests rows past their credential-specific,
+// provider-specific or default retention and returns how many were deleted. A non-negative maxID limits the
+// deletion to rows up to that ID, i.e. the ones already archived.
+func deleteExpiredRequests(ctx context.Context, tx *sql.Tx, now time.Time, policy *retentionPolicy, maxID int64) (int64, error) {
+	clauses, args := expiredRequestClauses(now, policy)
+	var deleted int64
+	for i, clause := range clauses {
+		query := `DELETE FROM usage_requests WHERE ` + clause
+		if maxID >= 0 {
+			query += ` AND id <= ?`
+			args[i] = append(args[i], maxID)
+		}
+		n, err := execCount(ctx, tx, query, args[i])
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+func retentionCutoff(now time.Time, days int) time.Time {
+	return now.Add(-time.Duration(days) * 24 * time.Hour)
+}
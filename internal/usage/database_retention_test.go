@@ -0,0 +1,306 @@
+package usage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageStoreProviderRetention(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "usage.db")
+	store, err := newUsageStore(DatabaseOptions{
+		Enabled:               true,
+		Path:                  path,
+		RetentionDays:         14,
+		DailyRetentionDays:    365,
+		ProviderRetentionDays: map[string]int{"Claude": 90},
+	})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	old := time.Now().UTC().Add(-30 * 24 * time.Hour)
+	for _, provider := range []string{"claude", "gemini"} {
+		if err := store.insert(dbRecord{Timestamp: old, Provider: provider, Model: "m"}); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	store.applyRetention()
+
+	rows, err := store.db.Query(`SELECT provider FROM usage_requests`)
+	if err != nil {
+		t.Fatalf("query usage_requests failed: %v", err)
+	}
+	defer rows.Close()
+	var remaining []string
+	for rows.Next() {
+		var provider string
+		if err := rows.Scan(&provider); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		remaining = append(remaining, provider)
+	}
+	if len(remaining) != 1 || remaining[0] != "claude" {
+		t.Fatalf("expected only claude detail to survive, got %v", remaining)
+	}
+
+	var dailyRows int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM usage_daily`).Scan(&dailyRows); err != nil {
+		t.Fatalf("query usage_daily failed: %v", err)
+	}
+	if dailyRows != 2 {
+		t.Fatalf("expected daily aggregates to be kept, got %d rows", dailyRows)
+	}
+}
+
+func TestUsageStoreCredentialRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	pinned := CredentialFingerprint("pinned-key")
+	store, err := newUsageStore(DatabaseOptions{
+		Enabled:                 true,
+		Path:                    path,
+		RetentionDays:           14,
+		ProviderRetentionDays:   map[string]int{"claude": 90},
+		CredentialRetentionDays: map[string]int{"personal.json": 1, pinned: 60},
+	})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	records := []dbRecord{
+		{Timestamp: now.Add(-2 * 24 * time.Hour), Provider: "claude", Model: "personal", CredentialFingerprint: CredentialFingerprint("personal.json")},
+		{Timestamp: now.Add(-2 * 24 * time.Hour), Provider: "claude", Model: "team", CredentialFingerprint: CredentialFingerprint("team.json")},
+		{Timestamp: now.Add(-30 * 24 * time.Hour), Provider: "gemini", Model: "pinned", CredentialFingerprint: pinned},
+		{Timestamp: now.Add(-30 * 24 * time.Hour), Provider: "gemini", Model: "other", CredentialFingerprint: CredentialFingerprint("other-key")},
+	}
+	for _, rec := range records {
+		if err := store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	store.applyRetention()
+
+	rows, err := store.db.Query(`SELECT model FROM usage_requests ORDER BY model`)
+	if err != nil {
+		t.Fatalf("query usage_requests failed: %v", err)
+	}
+	defer rows.Close()
+	var remaining []string
+	for rows.Next() {
+		var model string
+		if err := rows.Scan(&model); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		remaining = append(remaining, model)
+	}
+	if fmt.Sprint(remaining) != "[pinned team]" {
+		t.Fatalf("expected pinned and team detail to survive, got %v", remaining)
+	}
+
+	days := store.retention.Load().credentialRetention()
+	if days[CredentialFingerprint("personal.json")] != 1 || days[pinned] != 60 {
+		t.Fatalf("unexpected resolved credential retention: %v", days)
+	}
+}
+
+func TestUsageStoreCompactsDailyIntoMonthly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: path, RetentionDays: 14})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	old := time.Date(now.Year()-1, now.Month(), 10, 12, 0, 0, 0, time.UTC)
+	records := []dbRecord{
+		{Timestamp: old, Provider: "claude", Model: "m", CredentialFingerprint: "fp", Tokens: TokenStats{TotalTokens: 10}},
+		{Timestamp: old.Add(24 * time.Hour), Provider: "claude", Model: "m", CredentialFingerprint: "fp", Failed: true, Tokens: TokenStats{TotalTokens: 5}},
+		{Timestamp: now, Provider: "claude", Model: "m", CredentialFingerprint: "fp", Tokens: TokenStats{TotalTokens: 1}},
+	}
+	for _, rec := range records {
+		if err := store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	store.applyRetention()
+	// A second pass must not double count already compacted months.
+	store.applyRetention()
+
+	var dailyRows int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM usage_daily`).Scan(&dailyRows); err != nil {
+		t.Fatalf("query usage_daily failed: %v", err)
+	}
+	if dailyRows != 1 {
+		t.Fatalf("expected only the recent daily row to remain, got %d", dailyRows)
+	}
+
+	var requests, failed, tokens int64
+	if err := store.db.QueryRow(`SELECT total_requests, failed_requests, total_tokens FROM usage_monthly WHERE month = ?`,
+		old.Format("2006-01")).Scan(&requests, &failed, &tokens); err != nil {
+		t.Fatalf("query usage_monthly failed: %v", err)
+	}
+	if requests != 2 || failed != 1 || tokens != 15 {
+		t.Fatalf("unexpected monthly rollup: requests=%d failed=%d tokens=%d", requests, failed, tokens)
+	}
+
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	rows, err := QueryMonthlyUsage(context.Background(), old, "CLAUDE")
+	if err != nil {
+		t.Fatalf("QueryMonthlyUsage failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Month != now.Format("2006-01") || rows[1].TotalRequests != 2 || rows[1].TotalTokens != 15 {
+		t.Fatalf("unexpected monthly rows: %+v", rows)
+	}
+}
+
+func TestUsageStoreRetentionDryRun(t *testing.T) {
+	t.Parallel()
+
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db"), RetentionDays: 14})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC()
+	old := now.Add(-30 * 24 * time.Hour)
+	for _, rec := range []dbRecord{
+		{Timestamp: old, Provider: "claude", Model: "m", CredentialFingerprint: "fp", Tags: []string{"coding"}},
+		{Timestamp: now, Provider: "claude", Model: "m", CredentialFingerprint: "fp"},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	dry, err := store.runRetention(ctx, now, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	want := RetentionResult{DryRun: true, Requests: 1, RequestTags: 1, DailyRows: 1, MonthlyRows: 1}
+	if dry != want {
+		t.Fatalf("dry run = %+v, want %+v", dry, want)
+	}
+	var requests int
+	if err = store.db.QueryRow(`SELECT COUNT(*) FROM usage_requests`).Scan(&requests); err != nil || requests != 2 {
+		t.Fatalf("dry run must not delete rows: count=%d err=%v", requests, err)
+	}
+
+	result, err := store.runRetention(ctx, now, false)
+	if err != nil {
+		t.Fatalf("retention failed: %v", err)
+	}
+	want.DryRun = false
+	if result != want {
+		t.Fatalf("retention = %+v, want %+v", result, want)
+	}
+	if err = store.db.QueryRow(`SELECT COUNT(*) FROM usage_requests`).Scan(&requests); err != nil || requests != 1 {
+		t.Fatalf("expected one request row to remain: count=%d err=%v", requests, err)
+	}
+}
+
+type fakeArchiveUploader struct {
+	err     error
+	objects map[string][]byte
+}
+
+func (u *fakeArchiveUploader) upload(_ context.Context, key string, r io.Reader, size int64) error {
+	if u.err != nil {
+		return u.err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("read %d bytes, announced %d", len(data), size)
+	}
+	u.objects[key] = data
+	return nil
+}
+
+func TestUsageStoreArchivesBeforeRetention(t *testing.T) {
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db"), RetentionDays: 14})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	uploader := &fakeArchiveUploader{err: errors.New("bucket unreachable"), objects: map[string][]byte{}}
+	currentArchiver.Store(&usageArchiver{opts: normalizeArchiveOptions(ArchiveOptions{Enabled: true, Prefix: "/prod/"}), uploader: uploader})
+	defer currentArchiver.Store(nil)
+
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-30 * 24 * time.Hour)
+	for _, rec := range []dbRecord{
+		{Timestamp: old, Provider: "claude", Model: "m1"},
+		{Timestamp: old, Provider: "gemini", Model: "m2"},
+		{Timestamp: now, Provider: "claude", Model: "m3"},
+	} {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	countRequests := func() int {
+		var n int
+		if errCount := store.db.QueryRow(`SELECT COUNT(*) FROM usage_requests`).Scan(&n); errCount != nil {
+			t.Fatalf("count failed: %v", errCount)
+		}
+		return n
+	}
+
+	if _, err = store.runRetention(context.Background(), now, false); err == nil {
+		t.Fatal("expected a failed upload to abort retention")
+	}
+	if n := countRequests(); n != 3 {
+		t.Fatalf("expected rows to be kept after a failed upload, got %d", n)
+	}
+
+	uploader.err = nil
+	result, err := store.runRetention(context.Background(), now, false)
+	if err != nil {
+		t.Fatalf("retention failed: %v", err)
+	}
+	wantKey := "prod/usage_requests/2026/03/04/usage-requests-1-2.jsonl.gz"
+	if result.Archived != 2 || result.Requests != 2 || result.ArchiveObject != wantKey {
+		t.Fatalf("unexpected retention result: %+v", result)
+	}
+	if n := countRequests(); n != 1 {
+		t.Fatalf("expected only the recent row to remain, got %d", n)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(uploader.objects[wantKey]))
+	if err != nil {
+		t.Fatalf("archive is not gzip: %v", err)
+	}
+	var models []string
+	for dec := json.NewDecoder(gz); dec.More(); {
+		var rec ExportRecord
+		if err = dec.Decode(&rec); err != nil {
+			t.Fatalf("decode archived record: %v", err)
+		}
+		models = append(models, rec.Model)
+	}
+	if len(models) != 2 || models[0] != "m1" || models[1] != "m2" {
+		t.Fatalf("unexpected archived records: %v", models)
+	}
+	if status := CurrentArchiveStatus(); status.Objects != 1 || status.Rows != 2 || status.Uploads.Errors != 1 || status.LastObject != wantKey {
+		t.Fatalf("unexpected archive status: %+v", status)
+	}
+}
@@ -0,0 +1,190 @@
+package usage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/shadow"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	shadow.RegisterRecorder(RecordShadowComparison)
+}
+
+// RecordShadowComparison stores one shadow traffic comparison. It is a no-op while
+// the database is disabled or opened read-only. Deltas are shadow minus primary.
+func RecordShadowComparison(ctx context.Context, c shadow.Comparison) {
+	store := currentUsageStore.Load()
+	if store == nil || store.readOnly {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timestamp := c.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	p, s := c.Primary, c.Shadow
+	_, err := store.db.ExecContext(ctx, `
+		INSERT INTO shadow_comparisons (
+			timestamp, rule, request_id, api_key_hash,
+			primary_model, primary_status, primary_latency_ms, primary_input_tokens,
+			primary_output_tokens, primary_error, primary_response,
+			shadow_model, shadow_status, shadow_latency_ms, shadow_input_tokens,
+			shadow_output_tokens, shadow_error, shadow_response,
+			latency_delta_ms, output_token_delta
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		timestamp.UTC(), c.Rule, c.RequestID, fingerprint(c.APIKey),
+		p.Model, p.StatusCode, p.Latency.Milliseconds(), p.InputTokens,
+		p.OutputTokens, p.Error, p.Response,
+		s.Model, s.StatusCode, s.Latency.Milliseconds(), s.InputTokens,
+		s.OutputTokens, s.Error, s.Response,
+		(s.Latency - p.Latency).Milliseconds(), s.OutputTokens-p.OutputTokens)
+	if err != nil {
+		log.WithError(err).Warn("usage: failed to store shadow comparison")
+	}
+}
+
+// ShadowSide is one side of a stored shadow comparison.
+type ShadowSide struct {
+	Model        string `json:"model"`
+	StatusCode   int    `json:"status_code"`
+	LatencyMs    int64  `json:"latency_ms"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	Error        string `json:"error,omitempty"`
+	Response     string `json:"response,omitempty"`
+}
+
+// ShadowComparisonRow is a stored comparison between a primary response and its shadow.
+type ShadowComparisonRow struct {
+	Timestamp        string     `json:"timestamp"`
+	Rule             string     `json:"rule"`
+	RequestID        string     `json:"request_id,omitempty"`
+	APIKeyHash       string     `json:"api_key_hash,omitempty"`
+	Primary          ShadowSide `json:"primary"`
+	Shadow           ShadowSide `json:"shadow"`
+	LatencyDeltaMs   int64      `json:"latency_delta_ms"`
+	OutputTokenDelta int64      `json:"output_token_delta"`
+}
+
+// QueryShadowComparisons returns the comparisons at or after since, newest first,
+// optionally filtered by rule. Response bodies are only loaded with withResponses.
+func QueryShadowComparisons(ctx context.Context, since time.Time, rule string, limit int, withResponses bool) ([]ShadowComparisonRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	responses := `'', ''`
+	if withResponses {
+		responses = `primary_response, shadow_response`
+	}
+	query := `
+		SELECT CAST(timestamp AS TEXT), rule, request_id, api_key_hash,
+			primary_model, primary_status, primary_latency_ms, primary_input_tokens, primary_output_tokens, primary_error,
+			shadow_model, shadow_status, shadow_latency_ms, shadow_input_tokens, shadow_output_tokens, shadow_error,
+			latency_delta_ms, output_token_delta, ` + responses + `
+		FROM shadow_comparisons
+		WHERE timestamp >= ?`
+	args := []any{since.UTC()}
+	if rule = strings.TrimSpace(rule); rule != "" {
+		query += ` AND rule = ?`
+		args = append(args, rule)
+	}
+	query += ` ORDER BY timestamp DESC, id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]ShadowComparisonRow, 0)
+	for rows.Next() {
+		var row ShadowComparisonRow
+		p, s := &row.Primary, &row.Shadow
+		if err := rows.Scan(&row.Timestamp, &row.Rule, &row.RequestID, &row.APIKeyHash,
+			&p.Model, &p.StatusCode, &p.LatencyMs, &p.InputTokens, &p.OutputTokens, &p.Error,
+			&s.Model, &s.StatusCode, &s.LatencyMs, &s.InputTokens, &s.OutputTokens, &s.Error,
+			&row.LatencyDeltaMs, &row.OutputTokenDelta, &p.Response, &s.Response); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// ShadowSummaryRow aggregates the comparisons of one rule and model pair.
+type ShadowSummaryRow struct {
+	Rule         string `json:"rule"`
+	PrimaryModel string `json:"primary_model"`
+	ShadowModel  string `json:"shadow_model"`
+	Comparisons  int64  `json:"comparisons"`
+	// PrimaryErrors and ShadowErrors count sides that failed or returned a non-2xx status.
+	PrimaryErrors          int64   `json:"primary_errors"`
+	ShadowErrors           int64   `json:"shadow_errors"`
+	AvgPrimaryLatencyMs    float64 `json:"avg_primary_latency_ms"`
+	AvgShadowLatencyMs     float64 `json:"avg_shadow_latency_ms"`
+	AvgLatencyDeltaMs      float64 `json:"avg_latency_delta_ms"`
+	AvgPrimaryOutputTokens float64 `json:"avg_primary_output_tokens"`
+	AvgShadowOutputTokens  float64 `json:"avg_shadow_output_tokens"`
+	AvgOutputTokenDelta    float64 `json:"avg_output_token_delta"`
+}
+
+// QueryShadowSummary aggregates the comparisons at or after since by rule and model
+// pair. Averages only include comparisons where both sides succeeded, so failures do
+// not skew the latency and token deltas.
+func QueryShadowSummary(ctx context.Context, since time.Time) ([]ShadowSummaryRow, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rows, err := store.db.QueryContext(ctx, `
+		SELECT rule, primary_model, shadow_model, COUNT(*),
+			SUM(CASE WHEN primary_error <> '' OR primary_status NOT BETWEEN 200 AND 299 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN shadow_error <> '' OR shadow_status NOT BETWEEN 200 AND 299 THEN 1 ELSE 0 END),
+			COALESCE(AVG(CASE WHEN ok THEN primary_latency_ms END), 0),
+			COALESCE(AVG(CASE WHEN ok THEN shadow_latency_ms END), 0),
+			COALESCE(AVG(CASE WHEN ok THEN latency_delta_ms END), 0),
+			COALESCE(AVG(CASE WHEN ok THEN primary_output_tokens END), 0),
+			COALESCE(AVG(CASE WHEN ok THEN shadow_output_tokens END), 0),
+			COALESCE(AVG(CASE WHEN ok THEN output_token_delta END), 0)
+		FROM (
+			SELECT *, (primary_error = '' AND shadow_error = ''
+				AND primary_status BETWEEN 200 AND 299 AND shadow_status BETWEEN 200 AND 299) AS ok
+			FROM shadow_comparisons
+			WHERE timestamp >= ?
+		)
+		GROUP BY rule, primary_model, shadow_model
+		ORDER BY rule ASC, COUNT(*) DESC;`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]ShadowSummaryRow, 0)
+	for rows.Next() {
+		var row ShadowSummaryRow
+		if err := rows.Scan(&row.Rule, &row.PrimaryModel, &row.ShadowModel, &row.Comparisons,
+			&row.PrimaryErrors, &row.ShadowErrors, &row.AvgPrimaryLatencyMs, &row.AvgShadowLatencyMs,
+			&row.AvgLatencyDeltaMs, &row.AvgPrimaryOutputTokens, &row.AvgShadowOutputTokens,
+			&row.AvgOutputTokenDelta); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
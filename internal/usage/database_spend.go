@@ -0,0 +1,543 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/redisstate"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/team"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// RejectionSpendCap marks requests rejected because the client key is suspended
+// for exceeding its monthly spending cap.
+const RejectionSpendCap = "spend_cap_exceeded"
+
+// ErrUnknownSpendKey is returned when resetting a key that has no spending cap or suspension.
+var ErrUnknownSpendKey = errors.New("usage: api key has no spending cap")
+
+// teamSpendPrefix marks spend subjects that are teams rather than key hashes. Team
+// caps share the caps map and usage_spend_caps with key caps; hashes are hex, so the
+// two never collide.
+const teamSpendPrefix = "team:"
+
+// SpendSuspension describes a client key suspended for exceeding its monthly cap,
+// or a team suspended for exceeding the combined cap of its keys.
+type SpendSuspension struct {
+	APIKeyHash  string    `json:"api_key_hash,omitempty"`
+	Team        string    `json:"team,omitempty"`
+	Month       string    `json:"month"`
+	SpendUSD    float64   `json:"spend_usd"`
+	CapUSD      float64   `json:"cap_usd"`
+	SuspendedAt time.Time `json:"suspended_at"`
+}
+
+// SpendCapStatus reports the current month's spend of one capped client key or team.
+type SpendCapStatus struct {
+	APIKeyHash  string     `json:"api_key_hash,omitempty"`
+	Team        string     `json:"team,omitempty"`
+	CapUSD      float64    `json:"cap_usd"`
+	SpendUSD    float64    `json:"spend_usd"`
+	Suspended   bool       `json:"suspended"`
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	// ResetAt is the last admin reset; spend is counted from it when it falls in the current month.
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+}
+
+// spendState tracks per-key monthly caps and the keys suspended for exceeding them.
+type spendState struct {
+	// mu serialises cap checks so a key is suspended at most once.
+	mu        sync.Mutex
+	caps      atomic.Pointer[map[string]float64]
+	suspended atomic.Pointer[map[string]SpendSuspension]
+}
+
+// SpendCapsFromConfig collects the monthly spending caps of client API key policies,
+// keyed by client API key.
+func SpendCapsFromConfig(policies []config.APIKeyPolicy) map[string]float64 {
+	var out map[string]float64
+	for _, p := range policies {
+		key := strings.TrimSpace(p.APIKey)
+		if key == "" || p.MonthlySpendCap <= 0 {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]float64)
+		}
+		out[key] = p.MonthlySpendCap
+	}
+	return out
+}
+
+// TeamSpendCapsFromConfig collects the monthly spending caps of teams, keyed by team name.
+func TeamSpendCapsFromConfig(teams []config.Team) map[string]float64 {
+	var out map[string]float64
+	for _, t := range teams {
+		name := strings.TrimSpace(t.Name)
+		if name == "" || t.MonthlySpendCap <= 0 {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]float64)
+		}
+		out[name] = t.MonthlySpendCap
+	}
+	return out
+}
+
+// APIKeyHash returns the api_key_hash recorded for a client API key.
+func APIKeyHash(apiKey string) string {
+	return fingerprint(apiKey)
+}
+
+// CheckSpendSuspension reports whether apiKey is suspended for exceeding its
+// monthly spending cap or its team's. It is cheap enough to call on every request.
+func CheckSpendSuspension(apiKey string) (SpendSuspension, bool) {
+	store := currentUsageStore.Load()
+	if store == nil || apiKey == "" {
+		return SpendSuspension{}, false
+	}
+	if s, ok := store.checkSuspended(fingerprint(apiKey)); ok {
+		return s, true
+	}
+	if name := team.Lookup(apiKey); name != "" {
+		return store.checkSuspended(teamSpendSubject(name))
+	}
+	return SpendSuspension{}, false
+}
+
+func (s *usageStore) checkSuspended(subject string) (SpendSuspension, bool) {
+	suspended := s.spend.suspended.Load()
+	if suspended == nil {
+		return SpendSuspension{}, false
+	}
+	entry, ok := (*suspended)[subject]
+	if ok && redisstate.Active() != nil {
+		// Only suspended subjects pay for the round trip that picks up resets made
+		// on other instances.
+		s.syncSharedReset(context.Background(), subject)
+		entry, ok = s.suspendedKeys()[subject]
+	}
+	return entry, ok
+}
+
+func teamSpendSubject(name string) string {
+	return teamSpendPrefix + name
+}
+
+// spendSubjectLabel names a spend subject in log lines.
+func spendSubjectLabel(subject string) string {
+	if name, ok := strings.CutPrefix(subject, teamSpendPrefix); ok {
+		return "team " + name
+	}
+	return "api key " + shortHash(subject)
+}
+
+// setSpendSubject fills the key hash or team of a status from its spend subject.
+func setSpendSubject(subject string, hash, name *string) {
+	if teamName, ok := strings.CutPrefix(subject, teamSpendPrefix); ok {
+		*name = teamName
+		return
+	}
+	*hash = subject
+}
+
+// SpendCaps lists every capped key with its spend for the current month, along
+// with suspended keys whose cap has since been removed from the configuration.
+func SpendCaps(ctx context.Context) ([]SpendCapStatus, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	caps := store.spendCaps()
+	suspended := store.suspendedKeys()
+	hashes := make([]string, 0, len(caps)+len(suspended))
+	for hash := range caps {
+		hashes = append(hashes, hash)
+	}
+	for hash := range suspended {
+		if _, capped := caps[hash]; !capped {
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+
+	now := time.Now().UTC()
+	out := make([]SpendCapStatus, 0, len(hashes))
+	for _, hash := range hashes {
+		status := SpendCapStatus{CapUSD: caps[hash]}
+		setSpendSubject(hash, &status.APIKeyHash, &status.Team)
+		spend, resetAt, err := store.monthlySpend(ctx, hash, now)
+		if err != nil {
+			return nil, err
+		}
+		if shared, ok := sharedSpend(ctx, hash, now); ok && shared > spend {
+			spend = shared
+		}
+		status.SpendUSD = spend
+		if !resetAt.IsZero() {
+			status.ResetAt = &resetAt
+		}
+		if s, ok := suspended[hash]; ok {
+			status.Suspended = true
+			at := s.SuspendedAt
+			status.SuspendedAt = &at
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+// ResetSpendCap lifts the suspension of a key and restarts its spend count from
+// now, giving it its full cap again for the rest of the month.
+func ResetSpendCap(ctx context.Context, apiKeyHash string) error {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return ErrDatabaseDisabled
+	}
+	if store.readOnly {
+		return ErrReadOnly
+	}
+	return store.resetSpendCap(ctx, strings.ToLower(strings.TrimSpace(apiKeyHash)), time.Now().UTC())
+}
+
+// ResetTeamSpendCap lifts the suspension of a team and restarts its spend count
+// from now.
+func ResetTeamSpendCap(ctx context.Context, name string) error {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return ErrDatabaseDisabled
+	}
+	if store.readOnly {
+		return ErrReadOnly
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrUnknownSpendKey
+	}
+	return store.resetSpendCap(ctx, teamSpendSubject(name), time.Now().UTC())
+}
+
+func (s *usageStore) spendCaps() map[string]float64 {
+	if caps := s.spend.caps.Load(); caps != nil {
+		return *caps
+	}
+	return nil
+}
+
+func (s *usageStore) suspendedKeys() map[string]SpendSuspension {
+	if suspended := s.spend.suspended.Load(); suspended != nil {
+		return *suspended
+	}
+	return nil
+}
+
+// setSpendCaps stores key caps keyed by api_key_hash, matching usage_requests rows,
+// and team caps keyed by their team subject.
+func (s *usageStore) setSpendCaps(caps, teamCaps map[string]float64) {
+	hashed := make(map[string]float64, len(caps)+len(teamCaps))
+	for key, limit := range caps {
+		hashed[fingerprint(key)] = limit
+	}
+	for name, limit := range teamCaps {
+		hashed[teamSpendSubject(name)] = limit
+	}
+	s.spend.caps.Store(&hashed)
+}
+
+// loadSpendSuspensions reads persisted suspensions so they survive restarts.
+func (s *usageStore) loadSpendSuspensions() error {
+	rows, err := s.db.Query(`
+		SELECT api_key_hash, month, spend_usd, cap_usd, suspended_at
+		FROM usage_spend_caps
+		WHERE suspended_at IS NOT NULL;`)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	suspended := make(map[string]SpendSuspension)
+	for rows.Next() {
+		var entry SpendSuspension
+		var subject string
+		if err = rows.Scan(&subject, &entry.Month, &entry.SpendUSD, &entry.CapUSD, &entry.SuspendedAt); err != nil {
+			return err
+		}
+		setSpendSubject(subject, &entry.APIKeyHash, &entry.Team)
+		suspended[subject] = entry
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	s.spend.suspended.Store(&suspended)
+	return nil
+}
+
+// monthlySpend returns the priced spend of a key or team subject for the month
+// containing now, counted from the last admin reset when that falls inside the
+// month. Requests removed by retention no longer count, so requests-retention-days
+// should cover a full month when caps are used.
+func (s *usageStore) monthlySpend(ctx context.Context, subject string, now time.Time) (float64, time.Time, error) {
+	since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var resetAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `SELECT reset_at FROM usage_spend_caps WHERE api_key_hash = ?`, subject).Scan(&resetAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, err
+	}
+	if resetAt.Valid && resetAt.Time.After(since) {
+		since = resetAt.Time.UTC()
+	}
+	column, value := "r.api_key_hash", subject
+	if name, ok := strings.CutPrefix(subject, teamSpendPrefix); ok {
+		column, value = "r.team", name
+	}
+	var spend float64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(COALESCE(r.prompt_tokens, 0) * p.input_per_million
+			+ COALESCE(r.completion_tokens, 0) * p.output_per_million), 0) / 1000000.0
+		FROM usage_requests AS r
+		JOIN usage_model_prices AS p ON p.model = LOWER(r.model)
+		WHERE `+column+` = ? AND r.timestamp >= ?;`, value, since).Scan(&spend)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if resetAt.Valid {
+		return spend, resetAt.Time.UTC(), nil
+	}
+	return spend, time.Time{}, nil
+}
+
+// checkSpendCap suspends the key of rec, or its team, once their spend for the
+// month reaches the cap. It runs on the writer goroutine after each insert. With
+// Redis configured the spend of every instance counts; while Redis is unreachable
+// only local rows do.
+func (s *usageStore) checkSpendCap(rec dbRecord) {
+	if rec.APIKeyHash != "" {
+		s.checkSubjectSpendCap(rec, rec.APIKeyHash)
+	}
+	if rec.Team != "" {
+		s.checkSubjectSpendCap(rec, teamSpendSubject(rec.Team))
+	}
+}
+
+func (s *usageStore) checkSubjectSpendCap(rec dbRecord, subject string) {
+	limit, capped := s.spendCaps()[subject]
+	if !capped {
+		return
+	}
+	ctx := context.Background()
+	s.syncSharedReset(ctx, subject)
+	shared, sharedOK := s.recordSharedSpend(ctx, rec, subject)
+	s.spend.mu.Lock()
+	defer s.spend.mu.Unlock()
+	if _, already := s.suspendedKeys()[subject]; already {
+		return
+	}
+	at := rec.Timestamp.UTC()
+	spend, _, err := s.monthlySpend(ctx, subject, at)
+	if err != nil {
+		log.WithError(err).Warn("usage: failed to compute key spend")
+		return
+	}
+	if sharedOK && shared > spend {
+		spend = shared
+	}
+	if spend < limit {
+		return
+	}
+	entry := SpendSuspension{
+		Month:       at.Format("2006-01"),
+		SpendUSD:    spend,
+		CapUSD:      limit,
+		SuspendedAt: time.Now().UTC(),
+	}
+	setSpendSubject(subject, &entry.APIKeyHash, &entry.Team)
+	if _, err = s.db.Exec(`
+		INSERT INTO usage_spend_caps (api_key_hash, month, spend_usd, cap_usd, suspended_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(api_key_hash) DO UPDATE SET
+			month = excluded.month,
+			spend_usd = excluded.spend_usd,
+			cap_usd = excluded.cap_usd,
+			suspended_at = excluded.suspended_at;`,
+		subject, entry.Month, entry.SpendUSD, entry.CapUSD, entry.SuspendedAt); err != nil {
+		log.WithError(err).Warn("usage: failed to persist key suspension")
+	}
+	next := maps.Clone(s.suspendedKeys())
+	if next == nil {
+		next = make(map[string]SpendSuspension)
+	}
+	next[subject] = entry
+	s.spend.suspended.Store(&next)
+	log.Warnf("usage: %s suspended after spending $%.2f of its $%.2f monthly cap", spendSubjectLabel(subject), spend, limit)
+	events.Publish(spendCapEvent(entry))
+}
+
+// spendCapEvent describes the suspension of a client key or team as a budget event.
+func spendCapEvent(entry SpendSuspension) events.Event {
+	data := map[string]any{
+		"scope":     "api_key",
+		"month":     entry.Month,
+		"spend_usd": entry.SpendUSD,
+		"cap_usd":   entry.CapUSD,
+	}
+	if entry.Team != "" {
+		data["scope"] = "team"
+		data["team"] = entry.Team
+	} else {
+		data["api_key_hash"] = entry.APIKeyHash
+	}
+	return events.Event{
+		Type:   events.BudgetCrossed,
+		Time:   entry.SuspendedAt,
+		Reason: "monthly spend cap reached",
+		Data:   data,
+	}
+}
+
+func (s *usageStore) resetSpendCap(ctx context.Context, apiKeyHash string, now time.Time) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s.spend.mu.Lock()
+	defer s.spend.mu.Unlock()
+	_, capped := s.spendCaps()[apiKeyHash]
+	_, suspended := s.suspendedKeys()[apiKeyHash]
+	if apiKeyHash == "" || (!capped && !suspended) {
+		return ErrUnknownSpendKey
+	}
+	if err := s.applySpendReset(ctx, apiKeyHash, now); err != nil {
+		return err
+	}
+	if store := redisstate.Active(); store != nil {
+		// Other instances pick the reset up from the marker; the shared counter restarts.
+		err := store.SetTime(ctx, spendResetKey(store, apiKeyHash), now, spendCounterTTL)
+		if err == nil {
+			err = store.Delete(ctx, spendCounterKey(store, apiKeyHash, now))
+		}
+		if err != nil {
+			log.WithError(err).Warn("usage: failed to share spending cap reset")
+		}
+	}
+	log.Infof("usage: spending cap of %s reset", spendSubjectLabel(apiKeyHash))
+	return nil
+}
+
+// applySpendReset lifts a suspension and restarts the key's spend count at at. The
+// caller holds s.spend.mu.
+func (s *usageStore) applySpendReset(ctx context.Context, apiKeyHash string, at time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO usage_spend_caps (api_key_hash, month, spend_usd, cap_usd, suspended_at, reset_at)
+		VALUES (?, '', 0, 0, NULL, ?)
+		ON CONFLICT(api_key_hash) DO UPDATE SET suspended_at = NULL, reset_at = excluded.reset_at;`,
+		apiKeyHash, at); err != nil {
+		return err
+	}
+	next := maps.Clone(s.suspendedKeys())
+	delete(next, apiKeyHash)
+	s.spend.suspended.Store(&next)
+	return nil
+}
+
+// spendCounterTTL keeps shared spend counters and reset markers a few days past the
+// month they belong to.
+const spendCounterTTL = 35 * 24 * time.Hour
+
+func spendCounterKey(store *redisstate.Store, apiKeyHash string, at time.Time) string {
+	return store.Key("spend", apiKeyHash, at.UTC().Format("2006-01"))
+}
+
+func spendResetKey(store *redisstate.Store, apiKeyHash string) string {
+	return store.Key("spend-reset", apiKeyHash)
+}
+
+// recordSharedSpend adds the priced cost of rec to the shared monthly counter of
+// subject and returns the new total. ok is false when Redis is not configured or
+// unreachable.
+func (s *usageStore) recordSharedSpend(ctx context.Context, rec dbRecord, subject string) (float64, bool) {
+	store := redisstate.Active()
+	if store == nil {
+		return 0, false
+	}
+	var cost float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT (? * input_per_million + ? * output_per_million) / 1000000.0
+		FROM usage_model_prices WHERE model = LOWER(?);`,
+		rec.Tokens.InputTokens, rec.Tokens.OutputTokens, rec.Model).Scan(&cost)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.WithError(err).Warn("usage: failed to price request for shared spend")
+		return 0, false
+	}
+	key := spendCounterKey(store, subject, rec.Timestamp)
+	var total float64
+	if cost > 0 {
+		total, err = store.AddFloat(ctx, key, cost, spendCounterTTL)
+	} else {
+		total, err = store.GetFloat(ctx, key)
+	}
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}
+
+// sharedSpend returns a key's spend for the month of now across all instances.
+func sharedSpend(ctx context.Context, apiKeyHash string, now time.Time) (float64, bool) {
+	store := redisstate.Active()
+	if store == nil {
+		return 0, false
+	}
+	total, err := store.GetFloat(ctx, spendCounterKey(store, apiKeyHash, now))
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}
+
+// syncSharedReset applies a spending cap reset made on another instance: when the
+// reset recorded in Redis is newer than the local one it is persisted locally, which
+// also lifts a local suspension.
+func (s *usageStore) syncSharedReset(ctx context.Context, apiKeyHash string) {
+	store := redisstate.Active()
+	if store == nil || s.readOnly {
+		return
+	}
+	resetAt, err := store.GetTime(ctx, spendResetKey(store, apiKeyHash))
+	if err != nil || resetAt.IsZero() {
+		return
+	}
+	s.spend.mu.Lock()
+	defer s.spend.mu.Unlock()
+	var local sql.NullTime
+	err = s.db.QueryRowContext(ctx, `SELECT reset_at FROM usage_spend_caps WHERE api_key_hash = ?`, apiKeyHash).Scan(&local)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.WithError(err).Warn("usage: failed to read spending cap reset")
+		return
+	}
+	if local.Valid && !local.Time.Before(resetAt) {
+		return
+	}
+	if err = s.applySpendReset(ctx, apiKeyHash, resetAt); err != nil {
+		log.WithError(err).Warn("usage: failed to apply shared spending cap reset")
+		return
+	}
+	log.Infof("usage: spending cap of %s reset on another instance", spendSubjectLabel(apiKeyHash))
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
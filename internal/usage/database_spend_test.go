@@ -0,0 +1,230 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/providerspend"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/team"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+func TestUsageStoreSpendCapSuspendsAndResets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	opts := DatabaseOptions{
+		Enabled:     true,
+		Path:        path,
+		ModelPrices: map[string]ModelPrice{"gpt-x": {InputPerMillion: 10, OutputPerMillion: 30}},
+		SpendCaps:   SpendCapsFromConfig([]config.APIKeyPolicy{{APIKey: "sk-capped", MonthlySpendCap: 1}, {APIKey: "sk-free"}}),
+	}
+	store, err := newUsageStore(normalizeDatabaseOptions(opts))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	now := time.Now().UTC()
+	capped := APIKeyHash("sk-capped")
+	// 50k input tokens at $10/M and 10k output tokens at $30/M cost $0.80.
+	rec := dbRecord{Timestamp: now, Provider: "openai", Model: "GPT-X", APIKeyHash: capped, Tokens: TokenStats{InputTokens: 50000, OutputTokens: 10000}}
+	if err = store.insert(rec); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if _, suspended := CheckSpendSuspension("sk-capped"); suspended {
+		t.Fatal("key suspended before reaching its cap")
+	}
+	if err = store.insert(rec); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	suspension, suspended := CheckSpendSuspension("sk-capped")
+	if !suspended || suspension.CapUSD != 1 || suspension.SpendUSD < 1.59 || suspension.SpendUSD > 1.61 {
+		t.Fatalf("expected suspension at $1.60, got %+v (suspended=%v)", suspension, suspended)
+	}
+	if _, suspended = CheckSpendSuspension("sk-free"); suspended {
+		t.Fatal("uncapped key must not be suspended")
+	}
+
+	// Suspensions survive reopening the database.
+	store.close()
+	if store, err = newUsageStore(normalizeDatabaseOptions(opts)); err != nil {
+		t.Fatalf("failed to reopen usage store: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	if _, suspended = CheckSpendSuspension("sk-capped"); !suspended {
+		t.Fatal("suspension lost after reopening the store")
+	}
+
+	ctx := context.Background()
+	if err = ResetSpendCap(ctx, APIKeyHash("sk-unknown")); !errors.Is(err, ErrUnknownSpendKey) {
+		t.Fatalf("expected ErrUnknownSpendKey, got %v", err)
+	}
+	if err = ResetSpendCap(ctx, capped); err != nil {
+		t.Fatalf("ResetSpendCap failed: %v", err)
+	}
+	if _, suspended = CheckSpendSuspension("sk-capped"); suspended {
+		t.Fatal("key still suspended after reset")
+	}
+	caps, err := SpendCaps(ctx)
+	if err != nil {
+		t.Fatalf("SpendCaps failed: %v", err)
+	}
+	if len(caps) != 1 || caps[0].APIKeyHash != capped || caps[0].SpendUSD != 0 || caps[0].ResetAt == nil || caps[0].Suspended {
+		t.Fatalf("expected spend restarted after reset, got %+v", caps)
+	}
+}
+
+func TestUsageStoreTeamSpendCap(t *testing.T) {
+	teams := []config.Team{{Name: "research", APIKeys: []string{"sk-a", "sk-b"}, MonthlySpendCap: 1}}
+	team.Set(teams)
+	defer team.Set(nil)
+	opts := DatabaseOptions{
+		Enabled:       true,
+		Path:          filepath.Join(t.TempDir(), "usage.db"),
+		ModelPrices:   map[string]ModelPrice{"gpt-x": {InputPerMillion: 10, OutputPerMillion: 30}},
+		TeamSpendCaps: TeamSpendCapsFromConfig(teams),
+	}
+	store, err := newUsageStore(normalizeDatabaseOptions(opts))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	// Each record costs $0.80; neither key reaches $1 alone, the team does.
+	now := time.Now().UTC()
+	for _, key := range []string{"sk-a", "sk-b"} {
+		rec := dbRecord{Timestamp: now, Provider: "openai", Model: "gpt-x", APIKeyHash: APIKeyHash(key), Team: "research",
+			Tokens: TokenStats{InputTokens: 50000, OutputTokens: 10000}}
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	suspension, suspended := CheckSpendSuspension("sk-a")
+	if !suspended || suspension.Team != "research" || suspension.APIKeyHash != "" || suspension.SpendUSD < 1.59 {
+		t.Fatalf("expected the team to be suspended at $1.60, got %+v (suspended=%v)", suspension, suspended)
+	}
+	if _, suspended = CheckSpendSuspension("sk-b"); !suspended {
+		t.Fatal("expected every key of the team to be suspended")
+	}
+	if _, suspended = CheckSpendSuspension("sk-other"); suspended {
+		t.Fatal("keys outside the team must not be suspended")
+	}
+	caps, err := SpendCaps(context.Background())
+	if err != nil || len(caps) != 1 || caps[0].Team != "research" || !caps[0].Suspended {
+		t.Fatalf("unexpected spend caps %+v (%v)", caps, err)
+	}
+
+	if err = ResetTeamSpendCap(context.Background(), "unknown"); !errors.Is(err, ErrUnknownSpendKey) {
+		t.Fatalf("expected ErrUnknownSpendKey, got %v", err)
+	}
+	if err = ResetTeamSpendCap(context.Background(), "research"); err != nil {
+		t.Fatalf("ResetTeamSpendCap failed: %v", err)
+	}
+	if _, suspended = CheckSpendSuspension("sk-a"); suspended {
+		t.Fatal("team still suspended after reset")
+	}
+}
+
+func TestUsageStoreProviderSpendCap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+	opts := DatabaseOptions{
+		Enabled:     true,
+		Path:        path,
+		ModelPrices: map[string]ModelPrice{"gpt-x": {InputPerMillion: 10, OutputPerMillion: 30}},
+	}
+	store, err := newUsageStore(normalizeDatabaseOptions(opts))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	providerspend.SetCaps([]config.ProviderSpendCap{{Provider: "OpenAI", MonthlyCap: 1}})
+	defer providerspend.SetCaps(nil)
+
+	now := time.Now().UTC()
+	// Each record costs $0.80.
+	rec := dbRecord{Timestamp: now, Provider: "openai", Model: "gpt-x", Tokens: TokenStats{InputTokens: 50000, OutputTokens: 10000}}
+	if err = store.insert(rec); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if _, exceeded := providerspend.Check("openai", now); exceeded {
+		t.Fatal("provider marked before reaching its cap")
+	}
+	if err = store.insert(rec); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	entry, exceeded := providerspend.Check("openai", now)
+	if !exceeded || entry.SpendUSD < 1.59 || entry.SpendUSD > 1.61 || entry.Action != providerspend.ActionFallback {
+		t.Fatalf("expected the provider to be capped at $1.60, got %+v (exceeded=%v)", entry, exceeded)
+	}
+	if _, exceeded = providerspend.Check("openai", now.AddDate(0, 1, 0)); exceeded {
+		t.Fatal("caps must reset with the month")
+	}
+
+	// Raising the cap lifts the exceedance once spend is re-evaluated.
+	providerspend.SetCaps([]config.ProviderSpendCap{{Provider: "openai", MonthlyCap: 5}})
+	if err = RefreshProviderSpend(context.Background()); err != nil {
+		t.Fatalf("RefreshProviderSpend failed: %v", err)
+	}
+	if _, exceeded = providerspend.Check("openai", now); exceeded {
+		t.Fatal("provider still capped after raising the cap")
+	}
+	statuses, err := ProviderSpendCaps(context.Background())
+	if err != nil || len(statuses) != 1 || statuses[0].Exceeded || statuses[0].SpendUSD < 1.59 {
+		t.Fatalf("unexpected statuses %+v (%v)", statuses, err)
+	}
+}
+
+func TestSpendCapsPublishBudgetCrossed(t *testing.T) {
+	opts := DatabaseOptions{
+		Enabled:     true,
+		Path:        filepath.Join(t.TempDir(), "usage.db"),
+		ModelPrices: map[string]ModelPrice{"gpt-x": {InputPerMillion: 10, OutputPerMillion: 30}},
+		SpendCaps:   SpendCapsFromConfig([]config.APIKeyPolicy{{APIKey: "sk-capped", MonthlySpendCap: 1}}),
+	}
+	store, err := newUsageStore(normalizeDatabaseOptions(opts))
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+	providerspend.SetCaps([]config.ProviderSpendCap{{Provider: "openai", MonthlyCap: 1}})
+	defer providerspend.SetCaps(nil)
+
+	received := make(chan events.Event, 4)
+	unsubscribe := events.Subscribe(func(evt events.Event) { received <- evt }, events.BudgetCrossed)
+	defer unsubscribe()
+
+	// Each record costs $0.80, so the second one crosses both caps.
+	rec := dbRecord{Timestamp: time.Now().UTC(), Provider: "openai", Model: "gpt-x", APIKeyHash: APIKeyHash("sk-capped"), Tokens: TokenStats{InputTokens: 50000, OutputTokens: 10000}}
+	for i := 0; i < 2; i++ {
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	scopes := make(map[string]events.Event)
+	for len(scopes) < 2 {
+		select {
+		case evt := <-received:
+			scopes[evt.Data["scope"].(string)] = evt
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected budget events for the key and the provider, got %v", scopes)
+		}
+	}
+	if evt := scopes["api_key"]; evt.Data["api_key_hash"] != APIKeyHash("sk-capped") || evt.Data["cap_usd"] != 1.0 {
+		t.Fatalf("unexpected key budget event %+v", evt)
+	}
+	if evt := scopes["provider"]; evt.Provider != "openai" || evt.Data["cap_usd"] != 1.0 {
+		t.Fatalf("unexpected provider budget event %+v", evt)
+	}
+}
@@ -0,0 +1,85 @@
+package usage
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+const (
+	defaultSQLiteJournalMode   = "wal"
+	defaultSQLiteBusyTimeoutMs = 5000
+)
+
+// SQLiteOptions are the pragmas applied to every connection of the usage database.
+// Zero values keep the SQLite defaults, except for WAL journaling and a 5 second
+// busy timeout.
+type SQLiteOptions struct {
+	// JournalMode is one of wal, delete, truncate, persist, memory or off.
+	JournalMode string
+	// Synchronous is one of off, normal, full or extra; empty keeps the SQLite default.
+	Synchronous string
+	// CacheSizeKB is the page cache size per connection in KiB.
+	CacheSizeKB int
+	// BusyTimeoutMs is how long a connection waits for a lock.
+	BusyTimeoutMs int
+	// MmapSizeMB enables memory-mapped I/O of up to this many MiB of the file.
+	MmapSizeMB int
+}
+
+// SQLiteOptionsFromConfig converts the usage-db.sqlite setting.
+func SQLiteOptionsFromConfig(cfg config.UsageSQLiteConfig) SQLiteOptions {
+	return SQLiteOptions(cfg)
+}
+
+func normalizeSQLiteOptions(opts SQLiteOptions) SQLiteOptions {
+	opts.JournalMode = strings.ToLower(strings.TrimSpace(opts.JournalMode))
+	switch opts.JournalMode {
+	case "wal", "delete", "truncate", "persist", "memory", "off":
+	default:
+		opts.JournalMode = defaultSQLiteJournalMode
+	}
+	opts.Synchronous = strings.ToLower(strings.TrimSpace(opts.Synchronous))
+	switch opts.Synchronous {
+	case "off", "normal", "full", "extra":
+	default:
+		opts.Synchronous = ""
+	}
+	if opts.BusyTimeoutMs <= 0 {
+		opts.BusyTimeoutMs = defaultSQLiteBusyTimeoutMs
+	}
+	opts.CacheSizeKB = max(opts.CacheSizeKB, 0)
+	opts.MmapSizeMB = max(opts.MmapSizeMB, 0)
+	return opts
+}
+
+// sqliteDSN builds the connection string of the usage database at path. Read-only
+// connections cannot change the journal mode and never write, so only the lock and
+// read pragmas are applied to them.
+func sqliteDSN(path string, opts SQLiteOptions, readOnly bool) string {
+	opts = normalizeSQLiteOptions(opts)
+	query := url.Values{}
+	// The busy timeout goes first so switching the journal mode waits for locks too.
+	pragmas := []string{fmt.Sprintf("busy_timeout(%d)", opts.BusyTimeoutMs)}
+	if readOnly {
+		query.Set("mode", "ro")
+	} else {
+		pragmas = append(pragmas, fmt.Sprintf("journal_mode(%s)", opts.JournalMode), "foreign_keys(on)")
+		if opts.Synchronous != "" {
+			pragmas = append(pragmas, fmt.Sprintf("synchronous(%s)", opts.Synchronous))
+		}
+		query.Set("_txlock", "immediate")
+	}
+	if opts.CacheSizeKB > 0 {
+		// Negative cache sizes are in KiB rather than pages.
+		pragmas = append(pragmas, fmt.Sprintf("cache_size(-%d)", opts.CacheSizeKB))
+	}
+	if opts.MmapSizeMB > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("mmap_size(%d)", int64(opts.MmapSizeMB)<<20))
+	}
+	query["_pragma"] = pragmas
+	return "file:" + filepath.ToSlash(path) + "?" + query.Encode()
+}
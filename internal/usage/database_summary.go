@@ -0,0 +1,98 @@
+package usage
+
+import (
+	"sort"
+	"time"
+)
+
+// SummaryWindows lists the rolling windows reported by SummarizeDaily, in display order.
+var SummaryWindows = []string{"today", "7d", "30d"}
+
+// SummaryTotals aggregates requests and tokens for one window.
+type SummaryTotals struct {
+	Requests       int64 `json:"requests"`
+	FailedRequests int64 `json:"failed_requests"`
+	RateLimited    int64 `json:"rate_limited"`
+	TotalTokens    int64 `json:"total_tokens"`
+}
+
+// SummaryRow holds per-window totals for one provider, model or credential.
+type SummaryRow struct {
+	Name    string                   `json:"name"`
+	Windows map[string]SummaryTotals `json:"windows"`
+}
+
+// UsageSummary groups daily aggregates by provider, model and credential.
+type UsageSummary struct {
+	GeneratedAt  time.Time                `json:"generated_at"`
+	Totals       map[string]SummaryTotals `json:"totals"`
+	ByProvider   []SummaryRow             `json:"by_provider"`
+	ByModel      []SummaryRow             `json:"by_model"`
+	ByCredential []SummaryRow             `json:"by_credential"`
+}
+
+// SummarizeDaily folds usage_daily rows into today/7d/30d windows relative to now (UTC days).
+// Rows are sorted by 30-day request volume, busiest first.
+func SummarizeDaily(rows []DailyUsageRow, now time.Time) UsageSummary {
+	today := now.UTC().Truncate(24 * time.Hour)
+	starts := map[string]string{
+		"today": today.Format("2006-01-02"),
+		"7d":    today.AddDate(0, 0, -6).Format("2006-01-02"),
+		"30d":   today.AddDate(0, 0, -29).Format("2006-01-02"),
+	}
+	summary := UsageSummary{GeneratedAt: now.UTC(), Totals: make(map[string]SummaryTotals)}
+	byProvider := make(map[string]*SummaryRow)
+	byModel := make(map[string]*SummaryRow)
+	byCredential := make(map[string]*SummaryRow)
+
+	add := func(groups map[string]*SummaryRow, name, window string, row DailyUsageRow) {
+		if name == "" {
+			name = "unknown"
+		}
+		entry, ok := groups[name]
+		if !ok {
+			entry = &SummaryRow{Name: name, Windows: make(map[string]SummaryTotals, len(SummaryWindows))}
+			groups[name] = entry
+		}
+		entry.Windows[window] = addTotals(entry.Windows[window], row)
+	}
+
+	for _, row := range rows {
+		for _, window := range SummaryWindows {
+			if row.Day < starts[window] {
+				continue
+			}
+			summary.Totals[window] = addTotals(summary.Totals[window], row)
+			add(byProvider, row.Provider, window, row)
+			add(byModel, row.Model, window, row)
+			add(byCredential, row.CredentialLabel, window, row)
+		}
+	}
+	summary.ByProvider = sortedSummaryRows(byProvider)
+	summary.ByModel = sortedSummaryRows(byModel)
+	summary.ByCredential = sortedSummaryRows(byCredential)
+	return summary
+}
+
+func addTotals(t SummaryTotals, row DailyUsageRow) SummaryTotals {
+	t.Requests += row.TotalRequests
+	t.FailedRequests += row.FailedRequests
+	t.RateLimited += row.RateLimited
+	t.TotalTokens += row.TotalTokens
+	return t
+}
+
+func sortedSummaryRows(groups map[string]*SummaryRow) []SummaryRow {
+	out := make([]SummaryRow, 0, len(groups))
+	for _, row := range groups {
+		out = append(out, *row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Windows["30d"].Requests, out[j].Windows["30d"].Requests
+		if a != b {
+			return a > b
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
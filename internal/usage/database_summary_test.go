@@ -0,0 +1,36 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizeDailyWindows(t *testing.T) {
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+	rows := []DailyUsageRow{
+		{Day: "2025-03-31", Provider: "claude", Model: "sonnet", CredentialLabel: "a", TotalRequests: 2, TotalTokens: 20},
+		{Day: "2025-03-27", Provider: "claude", Model: "opus", CredentialLabel: "a", TotalRequests: 3, TotalTokens: 30, FailedRequests: 1},
+		{Day: "2025-03-10", Provider: "gemini", Model: "pro", CredentialLabel: "b", TotalRequests: 10, TotalTokens: 100},
+		{Day: "2025-02-01", Provider: "gemini", Model: "pro", CredentialLabel: "b", TotalRequests: 99, TotalTokens: 999},
+	}
+	s := SummarizeDaily(rows, now)
+
+	if got := s.Totals["today"]; got.Requests != 2 || got.TotalTokens != 20 {
+		t.Fatalf("today totals = %+v", got)
+	}
+	if got := s.Totals["7d"]; got.Requests != 5 {
+		t.Fatalf("7d requests = %d", got.Requests)
+	}
+	if got := s.Totals["30d"]; got.Requests != 15 || got.FailedRequests != 1 {
+		t.Fatalf("30d totals = %+v", got)
+	}
+	if len(s.ByProvider) != 2 || s.ByProvider[0].Name != "gemini" {
+		t.Fatalf("providers should be sorted by 30d volume: %+v", s.ByProvider)
+	}
+	if _, ok := s.ByProvider[0].Windows["today"]; ok {
+		t.Fatal("gemini has no traffic today")
+	}
+	if len(s.ByModel) != 3 || len(s.ByCredential) != 2 {
+		t.Fatalf("unexpected grouping: models=%d credentials=%d", len(s.ByModel), len(s.ByCredential))
+	}
+}
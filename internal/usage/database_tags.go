@@ -0,0 +1,58 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDatabaseDisabled is returned by query helpers when no usage store is configured.
+var ErrDatabaseDisabled = errors.New("usage: database disabled")
+
+// TagSummary aggregates persisted usage for a single classification tag.
+type TagSummary struct {
+	Tag              string `json:"tag"`
+	Requests         int64  `json:"requests"`
+	FailedRequests   int64  `json:"failed_requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+}
+
+// QueryTagSummary groups persisted request detail rows by classification tag.
+func QueryTagSummary(ctx context.Context, since time.Time) ([]TagSummary, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rows, err := store.db.QueryContext(ctx, `
+		SELECT t.tag,
+			COUNT(*),
+			COALESCE(SUM(r.failed), 0),
+			COALESCE(SUM(r.prompt_tokens), 0),
+			COALESCE(SUM(r.completion_tokens), 0),
+			COALESCE(SUM(r.total_tokens), 0)
+		FROM usage_request_tags t
+		JOIN usage_requests r ON r.id = t.request_id
+		WHERE r.timestamp >= ?
+		GROUP BY t.tag
+		ORDER BY COUNT(*) DESC, t.tag ASC;
+	`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]TagSummary, 0)
+	for rows.Next() {
+		var item TagSummary
+		if err := rows.Scan(&item.Tag, &item.Requests, &item.FailedRequests, &item.PromptTokens, &item.CompletionTokens, &item.TotalTokens); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,223 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+)
+
+// ModelPrice is the USD price per million prompt and completion tokens of a model.
+// CachedInputPerMillion prices prompt tokens read from the provider's prompt cache;
+// zero assumes defaultCachedInputRatio of the input price.
+type ModelPrice struct {
+	InputPerMillion       float64
+	OutputPerMillion      float64
+	CachedInputPerMillion float64
+}
+
+// defaultCachedInputRatio is the share of the input price assumed for cached prompt
+// tokens when a model has no cached-input price configured.
+const defaultCachedInputRatio = 0.1
+
+// cacheWritePremium is the share of the input price charged on top of it for prompt
+// tokens written to the cache (Anthropic bills 5-minute cache writes at 1.25x).
+const cacheWritePremium = 0.25
+
+// cacheablePromptTokens is the SQL expression for a usage_requests row's prompt tokens
+// including those read from or written to the prompt cache.
+const cacheablePromptTokens = `COALESCE(r.prompt_tokens, 0) + CASE WHEN LOWER(r.provider) = 'claude' THEN COALESCE(r.cached_tokens, 0) + r.cache_creation_tokens ELSE 0 END`
+
+// usageViews are reporting views over the usage tables, meant to be queried directly
+// by dashboards (e.g. Grafana's SQLite data source) or via QueryView. They are dropped
+// and recreated on every start so definition changes take effect.
+var usageViews = []struct{ name, query string }{
+	{"v_usage_by_provider_day", `
+		SELECT day, provider,
+			SUM(total_requests) AS requests,
+			SUM(failed_requests) AS failed_requests,
+			SUM(rate_limited) AS rate_limited,
+			SUM(prompt_tokens) AS prompt_tokens,
+			SUM(completion_tokens) AS completion_tokens,
+			SUM(total_tokens) AS total_tokens,
+			SUM(aborted_requests) AS aborted_requests
+		FROM usage_daily
+		GROUP BY day, provider`},
+	{"v_cost_by_key_day", `
+		SELECT substr(r.timestamp, 1, 10) AS day, r.api_key_hash AS api_key_hash,
+			COUNT(*) AS requests,
+			SUM(COALESCE(r.prompt_tokens, 0)) AS prompt_tokens,
+			SUM(COALESCE(r.completion_tokens, 0)) AS completion_tokens,
+			ROUND(SUM(COALESCE(r.prompt_tokens, 0) * COALESCE(p.input_per_million, 0)
+				+ COALESCE(r.completion_tokens, 0) * COALESCE(p.output_per_million, 0)) / 1000000.0, 6) AS cost_usd,
+			SUM(CASE WHEN p.model IS NULL THEN 1 ELSE 0 END) AS unpriced_requests
+		FROM usage_requests AS r
+		LEFT JOIN usage_model_prices AS p ON p.model = LOWER(r.model)
+		GROUP BY day, r.api_key_hash`},
+	// Cached prompt tokens are part of prompt_tokens except for Claude, whose
+	// input_tokens exclude cache reads and writes; cacheablePromptTokens normalises
+	// both. Savings are net of the premium paid for cache writes.
+	{"v_cache_by_model_day", `
+		SELECT substr(r.timestamp, 1, 10) AS day, COALESCE(r.provider, '') AS provider, COALESCE(r.model, '') AS model,
+			COUNT(*) AS requests,
+			SUM(CASE WHEN COALESCE(r.cached_tokens, 0) > 0 THEN 1 ELSE 0 END) AS cache_hit_requests,
+			SUM(` + cacheablePromptTokens + `) AS prompt_tokens,
+			SUM(COALESCE(r.cached_tokens, 0)) AS cached_tokens,
+			SUM(r.cache_creation_tokens) AS cache_creation_tokens,
+			ROUND(SUM(COALESCE(r.cached_tokens, 0) * (COALESCE(p.input_per_million, 0) - CASE
+				WHEN COALESCE(p.cached_input_per_million, 0) > 0 THEN p.cached_input_per_million
+				ELSE COALESCE(p.input_per_million, 0) * ` + strconv.FormatFloat(defaultCachedInputRatio, 'f', -1, 64) + `
+			END) - r.cache_creation_tokens * COALESCE(p.input_per_million, 0) * ` + strconv.FormatFloat(cacheWritePremium, 'f', -1, 64) + `) / 1000000.0, 6) AS savings_usd,
+			SUM(CASE WHEN p.model IS NULL THEN 1 ELSE 0 END) AS unpriced_requests
+		FROM usage_requests AS r
+		LEFT JOIN usage_model_prices AS p ON p.model = LOWER(r.model)
+		WHERE COALESCE(r.failed, 0) = 0
+		GROUP BY day, r.provider, r.model`},
+	{"v_latency_by_model_day", `
+		WITH ranked AS (
+			SELECT substr(timestamp, 1, 10) AS day, provider, model, duration_ms,
+				ROW_NUMBER() OVER w AS rn,
+				COUNT(*) OVER (PARTITION BY substr(timestamp, 1, 10), provider, model) AS cnt
+			FROM usage_requests
+			WHERE duration_ms > 0
+			WINDOW w AS (PARTITION BY substr(timestamp, 1, 10), provider, model ORDER BY duration_ms)
+		)
+		SELECT day, provider, model,
+			MAX(cnt) AS requests,
+			CAST(AVG(duration_ms) AS INTEGER) AS avg_ms,
+			MIN(CASE WHEN rn >= 0.50 * cnt THEN duration_ms END) AS p50_ms,
+			MIN(CASE WHEN rn >= 0.95 * cnt THEN duration_ms END) AS p95_ms,
+			MIN(CASE WHEN rn >= 0.99 * cnt THEN duration_ms END) AS p99_ms
+		FROM ranked
+		GROUP BY day, provider, model`},
+}
+
+func applyUsageViews(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS usage_model_prices (
+		model TEXT PRIMARY KEY,
+		input_per_million REAL NOT NULL,
+		output_per_million REAL NOT NULL
+	);`); err != nil {
+		return fmt.Errorf("usage: apply schema: %w", err)
+	}
+	if err := ensureColumn(db, "usage_model_prices", "cached_input_per_million", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	for _, view := range usageViews {
+		if _, err := db.Exec(`DROP VIEW IF EXISTS ` + view.name); err != nil {
+			return fmt.Errorf("usage: drop view %s: %w", view.name, err)
+		}
+		if _, err := db.Exec(`CREATE VIEW ` + view.name + ` AS ` + view.query); err != nil {
+			return fmt.Errorf("usage: create view %s: %w", view.name, err)
+		}
+	}
+	return nil
+}
+
+// syncModelPrices replaces the usage_model_prices rows with prices.
+func (s *usageStore) syncModelPrices(prices map[string]ModelPrice) error {
+	if s == nil || s.readOnly {
+		return nil
+	}
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err = tx.Exec(`DELETE FROM usage_model_prices`); err != nil {
+		return err
+	}
+	for model, price := range prices {
+		if _, err = tx.Exec(`INSERT INTO usage_model_prices (model, input_per_million, output_per_million, cached_input_per_million) VALUES (?, ?, ?, ?)`,
+			model, price.InputPerMillion, price.OutputPerMillion, price.CachedInputPerMillion); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ModelPricesFromConfig converts the usage-db.model-prices setting.
+func ModelPricesFromConfig(prices map[string]config.ModelPrice) map[string]ModelPrice {
+	if len(prices) == 0 {
+		return nil
+	}
+	out := make(map[string]ModelPrice, len(prices))
+	for model, price := range prices {
+		out[model] = ModelPrice(price)
+	}
+	return out
+}
+
+func normalizeModelPrices(prices map[string]ModelPrice) map[string]ModelPrice {
+	if len(prices) == 0 {
+		return nil
+	}
+	out := make(map[string]ModelPrice, len(prices))
+	for model, price := range prices {
+		model = strings.ToLower(strings.TrimSpace(model))
+		if model == "" || price.InputPerMillion < 0 || price.OutputPerMillion < 0 || price.CachedInputPerMillion < 0 {
+			continue
+		}
+		out[model] = price
+	}
+	return out
+}
+
+// ViewNames lists the reporting views available through QueryView.
+func ViewNames() []string {
+	names := make([]string, 0, len(usageViews))
+	for _, view := range usageViews {
+		names = append(names, view.name)
+	}
+	return names
+}
+
+// QueryView returns the rows of a reporting view for days on or after since,
+// ordered by day. Column values are returned as scanned from SQLite.
+func QueryView(ctx context.Context, name string, since time.Time) ([]map[string]any, error) {
+	if !slices.Contains(ViewNames(), name) {
+		return nil, fmt.Errorf("usage: unknown view %q", name)
+	}
+	store := currentUsageStore.Load()
+	if store == nil {
+		return nil, ErrDatabaseDisabled
+	}
+	return store.queryView(ctx, name, since)
+}
+
+func (s *usageStore) queryView(ctx context.Context, name string, since time.Time) ([]map[string]any, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT * FROM `+name+` WHERE day >= ? ORDER BY day`, since.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]map[string]any, 0)
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageViews(t *testing.T) {
+	t.Parallel()
+
+	store, err := newUsageStore(DatabaseOptions{
+		Enabled: true,
+		Path:    filepath.Join(t.TempDir(), "usage.db"),
+		ModelPrices: normalizeModelPrices(map[string]ModelPrice{
+			"Claude-Sonnet": {InputPerMillion: 3, OutputPerMillion: 15},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, ms := range []int64{100, 200, 300, 400} {
+		rec := dbRecord{
+			Timestamp:             now.Add(time.Duration(i) * time.Second),
+			Provider:              "claude",
+			Model:                 "claude-sonnet",
+			CredentialFingerprint: "fp",
+			APIKeyHash:            "key-a",
+			DurationMs:            ms,
+			Tokens:                TokenStats{InputTokens: 1000, OutputTokens: 100, TotalTokens: 1100},
+		}
+		if err = store.insert(rec); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	if err = store.insert(dbRecord{Timestamp: now, Provider: "gemini", Model: "gemini-pro", APIKeyHash: "key-a", CredentialFingerprint: "fp"}); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	ctx := context.Background()
+	since := now.Add(-24 * time.Hour)
+	byProvider, err := store.queryView(ctx, "v_usage_by_provider_day", since)
+	if err != nil {
+		t.Fatalf("provider view failed: %v", err)
+	}
+	if len(byProvider) != 2 {
+		t.Fatalf("provider rows = %+v", byProvider)
+	}
+
+	cost, err := store.queryView(ctx, "v_cost_by_key_day", since)
+	if err != nil {
+		t.Fatalf("cost view failed: %v", err)
+	}
+	if len(cost) != 1 {
+		t.Fatalf("cost rows = %+v", cost)
+	}
+	// 4 * (1000 * 3 + 100 * 15) / 1e6
+	if got := cost[0]["cost_usd"]; got != 0.018 {
+		t.Fatalf("cost_usd = %v", got)
+	}
+	if got := cost[0]["unpriced_requests"]; got != int64(1) {
+		t.Fatalf("unpriced_requests = %v", got)
+	}
+
+	latency, err := store.queryView(ctx, "v_latency_by_model_day", since)
+	if err != nil {
+		t.Fatalf("latency view failed: %v", err)
+	}
+	if len(latency) != 1 || latency[0]["p50_ms"] != int64(200) || latency[0]["p99_ms"] != int64(400) {
+		t.Fatalf("latency rows = %+v", latency)
+	}
+
+	if err = store.syncModelPrices(nil); err != nil {
+		t.Fatalf("clear prices failed: %v", err)
+	}
+	cost, err = store.queryView(ctx, "v_cost_by_key_day", since)
+	if err != nil || cost[0]["cost_usd"] != 0.0 {
+		t.Fatalf("cost after clearing prices = %+v, %v", cost, err)
+	}
+}
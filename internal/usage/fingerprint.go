@@ -0,0 +1,307 @@
+package usage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultFingerprintSaltEnv is read when usage-db.fingerprint-salt is empty.
+const DefaultFingerprintSaltEnv = "CLIPROXY_FINGERPRINT_SALT"
+
+const (
+	fingerprintSchemeSHA256 = "sha256"
+	fingerprintSchemeKey    = "fingerprint_scheme"
+)
+
+// ErrFingerprintSaltMismatch is returned when existing fingerprints were made with
+// a salt other than the previous salt supplied for migration.
+var ErrFingerprintSaltMismatch = errors.New("usage: previous fingerprint salt does not match the stored fingerprints")
+
+var fingerprintSalt atomic.Pointer[[]byte]
+
+// FingerprintSaltFromConfig resolves the fingerprint salt from the configuration
+// or, when it is empty, from the environment variable it names.
+func FingerprintSaltFromConfig(cfg config.UsageDatabaseConfig) string {
+	if salt := strings.TrimSpace(cfg.FingerprintSalt); salt != "" {
+		return salt
+	}
+	env := strings.TrimSpace(cfg.FingerprintSaltEnv)
+	if env == "" {
+		env = DefaultFingerprintSaltEnv
+	}
+	return strings.TrimSpace(os.Getenv(env))
+}
+
+func setFingerprintSalt(salt string) {
+	if salt == "" {
+		fingerprintSalt.Store(nil)
+		return
+	}
+	key := []byte(salt)
+	fingerprintSalt.Store(&key)
+}
+
+func currentFingerprintSalt() []byte {
+	if salt := fingerprintSalt.Load(); salt != nil {
+		return *salt
+	}
+	return nil
+}
+
+// fingerprint hashes identifying values (API keys, auth IDs, emails) before they
+// are stored. With a salt configured it is an HMAC-SHA256, so fingerprints of
+// short or guessable values cannot be brute forced from a copy of the database.
+func fingerprint(value string) string {
+	return fingerprintWith(currentFingerprintSalt(), value)
+}
+
+func fingerprintWith(salt []byte, value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(salt) == 0 {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// fingerprintScheme names the algorithm and identifies the salt without revealing it.
+func fingerprintScheme(salt []byte) string {
+	if len(salt) == 0 {
+		return fingerprintSchemeSHA256
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte("cliproxy-fingerprint-scheme"))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// loadFingerprintScheme returns the scheme recorded for existing rows. Databases
+// from builds without the record are assumed to hold plain SHA-256 fingerprints;
+// new, empty databases adopt the current scheme.
+func loadFingerprintScheme(db *sql.DB, writable bool) (string, error) {
+	var scheme string
+	err := db.QueryRow(`SELECT value FROM usage_meta WHERE key = ?`, fingerprintSchemeKey).Scan(&scheme)
+	if err == nil {
+		return scheme, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	var rows int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM (SELECT 1 FROM usage_requests LIMIT 1)`).Scan(&rows); err != nil {
+		return "", err
+	}
+	scheme = fingerprintSchemeSHA256
+	if rows == 0 {
+		scheme = fingerprintScheme(currentFingerprintSalt())
+	}
+	if writable {
+		if _, err = db.Exec(`INSERT OR REPLACE INTO usage_meta (key, value) VALUES (?, ?)`, fingerprintSchemeKey, scheme); err != nil {
+			return "", err
+		}
+	}
+	return scheme, nil
+}
+
+// FingerprintMigrationResult reports the rows re-fingerprinted by a migration.
+type FingerprintMigrationResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Values is the number of known plaintext values whose fingerprints were mapped.
+	Values int `json:"values"`
+	// Requests counts fingerprint columns rewritten in usage_requests; a row holding
+	// both a key hash and a credential fingerprint counts twice.
+	Requests    int64 `json:"requests"`
+	DailyRows   int64 `json:"daily_rows"`
+	MonthlyRows int64 `json:"monthly_rows"`
+	SpendCaps   int64 `json:"spend_caps"`
+}
+
+// MigrateFingerprints rewrites fingerprints made under the stored scheme into the
+// current one. Fingerprints are one-way, so only rows whose plaintext appears in
+// known (client API keys, auth IDs, account emails and the like) can be mapped;
+// previousSalt must be given when the stored scheme was itself salted.
+func MigrateFingerprints(ctx context.Context, known []string, previousSalt string) (FingerprintMigrationResult, error) {
+	store := currentUsageStore.Load()
+	if store == nil {
+		return FingerprintMigrationResult{}, ErrDatabaseDisabled
+	}
+	if store.readOnly {
+		return FingerprintMigrationResult{}, ErrReadOnly
+	}
+	return store.migrateFingerprints(ctx, known, []byte(strings.TrimSpace(previousSalt)))
+}
+
+func (s *usageStore) migrateFingerprints(ctx context.Context, known []string, previousSalt []byte) (FingerprintMigrationResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	salt := currentFingerprintSalt()
+	result := FingerprintMigrationResult{From: s.storedFingerprintScheme(), To: fingerprintScheme(salt)}
+	if result.From == result.To {
+		return result, nil
+	}
+	var oldSalt []byte
+	if result.From != fingerprintSchemeSHA256 {
+		if fingerprintScheme(previousSalt) != result.From {
+			return result, ErrFingerprintSaltMismatch
+		}
+		oldSalt = previousSalt
+	}
+
+	s.retentionMu.Lock()
+	defer s.retentionMu.Unlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	seen := make(map[string]struct{}, len(known))
+	for _, raw := range known {
+		for _, value := range []string{strings.TrimSpace(raw), strings.ToLower(strings.TrimSpace(raw))} {
+			if value == "" {
+				continue
+			}
+			if _, dup := seen[value]; dup {
+				continue
+			}
+			seen[value] = struct{}{}
+			from, to := fingerprintWith(oldSalt, value), fingerprintWith(salt, value)
+			changed, errMap := remapFingerprint(ctx, tx, from, to)
+			if errMap != nil {
+				return result, fmt.Errorf("usage: migrate fingerprints: %w", errMap)
+			}
+			if changed.any() {
+				result.Values++
+			}
+			result.Requests += changed.requests
+			result.DailyRows += changed.daily
+			result.MonthlyRows += changed.monthly
+			result.SpendCaps += changed.spendCaps
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO usage_meta (key, value) VALUES (?, ?)`, fingerprintSchemeKey, result.To); err != nil {
+		return result, err
+	}
+	if err = tx.Commit(); err != nil {
+		return result, err
+	}
+	s.fingerprintScheme.Store(result.To)
+	if err = s.loadSpendSuspensions(); err != nil {
+		log.WithError(err).Warn("usage: failed to reload key suspensions")
+	}
+	return result, nil
+}
+
+type remapCounts struct {
+	requests, daily, monthly, spendCaps int64
+}
+
+func (c remapCounts) any() bool {
+	return c.requests+c.daily+c.monthly+c.spendCaps > 0
+}
+
+// remapFingerprint replaces one fingerprint everywhere it is stored. Aggregate rows
+// are merged into rows already written under the new fingerprint.
+func remapFingerprint(ctx context.Context, tx *sql.Tx, from, to string) (remapCounts, error) {
+	var counts remapCounts
+	for _, column := range []string{"api_key_hash", "credential_fingerprint", "account_email"} {
+		n, err := execCount(ctx, tx, fmt.Sprintf(`UPDATE usage_requests SET %[1]s = ? WHERE %[1]s = ?`, column), []any{to, from})
+		if err != nil {
+			return counts, err
+		}
+		counts.requests += n
+	}
+	// Hashed account emails are stored encrypted when database encryption is on.
+	if sealedFrom, sealedTo := sealColumn(from), sealColumn(to); sealedFrom != from {
+		n, err := execCount(ctx, tx, `UPDATE usage_requests SET account_email = ? WHERE account_email = ?`, []any{sealedTo, sealedFrom})
+		if err != nil {
+			return counts, err
+		}
+		counts.requests += n
+	}
+	var err error
+	if counts.daily, err = mergeAggregateFingerprint(ctx, tx, "usage_daily", "day", from, to); err != nil {
+		return counts, err
+	}
+	if counts.monthly, err = mergeAggregateFingerprint(ctx, tx, "usage_monthly", "month", from, to); err != nil {
+		return counts, err
+	}
+	if counts.spendCaps, err = execCount(ctx, tx, `UPDATE OR REPLACE usage_spend_caps SET api_key_hash = ? WHERE api_key_hash = ?`, []any{to, from}); err != nil {
+		return counts, err
+	}
+	// Batch jobs and files keep their owner so clients still see them after the switch,
+	// and shadow comparisons stay reachable by a later erase of the key.
+	for _, table := range []string{"usage_batches", "usage_batch_files", "shadow_comparisons"} {
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET api_key_hash = ? WHERE api_key_hash = ?`, table), to, from); err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+func mergeAggregateFingerprint(ctx context.Context, tx *sql.Tx, table, period, from, to string) (int64, error) {
+	for _, pair := range [][2]string{{from, to}, {sealColumn(from), sealColumn(to)}} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET account_email = ? WHERE account_email = ?`, table), pair[1], pair[0]); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (
+			%[2]s, provider, credential_fingerprint, credential_label, model,
+			total_requests, failed_requests, rate_limited, prompt_tokens,
+			completion_tokens, total_tokens, account_email, aborted_requests
+		)
+		SELECT %[2]s, provider, ?, credential_label, model,
+			total_requests, failed_requests, rate_limited, prompt_tokens,
+			completion_tokens, total_tokens, account_email, aborted_requests
+		FROM %[1]s
+		WHERE credential_fingerprint = ?
+		ON CONFLICT(%[2]s, provider, credential_fingerprint, model) DO UPDATE SET
+			total_requests = %[1]s.total_requests + excluded.total_requests,
+			failed_requests = %[1]s.failed_requests + excluded.failed_requests,
+			rate_limited = %[1]s.rate_limited + excluded.rate_limited,
+			prompt_tokens = %[1]s.prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = %[1]s.completion_tokens + excluded.completion_tokens,
+			total_tokens = %[1]s.total_tokens + excluded.total_tokens,
+			aborted_requests = %[1]s.aborted_requests + excluded.aborted_requests;`, table, period), to, from); err != nil {
+		return 0, err
+	}
+	return execCount(ctx, tx, fmt.Sprintf(`DELETE FROM %s WHERE credential_fingerprint = ?`, table), []any{from})
+}
+
+// warnFingerprintMigration logs when stored fingerprints predate the current salt.
+func (s *usageStore) warnFingerprintMigration() {
+	if s.fingerprintMigrationPending() {
+		log.Warnf("usage: stored fingerprints use %s but the configured scheme is %s; run POST /v0/management/usage-db/fingerprints/migrate",
+			s.storedFingerprintScheme(), fingerprintScheme(currentFingerprintSalt()))
+	}
+}
+
+func (s *usageStore) fingerprintMigrationPending() bool {
+	return s.storedFingerprintScheme() != fingerprintScheme(currentFingerprintSalt())
+}
+
+func (s *usageStore) storedFingerprintScheme() string {
+	if scheme, ok := s.fingerprintScheme.Load().(string); ok {
+		return scheme
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/shadow"
+)
+
+func TestMigrateFingerprintsToSaltedScheme(t *testing.T) {
+	setFingerprintSalt("")
+	defer setFingerprintSalt("")
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	if store.fingerprintMigrationPending() {
+		t.Fatal("a new database must adopt the current scheme")
+	}
+
+	now := time.Now().UTC()
+	record := func() dbRecord {
+		return dbRecord{Timestamp: now, Provider: "claude", Model: "a", APIKeyHash: fingerprint("sk-1"), CredentialFingerprint: fingerprint("auth-a")}
+	}
+	if err = store.insert(record()); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	const salt = "0123456789abcdef-salt"
+	setFingerprintSalt(salt)
+	if !store.fingerprintMigrationPending() {
+		t.Fatal("expected a pending migration after the salt changed")
+	}
+	// Rows written after the change already use the salted fingerprint.
+	if err = store.insert(record()); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	ctx := context.Background()
+	result, err := store.migrateFingerprints(ctx, []string{"sk-1", "auth-a", "not-stored"}, nil)
+	if err != nil {
+		t.Fatalf("migrateFingerprints failed: %v", err)
+	}
+	if result.From != fingerprintSchemeSHA256 || result.Values != 2 || result.Requests != 2 || result.DailyRows != 1 {
+		t.Fatalf("unexpected migration result: %+v", result)
+	}
+	if store.fingerprintMigrationPending() {
+		t.Fatal("migration must record the new scheme")
+	}
+	var keyHashes, dailyRows, dailyRequests int
+	if err = store.db.QueryRow(`SELECT COUNT(*) FROM usage_requests WHERE api_key_hash = ? AND credential_fingerprint = ?`,
+		fingerprintWith([]byte(salt), "sk-1"), fingerprintWith([]byte(salt), "auth-a")).Scan(&keyHashes); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if err = store.db.QueryRow(`SELECT COUNT(*), SUM(total_requests) FROM usage_daily`).Scan(&dailyRows, &dailyRequests); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if keyHashes != 2 || dailyRows != 1 || dailyRequests != 2 {
+		t.Fatalf("expected both rows salted and daily rows merged, got requests=%d daily=%d/%d", keyHashes, dailyRows, dailyRequests)
+	}
+
+	setFingerprintSalt("another-salt-0123456789")
+	if _, err = store.migrateFingerprints(ctx, []string{"sk-1"}, []byte("wrong")); !errors.Is(err, ErrFingerprintSaltMismatch) {
+		t.Fatalf("expected ErrFingerprintSaltMismatch, got %v", err)
+	}
+	if result, err = store.migrateFingerprints(ctx, []string{"sk-1", "auth-a"}, []byte(salt)); err != nil || result.Requests != 4 {
+		t.Fatalf("unexpected rotation result: %+v err=%v", result, err)
+	}
+}
+
+func TestMigrateFingerprintsKeepsShadowComparisonsErasable(t *testing.T) {
+	setFingerprintSalt("")
+	defer setFingerprintSalt("")
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db")})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	ctx := context.Background()
+	RecordShadowComparison(ctx, shadow.Comparison{
+		Rule:    "ab",
+		APIKey:  "sk-1",
+		Primary: shadow.Result{Model: "gpt-4o", StatusCode: 200, Response: "primary"},
+		Shadow:  shadow.Result{Model: "claude-sonnet-4", StatusCode: 200, Response: "shadow"},
+	})
+
+	const salt = "0123456789abcdef-salt"
+	setFingerprintSalt(salt)
+	if _, err = store.migrateFingerprints(ctx, []string{"sk-1"}, nil); err != nil {
+		t.Fatalf("migrateFingerprints failed: %v", err)
+	}
+	result, err := store.erase(ctx, EraseRequest{APIKeyHash: fingerprint("sk-1")})
+	if err != nil {
+		t.Fatalf("erase failed: %v", err)
+	}
+	var remaining int
+	if err = store.db.QueryRow(`SELECT COUNT(*) FROM shadow_comparisons`).Scan(&remaining); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if result.ShadowComparisons != 1 || remaining != 0 {
+		t.Fatalf("expected the migrated shadow comparison to be erased, got result=%+v remaining=%d", result, remaining)
+	}
+}
@@ -0,0 +1,123 @@
+package usage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/redisstate"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+// ExporterHealth reports the outcome counters of one telemetry sink.
+type ExporterHealth struct {
+	Successes   uint64     `json:"successes"`
+	Errors      uint64     `json:"errors"`
+	LastSuccess *time.Time `json:"last-success,omitempty"`
+	LastError   string     `json:"last-error,omitempty"`
+	LastErrorAt *time.Time `json:"last-error-at,omitempty"`
+}
+
+// healthTracker accumulates success and error counts for a telemetry sink so
+// silent failures surface in the status endpoint instead of only in debug logs.
+type healthTracker struct {
+	mu     sync.Mutex
+	health ExporterHealth
+}
+
+func (h *healthTracker) observe(err error) {
+	now := time.Now().UTC()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.health.Errors++
+		h.health.LastError = err.Error()
+		h.health.LastErrorAt = &now
+		return
+	}
+	h.health.Successes++
+	h.health.LastSuccess = &now
+}
+
+func (h *healthTracker) snapshot() ExporterHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.health
+}
+
+var (
+	databaseHealth  healthTracker
+	retentionHealth healthTracker
+	otlpHealth      healthTracker
+	statsdHealth    healthTracker
+)
+
+// TelemetryStatus is a consolidated view of the usage pipeline and its exporters.
+type TelemetryStatus struct {
+	// DispatchQueueDepth is the number of records waiting for the plugin dispatcher.
+	DispatchQueueDepth int `json:"dispatch-queue-depth"`
+	// PluginPanics counts plugin invocations that panicked and were recovered.
+	PluginPanics uint64 `json:"plugin-panics"`
+	Database     struct {
+		DatabaseStatus
+		// Inserts tracks usage_requests writes; LastSuccess is the last successful insert.
+		Inserts ExporterHealth `json:"inserts"`
+		// Retention tracks non-dry-run retention passes.
+		Retention ExporterHealth `json:"retention"`
+	} `json:"database"`
+	OTLP struct {
+		Enabled  bool   `json:"enabled"`
+		Endpoint string `json:"endpoint,omitempty"`
+		// Candidates lists the failover collectors when more than one is configured.
+		Candidates []OTLPEndpointStatus `json:"candidates,omitempty"`
+		// Flushes tracks batch exports; LastError holds the last failed flush.
+		Flushes ExporterHealth   `json:"flushes"`
+		Spool   *OTLPSpoolStatus `json:"spool,omitempty"`
+	} `json:"otlp"`
+	StatsD struct {
+		Enabled bool           `json:"enabled"`
+		Writes  ExporterHealth `json:"writes"`
+	} `json:"statsd"`
+	Kafka KafkaStatus `json:"kafka"`
+	// Redis reports the backend sharing rate limits and spend caps between instances.
+	Redis redisstate.Status `json:"redis"`
+	// Archive reports uploads of expired usage_requests rows to object storage.
+	Archive ArchiveStatus `json:"archive"`
+	// Reports lists the scheduled usage reports and their deliveries.
+	Reports []ReportStatus `json:"reports,omitempty"`
+	// Sinks lists the external usage-sinks processes.
+	Sinks []SinkStatus `json:"sinks,omitempty"`
+}
+
+// CurrentTelemetryStatus snapshots queue depths, last successful writes and error
+// counters of every usage sink.
+func CurrentTelemetryStatus() TelemetryStatus {
+	var status TelemetryStatus
+	manager := coreusage.DefaultManager()
+	status.DispatchQueueDepth = manager.QueueDepth()
+	status.PluginPanics = manager.PluginPanics()
+
+	status.Database.DatabaseStatus = CurrentDatabaseStatus()
+	status.Database.Inserts = databaseHealth.snapshot()
+	status.Database.Retention = retentionHealth.snapshot()
+
+	status.OTLP.Enabled = OTLPEnabled()
+	if status.OTLP.Enabled {
+		status.OTLP.Endpoint = OTLPEndpoint()
+		if candidates := OTLPEndpointStatuses(); len(candidates) > 1 {
+			status.OTLP.Candidates = candidates
+		}
+	}
+	status.OTLP.Flushes = otlpHealth.snapshot()
+	if spool, ok := OTLPSpoolState(); ok {
+		status.OTLP.Spool = &spool
+	}
+
+	status.StatsD.Enabled = currentStatsDSink.Load() != nil
+	status.StatsD.Writes = statsdHealth.snapshot()
+	status.Kafka = CurrentKafkaStatus()
+	status.Redis = redisstate.CurrentStatus()
+	status.Archive = CurrentArchiveStatus()
+	status.Reports = ReportStatuses()
+	status.Sinks = UsageSinkStatuses()
+	return status
+}
@@ -0,0 +1,46 @@
+package usage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCurrentTelemetryStatusTracksDatabaseInserts(t *testing.T) {
+	databaseHealth = healthTracker{}
+	retentionHealth = healthTracker{}
+	store, err := newUsageStore(DatabaseOptions{Enabled: true, Path: filepath.Join(t.TempDir(), "usage.db"), RetentionDays: 7})
+	if err != nil {
+		t.Fatalf("failed to create usage store: %v", err)
+	}
+	defer store.close()
+	currentUsageStore.Store(store)
+	defer currentUsageStore.Store(nil)
+
+	if err = store.insert(dbRecord{Timestamp: time.Now().UTC(), Provider: "claude", Model: "a"}); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	store.applyRetention()
+
+	status := CurrentTelemetryStatus()
+	if !status.Database.Enabled || status.Database.Queue == nil {
+		t.Fatalf("expected an enabled writable database, got %+v", status.Database.DatabaseStatus)
+	}
+	if got := status.Database.Inserts; got.Successes != 1 || got.Errors != 0 || got.LastSuccess == nil {
+		t.Fatalf("unexpected insert health: %+v", got)
+	}
+	if got := status.Database.Retention; got.Successes != 1 || got.LastSuccess == nil {
+		t.Fatalf("unexpected retention health: %+v", got)
+	}
+}
+
+func TestHealthTrackerRecordsLastError(t *testing.T) {
+	var h healthTracker
+	h.observe(nil)
+	h.observe(errors.New("collector unreachable"))
+	got := h.snapshot()
+	if got.Successes != 1 || got.Errors != 1 || got.LastError != "collector unreachable" || got.LastErrorAt == nil || got.LastSuccess == nil {
+		t.Fatalf("unexpected health snapshot: %+v", got)
+	}
+}
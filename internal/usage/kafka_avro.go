@@ -0,0 +1,128 @@
+package usage
+
+import (
+	"encoding/binary"
+	"maps"
+	"math"
+	"slices"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+// UsageEventAvroSchema is the Avro schema, in Parsing Canonical Form, of the usage
+// events the Kafka publisher sends with format "avro". Fields mirror coreusage.SinkEvent;
+// timestamp is milliseconds since the Unix epoch and absent strings are empty.
+const UsageEventAvroSchema = `{"name":"cliproxy.UsageEvent","type":"record","fields":[` +
+	`{"name":"timestamp","type":"long"},` +
+	`{"name":"request_id","type":"string"},` +
+	`{"name":"provider","type":"string"},` +
+	`{"name":"model","type":"string"},` +
+	`{"name":"requested_model","type":"string"},` +
+	`{"name":"api_key_hash","type":"string"},` +
+	`{"name":"client_label","type":"string"},` +
+	`{"name":"auth_id","type":"string"},` +
+	`{"name":"source","type":"string"},` +
+	`{"name":"status_code","type":"int"},` +
+	`{"name":"failed","type":"boolean"},` +
+	`{"name":"error_class","type":"string"},` +
+	`{"name":"rejection","type":"string"},` +
+	`{"name":"policy_denied","type":"boolean"},` +
+	`{"name":"tags","type":{"type":"array","items":"string"}},` +
+	`{"name":"input_tokens","type":"long"},` +
+	`{"name":"output_tokens","type":"long"},` +
+	`{"name":"reasoning_tokens","type":"long"},` +
+	`{"name":"cached_tokens","type":"long"},` +
+	`{"name":"total_tokens","type":"long"},` +
+	`{"name":"latency_ms","type":"long"},` +
+	`{"name":"queue_wait_ms","type":"long"},` +
+	`{"name":"audio_seconds","type":"double"},` +
+	`{"name":"client_ip_hash","type":"string"},` +
+	`{"name":"client_country","type":"string"},` +
+	`{"name":"metadata","type":{"type":"map","values":"string"}}]}`
+
+// avroEmptyFingerprint seeds the CRC-64-AVRO (Rabin) fingerprint.
+const avroEmptyFingerprint uint64 = 0xc15d213aa4d7a795
+
+var avroFingerprintTable = func() [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		fp := uint64(i)
+		for range 8 {
+			fp = (fp >> 1) ^ (avroEmptyFingerprint & -(fp & 1))
+		}
+		table[i] = fp
+	}
+	return table
+}()
+
+// avroFingerprint returns the CRC-64-AVRO fingerprint of a canonical schema.
+func avroFingerprint(schema string) uint64 {
+	fp := avroEmptyFingerprint
+	for i := 0; i < len(schema); i++ {
+		fp = (fp >> 8) ^ avroFingerprintTable[byte(fp)^schema[i]]
+	}
+	return fp
+}
+
+// usageEventAvroHeader is the single-object encoding marker followed by the
+// little-endian schema fingerprint.
+var usageEventAvroHeader = binary.LittleEndian.AppendUint64([]byte{0xc3, 0x01}, avroFingerprint(UsageEventAvroSchema))
+
+// encodeUsageEventAvro encodes ev using Avro single-object encoding, so consumers can
+// pick the schema by fingerprint without a schema registry.
+func encodeUsageEventAvro(ev coreusage.SinkEvent) []byte {
+	buf := slices.Clone(usageEventAvroHeader)
+	str := func(s string) {
+		buf = binary.AppendVarint(buf, int64(len(s)))
+		buf = append(buf, s...)
+	}
+	boolean := func(b bool) {
+		if b {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	}
+	long := func(v int64) { buf = binary.AppendVarint(buf, v) }
+
+	long(ev.Timestamp.UnixMilli())
+	str(ev.RequestID)
+	str(ev.Provider)
+	str(ev.Model)
+	str(ev.RequestedModel)
+	str(ev.APIKeyHash)
+	str(ev.ClientLabel)
+	str(ev.AuthID)
+	str(ev.Source)
+	long(int64(ev.StatusCode))
+	boolean(ev.Failed)
+	str(ev.ErrorClass)
+	str(ev.Rejection)
+	boolean(ev.PolicyDenied)
+	if len(ev.Tags) > 0 {
+		long(int64(len(ev.Tags)))
+		for _, tag := range ev.Tags {
+			str(tag)
+		}
+	}
+	long(0)
+	long(ev.InputTokens)
+	long(ev.OutputTokens)
+	long(ev.ReasoningTokens)
+	long(ev.CachedTokens)
+	long(ev.TotalTokens)
+	long(ev.LatencyMs)
+	long(ev.QueueWaitMs)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(ev.AudioSeconds))
+	str(ev.ClientIPHash)
+	str(ev.ClientCountry)
+	if len(ev.Metadata) > 0 {
+		long(int64(len(ev.Metadata)))
+		for _, key := range slices.Sorted(maps.Keys(ev.Metadata)) {
+			str(key)
+			str(ev.Metadata[key])
+		}
+	}
+	long(0)
+	return buf
+}
@@ -0,0 +1,385 @@
+package usage
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	log "github.com/sirupsen/logrus"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const (
+	// KafkaFormatJSON publishes coreusage.SinkEvent JSON documents.
+	KafkaFormatJSON = "json"
+	// KafkaFormatAvro publishes UsageEventAvroSchema records in Avro single-object encoding.
+	KafkaFormatAvro = "avro"
+
+	defaultKafkaClientID      = "cliproxy"
+	defaultKafkaBatchSize     = 100
+	defaultKafkaFlushInterval = time.Second
+	defaultKafkaTimeout       = 10 * time.Second
+	defaultKafkaQueueSize     = 10000
+	// kafkaMaxAttempts bounds produce attempts per record; the client refreshes
+	// metadata between them.
+	kafkaMaxAttempts = 3
+)
+
+// KafkaOptions configures the Kafka usage event publisher.
+type KafkaOptions struct {
+	Enabled  bool
+	Brokers  []string
+	Topic    string
+	ClientID string
+	// Format is "json" (default) or "avro".
+	Format string
+	// Acks is "all" (default), "leader" or "none".
+	Acks          string
+	BatchSize     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	QueueSize     int
+
+	TLS                bool
+	CAFile             string
+	InsecureSkipVerify bool
+
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+}
+
+// KafkaStatus reports the delivery counters of the Kafka publisher.
+type KafkaStatus struct {
+	Enabled    bool   `json:"enabled"`
+	Topic      string `json:"topic,omitempty"`
+	Format     string `json:"format,omitempty"`
+	QueueDepth int    `json:"queue-depth"`
+	// Published counts records the brokers acknowledged.
+	Published uint64 `json:"published"`
+	// Failed counts records given up on after every produce attempt failed.
+	Failed uint64 `json:"failed"`
+	// Dropped counts records discarded because the queue was full.
+	Dropped uint64 `json:"dropped"`
+	// Batches tracks produce batches; LastError holds the last failed delivery.
+	Batches ExporterHealth `json:"batches"`
+}
+
+type kafkaProducer struct {
+	opts   KafkaOptions
+	client *kgo.Client
+	queue  chan *kgo.Record
+	stop   chan struct{}
+	done   chan struct{}
+
+	published atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+	batches   healthTracker
+}
+
+type kafkaPlugin struct{}
+
+var (
+	currentKafka  atomic.Pointer[kafkaProducer]
+	kafkaConfigMu sync.Mutex
+)
+
+func init() {
+	coreusage.RegisterPlugin(kafkaPlugin{})
+}
+
+// KafkaOptionsFromConfig converts the kafka configuration block.
+func KafkaOptionsFromConfig(cfg config.KafkaConfig) KafkaOptions {
+	return KafkaOptions{
+		Enabled:            cfg.Enabled,
+		Brokers:            cfg.Brokers,
+		Topic:              cfg.Topic,
+		ClientID:           cfg.ClientID,
+		Format:             cfg.Format,
+		Acks:               cfg.Acks,
+		BatchSize:          cfg.BatchSize,
+		FlushInterval:      time.Duration(cfg.FlushIntervalMs) * time.Millisecond,
+		Timeout:            time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		QueueSize:          cfg.QueueSize,
+		TLS:                cfg.TLS.Enabled,
+		CAFile:             cfg.TLS.CAFile,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+		SASLMechanism:      cfg.SASL.Mechanism,
+		SASLUsername:       cfg.SASL.Username,
+		SASLPassword:       cfg.SASL.Password,
+	}
+}
+
+// ConfigureKafka enables, reconfigures or disables the Kafka publisher. A replaced
+// publisher sends what it already queued in the background before it stops.
+func ConfigureKafka(opts KafkaOptions) error {
+	kafkaConfigMu.Lock()
+	defer kafkaConfigMu.Unlock()
+
+	normalized := normalizeKafkaOptions(opts)
+	prev := currentKafka.Load()
+	if prev != nil && reflect.DeepEqual(prev.opts, normalized) {
+		return nil
+	}
+	if !normalized.Enabled {
+		if old := currentKafka.Swap(nil); old != nil {
+			go old.close()
+		}
+		return nil
+	}
+	producer, err := newKafkaProducer(normalized)
+	if err != nil {
+		return err
+	}
+	go producer.run()
+	if old := currentKafka.Swap(producer); old != nil {
+		go old.close()
+	}
+	return nil
+}
+
+func normalizeKafkaOptions(opts KafkaOptions) KafkaOptions {
+	brokers := make([]string, 0, len(opts.Brokers))
+	for _, broker := range opts.Brokers {
+		if trimmed := strings.TrimSpace(broker); trimmed != "" {
+			brokers = append(brokers, trimmed)
+		}
+	}
+	opts.Brokers = brokers
+	opts.Topic = strings.TrimSpace(opts.Topic)
+	if opts.ClientID = strings.TrimSpace(opts.ClientID); opts.ClientID == "" {
+		opts.ClientID = defaultKafkaClientID
+	}
+	if opts.Format = strings.ToLower(strings.TrimSpace(opts.Format)); opts.Format == "" {
+		opts.Format = KafkaFormatJSON
+	}
+	if opts.Acks = strings.ToLower(strings.TrimSpace(opts.Acks)); opts.Acks == "" {
+		opts.Acks = "all"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultKafkaBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultKafkaFlushInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultKafkaTimeout
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultKafkaQueueSize
+	}
+	opts.SASLMechanism = strings.ToUpper(strings.TrimSpace(opts.SASLMechanism))
+	return opts
+}
+
+func newKafkaProducer(opts KafkaOptions) (*kafkaProducer, error) {
+	if len(opts.Brokers) == 0 || opts.Topic == "" {
+		return nil, errors.New("usage: kafka brokers and topic are required")
+	}
+	switch opts.Format {
+	case KafkaFormatJSON, KafkaFormatAvro:
+	default:
+		return nil, fmt.Errorf("usage: unsupported kafka format %q", opts.Format)
+	}
+	clientOpts := []kgo.Opt{
+		kgo.SeedBrokers(opts.Brokers...),
+		kgo.ClientID(opts.ClientID),
+		kgo.DefaultProduceTopic(opts.Topic),
+		kgo.DialTimeout(opts.Timeout),
+		kgo.ProduceRequestTimeout(opts.Timeout),
+		kgo.RecordRetries(kafkaMaxAttempts),
+		kgo.WithLogger(kafkaLogger{}),
+	}
+	// Idempotent writes need acks from all in-sync replicas.
+	switch opts.Acks {
+	case "all":
+		clientOpts = append(clientOpts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "leader":
+		clientOpts = append(clientOpts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case "none":
+		clientOpts = append(clientOpts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	default:
+		return nil, fmt.Errorf("usage: unsupported kafka acks %q", opts.Acks)
+	}
+	switch opts.SASLMechanism {
+	case "":
+	case "PLAIN":
+		clientOpts = append(clientOpts, kgo.SASL(plain.Auth{User: opts.SASLUsername, Pass: opts.SASLPassword}.AsMechanism()))
+	case "SCRAM-SHA-256":
+		clientOpts = append(clientOpts, kgo.SASL(scram.Auth{User: opts.SASLUsername, Pass: opts.SASLPassword}.AsSha256Mechanism()))
+	case "SCRAM-SHA-512":
+		clientOpts = append(clientOpts, kgo.SASL(scram.Auth{User: opts.SASLUsername, Pass: opts.SASLPassword}.AsSha512Mechanism()))
+	default:
+		return nil, fmt.Errorf("usage: unsupported kafka SASL mechanism %q", opts.SASLMechanism)
+	}
+	if opts.TLS {
+		tlsConfig := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+		if opts.CAFile != "" {
+			pem, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read kafka CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("kafka CA file %s contains no certificates", opts.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		clientOpts = append(clientOpts, kgo.DialTLSConfig(tlsConfig))
+	}
+	client, err := kgo.NewClient(clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("usage: kafka client: %w", err)
+	}
+	return &kafkaProducer{
+		opts:   opts,
+		client: client,
+		queue:  make(chan *kgo.Record, opts.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// CurrentKafkaStatus reports the Kafka publisher counters.
+func CurrentKafkaStatus() KafkaStatus {
+	p := currentKafka.Load()
+	if p == nil {
+		return KafkaStatus{}
+	}
+	return KafkaStatus{
+		Enabled:    true,
+		Topic:      p.opts.Topic,
+		Format:     p.opts.Format,
+		QueueDepth: len(p.queue),
+		Published:  p.published.Load(),
+		Failed:     p.failed.Load(),
+		Dropped:    p.dropped.Load(),
+		Batches:    p.batches.snapshot(),
+	}
+}
+
+func (kafkaPlugin) HandleUsage(ctx context.Context, record coreusage.Record) {
+	p := currentKafka.Load()
+	if p == nil {
+		return
+	}
+	event := sinkEvent(ctx, record)
+	msg := &kgo.Record{Timestamp: event.Timestamp}
+	if event.APIKeyHash != "" {
+		msg.Key = []byte(event.APIKeyHash)
+	}
+	if p.opts.Format == KafkaFormatAvro {
+		msg.Value = encodeUsageEventAvro(event)
+	} else {
+		value, err := json.Marshal(event)
+		if err != nil {
+			log.WithError(err).Warn("usage: failed to encode kafka event")
+			return
+		}
+		msg.Value = value
+	}
+	select {
+	case p.queue <- msg:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+func (p *kafkaProducer) close() {
+	close(p.stop)
+	<-p.done
+}
+
+// run batches queued records until the producer is stopped, then sends the rest.
+func (p *kafkaProducer) run() {
+	defer close(p.done)
+	defer p.client.Close()
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]*kgo.Record, 0, p.opts.BatchSize)
+	for {
+		select {
+		case msg := <-p.queue:
+			batch = append(batch, msg)
+			if len(batch) >= p.opts.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-p.stop:
+			for {
+				select {
+				case msg := <-p.queue:
+					batch = append(batch, msg)
+					if len(batch) < p.opts.BatchSize {
+						continue
+					}
+				default:
+				}
+				if len(batch) == 0 {
+					return
+				}
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush delivers batch and waits for the brokers to acknowledge it. Records are
+// partitioned by key, so one client's records stay in order.
+func (p *kafkaProducer) flush(batch []*kgo.Record) {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaMaxAttempts*p.opts.Timeout)
+	defer cancel()
+	var failed uint64
+	var lastErr error
+	for _, result := range p.client.ProduceSync(ctx, batch...) {
+		if result.Err != nil {
+			failed++
+			lastErr = result.Err
+			continue
+		}
+		p.published.Add(1)
+	}
+	p.batches.observe(lastErr)
+	if failed > 0 {
+		p.failed.Add(failed)
+		log.WithError(lastErr).Warnf("usage: failed to publish %d usage records to kafka topic %s", failed, p.opts.Topic)
+	}
+}
+
+// kafkaLogger forwards client warnings and errors to the usage log.
+type kafkaLogger struct{}
+
+func (kafkaLogger) Level() kgo.LogLevel { return kgo.LogLevelWarn }
+
+func (kafkaLogger) Log(level kgo.LogLevel, msg string, keyvals ...any) {
+	entry := util.ComponentLog(util.LogComponentUsage).WithField("client", "kafka")
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		entry = entry.WithField(fmt.Sprint(keyvals[i]), keyvals[i+1])
+	}
+	if level == kgo.LogLevelError {
+		entry.Error(msg)
+		return
+	}
+	entry.Warn(msg)
+}
@@ -0,0 +1,147 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+func TestKafkaPublish(t *testing.T) {
+	cluster, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.SeedTopics(2, "usage"),
+		kfake.EnableSASL(),
+		kfake.Superuser("PLAIN", "proxy", "secret"),
+	)
+	if err != nil {
+		t.Fatalf("start kafka: %v", err)
+	}
+	defer cluster.Close()
+	// Drop the connection on the first produce request so the publisher has to retry.
+	var produceAttempts atomic.Int32
+	cluster.ControlKey(int16(kmsg.Produce), func(kmsg.Request) (kmsg.Response, error, bool) {
+		produceAttempts.Add(1)
+		return nil, errors.New("injected broker failure"), true
+	})
+
+	err = ConfigureKafka(KafkaOptions{
+		Enabled:       true,
+		Brokers:       cluster.ListenAddrs(),
+		Topic:         "usage",
+		BatchSize:     3,
+		FlushInterval: 20 * time.Millisecond,
+		Timeout:       2 * time.Second,
+		SASLMechanism: "plain",
+		SASLUsername:  "proxy",
+		SASLPassword:  "secret",
+	})
+	if err != nil {
+		t.Fatalf("ConfigureKafka failed: %v", err)
+	}
+	defer func() { _ = ConfigureKafka(KafkaOptions{}) }()
+
+	plugin := kafkaPlugin{}
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "claude", Model: "a", APIKey: "k1", Detail: coreusage.Detail{TotalTokens: 9}})
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "claude", Model: "b", APIKey: "k1"})
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "gemini", Model: "c"})
+
+	waitFor(t, "published records", func() bool { return CurrentKafkaStatus().Published == 3 })
+
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.SASL(plain.Auth{User: "proxy", Pass: "secret"}.AsMechanism()),
+		kgo.ConsumeTopics("usage"),
+	)
+	if err != nil {
+		t.Fatalf("consumer: %v", err)
+	}
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < 3 && ctx.Err() == nil {
+		consumer.PollFetches(ctx).EachRecord(func(r *kgo.Record) { records = append(records, r) })
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 delivered records, got %d", len(records))
+	}
+	var sawKeyless bool
+	partitions := make(map[int32]bool)
+	for i, record := range records {
+		var ev coreusage.SinkEvent
+		if err = json.Unmarshal(record.Value, &ev); err != nil {
+			t.Fatalf("record %d is not a sink event: %v", i, err)
+		}
+		if record.Key == nil {
+			sawKeyless = ev.Provider == "gemini" && ev.APIKeyHash == ""
+			continue
+		}
+		if string(record.Key) != ev.APIKeyHash || ev.APIKeyHash == "" {
+			t.Fatalf("record %d key %q does not match api_key_hash %q", i, record.Key, ev.APIKeyHash)
+		}
+		partitions[record.Partition] = true
+	}
+	if produceAttempts.Load() != 1 {
+		t.Fatalf("expected the failing produce request to be intercepted once, got %d", produceAttempts.Load())
+	}
+	if !sawKeyless {
+		t.Fatalf("expected the record without API key to be sent without a key")
+	}
+	if len(partitions) != 1 {
+		t.Fatalf("expected records of one client on one partition, got %v", partitions)
+	}
+	status := CurrentKafkaStatus()
+	if status.Failed != 0 || status.Dropped != 0 || status.Batches.Successes == 0 {
+		t.Fatalf("unexpected kafka status: %+v", status)
+	}
+}
+
+func TestKafkaPublishCountsFailures(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	if err = ConfigureKafka(KafkaOptions{Enabled: true, Brokers: []string{addr}, Topic: "usage", BatchSize: 1, Timeout: 200 * time.Millisecond}); err != nil {
+		t.Fatalf("ConfigureKafka failed: %v", err)
+	}
+	defer func() { _ = ConfigureKafka(KafkaOptions{}) }()
+	kafkaPlugin{}.HandleUsage(context.Background(), coreusage.Record{Provider: "claude", Model: "a"})
+	waitFor(t, "failed record", func() bool { return CurrentKafkaStatus().Failed == 1 })
+	if status := CurrentKafkaStatus(); status.Published != 0 || status.Batches.Errors != 1 || status.Batches.LastError == "" {
+		t.Fatalf("unexpected kafka status: %+v", status)
+	}
+}
+
+func TestEncodeUsageEventAvro(t *testing.T) {
+	ts := time.UnixMilli(1700000000123)
+	buf := encodeUsageEventAvro(coreusage.SinkEvent{Timestamp: ts, RequestID: "req-1", Provider: "claude", Tags: []string{"x"}})
+	if !bytes.HasPrefix(buf, []byte{0xc3, 0x01}) || binary.LittleEndian.Uint64(buf[2:]) != avroFingerprint(UsageEventAvroSchema) {
+		t.Fatalf("missing single-object header: %x", buf[:10])
+	}
+	rd := bytes.NewReader(buf[10:])
+	if v, _ := binary.ReadVarint(rd); v != ts.UnixMilli() {
+		t.Fatalf("timestamp = %d", v)
+	}
+	n, _ := binary.ReadVarint(rd)
+	id := make([]byte, n)
+	_, _ = io.ReadFull(rd, id)
+	if string(id) != "req-1" {
+		t.Fatalf("request_id = %q", id)
+	}
+}
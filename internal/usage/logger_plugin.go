@@ -96,6 +96,12 @@ type RequestDetail struct {
 	AuthIndex uint64     `json:"auth_index"`
 	Tokens    TokenStats `json:"tokens"`
 	Failed    bool       `json:"failed"`
+	// QueueWaitMs is the time spent waiting for a credential concurrency slot.
+	QueueWaitMs int64 `json:"queue_wait_ms,omitempty"`
+	// RequestedModel is the client's model name when a rewrite rule changed it.
+	RequestedModel string `json:"requested_model,omitempty"`
+	// Rejection is set when the proxy refused the request before routing it.
+	Rejection string `json:"rejection,omitempty"`
 }
 
 // TokenStats captures the token usage breakdown for a request.
@@ -104,7 +110,19 @@ type TokenStats struct {
 	OutputTokens    int64 `json:"output_tokens"`
 	ReasoningTokens int64 `json:"reasoning_tokens"`
 	CachedTokens    int64 `json:"cached_tokens"`
-	TotalTokens     int64 `json:"total_tokens"`
+	// CacheCreationTokens counts prompt tokens written to the prompt cache; cache
+	// reads are CachedTokens.
+	CacheCreationTokens int64 `json:"cache_creation_tokens,omitempty"`
+	TotalTokens         int64 `json:"total_tokens"`
+	// ToolCalls, ToolResultTokens and ImageInputs describe tool use and image inputs,
+	// telling agentic workloads apart from plain chat.
+	ToolCalls        int64 `json:"tool_calls,omitempty"`
+	ToolResultTokens int64 `json:"tool_result_tokens,omitempty"`
+	ImageInputs      int64 `json:"image_inputs,omitempty"`
+	// DocumentInputs and MediaBytes count attached documents and the decoded size of
+	// inline images and documents.
+	DocumentInputs int64 `json:"document_inputs,omitempty"`
+	MediaBytes     int64 `json:"media_bytes,omitempty"`
 }
 
 // StatisticsSnapshot represents an immutable view of the aggregated metrics.
@@ -199,11 +217,14 @@ func (s *RequestStatistics) Record(ctx context.Context, record coreusage.Record)
 		s.apis[statsKey] = stats
 	}
 	s.updateAPIStats(stats, modelName, RequestDetail{
-		Timestamp: timestamp,
-		Source:    record.Source,
-		AuthIndex: record.AuthIndex,
-		Tokens:    detail,
-		Failed:    failed,
+		Timestamp:      timestamp,
+		Source:         record.Source,
+		AuthIndex:      record.AuthIndex,
+		Tokens:         detail,
+		Failed:         failed,
+		QueueWaitMs:    record.QueueWait.Milliseconds(),
+		RequestedModel: record.RequestedModel,
+		Rejection:      record.Rejection,
 	})
 
 	s.requestsByDay[dayKey]++
@@ -328,11 +349,18 @@ const httpStatusBadRequest = 400
 
 func normaliseDetail(detail coreusage.Detail) TokenStats {
 	tokens := TokenStats{
-		InputTokens:     detail.InputTokens,
-		OutputTokens:    detail.OutputTokens,
-		ReasoningTokens: detail.ReasoningTokens,
-		CachedTokens:    detail.CachedTokens,
-		TotalTokens:     detail.TotalTokens,
+		InputTokens:         detail.InputTokens,
+		OutputTokens:        detail.OutputTokens,
+		ReasoningTokens:     detail.ReasoningTokens,
+		CachedTokens:        detail.CachedTokens,
+		CacheCreationTokens: detail.CacheCreationTokens,
+		TotalTokens:         detail.TotalTokens,
+
+		ToolCalls:        detail.ToolCalls,
+		ToolResultTokens: detail.ToolResultTokens,
+		ImageInputs:      detail.ImageInputs,
+		DocumentInputs:   detail.DocumentInputs,
+		MediaBytes:       detail.MediaBytes,
 	}
 	if tokens.TotalTokens == 0 {
 		tokens.TotalTokens = detail.InputTokens + detail.OutputTokens + detail.ReasoningTokens
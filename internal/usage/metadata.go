@@ -0,0 +1,113 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetadataHeader carries client-supplied usage attribution such as
+// "team=search, project=ranking".
+const MetadataHeader = "X-Usage-Metadata"
+
+// GinMetadataKey stores the parsed usage metadata in the Gin context.
+const GinMetadataKey = "usageMetadata"
+
+const (
+	// maxMetadataHeaderBytes caps the raw header length.
+	maxMetadataHeaderBytes = 1024
+	// maxMetadataPairs caps the number of key=value pairs per request.
+	maxMetadataPairs    = 16
+	maxMetadataKeyLen   = 64
+	maxMetadataValueLen = 256
+)
+
+// ParseMetadata parses an X-Usage-Metadata header made of comma-separated
+// key=value pairs. Keys are limited to letters, digits, '_', '-' and '.', values to
+// printable ASCII without commas. An empty header yields nil metadata.
+func ParseMetadata(header string) (map[string]string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil, nil
+	}
+	if len(header) > maxMetadataHeaderBytes {
+		return nil, fmt.Errorf("%s exceeds %d bytes", MetadataHeader, maxMetadataHeaderBytes)
+	}
+	out := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s entry %q is not a key=value pair", MetadataHeader, pair)
+		}
+		if len(key) > maxMetadataKeyLen || !validMetadataKey(key) {
+			return nil, fmt.Errorf("%s key %q must be at most %d letters, digits, '_', '-' or '.'", MetadataHeader, key, maxMetadataKeyLen)
+		}
+		if len(value) > maxMetadataValueLen || !validMetadataValue(value) {
+			return nil, fmt.Errorf("%s value for %q must be at most %d printable ASCII characters", MetadataHeader, key, maxMetadataValueLen)
+		}
+		if _, dup := out[key]; dup {
+			return nil, fmt.Errorf("%s key %q is given more than once", MetadataHeader, key)
+		}
+		out[key] = value
+		if len(out) > maxMetadataPairs {
+			return nil, fmt.Errorf("%s has more than %d entries", MetadataHeader, maxMetadataPairs)
+		}
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+func validMetadataKey(key string) bool {
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validMetadataValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestMetadata returns the usage metadata attached to the request behind ctx.
+func requestMetadata(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || ginCtx == nil {
+		return nil
+	}
+	metadata, _ := ginCtx.Value(GinMetadataKey).(map[string]string)
+	return metadata
+}
+
+// encodeMetadata renders metadata for the usage_requests.metadata column.
+func encodeMetadata(metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
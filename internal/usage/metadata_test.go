@@ -0,0 +1,39 @@
+package usage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMetadata(t *testing.T) {
+	metadata, err := ParseMetadata(" team=search , project=ranking-v2,, cost.center = 42 ")
+	if err != nil {
+		t.Fatalf("ParseMetadata failed: %v", err)
+	}
+	if len(metadata) != 3 || metadata["team"] != "search" || metadata["project"] != "ranking-v2" || metadata["cost.center"] != "42" {
+		t.Fatalf("unexpected metadata: %+v", metadata)
+	}
+	if metadata, err = ParseMetadata(""); err != nil || metadata != nil {
+		t.Fatalf("expected nil metadata for empty header, got %+v (err=%v)", metadata, err)
+	}
+
+	tooMany := make([]string, 0, maxMetadataPairs+1)
+	for i := 0; i <= maxMetadataPairs; i++ {
+		tooMany = append(tooMany, "k"+strings.Repeat("x", i)+"=v")
+	}
+	for _, header := range []string{
+		"team",
+		"=search",
+		"team name=search",
+		"team=search,team=ads",
+		"team=café",
+		"team=" + strings.Repeat("x", maxMetadataValueLen+1),
+		strings.Repeat("k", maxMetadataKeyLen+1) + "=v",
+		strings.Join(tooMany, ","),
+		"team=" + strings.Repeat("x,", maxMetadataHeaderBytes),
+	} {
+		if _, err := ParseMetadata(header); err == nil {
+			t.Fatalf("expected %q to be rejected", header)
+		}
+	}
+}
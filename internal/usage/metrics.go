@@ -0,0 +1,106 @@
+package usage
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+type metricKind int
+
+const (
+	metricCounter metricKind = iota
+	metricTiming
+)
+
+// metric is a single sample derived from a usage record. Sinks render it in their
+// own wire format (OTLP attributes, StatsD lines).
+type metric struct {
+	name  string
+	kind  metricKind
+	value int64
+}
+
+// metricTag is an ordered key/value dimension attached to every metric of a record.
+type metricTag struct {
+	key   string
+	value string
+}
+
+// recordSample is the sink-independent view of a usage record.
+type recordSample struct {
+	tags     []metricTag
+	metrics  []metric
+	status   int
+	duration time.Duration
+}
+
+// recordDuration returns the request latency carried by the record, falling back
+// to the time elapsed since the request started for publishers that do not set it.
+func recordDuration(record coreusage.Record) time.Duration {
+	if record.Latency > 0 {
+		return record.Latency
+	}
+	if !record.RequestedAt.IsZero() {
+		if d := time.Since(record.RequestedAt); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sampleRecord maps a usage record onto the metric set shared by every telemetry sink.
+func sampleRecord(ctx context.Context, record coreusage.Record) recordSample {
+	status := recordStatus(ctx, record)
+	duration := recordDuration(record)
+
+	provider := record.Provider
+	if provider == "" {
+		provider = "unknown"
+	}
+	sample := recordSample{
+		tags: []metricTag{
+			{key: "provider", value: provider},
+			{key: "model", value: record.Model},
+			{key: "failed", value: strconv.FormatBool(record.Failed)},
+		},
+		status:   status,
+		duration: duration,
+	}
+	if status > 0 {
+		sample.tags = append(sample.tags, metricTag{key: "status", value: strconv.Itoa(status)})
+	}
+	if record.PolicyDenied {
+		sample.tags = append(sample.tags, metricTag{key: "policy_denied", value: "true"})
+	}
+	if record.Rejection != "" {
+		sample.tags = append(sample.tags, metricTag{key: "rejection", value: record.Rejection})
+	}
+
+	detail := normaliseDetail(record.Detail)
+	sample.metrics = append(sample.metrics, metric{name: "requests", kind: metricCounter, value: 1})
+	if record.Failed {
+		sample.metrics = append(sample.metrics, metric{name: "requests.failed", kind: metricCounter, value: 1})
+	}
+	for _, tok := range []struct {
+		name  string
+		value int64
+	}{
+		{"tokens.input", detail.InputTokens},
+		{"tokens.output", detail.OutputTokens},
+		{"tokens.reasoning", detail.ReasoningTokens},
+		{"tokens.cached", detail.CachedTokens},
+		{"tokens.cache_creation", detail.CacheCreationTokens},
+		{"tokens.total", detail.TotalTokens},
+	} {
+		if tok.value > 0 {
+			sample.metrics = append(sample.metrics, metric{name: tok.name, kind: metricCounter, value: tok.value})
+		}
+	}
+	if duration > 0 {
+		sample.metrics = append(sample.metrics, metric{name: "request.duration", kind: metricTiming, value: duration.Milliseconds()})
+	}
+	return sample
+}
@@ -0,0 +1,102 @@
+package usage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+const (
+	// OTLPEventSchemaVersion is the version of the OTLPEvent layout. Version 1 was
+	// the unversioned schema that only carried usage.record events; version 2 adds
+	// schema_version and lifecycle events named after their event bus type.
+	OTLPEventSchemaVersion = 2
+	// OTLPEventUsageRecord names the event exported for every sampled request.
+	OTLPEventUsageRecord = "usage.record"
+
+	otlpComponent = "cli-proxy-api"
+)
+
+// EmitOTLPEvent exports a custom event through the OTLP plugin. Event must be set;
+// the component, timestamp and schema version are filled in when empty. Custom
+// events are not sampled and skip the plugin when export is disabled or the event
+// is excluded. Code outside this module publishes on the events bus instead, which
+// is forwarded the same way.
+func EmitOTLPEvent(event OTLPEvent) {
+	if globalOTLPPlugin == nil {
+		return
+	}
+	globalOTLPPlugin.emit(&event)
+}
+
+// HandleEvent forwards a lifecycle event from the events bus as an OTLP event
+// named after its type, e.g. credential.refresh_failed or circuit.opened.
+func (p *OTLPPlugin) HandleEvent(evt events.Event) {
+	p.emit(convertLifecycleEvent(evt))
+}
+
+func (p *OTLPPlugin) emit(event *OTLPEvent) {
+	if event == nil || strings.TrimSpace(event.Event) == "" {
+		return
+	}
+	p.enabledMu.RLock()
+	enabled, exclude := p.enabled, p.export.ExcludeEvents
+	p.enabledMu.RUnlock()
+	if !enabled || otlpEventExcluded(exclude, event.Event) {
+		return
+	}
+	if event.SchemaVersion == 0 {
+		event.SchemaVersion = OTLPEventSchemaVersion
+	}
+	if event.Component == "" {
+		event.Component = otlpComponent
+	}
+	if event.Timestamp == "" {
+		event.Timestamp = time.Now().Format(time.RFC3339Nano)
+	}
+	p.enqueue(event)
+}
+
+// convertLifecycleEvent maps an events bus notification to an OTLP event. The auth
+// ID, reason and event data are carried as attributes.
+func convertLifecycleEvent(evt events.Event) *OTLPEvent {
+	timestamp := evt.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	event := &OTLPEvent{
+		SchemaVersion: OTLPEventSchemaVersion,
+		Component:     otlpComponent,
+		Event:         string(evt.Type),
+		Timestamp:     timestamp.Format(time.RFC3339Nano),
+		Provider:      evt.Provider,
+		Model:         evt.Model,
+		Attributes:    make(map[string]interface{}, len(evt.Data)+2),
+	}
+	for key, value := range evt.Data {
+		event.Attributes[key] = value
+	}
+	if evt.AuthID != "" {
+		event.Attributes["auth_id"] = evt.AuthID
+	}
+	if evt.Reason != "" {
+		event.Attributes["reason"] = evt.Reason
+	}
+	return event
+}
+
+// otlpEventExcluded reports whether name matches an exclusion: an exact name, or a
+// prefix ending in ".".
+func otlpEventExcluded(exclude []string, name string) bool {
+	for _, pattern := range exclude {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if pattern == name || (strings.HasSuffix(pattern, ".") && strings.HasPrefix(name, pattern)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+func TestOTLPPluginExportsLifecycleEvents(t *testing.T) {
+	plugin := &OTLPPlugin{enabled: true, batchSize: 100}
+	plugin.export.ExcludeEvents = []string{"circuit.", "budget.crossed"}
+
+	at := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	plugin.HandleEvent(events.Event{
+		Type:     events.CredentialRefreshFailed,
+		Time:     at,
+		Provider: "claude",
+		AuthID:   "auth-1",
+		Reason:   "token revoked",
+		Data:     map[string]any{"consecutive_failures": 3},
+	})
+	plugin.HandleEvent(events.Event{Type: events.CircuitOpened, AuthID: "auth-1"})
+	plugin.HandleEvent(events.Event{Type: events.BudgetCrossed})
+	plugin.emit(&OTLPEvent{Event: "quota.breached", Provider: "codex"})
+	plugin.emit(&OTLPEvent{Provider: "codex"})
+
+	if len(plugin.batch) != 2 {
+		t.Fatalf("expected 2 queued events, got %d", len(plugin.batch))
+	}
+	refresh := plugin.batch[0]
+	if refresh.Event != "credential.refresh_failed" || refresh.SchemaVersion != OTLPEventSchemaVersion ||
+		refresh.Component != "cli-proxy-api" || refresh.Timestamp != at.Format(time.RFC3339Nano) {
+		t.Fatalf("unexpected lifecycle event %+v", refresh)
+	}
+	if refresh.Attributes["auth_id"] != "auth-1" || refresh.Attributes["reason"] != "token revoked" ||
+		refresh.Attributes["consecutive_failures"] != 3 {
+		t.Fatalf("unexpected lifecycle attributes %+v", refresh.Attributes)
+	}
+	custom := plugin.batch[1]
+	if custom.Event != "quota.breached" || custom.SchemaVersion != OTLPEventSchemaVersion || custom.Timestamp == "" {
+		t.Fatalf("unexpected custom event %+v", custom)
+	}
+
+	plugin.SetEnabled(false)
+	plugin.HandleEvent(events.Event{Type: events.ConfigReloaded})
+	if len(plugin.batch) != 2 {
+		t.Fatalf("events queued while export is disabled: %d", len(plugin.batch))
+	}
+}
@@ -0,0 +1,204 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+)
+
+const (
+	// otlpEndpointCooldown is how long a failed collector is skipped while others are up.
+	otlpEndpointCooldown = 30 * time.Second
+	// otlpSRVRefresh is how long resolved SRV targets are reused.
+	otlpSRVRefresh = time.Minute
+	// otlpSRVLookupTimeout bounds one SRV lookup.
+	otlpSRVLookupTimeout = 5 * time.Second
+)
+
+// OTLPEndpointStatus reports the health of one candidate collector.
+type OTLPEndpointStatus struct {
+	Endpoint  string     `json:"endpoint"`
+	Active    bool       `json:"active"`
+	Healthy   bool       `json:"healthy"`
+	DownUntil *time.Time `json:"down-until,omitempty"`
+	LastError string     `json:"last-error,omitempty"`
+}
+
+// otlpEndpoints orders candidate collectors for failover. Candidates are the SRV
+// targets, in priority order, followed by the configured endpoints. A collector
+// that fails an export is skipped for otlpEndpointCooldown while another one is
+// healthy, so exports return to the primary once it recovers.
+type otlpEndpoints struct {
+	mu        sync.Mutex
+	srv       otlpSRV
+	targets   []string
+	lookedUp  time.Time
+	down      map[string]time.Time
+	lastError map[string]string
+	active    string
+	lookup    func(ctx context.Context, name string) ([]*net.SRV, error)
+	now       func() time.Time
+}
+
+// otlpSRV describes collectors discovered through a DNS SRV record.
+type otlpSRV struct {
+	name, scheme, path string
+}
+
+func newOTLPEndpoints() *otlpEndpoints {
+	return &otlpEndpoints{
+		down:      make(map[string]time.Time),
+		lastError: make(map[string]string),
+		lookup: func(ctx context.Context, name string) ([]*net.SRV, error) {
+			_, addrs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+			return addrs, err
+		},
+		now: time.Now,
+	}
+}
+
+// configure replaces the SRV record, dropping targets resolved for the previous one.
+func (e *otlpEndpoints) configure(opts OTLPExportOptions) {
+	srv := otlpSRV{
+		name:   strings.TrimSpace(opts.SRVName),
+		scheme: strings.ToLower(strings.TrimSpace(opts.SRVScheme)),
+		path:   strings.TrimSpace(opts.SRVPath),
+	}
+	if srv.scheme == "" {
+		srv.scheme = "http"
+	}
+	if srv.path == "" {
+		srv.path = "/v1/logs"
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if srv != e.srv {
+		e.srv = srv
+		e.targets = nil
+		e.lookedUp = time.Time{}
+	}
+}
+
+// candidates returns the collectors to try, healthy ones first and each group in
+// configured order; configured lists endpoint followed by its fallbacks.
+func (e *otlpEndpoints) candidates(configured []string) []string {
+	all := slices.Concat(e.discovered(), configured)
+	now := e.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	seen := make(map[string]bool, len(all))
+	var healthy, down []string
+	for _, endpoint := range all {
+		if endpoint == "" || seen[endpoint] {
+			continue
+		}
+		seen[endpoint] = true
+		if until, ok := e.down[endpoint]; ok && now.Before(until) {
+			down = append(down, endpoint)
+			continue
+		}
+		healthy = append(healthy, endpoint)
+	}
+	return append(healthy, down...)
+}
+
+// discovered resolves the SRV record, reusing the targets for otlpSRVRefresh. A
+// failed lookup keeps the previous targets.
+func (e *otlpEndpoints) discovered() []string {
+	e.mu.Lock()
+	srv, targets, fresh := e.srv, e.targets, e.now().Sub(e.lookedUp) < otlpSRVRefresh
+	e.mu.Unlock()
+	if srv.name == "" || fresh {
+		return targets
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpSRVLookupTimeout)
+	defer cancel()
+	addrs, err := e.lookup(ctx, srv.name)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lookedUp = e.now()
+	if err != nil {
+		util.ComponentLog(util.LogComponentOTLP).Debugf("OTLP plugin: SRV lookup of %s failed: %v", srv.name, err)
+		return e.targets
+	}
+	resolved := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		host := strings.TrimSuffix(addr.Target, ".")
+		if host == "" {
+			continue
+		}
+		endpoint := fmt.Sprintf("%s://%s", srv.scheme, net.JoinHostPort(host, strconv.Itoa(int(addr.Port))))
+		if srv.scheme == "http" || srv.scheme == "https" {
+			endpoint += "/" + strings.TrimPrefix(srv.path, "/")
+		}
+		resolved = append(resolved, endpoint)
+	}
+	e.targets = resolved
+	return resolved
+}
+
+// report records the outcome of an export to endpoint. It returns true when a
+// successful export moved the active collector.
+func (e *otlpEndpoints) report(endpoint string, err error) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.down[endpoint] = e.now().Add(otlpEndpointCooldown)
+		e.lastError[endpoint] = err.Error()
+		if e.active == endpoint {
+			e.active = ""
+		}
+		return false
+	}
+	delete(e.down, endpoint)
+	delete(e.lastError, endpoint)
+	if e.active == endpoint {
+		return false
+	}
+	e.active = endpoint
+	return true
+}
+
+// current returns the collector that took the last successful export, or the
+// first candidate before any export succeeded.
+func (e *otlpEndpoints) current(configured []string) string {
+	candidates := e.candidates(configured)
+	e.mu.Lock()
+	active := e.active
+	e.mu.Unlock()
+	if slices.Contains(candidates, active) {
+		return active
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return ""
+}
+
+// statuses reports every candidate collector.
+func (e *otlpEndpoints) statuses(configured []string) []OTLPEndpointStatus {
+	candidates := e.candidates(configured)
+	active := e.current(configured)
+	now := e.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]OTLPEndpointStatus, 0, len(candidates))
+	for _, endpoint := range candidates {
+		status := OTLPEndpointStatus{Endpoint: endpoint, Active: endpoint == active, Healthy: true, LastError: e.lastError[endpoint]}
+		if until, ok := e.down[endpoint]; ok && now.Before(until) {
+			until = until.UTC()
+			status.Healthy = false
+			status.DownUntil = &until
+		}
+		out = append(out, status)
+	}
+	return out
+}
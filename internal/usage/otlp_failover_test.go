@@ -0,0 +1,90 @@
+package usage
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+func TestOTLPPluginFailsOver(t *testing.T) {
+	var primaryUp atomic.Bool
+	var primaryHits, secondaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		if !primaryUp.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits.Add(1)
+	}))
+	defer secondary.Close()
+
+	plugin := &OTLPPlugin{endpoint: primary.URL, enabled: true}
+	if err := plugin.Configure(OTLPExportOptions{BatchSize: 1, Endpoints: []string{secondary.URL}}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	now := time.Now()
+	plugin.endpoints.now = func() time.Time { return now }
+	record := coreusage.Record{Provider: "claude", Model: "claude-sonnet"}
+
+	plugin.HandleUsage(context.Background(), record)
+	if primaryHits.Load() != 1 || secondaryHits.Load() != 1 || plugin.GetEndpoint() != secondary.URL {
+		t.Fatalf("expected failover to the secondary, got hits %d/%d and endpoint %s", primaryHits.Load(), secondaryHits.Load(), plugin.GetEndpoint())
+	}
+	plugin.HandleUsage(context.Background(), record)
+	if primaryHits.Load() != 1 || secondaryHits.Load() != 2 {
+		t.Fatalf("expected the failed primary to be skipped, got hits %d/%d", primaryHits.Load(), secondaryHits.Load())
+	}
+	statuses := plugin.EndpointStatuses()
+	if len(statuses) != 2 || statuses[0].Endpoint != secondary.URL || !statuses[0].Active || statuses[1].Healthy {
+		t.Fatalf("unexpected statuses %+v", statuses)
+	}
+
+	primaryUp.Store(true)
+	now = now.Add(otlpEndpointCooldown)
+	plugin.HandleUsage(context.Background(), record)
+	if primaryHits.Load() != 2 || secondaryHits.Load() != 2 || plugin.GetEndpoint() != primary.URL {
+		t.Fatalf("expected exports to return to the primary, got hits %d/%d and endpoint %s", primaryHits.Load(), secondaryHits.Load(), plugin.GetEndpoint())
+	}
+}
+
+func TestOTLPEndpointsDiscoverSRV(t *testing.T) {
+	endpoints := newOTLPEndpoints()
+	var lookups atomic.Int32
+	endpoints.lookup = func(ctx context.Context, name string) ([]*net.SRV, error) {
+		lookups.Add(1)
+		return []*net.SRV{
+			{Target: "collector-a.example.com.", Port: 4318, Priority: 10},
+			{Target: "collector-b.example.com.", Port: 4318, Priority: 20},
+		}, nil
+	}
+	endpoints.configure(OTLPExportOptions{SRVName: "_otlp._tcp.example.com"})
+
+	got := endpoints.candidates([]string{"http://static:4318/v1/logs"})
+	want := []string{"http://collector-a.example.com:4318/v1/logs", "http://collector-b.example.com:4318/v1/logs", "http://static:4318/v1/logs"}
+	if len(got) != len(want) {
+		t.Fatalf("candidates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candidates = %v, want %v", got, want)
+		}
+	}
+	endpoints.candidates(nil)
+	if lookups.Load() != 1 {
+		t.Fatalf("expected resolved targets to be reused, got %d lookups", lookups.Load())
+	}
+
+	endpoints.configure(OTLPExportOptions{SRVName: "_otlp._tcp.example.com", SRVScheme: "grpcs"})
+	if got = endpoints.candidates(nil); len(got) != 2 || got[0] != "grpcs://collector-a.example.com:4318" {
+		t.Fatalf("expected gRPC targets without a path, got %v", got)
+	}
+}
@@ -0,0 +1,417 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// OTLP export protocols.
+const (
+	// OTLPProtocolHTTPJSON posts JSON events over HTTP (the default, usually port 4318).
+	OTLPProtocolHTTPJSON = "http/json"
+	// OTLPProtocolGRPC sends OTLP/gRPC ExportLogsServiceRequest messages (usually port 4317).
+	OTLPProtocolGRPC = "grpc"
+
+	otlpGRPCLogsPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	otlpScopeName    = "github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+)
+
+// OTLPExportOptions configures how the OTLP plugin reaches its collector.
+type OTLPExportOptions struct {
+	// Enabled toggles export; applied by ConfigureOTLPExport only.
+	Enabled bool
+	// Endpoint overrides the collector URL when set.
+	Endpoint string
+	// Endpoints are fallback collectors tried in order when Endpoint fails.
+	Endpoints []string
+	// SRVName discovers collectors from a DNS SRV record. Its targets are tried
+	// before Endpoint and Endpoints, in priority order.
+	SRVName string
+	// SRVScheme is the scheme of discovered collectors: http (default), https, grpc
+	// or grpcs.
+	SRVScheme string
+	// SRVPath is appended to discovered http(s) collectors. Defaults to /v1/logs.
+	SRVPath string
+	// Protocol is "http/json" or "grpc". Endpoints using the grpc:// or grpcs://
+	// scheme always use gRPC.
+	Protocol string
+	// Headers are added to every export request, e.g. collector API keys.
+	Headers map[string]string
+	// CAFile is a PEM bundle used to verify the collector's certificate.
+	CAFile string
+	// InsecureSkipVerify disables certificate verification.
+	InsecureSkipVerify bool
+	// Timeout bounds each export request. Defaults to 5s.
+	Timeout time.Duration
+	// BatchSize buffers this many events per export request. Defaults to 10; 1 sends
+	// each event as it arrives.
+	BatchSize int
+	// FlushInterval bounds how long a partial batch waits. Defaults to 5s.
+	FlushInterval time.Duration
+	// SpoolDir enables the on-disk spool for events that fail to export.
+	SpoolDir string
+	// SpoolMaxBytes caps the spool size. Defaults to 64 MiB.
+	SpoolMaxBytes int64
+	// SpoolMaxAge drops spooled events older than this. Defaults to 24h.
+	SpoolMaxAge time.Duration
+	// Sampling exports only a share of events. Every event is exported when nil.
+	Sampling *OTLPSampling
+	// ResourceAttributes are attached to every export, e.g. deployment.environment.
+	// service.name defaults to cli-proxy-api.
+	ResourceAttributes map[string]string
+	// ExcludeEvents lists event names that are not exported. A name ending in "."
+	// excludes every event with that prefix, e.g. "circuit.".
+	ExcludeEvents []string
+}
+
+// otlpExportFromEnv reads DY_NOTI_OTEL_PROTOCOL and DY_NOTI_OTEL_HEADERS
+// ("key=value,key2=value2"), mirroring the OTEL_EXPORTER_OTLP_* conventions.
+func otlpExportFromEnv() OTLPExportOptions {
+	opts := OTLPExportOptions{Protocol: strings.TrimSpace(os.Getenv("DY_NOTI_OTEL_PROTOCOL"))}
+	for _, pair := range strings.Split(os.Getenv("DY_NOTI_OTEL_HEADERS"), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		if opts.Headers == nil {
+			opts.Headers = make(map[string]string)
+		}
+		opts.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return opts
+}
+
+// normalizeOTLPResource trims attribute names and values, dropping unnamed ones.
+func normalizeOTLPResource(attributes map[string]string) map[string]string {
+	if len(attributes) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		if key = strings.TrimSpace(key); key != "" {
+			out[key] = strings.TrimSpace(value)
+		}
+	}
+	return out
+}
+
+func normalizeOTLPProtocol(protocol string) string {
+	switch strings.ToLower(strings.TrimSpace(protocol)) {
+	case "grpc", "otlp/grpc":
+		return OTLPProtocolGRPC
+	default:
+		return OTLPProtocolHTTPJSON
+	}
+}
+
+// otlpTarget resolves the endpoint into the URL to post to and whether it speaks gRPC.
+// grpc:// is plaintext HTTP/2, grpcs:// is TLS; gRPC targets drop any path.
+func otlpTarget(endpoint, protocol string) (string, bool, error) {
+	u, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		return "", false, fmt.Errorf("parse endpoint: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "grpc":
+		u.Scheme = "http"
+	case "grpcs":
+		u.Scheme = "https"
+	default:
+		if protocol != OTLPProtocolGRPC {
+			return u.String(), false, nil
+		}
+	}
+	if u.Host == "" {
+		return "", false, fmt.Errorf("endpoint %q has no host", endpoint)
+	}
+	return u.Scheme + "://" + u.Host + otlpGRPCLogsPath, true, nil
+}
+
+func otlpTLSConfig(opts OTLPExportOptions) (*tls.Config, error) {
+	if opts.CAFile == "" && !opts.InsecureSkipVerify {
+		return nil, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read OTLP CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("OTLP CA file %s contains no certificates", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// newOTLPClients builds the HTTP/1.1 client for JSON export and the HTTP/2 client
+// for gRPC export. The gRPC client speaks h2c to plaintext http:// targets.
+func newOTLPClients(opts OTLPExportOptions) (*http.Client, *http.Client, error) {
+	tlsConfig, err := otlpTLSConfig(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		httpTransport.TLSClientConfig = tlsConfig.Clone()
+	}
+	grpcTransport := &http2.Transport{TLSClientConfig: tlsConfig}
+	h2c := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	grpcClient := &http.Client{Timeout: timeout, Transport: grpcSchemeTransport{tls: grpcTransport, plain: h2c}}
+	return &http.Client{Timeout: timeout, Transport: httpTransport}, grpcClient, nil
+}
+
+// grpcSchemeTransport routes https:// to TLS HTTP/2 and http:// to h2c.
+type grpcSchemeTransport struct {
+	tls   http.RoundTripper
+	plain http.RoundTripper
+}
+
+func (t grpcSchemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.plain.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+// sendGRPC posts events as a single OTLP ExportLogsServiceRequest.
+func sendGRPC(client *http.Client, target string, headers, resource map[string]string, events []*OTLPEvent) error {
+	msg := encodeExportLogsRequest(events, resource)
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, target, bytes.NewReader(frame))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", "CLIProxyAPI-OTLP-Exporter/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// Trailers are only populated once the body has been read to EOF.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// Trailers-only responses carry the status in the headers.
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if status != "" && status != "0" {
+		if decoded, errUnescape := url.PathUnescape(message); errUnescape == nil {
+			message = decoded
+		}
+		return fmt.Errorf("gRPC status %s: %s", status, message)
+	}
+	return nil
+}
+
+// encodeExportLogsRequest hand-encodes the opentelemetry.proto.collector.logs.v1
+// ExportLogsServiceRequest so the exporter does not need generated OTLP types.
+// Events are grouped into one ResourceLogs per sample rate, which is carried in the
+// sample_rate resource attribute next to the configured resource attributes.
+func encodeExportLogsRequest(events []*OTLPEvent, attributes map[string]string) []byte {
+	var (
+		rates  []float64
+		groups = make(map[float64][]*OTLPEvent)
+	)
+	for _, event := range events {
+		rate := event.SampleRate
+		if rate <= 0 {
+			rate = 1
+		}
+		if _, ok := groups[rate]; !ok {
+			rates = append(rates, rate)
+		}
+		groups[rate] = append(groups[rate], event)
+	}
+
+	var base []byte
+	if _, ok := attributes["service.name"]; !ok {
+		base = appendMessage(base, 1, appendKeyValue(nil, "service.name", "cli-proxy-api"))
+	}
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		base = appendMessage(base, 1, appendKeyValue(nil, key, attributes[key]))
+	}
+
+	var out []byte
+	for _, rate := range rates {
+		resource := slices.Clone(base)
+		resource = appendMessage(resource, 1, appendKeyValue(nil, "sample_rate", rate))
+
+		var scope []byte
+		scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+		scope = protowire.AppendString(scope, otlpScopeName)
+
+		var scopeLogs []byte
+		scopeLogs = appendMessage(scopeLogs, 1, scope)
+		for _, event := range groups[rate] {
+			scopeLogs = appendMessage(scopeLogs, 2, encodeLogRecord(event))
+		}
+
+		var resourceLogs []byte
+		resourceLogs = appendMessage(resourceLogs, 1, resource)
+		resourceLogs = appendMessage(resourceLogs, 2, scopeLogs)
+		out = appendMessage(out, 1, resourceLogs)
+	}
+	return out
+}
+
+func encodeLogRecord(event *OTLPEvent) []byte {
+	var b []byte
+	ts := time.Now()
+	if parsed, err := time.Parse(time.RFC3339Nano, event.Timestamp); err == nil {
+		ts = parsed
+	}
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(ts.UnixNano()))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, 9) // SEVERITY_NUMBER_INFO
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, "INFO")
+	b = appendMessage(b, 5, encodeAnyValue(event.Event))
+
+	attrs := map[string]any{
+		"schema_version": event.SchemaVersion,
+		"component":      event.Component,
+		"provider":       event.Provider,
+		"model":          event.Model,
+	}
+	if event.AccountEmail != "" {
+		attrs["account_email"] = event.AccountEmail
+	}
+	if event.ConversationID != "" {
+		attrs["conversation_id"] = event.ConversationID
+	}
+	if event.TurnID != "" {
+		attrs["turn_id"] = event.TurnID
+	}
+	if event.RequestDurationMs > 0 {
+		attrs["request_duration_ms"] = event.RequestDurationMs
+	}
+	if event.StatusCode > 0 {
+		attrs["status_code"] = event.StatusCode
+	}
+	for kind, value := range event.Tokens {
+		attrs["tokens."+kind] = value
+	}
+	for key, value := range event.Attributes {
+		attrs[key] = value
+	}
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b = appendMessage(b, 6, appendKeyValue(nil, key, attrs[key]))
+	}
+
+	if id, ok := attrs["trace_id"].(string); ok {
+		if raw, err := hex.DecodeString(id); err == nil && len(raw) == 16 {
+			b = protowire.AppendTag(b, 9, protowire.BytesType)
+			b = protowire.AppendBytes(b, raw)
+		}
+	}
+	if id, ok := attrs["span_id"].(string); ok {
+		if raw, err := hex.DecodeString(id); err == nil && len(raw) == 8 {
+			b = protowire.AppendTag(b, 10, protowire.BytesType)
+			b = protowire.AppendBytes(b, raw)
+		}
+	}
+	b = protowire.AppendTag(b, 11, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(time.Now().UnixNano()))
+	return b
+}
+
+func appendMessage(b []byte, field protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendKeyValue(b []byte, key string, value any) []byte {
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, key)
+	return appendMessage(b, 2, encodeAnyValue(value))
+}
+
+// encodeAnyValue encodes an opentelemetry.proto.common.v1.AnyValue.
+func encodeAnyValue(value any) []byte {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case bool:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case int:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(int64(v)))
+	case int64:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case uint64:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, v)
+	case float64:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case []string:
+		var arr []byte
+		for _, item := range v {
+			arr = appendMessage(arr, 1, encodeAnyValue(item))
+		}
+		b = appendMessage(b, 5, arr)
+	default:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, fmt.Sprint(v))
+	}
+	return b
+}
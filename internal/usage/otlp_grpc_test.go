@@ -0,0 +1,201 @@
+package usage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestOTLPTarget(t *testing.T) {
+	cases := []struct {
+		endpoint, protocol, want string
+		grpc                     bool
+	}{
+		{"http://collector:4318/v1/logs", OTLPProtocolHTTPJSON, "http://collector:4318/v1/logs", false},
+		{"grpc://collector:4317", OTLPProtocolHTTPJSON, "http://collector:4317" + otlpGRPCLogsPath, true},
+		{"grpcs://collector:4317", OTLPProtocolHTTPJSON, "https://collector:4317" + otlpGRPCLogsPath, true},
+		{"https://collector:4317/v1/logs", OTLPProtocolGRPC, "https://collector:4317" + otlpGRPCLogsPath, true},
+	}
+	for _, tc := range cases {
+		got, grpc, err := otlpTarget(tc.endpoint, tc.protocol)
+		if err != nil || got != tc.want || grpc != tc.grpc {
+			t.Errorf("otlpTarget(%q, %q) = %q, %v, %v; want %q, %v", tc.endpoint, tc.protocol, got, grpc, err, tc.want, tc.grpc)
+		}
+	}
+}
+
+func TestOTLPPluginSendsGRPC(t *testing.T) {
+	var (
+		gotPath, gotAuth, gotType string
+		gotBody                   []byte
+	)
+	status := "0"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("x-api-key")
+		gotType = r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Grpc-Status", status)
+		w.Header().Set("Grpc-Message", "rejected")
+	})
+	server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer server.Close()
+
+	plugin := &OTLPPlugin{endpoint: "grpc://" + strings.TrimPrefix(server.URL, "http://"), enabled: true}
+	if err := plugin.Configure(OTLPExportOptions{
+		Headers:            map[string]string{"x-api-key": "secret"},
+		ResourceAttributes: map[string]string{"deployment.environment": "staging"},
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	event := &OTLPEvent{
+		Component: "cli-proxy-api",
+		Event:     "usage.record",
+		Timestamp: "2026-01-02T03:04:05Z",
+		Provider:  "claude",
+		Model:     "claude-sonnet",
+		Tokens:    map[string]int64{"total": 42},
+	}
+	if err := plugin.sendEvent(event); err != nil {
+		t.Fatalf("sendEvent: %v", err)
+	}
+	if gotPath != otlpGRPCLogsPath || gotAuth != "secret" || gotType != "application/grpc" {
+		t.Fatalf("unexpected request: path=%q auth=%q type=%q", gotPath, gotAuth, gotType)
+	}
+	if len(gotBody) < 5 || int(binary.BigEndian.Uint32(gotBody[1:5])) != len(gotBody)-5 {
+		t.Fatalf("invalid gRPC frame of %d bytes", len(gotBody))
+	}
+	msg := gotBody[5:]
+	if num, typ, n := protowire.ConsumeTag(msg); num != 1 || typ != protowire.BytesType || n < 0 {
+		t.Fatalf("expected resource_logs field, got field %d type %d", num, typ)
+	}
+	for _, want := range []string{"service.name", "cli-proxy-api", "deployment.environment", "staging", "usage.record", "claude-sonnet", "tokens.total"} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("encoded request missing %q", want)
+		}
+	}
+
+	status = "14"
+	if err := plugin.sendEvent(event); err == nil || !strings.Contains(err.Error(), "gRPC status 14: rejected") {
+		t.Fatalf("expected gRPC status error, got %v", err)
+	}
+}
+
+func TestOTLPPluginBatchesEvents(t *testing.T) {
+	var mu sync.Mutex
+	var payloads [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		payloads = append(payloads, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	posts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(payloads)
+	}
+
+	plugin := &OTLPPlugin{endpoint: server.URL, enabled: true}
+	if err := plugin.Configure(OTLPExportOptions{BatchSize: 3}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	record := coreusage.Record{Provider: "claude", Model: "claude-sonnet"}
+	plugin.HandleUsage(context.Background(), record)
+	plugin.HandleUsage(context.Background(), record)
+	if got := posts(); got != 0 {
+		t.Fatalf("expected events to be buffered, got %d posts", got)
+	}
+	plugin.HandleUsage(context.Background(), record)
+	if got := posts(); got != 1 {
+		t.Fatalf("expected a full batch to be sent in one request, got %d", got)
+	}
+	var events []OTLPEvent
+	if err := json.Unmarshal(payloads[0], &events); err != nil || len(events) != 3 {
+		t.Fatalf("expected a JSON array of 3 events, got %s (%v)", payloads[0], err)
+	}
+
+	plugin.HandleUsage(context.Background(), record)
+	plugin.HandleUsage(context.Background(), record)
+	if err := plugin.Configure(OTLPExportOptions{BatchSize: 1, ResourceAttributes: map[string]string{" instance.id ": "proxy-01"}}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if got := posts(); got != 2 {
+		t.Fatalf("shrinking the batch size should flush pending events, got %d posts", got)
+	}
+	plugin.HandleUsage(context.Background(), record)
+	if got := posts(); got != 3 {
+		t.Fatalf("batch size 1 should send immediately, got %d posts", got)
+	}
+	var single []OTLPEvent
+	if err := json.Unmarshal(payloads[2], &single); err != nil || len(single) != 1 || single[0].Model != "claude-sonnet" {
+		t.Fatalf("expected a JSON array holding one event, got %s (%v)", payloads[2], err)
+	}
+	if single[0].Resource["instance.id"] != "proxy-01" {
+		t.Fatalf("expected the resource attributes on the event, got %s", payloads[2])
+	}
+}
+
+func TestOTLPPluginSampling(t *testing.T) {
+	var mu sync.Mutex
+	var events []OTLPEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []OTLPEvent
+		if err := json.NewDecoder(r.Body).Decode(&batch); err == nil {
+			mu.Lock()
+			events = append(events, batch...)
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	zero, half := 0.0, 50.0
+	sampling := OTLPSamplingFromConfig(config.OTLPSamplingConfig{
+		Percentage:           &zero,
+		AlwaysSampleFailures: true,
+		Providers:            map[string]float64{"Gemini": 100},
+	})
+	plugin := &OTLPPlugin{endpoint: server.URL, enabled: true}
+	if err := plugin.Configure(OTLPExportOptions{BatchSize: 1, Sampling: sampling}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "claude"})
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "claude", Failed: true})
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "gemini"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || !events[0].Attributes["failed"].(bool) || events[1].Provider != "gemini" {
+		t.Fatalf("unexpected sampled events: %+v", events)
+	}
+	for _, event := range events {
+		if event.SampleRate != 1 {
+			t.Fatalf("expected sample rate 1, got %v", event.SampleRate)
+		}
+	}
+
+	if rate := OTLPSamplingFromConfig(config.OTLPSamplingConfig{Percentage: &half}).rateFor(coreusage.Record{Provider: "claude"}); rate != 0.5 {
+		t.Fatalf("expected rate 0.5, got %v", rate)
+	}
+	if err := ValidateOTLPExport(OTLPExportOptions{Sampling: &OTLPSampling{Rate: 1.5}}); err == nil {
+		t.Fatal("expected out-of-range sampling to be rejected")
+	}
+}
@@ -7,14 +7,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
 	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
 	log "github.com/sirupsen/logrus"
 )
@@ -23,18 +28,24 @@ import (
 type OTLPPlugin struct {
 	endpoint    string
 	client      *http.Client
+	grpcClient  *http.Client
+	export      OTLPExportOptions
 	enabled     bool
 	enabledMu   sync.RWMutex
-	batch       []coreusage.Record
+	batch       []*OTLPEvent
 	batchMu     sync.Mutex
 	batchSize   int
-	batchTimer  *time.Timer
+	flushEvery  time.Duration
 	flushTicker *time.Ticker
 	stopChan    chan struct{}
+	spool       *otlpSpool
+	endpoints   *otlpEndpoints
 }
 
 // OTLPEvent represents the structure of an event sent to OTLP
 type OTLPEvent struct {
+	// SchemaVersion is the OTLPEventSchemaVersion the event was built with.
+	SchemaVersion     int                    `json:"schema_version"`
 	Component         string                 `json:"component"`
 	Event             string                 `json:"event"`
 	Timestamp         string                 `json:"ts"`
@@ -47,6 +58,10 @@ type OTLPEvent struct {
 	RequestDurationMs int64                  `json:"request_duration_ms,omitempty"`
 	StatusCode        int                    `json:"status_code,omitempty"`
 	Attributes        map[string]interface{} `json:"attributes,omitempty"`
+	// SampleRate is the fraction of matching events exported; consumers weight counts by 1/SampleRate.
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	// Resource carries the configured resource attributes, set when the event is exported.
+	Resource map[string]string `json:"resource,omitempty"`
 }
 
 // NewOTLPPlugin creates a new OTLP plugin with default configuration
@@ -57,16 +72,19 @@ func NewOTLPPlugin() *OTLPPlugin {
 	}
 
 	plugin := &OTLPPlugin{
-		endpoint:  endpoint,
-		client:    &http.Client{Timeout: 5 * time.Second},
-		enabled:   true,
-		batchSize: 10,
-		batch:     make([]coreusage.Record, 0, 10),
-		stopChan:  make(chan struct{}),
+		endpoint:    endpoint,
+		enabled:     true,
+		batchSize:   defaultOTLPBatchSize,
+		flushEvery:  defaultOTLPFlushInterval,
+		stopChan:    make(chan struct{}),
+		flushTicker: time.NewTicker(defaultOTLPFlushInterval),
+	}
+
+	if err := plugin.Configure(OTLPExportOptions{}); err != nil {
+		log.Warnf("OTLP plugin: %v", err)
 	}
 
 	// Start periodic batch flush
-	plugin.flushTicker = time.NewTicker(5 * time.Second)
 	go plugin.periodicFlush()
 
 	return plugin
@@ -75,36 +93,50 @@ func NewOTLPPlugin() *OTLPPlugin {
 // HandleUsage implements coreusage.Plugin interface
 func (p *OTLPPlugin) HandleUsage(ctx context.Context, record coreusage.Record) {
 	p.enabledMu.RLock()
-	enabled := p.enabled
+	enabled, sampling := p.enabled, p.export.Sampling
 	p.enabledMu.RUnlock()
 
 	if !enabled {
 		return
 	}
+	rate, sampled := sampling.sample(record)
+	if !sampled {
+		return
+	}
 
-	// Convert the usage record to an OTLP event
+	// Convert while the request context is still available.
 	event := p.convertRecordToEvent(ctx, record)
+	event.SampleRate = rate
+	p.enqueue(event)
+}
 
-	// Send the event immediately (for now, later we'll batch)
-	if err := p.sendEvent(event); err != nil {
-		log.Errorf("OTLP plugin: failed to send event: %v", err)
+// enqueue adds event to the pending batch, exporting the batch once it is full.
+func (p *OTLPPlugin) enqueue(event *OTLPEvent) {
+	p.batchMu.Lock()
+	p.batch = append(p.batch, event)
+	full := len(p.batch) >= p.batchSize
+	p.batchMu.Unlock()
+	if full {
+		p.flushBatch()
 	}
 }
 
 // convertRecordToEvent converts a usage record to an OTLP event
 func (p *OTLPPlugin) convertRecordToEvent(ctx context.Context, record coreusage.Record) *OTLPEvent {
 	event := &OTLPEvent{
-		Component: "cli-proxy-api",
-		Event:     "usage.record",
-		Timestamp: record.RequestedAt.Format(time.RFC3339Nano),
-		Provider:  record.Provider,
-		Model:     record.Model,
+		SchemaVersion: OTLPEventSchemaVersion,
+		Component:     otlpComponent,
+		Event:         OTLPEventUsageRecord,
+		Timestamp:     record.RequestedAt.Format(time.RFC3339Nano),
+		Provider:      record.Provider,
+		Model:         record.Model,
 		Tokens: map[string]int64{
-			"input":     record.Detail.InputTokens,
-			"output":    record.Detail.OutputTokens,
-			"reasoning": record.Detail.ReasoningTokens,
-			"cached":    record.Detail.CachedTokens,
-			"total":     record.Detail.TotalTokens,
+			"input":          record.Detail.InputTokens,
+			"output":         record.Detail.OutputTokens,
+			"reasoning":      record.Detail.ReasoningTokens,
+			"cached":         record.Detail.CachedTokens,
+			"cache_creation": record.Detail.CacheCreationTokens,
+			"total":          record.Detail.TotalTokens,
 		},
 		StatusCode: 200, // Default, will be overridden if needed
 		Attributes: map[string]interface{}{
@@ -116,6 +148,30 @@ func (p *OTLPPlugin) convertRecordToEvent(ctx context.Context, record coreusage.
 		},
 	}
 
+	if len(record.Tags) > 0 {
+		event.Attributes["tags"] = record.Tags
+	}
+	if record.PolicyDenied {
+		event.Attributes["policy_denied"] = true
+	}
+	if record.Rejection != "" {
+		event.Attributes["rejection"] = record.Rejection
+	}
+	if record.RequestedModel != "" {
+		event.Attributes["requested_model"] = record.RequestedModel
+	}
+	if record.QueueWait > 0 {
+		event.Attributes["queue_wait_ms"] = record.QueueWait.Milliseconds()
+	}
+	if record.AudioSeconds > 0 {
+		event.Attributes["audio_seconds"] = record.AudioSeconds
+	}
+	if record.ErrorClass != "" {
+		event.Attributes["error_class"] = record.ErrorClass
+	}
+
+	event.AccountEmail = record.AccountEmail
+
 	// Extract account information from context if available
 	if ginCtx, ok := ctx.Value("gin").(*gin.Context); ok && ginCtx != nil {
 		// Try to get account info from auth manager if available
@@ -138,31 +194,162 @@ func (p *OTLPPlugin) convertRecordToEvent(ctx context.Context, record coreusage.
 			}
 		}
 
-		// Extract status code from response
-		if ginCtx.Writer != nil {
-			event.StatusCode = ginCtx.Writer.Status()
+		if label := clientLabel(ctx); label != "" {
+			event.Attributes["client_label"] = label
+		}
+		for key, value := range requestMetadata(ctx) {
+			event.Attributes["metadata."+key] = value
 		}
+		if requestID := tracing.GinRequestID(ginCtx); requestID != "" {
+			event.Attributes["request_id"] = requestID
+		}
+
+		// Correlate the usage event with the request trace
+		if span := tracing.GinSpan(ginCtx); span != nil {
+			sc := span.Context()
+			event.Attributes["trace_id"] = sc.TraceIDString()
+			event.Attributes["span_id"] = sc.SpanIDString()
+		}
+	}
+
+	// Status and latency come from the mapping shared with the StatsD sink
+	sample := sampleRecord(ctx, record)
+	if sample.status > 0 {
+		event.StatusCode = sample.status
 	}
+	event.RequestDurationMs = sample.duration.Milliseconds()
 
 	return event
 }
 
+// Configure applies protocol, header and TLS settings. Unset fields fall back to
+// DY_NOTI_OTEL_PROTOCOL and DY_NOTI_OTEL_HEADERS.
+func (p *OTLPPlugin) Configure(opts OTLPExportOptions) error {
+	env := otlpExportFromEnv()
+	if strings.TrimSpace(opts.Protocol) == "" {
+		opts.Protocol = env.Protocol
+	}
+	opts.Protocol = normalizeOTLPProtocol(opts.Protocol)
+	headers := make(map[string]string, len(env.Headers)+len(opts.Headers))
+	for k, v := range env.Headers {
+		headers[k] = v
+	}
+	for k, v := range opts.Headers {
+		headers[k] = v
+	}
+	opts.Headers = headers
+	opts.ResourceAttributes = normalizeOTLPResource(opts.ResourceAttributes)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultOTLPBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultOTLPFlushInterval
+	}
+
+	p.batchMu.Lock()
+	p.batchSize = opts.BatchSize
+	if p.flushEvery != opts.FlushInterval {
+		p.flushEvery = opts.FlushInterval
+		if p.flushTicker != nil {
+			p.flushTicker.Reset(opts.FlushInterval)
+		}
+	}
+	drain := len(p.batch) >= p.batchSize
+	p.batchMu.Unlock()
+
+	client, grpcClient, err := newOTLPClients(opts)
+	if err != nil {
+		// Keep exporting with default TLS settings rather than going silent.
+		client, grpcClient, _ = newOTLPClients(OTLPExportOptions{Timeout: opts.Timeout})
+	}
+	p.enabledMu.Lock()
+	p.export = opts
+	p.client = client
+	p.grpcClient = grpcClient
+	if p.endpoints == nil {
+		p.endpoints = newOTLPEndpoints()
+	}
+	p.endpoints.configure(opts)
+	spool := p.spool
+	p.enabledMu.Unlock()
+	if errSpool := p.configureSpool(spool, opts); errSpool != nil && err == nil {
+		err = errSpool
+	}
+	if drain {
+		// The batch size shrank; do not hold events beyond the new size.
+		p.flushBatch()
+	}
+	return err
+}
+
 // sendEvent sends a single event to the OTLP endpoint
 func (p *OTLPPlugin) sendEvent(event *OTLPEvent) error {
-	payload, err := json.Marshal(event)
+	return p.sendEvents([]*OTLPEvent{event})
+}
+
+// sendEvents exports events to the first candidate collector that accepts them,
+// trying the others in failover order.
+func (p *OTLPPlugin) sendEvents(events []*OTLPEvent) error {
+	p.enabledMu.RLock()
+	endpoint, export, client, grpcClient, endpoints := p.endpoint, p.export, p.client, p.grpcClient, p.endpoints
+	p.enabledMu.RUnlock()
+
+	if endpoints == nil {
+		return sendOTLPEvents(endpoint, export, client, grpcClient, events)
+	}
+	candidates := endpoints.candidates(p.configuredEndpoints())
+	var errs []error
+	for _, candidate := range candidates {
+		err := sendOTLPEvents(candidate, export, client, grpcClient, events)
+		if endpoints.report(candidate, err) && len(candidates) > 1 {
+			log.Infof("OTLP plugin: exporting to %s", candidate)
+			followTracesEndpoint(candidate)
+		}
+		if err == nil {
+			return nil
+		}
+		if len(candidates) == 1 {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", candidate, err))
+	}
+	return errors.Join(errs...)
+}
+
+// sendOTLPEvents exports events in a single request to endpoint: one
+// ExportLogsServiceRequest over gRPC, or over HTTP a JSON array of events, also when
+// the batch holds a single event.
+func sendOTLPEvents(endpoint string, export OTLPExportOptions, client, grpcClient *http.Client, events []*OTLPEvent) error {
+	target, useGRPC, err := otlpTarget(endpoint, export.Protocol)
+	if err != nil {
+		return err
+	}
+	if useGRPC {
+		return sendGRPC(grpcClient, target, export.Headers, export.ResourceAttributes, events)
+	}
+	for _, event := range events {
+		event.Resource = export.ResourceAttributes
+	}
+	payload, err := json.Marshal(events)
 	if err != nil {
-		return fmt.Errorf("marshal event: %w", err)
+		return fmt.Errorf("marshal events: %w", err)
 	}
+	return postOTLPPayload(client, target, export.Headers, payload)
+}
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", p.endpoint, bytes.NewBuffer(payload))
+func postOTLPPayload(client *http.Client, target string, headers map[string]string, payload []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), "POST", target, bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
 
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "CLIProxyAPI-OTLP-Exporter/1.0")
 
-	resp, err := p.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("send request: %w", err)
 	}
@@ -196,11 +383,39 @@ func (p *OTLPPlugin) SetEndpoint(endpoint string) {
 	p.enabledMu.Unlock()
 }
 
-// GetEndpoint returns the current OTLP endpoint
+// GetEndpoint returns the active OTLP endpoint: the collector that took the last
+// export, or the preferred one before any export.
 func (p *OTLPPlugin) GetEndpoint() string {
+	p.enabledMu.RLock()
+	endpoint, endpoints := p.endpoint, p.endpoints
+	p.enabledMu.RUnlock()
+	if endpoints == nil {
+		return endpoint
+	}
+	return endpoints.current(p.configuredEndpoints())
+}
+
+// EndpointStatuses reports every candidate collector in failover order.
+func (p *OTLPPlugin) EndpointStatuses() []OTLPEndpointStatus {
+	p.enabledMu.RLock()
+	endpoints := p.endpoints
+	p.enabledMu.RUnlock()
+	if endpoints == nil {
+		return nil
+	}
+	return endpoints.statuses(p.configuredEndpoints())
+}
+
+// configuredEndpoints lists the primary endpoint followed by the configured fallbacks.
+func (p *OTLPPlugin) configuredEndpoints() []string {
 	p.enabledMu.RLock()
 	defer p.enabledMu.RUnlock()
-	return p.endpoint
+	out := make([]string, 0, 1+len(p.export.Endpoints))
+	out = append(out, p.endpoint)
+	for _, endpoint := range p.export.Endpoints {
+		out = append(out, strings.TrimSpace(endpoint))
+	}
+	return out
 }
 
 // periodicFlush periodically flushes the batch
@@ -211,6 +426,10 @@ func (p *OTLPPlugin) periodicFlush() {
 			return
 		case <-p.flushTicker.C:
 			p.flushBatch()
+			// Probe the collector with spooled events even when there is no live traffic.
+			if spool := p.currentSpool(); spool != nil && spool.pending() {
+				p.replaySpool()
+			}
 		}
 	}
 }
@@ -223,18 +442,71 @@ func (p *OTLPPlugin) flushBatch() {
 		return
 	}
 
-	// Copy the batch and clear it
-	batchCopy := make([]coreusage.Record, len(p.batch))
-	copy(batchCopy, p.batch)
-	p.batch = make([]coreusage.Record, 0, p.batchSize)
+	pending := p.batch
+	p.batch = nil
 	p.batchMu.Unlock()
 
-	// Send each event in the batch
-	for _, record := range batchCopy {
-		ctx := context.Background() // Use background context for batch sending
-		event := p.convertRecordToEvent(ctx, record)
-		if err := p.sendEvent(event); err != nil {
-			log.Errorf("OTLP plugin: failed to send batched event: %v", err)
+	spool := p.currentSpool()
+	err := p.sendEvents(pending)
+	otlpHealth.observe(err)
+	if err != nil {
+		if spool != nil {
+			errSpool := spool.append(pending)
+			if errSpool == nil {
+				log.Warnf("OTLP plugin: export failed, spooled %d events: %v", len(pending), err)
+				return
+			}
+			log.Errorf("OTLP plugin: failed to spool events: %v", errSpool)
+		}
+		log.Errorf("OTLP plugin: failed to send %d batched events: %v", len(pending), err)
+		return
+	}
+	if spool != nil && spool.pending() {
+		go p.replaySpool()
+	}
+}
+
+// configureSpool replaces the spool when its directory or limits changed.
+func (p *OTLPPlugin) configureSpool(current *otlpSpool, opts OTLPExportOptions) error {
+	dir := strings.TrimSpace(opts.SpoolDir)
+	if current != nil && dir != "" && current.sameSettings(dir, opts.SpoolMaxBytes, opts.SpoolMaxAge) {
+		return nil
+	}
+	var next *otlpSpool
+	var err error
+	if dir != "" {
+		next, err = newOTLPSpool(dir, opts.SpoolMaxBytes, opts.SpoolMaxAge)
+	}
+	p.enabledMu.Lock()
+	p.spool = next
+	p.enabledMu.Unlock()
+	if current != nil {
+		current.close()
+	}
+	return err
+}
+
+func (p *OTLPPlugin) currentSpool() *otlpSpool {
+	p.enabledMu.RLock()
+	defer p.enabledMu.RUnlock()
+	return p.spool
+}
+
+// replaySpool re-exports spooled events oldest first and stops at the first
+// failure. Only one replay runs at a time.
+func (p *OTLPPlugin) replaySpool() {
+	spool := p.currentSpool()
+	if spool == nil || !spool.replaying.CompareAndSwap(false, true) {
+		return
+	}
+	defer spool.replaying.Store(false)
+	p.batchMu.Lock()
+	batchSize := p.batchSize
+	p.batchMu.Unlock()
+	for _, path := range spool.take() {
+		if err := spool.replay(path, batchSize, p.sendEvents); err != nil {
+			util.ComponentLog(util.LogComponentOTLP).Debugf("OTLP plugin: spool replay paused: %v", err)
+			return
 		}
 	}
 }
@@ -249,8 +521,18 @@ func (p *OTLPPlugin) Close() {
 
 	// Flush any remaining events
 	p.flushBatch()
+	if spool := p.currentSpool(); spool != nil {
+		spool.close()
+	}
 }
 
+const (
+	// defaultOTLPBatchSize is how many events are buffered per export request.
+	defaultOTLPBatchSize = 10
+	// defaultOTLPFlushInterval bounds how long a partial batch waits for export.
+	defaultOTLPFlushInterval = 5 * time.Second
+)
+
 // Global OTLP plugin instance
 var globalOTLPPlugin *OTLPPlugin
 
@@ -259,6 +541,7 @@ func RegisterOTLPPlugin() {
 	plugin := NewOTLPPlugin()
 	globalOTLPPlugin = plugin
 	coreusage.RegisterPlugin(plugin)
+	events.Subscribe(plugin.HandleEvent)
 	log.Info("OTLP plugin registered and enabled")
 }
 
@@ -275,6 +558,7 @@ func SetOTLPEnabled(enabled bool) {
 	if globalOTLPPlugin != nil {
 		globalOTLPPlugin.SetEnabled(enabled)
 	}
+	tracing.SetEnabled(enabled)
 }
 
 // OTLPEndpoint returns the current OTLP endpoint
@@ -285,9 +569,104 @@ func OTLPEndpoint() string {
 	return "http://127.0.0.1:4318/v1/logs" // Default endpoint
 }
 
+// ConfigureOTLPExport applies the enabled flag, batching, protocol, header and TLS
+// settings to the OTLP plugin.
+func ConfigureOTLPExport(opts OTLPExportOptions) error {
+	if globalOTLPPlugin == nil {
+		return nil
+	}
+	SetOTLPEnabled(opts.Enabled)
+	tracing.SetResourceAttributes(normalizeOTLPResource(opts.ResourceAttributes))
+	if endpoint := strings.TrimSpace(opts.Endpoint); endpoint != "" {
+		SetOTLPEndpoint(endpoint)
+	}
+	return globalOTLPPlugin.Configure(opts)
+}
+
+// ValidateOTLPExport checks the endpoint, protocol and CA bundle of opts without
+// applying them.
+func ValidateOTLPExport(opts OTLPExportOptions) error {
+	for _, endpoint := range append([]string{opts.Endpoint}, opts.Endpoints...) {
+		if err := validateOTLPEndpoint(endpoint); err != nil {
+			return err
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(opts.SRVScheme)) {
+	case "", "http", "https", "grpc", "grpcs":
+	default:
+		return fmt.Errorf("otlp: unsupported srv scheme %q", opts.SRVScheme)
+	}
+	switch strings.ToLower(strings.TrimSpace(opts.Protocol)) {
+	case "", OTLPProtocolHTTPJSON, OTLPProtocolGRPC, "otlp/grpc":
+	default:
+		return fmt.Errorf("otlp: unknown protocol %q", opts.Protocol)
+	}
+	if err := opts.Sampling.validate(); err != nil {
+		return err
+	}
+	for key := range opts.ResourceAttributes {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("otlp: resource attribute names must not be empty")
+		}
+	}
+	_, err := otlpTLSConfig(opts)
+	return err
+}
+
+func validateOTLPEndpoint(endpoint string) error {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("otlp: parse endpoint: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "grpc", "grpcs":
+	default:
+		return fmt.Errorf("otlp: unsupported endpoint scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("otlp: endpoint %q has no host", endpoint)
+	}
+	return nil
+}
+
+// OTLPSpoolState returns the state of the OTLP spool. The boolean result is false
+// when spooling is disabled.
+func OTLPSpoolState() (OTLPSpoolStatus, bool) {
+	if globalOTLPPlugin == nil {
+		return OTLPSpoolStatus{}, false
+	}
+	spool := globalOTLPPlugin.currentSpool()
+	if spool == nil {
+		return OTLPSpoolStatus{}, false
+	}
+	return spool.status(), true
+}
+
+// OTLPEndpointStatuses reports the candidate collectors in failover order.
+func OTLPEndpointStatuses() []OTLPEndpointStatus {
+	if globalOTLPPlugin == nil {
+		return nil
+	}
+	return globalOTLPPlugin.EndpointStatuses()
+}
+
 // SetOTLPEndpoint sets the OTLP endpoint
 func SetOTLPEndpoint(endpoint string) {
 	if globalOTLPPlugin != nil {
 		globalOTLPPlugin.SetEndpoint(endpoint)
 	}
+	followTracesEndpoint(endpoint)
+}
+
+// followTracesEndpoint points span export at the collector behind a logs endpoint.
+func followTracesEndpoint(endpoint string) {
+	// Span export only speaks OTLP/HTTP; keep its endpoint when logs move to gRPC.
+	if scheme, _, _ := strings.Cut(strings.TrimSpace(endpoint), "://"); strings.HasPrefix(strings.ToLower(scheme), "grpc") {
+		return
+	}
+	tracing.SetEndpoint(tracing.TracesEndpointFromLogs(endpoint))
 }
@@ -0,0 +1,81 @@
+package usage
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+// OTLPSampling selects the share of usage events exported over OTLP. Rates are
+// fractions between 0 and 1.
+type OTLPSampling struct {
+	// Rate applies to providers without an override.
+	Rate float64
+	// AlwaysSampleFailures exports every failed request at rate 1.
+	AlwaysSampleFailures bool
+	// ProviderRates overrides Rate per lower-cased provider.
+	ProviderRates map[string]float64
+}
+
+// OTLPSamplingFromConfig converts the otlp.sampling setting. It returns nil, meaning
+// every event is exported, when no percentage is configured.
+func OTLPSamplingFromConfig(cfg config.OTLPSamplingConfig) *OTLPSampling {
+	if cfg.Percentage == nil && len(cfg.Providers) == 0 {
+		return nil
+	}
+	sampling := &OTLPSampling{Rate: 1, AlwaysSampleFailures: cfg.AlwaysSampleFailures}
+	if cfg.Percentage != nil {
+		sampling.Rate = *cfg.Percentage / 100
+	}
+	if len(cfg.Providers) > 0 {
+		sampling.ProviderRates = make(map[string]float64, len(cfg.Providers))
+		for provider, pct := range cfg.Providers {
+			sampling.ProviderRates[strings.ToLower(strings.TrimSpace(provider))] = pct / 100
+		}
+	}
+	return sampling
+}
+
+// validate reports rates outside [0, 1].
+func (s *OTLPSampling) validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.Rate < 0 || s.Rate > 1 {
+		return fmt.Errorf("otlp: sampling percentage %v is outside 0-100", s.Rate*100)
+	}
+	for provider, rate := range s.ProviderRates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("otlp: sampling percentage %v for provider %q is outside 0-100", rate*100, provider)
+		}
+	}
+	return nil
+}
+
+// rateFor returns the effective sample rate of record.
+func (s *OTLPSampling) rateFor(record coreusage.Record) float64 {
+	if s == nil || (record.Failed && s.AlwaysSampleFailures) {
+		return 1
+	}
+	rate := s.Rate
+	if override, ok := s.ProviderRates[strings.ToLower(record.Provider)]; ok {
+		rate = override
+	}
+	return min(max(rate, 0), 1)
+}
+
+// sample decides whether record is exported and returns the rate it was sampled at.
+func (s *OTLPSampling) sample(record coreusage.Record) (float64, bool) {
+	rate := s.rateFor(record)
+	switch {
+	case rate >= 1:
+		return 1, true
+	case rate <= 0:
+		return 0, false
+	default:
+		return rate, rand.Float64() < rate
+	}
+}
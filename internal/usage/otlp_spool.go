@@ -0,0 +1,284 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultOTLPSpoolMaxBytes caps the spool when no size limit is configured.
+	defaultOTLPSpoolMaxBytes = 64 << 20
+	// defaultOTLPSpoolMaxAge drops spooled events older than this when unset.
+	defaultOTLPSpoolMaxAge = 24 * time.Hour
+	// minOTLPSpoolSegment keeps segments from becoming tiny under small size caps.
+	minOTLPSpoolSegment = 64 << 10
+)
+
+// OTLPSpoolStatus reports the state of the on-disk OTLP spool.
+type OTLPSpoolStatus struct {
+	Dir      string `json:"dir"`
+	Segments int    `json:"segments"`
+	Bytes    int64  `json:"bytes"`
+	// Spooled, Replayed and Dropped count events since the spool was configured.
+	Spooled  uint64 `json:"spooled"`
+	Replayed uint64 `json:"replayed"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// otlpSpool stores events that could not be exported as JSON lines in append-only
+// segment files. Segments are named by creation time so replay and eviction both
+// work oldest first; files left by a previous process are picked up on start.
+type otlpSpool struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu         sync.Mutex
+	active     *os.File
+	activeSize int64
+
+	replaying atomic.Bool
+	spooled   atomic.Uint64
+	replayed  atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+type otlpSpoolSegment struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func newOTLPSpool(dir string, maxBytes int64, maxAge time.Duration) (*otlpSpool, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultOTLPSpoolMaxBytes
+	}
+	if maxAge <= 0 {
+		maxAge = defaultOTLPSpoolMaxAge
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("otlp: create spool dir: %w", err)
+	}
+	return &otlpSpool{dir: filepath.Clean(dir), maxBytes: maxBytes, maxAge: maxAge}, nil
+}
+
+func (s *otlpSpool) sameSettings(dir string, maxBytes int64, maxAge time.Duration) bool {
+	if maxBytes <= 0 {
+		maxBytes = defaultOTLPSpoolMaxBytes
+	}
+	if maxAge <= 0 {
+		maxAge = defaultOTLPSpoolMaxAge
+	}
+	return s.dir == filepath.Clean(dir) && s.maxBytes == maxBytes && s.maxAge == maxAge
+}
+
+func (s *otlpSpool) segmentLimit() int64 {
+	return max(s.maxBytes/8, minOTLPSpoolSegment)
+}
+
+// append writes events to the active segment, then enforces the size and age limits.
+func (s *otlpSpool) append(events []*OTLPEvent) error {
+	var buf bytes.Buffer
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("otlp: marshal spooled event: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != nil && s.activeSize >= s.segmentLimit() {
+		s.closeActive()
+	}
+	if s.active == nil {
+		name := filepath.Join(s.dir, fmt.Sprintf("otlp-spool-%020d.jsonl", time.Now().UnixNano()))
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("otlp: create spool segment: %w", err)
+		}
+		s.active = f
+		s.activeSize = 0
+	}
+	n, err := s.active.Write(buf.Bytes())
+	s.activeSize += int64(n)
+	if err != nil {
+		return fmt.Errorf("otlp: write spool segment: %w", err)
+	}
+	s.spooled.Add(uint64(len(events)))
+	s.enforceLimits(time.Now())
+	return nil
+}
+
+func (s *otlpSpool) closeActive() {
+	if s.active != nil {
+		_ = s.active.Close()
+		s.active = nil
+		s.activeSize = 0
+	}
+}
+
+// segments lists spool files oldest first. Callers hold mu.
+func (s *otlpSpool) segments() []otlpSpoolSegment {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "otlp-spool-*.jsonl"))
+	sort.Strings(matches)
+	out := make([]otlpSpoolSegment, 0, len(matches))
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		out = append(out, otlpSpoolSegment{path: path, size: info.Size(), modTime: info.ModTime()})
+	}
+	return out
+}
+
+// enforceLimits removes segments whose newest event is past maxAge, then the
+// oldest segments until the spool fits maxBytes. Callers hold mu.
+func (s *otlpSpool) enforceLimits(now time.Time) {
+	segments := s.segments()
+	var total int64
+	for _, seg := range segments {
+		total += seg.size
+	}
+	activeName := ""
+	if s.active != nil {
+		activeName = s.active.Name()
+	}
+	for _, seg := range segments {
+		expired := now.Sub(seg.modTime) > s.maxAge
+		if !expired && total <= s.maxBytes {
+			continue
+		}
+		if seg.path == activeName {
+			if !expired {
+				continue
+			}
+			s.closeActive()
+		}
+		if data, err := os.ReadFile(seg.path); err == nil {
+			s.dropped.Add(uint64(bytes.Count(data, []byte{'\n'})))
+		}
+		if err := os.Remove(seg.path); err != nil {
+			log.WithError(err).Warn("otlp: remove spool segment failed")
+			continue
+		}
+		total -= seg.size
+	}
+}
+
+// take closes the active segment and returns every segment ready for replay.
+func (s *otlpSpool) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeActive()
+	s.enforceLimits(time.Now())
+	segments := s.segments()
+	paths := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		paths = append(paths, seg.path)
+	}
+	return paths
+}
+
+// pending reports whether any segment is waiting for replay.
+func (s *otlpSpool) pending() bool {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "otlp-spool-*.jsonl"))
+	return len(matches) > 0
+}
+
+// replay sends the events of one segment in batches. When a batch fails the
+// unsent remainder is written back so the next attempt resumes where this one stopped.
+func (s *otlpSpool) replay(path string, batchSize int, send func([]*OTLPEvent) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte{'\n'})
+	if batchSize <= 0 {
+		batchSize = defaultOTLPBatchSize
+	}
+	for start := 0; start < len(lines); start += batchSize {
+		end := min(start+batchSize, len(lines))
+		events := make([]*OTLPEvent, 0, end-start)
+		for _, line := range lines[start:end] {
+			if len(line) == 0 {
+				continue
+			}
+			var event OTLPEvent
+			if errUnmarshal := json.Unmarshal(line, &event); errUnmarshal != nil {
+				log.WithError(errUnmarshal).Warn("otlp: skipping corrupt spooled event")
+				continue
+			}
+			events = append(events, &event)
+		}
+		if len(events) == 0 {
+			continue
+		}
+		if err = send(events); err != nil {
+			s.rewrite(path, lines[start:])
+			return err
+		}
+		s.replayed.Add(uint64(len(events)))
+	}
+	s.mu.Lock()
+	_ = os.Remove(path)
+	s.mu.Unlock()
+	return nil
+}
+
+// rewrite replaces a segment with the lines that remain to be replayed, unless
+// eviction removed it in the meantime.
+func (s *otlpSpool) rewrite(path string, lines [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	data := append(bytes.Join(lines, []byte{'\n'}), '\n')
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		log.WithError(err).Warn("otlp: rewrite spool segment failed")
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.WithError(err).Warn("otlp: rewrite spool segment failed")
+		_ = os.Remove(tmp)
+	}
+}
+
+func (s *otlpSpool) status() OTLPSpoolStatus {
+	s.mu.Lock()
+	segments := s.segments()
+	s.mu.Unlock()
+	st := OTLPSpoolStatus{
+		Dir:      s.dir,
+		Segments: len(segments),
+		Spooled:  s.spooled.Load(),
+		Replayed: s.replayed.Load(),
+		Dropped:  s.dropped.Load(),
+	}
+	for _, seg := range segments {
+		st.Bytes += seg.size
+	}
+	return st
+}
+
+func (s *otlpSpool) close() {
+	s.mu.Lock()
+	s.closeActive()
+	s.mu.Unlock()
+}
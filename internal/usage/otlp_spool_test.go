@@ -0,0 +1,112 @@
+package usage
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOTLPPluginSpoolsAndReplays(t *testing.T) {
+	var (
+		down     atomic.Bool
+		mu       sync.Mutex
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var events []OTLPEvent
+		if err := json.Unmarshal(body, &events); err != nil {
+			var single OTLPEvent
+			_ = json.Unmarshal(body, &single)
+			events = []OTLPEvent{single}
+		}
+		mu.Lock()
+		for _, event := range events {
+			received = append(received, event.Model)
+		}
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	plugin := &OTLPPlugin{endpoint: server.URL, enabled: true}
+	if err := plugin.Configure(OTLPExportOptions{BatchSize: 2, SpoolDir: dir}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	down.Store(true)
+	plugin.batch = []*OTLPEvent{{Model: "a"}, {Model: "b"}}
+	plugin.flushBatch()
+	plugin.batch = []*OTLPEvent{{Model: "c"}}
+	plugin.flushBatch()
+	if status := plugin.currentSpool().status(); status.Spooled != 3 || status.Segments != 1 {
+		t.Fatalf("unexpected spool status while down: %+v", status)
+	}
+
+	// A failed replay keeps every event.
+	plugin.replaySpool()
+	if status := plugin.currentSpool().status(); status.Replayed != 0 || status.Segments != 1 {
+		t.Fatalf("replay against a down collector must keep events: %+v", status)
+	}
+
+	down.Store(false)
+	plugin.replaySpool()
+	mu.Lock()
+	got := append([]string(nil), received...)
+	mu.Unlock()
+	if len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Fatalf("replayed events = %v", got)
+	}
+	if status := plugin.currentSpool().status(); status.Replayed != 3 || status.Segments != 0 {
+		t.Fatalf("unexpected spool status after replay: %+v", status)
+	}
+}
+
+func TestOTLPSpoolEnforcesLimits(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := newOTLPSpool(dir, minOTLPSpoolSegment, time.Hour)
+	if err != nil {
+		t.Fatalf("newOTLPSpool: %v", err)
+	}
+	defer spool.close()
+
+	stale := filepath.Join(dir, "otlp-spool-00000000000000000001.jsonl")
+	if err = os.WriteFile(stale, []byte("{}\n{}\n"), 0o600); err != nil {
+		t.Fatalf("write stale segment: %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err = os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	big := make([]*OTLPEvent, 0, 1000)
+	for range 1000 {
+		big = append(big, &OTLPEvent{Model: "model-with-a-reasonably-long-name", Provider: "provider"})
+	}
+	for range 3 {
+		if err = spool.append(big); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	status := spool.status()
+	if _, err = os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expired segment should be removed, stat err = %v", err)
+	}
+	if status.Bytes > 2*minOTLPSpoolSegment {
+		t.Fatalf("spool exceeds size cap: %+v", status)
+	}
+	if status.Dropped < 2 {
+		t.Fatalf("expected dropped events to be counted: %+v", status)
+	}
+}
@@ -0,0 +1,389 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/clientattr"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/team"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSinkQueueSize = 1000
+	sinkRestartMin       = time.Second
+	sinkRestartMax       = 30 * time.Second
+	// sinkStopGrace is how long a sink may take to drain after its stdin is closed.
+	sinkStopGrace = 5 * time.Second
+	// maxSinkLine bounds buffered sink output without a line break.
+	maxSinkLine = 64 << 10
+)
+
+// SinkOptions configures one external usage sink process.
+type SinkOptions struct {
+	Name      string
+	Command   string
+	Args      []string
+	Env       map[string]string
+	QueueSize int
+}
+
+// SinkStatus reports the state of one external usage sink.
+type SinkStatus struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Running bool   `json:"running"`
+	PID     int    `json:"pid,omitempty"`
+	// Restarts counts how often the process exited and was started again.
+	Restarts   uint64 `json:"restarts"`
+	QueueDepth int    `json:"queue-depth"`
+	// Dropped counts records discarded because the queue was full.
+	Dropped uint64 `json:"dropped"`
+	// Writes tracks records written to the process; Acks tracks the replies it sent.
+	Writes ExporterHealth `json:"writes"`
+	Acks   ExporterHealth `json:"acks"`
+}
+
+type execSink struct {
+	opts  SinkOptions
+	queue chan []byte
+	stop  chan struct{}
+	done  chan struct{}
+
+	pid      atomic.Int64
+	restarts atomic.Uint64
+	dropped  atomic.Uint64
+	writes   healthTracker
+	acks     healthTracker
+}
+
+type sinkPlugin struct{}
+
+var (
+	currentSinks atomic.Pointer[[]*execSink]
+	sinksMu      sync.Mutex
+)
+
+func init() {
+	coreusage.RegisterPlugin(sinkPlugin{})
+}
+
+// SinkOptionsFromConfig converts the usage-sinks configuration, skipping disabled entries.
+func SinkOptionsFromConfig(sinks []config.UsageSinkConfig) []SinkOptions {
+	out := make([]SinkOptions, 0, len(sinks))
+	for _, sink := range sinks {
+		if sink.Disabled {
+			continue
+		}
+		out = append(out, SinkOptions{
+			Name:      sink.Name,
+			Command:   sink.Command,
+			Args:      sink.Args,
+			Env:       sink.Env,
+			QueueSize: sink.QueueSize,
+		})
+	}
+	return out
+}
+
+// ConfigureUsageSinks starts, restarts or stops external usage sinks so that exactly
+// the given ones run. Sinks whose options did not change keep their process.
+func ConfigureUsageSinks(opts []SinkOptions) error {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	running := make(map[string]*execSink)
+	if prev := currentSinks.Load(); prev != nil {
+		for _, sink := range *prev {
+			running[sink.opts.Name] = sink
+		}
+	}
+	next := make([]*execSink, 0, len(opts))
+	var errs []error
+	for _, o := range opts {
+		o = normalizeSinkOptions(o)
+		if o.Name == "" || o.Command == "" {
+			errs = append(errs, fmt.Errorf("usage: sink %q: name and command are required", o.Name))
+			continue
+		}
+		if sink, ok := running[o.Name]; ok && sinkOptionsEqual(sink.opts, o) {
+			delete(running, o.Name)
+			next = append(next, sink)
+			continue
+		}
+		sink := &execSink{
+			opts:  o,
+			queue: make(chan []byte, o.QueueSize),
+			stop:  make(chan struct{}),
+			done:  make(chan struct{}),
+		}
+		go sink.run()
+		next = append(next, sink)
+	}
+	currentSinks.Store(&next)
+	for _, old := range running {
+		old.close()
+	}
+	return errors.Join(errs...)
+}
+
+func normalizeSinkOptions(o SinkOptions) SinkOptions {
+	o.Name = strings.TrimSpace(o.Name)
+	o.Command = strings.TrimSpace(o.Command)
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultSinkQueueSize
+	}
+	return o
+}
+
+func sinkOptionsEqual(a, b SinkOptions) bool {
+	return a.Name == b.Name && a.Command == b.Command && a.QueueSize == b.QueueSize &&
+		slices.Equal(a.Args, b.Args) && maps.Equal(a.Env, b.Env)
+}
+
+// UsageSinkStatuses reports the state of the running external usage sinks.
+func UsageSinkStatuses() []SinkStatus {
+	sinks := currentSinks.Load()
+	if sinks == nil {
+		return nil
+	}
+	out := make([]SinkStatus, 0, len(*sinks))
+	for _, sink := range *sinks {
+		pid := int(sink.pid.Load())
+		out = append(out, SinkStatus{
+			Name:       sink.opts.Name,
+			Command:    sink.opts.Command,
+			Running:    pid != 0,
+			PID:        pid,
+			Restarts:   sink.restarts.Load(),
+			QueueDepth: len(sink.queue),
+			Dropped:    sink.dropped.Load(),
+			Writes:     sink.writes.snapshot(),
+			Acks:       sink.acks.snapshot(),
+		})
+	}
+	return out
+}
+
+func (sinkPlugin) HandleUsage(ctx context.Context, record coreusage.Record) {
+	sinks := currentSinks.Load()
+	if sinks == nil || len(*sinks) == 0 {
+		return
+	}
+	line, err := json.Marshal(sinkEvent(ctx, record))
+	if err != nil {
+		log.WithError(err).Warn("usage: failed to encode sink event")
+		return
+	}
+	line = append(line, '\n')
+	for _, sink := range *sinks {
+		select {
+		case sink.queue <- line:
+		default:
+			sink.dropped.Add(1)
+		}
+	}
+}
+
+// sinkEvent renders record in the wire format documented on coreusage.SinkEvent.
+func sinkEvent(ctx context.Context, record coreusage.Record) coreusage.SinkEvent {
+	detail := normaliseDetail(record.Detail)
+	timestamp := record.RequestedAt
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	event := coreusage.SinkEvent{
+		Timestamp:           timestamp.UTC(),
+		RequestID:           tracing.RequestIDFromContext(ctx),
+		Provider:            record.Provider,
+		Model:               record.Model,
+		RequestedModel:      record.RequestedModel,
+		ClientLabel:         clientLabel(ctx),
+		AuthID:              record.AuthID,
+		Source:              record.Source,
+		StatusCode:          recordStatus(ctx, record),
+		Failed:              record.Failed,
+		ErrorClass:          record.ErrorClass,
+		Rejection:           record.Rejection,
+		PolicyDenied:        record.PolicyDenied,
+		Tags:                record.Tags,
+		InputTokens:         detail.InputTokens,
+		OutputTokens:        detail.OutputTokens,
+		ReasoningTokens:     detail.ReasoningTokens,
+		CachedTokens:        detail.CachedTokens,
+		CacheCreationTokens: detail.CacheCreationTokens,
+		TotalTokens:         detail.TotalTokens,
+		LatencyMs:           recordDuration(record).Milliseconds(),
+		QueueWaitMs:         record.QueueWait.Milliseconds(),
+		AudioSeconds:        record.AudioSeconds,
+		Metadata:            requestMetadata(ctx),
+	}
+	if record.APIKey != "" {
+		event.APIKeyHash = fingerprint(record.APIKey)
+		event.Team = team.Lookup(record.APIKey)
+	}
+	if client, ok := clientattr.FromContext(ctx); ok && client.IP.IsValid() {
+		event.ClientIPHash = fingerprint(client.IP.String())
+		event.ClientCountry = client.Country
+	}
+	return event
+}
+
+// close stops the process after letting it drain what it already received.
+func (s *execSink) close() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *execSink) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// run keeps the sink process alive, restarting it with exponential backoff.
+func (s *execSink) run() {
+	defer close(s.done)
+	backoff := sinkRestartMin
+	for {
+		started := time.Now()
+		err := s.serve()
+		if s.stopped() {
+			return
+		}
+		s.restarts.Add(1)
+		s.writes.observe(err)
+		if time.Since(started) > sinkRestartMax {
+			backoff = sinkRestartMin
+		}
+		log.WithError(err).Warnf("usage: sink %s stopped, restarting in %s", s.opts.Name, backoff)
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, sinkRestartMax)
+	}
+}
+
+// serve runs one process until it exits or the sink is stopped.
+func (s *execSink) serve() error {
+	cmd := exec.Command(s.opts.Command, s.opts.Args...)
+	cmd.Env = os.Environ()
+	for _, key := range slices.Sorted(maps.Keys(s.opts.Env)) {
+		cmd.Env = append(cmd.Env, key+"="+s.opts.Env[key])
+	}
+	cmd.Stdout = &lineWriter{handle: s.handleAck}
+	cmd.Stderr = &lineWriter{handle: func(line []byte) {
+		log.WithField("sink", s.opts.Name).Info(string(line))
+	}}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	s.pid.Store(int64(cmd.Process.Pid))
+	defer s.pid.Store(0)
+
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+	// Closing stdin on stop also unblocks a write to a process that stopped reading.
+	go func() {
+		select {
+		case <-s.stop:
+			_ = stdin.Close()
+			select {
+			case <-exited:
+			case <-time.After(sinkStopGrace):
+				_ = cmd.Process.Kill()
+			}
+		case <-exited:
+		}
+	}()
+
+	for {
+		select {
+		case <-s.stop:
+			<-exited
+			return nil
+		case <-exited:
+			if waitErr != nil {
+				return fmt.Errorf("process exited: %w", waitErr)
+			}
+			return errors.New("process exited")
+		case line := <-s.queue:
+			_, err = stdin.Write(line)
+			if err != nil {
+				_ = cmd.Process.Kill()
+				<-exited
+				return fmt.Errorf("write: %w", err)
+			}
+			s.writes.observe(nil)
+		}
+	}
+}
+
+// handleAck records a coreusage.SinkAck line. Other output is logged.
+func (s *execSink) handleAck(line []byte) {
+	var ack coreusage.SinkAck
+	if err := json.Unmarshal(line, &ack); err != nil {
+		log.WithField("sink", s.opts.Name).Info(string(line))
+		return
+	}
+	if ack.OK {
+		s.acks.observe(nil)
+		return
+	}
+	if ack.Error == "" {
+		ack.Error = "sink reported failure"
+	}
+	s.acks.observe(errors.New(ack.Error))
+}
+
+// lineWriter calls handle for every complete, non-empty line written to it.
+type lineWriter struct {
+	buf    []byte
+	handle func(line []byte)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimSpace(w.buf[:i]); len(line) > 0 {
+			w.handle(line)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > maxSinkLine {
+		w.handle(w.buf)
+		w.buf = nil
+	}
+	return len(p), nil
+}
@@ -0,0 +1,86 @@
+package usage
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUsageSinkDelivery(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	out := filepath.Join(t.TempDir(), "events.jsonl")
+	err := ConfigureUsageSinks([]SinkOptions{
+		{Name: "file", Command: "sh", Args: []string{"-c", `cat >> "$OUT"`}, Env: map[string]string{"OUT": out}},
+		{Name: "failing", Command: "sh", Args: []string{"-c", `while read -r line; do echo '{"ok":false,"error":"boom"}'; done`}},
+	})
+	if err != nil {
+		t.Fatalf("ConfigureUsageSinks failed: %v", err)
+	}
+	defer func() { _ = ConfigureUsageSinks(nil) }()
+
+	sinkPlugin{}.HandleUsage(context.Background(), coreusage.Record{
+		Provider: "claude", Model: "a", APIKey: "secret-key", Detail: coreusage.Detail{InputTokens: 3, OutputTokens: 4},
+	})
+	waitFor(t, "event in sink output", func() bool {
+		data, _ := os.ReadFile(out)
+		return strings.Contains(string(data), `"provider":"claude"`)
+	})
+	data, _ := os.ReadFile(out)
+	if strings.Contains(string(data), "secret-key") || !strings.Contains(string(data), `"total_tokens":7`) {
+		t.Fatalf("unexpected sink event: %s", data)
+	}
+
+	waitFor(t, "failure ack", func() bool {
+		for _, st := range UsageSinkStatuses() {
+			if st.Name == "failing" && st.Acks.Errors == 1 && st.Acks.LastError == "boom" {
+				return true
+			}
+		}
+		return false
+	})
+	for _, st := range UsageSinkStatuses() {
+		if !st.Running || st.Writes.Successes != 1 || st.Restarts != 0 {
+			t.Fatalf("unexpected sink status: %+v", st)
+		}
+	}
+
+	if err = ConfigureUsageSinks(nil); err != nil {
+		t.Fatal(err)
+	}
+	if st := UsageSinkStatuses(); len(st) != 0 {
+		t.Fatalf("expected sinks to stop, got %+v", st)
+	}
+}
+
+func TestUsageSinkRestartsExitedProcess(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	if err := ConfigureUsageSinks([]SinkOptions{{Name: "crashing", Command: "sh", Args: []string{"-c", "exit 3"}}}); err != nil {
+		t.Fatalf("ConfigureUsageSinks failed: %v", err)
+	}
+	defer func() { _ = ConfigureUsageSinks(nil) }()
+	waitFor(t, "restart", func() bool {
+		st := UsageSinkStatuses()
+		return len(st) == 1 && st[0].Restarts >= 1 && strings.Contains(st[0].Writes.LastError, "exit status 3")
+	})
+}
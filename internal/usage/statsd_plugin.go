@@ -0,0 +1,216 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StatsDFlavorStatsD emits plain StatsD lines; record dimensions are folded into metric names.
+	StatsDFlavorStatsD = "statsd"
+	// StatsDFlavorDatadog emits DogStatsD lines with dimensions as "|#key:value" tags.
+	StatsDFlavorDatadog = "datadog"
+
+	defaultStatsDAddress = "127.0.0.1:8125"
+	defaultStatsDPrefix  = "cliproxy"
+	// maxStatsDPacket keeps datagrams under a typical Ethernet MTU.
+	maxStatsDPacket = 1432
+)
+
+// StatsDOptions configures the StatsD/DogStatsD metric sink.
+type StatsDOptions struct {
+	Enabled bool
+	Address string
+	Prefix  string
+	Flavor  string
+	// Tags are constant "key:value" tags added to every metric (DogStatsD only).
+	Tags []string
+}
+
+type statsdSink struct {
+	opts StatsDOptions
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+type statsdPlugin struct{}
+
+var currentStatsDSink atomic.Pointer[statsdSink]
+
+var statsdConfigMu sync.Mutex
+
+func init() {
+	coreusage.RegisterPlugin(statsdPlugin{})
+}
+
+// ConfigureStatsD enables, reconfigures or disables the StatsD metric sink.
+func ConfigureStatsD(opts StatsDOptions) error {
+	statsdConfigMu.Lock()
+	defer statsdConfigMu.Unlock()
+
+	normalized := normalizeStatsDOptions(opts)
+	prev := currentStatsDSink.Load()
+	if prev != nil && statsdOptionsEqual(prev.opts, normalized) {
+		return nil
+	}
+	if !normalized.Enabled {
+		if old := currentStatsDSink.Swap(nil); old != nil {
+			_ = old.conn.Close()
+		}
+		return nil
+	}
+	switch normalized.Flavor {
+	case StatsDFlavorStatsD, StatsDFlavorDatadog:
+	default:
+		return fmt.Errorf("usage: unsupported statsd flavor %q", normalized.Flavor)
+	}
+	conn, err := net.Dial("udp", normalized.Address)
+	if err != nil {
+		return fmt.Errorf("usage: dial statsd %s: %w", normalized.Address, err)
+	}
+	if old := currentStatsDSink.Swap(&statsdSink{opts: normalized, conn: conn}); old != nil {
+		_ = old.conn.Close()
+	}
+	return nil
+}
+
+func normalizeStatsDOptions(opts StatsDOptions) StatsDOptions {
+	opts.Address = strings.TrimSpace(opts.Address)
+	if opts.Address == "" {
+		opts.Address = defaultStatsDAddress
+	}
+	opts.Prefix = strings.Trim(strings.TrimSpace(opts.Prefix), ".")
+	if opts.Prefix == "" {
+		opts.Prefix = defaultStatsDPrefix
+	}
+	opts.Flavor = strings.ToLower(strings.TrimSpace(opts.Flavor))
+	if opts.Flavor == "" || opts.Flavor == "dogstatsd" {
+		opts.Flavor = StatsDFlavorDatadog
+	}
+	tags := make([]string, 0, len(opts.Tags))
+	for _, tag := range opts.Tags {
+		if trimmed := strings.TrimSpace(tag); trimmed != "" {
+			tags = append(tags, trimmed)
+		}
+	}
+	opts.Tags = tags
+	return opts
+}
+
+func statsdOptionsEqual(a, b StatsDOptions) bool {
+	if a.Enabled != b.Enabled || a.Address != b.Address || a.Prefix != b.Prefix || a.Flavor != b.Flavor || len(a.Tags) != len(b.Tags) {
+		return false
+	}
+	for i := range a.Tags {
+		if a.Tags[i] != b.Tags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (statsdPlugin) HandleUsage(ctx context.Context, record coreusage.Record) {
+	sink := currentStatsDSink.Load()
+	if sink == nil {
+		return
+	}
+	sink.send(sink.render(sampleRecord(ctx, record)))
+}
+
+// render converts a sample into StatsD lines in the sink's flavor.
+func (s *statsdSink) render(sample recordSample) []string {
+	lines := make([]string, 0, len(sample.metrics))
+	var tagSuffix, namePrefix string
+	if s.opts.Flavor == StatsDFlavorDatadog {
+		tags := append([]string(nil), s.opts.Tags...)
+		for _, tag := range sample.tags {
+			if tag.value == "" {
+				continue
+			}
+			tags = append(tags, tag.key+":"+sanitizeStatsDTag(tag.value))
+		}
+		if len(tags) > 0 {
+			tagSuffix = "|#" + strings.Join(tags, ",")
+		}
+		namePrefix = s.opts.Prefix + "."
+	} else {
+		// Plain StatsD has no tags, so break metrics down by provider and model in the name.
+		namePrefix = s.opts.Prefix + "."
+		for _, tag := range sample.tags {
+			if tag.key == "provider" || tag.key == "model" {
+				if segment := sanitizeStatsDSegment(tag.value); segment != "" {
+					namePrefix += segment + "."
+				}
+			}
+		}
+	}
+	for _, m := range sample.metrics {
+		kind := "c"
+		if m.kind == metricTiming {
+			kind = "ms"
+		}
+		lines = append(lines, namePrefix+m.name+":"+strconv.FormatInt(m.value, 10)+"|"+kind+tagSuffix)
+	}
+	return lines
+}
+
+// send writes lines as newline-separated datagrams no larger than maxStatsDPacket.
+func (s *statsdSink) send(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var packet strings.Builder
+	flush := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		_, err := s.conn.Write([]byte(packet.String()))
+		if err != nil {
+			log.WithError(err).Debug("usage: failed to write statsd packet")
+		}
+		statsdHealth.observe(err)
+		packet.Reset()
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsDPacket {
+			flush()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	flush()
+}
+
+func sanitizeStatsDSegment(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSpace(value))
+}
+
+func sanitizeStatsDTag(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', ':', '\n':
+			return '_'
+		default:
+			return r
+		}
+	}, value)
+}
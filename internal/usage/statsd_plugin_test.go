@@ -0,0 +1,72 @@
+package usage
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+func TestStatsDPluginEmitsMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		flavor string
+		want   []string
+	}{
+		{
+			flavor: StatsDFlavorDatadog,
+			want: []string{
+				"test.requests:1|c|#env:ci,provider:openai,model:gpt-4o,failed:false",
+				"test.tokens.total:30|c|#env:ci,provider:openai,model:gpt-4o,failed:false",
+			},
+		},
+		{
+			flavor: StatsDFlavorStatsD,
+			want: []string{
+				"test.openai.gpt-4o.requests:1|c",
+				"test.openai.gpt-4o.tokens.input:10|c",
+			},
+		},
+	} {
+		t.Run(tc.flavor, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			defer func() { _ = conn.Close() }()
+
+			if err = ConfigureStatsD(StatsDOptions{Enabled: true, Address: conn.LocalAddr().String(), Prefix: "test", Flavor: tc.flavor, Tags: []string{"env:ci"}}); err != nil {
+				t.Fatalf("configure: %v", err)
+			}
+			t.Cleanup(func() { _ = ConfigureStatsD(StatsDOptions{}) })
+
+			statsdPlugin{}.HandleUsage(context.Background(), coreusage.Record{
+				Provider: "openai",
+				Model:    "gpt-4o",
+				Detail:   coreusage.Detail{InputTokens: 10, OutputTokens: 20},
+			})
+
+			buf := make([]byte, maxStatsDPacket)
+			_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			lines := strings.Split(string(buf[:n]), "\n")
+			for _, want := range tc.want {
+				found := false
+				for _, line := range lines {
+					if line == want {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("missing %q in %q", want, lines)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+// TailFilter selects the request log events delivered to a tail subscription. Empty
+// fields match everything.
+type TailFilter struct {
+	// Provider matches case-insensitively.
+	Provider string
+	// Model matches the routed or the requested model.
+	Model string
+	// StatusClasses lists status classes such as "2xx" or "5xx".
+	StatusClasses []string
+	// APIKeyHash matches the client key fingerprint by prefix.
+	APIKeyHash string
+}
+
+// ParseStatusClasses parses a comma-separated list of status classes ("4xx,5xx").
+func ParseStatusClasses(raw string) ([]string, error) {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		if len(part) != 3 || part[0] < '1' || part[0] > '5' || part[1:] != "xx" {
+			return nil, fmt.Errorf("invalid status class %q (want e.g. 2xx or 5xx)", part)
+		}
+		out = append(out, part)
+	}
+	return out, nil
+}
+
+func (f TailFilter) matches(event coreusage.SinkEvent) bool {
+	if f.Provider != "" && !strings.EqualFold(f.Provider, event.Provider) {
+		return false
+	}
+	if f.Model != "" && !strings.EqualFold(f.Model, event.Model) && !strings.EqualFold(f.Model, event.RequestedModel) {
+		return false
+	}
+	if f.APIKeyHash != "" && !strings.HasPrefix(event.APIKeyHash, strings.ToLower(f.APIKeyHash)) {
+		return false
+	}
+	if len(f.StatusClasses) > 0 {
+		class := fmt.Sprintf("%dxx", event.StatusCode/100)
+		for _, want := range f.StatusClasses {
+			if want == class {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// TailSubscription receives the request log events of one live tail.
+type TailSubscription struct {
+	// C delivers matching events. Events are dropped while the reader lags behind.
+	C       <-chan coreusage.SinkEvent
+	ch      chan coreusage.SinkEvent
+	filter  TailFilter
+	dropped atomic.Uint64
+}
+
+// Dropped returns the number of events dropped because the subscriber lagged behind.
+func (s *TailSubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+type tailPlugin struct{}
+
+var (
+	tailMu          sync.RWMutex
+	tailSubscribers = make(map[*TailSubscription]struct{})
+	tailCount       atomic.Int32
+)
+
+func init() {
+	coreusage.RegisterPlugin(tailPlugin{})
+}
+
+// SubscribeTail streams the request log events matching filter, buffering up to
+// buffer events. The returned function ends the subscription.
+func SubscribeTail(filter TailFilter, buffer int) (*TailSubscription, func()) {
+	if buffer <= 0 {
+		buffer = 256
+	}
+	ch := make(chan coreusage.SinkEvent, buffer)
+	sub := &TailSubscription{C: ch, ch: ch, filter: filter}
+	tailMu.Lock()
+	tailSubscribers[sub] = struct{}{}
+	tailCount.Store(int32(len(tailSubscribers)))
+	tailMu.Unlock()
+	var once sync.Once
+	return sub, func() {
+		once.Do(func() {
+			tailMu.Lock()
+			delete(tailSubscribers, sub)
+			tailCount.Store(int32(len(tailSubscribers)))
+			tailMu.Unlock()
+		})
+	}
+}
+
+func (tailPlugin) HandleUsage(ctx context.Context, record coreusage.Record) {
+	if tailCount.Load() == 0 {
+		return
+	}
+	event := sinkEvent(ctx, record)
+	tailMu.RLock()
+	defer tailMu.RUnlock()
+	for sub := range tailSubscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package usage
+
+import (
+	"context"
+	"testing"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+func TestTailFilters(t *testing.T) {
+	classes, err := ParseStatusClasses("4xx, 5xx")
+	if err != nil {
+		t.Fatalf("ParseStatusClasses failed: %v", err)
+	}
+	if _, err = ParseStatusClasses("404"); err == nil {
+		t.Fatalf("expected an invalid status class to be rejected")
+	}
+	sub, unsubscribe := SubscribeTail(TailFilter{Provider: "Claude", StatusClasses: classes}, 1)
+	all, unsubscribeAll := SubscribeTail(TailFilter{Model: "alias"}, 4)
+	defer unsubscribeAll()
+
+	plugin := tailPlugin{}
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "claude", Model: "m", RequestedModel: "alias", Rejection: RejectionSpendCap})
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "gemini", Model: "m", Rejection: RejectionSpendCap})
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "claude", Model: "alias"})
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "claude", Model: "m", PolicyDenied: true})
+
+	if got := <-sub.C; got.Provider != "claude" || got.StatusCode != 403 {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+	if sub.Dropped() != 1 {
+		t.Fatalf("expected the second matching event to be dropped, got %d", sub.Dropped())
+	}
+	if len(all.C) != 2 {
+		t.Fatalf("model filter matched %d events, want 2", len(all.C))
+	}
+
+	unsubscribe()
+	unsubscribe()
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "claude", PolicyDenied: true})
+	if len(sub.C) != 0 {
+		t.Fatalf("events delivered after unsubscribe")
+	}
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Log components whose debug output can be enabled independently of the global level.
+const (
+	LogComponentUsage  = "usage"
+	LogComponentOTLP   = "otlp"
+	LogComponentRouter = "router"
+	LogComponentAuth   = "auth"
+)
+
+var (
+	debugComponents atomic.Pointer[[]string]
+	logOutput       atomic.Pointer[io.Writer]
+
+	componentLoggerOnce sync.Once
+	componentLogger     *log.Logger
+)
+
+// SetDebugComponents replaces the set of components whose debug output is emitted
+// even when the global level is above debug.
+func SetDebugComponents(components []string) {
+	enabled := slices.Clone(components)
+	previous := DebugComponents()
+	debugComponents.Store(&enabled)
+	if !slices.Equal(previous, enabled) {
+		log.Infof("debug log components changed from %v to %v", previous, enabled)
+	}
+}
+
+// DebugComponents returns the components with debug output enabled.
+func DebugComponents() []string {
+	if p := debugComponents.Load(); p != nil {
+		return slices.Clone(*p)
+	}
+	return nil
+}
+
+// SetLogOutput sets the destination of the standard logger and of component loggers.
+// Callers should use it instead of log.SetOutput so both stay in sync.
+func SetLogOutput(w io.Writer) {
+	log.SetOutput(w)
+	logOutput.Store(&w)
+}
+
+// ComponentLog returns a log entry for component. Its debug messages are written when
+// the global level allows debug or when the component is listed in log-components.
+func ComponentLog(component string) *log.Entry {
+	if log.IsLevelEnabled(log.DebugLevel) || !componentDebugEnabled(component) {
+		return log.WithField("component", component)
+	}
+	componentLoggerOnce.Do(func() {
+		std := log.StandardLogger()
+		componentLogger = &log.Logger{
+			Out:          componentOutput{},
+			Formatter:    std.Formatter,
+			Hooks:        make(log.LevelHooks),
+			Level:        log.DebugLevel,
+			ReportCaller: std.ReportCaller,
+			ExitFunc:     os.Exit,
+		}
+	})
+	return componentLogger.WithField("component", component)
+}
+
+func componentDebugEnabled(component string) bool {
+	p := debugComponents.Load()
+	return p != nil && slices.Contains(*p, component)
+}
+
+// componentOutput forwards component log lines to the current standard logger output.
+type componentOutput struct{}
+
+func (componentOutput) Write(b []byte) (int, error) {
+	if p := logOutput.Load(); p != nil {
+		return (*p).Write(b)
+	}
+	return os.Stderr.Write(b)
+}
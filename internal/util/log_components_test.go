@@ -0,0 +1,64 @@
+package util
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestComponentLogHonorsDebugComponents(t *testing.T) {
+	prevLevel := log.GetLevel()
+	var buf bytes.Buffer
+	SetLogOutput(&buf)
+	t.Cleanup(func() {
+		SetLogOutput(os.Stderr)
+		log.SetLevel(prevLevel)
+		SetDebugComponents(nil)
+	})
+
+	SetLogLevel(&config.Config{LogLevel: "info"})
+	ComponentLog(LogComponentRouter).Debug("router hidden")
+	if strings.Contains(buf.String(), "router hidden") {
+		t.Fatalf("debug output leaked at info level: %q", buf.String())
+	}
+
+	SetLogLevel(&config.Config{LogLevel: "info", LogComponents: []string{LogComponentRouter}})
+	ComponentLog(LogComponentRouter).Debug("router shown")
+	ComponentLog(LogComponentUsage).Debug("usage hidden")
+	out := buf.String()
+	if !strings.Contains(out, "router shown") {
+		t.Fatalf("expected router debug output, got %q", out)
+	}
+	if strings.Contains(out, "usage hidden") {
+		t.Fatalf("usage debug output should stay hidden, got %q", out)
+	}
+	if log.GetLevel() != log.InfoLevel {
+		t.Fatalf("global level = %s, want info", log.GetLevel())
+	}
+}
+
+func TestSetLogLevelPrefersExplicitLevel(t *testing.T) {
+	prevLevel := log.GetLevel()
+	t.Cleanup(func() { log.SetLevel(prevLevel) })
+
+	cases := []struct {
+		cfg  config.Config
+		want log.Level
+	}{
+		{config.Config{}, log.InfoLevel},
+		{config.Config{Debug: true}, log.DebugLevel},
+		{config.Config{LogLevel: "warn"}, log.WarnLevel},
+		{config.Config{LogLevel: "warn", Debug: true}, log.DebugLevel},
+		{config.Config{LogLevel: "trace", Debug: true}, log.TraceLevel},
+	}
+	for _, tc := range cases {
+		SetLogLevel(&tc.cfg)
+		if got := log.GetLevel(); got != tc.want {
+			t.Errorf("SetLogLevel(%+v) level = %s, want %s", tc.cfg, got, tc.want)
+		}
+	}
+}
@@ -229,3 +229,67 @@ func FixJSON(input string) string {
 
 	return out.String()
 }
+
+// ParseDataURL splits a base64 data URL into its media type and payload.
+func ParseDataURL(url string) (string, string, bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !ok {
+		return "", "", false
+	}
+	return strings.Split(header, ";")[0], data, true
+}
+
+// FileExtension returns the lower-case extension of a file name or URL path.
+func FileExtension(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 && !strings.Contains(name[i:], "/") {
+		return strings.ToLower(name[i+1:])
+	}
+	return ""
+}
+
+// FirstExisting returns the first of paths present in value, for fields that may be
+// spelled in camelCase or snake_case.
+func FirstExisting(value gjson.Result, paths ...string) gjson.Result {
+	for _, path := range paths {
+		if field := value.Get(path); field.Exists() {
+			return field
+		}
+	}
+	return gjson.Result{}
+}
+
+// PendingToolCall is a function call of a conversation that has not been answered yet.
+type PendingToolCall struct {
+	ID   string
+	Name string
+}
+
+// TakePendingToolCall removes the call answered by a function response from pending and
+// returns its ID: the call with the response's ID, else the oldest call of the same
+// function, else the oldest call. An unknown response ID is returned as is.
+func TakePendingToolCall(pending []PendingToolCall, id, name string) (string, []PendingToolCall) {
+	match := -1
+	for i, call := range pending {
+		if id != "" && call.ID == id {
+			match = i
+			break
+		}
+		if match < 0 && call.Name == name {
+			match = i
+		}
+	}
+	if match < 0 && id != "" {
+		return id, pending
+	}
+	if match < 0 && len(pending) > 0 {
+		match = 0
+	}
+	if match < 0 {
+		return "", pending
+	}
+	toolID := pending[match].ID
+	return toolID, append(pending[:match:match], pending[match+1:]...)
+}
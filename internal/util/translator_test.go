@@ -0,0 +1,48 @@
+package util
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTakePendingToolCall(t *testing.T) {
+	pending := []PendingToolCall{{ID: "a", Name: "weather"}, {ID: "b", Name: "clock"}, {ID: "c", Name: "weather"}}
+	cases := []struct {
+		name     string
+		id       string
+		callName string
+		want     string
+		left     []string
+	}{
+		{name: "by id", id: "c", callName: "weather", want: "c", left: []string{"a", "b"}},
+		{name: "oldest of same name", callName: "weather", want: "a", left: []string{"b", "c"}},
+		{name: "oldest call", callName: "news", want: "a", left: []string{"b", "c"}},
+		{name: "unknown id", id: "z", callName: "news", want: "z", left: []string{"a", "b", "c"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, rest := TakePendingToolCall(slices.Clone(pending), tc.id, tc.callName)
+			var left []string
+			for _, call := range rest {
+				left = append(left, call.ID)
+			}
+			if got != tc.want || !slices.Equal(left, tc.left) {
+				t.Fatalf("got (%q, %q), want (%q, %q)", got, left, tc.want, tc.left)
+			}
+		})
+	}
+	if got, rest := TakePendingToolCall(nil, "", "weather"); got != "" || len(rest) != 0 {
+		t.Fatalf("empty queue returned (%q, %v)", got, rest)
+	}
+}
+
+func TestParseDataURL(t *testing.T) {
+	if mimeType, data, ok := ParseDataURL("data:application/pdf;base64,JVBE"); !ok || mimeType != "application/pdf" || data != "JVBE" {
+		t.Fatalf("got (%q, %q, %v)", mimeType, data, ok)
+	}
+	for _, url := range []string{"https://example.com/a.png", "data:image/png;base64"} {
+		if _, _, ok := ParseDataURL(url); ok {
+			t.Fatalf("%q should not parse", url)
+		}
+	}
+}
@@ -15,20 +15,28 @@ import (
 )
 
 // SetLogLevel configures the logrus log level based on the configuration.
-// It sets the log level to DebugLevel if debug mode is enabled, otherwise to InfoLevel.
+// An explicit log-level wins; otherwise debug mode selects DebugLevel and InfoLevel is
+// used by default. Debug mode never raises the level above debug. Per-component debug
+// output follows cfg.LogComponents.
 func SetLogLevel(cfg *config.Config) {
 	currentLevel := log.GetLevel()
-	var newLevel log.Level
-	if cfg.Debug {
+	newLevel := log.InfoLevel
+	if cfg.LogLevel != "" {
+		if parsed, err := log.ParseLevel(cfg.LogLevel); err == nil {
+			newLevel = parsed
+		} else {
+			log.Warnf("invalid log-level %q, using %s", cfg.LogLevel, newLevel)
+		}
+	}
+	if cfg.Debug && newLevel < log.DebugLevel {
 		newLevel = log.DebugLevel
-	} else {
-		newLevel = log.InfoLevel
 	}
 
 	if currentLevel != newLevel {
 		log.SetLevel(newLevel)
 		log.Infof("log level changed from %s to %s (debug=%t)", currentLevel, newLevel, cfg.Debug)
 	}
+	SetDebugComponents(cfg.LogComponents)
 }
 
 // ResolveAuthDir normalizes the auth directory path for consistent reuse throughout the app.
@@ -6,11 +6,13 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/watcher/diff"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
 	"gopkg.in/yaml.v3"
 
 	log "github.com/sirupsen/logrus"
@@ -80,9 +82,16 @@ func (w *Watcher) reloadConfig() bool {
 	log.Debug("=========================== CONFIG RELOAD ============================")
 	log.Debugf("starting config reload from: %s", w.configPath)
 
+	if data, errRead := os.ReadFile(w.configPath); errRead == nil {
+		if result := config.ValidateYAML(data, w.configPath); !result.Valid {
+			rejectConfigReload(result.Issues)
+			return false
+		}
+	}
 	newConfig, errLoadConfig := config.LoadConfig(w.configPath)
 	if errLoadConfig != nil {
 		log.Errorf("failed to reload config: %v", errLoadConfig)
+		events.Publish(events.Event{Type: events.ConfigReloadFailed, Reason: errLoadConfig.Error(), Data: map[string]any{"stage": "load"}})
 		return false
 	}
 
@@ -132,3 +141,28 @@ func (w *Watcher) reloadConfig() bool {
 	w.reloadClients(authDirChanged, affectedOAuthProviders, forceAuthRefresh)
 	return true
 }
+
+// rejectConfigReload logs the validation errors of a changed config file and reports
+// them on the event bus. The running configuration stays in place.
+func rejectConfigReload(issues []config.ValidationIssue) {
+	errs := make([]config.ValidationIssue, 0, len(issues))
+	messages := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		if issue.Severity != config.SeverityError {
+			continue
+		}
+		errs = append(errs, issue)
+		if issue.Field != "" {
+			messages = append(messages, issue.Field+": "+issue.Message)
+		} else {
+			messages = append(messages, issue.Message)
+		}
+	}
+	reason := strings.Join(messages, "; ")
+	log.Errorf("config reload rejected, keeping the current config: %s", reason)
+	events.Publish(events.Event{
+		Type:   events.ConfigReloadFailed,
+		Reason: reason,
+		Data:   map[string]any{"stage": "validate", "issues": errs},
+	})
+}
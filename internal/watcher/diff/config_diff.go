@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
@@ -27,6 +28,12 @@ func BuildConfigChangeDetails(oldCfg, newCfg *config.Config) []string {
 	if oldCfg.Debug != newCfg.Debug {
 		changes = append(changes, fmt.Sprintf("debug: %t -> %t", oldCfg.Debug, newCfg.Debug))
 	}
+	if oldCfg.LogLevel != newCfg.LogLevel {
+		changes = append(changes, fmt.Sprintf("log-level: %s -> %s", oldCfg.LogLevel, newCfg.LogLevel))
+	}
+	if !reflect.DeepEqual(oldCfg.LogComponents, newCfg.LogComponents) {
+		changes = append(changes, fmt.Sprintf("log-components: %v -> %v", oldCfg.LogComponents, newCfg.LogComponents))
+	}
 	if oldCfg.LoggingToFile != newCfg.LoggingToFile {
 		changes = append(changes, fmt.Sprintf("logging-to-file: %t -> %t", oldCfg.LoggingToFile, newCfg.LoggingToFile))
 	}
@@ -48,6 +55,15 @@ func BuildConfigChangeDetails(oldCfg, newCfg *config.Config) []string {
 	if oldCfg.ProxyURL != newCfg.ProxyURL {
 		changes = append(changes, fmt.Sprintf("proxy-url: %s -> %s", formatProxyURL(oldCfg.ProxyURL), formatProxyURL(newCfg.ProxyURL)))
 	}
+	if oldCfg.ErrorResponses.Translate != newCfg.ErrorResponses.Translate {
+		changes = append(changes, fmt.Sprintf("error-responses.translate: %t -> %t", oldCfg.ErrorResponses.Translate, newCfg.ErrorResponses.Translate))
+	}
+	if !reflect.DeepEqual(oldCfg.ErrorResponses.Routes, newCfg.ErrorResponses.Routes) {
+		changes = append(changes, fmt.Sprintf("error-responses.routes: updated (%d -> %d entries)", len(oldCfg.ErrorResponses.Routes), len(newCfg.ErrorResponses.Routes)))
+	}
+	for _, provider := range changedProviderProxies(oldCfg.ProviderProxies, newCfg.ProviderProxies) {
+		changes = append(changes, fmt.Sprintf("provider-proxies.%s: %s -> %s", provider, formatProxyURL(oldCfg.ProviderProxies[provider]), formatProxyURL(newCfg.ProviderProxies[provider])))
+	}
 	if oldCfg.WebsocketAuth != newCfg.WebsocketAuth {
 		changes = append(changes, fmt.Sprintf("ws-auth: %t -> %t", oldCfg.WebsocketAuth, newCfg.WebsocketAuth))
 	}
@@ -59,6 +75,9 @@ func BuildConfigChangeDetails(oldCfg, newCfg *config.Config) []string {
 	if oldCfg.QuotaExceeded.SwitchPreviewModel != newCfg.QuotaExceeded.SwitchPreviewModel {
 		changes = append(changes, fmt.Sprintf("quota-exceeded.switch-preview-model: %t -> %t", oldCfg.QuotaExceeded.SwitchPreviewModel, newCfg.QuotaExceeded.SwitchPreviewModel))
 	}
+	if oldCfg.QuotaExceeded.SwitchCredentialEnabled() != newCfg.QuotaExceeded.SwitchCredentialEnabled() {
+		changes = append(changes, fmt.Sprintf("quota-exceeded.switch-credential: %t -> %t", oldCfg.QuotaExceeded.SwitchCredentialEnabled(), newCfg.QuotaExceeded.SwitchCredentialEnabled()))
+	}
 
 	// API keys (redacted) and counts
 	if len(oldCfg.APIKeys) != len(newCfg.APIKeys) {
@@ -66,6 +85,12 @@ func BuildConfigChangeDetails(oldCfg, newCfg *config.Config) []string {
 	} else if !reflect.DeepEqual(trimStrings(oldCfg.APIKeys), trimStrings(newCfg.APIKeys)) {
 		changes = append(changes, "api-keys: values updated (count unchanged, redacted)")
 	}
+	if !reflect.DeepEqual(oldCfg.InviteCodes, newCfg.InviteCodes) {
+		changes = append(changes, fmt.Sprintf("invite-codes: updated (%d -> %d entries, redacted)", len(oldCfg.InviteCodes), len(newCfg.InviteCodes)))
+	}
+	if !reflect.DeepEqual(oldCfg.Teams, newCfg.Teams) {
+		changes = append(changes, fmt.Sprintf("teams: updated (%d -> %d entries, redacted)", len(oldCfg.Teams), len(newCfg.Teams)))
+	}
 	if len(oldCfg.GeminiKey) != len(newCfg.GeminiKey) {
 		changes = append(changes, fmt.Sprintf("gemini-api-key count: %d -> %d", len(oldCfg.GeminiKey), len(newCfg.GeminiKey)))
 	} else {
@@ -209,6 +234,174 @@ func BuildConfigChangeDetails(oldCfg, newCfg *config.Config) []string {
 			changes = append(changes, "remote-management.secret-key: updated")
 		}
 	}
+	if !reflect.DeepEqual(oldCfg.RemoteManagement.Tokens, newCfg.RemoteManagement.Tokens) {
+		changes = append(changes, fmt.Sprintf("remote-management.tokens: updated (%d -> %d entries)", len(oldCfg.RemoteManagement.Tokens), len(newCfg.RemoteManagement.Tokens)))
+	}
+
+	// Request size limits (per-key rules name client keys, so only note the change)
+	if oldCfg.RequestSizeLimits.MaxBodyBytes != newCfg.RequestSizeLimits.MaxBodyBytes {
+		changes = append(changes, fmt.Sprintf("request-size-limits.max-body-bytes: %d -> %d", oldCfg.RequestSizeLimits.MaxBodyBytes, newCfg.RequestSizeLimits.MaxBodyBytes))
+	}
+	if !reflect.DeepEqual(oldCfg.RequestSizeLimits.Routes, newCfg.RequestSizeLimits.Routes) {
+		changes = append(changes, fmt.Sprintf("request-size-limits.routes: updated (%d -> %d entries)", len(oldCfg.RequestSizeLimits.Routes), len(newCfg.RequestSizeLimits.Routes)))
+	}
+	if oldCfg.RequestSizeLimits.MaxMediaBytes != newCfg.RequestSizeLimits.MaxMediaBytes {
+		changes = append(changes, fmt.Sprintf("request-size-limits.max-media-bytes: %d -> %d", oldCfg.RequestSizeLimits.MaxMediaBytes, newCfg.RequestSizeLimits.MaxMediaBytes))
+	}
+	if oldCfg.RequestSizeLimits.MaxRequestMediaBytes != newCfg.RequestSizeLimits.MaxRequestMediaBytes {
+		changes = append(changes, fmt.Sprintf("request-size-limits.max-request-media-bytes: %d -> %d", oldCfg.RequestSizeLimits.MaxRequestMediaBytes, newCfg.RequestSizeLimits.MaxRequestMediaBytes))
+	}
+	if oldCfg.Idempotency.Enabled != newCfg.Idempotency.Enabled {
+		changes = append(changes, fmt.Sprintf("idempotency.enabled: %t -> %t", oldCfg.Idempotency.Enabled, newCfg.Idempotency.Enabled))
+	} else if oldCfg.Idempotency != newCfg.Idempotency {
+		changes = append(changes, "idempotency: updated")
+	}
+	if !reflect.DeepEqual(oldCfg.RequestSizeLimits.APIKeys, newCfg.RequestSizeLimits.APIKeys) {
+		changes = append(changes, fmt.Sprintf("request-size-limits.api-keys: updated (%d -> %d entries)", len(oldCfg.RequestSizeLimits.APIKeys), len(newCfg.RequestSizeLimits.APIKeys)))
+	}
+	if oldCfg.PromptCaching.AutoInject != newCfg.PromptCaching.AutoInject {
+		changes = append(changes, fmt.Sprintf("prompt-caching.auto-inject: %t -> %t", oldCfg.PromptCaching.AutoInject, newCfg.PromptCaching.AutoInject))
+	}
+	if oldCfg.PromptCaching.MinPromptChars != newCfg.PromptCaching.MinPromptChars {
+		changes = append(changes, fmt.Sprintf("prompt-caching.min-prompt-chars: %d -> %d", oldCfg.PromptCaching.MinPromptChars, newCfg.PromptCaching.MinPromptChars))
+	}
+	if oldCfg.LoadShedding.MaxInFlight != newCfg.LoadShedding.MaxInFlight {
+		changes = append(changes, fmt.Sprintf("load-shedding.max-in-flight: %d -> %d", oldCfg.LoadShedding.MaxInFlight, newCfg.LoadShedding.MaxInFlight))
+	}
+	if oldCfg.LoadShedding.MaxQueueWaitMs != newCfg.LoadShedding.MaxQueueWaitMs {
+		changes = append(changes, fmt.Sprintf("load-shedding.max-queue-wait-ms: %d -> %d", oldCfg.LoadShedding.MaxQueueWaitMs, newCfg.LoadShedding.MaxQueueWaitMs))
+	}
+	if oldCfg.LoadShedding.RetryAfterSeconds != newCfg.LoadShedding.RetryAfterSeconds {
+		changes = append(changes, fmt.Sprintf("load-shedding.retry-after-seconds: %d -> %d", oldCfg.LoadShedding.RetryAfterSeconds, newCfg.LoadShedding.RetryAfterSeconds))
+	}
+	if oldCfg.CredentialCanary.Enabled != newCfg.CredentialCanary.Enabled {
+		changes = append(changes, fmt.Sprintf("credential-canary.enabled: %t -> %t", oldCfg.CredentialCanary.Enabled, newCfg.CredentialCanary.Enabled))
+	}
+	if oldCfg.CredentialCanary.TrafficPercent != newCfg.CredentialCanary.TrafficPercent {
+		changes = append(changes, fmt.Sprintf("credential-canary.traffic-percent: %d -> %d", oldCfg.CredentialCanary.TrafficPercent, newCfg.CredentialCanary.TrafficPercent))
+	}
+	if oldCfg.CredentialCanary.WarmupMinutes != newCfg.CredentialCanary.WarmupMinutes {
+		changes = append(changes, fmt.Sprintf("credential-canary.warmup-minutes: %d -> %d", oldCfg.CredentialCanary.WarmupMinutes, newCfg.CredentialCanary.WarmupMinutes))
+	}
+	if oldCfg.CredentialCanary.MinRequests != newCfg.CredentialCanary.MinRequests {
+		changes = append(changes, fmt.Sprintf("credential-canary.min-requests: %d -> %d", oldCfg.CredentialCanary.MinRequests, newCfg.CredentialCanary.MinRequests))
+	}
+	if oldCfg.CredentialCanary.MaxFailureRate != newCfg.CredentialCanary.MaxFailureRate {
+		changes = append(changes, fmt.Sprintf("credential-canary.max-failure-rate: %g -> %g", oldCfg.CredentialCanary.MaxFailureRate, newCfg.CredentialCanary.MaxFailureRate))
+	}
+	if oldCfg.CredentialCanary.MaxRateLimitRate != newCfg.CredentialCanary.MaxRateLimitRate {
+		changes = append(changes, fmt.Sprintf("credential-canary.max-rate-limit-rate: %g -> %g", oldCfg.CredentialCanary.MaxRateLimitRate, newCfg.CredentialCanary.MaxRateLimitRate))
+	}
+	if oldCfg.LatencyRouting.Enabled != newCfg.LatencyRouting.Enabled {
+		changes = append(changes, fmt.Sprintf("latency-routing.enabled: %t -> %t", oldCfg.LatencyRouting.Enabled, newCfg.LatencyRouting.Enabled))
+	}
+	if oldCfg.LatencyRouting.WindowSeconds != newCfg.LatencyRouting.WindowSeconds {
+		changes = append(changes, fmt.Sprintf("latency-routing.window-seconds: %d -> %d", oldCfg.LatencyRouting.WindowSeconds, newCfg.LatencyRouting.WindowSeconds))
+	}
+	if oldCfg.LatencyRouting.MinSamples != newCfg.LatencyRouting.MinSamples {
+		changes = append(changes, fmt.Sprintf("latency-routing.min-samples: %d -> %d", oldCfg.LatencyRouting.MinSamples, newCfg.LatencyRouting.MinSamples))
+	}
+	if oldCfg.ClientAttribution.Enabled != newCfg.ClientAttribution.Enabled {
+		changes = append(changes, fmt.Sprintf("client-attribution.enabled: %t -> %t", oldCfg.ClientAttribution.Enabled, newCfg.ClientAttribution.Enabled))
+	}
+	if !reflect.DeepEqual(oldCfg.ClientAttribution.TrustedProxies, newCfg.ClientAttribution.TrustedProxies) {
+		changes = append(changes, fmt.Sprintf("client-attribution.trusted-proxies: updated (%d -> %d entries)", len(oldCfg.ClientAttribution.TrustedProxies), len(newCfg.ClientAttribution.TrustedProxies)))
+	}
+	if oldCfg.ClientAttribution.ClientIPHeader != newCfg.ClientAttribution.ClientIPHeader {
+		changes = append(changes, fmt.Sprintf("client-attribution.client-ip-header: %s -> %s", oldCfg.ClientAttribution.ClientIPHeader, newCfg.ClientAttribution.ClientIPHeader))
+	}
+	if oldCfg.ClientAttribution.GeoIPDatabase != newCfg.ClientAttribution.GeoIPDatabase {
+		changes = append(changes, fmt.Sprintf("client-attribution.geoip-database: %s -> %s", oldCfg.ClientAttribution.GeoIPDatabase, newCfg.ClientAttribution.GeoIPDatabase))
+	}
+
+	if oldCfg.AuthRefresh != newCfg.AuthRefresh {
+		changes = append(changes, fmt.Sprintf("auth-refresh: jitter %d%% / max backoff %ds -> jitter %d%% / max backoff %ds",
+			oldCfg.AuthRefresh.JitterPercent, oldCfg.AuthRefresh.MaxBackoffSeconds, newCfg.AuthRefresh.JitterPercent, newCfg.AuthRefresh.MaxBackoffSeconds))
+	}
+
+	// Shadow traffic
+	if !reflect.DeepEqual(oldCfg.ShadowTraffic.Rules, newCfg.ShadowTraffic.Rules) {
+		changes = append(changes, fmt.Sprintf("shadow-traffic.rules: updated (%d -> %d entries)", len(oldCfg.ShadowTraffic.Rules), len(newCfg.ShadowTraffic.Rules)))
+	}
+	if oldCfg.ShadowTraffic.MaxConcurrent != newCfg.ShadowTraffic.MaxConcurrent {
+		changes = append(changes, fmt.Sprintf("shadow-traffic.max-concurrent: %d -> %d", oldCfg.ShadowTraffic.MaxConcurrent, newCfg.ShadowTraffic.MaxConcurrent))
+	}
+	if oldCfg.ShadowTraffic.TimeoutSeconds != newCfg.ShadowTraffic.TimeoutSeconds || oldCfg.ShadowTraffic.MaxResponseBytes != newCfg.ShadowTraffic.MaxResponseBytes {
+		changes = append(changes, "shadow-traffic: limits updated")
+	}
+
+	// OTLP export (headers may hold collector credentials, so only note the change)
+	if oldCfg.OTLP.IsEnabled() != newCfg.OTLP.IsEnabled() {
+		changes = append(changes, fmt.Sprintf("otlp.enabled: %t -> %t", oldCfg.OTLP.IsEnabled(), newCfg.OTLP.IsEnabled()))
+	}
+	if oldCfg.OTLP.Endpoint != newCfg.OTLP.Endpoint {
+		changes = append(changes, fmt.Sprintf("otlp.endpoint: %s -> %s", oldCfg.OTLP.Endpoint, newCfg.OTLP.Endpoint))
+	}
+	if !reflect.DeepEqual(oldCfg.OTLP.Endpoints, newCfg.OTLP.Endpoints) {
+		changes = append(changes, fmt.Sprintf("otlp.endpoints: updated (%d -> %d entries)", len(oldCfg.OTLP.Endpoints), len(newCfg.OTLP.Endpoints)))
+	}
+	if oldCfg.OTLP.SRV != newCfg.OTLP.SRV {
+		changes = append(changes, fmt.Sprintf("otlp.srv: %s -> %s", oldCfg.OTLP.SRV.Name, newCfg.OTLP.SRV.Name))
+	}
+	if oldCfg.OTLP.Protocol != newCfg.OTLP.Protocol {
+		changes = append(changes, fmt.Sprintf("otlp.protocol: %s -> %s", oldCfg.OTLP.Protocol, newCfg.OTLP.Protocol))
+	}
+	if oldCfg.OTLP.BatchSize != newCfg.OTLP.BatchSize || oldCfg.OTLP.FlushIntervalMs != newCfg.OTLP.FlushIntervalMs {
+		changes = append(changes, fmt.Sprintf("otlp.batching: %d/%dms -> %d/%dms", oldCfg.OTLP.BatchSize, oldCfg.OTLP.FlushIntervalMs, newCfg.OTLP.BatchSize, newCfg.OTLP.FlushIntervalMs))
+	}
+	if !reflect.DeepEqual(oldCfg.OTLP.Headers, newCfg.OTLP.Headers) {
+		changes = append(changes, "otlp.headers: updated")
+	}
+	if !reflect.DeepEqual(oldCfg.OTLP.Sampling, newCfg.OTLP.Sampling) {
+		changes = append(changes, "otlp.sampling: updated")
+	}
+	if !reflect.DeepEqual(oldCfg.OTLP.ResourceAttributes, newCfg.OTLP.ResourceAttributes) {
+		changes = append(changes, "otlp.resource_attributes: updated")
+	}
+	if !reflect.DeepEqual(oldCfg.OTLP.ExcludeEvents, newCfg.OTLP.ExcludeEvents) {
+		changes = append(changes, fmt.Sprintf("otlp.exclude_events: %v -> %v", oldCfg.OTLP.ExcludeEvents, newCfg.OTLP.ExcludeEvents))
+	}
+	if oldCfg.Prometheus.Enabled != newCfg.Prometheus.Enabled {
+		changes = append(changes, fmt.Sprintf("prometheus.enabled: %t -> %t", oldCfg.Prometheus.Enabled, newCfg.Prometheus.Enabled))
+	}
+	if !reflect.DeepEqual(oldCfg.Prometheus.Buckets, newCfg.Prometheus.Buckets) {
+		changes = append(changes, "prometheus.buckets: updated (series reset)")
+	}
+	if oldCfg.Prometheus.BearerToken != newCfg.Prometheus.BearerToken {
+		changes = append(changes, "prometheus.bearer-token: updated")
+	}
+	if !reflect.DeepEqual(oldCfg.UsageSinks, newCfg.UsageSinks) {
+		changes = append(changes, fmt.Sprintf("usage-sinks: updated (%d -> %d entries)", len(oldCfg.UsageSinks), len(newCfg.UsageSinks)))
+	}
+	if oldCfg.Kafka.Enabled != newCfg.Kafka.Enabled {
+		changes = append(changes, fmt.Sprintf("kafka.enabled: %t -> %t", oldCfg.Kafka.Enabled, newCfg.Kafka.Enabled))
+	} else if !reflect.DeepEqual(oldCfg.Kafka, newCfg.Kafka) {
+		changes = append(changes, "kafka: updated")
+	}
+	if oldCfg.UsageDatabase.SQLite != newCfg.UsageDatabase.SQLite {
+		changes = append(changes, "usage-db.sqlite: updated")
+	}
+	if oldCfg.UsageDatabase.Archive.Enabled != newCfg.UsageDatabase.Archive.Enabled {
+		changes = append(changes, fmt.Sprintf("usage-db.archive.enabled: %t -> %t", oldCfg.UsageDatabase.Archive.Enabled, newCfg.UsageDatabase.Archive.Enabled))
+	} else if !reflect.DeepEqual(oldCfg.UsageDatabase.Archive, newCfg.UsageDatabase.Archive) {
+		changes = append(changes, "usage-db.archive: updated")
+	}
+	if oldCfg.UsageDatabase.DualWrite.Enabled != newCfg.UsageDatabase.DualWrite.Enabled {
+		changes = append(changes, fmt.Sprintf("usage-db.dual-write.enabled: %t -> %t", oldCfg.UsageDatabase.DualWrite.Enabled, newCfg.UsageDatabase.DualWrite.Enabled))
+	} else if oldCfg.UsageDatabase.DualWrite.DSN != newCfg.UsageDatabase.DualWrite.DSN {
+		changes = append(changes, "usage-db.dual-write.dsn: updated")
+	}
+	if oldCfg.UsageDatabase.Encryption.Enabled != newCfg.UsageDatabase.Encryption.Enabled {
+		changes = append(changes, fmt.Sprintf("usage-db.encryption.enabled: %t -> %t", oldCfg.UsageDatabase.Encryption.Enabled, newCfg.UsageDatabase.Encryption.Enabled))
+	} else if oldCfg.UsageDatabase.Encryption != newCfg.UsageDatabase.Encryption {
+		changes = append(changes, "usage-db.encryption: key source updated")
+	}
+	if !reflect.DeepEqual(oldCfg.UsageDatabase.Reports.Recipients, newCfg.UsageDatabase.Reports.Recipients) {
+		changes = append(changes, fmt.Sprintf("usage-db.reports.recipients: updated (%d -> %d entries)", len(oldCfg.UsageDatabase.Reports.Recipients), len(newCfg.UsageDatabase.Reports.Recipients)))
+	}
+	if !reflect.DeepEqual(oldCfg.UsageDatabase.Reports.SMTP, newCfg.UsageDatabase.Reports.SMTP) {
+		changes = append(changes, "usage-db.reports.smtp: updated")
+	}
 
 	// OpenAI compatibility providers (summarized)
 	if compat := DiffOpenAICompatibility(oldCfg.OpenAICompatibility, newCfg.OpenAICompatibility); len(compat) > 0 {
@@ -271,6 +464,23 @@ func equalStringMap(a, b map[string]string) bool {
 	return true
 }
 
+// changedProviderProxies returns the sorted providers whose proxy differs between old and new.
+func changedProviderProxies(oldProxies, newProxies map[string]string) []string {
+	var out []string
+	for provider, proxyURL := range oldProxies {
+		if strings.TrimSpace(newProxies[provider]) != strings.TrimSpace(proxyURL) {
+			out = append(out, provider)
+		}
+	}
+	for provider := range newProxies {
+		if _, ok := oldProxies[provider]; !ok {
+			out = append(out, provider)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
 func formatProxyURL(raw string) string {
 	trimmed := strings.TrimSpace(raw)
 	if trimmed == "" {
@@ -105,7 +105,7 @@ func (w *Watcher) prepareAuthUpdatesLocked(auths []*coreauth.Auth, force bool) [
 		}
 		updates := make([]AuthUpdate, 0, len(newState))
 		for id, auth := range newState {
-			updates = append(updates, AuthUpdate{Action: AuthUpdateActionAdd, ID: id, Auth: auth.Clone()})
+			updates = append(updates, AuthUpdate{Action: AuthUpdateActionAdd, ID: id, Auth: auth.Clone(), Initial: true})
 		}
 		return updates
 	}
@@ -145,8 +145,10 @@ func (w *Watcher) dispatchAuthUpdates(updates []AuthUpdate) {
 	}
 	for idx, update := range updates {
 		key := w.authUpdateKey(update, baseTS+int64(idx))
-		if _, exists := w.pendingUpdates[key]; !exists {
+		if pending, exists := w.pendingUpdates[key]; !exists {
 			w.pendingOrder = append(w.pendingOrder, key)
+		} else if pending.Initial {
+			update.Initial = true
 		}
 		w.pendingUpdates[key] = update
 	}
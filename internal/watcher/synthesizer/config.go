@@ -56,8 +56,10 @@ func (s *ConfigSynthesizer) synthesizeGeminiKeys(ctx *SynthesisContext) []*corea
 		proxyURL := strings.TrimSpace(entry.ProxyURL)
 		id, token := idGen.Next("gemini:apikey", key, base)
 		attrs := map[string]string{
-			"source":  fmt.Sprintf("config:gemini[%s]", token),
-			"api_key": key,
+			"source": fmt.Sprintf("config:gemini[%s]", token),
+		}
+		if !setAPIKeyAttr(attrs, key) {
+			continue
 		}
 		if base != "" {
 			attrs["base_url"] = base
@@ -97,8 +99,10 @@ func (s *ConfigSynthesizer) synthesizeClaudeKeys(ctx *SynthesisContext) []*corea
 		base := strings.TrimSpace(ck.BaseURL)
 		id, token := idGen.Next("claude:apikey", key, base)
 		attrs := map[string]string{
-			"source":  fmt.Sprintf("config:claude[%s]", token),
-			"api_key": key,
+			"source": fmt.Sprintf("config:claude[%s]", token),
+		}
+		if !setAPIKeyAttr(attrs, key) {
+			continue
 		}
 		if base != "" {
 			attrs["base_url"] = base
@@ -141,8 +145,10 @@ func (s *ConfigSynthesizer) synthesizeCodexKeys(ctx *SynthesisContext) []*coreau
 		prefix := strings.TrimSpace(ck.Prefix)
 		id, token := idGen.Next("codex:apikey", key, ck.BaseURL)
 		attrs := map[string]string{
-			"source":  fmt.Sprintf("config:codex[%s]", token),
-			"api_key": key,
+			"source": fmt.Sprintf("config:codex[%s]", token),
+		}
+		if !setAPIKeyAttr(attrs, key) {
+			continue
 		}
 		if ck.BaseURL != "" {
 			attrs["base_url"] = ck.BaseURL
@@ -196,8 +202,8 @@ func (s *ConfigSynthesizer) synthesizeOpenAICompat(ctx *SynthesisContext) []*cor
 				"compat_name":  compat.Name,
 				"provider_key": providerName,
 			}
-			if key != "" {
-				attrs["api_key"] = key
+			if key != "" && !setAPIKeyAttr(attrs, key) {
+				continue
 			}
 			if hash := diff.ComputeOpenAICompatModelsHash(compat.Models); hash != "" {
 				attrs["models_hash"] = hash
@@ -269,8 +275,8 @@ func (s *ConfigSynthesizer) synthesizeVertexCompat(ctx *SynthesisContext) []*cor
 			"base_url":     base,
 			"provider_key": providerName,
 		}
-		if key != "" {
-			attrs["api_key"] = key
+		if key != "" && !setAPIKeyAttr(attrs, key) {
+			continue
 		}
 		if hash := diff.ComputeVertexCompatModelsHash(compat.Models); hash != "" {
 			attrs["models_hash"] = hash
@@ -8,7 +8,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/credcrypt"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/runtime/geminicli"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/secrets"
 	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
 )
 
@@ -46,7 +48,7 @@ func (s *FileSynthesizer) Synthesize(ctx *SynthesisContext) ([]*coreauth.Auth, e
 			continue
 		}
 		full := filepath.Join(ctx.AuthDir, name)
-		data, errRead := os.ReadFile(full)
+		data, errRead := credcrypt.ReadFile(full)
 		if errRead != nil || len(data) == 0 {
 			continue
 		}
@@ -86,20 +88,26 @@ func (s *FileSynthesizer) Synthesize(ctx *SynthesisContext) ([]*coreauth.Auth, e
 			}
 		}
 
+		attrs := map[string]string{
+			"source": full,
+			"path":   full,
+		}
+		if errResolve := secrets.ResolveAuthMetadata(metadata, attrs); errResolve != nil {
+			logUnresolvedSecret(full, errResolve)
+			continue
+		}
+
 		a := &coreauth.Auth{
-			ID:       id,
-			Provider: provider,
-			Label:    label,
-			Prefix:   prefix,
-			Status:   coreauth.StatusActive,
-			Attributes: map[string]string{
-				"source": full,
-				"path":   full,
-			},
-			ProxyURL:  proxyURL,
-			Metadata:  metadata,
-			CreatedAt: now,
-			UpdatedAt: now,
+			ID:         id,
+			Provider:   provider,
+			Label:      label,
+			Prefix:     prefix,
+			Status:     coreauth.StatusActive,
+			Attributes: attrs,
+			ProxyURL:   proxyURL,
+			Metadata:   metadata,
+			CreatedAt:  now,
+			UpdatedAt:  now,
 		}
 		ApplyAuthExcludedModelsMeta(a, cfg, nil, "oauth")
 		if provider == "gemini-cli" {
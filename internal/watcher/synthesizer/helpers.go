@@ -3,13 +3,16 @@ package synthesizer
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/secrets"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/watcher/diff"
 	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	log "github.com/sirupsen/logrus"
 )
 
 // StableIDGenerator generates stable, deterministic IDs for auth entries.
@@ -108,3 +111,33 @@ func addConfigHeadersToAttrs(headers map[string]string, attrs map[string]string)
 		attrs["header:"+key] = val
 	}
 }
+
+// setAPIKeyAttr stores the usable API key in attrs, resolving secret references such
+// as "vault:secret/data/llm#openai". The reference is kept under "api_key_ref" so config
+// lookups keyed on the configured value still match. It returns false when a reference
+// is not resolved yet and the entry should be skipped; the entry is synthesized again
+// once the secrets backend delivers the value.
+func setAPIKeyAttr(attrs map[string]string, key string) bool {
+	if !secrets.IsReference(key) {
+		attrs["api_key"] = key
+		return true
+	}
+	value, err := secrets.Lookup(key)
+	if err != nil {
+		logUnresolvedSecret(attrs["source"], err)
+		return false
+	}
+	attrs["api_key"] = value
+	attrs["api_key_ref"] = key
+	return true
+}
+
+// logUnresolvedSecret reports a credential skipped because a secret reference it
+// uses has no value yet.
+func logUnresolvedSecret(source string, err error) {
+	if errors.Is(err, secrets.ErrPending) {
+		log.Debugf("skipping %s until its secret reference is resolved", source)
+		return
+	}
+	log.WithError(err).Warnf("skipping %s: failed to resolve secret reference", source)
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/secrets"
 	"gopkg.in/yaml.v3"
 
 	sdkAuth "github.com/router-for-me/CLIProxyAPI/v6/sdk/auth"
@@ -51,6 +52,7 @@ type Watcher struct {
 	storePersister    storePersister
 	mirroredAuthDir   string
 	oldConfigYaml     []byte
+	secretsUnsub      func()
 }
 
 // AuthUpdateAction represents the type of change detected in auth sources.
@@ -67,6 +69,9 @@ type AuthUpdate struct {
 	Action AuthUpdateAction
 	ID     string
 	Auth   *coreauth.Auth
+	// Initial marks the adds of the first snapshot after start, which carry
+	// credentials that existed before rather than newly added ones.
+	Initial bool
 }
 
 const (
@@ -108,11 +113,16 @@ func NewWatcher(configPath, authDir string, reloadCallback func(*config.Config))
 
 // Start begins watching the configuration file and authentication directory
 func (w *Watcher) Start(ctx context.Context) error {
+	// Re-synthesize config credentials when a referenced secret rotates.
+	w.secretsUnsub = secrets.Subscribe(func() { w.refreshAuthState(false) })
 	return w.start(ctx)
 }
 
 // Stop stops the file watcher
 func (w *Watcher) Stop() error {
+	if w.secretsUnsub != nil {
+		w.secretsUnsub()
+	}
 	w.stopDispatch()
 	w.stopConfigReloadTimer()
 	return w.watcher.Close()
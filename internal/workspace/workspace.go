@@ -0,0 +1,91 @@
+// Package workspace resolves the tenant a request belongs to from the client API
+// key that authenticated it. The resolved name is passed to credential selection
+// so that credentials restricted to a workspace are never used by other tenants.
+package workspace
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Directory maps client API keys to workspace names.
+type Directory struct {
+	byKey map[string]string
+}
+
+var active atomic.Pointer[Directory]
+
+// Build constructs a directory from configuration. Keys listed under several
+// workspaces keep their first assignment.
+func Build(workspaces []config.Workspace) *Directory {
+	dir := &Directory{byKey: make(map[string]string)}
+	for i := range workspaces {
+		name := strings.TrimSpace(workspaces[i].Name)
+		if name == "" {
+			continue
+		}
+		for _, key := range workspaces[i].APIKeys {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			if existing, ok := dir.byKey[key]; ok && existing != name {
+				log.Warnf("workspace: api key already assigned to %q, ignoring assignment to %q", existing, name)
+				continue
+			}
+			dir.byKey[key] = name
+		}
+	}
+	return dir
+}
+
+// Set replaces the active workspace directory.
+func Set(workspaces []config.Workspace) {
+	if len(workspaces) == 0 {
+		active.Store(nil)
+		return
+	}
+	active.Store(Build(workspaces))
+}
+
+// Lookup returns the workspace owning apiKey, or "" when it is unassigned.
+func (d *Directory) Lookup(apiKey string) string {
+	if d == nil {
+		return ""
+	}
+	return d.byKey[strings.TrimSpace(apiKey)]
+}
+
+// FromGin resolves the workspace of the client authenticated on c.
+func FromGin(c *gin.Context) string {
+	if c == nil {
+		return ""
+	}
+	dir := active.Load()
+	if dir == nil {
+		return ""
+	}
+	v, ok := c.Get("apiKey")
+	if !ok {
+		return ""
+	}
+	apiKey, _ := v.(string)
+	return dir.Lookup(apiKey)
+}
+
+// FromContext resolves the workspace from the Gin context embedded in ctx.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	ginCtx, ok := ctx.Value("gin").(*gin.Context)
+	if !ok {
+		return ""
+	}
+	return FromGin(ginCtx)
+}
@@ -67,14 +67,9 @@ func (h *ClaudeCodeAPIHandler) Models() []map[string]any {
 func (h *ClaudeCodeAPIHandler) ClaudeMessages(c *gin.Context) {
 	// Extract raw JSON data from the incoming request
 	rawJSON, err := c.GetRawData()
-	// If data retrieval fails, return a 400 Bad Request error.
+	// If data retrieval fails, return a 400 (413 when the body exceeds the size limit).
 	if err != nil {
-		c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
-			Error: handlers.ErrorDetail{
-				Message: fmt.Sprintf("Invalid request: %v", err),
-				Type:    "invalid_request_error",
-			},
-		})
+		handlers.WriteBodyReadError(c, err)
 		return
 	}
 
@@ -96,14 +91,9 @@ func (h *ClaudeCodeAPIHandler) ClaudeMessages(c *gin.Context) {
 func (h *ClaudeCodeAPIHandler) ClaudeCountTokens(c *gin.Context) {
 	// Extract raw JSON data from the incoming request
 	rawJSON, err := c.GetRawData()
-	// If data retrieval fails, return a 400 Bad Request error.
+	// If data retrieval fails, return a 400 (413 when the body exceeds the size limit).
 	if err != nil {
-		c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
-			Error: handlers.ErrorDetail{
-				Message: fmt.Sprintf("Invalid request: %v", err),
-				Type:    "invalid_request_error",
-			},
-		})
+		handlers.WriteBodyReadError(c, err)
 		return
 	}
 
@@ -130,8 +120,13 @@ func (h *ClaudeCodeAPIHandler) ClaudeCountTokens(c *gin.Context) {
 // Parameters:
 //   - c: The Gin context for the request.
 func (h *ClaudeCodeAPIHandler) ClaudeModels(c *gin.Context) {
+	listed := h.ListModels(c, h.HandlerType())
+	models := make([]map[string]any, len(listed))
+	for i, model := range listed {
+		models[i] = model.Info
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"data": h.Models(),
+		"data": models,
 	})
 }
 
@@ -250,7 +245,10 @@ func (h *ClaudeCodeAPIHandler) forwardClaudeStream(c *gin.Context, flusher http.
 				c.Status(status)
 
 				// An error occurred: emit as a proper SSE error event
-				errorBytes, _ := json.Marshal(h.toClaudeError(errMsg))
+				errorBytes, translated := h.TranslatedErrorBody(c, errMsg)
+				if !translated {
+					errorBytes, _ = json.Marshal(h.toClaudeError(errMsg))
+				}
 				_, _ = fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", errorBytes)
 				flusher.Flush()
 			}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/constant"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// Error dialects select the schema of error bodies written to clients.
+const (
+	ErrorDialectPassthrough = "passthrough"
+	ErrorDialectOpenAI      = "openai"
+	ErrorDialectClaude      = "claude"
+	ErrorDialectGemini      = "gemini"
+)
+
+// errorDialectContextKey stores the handler type of the request in the Gin context.
+const errorDialectContextKey = "ERROR_DIALECT_HANDLER"
+
+// ClaudeErrorResponse is the Anthropic Messages API error body.
+type ClaudeErrorResponse struct {
+	Type  string            `json:"type"`
+	Error ClaudeErrorDetail `json:"error"`
+}
+
+// ClaudeErrorDetail describes an Anthropic Messages API error.
+type ClaudeErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// GeminiErrorResponse is the Google API error body.
+type GeminiErrorResponse struct {
+	Error GeminiErrorDetail `json:"error"`
+}
+
+// GeminiErrorDetail describes a Google API error.
+type GeminiErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// upstreamError is an error body reduced to the fields every dialect carries.
+type upstreamError struct {
+	dialect string
+	message string
+	code    string
+}
+
+// errorDialect resolves the dialect for the request: an error-responses.routes entry
+// matching the path, then the inbound handler's dialect when translation is enabled,
+// otherwise passthrough.
+func (h *BaseAPIHandler) errorDialect(c *gin.Context) string {
+	if h == nil || h.Cfg == nil {
+		return ErrorDialectPassthrough
+	}
+	cfg := h.Cfg.ErrorResponses
+	if c != nil && c.Request != nil && len(cfg.Routes) > 0 {
+		path := c.Request.URL.Path
+		matched := ""
+		dialect := ""
+		for prefix, value := range cfg.Routes {
+			if strings.HasPrefix(path, prefix) && len(prefix) > len(matched) {
+				matched, dialect = prefix, strings.ToLower(strings.TrimSpace(value))
+			}
+		}
+		if matched != "" {
+			return dialect
+		}
+	}
+	if !cfg.Translate {
+		return ErrorDialectPassthrough
+	}
+	handlerType := ""
+	if c != nil {
+		handlerType = c.GetString(errorDialectContextKey)
+	}
+	return HandlerErrorDialect(handlerType)
+}
+
+// TranslatedErrorBody renders msg in the error dialect resolved for the request. It
+// returns false when the dialect is passthrough and the caller should keep its own body.
+func (h *BaseAPIHandler) TranslatedErrorBody(c *gin.Context, msg *interfaces.ErrorMessage) ([]byte, bool) {
+	dialect := h.errorDialect(c)
+	if dialect == ErrorDialectPassthrough {
+		return nil, false
+	}
+	status := http.StatusInternalServerError
+	text := ""
+	if msg != nil {
+		if msg.StatusCode > 0 {
+			status = msg.StatusCode
+		}
+		if msg.Error != nil {
+			text = msg.Error.Error()
+		}
+	}
+	return TranslateErrorBody(dialect, status, text), true
+}
+
+// HandlerErrorDialect maps a handler type to the error dialect its clients expect.
+func HandlerErrorDialect(handlerType string) string {
+	switch handlerType {
+	case constant.Claude:
+		return ErrorDialectClaude
+	case constant.Gemini, constant.GeminiCLI:
+		return ErrorDialectGemini
+	default:
+		return ErrorDialectOpenAI
+	}
+}
+
+// TranslateErrorBody renders an error with the given status in the schema of dialect.
+// text is the upstream error, either a JSON error body of any dialect or plain text.
+// Bodies already in the target dialect are returned unchanged.
+func TranslateErrorBody(dialect string, status int, text string) []byte {
+	parsed := parseUpstreamError(text)
+	if parsed.dialect != "" && parsed.dialect == dialect {
+		return []byte(strings.TrimSpace(text))
+	}
+	message := parsed.message
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	var payload any
+	switch dialect {
+	case ErrorDialectClaude:
+		payload = ClaudeErrorResponse{Type: "error", Error: ClaudeErrorDetail{Type: claudeErrorType(status), Message: message}}
+	case ErrorDialectGemini:
+		payload = GeminiErrorResponse{Error: GeminiErrorDetail{Code: status, Message: message, Status: geminiErrorStatus(status)}}
+	default:
+		payload = ErrorResponse{Error: ErrorDetail{Message: message, Type: openAIErrorType(status), Code: parsed.code}}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return []byte(`{"error":{"message":"internal error","type":"server_error"}}`)
+	}
+	return body
+}
+
+// parseUpstreamError detects the dialect of a JSON error body and extracts its
+// message and string code. Plain text becomes the message.
+func parseUpstreamError(text string) upstreamError {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || !json.Valid([]byte(trimmed)) {
+		return upstreamError{message: trimmed}
+	}
+	root := gjson.Parse(trimmed)
+	if root.IsArray() {
+		// Some Google endpoints wrap the error object in an array.
+		root = root.Get("0")
+	}
+	errObj := root.Get("error")
+	if !errObj.Exists() {
+		return upstreamError{message: trimmed}
+	}
+	if !errObj.IsObject() {
+		return upstreamError{message: errObj.String()}
+	}
+	out := upstreamError{message: errObj.Get("message").String()}
+	switch {
+	case root.Get("type").String() == "error":
+		out.dialect = ErrorDialectClaude
+	case errObj.Get("status").Type == gjson.String:
+		out.dialect = ErrorDialectGemini
+	default:
+		out.dialect = ErrorDialectOpenAI
+		if code := errObj.Get("code"); code.Type == gjson.String {
+			out.code = code.String()
+		}
+	}
+	if out.message == "" {
+		out.message = trimmed
+	}
+	return out
+}
+
+func openAIErrorType(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	default:
+		if status >= http.StatusInternalServerError {
+			return "server_error"
+		}
+		return "invalid_request_error"
+	}
+}
+
+func claudeErrorType(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		if status >= http.StatusInternalServerError {
+			return "api_error"
+		}
+		return "invalid_request_error"
+	}
+}
+
+func geminiErrorStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusConflict:
+		return "ABORTED"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case 499:
+		return "CANCELLED"
+	case http.StatusNotImplemented:
+		return "UNIMPLEMENTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		if status >= http.StatusInternalServerError {
+			return "INTERNAL"
+		}
+		return "INVALID_ARGUMENT"
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/interfaces"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/config"
+	"github.com/tidwall/gjson"
+)
+
+func TestTranslateErrorBody(t *testing.T) {
+	openAIBody := `{"error":{"message":"slow down","type":"rate_limit_error","code":"rate_limit_exceeded"}}`
+	claudeBody := `{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`
+	geminiBody := `[{"error":{"code":429,"message":"quota","status":"RESOURCE_EXHAUSTED"}}]`
+
+	got := TranslateErrorBody(ErrorDialectClaude, http.StatusTooManyRequests, openAIBody)
+	if gjson.GetBytes(got, "type").String() != "error" || gjson.GetBytes(got, "error.type").String() != "rate_limit_error" || gjson.GetBytes(got, "error.message").String() != "slow down" {
+		t.Fatalf("unexpected claude body %s", got)
+	}
+	got = TranslateErrorBody(ErrorDialectGemini, 529, claudeBody)
+	if gjson.GetBytes(got, "error.code").Int() != 529 || gjson.GetBytes(got, "error.status").String() != "INTERNAL" || gjson.GetBytes(got, "error.message").String() != "busy" {
+		t.Fatalf("unexpected gemini body %s", got)
+	}
+	got = TranslateErrorBody(ErrorDialectOpenAI, http.StatusTooManyRequests, geminiBody)
+	if gjson.GetBytes(got, "error.type").String() != "rate_limit_error" || gjson.GetBytes(got, "error.message").String() != "quota" {
+		t.Fatalf("unexpected openai body %s", got)
+	}
+	if got = TranslateErrorBody(ErrorDialectOpenAI, http.StatusTooManyRequests, openAIBody); string(got) != openAIBody {
+		t.Fatalf("expected body in the target dialect to pass through, got %s", got)
+	}
+	got = TranslateErrorBody(ErrorDialectClaude, http.StatusServiceUnavailable, "upstream unavailable")
+	if gjson.GetBytes(got, "error.type").String() != "overloaded_error" || gjson.GetBytes(got, "error.message").String() != "upstream unavailable" {
+		t.Fatalf("unexpected claude body for plain text %s", got)
+	}
+}
+
+func TestWriteErrorResponseUsesRouteDialect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &BaseAPIHandler{Cfg: &config.SDKConfig{ErrorResponses: config.ErrorResponsesConfig{
+		Translate: true,
+		Routes:    map[string]string{"/v1/legacy": "passthrough"},
+	}}}
+	upstream := `{"error":{"code":400,"message":"bad field","status":"INVALID_ARGUMENT"}}`
+	msg := &interfaces.ErrorMessage{StatusCode: http.StatusBadRequest, Error: errors.New(upstream)}
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	c.Set(errorDialectContextKey, "claude")
+	h.WriteErrorResponse(c, msg)
+	if rec.Code != http.StatusBadRequest || gjson.Get(rec.Body.String(), "error.type").String() != "invalid_request_error" || gjson.Get(rec.Body.String(), "type").String() != "error" {
+		t.Fatalf("expected claude error, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/legacy/chat", nil)
+	c.Set(errorDialectContextKey, "claude")
+	h.WriteErrorResponse(c, msg)
+	if rec.Body.String() != upstream {
+		t.Fatalf("expected passthrough body, got %s", rec.Body.String())
+	}
+}
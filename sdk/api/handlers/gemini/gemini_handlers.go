@@ -49,12 +49,12 @@ func (h *GeminiAPIHandler) Models() []map[string]any {
 // GeminiModels handles the Gemini models listing endpoint.
 // It returns a JSON response containing available Gemini models and their specifications.
 func (h *GeminiAPIHandler) GeminiModels(c *gin.Context) {
-	rawModels := h.Models()
-	normalizedModels := make([]map[string]any, 0, len(rawModels))
+	listed := h.ListModels(c, h.HandlerType())
+	normalizedModels := make([]map[string]any, 0, len(listed))
 	defaultMethods := []string{"generateContent"}
-	for _, model := range rawModels {
-		normalizedModel := make(map[string]any, len(model))
-		for k, v := range model {
+	for _, model := range listed {
+		normalizedModel := make(map[string]any, len(model.Info))
+		for k, v := range model.Info {
 			normalizedModel[k] = v
 		}
 		if name, ok := normalizedModel["name"].(string); ok && name != "" && !strings.HasPrefix(name, "models/") {
@@ -203,7 +203,11 @@ func (h *GeminiAPIHandler) GeminiHandler(c *gin.Context) {
 	}
 
 	method := action[1]
-	rawJSON, _ := c.GetRawData()
+	rawJSON, err := c.GetRawData()
+	if err != nil {
+		handlers.WriteBodyReadError(c, err)
+		return
+	}
 
 	switch method {
 	case "generateContent":
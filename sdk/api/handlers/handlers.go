@@ -6,18 +6,32 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/bodylimit"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/classify"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/interfaces"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/modelrewrite"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/policy"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/providerspend"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/reasoningbudget"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/replay"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/requesttransform"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/workspace"
 	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
 	coreexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/streaming"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
 	"github.com/router-for-me/CLIProxyAPI/v6/sdk/config"
 	sdktranslator "github.com/router-for-me/CLIProxyAPI/v6/sdk/translator"
+	"github.com/tidwall/gjson"
 	"golang.org/x/net/context"
 )
 
@@ -41,6 +55,28 @@ type ErrorDetail struct {
 	Code string `json:"code,omitempty"`
 }
 
+// WriteBodyReadError answers a request whose body could not be read. Bodies cut off
+// by the configured size limit get 413; any other read failure is a 400.
+func WriteBodyReadError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+			Error: ErrorDetail{
+				Message: fmt.Sprintf("request body exceeds the %d byte limit", tooLarge.Limit),
+				Type:    "invalid_request_error",
+				Code:    bodylimit.RejectionTooLarge,
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Error: ErrorDetail{
+			Message: fmt.Sprintf("Invalid request: %v", err),
+			Type:    "invalid_request_error",
+		},
+	})
+}
+
 // BaseAPIHandler contains the handlers for API endpoints.
 // It holds a pool of clients to interact with the backend service and manages
 // load balancing, client selection, and configuration.
@@ -113,6 +149,9 @@ func (h *BaseAPIHandler) GetContextWithCancel(handler interfaces.APIHandler, c *
 	newCtx, cancel := context.WithCancel(ctx)
 	newCtx = context.WithValue(newCtx, "gin", c)
 	newCtx = context.WithValue(newCtx, "handler", handler)
+	if handler != nil {
+		c.Set(errorDialectContextKey, handler.HandlerType())
+	}
 	return newCtx, func(params ...interface{}) {
 		if h.Cfg.RequestLog && len(params) == 1 {
 			if existing, exists := c.Get("API_RESPONSE"); exists {
@@ -179,7 +218,31 @@ func appendAPIResponse(c *gin.Context, data []byte) {
 // ExecuteWithAuthManager executes a non-streaming request via the core auth manager.
 // This path is the only supported execution route.
 func (h *BaseAPIHandler) ExecuteWithAuthManager(ctx context.Context, handlerType, modelName string, rawJSON []byte, alt string) ([]byte, *interfaces.ErrorMessage) {
+	modelName = modelrewrite.Apply(ctx, modelName)
+	rawJSON = requesttransform.Apply(ctx, handlerType, modelName, rawJSON)
 	providers, normalizedModel, metadata, errMsg := h.getRequestDetails(modelName)
+	metadata = withRequestTags(ctx, metadata)
+	metadata = withWorkspace(ctx, metadata)
+	metadata = withReplayPin(ctx, metadata)
+	metadata = withPriority(ctx, metadata)
+	metadata = withConversation(ctx, rawJSON, metadata)
+	ctx, inputs := withInputStats(ctx, handlerType, rawJSON)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	providers, errMsg = applyKeyPolicy(ctx, modelName, normalizedModel, providers)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	errMsg = applyMediaLimits(ctx, normalizedModel, inputs)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	providers, errMsg = applyProviderSpendCaps(ctx, normalizedModel, providers)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	rawJSON, errMsg = applyReasoningBudget(ctx, handlerType, modelName, normalizedModel, rawJSON, metadata)
 	if errMsg != nil {
 		return nil, errMsg
 	}
@@ -199,6 +262,7 @@ func (h *BaseAPIHandler) ExecuteWithAuthManager(ctx context.Context, handlerType
 	if cloned := cloneMetadata(metadata); cloned != nil {
 		opts.Metadata = cloned
 	}
+	run := h.startShadow(ctx, handlerType, normalizedModel, rawJSON, alt, false)
 	resp, err := h.AuthManager.Execute(ctx, providers, req, opts)
 	if err != nil {
 		status := http.StatusInternalServerError
@@ -213,8 +277,11 @@ func (h *BaseAPIHandler) ExecuteWithAuthManager(ctx context.Context, handlerType
 				addon = hdr.Clone()
 			}
 		}
+		run.finish(status, err)
 		return nil, &interfaces.ErrorMessage{StatusCode: status, Error: err, Addon: addon}
 	}
+	run.observe(resp.Payload)
+	run.finish(http.StatusOK, nil)
 	cloned := cloneBytes(resp.Payload)
 	h.applyUpstreamHeaders(ctx, resp.Headers, len(cloned))
 	return cloned, nil
@@ -223,7 +290,17 @@ func (h *BaseAPIHandler) ExecuteWithAuthManager(ctx context.Context, handlerType
 // ExecuteCountWithAuthManager executes a non-streaming request via the core auth manager.
 // This path is the only supported execution route.
 func (h *BaseAPIHandler) ExecuteCountWithAuthManager(ctx context.Context, handlerType, modelName string, rawJSON []byte, alt string) ([]byte, *interfaces.ErrorMessage) {
+	modelName = modelrewrite.Apply(ctx, modelName)
+	rawJSON = requesttransform.Apply(ctx, handlerType, modelName, rawJSON)
 	providers, normalizedModel, metadata, errMsg := h.getRequestDetails(modelName)
+	metadata = withRequestTags(ctx, metadata)
+	metadata = withWorkspace(ctx, metadata)
+	metadata = withReplayPin(ctx, metadata)
+	metadata = withPriority(ctx, metadata)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	providers, errMsg = applyKeyPolicy(ctx, modelName, normalizedModel, providers)
 	if errMsg != nil {
 		return nil, errMsg
 	}
@@ -264,10 +341,132 @@ func (h *BaseAPIHandler) ExecuteCountWithAuthManager(ctx context.Context, handle
 	return cloned, nil
 }
 
+// ExecuteEmbeddingsWithAuthManager executes an OpenAI-format embeddings request via the
+// core auth manager, routed to the providers that serve modelName.
+func (h *BaseAPIHandler) ExecuteEmbeddingsWithAuthManager(ctx context.Context, handlerType, modelName string, rawJSON []byte) ([]byte, *interfaces.ErrorMessage) {
+	modelName = modelrewrite.Apply(ctx, modelName)
+	rawJSON = requesttransform.Apply(ctx, handlerType, modelName, rawJSON)
+	providers, normalizedModel, metadata, errMsg := h.getRequestDetails(modelName)
+	metadata = withRequestTags(ctx, metadata)
+	metadata = withWorkspace(ctx, metadata)
+	metadata = withReplayPin(ctx, metadata)
+	metadata = withPriority(ctx, metadata)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	providers, errMsg = applyKeyPolicy(ctx, modelName, normalizedModel, providers)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	providers, errMsg = applyProviderSpendCaps(ctx, normalizedModel, providers)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	req := coreexecutor.Request{
+		Model:   normalizedModel,
+		Payload: cloneBytes(rawJSON),
+	}
+	if cloned := cloneMetadata(metadata); cloned != nil {
+		req.Metadata = cloned
+	}
+	opts := coreexecutor.Options{
+		Stream:          false,
+		OriginalRequest: cloneBytes(rawJSON),
+		SourceFormat:    sdktranslator.FromString(handlerType),
+	}
+	if cloned := cloneMetadata(metadata); cloned != nil {
+		opts.Metadata = cloned
+	}
+	resp, err := h.AuthManager.ExecuteEmbeddings(ctx, providers, req, opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if se, ok := err.(interface{ StatusCode() int }); ok && se != nil {
+			if code := se.StatusCode(); code > 0 {
+				status = code
+			}
+		}
+		var addon http.Header
+		if he, ok := err.(interface{ Headers() http.Header }); ok && he != nil {
+			if hdr := he.Headers(); hdr != nil {
+				addon = hdr.Clone()
+			}
+		}
+		return nil, &interfaces.ErrorMessage{StatusCode: status, Error: err, Addon: addon}
+	}
+	cloned := cloneBytes(resp.Payload)
+	h.applyUpstreamHeaders(ctx, resp.Headers, len(cloned))
+	return cloned, nil
+}
+
+// DialRealtimeWithAuthManager opens an upstream realtime WebSocket session for modelName
+// via the core auth manager. The caller must close the returned session.
+func (h *BaseAPIHandler) DialRealtimeWithAuthManager(ctx context.Context, handlerType, modelName string, headers http.Header) (*coreauth.RealtimeSession, *interfaces.ErrorMessage) {
+	modelName = modelrewrite.Apply(ctx, modelName)
+	providers, normalizedModel, metadata, errMsg := h.getRequestDetails(modelName)
+	metadata = withRequestTags(ctx, metadata)
+	metadata = withWorkspace(ctx, metadata)
+	metadata = withReplayPin(ctx, metadata)
+	metadata = withPriority(ctx, metadata)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	providers, errMsg = applyKeyPolicy(ctx, modelName, normalizedModel, providers)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	providers, errMsg = applyProviderSpendCaps(ctx, normalizedModel, providers)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	req := coreexecutor.Request{Model: normalizedModel}
+	if cloned := cloneMetadata(metadata); cloned != nil {
+		req.Metadata = cloned
+	}
+	opts := coreexecutor.Options{
+		Stream:       true,
+		SourceFormat: sdktranslator.FromString(handlerType),
+		Headers:      headers.Clone(),
+	}
+	if cloned := cloneMetadata(metadata); cloned != nil {
+		opts.Metadata = cloned
+	}
+	session, err := h.AuthManager.DialRealtime(ctx, providers, req, opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if se, ok := err.(interface{ StatusCode() int }); ok && se != nil {
+			if code := se.StatusCode(); code > 0 {
+				status = code
+			}
+		}
+		return nil, &interfaces.ErrorMessage{StatusCode: status, Error: err}
+	}
+	return session, nil
+}
+
 // ExecuteStreamWithAuthManager executes a streaming request via the core auth manager.
 // This path is the only supported execution route.
 func (h *BaseAPIHandler) ExecuteStreamWithAuthManager(ctx context.Context, handlerType, modelName string, rawJSON []byte, alt string) (<-chan []byte, <-chan *interfaces.ErrorMessage) {
+	modelName = modelrewrite.Apply(ctx, modelName)
+	rawJSON = requesttransform.Apply(ctx, handlerType, modelName, rawJSON)
 	providers, normalizedModel, metadata, errMsg := h.getRequestDetails(modelName)
+	metadata = withRequestTags(ctx, metadata)
+	metadata = withWorkspace(ctx, metadata)
+	metadata = withReplayPin(ctx, metadata)
+	metadata = withPriority(ctx, metadata)
+	metadata = withConversation(ctx, rawJSON, metadata)
+	ctx, inputs := withInputStats(ctx, handlerType, rawJSON)
+	if errMsg == nil {
+		providers, errMsg = applyKeyPolicy(ctx, modelName, normalizedModel, providers)
+	}
+	if errMsg == nil {
+		errMsg = applyMediaLimits(ctx, normalizedModel, inputs)
+	}
+	if errMsg == nil {
+		providers, errMsg = applyProviderSpendCaps(ctx, normalizedModel, providers)
+	}
+	if errMsg == nil {
+		rawJSON, errMsg = applyReasoningBudget(ctx, handlerType, modelName, normalizedModel, rawJSON, metadata)
+	}
 	if errMsg != nil {
 		errChan := make(chan *interfaces.ErrorMessage, 1)
 		errChan <- errMsg
@@ -290,6 +489,7 @@ func (h *BaseAPIHandler) ExecuteStreamWithAuthManager(ctx context.Context, handl
 	if cloned := cloneMetadata(metadata); cloned != nil {
 		opts.Metadata = cloned
 	}
+	run := h.startShadow(ctx, handlerType, normalizedModel, rawJSON, alt, true)
 	chunks, err := h.AuthManager.ExecuteStream(ctx, providers, req, opts)
 	if err != nil {
 		errChan := make(chan *interfaces.ErrorMessage, 1)
@@ -305,15 +505,35 @@ func (h *BaseAPIHandler) ExecuteStreamWithAuthManager(ctx context.Context, handl
 				addon = hdr.Clone()
 			}
 		}
+		run.finish(status, err)
 		errChan <- &interfaces.ErrorMessage{StatusCode: status, Error: err, Addon: addon}
 		close(errChan)
 		return nil, errChan
 	}
+	chain := streaming.DefaultManager().Open(ctx, streaming.Info{
+		Format:         handlerType,
+		Model:          normalizedModel,
+		RequestedModel: modelrewrite.RequestedModelFromContext(ctx),
+		APIKey:         policy.APIKeyFromContext(ctx),
+	})
 	dataChan := make(chan []byte)
 	errChan := make(chan *interfaces.ErrorMessage, 1)
 	go func() {
 		defer close(dataChan)
 		defer close(errChan)
+		defer run.finish(http.StatusOK, nil)
+		// send stops delivering once the handler cancelled ctx, typically because the
+		// client disconnected. The rest of the stream is drained so the executor sees
+		// the cancellation and records the aborted request instead of blocking.
+		send := func(payload []byte) bool {
+			select {
+			case dataChan <- payload:
+				return true
+			case <-ctx.Done():
+				go drainStreamChunks(chunks)
+				return false
+			}
+		}
 		headersApplied := false
 		for chunk := range chunks {
 			if !headersApplied && len(chunk.Headers) > 0 {
@@ -333,17 +553,50 @@ func (h *BaseAPIHandler) ExecuteStreamWithAuthManager(ctx context.Context, handl
 						addon = hdr.Clone()
 					}
 				}
+				run.finish(status, chunk.Err)
 				errChan <- &interfaces.ErrorMessage{StatusCode: status, Error: chunk.Err, Addon: addon}
 				return
 			}
-			if len(chunk.Payload) > 0 {
-				dataChan <- cloneBytes(chunk.Payload)
+			if len(chunk.Payload) == 0 {
+				continue
+			}
+			run.observe(chunk.Payload)
+			if chain == nil {
+				if !send(cloneBytes(chunk.Payload)) {
+					return
+				}
+				continue
+			}
+			out, stop, errTransform := chain.Transform(cloneBytes(chunk.Payload))
+			if errTransform != nil {
+				go drainStreamChunks(chunks)
+				errChan <- &interfaces.ErrorMessage{StatusCode: http.StatusInternalServerError, Error: errTransform}
+				return
+			}
+			if out != nil && !send(out) {
+				return
+			}
+			if stop {
+				// A stream plugin ended the response; the client context is cancelled
+				// once the handler sees dataChan close, which stops the executor.
+				go drainStreamChunks(chunks)
+				break
+			}
+		}
+		for _, tail := range chain.Flush() {
+			if !send(tail) {
+				return
 			}
 		}
 	}()
 	return dataChan, errChan
 }
 
+func drainStreamChunks(chunks <-chan coreexecutor.StreamChunk) {
+	for range chunks {
+	}
+}
+
 func cloneHeader(src http.Header) http.Header {
 	if len(src) == 0 {
 		return nil
@@ -407,6 +660,188 @@ func normalizeModelMetadata(modelName string) (string, map[string]any) {
 	return util.NormalizeThinkingModel(modelName)
 }
 
+// withRequestTags adds the classification tags of the inbound request to the
+// execution metadata so custom selectors and executors can route on them.
+func withRequestTags(ctx context.Context, metadata map[string]any) map[string]any {
+	tags := classify.TagsFromContext(ctx)
+	if len(tags) == 0 {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]any, 1)
+	}
+	metadata[classify.MetadataKey] = append([]string(nil), tags...)
+	return metadata
+}
+
+// applyKeyPolicy enforces the client API key's model/provider policy, narrowing
+// providers to the permitted ones. Denials are recorded as policy_denied usage.
+func applyKeyPolicy(ctx context.Context, requestedModel, normalizedModel string, providers []string) ([]string, *interfaces.ErrorMessage) {
+	set := policy.Active()
+	if set == nil {
+		return providers, nil
+	}
+	apiKey := policy.APIKeyFromContext(ctx)
+	allowed, err := set.Evaluate(apiKey, []string{requestedModel, normalizedModel}, providers)
+	if err == nil {
+		return allowed, nil
+	}
+	coreusage.PublishRecord(ctx, coreusage.Record{
+		Model:          normalizedModel,
+		RequestedModel: modelrewrite.RequestedModelFromContext(ctx),
+		APIKey:         apiKey,
+		RequestedAt:    time.Now(),
+		Failed:         true,
+		PolicyDenied:   true,
+		Tags:           classify.TagsFromContext(ctx),
+	})
+	return nil, &interfaces.ErrorMessage{StatusCode: http.StatusForbidden, Error: err}
+}
+
+// applyMediaLimits enforces the inline media size limits of the client API key.
+// Rejections are recorded as media_too_large usage.
+func applyMediaLimits(ctx context.Context, normalizedModel string, inputs coreusage.InputStats) *interfaces.ErrorMessage {
+	apiKey := policy.APIKeyFromContext(ctx)
+	err := bodylimit.Active().ForMedia(apiKey).CheckMedia(inputs.LargestMediaBytes, inputs.MediaBytes)
+	if err == nil {
+		return nil
+	}
+	coreusage.PublishRecord(ctx, coreusage.Record{
+		Model:          normalizedModel,
+		RequestedModel: modelrewrite.RequestedModelFromContext(ctx),
+		APIKey:         apiKey,
+		RequestedAt:    time.Now(),
+		Failed:         true,
+		Rejection:      bodylimit.RejectionMediaTooLarge,
+		Tags:           classify.TagsFromContext(ctx),
+		Detail:         coreusage.Detail{ImageInputs: inputs.ImageInputs, DocumentInputs: inputs.DocumentInputs, MediaBytes: inputs.MediaBytes},
+	})
+	return &interfaces.ErrorMessage{StatusCode: http.StatusRequestEntityTooLarge, Error: err}
+}
+
+// applyProviderSpendCaps drops providers past their monthly spend cap, so the
+// request falls back to the model's other providers. Rejections are recorded as
+// provider_spend_cap_exceeded usage.
+func applyProviderSpendCaps(ctx context.Context, normalizedModel string, providers []string) ([]string, *interfaces.ErrorMessage) {
+	now := time.Now()
+	allowed, err := providerspend.Filter(providers, normalizedModel, now)
+	if err == nil {
+		return allowed, nil
+	}
+	provider := ""
+	var exceeded *providerspend.ExceededError
+	if errors.As(err, &exceeded) && len(exceeded.Providers) > 0 {
+		provider = exceeded.Providers[0].Provider
+	}
+	coreusage.PublishRecord(ctx, coreusage.Record{
+		Provider:       provider,
+		Model:          normalizedModel,
+		RequestedModel: modelrewrite.RequestedModelFromContext(ctx),
+		APIKey:         policy.APIKeyFromContext(ctx),
+		RequestedAt:    now,
+		Failed:         true,
+		Rejection:      providerspend.Rejection,
+		Tags:           classify.TagsFromContext(ctx),
+	})
+	return nil, &interfaces.ErrorMessage{StatusCode: http.StatusTooManyRequests, Error: err}
+}
+
+// applyReasoningBudget caps the reasoning budget of the request for the client API
+// key and model. Rejections are recorded as reasoning_budget_exceeded usage.
+func applyReasoningBudget(ctx context.Context, handlerType, requestedModel, normalizedModel string, rawJSON []byte, metadata map[string]any) ([]byte, *interfaces.ErrorMessage) {
+	out, err := reasoningbudget.Apply(ctx, handlerType, requestedModel, normalizedModel, rawJSON, metadata)
+	if err == nil {
+		return out, nil
+	}
+	coreusage.PublishRecord(ctx, coreusage.Record{
+		Model:          normalizedModel,
+		RequestedModel: modelrewrite.RequestedModelFromContext(ctx),
+		APIKey:         policy.APIKeyFromContext(ctx),
+		RequestedAt:    time.Now(),
+		Failed:         true,
+		Rejection:      reasoningbudget.Rejection,
+		Tags:           classify.TagsFromContext(ctx),
+	})
+	return nil, &interfaces.ErrorMessage{StatusCode: http.StatusBadRequest, Error: err}
+}
+
+func withWorkspace(ctx context.Context, metadata map[string]any) map[string]any {
+	name := workspace.FromContext(ctx)
+	if name == "" {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]any, 1)
+	}
+	metadata[coreauth.WorkspaceMetadataKey] = name
+	return metadata
+}
+
+// withPriority tags the request with the scheduling class of the caller's API key
+// so the auth manager can order it in credential slot queues.
+func withPriority(ctx context.Context, metadata map[string]any) map[string]any {
+	priority := policy.Active().Priority(policy.APIKeyFromContext(ctx))
+	if priority == "" {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]any, 1)
+	}
+	metadata[coreauth.PriorityMetadataKey] = priority
+	return metadata
+}
+
+func withReplayPin(ctx context.Context, metadata map[string]any) map[string]any {
+	opts, ok := replay.FromContext(ctx)
+	if !ok || strings.TrimSpace(opts.AuthID) == "" {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]any, 1)
+	}
+	metadata[coreauth.PinnedAuthMetadataKey] = strings.TrimSpace(opts.AuthID)
+	return metadata
+}
+
+// conversationHeaders and conversationFields name where clients carry a conversation
+// identifier, in order of preference.
+var (
+	conversationHeaders = []string{"X-Conversation-Id", "X-Session-Id"}
+	conversationFields  = []string{"conversation_id", "metadata.conversation_id", "prompt_cache_key"}
+)
+
+// withConversation records the request's conversation ID for session affinity and
+// exposes it on the gin context for usage export.
+func withConversation(ctx context.Context, rawJSON []byte, metadata map[string]any) map[string]any {
+	ginCtx, _ := ctx.Value("gin").(*gin.Context)
+	conversation := ""
+	if ginCtx != nil && ginCtx.Request != nil {
+		for _, header := range conversationHeaders {
+			if conversation = strings.TrimSpace(ginCtx.GetHeader(header)); conversation != "" {
+				break
+			}
+		}
+	}
+	if conversation == "" && len(rawJSON) > 0 {
+		for _, field := range conversationFields {
+			if conversation = strings.TrimSpace(gjson.GetBytes(rawJSON, field).String()); conversation != "" {
+				break
+			}
+		}
+	}
+	if conversation == "" {
+		return metadata
+	}
+	if ginCtx != nil {
+		ginCtx.Set("conversation_id", conversation)
+	}
+	if metadata == nil {
+		metadata = make(map[string]any, 1)
+	}
+	metadata[coreauth.ConversationMetadataKey] = conversation
+	return metadata
+}
+
 func cloneMetadata(src map[string]any) map[string]any {
 	if len(src) == 0 {
 		return nil
@@ -484,23 +919,10 @@ func (h *BaseAPIHandler) WriteErrorResponse(c *gin.Context, msg *interfaces.Erro
 		if trimmed != "" && json.Valid([]byte(trimmed)) {
 			return []byte(trimmed)
 		}
-		errType := "invalid_request_error"
-		switch status {
-		case http.StatusUnauthorized:
-			errType = "authentication_error"
-		case http.StatusForbidden:
-			errType = "permission_error"
-		case http.StatusTooManyRequests:
-			errType = "rate_limit_error"
-		default:
-			if status >= http.StatusInternalServerError {
-				errType = "server_error"
-			}
-		}
 		payload, err := json.Marshal(ErrorResponse{
 			Error: ErrorDetail{
 				Message: errText,
-				Type:    errType,
+				Type:    openAIErrorType(status),
 			},
 		})
 		if err != nil {
@@ -509,7 +931,10 @@ func (h *BaseAPIHandler) WriteErrorResponse(c *gin.Context, msg *interfaces.Erro
 		return payload
 	}
 
-	body := buildJSONBody()
+	body, translated := h.TranslatedErrorBody(c, msg)
+	if !translated {
+		body = buildJSONBody()
+	}
 	c.Set("API_RESPONSE", bytes.Clone(body))
 
 	if !c.Writer.Written() {
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/modelcache"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/modelrewrite"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/policy"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
+)
+
+// ListedModel is one entry of a model listing as seen by the calling client key.
+type ListedModel struct {
+	// ID is the name clients use to request the model.
+	ID string
+	// Info is the registry entry rendered for the handler type; for aliases it is the
+	// target's entry with the alias name substituted.
+	Info map[string]any
+	// Providers lists the providers the key may be served by.
+	Providers []string
+	// Status is the registry health: available, cooling_down or unavailable.
+	Status string
+	// AliasOf names the model an alias from model-rewrites resolves to.
+	AliasOf string
+}
+
+// ListModels merges the models of every configured provider for handlerType into one
+// listing for the calling client key: models its API key policy denies are dropped,
+// providers are narrowed to the permitted ones, model-rewrites aliases are added next
+// to their targets and each entry carries the registry health. Entries are sorted by ID.
+//
+// With models-list.cache enabled the listing is reused per handler type and key for the
+// configured TTL and the response carries a matching Cache-Control header.
+func (h *BaseAPIHandler) ListModels(c *gin.Context, handlerType string) []ListedModel {
+	apiKey := c.GetString("apiKey")
+	var cachePolicy modelcache.Policy
+	if h.Cfg != nil {
+		cachePolicy = modelcache.PolicyFromSeconds(h.Cfg.ModelsList.Cache.For(""))
+	}
+	if !cachePolicy.Enabled() {
+		return h.listModels(handlerType, apiKey)
+	}
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d, stale-while-revalidate=%d",
+		int(cachePolicy.TTL.Seconds()), int(cachePolicy.Stale.Seconds())))
+	listed, _ := modelListings.Get(c.Request.Context(), handlerType+"\x00"+apiKey, cachePolicy, func(context.Context) ([]ListedModel, error) {
+		return h.listModels(handlerType, apiKey), nil
+	})
+	return listed
+}
+
+// modelListings caches ListModels results by handler type and client key.
+var modelListings = modelcache.New[[]ListedModel]()
+
+func (h *BaseAPIHandler) listModels(handlerType, apiKey string) []ListedModel {
+	modelRegistry := registry.GetGlobalRegistry()
+	includeSuspended := h.Cfg != nil && h.Cfg.ModelsList.IncludeSuspended
+	policies := policy.Active()
+
+	listed := make([]ListedModel, 0)
+	byID := make(map[string]int)
+	for _, info := range modelRegistry.GetModelsForListing(handlerType, includeSuspended) {
+		id := listedModelID(info)
+		if id == "" {
+			continue
+		}
+		if _, dup := byID[id]; dup {
+			continue
+		}
+		health, _ := modelRegistry.GetModelHealth(id)
+		providers, err := policies.Evaluate(apiKey, []string{id}, health.Providers)
+		if err != nil {
+			continue
+		}
+		byID[id] = len(listed)
+		listed = append(listed, ListedModel{ID: id, Info: info, Providers: providers, Status: health.Status()})
+	}
+
+	for _, alias := range modelrewrite.Active().Aliases(apiKey) {
+		if _, exists := byID[alias.From]; exists {
+			continue
+		}
+		idx, ok := byID[alias.To]
+		if !ok {
+			continue
+		}
+		target := listed[idx]
+		providers, err := policies.Evaluate(apiKey, []string{alias.From, alias.To}, target.Providers)
+		if err != nil {
+			continue
+		}
+		byID[alias.From] = len(listed)
+		listed = append(listed, ListedModel{
+			ID:        alias.From,
+			Info:      renameListedModel(target.Info, alias.From),
+			Providers: providers,
+			Status:    target.Status,
+			AliasOf:   alias.To,
+		})
+	}
+
+	sort.Slice(listed, func(i, j int) bool { return listed[i].ID < listed[j].ID })
+	return listed
+}
+
+// listedModelID returns the model name of a rendered registry entry. Gemini entries
+// carry it in "name", optionally prefixed with "models/".
+func listedModelID(info map[string]any) string {
+	if id, ok := info["id"].(string); ok && id != "" {
+		return id
+	}
+	name, _ := info["name"].(string)
+	return strings.TrimPrefix(name, "models/")
+}
+
+func renameListedModel(info map[string]any, id string) map[string]any {
+	out := maps.Clone(info)
+	if _, ok := out["id"]; ok {
+		out["id"] = id
+	}
+	if name, ok := out["name"].(string); ok {
+		if strings.HasPrefix(name, "models/") {
+			out["name"] = "models/" + id
+		} else {
+			out["name"] = id
+		}
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/modelrewrite"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/policy"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
+	sdkconfig "github.com/router-for-me/CLIProxyAPI/v6/sdk/config"
+)
+
+func TestListModelsAppliesPolicyAliasesAndHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := registry.GetGlobalRegistry()
+	reg.RegisterClient("list-models-a", "list-provider-a", []*registry.ModelInfo{{ID: "list-model-open"}, {ID: "list-model-denied"}})
+	reg.RegisterClient("list-models-b", "list-provider-b", []*registry.ModelInfo{{ID: "list-model-open"}})
+	t.Cleanup(func() {
+		reg.UnregisterClient("list-models-a")
+		reg.UnregisterClient("list-models-b")
+	})
+	reg.SetModelQuotaExceeded("list-models-a", "list-model-denied")
+
+	policy.SetPolicies([]config.APIKeyPolicy{{APIKey: "list-key", DeniedProviders: []string{"list-provider-b"}}})
+	modelrewrite.SetRules([]config.ModelRewriteRule{{From: "list-alias", To: "list-model-denied"}})
+	t.Cleanup(func() {
+		policy.SetPolicies(nil)
+		modelrewrite.SetRules(nil)
+	})
+
+	h := &BaseAPIHandler{Cfg: &sdkconfig.SDKConfig{}}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("apiKey", "list-key")
+
+	byID := make(map[string]ListedModel)
+	for _, m := range h.ListModels(c, "openai") {
+		byID[m.ID] = m
+	}
+	open, ok := byID["list-model-open"]
+	if !ok || len(open.Providers) != 1 || open.Providers[0] != "list-provider-a" || open.Status != registry.ModelStatusAvailable {
+		t.Fatalf("unexpected entry for list-model-open: %+v", open)
+	}
+	cooling, ok := byID["list-model-denied"]
+	if !ok || cooling.Status != registry.ModelStatusCoolingDown {
+		t.Fatalf("expected list-model-denied to be cooling down, got %+v", cooling)
+	}
+	alias, ok := byID["list-alias"]
+	if !ok || alias.AliasOf != "list-model-denied" || alias.Info["id"] != "list-alias" {
+		t.Fatalf("expected list-alias to resolve to list-model-denied, got %+v", alias)
+	}
+
+	policy.SetPolicies([]config.APIKeyPolicy{{APIKey: "list-key", DeniedModels: []string{"list-model-denied"}}})
+	for _, m := range h.ListModels(c, "openai") {
+		if m.ID == "list-model-denied" || m.ID == "list-alias" {
+			t.Fatalf("denied model %q must not be listed", m.ID)
+		}
+	}
+}
@@ -56,30 +56,36 @@ func (h *OpenAIAPIHandler) Models() []map[string]any {
 }
 
 // OpenAIModels handles the /v1/models endpoint.
-// It returns a list of available AI models with their capabilities
-// and specifications in OpenAI-compatible format.
+// It returns the models of every configured provider that the caller's API key may
+// use, in OpenAI-compatible format. Besides id, object, created and owned_by, each
+// entry lists the providers that may serve it, its health status and, for
+// model-rewrites aliases, the model it resolves to.
 func (h *OpenAIAPIHandler) OpenAIModels(c *gin.Context) {
-	// Get all available models
-	allModels := h.Models()
+	listed := h.ListModels(c, h.HandlerType())
 
-	// Filter to only include the 4 required fields: id, object, created, owned_by
-	filteredModels := make([]map[string]any, len(allModels))
-	for i, model := range allModels {
+	filteredModels := make([]map[string]any, len(listed))
+	for i, model := range listed {
 		filteredModel := map[string]any{
-			"id":     model["id"],
-			"object": model["object"],
+			"id":        model.ID,
+			"object":    model.Info["object"],
+			"providers": model.Providers,
+			"status":    model.Status,
 		}
 
 		// Add created field if it exists
-		if created, exists := model["created"]; exists {
+		if created, exists := model.Info["created"]; exists {
 			filteredModel["created"] = created
 		}
 
 		// Add owned_by field if it exists
-		if ownedBy, exists := model["owned_by"]; exists {
+		if ownedBy, exists := model.Info["owned_by"]; exists {
 			filteredModel["owned_by"] = ownedBy
 		}
 
+		if model.AliasOf != "" {
+			filteredModel["alias_of"] = model.AliasOf
+		}
+
 		filteredModels[i] = filteredModel
 	}
 
@@ -97,14 +103,9 @@ func (h *OpenAIAPIHandler) OpenAIModels(c *gin.Context) {
 //   - c: The Gin context containing the HTTP request and response
 func (h *OpenAIAPIHandler) ChatCompletions(c *gin.Context) {
 	rawJSON, err := c.GetRawData()
-	// If data retrieval fails, return a 400 Bad Request error.
+	// If data retrieval fails, return a 400 (413 when the body exceeds the size limit).
 	if err != nil {
-		c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
-			Error: handlers.ErrorDetail{
-				Message: fmt.Sprintf("Invalid request: %v", err),
-				Type:    "invalid_request_error",
-			},
-		})
+		handlers.WriteBodyReadError(c, err)
 		return
 	}
 
@@ -127,14 +128,9 @@ func (h *OpenAIAPIHandler) ChatCompletions(c *gin.Context) {
 //   - c: The Gin context containing the HTTP request and response
 func (h *OpenAIAPIHandler) Completions(c *gin.Context) {
 	rawJSON, err := c.GetRawData()
-	// If data retrieval fails, return a 400 Bad Request error.
+	// If data retrieval fails, return a 400 (413 when the body exceeds the size limit).
 	if err != nil {
-		c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
-			Error: handlers.ErrorDetail{
-				Message: fmt.Sprintf("Invalid request: %v", err),
-				Type:    "invalid_request_error",
-			},
-		})
+		handlers.WriteBodyReadError(c, err)
 		return
 	}
 
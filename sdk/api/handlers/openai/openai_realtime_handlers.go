@@ -0,0 +1,110 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/api/handlers"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+// realtimeUpgrader accepts client connections for /v1/realtime. Origin checks are left
+// to the API key middleware in front of the handler.
+var realtimeUpgrader = websocket.Upgrader{
+	ReadBufferSize:  16 << 10,
+	WriteBufferSize: 16 << 10,
+	Subprotocols:    []string{"realtime"},
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// Realtime handles the /v1/realtime WebSocket endpoint.
+// The upstream session is opened before the client connection is upgraded, so credential
+// failover happens during the handshake and a failure is reported as a normal JSON error.
+// Once established, events are relayed unchanged in both directions until either side
+// closes the connection.
+//
+// Parameters:
+//   - c: The Gin context containing the HTTP request and response
+func (h *OpenAIAPIHandler) Realtime(c *gin.Context) {
+	modelName := strings.TrimSpace(c.Query("model"))
+	if modelName == "" {
+		c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
+			Error: handlers.ErrorDetail{
+				Message: "Invalid request: model query parameter is required",
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	cliCtx, cliCancel := h.GetContextWithCancel(h, c, context.Background())
+	session, errMsg := h.DialRealtimeWithAuthManager(cliCtx, h.HandlerType(), modelName, c.Request.Header)
+	if errMsg != nil {
+		h.WriteErrorResponse(c, errMsg)
+		cliCancel(errMsg.Error)
+		return
+	}
+	defer func() { _ = session.Close() }()
+
+	client, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Warnf("realtime: upgrade failed: %v", err)
+		cliCancel(err)
+		return
+	}
+	defer func() { _ = client.Close() }()
+
+	relayRealtime(client, session)
+	cliCancel()
+}
+
+// relayRealtime copies messages between the client and the upstream session until one
+// side closes, then forwards the close to the other side.
+func relayRealtime(client *websocket.Conn, session *coreauth.RealtimeSession) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			messageType, data, err := client.ReadMessage()
+			if err != nil {
+				_ = session.WriteMessage(websocket.CloseMessage, realtimeCloseMessage(err))
+				_ = session.Close()
+				return
+			}
+			if err = session.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		messageType, data, err := session.ReadMessage()
+		if err != nil {
+			_ = client.WriteControl(websocket.CloseMessage, realtimeCloseMessage(err), time.Now().Add(time.Second))
+			break
+		}
+		if err = client.WriteMessage(messageType, data); err != nil {
+			break
+		}
+	}
+	_ = client.Close()
+	_ = session.Close()
+	<-done
+}
+
+// realtimeCloseMessage builds the close frame forwarded after err ended one side of the relay.
+func realtimeCloseMessage(err error) []byte {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseNoStatusReceived && closeErr.Code != websocket.CloseAbnormalClosure {
+		return websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)
+	}
+	return websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+}
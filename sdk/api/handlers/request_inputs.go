@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/constant"
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+	"github.com/tidwall/gjson"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+var (
+	inputCodecOnce sync.Once
+	inputCodec     tokenizer.Codec
+)
+
+// withInputStats attaches the tool result and media statistics of the inbound request
+// to ctx so the usage record of the request carries them.
+func withInputStats(ctx context.Context, handlerType string, rawJSON []byte) (context.Context, coreusage.InputStats) {
+	stats := requestInputStats(handlerType, rawJSON)
+	return coreusage.WithInputStats(ctx, stats), stats
+}
+
+// requestInputStats counts the tool results (as estimated tokens), images and
+// documents in a request body of the given handler type, with the decoded size of
+// inline media. They are read from the whole conversation, as that is what the
+// upstream is billed for.
+func requestInputStats(handlerType string, rawJSON []byte) coreusage.InputStats {
+	var stats coreusage.InputStats
+	if len(rawJSON) == 0 || !gjson.ValidBytes(rawJSON) {
+		return stats
+	}
+	root := gjson.ParseBytes(rawJSON)
+	var toolResults []string
+	switch handlerType {
+	case constant.OpenAI:
+		root.Get("messages").ForEach(func(_, msg gjson.Result) bool {
+			if msg.Get("role").String() == "tool" {
+				toolResults = append(toolResults, contentText(msg.Get("content")))
+				return true
+			}
+			msg.Get("content").ForEach(func(_, part gjson.Result) bool {
+				switch part.Get("type").String() {
+				case "image_url":
+					addImage(&stats, dataURLSize(part.Get("image_url.url").String()))
+				case "file":
+					addDocument(&stats, fileDataSize(part.Get("file.file_data").String()))
+				}
+				return true
+			})
+			return true
+		})
+	case constant.OpenaiResponse:
+		root.Get("input").ForEach(func(_, item gjson.Result) bool {
+			if item.Get("type").String() == "function_call_output" {
+				toolResults = append(toolResults, contentText(item.Get("output")))
+				return true
+			}
+			item.Get("content").ForEach(func(_, part gjson.Result) bool {
+				switch part.Get("type").String() {
+				case "input_image":
+					addImage(&stats, dataURLSize(part.Get("image_url").String()))
+				case "input_file":
+					addDocument(&stats, fileDataSize(part.Get("file_data").String()))
+				}
+				return true
+			})
+			return true
+		})
+	case constant.Claude:
+		root.Get("messages").ForEach(func(_, msg gjson.Result) bool {
+			msg.Get("content").ForEach(func(_, block gjson.Result) bool {
+				switch block.Get("type").String() {
+				case "tool_result":
+					toolResults = append(toolResults, contentText(block.Get("content")))
+					block.Get("content").ForEach(func(_, inner gjson.Result) bool {
+						addClaudeMedia(&stats, inner)
+						return true
+					})
+				default:
+					addClaudeMedia(&stats, block)
+				}
+				return true
+			})
+			return true
+		})
+	case constant.Gemini, constant.GeminiCLI:
+		contents := root.Get("contents")
+		if handlerType == constant.GeminiCLI {
+			contents = root.Get("request.contents")
+		}
+		contents.ForEach(func(_, content gjson.Result) bool {
+			content.Get("parts").ForEach(func(_, part gjson.Result) bool {
+				if response := part.Get("functionResponse.response"); response.Exists() {
+					toolResults = append(toolResults, response.Raw)
+				}
+				for _, key := range []string{"inlineData", "inline_data", "fileData", "file_data"} {
+					media := part.Get(key)
+					if !media.Exists() {
+						continue
+					}
+					mimeType := media.Get("mimeType").String()
+					if mimeType == "" {
+						mimeType = media.Get("mime_type").String()
+					}
+					size := base64Size(media.Get("data").String())
+					switch {
+					case strings.HasPrefix(mimeType, "image/"):
+						addImage(&stats, size)
+					case strings.HasPrefix(mimeType, "audio/"), strings.HasPrefix(mimeType, "video/"):
+					default:
+						addDocument(&stats, size)
+					}
+				}
+				return true
+			})
+			return true
+		})
+	}
+	stats.ToolResultTokens = estimateTokens(toolResults)
+	return stats
+}
+
+// addClaudeMedia counts a Claude image or document content block.
+func addClaudeMedia(stats *coreusage.InputStats, block gjson.Result) {
+	size := int64(0)
+	if block.Get("source.type").String() == "base64" {
+		size = base64Size(block.Get("source.data").String())
+	}
+	switch block.Get("type").String() {
+	case "image":
+		addImage(stats, size)
+	case "document":
+		addDocument(stats, size)
+	}
+}
+
+func addImage(stats *coreusage.InputStats, size int64) {
+	stats.ImageInputs++
+	addMediaBytes(stats, size)
+}
+
+func addDocument(stats *coreusage.InputStats, size int64) {
+	stats.DocumentInputs++
+	addMediaBytes(stats, size)
+}
+
+func addMediaBytes(stats *coreusage.InputStats, size int64) {
+	stats.MediaBytes += size
+	stats.LargestMediaBytes = max(stats.LargestMediaBytes, size)
+}
+
+// dataURLSize returns the decoded size of a base64 data URL, or 0 for other URLs.
+func dataURLSize(url string) int64 {
+	if !strings.HasPrefix(url, "data:") {
+		return 0
+	}
+	header, data, ok := strings.Cut(url, ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return int64(len(data))
+	}
+	return base64Size(data)
+}
+
+// fileDataSize returns the decoded size of file data sent as a data URL or as bare base64.
+func fileDataSize(data string) int64 {
+	if strings.HasPrefix(data, "data:") {
+		return dataURLSize(data)
+	}
+	return base64Size(data)
+}
+
+// base64Size returns the decoded size of base64 data without decoding it.
+func base64Size(data string) int64 {
+	data = strings.TrimRight(strings.TrimSpace(data), "=")
+	return int64(len(data)) * 3 / 4
+}
+
+// contentText returns the text of a string or content-block array value.
+func contentText(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	if !content.IsArray() {
+		return content.Raw
+	}
+	var parts []string
+	content.ForEach(func(_, part gjson.Result) bool {
+		if part.Type == gjson.String {
+			parts = append(parts, part.String())
+		} else if text := part.Get("text"); text.Exists() {
+			parts = append(parts, text.String())
+		}
+		return true
+	})
+	return strings.Join(parts, "\n")
+}
+
+// estimateTokens approximates the token count of texts with the o200k encoding,
+// falling back to four characters per token when the encoding is unavailable.
+func estimateTokens(texts []string) int64 {
+	joined := strings.TrimSpace(strings.Join(texts, "\n"))
+	if joined == "" {
+		return 0
+	}
+	inputCodecOnce.Do(func() {
+		inputCodec, _ = tokenizer.Get(tokenizer.O200kBase)
+	})
+	if inputCodec != nil {
+		if n, err := inputCodec.Count(joined); err == nil {
+			return int64(n)
+		}
+	}
+	return int64((len(joined) + 3) / 4)
+}
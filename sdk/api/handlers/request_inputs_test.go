@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/constant"
+)
+
+func TestRequestInputStats(t *testing.T) {
+	cases := []struct {
+		name        string
+		handlerType string
+		body        string
+		tools       bool
+		images      int64
+	}{
+		{
+			name:        "openai chat",
+			handlerType: constant.OpenAI,
+			body: `{"messages":[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"data:"}}]},
+				{"role":"tool","tool_call_id":"a","content":"the weather is sunny"}]}`,
+			tools:  true,
+			images: 1,
+		},
+		{
+			name:        "responses",
+			handlerType: constant.OpenaiResponse,
+			body:        `{"input":[{"type":"function_call_output","call_id":"a","output":"42"},{"role":"user","content":[{"type":"input_image","image_url":"x"}]}]}`,
+			tools:       true,
+			images:      1,
+		},
+		{
+			name:        "claude",
+			handlerType: constant.Claude,
+			body: `{"messages":[{"role":"user","content":[{"type":"image","source":{}},
+				{"type":"tool_result","tool_use_id":"a","content":[{"type":"text","text":"done"},{"type":"image","source":{}}]}]}]}`,
+			tools:  true,
+			images: 2,
+		},
+		{
+			name:        "gemini cli",
+			handlerType: constant.GeminiCLI,
+			body: `{"request":{"contents":[{"parts":[{"functionResponse":{"name":"f","response":{"ok":true}}},
+				{"inlineData":{"mimeType":"image/png","data":""}},{"inlineData":{"mimeType":"audio/wav","data":""}}]}]}}`,
+			tools:  true,
+			images: 1,
+		},
+		{
+			name:        "plain chat",
+			handlerType: constant.OpenAI,
+			body:        `{"messages":[{"role":"user","content":"hello"}]}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := requestInputStats(tc.handlerType, []byte(tc.body))
+			if (stats.ToolResultTokens > 0) != tc.tools {
+				t.Fatalf("tool result tokens = %d, want tools %v", stats.ToolResultTokens, tc.tools)
+			}
+			if stats.ImageInputs != tc.images {
+				t.Fatalf("image inputs = %d, want %d", stats.ImageInputs, tc.images)
+			}
+		})
+	}
+}
+
+func TestRequestInputStatsMedia(t *testing.T) {
+	// "aGVsbG8=" decodes to 5 bytes, "aGVsbG8gd29ybGQ=" to 11.
+	cases := []struct {
+		name        string
+		handlerType string
+		body        string
+		images      int64
+		documents   int64
+		bytes       int64
+		largest     int64
+	}{
+		{
+			name:        "openai chat",
+			handlerType: constant.OpenAI,
+			body: `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,aGVsbG8="}},
+				{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}},
+				{"type":"file","file":{"filename":"a.pdf","file_data":"data:application/pdf;base64,aGVsbG8gd29ybGQ="}}]}]}`,
+			images: 2, documents: 1, bytes: 16, largest: 11,
+		},
+		{
+			name:        "responses",
+			handlerType: constant.OpenaiResponse,
+			body:        `{"input":[{"role":"user","content":[{"type":"input_file","filename":"a.pdf","file_data":"aGVsbG8="}]}]}`,
+			documents:   1, bytes: 5, largest: 5,
+		},
+		{
+			name:        "claude",
+			handlerType: constant.Claude,
+			body: `{"messages":[{"role":"user","content":[{"type":"document","source":{"type":"base64","media_type":"application/pdf","data":"aGVsbG8gd29ybGQ="}},
+				{"type":"image","source":{"type":"url","url":"https://example.com/cat.png"}}]}]}`,
+			images: 1, documents: 1, bytes: 11, largest: 11,
+		},
+		{
+			name:        "gemini",
+			handlerType: constant.Gemini,
+			body: `{"contents":[{"parts":[{"inline_data":{"mime_type":"application/pdf","data":"aGVsbG8="}},
+				{"fileData":{"mimeType":"image/png","fileUri":"gs://bucket/cat.png"}}]}]}`,
+			images: 1, documents: 1, bytes: 5, largest: 5,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := requestInputStats(tc.handlerType, []byte(tc.body))
+			if stats.ImageInputs != tc.images || stats.DocumentInputs != tc.documents {
+				t.Fatalf("images/documents = %d/%d, want %d/%d", stats.ImageInputs, stats.DocumentInputs, tc.images, tc.documents)
+			}
+			if stats.MediaBytes != tc.bytes || stats.LargestMediaBytes != tc.largest {
+				t.Fatalf("media bytes/largest = %d/%d, want %d/%d", stats.MediaBytes, stats.LargestMediaBytes, tc.bytes, tc.largest)
+			}
+		})
+	}
+}
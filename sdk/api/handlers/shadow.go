@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/policy"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/shadow"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/tracing"
+	coreexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+	sdktranslator "github.com/router-for-me/CLIProxyAPI/v6/sdk/translator"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// shadowRun collects the primary side of a sampled request and hands it to the
+// goroutine running the shadow request. All methods are no-ops on a nil run.
+type shadowRun struct {
+	model   string
+	start   time.Time
+	primary *shadow.Collector
+	done    chan shadow.Result
+	once    sync.Once
+}
+
+// observe records a primary response body or stream chunk.
+func (r *shadowRun) observe(payload []byte) {
+	if r == nil {
+		return
+	}
+	r.primary.Write(payload)
+}
+
+// finish completes the primary side. Only the first call counts, so error paths can
+// finish with their status before a deferred success call.
+func (r *shadowRun) finish(status int, err error) {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.done <- r.primary.Result(r.model, status, time.Since(r.start), err)
+	})
+}
+
+// shadowContext hides the Gin context from a shadow request. Gin recycles it once the
+// primary response is written, and usage plugins would otherwise attribute the shadow
+// request to the client key and read the primary's response status.
+type shadowContext struct {
+	context.Context
+}
+
+func (c shadowContext) Value(key any) any {
+	if key == "gin" {
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+// startShadow samples the request against the shadow traffic rules and, when it is
+// selected, sends a copy to the rule's shadow model in the background. The returned
+// run must be finished with the primary outcome; it is nil when the request is not
+// shadowed.
+func (h *BaseAPIHandler) startShadow(ctx context.Context, handlerType, model string, rawJSON []byte, alt string, stream bool) *shadowRun {
+	sampler := shadow.Active()
+	if sampler == nil || h.AuthManager == nil {
+		return nil
+	}
+	rule, ok := sampler.Sample(model)
+	if !ok {
+		return nil
+	}
+	release, ok := sampler.Acquire()
+	if !ok {
+		log.Debugf("shadow: skipping %s, too many shadow requests in flight", rule.Name)
+		return nil
+	}
+	comparison := shadow.Comparison{
+		Rule:      rule.Name,
+		RequestID: tracing.RequestIDFromContext(ctx),
+		APIKey:    policy.APIKeyFromContext(ctx),
+		Timestamp: time.Now().UTC(),
+	}
+	run := &shadowRun{
+		model:   model,
+		start:   time.Now(),
+		primary: shadow.NewCollector(sampler.MaxResponseBytes()),
+		done:    make(chan shadow.Result, 1),
+	}
+	shadowCtx, cancel := context.WithTimeout(shadowContext{context.WithoutCancel(ctx)}, sampler.Timeout())
+	payload := cloneBytes(rawJSON)
+	go func() {
+		defer release()
+		defer cancel()
+		comparison.Shadow = h.executeShadow(shadowCtx, handlerType, rule, payload, alt, stream, sampler.MaxResponseBytes())
+		wait := time.NewTimer(sampler.Timeout())
+		defer wait.Stop()
+		select {
+		case comparison.Primary = <-run.done:
+		case <-wait.C:
+			comparison.Primary = shadow.Result{Model: model, Error: "primary request did not finish"}
+		}
+		shadow.Record(context.Background(), comparison)
+	}()
+	return run
+}
+
+// executeShadow runs the shadow side of a comparison and never returns an error: the
+// outcome, including failures, is reported in the result.
+func (h *BaseAPIHandler) executeShadow(ctx context.Context, handlerType string, rule shadow.Rule, rawJSON []byte, alt string, stream bool, limit int) shadow.Result {
+	collector := shadow.NewCollector(limit)
+	start := time.Now()
+	providers, normalizedModel, metadata, errMsg := h.getRequestDetails(rule.ShadowModel)
+	if errMsg == nil && rule.ShadowProvider != "" {
+		var filtered []string
+		for _, provider := range providers {
+			if strings.EqualFold(provider, rule.ShadowProvider) {
+				filtered = append(filtered, provider)
+			}
+		}
+		if len(filtered) == 0 {
+			return collector.Result(rule.ShadowModel, http.StatusBadRequest, 0, fmt.Errorf("provider %s does not serve model %s", rule.ShadowProvider, rule.ShadowModel))
+		}
+		providers = filtered
+	}
+	if errMsg != nil {
+		return collector.Result(rule.ShadowModel, errMsg.StatusCode, 0, errMsg.Error)
+	}
+	if gjson.GetBytes(rawJSON, "model").Exists() {
+		if updated, err := sjson.SetBytes(rawJSON, "model", rule.ShadowModel); err == nil {
+			rawJSON = updated
+		}
+	}
+	req := coreexecutor.Request{Model: normalizedModel, Payload: rawJSON, Metadata: cloneMetadata(metadata)}
+	opts := coreexecutor.Options{
+		Stream:          stream,
+		Alt:             alt,
+		OriginalRequest: cloneBytes(rawJSON),
+		SourceFormat:    sdktranslator.FromString(handlerType),
+		Metadata:        cloneMetadata(metadata),
+	}
+
+	if !stream {
+		resp, err := h.AuthManager.Execute(ctx, providers, req, opts)
+		if err != nil {
+			return collector.Result(rule.ShadowModel, shadowErrorStatus(err), time.Since(start), err)
+		}
+		collector.Write(resp.Payload)
+		return collector.Result(rule.ShadowModel, http.StatusOK, time.Since(start), nil)
+	}
+	chunks, err := h.AuthManager.ExecuteStream(ctx, providers, req, opts)
+	if err != nil {
+		return collector.Result(rule.ShadowModel, shadowErrorStatus(err), time.Since(start), err)
+	}
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			go drainStreamChunks(chunks)
+			return collector.Result(rule.ShadowModel, shadowErrorStatus(chunk.Err), time.Since(start), chunk.Err)
+		}
+		collector.Write(chunk.Payload)
+	}
+	return collector.Result(rule.ShadowModel, http.StatusOK, time.Since(start), nil)
+}
+
+func shadowErrorStatus(err error) int {
+	if se, ok := err.(interface{ StatusCode() int }); ok && se != nil {
+		if code := se.StatusCode(); code > 0 {
+			return code
+		}
+	}
+	return http.StatusInternalServerError
+}
@@ -114,7 +114,7 @@ func (a *ClaudeAuthenticator) Login(ctx context.Context, cfg *config.Config, opt
 		return nil, claude.NewAuthenticationError(claude.ErrInvalidState, fmt.Errorf("state mismatch"))
 	}
 
-	log.Debug("Claude authorization code received; exchanging for tokens")
+	util.ComponentLog(util.LogComponentAuth).Debug("Claude authorization code received; exchanging for tokens")
 
 	authBundle, err := authSvc.ExchangeCodeForTokens(ctx, result.Code, state, pkceCodes)
 	if err != nil {
@@ -113,7 +113,7 @@ func (a *CodexAuthenticator) Login(ctx context.Context, cfg *config.Config, opts
 		return nil, codex.NewAuthenticationError(codex.ErrInvalidState, fmt.Errorf("state mismatch"))
 	}
 
-	log.Debug("Codex authorization code received; exchanging for tokens")
+	util.ComponentLog(util.LogComponentAuth).Debug("Codex authorization code received; exchanging for tokens")
 
 	authBundle, err := authSvc.ExchangeCodeForTokens(ctx, result.Code, pkceCodes)
 	if err != nil {
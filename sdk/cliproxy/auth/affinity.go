@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+// ConversationMetadataKey is the execution metadata key carrying the client's
+// conversation identifier used for session affinity.
+const ConversationMetadataKey = "conversation_id"
+
+// AffinityConfig controls sticky routing: requests that share a conversation ID are
+// sent to the credential that served the conversation before, so providers with
+// server-side prompt caching keep hitting a warm cache. A binding expires after TTL
+// without traffic; when the bound credential is unavailable the request is routed
+// normally and the conversation moves to the credential that serves it.
+type AffinityConfig struct {
+	Enabled bool
+	// TTL is how long an idle binding is kept. Defaults to one hour.
+	TTL time.Duration
+}
+
+// AffinityStore persists conversation bindings so they survive restarts. Keys are
+// opaque and already scoped by provider.
+type AffinityStore interface {
+	LoadAffinity(ctx context.Context, key string, now time.Time) (authID string, ok bool, err error)
+	SaveAffinity(ctx context.Context, key, authID string, expiresAt time.Time) error
+}
+
+type affinityBinding struct {
+	authID  string
+	expires time.Time
+	// persistedUntil is the expiry last written to the store; the row is refreshed
+	// once half of its lifetime has passed rather than on every request.
+	persistedUntil time.Time
+}
+
+type affinityTable struct {
+	mu        sync.Mutex
+	cfg       AffinityConfig
+	store     AffinityStore
+	bindings  map[string]*affinityBinding
+	lastSweep time.Time
+}
+
+// SetSessionAffinity updates the sticky routing settings. Disabling affinity drops
+// the in-memory bindings; persisted bindings are left to expire.
+func (m *Manager) SetSessionAffinity(cfg AffinityConfig) {
+	if m == nil {
+		return
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Hour
+	}
+	m.affinity.mu.Lock()
+	m.affinity.cfg = cfg
+	if !cfg.Enabled {
+		m.affinity.bindings = nil
+	}
+	m.affinity.mu.Unlock()
+}
+
+// SetAffinityStore installs the optional persistent backing for conversation bindings.
+// Passing nil keeps bindings in memory only.
+func (m *Manager) SetAffinityStore(store AffinityStore) {
+	if m == nil {
+		return
+	}
+	m.affinity.mu.Lock()
+	m.affinity.store = store
+	m.affinity.mu.Unlock()
+}
+
+// affinityKey returns the binding key for a request, or "" when affinity does not
+// apply. Requests pinned to an auth by operator tooling bypass affinity.
+func (m *Manager) affinityKey(provider string, opts cliproxyexecutor.Options) string {
+	if pinnedAuthFromOptions(opts) != "" || opts.Metadata == nil {
+		return ""
+	}
+	conversation, _ := opts.Metadata[ConversationMetadataKey].(string)
+	conversation = strings.TrimSpace(conversation)
+	if conversation == "" {
+		return ""
+	}
+	m.affinity.mu.Lock()
+	enabled := m.affinity.cfg.Enabled
+	m.affinity.mu.Unlock()
+	if !enabled {
+		return ""
+	}
+	return provider + "|" + conversation
+}
+
+// lookup returns the auth bound to key, consulting the store when the binding is not
+// held in memory.
+func (t *affinityTable) lookup(ctx context.Context, key string, now time.Time) string {
+	if key == "" {
+		return ""
+	}
+	t.mu.Lock()
+	if b := t.bindings[key]; b != nil && now.Before(b.expires) {
+		t.mu.Unlock()
+		return b.authID
+	}
+	store := t.store
+	t.mu.Unlock()
+	if store == nil {
+		return ""
+	}
+	authID, ok, err := store.LoadAffinity(ctx, key, now)
+	if err != nil {
+		util.ComponentLog(util.LogComponentRouter).Debugf("session affinity: load %s: %v", key, err)
+		return ""
+	}
+	if !ok {
+		return ""
+	}
+	return authID
+}
+
+// bind records that key is served by authID and extends the binding's lifetime.
+func (t *affinityTable) bind(ctx context.Context, key, authID string, now time.Time) {
+	if key == "" || authID == "" {
+		return
+	}
+	t.mu.Lock()
+	if t.bindings == nil {
+		t.bindings = make(map[string]*affinityBinding)
+	}
+	ttl := t.cfg.TTL
+	if now.Sub(t.lastSweep) >= ttl {
+		for k, b := range t.bindings {
+			if !now.Before(b.expires) {
+				delete(t.bindings, k)
+			}
+		}
+		t.lastSweep = now
+	}
+	b := t.bindings[key]
+	if b == nil || b.authID != authID {
+		b = &affinityBinding{authID: authID}
+		t.bindings[key] = b
+	}
+	b.expires = now.Add(ttl)
+	store := t.store
+	persist := store != nil && b.persistedUntil.Sub(now) < ttl/2
+	if persist {
+		b.persistedUntil = b.expires
+	}
+	expires := b.expires
+	t.mu.Unlock()
+	if !persist {
+		return
+	}
+	if err := store.SaveAffinity(ctx, key, authID, expires); err != nil {
+		util.ComponentLog(util.LogComponentRouter).Debugf("session affinity: save %s: %v", key, err)
+	}
+}
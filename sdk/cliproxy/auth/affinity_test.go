@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+type recordingExecutor struct {
+	chatOnlyExecutor
+	calls []string
+	fail  map[string]bool
+}
+
+func (e *recordingExecutor) Execute(_ context.Context, auth *Auth, _ cliproxyexecutor.Request, _ cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	e.calls = append(e.calls, auth.ID)
+	if e.fail[auth.ID] {
+		return cliproxyexecutor.Response{}, rejectedDialError{code: http.StatusServiceUnavailable}
+	}
+	return cliproxyexecutor.Response{Payload: []byte(auth.ID)}, nil
+}
+
+type memoryAffinityStore map[string]string
+
+func (s memoryAffinityStore) LoadAffinity(_ context.Context, key string, _ time.Time) (string, bool, error) {
+	id, ok := s[key]
+	return id, ok, nil
+}
+
+func (s memoryAffinityStore) SaveAffinity(_ context.Context, key, authID string, _ time.Time) error {
+	s[key] = authID
+	return nil
+}
+
+func newAffinityManager(t *testing.T, provider, model string) (*Manager, *recordingExecutor) {
+	t.Helper()
+	m := NewManager(nil, nil, nil)
+	exec := &recordingExecutor{chatOnlyExecutor: chatOnlyExecutor{provider: provider}, fail: map[string]bool{}}
+	m.RegisterExecutor(exec)
+	reg := registry.GetGlobalRegistry()
+	for _, id := range []string{provider + "-a", provider + "-b", provider + "-c"} {
+		if _, err := m.Register(context.Background(), &Auth{ID: id, Provider: provider}); err != nil {
+			t.Fatalf("register %s: %v", id, err)
+		}
+		reg.RegisterClient(id, provider, []*registry.ModelInfo{{ID: model}})
+		t.Cleanup(func() { reg.UnregisterClient(id) })
+	}
+	m.SetSessionAffinity(AffinityConfig{Enabled: true})
+	return m, exec
+}
+
+func executeConversation(t *testing.T, m *Manager, provider, model, conversation string) string {
+	t.Helper()
+	opts := cliproxyexecutor.Options{}
+	if conversation != "" {
+		opts.Metadata = map[string]any{ConversationMetadataKey: conversation}
+	}
+	resp, err := m.Execute(context.Background(), []string{provider}, cliproxyexecutor.Request{Model: model}, opts)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	return string(resp.Payload)
+}
+
+func TestSessionAffinityPinsConversation(t *testing.T) {
+	const provider, model = "sticky", "test-affinity-model"
+	m, exec := newAffinityManager(t, provider, model)
+
+	first := executeConversation(t, m, provider, model, "conv-1")
+	for i := 0; i < 4; i++ {
+		// Unrelated traffic advances the round-robin cursor in between.
+		executeConversation(t, m, provider, model, "")
+		if got := executeConversation(t, m, provider, model, "conv-1"); got != first {
+			t.Fatalf("conversation moved from %s to %s", first, got)
+		}
+	}
+
+	// A failing bound credential hands the conversation to the one that serves it.
+	exec.fail[first] = true
+	moved := executeConversation(t, m, provider, model, "conv-1")
+	if moved == first {
+		t.Fatalf("expected conversation to leave failing credential %s", first)
+	}
+	exec.fail[first] = false
+	if got := executeConversation(t, m, provider, model, "conv-1"); got != moved {
+		t.Fatalf("expected conversation to stay on %s, got %s", moved, got)
+	}
+}
+
+func TestSessionAffinityUsesStore(t *testing.T) {
+	const provider, model = "sticky-store", "test-affinity-store-model"
+	m, _ := newAffinityManager(t, provider, model)
+	store := memoryAffinityStore{provider + "|conv-2": provider + "-c"}
+	m.SetAffinityStore(store)
+
+	if got := executeConversation(t, m, provider, model, "conv-2"); got != provider+"-c" {
+		t.Fatalf("expected persisted binding %s-c, got %s", provider, got)
+	}
+	executeConversation(t, m, provider, model, "conv-3")
+	if store[provider+"|conv-3"] == "" {
+		t.Fatal("expected new binding to be persisted")
+	}
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerConfig controls the per-credential circuit breaker. A breaker opens after
+// FailureThreshold consecutive upstream failures inside Window, rejects traffic for
+// OpenDuration so the request falls through to the next credential or provider,
+// then lets a single probe request through (half-open) to decide whether to close.
+type BreakerConfig struct {
+	Enabled          bool
+	FailureThreshold int
+	Window           time.Duration
+	OpenDuration     time.Duration
+}
+
+// BreakerStatus is a snapshot of one credential's breaker.
+type BreakerStatus struct {
+	Provider            string    `json:"provider"`
+	AuthID              string    `json:"auth_id"`
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitempty"`
+	RetryAt             time.Time `json:"retry_at,omitempty"`
+}
+
+type breaker struct {
+	provider     string
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+}
+
+type breakerSet struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	breakers map[string]*breaker
+}
+
+func normalizeBreakerConfig(cfg BreakerConfig) BreakerConfig {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = 30 * time.Second
+	}
+	return cfg
+}
+
+// SetCircuitBreaker updates the circuit breaker settings. Disabling it drops all state.
+func (m *Manager) SetCircuitBreaker(cfg BreakerConfig) {
+	if m == nil {
+		return
+	}
+	cfg = normalizeBreakerConfig(cfg)
+	m.breakers.mu.Lock()
+	m.breakers.cfg = cfg
+	if !cfg.Enabled {
+		m.breakers.breakers = nil
+	}
+	m.breakers.mu.Unlock()
+}
+
+// CircuitBreakers returns the state of every credential with a tracked breaker.
+func (m *Manager) CircuitBreakers() []BreakerStatus {
+	now := time.Now()
+	m.breakers.mu.Lock()
+	defer m.breakers.mu.Unlock()
+	out := make([]BreakerStatus, 0, len(m.breakers.breakers))
+	for id, b := range m.breakers.breakers {
+		status := BreakerStatus{
+			Provider:            b.provider,
+			AuthID:              id,
+			State:               m.breakers.stateLocked(b, now),
+			ConsecutiveFailures: b.failures,
+			OpenedAt:            b.openedAt,
+		}
+		if !b.openedAt.IsZero() {
+			status.RetryAt = b.openedAt.Add(m.breakers.cfg.OpenDuration)
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].AuthID < out[j].AuthID
+	})
+	return out
+}
+
+// ResetCircuitBreaker closes the breaker for authID, or every breaker when authID is empty.
+func (m *Manager) ResetCircuitBreaker(authID string) {
+	m.breakers.mu.Lock()
+	if authID == "" {
+		m.breakers.breakers = nil
+	} else {
+		delete(m.breakers.breakers, authID)
+	}
+	m.breakers.mu.Unlock()
+}
+
+func (s *breakerSet) stateLocked(b *breaker, now time.Time) string {
+	switch {
+	case b.openedAt.IsZero():
+		return BreakerClosed
+	case now.Before(b.openedAt.Add(s.cfg.OpenDuration)):
+		return BreakerOpen
+	default:
+		return BreakerHalfOpen
+	}
+}
+
+// allows reports whether a request may be sent with authID. In the half-open state
+// only one probe is admitted at a time; claim reserves that probe.
+func (s *breakerSet) allows(authID string, now time.Time, claim bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.cfg.Enabled {
+		return true
+	}
+	b := s.breakers[authID]
+	if b == nil {
+		return true
+	}
+	switch s.stateLocked(b, now) {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		if claim {
+			b.probing = true
+		}
+	}
+	return true
+}
+
+// releaseProbe gives back a half-open probe claimed for a request that was never sent.
+func (s *breakerSet) releaseProbe(authID string) {
+	s.mu.Lock()
+	if b := s.breakers[authID]; b != nil {
+		b.probing = false
+	}
+	s.mu.Unlock()
+}
+
+// record updates the breaker after a request and returns the transition event, if any.
+func (s *breakerSet) record(provider, authID string, success bool, status int, now time.Time) *events.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.cfg.Enabled {
+		return nil
+	}
+	b := s.breakers[authID]
+	if success || !isUpstreamFailure(status) {
+		if b == nil {
+			return nil
+		}
+		wasOpen := !b.openedAt.IsZero()
+		delete(s.breakers, authID)
+		if wasOpen && success {
+			return &events.Event{Type: events.CircuitClosed, Time: now, Provider: provider, AuthID: authID, Reason: "circuit_breaker"}
+		}
+		return nil
+	}
+
+	if b == nil {
+		if s.breakers == nil {
+			s.breakers = make(map[string]*breaker)
+		}
+		b = &breaker{provider: provider}
+		s.breakers[authID] = b
+	}
+	if b.probing || !b.openedAt.IsZero() {
+		// A failed half-open probe re-opens the breaker for another full period.
+		b.probing = false
+		b.openedAt = now
+		b.failures++
+		return nil
+	}
+	if b.failures == 0 || now.Sub(b.firstFailure) > s.cfg.Window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures < s.cfg.FailureThreshold {
+		return nil
+	}
+	b.openedAt = now
+	return &events.Event{
+		Type:     events.CircuitOpened,
+		Time:     now,
+		Provider: provider,
+		AuthID:   authID,
+		Reason:   "circuit_breaker",
+		Data:     map[string]any{"retry_after": now.Add(s.cfg.OpenDuration), "failures": b.failures},
+	}
+}
+
+// isUpstreamFailure reports whether status indicates the upstream itself is failing,
+// as opposed to a client error or quota response handled by cooldowns.
+func isUpstreamFailure(status int) bool {
+	switch {
+	case status == 0:
+		return true
+	case status == 408:
+		return true
+	case status >= 500:
+		return true
+	default:
+		return false
+	}
+}
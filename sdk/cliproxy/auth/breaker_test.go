@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+func TestBreakerOpensAndHalfOpens(t *testing.T) {
+	s := &breakerSet{cfg: normalizeBreakerConfig(BreakerConfig{Enabled: true, FailureThreshold: 2, Window: time.Minute, OpenDuration: 10 * time.Second})}
+	now := time.Now()
+
+	if evt := s.record("claude", "a", false, 429, now); evt != nil || len(s.breakers) != 0 {
+		t.Fatalf("quota responses must not count as upstream failures")
+	}
+	if evt := s.record("claude", "a", false, 502, now); evt != nil {
+		t.Fatalf("breaker opened before threshold")
+	}
+	evt := s.record("claude", "a", false, 503, now.Add(time.Second))
+	if evt == nil || evt.Type != events.CircuitOpened {
+		t.Fatalf("expected circuit opened event, got %+v", evt)
+	}
+	if s.allows("a", now.Add(5*time.Second), true) {
+		t.Fatalf("open breaker admitted a request")
+	}
+
+	halfOpen := now.Add(12 * time.Second)
+	if !s.allows("a", halfOpen, true) {
+		t.Fatalf("half-open breaker rejected the probe")
+	}
+	if s.allows("a", halfOpen, true) {
+		t.Fatalf("half-open breaker admitted a second concurrent probe")
+	}
+	if evt := s.record("claude", "a", false, 500, halfOpen); evt != nil {
+		t.Fatalf("failed probe should re-open silently, got %+v", evt)
+	}
+	if s.allows("a", halfOpen.Add(5*time.Second), false) {
+		t.Fatalf("failed probe did not re-open the breaker")
+	}
+
+	recovered := halfOpen.Add(11 * time.Second)
+	if !s.allows("a", recovered, true) {
+		t.Fatalf("breaker did not half-open again")
+	}
+	if evt := s.record("claude", "a", true, 0, recovered); evt == nil || evt.Type != events.CircuitClosed {
+		t.Fatalf("expected circuit closed event, got %+v", evt)
+	}
+	if len(s.breakers) != 0 {
+		t.Fatalf("closed breaker still tracked")
+	}
+}
+
+func TestBreakerFailuresOutsideWindowReset(t *testing.T) {
+	s := &breakerSet{cfg: normalizeBreakerConfig(BreakerConfig{Enabled: true, FailureThreshold: 2, Window: time.Minute})}
+	now := time.Now()
+	s.record("codex", "b", false, 500, now)
+	if evt := s.record("codex", "b", false, 500, now.Add(2*time.Minute)); evt != nil {
+		t.Fatalf("failures outside the window must not open the breaker")
+	}
+}
+
+func TestManagerCircuitBreakerStatus(t *testing.T) {
+	m := NewManager(nil, nil, nil)
+	m.SetCircuitBreaker(BreakerConfig{Enabled: true, FailureThreshold: 1})
+	m.MarkResult(context.Background(), Result{AuthID: "x", Provider: "gemini", Error: &Error{HTTPStatus: 500}})
+	states := m.CircuitBreakers()
+	if len(states) != 1 || states[0].State != BreakerOpen || states[0].Provider != "gemini" {
+		t.Fatalf("unexpected breaker states: %+v", states)
+	}
+	m.ResetCircuitBreaker("x")
+	if states := m.CircuitBreakers(); len(states) != 0 {
+		t.Fatalf("reset did not clear breaker: %+v", states)
+	}
+}
+
+// barrierSelector holds the first n picks until all of them arrived, so concurrent
+// requests select credentials from the same breaker snapshot.
+type barrierSelector struct {
+	n       int32
+	calls   atomic.Int32
+	arrived chan struct{}
+}
+
+func (s *barrierSelector) Pick(_ context.Context, _, _ string, _ cliproxyexecutor.Options, auths []*Auth) (*Auth, error) {
+	if call := s.calls.Add(1); call <= s.n {
+		if call == s.n {
+			close(s.arrived)
+		}
+		select {
+		case <-s.arrived:
+		case <-time.After(time.Second):
+		}
+	}
+	return auths[0], nil
+}
+
+func TestPickNextClaimsHalfOpenProbeOnce(t *testing.T) {
+	const workers = 16
+	m := NewManager(nil, &barrierSelector{n: workers, arrived: make(chan struct{})}, nil)
+	m.RegisterExecutor(chatOnlyExecutor{provider: "probe"})
+	m.SetCircuitBreaker(BreakerConfig{Enabled: true, FailureThreshold: 1, OpenDuration: time.Second})
+	reg := registry.GetGlobalRegistry()
+	for _, id := range []string{"probe-a", "probe-b"} {
+		if _, err := m.Register(context.Background(), &Auth{ID: id, Provider: "probe"}); err != nil {
+			t.Fatalf("register %s: %v", id, err)
+		}
+		reg.RegisterClient(id, "probe", []*registry.ModelInfo{{ID: "probe-model"}})
+		t.Cleanup(func() { reg.UnregisterClient(id) })
+		// Both credentials tripped long enough ago to be half-open.
+		m.breakers.record("probe", id, false, 500, time.Now().Add(-time.Minute))
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		picked  = map[string]int{}
+		refused int
+	)
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			auth, _, err := m.pickNext(context.Background(), "probe", "probe-model", cliproxyexecutor.Options{}, map[string]struct{}{})
+			mu.Lock()
+			defer mu.Unlock()
+			var authErr *Error
+			switch {
+			case err == nil:
+				picked[auth.ID]++
+			case errors.As(err, &authErr) && authErr.Code == "circuit_open":
+				refused++
+			default:
+				t.Errorf("unexpected pick error: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if len(picked) != 2 || picked["probe-a"] != 1 || picked["probe-b"] != 1 || refused != workers-2 {
+		t.Fatalf("expected one probe per half-open credential, got %v and %d refusals", picked, refused)
+	}
+}
+
+func TestHealthEventsLockedTransitions(t *testing.T) {
+	m := NewManager(nil, nil, nil)
+	now := time.Now()
+	blockedState := func() map[string]*ModelState {
+		return map[string]*ModelState{"m": {Unavailable: true, NextRetryAfter: now.Add(time.Minute), StatusMessage: "rate limited"}}
+	}
+	a := &Auth{ID: "a", Provider: "claude", ModelStates: blockedState(), StatusMessage: "rate limited"}
+	b := &Auth{ID: "b", Provider: "claude"}
+	m.auths = map[string]*Auth{"a": a, "b": b}
+
+	types := func(evts []events.Event) []events.Type {
+		out := make([]events.Type, 0, len(evts))
+		for _, evt := range evts {
+			out = append(out, evt.Type)
+		}
+		return out
+	}
+
+	failure := Result{AuthID: "a", Provider: "claude", Model: "m"}
+	got := m.healthEventsLocked(a, failure, false, now)
+	if len(got) != 1 || got[0].Type != events.CircuitOpened || got[0].Data["retry_after"] == nil {
+		t.Fatalf("expected only circuit opened while another credential serves the model, got %v", types(got))
+	}
+
+	b.ModelStates = blockedState()
+	got = m.healthEventsLocked(b, Result{AuthID: "b", Provider: "claude", Model: "m"}, false, now)
+	if len(got) != 2 || got[0].Type != events.CircuitOpened || got[1].Type != events.ProviderUnhealthy {
+		t.Fatalf("expected circuit opened and provider unhealthy, got %v", types(got))
+	}
+	if got = m.healthEventsLocked(b, Result{AuthID: "b", Provider: "claude", Model: "m"}, true, now); len(got) != 0 {
+		t.Fatalf("provider unhealthy must be reported once, got %v", types(got))
+	}
+
+	b.ModelStates = nil
+	got = m.healthEventsLocked(b, Result{AuthID: "b", Provider: "claude", Model: "m", Success: true}, true, now)
+	if len(got) != 2 || got[0].Type != events.CircuitClosed || got[1].Type != events.ProviderRecovered {
+		t.Fatalf("expected circuit closed and provider recovered, got %v", types(got))
+	}
+	if got = m.healthEventsLocked(b, Result{AuthID: "b", Provider: "claude", Model: "m", Success: true}, false, now); len(got) != 0 {
+		t.Fatalf("healthy result without a transition produced %v", types(got))
+	}
+}
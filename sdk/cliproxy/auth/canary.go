@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+// CanaryConfig controls the warm-up of credentials added while the proxy is running.
+// A canary credential is offered only Percent of its provider's requests while other
+// credentials are available. It is promoted once Warmup has passed and it served at
+// least MinRequests requests, and disabled as soon as its failure or rate-limit rate
+// over at least MinRequests requests exceeds the thresholds.
+type CanaryConfig struct {
+	Enabled          bool
+	Percent          int
+	Warmup           time.Duration
+	MinRequests      int
+	MaxFailureRate   float64
+	MaxRateLimitRate float64
+}
+
+// CanaryStatus is a snapshot of one canary credential.
+type CanaryStatus struct {
+	Provider      string    `json:"provider"`
+	AuthID        string    `json:"auth_id"`
+	StartedAt     time.Time `json:"started_at"`
+	WarmupUntil   time.Time `json:"warmup_until"`
+	Requests      int64     `json:"requests"`
+	Failures      int64     `json:"failures"`
+	RateLimited   int64     `json:"rate_limited"`
+	FailureRate   float64   `json:"failure_rate"`
+	RateLimitRate float64   `json:"rate_limit_rate"`
+}
+
+type canary struct {
+	provider    string
+	startedAt   time.Time
+	requests    int64
+	failures    int64
+	rateLimited int64
+}
+
+type canarySet struct {
+	mu      sync.Mutex
+	cfg     CanaryConfig
+	entries map[string]*canary
+	// picks counts routing decisions per provider, spreading canary traffic evenly.
+	picks map[string]uint64
+}
+
+// canaryOutcome is the decision taken after a canary request.
+type canaryOutcome int
+
+const (
+	canaryContinue canaryOutcome = iota
+	canaryPromote
+	canaryFail
+)
+
+func normalizeCanaryConfig(cfg CanaryConfig) CanaryConfig {
+	if cfg.Percent <= 0 {
+		cfg.Percent = 5
+	}
+	if cfg.Percent > 100 {
+		cfg.Percent = 100
+	}
+	if cfg.Warmup <= 0 {
+		cfg.Warmup = 30 * time.Minute
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 20
+	}
+	if cfg.MaxFailureRate <= 0 {
+		cfg.MaxFailureRate = 0.2
+	}
+	if cfg.MaxRateLimitRate <= 0 {
+		cfg.MaxRateLimitRate = 0.5
+	}
+	return cfg
+}
+
+// SetCredentialCanary updates the canary settings. Disabling it promotes every
+// current canary.
+func (m *Manager) SetCredentialCanary(cfg CanaryConfig) {
+	if m == nil {
+		return
+	}
+	cfg = normalizeCanaryConfig(cfg)
+	m.canaries.mu.Lock()
+	m.canaries.cfg = cfg
+	if !cfg.Enabled {
+		m.canaries.entries = nil
+	}
+	m.canaries.mu.Unlock()
+}
+
+// StartCanary puts a credential on canary routing. Hosts call it for credentials
+// added while running; it does nothing while canary routing is disabled.
+func (m *Manager) StartCanary(authID string) {
+	if m == nil || authID == "" {
+		return
+	}
+	m.mu.RLock()
+	auth := m.auths[authID]
+	provider := ""
+	if auth != nil {
+		provider = auth.Provider
+	}
+	m.mu.RUnlock()
+	if auth == nil {
+		return
+	}
+	m.canaries.mu.Lock()
+	defer m.canaries.mu.Unlock()
+	if !m.canaries.cfg.Enabled {
+		return
+	}
+	if m.canaries.entries == nil {
+		m.canaries.entries = make(map[string]*canary)
+	}
+	m.canaries.entries[authID] = &canary{provider: provider, startedAt: time.Now()}
+}
+
+// Canaries returns the state of every credential on canary routing.
+func (m *Manager) Canaries() []CanaryStatus {
+	m.canaries.mu.Lock()
+	defer m.canaries.mu.Unlock()
+	out := make([]CanaryStatus, 0, len(m.canaries.entries))
+	for id, c := range m.canaries.entries {
+		status := CanaryStatus{
+			Provider:    c.provider,
+			AuthID:      id,
+			StartedAt:   c.startedAt,
+			WarmupUntil: c.startedAt.Add(m.canaries.cfg.Warmup),
+			Requests:    c.requests,
+			Failures:    c.failures,
+			RateLimited: c.rateLimited,
+		}
+		if c.requests > 0 {
+			status.FailureRate = float64(c.failures) / float64(c.requests)
+			status.RateLimitRate = float64(c.rateLimited) / float64(c.requests)
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].AuthID < out[j].AuthID
+	})
+	return out
+}
+
+// PromoteCanary ends canary routing for authID, or for every canary when authID is
+// empty, giving the credentials full traffic.
+func (m *Manager) PromoteCanary(authID string) {
+	m.canaries.mu.Lock()
+	if authID == "" {
+		m.canaries.entries = nil
+	} else {
+		delete(m.canaries.entries, authID)
+	}
+	m.canaries.mu.Unlock()
+}
+
+// route narrows candidates to either the canary or the regular credentials, so
+// canaries receive their configured share of the provider's requests. Candidates
+// are returned unchanged when only one of the two groups is available.
+func (s *canarySet) route(provider string, candidates []*Auth) []*Auth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.cfg.Enabled || len(s.entries) == 0 {
+		return candidates
+	}
+	canaries := make([]*Auth, 0, len(candidates))
+	regular := make([]*Auth, 0, len(candidates))
+	for _, candidate := range candidates {
+		if _, ok := s.entries[candidate.ID]; ok {
+			canaries = append(canaries, candidate)
+		} else {
+			regular = append(regular, candidate)
+		}
+	}
+	if len(canaries) == 0 || len(regular) == 0 {
+		return candidates
+	}
+	if s.picks == nil {
+		s.picks = make(map[string]uint64)
+	}
+	n := s.picks[provider]
+	s.picks[provider] = n + 1
+	if int(n%100) < s.cfg.Percent {
+		return canaries
+	}
+	return regular
+}
+
+// record counts a request served by authID and decides whether its canary ends.
+func (s *canarySet) record(authID string, success bool, status int, now time.Time) (canaryOutcome, CanaryStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.entries[authID]
+	if c == nil {
+		return canaryContinue, CanaryStatus{}
+	}
+	c.requests++
+	switch {
+	case success:
+	case status == 429:
+		c.rateLimited++
+	case isCanaryFailure(status):
+		c.failures++
+	}
+	snapshot := CanaryStatus{
+		Provider:      c.provider,
+		AuthID:        authID,
+		StartedAt:     c.startedAt,
+		WarmupUntil:   c.startedAt.Add(s.cfg.Warmup),
+		Requests:      c.requests,
+		Failures:      c.failures,
+		RateLimited:   c.rateLimited,
+		FailureRate:   float64(c.failures) / float64(c.requests),
+		RateLimitRate: float64(c.rateLimited) / float64(c.requests),
+	}
+	if c.requests < int64(s.cfg.MinRequests) {
+		return canaryContinue, snapshot
+	}
+	if snapshot.FailureRate > s.cfg.MaxFailureRate || snapshot.RateLimitRate > s.cfg.MaxRateLimitRate {
+		delete(s.entries, authID)
+		return canaryFail, snapshot
+	}
+	if !now.Before(snapshot.WarmupUntil) {
+		delete(s.entries, authID)
+		return canaryPromote, snapshot
+	}
+	return canaryContinue, snapshot
+}
+
+// isCanaryFailure reports whether status counts against a canary: upstream failures
+// and rejected credentials, but not client errors the credential is not to blame for.
+func isCanaryFailure(status int) bool {
+	return isUpstreamFailure(status) || status == 401 || status == 403
+}
+
+// recordCanary applies the outcome of a canary request: a failed canary is disabled
+// and persisted as such, so it stays out of rotation until re-enabled.
+func (m *Manager) recordCanary(ctx context.Context, result Result, now time.Time) *events.Event {
+	outcome, status := m.canaries.record(result.AuthID, result.Success, statusCodeFromResult(result.Error), now)
+	data := map[string]any{
+		"requests":        status.Requests,
+		"failure_rate":    status.FailureRate,
+		"rate_limit_rate": status.RateLimitRate,
+	}
+	switch outcome {
+	case canaryPromote:
+		return &events.Event{Type: events.CanaryPromoted, Time: now, Provider: status.Provider, AuthID: status.AuthID, Reason: "canary", Data: data}
+	case canaryFail:
+		reason := fmt.Sprintf("canary failed: %.0f%% failures, %.0f%% rate limited over %d requests",
+			status.FailureRate*100, status.RateLimitRate*100, status.Requests)
+		m.mu.Lock()
+		if auth := m.auths[result.AuthID]; auth != nil {
+			auth.Disabled = true
+			auth.Status = StatusDisabled
+			auth.StatusMessage = reason
+			auth.UpdatedAt = now
+			_ = m.persist(ctx, auth)
+		}
+		m.mu.Unlock()
+		return &events.Event{Type: events.CanaryFailed, Time: now, Provider: status.Provider, AuthID: status.AuthID, Reason: reason, Data: data}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+func TestCanaryRouteSplitsTraffic(t *testing.T) {
+	s := &canarySet{cfg: normalizeCanaryConfig(CanaryConfig{Enabled: true, Percent: 10})}
+	s.entries = map[string]*canary{"new": {provider: "claude", startedAt: time.Now()}}
+	candidates := []*Auth{{ID: "old-1"}, {ID: "new"}, {ID: "old-2"}}
+
+	canaryPicks := 0
+	for i := 0; i < 100; i++ {
+		routed := s.route("claude", candidates)
+		switch {
+		case len(routed) == 1 && routed[0].ID == "new":
+			canaryPicks++
+		case len(routed) == 2:
+		default:
+			t.Fatalf("unexpected routed candidates %+v", routed)
+		}
+	}
+	if canaryPicks != 10 {
+		t.Fatalf("expected 10 of 100 requests routed to the canary, got %d", canaryPicks)
+	}
+	if routed := s.route("claude", []*Auth{{ID: "new"}}); len(routed) != 1 {
+		t.Fatalf("a canary alone must still be used, got %+v", routed)
+	}
+}
+
+func TestCanaryRecordPromotesAndFails(t *testing.T) {
+	s := &canarySet{cfg: normalizeCanaryConfig(CanaryConfig{Enabled: true, Warmup: time.Minute, MinRequests: 4, MaxFailureRate: 0.3})}
+	now := time.Now()
+	s.entries = map[string]*canary{
+		"good": {provider: "codex", startedAt: now},
+		"bad":  {provider: "codex", startedAt: now},
+	}
+
+	for i := 0; i < 4; i++ {
+		if outcome, _ := s.record("good", true, 0, now.Add(time.Second)); outcome != canaryContinue {
+			t.Fatalf("canary ended before its warm-up, outcome %d", outcome)
+		}
+	}
+	if outcome, _ := s.record("good", false, 400, now.Add(2*time.Minute)); outcome != canaryPromote {
+		t.Fatalf("expected promotion after the warm-up, got %d", outcome)
+	}
+
+	s.record("bad", false, 401, now)
+	s.record("bad", true, 0, now)
+	s.record("bad", true, 0, now)
+	outcome, status := s.record("bad", false, 502, now)
+	if outcome != canaryFail || status.Failures != 2 || status.FailureRate != 0.5 {
+		t.Fatalf("expected the canary to fail at 50%% failures, got %d %+v", outcome, status)
+	}
+	if len(s.entries) != 0 {
+		t.Fatalf("finished canaries still tracked: %+v", s.entries)
+	}
+}
+
+func TestManagerCanaryDisablesFailingCredential(t *testing.T) {
+	m := NewManager(nil, nil, nil)
+	m.SetCredentialCanary(CanaryConfig{Enabled: true, MinRequests: 2})
+	if _, err := m.Register(context.Background(), &Auth{ID: "x", Provider: "gemini"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	m.StartCanary("x")
+	if states := m.Canaries(); len(states) != 1 || states[0].Provider != "gemini" {
+		t.Fatalf("unexpected canaries: %+v", states)
+	}
+
+	received := make(chan events.Event, 1)
+	unsubscribe := events.Subscribe(func(evt events.Event) { received <- evt }, events.CanaryFailed)
+	defer unsubscribe()
+	for i := 0; i < 2; i++ {
+		m.MarkResult(context.Background(), Result{AuthID: "x", Provider: "gemini", Error: &Error{HTTPStatus: 429}})
+	}
+	select {
+	case evt := <-received:
+		if evt.AuthID != "x" {
+			t.Fatalf("unexpected event %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a canary failed event")
+	}
+	if auth, _ := m.GetByID("x"); auth == nil || !auth.Disabled || auth.Status != StatusDisabled {
+		t.Fatalf("expected the failed canary to be disabled, got %+v", auth)
+	}
+	if states := m.Canaries(); len(states) != 0 {
+		t.Fatalf("failed canary still listed: %+v", states)
+	}
+
+	m.SetCredentialCanary(CanaryConfig{Enabled: false})
+	m.StartCanary("x")
+	if states := m.Canaries(); len(states) != 0 {
+		t.Fatalf("canary started while disabled: %+v", states)
+	}
+}
@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+// ConcurrencyConfig bounds how many requests may be in flight on a single credential,
+// so one client cannot monopolize a shared OAuth account. Requests beyond the limit
+// queue for up to QueueTimeout before the manager moves on to the next credential.
+// Queued requests are granted free slots by priority class, then in arrival order.
+type ConcurrencyConfig struct {
+	// MaxInFlight is the default per-credential limit; 0 disables limiting. A
+	// credential can override it with the "max_concurrency" attribute or metadata key.
+	MaxInFlight int
+	// QueueTimeout bounds how long a request waits for a slot. Defaults to 30s.
+	QueueTimeout time.Duration
+}
+
+// ConcurrencyStatus is a snapshot of one credential's in-flight and queued requests.
+type ConcurrencyStatus struct {
+	AuthID           string           `json:"auth_id"`
+	Limit            int              `json:"limit"`
+	InFlight         int              `json:"in_flight"`
+	Queued           int              `json:"queued"`
+	QueuedByPriority map[Priority]int `json:"queued_by_priority,omitempty"`
+}
+
+// slotWaiter is a queued request; ready is closed once a slot has been granted to it.
+type slotWaiter struct {
+	ready   chan struct{}
+	granted bool
+	since   time.Time
+}
+
+type authSlots struct {
+	limit    int
+	inFlight int
+	waiting  [len(priorityClasses)][]*slotWaiter
+}
+
+type concurrencyLimiter struct {
+	mu    sync.Mutex
+	cfg   ConcurrencyConfig
+	slots map[string]*authSlots
+	waits [len(priorityClasses)]priorityWaitStats
+}
+
+type queueWaitContextKey struct{}
+
+// WithQueueWait records how long the request waited for a free credential slot.
+func WithQueueWait(ctx context.Context, wait time.Duration) context.Context {
+	return context.WithValue(ctx, queueWaitContextKey{}, wait)
+}
+
+// QueueWaitFromContext returns the slot wait time recorded by WithQueueWait.
+func QueueWaitFromContext(ctx context.Context) time.Duration {
+	if ctx == nil {
+		return 0
+	}
+	wait, _ := ctx.Value(queueWaitContextKey{}).(time.Duration)
+	return wait
+}
+
+// SetConcurrencyLimit updates the per-credential concurrency settings. Requests
+// already holding a slot keep it; new limits apply to subsequent acquisitions.
+func (m *Manager) SetConcurrencyLimit(cfg ConcurrencyConfig) {
+	if m == nil {
+		return
+	}
+	if cfg.MaxInFlight < 0 {
+		cfg.MaxInFlight = 0
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = 30 * time.Second
+	}
+	m.concurrency.mu.Lock()
+	m.concurrency.cfg = cfg
+	m.concurrency.mu.Unlock()
+}
+
+// ConcurrencyStatuses returns the slot usage of every credential that has served a
+// limited request.
+func (m *Manager) ConcurrencyStatuses() []ConcurrencyStatus {
+	m.concurrency.mu.Lock()
+	defer m.concurrency.mu.Unlock()
+	out := make([]ConcurrencyStatus, 0, len(m.concurrency.slots))
+	for id, s := range m.concurrency.slots {
+		status := ConcurrencyStatus{AuthID: id, Limit: s.limit, InFlight: s.inFlight}
+		for rank, queue := range s.waiting {
+			if len(queue) == 0 {
+				continue
+			}
+			if status.QueuedByPriority == nil {
+				status.QueuedByPriority = make(map[Priority]int, len(priorityClasses))
+			}
+			status.QueuedByPriority[priorityClasses[rank]] = len(queue)
+			status.Queued += len(queue)
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AuthID < out[j].AuthID })
+	return out
+}
+
+// OldestQueueWait returns how long the longest-waiting request queued for a
+// credential slot has waited so far, or 0 when nothing is queued.
+func (m *Manager) OldestQueueWait() time.Duration {
+	if m == nil {
+		return 0
+	}
+	now := time.Now()
+	var oldest time.Duration
+	m.concurrency.mu.Lock()
+	defer m.concurrency.mu.Unlock()
+	for _, s := range m.concurrency.slots {
+		for _, queue := range s.waiting {
+			// Queues are FIFO, so the head of each class waited longest.
+			if len(queue) > 0 {
+				oldest = max(oldest, now.Sub(queue[0].since))
+			}
+		}
+	}
+	return oldest
+}
+
+// authConcurrencyLimit reads a per-credential override, returning ok=false when unset.
+func authConcurrencyLimit(a *Auth) (int, bool) {
+	if a == nil {
+		return 0, false
+	}
+	if a.Attributes != nil {
+		if raw := strings.TrimSpace(a.Attributes["max_concurrency"]); raw != "" {
+			if n, err := strconv.Atoi(raw); err == nil && n >= 0 {
+				return n, true
+			}
+		}
+	}
+	if a.Metadata != nil {
+		switch v := a.Metadata["max_concurrency"].(type) {
+		case float64:
+			if v >= 0 {
+				return int(v), true
+			}
+		case int:
+			if v >= 0 {
+				return v, true
+			}
+		case string:
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n >= 0 {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// acquireSlot reserves a concurrency slot on auth and returns ctx annotated with the
+// queue wait time. The request queues in the priority class carried by opts. When the
+// slot cannot be obtained, a claimed half-open breaker probe is handed back so another
+// request can probe the credential.
+func (m *Manager) acquireSlot(ctx context.Context, a *Auth, opts cliproxyexecutor.Options) (context.Context, func(), error) {
+	release, wait, err := m.concurrency.acquire(ctx, a, priorityFromOptions(opts))
+	if err != nil {
+		m.breakers.releaseProbe(a.ID)
+		return ctx, nil, err
+	}
+	if wait > 0 {
+		ctx = WithQueueWait(ctx, wait)
+	}
+	return ctx, release, nil
+}
+
+// acquire reserves an in-flight slot on auth, waiting up to the queue timeout. The
+// returned release must be called once the request (or stream) has finished.
+// Strict priority ordering may hold low-priority requests back until they time out
+// while higher classes keep the credential saturated.
+func (l *concurrencyLimiter) acquire(ctx context.Context, a *Auth, priority Priority) (func(), time.Duration, error) {
+	l.mu.Lock()
+	limit := l.cfg.MaxInFlight
+	if override, ok := authConcurrencyLimit(a); ok {
+		limit = override
+	}
+	if limit <= 0 {
+		l.mu.Unlock()
+		return func() {}, 0, nil
+	}
+	s := l.slots[a.ID]
+	if s == nil {
+		if l.slots == nil {
+			l.slots = make(map[string]*authSlots)
+		}
+		s = &authSlots{}
+		l.slots[a.ID] = s
+	}
+	// A raised limit admits queued requests right away; a lowered one takes effect
+	// as in-flight requests finish.
+	s.limit = limit
+	s.dispatch()
+	rank := priority.rank()
+	if s.inFlight < s.limit {
+		s.inFlight++
+		l.waits[rank].acquired++
+		l.mu.Unlock()
+		return l.releaser(s), 0, nil
+	}
+	w := &slotWaiter{ready: make(chan struct{}), since: time.Now()}
+	s.waiting[rank] = append(s.waiting[rank], w)
+	timeout := l.cfg.QueueTimeout
+	l.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+		wait := time.Since(start)
+		l.mu.Lock()
+		l.recordWait(rank, wait)
+		l.mu.Unlock()
+		return l.releaser(s), wait, nil
+	case <-timer.C:
+		err = &Error{
+			Code:       "concurrency_limit",
+			Message:    fmt.Sprintf("credential %s has %d requests in flight", a.ID, limit),
+			Retryable:  true,
+			HTTPStatus: http.StatusTooManyRequests,
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	wait := time.Since(start)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		// The slot was granted while giving up; hand it to the next waiter.
+		s.inFlight--
+		s.dispatch()
+	} else {
+		s.remove(rank, w)
+	}
+	if ctx.Err() == nil {
+		l.waits[rank].timeouts++
+	}
+	return nil, wait, err
+}
+
+func (l *concurrencyLimiter) recordWait(rank int, wait time.Duration) {
+	stats := &l.waits[rank]
+	stats.acquired++
+	stats.waited++
+	stats.totalWait += wait
+	if wait > stats.maxWait {
+		stats.maxWait = wait
+	}
+}
+
+// releaser returns an idempotent function freeing one slot of s.
+func (l *concurrencyLimiter) releaser(s *authSlots) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			s.inFlight--
+			s.dispatch()
+			l.mu.Unlock()
+		})
+	}
+}
+
+// dispatch grants free slots to queued requests, highest priority first and FIFO
+// within a class. The limiter lock must be held.
+func (s *authSlots) dispatch() {
+	for s.inFlight < s.limit {
+		w := s.next()
+		if w == nil {
+			return
+		}
+		w.granted = true
+		s.inFlight++
+		close(w.ready)
+	}
+}
+
+func (s *authSlots) next() *slotWaiter {
+	for rank, queue := range s.waiting {
+		if len(queue) == 0 {
+			continue
+		}
+		w := queue[0]
+		queue[0] = nil
+		s.waiting[rank] = queue[1:]
+		return w
+	}
+	return nil
+}
+
+func (s *authSlots) remove(rank int, w *slotWaiter) {
+	queue := s.waiting[rank]
+	for i, candidate := range queue {
+		if candidate == w {
+			s.waiting[rank] = append(queue[:i], queue[i+1:]...)
+			return
+		}
+	}
+}
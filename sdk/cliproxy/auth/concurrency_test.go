@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+func TestConcurrencyLimiterQueuesAndTimesOut(t *testing.T) {
+	m := NewManager(nil, nil, nil)
+	m.SetConcurrencyLimit(ConcurrencyConfig{MaxInFlight: 1, QueueTimeout: 50 * time.Millisecond})
+	a := &Auth{ID: "a"}
+
+	ctx, release, err := m.acquireSlot(context.Background(), a, cliproxyexecutor.Options{})
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	if QueueWaitFromContext(ctx) != 0 {
+		t.Fatalf("unexpected queue wait for a free slot")
+	}
+
+	_, _, err = m.acquireSlot(context.Background(), a, cliproxyexecutor.Options{})
+	var authErr *Error
+	if !errors.As(err, &authErr) || authErr.Code != "concurrency_limit" {
+		t.Fatalf("expected concurrency_limit error, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	ctx, release2, err := m.acquireSlot(context.Background(), a, cliproxyexecutor.Options{})
+	if err != nil {
+		t.Fatalf("queued acquire: %v", err)
+	}
+	if QueueWaitFromContext(ctx) <= 0 {
+		t.Fatalf("expected queue wait to be recorded")
+	}
+	release2()
+	release2()
+	if st := m.ConcurrencyStatuses(); len(st) != 1 || st[0].InFlight != 0 {
+		t.Fatalf("unexpected status after release: %+v", st)
+	}
+}
+
+func TestConcurrencyLimitAuthOverride(t *testing.T) {
+	m := NewManager(nil, nil, nil)
+	m.SetConcurrencyLimit(ConcurrencyConfig{MaxInFlight: 1, QueueTimeout: 10 * time.Millisecond})
+	a := &Auth{ID: "b", Metadata: map[string]any{"max_concurrency": float64(2)}}
+	for i := 0; i < 2; i++ {
+		if _, _, err := m.acquireSlot(context.Background(), a, cliproxyexecutor.Options{}); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	unlimited := &Auth{ID: "c", Attributes: map[string]string{"max_concurrency": "0"}}
+	for i := 0; i < 3; i++ {
+		if _, _, err := m.acquireSlot(context.Background(), unlimited, cliproxyexecutor.Options{}); err != nil {
+			t.Fatalf("unlimited acquire %d: %v", i, err)
+		}
+	}
+}
+
+func TestConcurrencyLimiterDequeuesByPriority(t *testing.T) {
+	m := NewManager(nil, nil, nil)
+	m.SetConcurrencyLimit(ConcurrencyConfig{MaxInFlight: 1, QueueTimeout: time.Second})
+	a := &Auth{ID: "p"}
+	_, release, err := m.acquireSlot(context.Background(), a, cliproxyexecutor.Options{})
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	order := make(chan Priority, 3)
+	for _, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		opts := cliproxyexecutor.Options{Metadata: map[string]any{PriorityMetadataKey: string(p)}}
+		go func(p Priority) {
+			_, rel, errAcquire := m.acquireSlot(context.Background(), a, opts)
+			if errAcquire != nil {
+				t.Errorf("%s acquire: %v", p, errAcquire)
+				order <- ""
+				return
+			}
+			order <- p
+			rel()
+		}(p)
+		waitForQueued(t, m, p)
+	}
+	if st := m.ConcurrencyStatuses(); len(st) != 1 || st[0].Queued != 3 || st[0].QueuedByPriority[PriorityHigh] != 1 {
+		t.Fatalf("unexpected status while queued: %+v", st)
+	}
+
+	release()
+	for _, want := range []Priority{PriorityHigh, PriorityNormal, PriorityLow} {
+		if got := <-order; got != want {
+			t.Fatalf("dequeued %q, want %q", got, want)
+		}
+	}
+	for _, st := range m.PriorityQueueStats() {
+		if st.Waited != 1 || st.Queued != 0 || st.Timeouts != 0 {
+			t.Fatalf("unexpected %s stats: %+v", st.Priority, st)
+		}
+	}
+}
+
+func waitForQueued(t *testing.T, m *Manager, p Priority) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, st := range m.PriorityQueueStats() {
+			if st.Priority == p && st.Queued == 1 {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s request never queued", p)
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+// EmbeddingExecutor is an optional interface implemented by provider executors whose
+// upstream offers an embeddings API. Requests and responses use the OpenAI
+// /v1/embeddings format; executors translate to the provider's native API.
+type EmbeddingExecutor interface {
+	Embed(ctx context.Context, auth *Auth, req cliproxyexecutor.Request, opts cliproxyexecutor.Options) (cliproxyexecutor.Response, error)
+}
+
+// ExecuteEmbeddings runs an embeddings request against the providers able to serve it,
+// rotating credentials and retrying the same way as Execute. Providers whose executor
+// does not implement EmbeddingExecutor are skipped.
+func (m *Manager) ExecuteEmbeddings(ctx context.Context, providers []string, req cliproxyexecutor.Request, opts cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	normalized := m.embeddingProviders(m.normalizeProviders(providers))
+	if len(normalized) == 0 {
+		return cliproxyexecutor.Response{}, &Error{Code: "not_supported", Message: "no provider supports embeddings for model " + req.Model, HTTPStatus: http.StatusBadRequest}
+	}
+	rotated := m.rotateProviders(req.Model, normalized)
+	defer m.advanceProviderCursor(req.Model, normalized)
+
+	retryTimes, maxWait := m.retrySettings()
+	attempts := retryTimes + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		resp, errExec := m.executeProvidersOnce(ctx, rotated, func(execCtx context.Context, provider string) (cliproxyexecutor.Response, error) {
+			return m.executeUnaryWithProvider(execCtx, provider, req, opts, func(callCtx context.Context, executor ProviderExecutor, auth *Auth, execReq cliproxyexecutor.Request) (cliproxyexecutor.Response, error) {
+				embedder, ok := executor.(EmbeddingExecutor)
+				if !ok {
+					return cliproxyexecutor.Response{}, &Error{Code: "not_supported", Message: "provider " + provider + " does not support embeddings", HTTPStatus: http.StatusBadRequest}
+				}
+				return embedder.Embed(callCtx, auth, execReq, opts)
+			})
+		})
+		if errExec == nil {
+			return resp, nil
+		}
+		lastErr = errExec
+		wait, shouldRetry := m.shouldRetryAfterError(errExec, attempt, attempts, rotated, req.Model, maxWait)
+		if !shouldRetry {
+			break
+		}
+		if errWait := waitForCooldown(ctx, wait); errWait != nil {
+			return cliproxyexecutor.Response{}, errWait
+		}
+	}
+	if lastErr != nil {
+		return cliproxyexecutor.Response{}, lastErr
+	}
+	return cliproxyexecutor.Response{}, &Error{Code: "auth_not_found", Message: "no auth available"}
+}
+
+// embeddingProviders filters providers down to those whose registered executor
+// implements EmbeddingExecutor.
+func (m *Manager) embeddingProviders(providers []string) []string {
+	if len(providers) == 0 {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		if _, ok := m.executors[provider].(EmbeddingExecutor); ok {
+			out = append(out, provider)
+		}
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+type chatOnlyExecutor struct{ provider string }
+
+func (e chatOnlyExecutor) Identifier() string { return e.provider }
+
+func (e chatOnlyExecutor) Execute(context.Context, *Auth, cliproxyexecutor.Request, cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	return cliproxyexecutor.Response{Payload: []byte("chat")}, nil
+}
+
+func (e chatOnlyExecutor) ExecuteStream(context.Context, *Auth, cliproxyexecutor.Request, cliproxyexecutor.Options) (<-chan cliproxyexecutor.StreamChunk, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (e chatOnlyExecutor) Refresh(_ context.Context, auth *Auth) (*Auth, error) { return auth, nil }
+
+func (e chatOnlyExecutor) CountTokens(context.Context, *Auth, cliproxyexecutor.Request, cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	return cliproxyexecutor.Response{}, nil
+}
+
+type embeddingExecutor struct {
+	chatOnlyExecutor
+	calls []string
+}
+
+func (e *embeddingExecutor) Embed(_ context.Context, auth *Auth, req cliproxyexecutor.Request, _ cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	e.calls = append(e.calls, auth.ID)
+	return cliproxyexecutor.Response{Payload: []byte("embedded " + req.Model)}, nil
+}
+
+func TestExecuteEmbeddingsSkipsProvidersWithoutEmbed(t *testing.T) {
+	const model = "test-embedding-model"
+	m := NewManager(nil, nil, nil)
+	embedder := &embeddingExecutor{chatOnlyExecutor: chatOnlyExecutor{provider: "embedder"}}
+	m.RegisterExecutor(chatOnlyExecutor{provider: "chat"})
+	m.RegisterExecutor(embedder)
+
+	reg := registry.GetGlobalRegistry()
+	for _, a := range []*Auth{{ID: "embed-chat", Provider: "chat"}, {ID: "embed-embedder", Provider: "embedder"}} {
+		if _, err := m.Register(context.Background(), a); err != nil {
+			t.Fatalf("register %s: %v", a.ID, err)
+		}
+		reg.RegisterClient(a.ID, a.Provider, []*registry.ModelInfo{{ID: model}})
+		t.Cleanup(func() { reg.UnregisterClient(a.ID) })
+	}
+
+	resp, err := m.ExecuteEmbeddings(context.Background(), []string{"chat", "embedder"}, cliproxyexecutor.Request{Model: model}, cliproxyexecutor.Options{})
+	if err != nil {
+		t.Fatalf("ExecuteEmbeddings: %v", err)
+	}
+	if string(resp.Payload) != "embedded "+model {
+		t.Fatalf("unexpected payload %q", resp.Payload)
+	}
+	if len(embedder.calls) != 1 || embedder.calls[0] != "embed-embedder" {
+		t.Fatalf("unexpected embed calls %v", embedder.calls)
+	}
+
+	_, err = m.ExecuteEmbeddings(context.Background(), []string{"chat"}, cliproxyexecutor.Request{Model: model}, cliproxyexecutor.Options{})
+	var authErr *Error
+	if !errors.As(err, &authErr) || authErr.Code != "not_supported" || authErr.StatusCode() != 400 {
+		t.Fatalf("expected not_supported error, got %v", err)
+	}
+}
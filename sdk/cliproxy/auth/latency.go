@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+// LatencyConfig controls latency-based routing. While enabled, requests go to the
+// credential with the lowest p95 latency for the requested model over Window, and
+// providers serving the same model are tried fastest first. Routing falls back to
+// round-robin as long as any candidate has fewer than MinSamples recent requests.
+type LatencyConfig struct {
+	Enabled    bool
+	Window     time.Duration
+	MinSamples int
+}
+
+// LatencyStatus is the recent latency of one credential serving one model.
+type LatencyStatus struct {
+	Provider string `json:"provider"`
+	AuthID   string `json:"auth_id"`
+	Model    string `json:"model"`
+	Samples  int    `json:"samples"`
+	P50Ms    int64  `json:"p50_ms"`
+	P95Ms    int64  `json:"p95_ms"`
+}
+
+const (
+	// maxLatencySamples bounds the samples kept per credential and model.
+	maxLatencySamples = 256
+	// latencyTolerance shares traffic between credentials whose p95 is within this
+	// fraction of the fastest one, so near-equal credentials do not herd onto one.
+	latencyTolerance = 0.1
+)
+
+type latencyKey struct {
+	authID string
+	model  string
+}
+
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+type latencyWindow struct {
+	provider string
+	samples  []latencySample
+}
+
+// latencyTracker holds recent request latencies fed by usage records. It is shared
+// by every manager in the process because usage plugins are registered globally.
+type latencyTracker struct {
+	mu      sync.Mutex
+	windows map[latencyKey]*latencyWindow
+}
+
+var latencyStats = &latencyTracker{}
+
+type latencyPlugin struct{}
+
+func init() {
+	coreusage.RegisterPlugin(latencyPlugin{})
+}
+
+// HandleUsage records the latency of successful requests. Failed requests are left
+// out, since fast failures would make a broken credential look attractive.
+func (latencyPlugin) HandleUsage(_ context.Context, record coreusage.Record) {
+	if record.Failed || record.AuthID == "" || record.Latency <= 0 {
+		return
+	}
+	latencyStats.observe(record.Provider, record.AuthID, record.Model, record.Latency, time.Now())
+}
+
+func (t *latencyTracker) observe(provider, authID, model string, latency time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.windows == nil {
+		t.windows = make(map[latencyKey]*latencyWindow)
+	}
+	key := latencyKey{authID: authID, model: model}
+	w := t.windows[key]
+	if w == nil {
+		w = &latencyWindow{provider: provider}
+		t.windows[key] = w
+	}
+	if len(w.samples) >= maxLatencySamples {
+		w.samples = slices.Delete(w.samples, 0, len(w.samples)-maxLatencySamples+1)
+	}
+	w.samples = append(w.samples, latencySample{at: now, latency: latency})
+}
+
+// recent returns the latencies of authID for model observed at or after since.
+func (t *latencyTracker) recent(authID, model string, since time.Time) []time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := t.windows[latencyKey{authID: authID, model: model}]
+	if w == nil {
+		return nil
+	}
+	return w.since(since)
+}
+
+// recentByProvider returns the latencies of every credential of provider for model
+// observed at or after since.
+func (t *latencyTracker) recentByProvider(provider, model string, since time.Time) []time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []time.Duration
+	for key, w := range t.windows {
+		if key.model == model && w.provider == provider {
+			out = append(out, w.since(since)...)
+		}
+	}
+	return out
+}
+
+func (w *latencyWindow) since(since time.Time) []time.Duration {
+	out := make([]time.Duration, 0, len(w.samples))
+	for _, s := range w.samples {
+		if !s.at.Before(since) {
+			out = append(out, s.latency)
+		}
+	}
+	return out
+}
+
+// latencyPercentile returns the q-th percentile (0-1) of samples, nearest rank.
+func latencyPercentile(samples []time.Duration, q float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	rank := int(q*float64(len(sorted))+0.999999) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+type latencyRouter struct {
+	mu  sync.RWMutex
+	cfg LatencyConfig
+}
+
+func normalizeLatencyConfig(cfg LatencyConfig) LatencyConfig {
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Minute
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 10
+	}
+	return cfg
+}
+
+// SetLatencyRouting updates the latency-based routing settings.
+func (m *Manager) SetLatencyRouting(cfg LatencyConfig) {
+	if m == nil {
+		return
+	}
+	m.latency.mu.Lock()
+	m.latency.cfg = normalizeLatencyConfig(cfg)
+	m.latency.mu.Unlock()
+}
+
+// LatencyStats returns the recent latency of every credential known to the manager,
+// per model, over the configured window.
+func (m *Manager) LatencyStats() []LatencyStatus {
+	m.latency.mu.RLock()
+	window := normalizeLatencyConfig(m.latency.cfg).Window
+	m.latency.mu.RUnlock()
+	m.mu.RLock()
+	known := make(map[string]struct{}, len(m.auths))
+	for id := range m.auths {
+		known[id] = struct{}{}
+	}
+	m.mu.RUnlock()
+
+	since := time.Now().Add(-window)
+	latencyStats.mu.Lock()
+	out := make([]LatencyStatus, 0, len(latencyStats.windows))
+	for key, w := range latencyStats.windows {
+		if _, ok := known[key.authID]; !ok {
+			continue
+		}
+		samples := w.since(since)
+		if len(samples) == 0 {
+			continue
+		}
+		out = append(out, LatencyStatus{
+			Provider: w.provider,
+			AuthID:   key.authID,
+			Model:    key.model,
+			Samples:  len(samples),
+			P50Ms:    latencyPercentile(samples, 0.5).Milliseconds(),
+			P95Ms:    latencyPercentile(samples, 0.95).Milliseconds(),
+		})
+	}
+	latencyStats.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Model != out[j].Model {
+			return out[i].Model < out[j].Model
+		}
+		if out[i].P95Ms != out[j].P95Ms {
+			return out[i].P95Ms < out[j].P95Ms
+		}
+		return out[i].AuthID < out[j].AuthID
+	})
+	return out
+}
+
+// route narrows candidates to the credentials with the lowest p95 latency for model.
+// Candidates are returned unchanged while routing is disabled, fewer than two are
+// usable, or any usable candidate has too few recent samples to judge.
+func (r *latencyRouter) route(model string, candidates []*Auth, now time.Time) []*Auth {
+	r.mu.RLock()
+	cfg := r.cfg
+	r.mu.RUnlock()
+	if !cfg.Enabled || len(candidates) < 2 {
+		return candidates
+	}
+	since := now.Add(-cfg.Window)
+	type ranked struct {
+		auth *Auth
+		p95  time.Duration
+	}
+	usable := make([]ranked, 0, len(candidates))
+	for _, candidate := range candidates {
+		if blocked, _, _ := isAuthBlockedForModel(candidate, model, now); blocked {
+			continue
+		}
+		samples := latencyStats.recent(candidate.ID, model, since)
+		if len(samples) < cfg.MinSamples {
+			return candidates
+		}
+		usable = append(usable, ranked{auth: candidate, p95: latencyPercentile(samples, 0.95)})
+	}
+	if len(usable) < 2 {
+		return candidates
+	}
+	best := usable[0].p95
+	for _, u := range usable[1:] {
+		best = min(best, u.p95)
+	}
+	limit := best + time.Duration(float64(best)*latencyTolerance)
+	fastest := make([]*Auth, 0, len(usable))
+	for _, u := range usable {
+		if u.p95 <= limit {
+			fastest = append(fastest, u.auth)
+		}
+	}
+	return fastest
+}
+
+// orderProviders sorts providers by the p95 latency of their credentials for model,
+// keeping the given order while routing is disabled or any provider lacks samples.
+func (r *latencyRouter) orderProviders(model string, providers []string, now time.Time) []string {
+	r.mu.RLock()
+	cfg := r.cfg
+	r.mu.RUnlock()
+	if !cfg.Enabled || len(providers) < 2 {
+		return providers
+	}
+	since := now.Add(-cfg.Window)
+	p95 := make(map[string]time.Duration, len(providers))
+	for _, provider := range providers {
+		samples := latencyStats.recentByProvider(provider, model, since)
+		if len(samples) < cfg.MinSamples {
+			return providers
+		}
+		p95[provider] = latencyPercentile(samples, 0.95)
+	}
+	ordered := slices.Clone(providers)
+	sort.SliceStable(ordered, func(i, j int) bool { return p95[ordered[i]] < p95[ordered[j]] })
+	return ordered
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coreusage "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
+)
+
+func TestLatencyRoutePrefersLowestP95(t *testing.T) {
+	now := time.Now()
+	r := &latencyRouter{cfg: normalizeLatencyConfig(LatencyConfig{Enabled: true, MinSamples: 3})}
+	candidates := []*Auth{{ID: "lat-fast"}, {ID: "lat-slow"}, {ID: "lat-close"}}
+
+	for i := 0; i < 3; i++ {
+		latencyStats.observe("claude", "lat-fast", "lat-model", 100*time.Millisecond, now)
+		latencyStats.observe("claude", "lat-slow", "lat-model", 900*time.Millisecond, now)
+	}
+	if routed := r.route("lat-model", candidates, now); len(routed) != 3 {
+		t.Fatalf("expected round-robin while lat-close has no samples, got %d candidates", len(routed))
+	}
+
+	for i := 0; i < 3; i++ {
+		latencyStats.observe("claude", "lat-close", "lat-model", 105*time.Millisecond, now)
+	}
+	routed := r.route("lat-model", candidates, now)
+	if len(routed) != 2 || routed[0].ID != "lat-fast" || routed[1].ID != "lat-close" {
+		t.Fatalf("expected the two fastest credentials, got %+v", routed)
+	}
+
+	if routed = r.route("lat-model", candidates, now.Add(10*time.Minute)); len(routed) != 3 {
+		t.Fatalf("expired samples must fall back to round-robin, got %d candidates", len(routed))
+	}
+	r.cfg.Enabled = false
+	if routed = r.route("lat-model", candidates, now); len(routed) != 3 {
+		t.Fatalf("disabled routing must not narrow candidates, got %d", len(routed))
+	}
+}
+
+func TestLatencyOrderProviders(t *testing.T) {
+	now := time.Now()
+	r := &latencyRouter{cfg: normalizeLatencyConfig(LatencyConfig{Enabled: true, MinSamples: 2})}
+	for i := 0; i < 2; i++ {
+		latencyStats.observe("order-slow", "order-a", "order-model", time.Second, now)
+		latencyStats.observe("order-fast", "order-b", "order-model", 200*time.Millisecond, now)
+	}
+	ordered := r.orderProviders("order-model", []string{"order-slow", "order-fast"}, now)
+	if ordered[0] != "order-fast" || ordered[1] != "order-slow" {
+		t.Fatalf("unexpected provider order %v", ordered)
+	}
+	ordered = r.orderProviders("order-model", []string{"order-slow", "order-none"}, now)
+	if ordered[0] != "order-slow" {
+		t.Fatalf("a provider without samples must keep the given order, got %v", ordered)
+	}
+}
+
+func TestLatencyPluginSkipsFailures(t *testing.T) {
+	plugin := latencyPlugin{}
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "gemini", AuthID: "plugin-auth", Model: "m", Latency: time.Second, Failed: true})
+	plugin.HandleUsage(context.Background(), coreusage.Record{Provider: "gemini", AuthID: "plugin-auth", Model: "m", Latency: 300 * time.Millisecond})
+	samples := latencyStats.recent("plugin-auth", "m", time.Now().Add(-time.Minute))
+	if len(samples) != 1 || samples[0] != 300*time.Millisecond {
+		t.Fatalf("unexpected samples %v", samples)
+	}
+	if p95 := latencyPercentile([]time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, 0.95); p95 != 19 {
+		t.Fatalf("unexpected p95 %v", p95)
+	}
+}
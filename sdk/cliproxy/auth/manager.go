@@ -14,8 +14,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
 	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
-	log "github.com/sirupsen/logrus"
 )
 
 // ProviderExecutor defines the contract required by Manager to execute provider calls.
@@ -105,10 +105,26 @@ type Manager struct {
 	auths     map[string]*Auth
 	// providerOffsets tracks per-model provider rotation state for multi-provider routing.
 	providerOffsets map[string]int
+	// unhealthy records provider/model pairs reported unhealthy on the event bus.
+	unhealthy map[string]struct{}
+	// breakers tracks per-credential circuit breakers for upstream failures.
+	breakers breakerSet
+	// canaries tracks credentials warming up on a share of traffic.
+	canaries canarySet
+	// latency prefers the credentials and providers with the lowest recent p95 latency.
+	latency latencyRouter
+	// concurrency bounds in-flight requests per credential.
+	concurrency concurrencyLimiter
+	// affinity pins conversations to the credential that served them.
+	affinity affinityTable
+	// refreshes tracks proactive refresh settings and per-credential outcomes.
+	refreshes refreshTracker
 
 	// Retry controls request retry behavior.
 	requestRetry     atomic.Int32
 	maxRetryInterval atomic.Int64
+	// rateLimitNoSwitch surfaces upstream 429s to the caller instead of trying another credential.
+	rateLimitNoSwitch atomic.Bool
 
 	// Optional HTTP RoundTripper provider injected by host.
 	rtProvider RoundTripperProvider
@@ -132,6 +148,7 @@ func NewManager(store Store, selector Selector, hook Hook) *Manager {
 		hook:            hook,
 		auths:           make(map[string]*Auth),
 		providerOffsets: make(map[string]int),
+		unhealthy:       make(map[string]struct{}),
 	}
 }
 
@@ -164,6 +181,20 @@ func (m *Manager) SetRetryConfig(retry int, maxRetryInterval time.Duration) {
 	m.maxRetryInterval.Store(maxRetryInterval.Nanoseconds())
 }
 
+// SetRateLimitSwitch controls whether a 429 from one credential is retried on another
+// credential before the error reaches the client. Switching is enabled by default.
+func (m *Manager) SetRateLimitSwitch(enabled bool) {
+	if m == nil {
+		return
+	}
+	m.rateLimitNoSwitch.Store(!enabled)
+}
+
+// surfaceRateLimit reports whether err is a rate limit that must be returned as-is.
+func (m *Manager) surfaceRateLimit(err error) bool {
+	return m.rateLimitNoSwitch.Load() && statusCodeFromError(err) == http.StatusTooManyRequests
+}
+
 // RegisterExecutor registers a provider executor with the manager.
 func (m *Manager) RegisterExecutor(executor ProviderExecutor) {
 	if executor == nil {
@@ -199,6 +230,7 @@ func (m *Manager) Register(ctx context.Context, auth *Auth) (*Auth, error) {
 	m.mu.Unlock()
 	_ = m.persist(ctx, auth)
 	m.hook.OnAuthRegistered(ctx, auth.Clone())
+	events.Publish(events.Event{Type: events.CredentialAdded, Provider: auth.Provider, AuthID: auth.ID})
 	return auth.Clone(), nil
 }
 
@@ -379,20 +411,28 @@ func (m *Manager) executeWithProvider(ctx context.Context, provider string, req
 		proxyInfo := auth.ProxyInfo()
 		if accountType == "api_key" {
 			if proxyInfo != "" {
-				log.Debugf("Use API key %s for model %s %s", util.HideAPIKey(accountInfo), req.Model, proxyInfo)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use API key %s for model %s %s", util.HideAPIKey(accountInfo), req.Model, proxyInfo)
 			} else {
-				log.Debugf("Use API key %s for model %s", util.HideAPIKey(accountInfo), req.Model)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use API key %s for model %s", util.HideAPIKey(accountInfo), req.Model)
 			}
 		} else if accountType == "oauth" {
 			if proxyInfo != "" {
-				log.Debugf("Use OAuth %s for model %s %s", accountInfo, req.Model, proxyInfo)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use OAuth %s for model %s %s", accountInfo, req.Model, proxyInfo)
 			} else {
-				log.Debugf("Use OAuth %s for model %s", accountInfo, req.Model)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use OAuth %s for model %s", accountInfo, req.Model)
 			}
 		}
 
 		tried[auth.ID] = struct{}{}
-		execCtx := ctx
+		slotCtx, release, errSlot := m.acquireSlot(ctx, auth, opts)
+		if errSlot != nil {
+			if ctx.Err() != nil {
+				return cliproxyexecutor.Response{}, errSlot
+			}
+			lastErr = errSlot
+			continue
+		}
+		execCtx := slotCtx
 		if rt := m.roundTripperFor(auth); rt != nil {
 			execCtx = context.WithValue(execCtx, roundTripperContextKey{}, rt)
 			execCtx = context.WithValue(execCtx, "cliproxy.roundtripper", rt)
@@ -400,6 +440,7 @@ func (m *Manager) executeWithProvider(ctx context.Context, provider string, req
 		execReq := req
 		execReq.Model, execReq.Metadata = rewriteModelForAuth(routeModel, req.Metadata, auth)
 		resp, errExec := executor.Execute(execCtx, auth, execReq, opts)
+		release()
 		result := Result{AuthID: auth.ID, Provider: provider, Model: routeModel, Success: errExec == nil}
 		if errExec != nil {
 			result.Error = &Error{Message: errExec.Error()}
@@ -411,6 +452,9 @@ func (m *Manager) executeWithProvider(ctx context.Context, provider string, req
 				result.RetryAfter = ra
 			}
 			m.MarkResult(execCtx, result)
+			if m.surfaceRateLimit(errExec) {
+				return cliproxyexecutor.Response{}, errExec
+			}
 			lastErr = errExec
 			continue
 		}
@@ -420,6 +464,17 @@ func (m *Manager) executeWithProvider(ctx context.Context, provider string, req
 }
 
 func (m *Manager) executeCountWithProvider(ctx context.Context, provider string, req cliproxyexecutor.Request, opts cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	return m.executeUnaryWithProvider(ctx, provider, req, opts, func(execCtx context.Context, executor ProviderExecutor, auth *Auth, execReq cliproxyexecutor.Request) (cliproxyexecutor.Response, error) {
+		return executor.CountTokens(execCtx, auth, execReq, opts)
+	})
+}
+
+// unaryCall performs a single non-streaming executor call for an already selected auth.
+type unaryCall func(ctx context.Context, executor ProviderExecutor, auth *Auth, req cliproxyexecutor.Request) (cliproxyexecutor.Response, error)
+
+// executeUnaryWithProvider rotates through the auths of provider, running call for
+// each until one succeeds, and records every outcome against the auth used.
+func (m *Manager) executeUnaryWithProvider(ctx context.Context, provider string, req cliproxyexecutor.Request, opts cliproxyexecutor.Options, call unaryCall) (cliproxyexecutor.Response, error) {
 	if provider == "" {
 		return cliproxyexecutor.Response{}, &Error{Code: "provider_not_found", Message: "provider identifier is empty"}
 	}
@@ -439,27 +494,36 @@ func (m *Manager) executeCountWithProvider(ctx context.Context, provider string,
 		proxyInfo := auth.ProxyInfo()
 		if accountType == "api_key" {
 			if proxyInfo != "" {
-				log.Debugf("Use API key %s for model %s %s", util.HideAPIKey(accountInfo), req.Model, proxyInfo)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use API key %s for model %s %s", util.HideAPIKey(accountInfo), req.Model, proxyInfo)
 			} else {
-				log.Debugf("Use API key %s for model %s", util.HideAPIKey(accountInfo), req.Model)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use API key %s for model %s", util.HideAPIKey(accountInfo), req.Model)
 			}
 		} else if accountType == "oauth" {
 			if proxyInfo != "" {
-				log.Debugf("Use OAuth %s for model %s %s", accountInfo, req.Model, proxyInfo)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use OAuth %s for model %s %s", accountInfo, req.Model, proxyInfo)
 			} else {
-				log.Debugf("Use OAuth %s for model %s", accountInfo, req.Model)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use OAuth %s for model %s", accountInfo, req.Model)
 			}
 		}
 
 		tried[auth.ID] = struct{}{}
-		execCtx := ctx
+		slotCtx, release, errSlot := m.acquireSlot(ctx, auth, opts)
+		if errSlot != nil {
+			if ctx.Err() != nil {
+				return cliproxyexecutor.Response{}, errSlot
+			}
+			lastErr = errSlot
+			continue
+		}
+		execCtx := slotCtx
 		if rt := m.roundTripperFor(auth); rt != nil {
 			execCtx = context.WithValue(execCtx, roundTripperContextKey{}, rt)
 			execCtx = context.WithValue(execCtx, "cliproxy.roundtripper", rt)
 		}
 		execReq := req
 		execReq.Model, execReq.Metadata = rewriteModelForAuth(routeModel, req.Metadata, auth)
-		resp, errExec := executor.CountTokens(execCtx, auth, execReq, opts)
+		resp, errExec := call(execCtx, executor, auth, execReq)
+		release()
 		result := Result{AuthID: auth.ID, Provider: provider, Model: routeModel, Success: errExec == nil}
 		if errExec != nil {
 			result.Error = &Error{Message: errExec.Error()}
@@ -471,6 +535,9 @@ func (m *Manager) executeCountWithProvider(ctx context.Context, provider string,
 				result.RetryAfter = ra
 			}
 			m.MarkResult(execCtx, result)
+			if m.surfaceRateLimit(errExec) {
+				return cliproxyexecutor.Response{}, errExec
+			}
 			lastErr = errExec
 			continue
 		}
@@ -499,20 +566,28 @@ func (m *Manager) executeStreamWithProvider(ctx context.Context, provider string
 		proxyInfo := auth.ProxyInfo()
 		if accountType == "api_key" {
 			if proxyInfo != "" {
-				log.Debugf("Use API key %s for model %s %s", util.HideAPIKey(accountInfo), req.Model, proxyInfo)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use API key %s for model %s %s", util.HideAPIKey(accountInfo), req.Model, proxyInfo)
 			} else {
-				log.Debugf("Use API key %s for model %s", util.HideAPIKey(accountInfo), req.Model)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use API key %s for model %s", util.HideAPIKey(accountInfo), req.Model)
 			}
 		} else if accountType == "oauth" {
 			if proxyInfo != "" {
-				log.Debugf("Use OAuth %s for model %s %s", accountInfo, req.Model, proxyInfo)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use OAuth %s for model %s %s", accountInfo, req.Model, proxyInfo)
 			} else {
-				log.Debugf("Use OAuth %s for model %s", accountInfo, req.Model)
+				util.ComponentLog(util.LogComponentRouter).Debugf("Use OAuth %s for model %s", accountInfo, req.Model)
 			}
 		}
 
 		tried[auth.ID] = struct{}{}
-		execCtx := ctx
+		slotCtx, release, errSlot := m.acquireSlot(ctx, auth, opts)
+		if errSlot != nil {
+			if ctx.Err() != nil {
+				return nil, errSlot
+			}
+			lastErr = errSlot
+			continue
+		}
+		execCtx := slotCtx
 		if rt := m.roundTripperFor(auth); rt != nil {
 			execCtx = context.WithValue(execCtx, roundTripperContextKey{}, rt)
 			execCtx = context.WithValue(execCtx, "cliproxy.roundtripper", rt)
@@ -521,6 +596,7 @@ func (m *Manager) executeStreamWithProvider(ctx context.Context, provider string
 		execReq.Model, execReq.Metadata = rewriteModelForAuth(routeModel, req.Metadata, auth)
 		chunks, errStream := executor.ExecuteStream(execCtx, auth, execReq, opts)
 		if errStream != nil {
+			release()
 			rerr := &Error{Message: errStream.Error()}
 			var se cliproxyexecutor.StatusError
 			if errors.As(errStream, &se) && se != nil {
@@ -529,12 +605,16 @@ func (m *Manager) executeStreamWithProvider(ctx context.Context, provider string
 			result := Result{AuthID: auth.ID, Provider: provider, Model: routeModel, Success: false, Error: rerr}
 			result.RetryAfter = retryAfterFromError(errStream)
 			m.MarkResult(execCtx, result)
+			if m.surfaceRateLimit(errStream) {
+				return nil, errStream
+			}
 			lastErr = errStream
 			continue
 		}
 		out := make(chan cliproxyexecutor.StreamChunk)
 		go func(streamCtx context.Context, streamAuth *Auth, streamProvider string, streamChunks <-chan cliproxyexecutor.StreamChunk) {
 			defer close(out)
+			defer release()
 			var failed bool
 			for chunk := range streamChunks {
 				if chunk.Err != nil && !failed {
@@ -638,12 +718,12 @@ func (m *Manager) rotateProviders(model string, providers []string) []string {
 		offset = 0
 	}
 	if offset == 0 {
-		return providers
+		return m.latency.orderProviders(model, providers, time.Now())
 	}
 	rotated := make([]string, 0, len(providers))
 	rotated = append(rotated, providers[offset:]...)
 	rotated = append(rotated, providers[:offset]...)
-	return rotated
+	return m.latency.orderProviders(model, rotated, time.Now())
 }
 
 func (m *Manager) advanceProviderCursor(model string, providers []string) {
@@ -719,6 +799,9 @@ func (m *Manager) shouldRetryAfterError(err error, attempt, maxAttempts int, pro
 	if status := statusCodeFromError(err); status == http.StatusOK {
 		return 0, false
 	}
+	if m.surfaceRateLimit(err) {
+		return 0, false
+	}
 	wait, found := m.closestCooldownWait(providers, model)
 	if !found || wait > maxWait {
 		return 0, false
@@ -751,6 +834,9 @@ func (m *Manager) executeProvidersOnce(ctx context.Context, providers []string,
 			return resp, nil
 		}
 		lastErr = errExec
+		if m.surfaceRateLimit(errExec) {
+			break
+		}
 	}
 	if lastErr != nil {
 		return cliproxyexecutor.Response{}, lastErr
@@ -769,6 +855,9 @@ func (m *Manager) executeStreamProvidersOnce(ctx context.Context, providers []st
 			return chunks, nil
 		}
 		lastErr = errExec
+		if m.surfaceRateLimit(errExec) {
+			break
+		}
 	}
 	if lastErr != nil {
 		return nil, lastErr
@@ -787,10 +876,12 @@ func (m *Manager) MarkResult(ctx context.Context, result Result) {
 	suspendReason := ""
 	clearModelQuota := false
 	setModelQuota := false
+	var published []events.Event
 
 	m.mu.Lock()
 	if auth, ok := m.auths[result.AuthID]; ok && auth != nil {
 		now := time.Now()
+		wasBlocked, _, _ := isAuthBlockedForModel(auth, result.Model, now)
 
 		if result.Success {
 			if result.Model != "" {
@@ -843,6 +934,7 @@ func (m *Manager) MarkResult(ctx context.Context, result Result) {
 					backoffLevel := state.Quota.BackoffLevel
 					if result.RetryAfter != nil {
 						next = now.Add(*result.RetryAfter)
+						util.ComponentLog(util.LogComponentRouter).Debugf("auth %s model %s rate limited, honoring upstream retry-after %s", auth.ID, result.Model, *result.RetryAfter)
 					} else {
 						cooldown, nextLevel := nextQuotaCooldown(backoffLevel)
 						if cooldown > 0 {
@@ -852,10 +944,11 @@ func (m *Manager) MarkResult(ctx context.Context, result Result) {
 					}
 					state.NextRetryAfter = next
 					state.Quota = QuotaState{
-						Exceeded:      true,
-						Reason:        "quota",
-						NextRecoverAt: next,
-						BackoffLevel:  backoffLevel,
+						Exceeded:          true,
+						Reason:            "quota",
+						NextRecoverAt:     next,
+						BackoffLevel:      backoffLevel,
+						RetryAfterSeconds: retryAfterSeconds(result.RetryAfter),
 					}
 					suspendReason = "quota"
 					shouldSuspendModel = true
@@ -876,9 +969,20 @@ func (m *Manager) MarkResult(ctx context.Context, result Result) {
 		}
 
 		_ = m.persist(ctx, auth)
+		published = m.healthEventsLocked(auth, result, wasBlocked, now)
 	}
 	m.mu.Unlock()
 
+	if evt := m.breakers.record(result.Provider, result.AuthID, result.Success, statusCodeFromResult(result.Error), time.Now()); evt != nil {
+		published = append(published, *evt)
+	}
+	if evt := m.recordCanary(ctx, result, time.Now()); evt != nil {
+		published = append(published, *evt)
+	}
+	for _, evt := range published {
+		events.Publish(evt)
+	}
+
 	if clearModelQuota && result.Model != "" {
 		registry.GetGlobalRegistry().ClearModelQuotaExceeded(result.AuthID, result.Model)
 	}
@@ -894,6 +998,49 @@ func (m *Manager) MarkResult(ctx context.Context, result Result) {
 	m.hook.OnResult(ctx, result)
 }
 
+// healthEventsLocked derives circuit and provider health transitions caused by a result.
+// Callers must hold m.mu.
+func (m *Manager) healthEventsLocked(auth *Auth, result Result, wasBlocked bool, now time.Time) []events.Event {
+	var out []events.Event
+	blocked, _, next := isAuthBlockedForModel(auth, result.Model, now)
+	switch {
+	case blocked && !wasBlocked:
+		evt := events.Event{Type: events.CircuitOpened, Time: now, Provider: auth.Provider, AuthID: auth.ID, Model: result.Model, Reason: auth.StatusMessage}
+		if !next.IsZero() {
+			evt.Data = map[string]any{"retry_after": next}
+		}
+		out = append(out, evt)
+	case !blocked && wasBlocked:
+		out = append(out, events.Event{Type: events.CircuitClosed, Time: now, Provider: auth.Provider, AuthID: auth.ID, Model: result.Model})
+	}
+
+	if m.unhealthy == nil {
+		m.unhealthy = make(map[string]struct{})
+	}
+	key := auth.Provider + ":" + result.Model
+	_, reported := m.unhealthy[key]
+	if result.Success {
+		if reported {
+			delete(m.unhealthy, key)
+			out = append(out, events.Event{Type: events.ProviderRecovered, Time: now, Provider: auth.Provider, Model: result.Model})
+		}
+		return out
+	}
+	if reported || !blocked {
+		return out
+	}
+	for _, candidate := range m.auths {
+		if candidate == nil || candidate.Provider != auth.Provider || candidate.Disabled || candidate.Status == StatusDisabled {
+			continue
+		}
+		if candidateBlocked, _, _ := isAuthBlockedForModel(candidate, result.Model, now); !candidateBlocked {
+			return out
+		}
+	}
+	m.unhealthy[key] = struct{}{}
+	return append(out, events.Event{Type: events.ProviderUnhealthy, Time: now, Provider: auth.Provider, Model: result.Model, Reason: auth.StatusMessage})
+}
+
 func ensureModelState(auth *Auth, model string) *ModelState {
 	if auth == nil || model == "" {
 		return nil
@@ -1052,8 +1199,8 @@ func retryAfterFromError(err error) *time.Duration {
 	type retryAfterProvider interface {
 		RetryAfter() *time.Duration
 	}
-	rap, ok := err.(retryAfterProvider)
-	if !ok || rap == nil {
+	var rap retryAfterProvider
+	if !errors.As(err, &rap) || rap == nil {
 		return nil
 	}
 	retryAfter := rap.RetryAfter()
@@ -1064,6 +1211,14 @@ func retryAfterFromError(err error) *time.Duration {
 	return &val
 }
 
+// retryAfterSeconds rounds an upstream retry hint up to whole seconds for reporting.
+func retryAfterSeconds(retryAfter *time.Duration) int64 {
+	if retryAfter == nil || *retryAfter <= 0 {
+		return 0
+	}
+	return int64((*retryAfter + time.Second - 1) / time.Second)
+}
+
 func statusCodeFromResult(err *Error) int {
 	if err == nil {
 		return 0
@@ -1110,6 +1265,7 @@ func applyAuthFailureState(auth *Auth, resultErr *Error, retryAfter *time.Durati
 			auth.Quota.BackoffLevel = nextLevel
 		}
 		auth.Quota.NextRecoverAt = next
+		auth.Quota.RetryAfterSeconds = retryAfterSeconds(retryAfter)
 		auth.NextRetryAfter = next
 	case 408, 500, 502, 503, 504:
 		auth.StatusMessage = "transient upstream error"
@@ -1166,6 +1322,49 @@ func (m *Manager) GetByID(id string) (*Auth, bool) {
 }
 
 func (m *Manager) pickNext(ctx context.Context, provider, model string, opts cliproxyexecutor.Options, tried map[string]struct{}) (*Auth, ProviderExecutor, error) {
+	affinityKey := m.affinityKey(provider, opts)
+	boundID := m.affinity.lookup(ctx, affinityKey, time.Now())
+	skipped, lostProbes := tried, 0
+	for {
+		authCopy, executor, err := m.pickCandidate(ctx, provider, model, opts, skipped, boundID)
+		if err != nil {
+			var authErr *Error
+			if lostProbes > 0 && errors.As(err, &authErr) && authErr.Code == "auth_not_found" {
+				return nil, nil, &Error{Code: "circuit_open", Message: "circuit breaker open for all " + provider + " credentials", Retryable: true, HTTPStatus: 503}
+			}
+			return nil, nil, err
+		}
+		// Reserve the half-open probe slot when the selected credential is recovering.
+		// A concurrent request may have claimed it since the candidates were filtered;
+		// pick another credential then instead of sending a second probe.
+		now := time.Now()
+		if !m.breakers.allows(authCopy.ID, now, true) {
+			if lostProbes == 0 {
+				skipped = make(map[string]struct{}, len(tried)+1)
+				for id := range tried {
+					skipped[id] = struct{}{}
+				}
+			}
+			skipped[authCopy.ID] = struct{}{}
+			lostProbes++
+			continue
+		}
+		if !authCopy.indexAssigned {
+			m.mu.Lock()
+			if current := m.auths[authCopy.ID]; current != nil && !current.indexAssigned {
+				current.EnsureIndex()
+				authCopy = current.Clone()
+			}
+			m.mu.Unlock()
+		}
+		m.affinity.bind(ctx, affinityKey, authCopy.ID, now)
+		return authCopy, executor, nil
+	}
+}
+
+// pickCandidate selects a credential for the request among those not in tried and not
+// blocked by an open circuit breaker.
+func (m *Manager) pickCandidate(ctx context.Context, provider, model string, opts cliproxyexecutor.Options, tried map[string]struct{}, boundID string) (*Auth, ProviderExecutor, error) {
 	m.mu.RLock()
 	executor, okExecutor := m.executors[provider]
 	if !okExecutor {
@@ -1175,6 +1374,8 @@ func (m *Manager) pickNext(ctx context.Context, provider, model string, opts cli
 	candidates := make([]*Auth, 0, len(m.auths))
 	modelKey := strings.TrimSpace(model)
 	registryRef := registry.GetGlobalRegistry()
+	now := time.Now()
+	breakerOpen := 0
 	for _, candidate := range m.auths {
 		if candidate.Provider != provider || candidate.Disabled {
 			continue
@@ -1185,13 +1386,29 @@ func (m *Manager) pickNext(ctx context.Context, provider, model string, opts cli
 		if modelKey != "" && registryRef != nil && !registryRef.ClientSupportsModel(candidate.ID, modelKey) {
 			continue
 		}
+		if !m.breakers.allows(candidate.ID, now, false) {
+			breakerOpen++
+			continue
+		}
 		candidates = append(candidates, candidate)
 	}
 	if len(candidates) == 0 {
 		m.mu.RUnlock()
+		if breakerOpen > 0 {
+			return nil, nil, &Error{Code: "circuit_open", Message: "circuit breaker open for all " + provider + " credentials", Retryable: true, HTTPStatus: 503}
+		}
 		return nil, nil, &Error{Code: "auth_not_found", Message: "no auth available"}
 	}
-	selected, errPick := m.selector.Pick(ctx, provider, model, opts, candidates)
+	routed := m.canaries.route(provider, candidates)
+	if boundID == "" {
+		// Conversations pinned by session affinity keep their credential.
+		routed = m.latency.route(model, routed, now)
+	}
+	selected, errPick := m.pickPreferred(ctx, provider, model, opts, routed, boundID)
+	if errPick != nil && len(routed) < len(candidates) {
+		// The chosen group is cooling down or not shared; fall back to every candidate.
+		selected, errPick = m.pickPreferred(ctx, provider, model, opts, candidates, boundID)
+	}
 	if errPick != nil {
 		m.mu.RUnlock()
 		return nil, nil, errPick
@@ -1202,15 +1419,25 @@ func (m *Manager) pickNext(ctx context.Context, provider, model string, opts cli
 	}
 	authCopy := selected.Clone()
 	m.mu.RUnlock()
-	if !selected.indexAssigned {
-		m.mu.Lock()
-		if current := m.auths[authCopy.ID]; current != nil && !current.indexAssigned {
-			current.EnsureIndex()
-			authCopy = current.Clone()
+	return authCopy, executor, nil
+}
+
+// pickPreferred offers the conversation's bound credential to the selector first, so
+// cooldown and workspace rules still apply, and falls back to the full candidate set
+// when it is not usable.
+func (m *Manager) pickPreferred(ctx context.Context, provider, model string, opts cliproxyexecutor.Options, candidates []*Auth, boundID string) (*Auth, error) {
+	if boundID != "" {
+		for _, candidate := range candidates {
+			if candidate.ID != boundID {
+				continue
+			}
+			if selected, err := m.selector.Pick(ctx, provider, model, opts, []*Auth{candidate}); err == nil && selected != nil {
+				return selected, nil
+			}
+			break
 		}
-		m.mu.Unlock()
 	}
-	return authCopy, executor, nil
+	return m.selector.Pick(ctx, provider, model, opts, candidates)
 }
 
 func (m *Manager) persist(ctx context.Context, auth *Auth) error {
@@ -1278,7 +1505,7 @@ func (m *Manager) checkRefreshes(ctx context.Context) {
 			if !m.shouldRefresh(a, now) {
 				continue
 			}
-			log.Debugf("checking refresh for %s, %s, %s", a.Provider, a.ID, typ)
+			util.ComponentLog(util.LogComponentAuth).Debugf("checking refresh for %s, %s, %s", a.Provider, a.ID, typ)
 
 			if exec := m.executorFor(a.Provider); exec == nil {
 				continue
@@ -1311,49 +1538,8 @@ func (m *Manager) shouldRefresh(a *Auth, now time.Time) bool {
 	if evaluator, ok := a.Runtime.(RefreshEvaluator); ok && evaluator != nil {
 		return evaluator.ShouldRefresh(now, a)
 	}
-
-	lastRefresh := a.LastRefreshedAt
-	if lastRefresh.IsZero() {
-		if ts, ok := authLastRefreshTimestamp(a); ok {
-			lastRefresh = ts
-		}
-	}
-
-	expiry, hasExpiry := a.ExpirationTime()
-
-	if interval := authPreferredInterval(a); interval > 0 {
-		if hasExpiry && !expiry.IsZero() {
-			if !expiry.After(now) {
-				return true
-			}
-			if expiry.Sub(now) <= interval {
-				return true
-			}
-		}
-		if lastRefresh.IsZero() {
-			return true
-		}
-		return now.Sub(lastRefresh) >= interval
-	}
-
-	provider := strings.ToLower(a.Provider)
-	lead := ProviderRefreshLead(provider, a.Runtime)
-	if lead == nil {
-		return false
-	}
-	if *lead <= 0 {
-		if hasExpiry && !expiry.IsZero() {
-			return now.After(expiry)
-		}
-		return false
-	}
-	if hasExpiry && !expiry.IsZero() {
-		return time.Until(expiry) <= *lead
-	}
-	if !lastRefresh.IsZero() {
-		return now.Sub(lastRefresh) >= *lead
-	}
-	return true
+	due, ok := m.refreshDueAt(a)
+	return ok && !now.Before(due)
 }
 
 func authPreferredInterval(a *Auth) time.Duration {
@@ -1533,13 +1719,15 @@ func (m *Manager) refreshAuth(ctx context.Context, id string) {
 		return
 	}
 	cloned := auth.Clone()
+	started := time.Now()
 	updated, err := exec.Refresh(ctx, cloned)
-	log.Debugf("refreshed %s, %s, %v", auth.Provider, auth.ID, err)
+	util.ComponentLog(util.LogComponentAuth).Debugf("refreshed %s, %s, %v", auth.Provider, auth.ID, err)
 	now := time.Now()
 	if err != nil {
+		backoff := m.recordRefreshAttempt(auth, started, err)
 		m.mu.Lock()
 		if current := m.auths[id]; current != nil {
-			current.NextRefreshAfter = now.Add(refreshFailureBackoff)
+			current.NextRefreshAfter = now.Add(backoff)
 			current.LastError = &Error{Message: err.Error()}
 			m.auths[id] = current
 		}
@@ -1559,6 +1747,7 @@ func (m *Manager) refreshAuth(ctx context.Context, id string) {
 	updated.LastError = nil
 	updated.UpdatedAt = now
 	_, _ = m.Update(ctx, updated)
+	m.recordRefreshAttempt(updated, started, nil)
 }
 
 func (m *Manager) executorFor(provider string) ProviderExecutor {
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+// PriorityMetadataKey is the execution metadata key carrying the caller's scheduling class.
+const PriorityMetadataKey = "priority"
+
+// Priority is the scheduling class of a request waiting for a credential slot.
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// priorityClasses lists the classes in dequeue order.
+var priorityClasses = [...]Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ParsePriority converts a configured class name, treating unknown or empty values
+// as PriorityNormal.
+func ParsePriority(raw string) Priority {
+	switch Priority(strings.ToLower(strings.TrimSpace(raw))) {
+	case PriorityHigh:
+		return PriorityHigh
+	case PriorityLow:
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// rank returns the index of p in priorityClasses.
+func (p Priority) rank() int {
+	switch p {
+	case PriorityHigh:
+		return 0
+	case PriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// priorityFromOptions extracts the scheduling class from execution metadata.
+func priorityFromOptions(opts cliproxyexecutor.Options) Priority {
+	if opts.Metadata == nil {
+		return PriorityNormal
+	}
+	raw, _ := opts.Metadata[PriorityMetadataKey].(string)
+	return ParsePriority(raw)
+}
+
+// PriorityQueueStats summarizes credential slot queueing for one scheduling class
+// across all limited credentials.
+type PriorityQueueStats struct {
+	Priority Priority `json:"priority"`
+	// Queued is the number of requests currently waiting for a slot.
+	Queued int `json:"queued"`
+	// Acquired counts slots granted, immediately or after queueing.
+	Acquired uint64 `json:"acquired"`
+	// Waited counts slots granted after queueing; TotalWaitMs and MaxWaitMs cover those waits.
+	Waited      uint64 `json:"waited"`
+	TotalWaitMs int64  `json:"total_wait_ms"`
+	MaxWaitMs   int64  `json:"max_wait_ms"`
+	// Timeouts counts requests that gave up before a slot became free.
+	Timeouts uint64 `json:"timeouts"`
+}
+
+type priorityWaitStats struct {
+	acquired  uint64
+	waited    uint64
+	timeouts  uint64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// PriorityQueueStats returns the queue counters of every scheduling class, highest first.
+func (m *Manager) PriorityQueueStats() []PriorityQueueStats {
+	m.concurrency.mu.Lock()
+	defer m.concurrency.mu.Unlock()
+	out := make([]PriorityQueueStats, len(priorityClasses))
+	for rank, p := range priorityClasses {
+		w := m.concurrency.waits[rank]
+		out[rank] = PriorityQueueStats{
+			Priority:    p,
+			Acquired:    w.acquired,
+			Waited:      w.waited,
+			TotalWaitMs: w.totalWait.Milliseconds(),
+			MaxWaitMs:   w.maxWait.Milliseconds(),
+			Timeouts:    w.timeouts,
+		}
+		for _, s := range m.concurrency.slots {
+			out[rank].Queued += len(s.waiting[rank])
+		}
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/util"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+// RealtimeConn is an upstream connection to an OpenAI Realtime style WebSocket API.
+// Messages use gorilla/websocket message types.
+type RealtimeConn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// RealtimeExecutor is an optional interface implemented by provider executors whose
+// upstream offers the OpenAI Realtime WebSocket API. The returned connection injects
+// the credential and accounts usage for the whole session when it is closed.
+type RealtimeExecutor interface {
+	DialRealtime(ctx context.Context, auth *Auth, req cliproxyexecutor.Request, opts cliproxyexecutor.Options) (RealtimeConn, error)
+}
+
+// RealtimeSession is an established upstream realtime connection. It holds the
+// credential's concurrency slot until Close is called.
+type RealtimeSession struct {
+	RealtimeConn
+	// AuthID and Provider identify the credential serving the session.
+	AuthID   string
+	Provider string
+
+	release   func()
+	closeOnce sync.Once
+}
+
+// Close closes the upstream connection and frees the credential's concurrency slot.
+func (s *RealtimeSession) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.RealtimeConn.Close()
+		if s.release != nil {
+			s.release()
+		}
+	})
+	return err
+}
+
+// DialRealtime opens a realtime session with the first credential that accepts the
+// connection, rotating credentials and retrying the same way as Execute. Failover
+// only applies while connecting: once a session is established it is bound to its
+// credential. Providers whose executor does not implement RealtimeExecutor are skipped.
+func (m *Manager) DialRealtime(ctx context.Context, providers []string, req cliproxyexecutor.Request, opts cliproxyexecutor.Options) (*RealtimeSession, error) {
+	normalized := m.realtimeProviders(m.normalizeProviders(providers))
+	if len(normalized) == 0 {
+		return nil, &Error{Code: "not_supported", Message: "no provider supports realtime sessions for model " + req.Model, HTTPStatus: http.StatusBadRequest}
+	}
+	rotated := m.rotateProviders(req.Model, normalized)
+	defer m.advanceProviderCursor(req.Model, normalized)
+
+	retryTimes, maxWait := m.retrySettings()
+	attempts := retryTimes + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		for _, provider := range rotated {
+			session, errDial := m.dialRealtimeWithProvider(ctx, provider, req, opts)
+			if errDial == nil {
+				return session, nil
+			}
+			lastErr = errDial
+			if m.surfaceRateLimit(errDial) {
+				break
+			}
+		}
+		if lastErr == nil {
+			break
+		}
+		wait, shouldRetry := m.shouldRetryAfterError(lastErr, attempt, attempts, rotated, req.Model, maxWait)
+		if !shouldRetry {
+			break
+		}
+		if errWait := waitForCooldown(ctx, wait); errWait != nil {
+			return nil, errWait
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, &Error{Code: "auth_not_found", Message: "no auth available"}
+}
+
+// dialRealtimeWithProvider rotates through the auths of provider until one accepts
+// the connection, recording every outcome against the auth used.
+func (m *Manager) dialRealtimeWithProvider(ctx context.Context, provider string, req cliproxyexecutor.Request, opts cliproxyexecutor.Options) (*RealtimeSession, error) {
+	routeModel := req.Model
+	tried := make(map[string]struct{})
+	var lastErr error
+	for {
+		auth, executor, errPick := m.pickNext(ctx, provider, routeModel, opts, tried)
+		if errPick != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, errPick
+		}
+		tried[auth.ID] = struct{}{}
+		util.ComponentLog(util.LogComponentRouter).Debugf("Use %s credential %s for realtime model %s", provider, auth.ID, req.Model)
+
+		dialer, ok := executor.(RealtimeExecutor)
+		if !ok {
+			return nil, &Error{Code: "not_supported", Message: "provider " + provider + " does not support realtime sessions", HTTPStatus: http.StatusBadRequest}
+		}
+		slotCtx, release, errSlot := m.acquireSlot(ctx, auth, opts)
+		if errSlot != nil {
+			if ctx.Err() != nil {
+				return nil, errSlot
+			}
+			lastErr = errSlot
+			continue
+		}
+		execCtx := slotCtx
+		if rt := m.roundTripperFor(auth); rt != nil {
+			execCtx = context.WithValue(execCtx, roundTripperContextKey{}, rt)
+			execCtx = context.WithValue(execCtx, "cliproxy.roundtripper", rt)
+		}
+		execReq := req
+		execReq.Model, execReq.Metadata = rewriteModelForAuth(routeModel, req.Metadata, auth)
+		conn, errDial := dialer.DialRealtime(execCtx, auth, execReq, opts)
+		result := Result{AuthID: auth.ID, Provider: provider, Model: routeModel, Success: errDial == nil}
+		if errDial != nil {
+			release()
+			result.Error = &Error{Message: errDial.Error()}
+			var se cliproxyexecutor.StatusError
+			if errors.As(errDial, &se) && se != nil {
+				result.Error.HTTPStatus = se.StatusCode()
+			}
+			result.RetryAfter = retryAfterFromError(errDial)
+			m.MarkResult(execCtx, result)
+			if m.surfaceRateLimit(errDial) {
+				return nil, errDial
+			}
+			lastErr = errDial
+			continue
+		}
+		m.MarkResult(execCtx, result)
+		return &RealtimeSession{RealtimeConn: conn, AuthID: auth.ID, Provider: provider, release: release}, nil
+	}
+}
+
+// realtimeProviders filters providers down to those whose registered executor
+// implements RealtimeExecutor.
+func (m *Manager) realtimeProviders(providers []string) []string {
+	if len(providers) == 0 {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		if _, ok := m.executors[provider].(RealtimeExecutor); ok {
+			out = append(out, provider)
+		}
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+type rejectedDialError struct{ code int }
+
+func (e rejectedDialError) Error() string   { return http.StatusText(e.code) }
+func (e rejectedDialError) StatusCode() int { return e.code }
+
+type fakeRealtimeConn struct{ closed int }
+
+func (c *fakeRealtimeConn) ReadMessage() (int, []byte, error) { return 0, nil, nil }
+func (c *fakeRealtimeConn) WriteMessage(int, []byte) error    { return nil }
+func (c *fakeRealtimeConn) Close() error                      { c.closed++; return nil }
+
+type realtimeExecutor struct {
+	chatOnlyExecutor
+	reject map[string]bool
+	dials  []string
+	conn   *fakeRealtimeConn
+}
+
+func (e *realtimeExecutor) DialRealtime(_ context.Context, auth *Auth, _ cliproxyexecutor.Request, _ cliproxyexecutor.Options) (RealtimeConn, error) {
+	e.dials = append(e.dials, auth.ID)
+	if e.reject[auth.ID] {
+		return nil, rejectedDialError{code: http.StatusUnauthorized}
+	}
+	return e.conn, nil
+}
+
+func TestDialRealtimeFailsOverAndSkipsProvidersWithoutRealtime(t *testing.T) {
+	const model = "test-realtime-model"
+	m := NewManager(nil, nil, nil)
+	rt := &realtimeExecutor{
+		chatOnlyExecutor: chatOnlyExecutor{provider: "rt"},
+		reject:           map[string]bool{"rt-a": true},
+		conn:             &fakeRealtimeConn{},
+	}
+	m.RegisterExecutor(chatOnlyExecutor{provider: "chat"})
+	m.RegisterExecutor(rt)
+
+	reg := registry.GetGlobalRegistry()
+	for _, a := range []*Auth{{ID: "rt-chat", Provider: "chat"}, {ID: "rt-a", Provider: "rt"}, {ID: "rt-b", Provider: "rt"}} {
+		if _, err := m.Register(context.Background(), a); err != nil {
+			t.Fatalf("register %s: %v", a.ID, err)
+		}
+		reg.RegisterClient(a.ID, a.Provider, []*registry.ModelInfo{{ID: model}})
+		t.Cleanup(func() { reg.UnregisterClient(a.ID) })
+	}
+
+	session, err := m.DialRealtime(context.Background(), []string{"chat", "rt"}, cliproxyexecutor.Request{Model: model}, cliproxyexecutor.Options{})
+	if err != nil {
+		t.Fatalf("DialRealtime: %v", err)
+	}
+	if session.AuthID != "rt-b" || session.Provider != "rt" {
+		t.Fatalf("session bound to %s/%s, want rt/rt-b", session.Provider, session.AuthID)
+	}
+	if len(rt.dials) != 2 {
+		t.Fatalf("unexpected dials %v", rt.dials)
+	}
+	_ = session.Close()
+	_ = session.Close()
+	if rt.conn.closed != 1 {
+		t.Fatalf("upstream closed %d times, want 1", rt.conn.closed)
+	}
+
+	_, err = m.DialRealtime(context.Background(), []string{"chat"}, cliproxyexecutor.Request{Model: model}, cliproxyexecutor.Options{})
+	var authErr *Error
+	if !errors.As(err, &authErr) || authErr.Code != "not_supported" {
+		t.Fatalf("expected not_supported error, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+// defaultRefreshMaxBackoff caps the delay between failed refresh attempts.
+const defaultRefreshMaxBackoff = 30 * time.Minute
+
+// RefreshConfig tunes proactive credential refresh.
+type RefreshConfig struct {
+	// JitterFraction widens each credential's refresh lead by a stable share of up to
+	// this fraction of the lead, spreading out renewals of tokens issued together.
+	JitterFraction float64
+	// MaxBackoff caps the delay between failed attempts, which doubles per
+	// consecutive failure. Defaults to 30 minutes.
+	MaxBackoff time.Duration
+}
+
+// RefreshStatus describes the refresh schedule of one OAuth credential.
+type RefreshStatus struct {
+	Provider string `json:"provider"`
+	AuthID   string `json:"auth_id"`
+	Label    string `json:"label,omitempty"`
+	// ExpiresAt is the token expiry recorded in the credential, when known.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// RefreshAt is when the credential becomes due for proactive renewal. It is zero
+	// when the provider does not expose a schedule.
+	RefreshAt time.Time `json:"refresh_at,omitempty"`
+	// RetryAfter holds back the next attempt while a refresh is pending or backing off.
+	RetryAfter          time.Time `json:"retry_after,omitempty"`
+	LastRefreshedAt     time.Time `json:"last_refreshed_at,omitempty"`
+	LastAttemptAt       time.Time `json:"last_attempt_at,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+type refreshState struct {
+	lastAttempt time.Time
+	failures    int
+	lastError   string
+}
+
+type refreshTracker struct {
+	mu     sync.Mutex
+	cfg    RefreshConfig
+	states map[string]*refreshState
+}
+
+// SetRefreshConfig updates the proactive refresh settings.
+func (m *Manager) SetRefreshConfig(cfg RefreshConfig) {
+	if m == nil {
+		return
+	}
+	if cfg.JitterFraction < 0 {
+		cfg.JitterFraction = 0
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultRefreshMaxBackoff
+	}
+	m.refreshes.mu.Lock()
+	m.refreshes.cfg = cfg
+	m.refreshes.mu.Unlock()
+}
+
+// refreshJitter returns the extra lead for a, derived from its ID and expiry so the
+// offset is stable across checks but changes with every new token.
+func (m *Manager) refreshJitter(a *Auth, lead time.Duration, expiry time.Time) time.Duration {
+	m.refreshes.mu.Lock()
+	fraction := m.refreshes.cfg.JitterFraction
+	m.refreshes.mu.Unlock()
+	if fraction <= 0 || lead <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(a.ID))
+	_, _ = h.Write([]byte(strconv.FormatInt(expiry.Unix(), 10)))
+	share := float64(h.Sum64()%10000) / 10000
+	return time.Duration(float64(lead) * fraction * share)
+}
+
+// refreshDueAt returns when a becomes due for a proactive refresh. ok is false when
+// neither the credential nor its provider defines a refresh schedule.
+func (m *Manager) refreshDueAt(a *Auth) (due time.Time, ok bool) {
+	lastRefresh := a.LastRefreshedAt
+	if lastRefresh.IsZero() {
+		if ts, ok := authLastRefreshTimestamp(a); ok {
+			lastRefresh = ts
+		}
+	}
+	expiry, hasExpiry := a.ExpirationTime()
+	hasExpiry = hasExpiry && !expiry.IsZero()
+
+	if interval := authPreferredInterval(a); interval > 0 {
+		if lastRefresh.IsZero() {
+			return time.Time{}, true
+		}
+		due = lastRefresh.Add(interval)
+		if hasExpiry {
+			if byExpiry := expiry.Add(-interval - m.refreshJitter(a, interval, expiry)); byExpiry.Before(due) {
+				due = byExpiry
+			}
+		}
+		return due, true
+	}
+
+	lead := ProviderRefreshLead(a.Provider, a.Runtime)
+	if lead == nil {
+		return time.Time{}, false
+	}
+	if *lead <= 0 {
+		if hasExpiry {
+			return expiry.Add(time.Nanosecond), true
+		}
+		return time.Time{}, false
+	}
+	if hasExpiry {
+		return expiry.Add(-*lead - m.refreshJitter(a, *lead, expiry)), true
+	}
+	if !lastRefresh.IsZero() {
+		return lastRefresh.Add(*lead), true
+	}
+	return time.Time{}, true
+}
+
+// recordRefreshAttempt updates the refresh history of a and publishes the outcome.
+// It returns the backoff before the next attempt after a failure.
+func (m *Manager) recordRefreshAttempt(a *Auth, started time.Time, err error) time.Duration {
+	m.refreshes.mu.Lock()
+	if m.refreshes.states == nil {
+		m.refreshes.states = make(map[string]*refreshState)
+	}
+	state := m.refreshes.states[a.ID]
+	if state == nil {
+		state = &refreshState{}
+		m.refreshes.states[a.ID] = state
+	}
+	state.lastAttempt = started
+	var backoff time.Duration
+	if err == nil {
+		state.failures = 0
+		state.lastError = ""
+	} else {
+		state.failures++
+		state.lastError = err.Error()
+		maxBackoff := m.refreshes.cfg.MaxBackoff
+		if maxBackoff <= 0 {
+			maxBackoff = defaultRefreshMaxBackoff
+		}
+		backoff = refreshFailureBackoff
+		for i := 1; i < state.failures && backoff < maxBackoff; i++ {
+			backoff *= 2
+		}
+		backoff = min(backoff, maxBackoff)
+	}
+	failures := state.failures
+	m.refreshes.mu.Unlock()
+
+	evt := events.Event{
+		Type:     events.CredentialRefreshed,
+		Provider: a.Provider,
+		AuthID:   a.ID,
+		Data:     map[string]any{"duration_ms": time.Since(started).Milliseconds()},
+	}
+	if err != nil {
+		evt.Type = events.CredentialRefreshFailed
+		evt.Reason = err.Error()
+		evt.Data["consecutive_failures"] = failures
+		evt.Data["retry_at"] = started.Add(backoff).UTC().Format(time.RFC3339)
+	} else if expiry, ok := a.ExpirationTime(); ok && !expiry.IsZero() {
+		evt.Data["expires_at"] = expiry.UTC().Format(time.RFC3339)
+	}
+	events.Publish(evt)
+	return backoff
+}
+
+// RefreshSchedule lists every OAuth credential with its expiry, when it is due for
+// proactive renewal and the outcome of recent attempts.
+func (m *Manager) RefreshSchedule() []RefreshStatus {
+	if m == nil {
+		return nil
+	}
+	snapshot := m.snapshotAuths()
+	out := make([]RefreshStatus, 0, len(snapshot))
+	m.refreshes.mu.Lock()
+	states := make(map[string]refreshState, len(m.refreshes.states))
+	for id, s := range m.refreshes.states {
+		states[id] = *s
+	}
+	m.refreshes.mu.Unlock()
+	for _, a := range snapshot {
+		if typ, _ := a.AccountInfo(); typ == "api_key" || a.Disabled {
+			continue
+		}
+		status := RefreshStatus{
+			Provider:        a.Provider,
+			AuthID:          a.ID,
+			Label:           a.Label,
+			RetryAfter:      a.NextRefreshAfter,
+			LastRefreshedAt: a.LastRefreshedAt,
+		}
+		if expiry, ok := a.ExpirationTime(); ok {
+			status.ExpiresAt = expiry
+		}
+		if _, isEvaluator := a.Runtime.(RefreshEvaluator); !isEvaluator {
+			if due, ok := m.refreshDueAt(a); ok && !due.IsZero() {
+				status.RefreshAt = due
+			}
+		}
+		if s, ok := states[a.ID]; ok {
+			status.LastAttemptAt = s.lastAttempt
+			status.ConsecutiveFailures = s.failures
+			status.LastError = s.lastError
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].AuthID < out[j].AuthID
+	})
+	return out
+}
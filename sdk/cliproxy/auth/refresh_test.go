@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+)
+
+type refreshingExecutor struct {
+	chatOnlyExecutor
+	mu  sync.Mutex
+	err error
+}
+
+func (e *refreshingExecutor) Refresh(_ context.Context, auth *Auth) (*Auth, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return nil, e.err
+	}
+	auth.Metadata["expired"] = time.Now().Add(8 * time.Hour).Format(time.RFC3339)
+	return auth, nil
+}
+
+func TestRefreshDueAtAppliesStableJitter(t *testing.T) {
+	lead := time.Hour
+	RegisterRefreshLeadProvider("jitter-test", func() *time.Duration { return &lead })
+	m := NewManager(nil, nil, nil)
+	expiry := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	a := &Auth{ID: "jitter-a", Provider: "jitter-test", Metadata: map[string]any{"expired": expiry.Format(time.RFC3339)}}
+
+	due, ok := m.refreshDueAt(a)
+	if !ok || !due.Equal(expiry.Add(-lead)) {
+		t.Fatalf("expected the plain lead without jitter, got %v (ok=%v)", due, ok)
+	}
+
+	m.SetRefreshConfig(RefreshConfig{JitterFraction: 0.5})
+	due, _ = m.refreshDueAt(a)
+	if due.After(expiry.Add(-lead)) || due.Before(expiry.Add(-lead*3/2)) {
+		t.Fatalf("jittered due time %v outside [%v, %v]", due, expiry.Add(-lead*3/2), expiry.Add(-lead))
+	}
+	if again, _ := m.refreshDueAt(a); !again.Equal(due) {
+		t.Fatalf("expected jitter to be stable between checks, got %v and %v", due, again)
+	}
+	if m.shouldRefresh(a, due.Add(-time.Second)) || !m.shouldRefresh(a, due) {
+		t.Fatalf("expected shouldRefresh to switch at %v", due)
+	}
+}
+
+func TestRefreshAuthBacksOffAndPublishesOutcomes(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []events.Event
+	)
+	unsubscribe := events.Subscribe(func(evt events.Event) {
+		mu.Lock()
+		received = append(received, evt)
+		mu.Unlock()
+	}, events.CredentialRefreshed, events.CredentialRefreshFailed)
+	defer unsubscribe()
+
+	exec := &refreshingExecutor{chatOnlyExecutor: chatOnlyExecutor{provider: "refresh-test"}, err: errors.New("invalid_grant")}
+	m := NewManager(nil, nil, nil)
+	m.SetRefreshConfig(RefreshConfig{MaxBackoff: 8 * time.Minute})
+	m.RegisterExecutor(exec)
+	a := &Auth{ID: "refresh-a", Provider: "refresh-test", Metadata: map[string]any{"type": "oauth"}}
+	if _, err := m.Register(context.Background(), a); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	for attempt, want := range []time.Duration{5 * time.Minute, 8 * time.Minute} {
+		before := time.Now()
+		m.refreshAuth(context.Background(), a.ID)
+		got, _ := m.GetByID(a.ID)
+		if wait := got.NextRefreshAfter.Sub(before); wait < want || wait > want+time.Second {
+			t.Fatalf("attempt %d: expected a %v backoff, got %v", attempt+1, want, wait)
+		}
+	}
+	schedule := m.RefreshSchedule()
+	if len(schedule) != 1 || schedule[0].ConsecutiveFailures != 2 || schedule[0].LastError != "invalid_grant" {
+		t.Fatalf("unexpected schedule: %+v", schedule)
+	}
+
+	exec.mu.Lock()
+	exec.err = nil
+	exec.mu.Unlock()
+	m.refreshAuth(context.Background(), a.ID)
+	schedule = m.RefreshSchedule()
+	if schedule[0].ConsecutiveFailures != 0 || schedule[0].LastError != "" || schedule[0].ExpiresAt.IsZero() {
+		t.Fatalf("expected a successful refresh to reset failures, got %+v", schedule[0])
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n >= 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 || received[0].Type != events.CredentialRefreshFailed || received[0].Reason != "invalid_grant" ||
+		received[1].Data["consecutive_failures"] != 2 || received[2].Type != events.CredentialRefreshed || received[2].Data["expires_at"] == nil {
+		t.Fatalf("unexpected events: %+v", received)
+	}
+}
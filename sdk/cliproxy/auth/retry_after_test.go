@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+type rateLimitError struct{ retryAfter time.Duration }
+
+func (e rateLimitError) Error() string              { return http.StatusText(http.StatusTooManyRequests) }
+func (e rateLimitError) StatusCode() int            { return http.StatusTooManyRequests }
+func (e rateLimitError) RetryAfter() *time.Duration { return &e.retryAfter }
+
+// rateLimitedExecutor rejects the first credential it sees with a 429 and serves the rest.
+type rateLimitedExecutor struct {
+	chatOnlyExecutor
+	retryAfter time.Duration
+	calls      []string
+}
+
+func (e *rateLimitedExecutor) Execute(_ context.Context, auth *Auth, _ cliproxyexecutor.Request, _ cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	e.calls = append(e.calls, auth.ID)
+	if len(e.calls) == 1 {
+		return cliproxyexecutor.Response{}, fmt.Errorf("upstream: %w", rateLimitError{retryAfter: e.retryAfter})
+	}
+	return cliproxyexecutor.Response{Payload: []byte("ok")}, nil
+}
+
+func newRateLimitedManager(t *testing.T, provider, model string) (*Manager, *rateLimitedExecutor) {
+	t.Helper()
+	m := NewManager(nil, nil, nil)
+	exec := &rateLimitedExecutor{chatOnlyExecutor: chatOnlyExecutor{provider: provider}, retryAfter: 42 * time.Second}
+	m.RegisterExecutor(exec)
+	reg := registry.GetGlobalRegistry()
+	for _, id := range []string{provider + "-a", provider + "-b"} {
+		if _, err := m.Register(context.Background(), &Auth{ID: id, Provider: provider}); err != nil {
+			t.Fatalf("register %s: %v", id, err)
+		}
+		reg.RegisterClient(id, provider, []*registry.ModelInfo{{ID: model}})
+		t.Cleanup(func() { reg.UnregisterClient(id) })
+	}
+	return m, exec
+}
+
+func TestExecuteHonorsRetryAfterAndSwitchesCredential(t *testing.T) {
+	const model = "test-retry-after-model"
+	m, exec := newRateLimitedManager(t, "ratelimited", model)
+
+	before := time.Now()
+	resp, err := m.Execute(context.Background(), []string{"ratelimited"}, cliproxyexecutor.Request{Model: model}, cliproxyexecutor.Options{})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if string(resp.Payload) != "ok" || len(exec.calls) != 2 {
+		t.Fatalf("expected failover to a second credential, calls=%v payload=%q", exec.calls, resp.Payload)
+	}
+
+	limited, ok := m.GetByID(exec.calls[0])
+	if !ok {
+		t.Fatalf("auth %s not found", exec.calls[0])
+	}
+	state := limited.ModelStates[model]
+	if state == nil || !state.Quota.Exceeded {
+		t.Fatalf("expected quota state on %s, got %+v", limited.ID, state)
+	}
+	if state.Quota.RetryAfterSeconds != 42 {
+		t.Fatalf("retry_after_seconds = %d, want 42", state.Quota.RetryAfterSeconds)
+	}
+	if d := state.NextRetryAfter.Sub(before); d < 42*time.Second || d > 43*time.Second {
+		t.Fatalf("cooldown = %s, want the upstream 42s", d)
+	}
+}
+
+func TestExecuteSurfacesRateLimitWhenSwitchDisabled(t *testing.T) {
+	const model = "test-retry-after-noswitch-model"
+	m, exec := newRateLimitedManager(t, "ratelimited-noswitch", model)
+	m.SetRateLimitSwitch(false)
+
+	_, err := m.Execute(context.Background(), []string{"ratelimited-noswitch"}, cliproxyexecutor.Request{Model: model}, cliproxyexecutor.Options{})
+	if statusCodeFromError(err) != http.StatusTooManyRequests {
+		t.Fatalf("expected the 429 to reach the caller, got %v", err)
+	}
+	if len(exec.calls) != 1 {
+		t.Fatalf("expected a single attempt, calls=%v", exec.calls)
+	}
+}
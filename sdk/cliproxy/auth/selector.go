@@ -101,10 +101,20 @@ func (e *modelCooldownError) Headers() http.Header {
 // Pick selects the next available auth for the provider in a round-robin manner.
 func (s *RoundRobinSelector) Pick(ctx context.Context, provider, model string, opts cliproxyexecutor.Options, auths []*Auth) (*Auth, error) {
 	_ = ctx
-	_ = opts
 	if len(auths) == 0 {
 		return nil, &Error{Code: "auth_not_found", Message: "no auth candidates"}
 	}
+	if pinned := pinnedAuthFromOptions(opts); pinned != "" {
+		auths = filterAuthsByID(auths, pinned)
+		if len(auths) == 0 {
+			return nil, &Error{Code: "auth_not_found", Message: "pinned auth " + pinned + " is not a candidate", HTTPStatus: http.StatusNotFound}
+		}
+	} else {
+		auths = filterAuthsForWorkspace(auths, workspaceFromOptions(opts))
+		if len(auths) == 0 {
+			return nil, &Error{Code: "auth_not_shared", Message: "no credentials shared with this workspace", HTTPStatus: http.StatusForbidden}
+		}
+	}
 	if s.cursors == nil {
 		s.cursors = make(map[string]int)
 	}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"strings"
+
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+// WorkspaceMetadataKey is the execution metadata key carrying the caller's workspace name.
+const WorkspaceMetadataKey = "workspace"
+
+// PinnedAuthMetadataKey is the execution metadata key restricting selection to one auth ID.
+// It is set by operator tooling such as request replay and bypasses workspace sharing.
+const PinnedAuthMetadataKey = "pinned_auth_id"
+
+// SharingMode controls which workspaces may be served by a credential.
+type SharingMode string
+
+const (
+	// SharingGlobal makes the credential available to every caller (the default).
+	SharingGlobal SharingMode = "global"
+	// SharingRestricted limits the credential to the listed workspaces.
+	SharingRestricted SharingMode = "restricted"
+	// SharingExclusive dedicates the credential to a single workspace.
+	SharingExclusive SharingMode = "exclusive"
+)
+
+// Sharing returns the credential's sharing mode and the workspaces it is bound to.
+// The policy is read from the "sharing" and "workspaces" attributes, falling back to
+// the same keys in the auth file metadata. Unknown modes are treated as restricted so
+// that a typo never widens access.
+func (a *Auth) Sharing() (SharingMode, []string) {
+	if a == nil {
+		return SharingGlobal, nil
+	}
+	rawMode := ""
+	var workspaces []string
+	if a.Attributes != nil {
+		rawMode = a.Attributes["sharing"]
+		workspaces = splitWorkspaces(a.Attributes["workspaces"])
+	}
+	if a.Metadata != nil {
+		if rawMode == "" {
+			rawMode, _ = a.Metadata["sharing"].(string)
+		}
+		if len(workspaces) == 0 {
+			switch v := a.Metadata["workspaces"].(type) {
+			case string:
+				workspaces = splitWorkspaces(v)
+			case []any:
+				for _, item := range v {
+					if s, ok := item.(string); ok {
+						workspaces = append(workspaces, splitWorkspaces(s)...)
+					}
+				}
+			case []string:
+				for _, s := range v {
+					workspaces = append(workspaces, splitWorkspaces(s)...)
+				}
+			}
+		}
+	}
+	switch mode := SharingMode(strings.ToLower(strings.TrimSpace(rawMode))); mode {
+	case "", SharingGlobal:
+		if rawMode == "" && len(workspaces) > 0 {
+			return SharingRestricted, workspaces
+		}
+		return SharingGlobal, nil
+	case SharingExclusive:
+		if len(workspaces) > 1 {
+			workspaces = workspaces[:1]
+		}
+		return SharingExclusive, workspaces
+	default:
+		return SharingRestricted, workspaces
+	}
+}
+
+// AllowsWorkspace reports whether the credential may serve a request from workspace.
+// Requests without a workspace can only use globally shared credentials.
+func (a *Auth) AllowsWorkspace(workspace string) bool {
+	mode, workspaces := a.Sharing()
+	if mode == SharingGlobal {
+		return true
+	}
+	workspace = strings.TrimSpace(workspace)
+	if workspace == "" {
+		return false
+	}
+	for _, allowed := range workspaces {
+		if strings.EqualFold(allowed, workspace) {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceFromOptions extracts the caller's workspace from execution metadata.
+func workspaceFromOptions(opts cliproxyexecutor.Options) string {
+	if opts.Metadata == nil {
+		return ""
+	}
+	workspace, _ := opts.Metadata[WorkspaceMetadataKey].(string)
+	return strings.TrimSpace(workspace)
+}
+
+// pinnedAuthFromOptions extracts the pinned auth ID from execution metadata.
+func pinnedAuthFromOptions(opts cliproxyexecutor.Options) string {
+	if opts.Metadata == nil {
+		return ""
+	}
+	id, _ := opts.Metadata[PinnedAuthMetadataKey].(string)
+	return strings.TrimSpace(id)
+}
+
+// filterAuthsForWorkspace drops credentials that are not shared with workspace.
+func filterAuthsForWorkspace(auths []*Auth, workspace string) []*Auth {
+	allowed := auths[:0:0]
+	for _, candidate := range auths {
+		if candidate.AllowsWorkspace(workspace) {
+			allowed = append(allowed, candidate)
+		}
+	}
+	return allowed
+}
+
+// filterAuthsByID keeps only the credential with the given ID.
+func filterAuthsByID(auths []*Auth, id string) []*Auth {
+	for _, candidate := range auths {
+		if candidate != nil && candidate.ID == id {
+			return []*Auth{candidate}
+		}
+	}
+	return nil
+}
+
+func splitWorkspaces(raw string) []string {
+	parts := strings.Split(raw, ",")
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
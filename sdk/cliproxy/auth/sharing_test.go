@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+)
+
+func TestRoundRobinSelectorEnforcesWorkspaceSharing(t *testing.T) {
+	shared := &Auth{ID: "a-shared", Provider: "claude"}
+	teamA := &Auth{ID: "b-team-a", Provider: "claude", Metadata: map[string]any{"sharing": "exclusive", "workspaces": []any{"team-a"}}}
+	teamsBC := &Auth{ID: "c-teams-bc", Provider: "claude", Attributes: map[string]string{"sharing": "restricted", "workspaces": "team-b, team-c"}}
+	auths := []*Auth{shared, teamA, teamsBC}
+
+	cases := []struct {
+		workspace string
+		want      map[string]bool
+	}{
+		{workspace: "", want: map[string]bool{"a-shared": true}},
+		{workspace: "team-a", want: map[string]bool{"a-shared": true, "b-team-a": true}},
+		{workspace: "TEAM-C", want: map[string]bool{"a-shared": true, "c-teams-bc": true}},
+	}
+	for _, tc := range cases {
+		selector := &RoundRobinSelector{}
+		opts := cliproxyexecutor.Options{Metadata: map[string]any{WorkspaceMetadataKey: tc.workspace}}
+		seen := make(map[string]bool)
+		for i := 0; i < len(auths)*2; i++ {
+			picked, err := selector.Pick(context.Background(), "claude", "", opts, auths)
+			if err != nil {
+				t.Fatalf("workspace %q: Pick() error = %v", tc.workspace, err)
+			}
+			seen[picked.ID] = true
+		}
+		if len(seen) != len(tc.want) {
+			t.Fatalf("workspace %q: picked %v, want %v", tc.workspace, seen, tc.want)
+		}
+		for id := range seen {
+			if !tc.want[id] {
+				t.Fatalf("workspace %q: picked unexpected credential %s", tc.workspace, id)
+			}
+		}
+	}
+}
+
+func TestRoundRobinSelectorRejectsUnsharedWorkspace(t *testing.T) {
+	auths := []*Auth{{ID: "team-a", Provider: "codex", Metadata: map[string]any{"workspaces": "team-a"}}}
+	opts := cliproxyexecutor.Options{Metadata: map[string]any{WorkspaceMetadataKey: "team-b"}}
+	_, err := (&RoundRobinSelector{}).Pick(context.Background(), "codex", "", opts, auths)
+	authErr, ok := err.(*Error)
+	if !ok || authErr.Code != "auth_not_shared" {
+		t.Fatalf("Pick() error = %v, want auth_not_shared", err)
+	}
+}
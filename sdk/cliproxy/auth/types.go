@@ -74,6 +74,8 @@ type QuotaState struct {
 	NextRecoverAt time.Time `json:"next_recover_at"`
 	// BackoffLevel stores the progressive cooldown exponent used for rate limits.
 	BackoffLevel int `json:"backoff_level,omitempty"`
+	// RetryAfterSeconds records the delay requested by the upstream Retry-After hint, if any.
+	RetryAfterSeconds int64 `json:"retry_after_seconds,omitempty"`
 }
 
 // ModelState captures the execution state for a specific model under an auth entry.
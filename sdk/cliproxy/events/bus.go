@@ -0,0 +1,169 @@
+// Package events provides a lightweight publish/subscribe bus for proxy lifecycle
+// notifications. Embedders and plugins subscribe to the events they care about
+// instead of polling management endpoints for state changes.
+package events
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Type identifies the kind of lifecycle event.
+type Type string
+
+const (
+	// CredentialAdded fires when a new credential is registered with the auth manager.
+	CredentialAdded Type = "credential.added"
+	// CredentialRemoved fires when a credential is removed from the runtime.
+	CredentialRemoved Type = "credential.removed"
+	// CredentialRefreshed fires after an OAuth credential was renewed.
+	CredentialRefreshed Type = "credential.refreshed"
+	// CredentialRefreshFailed fires when renewing an OAuth credential failed; the
+	// attempt is retried with backoff.
+	CredentialRefreshFailed Type = "credential.refresh_failed"
+	// CanaryPromoted fires when a credential added while running finished its warm-up
+	// and receives full traffic.
+	CanaryPromoted Type = "credential.canary_promoted"
+	// CanaryFailed fires when a canary credential exceeded its failure or rate-limit
+	// threshold and was disabled. Reason holds the observed rates.
+	CanaryFailed Type = "credential.canary_failed"
+	// CircuitOpened fires when a credential (or one of its models) is suspended after failures.
+	CircuitOpened Type = "circuit.opened"
+	// CircuitClosed fires when a suspended credential/model serves a request successfully again.
+	CircuitClosed Type = "circuit.closed"
+	// ConfigReloaded fires after a configuration change has been applied.
+	ConfigReloaded Type = "config.reloaded"
+	// ConfigReloadFailed fires when a changed configuration was rejected during
+	// validation or rolled back because a subsystem refused it. Reason holds the error.
+	ConfigReloadFailed Type = "config.reload_failed"
+	// BudgetCrossed fires when a client key, team or provider reaches its monthly
+	// spend cap. Data holds the scope ("api_key", "team" or "provider"), the month and
+	// the spend and cap in USD.
+	BudgetCrossed Type = "budget.crossed"
+	// ProviderUnhealthy fires when every credential of a provider is unavailable for a model.
+	ProviderUnhealthy Type = "provider.unhealthy"
+	// ProviderRecovered fires when a provider previously reported unhealthy serves traffic again.
+	ProviderRecovered Type = "provider.recovered"
+)
+
+// subscriberBuffer bounds the number of undelivered events queued per subscriber.
+const subscriberBuffer = 256
+
+// Event describes a single lifecycle notification.
+type Event struct {
+	Type     Type           `json:"type"`
+	Time     time.Time      `json:"time"`
+	Provider string         `json:"provider,omitempty"`
+	AuthID   string         `json:"auth_id,omitempty"`
+	Model    string         `json:"model,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+// Handler consumes events delivered by the bus.
+type Handler func(Event)
+
+type subscriber struct {
+	types   map[Type]struct{}
+	ch      chan Event
+	handler Handler
+}
+
+// Bus fans out published events to subscribers. Each subscriber receives events
+// on its own goroutine so a slow handler never blocks publishers; events are
+// dropped for a subscriber whose queue is full.
+type Bus struct {
+	mu     sync.RWMutex
+	nextID uint64
+	subs   map[uint64]*subscriber
+}
+
+// NewBus constructs an empty event bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[uint64]*subscriber)}
+}
+
+// Subscribe registers handler for the given event types (all types when none are
+// given) and returns a function that cancels the subscription.
+func (b *Bus) Subscribe(handler Handler, types ...Type) func() {
+	if b == nil || handler == nil {
+		return func() {}
+	}
+	sub := &subscriber{ch: make(chan Event, subscriberBuffer), handler: handler}
+	if len(types) > 0 {
+		sub.types = make(map[Type]struct{}, len(types))
+		for _, t := range types {
+			sub.types[t] = struct{}{}
+		}
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	go func() {
+		for evt := range sub.ch {
+			deliver(sub.handler, evt)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// Publish delivers evt to every matching subscriber without blocking.
+func (b *Bus) Publish(evt Event) {
+	if b == nil {
+		return
+	}
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subs {
+		if sub.types != nil {
+			if _, ok := sub.types[evt.Type]; !ok {
+				continue
+			}
+		}
+		select {
+		case sub.ch <- evt:
+		default:
+			log.Warnf("events: subscriber queue full, dropping %s event", evt.Type)
+		}
+	}
+}
+
+func deliver(handler Handler, evt Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("events: handler panic on %s: %v", evt.Type, r)
+		}
+	}()
+	handler(evt)
+}
+
+var defaultBus = NewBus()
+
+// DefaultBus returns the process-wide event bus used by the proxy runtime.
+func DefaultBus() *Bus { return defaultBus }
+
+// Subscribe registers handler on the default bus.
+func Subscribe(handler Handler, types ...Type) func() {
+	return defaultBus.Subscribe(handler, types...)
+}
+
+// Publish sends evt on the default bus.
+func Publish(evt Event) { defaultBus.Publish(evt) }
@@ -0,0 +1,33 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusDeliversFilteredEvents(t *testing.T) {
+	bus := NewBus()
+	got := make(chan Event, 4)
+	unsubscribe := bus.Subscribe(func(e Event) { got <- e }, CircuitOpened)
+
+	bus.Publish(Event{Type: ConfigReloaded})
+	bus.Publish(Event{Type: CircuitOpened, AuthID: "auth-1"})
+
+	select {
+	case evt := <-got:
+		if evt.Type != CircuitOpened || evt.AuthID != "auth-1" || evt.Time.IsZero() {
+			t.Fatalf("unexpected event %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(Event{Type: CircuitOpened})
+	select {
+	case evt := <-got:
+		t.Fatalf("received event after unsubscribe: %+v", evt)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
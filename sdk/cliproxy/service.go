@@ -13,14 +13,17 @@ import (
 	"time"
 
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/api"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/modelcache"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/registry"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/runtime/executor"
-	_ "github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
+	internalusage "github.com/router-for-me/CLIProxyAPI/v6/internal/usage"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/watcher"
 	"github.com/router-for-me/CLIProxyAPI/v6/internal/wsrelay"
 	sdkaccess "github.com/router-for-me/CLIProxyAPI/v6/sdk/access"
 	sdkAuth "github.com/router-for-me/CLIProxyAPI/v6/sdk/auth"
 	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/events"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/streaming"
 	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/usage"
 	"github.com/router-for-me/CLIProxyAPI/v6/sdk/config"
 	log "github.com/sirupsen/logrus"
@@ -97,6 +100,15 @@ func (s *Service) RegisterUsagePlugin(plugin usage.Plugin) {
 	usage.RegisterPlugin(plugin)
 }
 
+// RegisterStreamPlugin registers a plugin that can inspect and rewrite streamed
+// response chunks before they are written to the client.
+//
+// Parameters:
+//   - plugin: The stream plugin to register
+func (s *Service) RegisterStreamPlugin(plugin streaming.Plugin) {
+	streaming.RegisterPlugin(plugin)
+}
+
 // newDefaultAuthManager creates a default authentication manager with all supported providers.
 func newDefaultAuthManager() *sdkAuth.Manager {
 	return sdkAuth.NewManager(
@@ -182,7 +194,7 @@ func (s *Service) handleAuthUpdate(ctx context.Context, update watcher.AuthUpdat
 		if update.Auth == nil || update.Auth.ID == "" {
 			return
 		}
-		s.applyCoreAuthAddOrUpdate(ctx, update.Auth)
+		s.applyCoreAuthAddOrUpdate(ctx, update.Auth, !update.Initial)
 	case watcher.AuthUpdateActionDelete:
 		id := update.ID
 		if id == "" && update.Auth != nil {
@@ -268,7 +280,9 @@ func (s *Service) wsOnDisconnected(channelID string, reason error) {
 	})
 }
 
-func (s *Service) applyCoreAuthAddOrUpdate(ctx context.Context, auth *coreauth.Auth) {
+// applyCoreAuthAddOrUpdate registers or updates auth in the core manager. When
+// canary is set a newly registered credential starts on canary routing.
+func (s *Service) applyCoreAuthAddOrUpdate(ctx context.Context, auth *coreauth.Auth, canary bool) {
 	if s == nil || auth == nil || auth.ID == "" {
 		return
 	}
@@ -289,6 +303,10 @@ func (s *Service) applyCoreAuthAddOrUpdate(ctx context.Context, auth *coreauth.A
 	}
 	if _, err := s.coreManager.Register(ctx, auth); err != nil {
 		log.Errorf("failed to register auth %s: %v", auth.ID, err)
+		return
+	}
+	if canary && auth.Attributes["runtime_only"] != "true" {
+		s.coreManager.StartCanary(auth.ID)
 	}
 }
 
@@ -306,6 +324,7 @@ func (s *Service) applyCoreAuthRemoval(ctx context.Context, id string) {
 		if _, err := s.coreManager.Update(ctx, existing); err != nil {
 			log.Errorf("failed to disable auth %s: %v", id, err)
 		}
+		events.Publish(events.Event{Type: events.CredentialRemoved, Provider: existing.Provider, AuthID: id})
 	}
 }
 
@@ -315,6 +334,43 @@ func (s *Service) applyRetryConfig(cfg *config.Config) {
 	}
 	maxInterval := time.Duration(cfg.MaxRetryInterval) * time.Second
 	s.coreManager.SetRetryConfig(cfg.RequestRetry, maxInterval)
+	s.coreManager.SetCircuitBreaker(coreauth.BreakerConfig{
+		Enabled:          cfg.CircuitBreaker.Enabled,
+		FailureThreshold: cfg.CircuitBreaker.FailureThreshold,
+		Window:           time.Duration(cfg.CircuitBreaker.WindowSeconds) * time.Second,
+		OpenDuration:     time.Duration(cfg.CircuitBreaker.OpenSeconds) * time.Second,
+	})
+	s.coreManager.SetCredentialCanary(coreauth.CanaryConfig{
+		Enabled:          cfg.CredentialCanary.Enabled,
+		Percent:          cfg.CredentialCanary.TrafficPercent,
+		Warmup:           time.Duration(cfg.CredentialCanary.WarmupMinutes) * time.Minute,
+		MinRequests:      cfg.CredentialCanary.MinRequests,
+		MaxFailureRate:   cfg.CredentialCanary.MaxFailureRate,
+		MaxRateLimitRate: cfg.CredentialCanary.MaxRateLimitRate,
+	})
+	s.coreManager.SetLatencyRouting(coreauth.LatencyConfig{
+		Enabled:    cfg.LatencyRouting.Enabled,
+		Window:     time.Duration(cfg.LatencyRouting.WindowSeconds) * time.Second,
+		MinSamples: cfg.LatencyRouting.MinSamples,
+	})
+	s.coreManager.SetRefreshConfig(coreauth.RefreshConfig{
+		JitterFraction: cfg.AuthRefresh.JitterFraction(),
+		MaxBackoff:     time.Duration(cfg.AuthRefresh.MaxBackoffSeconds) * time.Second,
+	})
+	s.coreManager.SetConcurrencyLimit(coreauth.ConcurrencyConfig{
+		MaxInFlight:  cfg.CredentialConcurrency.MaxInFlight,
+		QueueTimeout: time.Duration(cfg.CredentialConcurrency.QueueTimeoutSeconds) * time.Second,
+	})
+	s.coreManager.SetRateLimitSwitch(cfg.QuotaExceeded.SwitchCredentialEnabled())
+	s.coreManager.SetSessionAffinity(coreauth.AffinityConfig{
+		Enabled: cfg.SessionAffinity.Enabled,
+		TTL:     time.Duration(cfg.SessionAffinity.TTLSeconds) * time.Second,
+	})
+	if cfg.SessionAffinity.Enabled && cfg.SessionAffinity.Persist {
+		s.coreManager.SetAffinityStore(&internalusage.SessionAffinityStore{})
+	} else {
+		s.coreManager.SetAffinityStore(nil)
+	}
 }
 
 func openAICompatInfoFromAuth(a *coreauth.Auth) (providerKey string, compatName string, ok bool) {
@@ -514,14 +570,25 @@ func (s *Service) Run(ctx context.Context) error {
 		if newCfg == nil {
 			return
 		}
-		s.applyRetryConfig(newCfg)
 		if s.server != nil {
-			s.server.UpdateClients(newCfg)
+			if errApply := s.server.ApplyConfig(newCfg); errApply != nil {
+				log.WithError(errApply).Error("config reload rolled back, keeping the previous config")
+				events.Publish(events.Event{Type: events.ConfigReloadFailed, Reason: errApply.Error(), Data: map[string]any{"stage": "apply"}})
+				s.cfgMu.RLock()
+				current := s.cfg
+				s.cfgMu.RUnlock()
+				if watcherWrapper != nil && current != nil {
+					watcherWrapper.SetConfig(current)
+				}
+				return
+			}
 		}
+		s.applyRetryConfig(newCfg)
 		s.cfgMu.Lock()
 		s.cfg = newCfg
 		s.cfgMu.Unlock()
 		s.rebindExecutors()
+		events.Publish(events.Event{Type: events.ConfigReloaded})
 	}
 
 	watcherWrapper, err = s.watcherFactory(s.configPath, s.cfg.AuthDir, reloadCallback)
@@ -692,9 +759,7 @@ func (s *Service) registerModelsForAuth(a *coreauth.Auth) {
 		models = registry.GetAIStudioModels()
 		models = applyExcludedModels(models, excluded)
 	case "antigravity":
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		models = executor.FetchAntigravityModels(ctx, a, s.cfg)
-		cancel()
+		models = s.fetchAntigravityModels(a)
 		models = applyExcludedModels(models, excluded)
 	case "claude":
 		models = registry.GetClaudeModels()
@@ -821,6 +886,9 @@ func (s *Service) resolveConfigClaudeKey(auth *coreauth.Auth) *config.ClaudeKey
 	var attrKey, attrBase string
 	if auth.Attributes != nil {
 		attrKey = strings.TrimSpace(auth.Attributes["api_key"])
+		if ref := strings.TrimSpace(auth.Attributes["api_key_ref"]); ref != "" {
+			attrKey = ref
+		}
 		attrBase = strings.TrimSpace(auth.Attributes["base_url"])
 	}
 	for i := range s.cfg.ClaudeKey {
@@ -860,6 +928,9 @@ func (s *Service) resolveConfigGeminiKey(auth *coreauth.Auth) *config.GeminiKey
 	var attrKey, attrBase string
 	if auth.Attributes != nil {
 		attrKey = strings.TrimSpace(auth.Attributes["api_key"])
+		if ref := strings.TrimSpace(auth.Attributes["api_key_ref"]); ref != "" {
+			attrKey = ref
+		}
 		attrBase = strings.TrimSpace(auth.Attributes["base_url"])
 	}
 	for i := range s.cfg.GeminiKey {
@@ -886,6 +957,9 @@ func (s *Service) resolveConfigVertexCompatKey(auth *coreauth.Auth) *config.Vert
 	var attrKey, attrBase string
 	if auth.Attributes != nil {
 		attrKey = strings.TrimSpace(auth.Attributes["api_key"])
+		if ref := strings.TrimSpace(auth.Attributes["api_key_ref"]); ref != "" {
+			attrKey = ref
+		}
 		attrBase = strings.TrimSpace(auth.Attributes["base_url"])
 	}
 	for i := range s.cfg.VertexCompatAPIKey {
@@ -920,6 +994,9 @@ func (s *Service) resolveConfigCodexKey(auth *coreauth.Auth) *config.CodexKey {
 	var attrKey, attrBase string
 	if auth.Attributes != nil {
 		attrKey = strings.TrimSpace(auth.Attributes["api_key"])
+		if ref := strings.TrimSpace(auth.Attributes["api_key_ref"]); ref != "" {
+			attrKey = ref
+		}
 		attrBase = strings.TrimSpace(auth.Attributes["base_url"])
 	}
 	for i := range s.cfg.CodexKey {
@@ -1029,6 +1106,32 @@ func applyModelPrefixes(models []*ModelInfo, prefix string, forceModelPrefix boo
 	return out
 }
 
+// antigravityModels caches upstream model discovery per auth so reloads and
+// re-registrations within the configured TTL don't hit the Antigravity API again.
+var antigravityModels = modelcache.New[[]*ModelInfo]()
+
+// fetchAntigravityModels returns the models available to a, served from the
+// models-list cache when enabled. A failed fetch falls back to the last result.
+func (s *Service) fetchAntigravityModels(a *coreauth.Auth) []*ModelInfo {
+	var policy modelcache.Policy
+	if s.cfg != nil {
+		policy = modelcache.PolicyFromSeconds(s.cfg.ModelsList.Cache.For("antigravity"))
+	}
+	models, err := antigravityModels.Get(context.Background(), a.ID, policy, func(ctx context.Context) ([]*ModelInfo, error) {
+		ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		defer cancel()
+		fetched := executor.FetchAntigravityModels(ctx, a, s.cfg)
+		if len(fetched) == 0 {
+			return nil, fmt.Errorf("no antigravity models returned for %s", a.ID)
+		}
+		return fetched, nil
+	})
+	if err != nil {
+		return nil
+	}
+	return append([]*ModelInfo(nil), models...)
+}
+
 // matchWildcard performs case-insensitive wildcard matching where '*' matches any substring.
 func matchWildcard(pattern, value string) bool {
 	if pattern == "" {
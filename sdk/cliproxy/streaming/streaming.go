@@ -0,0 +1,211 @@
+// Package streaming lets plugins inspect and rewrite streamed response chunks
+// after translation and before they reach the client, e.g. to strip reasoning
+// blocks, inject watermarks or enforce stop sequences.
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrStop ends a stream early. A transformer returning it still has its chunk
+// forwarded; later upstream chunks are discarded and flushes still run.
+var ErrStop = errors.New("streaming: stop stream")
+
+// Info describes the streaming response a transformer is attached to.
+type Info struct {
+	// Format is the client-facing response format (e.g., "openai", "claude", "gemini").
+	Format string
+	// Model is the effective model the request was routed with.
+	Model string
+	// RequestedModel is the model the client asked for when a rewrite rule changed it.
+	RequestedModel string
+	// APIKey is the client key that authenticated the request.
+	APIKey string
+}
+
+// Transformer processes the chunks of a single stream in order.
+type Transformer interface {
+	// Transform returns the chunk to forward in place of chunk. A nil result drops
+	// the chunk; ErrStop forwards the result and ends the stream.
+	Transform(chunk []byte) ([]byte, error)
+	// Flush returns trailing chunks to send once the stream ends.
+	Flush() [][]byte
+}
+
+// Plugin creates a transformer per streaming response.
+type Plugin interface {
+	// NewStream returns the transformer for a stream, or nil to leave it untouched.
+	NewStream(ctx context.Context, info Info) Transformer
+}
+
+// PluginFunc adapts a function to Plugin.
+type PluginFunc func(ctx context.Context, info Info) Transformer
+
+// NewStream implements Plugin.
+func (f PluginFunc) NewStream(ctx context.Context, info Info) Transformer { return f(ctx, info) }
+
+// TransformFunc adapts a stateless chunk function to Transformer.
+type TransformFunc func(chunk []byte) ([]byte, error)
+
+// Transform implements Transformer.
+func (f TransformFunc) Transform(chunk []byte) ([]byte, error) { return f(chunk) }
+
+// Flush implements Transformer.
+func (f TransformFunc) Flush() [][]byte { return nil }
+
+// Manager holds the registered stream plugins.
+type Manager struct {
+	mu      sync.RWMutex
+	plugins []Plugin
+}
+
+// NewManager constructs an empty manager.
+func NewManager() *Manager { return &Manager{} }
+
+// Register appends a plugin. Plugins run in registration order, each seeing the
+// output of the previous one.
+func (m *Manager) Register(plugin Plugin) {
+	if m == nil || plugin == nil {
+		return
+	}
+	m.mu.Lock()
+	m.plugins = append(m.plugins, plugin)
+	m.mu.Unlock()
+}
+
+// Open builds the transformer chain for a new stream. It returns nil when no
+// plugin wants to see the stream, so callers can skip the chain entirely.
+func (m *Manager) Open(ctx context.Context, info Info) *Chain {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	plugins := make([]Plugin, len(m.plugins))
+	copy(plugins, m.plugins)
+	m.mu.RUnlock()
+	var chain *Chain
+	for _, plugin := range plugins {
+		t := safeOpen(plugin, ctx, info)
+		if t == nil {
+			continue
+		}
+		if chain == nil {
+			chain = &Chain{}
+		}
+		chain.transformers = append(chain.transformers, t)
+	}
+	return chain
+}
+
+// Chain applies a stream's transformers in order.
+type Chain struct {
+	transformers []Transformer
+	stopped      bool
+}
+
+// Transform passes chunk through every transformer and returns the chunk to
+// forward, or nil when it was dropped. stop reports that a transformer ended the
+// stream; the returned chunk must still be forwarded. A non-nil error aborts the stream.
+func (c *Chain) Transform(chunk []byte) (out []byte, stop bool, err error) {
+	if c == nil {
+		return chunk, false, nil
+	}
+	if c.stopped {
+		return nil, true, nil
+	}
+	out, stop, err = c.run(0, chunk)
+	if stop {
+		c.stopped = true
+	}
+	return out, stop, err
+}
+
+// run feeds chunk to the transformers from index start onwards.
+func (c *Chain) run(start int, chunk []byte) ([]byte, bool, error) {
+	stop := false
+	for i := start; i < len(c.transformers); i++ {
+		next, err := safeTransform(c.transformers[i], chunk)
+		if errors.Is(err, ErrStop) {
+			stop = true
+		} else if err != nil {
+			return nil, false, err
+		}
+		if next == nil {
+			return nil, stop, nil
+		}
+		chunk = next
+	}
+	return chunk, stop, nil
+}
+
+// Flush collects trailing chunks, passing each transformer's output through the
+// transformers after it.
+func (c *Chain) Flush() [][]byte {
+	if c == nil {
+		return nil
+	}
+	var out [][]byte
+	for i, t := range c.transformers {
+		for _, chunk := range safeFlush(t) {
+			if len(chunk) == 0 {
+				continue
+			}
+			forwarded, _, err := c.run(i+1, chunk)
+			if err != nil {
+				log.Warnf("streaming: flush dropped: %v", err)
+				continue
+			}
+			if forwarded != nil {
+				out = append(out, forwarded)
+			}
+		}
+	}
+	return out
+}
+
+func safeOpen(plugin Plugin, ctx context.Context, info Info) (t Transformer) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("streaming: plugin panic recovered: %v", r)
+			t = nil
+		}
+	}()
+	return plugin.NewStream(ctx, info)
+}
+
+func safeTransform(t Transformer, chunk []byte) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("streaming: transformer panic recovered: %v", r)
+			out, err = chunk, nil
+		}
+	}()
+	out, err = t.Transform(chunk)
+	if err != nil && !errors.Is(err, ErrStop) {
+		err = fmt.Errorf("streaming: transform: %w", err)
+	}
+	return out, err
+}
+
+func safeFlush(t Transformer) (out [][]byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("streaming: transformer panic recovered: %v", r)
+			out = nil
+		}
+	}()
+	return t.Flush()
+}
+
+var defaultManager = NewManager()
+
+// DefaultManager returns the global stream plugin manager.
+func DefaultManager() *Manager { return defaultManager }
+
+// RegisterPlugin registers a plugin on the default manager.
+func RegisterPlugin(plugin Plugin) { DefaultManager().Register(plugin) }
@@ -0,0 +1,93 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+type suffixTransformer struct {
+	suffix string
+	tail   string
+}
+
+func (t *suffixTransformer) Transform(chunk []byte) ([]byte, error) {
+	return append(chunk, t.suffix...), nil
+}
+
+func (t *suffixTransformer) Flush() [][]byte {
+	if t.tail == "" {
+		return nil
+	}
+	return [][]byte{[]byte(t.tail)}
+}
+
+func TestChainTransformAndFlush(t *testing.T) {
+	m := NewManager()
+	m.Register(PluginFunc(func(_ context.Context, info Info) Transformer {
+		if info.Format != "openai" {
+			return nil
+		}
+		return &suffixTransformer{suffix: "-a", tail: "tail"}
+	}))
+	m.Register(PluginFunc(func(context.Context, Info) Transformer {
+		return TransformFunc(func(chunk []byte) ([]byte, error) {
+			switch {
+			case bytes.HasPrefix(chunk, []byte("drop")):
+				return nil, nil
+			case bytes.HasPrefix(chunk, []byte("stop")):
+				return chunk, ErrStop
+			}
+			return append(chunk, "-b"...), nil
+		})
+	}))
+
+	chain := m.Open(context.Background(), Info{Format: "openai"})
+	if out, stop, err := chain.Transform([]byte("x")); err != nil || stop || string(out) != "x-a-b" {
+		t.Fatalf("Transform = %q, %v, %v", out, stop, err)
+	}
+	if out, _, _ := chain.Transform([]byte("drop")); out != nil {
+		t.Fatalf("expected dropped chunk, got %q", out)
+	}
+	if out, stop, err := chain.Transform([]byte("stop")); err != nil || !stop || string(out) != "stop-a" {
+		t.Fatalf("Transform(stop) = %q, %v, %v", out, stop, err)
+	}
+	if out, stop, _ := chain.Transform([]byte("late")); out != nil || !stop {
+		t.Fatalf("chunks after stop must be discarded, got %q", out)
+	}
+	flushed := chain.Flush()
+	if len(flushed) != 1 || string(flushed[0]) != "tail-b" {
+		t.Fatalf("Flush = %q, want tail passed through later transformers", flushed)
+	}
+
+	only := m.Open(context.Background(), Info{Format: "claude"})
+	if out, _, _ := only.Transform([]byte("y")); string(out) != "y-b" {
+		t.Fatalf("plugin returning nil must be skipped, got %q", out)
+	}
+	if NewManager().Open(context.Background(), Info{}) != nil {
+		t.Fatalf("expected nil chain without plugins")
+	}
+}
+
+func TestChainErrorsAndPanics(t *testing.T) {
+	m := NewManager()
+	m.Register(PluginFunc(func(context.Context, Info) Transformer {
+		return TransformFunc(func(chunk []byte) ([]byte, error) {
+			if string(chunk) == "panic" {
+				panic("boom")
+			}
+			if string(chunk) == "fail" {
+				return nil, errors.New("bad chunk")
+			}
+			return chunk, nil
+		})
+	}))
+	chain := m.Open(context.Background(), Info{})
+	if out, _, err := chain.Transform([]byte("panic")); err != nil || string(out) != "panic" {
+		t.Fatalf("panicking transformer must pass the chunk through, got %q %v", out, err)
+	}
+	if _, _, err := chain.Transform([]byte("fail")); err == nil {
+		t.Fatalf("expected transform error")
+	}
+}
@@ -0,0 +1,123 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Error classes recorded on failed usage records.
+const (
+	ErrorClassTimeout       = "timeout"
+	ErrorClassAuthExpired   = "auth_expired"
+	ErrorClassQuota         = "quota"
+	ErrorClassContentFilter = "content_filter"
+	ErrorClassServer        = "5xx"
+	ErrorClassNetwork       = "network"
+	ErrorClassCanceled      = "canceled"
+	ErrorClassClient        = "client_error"
+	ErrorClassUnknown       = "unknown"
+
+	// ErrorClassConnectTimeout and ErrorClassReadTimeout refine ErrorClassTimeout for
+	// the configured upstream connect and read timeouts; the total timeout stays "timeout".
+	ErrorClassConnectTimeout = "connect_timeout"
+	ErrorClassReadTimeout    = "read_timeout"
+)
+
+var (
+	quotaMarkers = []string{
+		"quota", "resource_exhausted", "resource exhausted", "rate limit", "rate_limit", "too many requests",
+	}
+	contentFilterMarkers = []string{
+		"content_filter", "content filter", "content_policy", "content policy", "safety", "moderation",
+		"responsible ai", "prohibited_content", "blocked",
+	}
+	networkMarkers = []string{
+		"connection refused", "connection reset", "broken pipe", "no such host", "eof", "tls handshake",
+	}
+)
+
+// ClassifyError maps an upstream failure to one of the ErrorClass constants. Errors
+// carrying an HTTP status are classified by status first, refined by the message for
+// statuses providers overload (quota exhaustion reported as 403, content filtering
+// reported as 400). It returns "" for a nil error.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	var phased interface{ TimeoutPhase() string }
+	if errors.As(err, &phased) {
+		switch phased.TimeoutPhase() {
+		case "connect":
+			return ErrorClassConnectTimeout
+		case "read":
+			return ErrorClassReadTimeout
+		}
+		return ErrorClassTimeout
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassCanceled
+	}
+	message := strings.ToLower(err.Error())
+
+	var status interface{ StatusCode() int }
+	if errors.As(err, &status) && status.StatusCode() > 0 {
+		code := status.StatusCode()
+		switch {
+		case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout:
+			return ErrorClassTimeout
+		case code == http.StatusTooManyRequests:
+			return ErrorClassQuota
+		case code == http.StatusUnauthorized:
+			return ErrorClassAuthExpired
+		case code == http.StatusForbidden:
+			if containsAny(message, quotaMarkers) {
+				return ErrorClassQuota
+			}
+			return ErrorClassAuthExpired
+		case code >= 500:
+			return ErrorClassServer
+		case code >= 400:
+			if containsAny(message, contentFilterMarkers) {
+				return ErrorClassContentFilter
+			}
+			if containsAny(message, quotaMarkers) {
+				return ErrorClassQuota
+			}
+			return ErrorClassClient
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassNetwork
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || containsAny(message, networkMarkers) {
+		return ErrorClassNetwork
+	}
+	if strings.Contains(message, "timeout") || strings.Contains(message, "deadline exceeded") {
+		return ErrorClassTimeout
+	}
+	if containsAny(message, contentFilterMarkers) {
+		return ErrorClassContentFilter
+	}
+	return ErrorClassUnknown
+}
+
+func containsAny(s string, markers []string) bool {
+	for _, marker := range markers {
+		if strings.Contains(s, marker) {
+			return true
+		}
+	}
+	return false
+}
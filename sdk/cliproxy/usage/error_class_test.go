@@ -0,0 +1,52 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e statusError) Error() string   { return e.msg }
+func (e statusError) StatusCode() int { return e.code }
+
+type phaseTimeout string
+
+func (e phaseTimeout) Error() string        { return string(e) + " timeout" }
+func (e phaseTimeout) TimeoutPhase() string { return string(e) }
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{context.DeadlineExceeded, ErrorClassTimeout},
+		{fmt.Errorf("wrapped: %w", context.Canceled), ErrorClassCanceled},
+		{statusError{504, "gateway timeout"}, ErrorClassTimeout},
+		{statusError{401, "token expired"}, ErrorClassAuthExpired},
+		{statusError{403, "permission denied"}, ErrorClassAuthExpired},
+		{statusError{403, `{"error":{"status":"RESOURCE_EXHAUSTED"}}`}, ErrorClassQuota},
+		{statusError{429, "slow down"}, ErrorClassQuota},
+		{statusError{400, `{"error":{"code":"content_filter"}}`}, ErrorClassContentFilter},
+		{statusError{400, "missing field"}, ErrorClassClient},
+		{statusError{503, "overloaded"}, ErrorClassServer},
+		{fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), ErrorClassNetwork},
+		{errors.New("dial tcp: connection refused"), ErrorClassNetwork},
+		{errors.New("something odd"), ErrorClassUnknown},
+		{fmt.Errorf("post: %w", phaseTimeout("connect")), ErrorClassConnectTimeout},
+		{phaseTimeout("read"), ErrorClassReadTimeout},
+		{phaseTimeout("total"), ErrorClassTimeout},
+	}
+	for _, tc := range cases {
+		if got := ClassifyError(tc.err); got != tc.want {
+			t.Errorf("ClassifyError(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
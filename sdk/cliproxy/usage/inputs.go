@@ -0,0 +1,36 @@
+package usage
+
+import "context"
+
+// InputStats describes the tool results and media carried by an inbound request.
+type InputStats struct {
+	ToolResultTokens int64
+	ImageInputs      int64
+	// DocumentInputs counts attached files other than images, audio and video (e.g. PDFs).
+	DocumentInputs int64
+	// MediaBytes is the decoded size of the inline images and documents; media passed
+	// by URL is counted but has no known size.
+	MediaBytes int64
+	// LargestMediaBytes is the decoded size of the biggest inline image or document.
+	LargestMediaBytes int64
+}
+
+type inputStatsContextKey struct{}
+
+// WithInputStats attaches the request's input statistics so executors can report
+// them with the usage record.
+func WithInputStats(ctx context.Context, stats InputStats) context.Context {
+	if stats == (InputStats{}) {
+		return ctx
+	}
+	return context.WithValue(ctx, inputStatsContextKey{}, stats)
+}
+
+// InputStatsFromContext returns the statistics attached by WithInputStats.
+func InputStatsFromContext(ctx context.Context) InputStats {
+	if ctx == nil {
+		return InputStats{}
+	}
+	stats, _ := ctx.Value(inputStatsContextKey{}).(InputStats)
+	return stats
+}
@@ -3,6 +3,7 @@ package usage
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -10,15 +11,38 @@ import (
 
 // Record contains the usage statistics captured for a single provider request.
 type Record struct {
-	Provider    string
-	Model       string
-	APIKey      string
-	AuthID      string
-	AuthIndex   uint64
-	Source      string
-	RequestedAt time.Time
-	Failed      bool
-	Detail      Detail
+	Provider string
+	// Model is the effective model the request was routed with.
+	Model string
+	// RequestedModel is the model the client asked for when a rewrite rule changed it.
+	RequestedModel string
+	APIKey         string
+	AuthID         string
+	AuthIndex      uint64
+	Source         string
+	// AccountEmail is the account email of the OAuth credential that served the request.
+	AccountEmail string
+	RequestedAt  time.Time
+	Failed       bool
+	// Aborted marks streams the client disconnected from before they finished.
+	// Detail then holds the tokens observed up to that point.
+	Aborted bool
+	// ErrorClass classifies why a failed request failed (see ClassifyError).
+	ErrorClass string
+	Detail     Detail
+	// Tags lists classification labels assigned to the originating request.
+	Tags []string
+	// PolicyDenied marks requests rejected by an API key model/provider policy.
+	PolicyDenied bool
+	// Rejection names why the proxy refused the request before routing it
+	// (e.g. "ip_denied", "ip_rate_limited", "request_too_large").
+	Rejection string
+	// QueueWait is how long the request waited for a free credential concurrency slot.
+	QueueWait time.Duration
+	// Latency is the time from the start of the upstream request until the record was published.
+	Latency time.Duration
+	// AudioSeconds is the duration of audio sent and received over a realtime session.
+	AudioSeconds float64
 }
 
 // Detail holds the token usage breakdown.
@@ -26,8 +50,24 @@ type Detail struct {
 	InputTokens     int64
 	OutputTokens    int64
 	ReasoningTokens int64
-	CachedTokens    int64
-	TotalTokens     int64
+	// CachedTokens counts prompt tokens read from the provider's prompt cache.
+	CachedTokens int64
+	// CacheCreationTokens counts prompt tokens written to the prompt cache (Anthropic
+	// cache_creation_input_tokens). Like cache reads they are not part of InputTokens
+	// for Claude.
+	CacheCreationTokens int64
+	TotalTokens         int64
+	// ToolCalls counts the tool/function calls the model made in its response.
+	ToolCalls int64
+	// ToolResultTokens estimates the prompt tokens spent on tool results sent back
+	// to the model; they are part of InputTokens.
+	ToolResultTokens int64
+	// ImageInputs counts the images attached to the request.
+	ImageInputs int64
+	// DocumentInputs counts the documents (e.g. PDFs) attached to the request.
+	DocumentInputs int64
+	// MediaBytes is the decoded size of the images and documents sent inline.
+	MediaBytes int64
 }
 
 // Plugin consumes usage records emitted by the proxy runtime.
@@ -42,17 +82,22 @@ type queueItem struct {
 
 // Manager maintains a queue of usage records and delivers them to registered plugins.
 type Manager struct {
-	once     sync.Once
-	stopOnce sync.Once
-	cancel   context.CancelFunc
+	cancel context.CancelFunc
 
-	mu     sync.Mutex
-	cond   *sync.Cond
-	queue  []queueItem
-	closed bool
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []queueItem
+	closed  bool
+	running bool
+	// gen identifies the active dispatcher so a worker left over from before a
+	// Stop/Start cycle exits instead of competing with its replacement.
+	gen uint64
 
 	pluginsMu sync.RWMutex
 	plugins   []Plugin
+
+	// panics counts plugin invocations that panicked and were recovered.
+	panics atomic.Uint64
 }
 
 // NewManager constructs a manager with a buffered queue.
@@ -62,19 +107,30 @@ func NewManager(buffer int) *Manager {
 	return m
 }
 
-// Start launches the background dispatcher. Calling Start multiple times is safe.
+// Start launches the background dispatcher. Calling Start multiple times is safe,
+// and Start after Stop resumes delivery (e.g. when an embedder restarts the service).
 func (m *Manager) Start(ctx context.Context) {
 	if m == nil {
 		return
 	}
-	m.once.Do(func() {
-		if ctx == nil {
-			ctx = context.Background()
-		}
-		var workerCtx context.Context
-		workerCtx, m.cancel = context.WithCancel(ctx)
-		go m.run(workerCtx)
-	})
+	m.start(ctx, true)
+}
+
+func (m *Manager) start(ctx context.Context, restart bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running || (m.closed && !restart) {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var workerCtx context.Context
+	workerCtx, m.cancel = context.WithCancel(ctx)
+	m.closed = false
+	m.running = true
+	m.gen++
+	go m.run(workerCtx, m.gen)
 }
 
 // Stop stops the dispatcher and drains the queue.
@@ -82,15 +138,19 @@ func (m *Manager) Stop() {
 	if m == nil {
 		return
 	}
-	m.stopOnce.Do(func() {
-		if m.cancel != nil {
-			m.cancel()
-		}
-		m.mu.Lock()
-		m.closed = true
+	m.mu.Lock()
+	if m.closed {
 		m.mu.Unlock()
-		m.cond.Broadcast()
-	})
+		return
+	}
+	m.closed = true
+	m.running = false
+	cancel := m.cancel
+	m.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	m.cond.Broadcast()
 }
 
 // Register appends a plugin to the delivery list.
@@ -110,7 +170,7 @@ func (m *Manager) Publish(ctx context.Context, record Record) {
 		return
 	}
 	// ensure worker is running even if Start was not called explicitly
-	m.Start(context.Background())
+	m.start(context.Background(), false)
 	m.mu.Lock()
 	if m.closed {
 		m.mu.Unlock()
@@ -121,13 +181,13 @@ func (m *Manager) Publish(ctx context.Context, record Record) {
 	m.cond.Signal()
 }
 
-func (m *Manager) run(ctx context.Context) {
+func (m *Manager) run(ctx context.Context, gen uint64) {
 	for {
 		m.mu.Lock()
-		for !m.closed && len(m.queue) == 0 {
+		for !m.closed && len(m.queue) == 0 && m.gen == gen {
 			m.cond.Wait()
 		}
-		if len(m.queue) == 0 && m.closed {
+		if m.gen != gen || (len(m.queue) == 0 && m.closed) {
 			m.mu.Unlock()
 			return
 		}
@@ -150,13 +210,32 @@ func (m *Manager) dispatch(item queueItem) {
 		if plugin == nil {
 			continue
 		}
-		safeInvoke(plugin, item.ctx, item.record)
+		m.safeInvoke(plugin, item.ctx, item.record)
+	}
+}
+
+// QueueDepth returns the number of records waiting to be dispatched to plugins.
+func (m *Manager) QueueDepth() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.queue)
+}
+
+// PluginPanics returns how many plugin invocations panicked since startup.
+func (m *Manager) PluginPanics() uint64 {
+	if m == nil {
+		return 0
 	}
+	return m.panics.Load()
 }
 
-func safeInvoke(plugin Plugin, ctx context.Context, record Record) {
+func (m *Manager) safeInvoke(plugin Plugin, ctx context.Context, record Record) {
 	defer func() {
 		if r := recover(); r != nil {
+			m.panics.Add(1)
 			log.Errorf("usage: plugin panic recovered: %v", r)
 		}
 	}()
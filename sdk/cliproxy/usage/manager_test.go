@@ -0,0 +1,51 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recordPlugin chan Record
+
+func (p recordPlugin) HandleUsage(_ context.Context, record Record) { p <- record }
+
+func TestManagerRestartsAfterStop(t *testing.T) {
+	m := NewManager(4)
+	delivered := make(recordPlugin, 4)
+	m.Register(delivered)
+	expect := func(provider string) {
+		t.Helper()
+		select {
+		case record := <-delivered:
+			if record.Provider != provider {
+				t.Fatalf("expected a %s record, got %+v", provider, record)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s record was not delivered", provider)
+		}
+	}
+
+	m.Start(context.Background())
+	m.Publish(context.Background(), Record{Provider: "first"})
+	expect("first")
+
+	m.Stop()
+	m.Stop()
+	m.Publish(context.Background(), Record{Provider: "dropped"})
+	if depth := m.QueueDepth(); depth != 0 {
+		t.Fatalf("stopped manager queued %d records", depth)
+	}
+
+	m.Start(context.Background())
+	m.Start(context.Background())
+	m.Publish(context.Background(), Record{Provider: "second"})
+	expect("second")
+	m.Stop()
+
+	select {
+	case record := <-delivered:
+		t.Fatalf("unexpected delivery %+v", record)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
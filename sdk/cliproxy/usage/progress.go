@@ -0,0 +1,109 @@
+package usage
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamProgress is the usage observed so far on a streaming response that has not
+// finished yet. Token counts come from usage fields in the stream chunks; output
+// tokens are estimated from the streamed text until the provider reports them.
+type StreamProgress struct {
+	ID                  uint64    `json:"id"`
+	Provider            string    `json:"provider"`
+	Model               string    `json:"model"`
+	AuthID              string    `json:"auth_id,omitempty"`
+	Source              string    `json:"source,omitempty"`
+	StartedAt           time.Time `json:"started_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	InputTokens         int64     `json:"input_tokens"`
+	OutputTokens        int64     `json:"output_tokens"`
+	ReasoningTokens     int64     `json:"reasoning_tokens"`
+	CachedTokens        int64     `json:"cached_tokens"`
+	CacheCreationTokens int64     `json:"cache_creation_tokens"`
+	TotalTokens         int64     `json:"total_tokens"`
+}
+
+// staleStreamAfter drops in-progress streams that stopped reporting, e.g. because
+// the executor returned without publishing a record.
+const staleStreamAfter = 15 * time.Minute
+
+var (
+	streamsMu  sync.Mutex
+	streams    = make(map[uint64]*StreamProgress)
+	nextStream atomic.Uint64
+)
+
+// StartStream registers a streaming response and returns the ID passed to
+// UpdateStream and EndStream.
+func StartStream(provider, model, authID, source string, startedAt time.Time) uint64 {
+	id := nextStream.Add(1)
+	now := time.Now()
+	if startedAt.IsZero() {
+		startedAt = now
+	}
+	streamsMu.Lock()
+	streams[id] = &StreamProgress{
+		ID:        id,
+		Provider:  provider,
+		Model:     model,
+		AuthID:    authID,
+		Source:    source,
+		StartedAt: startedAt,
+		UpdatedAt: now,
+	}
+	streamsMu.Unlock()
+	return id
+}
+
+// UpdateStream replaces the usage observed so far on stream id.
+func UpdateStream(id uint64, detail Detail) {
+	total := detail.TotalTokens
+	if total == 0 {
+		total = detail.InputTokens + detail.OutputTokens + detail.ReasoningTokens
+	}
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	p := streams[id]
+	if p == nil {
+		return
+	}
+	p.UpdatedAt = time.Now()
+	p.InputTokens = detail.InputTokens
+	p.OutputTokens = detail.OutputTokens
+	p.ReasoningTokens = detail.ReasoningTokens
+	p.CachedTokens = detail.CachedTokens
+	p.CacheCreationTokens = detail.CacheCreationTokens
+	p.TotalTokens = total
+}
+
+// EndStream removes stream id once its final usage record has been published.
+func EndStream(id uint64) {
+	streamsMu.Lock()
+	delete(streams, id)
+	streamsMu.Unlock()
+}
+
+// InFlightStreams returns the streams still in progress, oldest first.
+func InFlightStreams() []StreamProgress {
+	cutoff := time.Now().Add(-staleStreamAfter)
+	streamsMu.Lock()
+	out := make([]StreamProgress, 0, len(streams))
+	for id, p := range streams {
+		if p.UpdatedAt.Before(cutoff) {
+			delete(streams, id)
+			continue
+		}
+		out = append(out, *p)
+	}
+	streamsMu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartedAt.Equal(out[j].StartedAt) {
+			return out[i].StartedAt.Before(out[j].StartedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
@@ -0,0 +1,47 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamProgressLifecycle(t *testing.T) {
+	started := time.Now().Add(-time.Minute)
+	id := StartStream("claude", "claude-sonnet", "auth-1", "acct@example.com", started)
+	defer EndStream(id)
+
+	UpdateStream(id, Detail{InputTokens: 120, OutputTokens: 40})
+	var found *StreamProgress
+	for _, s := range InFlightStreams() {
+		if s.ID == id {
+			found = &s
+			break
+		}
+	}
+	if found == nil {
+		t.Fatal("stream missing from in-flight list")
+	}
+	if found.TotalTokens != 160 || found.OutputTokens != 40 || !found.StartedAt.Equal(started) {
+		t.Fatalf("unexpected progress %+v", *found)
+	}
+
+	EndStream(id)
+	UpdateStream(id, Detail{OutputTokens: 99})
+	for _, s := range InFlightStreams() {
+		if s.ID == id {
+			t.Fatalf("ended stream still listed: %+v", s)
+		}
+	}
+}
+
+func TestInFlightStreamsDropsStale(t *testing.T) {
+	id := StartStream("gemini", "gemini-pro", "", "", time.Time{})
+	streamsMu.Lock()
+	streams[id].UpdatedAt = time.Now().Add(-2 * staleStreamAfter)
+	streamsMu.Unlock()
+	for _, s := range InFlightStreams() {
+		if s.ID == id {
+			t.Fatal("stale stream was not dropped")
+		}
+	}
+}
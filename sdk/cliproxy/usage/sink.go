@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SinkEvent is one usage record as sent to external usage sinks configured under
+// usage-sinks. The proxy starts each sink as a subprocess and writes one SinkEvent
+// per line, JSON encoded, to its stdin. Client API keys are never sent; APIKeyHash
+// is the same salted fingerprint stored in the usage database.
+type SinkEvent struct {
+	Timestamp       time.Time `json:"timestamp"`
+	RequestID       string    `json:"request_id,omitempty"`
+	Provider        string    `json:"provider,omitempty"`
+	Model           string    `json:"model,omitempty"`
+	RequestedModel  string    `json:"requested_model,omitempty"`
+	APIKeyHash      string    `json:"api_key_hash,omitempty"`
+	ClientLabel     string    `json:"client_label,omitempty"`
+	Team            string    `json:"team,omitempty"`
+	AuthID          string    `json:"auth_id,omitempty"`
+	Source          string    `json:"source,omitempty"`
+	StatusCode      int       `json:"status_code"`
+	Failed          bool      `json:"failed"`
+	ErrorClass      string    `json:"error_class,omitempty"`
+	Rejection       string    `json:"rejection,omitempty"`
+	PolicyDenied    bool      `json:"policy_denied,omitempty"`
+	Tags            []string  `json:"tags,omitempty"`
+	InputTokens     int64     `json:"input_tokens"`
+	OutputTokens    int64     `json:"output_tokens"`
+	ReasoningTokens int64     `json:"reasoning_tokens"`
+	CachedTokens    int64     `json:"cached_tokens"`
+	// CacheCreationTokens is set when the upstream reported prompt cache writes.
+	CacheCreationTokens int64   `json:"cache_creation_tokens,omitempty"`
+	TotalTokens         int64   `json:"total_tokens"`
+	LatencyMs           int64   `json:"latency_ms"`
+	QueueWaitMs         int64   `json:"queue_wait_ms,omitempty"`
+	AudioSeconds        float64 `json:"audio_seconds,omitempty"`
+	// ClientIPHash and ClientCountry are set when client-attribution is enabled.
+	ClientIPHash  string `json:"client_ip_hash,omitempty"`
+	ClientCountry string `json:"client_country,omitempty"`
+	// Metadata holds the attribution pairs the client sent in X-Usage-Metadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SinkAck is the optional reply a sink writes to stdout, one JSON line per event,
+// so the proxy can report delivery failures in its telemetry status. Sinks that do
+// not reply are only health-checked on whether the process accepts writes.
+type SinkAck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// ServeSink implements the sink side of the protocol: it decodes events from r,
+// usually os.Stdin, calls handle for each and writes a SinkAck per event to w,
+// usually os.Stdout. It returns when r reaches EOF, which happens when the proxy
+// stops or replaces the sink.
+func ServeSink(r io.Reader, w io.Writer, handle func(SinkEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var ack SinkAck
+		var event SinkEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			ack.Error = fmt.Sprintf("decode event: %v", err)
+		} else if err = handle(event); err != nil {
+			ack.Error = err.Error()
+		} else {
+			ack.OK = true
+		}
+		if err := encoder.Encode(ack); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
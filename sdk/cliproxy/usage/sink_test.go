@@ -0,0 +1,46 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServeSink(t *testing.T) {
+	in := strings.NewReader(`{"provider":"claude","model":"a","total_tokens":7}` + "\n\n" +
+		`not json` + "\n" +
+		`{"provider":"gemini","model":"b"}` + "\n")
+	var out bytes.Buffer
+	var seen []string
+	err := ServeSink(in, &out, func(ev SinkEvent) error {
+		seen = append(seen, ev.Provider)
+		if ev.Provider == "gemini" {
+			return errors.New("upstream down")
+		}
+		if ev.TotalTokens != 7 {
+			t.Errorf("unexpected event: %+v", ev)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ServeSink failed: %v", err)
+	}
+	if strings.Join(seen, ",") != "claude,gemini" {
+		t.Fatalf("handled %v", seen)
+	}
+
+	var acks []SinkAck
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var ack SinkAck
+		if err = decoder.Decode(&ack); err != nil {
+			t.Fatal(err)
+		}
+		acks = append(acks, ack)
+	}
+	if len(acks) != 3 || !acks[0].OK || acks[1].OK || !strings.HasPrefix(acks[1].Error, "decode event") || acks[2].Error != "upstream down" {
+		t.Fatalf("unexpected acks: %+v", acks)
+	}
+}
@@ -9,6 +9,8 @@ import internalconfig "github.com/router-for-me/CLIProxyAPI/v6/internal/config"
 type SDKConfig = internalconfig.SDKConfig
 type AccessConfig = internalconfig.AccessConfig
 type AccessProvider = internalconfig.AccessProvider
+type OIDCAuthProvider = internalconfig.OIDCAuthProvider
+type ErrorResponsesConfig = internalconfig.ErrorResponsesConfig
 
 type Config = internalconfig.Config
 
@@ -32,6 +34,7 @@ type TLS = internalconfig.TLSConfig
 
 const (
 	AccessProviderTypeConfigAPIKey = internalconfig.AccessProviderTypeConfigAPIKey
+	AccessProviderTypeOIDC         = internalconfig.AccessProviderTypeOIDC
 	DefaultAccessProviderName      = internalconfig.DefaultAccessProviderName
 	DefaultPanelGitHubRepository   = internalconfig.DefaultPanelGitHubRepository
 )
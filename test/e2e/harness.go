@@ -0,0 +1,202 @@
+//go:build e2e
+
+// Package e2e runs scenario tests against a fully wired proxy instance backed by
+// mock providers and a mock OTLP collector. Run with:
+//
+//	go test -tags e2e ./test/e2e/...
+//
+// Set E2E_BASE_URL to target an already running stack (see docker-compose.yml)
+// instead of starting the proxy in-process.
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	configaccess "github.com/router-for-me/CLIProxyAPI/v6/internal/access/config_access"
+	oidcaccess "github.com/router-for-me/CLIProxyAPI/v6/internal/access/oidc_access"
+	"github.com/router-for-me/CLIProxyAPI/v6/internal/config"
+	"github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+	"github.com/router-for-me/CLIProxyAPI/v6/test/e2e/mock"
+)
+
+// ClientKey is the client API key accepted by harness-managed proxies.
+const ClientKey = "e2e-client-key"
+
+// Options configures a harness instance.
+type Options struct {
+	// UpstreamKeys are the provider API keys registered against the mock provider,
+	// in registration order. Defaults to a single "upstream-key".
+	UpstreamKeys []string
+	// ExtraConfig is appended verbatim to the generated config.yaml.
+	ExtraConfig string
+}
+
+// Harness is a running proxy wired to mock dependencies.
+type Harness struct {
+	// BaseURL is the proxy root, e.g. http://127.0.0.1:PORT.
+	BaseURL string
+	// Provider is the mock upstream; nil when targeting an external stack.
+	Provider *mock.Provider
+	// Collector receives OTLP exports; nil when targeting an external stack.
+	Collector *mock.Collector
+	// Model is the alias clients should request. Each harness-managed proxy gets a
+	// unique alias because the model registry is process-global.
+	Model string
+}
+
+// External reports whether the harness targets a stack it did not start.
+func (h *Harness) External() bool { return h.Provider == nil }
+
+// Start launches a proxy for the duration of the test.
+func Start(t *testing.T, opts Options) *Harness {
+	t.Helper()
+	if base := strings.TrimRight(os.Getenv("E2E_BASE_URL"), "/"); base != "" {
+		model := strings.TrimSpace(os.Getenv("E2E_MODEL"))
+		if model == "" {
+			model = "e2e-model"
+		}
+		return &Harness{BaseURL: base, Model: model}
+	}
+	model := "e2e-" + strings.ToLower(strings.NewReplacer("/", "-", "_", "-").Replace(t.Name()))
+
+	keys := opts.UpstreamKeys
+	if len(keys) == 0 {
+		keys = []string{"upstream-key"}
+	}
+
+	provider := mock.NewProvider("mock-model")
+	providerServer := httptest.NewServer(provider)
+	t.Cleanup(providerServer.Close)
+
+	collector := mock.NewCollector()
+	collectorServer := httptest.NewServer(collector)
+	t.Cleanup(collectorServer.Close)
+
+	port := freePort(t)
+	dir := t.TempDir()
+	authDir := filepath.Join(dir, "auths")
+	if err := os.MkdirAll(authDir, 0o700); err != nil {
+		t.Fatalf("create auth dir: %v", err)
+	}
+
+	var cfgText strings.Builder
+	fmt.Fprintf(&cfgText, "host: 127.0.0.1\nport: %d\nauth-dir: %q\n", port, authDir)
+	fmt.Fprintf(&cfgText, "api-keys:\n  - %q\nrequest-retry: 0\n", ClientKey)
+	cfgText.WriteString("openai-compatibility:\n  - name: mock\n")
+	fmt.Fprintf(&cfgText, "    base-url: %q\n    api-key-entries:\n", providerServer.URL+"/v1")
+	for _, key := range keys {
+		fmt.Fprintf(&cfgText, "      - api-key: %q\n", key)
+	}
+	fmt.Fprintf(&cfgText, "    models:\n      - name: mock-model\n        alias: %s\n", model)
+	// Export every usage event at once so scenarios need not wait for a batch flush.
+	fmt.Fprintf(&cfgText, "otlp:\n  enabled: true\n  endpoint: %q\n  batch_size: 1\n", collectorServer.URL+"/v1/logs")
+	cfgText.WriteString(opts.ExtraConfig)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(cfgText.String()), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	configaccess.Register()
+	oidcaccess.Register()
+	svc, err := cliproxy.NewBuilder().WithConfig(cfg).WithConfigPath(configPath).Build()
+	if err != nil {
+		t.Fatalf("build service: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil && !errors.Is(err, context.Canceled) {
+				t.Logf("proxy exited: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Log("proxy did not stop within 10s")
+		}
+	})
+
+	h := &Harness{
+		BaseURL:   fmt.Sprintf("http://127.0.0.1:%d", port),
+		Provider:  provider,
+		Collector: collector,
+		Model:     model,
+	}
+	h.waitReady(t)
+	return h
+}
+
+// ChatBody returns a minimal chat completion request for the harness model.
+func (h *Harness) ChatBody(stream bool) string {
+	return fmt.Sprintf(`{"model":%q,"stream":%t,"messages":[{"role":"user","content":"ping"}]}`, h.Model, stream)
+}
+
+// Do sends an authenticated request to the proxy.
+func (h *Harness) Do(t *testing.T, method, path, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, h.BaseURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+ClientKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp
+}
+
+// Eventually polls cond until it returns true or the timeout elapses.
+func Eventually(t *testing.T, timeout time.Duration, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %s: %s", timeout, msg)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (h *Harness) waitReady(t *testing.T) {
+	t.Helper()
+	Eventually(t, 15*time.Second, func() bool {
+		req, _ := http.NewRequest(http.MethodGet, h.BaseURL+"/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+ClientKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode == http.StatusOK && strings.Contains(string(body), h.Model)
+	}, "proxy did not become ready")
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve port: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+	return l.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,56 @@
+package mock
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// Collector records OTLP/HTTP payloads posted to /v1/logs and /v1/traces.
+type Collector struct {
+	mu       sync.Mutex
+	payloads map[string][][]byte
+}
+
+// NewCollector constructs an empty collector.
+func NewCollector() *Collector {
+	return &Collector{payloads: make(map[string][][]byte)}
+}
+
+// ServeHTTP implements http.Handler.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.payloads[r.URL.Path] = append(c.payloads[r.URL.Path], body)
+	c.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// Payloads returns a copy of the bodies received on path (e.g. "/v1/logs").
+func (c *Collector) Payloads(path string) [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([][]byte, len(c.payloads[path]))
+	copy(out, c.payloads[path])
+	return out
+}
+
+// Events returns every event received on path. Each OTLP/HTTP export body is a JSON
+// array of events.
+func (c *Collector) Events(path string) []gjson.Result {
+	var out []gjson.Result
+	for _, payload := range c.Payloads(path) {
+		out = append(out, gjson.ParseBytes(payload).Array()...)
+	}
+	return out
+}
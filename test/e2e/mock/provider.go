@@ -0,0 +1,159 @@
+// Package mock provides fake upstream providers and telemetry collectors used by
+// the end-to-end test harness and the dockerized scenario stack.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failure describes how the provider answers requests authenticated with a given key.
+type Failure struct {
+	// Status is the HTTP status returned to the proxy.
+	Status int
+	// Body is the response payload; a generic OpenAI-style error is used when empty.
+	Body string
+}
+
+// Provider is an OpenAI-compatible upstream serving /v1/chat/completions and /v1/models.
+// Responses succeed unless a Failure is configured for the calling API key.
+type Provider struct {
+	// Model is echoed back in responses and listed by /v1/models.
+	Model string
+	// StreamChunks is the number of content deltas emitted for streaming requests.
+	StreamChunks int
+
+	mu       sync.Mutex
+	failures map[string]Failure
+	calls    map[string]int
+}
+
+// NewProvider constructs a provider that serves model.
+func NewProvider(model string) *Provider {
+	return &Provider{
+		Model:        model,
+		StreamChunks: 3,
+		failures:     make(map[string]Failure),
+		calls:        make(map[string]int),
+	}
+}
+
+// Fail configures requests using apiKey to fail with f. A zero Failure clears it.
+func (p *Provider) Fail(apiKey string, f Failure) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if f.Status == 0 {
+		delete(p.failures, apiKey)
+		return
+	}
+	p.failures[apiKey] = f
+}
+
+// Calls returns how many chat requests were received for apiKey.
+func (p *Provider) Calls(apiKey string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[apiKey]
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/models"):
+		p.serveModels(w)
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		p.serveChat(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Provider) serveModels(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"object": "list",
+		"data":   []map[string]any{{"id": p.Model, "object": "model", "owned_by": "mock"}},
+	})
+}
+
+func (p *Provider) serveChat(w http.ResponseWriter, r *http.Request) {
+	apiKey := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+
+	p.mu.Lock()
+	p.calls[apiKey]++
+	failure, failing := p.failures[apiKey]
+	p.mu.Unlock()
+
+	if failing {
+		body := failure.Body
+		if body == "" {
+			body = fmt.Sprintf(`{"error":{"message":"mock failure","type":"mock_error","code":%d}}`, failure.Status)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(failure.Status)
+		_, _ = w.Write([]byte(body))
+		return
+	}
+
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	if req.Stream {
+		p.serveStream(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":      "chatcmpl-mock",
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   p.Model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": "hello from mock"},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]any{"prompt_tokens": 5, "completion_tokens": 3, "total_tokens": 8},
+	})
+}
+
+func (p *Provider) serveStream(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	created := time.Now().Unix()
+	for i := 0; i < p.StreamChunks; i++ {
+		chunk, _ := json.Marshal(map[string]any{
+			"id":      "chatcmpl-mock",
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   p.Model,
+			"choices": []map[string]any{{
+				"index": 0,
+				"delta": map[string]any{"content": fmt.Sprintf("chunk-%d ", i)},
+			}},
+		})
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", chunk)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	final, _ := json.Marshal(map[string]any{
+		"id":      "chatcmpl-mock",
+		"object":  "chat.completion.chunk",
+		"created": created,
+		"model":   p.Model,
+		"choices": []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": "stop"}},
+		"usage":   map[string]any{"prompt_tokens": 5, "completion_tokens": p.StreamChunks, "total_tokens": 5 + p.StreamChunks},
+	})
+	_, _ = fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", final)
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,40 @@
+// Command mockprovider serves the e2e mock OpenAI-compatible upstream for the
+// dockerized scenario stack. Keys listed in MOCK_FAIL_KEYS (comma separated,
+// "key=status") receive the configured error status.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/test/e2e/mock"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	model := flag.String("model", "mock-model", "model name served by the provider")
+	flag.Parse()
+
+	provider := mock.NewProvider(*model)
+	for _, entry := range strings.Split(os.Getenv("MOCK_FAIL_KEYS"), ",") {
+		key, rawStatus, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		status, err := strconv.Atoi(rawStatus)
+		if err != nil {
+			log.Warnf("mockprovider: invalid status for key %q: %v", key, err)
+			continue
+		}
+		provider.Fail(key, mock.Failure{Status: status})
+	}
+
+	log.Infof("mockprovider: serving %s on %s", *model, *addr)
+	if err := http.ListenAndServe(*addr, provider); err != nil {
+		log.Fatalf("mockprovider: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/router-for-me/CLIProxyAPI/v6/test/e2e/mock"
+	"github.com/tidwall/gjson"
+)
+
+func TestFailoverToHealthyCredential(t *testing.T) {
+	h := Start(t, Options{UpstreamKeys: []string{"key-a", "key-b"}})
+	if h.External() {
+		t.Skip("failover scenario requires a harness-managed mock provider")
+	}
+	h.Provider.Fail("key-a", mock.Failure{Status: http.StatusInternalServerError})
+
+	// key-a is cooled down after its first failure, so key-b serves every request.
+	for i := 0; i < 3; i++ {
+		resp := h.Do(t, http.MethodPost, "/v1/chat/completions", h.ChatBody(false))
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d body %s", i, resp.StatusCode, body)
+		}
+		if got := gjson.GetBytes(body, "choices.0.message.content").String(); got != "hello from mock" {
+			t.Fatalf("request %d: unexpected content %q", i, got)
+		}
+	}
+	if h.Provider.Calls("key-b") != 3 {
+		t.Fatalf("expected healthy key to serve 3 requests, got %d", h.Provider.Calls("key-b"))
+	}
+}
+
+func TestAllCredentialsFailingSurfacesError(t *testing.T) {
+	h := Start(t, Options{UpstreamKeys: []string{"key-a"}})
+	if h.External() {
+		t.Skip("requires a harness-managed mock provider")
+	}
+	h.Provider.Fail("key-a", mock.Failure{Status: http.StatusTooManyRequests})
+
+	resp := h.Do(t, http.MethodPost, "/v1/chat/completions", h.ChatBody(false))
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 when every credential is rate limited, got %d", resp.StatusCode)
+	}
+}
+
+func TestStreamingPassesThroughChunks(t *testing.T) {
+	h := Start(t, Options{})
+	resp := h.Do(t, http.MethodPost, "/v1/chat/completions", h.ChatBody(true))
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	var content strings.Builder
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		data, ok := bytes.CutPrefix(line, []byte("data: "))
+		if !ok || bytes.Equal(data, []byte("[DONE]")) {
+			continue
+		}
+		content.WriteString(gjson.GetBytes(data, "choices.0.delta.content").String())
+	}
+	if got := content.String(); got != "chunk-0 chunk-1 chunk-2 " {
+		t.Fatalf("unexpected streamed content %q", got)
+	}
+	if !bytes.Contains(raw, []byte("data: [DONE]")) {
+		t.Fatal("stream did not terminate with [DONE]")
+	}
+}
+
+func TestUsageExportedToCollector(t *testing.T) {
+	h := Start(t, Options{})
+	if h.External() {
+		t.Skip("collector assertions require the in-process mock collector")
+	}
+	resp := h.Do(t, http.MethodPost, "/v1/chat/completions", h.ChatBody(false))
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	Eventually(t, 5*time.Second, func() bool {
+		for _, event := range h.Collector.Events("/v1/logs") {
+			if event.Get("event").String() == "usage.record" && event.Get("tokens.total").Int() == 8 {
+				return true
+			}
+		}
+		return false
+	}, "usage record was not exported to the collector")
+}